@@ -0,0 +1,114 @@
+// Package base58 implements the Base58 encoding of Bitcoin, the Base58Check
+// encoding that extended keys, legacy addresses and encrypted keys are
+// serialized with, and the Wallet Import Format of private keys:
+//
+//	s := base58.CheckEncode(append([]byte{0x00}, pubKeyHash...))
+//	wif, err := base58.DecodeWIF(s)
+//
+// Base58 writes a big-endian number in an alphabet that leaves out 0, O, I
+// and l, which are easily confused, with each leading zero byte written as a
+// 1. Base58Check appends the first 4 bytes of the double SHA-256 of the data
+// before encoding it.
+package base58
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+)
+
+// alphabet is the Bitcoin Base58 alphabet, which leaves out 0, O, I and l.
+const alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// ChecksumLen is the number of checksum bytes Base58Check appends.
+const ChecksumLen = 4
+
+var (
+	// ErrInvalidCharacter is returned when decoding a string with a
+	// character outside the alphabet.
+	ErrInvalidCharacter = errors.New("base58: invalid character")
+
+	// ErrChecksum is returned when decoding a string whose checksum
+	// doesn't match, or that is too short to have one.
+	ErrChecksum = errors.New("base58: bad checksum")
+)
+
+// Alphabet returns the Base58 alphabet, for callers that need to corrupt
+// encodings one character at a time.
+func Alphabet() string {
+	return alphabet
+}
+
+// Encode encodes data in Base58, with each leading zero byte encoded as a 1.
+func Encode(data []byte) string {
+	n := new(big.Int).SetBytes(data)
+	radix := big.NewInt(58)
+	mod := new(big.Int)
+	var out []byte
+	for n.Sign() > 0 {
+		n.DivMod(n, radix, mod)
+		out = append(out, alphabet[mod.Int64()])
+	}
+	for _, b := range data {
+		if b != 0 {
+			break
+		}
+		out = append(out, alphabet[0])
+	}
+
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out)
+}
+
+// Decode decodes a Base58 string, with each leading 1 decoded as a zero
+// byte.
+func Decode(s string) ([]byte, error) {
+	n := new(big.Int)
+	radix := big.NewInt(58)
+	for i := 0; i < len(s); i++ {
+		digit := bytes.IndexByte([]byte(alphabet), s[i])
+		if digit < 0 {
+			return nil, ErrInvalidCharacter
+		}
+		n.Mul(n, radix)
+		n.Add(n, big.NewInt(int64(digit)))
+	}
+
+	var zeros int
+	for zeros < len(s) && s[zeros] == alphabet[0] {
+		zeros++
+	}
+	return append(make([]byte, zeros), n.Bytes()...), nil
+}
+
+// checksum returns the first 4 bytes of the double SHA-256 of data.
+func checksum(data []byte) []byte {
+	first := sha256.Sum256(data)
+	second := sha256.Sum256(first[:])
+	return second[:ChecksumLen]
+}
+
+// CheckEncode encodes data with its checksum appended in Base58.
+func CheckEncode(data []byte) string {
+	return Encode(append(append([]byte(nil), data...), checksum(data)...))
+}
+
+// CheckDecode decodes a Base58 string and checks and strips its checksum.
+func CheckDecode(s string) ([]byte, error) {
+	data, err := Decode(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < ChecksumLen {
+		return nil, ErrChecksum
+	}
+
+	payload, sum := data[:len(data)-ChecksumLen], data[len(data)-ChecksumLen:]
+	if !bytes.Equal(checksum(payload), sum) {
+		return nil, ErrChecksum
+	}
+	return payload, nil
+}
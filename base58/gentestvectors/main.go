@@ -0,0 +1,259 @@
+// This program writes test vectors for the base58 package: the Base58
+// vectors of Bitcoin Core, followed by leading zero, single byte and random
+// vectors, to base58.json, well known and random WIF keys to wif.json, and
+// strings that must be rejected as WIF keys to wif-invalid.json. The random
+// vectors depend only on -seed and -count, so they can be regenerated by
+// anyone:
+//
+//	gentestvectors -count 1000 -seed 58
+//
+// The files use the layout of the BIP 158 vectors: a JSON array whose first
+// row names the columns, followed by one row per vector. Pass -check to
+// verify existing files against the package instead:
+//
+//	gentestvectors -check base58.json -check-wif wif.json \
+//		-check-invalid wif-invalid.json
+//
+// The program lives in a directory of its own since the base58 package sits
+// at the root of the module.
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/christsim/bips/base58"
+	"github.com/christsim/bips/internal/vectorfile"
+)
+
+const (
+	// vectorColumns, wifColumns and invalidColumns are the header rows of
+	// the vector files.
+	vectorColumns  = "Data,Encoded,Comment"
+	wifColumns     = "Key,Version,Compressed,WIF,Comment"
+	invalidColumns = "String,Error,Comment"
+)
+
+type JSONTestWriter struct {
+	writer          io.Writer
+	firstRowWritten bool
+}
+
+func NewJSONTestWriter(writer io.Writer) *JSONTestWriter {
+	return &JSONTestWriter{writer: writer}
+}
+
+func (w *JSONTestWriter) WriteComment(comment string) error {
+	return w.WriteTestCase([]interface{}{comment})
+}
+
+func (w *JSONTestWriter) WriteTestCase(row []interface{}) error {
+	var err error
+	if w.firstRowWritten {
+		_, err = io.WriteString(w.writer, ",\n")
+	} else {
+		_, err = io.WriteString(w.writer, "[\n")
+		w.firstRowWritten = true
+	}
+	if err != nil {
+		return err
+	}
+
+	rowBytes, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.writer.Write(rowBytes)
+	return err
+}
+
+func (w *JSONTestWriter) Close() error {
+	if !w.firstRowWritten {
+		return nil
+	}
+
+	_, err := io.WriteString(w.writer, "\n]\n")
+	return err
+}
+
+func main() {
+	out := flag.String("out", "base58.json", "file to write the Base58 "+
+		"vectors to")
+	wifOut := flag.String("wif-out", "wif.json", "file to write the WIF "+
+		"keys to")
+	invalidOut := flag.String("invalid-out", "wif-invalid.json", "file to "+
+		"write the invalid WIF keys to")
+	count := flag.Int("count", 100, "number of random vectors to write, "+
+		"in each file")
+	seed := flag.Int64("seed", 58, "seed of the random vectors")
+	check := flag.String("check", "", "Base58 vector file to check "+
+		"instead of writing one")
+	checkWIF := flag.String("check-wif", "", "WIF key file to check "+
+		"instead of writing one")
+	checkInvalid := flag.String("check-invalid", "", "invalid WIF key "+
+		"file to check instead of writing one")
+	flag.Parse()
+
+	var err error
+	if *check != "" || *checkWIF != "" || *checkInvalid != "" {
+		err = checkFiles(*check, *checkWIF, *checkInvalid)
+	} else {
+		err = writeFiles(*out, *wifOut, *invalidOut, *seed, *count)
+	}
+	if err != nil {
+		fmt.Println("Error: ", err.Error())
+		os.Exit(1)
+	}
+}
+
+// writeRows writes the header and rows to a new vector file at path.
+func writeRows(path, columns string, rows [][]interface{}) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := NewJSONTestWriter(file)
+	if err := writer.WriteComment(columns); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if err := writer.WriteTestCase(row); err != nil {
+			return err
+		}
+	}
+	return writer.Close()
+}
+
+// writeFiles writes the Base58 vectors to out, the WIF keys to wifOut and
+// the invalid WIF keys to invalidOut.
+func writeFiles(out, wifOut, invalidOut string, seed int64, count int) error {
+	var rows [][]interface{}
+	vectors := base58.Vectors(seed, count)
+	for _, v := range vectors {
+		rows = append(rows, []interface{}{
+			hex.EncodeToString(v.Data),
+			v.Encoded,
+			v.Comment,
+		})
+	}
+	if err := writeRows(out, vectorColumns, rows); err != nil {
+		return err
+	}
+
+	rows = nil
+	wifs := base58.WIFVectors(seed, count)
+	for _, v := range wifs {
+		rows = append(rows, []interface{}{
+			hex.EncodeToString(v.Key),
+			fmt.Sprintf("0x%02x", v.Version),
+			strconv.FormatBool(v.Compressed),
+			v.WIF,
+			v.Comment,
+		})
+	}
+	if err := writeRows(wifOut, wifColumns, rows); err != nil {
+		return err
+	}
+
+	rows = nil
+	invalid := base58.InvalidVectors()
+	for _, v := range invalid {
+		rows = append(rows, []interface{}{
+			v.String,
+			v.Err.Error(),
+			v.Comment,
+		})
+	}
+	if err := writeRows(invalidOut, invalidColumns, rows); err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote %d vectors, %d WIF keys and %d invalid WIF keys\n",
+		len(vectors), len(wifs), len(invalid))
+	return nil
+}
+
+// checkFiles checks each vector of the Base58 vector file with
+// base58.CheckVector, each key of the WIF key file with
+// base58.CheckWIFVector, and each string of the invalid WIF key file with
+// base58.CheckInvalidVector. Any path may be empty to skip that file.
+func checkFiles(path, wifPath, invalidPath string) error {
+	if path != "" {
+		rows, err := vectorfile.ReadStringRows(path, 3)
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			data, err := hex.DecodeString(row[0])
+			if err != nil {
+				return fmt.Errorf("%v: %v", row[2], err)
+			}
+			err = base58.CheckVector(base58.Vector{
+				Data:    data,
+				Encoded: row[1],
+			})
+			if err != nil {
+				return fmt.Errorf("%v: %v", row[2], err)
+			}
+		}
+		fmt.Printf("%d vectors OK\n", len(rows))
+	}
+
+	if wifPath != "" {
+		rows, err := vectorfile.ReadStringRows(wifPath, 5)
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			key, err := hex.DecodeString(row[0])
+			if err != nil {
+				return fmt.Errorf("%v: %v", row[4], err)
+			}
+			version, err := strconv.ParseUint(row[1], 0, 8)
+			if err != nil {
+				return fmt.Errorf("%v: %v", row[4], err)
+			}
+			compressed, err := strconv.ParseBool(row[2])
+			if err != nil {
+				return fmt.Errorf("%v: %v", row[4], err)
+			}
+			err = base58.CheckWIFVector(base58.WIFVector{
+				Key:        key,
+				Version:    byte(version),
+				Compressed: compressed,
+				WIF:        row[3],
+			})
+			if err != nil {
+				return fmt.Errorf("%v: %v", row[4], err)
+			}
+		}
+		fmt.Printf("%d WIF keys OK\n", len(rows))
+	}
+
+	if invalidPath != "" {
+		rows, err := vectorfile.ReadStringRows(invalidPath, 3)
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			err := base58.CheckInvalidVector(base58.InvalidVector{
+				String: row[0],
+				Err:    errors.New(row[1]),
+			})
+			if err != nil {
+				return fmt.Errorf("%v: %v", row[2], err)
+			}
+		}
+		fmt.Printf("%d invalid WIF keys OK\n", len(rows))
+	}
+	return nil
+}
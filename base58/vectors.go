@@ -0,0 +1,375 @@
+package base58
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+)
+
+// ErrVectorMismatch is returned by the vector checks when encoding or
+// decoding a vector doesn't give the expected result.
+var ErrVectorMismatch = errors.New("base58: vector mismatch")
+
+// Vector is data and its Base58 encoding.
+type Vector struct {
+	Data    []byte
+	Encoded string
+
+	// Comment describes where the vector comes from.
+	Comment string
+}
+
+// WIFVector is a private key and its encoding in the Wallet Import Format.
+type WIFVector struct {
+	Key        []byte
+	Version    byte
+	Compressed bool
+	WIF        string
+
+	// Comment describes where the vector comes from.
+	Comment string
+}
+
+// InvalidVector is a string DecodeWIF must reject with the error.
+type InvalidVector struct {
+	String string
+	Err    error
+
+	// Comment describes what's wrong with the string.
+	Comment string
+}
+
+// specVectors are the Base58 vectors of Bitcoin Core's
+// base58_encode_decode.json, as hex data and encoding.
+var specVectors = [][2]string{
+	{"", ""},
+	{"61", "2g"},
+	{"626262", "a3gV"},
+	{"636363", "aPEr"},
+	{"73696d706c792061206c6f6e6720737472696e67",
+		"2cFupjhnEsSn59qHXstmK2ffpLv2"},
+	{"00eb15231dfceb60925886b67d065299925915aeb172c06647",
+		"1NS17iag9jJgTHD1VXjvLCEnZuQ3rJDE9L"},
+	{"516b6fcd0f", "ABnLTmg"},
+	{"bf4f89001e670274dd", "3SEo3LWLoPntC"},
+	{"572e4794", "3EFU7m"},
+	{"ecac89cad93923c02321", "EJDM8drfXA6uyA"},
+	{"10c8511e", "Rt5zm"},
+	{"00000000000000000000", "1111111111"},
+}
+
+// specWIFVectors are private keys with well known WIF encodings.
+var specWIFVectors = []struct {
+	key        string
+	version    byte
+	compressed bool
+	wif        string
+	comment    string
+}{
+	{
+		key: "0c28fca386c7a227600b2fe50b7cae11ec86d3bf1fbe471be89827e1" +
+			"9d72aa1d",
+		version: MainnetWIF,
+		wif:     "5HueCGU8rMjxEXxiPuD5BDku4MkFqeZyd4dZ1jvhTVqvbTLvyTJ",
+		comment: "Bitcoin wiki WIF example",
+	},
+	{
+		key: "0c28fca386c7a227600b2fe50b7cae11ec86d3bf1fbe471be89827e1" +
+			"9d72aa1d",
+		version:    MainnetWIF,
+		compressed: true,
+		wif:        "KwdMAjGmerYanjeui5SHS7JkmpZvVipYvB2LJGU1ZxJwYvP98617",
+		comment:    "Bitcoin wiki WIF example, compressed",
+	},
+	{
+		key: "00000000000000000000000000000000000000000000000000000000" +
+			"00000001",
+		version: MainnetWIF,
+		wif:     "5HpHagT65TZzG1PH3CSu63k8DbpvD8s5ip4nEB3kEsreAnchuDf",
+		comment: "Private key 1, uncompressed",
+	},
+	{
+		key: "00000000000000000000000000000000000000000000000000000000" +
+			"00000001",
+		version:    MainnetWIF,
+		compressed: true,
+		wif:        "KwDiBf89QgGbjEhKnhXJuH7LrciVrZi3qYjgd9M7rFU73sVHnoWn",
+		comment:    "Private key 1, compressed",
+	},
+	{
+		key: "00000000000000000000000000000000000000000000000000000000" +
+			"00000001",
+		version:    TestnetWIF,
+		compressed: true,
+		wif:        "cMahea7zqjxrtgAbB7LSGbcQUr1uX1ojuat9jZodMN87JcbXMTcA",
+		comment:    "Private key 1, compressed, testnet",
+	},
+}
+
+// SpecVectors returns the Base58 vectors of Bitcoin Core.
+func SpecVectors() []Vector {
+	vectors := make([]Vector, 0, len(specVectors))
+	for _, sv := range specVectors {
+		data, err := hex.DecodeString(sv[0])
+		if err != nil {
+			panic(err)
+		}
+		vectors = append(vectors, Vector{
+			Data:    data,
+			Encoded: sv[1],
+			Comment: "Bitcoin Core base58_encode_decode.json",
+		})
+	}
+	return vectors
+}
+
+// Vectors returns the vectors of Bitcoin Core, followed by data with every
+// number of leading zero bytes up to 8 in front of a single byte and in
+// front of nothing, every single byte value, and count random byte strings
+// of up to 64 bytes derived from a math/rand source with the seed.
+func Vectors(rngSeed int64, count int) []Vector {
+	vectors := SpecVectors()
+	add := func(data []byte, comment string) {
+		vectors = append(vectors, Vector{
+			Data:    data,
+			Encoded: Encode(data),
+			Comment: comment,
+		})
+	}
+	for zeros := 1; zeros <= 8; zeros++ {
+		add(make([]byte, zeros), fmt.Sprintf("%d zero bytes", zeros))
+		add(append(make([]byte, zeros), 0xff), fmt.Sprintf("%d zero "+
+			"bytes before 0xff", zeros))
+	}
+	for b := 1; b < 256; b++ {
+		add([]byte{byte(b)}, fmt.Sprintf("byte 0x%02x", b))
+	}
+
+	rng := rand.New(rand.NewSource(rngSeed))
+	for i := 0; i < count; i++ {
+		data := make([]byte, rng.Intn(65))
+		rng.Read(data)
+
+		// Give one string in four leading zero bytes.
+		if rng.Intn(4) == 0 {
+			for j := rng.Intn(4); j >= 0 && j < len(data); j-- {
+				data[j] = 0
+			}
+		}
+		add(data, fmt.Sprintf("random %d bytes", len(data)))
+	}
+	return vectors
+}
+
+// CheckVector encodes the vector's data and decodes its encoding, and checks
+// that both give the other back.
+func CheckVector(v Vector) error {
+	if s := Encode(v.Data); s != v.Encoded {
+		return fmt.Errorf("%w: encoded as %v, expected %v",
+			ErrVectorMismatch, s, v.Encoded)
+	}
+	data, err := Decode(v.Encoded)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(data, v.Data) {
+		return fmt.Errorf("%w: decoded as %x, expected %x",
+			ErrVectorMismatch, data, v.Data)
+	}
+	return nil
+}
+
+// maxKey is the highest valid private key, one below the curve order.
+const maxKey = "fffffffffffffffffffffffffffffffebaaedce6af48a03bbfd25e8cd0364140"
+
+// WIFVectors returns the well known WIF keys, followed by the lowest and
+// highest private keys and count random keys derived from a math/rand source
+// with the seed, each on both networks and with both compression flags.
+func WIFVectors(rngSeed int64, count int) []WIFVector {
+	var vectors []WIFVector
+	for _, sv := range specWIFVectors {
+		key, err := hex.DecodeString(sv.key)
+		if err != nil {
+			panic(err)
+		}
+		vectors = append(vectors, WIFVector{
+			Key:        key,
+			Version:    sv.version,
+			Compressed: sv.compressed,
+			WIF:        sv.wif,
+			Comment:    sv.comment,
+		})
+	}
+
+	add := func(key []byte, comment string) {
+		for _, version := range []byte{MainnetWIF, TestnetWIF} {
+			for _, compressed := range []bool{false, true} {
+				wif, err := EncodeWIF(key, version, compressed)
+				if err != nil {
+					panic(err)
+				}
+				vectors = append(vectors, WIFVector{
+					Key:        key,
+					Version:    version,
+					Compressed: compressed,
+					WIF:        wif,
+					Comment:    comment,
+				})
+			}
+		}
+	}
+	one := make([]byte, PrivateKeyLen)
+	one[PrivateKeyLen-1] = 1
+	add(one, "lowest private key")
+	highest, err := hex.DecodeString(maxKey)
+	if err != nil {
+		panic(err)
+	}
+	add(highest, "highest private key")
+
+	rng := rand.New(rand.NewSource(rngSeed))
+	for i := 0; i < count; i++ {
+		key := make([]byte, PrivateKeyLen)
+		rng.Read(key)
+		if checkPrivateKey(key) != nil {
+			continue
+		}
+		add(key, "random private key")
+	}
+	return vectors
+}
+
+// CheckWIFVector encodes the vector's key and decodes its WIF string, and
+// checks that both give the other back.
+func CheckWIFVector(v WIFVector) error {
+	wif, err := EncodeWIF(v.Key, v.Version, v.Compressed)
+	if err != nil {
+		return err
+	}
+	if wif != v.WIF {
+		return fmt.Errorf("%w: encoded as %v, expected %v",
+			ErrVectorMismatch, wif, v.WIF)
+	}
+
+	decoded, err := DecodeWIF(v.WIF)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(decoded.Key, v.Key) || decoded.Version != v.Version ||
+		decoded.Compressed != v.Compressed {
+
+		return fmt.Errorf("%w: decoded as key %x, version 0x%02x, "+
+			"compressed %v", ErrVectorMismatch, decoded.Key,
+			decoded.Version, decoded.Compressed)
+	}
+	return nil
+}
+
+// InvalidVectors returns strings that DecodeWIF must reject: encodings with
+// characters outside the alphabet, broken checksums, payloads of the wrong
+// length or with a wrong compression flag, and keys out of range.
+func InvalidVectors() []InvalidVector {
+	valid := specWIFVectors[0].wif
+	key, err := hex.DecodeString(specWIFVectors[0].key)
+	if err != nil {
+		panic(err)
+	}
+	payload := append([]byte{MainnetWIF}, key...)
+
+	vectors := make([]InvalidVector, 0, 16)
+	for _, c := range "0OIl+" {
+		vectors = append(vectors, InvalidVector{
+			String: valid[:10] + string(c) + valid[11:],
+			Err:    ErrInvalidCharacter,
+			Comment: fmt.Sprintf("character %q outside the alphabet",
+				c),
+		})
+	}
+
+	last := strings.IndexByte(alphabet, valid[len(valid)-1])
+	vectors = append(vectors,
+		InvalidVector{
+			String:  valid[:len(valid)-1] + string(alphabet[(last+1)%58]),
+			Err:     ErrChecksum,
+			Comment: "last character changed",
+		},
+		InvalidVector{
+			String:  "",
+			Err:     ErrChecksum,
+			Comment: "empty string",
+		},
+		InvalidVector{
+			String:  Encode([]byte{1, 2, 3}),
+			Err:     ErrChecksum,
+			Comment: "shorter than a checksum",
+		},
+		InvalidVector{
+			String:  CheckEncode(payload[:len(payload)-1]),
+			Err:     ErrInvalidWIFLen,
+			Comment: "31 byte key",
+		},
+		InvalidVector{
+			String:  CheckEncode(append(payload, 0x01, 0x01)),
+			Err:     ErrInvalidWIFLen,
+			Comment: "two compression flags",
+		},
+		InvalidVector{
+			String:  CheckEncode(append(payload, 0x02)),
+			Err:     ErrInvalidCompressFlag,
+			Comment: "compression flag 0x02",
+		},
+		InvalidVector{
+			String:  CheckEncode(append(payload, 0x10)),
+			Err:     ErrInvalidCompressFlag,
+			Comment: "BIP 178 P2PKH suffix 0x10",
+		},
+	)
+
+	high, err := hex.DecodeString(maxKey)
+	if err != nil {
+		panic(err)
+	}
+	order := append([]byte(nil), high...)
+	order[PrivateKeyLen-1]++
+	for _, bad := range []struct {
+		key     []byte
+		comment string
+	}{
+		{make([]byte, PrivateKeyLen), "zero key"},
+		{order, "key equal to the curve order"},
+		{bytes.Repeat([]byte{0xff}, PrivateKeyLen), "key above the " +
+			"curve order"},
+	} {
+		for _, compressed := range []bool{false, true} {
+			data := append([]byte{MainnetWIF}, bad.key...)
+			comment := bad.comment + ", uncompressed"
+			if compressed {
+				data = append(data, compressedFlag)
+				comment = bad.comment + ", compressed"
+			}
+			vectors = append(vectors, InvalidVector{
+				String:  CheckEncode(data),
+				Err:     ErrInvalidPrivateKey,
+				Comment: comment,
+			})
+		}
+	}
+	return vectors
+}
+
+// CheckInvalidVector checks that DecodeWIF rejects the vector's string with
+// its error.
+func CheckInvalidVector(v InvalidVector) error {
+	_, err := DecodeWIF(v.String)
+	if err == nil {
+		return fmt.Errorf("%w: %q accepted", ErrVectorMismatch, v.String)
+	}
+	if err.Error() != v.Err.Error() {
+		return fmt.Errorf("%w: got %v, expected %v", ErrVectorMismatch,
+			err, v.Err)
+	}
+	return nil
+}
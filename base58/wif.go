@@ -0,0 +1,114 @@
+package base58
+
+import (
+	"errors"
+	"math/big"
+)
+
+// Version bytes of WIF private keys.
+const (
+	MainnetWIF byte = 0x80
+	TestnetWIF byte = 0xef
+)
+
+// PrivateKeyLen is the length of a private key.
+const PrivateKeyLen = 32
+
+// compressedFlag is the suffix of keys whose public key is compressed.
+const compressedFlag = 0x01
+
+// curveOrder is the order of the secp256k1 group, which private keys must be
+// below.
+var curveOrder, _ = new(big.Int).SetString("fffffffffffffffffffffffffffffff"+
+	"ebaaedce6af48a03bbfd25e8cd0364141", 16)
+
+var (
+	// ErrInvalidWIFLen is returned when decoding a WIF key whose payload
+	// is neither 33 nor 34 bytes.
+	ErrInvalidWIFLen = errors.New("base58: WIF payload must be 33 or 34 " +
+		"bytes")
+
+	// ErrInvalidCompressFlag is returned when decoding a 34 byte WIF key
+	// whose last byte isn't 0x01.
+	ErrInvalidCompressFlag = errors.New("base58: invalid WIF compression " +
+		"flag")
+
+	// ErrInvalidPrivateKey is returned for a private key that isn't 32
+	// bytes, or is zero or not below the curve order.
+	ErrInvalidPrivateKey = errors.New("base58: invalid private key")
+)
+
+// WIF is a private key in the Wallet Import Format: a version byte naming
+// the network, the 32 byte key, and a flag telling whether its public key is
+// serialized compressed.
+type WIF struct {
+	Version    byte
+	Key        []byte
+	Compressed bool
+}
+
+// checkPrivateKey checks that the key is 32 bytes and a valid scalar.
+func checkPrivateKey(key []byte) error {
+	if len(key) != PrivateKeyLen {
+		return ErrInvalidPrivateKey
+	}
+	k := new(big.Int).SetBytes(key)
+	if k.Sign() == 0 || k.Cmp(curveOrder) >= 0 {
+		return ErrInvalidPrivateKey
+	}
+	return nil
+}
+
+// EncodeWIF encodes a private key in the Wallet Import Format with the
+// version byte of its network.
+func EncodeWIF(key []byte, version byte, compressed bool) (string, error) {
+	if err := checkPrivateKey(key); err != nil {
+		return "", err
+	}
+	data := append([]byte{version}, key...)
+	if compressed {
+		data = append(data, compressedFlag)
+	}
+	return CheckEncode(data), nil
+}
+
+// DecodeWIF decodes a private key in the Wallet Import Format. The version
+// byte is returned as is, for the caller to check against its network.
+func DecodeWIF(s string) (*WIF, error) {
+	data, err := CheckDecode(s)
+	if err != nil {
+		return nil, err
+	}
+
+	var compressed bool
+	switch len(data) {
+	case 1 + PrivateKeyLen:
+	case 1 + PrivateKeyLen + 1:
+		if data[len(data)-1] != compressedFlag {
+			return nil, ErrInvalidCompressFlag
+		}
+		compressed = true
+	default:
+		return nil, ErrInvalidWIFLen
+	}
+
+	key := data[1 : 1+PrivateKeyLen]
+	if err := checkPrivateKey(key); err != nil {
+		return nil, err
+	}
+	return &WIF{
+		Version:    data[0],
+		Key:        append([]byte(nil), key...),
+		Compressed: compressed,
+	}, nil
+}
+
+// String encodes the key in the Wallet Import Format, or returns an empty
+// string if it isn't valid.
+func (w *WIF) String() string {
+	s, err := EncodeWIF(w.Key, w.Version, w.Compressed)
+	if err != nil {
+		return ""
+	}
+	return s
+}
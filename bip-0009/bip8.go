@@ -0,0 +1,159 @@
+package versionbits
+
+import "fmt"
+
+// BIP8Deployment is a BIP 8 deployment, whose start and timeout are heights
+// and which can lock in on its timeout.
+type BIP8Deployment struct {
+	// Bit is the bit of the version blocks signal with.
+	Bit uint8
+
+	// StartHeight is the height of the first period blocks signal in,
+	// and TimeoutHeight that of the first period after the deployment
+	// fails if it hasn't locked in. Both are multiples of the period.
+	StartHeight   int32
+	TimeoutHeight int32
+
+	// LockInOnTimeout makes the blocks of the period before the timeout
+	// signal, rather than the deployment fail.
+	LockInOnTimeout bool
+
+	// MinActivationHeight is the lowest height it becomes active at.
+	MinActivationHeight int32
+
+	// Period is the number of blocks of a period, and Threshold the
+	// number of them that must signal for it to lock in.
+	Period    int32
+	Threshold int32
+}
+
+// Validate checks the bit, period and threshold of the deployment, and that
+// its start and timeout are multiples of the period with the timeout after
+// the start.
+func (d *BIP8Deployment) Validate() error {
+	if d.Bit > MaxBit {
+		return fmt.Errorf("%w: bit %d", ErrInvalidDeployment, d.Bit)
+	}
+	if d.Period <= 0 || d.Threshold <= 0 || d.Threshold > d.Period {
+		return fmt.Errorf("%w: threshold %d of %d",
+			ErrInvalidDeployment, d.Threshold, d.Period)
+	}
+	if d.StartHeight < 0 || d.StartHeight%d.Period != 0 ||
+		d.TimeoutHeight%d.Period != 0 ||
+		d.TimeoutHeight <= d.StartHeight {
+
+		return fmt.Errorf("%w: start height %d, timeout height %d, "+
+			"period %d", ErrInvalidDeployment, d.StartHeight,
+			d.TimeoutHeight, d.Period)
+	}
+	return nil
+}
+
+// Window returns the number of blocks of a period.
+func (d *BIP8Deployment) Window() int32 {
+	return d.Period
+}
+
+// Signals reports whether a block of the version signals for the
+// deployment.
+func (d *BIP8Deployment) Signals(version int32) bool {
+	return signals(d.Bit, version)
+}
+
+// Initial returns the state of the first period, DEFINED.
+func (d *BIP8Deployment) Initial() State {
+	return Defined
+}
+
+// Next returns the state of the period after p, which depends on the height
+// of its first block.
+func (d *BIP8Deployment) Next(p *Period) State {
+	height := p.StartHeight + p.Blocks
+	switch p.State {
+	case Defined:
+		if height >= d.StartHeight {
+			return Started
+		}
+	case Started:
+		if p.Signalling >= d.Threshold {
+			return LockedIn
+		}
+		if d.LockInOnTimeout && height+d.Period >= d.TimeoutHeight {
+			return MustSignal
+		}
+		if height >= d.TimeoutHeight {
+			return Failed
+		}
+	case MustSignal:
+		return LockedIn
+	case LockedIn:
+		if height >= d.MinActivationHeight {
+			return Active
+		}
+	}
+	return p.State
+}
+
+// Invalid reports whether the next block of the period p, of the version,
+// is invalid: in a MUST_SIGNAL period, one that doesn't signal once more
+// blocks than the period less the threshold haven't.
+func (d *BIP8Deployment) Invalid(p *Period, version int32) bool {
+	if p.State != MustSignal || d.Signals(version) {
+		return false
+	}
+	return p.Blocks-p.Signalling+1 > d.Period-d.Threshold
+}
+
+// Comparison is a period of blocks simulated under several conditions.
+type Comparison struct {
+	// Index is the number of periods before it, and StartHeight the
+	// height of its first block.
+	Index       int
+	StartHeight int32
+
+	// Blocks is the number of its blocks simulated, and
+	// EndMedianTimePast the median time past of the last.
+	Blocks            int32
+	EndMedianTimePast int64
+
+	// States, Signalling and Invalid are the state of the period and
+	// the number of its blocks that signal and are invalid under each
+	// condition, in order.
+	States     []State
+	Signalling []int32
+	Invalid    []int32
+}
+
+// Compare simulates the blocks under each of the conditions, which must have
+// periods of the same number of blocks, and returns the periods side by
+// side.
+func Compare(blocks []Block, conditions ...Condition) ([]Comparison,
+	error) {
+
+	var comparisons []Comparison
+	for i, c := range conditions {
+		if c.Window() != conditions[0].Window() {
+			return nil, fmt.Errorf("%w: period %d of condition "+
+				"%d, %d of the first", ErrInvalidDeployment,
+				c.Window(), i, conditions[0].Window())
+		}
+		periods, err := Simulate(c, blocks)
+		if err != nil {
+			return nil, err
+		}
+		if comparisons == nil {
+			comparisons = make([]Comparison, len(periods))
+		}
+		for j, p := range periods {
+			cmp := &comparisons[j]
+			cmp.Index = p.Index
+			cmp.StartHeight = p.StartHeight
+			cmp.Blocks = p.Blocks
+			cmp.EndMedianTimePast = p.EndMedianTimePast
+			cmp.States = append(cmp.States, p.State)
+			cmp.Signalling = append(cmp.Signalling, p.Signalling)
+			cmp.Invalid = append(cmp.Invalid, p.Invalid)
+		}
+	}
+	return comparisons, nil
+}
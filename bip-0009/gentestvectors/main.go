@@ -0,0 +1,469 @@
+// This program writes test vectors for the versionbits package to
+// states.json: the states of the periods of BIP 9 deployments of mainnet's
+// periods and threshold that lock in and activate, fail, lock in at the
+// timeout, wait for their minimum activation height, and are signalled for
+// when it doesn't count or by versions that don't signal, followed by
+// random deployments of short periods with random signalling. It writes
+// those of BIP 8 deployments, with and without lock-in on timeout, that
+// lock in, fail or must signal, with enough blocks signalling and too few,
+// followed by random ones, to bip8-states.json. The vectors depend only on
+// -seed and -count, so they can be regenerated by anyone:
+//
+//	gentestvectors -count 50 -seed 9
+//
+// Both files use the layout of the BIP 158 vectors: a JSON array whose
+// first row names the columns, followed by one row per vector. Each vector
+// is a deployment and a synthetic chain, given by the number of blocks of
+// each period that signal with the version, the first of the period, and
+// for BIP 9 the median time past of its blocks, and the states of its
+// periods and of the one after them, along with the number of blocks of
+// each that are invalid for BIP 8. Pass -check and -check-bip8 to verify
+// existing files against the package instead:
+//
+//	gentestvectors -check states.json -check-bip8 bip8-states.json
+//
+// Pass -replay to simulate a deployment over a chain of real headers
+// instead, read as hex, one per line from the genesis block, and write the
+// periods to the output as JSON:
+//
+//	gentestvectors -replay headers.txt -bit 1 -start 1479168000 \
+//		-timeout 1510704000 -out segwit.json
+//
+// Pass -compare to simulate the same chain, of real headers with -replay or
+// else of the synthetic periods of -signalling, under a BIP 9 deployment
+// and the BIP 8 deployment of -start-height and -timeout-height, without
+// and with lock-in on timeout, and write the periods side by side to the
+// output as JSON:
+//
+//	gentestvectors -compare -signalling 0,1800,1800,0,0,0,0 -start \
+//		1600000000 -timeout 1602419200 -start-height 2016 \
+//		-timeout-height 10080 -threshold 1815 -out timeline.json
+//
+// The program lives in a directory of its own since the versionbits package
+// sits at the root of the module.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcd/wire"
+	versionbits "github.com/christsim/bips/bip-0009"
+	"github.com/christsim/bips/internal/vectorfile"
+)
+
+// stateColumns is the header row of the vector file.
+const stateColumns = "Bit,Start Time,Timeout,Min Activation Height,Period," +
+	"Threshold,Version,Signalling,End Times,States,Comment"
+
+// bip8Columns is the header row of the BIP 8 vector file.
+const bip8Columns = "Bit,Start Height,Timeout Height,Lock In On Timeout," +
+	"Min Activation Height,Period,Threshold,Version,Signalling,States," +
+	"Invalid,Comment"
+
+// syntheticSpacing is the number of seconds between the blocks of the
+// synthetic chains of -compare.
+const syntheticSpacing = 600
+
+type JSONTestWriter struct {
+	writer          io.Writer
+	firstRowWritten bool
+}
+
+func NewJSONTestWriter(writer io.Writer) *JSONTestWriter {
+	return &JSONTestWriter{writer: writer}
+}
+
+func (w *JSONTestWriter) WriteComment(comment string) error {
+	return w.WriteTestCase([]interface{}{comment})
+}
+
+func (w *JSONTestWriter) WriteTestCase(row []interface{}) error {
+	var err error
+	if w.firstRowWritten {
+		_, err = io.WriteString(w.writer, ",\n")
+	} else {
+		_, err = io.WriteString(w.writer, "[\n")
+		w.firstRowWritten = true
+	}
+	if err != nil {
+		return err
+	}
+
+	rowBytes, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.writer.Write(rowBytes)
+	return err
+}
+
+func (w *JSONTestWriter) Close() error {
+	if !w.firstRowWritten {
+		return nil
+	}
+
+	_, err := io.WriteString(w.writer, "\n]\n")
+	return err
+}
+
+func main() {
+	out := flag.String("out", "states.json", "file to write the vectors, "+
+		"or the periods of -replay or -compare, to")
+	bip8Out := flag.String("bip8-out", "bip8-states.json", "file to "+
+		"write the BIP 8 vectors to")
+	count := flag.Int("count", 50, "number of random deployments to "+
+		"write vectors of")
+	seed := flag.Int64("seed", 9, "seed of the random vectors")
+	check := flag.String("check", "", "vector file to check instead of "+
+		"writing one")
+	checkBIP8 := flag.String("check-bip8", "", "BIP 8 vector file to "+
+		"check instead of writing one")
+	compare := flag.Bool("compare", false, "simulate the chain under "+
+		"BIP 9 and BIP 8 side by side instead of writing vectors")
+	signalling := flag.String("signalling", "", "comma separated "+
+		"signalling blocks of each period of the chain to compare, "+
+		"without -replay")
+	firstTime := flag.Int64("time", 1600000000, "median time past of "+
+		"the blocks of the first period of the chain to compare, "+
+		"without -replay")
+	replay := flag.String("replay", "", "file of headers to simulate the "+
+		"deployment over instead of writing vectors")
+	bit := flag.Uint("bit", 0, "bit of the deployment to replay")
+	start := flag.Int64("start", 0, "start time of the deployment to "+
+		"replay")
+	timeout := flag.Int64("timeout", 0, "timeout of the deployment to "+
+		"replay")
+	minHeight := flag.Int("min-activation-height", 0, "minimum "+
+		"activation height of the deployment to replay")
+	period := flag.Int("period", versionbits.DefaultPeriod, "blocks of a "+
+		"period of the deployment to replay")
+	threshold := flag.Int("threshold", versionbits.DefaultThreshold,
+		"signalling blocks of a period the deployment to replay needs")
+	startHeight := flag.Int("start-height", 0, "start height of the "+
+		"BIP 8 deployment to compare")
+	timeoutHeight := flag.Int("timeout-height", 0, "timeout height of "+
+		"the BIP 8 deployment to compare")
+	flag.Parse()
+
+	d := &versionbits.Deployment{
+		Bit:                 uint8(*bit),
+		StartTime:           *start,
+		Timeout:             *timeout,
+		MinActivationHeight: int32(*minHeight),
+		Period:              int32(*period),
+		Threshold:           int32(*threshold),
+	}
+	bip8 := &versionbits.BIP8Deployment{
+		Bit:                 d.Bit,
+		StartHeight:         int32(*startHeight),
+		TimeoutHeight:       int32(*timeoutHeight),
+		MinActivationHeight: d.MinActivationHeight,
+		Period:              d.Period,
+		Threshold:           d.Threshold,
+	}
+	var err error
+	switch {
+	case *check != "" || *checkBIP8 != "":
+		if *check != "" {
+			err = checkFile(*check)
+		}
+		if err == nil && *checkBIP8 != "" {
+			err = checkBIP8File(*checkBIP8)
+		}
+	case *compare:
+		var blocks []versionbits.Block
+		if *replay != "" {
+			blocks, err = replayBlocks(*replay)
+		} else {
+			blocks, err = syntheticBlocks(d, *signalling,
+				*firstTime)
+		}
+		if err == nil {
+			err = compareFile(blocks, *out, d, bip8)
+		}
+	case *replay != "":
+		err = replayFile(*replay, *out, d)
+	default:
+		err = writeFile(*out, *seed, *count)
+		if err == nil {
+			err = writeBIP8File(*bip8Out, *seed, *count)
+		}
+	}
+	if err != nil {
+		fmt.Println("Error: ", err.Error())
+		os.Exit(1)
+	}
+}
+
+// writeFile writes the vectors, with count random ones, to out.
+func writeFile(out string, seed int64, count int) error {
+	file, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := NewJSONTestWriter(file)
+	if err := writer.WriteComment(stateColumns); err != nil {
+		return err
+	}
+	vectors := versionbits.StateVectors(seed, count)
+	for _, v := range vectors {
+		d := v.Deployment
+		err := writer.WriteTestCase([]interface{}{
+			d.Bit,
+			d.StartTime,
+			d.Timeout,
+			d.MinActivationHeight,
+			d.Period,
+			d.Threshold,
+			v.Version,
+			v.Signalling,
+			v.EndTimes,
+			v.States,
+			v.Comment,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote %d vectors\n", len(vectors))
+	return nil
+}
+
+// readHeaders reads the headers of a file of one header in hex per line,
+// skipping empty lines.
+func readHeaders(path string) ([]*wire.BlockHeader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var headers []*wire.BlockHeader
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		header := &wire.BlockHeader{}
+		b, err := hex.DecodeString(line)
+		if err == nil {
+			err = header.Deserialize(bytes.NewReader(b))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("header %d: %v", len(headers),
+				err)
+		}
+		headers = append(headers, header)
+	}
+	return headers, scanner.Err()
+}
+
+// replayBlocks returns the blocks of the headers of the file.
+func replayBlocks(path string) ([]versionbits.Block, error) {
+	headers, err := readHeaders(path)
+	if err != nil {
+		return nil, err
+	}
+	return versionbits.BlocksFromHeaders(headers)
+}
+
+// writeJSON writes the value to out as indented JSON.
+func writeJSON(out string, v interface{}) error {
+	file, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	enc := json.NewEncoder(file)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// replayFile simulates the deployment over the headers of the file, and
+// writes the periods to out.
+func replayFile(path, out string, d *versionbits.Deployment) error {
+	blocks, err := replayBlocks(path)
+	if err != nil {
+		return err
+	}
+	periods, err := versionbits.Simulate(d, blocks)
+	if err != nil {
+		return err
+	}
+	if err := writeJSON(out, periods); err != nil {
+		return err
+	}
+
+	last := periods[len(periods)-1]
+	fmt.Printf("Replayed %d headers, %v from height %d\n", len(blocks),
+		last.State, last.StartHeight)
+	return nil
+}
+
+// syntheticBlocks returns the blocks of a chain of periods of the
+// deployment, of which the numbers of the comma separated list signal, the
+// blocks of the first with the median time past first and those of each
+// later one a period of blocks later.
+func syntheticBlocks(d *versionbits.Deployment, list string,
+	first int64) ([]versionbits.Block, error) {
+
+	var signalling []int32
+	var endTimes []int64
+	for i, field := range strings.Split(list, ",") {
+		n, err := strconv.ParseInt(strings.TrimSpace(field), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("period %d: %v", i, err)
+		}
+		signalling = append(signalling, int32(n))
+		endTimes = append(endTimes,
+			first+int64(i)*int64(d.Period)*syntheticSpacing)
+	}
+	return versionbits.SyntheticBlocks(d.Period,
+		versionbits.TopBits|1<<d.Bit, signalling, endTimes), nil
+}
+
+// timeline is the output of -compare: the names of the conditions, and the
+// periods with their states under each in the same order.
+type timeline struct {
+	Conditions []string
+	Periods    []versionbits.Comparison
+}
+
+// compareFile simulates the blocks under the BIP 9 deployment and the BIP 8
+// one, without and with lock-in on timeout, and writes the periods side by
+// side to out.
+func compareFile(blocks []versionbits.Block, out string,
+	d *versionbits.Deployment, bip8 *versionbits.BIP8Deployment) error {
+
+	lot := *bip8
+	lot.LockInOnTimeout = true
+	t := timeline{
+		Conditions: []string{"BIP 9", "BIP 8", "BIP 8 lock-in on " +
+			"timeout"},
+	}
+	var err error
+	t.Periods, err = versionbits.Compare(blocks, d, bip8, &lot)
+	if err != nil {
+		return err
+	}
+	if err := writeJSON(out, t); err != nil {
+		return err
+	}
+
+	last := t.Periods[len(t.Periods)-1]
+	for i, name := range t.Conditions {
+		fmt.Printf("%s: %v from height %d\n", name, last.States[i],
+			last.StartHeight)
+	}
+	return nil
+}
+
+// writeBIP8File writes the BIP 8 vectors, with count random ones, to out.
+func writeBIP8File(out string, seed int64, count int) error {
+	file, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := NewJSONTestWriter(file)
+	if err := writer.WriteComment(bip8Columns); err != nil {
+		return err
+	}
+	vectors := versionbits.BIP8Vectors(seed, count)
+	for _, v := range vectors {
+		d := v.Deployment
+		err := writer.WriteTestCase([]interface{}{
+			d.Bit,
+			d.StartHeight,
+			d.TimeoutHeight,
+			d.LockInOnTimeout,
+			d.MinActivationHeight,
+			d.Period,
+			d.Threshold,
+			v.Version,
+			v.Signalling,
+			v.States,
+			v.Invalid,
+			v.Comment,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote %d BIP 8 vectors\n", len(vectors))
+	return nil
+}
+
+// checkFile checks each vector of the file with
+// versionbits.CheckStateVector.
+func checkFile(path string) error {
+	rows, err := vectorfile.ReadRows(path, 11)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		var v versionbits.StateVector
+		d := &v.Deployment
+		err := vectorfile.DecodeRow(row, &d.Bit, &d.StartTime,
+			&d.Timeout, &d.MinActivationHeight, &d.Period,
+			&d.Threshold, &v.Version, &v.Signalling, &v.EndTimes,
+			&v.States, &v.Comment)
+		if err != nil {
+			return err
+		}
+		if err := versionbits.CheckStateVector(v); err != nil {
+			return fmt.Errorf("%v: %v", v.Comment, err)
+		}
+	}
+	fmt.Printf("%d vectors OK\n", len(rows))
+	return nil
+}
+
+// checkBIP8File checks each vector of the file with
+// versionbits.CheckBIP8Vector.
+func checkBIP8File(path string) error {
+	rows, err := vectorfile.ReadRows(path, 12)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		var v versionbits.BIP8Vector
+		d := &v.Deployment
+		err := vectorfile.DecodeRow(row, &d.Bit, &d.StartHeight,
+			&d.TimeoutHeight, &d.LockInOnTimeout,
+			&d.MinActivationHeight, &d.Period, &d.Threshold,
+			&v.Version, &v.Signalling, &v.States, &v.Invalid,
+			&v.Comment)
+		if err != nil {
+			return err
+		}
+		if err := versionbits.CheckBIP8Vector(v); err != nil {
+			return fmt.Errorf("%v: %v", v.Comment, err)
+		}
+	}
+	fmt.Printf("%d BIP 8 vectors OK\n", len(rows))
+	return nil
+}
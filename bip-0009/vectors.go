@@ -0,0 +1,422 @@
+package versionbits
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+)
+
+// ErrVectorMismatch is returned by CheckStateVector and CheckBIP8Vector when
+// simulating the blocks of a vector doesn't give the expected states.
+var ErrVectorMismatch = errors.New("versionbits: vector mismatch")
+
+// StateVector is a deployment and the states of the periods of a synthetic
+// chain: the number of blocks of each period signalling with the version,
+// and the median time past of its blocks.
+type StateVector struct {
+	Deployment Deployment
+
+	// Version is that of the blocks that signal, the others being of
+	// TopBits alone.
+	Version    int32
+	Signalling []int32
+	EndTimes   []int64
+
+	// States are the states of the periods, and of the one after them.
+	States []State
+
+	// Comment describes what the vector exercises.
+	Comment string
+}
+
+// SyntheticBlocks returns the blocks of a chain of periods of window blocks,
+// the first signalling[i] of period i of the version and the others of
+// TopBits alone, all of period i with the median time past endTimes[i].
+func SyntheticBlocks(window, version int32, signalling []int32,
+	endTimes []int64) []Block {
+
+	var blocks []Block
+	for i, n := range signalling {
+		for j := int32(0); j < window; j++ {
+			block := Block{
+				Version:        TopBits,
+				MedianTimePast: endTimes[i],
+			}
+			if j < n {
+				block.Version = version
+			}
+			blocks = append(blocks, block)
+		}
+	}
+	return blocks
+}
+
+// newStateVector returns the vector of the deployment and blocks.
+func newStateVector(d Deployment, version int32, signalling []int32,
+	endTimes []int64, comment string) StateVector {
+
+	blocks := SyntheticBlocks(d.Period, version, signalling, endTimes)
+	periods, err := Simulate(&d, blocks)
+	if err != nil {
+		panic(err)
+	}
+	states := make([]State, len(periods))
+	for i, p := range periods {
+		states[i] = p.State
+	}
+	return StateVector{
+		Deployment: d,
+		Version:    version,
+		Signalling: signalling,
+		EndTimes:   endTimes,
+		States:     states,
+		Comment:    comment,
+	}
+}
+
+// The timestamps of the periods of the vectors: the first ends at the median
+// time past base, and each lasts two weeks.
+const (
+	base     = 1600000000
+	twoWeeks = 14 * 24 * 3600
+)
+
+// endTimes returns the median times past of the ends of n periods.
+func endTimes(n int) []int64 {
+	times := make([]int64, n)
+	for i := range times {
+		times[i] = base + int64(i)*twoWeeks
+	}
+	return times
+}
+
+// StateVectors returns vectors of deployments of mainnet's periods and
+// threshold, starting at the end of the first period and timing out at the
+// end of the sixth unless stated otherwise, that lock in and activate, fail,
+// lock in at the timeout, wait for their minimum activation height, are
+// signalled for when it doesn't count or by versions that don't signal.
+// They are followed by count random deployments of short periods with
+// random signalling, derived from a math/rand source with the seed.
+func StateVectors(rngSeed int64, count int) []StateVector {
+	const (
+		threshold = DefaultThreshold
+		version   = TopBits | 1<<2
+	)
+	d := Deployment{
+		Bit:       2,
+		StartTime: endTimes(1)[0],
+		Timeout:   endTimes(6)[5],
+		Period:    DefaultPeriod,
+		Threshold: threshold,
+	}
+	with := func(f func(d *Deployment)) Deployment {
+		d := d
+		f(&d)
+		return d
+	}
+
+	vectors := []StateVector{
+		newStateVector(d, version, []int32{0, threshold, 0, 0},
+			endTimes(4), "Locks in and activates"),
+		newStateVector(d, version,
+			[]int32{0, DefaultPeriod, 0, 0}, endTimes(4),
+			"Every block signals"),
+		newStateVector(d, version,
+			[]int32{0, threshold - 1, threshold - 1, threshold - 1,
+				threshold - 1, threshold - 1, threshold - 1},
+			endTimes(7), "One block short until the timeout"),
+		newStateVector(d, version, []int32{threshold, 0, 0},
+			endTimes(3), "Signalling while defined doesn't count"),
+		newStateVector(d, version,
+			[]int32{0, 0, 0, 0, 0, threshold, 0}, endTimes(7),
+			"Locks in in the period of the timeout"),
+		newStateVector(d, version,
+			[]int32{0, 0, 0, 0, 0, 0, threshold}, endTimes(7),
+			"Signalling after failing doesn't count"),
+		newStateVector(d, version,
+			[]int32{0, threshold, threshold, 0}, endTimes(4),
+			"Signalling while locked in doesn't count"),
+		newStateVector(with(func(d *Deployment) {
+			d.StartTime = endTimes(3)[2]
+			d.Timeout = endTimes(2)[1]
+		}), version, []int32{0, 0, 0, 0, 0}, endTimes(5),
+			"Times out before it starts"),
+		newStateVector(with(func(d *Deployment) {
+			d.StartTime = endTimes(3)[2]
+			d.Timeout = endTimes(2)[1]
+		}), version, []int32{0, 0, 0, threshold, 0}, endTimes(5),
+			"Times out before it starts, locks in anyway"),
+		newStateVector(with(func(d *Deployment) {
+			d.StartTime = endTimes(1)[0] + 1
+		}), version, []int32{0, threshold, threshold, 0},
+			endTimes(4), "Starts a second after the first period"),
+		newStateVector(with(func(d *Deployment) {
+			d.Timeout = endTimes(2)[1] + 1
+		}), version, []int32{0, 0, threshold, 0}, endTimes(4),
+			"Times out a second after the second period"),
+		newStateVector(with(func(d *Deployment) {
+			d.MinActivationHeight = 5 * DefaultPeriod
+		}), version, []int32{0, threshold, 0, 0, 0, 0}, endTimes(6),
+			"Waits for its minimum activation height"),
+		newStateVector(with(func(d *Deployment) {
+			d.MinActivationHeight = 3*DefaultPeriod - 1
+		}), version, []int32{0, threshold, 0, 0, 0}, endTimes(5),
+			"Minimum activation height mid-period"),
+		newStateVector(with(func(d *Deployment) {
+			d.StartTime = AlwaysActive
+		}), version, []int32{0, 0}, endTimes(2), "Always active"),
+		newStateVector(with(func(d *Deployment) {
+			d.StartTime = NeverActive
+		}), version, []int32{0, DefaultPeriod}, endTimes(2),
+			"Never active"),
+		newStateVector(d, 1<<2, []int32{0, DefaultPeriod, 0},
+			endTimes(3), "Versions without the top bits"),
+		newStateVector(d, 0x60000000|1<<2,
+			[]int32{0, DefaultPeriod, 0}, endTimes(3),
+			"Versions of top bits 011"),
+		newStateVector(d, TopBits|1<<3, []int32{0, DefaultPeriod, 0},
+			endTimes(3), "Versions signalling another bit"),
+		newStateVector(d, -1, []int32{0, DefaultPeriod, 0},
+			endTimes(3), "Versions of all bits set"),
+		newStateVector(with(func(d *Deployment) {
+			d.Threshold = 1815
+		}), version, []int32{0, 1815, 0, 0}, endTimes(4),
+			"Threshold of 90 percent"),
+	}
+
+	rng := rand.New(rand.NewSource(rngSeed))
+	for n := 0; n < count; n++ {
+		period := int32(5 + rng.Intn(16))
+		periods := 3 + rng.Intn(8)
+		d := Deployment{
+			Bit:       uint8(rng.Intn(MaxBit + 1)),
+			StartTime: base + int64(rng.Intn(3))*twoWeeks,
+			Period:    period,
+		}
+		d.Threshold = period/2 + 1 + int32(rng.Intn(int(period/2)))
+		d.Timeout = d.StartTime + int64(rng.Intn(periods))*twoWeeks
+		if rng.Intn(4) == 0 {
+			d.MinActivationHeight = period *
+				int32(rng.Intn(periods))
+		}
+		signalling := make([]int32, periods)
+		for i := range signalling {
+			signalling[i] = int32(rng.Intn(int(period) + 1))
+		}
+		vectors = append(vectors, newStateVector(d, TopBits|1<<d.Bit,
+			signalling, endTimes(periods), "Random"))
+	}
+	return vectors
+}
+
+// CheckStateVector simulates the blocks of the vector and checks the states
+// of their periods.
+func CheckStateVector(v StateVector) error {
+	if len(v.EndTimes) != len(v.Signalling) {
+		return fmt.Errorf("%w: %d end times for %d periods",
+			ErrVectorMismatch, len(v.EndTimes), len(v.Signalling))
+	}
+	d := v.Deployment
+	blocks := SyntheticBlocks(d.Period, v.Version, v.Signalling,
+		v.EndTimes)
+	periods, err := Simulate(&d, blocks)
+	if err != nil {
+		return err
+	}
+	if len(periods) != len(v.States) {
+		return fmt.Errorf("%w: %d periods, expected %d",
+			ErrVectorMismatch, len(periods), len(v.States))
+	}
+	for i, p := range periods {
+		if p.State != v.States[i] {
+			return fmt.Errorf("%w: period %d %v, expected %v",
+				ErrVectorMismatch, i, p.State, v.States[i])
+		}
+	}
+	return nil
+}
+
+// BIP8Vector is a BIP 8 deployment and the states of the periods of a
+// synthetic chain, given by the number of blocks of each period signalling
+// with the version, and the number of blocks of each that are invalid.
+type BIP8Vector struct {
+	Deployment BIP8Deployment
+
+	// Version is that of the blocks that signal, the others being of
+	// TopBits alone.
+	Version    int32
+	Signalling []int32
+
+	// States are the states of the periods, and of the one after them,
+	// and Invalid the number of their blocks that are invalid.
+	States  []State
+	Invalid []int32
+
+	// Comment describes what the vector exercises.
+	Comment string
+}
+
+// simulateBIP8 simulates the deployment over the synthetic chain, whose
+// blocks all have the median time past zero as BIP 8 doesn't use it.
+func simulateBIP8(d BIP8Deployment, version int32,
+	signalling []int32) ([]Period, error) {
+
+	endTimes := make([]int64, len(signalling))
+	blocks := SyntheticBlocks(d.Period, version, signalling, endTimes)
+	return Simulate(&d, blocks)
+}
+
+// newBIP8Vector returns the vector of the deployment and blocks.
+func newBIP8Vector(d BIP8Deployment, version int32, signalling []int32,
+	comment string) BIP8Vector {
+
+	periods, err := simulateBIP8(d, version, signalling)
+	if err != nil {
+		panic(err)
+	}
+	v := BIP8Vector{
+		Deployment: d,
+		Version:    version,
+		Signalling: signalling,
+		Comment:    comment,
+	}
+	for _, p := range periods {
+		v.States = append(v.States, p.State)
+		v.Invalid = append(v.Invalid, p.Invalid)
+	}
+	return v
+}
+
+// BIP8Vectors returns vectors of deployments of mainnet's periods and a
+// threshold of 90 percent, starting at the second period and timing out at
+// the sixth unless stated otherwise, with and without lock-in on timeout,
+// that lock in before the timeout, fail or must signal, with blocks enough
+// signalling and too few, and that wait for their minimum activation
+// height. They are followed by count random deployments of short periods
+// with random signalling, derived from a math/rand source with the seed.
+func BIP8Vectors(rngSeed int64, count int) []BIP8Vector {
+	const (
+		period    = DefaultPeriod
+		threshold = 1815
+		version   = TopBits | 1<<2
+	)
+	d := BIP8Deployment{
+		Bit:           2,
+		StartHeight:   period,
+		TimeoutHeight: 5 * period,
+		Period:        period,
+		Threshold:     threshold,
+	}
+	lot := d
+	lot.LockInOnTimeout = true
+	with := func(d BIP8Deployment,
+		f func(d *BIP8Deployment)) BIP8Deployment {
+
+		f(&d)
+		return d
+	}
+
+	var vectors []BIP8Vector
+	for _, c := range []struct {
+		signalling []int32
+		comment    string
+	}{
+		{[]int32{0, threshold, 0, 0}, "Locks in and activates"},
+		{[]int32{0, 0, 0, 0, 0, 0, 0}, "No signalling"},
+		{[]int32{0, threshold - 1, threshold - 1, threshold - 1,
+			threshold - 1, threshold - 1, threshold - 1},
+			"One block short until the timeout"},
+		{[]int32{0, 0, 0, threshold, 0, 0},
+			"Locks in in the fourth period"},
+		{[]int32{0, 0, 0, 0, period, 0},
+			"Every block signals in the last period"},
+		{[]int32{0, 0, 0, 0, threshold - 1, 0},
+			"One block short in the last period"},
+		{[]int32{threshold, 0, 0},
+			"Signalling while defined doesn't count"},
+	} {
+		vectors = append(vectors,
+			newBIP8Vector(d, version, c.signalling, c.comment),
+			newBIP8Vector(lot, version, c.signalling,
+				c.comment+", lock-in on timeout"))
+	}
+
+	vectors = append(vectors,
+		newBIP8Vector(with(lot, func(d *BIP8Deployment) {
+			d.MinActivationHeight = 8 * period
+		}), version, []int32{0, 0, 0, 0, 0, 0, 0, 0},
+			"Must signal, waits for its minimum activation height"),
+		newBIP8Vector(with(d, func(d *BIP8Deployment) {
+			d.MinActivationHeight = 3*period - 1
+		}), version, []int32{0, threshold, 0, 0, 0},
+			"Minimum activation height mid-period"),
+		newBIP8Vector(with(d, func(d *BIP8Deployment) {
+			d.TimeoutHeight = 2 * period
+		}), version, []int32{0, 0, 0, 0},
+			"Times out a period after it starts"),
+		newBIP8Vector(with(lot, func(d *BIP8Deployment) {
+			d.TimeoutHeight = 2 * period
+		}), version, []int32{0, 0, 0, 0}, "Times out a period after "+
+			"it starts, lock-in on timeout"),
+		newBIP8Vector(with(lot, func(d *BIP8Deployment) {
+			d.StartHeight = 0
+		}), version, []int32{threshold, 0, 0},
+			"Starts at the genesis block"),
+		newBIP8Vector(lot, 1<<2, []int32{0, 0, 0, 0, period, 0},
+			"Must signal, versions without the top bits"),
+		newBIP8Vector(lot, TopBits|1<<3, []int32{0, 0, 0, 0, period, 0},
+			"Must signal, versions signalling another bit"),
+		newBIP8Vector(with(lot, func(d *BIP8Deployment) {
+			d.Threshold = DefaultThreshold
+		}), version, []int32{0, 0, 0, 0, 0, 0},
+			"Must signal, threshold of 95 percent"),
+	)
+
+	rng := rand.New(rand.NewSource(rngSeed))
+	for n := 0; n < count; n++ {
+		period := int32(5 + rng.Intn(16))
+		periods := 3 + rng.Intn(8)
+		d := BIP8Deployment{
+			Bit:             uint8(rng.Intn(MaxBit + 1)),
+			StartHeight:     period * int32(rng.Intn(3)),
+			LockInOnTimeout: rng.Intn(2) == 0,
+			Period:          period,
+		}
+		d.TimeoutHeight = d.StartHeight +
+			period*int32(1+rng.Intn(periods))
+		d.Threshold = period/2 + 1 + int32(rng.Intn(int(period/2)))
+		if rng.Intn(4) == 0 {
+			d.MinActivationHeight = period *
+				int32(rng.Intn(periods))
+		}
+		signalling := make([]int32, periods)
+		for i := range signalling {
+			signalling[i] = int32(rng.Intn(int(period) + 1))
+		}
+		vectors = append(vectors, newBIP8Vector(d, TopBits|1<<d.Bit,
+			signalling, "Random"))
+	}
+	return vectors
+}
+
+// CheckBIP8Vector simulates the blocks of the vector and checks the states
+// of their periods and the number of their blocks that are invalid.
+func CheckBIP8Vector(v BIP8Vector) error {
+	periods, err := simulateBIP8(v.Deployment, v.Version, v.Signalling)
+	if err != nil {
+		return err
+	}
+	if len(periods) != len(v.States) || len(periods) != len(v.Invalid) {
+		return fmt.Errorf("%w: %d periods, expected %d states and %d "+
+			"invalid counts", ErrVectorMismatch, len(periods),
+			len(v.States), len(v.Invalid))
+	}
+	for i, p := range periods {
+		if p.State != v.States[i] || p.Invalid != v.Invalid[i] {
+			return fmt.Errorf("%w: period %d %v with %d invalid, "+
+				"expected %v with %d", ErrVectorMismatch, i,
+				p.State, p.Invalid, v.States[i], v.Invalid[i])
+		}
+	}
+	return nil
+}
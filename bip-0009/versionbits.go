@@ -0,0 +1,326 @@
+// Package versionbits simulates the version bits deployments of BIP 9, the
+// state machine miners activate soft forks through by signalling with a bit
+// of the versions of the blocks they mine, and those of BIP 8:
+//
+//	d := &versionbits.Deployment{Bit: 2, StartTime: start,
+//		Timeout: timeout, Period: 2016, Threshold: 1916}
+//	blocks, err := versionbits.BlocksFromHeaders(headers)
+//	periods, err := versionbits.Simulate(d, blocks)
+//
+// The state of a deployment changes only between periods of blocks, from
+// DEFINED to STARTED once the median time past of the last block of a
+// period reaches the start time, and from STARTED to LOCKED_IN once at
+// least the threshold of blocks of a period signal, or to FAILED if they
+// don't by the period whose last block's median time past reaches the
+// timeout. A deployment LOCKED_IN for a period becomes ACTIVE in the next,
+// or in the first period from its minimum activation height, and ACTIVE and
+// FAILED are final. Only blocks whose version has the top three bits 001
+// signal, so that versions of other schemes don't.
+//
+// A BIP8Deployment starts and times out at heights rather than median times
+// past. With LockInOnTimeout set, one that hasn't locked in by the period
+// before its timeout goes to MUST_SIGNAL for it instead of failing, blocks
+// that don't signal are invalid once too few are left to reach the
+// threshold, and it locks in after that period whatever the signalling.
+//
+// Simulate replays blocks, a chain of real headers or synthetic signalling
+// patterns, through any Condition, the rules of which decide the state of
+// each period from the one before, and reports the state and signalling of
+// each period. Compare replays the same blocks through several conditions,
+// to set how a deployment activates under BIP 9 against BIP 8, with and
+// without lock-in on timeout.
+package versionbits
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/btcsuite/btcd/wire"
+	mediantime "github.com/christsim/bips/bip-0113"
+)
+
+const (
+	// TopBits are the top three bits of the versions of blocks that
+	// signal, and TopMask masks them.
+	TopBits = 0x20000000
+	TopMask = 0xe0000000
+
+	// MaxBit is the highest bit a deployment can signal with.
+	MaxBit = 28
+
+	// DefaultPeriod is the number of blocks of a period on mainnet, and
+	// DefaultThreshold the number of them that must signal, 95 percent.
+	DefaultPeriod    = 2016
+	DefaultThreshold = 1916
+
+	// AlwaysActive is the start time of a deployment that is active from
+	// the genesis block, and NeverActive that of one that never is.
+	AlwaysActive = -1
+	NeverActive  = -2
+)
+
+var (
+	// ErrInvalidDeployment is returned for a deployment whose bit, period
+	// or threshold are out of range.
+	ErrInvalidDeployment = errors.New("versionbits: invalid deployment")
+
+	// ErrUnknownState is returned by ParseState for a name that isn't one
+	// of a state.
+	ErrUnknownState = errors.New("versionbits: unknown state")
+)
+
+// State is the state of a deployment for the blocks of a period.
+type State uint8
+
+// The states of a deployment.
+const (
+	Defined State = iota
+	Started
+	LockedIn
+	Active
+	Failed
+
+	// MustSignal is the state of BIP 8 deployments locking in on
+	// timeout, whose blocks must signal.
+	MustSignal
+)
+
+// stateNames are the names of the states BIP 9 and BIP 8 give them.
+var stateNames = []string{"DEFINED", "STARTED", "LOCKED_IN", "ACTIVE",
+	"FAILED", "MUST_SIGNAL"}
+
+// String returns the name of the state.
+func (s State) String() string {
+	if int(s) < len(stateNames) {
+		return stateNames[s]
+	}
+	return fmt.Sprintf("State(%d)", s)
+}
+
+// ParseState returns the state of the name.
+func ParseState(name string) (State, error) {
+	for s, stateName := range stateNames {
+		if strings.EqualFold(name, stateName) {
+			return State(s), nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %q", ErrUnknownState, name)
+}
+
+// MarshalText encodes the state as its name.
+func (s State) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText decodes a state from its name.
+func (s *State) UnmarshalText(text []byte) error {
+	state, err := ParseState(string(text))
+	if err != nil {
+		return err
+	}
+	*s = state
+	return nil
+}
+
+// Block is what the state machine needs of a block: its version and median
+// time past.
+type Block struct {
+	Version        int32
+	MedianTimePast int64
+}
+
+// BlocksFromHeaders returns the blocks of a chain of headers, starting at
+// the genesis block.
+func BlocksFromHeaders(headers []*wire.BlockHeader) ([]Block, error) {
+	chain, err := mediantime.NewChain(0, headers)
+	if err != nil {
+		return nil, err
+	}
+	blocks := make([]Block, len(headers))
+	for i, header := range headers {
+		mtp, err := chain.MedianTimePast(int32(i))
+		if err != nil {
+			return nil, err
+		}
+		blocks[i] = Block{Version: header.Version, MedianTimePast: mtp}
+	}
+	return blocks, nil
+}
+
+// Period is a period of blocks, the state of a deployment for them and how
+// many of them signal for it.
+type Period struct {
+	// Index is the number of periods before it, and StartHeight the
+	// height of its first block.
+	Index       int
+	StartHeight int32
+
+	State State
+
+	// Blocks is the number of its blocks simulated, fewer than the
+	// period for the last of a chain, and Signalling the number of them
+	// that signal.
+	Blocks     int32
+	Signalling int32
+
+	// Invalid is the number of its blocks invalid under the condition
+	// for not signalling, which the simulation counts but keeps.
+	Invalid int32
+
+	// EndMedianTimePast is the median time past of its last block
+	// simulated.
+	EndMedianTimePast int64
+}
+
+// Condition is the rules of a deployment, deciding its state for each
+// period of blocks.
+type Condition interface {
+	// Validate checks the parameters of the rules.
+	Validate() error
+
+	// Window returns the number of blocks of a period.
+	Window() int32
+
+	// Signals reports whether a block of the version signals.
+	Signals(version int32) bool
+
+	// Initial returns the state of the first period.
+	Initial() State
+
+	// Next returns the state of the period after the full period p.
+	Next(p *Period) State
+}
+
+// Enforcer is implemented by the conditions under which blocks that don't
+// signal can be invalid.
+type Enforcer interface {
+	// Invalid reports whether the next block of the period p, of the
+	// version, is invalid.
+	Invalid(p *Period, version int32) bool
+}
+
+// Simulate returns the periods of the blocks, a chain starting at the genesis
+// block, under the condition. If the chain ends with a full period, the next
+// period follows it with no blocks, so that the state the chain leads to is
+// the last.
+func Simulate(c Condition, blocks []Block) ([]Period, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	window := c.Window()
+	enforcer, _ := c.(Enforcer)
+	periods := []Period{{State: c.Initial()}}
+	for _, block := range blocks {
+		p := &periods[len(periods)-1]
+		if p.Blocks == window {
+			periods = append(periods, Period{
+				Index:       p.Index + 1,
+				StartHeight: p.StartHeight + window,
+				State:       c.Next(p),
+			})
+			p = &periods[len(periods)-1]
+		}
+		if enforcer != nil && enforcer.Invalid(p, block.Version) {
+			p.Invalid++
+		}
+		p.Blocks++
+		if c.Signals(block.Version) {
+			p.Signalling++
+		}
+		p.EndMedianTimePast = block.MedianTimePast
+	}
+
+	if p := &periods[len(periods)-1]; p.Blocks == window {
+		periods = append(periods, Period{
+			Index:       p.Index + 1,
+			StartHeight: p.StartHeight + window,
+			State:       c.Next(p),
+		})
+	}
+	return periods, nil
+}
+
+// Deployment is a BIP 9 deployment.
+type Deployment struct {
+	// Bit is the bit of the version blocks signal with.
+	Bit uint8
+
+	// StartTime is the median time past from which blocks signal, or
+	// AlwaysActive or NeverActive, and Timeout the one at which the
+	// deployment fails if it hasn't locked in.
+	StartTime int64
+	Timeout   int64
+
+	// MinActivationHeight is the lowest height it becomes active at.
+	MinActivationHeight int32
+
+	// Period is the number of blocks of a period, and Threshold the
+	// number of them that must signal for it to lock in.
+	Period    int32
+	Threshold int32
+}
+
+// Validate checks the bit, period and threshold of the deployment.
+func (d *Deployment) Validate() error {
+	if d.Bit > MaxBit {
+		return fmt.Errorf("%w: bit %d", ErrInvalidDeployment, d.Bit)
+	}
+	if d.Period <= 0 || d.Threshold <= 0 || d.Threshold > d.Period {
+		return fmt.Errorf("%w: threshold %d of %d",
+			ErrInvalidDeployment, d.Threshold, d.Period)
+	}
+	return nil
+}
+
+// Window returns the number of blocks of a period.
+func (d *Deployment) Window() int32 {
+	return d.Period
+}
+
+// Signals reports whether a block of the version signals for the
+// deployment.
+func (d *Deployment) Signals(version int32) bool {
+	return signals(d.Bit, version)
+}
+
+// signals reports whether a block of the version signals with the bit.
+func signals(bit uint8, version int32) bool {
+	return uint32(version)&TopMask == TopBits &&
+		uint32(version)&(1<<bit) != 0
+}
+
+// Initial returns the state of the first period, DEFINED but for
+// deployments always or never active.
+func (d *Deployment) Initial() State {
+	switch d.StartTime {
+	case AlwaysActive:
+		return Active
+	case NeverActive:
+		return Failed
+	}
+	return Defined
+}
+
+// Next returns the state of the period after p.
+func (d *Deployment) Next(p *Period) State {
+	switch p.State {
+	case Defined:
+		if p.EndMedianTimePast >= d.StartTime {
+			return Started
+		}
+	case Started:
+		if p.Signalling >= d.Threshold {
+			return LockedIn
+		}
+		if p.EndMedianTimePast >= d.Timeout {
+			return Failed
+		}
+	case LockedIn:
+		if p.StartHeight+p.Blocks >= d.MinActivationHeight {
+			return Active
+		}
+	}
+	return p.State
+}
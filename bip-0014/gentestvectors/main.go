@@ -0,0 +1,192 @@
+// This program writes test vectors for the useragent package to
+// user-agents.json: the examples of BIP 14, the user agents of well known
+// node software, user agents malformed in every way and of the longest
+// length and past it, and random user agents, broken at random or not. The
+// random vectors depend only on -seed and -count, so they can be
+// regenerated by anyone:
+//
+//	gentestvectors -count 50 -seed 14
+//
+// The file uses the layout of the BIP 158 vectors: a JSON array whose first
+// row names the columns, followed by one row per vector. Each vector is a
+// user agent followed by its components, each a list of its name, version
+// and comments, and the user agent built of them, or by the error it's
+// rejected with, empty for a valid one. Pass -check to verify an existing
+// file against the package, and against the version message of btcd,
+// instead:
+//
+//	gentestvectors -check user-agents.json
+//
+// The program lives in a directory of its own since the useragent package
+// sits at the root of the module.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	useragent "github.com/christsim/bips/bip-0014"
+	"github.com/christsim/bips/internal/vectorfile"
+)
+
+// vectorColumns is the header row of the vector file.
+const vectorColumns = "User Agent,Components,Canonical,Error,Comment"
+
+type JSONTestWriter struct {
+	writer          io.Writer
+	firstRowWritten bool
+}
+
+func NewJSONTestWriter(writer io.Writer) *JSONTestWriter {
+	return &JSONTestWriter{writer: writer}
+}
+
+func (w *JSONTestWriter) WriteComment(comment string) error {
+	return w.WriteTestCase([]interface{}{comment})
+}
+
+func (w *JSONTestWriter) WriteTestCase(row []interface{}) error {
+	var err error
+	if w.firstRowWritten {
+		_, err = io.WriteString(w.writer, ",\n")
+	} else {
+		_, err = io.WriteString(w.writer, "[\n")
+		w.firstRowWritten = true
+	}
+	if err != nil {
+		return err
+	}
+
+	rowBytes, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.writer.Write(rowBytes)
+	return err
+}
+
+func (w *JSONTestWriter) Close() error {
+	if !w.firstRowWritten {
+		return nil
+	}
+
+	_, err := io.WriteString(w.writer, "\n]\n")
+	return err
+}
+
+func main() {
+	out := flag.String("out", "user-agents.json", "file to write the "+
+		"vectors to")
+	count := flag.Int("count", 50, "number of random user agents to "+
+		"write vectors of")
+	seed := flag.Int64("seed", 14, "seed of the random vectors")
+	check := flag.String("check", "", "vector file to check instead of "+
+		"writing one")
+	flag.Parse()
+
+	var err error
+	if *check != "" {
+		err = checkFile(*check)
+	} else {
+		err = writeFile(*out, *seed, *count)
+	}
+	if err != nil {
+		fmt.Println("Error: ", err.Error())
+		os.Exit(1)
+	}
+}
+
+// formatComponents returns the components as lists of their name, version
+// and comments.
+func formatComponents(ua useragent.UserAgent) [][]string {
+	formatted := make([][]string, len(ua))
+	for i, c := range ua {
+		formatted[i] = append([]string{c.Name, c.Version},
+			c.Comments...)
+	}
+	return formatted
+}
+
+// parseComponents returns the components of lists of their name, version
+// and comments.
+func parseComponents(formatted [][]string) (useragent.UserAgent, error) {
+	var ua useragent.UserAgent
+	for _, fields := range formatted {
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("component %q without version",
+				fields)
+		}
+		ua = append(ua, useragent.Component{
+			Name:     fields[0],
+			Version:  fields[1],
+			Comments: fields[2:],
+		})
+	}
+	return ua, nil
+}
+
+// writeFile writes the vectors, with count random ones, to out.
+func writeFile(out string, seed int64, count int) error {
+	file, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := NewJSONTestWriter(file)
+	if err := writer.WriteComment(vectorColumns); err != nil {
+		return err
+	}
+	vectors := useragent.Vectors(seed, count)
+	for _, v := range vectors {
+		err := writer.WriteTestCase([]interface{}{
+			v.UserAgent,
+			formatComponents(v.Components),
+			v.Canonical,
+			vectorfile.ErrorString(v.Err),
+			v.Comment,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote %d vectors\n", len(vectors))
+	return nil
+}
+
+// checkFile checks each vector of the file with useragent.CheckVector.
+func checkFile(path string) error {
+	rows, err := vectorfile.ReadRows(path, 5)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		var v useragent.Vector
+		var components [][]string
+		var errMsg string
+		err := vectorfile.DecodeRow(row, &v.UserAgent, &components,
+			&v.Canonical, &errMsg, &v.Comment)
+		if err != nil {
+			return err
+		}
+		v.Components, err = parseComponents(components)
+		if err != nil {
+			return fmt.Errorf("%v: %v", v.Comment, err)
+		}
+		v.Err = vectorfile.ParseError(errMsg)
+		if err := useragent.CheckVector(v); err != nil {
+			return fmt.Errorf("%v: %v", v.Comment, err)
+		}
+	}
+
+	fmt.Printf("%d vectors OK\n", len(rows))
+	return nil
+}
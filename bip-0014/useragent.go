@@ -0,0 +1,281 @@
+// Package useragent implements the user agents of BIP 14, which nodes send
+// in the subversion field of their version messages. A user agent names the
+// stack of software a node runs, from the code base up, each component with
+// its version and optional comments:
+//
+//	/Satoshi:0.21.0/
+//	/BitcoinJ:0.2(iPad; U; CPU OS 3_2_1)/AndroidBuild:0.8/
+//
+// Build writes a user agent of its components and Parse reads one back,
+// strictly: names, versions and comments must be free of the symbols BIP 14
+// reserves, / : ( ), and of anything but printable ASCII, and the whole no
+// longer than MaxLen. Comments are separated by semicolons, and written with
+// a space after each one:
+//
+//	s, err := useragent.Build(useragent.UserAgent{
+//		{Name: "Satoshi", Version: "0.21.0", Comments: []string{"pruned"}},
+//	})
+//	ua, err := useragent.Parse(s)
+//
+// Peers send whatever they like, so what a node logs or shows of a user
+// agent it can't parse should be passed through Sanitize first, which keeps
+// the characters Bitcoin Core keeps. SanitizeComment keeps those Bitcoin
+// Core allows in the comments it's configured with.
+package useragent
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+// MaxLen is the longest user agent a version message may carry.
+const MaxLen = wire.MaxUserAgentLen
+
+const (
+	// reserved are the symbols BIP 14 reserves for the syntax of user
+	// agents.
+	reserved = "/:()"
+
+	// commentSeparator separates the comments of a component, and
+	// commentJoin joins them when a user agent is built.
+	commentSeparator = ";"
+	commentJoin      = "; "
+
+	// alphaNum are the letters and digits.
+	alphaNum = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz" +
+		"0123456789"
+
+	// SafeChars are the characters Sanitize keeps, and
+	// SafeCommentChars those SanitizeComment keeps: those Bitcoin Core
+	// keeps of the user agents of its peers, and those it allows in the
+	// comments of its own.
+	SafeChars        = alphaNum + " .,;-_/:?@()"
+	SafeCommentChars = alphaNum + " .,;-_?@"
+)
+
+var (
+	// ErrTooLong is returned for a user agent longer than MaxLen.
+	ErrTooLong = errors.New("useragent: user agent too long")
+
+	// ErrMalformed is returned for a user agent that isn't a list of
+	// components each ended by a slash, after the slash it starts with.
+	ErrMalformed = errors.New("useragent: malformed user agent")
+
+	// ErrEmptyField is returned for a component of an empty name,
+	// version or comment.
+	ErrEmptyField = errors.New("useragent: empty field")
+
+	// ErrInvalidChar is returned for a name, version or comment holding a
+	// reserved symbol or a character that isn't printable ASCII.
+	ErrInvalidChar = errors.New("useragent: invalid character")
+)
+
+// Component is a piece of the software stack a user agent names, with its
+// version and comments.
+type Component struct {
+	Name     string
+	Version  string
+	Comments []string
+}
+
+// UserAgent is the components of a user agent, the code base first and each
+// following one built on those before it.
+type UserAgent []Component
+
+// checkField checks that the field of a component is not empty, and holds
+// only printable ASCII but the reserved symbols and the extra ones passed.
+func checkField(field, what, extra string) error {
+	if field == "" {
+		return fmt.Errorf("%w: %v", ErrEmptyField, what)
+	}
+	for _, c := range field {
+		if c < ' ' || c > '~' || strings.ContainsRune(reserved+extra, c) {
+			return fmt.Errorf("%w: %q in %v %q", ErrInvalidChar, c,
+				what, field)
+		}
+	}
+	return nil
+}
+
+// Validate checks that the component has a name and version, and that
+// they and its comments hold no reserved symbols. Comments may hold no
+// semicolons either, and may not start or end with a space, which Parse
+// would trim.
+func (c *Component) Validate() error {
+	if err := checkField(c.Name, "name", ""); err != nil {
+		return err
+	}
+	if err := checkField(c.Version, "version", ""); err != nil {
+		return err
+	}
+	for _, comment := range c.Comments {
+		err := checkField(comment, "comment", commentSeparator)
+		if err != nil {
+			return err
+		}
+		if strings.TrimSpace(comment) != comment {
+			return fmt.Errorf("%w: comment %q padded with spaces",
+				ErrInvalidChar, comment)
+		}
+	}
+	return nil
+}
+
+// String returns the component as it's written in a user agent, without
+// the slash that ends it.
+func (c *Component) String() string {
+	s := c.Name + ":" + c.Version
+	if len(c.Comments) > 0 {
+		s += "(" + strings.Join(c.Comments, commentJoin) + ")"
+	}
+	return s
+}
+
+// String returns the user agent of the components, whether they are valid
+// or not. Use Build for one that must be.
+func (ua UserAgent) String() string {
+	if len(ua) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("/")
+	for i := range ua {
+		b.WriteString(ua[i].String())
+		b.WriteString("/")
+	}
+	return b.String()
+}
+
+// Build returns the user agent of the components, which must be valid and
+// make up a user agent no longer than MaxLen. An empty user agent, of no
+// components, is the empty string.
+func Build(ua UserAgent) (string, error) {
+	for i := range ua {
+		if err := ua[i].Validate(); err != nil {
+			return "", fmt.Errorf("component %d: %w", i, err)
+		}
+	}
+	s := ua.String()
+	if len(s) > MaxLen {
+		return "", fmt.Errorf("%w: %d bytes, max %d", ErrTooLong,
+			len(s), MaxLen)
+	}
+	return s, nil
+}
+
+// parseComponent parses a component of a user agent, without the slash that
+// ends it.
+func parseComponent(s string) (Component, error) {
+	var c Component
+	name, rest, ok := strings.Cut(s, ":")
+	if !ok {
+		return c, fmt.Errorf("%w: component %q without version",
+			ErrMalformed, s)
+	}
+	c.Name, c.Version = name, rest
+	if i := strings.IndexByte(rest, '('); i >= 0 {
+		if !strings.HasSuffix(rest, ")") {
+			return c, fmt.Errorf("%w: comments of %q not ended by )",
+				ErrMalformed, s)
+		}
+		c.Version = rest[:i]
+		comments := rest[i+1 : len(rest)-1]
+		for _, comment := range strings.Split(comments,
+			commentSeparator) {
+
+			c.Comments = append(c.Comments,
+				strings.TrimSpace(comment))
+		}
+	}
+	return c, c.Validate()
+}
+
+// Parse parses a user agent, rejecting any that Build wouldn't write but for
+// the spacing of comments. The empty string is a user agent of no
+// components.
+func Parse(s string) (UserAgent, error) {
+	if len(s) > MaxLen {
+		return nil, fmt.Errorf("%w: %d bytes, max %d", ErrTooLong,
+			len(s), MaxLen)
+	}
+	if s == "" {
+		return UserAgent{}, nil
+	}
+	if len(s) < 2 || s[0] != '/' || s[len(s)-1] != '/' {
+		return nil, fmt.Errorf("%w: %q not between slashes",
+			ErrMalformed, s)
+	}
+
+	var ua UserAgent
+	for i, part := range strings.Split(s[1:len(s)-1], "/") {
+		c, err := parseComponent(part)
+		if err != nil {
+			return nil, fmt.Errorf("component %d: %w", i, err)
+		}
+		ua = append(ua, c)
+	}
+	return ua, nil
+}
+
+// Base returns the first component of the user agent, the code base the
+// rest are built on, or false if it has none.
+func (ua UserAgent) Base() (Component, bool) {
+	if len(ua) == 0 {
+		return Component{}, false
+	}
+	return ua[0], true
+}
+
+// Find returns the first component of the user agent of the name, or false
+// if it has none.
+func (ua UserAgent) Find(name string) (Component, bool) {
+	for _, c := range ua {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return Component{}, false
+}
+
+// sanitize returns s with only the characters of safe.
+func sanitize(s, safe string) string {
+	return strings.Map(func(c rune) rune {
+		if strings.ContainsRune(safe, c) {
+			return c
+		}
+		return -1
+	}, s)
+}
+
+// Sanitize returns the user agent of a peer with only the characters of
+// SafeChars, fit to be logged or shown, as Bitcoin Core cleans the user
+// agents of its peers. The result needn't parse.
+func Sanitize(s string) string {
+	return sanitize(s, SafeChars)
+}
+
+// SanitizeComment returns the comment with only the characters of
+// SafeCommentChars. Bitcoin Core refuses a comment it configures its user
+// agent with if the result isn't the comment itself.
+func SanitizeComment(s string) string {
+	return sanitize(s, SafeCommentChars)
+}
+
+// SetUserAgent builds the user agent of the components into the version
+// message, replacing whatever it held.
+func SetUserAgent(msg *wire.MsgVersion, ua UserAgent) error {
+	s, err := Build(ua)
+	if err != nil {
+		return err
+	}
+	msg.UserAgent = s
+	return nil
+}
+
+// FromVersion parses the user agent of the version message.
+func FromVersion(msg *wire.MsgVersion) (UserAgent, error) {
+	return Parse(msg.UserAgent)
+}
@@ -0,0 +1,228 @@
+package useragent
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/christsim/bips/internal/vectorfile"
+)
+
+// ErrVectorMismatch is returned by CheckVector when parsing the user agent
+// of a vector, or building it with the package or the version message of
+// btcd, doesn't give the expected result.
+var ErrVectorMismatch = errors.New("useragent: vector mismatch")
+
+// Vector is a user agent and what Parse returns for it: its components and
+// the user agent Build writes of them, or the error it's rejected with.
+type Vector struct {
+	UserAgent string
+
+	Components UserAgent
+	Canonical  string
+
+	// Err is the error an invalid user agent is rejected with, or nil.
+	Err error
+
+	// Comment describes what the vector exercises.
+	Comment string
+}
+
+// newVector returns the vector of parsing the user agent.
+func newVector(s, comment string) Vector {
+	v := Vector{UserAgent: s, Comment: comment}
+	v.Components, v.Err = Parse(s)
+	if v.Err != nil {
+		v.Components = nil
+		return v
+	}
+	canonical, err := Build(v.Components)
+	if err != nil {
+		panic(fmt.Sprintf("useragent: %v: %v", comment, err))
+	}
+	v.Canonical = canonical
+	return v
+}
+
+// padded returns a user agent of one component whose version is padded to
+// make the user agent n bytes long.
+func padded(n int) string {
+	s := "/Satoshi:/"
+	return s[:len(s)-1] + strings.Repeat("1", n-len(s)) + "/"
+}
+
+// Vectors returns vectors of the examples of BIP 14, the user agents of
+// well known node software, and user agents of every kind of error:
+// reserved symbols and characters that aren't printable ASCII in each
+// field, empty fields, missing slashes and versions, unended comments and
+// user agents too long. They are followed by count random user agents,
+// derived from a math/rand source with the seed, broken in a random way or
+// not.
+func Vectors(rngSeed int64, count int) []Vector {
+	vectors := []Vector{
+		newVector("/Satoshi:5.64/bitcoin-qt:0.4/", "BIP 14 example"),
+		newVector("/Satoshi:5.12/Spesmilo:0.8/", "BIP 14 example"),
+		newVector("/BitcoinJ:0.2(iPad; U; CPU OS 3_2_1)/"+
+			"AndroidBuild:0.8/", "BIP 14 example with comments"),
+		newVector("/Satoshi:27.0.0/", "Bitcoin Core"),
+		newVector("/Satoshi:0.21.0(pruned; EB32.0)/", "Bitcoin Core "+
+			"with comments"),
+		newVector("/btcwire:0.5.0/btcd:0.24.2/", "btcd"),
+		newVector("/bitcoinj:0.16.2/Bitcoin Wallet:9.25/", "name with "+
+			"a space"),
+		newVector("/Satoshi:0.7.2-r1/", "version with a revision"),
+		newVector("/Satoshi:20110128/", "version of a date"),
+		newVector("/a:1(x;y;  z )/", "comments spaced unevenly"),
+		newVector("", "empty user agent"),
+		newVector(padded(MaxLen), "MaxLen bytes"),
+		newVector(padded(MaxLen+1), "MaxLen+1 bytes"),
+		newVector("/", "single slash"),
+		newVector("Satoshi:0.21.0/", "no leading slash"),
+		newVector("/Satoshi:0.21.0", "no trailing slash"),
+		newVector("/Satoshi:0.21.0//", "empty component"),
+		newVector("/Satoshi/", "no version"),
+		newVector("/Satoshi:/", "empty version"),
+		newVector("/:0.21.0/", "empty name"),
+		newVector("/Satoshi:0.21:0/", "colon in version"),
+		newVector("/Sat(oshi:0.21.0/", "bracket in name"),
+		newVector("/Satoshi:0.21.0(pruned/", "comment not ended"),
+		newVector("/Satoshi:0.21.0(pruned)x/", "text after comment"),
+		newVector("/Satoshi:0.21.0()/", "empty comment"),
+		newVector("/Satoshi:0.21.0(a;;b)/", "empty comment between "+
+			"others"),
+		newVector("/Satoshi:0.21.0(a(b))/", "nested comment"),
+		newVector("/Satoshi:0.21.0(a:b)/", "colon in comment"),
+		newVector("/Satoshi:0.21.0\n/", "newline in version"),
+		newVector("/Satoshi:0.21.0(café)/", "non-ASCII comment"),
+		newVector("/Sat\x00oshi:0.21.0/", "NUL in name"),
+	}
+
+	rng := rand.New(rand.NewSource(rngSeed))
+	for i := 0; i < count; i++ {
+		ua := randomUserAgent(rng)
+		s := ua.String()
+		comment := fmt.Sprintf("random user agent %d of %d components",
+			i, len(ua))
+		if rng.Intn(3) == 0 {
+			at := rng.Intn(len(s))
+			c := breakers[rng.Intn(len(breakers))]
+			s = s[:at] + c + s[at:]
+			comment += fmt.Sprintf(", %q inserted at %d", c, at)
+		}
+		vectors = append(vectors, newVector(s, comment))
+	}
+	return vectors
+}
+
+// breakers are what Vectors inserts into random user agents to break them,
+// which they needn't.
+var breakers = []string{"/", ":", "(", ")", ";", " ", "\x7f", "é"}
+
+// fieldChars are the characters of the fields of random user agents.
+const fieldChars = alphaNum + " .,-_?@"
+
+// randomField returns a random field of 1 to max characters, of no
+// leading or trailing space.
+func randomField(rng *rand.Rand, max int) string {
+	b := make([]byte, 1+rng.Intn(max))
+	for i := range b {
+		b[i] = fieldChars[rng.Intn(len(fieldChars))]
+	}
+	if b[0] == ' ' {
+		b[0] = '_'
+	}
+	if b[len(b)-1] == ' ' {
+		b[len(b)-1] = '_'
+	}
+	return string(b)
+}
+
+// randomUserAgent returns a random user agent of 1 to 4 components.
+func randomUserAgent(rng *rand.Rand) UserAgent {
+	ua := make(UserAgent, 1+rng.Intn(4))
+	for i := range ua {
+		ua[i].Name = randomField(rng, 12)
+		ua[i].Version = randomField(rng, 8)
+		for j := rng.Intn(4) - 1; j > 0; j-- {
+			ua[i].Comments = append(ua[i].Comments,
+				randomField(rng, 10))
+		}
+	}
+	return ua
+}
+
+// sameUserAgent reports whether the user agents have the same components.
+func sameUserAgent(a, b UserAgent) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Name != b[i].Name || a[i].Version != b[i].Version ||
+			len(a[i].Comments) != len(b[i].Comments) {
+
+			return false
+		}
+		for j := range a[i].Comments {
+			if a[i].Comments[j] != b[i].Comments[j] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// btcdUserAgent returns the user agent the version message of btcd builds
+// of the components, or the error it gives.
+func btcdUserAgent(ua UserAgent) (string, error) {
+	if len(ua) == 0 {
+		return "", nil
+	}
+	msg := &wire.MsgVersion{UserAgent: "/"}
+	for _, c := range ua {
+		err := msg.AddUserAgent(c.Name, c.Version, c.Comments...)
+		if err != nil {
+			return "", err
+		}
+	}
+	return msg.UserAgent, nil
+}
+
+// CheckVector parses the user agent of the vector, which must give the
+// expected components or error, and builds the components of a valid one,
+// with the package and with the version message of btcd, which must give
+// the canonical user agent, itself parsed to the same components.
+func CheckVector(v Vector) error {
+	ua, err := Parse(v.UserAgent)
+	if !vectorfile.SameError(err, v.Err) {
+		return fmt.Errorf("%w: error %v, expected %v",
+			ErrVectorMismatch, err, v.Err)
+	}
+	if err != nil {
+		return nil
+	}
+	if !sameUserAgent(ua, v.Components) {
+		return fmt.Errorf("%w: components %+v, expected %+v",
+			ErrVectorMismatch, ua, v.Components)
+	}
+
+	s, err := Build(ua)
+	if err != nil {
+		return fmt.Errorf("%w: build: %v", ErrVectorMismatch, err)
+	}
+	if s != v.Canonical {
+		return fmt.Errorf("%w: built %q, expected %q", ErrVectorMismatch,
+			s, v.Canonical)
+	}
+	if s, err = btcdUserAgent(ua); err != nil || s != v.Canonical {
+		return fmt.Errorf("%w: btcd builds %q, error %v, expected %q",
+			ErrVectorMismatch, s, err, v.Canonical)
+	}
+	ua, err = Parse(v.Canonical)
+	if err != nil || !sameUserAgent(ua, v.Components) {
+		return fmt.Errorf("%w: canonical user agent parses to %+v, "+
+			"error %v", ErrVectorMismatch, ua, err)
+	}
+	return nil
+}
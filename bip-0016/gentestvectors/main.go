@@ -0,0 +1,292 @@
+// This program writes test vectors for the p2sh package: P2SH outputs
+// spent by plain and nested witness redeem scripts, by signature scripts
+// push only and not and with witnesses missing, unexpected and mismatched,
+// one second before the activation of BIP 16 and from it on, with the rules
+// of segwit and without, followed by random spends, to spends.json, and
+// the signature operations of bare, P2SH and witness outputs, of keys and
+// multisigs, followed by random scripts of them, to sigops.json. The
+// vectors depend only on -seed and -count, so they can be regenerated by
+// anyone:
+//
+//	gentestvectors -count 50 -seed 16
+//
+// Both files use the layout of the BIP 158 vectors: a JSON array whose
+// first row names the columns, followed by one row per vector. Scripts are
+// in hex, witnesses lists of their items in hex, and the errors of spends
+// that fail by their messages, empty for those that pass. Pass -check and
+// -check-sigops to verify existing files against the package, and against
+// the script engine and signature operation counts of btcd, instead:
+//
+//	gentestvectors -check spends.json -check-sigops sigops.json
+//
+// The program lives in a directory of its own since the p2sh package sits
+// at the root of the module.
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/btcsuite/btcd/wire"
+	p2sh "github.com/christsim/bips/bip-0016"
+	"github.com/christsim/bips/internal/vectorfile"
+)
+
+// spendColumns is the header row of the spend vector file.
+const spendColumns = "Timestamp,Segwit,Script Sig,Pk Script,Witness,Error," +
+	"Comment"
+
+// sigOpColumns is the header row of the signature operation vector file.
+const sigOpColumns = "Script Sig,Pk Script,Witness,Legacy Sig Ops," +
+	"P2SH Sig Ops,Witness Sig Ops,Comment"
+
+type JSONTestWriter struct {
+	writer          io.Writer
+	firstRowWritten bool
+}
+
+func NewJSONTestWriter(writer io.Writer) *JSONTestWriter {
+	return &JSONTestWriter{writer: writer}
+}
+
+func (w *JSONTestWriter) WriteComment(comment string) error {
+	return w.WriteTestCase([]interface{}{comment})
+}
+
+func (w *JSONTestWriter) WriteTestCase(row []interface{}) error {
+	var err error
+	if w.firstRowWritten {
+		_, err = io.WriteString(w.writer, ",\n")
+	} else {
+		_, err = io.WriteString(w.writer, "[\n")
+		w.firstRowWritten = true
+	}
+	if err != nil {
+		return err
+	}
+
+	rowBytes, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.writer.Write(rowBytes)
+	return err
+}
+
+func (w *JSONTestWriter) Close() error {
+	if !w.firstRowWritten {
+		return nil
+	}
+
+	_, err := io.WriteString(w.writer, "\n]\n")
+	return err
+}
+
+func main() {
+	out := flag.String("out", "spends.json", "file to write the spend "+
+		"vectors to")
+	sigOpsOut := flag.String("sigops-out", "sigops.json", "file to "+
+		"write the signature operation vectors to")
+	count := flag.Int("count", 50, "number of random spends and "+
+		"scripts to write vectors of")
+	seed := flag.Int64("seed", 16, "seed of the random vectors")
+	check := flag.String("check", "", "spend vector file to check "+
+		"instead of writing the files")
+	checkSigOps := flag.String("check-sigops", "", "signature "+
+		"operation vector file to check instead of writing the files")
+	flag.Parse()
+
+	var err error
+	switch {
+	case *check != "" || *checkSigOps != "":
+		if *check != "" {
+			err = checkFile(*check)
+		}
+		if err == nil && *checkSigOps != "" {
+			err = checkSigOpsFile(*checkSigOps)
+		}
+	default:
+		err = writeFile(*out, *seed, *count)
+		if err == nil {
+			err = writeSigOpsFile(*sigOpsOut, *seed, *count)
+		}
+	}
+	if err != nil {
+		fmt.Println("Error: ", err.Error())
+		os.Exit(1)
+	}
+}
+
+// writeRows writes the header and rows to a new vector file at path.
+func writeRows(path, columns string, rows [][]interface{}) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := NewJSONTestWriter(file)
+	if err := writer.WriteComment(columns); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if err := writer.WriteTestCase(row); err != nil {
+			return err
+		}
+	}
+	return writer.Close()
+}
+
+// hexList returns the items of the witness in hex.
+func hexList(witness wire.TxWitness) []string {
+	list := make([]string, len(witness))
+	for i, item := range witness {
+		list[i] = hex.EncodeToString(item)
+	}
+	return list
+}
+
+// parseHexList returns the witness of the items in hex, nil if there are
+// none.
+func parseHexList(list []string) (wire.TxWitness, error) {
+	var witness wire.TxWitness
+	for _, s := range list {
+		item, err := hex.DecodeString(s)
+		if err != nil {
+			return nil, err
+		}
+		witness = append(witness, item)
+	}
+	return witness, nil
+}
+
+// writeFile writes the spend vectors, with count random ones, to out.
+func writeFile(out string, seed int64, count int) error {
+	var rows [][]interface{}
+	vectors := p2sh.SpendVectors(seed, count)
+	for _, v := range vectors {
+		rows = append(rows, []interface{}{
+			v.Timestamp,
+			v.Segwit,
+			hex.EncodeToString(v.ScriptSig),
+			hex.EncodeToString(v.PkScript),
+			hexList(v.Witness),
+			vectorfile.ErrorString(v.Err),
+			v.Comment,
+		})
+	}
+	if err := writeRows(out, spendColumns, rows); err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote %d spend vectors\n", len(vectors))
+	return nil
+}
+
+// writeSigOpsFile writes the signature operation vectors, with count random
+// ones, to out.
+func writeSigOpsFile(out string, seed int64, count int) error {
+	var rows [][]interface{}
+	vectors := p2sh.SigOpVectors(seed, count)
+	for _, v := range vectors {
+		rows = append(rows, []interface{}{
+			hex.EncodeToString(v.ScriptSig),
+			hex.EncodeToString(v.PkScript),
+			hexList(v.Witness),
+			v.LegacySigOps,
+			v.P2SHSigOps,
+			v.WitnessSigOps,
+			v.Comment,
+		})
+	}
+	if err := writeRows(out, sigOpColumns, rows); err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote %d signature operation vectors\n", len(vectors))
+	return nil
+}
+
+// decodeScripts decodes the signature script, output script and witness of
+// a row.
+func decodeScripts(scriptSig, pkScript string,
+	witness []string) ([]byte, []byte, wire.TxWitness, error) {
+
+	sigBytes, err := hex.DecodeString(scriptSig)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	pkBytes, err := hex.DecodeString(pkScript)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	items, err := parseHexList(witness)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return sigBytes, pkBytes, items, nil
+}
+
+// checkFile checks each vector of the file with p2sh.CheckSpendVector.
+func checkFile(path string) error {
+	rows, err := vectorfile.ReadRows(path, 7)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		var v p2sh.SpendVector
+		var scriptSig, pkScript, errMsg string
+		var witness []string
+		err := vectorfile.DecodeRow(row, &v.Timestamp, &v.Segwit,
+			&scriptSig, &pkScript, &witness, &errMsg, &v.Comment)
+		if err != nil {
+			return err
+		}
+		v.ScriptSig, v.PkScript, v.Witness, err = decodeScripts(
+			scriptSig, pkScript, witness)
+		if err != nil {
+			return fmt.Errorf("%v: %v", v.Comment, err)
+		}
+		v.Err = vectorfile.ParseError(errMsg)
+		if err := p2sh.CheckSpendVector(v); err != nil {
+			return fmt.Errorf("%v: %v", v.Comment, err)
+		}
+	}
+	fmt.Printf("%d spend vectors OK\n", len(rows))
+	return nil
+}
+
+// checkSigOpsFile checks each vector of the file with
+// p2sh.CheckSigOpVector.
+func checkSigOpsFile(path string) error {
+	rows, err := vectorfile.ReadRows(path, 7)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		var v p2sh.SigOpVector
+		var scriptSig, pkScript string
+		var witness []string
+		err := vectorfile.DecodeRow(row, &scriptSig, &pkScript,
+			&witness, &v.LegacySigOps, &v.P2SHSigOps,
+			&v.WitnessSigOps, &v.Comment)
+		if err != nil {
+			return err
+		}
+		v.ScriptSig, v.PkScript, v.Witness, err = decodeScripts(
+			scriptSig, pkScript, witness)
+		if err != nil {
+			return fmt.Errorf("%v: %v", v.Comment, err)
+		}
+		if err := p2sh.CheckSigOpVector(v); err != nil {
+			return fmt.Errorf("%v: %v", v.Comment, err)
+		}
+	}
+	fmt.Printf("%d signature operation vectors OK\n", len(rows))
+	return nil
+}
@@ -0,0 +1,320 @@
+// Package p2sh implements pay to script hash, the outputs of BIP 16 that
+// commit to the hash of a redeem script, which the signature script of the
+// input spending them reveals as its last push:
+//
+//	pkScript := p2sh.PkScript(redeemScript)
+//	err := p2sh.CheckSpend(scriptSig, pkScript, witness, timestamp, true)
+//
+// An output script of the form OP_HASH160 <20 bytes> OP_EQUAL only checks
+// the hash of the top of the stack, which is all nodes not enforcing BIP 16
+// do. Those enforcing it, in blocks from ActivationTime on, also require
+// the signature script to be push only, and execute the redeem script on
+// the rest of the stack. The signature operations of the redeem script
+// count toward the limit of the block, counted accurately, as P2SHSigOps
+// does, since the script is known.
+//
+// Segregated witness nests its programs in P2SH: a redeem script that is a
+// witness program is spent by a witness, as a native one would be, and the
+// signature script must then be the single push of the program, so that
+// nothing in it can be malleated. CheckSpend checks the rules of BIP 16 and
+// of the nested witness programs, but leaves executing the scripts to the
+// interpreter, and the vectors are also checked against the script engine
+// of btcd.
+package p2sh
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+const (
+	// PkScriptLen is the length of a P2SH output script.
+	PkScriptLen = 23
+
+	// MaxRedeemScriptLen is the length of the longest redeem script, the
+	// longest push the interpreter allows.
+	MaxRedeemScriptLen = txscript.MaxScriptElementSize
+)
+
+// ActivationTime is the block timestamp from which BIP 16 is enforced on
+// mainnet, April 1, 2012.
+var ActivationTime = time.Unix(1333238400, 0)
+
+var (
+	// ErrEmptyScriptSig is returned for a P2SH output spent by an empty
+	// signature script, which reveals no redeem script.
+	ErrEmptyScriptSig = errors.New("p2sh: empty signature script")
+
+	// ErrNotPushOnly is returned for a P2SH output spent by a signature
+	// script with opcodes other than pushes.
+	ErrNotPushOnly = errors.New("p2sh: signature script not push only")
+
+	// ErrMalformedScript is returned for a signature script that fails to
+	// parse.
+	ErrMalformedScript = errors.New("p2sh: malformed script")
+
+	// ErrRedeemScriptTooLong is returned for a redeem script longer than
+	// MaxRedeemScriptLen.
+	ErrRedeemScriptTooLong = errors.New("p2sh: redeem script too long")
+
+	// ErrHashMismatch is returned for a redeem script whose hash isn't
+	// the one the output commits to.
+	ErrHashMismatch = errors.New("p2sh: redeem script hash mismatch")
+
+	// ErrNotSinglePush is returned for a nested witness program whose
+	// signature script is more than the single push of it.
+	ErrNotSinglePush = errors.New("p2sh: signature script of a witness " +
+		"program not a single push")
+
+	// ErrWitnessUnexpected is returned for a witness spending a redeem
+	// script that isn't a witness program.
+	ErrWitnessUnexpected = errors.New("p2sh: unexpected witness")
+
+	// ErrWitnessMismatch is returned for a witness that doesn't match its
+	// program: one of other than two items, or whose public key hashes to
+	// another program, for a P2WPKH program, or an empty one, or one whose
+	// witness script hashes to another program, for a P2WSH program.
+	ErrWitnessMismatch = errors.New("p2sh: witness program mismatch")
+
+	// ErrWitnessProgramLen is returned for a version 0 witness program of
+	// neither 20 nor 32 bytes.
+	ErrWitnessProgramLen = errors.New("p2sh: bad witness program length")
+)
+
+// Form is the form of the redeem script of a P2SH output.
+type Form int
+
+const (
+	// NotP2SH is the form of an output that isn't P2SH.
+	NotP2SH Form = iota
+
+	// Plain is the form of a redeem script that isn't a witness program.
+	Plain
+
+	// NestedP2WPKH and NestedP2WSH are the forms of version 0 witness
+	// programs of a key hash and a script hash.
+	NestedP2WPKH
+	NestedP2WSH
+
+	// NestedWitness is the form of any other witness program.
+	NestedWitness
+)
+
+// formNames are the names of the forms.
+var formNames = map[Form]string{
+	NotP2SH:       "NOT_P2SH",
+	Plain:         "P2SH",
+	NestedP2WPKH:  "P2SH-P2WPKH",
+	NestedP2WSH:   "P2SH-P2WSH",
+	NestedWitness: "P2SH-WITNESS",
+}
+
+// String returns the name of the form.
+func (f Form) String() string {
+	if name, ok := formNames[f]; ok {
+		return name
+	}
+	return fmt.Sprintf("Form(%d)", int(f))
+}
+
+// Active reports whether BIP 16 is enforced in a block of the timestamp.
+func Active(timestamp time.Time) bool {
+	return !timestamp.Before(ActivationTime)
+}
+
+// IsP2SH reports whether the output script is OP_HASH160 <20 bytes>
+// OP_EQUAL.
+func IsP2SH(pkScript []byte) bool {
+	return len(pkScript) == PkScriptLen &&
+		pkScript[0] == txscript.OP_HASH160 &&
+		pkScript[1] == txscript.OP_DATA_20 &&
+		pkScript[22] == txscript.OP_EQUAL
+}
+
+// PkScript returns the output script committing to the redeem script.
+func PkScript(redeemScript []byte) []byte {
+	script := []byte{txscript.OP_HASH160, txscript.OP_DATA_20}
+	script = append(script, btcutil.Hash160(redeemScript)...)
+	return append(script, txscript.OP_EQUAL)
+}
+
+// IsPushOnly reports whether the script parses and has no opcodes other
+// than pushes, OP_1NEGATE, OP_RESERVED and the small integers included.
+func IsPushOnly(script []byte) bool {
+	tokenizer := txscript.MakeScriptTokenizer(0, script)
+	for tokenizer.Next() {
+		if tokenizer.Opcode() > txscript.OP_16 {
+			return false
+		}
+	}
+	return tokenizer.Err() == nil
+}
+
+// lastPush returns what the last push of the push only signature script
+// leaves on the stack: its data, or the byte of a small integer.
+func lastPush(scriptSig []byte) ([]byte, error) {
+	if len(scriptSig) == 0 {
+		return nil, ErrEmptyScriptSig
+	}
+
+	var data []byte
+	tokenizer := txscript.MakeScriptTokenizer(0, scriptSig)
+	for tokenizer.Next() {
+		switch op := tokenizer.Opcode(); {
+		case op > txscript.OP_16:
+			return nil, fmt.Errorf("%w: opcode %#x", ErrNotPushOnly,
+				op)
+		case op == txscript.OP_1NEGATE:
+			data = []byte{0x81}
+		case op >= txscript.OP_1:
+			data = []byte{op - txscript.OP_1 + 1}
+		default:
+			data = tokenizer.Data()
+		}
+	}
+	if err := tokenizer.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedScript, err)
+	}
+	return data, nil
+}
+
+// RedeemScript returns the redeem script the signature script reveals, the
+// data of its last push.
+func RedeemScript(scriptSig []byte) ([]byte, error) {
+	data, err := lastPush(scriptSig)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxRedeemScriptLen {
+		return nil, fmt.Errorf("%w: %d bytes", ErrRedeemScriptTooLong,
+			len(data))
+	}
+	return data, nil
+}
+
+// WitnessProgram returns the version and program of the script if it is a
+// witness program: a small integer followed by a push of 2 to 40 bytes.
+func WitnessProgram(script []byte) (int, []byte, bool) {
+	if len(script) < 4 || len(script) > 42 {
+		return 0, nil, false
+	}
+	version := script[0]
+	if version != txscript.OP_0 &&
+		(version < txscript.OP_1 || version > txscript.OP_16) {
+
+		return 0, nil, false
+	}
+	if int(script[1]) != len(script)-2 {
+		return 0, nil, false
+	}
+	if version == txscript.OP_0 {
+		return 0, script[2:], true
+	}
+	return int(version - txscript.OP_1 + 1), script[2:], true
+}
+
+// Classify returns the form of the redeem script the signature script
+// reveals to spend the output, Plain if it reveals none.
+func Classify(scriptSig, pkScript []byte) Form {
+	if !IsP2SH(pkScript) {
+		return NotP2SH
+	}
+	redeemScript, err := RedeemScript(scriptSig)
+	if err != nil {
+		return Plain
+	}
+	version, program, ok := WitnessProgram(redeemScript)
+	switch {
+	case !ok:
+		return Plain
+	case version == 0 && len(program) == 20:
+		return NestedP2WPKH
+	case version == 0 && len(program) == 32:
+		return NestedP2WSH
+	default:
+		return NestedWitness
+	}
+}
+
+// CheckSpend checks the signature script and witness of an input spending
+// the output in a block of the timestamp. Outputs that aren't P2SH, and
+// the rules of BIP 16 before ActivationTime, are left to the interpreter,
+// but for the hash of the redeem script of a push only signature script,
+// which the output script itself checks. If segwit is set, the rules of
+// nested witness programs apply.
+func CheckSpend(scriptSig, pkScript []byte, witness wire.TxWitness,
+	timestamp time.Time, segwit bool) error {
+
+	if !IsP2SH(pkScript) {
+		return nil
+	}
+	if !Active(timestamp) && !IsPushOnly(scriptSig) {
+		return nil
+	}
+	redeemScript, err := RedeemScript(scriptSig)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(btcutil.Hash160(redeemScript), pkScript[2:22]) {
+		return fmt.Errorf("%w: %x", ErrHashMismatch, redeemScript)
+	}
+	if !Active(timestamp) || !segwit {
+		return nil
+	}
+
+	version, program, ok := WitnessProgram(redeemScript)
+	if !ok {
+		if len(witness) > 0 {
+			return fmt.Errorf("%w: %d items", ErrWitnessUnexpected,
+				len(witness))
+		}
+		return nil
+	}
+	if len(scriptSig) != len(redeemScript)+1 {
+		return fmt.Errorf("%w: %x", ErrNotSinglePush, scriptSig)
+	}
+	return checkWitness(version, program, witness)
+}
+
+// checkWitness checks that the witness matches the witness program of the
+// version. Programs of other versions than 0 are left for future rules.
+func checkWitness(version int, program []byte,
+	witness wire.TxWitness) error {
+
+	if version != 0 {
+		return nil
+	}
+	switch len(program) {
+	case 20:
+		if len(witness) != 2 {
+			return fmt.Errorf("%w: %d items for P2WPKH",
+				ErrWitnessMismatch, len(witness))
+		}
+		hash := btcutil.Hash160(witness[1])
+		if !bytes.Equal(hash, program) {
+			return fmt.Errorf("%w: public key of hash %x",
+				ErrWitnessMismatch, hash)
+		}
+	case 32:
+		if len(witness) == 0 {
+			return fmt.Errorf("%w: empty witness for P2WSH",
+				ErrWitnessMismatch)
+		}
+		hash := sha256.Sum256(witness[len(witness)-1])
+		if !bytes.Equal(hash[:], program) {
+			return fmt.Errorf("%w: witness script of hash %x",
+				ErrWitnessMismatch, hash)
+		}
+	default:
+		return fmt.Errorf("%w: %d bytes", ErrWitnessProgramLen,
+			len(program))
+	}
+	return nil
+}
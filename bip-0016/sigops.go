@@ -0,0 +1,81 @@
+package p2sh
+
+import (
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// MaxPubKeysPerMultiSig is the number of signature operations an
+// OP_CHECKMULTISIG counts for when its number of keys isn't counted.
+const MaxPubKeysPerMultiSig = txscript.MaxPubKeysPerMultiSig
+
+// SigOps returns the number of signature operations of the script, up to
+// the first opcode that fails to parse. OP_CHECKSIG and OP_CHECKSIGVERIFY
+// count for one, and OP_CHECKMULTISIG and OP_CHECKMULTISIGVERIFY for
+// MaxPubKeysPerMultiSig, or, if accurate is set and they follow OP_1 to
+// OP_16, for that number of keys, as they do in redeem and witness scripts.
+func SigOps(script []byte, accurate bool) int {
+	n := 0
+	prevOp := byte(txscript.OP_INVALIDOPCODE)
+	tokenizer := txscript.MakeScriptTokenizer(0, script)
+	for tokenizer.Next() {
+		switch op := tokenizer.Opcode(); op {
+		case txscript.OP_CHECKSIG, txscript.OP_CHECKSIGVERIFY:
+			n++
+		case txscript.OP_CHECKMULTISIG,
+			txscript.OP_CHECKMULTISIGVERIFY:
+
+			if accurate && prevOp >= txscript.OP_1 &&
+				prevOp <= txscript.OP_16 {
+
+				n += int(prevOp - txscript.OP_1 + 1)
+			} else {
+				n += MaxPubKeysPerMultiSig
+			}
+		}
+		prevOp = tokenizer.Opcode()
+	}
+	return n
+}
+
+// P2SHSigOps returns the number of signature operations of the redeem
+// script the signature script reveals to spend the output, counted
+// accurately, which BIP 16 adds to those of the scripts themselves. It is
+// zero for an output that isn't P2SH, or a signature script that isn't
+// push only, but counted for redeem scripts too long to execute.
+func P2SHSigOps(scriptSig, pkScript []byte) int {
+	if !IsP2SH(pkScript) {
+		return 0
+	}
+	redeemScript, err := lastPush(scriptSig)
+	if err != nil {
+		return 0
+	}
+	return SigOps(redeemScript, true)
+}
+
+// WitnessSigOps returns the number of signature operations of spending the
+// output, a native witness program or one nested in P2SH, with the witness:
+// one for a P2WPKH program, and those of the witness script, counted
+// accurately, for a P2WSH program. It is zero for any other output, and for
+// witness programs of other versions.
+func WitnessSigOps(scriptSig, pkScript []byte, witness wire.TxWitness) int {
+	program := pkScript
+	if IsP2SH(pkScript) {
+		var err error
+		if program, err = lastPush(scriptSig); err != nil {
+			return 0
+		}
+	}
+	version, program, ok := WitnessProgram(program)
+	switch {
+	case !ok || version != 0:
+		return 0
+	case len(program) == 20:
+		return 1
+	case len(program) == 32 && len(witness) > 0:
+		return SigOps(witness[len(witness)-1], true)
+	default:
+		return 0
+	}
+}
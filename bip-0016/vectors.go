@@ -0,0 +1,492 @@
+package p2sh
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/christsim/bips/internal/vectorfile"
+)
+
+// ErrVectorMismatch is returned by CheckSpendVector and CheckSigOpVector
+// when a vector, checked with the package or the script engine of btcd,
+// doesn't give the expected result.
+var ErrVectorMismatch = errors.New("p2sh: vector mismatch")
+
+// spendValue is the value of the outputs the vectors spend, which P2WPKH
+// signatures commit to.
+const spendValue = 100000
+
+// SpendVector is an output script spent by a signature script and witness
+// in a block of the timestamp, with the rules of segwit or without, and the
+// error CheckSpend gives, nil if the rules pass.
+type SpendVector struct {
+	Timestamp int64
+	Segwit    bool
+	ScriptSig []byte
+	PkScript  []byte
+	Witness   wire.TxWitness
+
+	Err error
+
+	// Comment describes what the vector exercises.
+	Comment string
+}
+
+// newSpendVector returns the vector of spending the output script.
+func newSpendVector(timestamp int64, segwit bool, scriptSig,
+	pkScript []byte, witness wire.TxWitness, comment string) SpendVector {
+
+	return SpendVector{
+		Timestamp: timestamp,
+		Segwit:    segwit,
+		ScriptSig: scriptSig,
+		PkScript:  pkScript,
+		Witness:   witness,
+		Err: CheckSpend(scriptSig, pkScript, witness,
+			time.Unix(timestamp, 0), segwit),
+		Comment: comment,
+	}
+}
+
+// spendTx returns the transaction spending an output of spendValue with the
+// signature script and witness.
+func spendTx(scriptSig []byte, witness wire.TxWitness) *wire.MsgTx {
+	tx := wire.NewMsgTx(2)
+	txIn := wire.NewTxIn(&wire.OutPoint{}, scriptSig, witness)
+	tx.AddTxIn(txIn)
+	tx.AddTxOut(wire.NewTxOut(spendValue-1000, []byte{txscript.OP_TRUE}))
+	return tx
+}
+
+// push returns the script pushing the data.
+func push(data ...[]byte) []byte {
+	builder := txscript.NewScriptBuilder()
+	for _, d := range data {
+		builder.AddFullData(d)
+	}
+	script, _ := builder.Script()
+	return script
+}
+
+// vectorKey is the key of the P2WPKH programs of the vectors.
+var vectorKey, _ = btcec.PrivKeyFromBytes(bytes.Repeat([]byte{0x01}, 32))
+
+// p2wpkh returns the P2WPKH program of vectorKey, nested in P2SH, and the
+// witness spending it by spendTx.
+func p2wpkh() ([]byte, wire.TxWitness) {
+	pubKeyHash := btcutil.Hash160(vectorKey.PubKey().SerializeCompressed())
+	program := append([]byte{txscript.OP_0, txscript.OP_DATA_20},
+		pubKeyHash...)
+
+	scriptSig := push(program)
+	tx := spendTx(scriptSig, nil)
+	fetcher := txscript.NewCannedPrevOutputFetcher(PkScript(program),
+		spendValue)
+	witness, err := txscript.WitnessSignature(tx,
+		txscript.NewTxSigHashes(tx, fetcher), 0, spendValue, program,
+		txscript.SigHashAll, vectorKey, true)
+	if err != nil {
+		panic(err)
+	}
+	return program, witness
+}
+
+// p2wsh returns the P2WSH program of the witness script.
+func p2wsh(witnessScript []byte) []byte {
+	hash := sha256.Sum256(witnessScript)
+	return append([]byte{txscript.OP_0, txscript.OP_DATA_32}, hash[:]...)
+}
+
+// SpendVectors returns vectors of P2SH outputs spent by plain and nested
+// witness redeem scripts, by signature scripts push only and not, pushing
+// the redeem script of another hash, none or one too long, and with
+// witnesses missing, unexpected and mismatched, one second before
+// ActivationTime and from it on, with the rules of segwit and without.
+// They are followed by count random spends of random redeem scripts,
+// broken in random ways or not, around ActivationTime, derived from a
+// math/rand source with the seed.
+func SpendVectors(rngSeed int64, count int) []SpendVector {
+	trueScript := []byte{txscript.OP_TRUE}
+	equal2 := []byte{txscript.OP_2, txscript.OP_EQUAL}
+	nop := []byte{txscript.OP_NOP}
+	longest := bytes.Repeat(trueScript, MaxRedeemScriptLen)
+	tooLong := bytes.Repeat(trueScript, MaxRedeemScriptLen+1)
+	equalVerify := append([]byte{txscript.OP_HASH160, txscript.OP_DATA_20},
+		btcutil.Hash160(trueScript)...)
+	equalVerify = append(equalVerify, txscript.OP_EQUALVERIFY,
+		txscript.OP_TRUE)
+
+	wpkh, wpkhWitness := p2wpkh()
+	wsh, wshArg := p2wsh(trueScript), p2wsh(equal2)
+	wpkhSig := push(wpkh)
+	v1 := append([]byte{txscript.OP_1, txscript.OP_DATA_32},
+		bytes.Repeat([]byte{0x01}, 32)...)
+	v0Long := append([]byte{txscript.OP_0, 25},
+		bytes.Repeat([]byte{0x01}, 25)...)
+	pushdata1 := func(data []byte) []byte {
+		return append([]byte{txscript.OP_PUSHDATA1, byte(len(data))},
+			data...)
+	}
+
+	cases := []struct {
+		scriptSig []byte
+		pkScript  []byte
+		witness   wire.TxWitness
+		comment   string
+	}{
+		{push(trueScript), PkScript(trueScript), nil,
+			"OP_TRUE redeem script"},
+		{append([]byte{txscript.OP_2}, push(equal2)...),
+			PkScript(equal2), nil,
+			"Redeem script with an argument"},
+		{pushdata1(trueScript), PkScript(trueScript), nil,
+			"Redeem script pushed by PUSHDATA1"},
+		{append(nop, push(trueScript)...), PkScript(trueScript), nil,
+			"Not push only, OP_NOP"},
+		{append(push(trueScript), txscript.OP_DUP),
+			PkScript(trueScript), nil,
+			"Not push only, redeem script pushed by OP_DUP"},
+		{append([]byte{txscript.OP_2}, push(equal2)...),
+			PkScript(trueScript), nil,
+			"Redeem script of another hash"},
+		{nil, PkScript(trueScript), nil, "Empty signature script"},
+		{push(longest), PkScript(longest), nil,
+			"Redeem script of 520 bytes"},
+		{push(tooLong), PkScript(tooLong), nil,
+			"Redeem script of 521 bytes"},
+		{push(trueScript), PkScript(trueScript),
+			wire.TxWitness{trueScript},
+			"Witness of a plain redeem script"},
+		{append(nop, push(trueScript)...), equalVerify, nil,
+			"Not P2SH, hash checked by OP_EQUALVERIFY"},
+
+		{wpkhSig, PkScript(wpkh), wpkhWitness, "P2SH-P2WPKH"},
+		{wpkhSig, PkScript(wpkh), nil, "P2SH-P2WPKH, empty witness"},
+		{wpkhSig, PkScript(wpkh), wpkhWitness[:1],
+			"P2SH-P2WPKH, witness of one item"},
+		{wpkhSig, PkScript(wpkh), append(wpkhWitness, trueScript),
+			"P2SH-P2WPKH, witness of three items"},
+		{append([]byte{txscript.OP_0}, wpkhSig...), PkScript(wpkh),
+			wpkhWitness, "P2SH-P2WPKH, extra push"},
+		{pushdata1(wpkh), PkScript(wpkh), wpkhWitness,
+			"P2SH-P2WPKH, program pushed by PUSHDATA1"},
+		{push(wsh), PkScript(wsh), wire.TxWitness{trueScript},
+			"P2SH-P2WSH"},
+		{push(wshArg), PkScript(wshArg),
+			wire.TxWitness{{0x02}, equal2},
+			"P2SH-P2WSH, witness script with an argument"},
+		{push(wsh), PkScript(wsh), nil, "P2SH-P2WSH, empty witness"},
+		{push(wsh), PkScript(wsh), wire.TxWitness{equal2},
+			"P2SH-P2WSH, witness script of another hash"},
+		{push(wsh), PkScript(wsh), wire.TxWitness{trueScript, wsh},
+			"P2SH-P2WSH, program as witness script"},
+		{push(v0Long), PkScript(v0Long), wire.TxWitness{trueScript},
+			"P2SH, version 0 program of 25 bytes"},
+		{push(v1), PkScript(v1), wire.TxWitness{trueScript},
+			"P2SH, version 1 program"},
+	}
+
+	before := ActivationTime.Unix() - 1
+	at := ActivationTime.Unix()
+	var vectors []SpendVector
+	for _, c := range cases {
+		vectors = append(vectors,
+			newSpendVector(before, false, c.scriptSig, c.pkScript,
+				c.witness, c.comment+", before activation"),
+			newSpendVector(at, false, c.scriptSig, c.pkScript,
+				c.witness, c.comment+", at activation"),
+			newSpendVector(at, true, c.scriptSig, c.pkScript,
+				c.witness, c.comment+", at activation, segwit"))
+	}
+
+	rng := rand.New(rand.NewSource(rngSeed))
+	for n := 0; n < count; n++ {
+		timestamp := at + int64(rng.Intn(7200)) - 3600
+		segwit := timestamp >= at && rng.Intn(2) == 0
+		c := cases[rng.Intn(len(cases))]
+		scriptSig, pkScript := c.scriptSig, c.pkScript
+		witness := c.witness
+		comment := "Random"
+
+		// Before ActivationTime, only the interpreter can tell what a
+		// signature script that isn't push only leaves on the stack, so
+		// it is only made so for spends that pass, which OP_NOP can't
+		// fail. Witnesses are only checked for P2SH outputs.
+		m := rng.Intn(4)
+		switch {
+		case m == 0 && CheckSpend(scriptSig, pkScript, witness,
+			time.Unix(before, 0), false) == nil:
+
+			scriptSig = append([]byte{txscript.OP_NOP},
+				scriptSig...)
+			comment += ", OP_NOP prepended"
+		case m == 1 && IsPushOnly(scriptSig):
+			pkScript = PkScript(equal2)
+			comment += ", redeem script of another hash"
+		case m == 2 && IsP2SH(pkScript):
+			witness = append(append(wire.TxWitness{}, witness...),
+				[]byte{0x01})
+			comment += ", witness item appended"
+		}
+		vectors = append(vectors, newSpendVector(timestamp, segwit,
+			scriptSig, pkScript, witness, comment))
+	}
+	return vectors
+}
+
+// CheckSpendVector checks the spend of the vector with CheckSpend, and with
+// the script engine of btcd, with the flags of BIP 16 and segwit as they
+// apply, which must agree on whether it passes. The engine only checks the
+// witness of a nested witness program if it isn't empty, and passes those
+// that are as the redeem script leaves the program on the stack, so only
+// the package checks them.
+func CheckSpendVector(v SpendVector) error {
+	timestamp := time.Unix(v.Timestamp, 0)
+	err := CheckSpend(v.ScriptSig, v.PkScript, v.Witness, timestamp,
+		v.Segwit)
+	if !vectorfile.SameError(err, v.Err) {
+		return fmt.Errorf("%w: error %v, expected %v",
+			ErrVectorMismatch, err, v.Err)
+	}
+
+	var flags txscript.ScriptFlags
+	if Active(timestamp) {
+		flags |= txscript.ScriptBip16
+		if v.Segwit {
+			flags |= txscript.ScriptVerifyWitness
+		}
+	}
+	form := Classify(v.ScriptSig, v.PkScript)
+	if flags&txscript.ScriptVerifyWitness != 0 && len(v.Witness) == 0 &&
+		form != Plain && form != NotP2SH {
+
+		return nil
+	}
+
+	tx := spendTx(v.ScriptSig, v.Witness)
+	fetcher := txscript.NewCannedPrevOutputFetcher(v.PkScript,
+		spendValue)
+	vm, err := txscript.NewEngine(v.PkScript, tx, 0, flags, nil,
+		txscript.NewTxSigHashes(tx, fetcher), spendValue, fetcher)
+	if err == nil {
+		err = vm.Execute()
+	}
+	if (err == nil) != (v.Err == nil) {
+		return fmt.Errorf("%w: btcd gives error %v, expected %v",
+			ErrVectorMismatch, err, v.Err)
+	}
+	return nil
+}
+
+// SigOpVector is an output script spent by a signature script and witness,
+// and the numbers of signature operations of the scripts, counted by
+// SigOps, of the redeem script, counted by P2SHSigOps, and of the witness,
+// counted by WitnessSigOps.
+type SigOpVector struct {
+	ScriptSig []byte
+	PkScript  []byte
+	Witness   wire.TxWitness
+
+	LegacySigOps  int
+	P2SHSigOps    int
+	WitnessSigOps int
+
+	// Comment describes what the vector exercises.
+	Comment string
+}
+
+// newSigOpVector returns the vector of spending the output script.
+func newSigOpVector(scriptSig, pkScript []byte, witness wire.TxWitness,
+	comment string) SigOpVector {
+
+	return SigOpVector{
+		ScriptSig: scriptSig,
+		PkScript:  pkScript,
+		Witness:   witness,
+		LegacySigOps: SigOps(scriptSig, false) +
+			SigOps(pkScript, false),
+		P2SHSigOps:    P2SHSigOps(scriptSig, pkScript),
+		WitnessSigOps: WitnessSigOps(scriptSig, pkScript, witness),
+		Comment:       comment,
+	}
+}
+
+// multisig returns the script of an m-of-n multisig of keys of 33 bytes,
+// with m and n pushed as small integers up to 16 and as data past it.
+func multisig(m, n int) []byte {
+	builder := txscript.NewScriptBuilder().AddInt64(int64(m))
+	for i := 0; i < n; i++ {
+		key := bytes.Repeat([]byte{byte(i + 1)}, 33)
+		key[0] = 0x02
+		builder.AddData(key)
+	}
+	script, _ := builder.AddInt64(int64(n)).
+		AddOp(txscript.OP_CHECKMULTISIG).
+		Script()
+	return script
+}
+
+// sigOpCodes are the opcodes random scripts are made of.
+var sigOpCodes = []byte{
+	txscript.OP_CHECKSIG, txscript.OP_CHECKSIGVERIFY,
+	txscript.OP_CHECKMULTISIG, txscript.OP_CHECKMULTISIGVERIFY,
+	txscript.OP_0, txscript.OP_1, txscript.OP_3, txscript.OP_16,
+	txscript.OP_1NEGATE, txscript.OP_DROP, txscript.OP_DATA_1,
+}
+
+// SigOpVectors returns vectors of bare, P2SH, native and nested witness
+// outputs of single keys and multisigs, of their numbers of keys pushed as
+// small integers and not, of scripts cut short and too long to execute,
+// spent by signature scripts push only and not. They are followed by count
+// random scripts of signature operations, as bare outputs, redeem scripts
+// and witness scripts, derived from a math/rand source with the seed.
+func SigOpVectors(rngSeed int64, count int) []SigOpVector {
+	sig := bytes.Repeat([]byte{0x30}, 72)
+	key := vectorKey.PubKey().SerializeCompressed()
+	checkSig := []byte{txscript.OP_CHECKSIG}
+	p2pkh, _ := txscript.NewScriptBuilder().
+		AddOp(txscript.OP_DUP).
+		AddOp(txscript.OP_HASH160).
+		AddData(btcutil.Hash160(key)).
+		AddOp(txscript.OP_EQUALVERIFY).
+		AddOp(txscript.OP_CHECKSIG).
+		Script()
+	mixed := []byte{txscript.OP_CHECKSIG, txscript.OP_CHECKSIGVERIFY,
+		txscript.OP_3, txscript.OP_CHECKMULTISIGVERIFY}
+	cutShort := []byte{txscript.OP_CHECKSIG, txscript.OP_PUSHDATA1}
+	zeroKeys := []byte{txscript.OP_0, txscript.OP_CHECKMULTISIG}
+	wpkh, wpkhWitness := p2wpkh()
+	wsh := p2wsh(multisig(2, 3))
+	tr := append([]byte{txscript.OP_1, txscript.OP_DATA_32},
+		bytes.Repeat([]byte{0x01}, 32)...)
+
+	vectors := []SigOpVector{
+		newSigOpVector(push(sig, key), p2pkh, nil, "P2PKH"),
+		newSigOpVector(push(sig), multisig(1, 2), nil,
+			"Bare 1-of-2 multisig"),
+		newSigOpVector(push(sig, checkSig), p2pkh, nil,
+			"P2PKH, OP_CHECKSIG pushed as data"),
+		newSigOpVector(append(push(sig, key), txscript.OP_CHECKSIG),
+			p2pkh, nil,
+			"P2PKH, OP_CHECKSIG in the signature script"),
+		newSigOpVector(push(sig, sig, multisig(2, 3)),
+			PkScript(multisig(2, 3)), nil, "P2SH 2-of-3 multisig"),
+		newSigOpVector(push(sig, multisig(1, 16)),
+			PkScript(multisig(1, 16)), nil,
+			"P2SH 1-of-16 multisig, too long to execute"),
+		newSigOpVector(push(sig, multisig(1, 17)),
+			PkScript(multisig(1, 17)), nil,
+			"P2SH 1-of-17 multisig, keys pushed as data"),
+		newSigOpVector(push(zeroKeys), PkScript(zeroKeys), nil,
+			"P2SH multisig of zero keys"),
+		newSigOpVector(push(sig, mixed), PkScript(mixed), nil,
+			"P2SH of every signature operation"),
+		newSigOpVector(push(cutShort), PkScript(cutShort), nil,
+			"P2SH redeem script cut short"),
+		newSigOpVector(append(push(sig, multisig(2, 3)),
+			txscript.OP_NOP), PkScript(multisig(2, 3)), nil,
+			"P2SH, signature script not push only"),
+		newSigOpVector(nil, PkScript(multisig(2, 3)), nil,
+			"P2SH, empty signature script"),
+		newSigOpVector(append(push(sig), txscript.OP_PUSHDATA1),
+			PkScript(multisig(2, 3)), nil,
+			"P2SH, signature script cut short"),
+		newSigOpVector(push(sig, multisig(2, 3)), multisig(2, 3), nil,
+			"Redeem script of a bare multisig"),
+		newSigOpVector(nil, wpkh, wpkhWitness, "P2WPKH"),
+		newSigOpVector(nil, wsh,
+			wire.TxWitness{nil, sig, sig, multisig(2, 3)},
+			"P2WSH 2-of-3 multisig"),
+		newSigOpVector(nil, wsh, nil, "P2WSH, empty witness"),
+		newSigOpVector(nil, tr, wire.TxWitness{sig[:64]}, "P2TR"),
+		newSigOpVector(push(wpkh), PkScript(wpkh), wpkhWitness,
+			"P2SH-P2WPKH"),
+		newSigOpVector(push(wsh), PkScript(wsh),
+			wire.TxWitness{nil, sig, sig, multisig(2, 3)},
+			"P2SH-P2WSH 2-of-3 multisig"),
+		newSigOpVector(push(tr), PkScript(tr),
+			wire.TxWitness{sig[:64]}, "P2SH-P2TR"),
+		newSigOpVector(append([]byte{txscript.OP_PUSHDATA1, 22},
+			wpkh...), PkScript(wpkh), wpkhWitness,
+			"P2SH-P2WPKH, program pushed by PUSHDATA1"),
+		newSigOpVector(append(push(wpkh), txscript.OP_NOP),
+			PkScript(wpkh), wpkhWitness,
+			"P2SH-P2WPKH, signature script not push only"),
+	}
+
+	rng := rand.New(rand.NewSource(rngSeed))
+	for n := 0; n < count; n++ {
+		script := make([]byte, 1+rng.Intn(20))
+		for i := range script {
+			script[i] = sigOpCodes[rng.Intn(len(sigOpCodes))]
+		}
+		var v SigOpVector
+		switch rng.Intn(4) {
+		case 0:
+			v = newSigOpVector(nil, script, nil, "Random bare")
+		case 1:
+			v = newSigOpVector(push(script), PkScript(script), nil,
+				"Random P2SH")
+		case 2:
+			v = newSigOpVector(nil, p2wsh(script),
+				wire.TxWitness{script}, "Random P2WSH")
+		default:
+			v = newSigOpVector(push(p2wsh(script)),
+				PkScript(p2wsh(script)), wire.TxWitness{script},
+				"Random P2SH-P2WSH")
+		}
+		vectors = append(vectors, v)
+	}
+	return vectors
+}
+
+// CheckSigOpVector counts the signature operations of the vector with
+// SigOps, P2SHSigOps and WitnessSigOps, and with the counts of btcd, which
+// must agree. Btcd only finds a nested witness program pushed by a single
+// byte opcode, which the signature script of one must be anyway, so its
+// count isn't checked for others.
+func CheckSigOpVector(v SigOpVector) error {
+	legacy := SigOps(v.ScriptSig, false) + SigOps(v.PkScript, false)
+	p2sh := P2SHSigOps(v.ScriptSig, v.PkScript)
+	witness := WitnessSigOps(v.ScriptSig, v.PkScript, v.Witness)
+	if legacy != v.LegacySigOps || p2sh != v.P2SHSigOps ||
+		witness != v.WitnessSigOps {
+
+		return fmt.Errorf("%w: sigops %d, %d and %d, expected %d, %d "+
+			"and %d", ErrVectorMismatch, legacy, p2sh, witness,
+			v.LegacySigOps, v.P2SHSigOps, v.WitnessSigOps)
+	}
+
+	btcdLegacy := txscript.GetSigOpCount(v.ScriptSig) +
+		txscript.GetSigOpCount(v.PkScript)
+	btcdP2SH := 0
+	if IsP2SH(v.PkScript) {
+		btcdP2SH = txscript.GetPreciseSigOpCount(v.ScriptSig,
+			v.PkScript, true)
+	}
+	btcdWitness := witness
+	redeemScript, err := RedeemScript(v.ScriptSig)
+	if !IsP2SH(v.PkScript) || err != nil ||
+		len(v.ScriptSig) == len(redeemScript)+1 {
+
+		btcdWitness = txscript.GetWitnessSigOpCount(v.ScriptSig,
+			v.PkScript, v.Witness)
+	}
+	if btcdLegacy != legacy || btcdP2SH != p2sh ||
+		btcdWitness != witness {
+
+		return fmt.Errorf("%w: btcd counts %d, %d and %d sigops, "+
+			"expected %d, %d and %d", ErrVectorMismatch,
+			btcdLegacy, btcdP2SH, btcdWitness, legacy, p2sh,
+			witness)
+	}
+	return nil
+}
@@ -0,0 +1,255 @@
+package paymenturi
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	bech32 "github.com/christsim/bips/bip-0173"
+	silentpayments "github.com/christsim/bips/bip-0352"
+)
+
+// Extension is a parameter a payment URI can have past those of BIP 21.
+type Extension struct {
+	// Key is the key of the parameter, without the req- prefix.
+	Key string
+
+	// Destination is set for an extension that says where to pay, which
+	// lets the URI leave out the address.
+	Destination bool
+
+	// Check checks the decoded value of the parameter for the network.
+	Check func(value string, net *chaincfg.Params) error
+}
+
+// Registry is a set of extensions, by key.
+type Registry map[string]Extension
+
+// Register adds the extension to the registry, with its key lowered.
+func (r Registry) Register(ext Extension) error {
+	key := strings.ToLower(ext.Key)
+	switch key {
+	case "", AmountKey, LabelKey, MessageKey:
+		return fmt.Errorf("%w: %q", ErrReservedKey, ext.Key)
+	}
+	if strings.HasPrefix(key, RequiredPrefix) {
+		return fmt.Errorf("%w: %q", ErrReservedKey, ext.Key)
+	}
+	if _, ok := r[key]; ok {
+		return fmt.Errorf("%w: %s", ErrDuplicateExtension, key)
+	}
+	ext.Key = key
+	r[key] = ext
+	return nil
+}
+
+// DefaultRegistry returns a new registry of the extensions of this package:
+// Lightning, Offer, SilentPayment and Name.
+func DefaultRegistry() Registry {
+	r := make(Registry)
+	for _, ext := range []Extension{Lightning, Offer, SilentPayment, Name} {
+		if err := r.Register(ext); err != nil {
+			panic(err)
+		}
+	}
+	return r
+}
+
+var (
+	// Lightning is the lightning parameter, a BOLT 11 invoice that can be
+	// paid instead of the address.
+	Lightning = Extension{
+		Key:         "lightning",
+		Destination: true,
+		Check:       checkInvoice,
+	}
+
+	// Offer is the lno parameter, a BOLT 12 offer that can be paid
+	// instead of the address.
+	Offer = Extension{
+		Key:         "lno",
+		Destination: true,
+		Check:       checkOffer,
+	}
+
+	// SilentPayment is the sp parameter, a silent payment address of BIP
+	// 352 that can be paid instead of the address.
+	SilentPayment = Extension{
+		Key:         "sp",
+		Destination: true,
+		Check:       checkSilentPayment,
+	}
+
+	// Name is the bip353 parameter, the human-readable name of BIP 353,
+	// ₿user@domain, whose DNS record the URI was resolved from, and which
+	// wallets can show in place of the address.
+	Name = Extension{
+		Key:   "bip353",
+		Check: checkName,
+	}
+)
+
+// MaxInvoiceLen is the length of the longest invoice checkInvoice accepts,
+// the most alphanumeric characters a QR code holds.
+const MaxInvoiceLen = 7089
+
+// minInvoiceData is the number of 5-bit groups of the shortest invoice data:
+// a timestamp of 35 bits and a recoverable signature of 520 bits.
+const minInvoiceData = 7 + 104
+
+// invoicePrefixes are the prefixes of the human-readable parts of invoices,
+// by the name of the network, which all signets share.
+var invoicePrefixes = map[string]string{
+	chaincfg.MainNetParams.Name:       "lnbc",
+	chaincfg.TestNet3Params.Name:      "lntb",
+	chaincfg.SigNetParams.Name:        "lntbs",
+	chaincfg.RegressionNetParams.Name: "lnbcrt",
+}
+
+// checkInvoiceAmount checks the amount of the human-readable part of an
+// invoice: empty, or digits without leading zeros and an optional
+// multiplier. A pico-bitcoin amount must be a whole number of millisatoshis.
+func checkInvoiceAmount(amount string) error {
+	if amount == "" {
+		return nil
+	}
+	digits := amount
+	multiplier := amount[len(amount)-1]
+	if strings.IndexByte("munp", multiplier) >= 0 {
+		digits = amount[:len(amount)-1]
+	}
+	switch {
+	case digits == "" || !isDigits(digits) || digits[0] == '0':
+		return fmt.Errorf("invoice amount %q", amount)
+	case multiplier == 'p' && digits[len(digits)-1] != '0':
+		return fmt.Errorf("invoice amount %s below a millisatoshi",
+			amount)
+	}
+	return nil
+}
+
+// checkInvoice checks that the value is a bech32 invoice of the network, of
+// a valid amount and long enough to be signed. The fields and signature of
+// the invoice are left to the lightning wallet paying it.
+func checkInvoice(value string, net *chaincfg.Params) error {
+	hrp, data, enc, err := bech32.DecodeLimit(value, MaxInvoiceLen)
+	if err != nil {
+		return err
+	}
+	if enc != bech32.Bech32 {
+		return fmt.Errorf("invoice of %v checksum", enc)
+	}
+	prefix, ok := invoicePrefixes[net.Name]
+	if !ok {
+		return fmt.Errorf("no invoices on %s", net.Name)
+	}
+	if !strings.HasPrefix(hrp, prefix) {
+		return fmt.Errorf("invoice human-readable part %q", hrp)
+	}
+	if err := checkInvoiceAmount(hrp[len(prefix):]); err != nil {
+		return err
+	}
+	if len(data) < minInvoiceData {
+		return fmt.Errorf("invoice of %d data characters", len(data))
+	}
+	return nil
+}
+
+// bech32Charset is the alphabet of bech32 data.
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+// checkOffer checks that the value is an offer: lno1 followed by bech32
+// data without a checksum, in one case, which may be split by plus signs
+// followed by whitespace. The fields of the offer are left to the
+// lightning wallet paying it.
+func checkOffer(value string, _ *chaincfg.Params) error {
+	parts := strings.Split(value, "+")
+	for i := range parts {
+		if i > 0 {
+			parts[i] = strings.TrimLeft(parts[i], " \t\r\n")
+		}
+		if parts[i] == "" {
+			return errors.New("offer with an empty part")
+		}
+	}
+	offer := strings.Join(parts, "")
+	lower := strings.ToLower(offer)
+	if lower != offer && strings.ToUpper(offer) != offer {
+		return errors.New("offer of mixed case")
+	}
+	data, ok := strings.CutPrefix(lower, "lno1")
+	switch {
+	case !ok:
+		return fmt.Errorf("offer prefix of %q", offer)
+	case data == "":
+		return errors.New("empty offer")
+	}
+	for i := 0; i < len(data); i++ {
+		if strings.IndexByte(bech32Charset, data[i]) < 0 {
+			return fmt.Errorf("offer character %q", data[i])
+		}
+	}
+	return nil
+}
+
+// silentPaymentHRPs are the human-readable parts of silent payment
+// addresses, by the name of the network, with that of test networks for the
+// others.
+var silentPaymentHRPs = map[string]string{
+	chaincfg.MainNetParams.Name:       "sp",
+	chaincfg.RegressionNetParams.Name: "sprt",
+}
+
+// checkSilentPayment checks that the value is a silent payment address of
+// the network.
+func checkSilentPayment(value string, net *chaincfg.Params) error {
+	hrp, ok := silentPaymentHRPs[net.Name]
+	if !ok {
+		hrp = "tsp"
+	}
+	_, err := silentpayments.DecodeAddress(hrp, value)
+	return err
+}
+
+// NamePrefix is the bitcoin sign that human-readable names are shown with.
+const NamePrefix = "₿"
+
+// maxDNSNameLen and maxDNSLabelLen are the lengths of the longest domain
+// name and label.
+const (
+	maxDNSNameLen  = 253
+	maxDNSLabelLen = 63
+)
+
+// checkName checks that the value is a human-readable name, user@domain
+// with an optional NamePrefix, whose DNS name is valid:
+//
+//	user.user._bitcoin-payment.domain
+//
+// It must have labels of letters, digits, hyphens and underscores, of up to
+// 63 characters, and 253 characters in all.
+func checkName(value string, _ *chaincfg.Params) error {
+	user, domain, ok := strings.Cut(strings.TrimPrefix(value, NamePrefix),
+		"@")
+	if !ok {
+		return fmt.Errorf("name %q without @", value)
+	}
+	dnsName := user + ".user._bitcoin-payment." + domain
+	if len(dnsName) > maxDNSNameLen {
+		return fmt.Errorf("name %q too long", value)
+	}
+	for _, label := range strings.Split(dnsName, ".") {
+		if label == "" || len(label) > maxDNSLabelLen {
+			return fmt.Errorf("name %q of label %q", value, label)
+		}
+		for i := 0; i < len(label); i++ {
+			c := label[i]
+			if !isUnreserved(c) || c == '.' || c == '~' {
+				return fmt.Errorf("name %q of character %q",
+					value, c)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+// This program writes test vectors for the paymenturi package to uris.json:
+// the examples of BIP 21, and payment URIs of addresses of every kind and
+// network, of amounts at and past their limits, of labels and messages of
+// every escape, of keys in any case, given twice and with the req- prefix,
+// and of lightning invoices, offers, silent payment addresses and
+// human-readable names, followed by random URIs, broken in random ways or
+// not. The vectors depend only on -seed and -count, so they can be
+// regenerated by anyone:
+//
+//	gentestvectors -count 100 -seed 21
+//
+// The file uses the layout of the BIP 158 vectors: a JSON array whose first
+// row names the columns, followed by one row per vector. Each vector is a
+// URI and the name of the network it's parsed for, followed by its address,
+// amount in satoshis, label and message, the parameters of its extensions
+// as decoded key=value pairs with the req- prefix of the required ones, and
+// the URI built of them, or by the error it's rejected with, empty for a
+// valid URI. Pass -check to verify an existing file against the package
+// instead:
+//
+//	gentestvectors -check uris.json
+//
+// The program lives in a directory of its own since the paymenturi package
+// sits at the root of the module.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcutil"
+	paymenturi "github.com/christsim/bips/bip-0021"
+	"github.com/christsim/bips/internal/vectorfile"
+)
+
+// uriColumns is the header row of the vector file.
+const uriColumns = "URI,Network,Address,Amount,Label,Message,Params," +
+	"Canonical,Error,Comment"
+
+type JSONTestWriter struct {
+	writer          io.Writer
+	firstRowWritten bool
+}
+
+func NewJSONTestWriter(writer io.Writer) *JSONTestWriter {
+	return &JSONTestWriter{writer: writer}
+}
+
+func (w *JSONTestWriter) WriteComment(comment string) error {
+	return w.WriteTestCase([]interface{}{comment})
+}
+
+func (w *JSONTestWriter) WriteTestCase(row []interface{}) error {
+	var err error
+	if w.firstRowWritten {
+		_, err = io.WriteString(w.writer, ",\n")
+	} else {
+		_, err = io.WriteString(w.writer, "[\n")
+		w.firstRowWritten = true
+	}
+	if err != nil {
+		return err
+	}
+
+	rowBytes, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.writer.Write(rowBytes)
+	return err
+}
+
+func (w *JSONTestWriter) Close() error {
+	if !w.firstRowWritten {
+		return nil
+	}
+
+	_, err := io.WriteString(w.writer, "\n]\n")
+	return err
+}
+
+func main() {
+	out := flag.String("out", "uris.json", "file to write the vectors to")
+	count := flag.Int("count", 100, "number of random URIs to write "+
+		"vectors of")
+	seed := flag.Int64("seed", 21, "seed of the random vectors")
+	check := flag.String("check", "", "vector file to check instead of "+
+		"writing one")
+	flag.Parse()
+
+	var err error
+	if *check != "" {
+		err = checkFile(*check)
+	} else {
+		err = writeFile(*out, *seed, *count)
+	}
+	if err != nil {
+		fmt.Println("Error: ", err.Error())
+		os.Exit(1)
+	}
+}
+
+// writeRows writes the header and rows to a new vector file at path.
+func writeRows(path, columns string, rows [][]interface{}) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := NewJSONTestWriter(file)
+	if err := writer.WriteComment(columns); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if err := writer.WriteTestCase(row); err != nil {
+			return err
+		}
+	}
+	return writer.Close()
+}
+
+// formatParams returns the parameters as key=value pairs, with the req-
+// prefix of the required ones.
+func formatParams(params []paymenturi.Param) []string {
+	pairs := make([]string, len(params))
+	for i, p := range params {
+		key := p.Key
+		if p.Required {
+			key = paymenturi.RequiredPrefix + key
+		}
+		pairs[i] = key + "=" + p.Value
+	}
+	return pairs
+}
+
+// parseParams returns the parameters of the key=value pairs.
+func parseParams(pairs []string) ([]paymenturi.Param, error) {
+	var params []paymenturi.Param
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("parameter %q without =", pair)
+		}
+		name, required := strings.CutPrefix(key,
+			paymenturi.RequiredPrefix)
+		params = append(params, paymenturi.Param{
+			Key:      name,
+			Value:    value,
+			Required: required,
+		})
+	}
+	return params, nil
+}
+
+// writeFile writes the vectors, with count random ones, to out.
+func writeFile(out string, seed int64, count int) error {
+	var rows [][]interface{}
+	vectors := paymenturi.URIVectors(seed, count)
+	for _, v := range vectors {
+		rows = append(rows, []interface{}{
+			v.URI,
+			v.Network,
+			v.Address,
+			int64(v.Amount),
+			v.Label,
+			v.Message,
+			formatParams(v.Params),
+			v.Canonical,
+			vectorfile.ErrorString(v.Err),
+			v.Comment,
+		})
+	}
+	if err := writeRows(out, uriColumns, rows); err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote %d vectors\n", len(vectors))
+	return nil
+}
+
+// checkFile checks each vector of the file with
+// paymenturi.CheckURIVector.
+func checkFile(path string) error {
+	rows, err := vectorfile.ReadRows(path, 10)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		var v paymenturi.URIVector
+		var amount int64
+		var pairs []string
+		var errMsg string
+		err := vectorfile.DecodeRow(row, &v.URI, &v.Network, &v.Address,
+			&amount, &v.Label, &v.Message, &pairs, &v.Canonical,
+			&errMsg, &v.Comment)
+		if err != nil {
+			return err
+		}
+		v.Amount = btcutil.Amount(amount)
+		if v.Params, err = parseParams(pairs); err != nil {
+			return fmt.Errorf("%v: %v", v.Comment, err)
+		}
+		v.Err = vectorfile.ParseError(errMsg)
+		if err := paymenturi.CheckURIVector(v); err != nil {
+			return fmt.Errorf("%v: %v", v.Comment, err)
+		}
+	}
+	fmt.Printf("%d vectors OK\n", len(rows))
+	return nil
+}
@@ -0,0 +1,356 @@
+// Package paymenturi implements the bitcoin: payment URIs of BIP 21, which
+// wallets put in links and QR codes to ask for a payment to an address,
+// optionally of an amount, with a label for the receiver and a message for
+// the payer:
+//
+//	u, err := paymenturi.Parse(s, &chaincfg.MainNetParams,
+//		paymenturi.DefaultRegistry())
+//	s = u.String()
+//
+// Amounts are decimal bitcoins, without signs, exponents or commas, and
+// must be a whole number of satoshis, which the URIs String builds have the
+// fewest digits of. Values are percent-encoded UTF-8, with a plus sign left
+// as it is rather than read as a space, and String escapes every character
+// but the unreserved ones of RFC 3986.
+//
+// Parameters past amount, label and message are extensions. Those a parser
+// doesn't know are ignored, unless their key has the req- prefix, which
+// marks them as required for the payment and makes the URI invalid. A
+// Registry tells Parse the extensions it knows, and how to check their
+// values: DefaultRegistry has lightning invoices of BOLT 11, offers of
+// BOLT 12 and silent payment addresses of BIP 352, which are destinations
+// that let the address be left out, as well as the human-readable names
+// of BIP 353 the URIs are resolved from.
+package paymenturi
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+const (
+	// Scheme is the scheme of payment URIs, matched in any case.
+	Scheme = "bitcoin:"
+
+	// RequiredPrefix is the prefix of the keys of required parameters.
+	RequiredPrefix = "req-"
+)
+
+// The keys of the parameters of BIP 21 itself.
+const (
+	AmountKey  = "amount"
+	LabelKey   = "label"
+	MessageKey = "message"
+)
+
+var (
+	// ErrInvalidScheme is returned for a URI that isn't of Scheme.
+	ErrInvalidScheme = errors.New("paymenturi: not a bitcoin URI")
+
+	// ErrInvalidAddress is returned for an address that doesn't decode,
+	// or is of another network.
+	ErrInvalidAddress = errors.New("paymenturi: invalid address")
+
+	// ErrMissingAddress is returned for a URI without an address, or an
+	// extension that is a destination.
+	ErrMissingAddress = errors.New("paymenturi: no address or destination")
+
+	// ErrMalformedParam is returned for a parameter without a key or an
+	// equals sign.
+	ErrMalformedParam = errors.New("paymenturi: malformed parameter")
+
+	// ErrInvalidEncoding is returned for a key or value with a bad percent
+	// escape, or that isn't UTF-8.
+	ErrInvalidEncoding = errors.New("paymenturi: invalid percent encoding")
+
+	// ErrDuplicateParam is returned for a parameter given twice, with the
+	// req- prefix or without.
+	ErrDuplicateParam = errors.New("paymenturi: duplicate parameter")
+
+	// ErrInvalidAmount is returned for an amount that isn't a decimal
+	// number of bitcoins, is zero, isn't a whole number of satoshis or is
+	// more than there will ever be.
+	ErrInvalidAmount = errors.New("paymenturi: invalid amount")
+
+	// ErrUnknownRequired is returned for a required parameter of an
+	// extension the registry doesn't have.
+	ErrUnknownRequired = errors.New("paymenturi: unknown required " +
+		"parameter")
+
+	// ErrInvalidParam is returned for a value of an extension its check
+	// rejects.
+	ErrInvalidParam = errors.New("paymenturi: invalid parameter")
+
+	// ErrReservedKey is returned by Register for an extension whose key is
+	// empty, has the req- prefix or is one of BIP 21 itself.
+	ErrReservedKey = errors.New("paymenturi: reserved key")
+
+	// ErrDuplicateExtension is returned by Register for an extension whose
+	// key the registry already has.
+	ErrDuplicateExtension = errors.New("paymenturi: duplicate extension")
+)
+
+// Param is a parameter of an extension, with its key lowered and stripped
+// of the req- prefix, and its value decoded.
+type Param struct {
+	Key   string
+	Value string
+
+	// Required is set for a key with the req- prefix.
+	Required bool
+}
+
+// URI is a payment URI. An Amount of zero is none, and an empty Label or
+// Message is left out.
+type URI struct {
+	Address string
+	Amount  btcutil.Amount
+	Label   string
+	Message string
+
+	// Params are the parameters of extensions, in the order of the URI,
+	// those the registry doesn't have included.
+	Params []Param
+}
+
+// Param returns the parameter of the key, and whether the URI has it.
+func (u *URI) Param(key string) (Param, bool) {
+	key = strings.ToLower(key)
+	for _, p := range u.Params {
+		if p.Key == key {
+			return p, true
+		}
+	}
+	return Param{}, false
+}
+
+// unescape decodes the percent escapes of the key or value.
+func unescape(s string) (string, error) {
+	decoded, err := url.PathUnescape(s)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidEncoding, err)
+	}
+	if !utf8.ValidString(decoded) {
+		return "", fmt.Errorf("%w: %q not UTF-8", ErrInvalidEncoding,
+			decoded)
+	}
+	return decoded, nil
+}
+
+// Parse parses the payment URI for the network, checking the parameters of
+// the extensions of the registry. Keys are matched in any case, and empty
+// parameters are skipped.
+func Parse(s string, net *chaincfg.Params, registry Registry) (*URI,
+	error) {
+
+	if len(s) < len(Scheme) || !strings.EqualFold(s[:len(Scheme)], Scheme) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidScheme, s)
+	}
+	address, query, _ := strings.Cut(s[len(Scheme):], "?")
+	u := &URI{Address: address}
+
+	seen := make(map[string]bool)
+	destination := false
+	for _, field := range strings.Split(query, "&") {
+		if field == "" {
+			continue
+		}
+		rawKey, rawValue, ok := strings.Cut(field, "=")
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrMalformedParam,
+				field)
+		}
+		key, err := unescape(rawKey)
+		if err != nil {
+			return nil, err
+		}
+		value, err := unescape(rawValue)
+		if err != nil {
+			return nil, err
+		}
+		key = strings.ToLower(key)
+		name, required := strings.CutPrefix(key, RequiredPrefix)
+		if name == "" {
+			return nil, fmt.Errorf("%w: %q", ErrMalformedParam,
+				field)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("%w: %s", ErrDuplicateParam,
+				name)
+		}
+		seen[name] = true
+
+		switch name {
+		case AmountKey:
+			if u.Amount, err = ParseAmount(value); err != nil {
+				return nil, err
+			}
+		case LabelKey:
+			u.Label = value
+		case MessageKey:
+			u.Message = value
+		default:
+			ext, ok := registry[name]
+			switch {
+			case !ok && required:
+				return nil, fmt.Errorf("%w: %s",
+					ErrUnknownRequired, name)
+			case ok:
+				if err := ext.Check(value, net); err != nil {
+					return nil, fmt.Errorf("%w: %s: %v",
+						ErrInvalidParam, name, err)
+				}
+				destination = destination || ext.Destination
+			}
+			u.Params = append(u.Params, Param{
+				Key:      name,
+				Value:    value,
+				Required: required,
+			})
+		}
+	}
+
+	if address == "" {
+		if !destination {
+			return nil, ErrMissingAddress
+		}
+		return u, nil
+	}
+	addr, err := btcutil.DecodeAddress(address, net)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidAddress, address,
+			err)
+	}
+	if !addr.IsForNet(net) {
+		return nil, fmt.Errorf("%w: %s not of %s", ErrInvalidAddress,
+			address, net.Name)
+	}
+	return u, nil
+}
+
+// isUnreserved reports whether the byte is one of the unreserved characters
+// of RFC 3986, which String doesn't escape.
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' ||
+		'0' <= c && c <= '9' || c == '-' || c == '.' || c == '_' ||
+		c == '~'
+}
+
+// escape percent-escapes every byte of the key or value but the unreserved
+// characters.
+func escape(s string) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if isUnreserved(c) {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(hex[c>>4])
+		b.WriteByte(hex[c&0x0f])
+	}
+	return b.String()
+}
+
+// String returns the URI with the scheme in lower case, followed by the
+// amount, label and message, if any, and the parameters of extensions in
+// order, the required ones with the req- prefix.
+func (u *URI) String() string {
+	var b strings.Builder
+	b.WriteString(Scheme)
+	b.WriteString(u.Address)
+	sep := byte('?')
+	add := func(key, value string) {
+		b.WriteByte(sep)
+		sep = '&'
+		b.WriteString(escape(key))
+		b.WriteByte('=')
+		b.WriteString(escape(value))
+	}
+
+	if u.Amount != 0 {
+		add(AmountKey, FormatAmount(u.Amount))
+	}
+	if u.Label != "" {
+		add(LabelKey, u.Label)
+	}
+	if u.Message != "" {
+		add(MessageKey, u.Message)
+	}
+	for _, p := range u.Params {
+		key := p.Key
+		if p.Required {
+			key = RequiredPrefix + key
+		}
+		add(key, p.Value)
+	}
+	return b.String()
+}
+
+// isDigits reports whether the string is only decimal digits.
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseAmount parses a decimal amount of bitcoins: digits, optionally
+// followed by a period and more digits. Leading zeros, and trailing zeros
+// past the satoshis, are allowed.
+func ParseAmount(s string) (btcutil.Amount, error) {
+	whole, frac, _ := strings.Cut(s, ".")
+	if whole == "" || !isDigits(whole) || !isDigits(frac) {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+	frac = strings.TrimRight(frac, "0")
+	if len(frac) > 8 {
+		return 0, fmt.Errorf("%w: %s below a satoshi", ErrInvalidAmount,
+			s)
+	}
+	whole = strings.TrimLeft(whole, "0")
+	if len(whole) > 8 {
+		return 0, fmt.Errorf("%w: %s too large", ErrInvalidAmount, s)
+	}
+
+	var sats int64
+	if whole != "" {
+		sats, _ = strconv.ParseInt(whole, 10, 64)
+		sats *= btcutil.SatoshiPerBitcoin
+	}
+	if frac != "" {
+		n, _ := strconv.ParseInt(frac+strings.Repeat("0", 8-len(frac)),
+			10, 64)
+		sats += n
+	}
+	switch {
+	case sats == 0:
+		return 0, fmt.Errorf("%w: zero", ErrInvalidAmount)
+	case sats > btcutil.MaxSatoshi:
+		return 0, fmt.Errorf("%w: %s too large", ErrInvalidAmount, s)
+	}
+	return btcutil.Amount(sats), nil
+}
+
+// FormatAmount returns the amount in bitcoins with the fewest digits, and
+// no period for a whole number.
+func FormatAmount(a btcutil.Amount) string {
+	whole := int64(a) / btcutil.SatoshiPerBitcoin
+	frac := int64(a) % btcutil.SatoshiPerBitcoin
+	s := strconv.FormatInt(whole, 10)
+	if frac == 0 {
+		return s
+	}
+	return s + "." + strings.TrimRight(fmt.Sprintf("%08d", frac), "0")
+}
@@ -0,0 +1,546 @@
+package paymenturi
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	bech32 "github.com/christsim/bips/bip-0173"
+	silentpayments "github.com/christsim/bips/bip-0352"
+	"github.com/christsim/bips/internal/vectorfile"
+)
+
+// ErrVectorMismatch is returned by CheckURIVector when parsing a vector
+// doesn't give the expected result.
+var ErrVectorMismatch = errors.New("paymenturi: vector mismatch")
+
+// ErrUnknownNetwork is returned by CheckURIVector for a vector of a network
+// btcd doesn't have.
+var ErrUnknownNetwork = errors.New("paymenturi: unknown network")
+
+// networks are the networks of the vectors, by name.
+var networks = map[string]*chaincfg.Params{
+	chaincfg.MainNetParams.Name:       &chaincfg.MainNetParams,
+	chaincfg.TestNet3Params.Name:      &chaincfg.TestNet3Params,
+	chaincfg.SigNetParams.Name:        &chaincfg.SigNetParams,
+	chaincfg.RegressionNetParams.Name: &chaincfg.RegressionNetParams,
+}
+
+// URIVector is a payment URI parsed for the network, with the extensions of
+// DefaultRegistry, and what it parses to: its fields and the URI String
+// builds of them, or the error it's rejected with.
+type URIVector struct {
+	URI     string
+	Network string
+
+	Address string
+	Amount  btcutil.Amount
+	Label   string
+	Message string
+	Params  []Param
+
+	// Canonical is the URI String builds of a valid URI, or empty.
+	Canonical string
+
+	// Err is the error an invalid URI is rejected with, or nil.
+	Err error
+
+	// Comment describes what the vector exercises.
+	Comment string
+}
+
+// newURIVector returns the vector of parsing the URI for the network.
+func newURIVector(s string, net *chaincfg.Params,
+	comment string) URIVector {
+
+	v := URIVector{URI: s, Network: net.Name, Comment: comment}
+	u, err := Parse(s, net, DefaultRegistry())
+	if err != nil {
+		v.Err = err
+		return v
+	}
+	v.Address = u.Address
+	v.Amount = u.Amount
+	v.Label = u.Label
+	v.Message = u.Message
+	v.Params = u.Params
+	v.Canonical = u.String()
+	return v
+}
+
+// vectorHash returns a hash of 20 bytes for the addresses of the vectors.
+func vectorHash(tag string) []byte {
+	hash := sha256.Sum256([]byte(tag))
+	return hash[:20]
+}
+
+// mustEncode returns the encoding of the address, panicking on an error.
+func mustEncode(addr btcutil.Address, err error) string {
+	if err != nil {
+		panic(err)
+	}
+	return addr.EncodeAddress()
+}
+
+// invoice returns a string of the form of an invoice, of the human-readable
+// part and n data characters, with the checksum of the encoding.
+func invoice(hrp string, n int, enc bech32.Encoding) string {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i*7) % 32
+	}
+	s, err := bech32.EncodeLimit(hrp, data, enc, MaxInvoiceLen)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// silentPaymentAddress returns the silent payment address of the human-
+// readable part, of keys derived from the seed.
+func silentPaymentAddress(hrp string, seed byte) string {
+	keys := make([][]byte, 2)
+	for i := range keys {
+		secKey := sha256.Sum256([]byte{seed, byte(i)})
+		var err error
+		if keys[i], err = silentpayments.PubKey(secKey[:]); err != nil {
+			panic(err)
+		}
+	}
+	addr, err := silentpayments.EncodeAddress(hrp, keys[0], keys[1])
+	if err != nil {
+		panic(err)
+	}
+	return addr
+}
+
+// specAddress is the address of the examples of BIP 21, whose checksum is
+// bad.
+const specAddress = "175tWpb8K1S7NmH4Zx6rewF9WQrcZv245W"
+
+// URIVectors returns the examples of BIP 21, and vectors of addresses of
+// every kind and network, in either case, of amounts at and past the limits
+// of their digits and values, of labels and messages of every escape, good
+// and bad, of keys in any case, given twice, with the req- prefix and
+// without, known and not, and of the parameters of every extension of
+// DefaultRegistry, with and without the address. They are followed by count
+// random URIs built by String, broken in random ways or not, derived from a
+// math/rand source with the seed.
+func URIVectors(rngSeed int64, count int) []URIVector {
+	main := &chaincfg.MainNetParams
+	test := &chaincfg.TestNet3Params
+	signet := &chaincfg.SigNetParams
+	regtest := &chaincfg.RegressionNetParams
+
+	p2pkh := mustEncode(btcutil.NewAddressPubKeyHash(vectorHash("p2pkh"),
+		main))
+	p2sh := mustEncode(btcutil.NewAddressScriptHashFromHash(
+		vectorHash("p2sh"), main))
+	p2wpkh := mustEncode(btcutil.NewAddressWitnessPubKeyHash(
+		vectorHash("p2wpkh"), main))
+	p2tr := mustEncode(btcutil.NewAddressTaproot(
+		append(vectorHash("p2tr"), vectorHash("p2tr")[:12]...), main))
+	testP2wpkh := mustEncode(btcutil.NewAddressWitnessPubKeyHash(
+		vectorHash("p2wpkh"), test))
+	testP2pkh := mustEncode(btcutil.NewAddressPubKeyHash(
+		vectorHash("p2pkh"), test))
+	badChecksum := p2wpkh[:len(p2wpkh)-1] + "q"
+	if badChecksum == p2wpkh {
+		badChecksum = p2wpkh[:len(p2wpkh)-1] + "p"
+	}
+
+	ln := invoice("lnbc", minInvoiceData+50, bech32.Bech32)
+	lnAmount := invoice("lnbc2500u", minInvoiceData+50, bech32.Bech32)
+	sp := silentPaymentAddress("sp", 1)
+	lno := "lno1" + strings.Repeat("qypzry9x8gf2tvdw0s3jn54khce6mua7l", 3)
+	name := "%E2%82%BFalice@example.com"
+
+	cases := []struct {
+		uri     string
+		net     *chaincfg.Params
+		comment string
+	}{
+		// The examples of BIP 21, of another address, since theirs has
+		// a bad checksum.
+		{"bitcoin:" + specAddress, main,
+			"BIP 21, address of a bad checksum"},
+		{"bitcoin:" + p2pkh, main, "BIP 21, address only"},
+		{"bitcoin:" + p2pkh + "?label=Luke-Jr", main, "BIP 21, label"},
+		{"bitcoin:" + p2pkh + "?amount=20.3&label=Luke-Jr", main,
+			"BIP 21, amount and label"},
+		{"bitcoin:" + p2pkh + "?amount=50&label=Luke-Jr&" +
+			"message=Donation%20for%20project%20xyz", main,
+			"BIP 21, amount, label and message"},
+		{"bitcoin:" + p2pkh + "?req-somethingyoudontunderstand=50&" +
+			"req-somethingelseyoudontget=999", main,
+			"BIP 21, unknown required parameters"},
+		{"bitcoin:" + p2pkh + "?somethingyoudontunderstand=50&" +
+			"somethingelseyoudontget=999", main,
+			"BIP 21, unknown parameters"},
+
+		// Schemes and addresses.
+		{"BITCOIN:" + p2pkh, main, "Scheme in upper case"},
+		{"BitCoin:" + p2pkh, main, "Scheme in mixed case"},
+		{"litecoin:" + p2pkh, main, "Other scheme"},
+		{"bitcoin" + p2pkh, main, "Scheme without a colon"},
+		{"bitcoin://" + p2pkh, main, "Scheme with slashes"},
+		{"", main, "Empty URI"},
+		{"bitcoin:", main, "No address"},
+		{"bitcoin:?amount=1", main, "No address, amount"},
+		{"bitcoin:" + p2sh, main, "P2SH address"},
+		{"bitcoin:" + p2wpkh, main, "P2WPKH address"},
+		{"bitcoin:" + strings.ToUpper(p2wpkh), main,
+			"P2WPKH address in upper case, as in QR codes"},
+		{"bitcoin:" + p2tr, main, "P2TR address"},
+		{"bitcoin:" + badChecksum, main, "Address of a bad checksum"},
+		{"bitcoin:" + testP2wpkh, main, "Testnet address on mainnet"},
+		{"bitcoin:" + testP2wpkh, test, "Testnet address"},
+		{"bitcoin:" + p2wpkh, test, "Mainnet address on testnet"},
+		{"bitcoin:" + testP2pkh, regtest,
+			"Testnet P2PKH address on regtest"},
+		{"bitcoin:%31" + p2pkh[1:], main, "Percent-escaped address"},
+
+		// Amounts.
+		{"bitcoin:" + p2pkh + "?amount=1", main, "Amount of 1 BTC"},
+		{"bitcoin:" + p2pkh + "?amount=0.00000001", main,
+			"Amount of a satoshi"},
+		{"bitcoin:" + p2pkh + "?amount=21000000", main,
+			"Amount of every bitcoin"},
+		{"bitcoin:" + p2pkh + "?amount=21000000.00000001", main,
+			"Amount a satoshi past every bitcoin"},
+		{"bitcoin:" + p2pkh + "?amount=100000000", main,
+			"Amount of nine digits"},
+		{"bitcoin:" + p2pkh + "?amount=0", main, "Amount of zero"},
+		{"bitcoin:" + p2pkh + "?amount=0.00000000", main,
+			"Amount of zero with decimals"},
+		{"bitcoin:" + p2pkh + "?amount=0.000000001", main,
+			"Amount below a satoshi"},
+		{"bitcoin:" + p2pkh + "?amount=1.000000000", main,
+			"Amount with trailing zeros past the satoshis"},
+		{"bitcoin:" + p2pkh + "?amount=007.50", main,
+			"Amount with leading and trailing zeros"},
+		{"bitcoin:" + p2pkh + "?amount=50.", main,
+			"Amount ending in a period"},
+		{"bitcoin:" + p2pkh + "?amount=.5", main,
+			"Amount starting with a period"},
+		{"bitcoin:" + p2pkh + "?amount=.", main, "Amount of a period"},
+		{"bitcoin:" + p2pkh + "?amount=", main, "Empty amount"},
+		{"bitcoin:" + p2pkh + "?amount=1,5", main,
+			"Amount with a comma"},
+		{"bitcoin:" + p2pkh + "?amount=1.2.3", main,
+			"Amount of two periods"},
+		{"bitcoin:" + p2pkh + "?amount=1e3", main,
+			"Amount with an exponent"},
+		{"bitcoin:" + p2pkh + "?amount=-1", main,
+			"Negative amount"},
+		{"bitcoin:" + p2pkh + "?amount=%2B1", main,
+			"Amount with a plus sign"},
+		{"bitcoin:" + p2pkh + "?amount=%201", main,
+			"Amount with a space"},
+		{"bitcoin:" + p2pkh + "?amount=0x10", main, "Hex amount"},
+		{"bitcoin:" + p2pkh + "?amount=%D9%A1", main,
+			"Amount of an Arabic-Indic digit"},
+		{"bitcoin:" + p2pkh + "?amount=%31%2E%35", main,
+			"Percent-escaped amount"},
+
+		// Labels and messages.
+		{"bitcoin:" + p2pkh + "?label=Luke%20Jr", main,
+			"Label with an escaped space"},
+		{"bitcoin:" + p2pkh + "?label=Luke+Jr", main,
+			"Label with a plus sign, not a space"},
+		{"bitcoin:" + p2pkh + "?label=%E2%82%BF%20caf%C3%A9", main,
+			"Label of UTF-8"},
+		{"bitcoin:" + p2pkh + "?label=a%26b%3Dc%3Fd%25", main,
+			"Label of escaped delimiters"},
+		{"bitcoin:" + p2pkh + "?label=a%2fb", main,
+			"Label of a lower case escape"},
+		{"bitcoin:" + p2pkh + "?label=", main, "Empty label"},
+		{"bitcoin:" + p2pkh + "?label=%ZZ", main,
+			"Label of a bad escape"},
+		{"bitcoin:" + p2pkh + "?label=100%", main,
+			"Label of a cut short escape"},
+		{"bitcoin:" + p2pkh + "?label=%FF", main,
+			"Label that isn't UTF-8"},
+		{"bitcoin:" + p2pkh + "?message=line%0Aline", main,
+			"Message of a newline"},
+		{"bitcoin:" + p2pkh + "?message=a?b", main,
+			"Message of a question mark"},
+		{"bitcoin:" + p2pkh + "?message=a=b", main,
+			"Message of an equals sign"},
+
+		// Keys.
+		{"bitcoin:" + p2pkh + "?AMOUNT=1&Label=x", main,
+			"Keys in upper and mixed case"},
+		{"bitcoin:" + p2pkh + "?amount=1&amount=2", main,
+			"Amount given twice"},
+		{"bitcoin:" + p2pkh + "?amount=1&req-amount=1", main,
+			"Amount given with the req- prefix and without"},
+		{"bitcoin:" + p2pkh + "?label=a&LABEL=b", main,
+			"Label given twice, in two cases"},
+		{"bitcoin:" + p2pkh + "?foo=1&foo=2", main,
+			"Unknown parameter given twice"},
+		{"bitcoin:" + p2pkh + "?req-amount=1&req-label=x", main,
+			"Required amount and label"},
+		{"bitcoin:" + p2pkh + "?req-foo=bar", main,
+			"Unknown required parameter"},
+		{"bitcoin:" + p2pkh + "?REQ-foo=bar", main,
+			"Unknown required parameter, prefix in upper case"},
+		{"bitcoin:" + p2pkh + "?foo=bar&Baz=%20", main,
+			"Unknown parameters, kept"},
+		{"bitcoin:" + p2pkh + "?label", main,
+			"Parameter without an equals sign"},
+		{"bitcoin:" + p2pkh + "?=x", main, "Parameter without a key"},
+		{"bitcoin:" + p2pkh + "?req-=x", main,
+			"Parameter of the req- prefix alone"},
+		{"bitcoin:" + p2pkh + "?%61mount=1", main,
+			"Percent-escaped key"},
+		{"bitcoin:" + p2pkh + "?amount=1&&label=x&", main,
+			"Empty parameters"},
+		{"bitcoin:" + p2pkh + "?", main, "Question mark alone"},
+
+		// Lightning invoices.
+		{"bitcoin:" + p2wpkh + "?lightning=" + ln, main,
+			"Address and invoice"},
+		{"bitcoin:?lightning=" + ln, main, "Invoice alone"},
+		{"bitcoin:?amount=0.000025&lightning=" + lnAmount, main,
+			"Invoice of an amount"},
+		{"bitcoin:?lightning=" + strings.ToUpper(ln), main,
+			"Invoice in upper case"},
+		{"bitcoin:" + p2wpkh + "?req-lightning=" + ln, main,
+			"Required invoice"},
+		{"bitcoin:?lightning=" + invoice("lntb", minInvoiceData,
+			bech32.Bech32), test, "Testnet invoice"},
+		{"bitcoin:?lightning=" + invoice("lntbs1m", minInvoiceData,
+			bech32.Bech32), signet, "Signet invoice"},
+		{"bitcoin:?lightning=" + invoice("lnbcrt10n", minInvoiceData,
+			bech32.Bech32), regtest, "Regtest invoice"},
+		{"bitcoin:?lightning=" + invoice("lntb", minInvoiceData,
+			bech32.Bech32), main, "Testnet invoice on mainnet"},
+		{"bitcoin:?lightning=" + invoice("lnbcrt", minInvoiceData,
+			bech32.Bech32), main, "Regtest invoice on mainnet"},
+		{"bitcoin:?lightning=" + invoice("lntbs", minInvoiceData,
+			bech32.Bech32), test, "Signet invoice on testnet"},
+		{"bitcoin:?lightning=" + ln, test,
+			"Mainnet invoice on testnet"},
+		{"bitcoin:?lightning=" + invoice("lnbc", minInvoiceData,
+			bech32.Bech32m), main, "Invoice of a bech32m checksum"},
+		{"bitcoin:?lightning=" + invoice("lnbc", minInvoiceData-1,
+			bech32.Bech32), main, "Invoice too short to be signed"},
+		{"bitcoin:?lightning=" + invoice("lnbc10p", minInvoiceData,
+			bech32.Bech32), main, "Invoice of a millisatoshi"},
+		{"bitcoin:?lightning=" + invoice("lnbc1p", minInvoiceData,
+			bech32.Bech32), main, "Invoice below a millisatoshi"},
+		{"bitcoin:?lightning=" + invoice("lnbc025u", minInvoiceData,
+			bech32.Bech32), main,
+			"Invoice amount with a leading zero"},
+		{"bitcoin:?lightning=" + invoice("lnbc25x", minInvoiceData,
+			bech32.Bech32), main,
+			"Invoice of an unknown multiplier"},
+		{"bitcoin:?lightning=" + invoice("lnbcm", minInvoiceData,
+			bech32.Bech32), main, "Invoice of a multiplier alone"},
+		{"bitcoin:?lightning=" + ln[:len(ln)-1] + "x", main,
+			"Invoice of a bad checksum"},
+		{"bitcoin:?lightning=" + strings.Repeat("q", MaxInvoiceLen+1),
+			main, "Invoice too long"},
+		{"bitcoin:?lightning=", main, "Empty invoice"},
+		{"bitcoin:?foo=" + ln, main,
+			"Invoice of an unknown parameter alone"},
+
+		// Offers.
+		{"bitcoin:?lno=" + lno, main, "Offer alone"},
+		{"bitcoin:" + p2tr + "?lno=" + lno, main, "Address and offer"},
+		{"bitcoin:?lno=" + strings.ToUpper(lno), main,
+			"Offer in upper case"},
+		{"bitcoin:?lno=" + lno[:20] + "%2B%20%0A" + lno[20:], main,
+			"Offer split by a plus sign and whitespace"},
+		{"bitcoin:?lno=" + lno[:20] + "%2B%2B" + lno[20:], main,
+			"Offer split by two plus signs"},
+		{"bitcoin:?lno=" + lno + "%2B", main,
+			"Offer ending in a plus sign"},
+		{"bitcoin:?lno=LNO1" + lno[4:], main, "Offer of mixed case"},
+		{"bitcoin:?lno=" + lno + "b", main, "Offer of a b"},
+		{"bitcoin:?lno=lni1" + lno[4:], main,
+			"Invoice request as an offer"},
+		{"bitcoin:?lno=lno1", main, "Empty offer"},
+
+		// Silent payment addresses.
+		{"bitcoin:?sp=" + sp, main, "Silent payment address alone"},
+		{"bitcoin:" + p2tr + "?sp=" + sp, main,
+			"Address and silent payment address"},
+		{"bitcoin:?sp=" + strings.ToUpper(sp), main,
+			"Silent payment address in upper case"},
+		{"bitcoin:?sp=" + silentPaymentAddress("tsp", 2), test,
+			"Testnet silent payment address"},
+		{"bitcoin:?sp=" + silentPaymentAddress("tsp", 2), signet,
+			"Testnet silent payment address on signet"},
+		{"bitcoin:?sp=" + silentPaymentAddress("sprt", 3), regtest,
+			"Regtest silent payment address"},
+		{"bitcoin:?sp=" + sp, test,
+			"Mainnet silent payment address on testnet"},
+		{"bitcoin:?sp=" + silentPaymentAddress("tsp", 2), main,
+			"Testnet silent payment address on mainnet"},
+		{"bitcoin:?sp=" + sp[:len(sp)-1] + "x", main,
+			"Silent payment address of a bad checksum"},
+		{"bitcoin:?sp=" + p2tr, main,
+			"Taproot address as a silent payment address"},
+		{"bitcoin:?lightning=" + ln + "&lno=" + lno + "&sp=" + sp, main,
+			"Invoice, offer and silent payment address"},
+
+		// Human-readable names.
+		{"bitcoin:" + p2wpkh + "?bip353=" + name, main,
+			"Address and name"},
+		{"bitcoin:" + p2wpkh + "?bip353=alice@example.com", main,
+			"Name without the bitcoin sign"},
+		{"bitcoin:?sp=" + sp + "&bip353=" + name, main,
+			"Silent payment address and name"},
+		{"bitcoin:?bip353=" + name, main, "Name alone"},
+		{"bitcoin:" + p2wpkh + "?bip353=alice", main,
+			"Name without @"},
+		{"bitcoin:" + p2wpkh + "?bip353=@example.com", main,
+			"Name without a user"},
+		{"bitcoin:" + p2wpkh + "?bip353=alice@", main,
+			"Name without a domain"},
+		{"bitcoin:" + p2wpkh + "?bip353=al%20ice@example.com", main,
+			"Name of a space"},
+		{"bitcoin:" + p2wpkh + "?bip353=alice@example..com", main,
+			"Name of an empty label"},
+		{"bitcoin:" + p2wpkh + "?bip353=" + strings.Repeat("a", 64) +
+			"@example.com", main,
+			"Name of a user of 64 characters"},
+		{"bitcoin:" + p2wpkh + "?bip353=" + strings.Repeat("a", 63) +
+			"@example.com", main,
+			"Name of a user of 63 characters"},
+		{"bitcoin:" + p2wpkh + "?bip353=alice@" +
+			strings.Repeat("abcdefghi.", 23) + "com", main,
+			"Name too long"},
+	}
+
+	vectors := make([]URIVector, 0, len(cases)+count)
+	for _, c := range cases {
+		vectors = append(vectors, newURIVector(c.uri, c.net, c.comment))
+	}
+
+	rng := rand.New(rand.NewSource(rngSeed))
+	addresses := []string{p2pkh, p2sh, p2wpkh, p2tr, ""}
+	params := []Param{
+		{Key: Lightning.Key, Value: ln},
+		{Key: Lightning.Key, Value: lnAmount},
+		{Key: Offer.Key, Value: lno},
+		{Key: SilentPayment.Key, Value: sp},
+		{Key: Name.Key, Value: NamePrefix + "bob@example.org"},
+		{Key: "pop", Value: "wallet:"},
+	}
+	for n := 0; n < count; n++ {
+		u := URI{Address: addresses[rng.Intn(len(addresses))]}
+		if rng.Intn(2) == 0 {
+			u.Amount = btcutil.Amount(1 +
+				rng.Int63n(btcutil.MaxSatoshi))
+		}
+		if rng.Intn(2) == 0 {
+			u.Label = randomText(rng)
+		}
+		if rng.Intn(2) == 0 {
+			u.Message = randomText(rng)
+		}
+		for _, i := range rng.Perm(len(params))[:rng.Intn(3)] {
+			p := params[i]
+			p.Required = rng.Intn(2) == 0
+			u.Params = append(u.Params, p)
+		}
+
+		s, comment := u.String(), "Random"
+		switch rng.Intn(4) {
+		case 0:
+			// A URI of the scheme alone has no character to
+			// replace.
+			if len(s) == len(Scheme) {
+				break
+			}
+			i := len(Scheme) + rng.Intn(len(s)-len(Scheme))
+			chars := []rune(randomChars)
+			c := chars[rng.Intn(len(chars))]
+			s = s[:i] + string(c) + s[i+1:]
+			comment += fmt.Sprintf(", character %d replaced", i)
+		case 1:
+			if strings.Contains(s, "?") {
+				s += "&req-x=1"
+			} else {
+				s += "?req-x=1"
+			}
+			comment += ", unknown required parameter"
+		}
+		vectors = append(vectors, newURIVector(s, main, comment))
+	}
+	return vectors
+}
+
+// randomChars are the characters random text and mutations are made of,
+// delimiters, escapes and the digits of amounts included.
+const randomChars = "abcXYZ019 .+-_~%&=?#/€₿é\n"
+
+// randomText returns random text of up to 10 of randomChars.
+func randomText(rng *rand.Rand) string {
+	chars := []rune(randomChars)
+	var b strings.Builder
+	for i, n := 0, rng.Intn(10); i < n; i++ {
+		b.WriteRune(chars[rng.Intn(len(chars))])
+	}
+	return b.String()
+}
+
+// sameParams reports whether the parameters are the same.
+func sameParams(a, b []Param) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckURIVector parses the URI of the vector for its network, which must
+// give the expected fields or error, and parses the URI String builds of a
+// valid one, which must give the same fields and be built again as it is.
+func CheckURIVector(v URIVector) error {
+	net, ok := networks[v.Network]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownNetwork, v.Network)
+	}
+	u, err := Parse(v.URI, net, DefaultRegistry())
+	if !vectorfile.SameError(err, v.Err) {
+		return fmt.Errorf("%w: error %v, expected %v",
+			ErrVectorMismatch, err, v.Err)
+	}
+	if err != nil {
+		return nil
+	}
+
+	for _, parsed := range []string{v.URI, v.Canonical} {
+		if parsed != v.URI {
+			u, err = Parse(parsed, net, DefaultRegistry())
+			if err != nil {
+				return fmt.Errorf("%w: canonical URI: %v",
+					ErrVectorMismatch, err)
+			}
+		}
+		if u.Address != v.Address || u.Amount != v.Amount ||
+			u.Label != v.Label || u.Message != v.Message ||
+			!sameParams(u.Params, v.Params) {
+
+			return fmt.Errorf("%w: %s parses to %+v",
+				ErrVectorMismatch, parsed, *u)
+		}
+		if s := u.String(); s != v.Canonical {
+			return fmt.Errorf("%w: built %s, expected %s",
+				ErrVectorMismatch, s, v.Canonical)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+// Package duplicatetx implements the duplicate transaction rule of BIP 30: a
+// block can't contain a transaction whose txid is that of an earlier one
+// with outputs left unspent, which the new one would overwrite:
+//
+//	utxos := duplicatetx.NewUtxoSet()
+//	for i, block := range blocks {
+//		err := duplicatetx.CheckBlock(block, int32(i), utxos)
+//		utxos.Connect(block)
+//	}
+//
+// Before BIP 34 made coinbase transactions commit to their height, nothing
+// kept a miner from mining the same coinbase transaction twice, and two
+// blocks of mainnet, 91842 and 91880, did, overwriting the outputs of the
+// coinbase transactions of 91812 and 91722 so that only one of each pair
+// can ever be spent. The rule applies to every block but those two, which
+// Duplicates lists. Transactions spending duplicated coinbase transactions
+// can be duplicated in turn, and the rule covers them too.
+//
+// A transaction whose earlier instance is fully spent can be duplicated, as
+// nodes pruning the spent transactions couldn't tell otherwise. The rule
+// checks the outputs unspent before the block, so that a block spending the
+// earlier instance and duplicating it is invalid all the same.
+package duplicatetx
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// ErrDuplicateTx is returned by CheckBlock for a block with a transaction
+// that would overwrite unspent outputs.
+var ErrDuplicateTx = errors.New("duplicatetx: transaction overwrites " +
+	"unspent outputs")
+
+// Duplicate is a coinbase transaction mined twice on mainnet, the second
+// time by a block the rule exempts.
+type Duplicate struct {
+	Txid chainhash.Hash
+
+	// FirstHeight is the height of the block that mined it first, and
+	// Height and Hash the height and hash of the one that mined it again.
+	FirstHeight int32
+	Height      int32
+	Hash        chainhash.Hash
+}
+
+// mustParseHash returns the hash of the hex string, in the byte order
+// block explorers show it in.
+func mustParseHash(s string) chainhash.Hash {
+	hash, err := chainhash.NewHashFromStr(s)
+	if err != nil {
+		panic(err)
+	}
+	return *hash
+}
+
+// Duplicates are the transactions mined twice on mainnet.
+var Duplicates = []Duplicate{
+	{
+		Txid: mustParseHash("d5d27987d2a3dfc724e359870c6644b40e49" +
+			"7bdc0589a033220fe15429d88599"),
+		FirstHeight: 91812,
+		Height:      91842,
+		Hash: mustParseHash("00000000000a4d0a398161ffc163c503763b" +
+			"1f4360639393e0e4c8e300e0caec"),
+	},
+	{
+		Txid: mustParseHash("e3bf3d07d4b0375638d5f1db5255fe07ba2c" +
+			"4cb067cd81b84ee974b6585fb468"),
+		FirstHeight: 91722,
+		Height:      91880,
+		Hash: mustParseHash("00000000000743f190a18c5577a3c2d2a1f6" +
+			"10ae9601ac046a38084ccb7cd721"),
+	},
+}
+
+// IsExempt reports whether the block of the height and hash is one of those
+// that mined the Duplicates, which the rule doesn't apply to.
+func IsExempt(height int32, hash chainhash.Hash) bool {
+	for _, d := range Duplicates {
+		if d.Height == height && d.Hash == hash {
+			return true
+		}
+	}
+	return false
+}
+
+// UtxoView tells which outputs a block is checked against are unspent.
+type UtxoView interface {
+	// HaveOutput reports whether the output is unspent.
+	HaveOutput(op wire.OutPoint) bool
+}
+
+// UtxoSet is a view of a set of unspent outputs, which connecting blocks
+// updates.
+type UtxoSet map[wire.OutPoint]struct{}
+
+// NewUtxoSet returns an empty set.
+func NewUtxoSet() UtxoSet {
+	return make(UtxoSet)
+}
+
+// HaveOutput reports whether the output is in the set.
+func (s UtxoSet) HaveOutput(op wire.OutPoint) bool {
+	_, ok := s[op]
+	return ok
+}
+
+// Connect removes the outputs the transactions of the block spend from the
+// set and adds those they create. The outputs of a duplicate transaction
+// replace those of the earlier one, as they did on mainnet.
+func (s UtxoSet) Connect(block *wire.MsgBlock) {
+	for i, tx := range block.Transactions {
+		if i > 0 {
+			for _, txIn := range tx.TxIn {
+				delete(s, txIn.PreviousOutPoint)
+			}
+		}
+		txid := tx.TxHash()
+		for j := range tx.TxOut {
+			s[*wire.NewOutPoint(&txid, uint32(j))] = struct{}{}
+		}
+	}
+}
+
+// CheckBlock checks that no transaction of the block at the height has the
+// txid of one with outputs unspent in the view, the outputs unspent before
+// the block, unless the block is exempt.
+func CheckBlock(block *wire.MsgBlock, height int32, view UtxoView) error {
+	if IsExempt(height, block.BlockHash()) {
+		return nil
+	}
+	for i, tx := range block.Transactions {
+		txid := tx.TxHash()
+		for j := range tx.TxOut {
+			op := wire.NewOutPoint(&txid, uint32(j))
+			if view.HaveOutput(*op) {
+				return fmt.Errorf("%w: transaction %d, "+
+					"output %v", ErrDuplicateTx, i, op)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,259 @@
+// This program writes test vectors for the duplicatetx package: the blocks
+// of mainnet that duplicated coinbase transactions, which BIP 30 exempts,
+// and blocks of other heights or hashes, which it doesn't, followed by
+// random blocks, to exemptions.json, and regtest chains duplicating
+// coinbase transactions and the transactions spending them, with their
+// outputs unspent, partly spent and fully spent, and reconstructions of the
+// duplicates of mainnet, followed by random chains, to chains.json. The
+// vectors depend only on -seed and -count, so they can be regenerated by
+// anyone:
+//
+//	gentestvectors -count 50 -seed 30
+//
+// Both files use the layout of the BIP 158 vectors: a JSON array whose
+// first row names the columns, followed by one row per vector. Hashes are
+// in the byte order block explorers show them in, and chains are the
+// blocks after the genesis block of regtest in hex, all valid but the last,
+// and the error checking the last gives, empty if it is valid too. Pass
+// -check and -check-chains to verify existing files against the package
+// instead:
+//
+//	gentestvectors -check exemptions.json -check-chains chains.json
+//
+// The program lives in a directory of its own since the duplicatetx package
+// sits at the root of the module.
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	duplicatetx "github.com/christsim/bips/bip-0030"
+	"github.com/christsim/bips/internal/vectorfile"
+)
+
+// exemptionColumns is the header row of the exemption vector file.
+const exemptionColumns = "Height,Hash,Exempt,Comment"
+
+// chainColumns is the header row of the chain vector file.
+const chainColumns = "Blocks,Error,Comment"
+
+type JSONTestWriter struct {
+	writer          io.Writer
+	firstRowWritten bool
+}
+
+func NewJSONTestWriter(writer io.Writer) *JSONTestWriter {
+	return &JSONTestWriter{writer: writer}
+}
+
+func (w *JSONTestWriter) WriteComment(comment string) error {
+	return w.WriteTestCase([]interface{}{comment})
+}
+
+func (w *JSONTestWriter) WriteTestCase(row []interface{}) error {
+	var err error
+	if w.firstRowWritten {
+		_, err = io.WriteString(w.writer, ",\n")
+	} else {
+		_, err = io.WriteString(w.writer, "[\n")
+		w.firstRowWritten = true
+	}
+	if err != nil {
+		return err
+	}
+
+	rowBytes, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.writer.Write(rowBytes)
+	return err
+}
+
+func (w *JSONTestWriter) Close() error {
+	if !w.firstRowWritten {
+		return nil
+	}
+
+	_, err := io.WriteString(w.writer, "\n]\n")
+	return err
+}
+
+func main() {
+	out := flag.String("out", "exemptions.json", "file to write the "+
+		"exemption vectors to")
+	chainsOut := flag.String("chains-out", "chains.json", "file to "+
+		"write the chain vectors to")
+	count := flag.Int("count", 50, "number of random blocks and chains "+
+		"to write vectors of")
+	seed := flag.Int64("seed", 30, "seed of the random vectors")
+	check := flag.String("check", "", "exemption vector file to check "+
+		"instead of writing one")
+	checkChains := flag.String("check-chains", "", "chain vector file to "+
+		"check instead of writing one")
+	flag.Parse()
+
+	var err error
+	switch {
+	case *check != "" || *checkChains != "":
+		if *check != "" {
+			err = checkFile(*check)
+		}
+		if err == nil && *checkChains != "" {
+			err = checkChainsFile(*checkChains)
+		}
+	default:
+		err = writeFile(*out, *seed, *count)
+		if err == nil {
+			err = writeChainsFile(*chainsOut, *seed, *count)
+		}
+	}
+	if err != nil {
+		fmt.Println("Error: ", err.Error())
+		os.Exit(1)
+	}
+}
+
+// writeFile writes the exemption vectors, with count random ones, to out.
+func writeFile(out string, seed int64, count int) error {
+	file, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := NewJSONTestWriter(file)
+	if err := writer.WriteComment(exemptionColumns); err != nil {
+		return err
+	}
+	vectors := duplicatetx.ExemptionVectors(seed, count)
+	for _, v := range vectors {
+		err := writer.WriteTestCase([]interface{}{
+			v.Height,
+			v.Hash.String(),
+			v.Exempt,
+			v.Comment,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote %d exemption vectors\n", len(vectors))
+	return nil
+}
+
+// writeChainsFile writes the chain vectors, with count random ones, to out.
+func writeChainsFile(out string, seed int64, count int) error {
+	file, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := NewJSONTestWriter(file)
+	if err := writer.WriteComment(chainColumns); err != nil {
+		return err
+	}
+	vectors := duplicatetx.ChainVectors(seed, count)
+	for _, v := range vectors {
+		blocks := make([]string, len(v.Blocks))
+		for i, block := range v.Blocks {
+			var buf bytes.Buffer
+			if err := block.Serialize(&buf); err != nil {
+				return err
+			}
+			blocks[i] = hex.EncodeToString(buf.Bytes())
+		}
+		err := writer.WriteTestCase([]interface{}{
+			blocks,
+			vectorfile.ErrorString(v.Err),
+			v.Comment,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote %d chain vectors\n", len(vectors))
+	return nil
+}
+
+// checkFile checks each vector of the exemption file with
+// duplicatetx.CheckExemptionVector.
+func checkFile(path string) error {
+	rows, err := vectorfile.ReadRows(path, 4)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		var v duplicatetx.ExemptionVector
+		var hash string
+		err := vectorfile.DecodeRow(row, &v.Height, &hash, &v.Exempt,
+			&v.Comment)
+		if err != nil {
+			return err
+		}
+		h, err := chainhash.NewHashFromStr(hash)
+		if err != nil {
+			return fmt.Errorf("%v: %v", v.Comment, err)
+		}
+		v.Hash = *h
+		if err := duplicatetx.CheckExemptionVector(v); err != nil {
+			return fmt.Errorf("%v: %v", v.Comment, err)
+		}
+	}
+	fmt.Printf("%d exemption vectors OK\n", len(rows))
+	return nil
+}
+
+// checkChainsFile checks each vector of the chain file with
+// duplicatetx.CheckChainVector.
+func checkChainsFile(path string) error {
+	rows, err := vectorfile.ReadRows(path, 3)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		var v duplicatetx.ChainVector
+		var blocks []string
+		var errMsg string
+		err := vectorfile.DecodeRow(row, &blocks, &errMsg, &v.Comment)
+		if err != nil {
+			return err
+		}
+		for _, s := range blocks {
+			b, err := hex.DecodeString(s)
+			if err != nil {
+				return fmt.Errorf("%v: %v", v.Comment, err)
+			}
+			block := &wire.MsgBlock{}
+			err = block.Deserialize(bytes.NewReader(b))
+			if err != nil {
+				return fmt.Errorf("%v: %v", v.Comment, err)
+			}
+			v.Blocks = append(v.Blocks, block)
+		}
+		v.Err = vectorfile.ParseError(errMsg)
+		if err := duplicatetx.CheckChainVector(v); err != nil {
+			return fmt.Errorf("%v: %v", v.Comment, err)
+		}
+	}
+	fmt.Printf("%d chain vectors OK\n", len(rows))
+	return nil
+}
@@ -0,0 +1,271 @@
+package duplicatetx
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/christsim/bips/internal/vectorfile"
+)
+
+// ErrVectorMismatch is returned by CheckExemptionVector and CheckChainVector
+// when a vector doesn't give the expected result.
+var ErrVectorMismatch = errors.New("duplicatetx: vector mismatch")
+
+// ExemptionVector is the height and hash of a block, and whether the rule
+// exempts it.
+type ExemptionVector struct {
+	Height int32
+	Hash   chainhash.Hash
+	Exempt bool
+
+	// Comment describes what the vector exercises.
+	Comment string
+}
+
+// ExemptionVectors returns vectors of the blocks of the Duplicates, those
+// at their heights of other hashes, those of their hashes at other heights,
+// and the blocks that mined them first. They are followed by count random
+// blocks, of random hashes at heights around those of the Duplicates,
+// derived from a math/rand source with the seed.
+func ExemptionVectors(rngSeed int64, count int) []ExemptionVector {
+	var vectors []ExemptionVector
+	add := func(height int32, hash chainhash.Hash, comment string) {
+		vectors = append(vectors, ExemptionVector{
+			Height:  height,
+			Hash:    hash,
+			Exempt:  IsExempt(height, hash),
+			Comment: comment,
+		})
+	}
+
+	for i, d := range Duplicates {
+		other := Duplicates[1-i]
+		name := fmt.Sprintf("Block %d", d.Height)
+		add(d.Height, d.Hash, name)
+		add(d.Height-1, d.Hash, name+", height one below")
+		add(d.Height+1, d.Hash, name+", height one above")
+		add(d.FirstHeight, d.Hash, name+", height of the first block")
+		add(other.Height, d.Hash, name+", height of the other")
+		add(d.Height, other.Hash, name+", hash of the other")
+		add(d.Height, chainhash.Hash{}, name+", zero hash")
+		add(d.Height, chainhash.Hash(d.Txid), name+", hash of the txid")
+
+		hash := d.Hash
+		hash[0] ^= 1
+		add(d.Height, hash, name+", hash off by a bit")
+	}
+
+	rng := rand.New(rand.NewSource(rngSeed))
+	for n := 0; n < count; n++ {
+		var hash chainhash.Hash
+		rng.Read(hash[:])
+		add(int32(91700+rng.Intn(200)), hash, "Random")
+	}
+	return vectors
+}
+
+// CheckExemptionVector checks whether the rule exempts the block of the
+// vector with IsExempt.
+func CheckExemptionVector(v ExemptionVector) error {
+	if exempt := IsExempt(v.Height, v.Hash); exempt != v.Exempt {
+		return fmt.Errorf("%w: exempt %v, expected %v",
+			ErrVectorMismatch, exempt, v.Exempt)
+	}
+	return nil
+}
+
+// ChainVector is a chain of regtest blocks, from the first block after the
+// genesis block, of which all but the last are valid, and the error
+// checking the last gives, nil if it is valid too.
+type ChainVector struct {
+	Blocks []*wire.MsgBlock
+
+	Err error
+
+	// Comment describes what the vector exercises.
+	Comment string
+}
+
+// CheckChain checks the blocks, from the first block after the genesis
+// block, connecting each to the UTXO set after checking it. It returns the
+// index of the first invalid block and its error, or the number of blocks
+// and nil if they are all valid.
+func CheckChain(blocks []*wire.MsgBlock) (int, error) {
+	utxos := NewUtxoSet()
+	for i, block := range blocks {
+		if err := CheckBlock(block, int32(i+1), utxos); err != nil {
+			return i, err
+		}
+		utxos.Connect(block)
+	}
+	return len(blocks), nil
+}
+
+// coinbase returns a coinbase transaction of the tag, paying each value to
+// an output anyone can spend. Coinbase transactions of the same tag and
+// values are duplicates, as they were before BIP 34.
+func coinbase(tag byte, values ...int64) *wire.MsgTx {
+	tx := wire.NewMsgTx(1)
+	prevOut := wire.NewOutPoint(&chainhash.Hash{}, wire.MaxPrevOutIndex)
+	tx.AddTxIn(wire.NewTxIn(prevOut, []byte{0x01, tag}, nil))
+	for _, value := range values {
+		tx.AddTxOut(wire.NewTxOut(value, []byte{txscript.OP_TRUE}))
+	}
+	return tx
+}
+
+// spend returns a transaction spending the outputs to a single output of the
+// value.
+func spend(value int64, prevOuts ...wire.OutPoint) *wire.MsgTx {
+	tx := wire.NewMsgTx(1)
+	for i := range prevOuts {
+		tx.AddTxIn(wire.NewTxIn(&prevOuts[i], nil, nil))
+	}
+	tx.AddTxOut(wire.NewTxOut(value, []byte{txscript.OP_TRUE}))
+	return tx
+}
+
+// out returns the output of the transaction at the index.
+func out(tx *wire.MsgTx, index uint32) wire.OutPoint {
+	txid := tx.TxHash()
+	return *wire.NewOutPoint(&txid, index)
+}
+
+// chainOf returns the regtest blocks of the transactions, from the first
+// block after the genesis block, each a second after the one before.
+func chainOf(txs ...[]*wire.MsgTx) []*wire.MsgBlock {
+	params := &chaincfg.RegressionNetParams
+	prev := *params.GenesisHash
+	timestamp := params.GenesisBlock.Header.Timestamp
+	var blocks []*wire.MsgBlock
+	for _, blockTxs := range txs {
+		utilTxs := make([]*btcutil.Tx, len(blockTxs))
+		for i, tx := range blockTxs {
+			utilTxs[i] = btcutil.NewTx(tx)
+		}
+		timestamp = timestamp.Add(time.Second)
+		block := wire.NewMsgBlock(wire.NewBlockHeader(1, &prev,
+			&chainhash.Hash{}, params.PowLimitBits, 0))
+		block.Header.MerkleRoot = blockchain.CalcMerkleRoot(utilTxs,
+			false)
+		block.Header.Timestamp = timestamp
+		block.Transactions = blockTxs
+		blocks = append(blocks, block)
+		prev = block.BlockHash()
+	}
+	return blocks
+}
+
+// newChainVector returns the vector of the blocks, cut after the first
+// invalid one.
+func newChainVector(blocks []*wire.MsgBlock, comment string) ChainVector {
+	n, err := CheckChain(blocks)
+	if err != nil {
+		blocks = blocks[:n+1]
+	}
+	return ChainVector{Blocks: blocks, Err: err, Comment: comment}
+}
+
+// ChainVectors returns vectors of regtest chains duplicating coinbase
+// transactions with outputs unspent, partly spent and fully spent, spending
+// them in the block duplicating them, and duplicating the transactions
+// spending them in turn, with reconstructions of the duplicates of mainnet,
+// which the rule would reject anywhere but at their heights of mainnet.
+// They are followed by count random chains mining coinbase transactions of
+// few tags and spending random outputs, derived from a math/rand source
+// with the seed.
+func ChainVectors(rngSeed int64, count int) []ChainVector {
+	const value = 50 * btcutil.SatoshiPerBitcoin
+	a := coinbase(0xa, value)
+	b, c := coinbase(0xb, value), coinbase(0xc, value)
+	d := coinbase(0xd, value)
+	a2 := coinbase(0xa, value/2, value/2)
+	pay := func(txs ...*wire.MsgTx) []*wire.MsgTx {
+		return txs
+	}
+	spendA := spend(value, out(a, 0))
+	spendSpendA := spend(value, out(spendA, 0))
+
+	vectors := []ChainVector{
+		newChainVector(chainOf(pay(a), pay(b), pay(c)),
+			"Unique coinbase transactions"),
+		newChainVector(chainOf(pay(a), pay(a)),
+			"Duplicate coinbase, unspent"),
+		newChainVector(chainOf(pay(a), pay(b, spendA), pay(a)),
+			"Duplicate coinbase, spent"),
+		newChainVector(chainOf(pay(a2),
+			pay(b, spend(value/2, out(a2, 0))), pay(a2)),
+			"Duplicate coinbase, first output spent"),
+		newChainVector(chainOf(pay(a2),
+			pay(b, spend(value/2, out(a2, 1))), pay(a2)),
+			"Duplicate coinbase, second output spent"),
+		newChainVector(chainOf(pay(a2),
+			pay(b, spend(value, out(a2, 0), out(a2, 1))), pay(a2)),
+			"Duplicate coinbase, both outputs spent"),
+		newChainVector(chainOf(pay(a), pay(a, spendA)),
+			"Duplicate coinbase, spent in the same block"),
+		newChainVector(chainOf(pay(a), pay(b, spendA),
+			pay(a, spend(value-1, out(a, 0)))),
+			"Duplicate coinbase, spent, spent again in the same "+
+				"block"),
+		newChainVector(chainOf(pay(a), pay(b, spendA), pay(a, spendA)),
+			"Duplicate coinbase and spend in the same block"),
+		newChainVector(chainOf(pay(a), pay(b, spendA), pay(a),
+			pay(c, spendA)),
+			"Duplicate spend of a duplicate coinbase, unspent"),
+		newChainVector(chainOf(pay(a), pay(b, spendA),
+			pay(c, spendSpendA), pay(a), pay(d, spendA)),
+			"Duplicate spend of a duplicate coinbase, spent"),
+		newChainVector(chainOf(pay(a), pay(b), pay(c), pay(b)),
+			"Reconstruction of blocks 91812 and 91842"),
+		newChainVector(chainOf(pay(a), pay(b), pay(c), pay(a)),
+			"Reconstruction of blocks 91722 and 91880"),
+		newChainVector(chainOf(pay(a), pay(b, spend(value, out(b, 0)))),
+			"Spending an output of the same block"),
+	}
+
+	rng := rand.New(rand.NewSource(rngSeed))
+	for n := 0; n < count; n++ {
+		var blocks [][]*wire.MsgTx
+		var unspent []wire.OutPoint
+		for i, length := 0, 2+rng.Intn(8); i < length; i++ {
+			cb := coinbase(byte(rng.Intn(16)), value)
+			txs := []*wire.MsgTx{cb}
+			if len(unspent) > 0 && rng.Intn(2) == 0 {
+				k := rng.Intn(len(unspent))
+				tx := spend(value, unspent[k])
+				unspent = append(unspent[:k], unspent[k+1:]...)
+				unspent = append(unspent, out(tx, 0))
+				txs = append(txs, tx)
+			}
+			unspent = append(unspent, out(cb, 0))
+			blocks = append(blocks, txs)
+		}
+		vectors = append(vectors, newChainVector(chainOf(blocks...),
+			"Random"))
+	}
+	return vectors
+}
+
+// CheckChainVector checks the blocks of the vector with CheckChain, which
+// must find all but the last valid.
+func CheckChainVector(v ChainVector) error {
+	n, err := CheckChain(v.Blocks)
+	if err != nil && n != len(v.Blocks)-1 {
+		return fmt.Errorf("%w: block %d of %d invalid: %v",
+			ErrVectorMismatch, n, len(v.Blocks), err)
+	}
+	if !vectorfile.SameError(err, v.Err) {
+		return fmt.Errorf("%w: error %v, expected %v",
+			ErrVectorMismatch, err, v.Err)
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+// Package bip32 implements the hierarchical deterministic wallets of BIP 32:
+// deriving a master extended key from a seed, deriving child keys from it
+// with CKDpriv and CKDpub, and serializing extended keys as xprv and xpub
+// strings.
+//
+// An extended key is a private or public secp256k1 key along with a 32 byte
+// chain code. Child i of a private key is derived from the private key if i is
+// hardened, that is at least HardenedKeyStart, and from the public key
+// otherwise. Only non-hardened children can be derived from a public key,
+// which lets a watch-only wallet hold an account's xpub and derive its
+// addresses without being able to spend from them:
+//
+//	master, err := bip32.NewMaster(seed, bip32.Mainnet)
+//	account, err := master.Derive(bip32.MustParsePath("m/84'/0'/0'"))
+//	xpub := account.Neuter()
+//	receive, err := xpub.Derive(bip32.Path{0, 5})
+//
+// Vectors returns the test vectors of the BIP along with randomized vectors,
+// which the gentestvectors program writes to a file.
+package bip32
+
+import (
+	"errors"
+)
+
+const (
+	// HardenedKeyStart is the index of the first hardened child. Hardened
+	// indexes are written with a trailing ' in paths, so that 0' is
+	// HardenedKeyStart.
+	HardenedKeyStart = 0x80000000
+
+	// MinSeedLen and MaxSeedLen are the bounds of the seed lengths the BIP
+	// allows, in bytes.
+	MinSeedLen = 16
+	MaxSeedLen = 64
+
+	// MaxDepth is the depth of the deepest key that can be serialized, as
+	// the depth is serialized as a single byte.
+	MaxDepth = 255
+
+	// serializedLen is the length of a serialized extended key, before
+	// the checksum is appended.
+	serializedLen = 78
+)
+
+var (
+	// ErrInvalidSeedLen is returned by NewMaster when the seed isn't
+	// between MinSeedLen and MaxSeedLen bytes long.
+	ErrInvalidSeedLen = errors.New("bip32: seed must be between 16 and " +
+		"64 bytes")
+
+	// ErrUnusableSeed is returned by NewMaster when the seed gives an
+	// invalid master key, which happens with a probability lower than
+	// 1 in 2^127.
+	ErrUnusableSeed = errors.New("bip32: seed gives an invalid master key")
+
+	// ErrInvalidChild is returned when deriving a child that is invalid,
+	// which happens with a probability lower than 1 in 2^127. The BIP
+	// requires callers to skip to the next index.
+	ErrInvalidChild = errors.New("bip32: invalid child, use the next index")
+
+	// ErrDeriveHardFromPublic is returned when deriving a hardened child
+	// from a public key.
+	ErrDeriveHardFromPublic = errors.New("bip32: can't derive a hardened " +
+		"child from a public key")
+
+	// ErrDepthTooBig is returned when deriving a child of a key at
+	// MaxDepth.
+	ErrDepthTooBig = errors.New("bip32: depth can't exceed 255")
+
+	// ErrInvalidKeyLen is returned when parsing a serialized key that
+	// isn't 78 bytes long.
+	ErrInvalidKeyLen = errors.New("bip32: serialized key must be 78 bytes")
+
+	// ErrBadChecksum is returned when parsing a key whose checksum doesn't
+	// match.
+	ErrBadChecksum = errors.New("bip32: bad checksum")
+
+	// ErrUnknownVersion is returned when parsing a key whose version
+	// bytes belong to no known network.
+	ErrUnknownVersion = errors.New("bip32: unknown version")
+
+	// ErrInvalidPrivateKey is returned when parsing a private key that is
+	// zero or not below the curve order, or whose padding byte isn't zero.
+	ErrInvalidPrivateKey = errors.New("bip32: invalid private key")
+
+	// ErrInvalidPublicKey is returned when parsing a public key that isn't
+	// a compressed point on the curve.
+	ErrInvalidPublicKey = errors.New("bip32: invalid public key")
+
+	// ErrInvalidMaster is returned when parsing a key at depth 0 whose
+	// parent fingerprint or child number isn't zero.
+	ErrInvalidMaster = errors.New("bip32: master key with parent " +
+		"fingerprint or child number")
+
+	// ErrInvalidPath is returned by ParsePath for a malformed path.
+	ErrInvalidPath = errors.New("bip32: invalid path")
+)
+
+// Network holds the version bytes extended keys are serialized with on a
+// network.
+type Network struct {
+	// Name identifies the network.
+	Name string
+
+	// Private and Public are the versions of private and public keys.
+	Private [4]byte
+	Public  [4]byte
+}
+
+var (
+	// Mainnet gives xprv and xpub keys.
+	Mainnet = Network{
+		Name:    "mainnet",
+		Private: [4]byte{0x04, 0x88, 0xad, 0xe4},
+		Public:  [4]byte{0x04, 0x88, 0xb2, 0x1e},
+	}
+
+	// Testnet gives tprv and tpub keys, and is also used on regtest and
+	// signet.
+	Testnet = Network{
+		Name:    "testnet",
+		Private: [4]byte{0x04, 0x35, 0x83, 0x94},
+		Public:  [4]byte{0x04, 0x35, 0x87, 0xcf},
+	}
+)
+
+// networks are the networks whose keys ParseKey accepts. Other versions,
+// such as those of SLIP 132, can be added with RegisterNetwork.
+var networks = []Network{Mainnet, Testnet}
+
+// RegisterNetwork makes ParseKey accept keys with the network's versions.
+func RegisterNetwork(net Network) {
+	networks = append(networks, net)
+}
+
+// lookupVersion returns the network the version belongs to and whether it's
+// the version of private keys.
+func lookupVersion(version [4]byte) (Network, bool, error) {
+	for _, net := range networks {
+		switch version {
+		case net.Private:
+			return net, true, nil
+		case net.Public:
+			return net, false, nil
+		}
+	}
+	return Network{}, false, ErrUnknownVersion
+}
@@ -0,0 +1,187 @@
+package derivation
+
+import (
+	bip32 "github.com/christsim/bips/bip-0032"
+)
+
+// Network holds what addresses and keys are rendered with on a network.
+type Network struct {
+	// Name identifies the network.
+	Name string
+
+	// CoinType is the second level of paths on the network, as registered
+	// in SLIP 44.
+	CoinType uint32
+
+	// PubKeyHashAddrID and ScriptHashAddrID are the version bytes of
+	// P2PKH and P2SH addresses.
+	PubKeyHashAddrID byte
+	ScriptHashAddrID byte
+
+	// HRP is the human readable part of segwit addresses.
+	HRP string
+
+	// Keys holds the versions of extended keys, and SLIP132 the versions
+	// that mark the script type of account keys, by purpose. Purposes
+	// without an entry in SLIP132 use Keys.
+	Keys    bip32.Network
+	SLIP132 map[Purpose]bip32.Network
+}
+
+var (
+	// Mainnet is the main network.
+	Mainnet = Network{
+		Name:             "mainnet",
+		CoinType:         0,
+		PubKeyHashAddrID: 0x00,
+		ScriptHashAddrID: 0x05,
+		HRP:              "bc",
+		Keys:             bip32.Mainnet,
+		SLIP132: map[Purpose]bip32.Network{
+			BIP49: {
+				Name:    "mainnet-bip49",
+				Private: [4]byte{0x04, 0x9d, 0x78, 0x78},
+				Public:  [4]byte{0x04, 0x9d, 0x7c, 0xb2},
+			},
+			BIP84: {
+				Name:    "mainnet-bip84",
+				Private: [4]byte{0x04, 0xb2, 0x43, 0x0c},
+				Public:  [4]byte{0x04, 0xb2, 0x47, 0x46},
+			},
+		},
+	}
+
+	// Testnet is the test network, whose coin type and versions are also
+	// used on regtest and signet. Regtest addresses use the bcrt HRP.
+	Testnet = Network{
+		Name:             "testnet",
+		CoinType:         1,
+		PubKeyHashAddrID: 0x6f,
+		ScriptHashAddrID: 0xc4,
+		HRP:              "tb",
+		Keys:             bip32.Testnet,
+		SLIP132: map[Purpose]bip32.Network{
+			BIP49: {
+				Name:    "testnet-bip49",
+				Private: [4]byte{0x04, 0x4a, 0x4e, 0x28},
+				Public:  [4]byte{0x04, 0x4a, 0x52, 0x62},
+			},
+			BIP84: {
+				Name:    "testnet-bip84",
+				Private: [4]byte{0x04, 0x5f, 0x18, 0xbc},
+				Public:  [4]byte{0x04, 0x5f, 0x1c, 0xf6},
+			},
+		},
+	}
+)
+
+func init() {
+	// Let bip32.ParseKey read the account keys wallets export with
+	// SLIP 132 versions, such as zpubs.
+	for _, net := range []Network{Mainnet, Testnet} {
+		for _, keys := range net.SLIP132 {
+			bip32.RegisterNetwork(keys)
+		}
+	}
+}
+
+// Account is an account of the BIP 44 structure, from whose key the
+// addresses of the account are derived. The key is either private or, for a
+// watch-only account, public.
+type Account struct {
+	Purpose Purpose
+	Net     Network
+	Number  uint32
+
+	key *bip32.ExtendedKey
+}
+
+// DeriveAccount derives an account from a master key, which may be private
+// or, since account levels are hardened, nothing else.
+func DeriveAccount(master *bip32.ExtendedKey, purpose Purpose, net Network,
+	number uint32) (*Account, error) {
+
+	if _, err := purpose.ScriptType(); err != nil {
+		return nil, err
+	}
+	key, err := master.Derive(AccountPath(purpose, net.CoinType, number))
+	if err != nil {
+		return nil, err
+	}
+	return &Account{
+		Purpose: purpose,
+		Net:     net,
+		Number:  number,
+		key:     key.WithNetwork(net.Keys),
+	}, nil
+}
+
+// NewAccount returns an account of the passed key, typically an xpub exported
+// by a wallet for watch-only use. The account number is taken from the key's
+// child number.
+func NewAccount(key *bip32.ExtendedKey, purpose Purpose,
+	net Network) (*Account, error) {
+
+	if _, err := purpose.ScriptType(); err != nil {
+		return nil, err
+	}
+	number := key.ChildNumber()
+	if number >= bip32.HardenedKeyStart {
+		number -= bip32.HardenedKeyStart
+	}
+	return &Account{
+		Purpose: purpose,
+		Net:     net,
+		Number:  number,
+		key:     key.WithNetwork(net.Keys),
+	}, nil
+}
+
+// Key returns the account key with the standard versions of the network.
+func (a *Account) Key() *bip32.ExtendedKey {
+	return a.key
+}
+
+// SLIP132Key returns the account key with the SLIP 132 versions of the
+// account's purpose, such as a zpub for BIP 84 on mainnet, or the standard
+// versions for purposes without any.
+func (a *Account) SLIP132Key() *bip32.ExtendedKey {
+	keys, ok := a.Net.SLIP132[a.Purpose]
+	if !ok {
+		return a.key
+	}
+	return a.key.WithNetwork(keys)
+}
+
+// Path returns the path of the address at the passed change level and
+// index.
+func (a *Account) Path(change Change, index uint32) Path {
+	return Path{
+		Purpose:  a.Purpose,
+		CoinType: a.Net.CoinType,
+		Account:  a.Number,
+		Change:   change,
+		Index:    index,
+	}
+}
+
+// AddressKey derives the key of the address at the passed change level and
+// index.
+func (a *Account) AddressKey(change Change,
+	index uint32) (*bip32.ExtendedKey, error) {
+
+	return a.key.Derive(bip32.Path{uint32(change), index})
+}
+
+// Address renders the address at the passed change level and index.
+func (a *Account) Address(change Change, index uint32) (string, error) {
+	key, err := a.AddressKey(change, index)
+	if err != nil {
+		return "", err
+	}
+	scriptType, err := a.Purpose.ScriptType()
+	if err != nil {
+		return "", err
+	}
+	return Address(key.PublicKey(), scriptType, a.Net)
+}
@@ -0,0 +1,97 @@
+package derivation
+
+import (
+	"crypto/sha256"
+	"errors"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/christsim/bips/base58"
+	bech32 "github.com/christsim/bips/bip-0173"
+	"golang.org/x/crypto/ripemd160"
+)
+
+// ErrInvalidPubKey is returned when rendering the address of a public key
+// that isn't a compressed point on the curve.
+var ErrInvalidPubKey = errors.New("derivation: invalid public key")
+
+// hash160 returns RIPEMD160(SHA256(data)).
+func hash160(data []byte) []byte {
+	sha := sha256.Sum256(data)
+	h := ripemd160.New()
+	h.Write(sha[:])
+	return h.Sum(nil)
+}
+
+// Address renders the address paying to the compressed public key with an
+// output script of the passed type.
+func Address(pubKey []byte, scriptType ScriptType,
+	net Network) (string, error) {
+
+	if _, err := btcec.ParsePubKey(pubKey); err != nil ||
+		len(pubKey) != 33 {
+
+		return "", ErrInvalidPubKey
+	}
+
+	switch scriptType {
+	case P2PKH:
+		return base58.CheckEncode(append([]byte{net.PubKeyHashAddrID},
+			hash160(pubKey)...)), nil
+
+	case P2SHP2WPKH:
+		redeemScript := append([]byte{0x00, 0x14}, hash160(pubKey)...)
+		return base58.CheckEncode(append([]byte{net.ScriptHashAddrID},
+			hash160(redeemScript)...)), nil
+
+	case P2WPKH:
+		return bech32.EncodeSegwit(net.HRP, 0, hash160(pubKey))
+
+	case P2TR:
+		outputKey, err := TaprootOutputKey(pubKey)
+		if err != nil {
+			return "", err
+		}
+		return bech32.EncodeSegwit(net.HRP, 1, outputKey)
+
+	default:
+		return "", ErrUnknownPurpose
+	}
+}
+
+// TaprootOutputKey returns the x-only output key of a BIP 86 output, which
+// commits to the compressed internal key and no script tree:
+//
+//	Q = P + int(hashTapTweak(bytes(P)))G
+//
+// where P is the internal key with an even Y coordinate.
+func TaprootOutputKey(internalKey []byte) ([]byte, error) {
+	// Lifting the X coordinate gives the even Y point whichever the
+	// parity of the key's Y coordinate.
+	even := append([]byte{0x02}, internalKey[1:]...)
+	p, err := btcec.ParsePubKey(even)
+	if err != nil {
+		return nil, ErrInvalidPubKey
+	}
+
+	tag := sha256.Sum256([]byte("TapTweak"))
+	h := sha256.New()
+	h.Write(tag[:])
+	h.Write(tag[:])
+	h.Write(even[1:])
+
+	var tweak btcec.ModNScalar
+	if tweak.SetByteSlice(h.Sum(nil)) {
+		return nil, ErrInvalidPubKey
+	}
+
+	var tweakPoint, point, q btcec.JacobianPoint
+	btcec.ScalarBaseMultNonConst(&tweak, &tweakPoint)
+	p.AsJacobian(&point)
+	btcec.AddNonConst(&point, &tweakPoint, &q)
+	if q.Z.IsZero() {
+		return nil, ErrInvalidPubKey
+	}
+	q.ToAffine()
+	x := q.X.Bytes()
+	return x[:], nil
+}
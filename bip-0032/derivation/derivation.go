@@ -0,0 +1,207 @@
+// Package derivation implements the account structure of BIP 44 and the
+// derivation schemes built on it: BIP 49 for P2WPKH nested in P2SH, BIP 84
+// for native P2WPKH and BIP 86 for single key P2TR. Keys are derived along
+// paths of the form
+//
+//	m / purpose' / coin_type' / account' / change / address_index
+//
+// where the purpose selects the script type of the addresses. The package
+// parses and normalizes such paths, derives account keys from a master key,
+// and renders the addresses of an account, from its private key or from its
+// xpub alone:
+//
+//	account, err := derivation.DeriveAccount(master, derivation.BIP84,
+//		derivation.Mainnet, 0)
+//	address, err := account.Address(derivation.External, 0)
+package derivation
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	bip32 "github.com/christsim/bips/bip-0032"
+)
+
+var (
+	// ErrUnknownPurpose is returned for a purpose the package doesn't
+	// implement.
+	ErrUnknownPurpose = errors.New("derivation: unknown purpose")
+
+	// ErrPathDepth is returned when parsing a path that isn't 5 levels
+	// deep.
+	ErrPathDepth = errors.New("derivation: path must have 5 levels")
+
+	// ErrNotHardened is returned when parsing a path whose purpose, coin
+	// type or account isn't hardened, or whose change or address index
+	// is.
+	ErrNotHardened = errors.New("derivation: purpose, coin type and " +
+		"account must be hardened, change and index must not")
+
+	// ErrInvalidChange is returned when parsing a path whose change level
+	// is neither 0 nor 1.
+	ErrInvalidChange = errors.New("derivation: change must be 0 or 1")
+
+	// ErrWrongNetwork is returned when a path's coin type isn't that of
+	// the network it's used with.
+	ErrWrongNetwork = errors.New("derivation: coin type doesn't match " +
+		"network")
+)
+
+// Purpose is the first level of a path, the number of the BIP defining the
+// structure below it.
+type Purpose uint32
+
+const (
+	BIP44 Purpose = 44
+	BIP49 Purpose = 49
+	BIP84 Purpose = 84
+	BIP86 Purpose = 86
+)
+
+// Purposes are the purposes the package implements.
+var Purposes = []Purpose{BIP44, BIP49, BIP84, BIP86}
+
+// ScriptType returns the type of the output scripts of the purpose's
+// addresses.
+func (p Purpose) ScriptType() (ScriptType, error) {
+	switch p {
+	case BIP44:
+		return P2PKH, nil
+	case BIP49:
+		return P2SHP2WPKH, nil
+	case BIP84:
+		return P2WPKH, nil
+	case BIP86:
+		return P2TR, nil
+	default:
+		return 0, ErrUnknownPurpose
+	}
+}
+
+// PurposeOf returns the purpose whose addresses have the script type.
+func PurposeOf(scriptType ScriptType) (Purpose, error) {
+	for _, p := range Purposes {
+		if st, _ := p.ScriptType(); st == scriptType {
+			return p, nil
+		}
+	}
+	return 0, ErrUnknownPurpose
+}
+
+// ScriptType is the type of the output script an address pays to.
+type ScriptType int
+
+const (
+	// P2PKH is pay to public key hash, with a 1 address on mainnet.
+	P2PKH ScriptType = iota
+
+	// P2SHP2WPKH is P2WPKH nested in P2SH, with a 3 address on mainnet.
+	P2SHP2WPKH
+
+	// P2WPKH is native pay to witness public key hash, with a bc1q
+	// address on mainnet.
+	P2WPKH
+
+	// P2TR is pay to taproot with a key path only, with a bc1p address on
+	// mainnet.
+	P2TR
+)
+
+// String returns the name of the script type.
+func (t ScriptType) String() string {
+	switch t {
+	case P2PKH:
+		return "p2pkh"
+	case P2SHP2WPKH:
+		return "p2sh-p2wpkh"
+	case P2WPKH:
+		return "p2wpkh"
+	case P2TR:
+		return "p2tr"
+	default:
+		return fmt.Sprintf("ScriptType(%d)", int(t))
+	}
+}
+
+// Change is the fourth level of a path, separating the addresses given out
+// to receive payments from those that receive change.
+type Change uint32
+
+const (
+	External Change = 0
+	Internal Change = 1
+)
+
+// Path is a path of the BIP 44 structure down to an address.
+type Path struct {
+	Purpose  Purpose
+	CoinType uint32
+	Account  uint32
+	Change   Change
+	Index    uint32
+}
+
+// ParsePath parses a path of the BIP 44 structure, such as m/84'/0'/0'/0/0,
+// with hardened levels marked by ', h or H.
+func ParsePath(s string) (Path, error) {
+	p, err := bip32.ParsePath(s)
+	if err != nil {
+		return Path{}, err
+	}
+	if len(p) != 5 {
+		return Path{}, ErrPathDepth
+	}
+	for i, index := range p {
+		if (index >= bip32.HardenedKeyStart) != (i < 3) {
+			return Path{}, ErrNotHardened
+		}
+	}
+
+	path := Path{
+		Purpose:  Purpose(p[0] - bip32.HardenedKeyStart),
+		CoinType: p[1] - bip32.HardenedKeyStart,
+		Account:  p[2] - bip32.HardenedKeyStart,
+		Change:   Change(p[3]),
+		Index:    p[4],
+	}
+	if _, err := path.Purpose.ScriptType(); err != nil {
+		return Path{}, err
+	}
+	if path.Change != External && path.Change != Internal {
+		return Path{}, ErrInvalidChange
+	}
+	return path, nil
+}
+
+// Normalize returns a path in its canonical form, starting with m/ and with
+// hardened levels marked by ', so that paths written differently can be
+// compared. Any BIP 32 path is accepted, not only those of the BIP 44
+// structure.
+func Normalize(s string) (string, error) {
+	p, err := bip32.ParsePath(strings.TrimSpace(s))
+	if err != nil {
+		return "", err
+	}
+	return p.String(), nil
+}
+
+// AccountPath returns the path of an account key.
+func AccountPath(purpose Purpose, coinType, account uint32) bip32.Path {
+	return bip32.Path{
+		uint32(purpose) + bip32.HardenedKeyStart,
+		coinType + bip32.HardenedKeyStart,
+		account + bip32.HardenedKeyStart,
+	}
+}
+
+// BIP32 returns the path as a path of child indexes.
+func (p Path) BIP32() bip32.Path {
+	return append(AccountPath(p.Purpose, p.CoinType, p.Account),
+		uint32(p.Change), p.Index)
+}
+
+// String returns the path in its canonical form.
+func (p Path) String() string {
+	return p.BIP32().String()
+}
@@ -0,0 +1,254 @@
+package derivation
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	bip32 "github.com/christsim/bips/bip-0032"
+)
+
+// ErrVectorMismatch is returned by CheckVector when deriving a vector's
+// account key or address doesn't give the expected result.
+var ErrVectorMismatch = errors.New("derivation: vector mismatch")
+
+// AbandonSeed is the seed of the mnemonic "abandon abandon abandon abandon
+// abandon abandon abandon abandon abandon abandon abandon about" without a
+// passphrase, which the BIPs' test vectors are derived from.
+const AbandonSeed = "5eb00bbddcf069084889a8ab9155568165f5c453ccb85e70811aaed6" +
+	"f6da5fc19a5ac40b389cd370d086206dec8aa6c43daea6690f20ad3d8d48b2d2ce9e38e4"
+
+// Vector is an address derived from a seed, along with the key of its
+// account.
+type Vector struct {
+	Seed []byte
+	Net  Network
+	Path Path
+
+	// AccountKey is the serialization of the account key, private or
+	// public, with the standard or SLIP 132 versions.
+	AccountKey string
+
+	// Address is the address at the path.
+	Address string
+
+	// Comment describes where the vector comes from.
+	Comment string
+}
+
+// specVector is an address from the test vectors of one of the BIPs, all of
+// which derive from AbandonSeed.
+type specVector struct {
+	net        Network
+	path       string
+	accountKey string
+	address    string
+	comment    string
+}
+
+var specVectors = []specVector{
+	{
+		net:  Mainnet,
+		path: "m/44'/0'/0'/0/0",
+		accountKey: "xpub6BosfCnifzxcFwrSzQiqu2DBVTshkCXacvNsWGYJVVhhawA" +
+			"7d4R5WSWGFNbi8Aw6ZRc1brxMyWMzG3DSSSSoekkudhUd9yLb6qx39T9nMdj",
+		address: "1LqBGSKuX5yYUonjxT5qGfpUsXKYYWeabA",
+		comment: "BIP 44 first receiving address",
+	},
+	{
+		net:  Testnet,
+		path: "m/49'/1'/0'/0/0",
+		accountKey: "tprv8gRrNu65W2Msef2BdBSUgFdRTGzC8EwVXnV7UGS3faeXtuM" +
+			"VtGfEdidVeGbThs4ELEoayCAzZQ4uUji9DUiAs7erdVskqju7hrBcDvDsdbY",
+		address: "2Mww8dCYPUpKHofjgcXcBCEGmniw9CoaiD2",
+		comment: "BIP 49 test vector",
+	},
+	{
+		net:  Mainnet,
+		path: "m/84'/0'/0'/0/0",
+		accountKey: "zpub6rFR7y4Q2AijBEqTUquhVz398htDFrtymD9xYYfG1m4wAcv" +
+			"PhXNfE3EfH1r1ADqtfSdVCToUG868RvUUkgDKf31mGDtKsAYz2oz2AGutZYs",
+		address: "bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu",
+		comment: "BIP 84 test vector, first receiving address",
+	},
+	{
+		net:  Mainnet,
+		path: "m/84'/0'/0'/0/1",
+		accountKey: "zprvAdG4iTXWBoARxkkzNpNh8r6Qag3irQB8PzEMkAFeTRXxHpb" +
+			"F9z4QgEvBRmfvqWvGp42t42nvgGpNgYSJA9iefm1yYNZKEm7z6qUWCroSQnE",
+		address: "bc1qnjg0jd8228aq7egyzacy8cys3knf9xvrerkf9g",
+		comment: "BIP 84 test vector, second receiving address",
+	},
+	{
+		net:  Mainnet,
+		path: "m/84'/0'/0'/1/0",
+		accountKey: "zpub6rFR7y4Q2AijBEqTUquhVz398htDFrtymD9xYYfG1m4wAcv" +
+			"PhXNfE3EfH1r1ADqtfSdVCToUG868RvUUkgDKf31mGDtKsAYz2oz2AGutZYs",
+		address: "bc1q8c6fshw2dlwun7ekn9qwf37cu2rn755upcp6el",
+		comment: "BIP 84 test vector, first change address",
+	},
+	{
+		net:  Mainnet,
+		path: "m/86'/0'/0'/0/0",
+		accountKey: "xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxa" +
+			"rj2afYWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ",
+		address: "bc1p5cyxnuxmeuwuvkwfem96lqzszd02n6xdcjrs20cac6yqjjwudpxqkedrcr",
+		comment: "BIP 86 test vector, first receiving address",
+	},
+	{
+		net:  Mainnet,
+		path: "m/86'/0'/0'/0/1",
+		accountKey: "xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxa" +
+			"rj2afYWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ",
+		address: "bc1p4qhjn9zdvkux4e44uhx8tc55attvtyu358kutcqkudyccelu0was9fqzwh",
+		comment: "BIP 86 test vector, second receiving address",
+	},
+	{
+		net:  Mainnet,
+		path: "m/86'/0'/0'/1/0",
+		accountKey: "xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxa" +
+			"rj2afYWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ",
+		address: "bc1p3qkhfews2uk44qtvauqyr2ttdsw7svhkl9nkm9s9c3x4ax5h60wqwruhk7",
+		comment: "BIP 86 test vector, first change address",
+	},
+}
+
+// SpecVectors returns the test vectors published with BIPs 49, 84 and 86,
+// along with the first BIP 44 address of the same seed, which BIP 44 itself
+// has no vectors for but wallets widely reproduce.
+func SpecVectors() []Vector {
+	seed, err := hex.DecodeString(AbandonSeed)
+	if err != nil {
+		panic(err)
+	}
+
+	vectors := make([]Vector, 0, len(specVectors))
+	for _, sv := range specVectors {
+		path, err := ParsePath(sv.path)
+		if err != nil {
+			panic(err)
+		}
+		vectors = append(vectors, Vector{
+			Seed:       seed,
+			Net:        sv.net,
+			Path:       path,
+			AccountKey: sv.accountKey,
+			Address:    sv.address,
+			Comment:    sv.comment,
+		})
+	}
+	return vectors
+}
+
+// Vectors returns the test vectors of the BIPs, followed by the first
+// receiving and change addresses of the first two accounts of every purpose
+// on both networks, derived from AbandonSeed. The latter carry the account
+// xpub, or the SLIP 132 equivalent where there is one.
+func Vectors() []Vector {
+	vectors := SpecVectors()
+	seed := vectors[0].Seed
+	for _, net := range []Network{Mainnet, Testnet} {
+		for _, purpose := range Purposes {
+			for number := uint32(0); number < 2; number++ {
+				for _, change := range []Change{External, Internal} {
+					for index := uint32(0); index < 2; index++ {
+						v, err := NewVector(seed, net, purpose,
+							number, change, index)
+						if err != nil {
+							panic(err)
+						}
+						vectors = append(vectors, *v)
+					}
+				}
+			}
+		}
+	}
+	return vectors
+}
+
+// NewVector derives the address at the passed position from the seed, and
+// returns it with the SLIP 132 public key of its account.
+func NewVector(seed []byte, net Network, purpose Purpose, number uint32,
+	change Change, index uint32) (*Vector, error) {
+
+	master, err := bip32.NewMaster(seed, net.Keys)
+	if err != nil {
+		return nil, err
+	}
+	account, err := DeriveAccount(master, purpose, net, number)
+	if err != nil {
+		return nil, err
+	}
+	address, err := account.Address(change, index)
+	if err != nil {
+		return nil, err
+	}
+	path := account.Path(change, index)
+	scriptType, _ := purpose.ScriptType()
+	return &Vector{
+		Seed:       seed,
+		Net:        net,
+		Path:       path,
+		AccountKey: account.SLIP132Key().Neuter().String(),
+		Address:    address,
+		Comment:    fmt.Sprintf("%v %v %v", net.Name, scriptType, path),
+	}, nil
+}
+
+// CheckVector derives the vector's account from its seed and checks its key,
+// and derives the vector's address both from the account's private key and,
+// as a watch-only wallet would, from the account key alone.
+func CheckVector(v Vector) error {
+	if v.Path.CoinType != v.Net.CoinType {
+		return ErrWrongNetwork
+	}
+	master, err := bip32.NewMaster(v.Seed, v.Net.Keys)
+	if err != nil {
+		return err
+	}
+	account, err := DeriveAccount(master, v.Path.Purpose, v.Net,
+		v.Path.Account)
+	if err != nil {
+		return err
+	}
+
+	// Compare the account key in the form the vector has it in.
+	expected, err := bip32.ParseKey(v.AccountKey)
+	if err != nil {
+		return err
+	}
+	key := account.Key()
+	if expected.Network().Name != v.Net.Keys.Name {
+		key = account.SLIP132Key()
+	}
+	if !expected.IsPrivate() {
+		key = key.Neuter()
+	}
+	if key.String() != v.AccountKey {
+		return fmt.Errorf("%w: account key %v, expected %v",
+			ErrVectorMismatch, key, v.AccountKey)
+	}
+
+	address, err := account.Address(v.Path.Change, v.Path.Index)
+	if err != nil {
+		return err
+	}
+	if address != v.Address {
+		return fmt.Errorf("%w: address %v, expected %v",
+			ErrVectorMismatch, address, v.Address)
+	}
+
+	watchOnly, err := NewAccount(expected.Neuter(), v.Path.Purpose, v.Net)
+	if err != nil {
+		return err
+	}
+	address, err = watchOnly.Address(v.Path.Change, v.Path.Index)
+	if err != nil {
+		return err
+	}
+	if address != v.Address {
+		return fmt.Errorf("%w: watch-only address %v, expected %v",
+			ErrVectorMismatch, address, v.Address)
+	}
+	return nil
+}
@@ -0,0 +1,310 @@
+// This program writes test vectors for the bip32 package: the test vectors of
+// BIP 32, followed by vectors for random seeds and paths, to bip32.json, and
+// serialized keys that must be rejected to bip32-invalid.json. The random
+// vectors depend only on -seed and -count, so they can be regenerated by
+// anyone:
+//
+//	gentestvectors -count 1000 -seed 32
+//
+// Both files use the layout of the BIP 158 vectors: a JSON array whose first
+// row names the columns, followed by one row per vector. Pass -check to
+// verify existing files against the package instead, which is how other
+// implementations' output can be compared:
+//
+//	gentestvectors -check bip32.json -check-invalid bip32-invalid.json
+//
+// With -derivation-out, the program also writes the addresses of the
+// derivation package: the vectors of BIPs 49, 84 and 86 and the first
+// addresses of every purpose on both networks, checked with
+// -check-derivation.
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	bip32 "github.com/christsim/bips/bip-0032"
+	"github.com/christsim/bips/bip-0032/derivation"
+	"github.com/christsim/bips/internal/vectorfile"
+)
+
+const (
+	// vectorColumns, invalidColumns and derivationColumns are the header
+	// rows of the vector files.
+	vectorColumns     = "Seed,Path,Private,Public,Comment"
+	invalidColumns    = "Key,Error,Comment"
+	derivationColumns = "Seed,Network,Path,AccountKey,Address,Comment"
+)
+
+type JSONTestWriter struct {
+	writer          io.Writer
+	firstRowWritten bool
+}
+
+func NewJSONTestWriter(writer io.Writer) *JSONTestWriter {
+	return &JSONTestWriter{writer: writer}
+}
+
+func (w *JSONTestWriter) WriteComment(comment string) error {
+	return w.WriteTestCase([]interface{}{comment})
+}
+
+func (w *JSONTestWriter) WriteTestCase(row []interface{}) error {
+	var err error
+	if w.firstRowWritten {
+		_, err = io.WriteString(w.writer, ",\n")
+	} else {
+		_, err = io.WriteString(w.writer, "[\n")
+		w.firstRowWritten = true
+	}
+	if err != nil {
+		return err
+	}
+
+	rowBytes, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.writer.Write(rowBytes)
+	return err
+}
+
+func (w *JSONTestWriter) Close() error {
+	if !w.firstRowWritten {
+		return nil
+	}
+
+	_, err := io.WriteString(w.writer, "\n]\n")
+	return err
+}
+
+func main() {
+	out := flag.String("out", "bip32.json", "file to write the vectors to")
+	invalidOut := flag.String("invalid-out", "bip32-invalid.json", "file "+
+		"to write the invalid keys to")
+	count := flag.Int("count", 100, "number of random vectors to write "+
+		"after those of the BIP")
+	seed := flag.Int64("seed", 32, "seed of the random vectors")
+	check := flag.String("check", "", "vector file to check instead of "+
+		"writing one")
+	checkInvalid := flag.String("check-invalid", "", "invalid key file to "+
+		"check instead of writing one")
+	derivationOut := flag.String("derivation-out", "", "file to write the "+
+		"addresses of the derivation package to")
+	checkDerivation := flag.String("check-derivation", "", "derivation "+
+		"file to check instead of writing one")
+	flag.Parse()
+
+	var err error
+	switch {
+	case *check != "" || *checkInvalid != "" || *checkDerivation != "":
+		err = checkFiles(*check, *checkInvalid)
+		if err == nil && *checkDerivation != "" {
+			err = checkDerivationFile(*checkDerivation)
+		}
+	default:
+		err = writeFiles(*out, *invalidOut, *seed, *count)
+		if err == nil && *derivationOut != "" {
+			err = writeDerivationFile(*derivationOut)
+		}
+	}
+	if err != nil {
+		fmt.Println("Error: ", err.Error())
+		os.Exit(1)
+	}
+}
+
+// writeFiles writes the vectors of the BIP and count random vectors to out,
+// and the invalid keys to invalidOut.
+func writeFiles(out, invalidOut string, seed int64, count int) error {
+	random, err := bip32.RandomVectors(seed, count)
+	if err != nil {
+		return err
+	}
+	vectors := append(bip32.Vectors(), random...)
+
+	file, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := NewJSONTestWriter(file)
+	if err := writer.WriteComment(vectorColumns); err != nil {
+		return err
+	}
+	for _, v := range vectors {
+		err := writer.WriteTestCase([]interface{}{
+			hex.EncodeToString(v.Seed),
+			v.Path.String(),
+			v.Private,
+			v.Public,
+			v.Comment,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	invalidFile, err := os.Create(invalidOut)
+	if err != nil {
+		return err
+	}
+	defer invalidFile.Close()
+
+	writer = NewJSONTestWriter(invalidFile)
+	if err := writer.WriteComment(invalidColumns); err != nil {
+		return err
+	}
+	for _, v := range bip32.InvalidVectors() {
+		err := writer.WriteTestCase([]interface{}{
+			v.Key,
+			v.Err.Error(),
+			v.Comment,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote %d vectors and %d invalid keys\n", len(vectors),
+		len(bip32.InvalidVectors()))
+	return nil
+}
+
+// checkFiles checks each vector of the vector file with bip32.CheckVector,
+// and that each key of the invalid key file is rejected with the listed
+// error. Either path may be empty to skip that file.
+func checkFiles(path, invalidPath string) error {
+	if path != "" {
+		rows, err := vectorfile.ReadStringRows(path, 5)
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			seed, err := hex.DecodeString(row[0])
+			if err != nil {
+				return fmt.Errorf("%v: %v", row[4], err)
+			}
+			keyPath, err := bip32.ParsePath(row[1])
+			if err != nil {
+				return fmt.Errorf("%v: %v", row[4], err)
+			}
+			err = bip32.CheckVector(bip32.Vector{
+				Seed:    seed,
+				Path:    keyPath,
+				Private: row[2],
+				Public:  row[3],
+			})
+			if err != nil {
+				return fmt.Errorf("%v: %v", row[4], err)
+			}
+		}
+		fmt.Printf("%d vectors OK\n", len(rows))
+	}
+
+	if invalidPath != "" {
+		rows, err := vectorfile.ReadStringRows(invalidPath, 3)
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			_, err := bip32.ParseKey(row[0])
+			if err == nil {
+				return fmt.Errorf("%v: %v accepted", row[2], row[0])
+			}
+			if err.Error() != row[1] {
+				return fmt.Errorf("%v: got %q, expected %q", row[2],
+					err, row[1])
+			}
+		}
+		fmt.Printf("%d invalid keys OK\n", len(rows))
+	}
+	return nil
+}
+
+// networks maps the names of the networks of the derivation package to them.
+var networks = map[string]derivation.Network{
+	derivation.Mainnet.Name: derivation.Mainnet,
+	derivation.Testnet.Name: derivation.Testnet,
+}
+
+// writeDerivationFile writes the vectors of the derivation package to out.
+func writeDerivationFile(out string) error {
+	file, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	vectors := derivation.Vectors()
+	writer := NewJSONTestWriter(file)
+	if err := writer.WriteComment(derivationColumns); err != nil {
+		return err
+	}
+	for _, v := range vectors {
+		err := writer.WriteTestCase([]interface{}{
+			hex.EncodeToString(v.Seed),
+			v.Net.Name,
+			v.Path.String(),
+			v.AccountKey,
+			v.Address,
+			v.Comment,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote %d addresses\n", len(vectors))
+	return nil
+}
+
+// checkDerivationFile checks each vector of the file with
+// derivation.CheckVector.
+func checkDerivationFile(path string) error {
+	rows, err := vectorfile.ReadStringRows(path, 6)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		seed, err := hex.DecodeString(row[0])
+		if err != nil {
+			return fmt.Errorf("%v: %v", row[5], err)
+		}
+		net, ok := networks[row[1]]
+		if !ok {
+			return fmt.Errorf("%v: unknown network %v", row[5], row[1])
+		}
+		addrPath, err := derivation.ParsePath(row[2])
+		if err != nil {
+			return fmt.Errorf("%v: %v", row[5], err)
+		}
+		err = derivation.CheckVector(derivation.Vector{
+			Seed:       seed,
+			Net:        net,
+			Path:       addrPath,
+			AccountKey: row[3],
+			Address:    row[4],
+		})
+		if err != nil {
+			return fmt.Errorf("%v: %v", row[5], err)
+		}
+	}
+	fmt.Printf("%d addresses OK\n", len(rows))
+	return nil
+}
@@ -0,0 +1,19 @@
+module github.com/christsim/bips/bip-0032
+
+go 1.21
+
+require (
+	github.com/btcsuite/btcd/btcec/v2 v2.3.4
+	github.com/christsim/bips/base58 v0.0.0
+	github.com/christsim/bips/bip-0173 v0.0.0
+	github.com/christsim/bips/internal v0.0.0
+	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9
+)
+
+require github.com/decred/dcrd/dcrec/secp256k1/v4 v4.0.1 // indirect
+
+replace (
+	github.com/christsim/bips/base58 => ../base58
+	github.com/christsim/bips/bip-0173 => ../bip-0173
+	github.com/christsim/bips/internal => ../internal
+)
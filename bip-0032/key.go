@@ -0,0 +1,315 @@
+package bip32
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/christsim/bips/base58"
+	"golang.org/x/crypto/ripemd160"
+)
+
+// masterKey is the HMAC-SHA512 key the master key is derived from a seed
+// with.
+var masterKey = []byte("Bitcoin seed")
+
+// ExtendedKey is a private or public key along with its chain code and its
+// position in the tree. ExtendedKeys are immutable; deriving and neutering
+// return new keys.
+type ExtendedKey struct {
+	net     Network
+	private bool
+
+	depth       uint8
+	parentFP    [4]byte
+	childNumber uint32
+	chainCode   [32]byte
+
+	// key is the 32 byte private key if private is set, and the 33 byte
+	// compressed public key otherwise.
+	key []byte
+}
+
+// NewMaster derives the master private key from a seed of between MinSeedLen
+// and MaxSeedLen bytes, which serializes with the network's versions.
+func NewMaster(seed []byte, net Network) (*ExtendedKey, error) {
+	if len(seed) < MinSeedLen || len(seed) > MaxSeedLen {
+		return nil, ErrInvalidSeedLen
+	}
+
+	mac := hmac.New(sha512.New, masterKey)
+	mac.Write(seed)
+	sum := mac.Sum(nil)
+
+	var k btcec.ModNScalar
+	if k.SetByteSlice(sum[:32]) || k.IsZero() {
+		return nil, ErrUnusableSeed
+	}
+
+	key := &ExtendedKey{
+		net:     net,
+		private: true,
+		key:     sum[:32],
+	}
+	copy(key.chainCode[:], sum[32:])
+	return key, nil
+}
+
+// IsPrivate returns whether the key is a private key.
+func (k *ExtendedKey) IsPrivate() bool {
+	return k.private
+}
+
+// Network returns the network whose versions the key serializes with.
+func (k *ExtendedKey) Network() Network {
+	return k.net
+}
+
+// Depth returns the number of derivations from the master key to the key.
+func (k *ExtendedKey) Depth() uint8 {
+	return k.depth
+}
+
+// ChildNumber returns the index the key was derived with from its parent, or
+// 0 for the master key.
+func (k *ExtendedKey) ChildNumber() uint32 {
+	return k.childNumber
+}
+
+// ParentFingerprint returns the fingerprint of the key's parent, or zeros
+// for the master key.
+func (k *ExtendedKey) ParentFingerprint() [4]byte {
+	return k.parentFP
+}
+
+// ChainCode returns the key's chain code.
+func (k *ExtendedKey) ChainCode() [32]byte {
+	return k.chainCode
+}
+
+// PrivateKey returns the 32 byte private key, or nil for a public key.
+func (k *ExtendedKey) PrivateKey() []byte {
+	if !k.private {
+		return nil
+	}
+	return append([]byte(nil), k.key...)
+}
+
+// PublicKey returns the 33 byte compressed public key.
+func (k *ExtendedKey) PublicKey() []byte {
+	if !k.private {
+		return append([]byte(nil), k.key...)
+	}
+	_, pub := btcec.PrivKeyFromBytes(k.key)
+	return pub.SerializeCompressed()
+}
+
+// Fingerprint returns the first 4 bytes of the hash160 of the key's public
+// key, which identify it as the parent of its children.
+func (k *ExtendedKey) Fingerprint() [4]byte {
+	sha := sha256.Sum256(k.PublicKey())
+	h := ripemd160.New()
+	h.Write(sha[:])
+
+	var fp [4]byte
+	copy(fp[:], h.Sum(nil))
+	return fp
+}
+
+// Neuter returns the public key of a private key, with the same chain code
+// and position in the tree. A public key is returned as is.
+func (k *ExtendedKey) Neuter() *ExtendedKey {
+	if !k.private {
+		return k
+	}
+	pub := *k
+	pub.private = false
+	pub.key = k.PublicKey()
+	return &pub
+}
+
+// Child derives the child with the passed index, with CKDpriv for a private
+// key and CKDpub for a public key. ErrInvalidChild is returned in the
+// unlikely case that the index gives an invalid key.
+func (k *ExtendedKey) Child(index uint32) (*ExtendedKey, error) {
+	if k.depth == MaxDepth {
+		return nil, ErrDepthTooBig
+	}
+	hardened := index >= HardenedKeyStart
+	if hardened && !k.private {
+		return nil, ErrDeriveHardFromPublic
+	}
+
+	// Hardened children are derived from the private key, padded to 33
+	// bytes, and the others from the public key.
+	data := make([]byte, 0, 37)
+	if hardened {
+		data = append(data, 0)
+		data = append(data, k.key...)
+	} else {
+		data = append(data, k.PublicKey()...)
+	}
+	data = binary.BigEndian.AppendUint32(data, index)
+
+	mac := hmac.New(sha512.New, k.chainCode[:])
+	mac.Write(data)
+	sum := mac.Sum(nil)
+
+	var tweak btcec.ModNScalar
+	if tweak.SetByteSlice(sum[:32]) {
+		return nil, ErrInvalidChild
+	}
+
+	var childKey []byte
+	if k.private {
+		var parent btcec.ModNScalar
+		parent.SetByteSlice(k.key)
+		tweak.Add(&parent)
+		if tweak.IsZero() {
+			return nil, ErrInvalidChild
+		}
+		b := tweak.Bytes()
+		childKey = b[:]
+	} else {
+		parent, err := btcec.ParsePubKey(k.key)
+		if err != nil {
+			return nil, err
+		}
+		var p, q, sum btcec.JacobianPoint
+		btcec.ScalarBaseMultNonConst(&tweak, &p)
+		parent.AsJacobian(&q)
+		btcec.AddNonConst(&p, &q, &sum)
+		if sum.Z.IsZero() {
+			return nil, ErrInvalidChild
+		}
+		sum.ToAffine()
+		childKey = btcec.NewPublicKey(&sum.X, &sum.Y).SerializeCompressed()
+	}
+
+	child := &ExtendedKey{
+		net:         k.net,
+		private:     k.private,
+		depth:       k.depth + 1,
+		parentFP:    k.Fingerprint(),
+		childNumber: index,
+		key:         childKey,
+	}
+	copy(child.chainCode[:], sum[32:])
+	return child, nil
+}
+
+// Derive derives the key at the path relative to the key, one child at a
+// time.
+func (k *ExtendedKey) Derive(path Path) (*ExtendedKey, error) {
+	key := k
+	for _, index := range path {
+		var err error
+		key, err = key.Child(index)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return key, nil
+}
+
+// Serialize returns the 78 byte serialization of the key, without the
+// checksum.
+func (k *ExtendedKey) Serialize() []byte {
+	buf := make([]byte, 0, serializedLen)
+	if k.private {
+		buf = append(buf, k.net.Private[:]...)
+	} else {
+		buf = append(buf, k.net.Public[:]...)
+	}
+	buf = append(buf, k.depth)
+	buf = append(buf, k.parentFP[:]...)
+	buf = binary.BigEndian.AppendUint32(buf, k.childNumber)
+	buf = append(buf, k.chainCode[:]...)
+	if k.private {
+		buf = append(buf, 0)
+	}
+	return append(buf, k.key...)
+}
+
+// String returns the Base58Check encoding of the key, such as an xprv or
+// xpub string on mainnet.
+func (k *ExtendedKey) String() string {
+	return base58.CheckEncode(k.Serialize())
+}
+
+// ParseKey parses a Base58Check encoded extended key of one of the known
+// networks, checking that its key is valid.
+func ParseKey(s string) (*ExtendedKey, error) {
+	data, err := base58.CheckDecode(s)
+	if err == base58.ErrChecksum {
+		return nil, ErrBadChecksum
+	}
+	if err != nil {
+		return nil, err
+	}
+	return Deserialize(data)
+}
+
+// Deserialize parses the 78 byte serialization of an extended key, without
+// the checksum.
+func Deserialize(data []byte) (*ExtendedKey, error) {
+	if len(data) != serializedLen {
+		return nil, ErrInvalidKeyLen
+	}
+
+	var version [4]byte
+	copy(version[:], data[:4])
+	net, private, err := lookupVersion(version)
+	if err != nil {
+		return nil, err
+	}
+
+	k := &ExtendedKey{
+		net:         net,
+		private:     private,
+		depth:       data[4],
+		childNumber: binary.BigEndian.Uint32(data[9:13]),
+	}
+	copy(k.parentFP[:], data[5:9])
+	copy(k.chainCode[:], data[13:45])
+	if k.depth == 0 && (k.parentFP != [4]byte{} || k.childNumber != 0) {
+		return nil, ErrInvalidMaster
+	}
+
+	keyData := data[45:]
+	if private {
+		var s btcec.ModNScalar
+		if keyData[0] != 0 || s.SetByteSlice(keyData[1:]) ||
+			s.IsZero() {
+
+			return nil, ErrInvalidPrivateKey
+		}
+		k.key = append([]byte(nil), keyData[1:]...)
+	} else {
+		if !btcec.IsCompressedPubKey(keyData) {
+			return nil, ErrInvalidPublicKey
+		}
+		if _, err := btcec.ParsePubKey(keyData); err != nil {
+			return nil, ErrInvalidPublicKey
+		}
+		k.key = append([]byte(nil), keyData...)
+	}
+	return k, nil
+}
+
+// Equal returns whether the keys serialize the same.
+func (k *ExtendedKey) Equal(other *ExtendedKey) bool {
+	return bytes.Equal(k.Serialize(), other.Serialize())
+}
+
+// WithNetwork returns the key serialized with the versions of another network,
+// such as the SLIP 132 versions that mark the script type of an account's
+// keys.
+func (k *ExtendedKey) WithNetwork(net Network) *ExtendedKey {
+	other := *k
+	other.net = net
+	return &other
+}
@@ -0,0 +1,74 @@
+package bip32
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Path is a sequence of child indexes, derived in order from a key.
+type Path []uint32
+
+// ParsePath parses a path such as m/44'/0'/0'/0/1. Hardened indexes are
+// marked with a trailing ', h or H, and the leading m/ is optional, so that
+// "0h/1" is the same path relative to any key. "m" on its own is the empty
+// path.
+func ParsePath(s string) (Path, error) {
+	s = strings.TrimSpace(s)
+	if s == "m" || s == "" {
+		return Path{}, nil
+	}
+	s = strings.TrimPrefix(s, "m/")
+
+	var path Path
+	for _, elem := range strings.Split(s, "/") {
+		hardened := false
+		if n := len(elem); n > 0 && strings.ContainsAny(elem[n-1:], "'hH") {
+			hardened = true
+			elem = elem[:n-1]
+		}
+		// Only plain decimal indexes are accepted, so that each path
+		// has a single spelling up to the hardened marker.
+		if elem == "" || elem[0] == '+' || elem[0] == '-' ||
+			(len(elem) > 1 && elem[0] == '0') {
+
+			return nil, ErrInvalidPath
+		}
+		index, err := strconv.ParseUint(elem, 10, 32)
+		if err != nil || index >= HardenedKeyStart {
+			return nil, ErrInvalidPath
+		}
+		if hardened {
+			index += HardenedKeyStart
+		}
+		path = append(path, uint32(index))
+	}
+	return path, nil
+}
+
+// MustParsePath is like ParsePath but panics if the path is invalid, for
+// paths known at compile time.
+func MustParsePath(s string) Path {
+	path, err := ParsePath(s)
+	if err != nil {
+		panic("bip32: invalid path " + strconv.Quote(s))
+	}
+	return path
+}
+
+// String returns the path from the master key, such as m/0'/1, with hardened
+// indexes marked with '.
+func (p Path) String() string {
+	var b strings.Builder
+	b.WriteString("m")
+	for _, index := range p {
+		b.WriteByte('/')
+		if index >= HardenedKeyStart {
+			b.WriteString(strconv.FormatUint(uint64(index-HardenedKeyStart),
+				10))
+			b.WriteByte('\'')
+		} else {
+			b.WriteString(strconv.FormatUint(uint64(index), 10))
+		}
+	}
+	return b.String()
+}
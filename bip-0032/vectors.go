@@ -0,0 +1,420 @@
+package bip32
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/rand"
+
+	"github.com/christsim/bips/base58"
+)
+
+// ErrVectorMismatch is returned by CheckVector when deriving a vector's key
+// doesn't give the expected result.
+var ErrVectorMismatch = errors.New("bip32: vector mismatch")
+
+// Vector is an extended key derived from a seed.
+type Vector struct {
+	// Seed is the seed the master key is derived from.
+	Seed []byte
+
+	// Path is the path of the key from the master key.
+	Path Path
+
+	// Private and Public are the serializations of the key and of its
+	// public key.
+	Private string
+	Public  string
+
+	// Comment describes what the vector exercises.
+	Comment string
+}
+
+// InvalidVector is a serialized extended key that ParseKey must reject.
+type InvalidVector struct {
+	// Key is the Base58Check encoded key.
+	Key string
+
+	// Err is the error ParseKey returns for the key.
+	Err error
+
+	// Comment describes what is wrong with the key.
+	Comment string
+}
+
+// specChain is a seed from the test vectors of the BIP, the path along which
+// keys are derived from it, and the serializations the BIP gives for each
+// key along the path, starting with the master key.
+type specChain struct {
+	seed    string
+	path    string
+	keys    []specKey
+	comment string
+}
+
+// specKey is the serialization of an extended private key and of its public
+// key.
+type specKey struct {
+	private string
+	public  string
+}
+
+// specChains are the test vectors of the BIP. The fourth covers hardened
+// derivation from private keys with leading zeros, which implementations
+// have been known to strip.
+var specChains = []specChain{
+	{
+		seed: "000102030405060708090a0b0c0d0e0f",
+		path: "m/0'/1/2'/2/1000000000",
+		keys: []specKey{
+			{
+				private: "xprv9s21ZrQH143K3QTDL4LXw2F7HEK3wJUD2nW2nRk4stbPy6cq3jPPqjiChkVvvNKmPGJxWUtg6LnF5kejMRNNU3TGtRBeJgk33yuGBxrMPHi",
+				public:  "xpub661MyMwAqRbcFtXgS5sYJABqqG9YLmC4Q1Rdap9gSE8NqtwybGhePY2gZ29ESFjqJoCu1Rupje8YtGqsefD265TMg7usUDFdp6W1EGMcet8",
+			},
+			{
+				private: "xprv9uHRZZhk6KAJC1avXpDAp4MDc3sQKNxDiPvvkX8Br5ngLNv1TxvUxt4cV1rGL5hj6KCesnDYUhd7oWgT11eZG7XnxHrnYeSvkzY7d2bhkJ7",
+				public:  "xpub68Gmy5EdvgibQVfPdqkBBCHxA5htiqg55crXYuXoQRKfDBFA1WEjWgP6LHhwBZeNK1VTsfTFUHCdrfp1bgwQ9xv5ski8PX9rL2dZXvgGDnw",
+			},
+			{
+				private: "xprv9wTYmMFdV23N2TdNG573QoEsfRrWKQgWeibmLntzniatZvR9BmLnvSxqu53Kw1UmYPxLgboyZQaXwTCg8MSY3H2EU4pWcQDnRnrVA1xe8fs",
+				public:  "xpub6ASuArnXKPbfEwhqN6e3mwBcDTgzisQN1wXN9BJcM47sSikHjJf3UFHKkNAWbWMiGj7Wf5uMash7SyYq527Hqck2AxYysAA7xmALppuCkwQ",
+			},
+			{
+				private: "xprv9z4pot5VBttmtdRTWfWQmoH1taj2axGVzFqSb8C9xaxKymcFzXBDptWmT7FwuEzG3ryjH4ktypQSAewRiNMjANTtpgP4mLTj34bhnZX7UiM",
+				public:  "xpub6D4BDPcP2GT577Vvch3R8wDkScZWzQzMMUm3PWbmWvVJrZwQY4VUNgqFJPMM3No2dFDFGTsxxpG5uJh7n7epu4trkrX7x7DogT5Uv6fcLW5",
+			},
+			{
+				private: "xprvA2JDeKCSNNZky6uBCviVfJSKyQ1mDYahRjijr5idH2WwLsEd4Hsb2Tyh8RfQMuPh7f7RtyzTtdrbdqqsunu5Mm3wDvUAKRHSC34sJ7in334",
+				public:  "xpub6FHa3pjLCk84BayeJxFW2SP4XRrFd1JYnxeLeU8EqN3vDfZmbqBqaGJAyiLjTAwm6ZLRQUMv1ZACTj37sR62cfN7fe5JnJ7dh8zL4fiyLHV",
+			},
+			{
+				private: "xprvA41z7zogVVwxVSgdKUHDy1SKmdb533PjDz7J6N6mV6uS3ze1ai8FHa8kmHScGpWmj4WggLyQjgPie1rFSruoUihUZREPSL39UNdE3BBDu76",
+				public:  "xpub6H1LXWLaKsWFhvm6RVpEL9P4KfRZSW7abD2ttkWP3SSQvnyA8FSVqNTEcYFgJS2UaFcxupHiYkro49S8yGasTvXEYBVPamhGW6cFJodrTHy",
+			},
+		},
+		comment: "Test vector 1",
+	},
+	{
+		seed: "fffcf9f6f3f0edeae7e4e1dedbd8d5d2cfccc9c6c3c0bdbab7b4" +
+			"b1aeaba8a5a29f9c999693908d8a8784817e7b7875726f6c69" +
+			"6663605d5a5754514e4b484542",
+		path: "m/0/2147483647'/1/2147483646'/2",
+		keys: []specKey{
+			{
+				private: "xprv9s21ZrQH143K31xYSDQpPDxsXRTUcvj2iNHm5NUtrGiGG5e2DtALGdso3pGz6ssrdK4PFmM8NSpSBHNqPqm55Qn3LqFtT2emdEXVYsCzC2U",
+				public:  "xpub661MyMwAqRbcFW31YEwpkMuc5THy2PSt5bDMsktWQcFF8syAmRUapSCGu8ED9W6oDMSgv6Zz8idoc4a6mr8BDzTJY47LJhkJ8UB7WEGuduB",
+			},
+			{
+				private: "xprv9vHkqa6EV4sPZHYqZznhT2NPtPCjKuDKGY38FBWLvgaDx45zo9WQRUT3dKYnjwih2yJD9mkrocEZXo1ex8G81dwSM1fwqWpWkeS3v86pgKt",
+				public:  "xpub69H7F5d8KSRgmmdJg2KhpAK8SR3DjMwAdkxj3ZuxV27CprR9LgpeyGmXUbC6wb7ERfvrnKZjXoUmmDznezpbZb7ap6r1D3tgFxHmwMkQTPH",
+			},
+			{
+				private: "xprv9wSp6B7kry3Vj9m1zSnLvN3xH8RdsPP1Mh7fAaR7aRLcQMKTR2vidYEeEg2mUCTAwCd6vnxVrcjfy2kRgVsFawNzmjuHc2YmYRmagcEPdU9",
+				public:  "xpub6ASAVgeehLbnwdqV6UKMHVzgqAG8Gr6riv3Fxxpj8ksbH9ebxaEyBLZ85ySDhKiLDBrQSARLq1uNRts8RuJiHjaDMBU4Zn9h8LZNnBC5y4a",
+			},
+			{
+				private: "xprv9zFnWC6h2cLgpmSA46vutJzBcfJ8yaJGg8cX1e5StJh45BBciYTRXSd25UEPVuesF9yog62tGAQtHjXajPPdbRCHuWS6T8XA2ECKADdw4Ef",
+				public:  "xpub6DF8uhdarytz3FWdA8TvFSvvAh8dP3283MY7p2V4SeE2wyWmG5mg5EwVvmdMVCQcoNJxGoWaU9DCWh89LojfZ537wTfunKau47EL2dhHKon",
+			},
+			{
+				private: "xprvA1RpRA33e1JQ7ifknakTFpgNXPmW2YvmhqLQYMmrj4xJXXWYpDPS3xz7iAxn8L39njGVyuoseXzU6rcxFLJ8HFsTjSyQbLYnMpCqE2VbFWc",
+				public:  "xpub6ERApfZwUNrhLCkDtcHTcxd75RbzS1ed54G1LkBUHQVHQKqhMkhgbmJbZRkrgZw4koxb5JaHWkY4ALHY2grBGRjaDMzQLcgJvLJuZZvRcEL",
+			},
+			{
+				private: "xprvA2nrNbFZABcdryreWet9Ea4LvTJcGsqrMzxHx98MMrotbir7yrKCEXw7nadnHM8Dq38EGfSh6dqA9QWTyefMLEcBYJUuekgW4BYPJcr9E7j",
+				public:  "xpub6FnCn6nSzZAw5Tw7cgR9bi15UV96gLZhjDstkXXxvCLsUXBGXPdSnLFbdpq8p9HmGsApME5hQTZ3emM2rnY5agb9rXpVGyy3bdW6EEgAtqt",
+			},
+		},
+		comment: "Test vector 2",
+	},
+	{
+		seed: "4b381541583be4423346c643850da4b320e46a87ae3d2a4e6da1" +
+			"1eba819cd4acba45d239319ac14f863b8d5ab5a0d0c64d2e8a" +
+			"1e7d1457df2e5a3c51c73235be",
+		path: "m/0'",
+		keys: []specKey{
+			{
+				private: "xprv9s21ZrQH143K25QhxbucbDDuQ4naNntJRi4KUfWT7xo4EKsHt2QJDu7KXp1A3u7Bi1j8ph3EGsZ9Xvz9dGuVrtHHs7pXeTzjuxBrCmmhgC6",
+				public:  "xpub661MyMwAqRbcEZVB4dScxMAdx6d4nFc9nvyvH3v4gJL378CSRZiYmhRoP7mBy6gSPSCYk6SzXPTf3ND1cZAceL7SfJ1Z3GC8vBgp2epUt13",
+			},
+			{
+				private: "xprv9uPDJpEQgRQfDcW7BkF7eTya6RPxXeJCqCJGHuCJ4GiRVLzkTXBAJMu2qaMWPrS7AANYqdq6vcBcBUdJCVVFceUvJFjaPdGZ2y9WACViL4L",
+				public:  "xpub68NZiKmJWnxxS6aaHmn81bvJeTESw724CRDs6HbuccFQN9Ku14VQrADWgqbhhTHBaohPX4CjNLf9fq9MYo6oDaPPLPxSb7gwQN3ih19Zm4Y",
+			},
+		},
+		comment: "Test vector 3, retention of leading zeros",
+	},
+	{
+		seed: "3ddd5602285899a946114506157c7997e5444528f3003f613471" +
+			"2147db19b678",
+		path: "m/0'/1'",
+		keys: []specKey{
+			{
+				private: "xprv9s21ZrQH143K48vGoLGRPxgo2JNkJ3J3fqkirQC2zVdk5Dgd5w14S7fRDyHH4dWNHUgkvsvNDCkvAwcSHNAQwhwgNMgZhLtQC63zxwhQmRv",
+				public:  "xpub661MyMwAqRbcGczjuMoRm6dXaLDEhW1u34gKenbeYqAix21mdUKJyuyu5F1rzYGVxyL6tmgBUAEPrEz92mBXjByMRiJdba9wpnN37RLLAXa",
+			},
+			{
+				private: "xprv9vB7xEWwNp9kh1wQRfCCQMnZUEG21LpbR9NPCNN1dwhiZkjjeGRnaALmPXCX7SgjFTiCTT6bXes17boXtjq3xLpcDjzEuGLQBM5ohqkao9G",
+				public:  "xpub69AUMk3qDBi3uW1sXgjCmVjJ2G6WQoYSnNHyzkmdCHEhSZ4tBok37xfFEqHd2AddP56Tqp4o56AePAgCjYdvpW2PU2jbUPFKsav5ut6Ch1m",
+			},
+			{
+				private: "xprv9xJocDuwtYCMNAo3Zw76WENQeAS6WGXQ55RCy7tDJ8oALr4FWkuVoHJeHVAcAqiZLE7Je3vZJHxspZdFHfnBEjHqU5hG1Jaj32dVoS6XLT1",
+				public:  "xpub6BJA1jSqiukeaesWfxe6sNK9CCGaujFFSJLomWHprUL9DePQ4JDkM5d88n49sMGJxrhpjazuXYWdMf17C9T5XnxkopaeS7jGk1GyyVziaMt",
+			},
+		},
+		comment: "Test vector 4, leading zeros in hardened derivation",
+	},
+}
+
+// Vectors returns the test vectors of the BIP, one for each key along the
+// path of each of its seeds, starting with the master key, with the
+// serializations the BIP gives for them.
+func Vectors() []Vector {
+	var vectors []Vector
+	for _, chain := range specChains {
+		seed, err := hex.DecodeString(chain.seed)
+		if err != nil {
+			panic(err)
+		}
+		path := MustParsePath(chain.path)
+		for i, key := range chain.keys {
+			vectors = append(vectors, Vector{
+				Seed:    seed,
+				Path:    path[:i],
+				Private: key.private,
+				Public:  key.public,
+				Comment: fmt.Sprintf("%v, chain %v",
+					chain.comment, path[:i]),
+			})
+		}
+	}
+	return vectors
+}
+
+// RandomVectors returns count vectors for random seeds and paths drawn from
+// a source seeded with rngSeed, so that the same arguments give the same
+// vectors. Seeds are of any length the BIP allows, paths are up to 8 deep
+// with a mix of hardened and non-hardened indexes, and keys alternate
+// between the mainnet and testnet versions.
+func RandomVectors(rngSeed int64, count int) ([]Vector, error) {
+	rng := rand.New(rand.NewSource(rngSeed))
+
+	vectors := make([]Vector, 0, count)
+	for len(vectors) < count {
+		seed := make([]byte, MinSeedLen+rng.Intn(MaxSeedLen-MinSeedLen+1))
+		rng.Read(seed)
+
+		path := make(Path, rng.Intn(9))
+		for i := range path {
+			path[i] = rng.Uint32()
+		}
+		net := Mainnet
+		if len(vectors)%2 == 1 {
+			net = Testnet
+		}
+
+		v, err := NewVector(seed, net, path)
+		switch {
+		case errors.Is(err, ErrUnusableSeed) ||
+			errors.Is(err, ErrInvalidChild):
+
+			// Too unlikely to ever happen, but not a failure.
+			continue
+		case err != nil:
+			return nil, err
+		}
+		v.Comment = fmt.Sprintf("Random %d byte seed, chain %v",
+			len(seed), path)
+		vectors = append(vectors, *v)
+	}
+	return vectors, nil
+}
+
+// NewVector derives the key at path from the master key of the seed, and
+// returns it as a vector without a comment.
+func NewVector(seed []byte, net Network, path Path) (*Vector, error) {
+	master, err := NewMaster(seed, net)
+	if err != nil {
+		return nil, err
+	}
+	key, err := master.Derive(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Vector{
+		Seed:    seed,
+		Path:    path,
+		Private: key.String(),
+		Public:  key.Neuter().String(),
+	}, nil
+}
+
+// CheckVector derives the vector's key from its seed and checks it against
+// the expected serializations. The public key is also derived from the
+// public key of its closest hardened ancestor with CKDpub, and both
+// serializations are parsed and reserialized, all of which must agree.
+func CheckVector(v Vector) error {
+	priv, err := ParseKey(v.Private)
+	if err != nil {
+		return fmt.Errorf("%v: %v", v.Private, err)
+	}
+	pub, err := ParseKey(v.Public)
+	if err != nil {
+		return fmt.Errorf("%v: %v", v.Public, err)
+	}
+	if priv.String() != v.Private || pub.String() != v.Public {
+		return fmt.Errorf("%w: reserialized key differs", ErrVectorMismatch)
+	}
+
+	master, err := NewMaster(v.Seed, priv.Network())
+	if err != nil {
+		return err
+	}
+	key, err := master.Derive(v.Path)
+	if err != nil {
+		return err
+	}
+	if key.String() != v.Private {
+		return fmt.Errorf("%w: derived %v, expected %v",
+			ErrVectorMismatch, key, v.Private)
+	}
+	if !key.Neuter().Equal(pub) {
+		return fmt.Errorf("%w: neutered %v, expected %v",
+			ErrVectorMismatch, key.Neuter(), v.Public)
+	}
+
+	// Derive the non-hardened tail of the path from a public key.
+	split := len(v.Path)
+	for split > 0 && v.Path[split-1] < HardenedKeyStart {
+		split--
+	}
+	ancestor, err := master.Derive(v.Path[:split])
+	if err != nil {
+		return err
+	}
+	pubKey, err := ancestor.Neuter().Derive(v.Path[split:])
+	if err != nil {
+		return err
+	}
+	if !pubKey.Equal(pub) {
+		return fmt.Errorf("%w: CKDpub gave %v, expected %v",
+			ErrVectorMismatch, pubKey, v.Public)
+	}
+	return nil
+}
+
+// InvalidVectors returns keys that ParseKey must reject, in the categories of
+// the invalid keys of the BIP: mismatched versions and keys, invalid private
+// and public keys, master keys with a parent, bad checksums and lengths. They
+// are made by corrupting the keys of the first test vector, so the same set
+// is returned on every call.
+func InvalidVectors() []InvalidVector {
+	vectors := Vectors()
+	master, err := ParseKey(vectors[0].Private)
+	if err != nil {
+		panic(err)
+	}
+	child, err := ParseKey(vectors[1].Private)
+	if err != nil {
+		panic(err)
+	}
+	masterPriv := master.Serialize()
+	masterPub := master.Neuter().Serialize()
+	childPub := child.Neuter().Serialize()
+
+	var invalid []InvalidVector
+	add := func(data []byte, keyErr error, comment string,
+		corrupt func(data []byte)) {
+
+		data = append([]byte(nil), data...)
+		corrupt(data)
+		invalid = append(invalid, InvalidVector{
+			Key:     base58.CheckEncode(data),
+			Err:     keyErr,
+			Comment: comment,
+		})
+	}
+
+	add(masterPub, ErrInvalidPublicKey, "Public version with a private key",
+		func(data []byte) {
+			copy(data[45:], masterPriv[45:])
+		})
+	add(masterPriv, ErrInvalidPrivateKey, "Private version with a public "+
+		"key", func(data []byte) {
+		copy(data[45:], masterPub[45:])
+	})
+	for _, prefix := range []byte{0x01, 0x04, 0x05} {
+		add(masterPub, ErrInvalidPublicKey, fmt.Sprintf("Public key "+
+			"with prefix %#02x", prefix), func(data []byte) {
+			data[45] = prefix
+		})
+	}
+	add(masterPub, ErrInvalidPublicKey, "Public key not on the curve",
+		func(data []byte) {
+			// x = 5 has no square root on secp256k1.
+			copy(data[46:], make([]byte, 32))
+			data[77] = 5
+		})
+	add(masterPriv, ErrInvalidPrivateKey, "Private key of zero",
+		func(data []byte) {
+			copy(data[46:], make([]byte, 32))
+		})
+	add(masterPriv, ErrInvalidPrivateKey, "Private key equal to the "+
+		"curve order", func(data []byte) {
+		n, _ := hex.DecodeString("fffffffffffffffffffffffffffffffe" +
+			"baaedce6af48a03bbfd25e8cd0364141")
+		copy(data[46:], n)
+	})
+	add(masterPriv, ErrInvalidPrivateKey, "Private key with a non-zero "+
+		"padding byte", func(data []byte) {
+		data[45] = 1
+	})
+	add(masterPriv, ErrUnknownVersion, "Unknown version",
+		func(data []byte) {
+			copy(data, []byte{0xde, 0xad, 0xbe, 0xef})
+		})
+	add(childPub, ErrInvalidMaster, "Depth 0 with a parent fingerprint",
+		func(data []byte) {
+			data[4] = 0
+			binary.BigEndian.PutUint32(data[9:], 0)
+		})
+	add(masterPub, ErrInvalidMaster, "Depth 0 with a child number",
+		func(data []byte) {
+			binary.BigEndian.PutUint32(data[9:], 1)
+		})
+
+	// Bad checksums and lengths can't be made by corrupting the payload.
+	key := []byte(vectors[0].Public)
+	last := bytes.IndexByte([]byte(base58.Alphabet()), key[len(key)-1])
+	key[len(key)-1] = base58.Alphabet()[(last+1)%58]
+	invalid = append(invalid, InvalidVector{
+		Key:     string(key),
+		Err:     ErrBadChecksum,
+		Comment: "Bad checksum",
+	})
+	invalid = append(invalid, InvalidVector{
+		Key:     base58.CheckEncode(masterPub[:serializedLen-1]),
+		Err:     ErrInvalidKeyLen,
+		Comment: "Truncated key",
+	})
+	invalid = append(invalid, InvalidVector{
+		Key:     base58.CheckEncode(append(masterPub, 0)),
+		Err:     ErrInvalidKeyLen,
+		Comment: "Key with trailing data",
+	})
+
+	return invalid
+}
+
+// CheckInvalidVector checks that ParseKey rejects the vector's key with the
+// expected error.
+func CheckInvalidVector(v InvalidVector) error {
+	_, err := ParseKey(v.Key)
+	if err != v.Err {
+		return fmt.Errorf("%w: %v gave %v, expected %v",
+			ErrVectorMismatch, v.Key, err, v.Err)
+	}
+	return nil
+}
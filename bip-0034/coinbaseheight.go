@@ -0,0 +1,168 @@
+// Package coinbaseheight implements the height in coinbase of BIP 34: blocks
+// of version 2 and above commit to their height by the first push of the
+// signature script of their coinbase, so that no two coinbase transactions,
+// and no two transactions spending them, have the same hash:
+//
+//	scriptSig := append(coinbaseheight.Encode(height), extraNonce...)
+//	height, err := coinbaseheight.Decode(scriptSig)
+//	err = coinbaseheight.CheckBlock(block, height, &chaincfg.MainNetParams)
+//
+// The height is pushed as a script number the way Bitcoin Core serializes
+// it, with OP_0 for the genesis block, OP_1 to OP_16 for the heights up to
+// 16, and the shortest little endian push with a sign bit for the others.
+// Any other encoding of the right height, such as a push padded with zero
+// bytes, doesn't commit to it.
+//
+// The rule only applies from the height BIP 34 activated at, the
+// BIP0034Height of the chain parameters of btcd, 227931 on mainnet and
+// 21111 on testnet3. The coinbase transactions of earlier blocks often
+// start with anything but their height, the genesis blocks with their
+// difficulty bits.
+package coinbaseheight
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// MinBlockVersion is the lowest version of the blocks that commit to their
+// height once BIP 34 is active.
+const MinBlockVersion = 2
+
+// maxHeightLen is the longest push of a height, that of the largest int32.
+const maxHeightLen = 4
+
+var (
+	// ErrEmptyScript is returned for a signature script with no height.
+	ErrEmptyScript = errors.New("coinbaseheight: empty signature script")
+
+	// ErrNotPush is returned for a signature script that doesn't start
+	// with a push of a number, or whose push is cut short.
+	ErrNotPush = errors.New("coinbaseheight: signature script doesn't " +
+		"start with a push")
+
+	// ErrHeightTooLong is returned for a push too long to be a height.
+	ErrHeightTooLong = errors.New("coinbaseheight: height too long")
+
+	// ErrNonMinimal is returned for a push of a height not encoded as
+	// Encode does.
+	ErrNonMinimal = errors.New("coinbaseheight: height not minimally " +
+		"encoded")
+
+	// ErrNegativeHeight is returned for a negative height.
+	ErrNegativeHeight = errors.New("coinbaseheight: negative height")
+
+	// ErrHeightMismatch is returned for a signature script that commits
+	// to a height other than that of its block.
+	ErrHeightMismatch = errors.New("coinbaseheight: height mismatch")
+
+	// ErrBadVersion is returned by CheckBlock for a block of a version
+	// below MinBlockVersion once BIP 34 is active.
+	ErrBadVersion = errors.New("coinbaseheight: block version too low")
+
+	// ErrNoCoinbase is returned by CheckBlock for a block without a
+	// coinbase transaction with an input.
+	ErrNoCoinbase = errors.New("coinbaseheight: block has no coinbase")
+)
+
+// Encode returns the push of the height that starts the signature script of
+// the coinbase transaction of its block.
+func Encode(height int32) []byte {
+	script, _ := txscript.NewScriptBuilder().
+		AddInt64(int64(height)).
+		Script()
+	return script
+}
+
+// Decode returns the height the signature script of a coinbase transaction
+// commits to, which must start with the height as Encode pushes it.
+func Decode(scriptSig []byte) (int32, error) {
+	if len(scriptSig) == 0 {
+		return 0, ErrEmptyScript
+	}
+
+	op := scriptSig[0]
+	switch {
+	case op == txscript.OP_0:
+		return 0, nil
+	case op >= txscript.OP_1 && op <= txscript.OP_16:
+		return int32(op-txscript.OP_1) + 1, nil
+	case op == txscript.OP_1NEGATE:
+		return 0, fmt.Errorf("%w: OP_1NEGATE", ErrNegativeHeight)
+	case op >= txscript.OP_PUSHDATA1 && op <= txscript.OP_PUSHDATA4:
+		return 0, fmt.Errorf("%w: pushed by opcode %#x", ErrNonMinimal,
+			op)
+	case op > txscript.OP_DATA_75:
+		return 0, fmt.Errorf("%w: opcode %#x", ErrNotPush, op)
+	case int(op) > len(scriptSig)-1:
+		return 0, fmt.Errorf("%w: push of %d bytes, %d left",
+			ErrNotPush, op, len(scriptSig)-1)
+	case op > maxHeightLen:
+		return 0, fmt.Errorf("%w: %d bytes", ErrHeightTooLong, op)
+	}
+
+	b := scriptSig[1 : 1+op]
+	last := b[len(b)-1]
+	var height int32
+	for i, c := range b {
+		height |= int32(c) << (8 * i)
+	}
+	if last&0x80 != 0 {
+		return 0, fmt.Errorf("%w: %x", ErrNegativeHeight, b)
+	}
+	if !bytes.HasPrefix(scriptSig, Encode(height)) {
+		return 0, fmt.Errorf("%w: %d pushed as %x", ErrNonMinimal,
+			height, scriptSig[:1+op])
+	}
+	return height, nil
+}
+
+// Check checks that the signature script of a coinbase transaction commits
+// to the height of its block.
+func Check(scriptSig []byte, height int32) error {
+	if height < 0 {
+		return fmt.Errorf("%w: %d", ErrNegativeHeight, height)
+	}
+	if bytes.HasPrefix(scriptSig, Encode(height)) {
+		return nil
+	}
+
+	committed, err := Decode(scriptSig)
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("%w: script commits to %d, block at %d",
+		ErrHeightMismatch, committed, height)
+}
+
+// Active reports whether BIP 34 applies to the block at the height on the
+// chain of the parameters.
+func Active(height int32, params *chaincfg.Params) bool {
+	return height >= params.BIP0034Height
+}
+
+// CheckBlock checks that the block at the height on the chain of the
+// parameters follows BIP 34, if it applies to it: that its version is at
+// least MinBlockVersion and its coinbase transaction commits to the height.
+func CheckBlock(block *wire.MsgBlock, height int32,
+	params *chaincfg.Params) error {
+
+	if !Active(height, params) {
+		return nil
+	}
+	if block.Header.Version < MinBlockVersion {
+		return fmt.Errorf("%w: version %d at height %d", ErrBadVersion,
+			block.Header.Version, height)
+	}
+	if len(block.Transactions) == 0 ||
+		len(block.Transactions[0].TxIn) == 0 {
+
+		return ErrNoCoinbase
+	}
+	return Check(block.Transactions[0].TxIn[0].SignatureScript, height)
+}
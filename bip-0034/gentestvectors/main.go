@@ -0,0 +1,297 @@
+// This program writes test vectors for the coinbaseheight package to
+// heights.json: the heights of each length of push and those BIP 34
+// activated at on mainnet and testnet3, committed to by the signature
+// scripts of the coinbase transactions of their blocks and checked against
+// those of the blocks before and after, heights encoded in every other way,
+// and random heights. The random vectors depend only on -seed and -count,
+// so they can be regenerated by anyone:
+//
+//	gentestvectors -count 50 -seed 34
+//
+// The file uses the layout of the BIP 158 vectors: a JSON array whose first
+// row names the columns, followed by one row per vector. Each vector is a
+// signature script, in hex, the height of its block, and the error checking
+// the script against the height gives, empty if it commits to it. Pass
+// -check to verify an existing file against the package, and against the
+// block validation of btcd, instead:
+//
+//	gentestvectors -check heights.json
+//
+// Pass -audit to check the blocks of a file of that layout whose columns
+// include "Block Height" and "Block", such as the BIP 158 vectors, against
+// BIP 34 on the chain of -net. The blocks below the activation height are
+// reported along with what their coinbase transactions commit to, and only
+// those above it fail the audit:
+//
+//	gentestvectors -audit ../bip-0158/testnet-20.json -net testnet3
+//
+// The program lives in a directory of its own since the coinbaseheight
+// package sits at the root of the module.
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/wire"
+	coinbaseheight "github.com/christsim/bips/bip-0034"
+	"github.com/christsim/bips/internal/vectorfile"
+)
+
+// heightColumns is the header row of the vector file.
+const heightColumns = "Script Sig,Height,Error,Comment"
+
+// nets are the chains -net names.
+var nets = map[string]*chaincfg.Params{
+	"mainnet":  &chaincfg.MainNetParams,
+	"testnet3": &chaincfg.TestNet3Params,
+	"regtest":  &chaincfg.RegressionNetParams,
+	"signet":   &chaincfg.SigNetParams,
+	"simnet":   &chaincfg.SimNetParams,
+}
+
+type JSONTestWriter struct {
+	writer          io.Writer
+	firstRowWritten bool
+}
+
+func NewJSONTestWriter(writer io.Writer) *JSONTestWriter {
+	return &JSONTestWriter{writer: writer}
+}
+
+func (w *JSONTestWriter) WriteComment(comment string) error {
+	return w.WriteTestCase([]interface{}{comment})
+}
+
+func (w *JSONTestWriter) WriteTestCase(row []interface{}) error {
+	var err error
+	if w.firstRowWritten {
+		_, err = io.WriteString(w.writer, ",\n")
+	} else {
+		_, err = io.WriteString(w.writer, "[\n")
+		w.firstRowWritten = true
+	}
+	if err != nil {
+		return err
+	}
+
+	rowBytes, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.writer.Write(rowBytes)
+	return err
+}
+
+func (w *JSONTestWriter) Close() error {
+	if !w.firstRowWritten {
+		return nil
+	}
+
+	_, err := io.WriteString(w.writer, "\n]\n")
+	return err
+}
+
+func main() {
+	out := flag.String("out", "heights.json", "file to write the vectors "+
+		"to")
+	count := flag.Int("count", 50, "number of random heights to write "+
+		"vectors of")
+	seed := flag.Int64("seed", 34, "seed of the random vectors")
+	check := flag.String("check", "", "vector file to check instead of "+
+		"writing one")
+	audit := flag.String("audit", "", "file of blocks to audit instead "+
+		"of writing vectors")
+	net := flag.String("net", "testnet3", "chain of the blocks to audit: "+
+		"mainnet, testnet3, regtest, signet or simnet")
+	flag.Parse()
+
+	var err error
+	switch {
+	case *check != "":
+		err = checkFile(*check)
+	case *audit != "":
+		params, ok := nets[*net]
+		if !ok {
+			err = fmt.Errorf("unknown net %q", *net)
+			break
+		}
+		err = auditFile(*audit, params)
+	default:
+		err = writeFile(*out, *seed, *count)
+	}
+	if err != nil {
+		fmt.Println("Error: ", err.Error())
+		os.Exit(1)
+	}
+}
+
+// writeFile writes the vectors, with count random ones, to out.
+func writeFile(out string, seed int64, count int) error {
+	file, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := NewJSONTestWriter(file)
+	if err := writer.WriteComment(heightColumns); err != nil {
+		return err
+	}
+	vectors := coinbaseheight.HeightVectors(seed, count)
+	for _, v := range vectors {
+		err := writer.WriteTestCase([]interface{}{
+			hex.EncodeToString(v.ScriptSig),
+			v.Height,
+			vectorfile.ErrorString(v.Err),
+			v.Comment,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote %d vectors\n", len(vectors))
+	return nil
+}
+
+// checkFile checks each vector of the file with
+// coinbaseheight.CheckHeightVector.
+func checkFile(path string) error {
+	rows, err := vectorfile.ReadRows(path, 4)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		var v coinbaseheight.HeightVector
+		var scriptSig, errMsg string
+		err := vectorfile.DecodeRow(row, &scriptSig, &v.Height, &errMsg,
+			&v.Comment)
+		if err != nil {
+			return err
+		}
+		v.ScriptSig, err = hex.DecodeString(scriptSig)
+		if err != nil {
+			return fmt.Errorf("%v: %v", v.Comment, err)
+		}
+		v.Err = vectorfile.ParseError(errMsg)
+		if err := coinbaseheight.CheckHeightVector(v); err != nil {
+			return fmt.Errorf("%v: %v", v.Comment, err)
+		}
+	}
+	fmt.Printf("%d vectors OK\n", len(rows))
+	return nil
+}
+
+// columnIndex returns the index of the named column of the header row.
+func columnIndex(header []string, name string) (int, error) {
+	for i, column := range header {
+		if column == name {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("no %q column", name)
+}
+
+// auditFile checks the blocks of the file against BIP 34 on the chain of
+// the parameters, reporting what the coinbase transactions of those it
+// doesn't apply to commit to.
+func auditFile(path string, params *chaincfg.Params) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var rows [][]json.RawMessage
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return err
+	}
+	if len(rows) == 0 || len(rows[0]) != 1 {
+		return errors.New("no header row")
+	}
+	var header string
+	if err := json.Unmarshal(rows[0][0], &header); err != nil {
+		return err
+	}
+	columns := strings.Split(header, ",")
+	heightColumn, err := columnIndex(columns, "Block Height")
+	if err != nil {
+		return err
+	}
+	blockColumn, err := columnIndex(columns, "Block")
+	if err != nil {
+		return err
+	}
+
+	var audited, active, failed int
+	for i, row := range rows[1:] {
+		if len(row) != len(columns) {
+			continue
+		}
+		var height int32
+		var blockHex string
+		err := json.Unmarshal(row[heightColumn], &height)
+		if err == nil {
+			err = json.Unmarshal(row[blockColumn], &blockHex)
+		}
+		var b []byte
+		if err == nil {
+			b, err = hex.DecodeString(blockHex)
+		}
+		block := &wire.MsgBlock{}
+		if err == nil {
+			err = block.Deserialize(bytes.NewReader(b))
+		}
+		if err != nil {
+			return fmt.Errorf("row %d: %v", i+1, err)
+		}
+
+		audited++
+		if !coinbaseheight.Active(height, params) {
+			fmt.Printf("Height %d: not active, %s\n", height,
+				commitment(block))
+			continue
+		}
+		active++
+		err = coinbaseheight.CheckBlock(block, height, params)
+		if err != nil {
+			failed++
+			fmt.Printf("Height %d: %v\n", height, err)
+			continue
+		}
+		fmt.Printf("Height %d: OK\n", height)
+	}
+
+	fmt.Printf("Audited %d blocks, %d under BIP 34\n", audited, active)
+	if failed > 0 {
+		return fmt.Errorf("%d blocks fail BIP 34", failed)
+	}
+	return nil
+}
+
+// commitment describes what the coinbase transaction of the block commits
+// to.
+func commitment(block *wire.MsgBlock) string {
+	if len(block.Transactions) == 0 ||
+		len(block.Transactions[0].TxIn) == 0 {
+
+		return "no coinbase"
+	}
+	scriptSig := block.Transactions[0].TxIn[0].SignatureScript
+	height, err := coinbaseheight.Decode(scriptSig)
+	if err != nil {
+		return fmt.Sprintf("commits to no height: %v", err)
+	}
+	return fmt.Sprintf("commits to height %d", height)
+}
@@ -0,0 +1,171 @@
+package coinbaseheight
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/christsim/bips/internal/vectorfile"
+)
+
+// ErrVectorMismatch is returned by CheckHeightVector when checking the
+// signature script of a vector, with the package or the block validation of
+// btcd, doesn't give the expected result.
+var ErrVectorMismatch = errors.New("coinbaseheight: vector mismatch")
+
+// HeightVector is the signature script of the coinbase transaction of a
+// block at the height, and the error checking it gives, nil if it commits to
+// the height.
+type HeightVector struct {
+	ScriptSig []byte
+	Height    int32
+
+	Err error
+
+	// Comment describes what the vector exercises.
+	Comment string
+}
+
+// newHeightVector returns the vector of the signature script and height.
+func newHeightVector(scriptSig []byte, height int32,
+	comment string) HeightVector {
+
+	return HeightVector{
+		ScriptSig: scriptSig,
+		Height:    height,
+		Err:       Check(scriptSig, height),
+		Comment:   comment,
+	}
+}
+
+// extraNonce is what follows the height in the signature scripts of the
+// vectors, as the extra nonce miners roll follows it in theirs.
+var extraNonce = []byte{0x04, 0xde, 0xad, 0xbe, 0xef}
+
+// HeightVectors returns vectors of the heights of each length of push, and
+// those of the activation of BIP 34 on mainnet and testnet3, committed to
+// by the signature scripts of their blocks, by those of the blocks before
+// and after, and encoded in every other way: by pushes padded, negative or
+// cut short, and by opcodes that aren't pushes. They are followed by count
+// random heights, committed to or off by one, derived from a math/rand
+// source with the seed.
+func HeightVectors(rngSeed int64, count int) []HeightVector {
+	var vectors []HeightVector
+	for _, c := range []struct {
+		height  int32
+		comment string
+	}{
+		{0, "Height 0"},
+		{1, "Height 1"},
+		{16, "Height 16"},
+		{17, "Height 17"},
+		{127, "Largest height of one byte"},
+		{128, "Height 128, sign byte needed"},
+		{255, "Height 255"},
+		{256, "Height 256"},
+		{32767, "Largest height of two bytes"},
+		{32768, "Height 32768, sign byte needed"},
+		{1<<23 - 1, "Largest height of three bytes"},
+		{1 << 23, "Height 8388608, sign byte needed"},
+		{1<<31 - 1, "Largest height"},
+		{21111, "Activation height on testnet3"},
+		{227931, "Activation height on mainnet"},
+	} {
+		scriptSig := append(Encode(c.height), extraNonce...)
+		vectors = append(vectors,
+			newHeightVector(scriptSig, c.height, c.comment),
+			newHeightVector(Encode(c.height), c.height,
+				c.comment+", nothing after"))
+		if c.height > 0 {
+			vectors = append(vectors, newHeightVector(scriptSig,
+				c.height-1, c.comment+", block before"))
+		}
+		if c.height < 1<<31-1 {
+			vectors = append(vectors, newHeightVector(scriptSig,
+				c.height+1, c.comment+", block after"))
+		}
+	}
+
+	for _, c := range []struct {
+		scriptSig []byte
+		height    int32
+		comment   string
+	}{
+		{nil, 0, "Empty script"},
+		{[]byte{0x01, 0x00}, 0, "Height 0 pushed as data"},
+		{[]byte{0x01, 0x01}, 1, "Height 1 pushed as data"},
+		{[]byte{0x01, 0x10}, 16, "Height 16 pushed as data"},
+		{[]byte{0x01, 0x11}, 17, "Height 17 pushed as data"},
+		{[]byte{0x02, 0x11, 0x00}, 17, "Height 17 padded to 2 bytes"},
+		{[]byte{0x04, 0x5b, 0x7a, 0x03, 0x00}, 227931,
+			"Mainnet activation height padded to 4 bytes"},
+		{[]byte{0x05, 0x5b, 0x7a, 0x03, 0x00, 0x00}, 227931,
+			"Mainnet activation height padded to 5 bytes"},
+		{[]byte{0x4c, 0x03, 0x5b, 0x7a, 0x03}, 227931,
+			"Mainnet activation height pushed by PUSHDATA1"},
+		{[]byte{0x01, 0x80}, 0, "Negative zero"},
+		{[]byte{0x01, 0x81}, 1, "Height -1"},
+		{[]byte{0x01, 0x80}, 128, "Height 128 without sign byte"},
+		{[]byte{txscript.OP_1NEGATE}, 0, "OP_1NEGATE"},
+		{[]byte{0x03, 0x5b, 0x7a}, 227931, "Push cut short"},
+		{[]byte{txscript.OP_DUP, 0x03, 0x5b, 0x7a, 0x03}, 227931,
+			"Not a push"},
+		{[]byte{0x04, 0xff, 0xff, 0x00, 0x1d}, 0,
+			"Genesis block of the difficulty bits"},
+		{[]byte{0x04, 0xff, 0xff, 0x00, 0x1d}, 486604799,
+			"Height of the difficulty bits"},
+		{[]byte{0x03, 0x5b, 0x7a, 0x03}, -1, "Negative block height"},
+	} {
+		vectors = append(vectors, newHeightVector(c.scriptSig,
+			c.height, c.comment))
+	}
+
+	rng := rand.New(rand.NewSource(rngSeed))
+	for n := 0; n < count; n++ {
+		height := int32(rng.Int63n(1 << uint(1+rng.Intn(31))))
+		scriptSig := append(Encode(height), extraNonce...)
+		blockHeight := height
+		if rng.Intn(4) == 0 && height > 0 {
+			blockHeight--
+		}
+		vectors = append(vectors, newHeightVector(scriptSig,
+			blockHeight, "Random"))
+	}
+	return vectors
+}
+
+// CheckHeightVector checks the signature script of the vector against its
+// height with Check, and with the block validation of btcd, which must
+// agree on whether it commits to it. For those that do, Decode must return
+// the height.
+func CheckHeightVector(v HeightVector) error {
+	err := Check(v.ScriptSig, v.Height)
+	if !vectorfile.SameError(err, v.Err) {
+		return fmt.Errorf("%w: error %v, expected %v",
+			ErrVectorMismatch, err, v.Err)
+	}
+	if v.Err == nil {
+		height, err := Decode(v.ScriptSig)
+		if err != nil || height != v.Height {
+			return fmt.Errorf("%w: decoded %d, error %v, expected "+
+				"%d", ErrVectorMismatch, height, err, v.Height)
+		}
+	}
+
+	if v.Height < 0 {
+		return nil
+	}
+	tx := wire.NewMsgTx(1)
+	tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: wire.MaxPrevOutIndex},
+		v.ScriptSig, nil))
+	err = blockchain.CheckSerializedHeight(btcutil.NewTx(tx), v.Height)
+	if (err == nil) != (v.Err == nil) {
+		return fmt.Errorf("%w: btcd gives error %v, expected %v",
+			ErrVectorMismatch, err, v.Err)
+	}
+	return nil
+}
@@ -0,0 +1,236 @@
+// Package bloom implements the connection bloom filters of BIP 37, which
+// SPV wallets load into a full node with filterload so that it relays only
+// the transactions matching them, and announces blocks as merkleblock
+// messages proving which of their transactions matched:
+//
+//	f := bloom.NewFilter(len(elements), 0.0001, tweak,
+//		wire.BloomUpdateP2PubkeyOnly)
+//	for _, element := range elements {
+//		f.Add(element)
+//	}
+//	msg := f.MsgFilterLoad()
+//
+// A filter of n elements and false positive rate p takes -n ln(p) / ln(2)^2
+// bits, at most 36,000 bytes, and ln(2) hash functions per bit per element,
+// at most 50. Hash function i is the 32 bit MurmurHash3 seeded with i times
+// 0xfba4c795 plus the tweak, which wallets randomize so that their filters
+// don't fingerprint them.
+//
+// A transaction matches a filter if its txid does, any data pushed by one of
+// its output scripts, any outpoint it spends or any data pushed by one of
+// its input scripts. The update flag of the filter tells whether matching an
+// output adds its outpoint, so that the transactions spending it match too:
+// always with wire.BloomUpdateAll, only for pay-to-pubkey and bare multisig
+// outputs with wire.BloomUpdateP2PubkeyOnly, and never with
+// wire.BloomUpdateNone.
+//
+// A merkleblock proves which transactions of a block matched with a partial
+// merkle tree, the branches of the merkle tree leading to them. ProveTxs
+// builds the merkleblock of any transactions, and ExtractMatches checks one
+// against the merkle root of its header, rejecting malformed trees and those
+// of two identical siblings, which CVE-2012-2459 abuses.
+package bloom
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+const (
+	// MaxFilterSize is the size of the largest filter, in bytes.
+	MaxFilterSize = wire.MaxFilterLoadFilterSize
+
+	// MaxHashFuncs is the largest number of hash functions of a filter.
+	MaxHashFuncs = wire.MaxFilterLoadHashFuncs
+
+	// seedStep is the step between the seeds of the hash functions.
+	seedStep = 0xfba4c795
+)
+
+var (
+	// ErrFilterTooBig is returned by LoadFilter for a filter larger than
+	// MaxFilterSize.
+	ErrFilterTooBig = errors.New("bloom: filter too big")
+
+	// ErrTooManyHashFuncs is returned by LoadFilter for a filter of more
+	// than MaxHashFuncs hash functions.
+	ErrTooManyHashFuncs = errors.New("bloom: too many hash functions")
+
+	// ErrUnknownFlags is returned by LoadFilter for a filter of an update
+	// flag BIP 37 doesn't define.
+	ErrUnknownFlags = errors.New("bloom: unknown update flags")
+)
+
+// Filter is a BIP 37 bloom filter.
+type Filter struct {
+	data      []byte
+	hashFuncs uint32
+	tweak     uint32
+	flags     wire.BloomUpdateType
+}
+
+// NewFilter returns an empty filter sized for the number of elements and
+// false positive rate as BIP 37 sizes it, with the tweak and update flags.
+func NewFilter(elements int, fpRate float64, tweak uint32,
+	flags wire.BloomUpdateType) *Filter {
+
+	if elements < 1 {
+		elements = 1
+	}
+
+	// The sizes truncate as those of BIP 37's reference implementation
+	// do, so that filters of the same parameters are the same.
+	bits := -float64(elements) * math.Log(fpRate) / (math.Ln2 * math.Ln2)
+	size := uint32(math.Min(bits, MaxFilterSize*8)) / 8
+	hashFuncs := float64(size*8/uint32(elements)) * math.Ln2
+	return &Filter{
+		data:      make([]byte, size),
+		hashFuncs: uint32(math.Min(hashFuncs, MaxHashFuncs)),
+		tweak:     tweak,
+		flags:     flags,
+	}
+}
+
+// LoadFilter returns the filter of a filterload message.
+func LoadFilter(msg *wire.MsgFilterLoad) (*Filter, error) {
+	if len(msg.Filter) > MaxFilterSize {
+		return nil, fmt.Errorf("%w: %d bytes", ErrFilterTooBig,
+			len(msg.Filter))
+	}
+	if msg.HashFuncs > MaxHashFuncs {
+		return nil, fmt.Errorf("%w: %d", ErrTooManyHashFuncs,
+			msg.HashFuncs)
+	}
+	if msg.Flags > wire.BloomUpdateP2PubkeyOnly {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownFlags, msg.Flags)
+	}
+	return &Filter{
+		data:      append([]byte{}, msg.Filter...),
+		hashFuncs: msg.HashFuncs,
+		tweak:     msg.Tweak,
+		flags:     msg.Flags,
+	}, nil
+}
+
+// MsgFilterLoad returns the filterload message loading the filter.
+func (f *Filter) MsgFilterLoad() *wire.MsgFilterLoad {
+	return wire.NewMsgFilterLoad(append([]byte{}, f.data...), f.hashFuncs,
+		f.tweak, f.flags)
+}
+
+// Size returns the size of the filter in bytes.
+func (f *Filter) Size() int {
+	return len(f.data)
+}
+
+// HashFuncs returns the number of hash functions of the filter.
+func (f *Filter) HashFuncs() uint32 {
+	return f.hashFuncs
+}
+
+// bit returns the index of the bit hash function i sets for the data.
+func (f *Filter) bit(i uint32, data []byte) uint32 {
+	return murmur3(i*seedStep+f.tweak, data) % uint32(len(f.data)*8)
+}
+
+// Add adds the data to the filter.
+func (f *Filter) Add(data []byte) {
+	if len(f.data) == 0 {
+		return
+	}
+	for i := uint32(0); i < f.hashFuncs; i++ {
+		bit := f.bit(i, data)
+		f.data[bit>>3] |= 1 << (bit & 7)
+	}
+}
+
+// Matches reports whether the filter matches the data.
+func (f *Filter) Matches(data []byte) bool {
+	if len(f.data) == 0 {
+		return false
+	}
+	for i := uint32(0); i < f.hashFuncs; i++ {
+		bit := f.bit(i, data)
+		if f.data[bit>>3]&(1<<(bit&7)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// outPointBytes returns the serialization of the outpoint the filter holds:
+// its txid in internal byte order followed by its index in little endian.
+func outPointBytes(op *wire.OutPoint) []byte {
+	b := make([]byte, len(op.Hash)+4)
+	copy(b, op.Hash[:])
+	binary.LittleEndian.PutUint32(b[len(op.Hash):], op.Index)
+	return b
+}
+
+// AddOutPoint adds the outpoint to the filter.
+func (f *Filter) AddOutPoint(op *wire.OutPoint) {
+	f.Add(outPointBytes(op))
+}
+
+// MatchesOutPoint reports whether the filter matches the outpoint.
+func (f *Filter) MatchesOutPoint(op *wire.OutPoint) bool {
+	return f.Matches(outPointBytes(op))
+}
+
+// matchesPushes reports whether the filter matches any data the script
+// pushes, up to any opcode that fails to parse.
+func (f *Filter) matchesPushes(script []byte) bool {
+	tokenizer := txscript.MakeScriptTokenizer(0, script)
+	for tokenizer.Next() {
+		data := tokenizer.Data()
+		if len(data) != 0 && f.Matches(data) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchTx reports whether the transaction matches the filter, adding the
+// outpoints of the outputs that match as the update flags of the filter
+// tell.
+func (f *Filter) MatchTx(tx *wire.MsgTx) bool {
+	txid := tx.TxHash()
+	matched := f.Matches(txid[:])
+
+	for i, txOut := range tx.TxOut {
+		if !f.matchesPushes(txOut.PkScript) {
+			continue
+		}
+		matched = true
+
+		switch f.flags {
+		case wire.BloomUpdateAll:
+			f.AddOutPoint(wire.NewOutPoint(&txid, uint32(i)))
+		case wire.BloomUpdateP2PubkeyOnly:
+			class := txscript.GetScriptClass(txOut.PkScript)
+			if class == txscript.PubKeyTy ||
+				class == txscript.MultiSigTy {
+
+				f.AddOutPoint(wire.NewOutPoint(&txid,
+					uint32(i)))
+			}
+		}
+	}
+	if matched {
+		return true
+	}
+
+	for _, txIn := range tx.TxIn {
+		if f.MatchesOutPoint(&txIn.PreviousOutPoint) ||
+			f.matchesPushes(txIn.SignatureScript) {
+
+			return true
+		}
+	}
+	return false
+}
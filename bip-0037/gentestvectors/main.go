@@ -0,0 +1,413 @@
+// This program writes test vectors for the bloom package: the filterload
+// payloads of the filters of the tests of BIP 37's reference implementation
+// and of random filters to filters.json, the merkleblocks the test blocks of
+// the BIP 158 vectors give for filters matching none, some or one of their
+// transactions to merkleblocks.json, and partial merkle tree proofs of
+// subsets of their transactions, followed by corrupted proofs that must be
+// rejected, to proofs.json. The blocks are read from a BIP 158 vector file,
+// so they needn't be fetched from a node again, and the vectors depend only
+// on the blocks, -seed and -count:
+//
+//	gentestvectors -blocks ../bip-0158/testnet-20.json -count 50 -seed 37
+//
+// The files use the layout of the BIP 158 vectors: a JSON array whose first
+// row names the columns, followed by one row per vector. Elements are given
+// as a comma separated list of hex, and indexes as a comma separated list
+// of decimal numbers. Pass -check to verify existing files against the
+// package instead:
+//
+//	gentestvectors -check filters.json \
+//		-check-merkleblocks merkleblocks.json -check-proofs proofs.json
+//
+// The program lives in a directory of its own since the bloom package sits
+// at the root of the module.
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcd/wire"
+	bloom "github.com/christsim/bips/bip-0037"
+	"github.com/christsim/bips/internal/vectorfile"
+)
+
+const (
+	// vectorColumns, merkleBlockColumns and proofColumns are the header
+	// rows of the vector files.
+	vectorColumns      = "Elements,FPRate,Tweak,Flags,FilterLoad,Comment"
+	merkleBlockColumns = "Block,FilterLoad,MerkleBlock,Matched,Comment"
+	proofColumns       = "Block,Matched,MerkleBlock,Error,Comment"
+)
+
+type JSONTestWriter struct {
+	writer          io.Writer
+	firstRowWritten bool
+}
+
+func NewJSONTestWriter(writer io.Writer) *JSONTestWriter {
+	return &JSONTestWriter{writer: writer}
+}
+
+func (w *JSONTestWriter) WriteComment(comment string) error {
+	return w.WriteTestCase([]interface{}{comment})
+}
+
+func (w *JSONTestWriter) WriteTestCase(row []interface{}) error {
+	var err error
+	if w.firstRowWritten {
+		_, err = io.WriteString(w.writer, ",\n")
+	} else {
+		_, err = io.WriteString(w.writer, "[\n")
+		w.firstRowWritten = true
+	}
+	if err != nil {
+		return err
+	}
+
+	rowBytes, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.writer.Write(rowBytes)
+	return err
+}
+
+func (w *JSONTestWriter) Close() error {
+	if !w.firstRowWritten {
+		return nil
+	}
+
+	_, err := io.WriteString(w.writer, "\n]\n")
+	return err
+}
+
+func main() {
+	blocks := flag.String("blocks",
+		vectorfile.RepoPath("bip-0158", "testnet-20.json"), "BIP 158 "+
+		"vector file to read the test blocks from")
+	out := flag.String("out", "filters.json", "file to write the filter "+
+		"vectors to")
+	merkleBlocksOut := flag.String("merkleblocks-out", "merkleblocks.json",
+		"file to write the merkleblock vectors to")
+	proofsOut := flag.String("proofs-out", "proofs.json", "file to write "+
+		"the proof vectors to")
+	count := flag.Int("count", 50, "number of random filters to write")
+	seed := flag.Int64("seed", 37, "seed of the random vectors")
+	check := flag.String("check", "", "filter vector file to check "+
+		"instead of writing one")
+	checkMerkleBlocks := flag.String("check-merkleblocks", "",
+		"merkleblock vector file to check instead of writing one")
+	checkProofs := flag.String("check-proofs", "", "proof vector file to "+
+		"check instead of writing one")
+	flag.Parse()
+
+	var err error
+	if *check != "" || *checkMerkleBlocks != "" || *checkProofs != "" {
+		err = checkFiles(*check, *checkMerkleBlocks, *checkProofs)
+	} else {
+		err = writeFiles(*out, *merkleBlocksOut, *proofsOut, *blocks,
+			*seed, *count)
+	}
+	if err != nil {
+		fmt.Println("Error: ", err.Error())
+		os.Exit(1)
+	}
+}
+
+// readBlocks reads the blocks of a BIP 158 vector file, whose rows start
+// with the height, hash and serialization of a block, and names each by its
+// height.
+func readBlocks(path string) ([]*wire.MsgBlock, []string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	var rows [][]json.RawMessage
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return nil, nil, err
+	}
+
+	var blocks []*wire.MsgBlock
+	var names []string
+	for i, row := range rows {
+		if len(row) == 1 {
+			continue
+		}
+		if len(row) < 3 {
+			return nil, nil, fmt.Errorf("row %d: no block", i)
+		}
+		var height uint32
+		var blockHex string
+		if err := json.Unmarshal(row[0], &height); err != nil {
+			return nil, nil, fmt.Errorf("row %d: %v", i, err)
+		}
+		if err := json.Unmarshal(row[2], &blockHex); err != nil {
+			return nil, nil, fmt.Errorf("row %d: %v", i, err)
+		}
+		b, err := hex.DecodeString(blockHex)
+		if err != nil {
+			return nil, nil, fmt.Errorf("row %d: %v", i, err)
+		}
+		block := &wire.MsgBlock{}
+		if err := block.Deserialize(bytes.NewReader(b)); err != nil {
+			return nil, nil, fmt.Errorf("row %d: %v", i, err)
+		}
+		blocks = append(blocks, block)
+		names = append(names, fmt.Sprintf("Block %d", height))
+	}
+	if len(blocks) == 0 {
+		return nil, nil, errors.New("no blocks in " + path)
+	}
+	return blocks, names, nil
+}
+
+// writeRows writes the header and rows to a new vector file at path.
+func writeRows(path, columns string, rows [][]interface{}) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := NewJSONTestWriter(file)
+	if err := writer.WriteComment(columns); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if err := writer.WriteTestCase(row); err != nil {
+			return err
+		}
+	}
+	return writer.Close()
+}
+
+// formatElements returns the elements as a comma separated list of hex.
+func formatElements(elements [][]byte) string {
+	hexes := make([]string, len(elements))
+	for i, element := range elements {
+		hexes[i] = hex.EncodeToString(element)
+	}
+	return strings.Join(hexes, ",")
+}
+
+// formatIndexes returns the indexes as a comma separated list.
+func formatIndexes(indexes []uint32) string {
+	var b []byte
+	for i, index := range indexes {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = strconv.AppendUint(b, uint64(index), 10)
+	}
+	return string(b)
+}
+
+// writeFiles writes the filter vectors to out, and the merkleblock and proof
+// vectors of the blocks of the BIP 158 vector file at blocksPath to
+// merkleBlocksOut and proofsOut.
+func writeFiles(out, merkleBlocksOut, proofsOut, blocksPath string,
+	seed int64, count int) error {
+
+	blocks, names, err := readBlocks(blocksPath)
+	if err != nil {
+		return err
+	}
+
+	var rows [][]interface{}
+	vectors := append(bloom.SpecVectors(),
+		bloom.RandomVectors(seed, count)...)
+	for _, v := range vectors {
+		rows = append(rows, []interface{}{
+			formatElements(v.Elements),
+			strconv.FormatFloat(v.FPRate, 'g', -1, 64),
+			strconv.FormatUint(uint64(v.Tweak), 10),
+			strconv.Itoa(int(v.Flags)),
+			hex.EncodeToString(v.FilterLoad),
+			v.Comment,
+		})
+	}
+	if err := writeRows(out, vectorColumns, rows); err != nil {
+		return err
+	}
+
+	rows = nil
+	merkleBlocks := bloom.MerkleBlockVectors(seed, blocks, names)
+	for _, v := range merkleBlocks {
+		rows = append(rows, []interface{}{
+			hex.EncodeToString(v.Block),
+			hex.EncodeToString(v.FilterLoad),
+			hex.EncodeToString(v.MerkleBlock),
+			formatIndexes(v.Matched),
+			v.Comment,
+		})
+	}
+	err = writeRows(merkleBlocksOut, merkleBlockColumns, rows)
+	if err != nil {
+		return err
+	}
+
+	rows = nil
+	proofs := bloom.ProofVectors(seed, blocks, names)
+	for _, v := range proofs {
+		rows = append(rows, []interface{}{
+			hex.EncodeToString(v.Block),
+			formatIndexes(v.Matched),
+			hex.EncodeToString(v.MerkleBlock),
+			vectorfile.ErrorString(v.Err),
+			v.Comment,
+		})
+	}
+	if err := writeRows(proofsOut, proofColumns, rows); err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote %d filters, %d merkleblocks and %d proofs of %d "+
+		"blocks\n", len(vectors), len(merkleBlocks), len(proofs),
+		len(blocks))
+	return nil
+}
+
+// decodeHex decodes the hex columns of a row.
+func decodeHex(columns ...string) ([][]byte, error) {
+	decoded := make([][]byte, len(columns))
+	for i, s := range columns {
+		b, err := hex.DecodeString(s)
+		if err != nil {
+			return nil, err
+		}
+		decoded[i] = b
+	}
+	return decoded, nil
+}
+
+// parseIndexes parses a comma separated list of indexes.
+func parseIndexes(s string) ([]uint32, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var indexes []uint32
+	for _, field := range strings.Split(s, ",") {
+		index, err := strconv.ParseUint(field, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		indexes = append(indexes, uint32(index))
+	}
+	return indexes, nil
+}
+
+// checkFiles checks each vector of the filter vector file with
+// bloom.CheckFilterVector, each vector of the merkleblock vector file with
+// bloom.CheckMerkleBlockVector, and each vector of the proof vector file
+// with bloom.CheckProofVector. Any path may be empty to skip that file.
+func checkFiles(path, merkleBlocksPath, proofsPath string) error {
+	var filters, merkleBlocks, proofs int
+	if path != "" {
+		rows, err := vectorfile.ReadStringRows(path, 6)
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			hexes := strings.Split(row[0], ",")
+			elements, err := decodeHex(hexes...)
+			if err != nil {
+				return fmt.Errorf("%v: %v", row[5], err)
+			}
+			fpRate, err := strconv.ParseFloat(row[1], 64)
+			if err != nil {
+				return fmt.Errorf("%v: %v", row[5], err)
+			}
+			tweak, err := strconv.ParseUint(row[2], 10, 32)
+			if err != nil {
+				return fmt.Errorf("%v: %v", row[5], err)
+			}
+			flags, err := strconv.ParseUint(row[3], 10, 8)
+			if err != nil {
+				return fmt.Errorf("%v: %v", row[5], err)
+			}
+			filterLoad, err := hex.DecodeString(row[4])
+			if err != nil {
+				return fmt.Errorf("%v: %v", row[5], err)
+			}
+			err = bloom.CheckFilterVector(bloom.FilterVector{
+				Elements:   elements,
+				FPRate:     fpRate,
+				Tweak:      uint32(tweak),
+				Flags:      wire.BloomUpdateType(flags),
+				FilterLoad: filterLoad,
+			})
+			if err != nil {
+				return fmt.Errorf("%v: %v", row[5], err)
+			}
+		}
+		filters = len(rows)
+	}
+
+	if merkleBlocksPath != "" {
+		rows, err := vectorfile.ReadStringRows(merkleBlocksPath, 5)
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			b, err := decodeHex(row[0], row[1], row[2])
+			if err != nil {
+				return fmt.Errorf("%v: %v", row[4], err)
+			}
+			matched, err := parseIndexes(row[3])
+			if err != nil {
+				return fmt.Errorf("%v: %v", row[4], err)
+			}
+			v := bloom.MerkleBlockVector{
+				Block:       b[0],
+				FilterLoad:  b[1],
+				MerkleBlock: b[2],
+				Matched:     matched,
+			}
+			if err := bloom.CheckMerkleBlockVector(v); err != nil {
+				return fmt.Errorf("%v: %v", row[4], err)
+			}
+		}
+		merkleBlocks = len(rows)
+	}
+
+	if proofsPath != "" {
+		rows, err := vectorfile.ReadStringRows(proofsPath, 5)
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			b, err := decodeHex(row[0], row[2])
+			if err != nil {
+				return fmt.Errorf("%v: %v", row[4], err)
+			}
+			matched, err := parseIndexes(row[1])
+			if err != nil {
+				return fmt.Errorf("%v: %v", row[4], err)
+			}
+			err = bloom.CheckProofVector(bloom.ProofVector{
+				Block:       b[0],
+				Matched:     matched,
+				MerkleBlock: b[1],
+				Err:         vectorfile.ParseError(row[3]),
+			})
+			if err != nil {
+				return fmt.Errorf("%v: %v", row[4], err)
+			}
+		}
+		proofs = len(rows)
+	}
+
+	fmt.Printf("%d filters, %d merkleblocks and %d proofs OK\n", filters,
+		merkleBlocks, proofs)
+	return nil
+}
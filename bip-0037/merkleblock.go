@@ -0,0 +1,269 @@
+package bloom
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// maxMerkleBlockTxs bounds the transactions of a merkleblock, those of the
+// smallest size filling a block.
+const maxMerkleBlockTxs = 4000000 / 240
+
+// ErrInvalidMerkleBlock is returned by ExtractMatches for a merkleblock
+// whose partial merkle tree is malformed or doesn't match the merkle root
+// of its header.
+var ErrInvalidMerkleBlock = errors.New("bloom: invalid merkleblock")
+
+// PartialMerkleTree is the partial merkle tree of a merkleblock, proving
+// which transactions of a block of Transactions transactions matched: the
+// hashes and flag bits of a depth first walk of the merkle tree, the bits
+// packed least significant first. A bit tells whether a matched transaction
+// descends from a node, and the hashes are those of the nodes with none, and
+// of the matched transactions.
+type PartialMerkleTree struct {
+	Transactions uint32
+	Hashes       []*chainhash.Hash
+	Flags        []byte
+}
+
+// partialTree builds and walks the partial merkle tree of a block of n
+// transactions.
+type partialTree struct {
+	n      uint32
+	txids  []chainhash.Hash
+	match  []bool
+	bits   []bool
+	hashes []*chainhash.Hash
+
+	// bitsUsed and hashesUsed count the bits and hashes walked.
+	bitsUsed     int
+	hashesUsed   int
+	matches      []uint32
+	matchedTxids []chainhash.Hash
+}
+
+// width returns the number of nodes at the height of the tree.
+func (t *partialTree) width(height uint) uint32 {
+	return (t.n + 1<<height - 1) >> height
+}
+
+// height returns the height of the root of the tree.
+func (t *partialTree) height() uint {
+	var height uint
+	for t.width(height) > 1 {
+		height++
+	}
+	return height
+}
+
+// parent returns the hash of the parent of the nodes.
+func parent(left, right *chainhash.Hash) chainhash.Hash {
+	var b [2 * chainhash.HashSize]byte
+	copy(b[:], left[:])
+	copy(b[chainhash.HashSize:], right[:])
+	return chainhash.DoubleHashH(b[:])
+}
+
+// hash returns the hash of the node at the height and position, whose last
+// node of a level pairs with itself.
+func (t *partialTree) hash(height uint, pos uint32) chainhash.Hash {
+	if height == 0 {
+		return t.txids[pos]
+	}
+	left := t.hash(height-1, pos*2)
+	right := left
+	if pos*2+1 < t.width(height-1) {
+		right = t.hash(height-1, pos*2+1)
+	}
+	return parent(&left, &right)
+}
+
+// build walks the tree depth first, adding the bits and hashes of the nodes.
+func (t *partialTree) build(height uint, pos uint32) {
+	ancestor := false
+	for i := pos << height; i < (pos+1)<<height && i < t.n; i++ {
+		ancestor = ancestor || t.match[i]
+	}
+	t.bits = append(t.bits, ancestor)
+	if height == 0 || !ancestor {
+		hash := t.hash(height, pos)
+		t.hashes = append(t.hashes, &hash)
+		return
+	}
+	t.build(height-1, pos*2)
+	if pos*2+1 < t.width(height-1) {
+		t.build(height-1, pos*2+1)
+	}
+}
+
+// extract walks the bits and hashes of the tree as build added them,
+// collecting the matched transactions, and returns the hash of the node.
+func (t *partialTree) extract(height uint, pos uint32) (chainhash.Hash,
+	error) {
+
+	if t.bitsUsed >= len(t.bits) {
+		return chainhash.Hash{}, fmt.Errorf("%w: too few flags",
+			ErrInvalidMerkleBlock)
+	}
+	ancestor := t.bits[t.bitsUsed]
+	t.bitsUsed++
+	if height == 0 || !ancestor {
+		if t.hashesUsed >= len(t.hashes) {
+			return chainhash.Hash{}, fmt.Errorf(
+				"%w: too few hashes", ErrInvalidMerkleBlock)
+		}
+		hash := *t.hashes[t.hashesUsed]
+		t.hashesUsed++
+		if height == 0 && ancestor {
+			t.matches = append(t.matches, pos)
+			t.matchedTxids = append(t.matchedTxids, hash)
+		}
+		return hash, nil
+	}
+
+	left, err := t.extract(height-1, pos*2)
+	if err != nil {
+		return left, err
+	}
+	right := left
+	if pos*2+1 < t.width(height-1) {
+		right, err = t.extract(height-1, pos*2+1)
+		if err != nil {
+			return right, err
+		}
+		// Identical siblings would let a tree of a different set of
+		// transactions share the root, as in CVE-2012-2459.
+		if right == left {
+			return right, fmt.Errorf("%w: identical siblings",
+				ErrInvalidMerkleBlock)
+		}
+	}
+	return parent(&left, &right), nil
+}
+
+// NewPartialMerkleTree returns the partial merkle tree of a block of the
+// txids proving the transactions at the matched indexes.
+func NewPartialMerkleTree(txids []chainhash.Hash,
+	matched []uint32) *PartialMerkleTree {
+
+	t := &partialTree{
+		n:     uint32(len(txids)),
+		txids: txids,
+		match: make([]bool, len(txids)),
+	}
+	for _, index := range matched {
+		if index < t.n {
+			t.match[index] = true
+		}
+	}
+	if t.n > 0 {
+		t.build(t.height(), 0)
+	}
+
+	tree := &PartialMerkleTree{
+		Transactions: t.n,
+		Hashes:       t.hashes,
+		Flags:        make([]byte, (len(t.bits)+7)/8),
+	}
+	for i, bit := range t.bits {
+		if bit {
+			tree.Flags[i/8] |= 1 << (i % 8)
+		}
+	}
+	return tree
+}
+
+// Extract walks the tree, checking that it is well formed, and returns the
+// merkle root it commits to along with the indexes and txids of the matched
+// transactions, in the order of the block.
+func (tree *PartialMerkleTree) Extract() (chainhash.Hash, []uint32,
+	[]chainhash.Hash, error) {
+
+	t := &partialTree{n: tree.Transactions, hashes: tree.Hashes}
+	var err error
+	switch {
+	case t.n == 0:
+		err = fmt.Errorf("%w: no transactions", ErrInvalidMerkleBlock)
+	case t.n > maxMerkleBlockTxs:
+		err = fmt.Errorf("%w: %d transactions", ErrInvalidMerkleBlock,
+			t.n)
+	case uint32(len(t.hashes)) > t.n:
+		err = fmt.Errorf("%w: more hashes than transactions",
+			ErrInvalidMerkleBlock)
+	case len(tree.Flags)*8 < len(t.hashes):
+		err = fmt.Errorf("%w: fewer flags than hashes",
+			ErrInvalidMerkleBlock)
+	}
+	if err != nil {
+		return chainhash.Hash{}, nil, nil, err
+	}
+	for i := 0; i < len(tree.Flags)*8; i++ {
+		t.bits = append(t.bits, tree.Flags[i/8]&(1<<(i%8)) != 0)
+	}
+
+	root, err := t.extract(t.height(), 0)
+	if err != nil {
+		return chainhash.Hash{}, nil, nil, err
+	}
+	if (t.bitsUsed+7)/8 != len(tree.Flags) ||
+		t.hashesUsed != len(t.hashes) {
+
+		return chainhash.Hash{}, nil, nil, fmt.Errorf(
+			"%w: unused flags or hashes", ErrInvalidMerkleBlock)
+	}
+	return root, t.matches, t.matchedTxids, nil
+}
+
+// NewMerkleBlock matches each transaction of the block against the filter,
+// updating it as its flags tell, and returns the merkleblock proving the
+// matches along with the indexes of the matched transactions.
+func NewMerkleBlock(block *wire.MsgBlock, f *Filter) (*wire.MsgMerkleBlock,
+	[]uint32) {
+
+	txids := make([]chainhash.Hash, len(block.Transactions))
+	var matched []uint32
+	for i, tx := range block.Transactions {
+		txids[i] = tx.TxHash()
+		if f.MatchTx(tx) {
+			matched = append(matched, uint32(i))
+		}
+	}
+	return ProveTxs(&block.Header, txids, matched), matched
+}
+
+// ProveTxs returns the merkleblock proving the transactions at the matched
+// indexes of a block of the header and txids.
+func ProveTxs(header *wire.BlockHeader, txids []chainhash.Hash,
+	matched []uint32) *wire.MsgMerkleBlock {
+
+	tree := NewPartialMerkleTree(txids, matched)
+	return &wire.MsgMerkleBlock{
+		Header:       *header,
+		Transactions: tree.Transactions,
+		Hashes:       tree.Hashes,
+		Flags:        tree.Flags,
+	}
+}
+
+// ExtractMatches checks the partial merkle tree of the merkleblock against
+// the merkle root of its header, and returns the txids of the matched
+// transactions in the order of the block.
+func ExtractMatches(msg *wire.MsgMerkleBlock) ([]chainhash.Hash, error) {
+	tree := &PartialMerkleTree{
+		Transactions: msg.Transactions,
+		Hashes:       msg.Hashes,
+		Flags:        msg.Flags,
+	}
+	root, _, txids, err := tree.Extract()
+	if err != nil {
+		return nil, err
+	}
+	if root != msg.Header.MerkleRoot {
+		return nil, fmt.Errorf("%w: merkle root %v, header has %v",
+			ErrInvalidMerkleBlock, root, msg.Header.MerkleRoot)
+	}
+	return txids, nil
+}
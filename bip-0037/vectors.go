@@ -0,0 +1,531 @@
+package bloom
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/rand"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/christsim/bips/internal/vectorfile"
+)
+
+// pver is the protocol version the payloads of the vectors are encoded at,
+// the first to know the messages of BIP 37.
+const pver = wire.BIP0037Version
+
+// ErrVectorMismatch is returned by the checks of vectors when building their
+// filters or merkleblocks doesn't give the expected payloads.
+var ErrVectorMismatch = errors.New("bloom: vector mismatch")
+
+// FilterVector is the filterload payload of a filter sized for the number of
+// elements and false positive rate, after adding the elements.
+type FilterVector struct {
+	Elements   [][]byte
+	FPRate     float64
+	Tweak      uint32
+	Flags      wire.BloomUpdateType
+	FilterLoad []byte
+
+	// Comment describes what the vector exercises.
+	Comment string
+}
+
+// MerkleBlockVector is the merkleblock payload a node serving a block sends
+// a peer that loaded a filter, and the indexes of the transactions of the
+// block that matched it.
+type MerkleBlockVector struct {
+	Block       []byte
+	FilterLoad  []byte
+	MerkleBlock []byte
+	Matched     []uint32
+
+	// Comment describes what the vector exercises.
+	Comment string
+}
+
+// encode returns the payload of the message.
+func encode(msg wire.Message) ([]byte, error) {
+	var b bytes.Buffer
+	if err := msg.BtcEncode(&b, pver, wire.BaseEncoding); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// decode reads the message from its payload.
+func decode(msg wire.Message, payload []byte) error {
+	return msg.BtcDecode(bytes.NewReader(payload), pver, wire.BaseEncoding)
+}
+
+// mustDecode decodes the hex of a spec vector.
+func mustDecode(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// newFilterVector returns the vector of the filter of the elements.
+func newFilterVector(elements [][]byte, fpRate float64, tweak uint32,
+	flags wire.BloomUpdateType, comment string) FilterVector {
+
+	f := NewFilter(len(elements), fpRate, tweak, flags)
+	for _, element := range elements {
+		f.Add(element)
+	}
+	filterLoad, err := encode(f.MsgFilterLoad())
+	if err != nil {
+		panic(err)
+	}
+	return FilterVector{
+		Elements:   elements,
+		FPRate:     fpRate,
+		Tweak:      tweak,
+		Flags:      flags,
+		FilterLoad: filterLoad,
+		Comment:    comment,
+	}
+}
+
+// SpecVectors returns the filters of the tests of BIP 37's reference
+// implementation.
+func SpecVectors() []FilterVector {
+	elements := [][]byte{
+		mustDecode("99108ad8ed9bb6274d3980bab5a85c048f0950c8"),
+		mustDecode("b5a2c786d9ef4658287ced5914b37a1b4aa32eee"),
+		mustDecode("b9300670b4c5366e95b2699e8b18bc75e5f729c5"),
+	}
+	key := [][]byte{
+		mustDecode("045b81f0017e2091e2edcd5eecf10d5bdd120a5514cb3" +
+			"ee65b8447ec18bfc4575c6d5bf415e54e03b1067934a0f0ba76b" +
+			"01c6b9ab227142ee1d543764b69d901e0"),
+		mustDecode("477abbacd4113f2e6b100526222eedd953c26a64"),
+	}
+	return []FilterVector{
+		newFilterVector(elements, 0.01, 0, wire.BloomUpdateAll,
+			"Three elements"),
+		newFilterVector(elements, 0.01, 2147483649,
+			wire.BloomUpdateAll, "Three elements, tweaked"),
+		newFilterVector(key, 0.001, 0, wire.BloomUpdateAll,
+			"Public key and its hash"),
+	}
+}
+
+// fpRates are the false positive rates of the random filters.
+var fpRates = []float64{0.1, 0.01, 0.001, 0.0001, 0.000001}
+
+// RandomVectors returns count filters derived from a math/rand source with
+// the seed, of up to 50 random elements of up to 80 bytes, a false positive
+// rate of fpRates, and random tweaks and update flags.
+func RandomVectors(rngSeed int64, count int) []FilterVector {
+	rng := rand.New(rand.NewSource(rngSeed))
+	var vectors []FilterVector
+	for n := 0; n < count; n++ {
+		elements := make([][]byte, 1+rng.Intn(50))
+		for i := range elements {
+			elements[i] = make([]byte, 1+rng.Intn(80))
+			rng.Read(elements[i])
+		}
+		fpRate := fpRates[rng.Intn(len(fpRates))]
+		tweak := rng.Uint32()
+		flags := wire.BloomUpdateType(rng.Intn(3))
+		vectors = append(vectors, newFilterVector(elements, fpRate,
+			tweak, flags, fmt.Sprintf("%d random elements",
+				len(elements))))
+	}
+	return vectors
+}
+
+// CheckFilterVector checks the filterload payload of the filter of the
+// vector, and that the loaded filter matches each element.
+func CheckFilterVector(v FilterVector) error {
+	got := newFilterVector(v.Elements, v.FPRate, v.Tweak, v.Flags, "")
+	if !bytes.Equal(got.FilterLoad, v.FilterLoad) {
+		return fmt.Errorf("%w: filterload %x, expected %x",
+			ErrVectorMismatch, got.FilterLoad, v.FilterLoad)
+	}
+
+	msg := &wire.MsgFilterLoad{}
+	if err := decode(msg, v.FilterLoad); err != nil {
+		return err
+	}
+	f, err := LoadFilter(msg)
+	if err != nil {
+		return err
+	}
+	for _, element := range v.Elements {
+		if !f.Matches(element) {
+			return fmt.Errorf("%w: element %x unmatched",
+				ErrVectorMismatch, element)
+		}
+	}
+	return nil
+}
+
+// firstPush returns the first data an output script of the transaction
+// pushes, or nil if none pushes any.
+func firstPush(tx *wire.MsgTx) []byte {
+	for _, txOut := range tx.TxOut {
+		tokenizer := txscript.MakeScriptTokenizer(0, txOut.PkScript)
+		for tokenizer.Next() {
+			if len(tokenizer.Data()) != 0 {
+				return tokenizer.Data()
+			}
+		}
+	}
+	return nil
+}
+
+// newMerkleBlockVector returns the vector of the merkleblock of the block
+// for a filter of the elements.
+func newMerkleBlockVector(block *wire.MsgBlock, elements [][]byte,
+	tweak uint32, flags wire.BloomUpdateType,
+	comment string) MerkleBlockVector {
+
+	f := NewFilter(len(elements), 0.0001, tweak, flags)
+	for _, element := range elements {
+		f.Add(element)
+	}
+	filterLoad, err := encode(f.MsgFilterLoad())
+	if err != nil {
+		panic(err)
+	}
+	var b bytes.Buffer
+	if err := block.Serialize(&b); err != nil {
+		panic(err)
+	}
+	msg, matched := NewMerkleBlock(block, f)
+	merkleBlock, err := encode(msg)
+	if err != nil {
+		panic(err)
+	}
+	return MerkleBlockVector{
+		Block:       b.Bytes(),
+		FilterLoad:  filterLoad,
+		MerkleBlock: merkleBlock,
+		Matched:     matched,
+		Comment:     comment,
+	}
+}
+
+// MerkleBlockVectors returns vectors of the merkleblocks of each block,
+// named by the entry of names, derived from a math/rand source with the
+// seed: for a filter of an element no transaction holds, for one of the
+// txids of a random subset of the transactions, and for one of the first
+// data an output script of a random transaction pushes, under each update
+// flag.
+func MerkleBlockVectors(rngSeed int64, blocks []*wire.MsgBlock,
+	names []string) []MerkleBlockVector {
+
+	rng := rand.New(rand.NewSource(rngSeed))
+	var vectors []MerkleBlockVector
+	for i, block := range blocks {
+		n := len(block.Transactions)
+		vectors = append(vectors, newMerkleBlockVector(block,
+			[][]byte{[]byte("nothing")}, rng.Uint32(),
+			wire.BloomUpdateNone, names[i]+", no matches"))
+
+		var txids [][]byte
+		for len(txids) == 0 {
+			for _, tx := range block.Transactions {
+				if rng.Intn(3) == 0 {
+					txid := tx.TxHash()
+					txids = append(txids, txid[:])
+				}
+			}
+		}
+		vectors = append(vectors, newMerkleBlockVector(block, txids,
+			rng.Uint32(), wire.BloomUpdateNone, fmt.Sprintf(
+				"%v, %d of %d txids", names[i], len(txids), n)))
+
+		j := rng.Intn(n)
+		push := firstPush(block.Transactions[j])
+		if push == nil {
+			continue
+		}
+		for _, flags := range []wire.BloomUpdateType{
+			wire.BloomUpdateNone, wire.BloomUpdateAll,
+			wire.BloomUpdateP2PubkeyOnly,
+		} {
+			comment := fmt.Sprintf("%v, output data of "+
+				"transaction %d, update flags %d", names[i], j,
+				flags)
+			vectors = append(vectors, newMerkleBlockVector(block,
+				[][]byte{push}, rng.Uint32(), flags, comment))
+		}
+	}
+	return vectors
+}
+
+// CheckMerkleBlockVector builds the merkleblock of the block of the vector
+// for its filter, checks its payload and the matched transactions, and that
+// extracting the matches from the payload gives their txids.
+func CheckMerkleBlockVector(v MerkleBlockVector) error {
+	block := &wire.MsgBlock{}
+	if err := block.Deserialize(bytes.NewReader(v.Block)); err != nil {
+		return err
+	}
+	filterLoad := &wire.MsgFilterLoad{}
+	if err := decode(filterLoad, v.FilterLoad); err != nil {
+		return err
+	}
+	f, err := LoadFilter(filterLoad)
+	if err != nil {
+		return err
+	}
+
+	msg, matched := NewMerkleBlock(block, f)
+	merkleBlock, err := encode(msg)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(merkleBlock, v.MerkleBlock) {
+		return fmt.Errorf("%w: merkleblock %x, expected %x",
+			ErrVectorMismatch, merkleBlock, v.MerkleBlock)
+	}
+	if fmt.Sprint(matched) != fmt.Sprint(v.Matched) {
+		return fmt.Errorf("%w: matched %v, expected %v",
+			ErrVectorMismatch, matched, v.Matched)
+	}
+
+	decoded := &wire.MsgMerkleBlock{}
+	if err := decode(decoded, v.MerkleBlock); err != nil {
+		return err
+	}
+	txids, err := ExtractMatches(decoded)
+	if err != nil {
+		return err
+	}
+	var want []chainhash.Hash
+	for _, index := range v.Matched {
+		want = append(want, block.Transactions[index].TxHash())
+	}
+	if fmt.Sprint(txids) != fmt.Sprint(want) {
+		return fmt.Errorf("%w: extracted %v, expected %v",
+			ErrVectorMismatch, txids, want)
+	}
+	return nil
+}
+
+// ProofVector is a merkleblock proving the transactions at the matched
+// indexes of a block, or one that extracting the matches from must reject.
+type ProofVector struct {
+	Block       []byte
+	Matched     []uint32
+	MerkleBlock []byte
+
+	// Err is the error extracting the matches from the merkleblock fails
+	// with, or nil if the merkleblock is the proof ProveTxs gives.
+	Err error
+
+	// Comment describes what the vector exercises.
+	Comment string
+}
+
+// blockTxids returns the txids of the transactions of the block.
+func blockTxids(block *wire.MsgBlock) []chainhash.Hash {
+	txids := make([]chainhash.Hash, len(block.Transactions))
+	for i, tx := range block.Transactions {
+		txids[i] = tx.TxHash()
+	}
+	return txids
+}
+
+// newProofVector returns the vector of the merkleblock, and of the error
+// extracting its matches fails with.
+func newProofVector(block *wire.MsgBlock, matched []uint32,
+	msg *wire.MsgMerkleBlock, comment string) ProofVector {
+
+	var b bytes.Buffer
+	if err := block.Serialize(&b); err != nil {
+		panic(err)
+	}
+	merkleBlock, err := encode(msg)
+	if err != nil {
+		panic(err)
+	}
+	_, err = ExtractMatches(msg)
+	return ProofVector{
+		Block:       b.Bytes(),
+		Matched:     matched,
+		MerkleBlock: merkleBlock,
+		Err:         err,
+		Comment:     comment,
+	}
+}
+
+// copyMerkleBlock returns a copy of the merkleblock whose hashes and flags
+// can be changed without changing those of msg.
+func copyMerkleBlock(msg *wire.MsgMerkleBlock) *wire.MsgMerkleBlock {
+	c := *msg
+	c.Hashes = nil
+	for _, hash := range msg.Hashes {
+		h := *hash
+		c.Hashes = append(c.Hashes, &h)
+	}
+	c.Flags = append([]byte{}, msg.Flags...)
+	return &c
+}
+
+// ProofVectors returns vectors of the merkleblocks of each block, named by
+// the entry of names, derived from a math/rand source with the seed:
+// proving none, each and all of the transactions and a random subset of
+// them, followed by corruptions of the proof of the subset that must be
+// rejected. Blocks of an odd number of transactions above one also give
+// the proof of all the transactions of the block with its last duplicated,
+// which shares its merkle root, as in CVE-2012-2459.
+func ProofVectors(rngSeed int64, blocks []*wire.MsgBlock,
+	names []string) []ProofVector {
+
+	rng := rand.New(rand.NewSource(rngSeed))
+	var vectors []ProofVector
+	for i, block := range blocks {
+		txids := blockTxids(block)
+		n := uint32(len(txids))
+		prove := func(matched []uint32,
+			comment string) *wire.MsgMerkleBlock {
+
+			msg := ProveTxs(&block.Header, txids, matched)
+			vectors = append(vectors, newProofVector(block, matched,
+				msg, comment))
+			return msg
+		}
+
+		prove(nil, names[i]+", no matches")
+		var all []uint32
+		for j := uint32(0); j < n; j++ {
+			all = append(all, j)
+			if n > 1 {
+				prove([]uint32{j}, fmt.Sprintf(
+					"%v, transaction %d", names[i], j))
+			}
+		}
+		prove(all, names[i]+", all transactions")
+
+		var subset []uint32
+		for j := uint32(0); j < n; j++ {
+			if rng.Intn(2) == 0 {
+				subset = append(subset, j)
+			}
+		}
+		if len(subset) == 0 {
+			subset = []uint32{uint32(rng.Intn(int(n)))}
+		}
+		msg := prove(subset, fmt.Sprintf("%v, %d of %d transactions",
+			names[i], len(subset), n))
+		vectors = append(vectors, corruptProofs(rng, block, subset,
+			msg, names[i])...)
+
+		if n > 1 && n%2 == 1 {
+			dup := *block
+			dup.Transactions = append(block.Transactions[:n:n],
+				block.Transactions[n-1])
+			var indexes []uint32
+			for j := uint32(0); j <= n; j++ {
+				indexes = append(indexes, j)
+			}
+			dupTxids := blockTxids(&dup)
+			msg := ProveTxs(&block.Header, dupTxids, indexes)
+			vectors = append(vectors, newProofVector(&dup, indexes,
+				msg, names[i]+", last transaction duplicated"))
+		}
+	}
+	return vectors
+}
+
+// corruptProofs returns vectors of corruptions of the merkleblock proving
+// the transactions at the matched indexes of the block. Corruptions that
+// happen to give another valid proof, such as clearing the flags of the
+// tree of a single transaction, are skipped.
+func corruptProofs(rng *rand.Rand, block *wire.MsgBlock, matched []uint32,
+	msg *wire.MsgMerkleBlock, name string) []ProofVector {
+
+	var vectors []ProofVector
+	corrupt := func(comment string, change func(*wire.MsgMerkleBlock)) {
+		c := copyMerkleBlock(msg)
+		change(c)
+		v := newProofVector(block, matched, c, name+", "+comment)
+		if v.Err != nil {
+			vectors = append(vectors, v)
+		}
+	}
+
+	corrupt("zero transactions", func(c *wire.MsgMerkleBlock) {
+		c.Transactions = 0
+	})
+	corrupt("one transaction too many", func(c *wire.MsgMerkleBlock) {
+		c.Transactions++
+	})
+	corrupt("hash flipped", func(c *wire.MsgMerkleBlock) {
+		j := rng.Intn(len(c.Hashes))
+		c.Hashes[j][rng.Intn(chainhash.HashSize)] ^= 1
+	})
+	corrupt("hash added", func(c *wire.MsgMerkleBlock) {
+		c.Hashes = append(c.Hashes, c.Hashes[len(c.Hashes)-1])
+	})
+	corrupt("hash removed", func(c *wire.MsgMerkleBlock) {
+		c.Hashes = c.Hashes[:len(c.Hashes)-1]
+	})
+	corrupt("flag byte added", func(c *wire.MsgMerkleBlock) {
+		c.Flags = append(c.Flags, 0)
+	})
+	corrupt("flags cleared", func(c *wire.MsgMerkleBlock) {
+		c.Flags = make([]byte, len(c.Flags))
+	})
+	corrupt("merkle root flipped", func(c *wire.MsgMerkleBlock) {
+		c.Header.MerkleRoot[0] ^= 1
+	})
+	return vectors
+}
+
+// CheckProofVector checks that extracting the matches from the merkleblock
+// of the vector gives the txids of the matched transactions of its block,
+// or fails with the expected error, and that ProveTxs gives the merkleblock
+// of those that don't.
+func CheckProofVector(v ProofVector) error {
+	block := &wire.MsgBlock{}
+	if err := block.Deserialize(bytes.NewReader(v.Block)); err != nil {
+		return err
+	}
+	txids := blockTxids(block)
+
+	msg := &wire.MsgMerkleBlock{}
+	if err := decode(msg, v.MerkleBlock); err != nil {
+		return err
+	}
+	extracted, err := ExtractMatches(msg)
+	if !vectorfile.SameError(err, v.Err) {
+		return fmt.Errorf("%w: error %v, expected %v",
+			ErrVectorMismatch, err, v.Err)
+	}
+	if v.Err != nil {
+		return nil
+	}
+
+	var want []chainhash.Hash
+	for _, index := range v.Matched {
+		if index >= uint32(len(txids)) {
+			return fmt.Errorf("%w: index %d of %d transactions",
+				ErrVectorMismatch, index, len(txids))
+		}
+		want = append(want, txids[index])
+	}
+	if fmt.Sprint(extracted) != fmt.Sprint(want) {
+		return fmt.Errorf("%w: extracted %v, expected %v",
+			ErrVectorMismatch, extracted, want)
+	}
+	merkleBlock, err := encode(ProveTxs(&block.Header, txids, v.Matched))
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(merkleBlock, v.MerkleBlock) {
+		return fmt.Errorf("%w: merkleblock %x, expected %x",
+			ErrVectorMismatch, merkleBlock, v.MerkleBlock)
+	}
+	return nil
+}
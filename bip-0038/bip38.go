@@ -0,0 +1,289 @@
+// Package bip38 implements the passphrase-protected private keys of BIP 38,
+// which paper wallets and physical coins print as 58 character strings
+// starting with 6P:
+//
+//	encrypted, err := bip38.Encrypt(key, true, passphrase, nil)
+//	wif, err := bip38.Decrypt(encrypted, passphrase, nil)
+//
+// Keys can be encrypted in two ways. Without EC multiplication, any known
+// private key is encrypted with AES-256 under a key stretched from the
+// passphrase with scrypt. With EC multiplication, the owner of the passphrase
+// hands an intermediate code to a printer, who generates new keys that only
+// the passphrase can decrypt, along with confirmation codes that let the
+// owner check the printed addresses depend on the passphrase without
+// decrypting anything.
+//
+// Both ways salt scrypt with a hash of the key's P2PKH address, which is also
+// how a wrong passphrase is detected. The scrypt parameters of the passphrase
+// can be lowered for tests by passing Params; nil means those of the BIP, and
+// keys encrypted with any others can't be decrypted by other software.
+package bip38
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/christsim/bips/base58"
+	"golang.org/x/crypto/ripemd160"
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Prefixes of the encoded records.
+var (
+	prefixNonEC        = []byte{0x01, 0x42}
+	prefixEC           = []byte{0x01, 0x43}
+	prefixConfirmation = []byte{0x64, 0x3b, 0xf6, 0xa8, 0x9a}
+)
+
+// Bits of the flag byte.
+const (
+	flagNonEC       = 0xc0
+	flagCompressed  = 0x20
+	flagLotSequence = 0x04
+)
+
+// recordLen is the length of an encrypted key record without its Base58Check
+// checksum.
+const recordLen = 39
+
+// addressHashLen is the length of the address hash salting scrypt.
+const addressHashLen = 4
+
+var (
+	// ErrInvalidLength is returned when decoding a record of the wrong
+	// length.
+	ErrInvalidLength = errors.New("bip38: invalid record length")
+
+	// ErrUnknownPrefix is returned when decoding a record that isn't an
+	// encrypted key, intermediate code or confirmation code.
+	ErrUnknownPrefix = errors.New("bip38: unknown prefix")
+
+	// ErrInvalidFlags is returned when decoding a record with reserved
+	// flag bits set, or flags that don't fit its kind.
+	ErrInvalidFlags = errors.New("bip38: invalid flags")
+
+	// ErrWrongPassphrase is returned when the address of a decrypted key
+	// doesn't match the address hash of the record.
+	ErrWrongPassphrase = errors.New("bip38: wrong passphrase")
+
+	// ErrInvalidKey is returned when encrypting a private key that isn't a
+	// 32 byte scalar below the curve order.
+	ErrInvalidKey = errors.New("bip38: invalid private key")
+)
+
+// Params are the cost parameters of scrypt, as passed to scrypt.Key.
+type Params struct {
+	N, R, P int
+}
+
+// DefaultParams are the parameters BIP 38 stretches passphrases with.
+var DefaultParams = &Params{N: 16384, R: 8, P: 8}
+
+// pointParams are the parameters the EC multiply mode stretches the
+// passpoint with, which the BIP doesn't let vary.
+var pointParams = &Params{N: 1024, R: 1, P: 1}
+
+// String returns the parameters as N:r:p.
+func (p *Params) String() string {
+	return fmt.Sprintf("%d:%d:%d", p.N, p.R, p.P)
+}
+
+// ParseParams parses parameters written as N:r:p.
+func ParseParams(s string) (*Params, error) {
+	var p Params
+	if _, err := fmt.Sscanf(s, "%d:%d:%d", &p.N, &p.R, &p.P); err != nil {
+		return nil, fmt.Errorf("bip38: invalid scrypt parameters %q", s)
+	}
+	return &p, nil
+}
+
+// orDefault returns the parameters, or DefaultParams if nil.
+func (p *Params) orDefault() *Params {
+	if p == nil {
+		return DefaultParams
+	}
+	return p
+}
+
+// stretch derives n bytes from the password and salt with scrypt.
+func stretch(password, salt []byte, params *Params, n int) ([]byte, error) {
+	return scrypt.Key(password, salt, params.N, params.R, params.P, n)
+}
+
+// normalize returns the passphrase in NFC, as the BIP stretches it.
+func normalize(passphrase string) []byte {
+	return []byte(norm.NFC.String(passphrase))
+}
+
+// doubleSHA256 returns SHA256(SHA256(data)).
+func doubleSHA256(data []byte) []byte {
+	first := sha256.Sum256(data)
+	second := sha256.Sum256(first[:])
+	return second[:]
+}
+
+// Address returns the mainnet P2PKH address of the public key, serialized
+// compressed or not.
+func Address(pubKey *btcec.PublicKey, compressed bool) string {
+	var serialized []byte
+	if compressed {
+		serialized = pubKey.SerializeCompressed()
+	} else {
+		serialized = pubKey.SerializeUncompressed()
+	}
+	sha := sha256.Sum256(serialized)
+	h := ripemd160.New()
+	h.Write(sha[:])
+	return base58.CheckEncode(append([]byte{0x00}, h.Sum(nil)...))
+}
+
+// addressHash returns the first 4 bytes of the double SHA-256 of the
+// address, which salts scrypt and checks the passphrase.
+func addressHash(address string) []byte {
+	return doubleSHA256([]byte(address))[:addressHashLen]
+}
+
+// aesBlock encrypts or decrypts a 16 byte block XORed before encryption or
+// after decryption with mask, as BIP 38 uses AES-256 without a mode.
+func aesBlock(key, block, mask []byte, decrypt bool) []byte {
+	cipher, err := aes.NewCipher(key)
+	if err != nil {
+		panic(err)
+	}
+	out := make([]byte, aes.BlockSize)
+	if decrypt {
+		cipher.Decrypt(out, block)
+		xorInto(out, mask)
+	} else {
+		in := append([]byte(nil), block...)
+		xorInto(in, mask)
+		cipher.Encrypt(out, in)
+	}
+	return out
+}
+
+// xorInto XORs mask into dst.
+func xorInto(dst, mask []byte) {
+	for i := range dst {
+		dst[i] ^= mask[i]
+	}
+}
+
+// parseScalar parses a private key or factor, which must be a valid scalar.
+func parseScalar(b []byte) (*btcec.ModNScalar, error) {
+	var k btcec.ModNScalar
+	if len(b) != 32 || k.SetByteSlice(b) || k.IsZero() {
+		return nil, ErrInvalidKey
+	}
+	return &k, nil
+}
+
+// decodeRecord decodes a Base58Check record of the length, which must start
+// with one of the prefixes, and returns the record with the index of the
+// prefix it starts with.
+func decodeRecord(s string, length int, prefixes ...[]byte) ([]byte, int,
+	error) {
+
+	data, err := base58.CheckDecode(s)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(data) != length {
+		return nil, 0, ErrInvalidLength
+	}
+	for i, prefix := range prefixes {
+		if bytes.HasPrefix(data, prefix) {
+			return data, i, nil
+		}
+	}
+	return nil, 0, ErrUnknownPrefix
+}
+
+// Encrypt encrypts a 32 byte private key with the passphrase, without EC
+// multiplication. The key's address is formed from its compressed public key
+// if compressed is set.
+func Encrypt(key []byte, compressed bool, passphrase string,
+	params *Params) (string, error) {
+
+	if _, err := parseScalar(key); err != nil {
+		return "", err
+	}
+	_, pubKey := btcec.PrivKeyFromBytes(key)
+	hash := addressHash(Address(pubKey, compressed))
+	derived, err := stretch(normalize(passphrase), hash,
+		params.orDefault(), 64)
+	if err != nil {
+		return "", err
+	}
+
+	flags := byte(flagNonEC)
+	if compressed {
+		flags |= flagCompressed
+	}
+	record := append(append([]byte(nil), prefixNonEC...), flags)
+	record = append(record, hash...)
+	record = append(record, aesBlock(derived[32:], key[:16], derived[:16],
+		false)...)
+	record = append(record, aesBlock(derived[32:], key[16:],
+		derived[16:32], false)...)
+	return base58.CheckEncode(record), nil
+}
+
+// Decrypt decrypts a key encrypted in either mode with the passphrase, and
+// returns it as a mainnet WIF key, compressed as its address was formed.
+func Decrypt(encrypted, passphrase string, params *Params) (*base58.WIF,
+	error) {
+
+	record, kind, err := decodeRecord(encrypted, recordLen, prefixNonEC,
+		prefixEC)
+	if err != nil {
+		return nil, err
+	}
+
+	var key []byte
+	if kind == 0 {
+		key, err = decryptNonEC(record, passphrase, params.orDefault())
+	} else {
+		key, _, err = decryptEC(record, passphrase, params.orDefault())
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &base58.WIF{
+		Version:    base58.MainnetWIF,
+		Key:        key,
+		Compressed: record[2]&flagCompressed != 0,
+	}, nil
+}
+
+// decryptNonEC decrypts a record encrypted without EC multiplication.
+func decryptNonEC(record []byte, passphrase string, params *Params) ([]byte,
+	error) {
+
+	flags := record[2]
+	if flags&^flagCompressed != flagNonEC {
+		return nil, ErrInvalidFlags
+	}
+	hash := record[3:7]
+	derived, err := stretch(normalize(passphrase), hash, params, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	key := append(aesBlock(derived[32:], record[7:23], derived[:16], true),
+		aesBlock(derived[32:], record[23:39], derived[16:32], true)...)
+	if _, err := parseScalar(key); err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	_, pubKey := btcec.PrivKeyFromBytes(key)
+	address := Address(pubKey, flags&flagCompressed != 0)
+	if !bytes.Equal(addressHash(address), hash) {
+		return nil, ErrWrongPassphrase
+	}
+	return key, nil
+}
@@ -0,0 +1,361 @@
+package bip38
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/christsim/bips/base58"
+)
+
+// Magic bytes of intermediate codes, with and without lot and sequence
+// numbers.
+var (
+	magicLotSequence = []byte{0x2c, 0xe9, 0xb3, 0xe1, 0xff, 0x39, 0xe2, 0x51}
+	magicNoLot       = []byte{0x2c, 0xe9, 0xb3, 0xe1, 0xff, 0x39, 0xe2, 0x53}
+)
+
+const (
+	// intermediateLen and confirmationLen are the lengths of intermediate
+	// and confirmation codes without their Base58Check checksums.
+	intermediateLen = 49
+	confirmationLen = 51
+
+	// ownerEntropyLen is the length of the owner entropy, which is the
+	// owner salt followed by the lot and sequence numbers if there are
+	// any.
+	ownerEntropyLen = 8
+
+	// SeedLen is the length of the seed printers generate keys from.
+	SeedLen = 24
+)
+
+// Limits of lot and sequence numbers, which share 32 bits.
+const (
+	MaxLot      = 1<<20 - 1
+	MaxSequence = 1<<12 - 1
+)
+
+var (
+	// ErrInvalidLotSequence is returned for a lot number above MaxLot or a
+	// sequence number above MaxSequence.
+	ErrInvalidLotSequence = errors.New("bip38: invalid lot or sequence " +
+		"number")
+
+	// ErrInvalidSaltLen is returned for an owner salt other than 4 bytes
+	// with lot and sequence numbers, or 8 bytes without.
+	ErrInvalidSaltLen = errors.New("bip38: owner salt must be 4 bytes " +
+		"with lot and sequence numbers, 8 without")
+
+	// ErrInvalidSeedLen is returned for a seed other than SeedLen bytes.
+	ErrInvalidSeedLen = errors.New("bip38: seed must be 24 bytes")
+
+	// ErrInvalidPoint is returned for an intermediate or confirmation code
+	// whose point isn't on the curve.
+	ErrInvalidPoint = errors.New("bip38: invalid point")
+)
+
+// LotSequence are the lot and sequence numbers an intermediate code and the
+// keys generated from it carry.
+type LotSequence struct {
+	Lot      uint32
+	Sequence uint32
+}
+
+// String returns the numbers as lot/sequence, as the BIP prints them.
+func (ls *LotSequence) String() string {
+	return fmt.Sprintf("%d/%d", ls.Lot, ls.Sequence)
+}
+
+// ParseLotSequence parses lot and sequence numbers written as lot/sequence.
+func ParseLotSequence(s string) (*LotSequence, error) {
+	var ls LotSequence
+	_, err := fmt.Sscanf(s, "%d/%d", &ls.Lot, &ls.Sequence)
+	if err != nil || ls.Lot > MaxLot || ls.Sequence > MaxSequence {
+		return nil, ErrInvalidLotSequence
+	}
+	return &ls, nil
+}
+
+// bytes returns the numbers as the 4 bytes of lot * 4096 + sequence.
+func (ls *LotSequence) bytes() []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, ls.Lot<<12|ls.Sequence)
+	return b
+}
+
+// lotSequence returns the lot and sequence numbers in the owner entropy if
+// the flags say it has them, or nil.
+func lotSequence(flags byte, ownerEntropy []byte) *LotSequence {
+	if flags&flagLotSequence == 0 {
+		return nil
+	}
+	n := binary.BigEndian.Uint32(ownerEntropy[4:])
+	return &LotSequence{Lot: n >> 12, Sequence: n & MaxSequence}
+}
+
+// passFactor derives the passfactor of the passphrase and owner entropy, and
+// the passpoint it multiplies G into.
+func passFactor(passphrase string, ownerEntropy []byte, hasLotSequence bool,
+	params *Params) (*btcec.ModNScalar, *btcec.PublicKey, error) {
+
+	salt := ownerEntropy
+	if hasLotSequence {
+		salt = ownerEntropy[:4]
+	}
+	factor, err := stretch(normalize(passphrase), salt, params, 32)
+	if err != nil {
+		return nil, nil, err
+	}
+	if hasLotSequence {
+		factor = doubleSHA256(append(factor, ownerEntropy...))
+	}
+	k, err := parseScalar(factor)
+	if err != nil {
+		return nil, nil, err
+	}
+	_, passpoint := btcec.PrivKeyFromBytes(factor)
+	return k, passpoint, nil
+}
+
+// pointKey stretches the passpoint, salted with the address hash and owner
+// entropy, into the 64 bytes the seed and confirmation are encrypted with.
+func pointKey(passpoint *btcec.PublicKey, hash,
+	ownerEntropy []byte) ([]byte, error) {
+
+	salt := append(append([]byte(nil), hash...), ownerEntropy...)
+	return stretch(passpoint.SerializeCompressed(), salt, pointParams, 64)
+}
+
+// multiply returns the point multiplied by the scalar.
+func multiply(point *btcec.PublicKey, k *btcec.ModNScalar) *btcec.PublicKey {
+	var p, result btcec.JacobianPoint
+	point.AsJacobian(&p)
+	btcec.ScalarMultNonConst(k, &p, &result)
+	result.ToAffine()
+	return btcec.NewPublicKey(&result.X, &result.Y)
+}
+
+// IntermediateCode derives the intermediate code an owner hands to a printer
+// from the passphrase and a random owner salt: 4 bytes followed by the lot
+// and sequence numbers if ls isn't nil, or 8 bytes without them. The owner
+// salt must come from a secure random source.
+func IntermediateCode(passphrase string, ownerSalt []byte, ls *LotSequence,
+	params *Params) (string, error) {
+
+	magic, ownerEntropy := magicNoLot, ownerSalt
+	if ls != nil {
+		if ls.Lot > MaxLot || ls.Sequence > MaxSequence {
+			return "", ErrInvalidLotSequence
+		}
+		if len(ownerSalt) != 4 {
+			return "", ErrInvalidSaltLen
+		}
+		magic = magicLotSequence
+		ownerEntropy = append(append([]byte(nil), ownerSalt...),
+			ls.bytes()...)
+	} else if len(ownerSalt) != ownerEntropyLen {
+		return "", ErrInvalidSaltLen
+	}
+
+	_, passpoint, err := passFactor(passphrase, ownerEntropy, ls != nil,
+		params.orDefault())
+	if err != nil {
+		return "", err
+	}
+	code := append(append([]byte(nil), magic...), ownerEntropy...)
+	code = append(code, passpoint.SerializeCompressed()...)
+	return base58.CheckEncode(code), nil
+}
+
+// GeneratedKey is a key a printer generated from an intermediate code.
+type GeneratedKey struct {
+	// Encrypted is the encrypted key, which only the owner's passphrase
+	// decrypts.
+	Encrypted string
+
+	// Address is the P2PKH address of the key.
+	Address string
+
+	// Confirmation is the code that lets the owner check that the address
+	// depends on the passphrase.
+	Confirmation string
+}
+
+// EncryptIntermediate generates a new encrypted key from an intermediate code
+// and a random seed of SeedLen bytes, with its address formed from the
+// compressed public key if compressed is set. The seed must come from a
+// secure random source.
+func EncryptIntermediate(code string, seed []byte,
+	compressed bool) (*GeneratedKey, error) {
+
+	if len(seed) != SeedLen {
+		return nil, ErrInvalidSeedLen
+	}
+	data, kind, err := decodeRecord(code, intermediateLen,
+		magicLotSequence, magicNoLot)
+	if err != nil {
+		return nil, err
+	}
+	ownerEntropy := data[8:16]
+	passpoint, err := btcec.ParsePubKey(data[16:])
+	if err != nil {
+		return nil, ErrInvalidPoint
+	}
+
+	var flags byte
+	if compressed {
+		flags |= flagCompressed
+	}
+	if kind == 0 {
+		flags |= flagLotSequence
+	}
+
+	factorB, err := parseScalar(doubleSHA256(seed))
+	if err != nil {
+		return nil, err
+	}
+	address := Address(multiply(passpoint, factorB), compressed)
+	hash := addressHash(address)
+	derived, err := pointKey(passpoint, hash, ownerEntropy)
+	if err != nil {
+		return nil, err
+	}
+
+	part1 := aesBlock(derived[32:], seed[:16], derived[:16], false)
+	part2 := aesBlock(derived[32:], append(part1[8:16:16], seed[16:]...),
+		derived[16:32], false)
+	record := append(append([]byte(nil), prefixEC...), flags)
+	record = append(record, hash...)
+	record = append(record, ownerEntropy...)
+	record = append(record, part1[:8]...)
+	record = append(record, part2...)
+
+	// The confirmation code carries pointb = factorb * G, encrypted with
+	// the same key as the seed.
+	_, pointB := btcec.PrivKeyFromBytes(doubleSHA256(seed))
+	serialized := pointB.SerializeCompressed()
+	confirmation := append(append([]byte(nil), prefixConfirmation...),
+		flags)
+	confirmation = append(confirmation, hash...)
+	confirmation = append(confirmation, ownerEntropy...)
+	confirmation = append(confirmation, serialized[0]^derived[63]&1)
+	confirmation = append(confirmation, aesBlock(derived[32:],
+		serialized[1:17], derived[:16], false)...)
+	confirmation = append(confirmation, aesBlock(derived[32:],
+		serialized[17:33], derived[16:32], false)...)
+
+	return &GeneratedKey{
+		Encrypted:    base58.CheckEncode(record),
+		Address:      address,
+		Confirmation: base58.CheckEncode(confirmation),
+	}, nil
+}
+
+// checkECFlags checks the flags of an EC multiplied record.
+func checkECFlags(flags byte) error {
+	if flags&^(flagCompressed|flagLotSequence) != 0 {
+		return ErrInvalidFlags
+	}
+	return nil
+}
+
+// decryptEC decrypts a record encrypted with EC multiplication, and returns
+// the private key and the seed it was generated from.
+func decryptEC(record []byte, passphrase string, params *Params) ([]byte,
+	[]byte, error) {
+
+	flags := record[2]
+	if err := checkECFlags(flags); err != nil {
+		return nil, nil, err
+	}
+	hash, ownerEntropy := record[3:7], record[7:15]
+	passfactor, passpoint, err := passFactor(passphrase, ownerEntropy,
+		flags&flagLotSequence != 0, params)
+	if err != nil {
+		return nil, nil, err
+	}
+	derived, err := pointKey(passpoint, hash, ownerEntropy)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The second part holds the end of the first and of the seed.
+	part2 := aesBlock(derived[32:], record[23:39], derived[16:32], true)
+	part1 := append(append([]byte(nil), record[15:23]...), part2[:8]...)
+	seed := append(aesBlock(derived[32:], part1, derived[:16], true),
+		part2[8:]...)
+
+	factorB, err := parseScalar(doubleSHA256(seed))
+	if err != nil {
+		return nil, nil, ErrWrongPassphrase
+	}
+	var k btcec.ModNScalar
+	k.Mul2(passfactor, factorB)
+	key := k.Bytes()
+
+	_, pubKey := btcec.PrivKeyFromBytes(key[:])
+	if string(addressHash(Address(pubKey, flags&flagCompressed != 0))) !=
+		string(hash) {
+
+		return nil, nil, ErrWrongPassphrase
+	}
+	return key[:], seed, nil
+}
+
+// Confirmation is what checking a confirmation code tells the owner.
+type Confirmation struct {
+	// Address is the address the printer generated, which depends on
+	// the passphrase.
+	Address string
+
+	// LotSequence are the lot and sequence numbers of the key, or nil.
+	LotSequence *LotSequence
+}
+
+// Confirm checks a confirmation code against the passphrase, and returns the
+// address of the generated key it confirms.
+func Confirm(confirmation, passphrase string,
+	params *Params) (*Confirmation, error) {
+
+	data, _, err := decodeRecord(confirmation, confirmationLen,
+		prefixConfirmation)
+	if err != nil {
+		return nil, err
+	}
+	flags := data[5]
+	if err := checkECFlags(flags); err != nil {
+		return nil, err
+	}
+	hash, ownerEntropy, encrypted := data[6:10], data[10:18], data[18:]
+	passfactor, passpoint, err := passFactor(passphrase, ownerEntropy,
+		flags&flagLotSequence != 0, params.orDefault())
+	if err != nil {
+		return nil, err
+	}
+	derived, err := pointKey(passpoint, hash, ownerEntropy)
+	if err != nil {
+		return nil, err
+	}
+
+	serialized := []byte{encrypted[0] ^ derived[63]&1}
+	serialized = append(serialized, aesBlock(derived[32:], encrypted[1:17],
+		derived[:16], true)...)
+	serialized = append(serialized, aesBlock(derived[32:],
+		encrypted[17:33], derived[16:32], true)...)
+	pointB, err := btcec.ParsePubKey(serialized)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+
+	address := Address(multiply(pointB, passfactor),
+		flags&flagCompressed != 0)
+	if string(addressHash(address)) != string(hash) {
+		return nil, ErrWrongPassphrase
+	}
+	return &Confirmation{
+		Address:     address,
+		LotSequence: lotSequence(flags, ownerEntropy),
+	}, nil
+}
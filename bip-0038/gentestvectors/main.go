@@ -0,0 +1,204 @@
+// This program writes test vectors for the bip38 package to bip38.json: the
+// vectors of the BIP, followed by random keys encrypted with and without EC
+// multiplication. The random vectors depend only on -seed, -count and
+// -params, so they can be regenerated by anyone:
+//
+//	gentestvectors -count 20 -seed 38
+//
+// The scrypt parameters of the BIP make every vector take a noticeable
+// fraction of a second, so -params lowers them for vectors meant for quick
+// tests, written as N:r:p:
+//
+//	gentestvectors -count 1000 -params 16:1:1
+//
+// Each vector lists its parameters, and those of the BIP's vectors are always
+// the BIP's. The file uses the layout of the BIP 158 vectors: a JSON array
+// whose first row names the columns, followed by one row per vector. Pass
+// -check to verify an existing file against the package instead:
+//
+//	gentestvectors -check bip38.json
+//
+// The program lives in a directory of its own since the bip38 package sits at
+// the root of the module.
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	bip38 "github.com/christsim/bips/bip-0038"
+	"github.com/christsim/bips/internal/vectorfile"
+)
+
+// vectorColumns is the header row of the vector file.
+const vectorColumns = "Passphrase,Encrypted,Key,Compressed,Address," +
+	"IntermediateCode,Confirmation,LotSequence,Params,Comment"
+
+type JSONTestWriter struct {
+	writer          io.Writer
+	firstRowWritten bool
+}
+
+func NewJSONTestWriter(writer io.Writer) *JSONTestWriter {
+	return &JSONTestWriter{writer: writer}
+}
+
+func (w *JSONTestWriter) WriteComment(comment string) error {
+	return w.WriteTestCase([]interface{}{comment})
+}
+
+func (w *JSONTestWriter) WriteTestCase(row []interface{}) error {
+	var err error
+	if w.firstRowWritten {
+		_, err = io.WriteString(w.writer, ",\n")
+	} else {
+		_, err = io.WriteString(w.writer, "[\n")
+		w.firstRowWritten = true
+	}
+	if err != nil {
+		return err
+	}
+
+	rowBytes, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.writer.Write(rowBytes)
+	return err
+}
+
+func (w *JSONTestWriter) Close() error {
+	if !w.firstRowWritten {
+		return nil
+	}
+
+	_, err := io.WriteString(w.writer, "\n]\n")
+	return err
+}
+
+func main() {
+	out := flag.String("out", "bip38.json", "file to write the vectors to")
+	count := flag.Int("count", 20, "number of random vectors to write "+
+		"after those of the BIP")
+	seed := flag.Int64("seed", 38, "seed of the random vectors")
+	params := flag.String("params", bip38.DefaultParams.String(), "scrypt "+
+		"parameters of the random vectors, as N:r:p")
+	check := flag.String("check", "", "vector file to check instead of "+
+		"writing one")
+	flag.Parse()
+
+	var err error
+	if *check != "" {
+		err = checkFile(*check)
+	} else {
+		err = writeFile(*out, *seed, *count, *params)
+	}
+	if err != nil {
+		fmt.Println("Error: ", err.Error())
+		os.Exit(1)
+	}
+}
+
+// writeFile writes the vectors of the BIP and count random vectors with the
+// scrypt parameters to out.
+func writeFile(out string, seed int64, count int, params string) error {
+	p, err := bip38.ParseParams(params)
+	if err != nil {
+		return err
+	}
+	vectors := append(bip38.SpecVectors(),
+		bip38.RandomVectors(seed, count, p)...)
+
+	file, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := NewJSONTestWriter(file)
+	if err := writer.WriteComment(vectorColumns); err != nil {
+		return err
+	}
+	for _, v := range vectors {
+		lotSequence := ""
+		if v.LotSequence != nil {
+			lotSequence = v.LotSequence.String()
+		}
+		params := bip38.DefaultParams
+		if v.Params != nil {
+			params = v.Params
+		}
+		err := writer.WriteTestCase([]interface{}{
+			v.Passphrase,
+			v.Encrypted,
+			hex.EncodeToString(v.Key),
+			strconv.FormatBool(v.Compressed),
+			v.Address,
+			v.IntermediateCode,
+			v.Confirmation,
+			lotSequence,
+			params.String(),
+			v.Comment,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote %d vectors\n", len(vectors))
+	return nil
+}
+
+// checkFile checks each vector of the file with bip38.CheckVector.
+func checkFile(path string) error {
+	rows, err := vectorfile.ReadStringRows(path, 10)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		key, err := hex.DecodeString(row[2])
+		if err != nil {
+			return fmt.Errorf("%v: %v", row[9], err)
+		}
+		compressed, err := strconv.ParseBool(row[3])
+		if err != nil {
+			return fmt.Errorf("%v: %v", row[9], err)
+		}
+		var lotSequence *bip38.LotSequence
+		if row[7] != "" {
+			lotSequence, err = bip38.ParseLotSequence(row[7])
+			if err != nil {
+				return fmt.Errorf("%v: %v", row[9], err)
+			}
+		}
+		params, err := bip38.ParseParams(row[8])
+		if err != nil {
+			return fmt.Errorf("%v: %v", row[9], err)
+		}
+		err = bip38.CheckVector(bip38.Vector{
+			Passphrase:       row[0],
+			Encrypted:        row[1],
+			Key:              key,
+			Compressed:       compressed,
+			Address:          row[4],
+			IntermediateCode: row[5],
+			Confirmation:     row[6],
+			LotSequence:      lotSequence,
+			Params:           params,
+		})
+		if err != nil {
+			return fmt.Errorf("%v: %v", row[9], err)
+		}
+	}
+	fmt.Printf("%d vectors OK\n", len(rows))
+	return nil
+}
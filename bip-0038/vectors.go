@@ -0,0 +1,383 @@
+package bip38
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/christsim/bips/base58"
+)
+
+// ErrVectorMismatch is returned by CheckVector when encrypting, decrypting or
+// confirming a vector doesn't give the expected result.
+var ErrVectorMismatch = errors.New("bip38: vector mismatch")
+
+// Vector is a private key encrypted with a passphrase, in either mode.
+type Vector struct {
+	Passphrase string
+	Encrypted  string
+	Key        []byte
+	Compressed bool
+	Address    string
+
+	// IntermediateCode is the code the key was generated from, or empty
+	// for a key encrypted without EC multiplication.
+	IntermediateCode string
+
+	// Confirmation is the confirmation code of a key generated from an
+	// intermediate code, or empty if there is none.
+	Confirmation string
+
+	// LotSequence are the lot and sequence numbers of a key generated
+	// from an intermediate code that carries them, or nil.
+	LotSequence *LotSequence
+
+	// Params are the scrypt parameters of the passphrase, or nil for
+	// those of the BIP.
+	Params *Params
+
+	// Comment describes what the vector exercises.
+	Comment string
+}
+
+// specVector is one of the test vectors of the BIP.
+type specVector struct {
+	passphrase   string
+	encrypted    string
+	wif          string
+	address      string
+	code         string
+	confirmation string
+	lotSequence  *LotSequence
+	comment      string
+}
+
+var specVectors = []specVector{
+	{
+		passphrase: "TestingOneTwoThree",
+		encrypted:  "6PRVWUbkzzsbcVac2qwfssoUJAN1Xhrg6bNk8J7Nzm5H7kxEbn2Nh2ZoGg",
+		wif:        "5KN7MzqK5wt2TP1fQCYyHBtDrXdJuXbUzm4A9rKAteGu3Qi5CVR",
+		comment:    "No compression, no EC multiply, test 1",
+	},
+	{
+		passphrase: "Satoshi",
+		encrypted:  "6PRNFFkZc2NZ6dJqFfhRoFNMR9Lnyj7dYGrzdgXXVMXcxoKTePPX1dWByq",
+		wif:        "5HtasZ6ofTHP6HCwTqTkLDuLQisYPah7aUnSKfC7h4hMUVw2gi5",
+		comment:    "No compression, no EC multiply, test 2",
+	},
+	{
+		passphrase: "\u03D2\u0301\u0000\U00010400\U0001F4A9",
+		encrypted:  "6PRW5o9FLp4gJDDVqJQKJFTpMvdsSGJxMYHtHaQBF3ooa8mwD69bapcDQn",
+		wif:        "5Jajm8eQ22H3pGWLEVCXyvND8dQZhiQhoLJNKjYXk9roUFTMSZ4",
+		address:    "16ktGzmfrurhbhi6JGqsMWf7TyqK9HNAeF",
+		comment:    "No compression, no EC multiply, test 3",
+	},
+	{
+		passphrase: "TestingOneTwoThree",
+		encrypted:  "6PYNKZ1EAgYgmQfmNVamxyXVWHzK5s6DGhwP4J5o44cvXdoY7sRzhtpUeo",
+		wif:        "L44B5gGEpqEDRS9vVPz7QT35jcBG2r3CZwSwQ4fCewXAhAhqGVpP",
+		comment:    "Compression, no EC multiply, test 1",
+	},
+	{
+		passphrase: "Satoshi",
+		encrypted:  "6PYLtMnXvfG3oJde97zRyLYFZCYizPU5T3LwgdYJz1fRhh16bU7u6PPmY7",
+		wif:        "KwYgW8gcxj1JWJXhPSu4Fqwzfhp5Yfi42mdYmMa4XqK7NJxXUSK7",
+		comment:    "Compression, no EC multiply, test 2",
+	},
+	{
+		passphrase: "TestingOneTwoThree",
+		encrypted:  "6PfQu77ygVyJLZjfvMLyhLMQbYnu5uguoJJ4kMCLqWwPEdfpwANVS76gTX",
+		wif:        "5K4caxezwjGCGfnoPTZ8tMcJBLB7Jvyjv4xxeacadhq8nLisLR2",
+		address:    "1PE6TQi6HTVNz5DLwB1LcpMBALubfuN2z2",
+		code: "passphrasepxFy57B9v8HtUsszJYKReoNDV6VHjUSGt8EVJmux9n1J3Ltf1g" +
+			"RxyDGXqnf9qm",
+		comment: "EC multiply, no compression, no lot/sequence numbers, " +
+			"test 1",
+	},
+	{
+		passphrase: "Satoshi",
+		encrypted:  "6PfLGnQs6VZnrNpmVKfjotbnQuaJK4KZoPFrAjx1JMJUa1Ft8gnf5WxfKd",
+		wif:        "5KJ51SgxWaAYR13zd9ReMhJpwrcX47xTJh2D3fGPG9CM8vkv5sH",
+		address:    "1CqzrtZC6mXSAhoxtFwVjz8LtwLJjDYU3V",
+		code: "passphraseoRDGAXTWzbp72eVbtUDdn1rwpgPUGjNZEc6CGBo8i5EC1FPW8w" +
+			"cnLdq4ThKzAS",
+		comment: "EC multiply, no compression, no lot/sequence numbers, " +
+			"test 2",
+	},
+	{
+		passphrase: "MOLON LABE",
+		encrypted:  "6PgNBNNzDkKdhkT6uJntUXwwzQV8Rr2tZcbkDcuC9DZRsS6AtHts4Ypo1j",
+		wif:        "5JLdxTtcTHcfYcmJsNVy1v2PMDx432JPoYcBTVVRHpPaxUrdtf8",
+		address:    "1Jscj8ALrYu2y9TD8NrpvDBugPedmbj4Yh",
+		code: "passphraseaB8feaLQDENqCgr4gKZpmf4VoaT6qdjJNJiv7fsKvjqavcJxvu" +
+			"R1hy25aTu5sX",
+		confirmation: "cfrm38V8aXBn7JWA1ESmFMUn6erxeBGZGAxJPY4e36S9QWkzZKta" +
+			"VqLNMgnifETYw7BPwWC9aPD",
+		lotSequence: &LotSequence{Lot: 263183, Sequence: 1},
+		comment: "EC multiply, no compression, lot/sequence numbers, " +
+			"test 1",
+	},
+	{
+		passphrase: "ΜΟΛΩΝ ΛΑΒΕ",
+		encrypted:  "6PgGWtx25kUg8QWvwuJAgorN6k9FbE25rv5dMRwu5SKMnfpfVe5mar2ngH",
+		wif:        "5KMKKuUmAkiNbA3DazMQiLfDq47qs8MAEThm4yL8R2PhV1ov33D",
+		address:    "1Lurmih3KruL4xDB5FmHof38yawNtP9oGf",
+		code: "passphrased3z9rQJHSyBkNBwTRPkUGNVEVrUAcfAXDyRU1V28ie6hNFbqDw" +
+			"bFBvsTK7yWVK",
+		confirmation: "cfrm38V8G4qq2ywYEFfWLD5Cc6msj9UwsG2Mj4Z6QdGJAFQpdatZ" +
+			"LavkgRd1i4iBMdRngDqDs51",
+		lotSequence: &LotSequence{Lot: 806938, Sequence: 1},
+		comment: "EC multiply, no compression, lot/sequence numbers, " +
+			"test 2",
+	},
+}
+
+// SpecVectors returns the test vectors of the BIP, which all use its scrypt
+// parameters. Vectors that don't list their address get the one of their
+// key.
+func SpecVectors() []Vector {
+	vectors := make([]Vector, 0, len(specVectors))
+	for _, sv := range specVectors {
+		wif, err := base58.DecodeWIF(sv.wif)
+		if err != nil {
+			panic(err)
+		}
+		address := sv.address
+		if address == "" {
+			_, pubKey := btcec.PrivKeyFromBytes(wif.Key)
+			address = Address(pubKey, wif.Compressed)
+		}
+		vectors = append(vectors, Vector{
+			Passphrase:       sv.passphrase,
+			Encrypted:        sv.encrypted,
+			Key:              wif.Key,
+			Compressed:       wif.Compressed,
+			Address:          address,
+			IntermediateCode: sv.code,
+			Confirmation:     sv.confirmation,
+			LotSequence:      sv.lotSequence,
+			Comment:          sv.comment,
+		})
+	}
+	return vectors
+}
+
+// passphraseRunes are the characters of random passphrases, which include
+// characters outside ASCII and a combining accent, so that some passphrases
+// change when normalized.
+var passphraseRunes = []rune("abcdefghijklmnopqrstuvwxyz" +
+	"ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789 !#%&*-_.é\u0301ΛΩß€😀")
+
+// randomPassphrase returns a passphrase of 1 to 24 random characters.
+func randomPassphrase(rng *rand.Rand) string {
+	var b strings.Builder
+	for i := rng.Intn(24); i >= 0; i-- {
+		b.WriteRune(passphraseRunes[rng.Intn(len(passphraseRunes))])
+	}
+	return b.String()
+}
+
+// RandomVectors returns count random vectors derived from a math/rand source
+// with the seed, with passphrases stretched with the scrypt parameters, or
+// those of the BIP if nil. Half the keys are encrypted without EC
+// multiplication, and half are generated from intermediate codes, with and
+// without lot and sequence numbers; either half is compressed at random.
+func RandomVectors(rngSeed int64, count int, params *Params) []Vector {
+	rng := rand.New(rand.NewSource(rngSeed))
+	vectors := make([]Vector, 0, count)
+	for len(vectors) < count {
+		var (
+			v   *Vector
+			err error
+		)
+		passphrase := randomPassphrase(rng)
+		compressed := rng.Intn(2) == 0
+		if len(vectors)%2 == 0 {
+			key := make([]byte, 32)
+			rng.Read(key)
+			if _, err := parseScalar(key); err != nil {
+				continue
+			}
+			v, err = newVector(key, compressed, passphrase, params)
+		} else {
+			ownerSalt := make([]byte, ownerEntropyLen)
+			rng.Read(ownerSalt)
+			var ls *LotSequence
+			if rng.Intn(2) == 0 {
+				ownerSalt = ownerSalt[:4]
+				ls = &LotSequence{
+					Lot:      uint32(rng.Intn(MaxLot + 1)),
+					Sequence: uint32(rng.Intn(MaxSequence + 1)),
+				}
+			}
+			seed := make([]byte, SeedLen)
+			rng.Read(seed)
+			v, err = newECVector(passphrase, ownerSalt, ls, seed,
+				compressed, params)
+		}
+		if errors.Is(err, ErrInvalidKey) {
+			continue
+		}
+		if err != nil {
+			panic(err)
+		}
+		vectors = append(vectors, *v)
+	}
+	return vectors
+}
+
+// newVector encrypts the key without EC multiplication.
+func newVector(key []byte, compressed bool, passphrase string,
+	params *Params) (*Vector, error) {
+
+	encrypted, err := Encrypt(key, compressed, passphrase, params)
+	if err != nil {
+		return nil, err
+	}
+	_, pubKey := btcec.PrivKeyFromBytes(key)
+	return &Vector{
+		Passphrase: passphrase,
+		Encrypted:  encrypted,
+		Key:        key,
+		Compressed: compressed,
+		Address:    Address(pubKey, compressed),
+		Params:     params,
+		Comment:    fmt.Sprintf("random key, compressed %v", compressed),
+	}, nil
+}
+
+// newECVector generates a key from the seed and an intermediate code of the
+// passphrase and owner salt.
+func newECVector(passphrase string, ownerSalt []byte, ls *LotSequence,
+	seed []byte, compressed bool, params *Params) (*Vector, error) {
+
+	code, err := IntermediateCode(passphrase, ownerSalt, ls, params)
+	if err != nil {
+		return nil, err
+	}
+	generated, err := EncryptIntermediate(code, seed, compressed)
+	if err != nil {
+		return nil, err
+	}
+	wif, err := Decrypt(generated.Encrypted, passphrase, params)
+	if err != nil {
+		return nil, err
+	}
+
+	comment := fmt.Sprintf("random EC multiplied key, compressed %v",
+		compressed)
+	if ls != nil {
+		comment += ", lot/sequence " + ls.String()
+	}
+	return &Vector{
+		Passphrase:       passphrase,
+		Encrypted:        generated.Encrypted,
+		Key:              wif.Key,
+		Compressed:       compressed,
+		Address:          generated.Address,
+		IntermediateCode: code,
+		Confirmation:     generated.Confirmation,
+		LotSequence:      ls,
+		Params:           params,
+		Comment:          comment,
+	}, nil
+}
+
+// CheckVector decrypts the vector's encrypted key and checks its key and
+// address. A key encrypted without EC multiplication is encrypted again and
+// must give the same string. For a key generated from an intermediate code,
+// the code is derived again from the passphrase and the owner salt of the
+// encrypted key, the key is generated again from the seed it decrypts to,
+// and its confirmation code is confirmed.
+func CheckVector(v Vector) error {
+	wif, err := Decrypt(v.Encrypted, v.Passphrase, v.Params)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(wif.Key, v.Key) || wif.Compressed != v.Compressed {
+		return fmt.Errorf("%w: decrypted to key %x, compressed %v",
+			ErrVectorMismatch, wif.Key, wif.Compressed)
+	}
+	_, pubKey := btcec.PrivKeyFromBytes(wif.Key)
+	if address := Address(pubKey, wif.Compressed); address != v.Address {
+		return fmt.Errorf("%w: decrypted key has address %v, expected %v",
+			ErrVectorMismatch, address, v.Address)
+	}
+
+	if v.IntermediateCode == "" {
+		encrypted, err := Encrypt(v.Key, v.Compressed, v.Passphrase,
+			v.Params)
+		if err != nil {
+			return err
+		}
+		if encrypted != v.Encrypted {
+			return fmt.Errorf("%w: encrypted as %v, expected %v",
+				ErrVectorMismatch, encrypted, v.Encrypted)
+		}
+		return nil
+	}
+	return checkECVector(v)
+}
+
+// checkECVector checks a vector of a key generated from an intermediate
+// code.
+func checkECVector(v Vector) error {
+	record, _, err := decodeRecord(v.Encrypted, recordLen, prefixEC)
+	if err != nil {
+		return err
+	}
+	ls := lotSequence(record[2], record[7:15])
+	if fmt.Sprint(ls) != fmt.Sprint(v.LotSequence) {
+		return fmt.Errorf("%w: lot/sequence %v, expected %v",
+			ErrVectorMismatch, ls, v.LotSequence)
+	}
+	ownerSalt := record[7:15]
+	if ls != nil {
+		ownerSalt = ownerSalt[:4]
+	}
+	code, err := IntermediateCode(v.Passphrase, ownerSalt, ls, v.Params)
+	if err != nil {
+		return err
+	}
+	if code != v.IntermediateCode {
+		return fmt.Errorf("%w: intermediate code %v, expected %v",
+			ErrVectorMismatch, code, v.IntermediateCode)
+	}
+
+	_, seed, err := decryptEC(record, v.Passphrase, v.Params.orDefault())
+	if err != nil {
+		return err
+	}
+	generated, err := EncryptIntermediate(code, seed, v.Compressed)
+	if err != nil {
+		return err
+	}
+	if generated.Encrypted != v.Encrypted ||
+		generated.Address != v.Address {
+
+		return fmt.Errorf("%w: generated %v with address %v",
+			ErrVectorMismatch, generated.Encrypted, generated.Address)
+	}
+	if v.Confirmation == "" {
+		return nil
+	}
+	if generated.Confirmation != v.Confirmation {
+		return fmt.Errorf("%w: confirmation code %v, expected %v",
+			ErrVectorMismatch, generated.Confirmation, v.Confirmation)
+	}
+
+	confirmed, err := Confirm(v.Confirmation, v.Passphrase, v.Params)
+	if err != nil {
+		return err
+	}
+	if confirmed.Address != v.Address ||
+		fmt.Sprint(confirmed.LotSequence) != fmt.Sprint(v.LotSequence) {
+
+		return fmt.Errorf("%w: confirmed address %v, lot/sequence %v",
+			ErrVectorMismatch, confirmed.Address, confirmed.LotSequence)
+	}
+	return nil
+}
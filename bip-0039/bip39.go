@@ -0,0 +1,162 @@
+// Package bip39 implements the mnemonic codes of BIP 39: encoding entropy as
+// a sentence of words from one of the published wordlists with a checksum,
+// decoding and validating such sentences, and stretching a mnemonic and an
+// optional passphrase into a seed for BIP 32.
+//
+// A mnemonic of 12 to 24 words encodes 128 to 256 bits of entropy. Its last
+// word includes the first bits of the SHA-256 hash of the entropy as a
+// checksum, which catches most mistyped words:
+//
+//	mnemonic, err := bip39.NewMnemonic(entropy, bip39.English)
+//	...
+//	if err := bip39.ValidateMnemonic(typed, bip39.English); err != nil {
+//		...
+//	}
+//	seed := bip39.NewSeed(typed, passphrase)
+//
+// Mnemonics and passphrases are normalized to NFKD before use, as the BIP
+// requires, so the same words typed with composed or decomposed accents, or
+// a Japanese mnemonic separated by ASCII rather than ideographic spaces, give
+// the same seed.
+package bip39
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	// MinEntropyLen and MaxEntropyLen are the bounds of the entropy
+	// lengths the BIP allows, in bytes. The length must also be a multiple
+	// of 4.
+	MinEntropyLen = 16
+	MaxEntropyLen = 32
+
+	// SeedLen is the length of the seeds returned by NewSeed.
+	SeedLen = 64
+
+	// seedIterations is the PBKDF2 iteration count.
+	seedIterations = 2048
+)
+
+var (
+	// ErrInvalidEntropyLen is returned when encoding entropy that isn't a
+	// multiple of 4 bytes between MinEntropyLen and MaxEntropyLen.
+	ErrInvalidEntropyLen = errors.New("bip39: entropy must be 16 to 32 " +
+		"bytes, in multiples of 4")
+
+	// ErrInvalidWordCount is returned when decoding a mnemonic that isn't
+	// 12, 15, 18, 21 or 24 words long.
+	ErrInvalidWordCount = errors.New("bip39: mnemonic must be 12 to 24 " +
+		"words, in multiples of 3")
+
+	// ErrInvalidChecksum is returned when decoding a mnemonic whose words
+	// are all in the wordlist but whose checksum doesn't match.
+	ErrInvalidChecksum = errors.New("bip39: invalid checksum")
+)
+
+// UnknownWordError is returned when decoding a mnemonic with a word that
+// isn't in the wordlist.
+type UnknownWordError struct {
+	// Index is the position of the word in the mnemonic, from 0.
+	Index int
+
+	// Word is the word as it appears in the mnemonic.
+	Word string
+}
+
+func (e *UnknownWordError) Error() string {
+	return fmt.Sprintf("bip39: word %d (%q) isn't in the wordlist",
+		e.Index+1, e.Word)
+}
+
+// NewMnemonic encodes the entropy as a mnemonic of words from the wordlist,
+// joined with the wordlist's separator.
+func NewMnemonic(entropy []byte, wl *Wordlist) (string, error) {
+	n := len(entropy)
+	if n < MinEntropyLen || n > MaxEntropyLen || n%4 != 0 {
+		return "", ErrInvalidEntropyLen
+	}
+
+	// The checksum is the first bit of the hash for every 32 bits of
+	// entropy, appended to the entropy.
+	checksumBits := uint(n / 4)
+	hash := sha256.Sum256(entropy)
+	bits := new(big.Int).SetBytes(entropy)
+	bits.Lsh(bits, checksumBits)
+	bits.Or(bits, big.NewInt(int64(hash[0]>>(8-checksumBits))))
+
+	wordCount := (n*8 + int(checksumBits)) / 11
+	words := make([]string, wordCount)
+	mask := big.NewInt(WordCount - 1)
+	index := new(big.Int)
+	for i := wordCount - 1; i >= 0; i-- {
+		index.And(bits, mask)
+		words[i] = wl.Word(int(index.Int64()))
+		bits.Rsh(bits, 11)
+	}
+	return strings.Join(words, wl.Separator), nil
+}
+
+// EntropyFromMnemonic decodes a mnemonic of words from the wordlist, which
+// may be separated by any white space, and returns the entropy it encodes
+// after checking its checksum.
+func EntropyFromMnemonic(mnemonic string, wl *Wordlist) ([]byte, error) {
+	words := strings.Fields(norm.NFKD.String(mnemonic))
+	if len(words) < 12 || len(words) > 24 || len(words)%3 != 0 {
+		return nil, ErrInvalidWordCount
+	}
+
+	bits := new(big.Int)
+	for i, word := range words {
+		index, ok := wl.Index(word)
+		if !ok {
+			// Report the word as the caller wrote it rather than
+			// in its normalized form.
+			original := strings.Fields(mnemonic)
+			if len(original) == len(words) {
+				word = original[i]
+			}
+			return nil, &UnknownWordError{Index: i, Word: word}
+		}
+		bits.Lsh(bits, 11)
+		bits.Or(bits, big.NewInt(int64(index)))
+	}
+
+	checksumBits := uint(len(words) / 3)
+	checksum := new(big.Int).And(bits,
+		big.NewInt(1<<checksumBits-1)).Int64()
+	bits.Rsh(bits, checksumBits)
+
+	entropy := bits.FillBytes(make([]byte, len(words)*4/3))
+	hash := sha256.Sum256(entropy)
+	if int64(hash[0]>>(8-checksumBits)) != checksum {
+		return nil, ErrInvalidChecksum
+	}
+	return entropy, nil
+}
+
+// ValidateMnemonic returns an error if the mnemonic doesn't decode with the
+// wordlist or its checksum doesn't match.
+func ValidateMnemonic(mnemonic string, wl *Wordlist) error {
+	_, err := EntropyFromMnemonic(mnemonic, wl)
+	return err
+}
+
+// NewSeed returns the 64 byte seed of the mnemonic and passphrase, which may
+// be empty. As the BIP specifies, the mnemonic isn't validated, so seeds can
+// be recovered from mnemonics made with lists the package doesn't know;
+// callers should check mnemonics typed by users with ValidateMnemonic first.
+func NewSeed(mnemonic, passphrase string) []byte {
+	password := norm.NFKD.String(mnemonic)
+	salt := "mnemonic" + norm.NFKD.String(passphrase)
+	return pbkdf2.Key([]byte(password), []byte(salt), seedIterations,
+		SeedLen, sha512.New)
+}
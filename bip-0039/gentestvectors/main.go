@@ -0,0 +1,208 @@
+// This program writes test vectors for the bip39 package to bip39.json: the
+// English reference vectors published by Trezor, with the passphrase TREZOR,
+// followed by vectors for each wordlist. Each vector lists its entropy,
+// mnemonic, passphrase and seed, and the BIP 32 master key of the seed as an
+// xprv string, as the reference vectors do:
+//
+//	gentestvectors -seed 39 -out bip39.json
+//
+// The file uses the layout of the BIP 158 vectors: a JSON array whose first
+// row names the columns, followed by one row per vector. Pass -check to
+// verify an existing file against the package instead:
+//
+//	gentestvectors -check bip39.json
+//
+// The program lives in a directory of its own since the bip39 package sits at
+// the root of the module, next to the wordlists it embeds.
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/christsim/bips/base58"
+	bip39 "github.com/christsim/bips/bip-0039"
+)
+
+// vectorColumns is the header row of the vector file.
+const vectorColumns = "Wordlist,Entropy,Mnemonic,Passphrase,Seed,Xprv,Comment"
+
+type JSONTestWriter struct {
+	writer          io.Writer
+	firstRowWritten bool
+}
+
+func NewJSONTestWriter(writer io.Writer) *JSONTestWriter {
+	return &JSONTestWriter{writer: writer}
+}
+
+func (w *JSONTestWriter) WriteComment(comment string) error {
+	return w.WriteTestCase([]interface{}{comment})
+}
+
+func (w *JSONTestWriter) WriteTestCase(row []interface{}) error {
+	var err error
+	if w.firstRowWritten {
+		_, err = io.WriteString(w.writer, ",\n")
+	} else {
+		_, err = io.WriteString(w.writer, "[\n")
+		w.firstRowWritten = true
+	}
+	if err != nil {
+		return err
+	}
+
+	rowBytes, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.writer.Write(rowBytes)
+	return err
+}
+
+func (w *JSONTestWriter) Close() error {
+	if !w.firstRowWritten {
+		return nil
+	}
+
+	_, err := io.WriteString(w.writer, "\n]\n")
+	return err
+}
+
+func main() {
+	out := flag.String("out", "bip39.json", "file to write the vectors to")
+	seed := flag.Int64("seed", 39, "seed of the random entropy of the "+
+		"vectors for each wordlist")
+	check := flag.String("check", "", "vector file to check instead of "+
+		"writing one")
+	flag.Parse()
+
+	var err error
+	if *check != "" {
+		err = checkFile(*check)
+	} else {
+		err = writeFile(*out, *seed)
+	}
+	if err != nil {
+		fmt.Println("Error: ", err.Error())
+		os.Exit(1)
+	}
+}
+
+// writeFile writes the reference vectors and the vectors for each wordlist
+// to out.
+func writeFile(out string, seed int64) error {
+	vectors := append(bip39.TrezorVectors(), bip39.LanguageVectors(seed)...)
+
+	file, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := NewJSONTestWriter(file)
+	if err := writer.WriteComment(vectorColumns); err != nil {
+		return err
+	}
+	for _, v := range vectors {
+		err := writer.WriteTestCase([]interface{}{
+			v.Wordlist.Name,
+			hex.EncodeToString(v.Entropy),
+			v.Mnemonic,
+			v.Passphrase,
+			hex.EncodeToString(v.Seed),
+			masterXprv(v.Seed),
+			v.Comment,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote %d vectors\n", len(vectors))
+	return nil
+}
+
+// checkFile checks each vector of the file with bip39.CheckVector, and its
+// master key against its seed.
+func checkFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var rows [][]string
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return err
+	}
+
+	count := 0
+	for i, row := range rows {
+		// Skip the header row and any other comments.
+		if len(row) == 1 {
+			continue
+		}
+		if len(row) != 7 {
+			return fmt.Errorf("row %d: expected 7 columns, got %d", i,
+				len(row))
+		}
+
+		wl := bip39.WordlistByName(row[0])
+		if wl == nil {
+			return fmt.Errorf("row %d: unknown wordlist %v", i, row[0])
+		}
+		entropy, err := hex.DecodeString(row[1])
+		if err != nil {
+			return fmt.Errorf("row %d: %v", i, err)
+		}
+		seed, err := hex.DecodeString(row[4])
+		if err != nil {
+			return fmt.Errorf("row %d: %v", i, err)
+		}
+		err = bip39.CheckVector(bip39.Vector{
+			Wordlist:   wl,
+			Entropy:    entropy,
+			Mnemonic:   row[2],
+			Passphrase: row[3],
+			Seed:       seed,
+		})
+		if err != nil {
+			return fmt.Errorf("%v: %v", row[6], err)
+		}
+		if xprv := masterXprv(seed); xprv != row[5] {
+			return fmt.Errorf("%v: master key %v, expected %v", row[6],
+				xprv, row[5])
+		}
+		count++
+	}
+
+	fmt.Printf("%d vectors OK\n", count)
+	return nil
+}
+
+// masterXprv returns the BIP 32 master key of the seed, serialized with the
+// mainnet version. Unlike child keys, the master key takes no curve
+// arithmetic to derive, so the module doesn't need to depend on the bip32
+// package for it.
+func masterXprv(seed []byte) string {
+	mac := hmac.New(sha512.New, []byte("Bitcoin seed"))
+	mac.Write(seed)
+	sum := mac.Sum(nil)
+
+	// Version, depth, parent fingerprint and child number, followed by
+	// the chain code and the padded private key.
+	key := []byte{0x04, 0x88, 0xad, 0xe4, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	key = append(key, sum[32:]...)
+	key = append(key, 0)
+	key = append(key, sum[:32]...)
+	return base58.CheckEncode(key)
+}
@@ -0,0 +1,11 @@
+module github.com/christsim/bips/bip-0039
+
+go 1.21
+
+require (
+	github.com/christsim/bips/base58 v0.0.0
+	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9
+	golang.org/x/text v0.3.3
+)
+
+replace github.com/christsim/bips/base58 => ../base58
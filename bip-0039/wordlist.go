@@ -0,0 +1,102 @@
+package bip39
+
+import (
+	"embed"
+	"strings"
+	"sync"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// wordlistFiles are the wordlists published alongside the BIP.
+//
+//go:embed *.txt
+var wordlistFiles embed.FS
+
+// WordCount is the number of words in a wordlist, each of which encodes 11
+// bits.
+const WordCount = 2048
+
+// Wordlist is one of the published lists of 2048 words that mnemonics are
+// made of.
+type Wordlist struct {
+	// Name is the name of the wordlist's file without its extension,
+	// such as english or chinese_simplified.
+	Name string
+
+	// Separator joins the words of a mnemonic. Japanese mnemonics are
+	// separated by ideographic spaces, and all others by ASCII spaces.
+	Separator string
+
+	once  sync.Once
+	words []string
+
+	// index maps the NFKD form of each word to its position.
+	index map[string]int
+}
+
+// The published wordlists, in the order of their files.
+var (
+	ChineseSimplified  = &Wordlist{Name: "chinese_simplified", Separator: " "}
+	ChineseTraditional = &Wordlist{Name: "chinese_traditional", Separator: " "}
+	English            = &Wordlist{Name: "english", Separator: " "}
+	French             = &Wordlist{Name: "french", Separator: " "}
+	Italian            = &Wordlist{Name: "italian", Separator: " "}
+	Japanese           = &Wordlist{Name: "japanese", Separator: "\u3000"}
+	Korean             = &Wordlist{Name: "korean", Separator: " "}
+	Spanish            = &Wordlist{Name: "spanish", Separator: " "}
+)
+
+// Wordlists returns all the published wordlists, English first.
+func Wordlists() []*Wordlist {
+	return []*Wordlist{English, ChineseSimplified, ChineseTraditional,
+		French, Italian, Japanese, Korean, Spanish}
+}
+
+// WordlistByName returns the wordlist with the passed name, or nil if there
+// is none.
+func WordlistByName(name string) *Wordlist {
+	for _, wl := range Wordlists() {
+		if wl.Name == name {
+			return wl
+		}
+	}
+	return nil
+}
+
+// load reads the wordlist's file the first time it's used. The files are
+// embedded and checked when the package is built, so failing to read one is
+// a bug.
+func (wl *Wordlist) load() {
+	wl.once.Do(func() {
+		data, err := wordlistFiles.ReadFile(wl.Name + ".txt")
+		if err != nil {
+			panic("bip39: missing wordlist " + wl.Name)
+		}
+		wl.words = strings.Split(strings.TrimSpace(string(data)), "\n")
+		if len(wl.words) != WordCount {
+			panic("bip39: wordlist " + wl.Name + " doesn't have 2048 " +
+				"words")
+		}
+		wl.index = make(map[string]int, WordCount)
+		for i, word := range wl.words {
+			wl.index[norm.NFKD.String(word)] = i
+		}
+	})
+}
+
+// Word returns the word at position i of the list, as written in the list's
+// file.
+func (wl *Wordlist) Word(i int) string {
+	wl.load()
+	return wl.words[i]
+}
+
+// Index returns the position of the word in the list, comparing words in
+// their NFKD form so that composed and decomposed accents match, and whether
+// the word is in the list at all.
+func (wl *Wordlist) Index(word string) (int, bool) {
+	wl.load()
+	i, ok := wl.index[norm.NFKD.String(word)]
+	return i, ok
+}
@@ -0,0 +1,187 @@
+package paymentcode
+
+import (
+	"crypto/sha256"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	bip32 "github.com/christsim/bips/bip-0032"
+	"github.com/christsim/bips/bip-0032/derivation"
+)
+
+// Account is a payment code account of a wallet, whose private key derives
+// the keys the wallet notifies and pays from, and is paid to.
+type Account struct {
+	Net    derivation.Network
+	Number uint32
+
+	key *bip32.ExtendedKey
+}
+
+// DeriveAccount derives the payment code account with the number from a
+// private master key, at the path of Path with the coin type of the
+// network.
+func DeriveAccount(master *bip32.ExtendedKey, net derivation.Network,
+	number uint32) (*Account, error) {
+
+	key, err := master.Derive(Path(net.CoinType, number))
+	if err != nil {
+		return nil, err
+	}
+	return &Account{Net: net, Number: number, key: key}, nil
+}
+
+// PaymentCode returns the payment code of the account.
+func (a *Account) PaymentCode() *PaymentCode {
+	return NewPaymentCode(a.key)
+}
+
+// childSecKey returns the secret key of child i of the account.
+func (a *Account) childSecKey(i uint32) ([]byte, error) {
+	child, err := a.key.Child(i)
+	if err != nil {
+		return nil, err
+	}
+	return child.PrivateKey(), nil
+}
+
+// NotificationKey returns the secret key of the account's notification
+// address, that of child 0.
+func (a *Account) NotificationKey() ([]byte, error) {
+	return a.childSecKey(0)
+}
+
+// NotificationAddress returns the P2PKH address of child 0 of the payment
+// code, which senders notify it at, on the network.
+func NotificationAddress(c *PaymentCode, net derivation.Network) (string,
+	error) {
+
+	pubKey, err := c.ChildKey(0)
+	if err != nil {
+		return "", err
+	}
+	return derivation.Address(pubKey, derivation.P2PKH, net)
+}
+
+// NotificationAddress returns the account's notification address.
+func (a *Account) NotificationAddress() (string, error) {
+	return NotificationAddress(a.PaymentCode(), a.Net)
+}
+
+// paymentSecret returns s, the hash of the shared secret of a payment,
+// which fails with ErrInvalidSecret if it isn't below the curve order.
+func paymentSecret(secKey, pubKey []byte) (btcec.ModNScalar, error) {
+	var s btcec.ModNScalar
+	x, err := SharedSecret(secKey, pubKey)
+	if err != nil {
+		return s, err
+	}
+	hash := sha256.Sum256(x)
+	if s.SetBytes(&hash) != 0 {
+		return s, ErrInvalidSecret
+	}
+	return s, nil
+}
+
+// SendSecret returns the shared secret of the i-th payment from the
+// account to the recipient: the x coordinate of the secret key of child 0
+// of the account times the key of child i of the recipient.
+func (a *Account) SendSecret(recipient *PaymentCode, i uint32) ([]byte,
+	error) {
+
+	secKey, err := a.childSecKey(0)
+	if err != nil {
+		return nil, err
+	}
+	pubKey, err := recipient.ChildKey(i)
+	if err != nil {
+		return nil, err
+	}
+	return SharedSecret(secKey, pubKey)
+}
+
+// SendKey returns the compressed public key the i-th payment from the
+// account to the recipient goes to: the key of child i of the recipient
+// plus the hash of their shared secret times the generator.
+func (a *Account) SendKey(recipient *PaymentCode, i uint32) ([]byte,
+	error) {
+
+	secKey, err := a.childSecKey(0)
+	if err != nil {
+		return nil, err
+	}
+	pubKey, err := recipient.ChildKey(i)
+	if err != nil {
+		return nil, err
+	}
+	s, err := paymentSecret(secKey, pubKey)
+	if err != nil {
+		return nil, err
+	}
+	key, err := btcec.ParsePubKey(pubKey)
+	if err != nil {
+		return nil, err
+	}
+	var p, sG, sum btcec.JacobianPoint
+	key.AsJacobian(&p)
+	btcec.ScalarBaseMultNonConst(&s, &sG)
+	btcec.AddNonConst(&p, &sG, &sum)
+	if (sum.X.IsZero() && sum.Y.IsZero()) || sum.Z.IsZero() {
+		return nil, ErrInvalidSecret
+	}
+	sum.ToAffine()
+	return btcec.NewPublicKey(&sum.X, &sum.Y).SerializeCompressed(), nil
+}
+
+// SendAddress returns the P2PKH address of the key of SendKey on the
+// account's network.
+func (a *Account) SendAddress(recipient *PaymentCode, i uint32) (string,
+	error) {
+
+	pubKey, err := a.SendKey(recipient, i)
+	if err != nil {
+		return "", err
+	}
+	return derivation.Address(pubKey, derivation.P2PKH, a.Net)
+}
+
+// ReceiveKey returns the secret key of the i-th payment from the sender to
+// the account: the secret key of child i of the account plus the hash of
+// their shared secret, which it computes with the key of child 0 of the
+// sender.
+func (a *Account) ReceiveKey(sender *PaymentCode, i uint32) ([]byte,
+	error) {
+
+	secKey, err := a.childSecKey(i)
+	if err != nil {
+		return nil, err
+	}
+	pubKey, err := sender.ChildKey(0)
+	if err != nil {
+		return nil, err
+	}
+	s, err := paymentSecret(secKey, pubKey)
+	if err != nil {
+		return nil, err
+	}
+	var d btcec.ModNScalar
+	d.SetByteSlice(secKey)
+	if d.Add(&s).IsZero() {
+		return nil, ErrInvalidSecret
+	}
+	key := d.Bytes()
+	return key[:], nil
+}
+
+// ReceiveAddress returns the P2PKH address of the key of ReceiveKey on the
+// account's network, which a wallet watches for payments from the sender.
+func (a *Account) ReceiveAddress(sender *PaymentCode, i uint32) (string,
+	error) {
+
+	secKey, err := a.ReceiveKey(sender, i)
+	if err != nil {
+		return "", err
+	}
+	_, pubKey := btcec.PrivKeyFromBytes(secKey)
+	return derivation.Address(pubKey.SerializeCompressed(),
+		derivation.P2PKH, a.Net)
+}
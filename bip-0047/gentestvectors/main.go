@@ -0,0 +1,326 @@
+// This program writes test vectors for the paymentcode package: the payments
+// from Alice to Bob of the BIP, followed by payments between random wallets,
+// to addresses.json, Alice's notification transaction to Bob and random
+// notification transactions, some of which reading fails on, to
+// notifications.json, and payment codes that must be rejected to
+// invalid.json. The random vectors depend only on -seed and -count, so they
+// can be regenerated by anyone:
+//
+//	gentestvectors -count 50 -seed 47
+//
+// The files use the layout of the BIP 158 vectors: a JSON array whose first
+// row names the columns, followed by one row per vector. Pass -check to
+// verify existing files against the package instead:
+//
+//	gentestvectors -check addresses.json \
+//		-check-notifications notifications.json \
+//		-check-invalid invalid.json
+//
+// The program lives in a directory of its own since the paymentcode package
+// sits at the root of the module.
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/christsim/bips/bip-0032/derivation"
+	paymentcode "github.com/christsim/bips/bip-0047"
+	"github.com/christsim/bips/internal/vectorfile"
+)
+
+const (
+	// vectorColumns, notificationColumns and invalidColumns are the header
+	// rows of the vector files.
+	vectorColumns = "Network,SenderSeed,RecipientSeed,SenderCode," +
+		"RecipientCode,Index,SharedSecret,Address,Comment"
+	notificationColumns = "Network,SenderSeed,RecipientSeed,SenderCode," +
+		"Notification,SecKey,Payload,Tx,Error,Comment"
+	invalidColumns = "PaymentCode,Error,Comment"
+)
+
+type JSONTestWriter struct {
+	writer          io.Writer
+	firstRowWritten bool
+}
+
+func NewJSONTestWriter(writer io.Writer) *JSONTestWriter {
+	return &JSONTestWriter{writer: writer}
+}
+
+func (w *JSONTestWriter) WriteComment(comment string) error {
+	return w.WriteTestCase([]interface{}{comment})
+}
+
+func (w *JSONTestWriter) WriteTestCase(row []interface{}) error {
+	var err error
+	if w.firstRowWritten {
+		_, err = io.WriteString(w.writer, ",\n")
+	} else {
+		_, err = io.WriteString(w.writer, "[\n")
+		w.firstRowWritten = true
+	}
+	if err != nil {
+		return err
+	}
+
+	rowBytes, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.writer.Write(rowBytes)
+	return err
+}
+
+func (w *JSONTestWriter) Close() error {
+	if !w.firstRowWritten {
+		return nil
+	}
+
+	_, err := io.WriteString(w.writer, "\n]\n")
+	return err
+}
+
+func main() {
+	out := flag.String("out", "addresses.json", "file to write the "+
+		"payment vectors to")
+	notificationsOut := flag.String("notifications-out",
+		"notifications.json", "file to write the notification "+
+			"vectors to")
+	invalidOut := flag.String("invalid-out", "invalid.json", "file to "+
+		"write the invalid payment codes to")
+	count := flag.Int("count", 50, "number of random wallet pairs to "+
+		"write, in each of the first two files")
+	seed := flag.Int64("seed", 47, "seed of the random vectors")
+	check := flag.String("check", "", "payment vector file to check "+
+		"instead of writing one")
+	checkNotifications := flag.String("check-notifications", "",
+		"notification vector file to check instead of writing one")
+	checkInvalid := flag.String("check-invalid", "", "invalid payment "+
+		"code file to check instead of writing one")
+	flag.Parse()
+
+	var err error
+	if *check != "" || *checkNotifications != "" || *checkInvalid != "" {
+		err = checkFiles(*check, *checkNotifications, *checkInvalid)
+	} else {
+		err = writeFiles(*out, *notificationsOut, *invalidOut, *seed,
+			*count)
+	}
+	if err != nil {
+		fmt.Println("Error: ", err.Error())
+		os.Exit(1)
+	}
+}
+
+// networks maps the names of the networks of the derivation package to them.
+var networks = map[string]derivation.Network{
+	derivation.Mainnet.Name: derivation.Mainnet,
+	derivation.Testnet.Name: derivation.Testnet,
+}
+
+// writeRows writes the header and rows to a new vector file at path.
+func writeRows(path, columns string, rows [][]interface{}) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := NewJSONTestWriter(file)
+	if err := writer.WriteComment(columns); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if err := writer.WriteTestCase(row); err != nil {
+			return err
+		}
+	}
+	return writer.Close()
+}
+
+// writeFiles writes the payment vectors to out, the notification vectors to
+// notificationsOut and the invalid payment codes to invalidOut.
+func writeFiles(out, notificationsOut, invalidOut string, seed int64,
+	count int) error {
+
+	var rows [][]interface{}
+	vectors := append(paymentcode.SpecVectors(),
+		paymentcode.RandomVectors(seed, count)...)
+	for _, v := range vectors {
+		rows = append(rows, []interface{}{
+			v.Net.Name,
+			hex.EncodeToString(v.SenderSeed),
+			hex.EncodeToString(v.RecipientSeed),
+			v.SenderCode,
+			v.RecipientCode,
+			strconv.FormatUint(uint64(v.Index), 10),
+			hex.EncodeToString(v.SharedSecret),
+			v.Address,
+			v.Comment,
+		})
+	}
+	if err := writeRows(out, vectorColumns, rows); err != nil {
+		return err
+	}
+
+	rows = nil
+	notifications := paymentcode.NotificationVectors(seed, count)
+	for _, v := range notifications {
+		rows = append(rows, []interface{}{
+			v.Net.Name,
+			hex.EncodeToString(v.SenderSeed),
+			hex.EncodeToString(v.RecipientSeed),
+			v.SenderCode,
+			v.Notification,
+			hex.EncodeToString(v.SecKey),
+			hex.EncodeToString(v.Payload),
+			hex.EncodeToString(v.Tx),
+			vectorfile.ErrorString(v.Err),
+			v.Comment,
+		})
+	}
+	err := writeRows(notificationsOut, notificationColumns, rows)
+	if err != nil {
+		return err
+	}
+
+	rows = nil
+	invalid := paymentcode.InvalidVectors()
+	for _, v := range invalid {
+		rows = append(rows, []interface{}{
+			v.PaymentCode,
+			v.Err.Error(),
+			v.Comment,
+		})
+	}
+	if err := writeRows(invalidOut, invalidColumns, rows); err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote %d vectors, %d notifications and %d invalid "+
+		"payment codes\n", len(vectors), len(notifications),
+		len(invalid))
+	return nil
+}
+
+// decodeHex decodes the hex columns of a row, empty ones to nil.
+func decodeHex(columns ...string) ([][]byte, error) {
+	decoded := make([][]byte, len(columns))
+	for i, s := range columns {
+		if s == "" {
+			continue
+		}
+		b, err := hex.DecodeString(s)
+		if err != nil {
+			return nil, err
+		}
+		decoded[i] = b
+	}
+	return decoded, nil
+}
+
+// checkFiles checks each vector of the payment vector file with
+// paymentcode.CheckVector, each vector of the notification vector file with
+// paymentcode.CheckNotificationVector, and each code of the invalid payment
+// code file with paymentcode.CheckInvalidVector. Any path may be empty to
+// skip that file.
+func checkFiles(path, notificationsPath, invalidPath string) error {
+	if path != "" {
+		rows, err := vectorfile.ReadStringRows(path, 9)
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			net, ok := networks[row[0]]
+			if !ok {
+				return fmt.Errorf("%v: unknown network %v",
+					row[8], row[0])
+			}
+			b, err := decodeHex(row[1], row[2], row[6])
+			if err != nil {
+				return fmt.Errorf("%v: %v", row[8], err)
+			}
+			index, err := strconv.ParseUint(row[5], 10, 32)
+			if err != nil {
+				return fmt.Errorf("%v: %v", row[8], err)
+			}
+			err = paymentcode.CheckVector(paymentcode.Vector{
+				Net:           net,
+				SenderSeed:    b[0],
+				RecipientSeed: b[1],
+				SenderCode:    row[3],
+				RecipientCode: row[4],
+				Index:         uint32(index),
+				SharedSecret:  b[2],
+				Address:       row[7],
+			})
+			if err != nil {
+				return fmt.Errorf("%v: %v", row[8], err)
+			}
+		}
+		fmt.Printf("%d vectors OK\n", len(rows))
+	}
+
+	if notificationsPath != "" {
+		rows, err := vectorfile.ReadStringRows(notificationsPath, 10)
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			net, ok := networks[row[0]]
+			if !ok {
+				return fmt.Errorf("%v: unknown network %v",
+					row[9], row[0])
+			}
+			b, err := decodeHex(row[1], row[2], row[5], row[6],
+				row[7])
+			if err != nil {
+				return fmt.Errorf("%v: %v", row[9], err)
+			}
+			vectorErr := vectorfile.ParseError(row[8])
+			err = paymentcode.CheckNotificationVector(
+				paymentcode.NotificationVector{
+					Net:           net,
+					SenderSeed:    b[0],
+					RecipientSeed: b[1],
+					SenderCode:    row[3],
+					Notification:  row[4],
+					SecKey:        b[2],
+					Payload:       b[3],
+					Tx:            b[4],
+					Err:           vectorErr,
+				})
+			if err != nil {
+				return fmt.Errorf("%v: %v", row[9], err)
+			}
+		}
+		fmt.Printf("%d notifications OK\n", len(rows))
+	}
+
+	if invalidPath != "" {
+		rows, err := vectorfile.ReadStringRows(invalidPath, 3)
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			err := paymentcode.CheckInvalidVector(
+				paymentcode.InvalidVector{
+					PaymentCode: row[0],
+					Err:         errors.New(row[1]),
+				})
+			if err != nil {
+				return fmt.Errorf("%v: %v", row[2], err)
+			}
+		}
+		fmt.Printf("%d invalid payment codes OK\n", len(rows))
+	}
+	return nil
+}
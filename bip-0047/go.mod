@@ -0,0 +1,32 @@
+module github.com/christsim/bips/bip-0047
+
+go 1.21
+
+require (
+	github.com/btcsuite/btcd v0.24.2
+	github.com/btcsuite/btcd/btcec/v2 v2.3.4
+	github.com/btcsuite/btcd/chaincfg/chainhash v1.1.0
+	github.com/christsim/bips/base58 v0.0.0
+	github.com/christsim/bips/bip-0032 v0.0.0
+	github.com/christsim/bips/bip-0039 v0.0.0
+	github.com/christsim/bips/internal v0.0.0
+	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9
+)
+
+require (
+	github.com/btcsuite/btcd/btcutil v1.1.5 // indirect
+	github.com/btcsuite/btclog v0.0.0-20170628155309-84c8d2346e9f // indirect
+	github.com/christsim/bips/bip-0173 v0.0.0 // indirect
+	github.com/decred/dcrd/crypto/blake256 v1.0.0 // indirect
+	github.com/decred/dcrd/dcrec/secp256k1/v4 v4.0.1 // indirect
+	golang.org/x/sys v0.0.0-20200814200057-3d37ad5750ed // indirect
+	golang.org/x/text v0.3.3 // indirect
+)
+
+replace (
+	github.com/christsim/bips/base58 => ../base58
+	github.com/christsim/bips/bip-0032 => ../bip-0032
+	github.com/christsim/bips/bip-0039 => ../bip-0039
+	github.com/christsim/bips/bip-0173 => ../bip-0173
+	github.com/christsim/bips/internal => ../internal
+)
@@ -0,0 +1,221 @@
+package paymentcode
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/christsim/bips/base58"
+)
+
+// NotificationAmount is the amount NotificationTx pays to notification
+// addresses, the dust limit of P2PKH outputs.
+const NotificationAmount = 546
+
+var (
+	// ErrNotNotification is returned by ReadNotification for a
+	// transaction that doesn't pay the account's notification address, or
+	// that has no OP_RETURN output of a payment code.
+	ErrNotNotification = errors.New("paymentcode: not a notification " +
+		"transaction")
+
+	// ErrNoDesignatedInput is returned for a notification transaction
+	// none of whose inputs exposes a public key.
+	ErrNoDesignatedInput = errors.New("paymentcode: no designated input")
+)
+
+// blindingFactor returns the 64 byte factor payment codes are blinded with
+// in notification transactions: the HMAC-SHA512, keyed with the outpoint of
+// the designated input, of the x coordinate of the ECDH secret of the
+// designated input's key and the recipient's notification key.
+func blindingFactor(secKey, pubKey []byte, op wire.OutPoint) ([]byte,
+	error) {
+
+	x, err := SharedSecret(secKey, pubKey)
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha512.New, serializeOutPoint(op.Hash[:], op.Index))
+	mac.Write(x)
+	return mac.Sum(nil), nil
+}
+
+// blind returns the payload of a payment code with the first half of the
+// blinding factor xored into the x coordinate of its key, and the second
+// half into its chain code. Blinding a blinded payload unblinds it.
+func blind(payload, factor []byte) []byte {
+	blinded := append([]byte{}, payload...)
+	for i := 0; i < 64; i++ {
+		blinded[3+i] ^= factor[i]
+	}
+	return blinded
+}
+
+// NotificationPayload returns the blinded payment code of the account that
+// a notification transaction to the recipient carries, whose designated
+// input spends the outpoint with the secret key.
+func (a *Account) NotificationPayload(recipient *PaymentCode,
+	secKey []byte, op wire.OutPoint) ([]byte, error) {
+
+	pubKey, err := recipient.ChildKey(0)
+	if err != nil {
+		return nil, err
+	}
+	factor, err := blindingFactor(secKey, pubKey, op)
+	if err != nil {
+		return nil, err
+	}
+	return blind(a.PaymentCode().Payload(), factor), nil
+}
+
+// pubKeyHashScript returns the P2PKH script of the Base58Check address.
+func pubKeyHashScript(addr string) ([]byte, error) {
+	data, err := base58.CheckDecode(addr)
+	if err != nil {
+		return nil, err
+	}
+	script := []byte{txscript.OP_DUP, txscript.OP_HASH160,
+		txscript.OP_DATA_20}
+	script = append(script, data[1:]...)
+	return append(script, txscript.OP_EQUALVERIFY, txscript.OP_CHECKSIG),
+		nil
+}
+
+// NotificationTx returns the unsigned notification transaction from the
+// account to the recipient, whose designated input, its first, spends the
+// outpoint with the secret key. It pays NotificationAmount to the
+// recipient's notification address and has an OP_RETURN output of the
+// blinded payment code of the account, followed by the change outputs.
+// Further inputs may be added after the designated one, and signing it
+// must expose the public key of the secret key in its scriptSig or witness.
+func (a *Account) NotificationTx(recipient *PaymentCode,
+	designated wire.OutPoint, secKey []byte, change ...*wire.TxOut) (
+	*wire.MsgTx, error) {
+
+	payload, err := a.NotificationPayload(recipient, secKey, designated)
+	if err != nil {
+		return nil, err
+	}
+	addr, err := NotificationAddress(recipient, a.Net)
+	if err != nil {
+		return nil, err
+	}
+	script, err := pubKeyHashScript(addr)
+	if err != nil {
+		return nil, err
+	}
+	nullData, err := txscript.NullDataScript(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	tx := wire.NewMsgTx(1)
+	tx.AddTxIn(wire.NewTxIn(&designated, nil, nil))
+	tx.AddTxOut(wire.NewTxOut(NotificationAmount, script))
+	tx.AddTxOut(wire.NewTxOut(0, nullData))
+	for _, out := range change {
+		tx.AddTxOut(out)
+	}
+	return tx, nil
+}
+
+// isPubKey reports whether the data is a compressed or uncompressed public
+// key.
+func isPubKey(data []byte) bool {
+	if len(data) != 33 && len(data) != 65 {
+		return false
+	}
+	_, err := btcec.ParsePubKey(data)
+	return err == nil
+}
+
+// DesignatedInput returns the index of the designated input of a
+// notification transaction, the first that exposes a public key as the
+// last push of its scriptSig or the last item of its witness, and the key
+// in compressed form.
+func DesignatedInput(tx *wire.MsgTx) (int, []byte, error) {
+	for i, in := range tx.TxIn {
+		var key []byte
+		pushes, err := txscript.PushedData(in.SignatureScript)
+		if err == nil && len(pushes) > 0 {
+			key = pushes[len(pushes)-1]
+		}
+		if !isPubKey(key) && len(in.Witness) > 0 {
+			key = in.Witness[len(in.Witness)-1]
+		}
+		if isPubKey(key) {
+			pubKey, err := btcec.ParsePubKey(key)
+			if err != nil {
+				return 0, nil, err
+			}
+			return i, pubKey.SerializeCompressed(), nil
+		}
+	}
+	return 0, nil, ErrNoDesignatedInput
+}
+
+// notificationPayload returns the data of the first OP_RETURN output of
+// the transaction that pushes PayloadSize bytes.
+func notificationPayload(tx *wire.MsgTx) ([]byte, bool) {
+	for _, out := range tx.TxOut {
+		if len(out.PkScript) == 0 ||
+			out.PkScript[0] != txscript.OP_RETURN {
+
+			continue
+		}
+		pushes, err := txscript.PushedData(out.PkScript[1:])
+		if err == nil && len(pushes) == 1 &&
+			len(pushes[0]) == PayloadSize {
+
+			return pushes[0], true
+		}
+	}
+	return nil, false
+}
+
+// ReadNotification returns the payment code of the sender of a
+// notification transaction to the account, unblinding the code it carries
+// with the account's notification key and the designated input.
+func (a *Account) ReadNotification(tx *wire.MsgTx) (*PaymentCode, error) {
+	addr, err := a.NotificationAddress()
+	if err != nil {
+		return nil, err
+	}
+	script, err := pubKeyHashScript(addr)
+	if err != nil {
+		return nil, err
+	}
+	var paid bool
+	for _, out := range tx.TxOut {
+		paid = paid || bytes.Equal(out.PkScript, script)
+	}
+	payload, ok := notificationPayload(tx)
+	switch {
+	case !paid:
+		return nil, fmt.Errorf("%w: %v isn't paid", ErrNotNotification,
+			addr)
+	case !ok:
+		return nil, fmt.Errorf("%w: no payment code",
+			ErrNotNotification)
+	}
+
+	i, pubKey, err := DesignatedInput(tx)
+	if err != nil {
+		return nil, err
+	}
+	secKey, err := a.NotificationKey()
+	if err != nil {
+		return nil, err
+	}
+	factor, err := blindingFactor(secKey, pubKey,
+		tx.TxIn[i].PreviousOutPoint)
+	if err != nil {
+		return nil, err
+	}
+	return FromPayload(blind(payload, factor))
+}
@@ -0,0 +1,228 @@
+// Package paymentcode implements version 1 of the reusable payment codes of
+// BIP 47, which let a wallet publish a single code that others pay without
+// their payments being linkable to the code or to each other:
+//
+//	alice, err := paymentcode.DeriveAccount(master, derivation.Mainnet, 0)
+//	tx, err := alice.NotificationTx(bob, designated, secKey, change)
+//	addr, err := alice.SendAddress(bob, 0)
+//
+// A payment code holds the public key and chain code of the account key
+// m/47'/coin_type'/account', whose children are the keys the wallet is paid
+// to. Before paying a recipient for the first time, a sender notifies it
+// with a transaction paying its notification address, that of child 0 of
+// its code, which carries the sender's code blinded with an ECDH secret of
+// the transaction's designated input and that child. Each payment then goes
+// to a fresh address derived from an ECDH secret of child 0 of the sender
+// and child i of the recipient, whose key only the recipient can compute.
+//
+// The blinding factor is an HMAC-SHA512 keyed with the outpoint of the
+// designated input, as the wallets that deployed the BIP compute it and its
+// vectors have it.
+package paymentcode
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/christsim/bips/base58"
+	bip32 "github.com/christsim/bips/bip-0032"
+	"golang.org/x/crypto/ripemd160"
+)
+
+const (
+	// Version1 is the version of the payment codes the package
+	// implements.
+	Version1 = 0x01
+
+	// PayloadSize is the size of the binary payment code, which
+	// notification transactions carry blinded.
+	PayloadSize = 80
+
+	// Prefix is the version byte of the Base58Check encoding of payment
+	// codes, which makes them start with PM8T.
+	Prefix = 0x47
+
+	// FeatureBitmessage is the bit of the features byte of codes whose
+	// owners take notifications by Bitmessage, which the package doesn't
+	// implement.
+	FeatureBitmessage = 0x01
+
+	// Purpose is the first level of the paths of payment code accounts.
+	Purpose = 47
+)
+
+var (
+	// ErrInvalidPaymentCode is returned for a payment code that isn't
+	// PayloadSize bytes, has a bad checksum or prefix, or whose key isn't
+	// a point of the curve, wrapped with the reason.
+	ErrInvalidPaymentCode = errors.New("paymentcode: invalid payment code")
+
+	// ErrUnsupportedVersion is returned for a payment code of a version
+	// other than 1.
+	ErrUnsupportedVersion = errors.New("paymentcode: unsupported version")
+
+	// ErrInvalidSecret is returned in the unlikely case that the shared
+	// secret of a payment isn't below the curve order or gives the point
+	// at infinity. The BIP has wallets skip the index of such payments.
+	ErrInvalidSecret = errors.New("paymentcode: invalid shared secret")
+)
+
+// PaymentCode is a payment code: the public key and chain code of an
+// account, whose children are derived as those of an extended public key.
+type PaymentCode struct {
+	Version  byte
+	Features byte
+
+	// PubKey is the compressed public key of the account.
+	PubKey    []byte
+	ChainCode [32]byte
+}
+
+// NewPaymentCode returns the version 1 payment code of an account key,
+// private or public, without features.
+func NewPaymentCode(key *bip32.ExtendedKey) *PaymentCode {
+	return &PaymentCode{
+		Version:   Version1,
+		PubKey:    key.PublicKey(),
+		ChainCode: key.ChainCode(),
+	}
+}
+
+// FromPayload parses the binary encoding of a payment code: its version
+// and features bytes, its key, its chain code and 13 reserved bytes, which
+// must be zero.
+func FromPayload(payload []byte) (*PaymentCode, error) {
+	if len(payload) != PayloadSize {
+		return nil, fmt.Errorf("%w: %d bytes", ErrInvalidPaymentCode,
+			len(payload))
+	}
+	if payload[0] != Version1 {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion,
+			payload[0])
+	}
+	c := &PaymentCode{
+		Version:  payload[0],
+		Features: payload[1],
+		PubKey:   append([]byte(nil), payload[2:35]...),
+	}
+	copy(c.ChainCode[:], payload[35:67])
+	if !btcec.IsCompressedPubKey(c.PubKey) {
+		return nil, fmt.Errorf("%w: sign byte %#x",
+			ErrInvalidPaymentCode, c.PubKey[0])
+	}
+	if _, err := btcec.ParsePubKey(c.PubKey); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPaymentCode, err)
+	}
+	for _, b := range payload[67:] {
+		if b != 0 {
+			return nil, fmt.Errorf("%w: reserved bytes set",
+				ErrInvalidPaymentCode)
+		}
+	}
+	return c, nil
+}
+
+// Parse parses the Base58Check encoding of a payment code.
+func Parse(s string) (*PaymentCode, error) {
+	data, err := base58.CheckDecode(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPaymentCode, err)
+	}
+	if len(data) == 0 || data[0] != Prefix {
+		return nil, fmt.Errorf("%w: prefix", ErrInvalidPaymentCode)
+	}
+	return FromPayload(data[1:])
+}
+
+// Payload returns the binary encoding of the payment code.
+func (c *PaymentCode) Payload() []byte {
+	payload := make([]byte, PayloadSize)
+	payload[0] = c.Version
+	payload[1] = c.Features
+	copy(payload[2:35], c.PubKey)
+	copy(payload[35:67], c.ChainCode[:])
+	return payload
+}
+
+// String returns the Base58Check encoding of the payment code.
+func (c *PaymentCode) String() string {
+	return base58.CheckEncode(append([]byte{Prefix}, c.Payload()...))
+}
+
+// extendedKey returns the payment code as the extended public key it's
+// derived as.
+func (c *PaymentCode) extendedKey() (*bip32.ExtendedKey, error) {
+	data := append([]byte{}, bip32.Mainnet.Public[:]...)
+	data = append(data, make([]byte, 9)...)
+	data = append(data, c.ChainCode[:]...)
+	key, err := bip32.Deserialize(append(data, c.PubKey...))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPaymentCode, err)
+	}
+	return key, nil
+}
+
+// ChildKey returns the compressed public key of child i of the payment
+// code. Child 0 is the key of the notification address.
+func (c *PaymentCode) ChildKey(i uint32) ([]byte, error) {
+	key, err := c.extendedKey()
+	if err != nil {
+		return nil, err
+	}
+	child, err := key.Child(i)
+	if err != nil {
+		return nil, err
+	}
+	return child.PublicKey(), nil
+}
+
+// Path returns the path of the key of a payment code account:
+//
+//	m / 47' / coin_type' / account'
+func Path(coinType, account uint32) bip32.Path {
+	return bip32.Path{
+		Purpose + bip32.HardenedKeyStart,
+		coinType + bip32.HardenedKeyStart,
+		account + bip32.HardenedKeyStart,
+	}
+}
+
+// SharedSecret returns the x coordinate of the ECDH secret of a secret key
+// and a compressed public key, the secret key times the public key.
+func SharedSecret(secKey, pubKey []byte) ([]byte, error) {
+	var d btcec.ModNScalar
+	if len(secKey) != 32 || d.SetByteSlice(secKey) || d.IsZero() {
+		return nil, fmt.Errorf("%w: secret key", ErrInvalidSecret)
+	}
+	key, err := btcec.ParsePubKey(pubKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSecret, err)
+	}
+	var p, s btcec.JacobianPoint
+	key.AsJacobian(&p)
+	btcec.ScalarMultNonConst(&d, &p, &s)
+	if (s.X.IsZero() && s.Y.IsZero()) || s.Z.IsZero() {
+		return nil, ErrInvalidSecret
+	}
+	s.ToAffine()
+	x := s.X.Bytes()
+	return x[:], nil
+}
+
+// serializeOutPoint returns the serialization of an outpoint: its txid in
+// the byte order of transactions, and its index in little endian.
+func serializeOutPoint(hash []byte, index uint32) []byte {
+	b := append(make([]byte, 0, len(hash)+4), hash...)
+	return binary.LittleEndian.AppendUint32(b, index)
+}
+
+// hash160 returns RIPEMD160(SHA256(data)).
+func hash160(data []byte) []byte {
+	sha := sha256.Sum256(data)
+	h := ripemd160.New()
+	h.Write(sha[:])
+	return h.Sum(nil)
+}
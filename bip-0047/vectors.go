@@ -0,0 +1,688 @@
+package paymentcode
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/rand"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/christsim/bips/base58"
+	bip32 "github.com/christsim/bips/bip-0032"
+	"github.com/christsim/bips/bip-0032/derivation"
+	bip39 "github.com/christsim/bips/bip-0039"
+	"github.com/christsim/bips/internal/vectorfile"
+)
+
+// ErrVectorMismatch is returned by the checks of vectors when deriving
+// their codes, addresses or notifications doesn't give the expected result.
+var ErrVectorMismatch = errors.New("paymentcode: vector mismatch")
+
+// Vector is the i-th payment from a sender to a recipient, whose accounts
+// are account 0 of wallets of the seeds.
+type Vector struct {
+	Net           derivation.Network
+	SenderSeed    []byte
+	RecipientSeed []byte
+	SenderCode    string
+	RecipientCode string
+	Index         uint32
+
+	// SharedSecret is the x coordinate of the ECDH secret of the payment,
+	// and Address the address it goes to.
+	SharedSecret []byte
+	Address      string
+
+	// Comment describes what the vector exercises.
+	Comment string
+}
+
+// NotificationVector is a notification transaction from a sender to a
+// recipient, whose accounts are account 0 of wallets of the seeds, and the
+// outcome of the recipient reading it.
+type NotificationVector struct {
+	Net           derivation.Network
+	SenderSeed    []byte
+	RecipientSeed []byte
+	SenderCode    string
+
+	// Notification is the recipient's notification address.
+	Notification string
+
+	// SecKey is the secret key of the designated input, and Payload the
+	// blinded payment code made with it. Both are empty for transactions
+	// that are only read.
+	SecKey  []byte
+	Payload []byte
+
+	// Tx is the signed transaction.
+	Tx []byte
+
+	// Err is the error reading the transaction fails with, or nil if it
+	// gives the sender's code.
+	Err error
+
+	// Comment describes what the vector exercises.
+	Comment string
+}
+
+// InvalidVector is a payment code that Parse must reject.
+type InvalidVector struct {
+	PaymentCode string
+
+	// Err is the error Parse returns for the code.
+	Err error
+
+	// Comment describes what is wrong with the code.
+	Comment string
+}
+
+// The wallets of the BIP's vectors, of Alice who pays and Bob who is paid,
+// and the first ten addresses Alice pays Bob at.
+const (
+	aliceMnemonic = "response seminar brave tip suit recall often sound " +
+		"stick owner lottery motion"
+	aliceCode = "PM8TJTLJbPRGxSbc8EJi42Wrr6QbNSaSSVJ5Y3E4pbCYiTHUskHg1393" +
+		"5Ubb7q8tx9GVbh2UuRnBc3WSyJHhUrw8KhprKnn9eDznYGieTzFcwQRya4GA"
+	aliceNotification = "1JDdmqFLhpzcUwPeinhJbUPw4Co3aWLyzW"
+
+	bobMnemonic = "reward upper indicate eight swift arch injury crystal " +
+		"super wrestle already dentist"
+	bobCode = "PM8TJS2JxQ5ztXUpBBRnpTbcUXbUHy2T1abfrb3KkAAtMEGNbey4oumH" +
+		"7Hc578WgQJhPjBxteQ5GHHToTYHE3A1w6p7tU6KSoFmWBVbFGjKPisZDbP97"
+	bobNotification = "1ChvUUvht2hUQufHBXF8NgLhW8SwE2ecGV"
+)
+
+var specAddresses = []string{
+	"141fi7TY3h936vRUKh1qfUZr8rSBuYbVBK",
+	"12u3Uued2fuko2nY4SoSFGCoGLCBUGPkk6",
+	"1FsBVhT5dQutGwaPePTYMe5qvYqqjxyftc",
+	"1CZAmrbKL6fJ7wUxb99aETwXhcGeG3CpeA",
+	"1KQvRShk6NqPfpr4Ehd53XUhpemBXtJPTL",
+	"1KsLV2F47JAe6f8RtwzfqhjVa8mZEnTM7t",
+	"1DdK9TknVwvBrJe7urqFmaxEtGF2TMWxzD",
+	"16DpovNuhQJH7JUSZQFLBQgQYS4QB9Wy8e",
+	"17qK2RPGZMDcci2BLQ6Ry2PDGJErrNojT5",
+	"1GxfdfP286uE24qLZ9YRP3EWk2urqXgC4s",
+}
+
+// Alice's notification transaction to Bob in the BIP, the key of its
+// designated input, and the payload it carries.
+const (
+	specDesignatedKey  = "Kx983SRhAZpAhj7Aac1wUXMJ6XZeyJKqCxJJ49dxEbYCT4a1ozRD"
+	specPayload        = "010002063e4eb95e62791b06c50e1a3a942e1ecaaa9afbbeb324d16ae6821e091611fa96c0cf048f607fe51a0327f5e2528979311c78cb2de0d682c61e1180fc3d543b00000000000000000000000000"
+	specNotificationTx = "010000000186f411ab1c8e70ae8a0795ab7a6757aea6e4d5ae1826fc7b8f00c597d500609c010000006b483045022100ac8c6dbc482c79e86c18928a8b364923c774bfdbd852059f6b3778f2319b59a7022029d7cc5724e2f41ab1fcfc0ba5a0d4f57ca76f72f19530ba97c860c70a6bf0a801210272d83d8a1fa323feab1c085157a0791b46eba34afb8bfbfaeb3a3fcc3f2c9ad8ffffffff0210270000000000001976a9148066a8e7ee82e5c5b9b7dc1765038340dc5420a988ac1027000000000000536a4c50010002063e4eb95e62791b06c50e1a3a942e1ecaaa9afbbeb324d16ae6821e091611fa96c0cf048f607fe51a0327f5e2528979311c78cb2de0d682c61e1180fc3d543b0000000000000000000000000000000000"
+)
+
+// mustDecodeHex decodes hex the package embeds, which is known to be valid.
+func mustDecodeHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// deriveAccount derives account 0 of the wallet of the seed.
+func deriveAccount(seed []byte, net derivation.Network) (*Account, error) {
+	master, err := bip32.NewMaster(seed, net.Keys)
+	if err != nil {
+		return nil, err
+	}
+	return DeriveAccount(master, net, 0)
+}
+
+// mustDeriveAccount derives account 0 of the wallet of a seed the package
+// makes, which is known to be valid.
+func mustDeriveAccount(seed []byte, net derivation.Network) *Account {
+	a, err := deriveAccount(seed, net)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
+// newVector derives the vector of the i-th payment between the wallets of
+// the seeds.
+func newVector(net derivation.Network, senderSeed, recipientSeed []byte,
+	i uint32, comment string) Vector {
+
+	sender := mustDeriveAccount(senderSeed, net)
+	recipient := mustDeriveAccount(recipientSeed, net)
+	code := recipient.PaymentCode()
+	secret, err := sender.SendSecret(code, i)
+	if err != nil {
+		panic(err)
+	}
+	addr, err := sender.SendAddress(code, i)
+	if err != nil {
+		panic(err)
+	}
+	return Vector{
+		Net:           net,
+		SenderSeed:    senderSeed,
+		RecipientSeed: recipientSeed,
+		SenderCode:    sender.PaymentCode().String(),
+		RecipientCode: code.String(),
+		Index:         i,
+		SharedSecret:  secret,
+		Address:       addr,
+		Comment:       comment,
+	}
+}
+
+// SpecVectors returns the first ten payments from Alice to Bob of the BIP's
+// vectors. It panics if the package doesn't give the BIP's codes and
+// addresses.
+func SpecVectors() []Vector {
+	alice := bip39.NewSeed(aliceMnemonic, "")
+	bob := bip39.NewSeed(bobMnemonic, "")
+	var vectors []Vector
+	for i, addr := range specAddresses {
+		v := newVector(derivation.Mainnet, alice, bob, uint32(i),
+			fmt.Sprintf("Alice's payment %d to Bob", i))
+		if v.SenderCode != aliceCode || v.RecipientCode != bobCode ||
+			v.Address != addr {
+
+			panic(fmt.Sprintf("paymentcode: %v: %v, %v, %v",
+				v.Comment, v.SenderCode, v.RecipientCode,
+				v.Address))
+		}
+		vectors = append(vectors, v)
+	}
+	return vectors
+}
+
+// networks are the networks of the random vectors.
+var networks = []derivation.Network{derivation.Mainnet, derivation.Testnet}
+
+// randomSeed returns a random seed of a random length the BIP 32 allows.
+func randomSeed(rng *rand.Rand) []byte {
+	seed := make([]byte, bip32.MinSeedLen+rng.Intn(
+		bip32.MaxSeedLen-bip32.MinSeedLen+1))
+	rng.Read(seed)
+	return seed
+}
+
+// RandomVectors returns vectors of count pairs of random wallets derived
+// from a math/rand source with the seed, on a random network: the first two
+// payments from one to the other, a payment of a random index, and the
+// first payment back.
+func RandomVectors(rngSeed int64, count int) []Vector {
+	rng := rand.New(rand.NewSource(rngSeed))
+	var vectors []Vector
+	for n := 0; n < count; n++ {
+		net := networks[rng.Intn(len(networks))]
+		sender, recipient := randomSeed(rng), randomSeed(rng)
+		i := uint32(rng.Int31())
+		vectors = append(vectors,
+			newVector(net, sender, recipient, 0, "First payment"),
+			newVector(net, sender, recipient, 1, "Second payment"),
+			newVector(net, sender, recipient, i, fmt.Sprintf(
+				"Payment %d", i)),
+			newVector(net, recipient, sender, 0, "First payment "+
+				"back"),
+		)
+	}
+	return vectors
+}
+
+// CheckVector derives the wallets of the vector, and checks their codes,
+// and that the sender pays the address that the recipient derives from the
+// sender's code.
+func CheckVector(v Vector) error {
+	sender, err := deriveAccount(v.SenderSeed, v.Net)
+	if err != nil {
+		return err
+	}
+	recipient, err := deriveAccount(v.RecipientSeed, v.Net)
+	if err != nil {
+		return err
+	}
+	senderCode, recipientCode := sender.PaymentCode(),
+		recipient.PaymentCode()
+	if senderCode.String() != v.SenderCode ||
+		recipientCode.String() != v.RecipientCode {
+
+		return fmt.Errorf("%w: codes %v and %v, expected %v and %v",
+			ErrVectorMismatch, senderCode, recipientCode,
+			v.SenderCode, v.RecipientCode)
+	}
+
+	secret, err := sender.SendSecret(recipientCode, v.Index)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(secret, v.SharedSecret) {
+		return fmt.Errorf("%w: shared secret %x, expected %x",
+			ErrVectorMismatch, secret, v.SharedSecret)
+	}
+	sent, err := sender.SendAddress(recipientCode, v.Index)
+	if err != nil {
+		return err
+	}
+	received, err := recipient.ReceiveAddress(senderCode, v.Index)
+	if err != nil {
+		return err
+	}
+	if sent != v.Address || received != v.Address {
+		return fmt.Errorf("%w: sent to %v and received at %v, "+
+			"expected %v", ErrVectorMismatch, sent, received,
+			v.Address)
+	}
+	return nil
+}
+
+// serializeTx returns the serialization of the transaction.
+func serializeTx(tx *wire.MsgTx) []byte {
+	var b bytes.Buffer
+	if err := tx.Serialize(&b); err != nil {
+		panic(err)
+	}
+	return b.Bytes()
+}
+
+// newNotificationVector returns the vector of the notification transaction
+// from the sender to the recipient, whose designated input spends the
+// outpoint with the secret key, or of the transaction only.
+func newNotificationVector(net derivation.Network, senderSeed,
+	recipientSeed, secKey, payload []byte, tx *wire.MsgTx,
+	comment string) NotificationVector {
+
+	sender := mustDeriveAccount(senderSeed, net)
+	recipient := mustDeriveAccount(recipientSeed, net)
+	notification, err := recipient.NotificationAddress()
+	if err != nil {
+		panic(err)
+	}
+	v := NotificationVector{
+		Net:           net,
+		SenderSeed:    senderSeed,
+		RecipientSeed: recipientSeed,
+		SenderCode:    sender.PaymentCode().String(),
+		Notification:  notification,
+		SecKey:        secKey,
+		Payload:       payload,
+		Tx:            serializeTx(tx),
+		Comment:       comment,
+	}
+	code, err := recipient.ReadNotification(tx)
+	if err == nil && code.String() != v.SenderCode {
+		panic(fmt.Sprintf("paymentcode: %v: read %v", comment, code))
+	}
+	v.Err = err
+	return v
+}
+
+// specNotificationVector returns the vector of Alice's notification
+// transaction to Bob. It panics if the package doesn't give the BIP's
+// payload.
+func specNotificationVector() NotificationVector {
+	wif, err := base58.DecodeWIF(specDesignatedKey)
+	if err != nil {
+		panic(err)
+	}
+	tx := &wire.MsgTx{}
+	err = tx.Deserialize(bytes.NewReader(mustDecodeHex(
+		specNotificationTx)))
+	if err != nil {
+		panic(err)
+	}
+	alice := bip39.NewSeed(aliceMnemonic, "")
+	bob := bip39.NewSeed(bobMnemonic, "")
+	payload, err := mustDeriveAccount(alice, derivation.Mainnet).
+		NotificationPayload(mustDeriveAccount(bob,
+			derivation.Mainnet).PaymentCode(), wif.Key,
+			tx.TxIn[0].PreviousOutPoint)
+	if err != nil {
+		panic(err)
+	}
+	if !bytes.Equal(payload, mustDecodeHex(specPayload)) {
+		panic(fmt.Sprintf("paymentcode: spec payload %x", payload))
+	}
+	v := newNotificationVector(derivation.Mainnet, alice, bob, wif.Key,
+		payload, tx, "Alice's notification transaction to Bob")
+	if v.Notification != bobNotification || v.Err != nil {
+		panic(fmt.Sprintf("paymentcode: spec notification %v, %v",
+			v.Notification, v.Err))
+	}
+	return v
+}
+
+// Kinds of the designated inputs of the random notification vectors.
+const (
+	pubKeyHashInput = iota
+	witnessInput
+	nestedWitnessInput
+	numInputKinds
+)
+
+// inputNames describe the kinds of designated inputs.
+var inputNames = []string{"P2PKH", "P2WPKH", "P2SH-P2WPKH"}
+
+// randomSecKey returns a random valid secret key.
+func randomSecKey(rng *rand.Rand) []byte {
+	for {
+		secKey := make([]byte, 32)
+		rng.Read(secKey)
+		var d btcec.ModNScalar
+		if !d.SetByteSlice(secKey) && !d.IsZero() {
+			return secKey
+		}
+	}
+}
+
+// randomOutPoint returns a random outpoint.
+func randomOutPoint(rng *rand.Rand) wire.OutPoint {
+	var hash chainhash.Hash
+	rng.Read(hash[:])
+	return wire.OutPoint{Hash: hash, Index: uint32(rng.Intn(4))}
+}
+
+// prevScript returns the script of the output of the kind paying the key,
+// and the witness program of P2SH-P2WPKH outputs.
+func prevScript(kind int, pubKey []byte) ([]byte, []byte) {
+	program := append([]byte{txscript.OP_0, txscript.OP_DATA_20},
+		hash160(pubKey)...)
+	switch kind {
+	case witnessInput:
+		return program, nil
+	case nestedWitnessInput:
+		script := append([]byte{txscript.OP_HASH160,
+			txscript.OP_DATA_20}, hash160(program)...)
+		return append(script, txscript.OP_EQUAL), program
+	}
+	script := append([]byte{txscript.OP_DUP, txscript.OP_HASH160,
+		txscript.OP_DATA_20}, hash160(pubKey)...)
+	return append(script, txscript.OP_EQUALVERIFY, txscript.OP_CHECKSIG),
+		nil
+}
+
+// signInput signs the input of the transaction spending an output of the
+// kind of the secret key, whose previous outputs the fetcher has.
+func signInput(tx *wire.MsgTx, i, kind int, secKey []byte,
+	fetcher txscript.PrevOutputFetcher) {
+
+	priv, pub := btcec.PrivKeyFromBytes(secKey)
+	script, program := prevScript(kind, pub.SerializeCompressed())
+	in := tx.TxIn[i]
+	if kind == pubKeyHashInput {
+		sigScript, err := txscript.SignatureScript(tx, i, script,
+			txscript.SigHashAll, priv, true)
+		if err != nil {
+			panic(err)
+		}
+		in.SignatureScript = sigScript
+		return
+	}
+	if program == nil {
+		program = script
+	}
+	amount := fetcher.FetchPrevOutput(in.PreviousOutPoint).Value
+	witness, err := txscript.WitnessSignature(tx,
+		txscript.NewTxSigHashes(tx, fetcher), i, amount, program,
+		txscript.SigHashAll, priv, true)
+	if err != nil {
+		panic(err)
+	}
+	in.Witness = witness
+	if kind == nestedWitnessInput {
+		in.SignatureScript = append([]byte{byte(len(program))},
+			program...)
+	}
+}
+
+// randomNotificationTx returns a signed notification transaction from the
+// sender to the recipient, whose designated input of the kind spends a
+// random outpoint with the secret key. If taproot is set, a P2TR input,
+// which exposes no key, comes before the designated one.
+func randomNotificationTx(rng *rand.Rand, sender *Account,
+	recipient *PaymentCode, kind int, secKey []byte,
+	taproot bool) *wire.MsgTx {
+
+	change := make([]byte, 20)
+	rng.Read(change)
+	tx, err := sender.NotificationTx(recipient, randomOutPoint(rng), secKey,
+		wire.NewTxOut(rng.Int63n(1e8), append([]byte{txscript.OP_0,
+			txscript.OP_DATA_20}, change...)))
+	if err != nil {
+		panic(err)
+	}
+
+	fetcher := txscript.NewMultiPrevOutFetcher(nil)
+	designated := 0
+	if taproot {
+		op := randomOutPoint(rng)
+		outputKey := make([]byte, 32)
+		rng.Read(outputKey)
+		sig := make([]byte, 64)
+		rng.Read(sig)
+		tx.TxIn = append([]*wire.TxIn{wire.NewTxIn(&op, nil,
+			wire.TxWitness{sig})}, tx.TxIn...)
+		fetcher.AddPrevOut(op, wire.NewTxOut(rng.Int63n(1e8),
+			append([]byte{txscript.OP_1, txscript.OP_DATA_32},
+				outputKey...)))
+		designated = 1
+	}
+	_, pub := btcec.PrivKeyFromBytes(secKey)
+	script, _ := prevScript(kind, pub.SerializeCompressed())
+	fetcher.AddPrevOut(tx.TxIn[designated].PreviousOutPoint,
+		wire.NewTxOut(1e5+rng.Int63n(1e8), script))
+	signInput(tx, designated, kind, secKey, fetcher)
+	return tx
+}
+
+// NotificationVectors returns vectors of notification transactions: Alice's
+// to Bob of the BIP, followed by those between count pairs of random
+// wallets derived from a math/rand source with the seed, on a random
+// network, whose designated inputs are of a random kind and now and then
+// come after an input that exposes no key. Transactions that reading fails
+// on follow. It panics if the package doesn't reproduce the BIP's
+// notification.
+func NotificationVectors(rngSeed int64, count int) []NotificationVector {
+	vectors := []NotificationVector{specNotificationVector()}
+	rng := rand.New(rand.NewSource(rngSeed))
+	for n := 0; n < count; n++ {
+		net := networks[rng.Intn(len(networks))]
+		senderSeed, recipientSeed := randomSeed(rng), randomSeed(rng)
+		sender := mustDeriveAccount(senderSeed, net)
+		recipient := mustDeriveAccount(recipientSeed, net)
+		code := recipient.PaymentCode()
+
+		kind := rng.Intn(numInputKinds)
+		taproot := rng.Intn(3) == 0
+		secKey := randomSecKey(rng)
+		tx := randomNotificationTx(rng, sender, code, kind, secKey,
+			taproot)
+		comment := inputNames[kind] + " designated input"
+		if taproot {
+			comment += " after a P2TR input"
+		}
+		payload, _ := notificationPayload(tx)
+		vectors = append(vectors, newNotificationVector(net,
+			senderSeed, recipientSeed, secKey, payload, tx,
+			comment))
+		if n > 0 {
+			continue
+		}
+
+		// The transactions that reading fails on are made from that of
+		// the first pair, and carry neither key nor payload.
+		invalid := func(recipientSeed []byte, comment string,
+			tamper func(tx *wire.MsgTx)) {
+
+			tampered := tx.Copy()
+			tamper(tampered)
+			vectors = append(vectors, newNotificationVector(net,
+				senderSeed, recipientSeed, nil, nil, tampered,
+				comment))
+		}
+		invalid(randomSeed(rng), "Notification to another recipient",
+			func(tx *wire.MsgTx) {})
+		invalid(recipientSeed, "No payment code output",
+			func(tx *wire.MsgTx) {
+				tx.TxOut = append(tx.TxOut[:1], tx.TxOut[2:]...)
+			})
+		invalid(recipientSeed, "Payment code output of 79 bytes",
+			func(tx *wire.MsgTx) {
+				script, err := txscript.NullDataScript(
+					payload[:PayloadSize-1])
+				if err != nil {
+					panic(err)
+				}
+				tx.TxOut[1].PkScript = script
+			})
+		invalid(recipientSeed, "No input exposing a key",
+			func(tx *wire.MsgTx) {
+				for _, in := range tx.TxIn {
+					in.SignatureScript, in.Witness = nil,
+						nil
+				}
+			})
+		invalid(recipientSeed, "Payment code of version 2",
+			func(tx *wire.MsgTx) {
+				tx.TxOut[1].PkScript[3] = 0x02
+			})
+		invalid(recipientSeed, "Payment code with sign byte 0x04",
+			func(tx *wire.MsgTx) {
+				tx.TxOut[1].PkScript[5] = 0x04
+			})
+	}
+	return vectors
+}
+
+// CheckNotificationVector derives the wallets of the vector, checks the
+// sender's code and the recipient's notification address, and that the
+// recipient reads the transaction as expected. A vector with a key is
+// blinded again.
+func CheckNotificationVector(v NotificationVector) error {
+	sender, err := deriveAccount(v.SenderSeed, v.Net)
+	if err != nil {
+		return err
+	}
+	recipient, err := deriveAccount(v.RecipientSeed, v.Net)
+	if err != nil {
+		return err
+	}
+	notification, err := recipient.NotificationAddress()
+	if err != nil {
+		return err
+	}
+	if code := sender.PaymentCode().String(); code != v.SenderCode ||
+		notification != v.Notification {
+
+		return fmt.Errorf("%w: code %v and notification address %v, "+
+			"expected %v and %v", ErrVectorMismatch, code,
+			notification, v.SenderCode, v.Notification)
+	}
+	tx := &wire.MsgTx{}
+	if err := tx.Deserialize(bytes.NewReader(v.Tx)); err != nil {
+		return err
+	}
+
+	if v.SecKey != nil {
+		i, _, err := DesignatedInput(tx)
+		if err != nil {
+			return err
+		}
+		payload, err := sender.NotificationPayload(
+			recipient.PaymentCode(), v.SecKey,
+			tx.TxIn[i].PreviousOutPoint)
+		if err != nil {
+			return err
+		}
+		carried, _ := notificationPayload(tx)
+		if !bytes.Equal(payload, v.Payload) ||
+			!bytes.Equal(carried, v.Payload) {
+
+			return fmt.Errorf("%w: payload %x carried as %x, "+
+				"expected %x", ErrVectorMismatch, payload,
+				carried, v.Payload)
+		}
+	}
+
+	code, err := recipient.ReadNotification(tx)
+	if !vectorfile.SameError(err, v.Err) {
+		return fmt.Errorf("%w: error %v, expected %v",
+			ErrVectorMismatch, err, v.Err)
+	}
+	if err == nil && code.String() != v.SenderCode {
+		return fmt.Errorf("%w: read %v, expected %v",
+			ErrVectorMismatch, code, v.SenderCode)
+	}
+	return nil
+}
+
+// InvalidVectors returns payment codes that Parse must reject, made by
+// corrupting Alice's code, so the same set is returned on every call.
+func InvalidVectors() []InvalidVector {
+	code, err := Parse(aliceCode)
+	if err != nil {
+		panic(err)
+	}
+	payload := code.Payload()
+
+	var invalid []InvalidVector
+	add := func(data []byte, comment string) {
+		_, err := Parse(base58.CheckEncode(data))
+		invalid = append(invalid, InvalidVector{
+			PaymentCode: base58.CheckEncode(data),
+			Err:         err,
+			Comment:     comment,
+		})
+	}
+	corrupt := func(comment string, f func(payload []byte)) {
+		data := append([]byte{Prefix}, payload...)
+		f(data[1:])
+		add(data, comment)
+	}
+
+	corrupt("Version 2", func(payload []byte) { payload[0] = 2 })
+	corrupt("Version 0", func(payload []byte) { payload[0] = 0 })
+	corrupt("Sign byte 0x04", func(payload []byte) { payload[2] = 4 })
+	corrupt("Key not on the curve", func(payload []byte) {
+		// x = 5 has no square root on secp256k1.
+		copy(payload[3:35], make([]byte, 32))
+		payload[34] = 5
+	})
+	corrupt("Reserved bytes set", func(payload []byte) {
+		payload[PayloadSize-1] = 1
+	})
+	add(append([]byte{Prefix + 1}, payload...), "Prefix 0x48")
+	add(append([]byte{Prefix}, payload[:PayloadSize-1]...),
+		"Truncated code")
+	add(append(append([]byte{Prefix}, payload...), 0), "Code with "+
+		"trailing data")
+
+	// A bad checksum can't be made by corrupting the payload.
+	s := []byte(aliceCode)
+	last := bytes.IndexByte([]byte(base58.Alphabet()), s[len(s)-1])
+	s[len(s)-1] = base58.Alphabet()[(last+1)%58]
+	_, err = Parse(string(s))
+	invalid = append(invalid, InvalidVector{
+		PaymentCode: string(s),
+		Err:         err,
+		Comment:     "Bad checksum",
+	})
+	for _, v := range invalid {
+		if v.Err == nil {
+			panic(fmt.Sprintf("paymentcode: %v parses", v.Comment))
+		}
+	}
+	return invalid
+}
+
+// CheckInvalidVector checks that Parse rejects the vector's code with the
+// expected error.
+func CheckInvalidVector(v InvalidVector) error {
+	_, err := Parse(v.PaymentCode)
+	if !vectorfile.SameError(err, v.Err) {
+		return fmt.Errorf("%w: %v gave %v, expected %v",
+			ErrVectorMismatch, v.PaymentCode, err, v.Err)
+	}
+	return nil
+}
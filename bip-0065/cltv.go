@@ -0,0 +1,262 @@
+// Package cltv implements OP_CHECKLOCKTIMEVERIFY, the opcode of BIP 65
+// that fails a script unless the transaction spending it is locked by its
+// nLockTime until at least the lock-time on top of the stack:
+//
+//	script := cltv.Script(800000)
+//	err := cltv.Execute(append(script, txscript.OP_TRUE), tx, 0, true)
+//
+// The operand is a script number of up to 5 bytes, so that all lock-times
+// up to 2^32 - 1 fit, and must not be negative. It must be of the same type
+// as the lock-time of the transaction, both heights below
+// LockTimeThreshold or both times from it on, and no later. The input
+// executing the opcode must not have the final sequence number, which
+// would leave the transaction without a lock-time, whatever its
+// nLockTime says. Operands past the largest lock-time fit in the 5 bytes but
+// never pass.
+//
+// Like OP_CHECKSEQUENCEVERIFY, the opcode leaves its operand on the stack,
+// so scripts usually drop it next. Execute runs scripts of pushes,
+// OP_CHECKLOCKTIMEVERIFY, OP_CHECKSEQUENCEVERIFY, checked by the csv
+// package, and OP_DROP, enough for scripts locked by either or both, and
+// the vectors are also checked against the script engine of btcd.
+package cltv
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	csv "github.com/christsim/bips/bip-0112"
+)
+
+const (
+	// MaxOperandLen is the size of the largest operand, in bytes.
+	MaxOperandLen = 5
+
+	// LockTimeThreshold is the lowest lock-time that is a time rather
+	// than a height.
+	LockTimeThreshold = 500000000
+)
+
+var (
+	// ErrEmptyStack is returned when OP_CHECKLOCKTIMEVERIFY,
+	// OP_CHECKSEQUENCEVERIFY or OP_DROP executes on an empty stack.
+	ErrEmptyStack = errors.New("cltv: empty stack")
+
+	// ErrOperandTooLong is returned for an operand longer than
+	// MaxOperandLen.
+	ErrOperandTooLong = errors.New("cltv: operand too long")
+
+	// ErrMinimalData is returned, when minimal encodings are required,
+	// for an operand or a push that isn't minimally encoded.
+	ErrMinimalData = errors.New("cltv: non-minimal encoding")
+
+	// ErrNegativeLockTime is returned for a negative operand.
+	ErrNegativeLockTime = errors.New("cltv: negative lock-time")
+
+	// ErrUnsatisfiedLockTime is returned when the transaction isn't
+	// locked until the operand.
+	ErrUnsatisfiedLockTime = errors.New("cltv: unsatisfied lock-time")
+
+	// ErrUnsupportedOpcode is returned by Execute for an opcode it doesn't
+	// run, or one that fails to parse.
+	ErrUnsupportedOpcode = errors.New("cltv: unsupported opcode")
+
+	// ErrEvalFalse is returned by Execute for a script that leaves an
+	// empty stack or false on top of it.
+	ErrEvalFalse = errors.New("cltv: script evaluated false")
+
+	// ErrInputIndex is returned for an input the transaction doesn't
+	// have.
+	ErrInputIndex = errors.New("cltv: input index out of range")
+)
+
+// IsHeight reports whether the lock-time is a height rather than a time.
+func IsHeight(lockTime int64) bool {
+	return lockTime < LockTimeThreshold
+}
+
+// Script returns the script locking an output until the lock-time, a height
+// or a time, followed by OP_CHECKLOCKTIMEVERIFY and OP_DROP, to which the
+// rest of the locking script is appended.
+func Script(lockTime uint32) []byte {
+	script, _ := txscript.NewScriptBuilder().
+		AddInt64(int64(lockTime)).
+		AddOp(txscript.OP_CHECKLOCKTIMEVERIFY).
+		AddOp(txscript.OP_DROP).
+		Script()
+	return script
+}
+
+// ParseOperand returns the value of the operand, a little endian script
+// number whose top bit is its sign, of at most MaxOperandLen bytes. If
+// requireMinimal is set, it must have no extra zero bytes.
+func ParseOperand(b []byte, requireMinimal bool) (int64, error) {
+	if len(b) > MaxOperandLen {
+		return 0, fmt.Errorf("%w: %d bytes", ErrOperandTooLong, len(b))
+	}
+	if len(b) == 0 {
+		return 0, nil
+	}
+
+	// The last byte can only be zero, or the sign bit alone, if the byte
+	// before needs its top bit.
+	last := b[len(b)-1]
+	if requireMinimal && last&0x7f == 0 &&
+		(len(b) == 1 || b[len(b)-2]&0x80 == 0) {
+
+		return 0, fmt.Errorf("%w: operand %x", ErrMinimalData, b)
+	}
+
+	var n int64
+	for i, c := range b {
+		n |= int64(c) << (8 * i)
+	}
+	if last&0x80 != 0 {
+		n &^= 0x80 << (8 * (len(b) - 1))
+		n = -n
+	}
+	return n, nil
+}
+
+// Verify checks the transaction, spent by its input at index i, against the
+// operand of OP_CHECKLOCKTIMEVERIFY.
+func Verify(tx *wire.MsgTx, i int, operand int64) error {
+	if operand < 0 {
+		return fmt.Errorf("%w: %d", ErrNegativeLockTime, operand)
+	}
+	if operand > math.MaxUint32 {
+		return fmt.Errorf("%w: lock-time %d past the largest",
+			ErrUnsatisfiedLockTime, operand)
+	}
+
+	lockTime := int64(tx.LockTime)
+	if IsHeight(operand) != IsHeight(lockTime) {
+		return fmt.Errorf("%w: lock-time %d, transaction locked "+
+			"until %d, of the other type", ErrUnsatisfiedLockTime,
+			operand, lockTime)
+	}
+	if operand > lockTime {
+		return fmt.Errorf("%w: lock-time %d, transaction locked "+
+			"until %d", ErrUnsatisfiedLockTime, operand, lockTime)
+	}
+
+	if i < 0 || i >= len(tx.TxIn) {
+		return fmt.Errorf("%w: %d of %d", ErrInputIndex, i,
+			len(tx.TxIn))
+	}
+	if tx.TxIn[i].Sequence == wire.MaxTxInSequenceNum {
+		return fmt.Errorf("%w: input final", ErrUnsatisfiedLockTime)
+	}
+	return nil
+}
+
+// isMinimalPush reports whether the data push opcode is the smallest push
+// of its data.
+func isMinimalPush(op byte, data []byte) bool {
+	switch {
+	case len(data) == 0:
+		return op == txscript.OP_0
+	case len(data) == 1 && data[0] >= 1 && data[0] <= 16:
+		return op == txscript.OP_1+data[0]-1
+	case len(data) == 1 && data[0] == 0x81:
+		return op == txscript.OP_1NEGATE
+	case len(data) <= txscript.OP_DATA_75:
+		return int(op) == len(data)
+	case len(data) <= 0xff:
+		return op == txscript.OP_PUSHDATA1
+	case len(data) <= 0xffff:
+		return op == txscript.OP_PUSHDATA2
+	}
+	return true
+}
+
+// pushedData returns the data a push opcode pushes, with the small integer
+// opcodes pushing their number.
+func pushedData(op byte, data []byte) ([]byte, bool) {
+	switch {
+	case op <= txscript.OP_PUSHDATA4:
+		return data, true
+	case op == txscript.OP_1NEGATE:
+		return []byte{0x81}, true
+	case op >= txscript.OP_1 && op <= txscript.OP_16:
+		return []byte{op - txscript.OP_1 + 1}, true
+	}
+	return nil, false
+}
+
+// isTrue reports whether the stack item is true: not all zero bytes but
+// for a sign bit in the last.
+func isTrue(item []byte) bool {
+	for i, c := range item {
+		if c != 0 && (i < len(item)-1 || c != 0x80) {
+			return true
+		}
+	}
+	return false
+}
+
+// Execute runs the script, spent by the input of the transaction at index
+// i, from an empty stack, and checks that it leaves true on top. The script
+// may only push data, run OP_CHECKLOCKTIMEVERIFY, OP_CHECKSEQUENCEVERIFY
+// and OP_DROP. If requireMinimal is set, pushes and operands must be
+// minimally encoded.
+func Execute(script []byte, tx *wire.MsgTx, i int,
+	requireMinimal bool) error {
+
+	var stack [][]byte
+	tokenizer := txscript.MakeScriptTokenizer(0, script)
+	for tokenizer.Next() {
+		op, data := tokenizer.Opcode(), tokenizer.Data()
+		if item, ok := pushedData(op, data); ok {
+			if requireMinimal && op <= txscript.OP_PUSHDATA4 &&
+				!isMinimalPush(op, data) {
+
+				return fmt.Errorf("%w: push of %x",
+					ErrMinimalData, data)
+			}
+			stack = append(stack, item)
+			continue
+		}
+
+		switch op {
+		case txscript.OP_CHECKLOCKTIMEVERIFY,
+			txscript.OP_CHECKSEQUENCEVERIFY:
+
+			if len(stack) == 0 {
+				return ErrEmptyStack
+			}
+			operand, err := ParseOperand(stack[len(stack)-1],
+				requireMinimal)
+			if err != nil {
+				return err
+			}
+			if op == txscript.OP_CHECKSEQUENCEVERIFY {
+				err = csv.Verify(tx, i, operand)
+			} else {
+				err = Verify(tx, i, operand)
+			}
+			if err != nil {
+				return err
+			}
+		case txscript.OP_DROP:
+			if len(stack) == 0 {
+				return ErrEmptyStack
+			}
+			stack = stack[:len(stack)-1]
+		default:
+			return fmt.Errorf("%w: %02x at offset %d",
+				ErrUnsupportedOpcode, op, tokenizer.ByteIndex())
+		}
+	}
+	if err := tokenizer.Err(); err != nil {
+		return fmt.Errorf("%w: %v", ErrUnsupportedOpcode, err)
+	}
+
+	if len(stack) == 0 || !isTrue(stack[len(stack)-1]) {
+		return ErrEvalFalse
+	}
+	return nil
+}
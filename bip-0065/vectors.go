@@ -0,0 +1,256 @@
+package cltv
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	sequencelock "github.com/christsim/bips/bip-0068"
+	"github.com/christsim/bips/internal/vectorfile"
+)
+
+// ErrVectorMismatch is returned by CheckScriptVector when executing the
+// script of a vector, with the package or the script engine of btcd,
+// doesn't give the expected result.
+var ErrVectorMismatch = errors.New("cltv: vector mismatch")
+
+// ScriptVector is a script spent by the only input of a transaction of the
+// version and lock-time, whose sequence number is passed, and the error
+// executing it gives, nil if it passes.
+type ScriptVector struct {
+	Version  int32
+	LockTime uint32
+	Sequence uint32
+	Script   []byte
+
+	// MinimalData tells whether pushes and operands must be minimally
+	// encoded, as they must for standard transactions.
+	MinimalData bool
+
+	Err error
+
+	// Comment describes what the vector exercises.
+	Comment string
+}
+
+// spendTx returns a transaction of the version and lock-time whose only
+// input has the sequence number.
+func spendTx(version int32, lockTime, sequence uint32) *wire.MsgTx {
+	tx := wire.NewMsgTx(version)
+	tx.LockTime = lockTime
+	txIn := wire.NewTxIn(&wire.OutPoint{}, nil, nil)
+	txIn.Sequence = sequence
+	tx.AddTxIn(txIn)
+	tx.AddTxOut(wire.NewTxOut(0, nil))
+	return tx
+}
+
+// newScriptVector returns the vector of the script spent by the transaction.
+func newScriptVector(version int32, lockTime, sequence uint32,
+	script []byte, minimalData bool, comment string) ScriptVector {
+
+	tx := spendTx(version, lockTime, sequence)
+	return ScriptVector{
+		Version:     version,
+		LockTime:    lockTime,
+		Sequence:    sequence,
+		Script:      script,
+		MinimalData: minimalData,
+		Err:         Execute(script, tx, 0, minimalData),
+		Comment:     comment,
+	}
+}
+
+// lockScript returns the script checking the operand with
+// OP_CHECKLOCKTIMEVERIFY, then dropping it and pushing true.
+func lockScript(operand int64) []byte {
+	script, _ := txscript.NewScriptBuilder().
+		AddInt64(operand).
+		AddOp(txscript.OP_CHECKLOCKTIMEVERIFY).
+		AddOp(txscript.OP_DROP).
+		AddOp(txscript.OP_TRUE).
+		Script()
+	return script
+}
+
+// rawLockScript returns the lock script of the operand as the raw push
+// opcodes.
+func rawLockScript(push ...byte) []byte {
+	return append(push, txscript.OP_CHECKLOCKTIMEVERIFY,
+		txscript.OP_DROP, txscript.OP_TRUE)
+}
+
+// ScriptVectors returns vectors of scripts checking lock-times with
+// OP_CHECKLOCKTIMEVERIFY, spent by transactions that satisfy them and that
+// don't: locked until too early, by a lock-time of the other type or with
+// the input final. They are followed by the edge cases of operands, their
+// encodings and the scripts around them, with OP_CHECKSEQUENCEVERIFY too,
+// and count random operands spent by random transactions derived from a
+// math/rand source with the seed. All follow the standard rules requiring
+// minimal encodings, and the encodings also the consensus rules that don't.
+func ScriptVectors(rngSeed int64, count int) []ScriptVector {
+	const (
+		final     = wire.MaxTxInSequenceNum
+		nonFinal  = wire.MaxTxInSequenceNum - 1
+		threshold = LockTimeThreshold
+		t         = 1600000000
+	)
+
+	var vectors []ScriptVector
+	add := func(lockTime, sequence uint32, script []byte,
+		comment string) {
+
+		vectors = append(vectors, newScriptVector(2, lockTime,
+			sequence, script, true, comment))
+	}
+
+	for _, c := range []struct {
+		operand  int64
+		lockTime uint32
+		sequence uint32
+		comment  string
+	}{
+		{100, 100, nonFinal, "Height 100, locked until 100"},
+		{100, 101, nonFinal, "Height 100, locked until 101"},
+		{100, 99, nonFinal, "Height 100, locked until 99"},
+		{t, t, nonFinal, "Time, locked until then"},
+		{t, t + 1, nonFinal, "Time, locked until a second later"},
+		{t, t - 1, nonFinal, "Time, locked until a second earlier"},
+		{0, 0, nonFinal, "Height 0, lock-time 0"},
+		{0, 0, final, "Height 0, lock-time 0, input final"},
+		{100, 100, final, "Input final"},
+		{100, 100, 0, "Input of sequence number 0"},
+		{100, 100, final - 1, "Input final but one"},
+		{threshold - 1, threshold - 1, nonFinal, "Largest height"},
+		{threshold, threshold, nonFinal, "Smallest time"},
+		{threshold - 1, threshold, nonFinal,
+			"Largest height, locked until smallest time"},
+		{threshold, threshold - 1, nonFinal,
+			"Smallest time, locked until largest height"},
+		{100, t, nonFinal, "Height, locked until a time"},
+		{t, 100, nonFinal, "Time, locked until a height"},
+		{0xffffffff, 0xffffffff, nonFinal, "Largest lock-time"},
+		{1 << 32, 0xffffffff, nonFinal, "Past the largest lock-time"},
+		{1<<39 - 1, 0xffffffff, nonFinal, "Largest operand"},
+		{-1, 100, nonFinal, "Negative operand"},
+		{-100, 100, nonFinal, "Negative height 100"},
+	} {
+		add(c.lockTime, c.sequence, lockScript(c.operand), c.comment)
+	}
+
+	// Scripts around the opcode, and along with OP_CHECKSEQUENCEVERIFY
+	// on an input locked for 10 blocks.
+	cltv := byte(txscript.OP_CHECKLOCKTIMEVERIFY)
+	csv := byte(txscript.OP_CHECKSEQUENCEVERIFY)
+	blocks := func(n int64) byte {
+		return byte(txscript.OP_1 + n - 1)
+	}
+	for _, c := range []struct {
+		script  []byte
+		comment string
+	}{
+		{[]byte{cltv}, "Empty stack"},
+		{[]byte{blocks(10), cltv}, "Operand left on stack"},
+		{[]byte{txscript.OP_0, cltv}, "Zero operand left on stack"},
+		{[]byte{blocks(10), cltv, txscript.OP_DROP},
+			"Operand dropped, empty stack"},
+		{append(Script(100), txscript.OP_1), "Script of height 100"},
+		{append(Script(101), txscript.OP_1), "Script of height 101"},
+		{[]byte{txscript.OP_1, blocks(10), cltv, txscript.OP_DROP,
+			blocks(10), csv, txscript.OP_DROP},
+			"Lock-time and sequence lock"},
+		{[]byte{txscript.OP_1, blocks(10), cltv, txscript.OP_DROP,
+			blocks(11), csv, txscript.OP_DROP},
+			"Lock-time, sequence lock too long"},
+		{[]byte{txscript.OP_1, blocks(11), cltv, txscript.OP_DROP,
+			blocks(10), csv, txscript.OP_DROP},
+			"Lock-time too late, sequence lock"},
+		{[]byte{txscript.OP_1, blocks(5), cltv, blocks(10), cltv,
+			txscript.OP_DROP, txscript.OP_DROP},
+			"Two lock-times"},
+	} {
+		add(10, 10, c.script, c.comment)
+	}
+	vectors = append(vectors, newScriptVector(1, 10, 10,
+		[]byte{txscript.OP_1, blocks(10), cltv, txscript.OP_DROP,
+			blocks(10), csv, txscript.OP_DROP},
+		true, "Lock-time and sequence lock, version 1"))
+
+	// Operands encoded in odd ways, by the bytes of the push, which only
+	// the consensus rules accept.
+	for _, minimalData := range []bool{true, false} {
+		for _, c := range []struct {
+			push     []byte
+			lockTime uint32
+			comment  string
+		}{
+			{[]byte{0x01, 0x0a}, 10, "10 pushed as data"},
+			{[]byte{0x02, 0x0a, 0x00}, 10, "10 padded to 2 bytes"},
+			{[]byte{0x4c, 0x01, 0x0a}, 10,
+				"10 pushed by PUSHDATA1"},
+			{[]byte{0x01, 0x80}, 0, "Negative zero"},
+			{[]byte{0x05, 0x0a, 0x00, 0x00, 0x00, 0x00}, 10,
+				"10 padded to 5 bytes"},
+			{[]byte{0x06, 0x0a, 0x00, 0x00, 0x00, 0x00, 0x00}, 10,
+				"10 padded to 6 bytes"},
+			{[]byte{0x05, 0xff, 0xff, 0xff, 0xff, 0x00},
+				0xffffffff, "Largest, sign byte needed"},
+		} {
+			comment := c.comment
+			if !minimalData {
+				comment += ", non-minimal allowed"
+			}
+			vectors = append(vectors, newScriptVector(2,
+				c.lockTime, nonFinal, rawLockScript(c.push...),
+				minimalData, comment))
+		}
+	}
+
+	rng := rand.New(rand.NewSource(rngSeed))
+	for n := 0; n < count; n++ {
+		operand := int64(rng.Intn(1000))
+		lockTime := uint32(rng.Intn(1000))
+		if rng.Intn(2) == 0 {
+			operand += t
+		}
+		if rng.Intn(2) == 0 {
+			lockTime += t
+		}
+		sequence := nonFinal - uint32(rng.Intn(2))
+		if rng.Intn(4) == 0 {
+			sequence = uint32(rng.Intn(sequencelock.ValueMask))
+		}
+		add(lockTime, sequence, lockScript(operand), "Random")
+	}
+	return vectors
+}
+
+// CheckScriptVector executes the script of the vector with Execute and
+// with the script engine of btcd, which must agree on whether it passes.
+func CheckScriptVector(v ScriptVector) error {
+	tx := spendTx(v.Version, v.LockTime, v.Sequence)
+	err := Execute(v.Script, tx, 0, v.MinimalData)
+	if !vectorfile.SameError(err, v.Err) {
+		return fmt.Errorf("%w: error %v, expected %v",
+			ErrVectorMismatch, err, v.Err)
+	}
+
+	flags := txscript.ScriptVerifyCheckLockTimeVerify |
+		txscript.ScriptVerifyCheckSequenceVerify
+	if v.MinimalData {
+		flags |= txscript.ScriptVerifyMinimalData
+	}
+	fetcher := txscript.NewCannedPrevOutputFetcher(v.Script, 0)
+	vm, err := txscript.NewEngine(v.Script, tx, 0, flags, nil, nil, 0,
+		fetcher)
+	if err == nil {
+		err = vm.Execute()
+	}
+	if (err == nil) != (v.Err == nil) {
+		return fmt.Errorf("%w: btcd gives error %v, expected %v",
+			ErrVectorMismatch, err, v.Err)
+	}
+	return nil
+}
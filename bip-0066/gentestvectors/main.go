@@ -0,0 +1,160 @@
+// This program writes test vectors for the strictder package to
+// signatures.json: signatures of real keys and the edge cases of their
+// encoding, which BIP 66 accepts, and signatures subtly broken by mistaken
+// lengths and tags, missing and trailing bytes, and integers empty,
+// negative and padded, which it doesn't, followed by random signatures,
+// broken in random ways or not. The vectors depend only on -seed and
+// -count, so they can be regenerated by anyone:
+//
+//	gentestvectors -count 50 -seed 66
+//
+// The file uses the layout of the BIP 158 vectors: a JSON array whose first
+// row names the columns, followed by one row per vector. Each vector is a
+// signature in hex, sighash type byte included, and the error checking it
+// gives, empty if it is strictly DER encoded. Pass -check to verify an
+// existing file against the package, and against the script engine of
+// btcd, instead:
+//
+//	gentestvectors -check signatures.json
+//
+// The program lives in a directory of its own since the strictder package
+// sits at the root of the module.
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	strictder "github.com/christsim/bips/bip-0066"
+	"github.com/christsim/bips/internal/vectorfile"
+)
+
+// encodingColumns is the header row of the vector file.
+const encodingColumns = "Signature,Error,Comment"
+
+type JSONTestWriter struct {
+	writer          io.Writer
+	firstRowWritten bool
+}
+
+func NewJSONTestWriter(writer io.Writer) *JSONTestWriter {
+	return &JSONTestWriter{writer: writer}
+}
+
+func (w *JSONTestWriter) WriteComment(comment string) error {
+	return w.WriteTestCase([]interface{}{comment})
+}
+
+func (w *JSONTestWriter) WriteTestCase(row []interface{}) error {
+	var err error
+	if w.firstRowWritten {
+		_, err = io.WriteString(w.writer, ",\n")
+	} else {
+		_, err = io.WriteString(w.writer, "[\n")
+		w.firstRowWritten = true
+	}
+	if err != nil {
+		return err
+	}
+
+	rowBytes, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.writer.Write(rowBytes)
+	return err
+}
+
+func (w *JSONTestWriter) Close() error {
+	if !w.firstRowWritten {
+		return nil
+	}
+
+	_, err := io.WriteString(w.writer, "\n]\n")
+	return err
+}
+
+func main() {
+	out := flag.String("out", "signatures.json", "file to write the "+
+		"vectors to")
+	count := flag.Int("count", 50, "number of random signatures to "+
+		"write vectors of")
+	seed := flag.Int64("seed", 66, "seed of the random vectors")
+	check := flag.String("check", "", "vector file to check instead of "+
+		"writing one")
+	flag.Parse()
+
+	var err error
+	if *check != "" {
+		err = checkFile(*check)
+	} else {
+		err = writeFile(*out, *seed, *count)
+	}
+	if err != nil {
+		fmt.Println("Error: ", err.Error())
+		os.Exit(1)
+	}
+}
+
+// writeFile writes the vectors, with count random ones, to out.
+func writeFile(out string, seed int64, count int) error {
+	file, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := NewJSONTestWriter(file)
+	if err := writer.WriteComment(encodingColumns); err != nil {
+		return err
+	}
+	vectors := strictder.EncodingVectors(seed, count)
+	for _, v := range vectors {
+		err := writer.WriteTestCase([]interface{}{
+			hex.EncodeToString(v.Sig),
+			vectorfile.ErrorString(v.Err),
+			v.Comment,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote %d vectors\n", len(vectors))
+	return nil
+}
+
+// checkFile checks each vector of the file with
+// strictder.CheckEncodingVector.
+func checkFile(path string) error {
+	rows, err := vectorfile.ReadRows(path, 3)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		var v strictder.EncodingVector
+		var sig, errMsg string
+		err := vectorfile.DecodeRow(row, &sig, &errMsg, &v.Comment)
+		if err != nil {
+			return err
+		}
+		v.Sig, err = hex.DecodeString(sig)
+		if err != nil {
+			return fmt.Errorf("%v: %v", v.Comment, err)
+		}
+		v.Err = vectorfile.ParseError(errMsg)
+		if err := strictder.CheckEncodingVector(v); err != nil {
+			return fmt.Errorf("%v: %v", v.Comment, err)
+		}
+	}
+	fmt.Printf("%d vectors OK\n", len(rows))
+	return nil
+}
@@ -0,0 +1,146 @@
+// Package strictder implements the strict DER signatures of BIP 66, the only
+// encoding of ECDSA signatures the script interpreter accepts since, so that
+// nodes no longer depend on the parser of OpenSSL to agree on which are
+// valid:
+//
+//	if err := strictder.Check(sig); err != nil {
+//		return err
+//	}
+//
+// A signature is a DER sequence of the two integers R and S, followed by the
+// sighash type byte, which BIP 66 doesn't check:
+//
+//	0x30 [total-length] 0x02 [R-length] [R] 0x02 [S-length] [S] [sighash]
+//
+// Each length is a single byte, and the total length counts what follows
+// it but the sighash type. The integers are big endian and signed, so that
+// one whose top bit is set needs a zero byte before it, and any other
+// leading zero byte is padding DER forbids. The checks follow the order of
+// IsValidSignatureEncoding of BIP 66, and the error tells which fails
+// first.
+//
+// The interpreter lets an empty signature through, as a compact way of
+// failing OP_CHECKSIG, which Check doesn't: callers skip it themselves.
+package strictder
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	// MinSigLen and MaxSigLen are the lengths of the shortest and the
+	// longest signatures, sighash type included.
+	MinSigLen = 9
+	MaxSigLen = 73
+
+	// sequenceTag and integerTag are the DER tags of a sequence and an
+	// integer.
+	sequenceTag = 0x30
+	integerTag  = 0x02
+)
+
+var (
+	// ErrTooShort and ErrTooLong are returned for a signature shorter
+	// than MinSigLen or longer than MaxSigLen.
+	ErrTooShort = errors.New("strictder: signature too short")
+	ErrTooLong  = errors.New("strictder: signature too long")
+
+	// ErrNotSequence is returned for a signature that isn't a DER
+	// sequence.
+	ErrNotSequence = errors.New("strictder: not a sequence")
+
+	// ErrBadTotalLength is returned for a total length that isn't that
+	// of the rest of the signature.
+	ErrBadTotalLength = errors.New("strictder: bad total length")
+
+	// ErrRLengthPastEnd is returned for a length of R that leaves no room
+	// for the length of S.
+	ErrRLengthPastEnd = errors.New("strictder: R length past the end")
+
+	// ErrBadLengths is returned for lengths of R and S that don't add up
+	// to the length of the signature.
+	ErrBadLengths = errors.New("strictder: R and S lengths don't match " +
+		"the signature")
+
+	// ErrRNotInteger and ErrSNotInteger are returned for an R or S that
+	// isn't a DER integer.
+	ErrRNotInteger = errors.New("strictder: R not an integer")
+	ErrSNotInteger = errors.New("strictder: S not an integer")
+
+	// ErrEmptyR and ErrEmptyS are returned for an R or S of no bytes.
+	ErrEmptyR = errors.New("strictder: R empty")
+	ErrEmptyS = errors.New("strictder: S empty")
+
+	// ErrNegativeR and ErrNegativeS are returned for an R or S whose top
+	// bit is set.
+	ErrNegativeR = errors.New("strictder: R negative")
+	ErrNegativeS = errors.New("strictder: S negative")
+
+	// ErrPaddedR and ErrPaddedS are returned for an R or S with a zero
+	// byte before it that isn't needed.
+	ErrPaddedR = errors.New("strictder: R padded")
+	ErrPaddedS = errors.New("strictder: S padded")
+)
+
+// Check checks that the signature, with its sighash type byte, is strictly
+// DER encoded.
+func Check(sig []byte) error {
+	switch {
+	case len(sig) < MinSigLen:
+		return fmt.Errorf("%w: %d bytes", ErrTooShort, len(sig))
+	case len(sig) > MaxSigLen:
+		return fmt.Errorf("%w: %d bytes", ErrTooLong, len(sig))
+	case sig[0] != sequenceTag:
+		return fmt.Errorf("%w: tag %#x", ErrNotSequence, sig[0])
+	case int(sig[1]) != len(sig)-3:
+		return fmt.Errorf("%w: %d, %d bytes follow", ErrBadTotalLength,
+			sig[1], len(sig)-3)
+	}
+
+	lenR := int(sig[3])
+	if 5+lenR >= len(sig) {
+		return fmt.Errorf("%w: %d of %d bytes", ErrRLengthPastEnd, lenR,
+			len(sig))
+	}
+	lenS := int(sig[5+lenR])
+	if lenR+lenS+7 != len(sig) {
+		return fmt.Errorf("%w: %d and %d of %d bytes", ErrBadLengths,
+			lenR, lenS, len(sig))
+	}
+
+	if sig[2] != integerTag {
+		return fmt.Errorf("%w: tag %#x", ErrRNotInteger, sig[2])
+	}
+	if lenR == 0 {
+		return ErrEmptyR
+	}
+	r := sig[4 : 4+lenR]
+	if r[0]&0x80 != 0 {
+		return fmt.Errorf("%w: %x", ErrNegativeR, r)
+	}
+	if lenR > 1 && r[0] == 0x00 && r[1]&0x80 == 0 {
+		return fmt.Errorf("%w: %x", ErrPaddedR, r)
+	}
+
+	if sig[4+lenR] != integerTag {
+		return fmt.Errorf("%w: tag %#x", ErrSNotInteger, sig[4+lenR])
+	}
+	if lenS == 0 {
+		return ErrEmptyS
+	}
+	s := sig[6+lenR : 6+lenR+lenS]
+	if s[0]&0x80 != 0 {
+		return fmt.Errorf("%w: %x", ErrNegativeS, s)
+	}
+	if lenS > 1 && s[0] == 0x00 && s[1]&0x80 == 0 {
+		return fmt.Errorf("%w: %x", ErrPaddedS, s)
+	}
+	return nil
+}
+
+// IsValid reports whether the signature, with its sighash type byte, is
+// strictly DER encoded, as IsValidSignatureEncoding of BIP 66 does.
+func IsValid(sig []byte) bool {
+	return Check(sig) == nil
+}
@@ -0,0 +1,247 @@
+package strictder
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/christsim/bips/internal/vectorfile"
+)
+
+// ErrVectorMismatch is returned by CheckEncodingVector when checking the
+// signature of a vector, with the package or the script engine of btcd,
+// doesn't give the expected verdict.
+var ErrVectorMismatch = errors.New("strictder: vector mismatch")
+
+// EncodingVector is a signature, with its sighash type byte, and the error
+// checking it gives, nil if it is strictly DER encoded.
+type EncodingVector struct {
+	Sig []byte
+	Err error
+
+	// Comment describes what the vector exercises.
+	Comment string
+}
+
+// newEncodingVector returns the vector of the signature.
+func newEncodingVector(sig []byte, comment string) EncodingVector {
+	return EncodingVector{Sig: sig, Err: Check(sig), Comment: comment}
+}
+
+// assemble returns the signature of the integers and sighash type, encoded
+// as DER would if they were valid DER integers.
+func assemble(r, s []byte, hashType byte) []byte {
+	sig := []byte{sequenceTag, byte(4 + len(r) + len(s))}
+	sig = append(sig, integerTag, byte(len(r)))
+	sig = append(sig, r...)
+	sig = append(sig, integerTag, byte(len(s)))
+	sig = append(sig, s...)
+	return append(sig, hashType)
+}
+
+// integer returns an integer of the bytes, the first b and the others
+// filled with c.
+func integer(n int, b, c byte) []byte {
+	x := bytes.Repeat([]byte{c}, n)
+	x[0] = b
+	return x
+}
+
+// with returns a copy of the signature with the byte at index i set to b.
+func with(sig []byte, i int, b byte) []byte {
+	sig = append([]byte{}, sig...)
+	sig[i] = b
+	return sig
+}
+
+// mutations are the ways the vectors break a signature of R of lenR bytes,
+// each giving the error of its name.
+var mutations = []struct {
+	name   string
+	mutate func(sig []byte, lenR int) []byte
+}{
+	{"sequence tag 0x31", func(sig []byte, _ int) []byte {
+		return with(sig, 0, 0x31)
+	}},
+	{"total length one more", func(sig []byte, _ int) []byte {
+		return with(sig, 1, sig[1]+1)
+	}},
+	{"total length one less", func(sig []byte, _ int) []byte {
+		return with(sig, 1, sig[1]-1)
+	}},
+	{"total length of the whole signature", func(sig []byte,
+		_ int) []byte {
+
+		return with(sig, 1, byte(len(sig)))
+	}},
+	{"R length one more", func(sig []byte, _ int) []byte {
+		return with(sig, 3, sig[3]+1)
+	}},
+	{"R length one less", func(sig []byte, _ int) []byte {
+		return with(sig, 3, sig[3]-1)
+	}},
+	{"R length past the end", func(sig []byte, _ int) []byte {
+		return with(sig, 3, byte(len(sig)-5))
+	}},
+	{"S length one more", func(sig []byte, lenR int) []byte {
+		return with(sig, 5+lenR, sig[5+lenR]+1)
+	}},
+	{"S length one less", func(sig []byte, lenR int) []byte {
+		return with(sig, 5+lenR, sig[5+lenR]-1)
+	}},
+	{"R tag 0x03", func(sig []byte, _ int) []byte {
+		return with(sig, 2, 0x03)
+	}},
+	{"S tag 0x03", func(sig []byte, lenR int) []byte {
+		return with(sig, 4+lenR, 0x03)
+	}},
+	{"no sighash type", func(sig []byte, _ int) []byte {
+		return sig[:len(sig)-1]
+	}},
+	{"trailing byte", func(sig []byte, _ int) []byte {
+		return append(append([]byte{}, sig...), 0x00)
+	}},
+	{"trailing byte counted in the total length", func(sig []byte,
+		_ int) []byte {
+
+		return append(with(sig, 1, sig[1]+1), 0x00)
+	}},
+	{"cut short", func(sig []byte, _ int) []byte {
+		return sig[:len(sig)-2]
+	}},
+}
+
+// EncodingVectors returns vectors of signatures of real keys and of the
+// edge cases of their encoding: the shortest and longest, integers of zero
+// and needing a zero byte, and any sighash type. They are followed by
+// signatures subtly broken by mistaken lengths and tags, missing, trailing
+// and extra bytes, and by integers empty, negative and padded, and by the
+// mutations of count random signatures of random keys, derived from a
+// math/rand source with the seed.
+func EncodingVectors(rngSeed int64, count int) []EncodingVector {
+	const all = byte(txscript.SigHashAll)
+	rng := rand.New(rand.NewSource(rngSeed))
+	sign := func() []byte {
+		var key, hash [32]byte
+		rng.Read(key[:])
+		rng.Read(hash[:])
+		priv, _ := btcec.PrivKeyFromBytes(key[:])
+		return append(ecdsa.Sign(priv, hash[:]).Serialize(), all)
+	}
+
+	one := []byte{0x01}
+	r32 := integer(32, 0x11, 0x11)
+	s32 := integer(32, 0x22, 0x22)
+	high := integer(33, 0x00, 0xff)
+	vectors := []EncodingVector{
+		newEncodingVector(sign(), "Signature of a real key"),
+		newEncodingVector(sign(), "Signature of another real key"),
+		newEncodingVector(assemble(r32, s32, all),
+			"R and S of 32 bytes"),
+		newEncodingVector(assemble(one, one, all),
+			"Shortest signature"),
+		newEncodingVector(assemble(high, high, all),
+			"Longest signature"),
+		newEncodingVector(assemble([]byte{0x00}, []byte{0x00}, all),
+			"R and S of zero"),
+		newEncodingVector(assemble([]byte{0x00, 0x80}, s32, all),
+			"R padded for its top bit"),
+		newEncodingVector(assemble(r32, []byte{0x00, 0x80}, all),
+			"S padded for its top bit"),
+		newEncodingVector(assemble(r32, s32, 0x00), "Sighash type 0"),
+		newEncodingVector(assemble(r32, s32, 0xff),
+			"Sighash type 0xff"),
+		newEncodingVector(assemble(r32, s32, 0x81),
+			"Sighash type ALL|ANYONECANPAY"),
+
+		newEncodingVector(assemble(one, one, all)[:MinSigLen-1],
+			"Too short"),
+		newEncodingVector(assemble(append([]byte{0x00}, high...), high,
+			all), "Too long"),
+		newEncodingVector(nil, "Empty"),
+		newEncodingVector(assemble(nil, s32, all), "R empty"),
+		newEncodingVector(assemble(r32, nil, all), "S empty"),
+		newEncodingVector(assemble(nil, nil, all), "R and S empty"),
+		newEncodingVector(assemble(high[1:], s32, all), "R negative"),
+		newEncodingVector(assemble(r32, high[1:], all), "S negative"),
+		newEncodingVector(assemble([]byte{0x80}, s32, all),
+			"R negative zero"),
+		newEncodingVector(assemble([]byte{0x00, 0x01}, s32, all),
+			"R padded"),
+		newEncodingVector(assemble(r32, []byte{0x00, 0x01}, all),
+			"S padded"),
+		newEncodingVector(assemble([]byte{0x00, 0x00, 0x80}, s32, all),
+			"R padded twice for its top bit"),
+		newEncodingVector(assemble([]byte{0x00, 0x00}, s32, all),
+			"R zero padded"),
+		newEncodingVector(assemble(append([]byte{0x00}, r32...), s32,
+			all), "R of 32 bytes padded"),
+		newEncodingVector(assemble(r32, append([]byte{0x00}, s32...),
+			all), "S of 32 bytes padded"),
+	}
+
+	base := assemble(r32, s32, all)
+	for _, m := range mutations {
+		sig := m.mutate(base, len(r32))
+		vectors = append(vectors, newEncodingVector(sig,
+			"R and S of 32 bytes, "+m.name))
+	}
+	for n := 0; n < count; n++ {
+		sig := sign()
+		m := mutations[rng.Intn(len(mutations))]
+		comment := "Random"
+		if rng.Intn(2) == 0 {
+			sig = m.mutate(sig, int(sig[3]))
+			comment += ", " + m.name
+		}
+		vectors = append(vectors, newEncodingVector(sig, comment))
+	}
+	return vectors
+}
+
+// CheckEncodingVector checks the signature of the vector with Check, and,
+// unless it is empty, with the script engine of btcd enforcing BIP 66, which
+// must agree on whether it is strictly DER encoded. The engine executes it
+// with OP_CHECKSIG OP_NOT, which passes for a signature of the right
+// encoding that doesn't verify.
+func CheckEncodingVector(v EncodingVector) error {
+	err := Check(v.Sig)
+	if !vectorfile.SameError(err, v.Err) {
+		return fmt.Errorf("%w: error %v, expected %v",
+			ErrVectorMismatch, err, v.Err)
+	}
+	if len(v.Sig) == 0 {
+		return nil
+	}
+
+	priv, _ := btcec.PrivKeyFromBytes(bytes.Repeat([]byte{0x01}, 32))
+	sigScript, err := txscript.NewScriptBuilder().
+		AddData(v.Sig).
+		AddData(priv.PubKey().SerializeCompressed()).
+		Script()
+	if err != nil {
+		return err
+	}
+	pkScript := []byte{txscript.OP_CHECKSIG, txscript.OP_NOT}
+
+	tx := wire.NewMsgTx(1)
+	txIn := wire.NewTxIn(&wire.OutPoint{}, sigScript, nil)
+	tx.AddTxIn(txIn)
+	tx.AddTxOut(wire.NewTxOut(0, nil))
+	fetcher := txscript.NewCannedPrevOutputFetcher(pkScript, 0)
+	vm, err := txscript.NewEngine(pkScript, tx, 0,
+		txscript.ScriptVerifyDERSignatures, nil, nil, 0, fetcher)
+	if err == nil {
+		err = vm.Execute()
+	}
+	if (err == nil) != (v.Err == nil) {
+		return fmt.Errorf("%w: btcd gives error %v, expected %v",
+			ErrVectorMismatch, err, v.Err)
+	}
+	return nil
+}
@@ -0,0 +1,251 @@
+// This program writes test vectors for the sequencelock package: the locks
+// sequence numbers at the edges of each field and random ones decode to, to
+// sequences.json, and the locks of transactions mined in the last block
+// they are locked in and the next, for each edge of the sequence number, the
+// transaction versions locks apply from and transactions of several inputs,
+// followed by random transactions mined around their locks, to locks.json.
+// The random vectors depend only on -seed and -count, so they can be
+// regenerated by anyone:
+//
+//	gentestvectors -count 50 -seed 68
+//
+// Both files use the layout of the BIP 158 vectors: a JSON array whose
+// first row names the columns, followed by one row per vector. The inputs
+// of a transaction are given by the heights of the blocks confirming the
+// outputs they spend and the median times past of their parents. Pass
+// -check and -check-locks to verify existing files against the package
+// instead:
+//
+//	gentestvectors -check sequences.json -check-locks locks.json
+//
+// The program lives in a directory of its own since the sequencelock
+// package sits at the root of the module.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	sequencelock "github.com/christsim/bips/bip-0068"
+	"github.com/christsim/bips/internal/vectorfile"
+)
+
+// sequenceColumns is the header row of the sequence vector file.
+const sequenceColumns = "Sequence,Disabled,Seconds,Value,Comment"
+
+// lockColumns is the header row of the lock vector file.
+const lockColumns = "Version,Sequences,Input Heights," +
+	"Input Prev Median Times Past,Height,Prev Median Time Past," +
+	"Min Height,Min Time,Spendable,Comment"
+
+type JSONTestWriter struct {
+	writer          io.Writer
+	firstRowWritten bool
+}
+
+func NewJSONTestWriter(writer io.Writer) *JSONTestWriter {
+	return &JSONTestWriter{writer: writer}
+}
+
+func (w *JSONTestWriter) WriteComment(comment string) error {
+	return w.WriteTestCase([]interface{}{comment})
+}
+
+func (w *JSONTestWriter) WriteTestCase(row []interface{}) error {
+	var err error
+	if w.firstRowWritten {
+		_, err = io.WriteString(w.writer, ",\n")
+	} else {
+		_, err = io.WriteString(w.writer, "[\n")
+		w.firstRowWritten = true
+	}
+	if err != nil {
+		return err
+	}
+
+	rowBytes, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.writer.Write(rowBytes)
+	return err
+}
+
+func (w *JSONTestWriter) Close() error {
+	if !w.firstRowWritten {
+		return nil
+	}
+
+	_, err := io.WriteString(w.writer, "\n]\n")
+	return err
+}
+
+func main() {
+	out := flag.String("out", "sequences.json", "file to write the "+
+		"sequence vectors to")
+	locksOut := flag.String("locks-out", "locks.json", "file to write "+
+		"the lock vectors to")
+	count := flag.Int("count", 50, "number of random sequence numbers "+
+		"and transactions to write vectors of")
+	seed := flag.Int64("seed", 68, "seed of the random vectors")
+	check := flag.String("check", "", "sequence vector file to check "+
+		"instead of writing the files")
+	checkLocks := flag.String("check-locks", "", "lock vector file to "+
+		"check instead of writing the files")
+	flag.Parse()
+
+	var err error
+	switch {
+	case *check != "" || *checkLocks != "":
+		if *check != "" {
+			err = checkFile(*check)
+		}
+		if err == nil && *checkLocks != "" {
+			err = checkLocksFile(*checkLocks)
+		}
+	default:
+		err = writeFile(*out, *seed, *count)
+		if err == nil {
+			err = writeLocksFile(*locksOut, *seed, *count)
+		}
+	}
+	if err != nil {
+		fmt.Println("Error: ", err.Error())
+		os.Exit(1)
+	}
+}
+
+// writeRows writes the header and rows to a new vector file at path.
+func writeRows(path, columns string, rows [][]interface{}) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := NewJSONTestWriter(file)
+	if err := writer.WriteComment(columns); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if err := writer.WriteTestCase(row); err != nil {
+			return err
+		}
+	}
+	return writer.Close()
+}
+
+// writeFile writes the sequence vectors, with count random ones, to out.
+func writeFile(out string, seed int64, count int) error {
+	var rows [][]interface{}
+	vectors := sequencelock.SequenceVectors(seed, count)
+	for _, v := range vectors {
+		rows = append(rows, []interface{}{
+			v.Sequence,
+			v.Disabled,
+			v.Seconds,
+			v.Value,
+			v.Comment,
+		})
+	}
+	if err := writeRows(out, sequenceColumns, rows); err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote %d sequence vectors\n", len(vectors))
+	return nil
+}
+
+// writeLocksFile writes the lock vectors, with those of count random
+// transactions, to out.
+func writeLocksFile(out string, seed int64, count int) error {
+	var rows [][]interface{}
+	vectors := sequencelock.LockVectors(seed, count)
+	for _, v := range vectors {
+		heights := make([]int32, len(v.Inputs))
+		times := make([]int64, len(v.Inputs))
+		for i, input := range v.Inputs {
+			heights[i] = input.Height
+			times[i] = input.PrevMedianTimePast
+		}
+		rows = append(rows, []interface{}{
+			v.Version,
+			v.Sequences,
+			heights,
+			times,
+			v.Height,
+			v.PrevMedianTimePast,
+			v.MinHeight,
+			v.MinTime,
+			v.Spendable,
+			v.Comment,
+		})
+	}
+	if err := writeRows(out, lockColumns, rows); err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote %d lock vectors\n", len(vectors))
+	return nil
+}
+
+// checkFile checks each vector of the file with
+// sequencelock.CheckSequenceVector.
+func checkFile(path string) error {
+	rows, err := vectorfile.ReadRows(path, 5)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		var v sequencelock.SequenceVector
+		err := vectorfile.DecodeRow(row, &v.Sequence, &v.Disabled,
+			&v.Seconds, &v.Value, &v.Comment)
+		if err != nil {
+			return err
+		}
+		if err := sequencelock.CheckSequenceVector(v); err != nil {
+			return fmt.Errorf("%v: %v", v.Comment, err)
+		}
+	}
+	fmt.Printf("%d sequence vectors OK\n", len(rows))
+	return nil
+}
+
+// checkLocksFile checks each vector of the file with
+// sequencelock.CheckLockVector.
+func checkLocksFile(path string) error {
+	rows, err := vectorfile.ReadRows(path, 10)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		var v sequencelock.LockVector
+		var heights []int32
+		var times []int64
+		err := vectorfile.DecodeRow(row, &v.Version, &v.Sequences,
+			&heights, &times, &v.Height, &v.PrevMedianTimePast,
+			&v.MinHeight, &v.MinTime, &v.Spendable, &v.Comment)
+		if err != nil {
+			return err
+		}
+		if len(heights) != len(times) {
+			return fmt.Errorf("%v: %d input heights, %d times",
+				v.Comment, len(heights), len(times))
+		}
+		for i := range heights {
+			v.Inputs = append(v.Inputs, sequencelock.Input{
+				Height:             heights[i],
+				PrevMedianTimePast: times[i],
+			})
+		}
+		if err := sequencelock.CheckLockVector(v); err != nil {
+			return fmt.Errorf("%v: %v", v.Comment, err)
+		}
+	}
+	fmt.Printf("%d lock vectors OK\n", len(rows))
+	return nil
+}
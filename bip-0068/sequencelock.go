@@ -0,0 +1,179 @@
+// Package sequencelock implements the relative lock-times of BIP 68, which
+// give the sequence number of a transaction input the consensus meaning of
+// a number of blocks or a span of time that must pass after the output it
+// spends confirms before the transaction can be mined:
+//
+//	sequence := sequencelock.Blocks(144).Sequence()
+//	lock, err := sequencelock.CalculateLock(tx, inputs)
+//	ok := lock.Evaluate(height, prevMedianTimePast)
+//
+// The lock of an input is in its low 16 bits, counting blocks, or units of
+// 512 seconds if the type flag, bit 22, is set. Setting the disable flag,
+// bit 31, leaves the input without a lock, and the other bits are free for
+// future use. Only transactions of version 2 and above, as an unsigned
+// number, are locked.
+//
+// Time locks are measured in median time past, that of BIP 113: a time lock
+// of an input passes in the first block whose parent's median time past is
+// at least the median time past of the block before the one confirming the
+// spent output, plus the lock. A height lock passes in the block that many
+// blocks after the one confirming the output.
+package sequencelock
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+const (
+	// DisableFlag is the bit of a sequence number disabling its lock.
+	DisableFlag = 1 << 31
+
+	// TypeFlag is the bit of a sequence number telling its lock counts
+	// units of Granularity seconds rather than blocks.
+	TypeFlag = 1 << 22
+
+	// ValueMask masks the bits of a sequence number holding its lock.
+	ValueMask = 0x0000ffff
+
+	// Granularity is the log2 of the seconds in a unit of a time lock,
+	// which are 512.
+	Granularity = 9
+
+	// MinTxVersion is the first transaction version whose sequence
+	// numbers are locks. Versions compare unsigned, so negative ones are
+	// above it.
+	MinTxVersion = 2
+)
+
+var (
+	// ErrLockTooLong is returned for a lock longer than 65535 blocks or
+	// units of time.
+	ErrLockTooLong = errors.New("sequencelock: lock too long")
+
+	// ErrInputCount is returned by CalculateLock when the number of
+	// inputs it's passed differs from that of the transaction.
+	ErrInputCount = errors.New("sequencelock: wrong number of inputs")
+)
+
+// RelativeLock is the lock of an input: a number of blocks, or of units of
+// 512 seconds if Seconds is set.
+type RelativeLock struct {
+	Seconds bool
+	Value   uint16
+}
+
+// Blocks returns the lock of n blocks.
+func Blocks(n uint16) RelativeLock {
+	return RelativeLock{Value: n}
+}
+
+// Duration returns the lock of the seconds, rounded up to a multiple of 512
+// so that at least that much time passes.
+func Duration(seconds uint32) (RelativeLock, error) {
+	units := (uint64(seconds) + 1<<Granularity - 1) >> Granularity
+	if units > math.MaxUint16 {
+		return RelativeLock{}, fmt.Errorf("%w: %d seconds",
+			ErrLockTooLong, seconds)
+	}
+	return RelativeLock{Seconds: true, Value: uint16(units)}, nil
+}
+
+// Decode returns the lock of a sequence number, or false if its disable
+// flag is set.
+func Decode(sequence uint32) (RelativeLock, bool) {
+	if sequence&DisableFlag != 0 {
+		return RelativeLock{}, false
+	}
+	return RelativeLock{
+		Seconds: sequence&TypeFlag != 0,
+		Value:   uint16(sequence & ValueMask),
+	}, true
+}
+
+// Sequence returns the sequence number of the lock, with the bits BIP 68
+// leaves free unset.
+func (l RelativeLock) Sequence() uint32 {
+	sequence := uint32(l.Value)
+	if l.Seconds {
+		sequence |= TypeFlag
+	}
+	return sequence
+}
+
+// SecondsLocked returns the span of a time lock in seconds.
+func (l RelativeLock) SecondsLocked() uint32 {
+	return uint32(l.Value) << Granularity
+}
+
+// String returns the lock as a number of blocks or seconds.
+func (l RelativeLock) String() string {
+	if l.Seconds {
+		return fmt.Sprintf("%d seconds", l.SecondsLocked())
+	}
+	return fmt.Sprintf("%d blocks", l.Value)
+}
+
+// Input describes where the output an input spends confirmed: the height of
+// its block, and the median time past of the block before it. An output in
+// the mempool counts as confirmed in the next block.
+type Input struct {
+	Height             int32
+	PrevMedianTimePast int64
+}
+
+// Lock is the lock of a transaction, the last height and median time past
+// at which it is locked, as those of its most locked input. Either is -1 if
+// none of its inputs is locked by it.
+type Lock struct {
+	MinHeight int32
+	MinTime   int64
+}
+
+// Unlocked is the lock of a transaction none of whose inputs are locked.
+var Unlocked = Lock{MinHeight: -1, MinTime: -1}
+
+// CalculateLock returns the lock of the transaction, whose inputs spend the
+// outputs inputs describes.
+func CalculateLock(tx *wire.MsgTx, inputs []Input) (Lock, error) {
+	if len(inputs) != len(tx.TxIn) {
+		return Unlocked, fmt.Errorf("%w: %d for %d inputs",
+			ErrInputCount, len(inputs), len(tx.TxIn))
+	}
+	lock := Unlocked
+	if uint32(tx.Version) < MinTxVersion {
+		return lock, nil
+	}
+
+	for i, txIn := range tx.TxIn {
+		l, ok := Decode(txIn.Sequence)
+		if !ok {
+			continue
+		}
+
+		// The lock is one less than the height or time at which it
+		// passes, so that a lock of zero doesn't lock at all.
+		if l.Seconds {
+			minTime := inputs[i].PrevMedianTimePast +
+				int64(l.SecondsLocked()) - 1
+			if minTime > lock.MinTime {
+				lock.MinTime = minTime
+			}
+		} else {
+			minHeight := inputs[i].Height + int32(l.Value) - 1
+			if minHeight > lock.MinHeight {
+				lock.MinHeight = minHeight
+			}
+		}
+	}
+	return lock, nil
+}
+
+// Evaluate reports whether a transaction of the lock can be mined in the
+// block at the height, whose parent's median time past is passed.
+func (l Lock) Evaluate(height int32, prevMedianTimePast int64) bool {
+	return l.MinHeight < height && l.MinTime < prevMedianTimePast
+}
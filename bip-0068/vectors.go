@@ -0,0 +1,316 @@
+package sequencelock
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+// ErrVectorMismatch is returned by the checks of vectors when decoding their
+// sequence numbers or evaluating their locks doesn't give the expected
+// result.
+var ErrVectorMismatch = errors.New("sequencelock: vector mismatch")
+
+// SequenceVector is the lock a sequence number decodes to.
+type SequenceVector struct {
+	Sequence uint32
+
+	// Disabled tells whether the disable flag is set, and Seconds and
+	// Value are the lock otherwise.
+	Disabled bool
+	Seconds  bool
+	Value    uint16
+
+	// Comment describes what the vector exercises.
+	Comment string
+}
+
+// LockVector is the lock of a transaction of the version and sequence
+// numbers, spending the outputs Inputs describes, and whether it can be
+// mined in the block at Height, whose parent has the median time past
+// PrevMedianTimePast.
+type LockVector struct {
+	Version   int32
+	Sequences []uint32
+	Inputs    []Input
+
+	Height             int32
+	PrevMedianTimePast int64
+
+	MinHeight int32
+	MinTime   int64
+	Spendable bool
+
+	// Comment describes what the vector exercises.
+	Comment string
+}
+
+// newSequenceVector returns the vector of the sequence number.
+func newSequenceVector(sequence uint32, comment string) SequenceVector {
+	l, ok := Decode(sequence)
+	return SequenceVector{
+		Sequence: sequence,
+		Disabled: !ok,
+		Seconds:  l.Seconds,
+		Value:    l.Value,
+		Comment:  comment,
+	}
+}
+
+// SequenceVectors returns the vectors of sequence numbers at the edges of
+// each field, and of count random ones derived from a math/rand source with
+// the seed.
+func SequenceVectors(rngSeed int64, count int) []SequenceVector {
+	vectors := []SequenceVector{
+		newSequenceVector(0, "Zero blocks"),
+		newSequenceVector(1, "One block"),
+		newSequenceVector(ValueMask, "Most blocks"),
+		newSequenceVector(TypeFlag, "Zero seconds"),
+		newSequenceVector(TypeFlag|1, "512 seconds"),
+		newSequenceVector(TypeFlag|ValueMask, "Most seconds"),
+		newSequenceVector(ValueMask+1, "Free bit 16 ignored"),
+		newSequenceVector(TypeFlag>>1|7, "Free bit 21 ignored"),
+		newSequenceVector(TypeFlag<<1|TypeFlag|7,
+			"Free bit 23 ignored"),
+		newSequenceVector(DisableFlag>>1|7, "Free bit 30 ignored"),
+		newSequenceVector(DisableFlag, "Disabled"),
+		newSequenceVector(DisableFlag|TypeFlag|ValueMask,
+			"Disabled time lock"),
+		newSequenceVector(wire.MaxTxInSequenceNum, "Final"),
+		newSequenceVector(wire.MaxTxInSequenceNum-1,
+			"Final but one, disabled"),
+	}
+
+	rng := rand.New(rand.NewSource(rngSeed))
+	for n := 0; n < count; n++ {
+		vectors = append(vectors, newSequenceVector(rng.Uint32(),
+			"Random"))
+	}
+	return vectors
+}
+
+// CheckSequenceVector checks the lock the sequence number of the vector
+// decodes to, and that encoding it gives the sequence number without its
+// free bits.
+func CheckSequenceVector(v SequenceVector) error {
+	l, ok := Decode(v.Sequence)
+	if ok == v.Disabled {
+		return fmt.Errorf("%w: disabled %v, expected %v",
+			ErrVectorMismatch, !ok, v.Disabled)
+	}
+	if !ok {
+		return nil
+	}
+	if l.Seconds != v.Seconds || l.Value != v.Value {
+		return fmt.Errorf("%w: lock of %v, expected %v",
+			ErrVectorMismatch, l, RelativeLock{v.Seconds, v.Value})
+	}
+	want := v.Sequence & (TypeFlag | ValueMask)
+	if got := l.Sequence(); got != want {
+		return fmt.Errorf("%w: sequence %08x, expected %08x",
+			ErrVectorMismatch, got, want)
+	}
+	return nil
+}
+
+// lockTx returns a transaction of the version and sequence numbers.
+func lockTx(version int32, sequences []uint32) *wire.MsgTx {
+	tx := wire.NewMsgTx(version)
+	for i, sequence := range sequences {
+		txIn := wire.NewTxIn(&wire.OutPoint{Index: uint32(i)}, nil, nil)
+		txIn.Sequence = sequence
+		tx.AddTxIn(txIn)
+	}
+	tx.AddTxOut(wire.NewTxOut(0, nil))
+	return tx
+}
+
+// newLockVector returns the vector of the transaction evaluated in the
+// block.
+func newLockVector(version int32, sequences []uint32, inputs []Input,
+	height int32, prevMedianTimePast int64, comment string) LockVector {
+
+	lock, err := CalculateLock(lockTx(version, sequences), inputs)
+	if err != nil {
+		panic(err)
+	}
+	return LockVector{
+		Version:            version,
+		Sequences:          sequences,
+		Inputs:             inputs,
+		Height:             height,
+		PrevMedianTimePast: prevMedianTimePast,
+		MinHeight:          lock.MinHeight,
+		MinTime:            lock.MinTime,
+		Spendable:          lock.Evaluate(height, prevMedianTimePast),
+		Comment:            comment,
+	}
+}
+
+// The block confirming the spent outputs of the boundary vectors, and the
+// median time past of its parent.
+const (
+	confirmHeight = 500000
+	confirmTime   = 1500000000
+)
+
+// boundaryVectors returns the vectors of a transaction spending an output
+// confirmed at confirmHeight under the lock, mined in the last block it is
+// locked in and in the next.
+func boundaryVectors(version int32, sequence uint32,
+	comment string) []LockVector {
+
+	sequences := []uint32{sequence}
+	inputs := []Input{{confirmHeight, confirmTime}}
+	lock, _ := CalculateLock(lockTx(version, sequences), inputs)
+
+	// Only the dimension of the lock moves, the other staying past the
+	// lock of the output either way.
+	height, mtp := int32(confirmHeight+1<<16), int64(confirmTime+1<<25)
+	if lock == Unlocked {
+		return []LockVector{
+			newLockVector(version, sequences, inputs, confirmHeight,
+				confirmTime, comment+", next block"),
+		}
+	}
+	if lock.MinTime >= 0 {
+		return []LockVector{
+			newLockVector(version, sequences, inputs, height,
+				lock.MinTime, comment+", last locked time"),
+			newLockVector(version, sequences, inputs, height,
+				lock.MinTime+1,
+				comment+", first unlocked time"),
+		}
+	}
+	return []LockVector{
+		newLockVector(version, sequences, inputs, lock.MinHeight, mtp,
+			comment+", last locked height"),
+		newLockVector(version, sequences, inputs, lock.MinHeight+1, mtp,
+			comment+", first unlocked height"),
+	}
+}
+
+// LockVectors returns vectors of transactions mined at the boundaries of
+// their locks: of each edge of the fields of the sequence number, of the
+// versions locks apply from, and of several inputs, whose most locked input
+// of each type must pass. They are followed by count random transactions
+// derived from a math/rand source with the seed, mined around the boundary
+// of their lock.
+func LockVectors(rngSeed int64, count int) []LockVector {
+	var vectors []LockVector
+	for _, c := range []struct {
+		version  int32
+		sequence uint32
+		comment  string
+	}{
+		{2, 0, "Zero blocks"},
+		{2, 1, "One block"},
+		{2, 10, "Ten blocks"},
+		{2, ValueMask, "Most blocks"},
+		{2, TypeFlag, "Zero seconds"},
+		{2, TypeFlag | 1, "512 seconds"},
+		{2, TypeFlag | ValueMask, "Most seconds"},
+		{2, 0x003f0000 | 10, "Ten blocks, free bits set"},
+		{2, 0x7f800000 | TypeFlag | 10, "5120 seconds, free bits set"},
+		{2, DisableFlag | 10, "Disabled"},
+		{2, wire.MaxTxInSequenceNum, "Final"},
+		{1, 10, "Version 1"},
+		{0, 10, "Version 0"},
+		{3, 10, "Version 3"},
+		{-1, 10, "Version -1, unsigned above 2"},
+		{-0x80000000, 10, "Version -2^31, unsigned above 2"},
+	} {
+		vectors = append(vectors, boundaryVectors(c.version,
+			c.sequence, c.comment)...)
+	}
+
+	// Of two inputs, the more locked one decides, and height and time
+	// locks must both pass.
+	inputs := []Input{
+		{confirmHeight, confirmTime},
+		{confirmHeight + 5, confirmTime + 3000},
+	}
+	for _, c := range []struct {
+		sequences []uint32
+		height    int32
+		mtp       int64
+		comment   string
+	}{
+		{[]uint32{10, 10}, confirmHeight + 14, confirmTime,
+			"Two height locks, second locked"},
+		{[]uint32{10, 10}, confirmHeight + 15, confirmTime,
+			"Two height locks, both unlocked"},
+		{[]uint32{20, 10}, confirmHeight + 19, confirmTime,
+			"Two height locks, first locked"},
+		{[]uint32{TypeFlag | 10, TypeFlag | 1}, confirmHeight,
+			confirmTime + 5119, "Two time locks, first locked"},
+		{[]uint32{TypeFlag | 10, TypeFlag | 1}, confirmHeight,
+			confirmTime + 5120, "Two time locks, both unlocked"},
+		{[]uint32{10, TypeFlag | 1}, confirmHeight + 10,
+			confirmTime + 3511, "Both types, time locked"},
+		{[]uint32{10, TypeFlag | 1}, confirmHeight + 9,
+			confirmTime + 3512, "Both types, height locked"},
+		{[]uint32{10, TypeFlag | 1}, confirmHeight + 10,
+			confirmTime + 3512, "Both types, both unlocked"},
+		{[]uint32{DisableFlag | 10, 10}, confirmHeight + 14,
+			confirmTime, "First disabled, second locked"},
+	} {
+		vectors = append(vectors, newLockVector(2, c.sequences, inputs,
+			c.height, c.mtp, c.comment))
+	}
+
+	rng := rand.New(rand.NewSource(rngSeed))
+	for n := 0; n < count; n++ {
+		var sequences []uint32
+		var inputs []Input
+		for i := 1 + rng.Intn(4); i > 0; i-- {
+			sequence := uint32(rng.Intn(1 << 10))
+			switch rng.Intn(4) {
+			case 0:
+				sequence |= TypeFlag
+			case 1:
+				sequence |= rng.Uint32()
+			}
+			sequences = append(sequences, sequence)
+			inputs = append(inputs, Input{
+				Height:             int32(rng.Intn(1 << 20)),
+				PrevMedianTimePast: int64(1e9 + rng.Intn(1e9)),
+			})
+		}
+		version := int32(1 + rng.Intn(2))
+		lock, _ := CalculateLock(lockTx(version, sequences), inputs)
+		height := int32(rng.Intn(1 << 20))
+		if lock.MinHeight >= 0 {
+			height = lock.MinHeight + int32(rng.Intn(3))
+		}
+		mtp := int64(1e9 + rng.Intn(1e9))
+		if lock.MinTime >= 0 {
+			mtp = lock.MinTime + int64(rng.Intn(3))
+		}
+		vectors = append(vectors, newLockVector(version, sequences,
+			inputs, height, mtp, fmt.Sprintf("Random, version %d",
+				version)))
+	}
+	return vectors
+}
+
+// CheckLockVector checks the lock of the transaction of the vector, and
+// whether it can be mined in its block.
+func CheckLockVector(v LockVector) error {
+	lock, err := CalculateLock(lockTx(v.Version, v.Sequences), v.Inputs)
+	if err != nil {
+		return err
+	}
+	if lock.MinHeight != v.MinHeight || lock.MinTime != v.MinTime {
+		return fmt.Errorf("%w: lock %+v, expected height %d, time %d",
+			ErrVectorMismatch, lock, v.MinHeight, v.MinTime)
+	}
+	spendable := lock.Evaluate(v.Height, v.PrevMedianTimePast)
+	if spendable != v.Spendable {
+		return fmt.Errorf("%w: spendable %v, expected %v",
+			ErrVectorMismatch, spendable, v.Spendable)
+	}
+	return nil
+}
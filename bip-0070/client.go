@@ -0,0 +1,211 @@
+package paymentprotocol
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	paymenturi "github.com/christsim/bips/bip-0021"
+)
+
+var (
+	// ErrNoRequestURL is returned by FetchURI for a payment URI without
+	// the r parameter.
+	ErrNoRequestURL = errors.New("paymentprotocol: no payment request URL")
+
+	// ErrNoPaymentURL is returned by Pay for payment details without a
+	// payment URL.
+	ErrNoPaymentURL = errors.New("paymentprotocol: no payment URL")
+
+	// ErrHTTPStatus is returned for a response of a status other than 200.
+	ErrHTTPStatus = errors.New("paymentprotocol: unexpected HTTP status")
+
+	// ErrMediaType is returned for a message of another media type than
+	// that of its kind.
+	ErrMediaType = errors.New("paymentprotocol: unexpected media type")
+)
+
+// RequestURL is the r parameter of BIP 72, the URL to fetch a payment
+// request from, which wallets that support it follow instead of paying the
+// rest of the URI, and which lets the URI leave out the address.
+var RequestURL = paymenturi.Extension{
+	Key:         "r",
+	Destination: true,
+	Check:       checkRequestURL,
+}
+
+// checkRequestURL checks that the value is an absolute http or https URL.
+func checkRequestURL(value string, _ *chaincfg.Params) error {
+	u, err := url.Parse(value)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("request URL %q not http or https", value)
+	}
+	return nil
+}
+
+// Registry returns a new registry of the extensions of the default registry
+// of payment URIs and RequestURL.
+func Registry() paymenturi.Registry {
+	r := paymenturi.DefaultRegistry()
+	if err := r.Register(RequestURL); err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// Invoice is a payment request a wallet fetched and checked, its details,
+// and the identity of the merchant who signed it, empty if no one did.
+type Invoice struct {
+	Request  *PaymentRequest
+	Details  *PaymentDetails
+	Merchant string
+}
+
+// Client is a wallet's side of the protocol, for a network.
+type Client struct {
+	Net *chaincfg.Params
+
+	// HTTPClient makes the requests, http.DefaultClient if nil.
+	HTTPClient *http.Client
+
+	// Roots are the trusted roots of certificate chains, the system's if
+	// nil.
+	Roots *x509.CertPool
+
+	// Now returns the time to check certificates and expiry at, the
+	// current time if nil.
+	Now func() time.Time
+}
+
+// httpClient returns the HTTP client of the client.
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// now returns the time of the client.
+func (c *Client) now() time.Time {
+	if c.Now != nil {
+		return c.Now()
+	}
+	return time.Now()
+}
+
+// do makes the HTTP request, which accepts the media type, and returns the
+// body of the response, of up to limit bytes, which must be of the type.
+func (c *Client) do(req *http.Request, mediaType string,
+	limit int) ([]byte, error) {
+
+	req.Header.Set("Accept", mediaType)
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %s", ErrHTTPStatus, resp.Status)
+	}
+	got, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || got != mediaType {
+		return nil, fmt.Errorf("%w: %q, expected %q", ErrMediaType,
+			resp.Header.Get("Content-Type"), mediaType)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, int64(limit)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > limit {
+		return nil, fmt.Errorf("%w: more than %d bytes", ErrTooLarge,
+			limit)
+	}
+	return body, nil
+}
+
+// FetchRequest fetches the payment request at the URL, verifies it, and
+// checks its details.
+func (c *Client) FetchRequest(ctx context.Context,
+	requestURL string) (*Invoice, error) {
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		requestURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	body, err := c.do(req, RequestMediaType, MaxRequestSize)
+	if err != nil {
+		return nil, err
+	}
+	r, err := ParsePaymentRequest(body)
+	if err != nil {
+		return nil, err
+	}
+	merchant, err := r.Verify(c.Roots, c.now())
+	if err != nil {
+		return nil, err
+	}
+	details, err := r.Details()
+	if err != nil {
+		return nil, err
+	}
+	if err := details.Check(c.Net, c.now()); err != nil {
+		return nil, err
+	}
+	return &Invoice{Request: r, Details: details, Merchant: merchant}, nil
+}
+
+// FetchURI parses the payment URI, with the extensions of Registry, and
+// fetches the payment request of its r parameter. The rest of the URI is
+// left for wallets that don't support the protocol.
+func (c *Client) FetchURI(ctx context.Context, uri string) (*Invoice,
+	error) {
+
+	u, err := paymenturi.Parse(uri, c.Net, Registry())
+	if err != nil {
+		return nil, err
+	}
+	p, ok := u.Param(RequestURL.Key)
+	if !ok {
+		return nil, ErrNoRequestURL
+	}
+	return c.FetchRequest(ctx, p.Value)
+}
+
+// Pay checks that the invoice hasn't expired, and posts the payment to its
+// payment URL, returning the merchant's acknowledgement. The transactions
+// of the payment are for the wallet to broadcast as well.
+func (c *Client) Pay(ctx context.Context, invoice *Invoice,
+	payment *Payment) (*PaymentACK, error) {
+
+	if err := invoice.Details.Check(c.Net, c.now()); err != nil {
+		return nil, err
+	}
+	if invoice.Details.PaymentURL == "" {
+		return nil, ErrNoPaymentURL
+	}
+	body := bytes.NewReader(payment.Serialize())
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		invoice.Details.PaymentURL, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", PaymentMediaType)
+	ack, err := c.do(req, ACKMediaType, MaxACKSize)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePaymentACK(ack)
+}
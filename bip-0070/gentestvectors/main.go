@@ -0,0 +1,252 @@
+// This program writes test vectors for the paymentprotocol package:
+// payment requests unsigned and signed over either hash, of certificate
+// chains good and bad, of signatures broken in every way, of versions and
+// PKI types unknown, of malformed messages and of details of every network,
+// expiry and total, followed by random requests, to requests.json, and
+// payments of details paid in full and not, of merchant data good and bad
+// and of malformed messages, followed by random payments, to payments.json.
+// The vectors depend only on -seed and -count, so they can be regenerated
+// by anyone:
+//
+//	gentestvectors -count 50 -seed 70
+//
+// Both files use the layout of the BIP 158 vectors: a JSON array whose
+// first row names the columns, followed by one row per vector. Messages
+// are in hex, and the errors of those rejected by their messages, empty
+// for those accepted. A request is checked on its network at its time, as
+// a Unix timestamp, against the root certificate of the package's vectors,
+// and a valid one names the merchant who signed it, if anyone did. Pass
+// -check and -check-payments to verify existing files against the package
+// instead, which also runs the whole protocol for each valid request, with
+// a server of the package on a local port:
+//
+//	gentestvectors -check requests.json -check-payments payments.json
+//
+// The program lives in a directory of its own since the paymentprotocol
+// package sits at the root of the module.
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	paymentprotocol "github.com/christsim/bips/bip-0070"
+	"github.com/christsim/bips/internal/vectorfile"
+)
+
+// requestColumns is the header row of the request vector file.
+const requestColumns = "Request,Network,Time,Merchant,Error,Comment"
+
+// paymentColumns is the header row of the payment vector file.
+const paymentColumns = "Details,Payment,Error,Comment"
+
+type JSONTestWriter struct {
+	writer          io.Writer
+	firstRowWritten bool
+}
+
+func NewJSONTestWriter(writer io.Writer) *JSONTestWriter {
+	return &JSONTestWriter{writer: writer}
+}
+
+func (w *JSONTestWriter) WriteComment(comment string) error {
+	return w.WriteTestCase([]interface{}{comment})
+}
+
+func (w *JSONTestWriter) WriteTestCase(row []interface{}) error {
+	var err error
+	if w.firstRowWritten {
+		_, err = io.WriteString(w.writer, ",\n")
+	} else {
+		_, err = io.WriteString(w.writer, "[\n")
+		w.firstRowWritten = true
+	}
+	if err != nil {
+		return err
+	}
+
+	rowBytes, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.writer.Write(rowBytes)
+	return err
+}
+
+func (w *JSONTestWriter) Close() error {
+	if !w.firstRowWritten {
+		return nil
+	}
+
+	_, err := io.WriteString(w.writer, "\n]\n")
+	return err
+}
+
+func main() {
+	out := flag.String("out", "requests.json", "file to write the "+
+		"request vectors to")
+	paymentsOut := flag.String("payments-out", "payments.json", "file "+
+		"to write the payment vectors to")
+	count := flag.Int("count", 50, "number of random requests and "+
+		"payments to write vectors of")
+	seed := flag.Int64("seed", 70, "seed of the random vectors")
+	check := flag.String("check", "", "request vector file to check "+
+		"instead of writing the files")
+	checkPayments := flag.String("check-payments", "", "payment vector "+
+		"file to check instead of writing the files")
+	flag.Parse()
+
+	var err error
+	switch {
+	case *check != "" || *checkPayments != "":
+		if *check != "" {
+			err = checkFile(*check)
+		}
+		if err == nil && *checkPayments != "" {
+			err = checkPaymentsFile(*checkPayments)
+		}
+	default:
+		err = writeFile(*out, *seed, *count)
+		if err == nil {
+			err = writePaymentsFile(*paymentsOut, *seed, *count)
+		}
+	}
+	if err != nil {
+		fmt.Println("Error: ", err.Error())
+		os.Exit(1)
+	}
+}
+
+// writeRows writes the header and rows to a new vector file at path.
+func writeRows(path, columns string, rows [][]interface{}) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := NewJSONTestWriter(file)
+	if err := writer.WriteComment(columns); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if err := writer.WriteTestCase(row); err != nil {
+			return err
+		}
+	}
+	return writer.Close()
+}
+
+// writeFile writes the request vectors, with count random ones, to out.
+func writeFile(out string, seed int64, count int) error {
+	var rows [][]interface{}
+	vectors := paymentprotocol.RequestVectors(seed, count)
+	for _, v := range vectors {
+		rows = append(rows, []interface{}{
+			hex.EncodeToString(v.Request),
+			v.Network,
+			v.Time,
+			v.Merchant,
+			vectorfile.ErrorString(v.Err),
+			v.Comment,
+		})
+	}
+	if err := writeRows(out, requestColumns, rows); err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote %d request vectors\n", len(vectors))
+	return nil
+}
+
+// writePaymentsFile writes the payment vectors, with count random ones, to
+// out.
+func writePaymentsFile(out string, seed int64, count int) error {
+	var rows [][]interface{}
+	vectors := paymentprotocol.PaymentVectors(seed, count)
+	for _, v := range vectors {
+		rows = append(rows, []interface{}{
+			hex.EncodeToString(v.Details),
+			hex.EncodeToString(v.Payment),
+			vectorfile.ErrorString(v.Err),
+			v.Comment,
+		})
+	}
+	if err := writeRows(out, paymentColumns, rows); err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote %d payment vectors\n", len(vectors))
+	return nil
+}
+
+// checkFile checks each vector of the file with
+// paymentprotocol.CheckRequestVector, and runs the protocol for each valid
+// one with paymentprotocol.CheckFlow.
+func checkFile(path string) error {
+	rows, err := vectorfile.ReadRows(path, 6)
+	if err != nil {
+		return err
+	}
+	flows := 0
+	for _, row := range rows {
+		var v paymentprotocol.RequestVector
+		var request, errMsg string
+		err := vectorfile.DecodeRow(row, &request, &v.Network, &v.Time,
+			&v.Merchant, &errMsg, &v.Comment)
+		if err != nil {
+			return err
+		}
+		if v.Request, err = hex.DecodeString(request); err != nil {
+			return fmt.Errorf("%v: %v", v.Comment, err)
+		}
+		v.Err = vectorfile.ParseError(errMsg)
+		if err := paymentprotocol.CheckRequestVector(v); err != nil {
+			return fmt.Errorf("%v: %v", v.Comment, err)
+		}
+		if v.Err != nil {
+			continue
+		}
+		if err := paymentprotocol.CheckFlow(v); err != nil {
+			return fmt.Errorf("%v: %v", v.Comment, err)
+		}
+		flows++
+	}
+	fmt.Printf("%d request vectors OK, %d flows OK\n", len(rows), flows)
+	return nil
+}
+
+// checkPaymentsFile checks each vector of the file with
+// paymentprotocol.CheckPaymentVector.
+func checkPaymentsFile(path string) error {
+	rows, err := vectorfile.ReadRows(path, 4)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		var v paymentprotocol.PaymentVector
+		var details, payment, errMsg string
+		err := vectorfile.DecodeRow(row, &details, &payment, &errMsg,
+			&v.Comment)
+		if err != nil {
+			return err
+		}
+		if v.Details, err = hex.DecodeString(details); err != nil {
+			return fmt.Errorf("%v: %v", v.Comment, err)
+		}
+		if v.Payment, err = hex.DecodeString(payment); err != nil {
+			return fmt.Errorf("%v: %v", v.Comment, err)
+		}
+		v.Err = vectorfile.ParseError(errMsg)
+		if err := paymentprotocol.CheckPaymentVector(v); err != nil {
+			return fmt.Errorf("%v: %v", v.Comment, err)
+		}
+	}
+	fmt.Printf("%d payment vectors OK\n", len(rows))
+	return nil
+}
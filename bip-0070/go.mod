@@ -0,0 +1,35 @@
+module github.com/christsim/bips/bip-0070
+
+go 1.21
+
+require (
+	github.com/btcsuite/btcd v0.24.2
+	github.com/btcsuite/btcd/btcutil v1.1.6
+	github.com/btcsuite/btcd/chaincfg/chainhash v1.1.0
+	github.com/christsim/bips/bip-0021 v0.0.0
+	github.com/christsim/bips/internal v0.0.0
+)
+
+require (
+	github.com/aead/siphash v1.0.1 // indirect
+	github.com/btcsuite/btcd/btcec/v2 v2.3.4 // indirect
+	github.com/btcsuite/btclog v0.0.0-20170628155309-84c8d2346e9f // indirect
+	github.com/christsim/bips/bip-0158 v0.0.0 // indirect
+	github.com/christsim/bips/bip-0173 v0.0.0 // indirect
+	github.com/christsim/bips/bip-0340 v0.0.0 // indirect
+	github.com/christsim/bips/bip-0352 v0.0.0 // indirect
+	github.com/decred/dcrd/crypto/blake256 v1.0.0 // indirect
+	github.com/decred/dcrd/dcrec/secp256k1/v4 v4.0.1 // indirect
+	github.com/roasbeef/btcd v0.0.0-20180418012700-a03db407e40d // indirect
+	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9 // indirect
+	golang.org/x/sys v0.0.0-20200814200057-3d37ad5750ed // indirect
+)
+
+replace (
+	github.com/christsim/bips/bip-0021 => ../bip-0021
+	github.com/christsim/bips/bip-0158 => ../bip-0158
+	github.com/christsim/bips/bip-0173 => ../bip-0173
+	github.com/christsim/bips/bip-0340 => ../bip-0340
+	github.com/christsim/bips/bip-0352 => ../bip-0352
+	github.com/christsim/bips/internal => ../internal
+)
@@ -0,0 +1,385 @@
+package paymentprotocol
+
+import "fmt"
+
+// Output is an amount in satoshis paid to an output script, zero for an
+// amount the customer chooses.
+type Output struct {
+	Amount uint64
+	Script []byte
+}
+
+// appendOutputField appends the output as a field of the number.
+func appendOutputField(b []byte, num int, o Output) []byte {
+	var data []byte
+	if o.Amount != 0 {
+		data = appendVarintField(data, 1, o.Amount)
+	}
+	data = appendBytesField(data, 2, o.Script)
+	return appendBytesField(b, num, data)
+}
+
+// parseOutput parses the data of an output field.
+func parseOutput(b []byte) (Output, error) {
+	fields, err := readFields(b)
+	if err != nil {
+		return Output{}, err
+	}
+	var o Output
+	hasScript := false
+	for i := range fields {
+		f := &fields[i]
+		switch f.num {
+		case 1:
+			o.Amount, err = f.uint()
+		case 2:
+			o.Script, err = f.bytes()
+			hasScript = true
+		}
+		if err != nil {
+			return Output{}, err
+		}
+	}
+	if !hasScript {
+		return Output{}, fmt.Errorf("%w: script of output",
+			ErrMissingField)
+	}
+	return o, nil
+}
+
+// PaymentDetails is what a merchant asks to be paid: the outputs, on the
+// network, of a request created at Time and valid until Expires, if it
+// isn't zero, with a memo for the customer, and the URL to send the Payment
+// to, with the merchant data copied in it.
+type PaymentDetails struct {
+	Network      string
+	Outputs      []Output
+	Time         uint64
+	Expires      uint64
+	Memo         string
+	PaymentURL   string
+	MerchantData []byte
+}
+
+// Serialize returns the serialization of the details, leaving out the
+// fields that are empty or of their default values.
+func (d *PaymentDetails) Serialize() []byte {
+	var b []byte
+	if d.Network != "" && d.Network != MainNetwork {
+		b = appendBytesField(b, 1, []byte(d.Network))
+	}
+	for _, o := range d.Outputs {
+		b = appendOutputField(b, 2, o)
+	}
+	b = appendVarintField(b, 3, d.Time)
+	if d.Expires != 0 {
+		b = appendVarintField(b, 4, d.Expires)
+	}
+	if d.Memo != "" {
+		b = appendBytesField(b, 5, []byte(d.Memo))
+	}
+	if d.PaymentURL != "" {
+		b = appendBytesField(b, 6, []byte(d.PaymentURL))
+	}
+	if len(d.MerchantData) > 0 {
+		b = appendBytesField(b, 7, d.MerchantData)
+	}
+	return b
+}
+
+// ParsePaymentDetails parses serialized payment details, whose network is
+// MainNetwork unless it says otherwise.
+func ParsePaymentDetails(b []byte) (*PaymentDetails, error) {
+	fields, err := readFields(b)
+	if err != nil {
+		return nil, err
+	}
+	d := &PaymentDetails{Network: MainNetwork}
+	hasTime := false
+	for i := range fields {
+		f := &fields[i]
+		switch f.num {
+		case 1:
+			d.Network, err = f.string()
+		case 2:
+			var data []byte
+			if data, err = f.bytes(); err == nil {
+				var o Output
+				o, err = parseOutput(data)
+				d.Outputs = append(d.Outputs, o)
+			}
+		case 3:
+			d.Time, err = f.uint()
+			hasTime = true
+		case 4:
+			d.Expires, err = f.uint()
+		case 5:
+			d.Memo, err = f.string()
+		case 6:
+			d.PaymentURL, err = f.string()
+		case 7:
+			d.MerchantData, err = f.bytes()
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !hasTime {
+		return nil, fmt.Errorf("%w: time of payment details",
+			ErrMissingField)
+	}
+	return d, nil
+}
+
+// PaymentRequest is payment details, serialized, optionally signed by the
+// merchant with the key of the first certificate of the PKI data.
+type PaymentRequest struct {
+	PaymentDetailsVersion    uint32
+	PKIType                  string
+	PKIData                  []byte
+	SerializedPaymentDetails []byte
+	Signature                []byte
+
+	// raw is the serialization the request was parsed from, which its
+	// signature covers, or nil for a request built by the caller.
+	raw []byte
+}
+
+// Serialize returns the serialization of the request, as it was parsed if
+// it was, leaving out the fields that are empty or of their default values
+// otherwise.
+func (r *PaymentRequest) Serialize() []byte {
+	if r.raw != nil {
+		return append([]byte{}, r.raw...)
+	}
+
+	var b []byte
+	if r.PaymentDetailsVersion != DetailsVersion {
+		b = appendVarintField(b, 1, uint64(r.PaymentDetailsVersion))
+	}
+	if r.PKIType != "" && r.PKIType != PKINone {
+		b = appendBytesField(b, 2, []byte(r.PKIType))
+	}
+	if len(r.PKIData) > 0 {
+		b = appendBytesField(b, 3, r.PKIData)
+	}
+	b = appendBytesField(b, 4, r.SerializedPaymentDetails)
+	if len(r.Signature) > 0 {
+		b = appendBytesField(b, 5, r.Signature)
+	}
+	return b
+}
+
+// ParsePaymentRequest parses a serialized request of up to MaxRequestSize
+// bytes, whose version is DetailsVersion and PKI type PKINone unless it
+// says otherwise. Fields it doesn't know are kept in its serialization.
+func ParsePaymentRequest(b []byte) (*PaymentRequest, error) {
+	if len(b) > MaxRequestSize {
+		return nil, fmt.Errorf("%w: request of %d bytes", ErrTooLarge,
+			len(b))
+	}
+	fields, err := readFields(b)
+	if err != nil {
+		return nil, err
+	}
+	r := &PaymentRequest{
+		PaymentDetailsVersion: DetailsVersion,
+		PKIType:               PKINone,
+		raw:                   append([]byte{}, b...),
+	}
+	hasDetails := false
+	for i := range fields {
+		f := &fields[i]
+		switch f.num {
+		case 1:
+			var v uint64
+			v, err = f.uint()
+			r.PaymentDetailsVersion = uint32(v)
+		case 2:
+			r.PKIType, err = f.string()
+		case 3:
+			r.PKIData, err = f.bytes()
+		case 4:
+			r.SerializedPaymentDetails, err = f.bytes()
+			hasDetails = true
+		case 5:
+			r.Signature, err = f.bytes()
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !hasDetails {
+		return nil, fmt.Errorf("%w: serialized payment details",
+			ErrMissingField)
+	}
+	return r, nil
+}
+
+// Details parses the payment details of the request.
+func (r *PaymentRequest) Details() (*PaymentDetails, error) {
+	return ParsePaymentDetails(r.SerializedPaymentDetails)
+}
+
+// X509Certificates is the PKI data of the X.509 PKI types: the DER
+// certificate of the merchant's key, followed by those certifying each
+// certificate before it, up to a trusted root, which may be left out.
+type X509Certificates struct {
+	Certificates [][]byte
+}
+
+// Serialize returns the serialization of the certificates.
+func (c *X509Certificates) Serialize() []byte {
+	var b []byte
+	for _, cert := range c.Certificates {
+		b = appendBytesField(b, 1, cert)
+	}
+	return b
+}
+
+// ParseX509Certificates parses serialized certificates.
+func ParseX509Certificates(b []byte) (*X509Certificates, error) {
+	fields, err := readFields(b)
+	if err != nil {
+		return nil, err
+	}
+	c := &X509Certificates{}
+	for i := range fields {
+		f := &fields[i]
+		if f.num != 1 {
+			continue
+		}
+		cert, err := f.bytes()
+		if err != nil {
+			return nil, err
+		}
+		c.Certificates = append(c.Certificates, cert)
+	}
+	return c, nil
+}
+
+// Payment is what a customer sends the merchant after paying: the signed
+// transactions paying the outputs of the details, the merchant data of the
+// details, outputs to refund the customer to and a memo for the merchant.
+type Payment struct {
+	MerchantData []byte
+	Transactions [][]byte
+	RefundTo     []Output
+	Memo         string
+}
+
+// Serialize returns the serialization of the payment, leaving out the
+// fields that are empty.
+func (p *Payment) Serialize() []byte {
+	var b []byte
+	if len(p.MerchantData) > 0 {
+		b = appendBytesField(b, 1, p.MerchantData)
+	}
+	for _, tx := range p.Transactions {
+		b = appendBytesField(b, 2, tx)
+	}
+	for _, o := range p.RefundTo {
+		b = appendOutputField(b, 3, o)
+	}
+	if p.Memo != "" {
+		b = appendBytesField(b, 4, []byte(p.Memo))
+	}
+	return b
+}
+
+// ParsePayment parses a serialized payment of up to MaxPaymentSize bytes.
+func ParsePayment(b []byte) (*Payment, error) {
+	if len(b) > MaxPaymentSize {
+		return nil, fmt.Errorf("%w: payment of %d bytes", ErrTooLarge,
+			len(b))
+	}
+	return parsePayment(b)
+}
+
+// parsePayment parses a serialized payment of any size.
+func parsePayment(b []byte) (*Payment, error) {
+	fields, err := readFields(b)
+	if err != nil {
+		return nil, err
+	}
+	p := &Payment{}
+	for i := range fields {
+		f := &fields[i]
+		switch f.num {
+		case 1:
+			p.MerchantData, err = f.bytes()
+		case 2:
+			var tx []byte
+			tx, err = f.bytes()
+			p.Transactions = append(p.Transactions, tx)
+		case 3:
+			var data []byte
+			if data, err = f.bytes(); err == nil {
+				var o Output
+				o, err = parseOutput(data)
+				p.RefundTo = append(p.RefundTo, o)
+			}
+		case 4:
+			p.Memo, err = f.string()
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// PaymentACK is the merchant's acknowledgement of a payment, with a memo
+// for the customer on its status.
+type PaymentACK struct {
+	Payment Payment
+	Memo    string
+}
+
+// Serialize returns the serialization of the acknowledgement.
+func (a *PaymentACK) Serialize() []byte {
+	b := appendBytesField(nil, 1, a.Payment.Serialize())
+	if a.Memo != "" {
+		b = appendBytesField(b, 2, []byte(a.Memo))
+	}
+	return b
+}
+
+// ParsePaymentACK parses a serialized acknowledgement of up to MaxACKSize
+// bytes.
+func ParsePaymentACK(b []byte) (*PaymentACK, error) {
+	if len(b) > MaxACKSize {
+		return nil, fmt.Errorf("%w: acknowledgement of %d bytes",
+			ErrTooLarge, len(b))
+	}
+	fields, err := readFields(b)
+	if err != nil {
+		return nil, err
+	}
+	a := &PaymentACK{}
+	hasPayment := false
+	for i := range fields {
+		f := &fields[i]
+		switch f.num {
+		case 1:
+			var data []byte
+			var p *Payment
+			if data, err = f.bytes(); err == nil {
+				if p, err = parsePayment(data); err == nil {
+					a.Payment = *p
+				}
+			}
+			hasPayment = true
+		case 2:
+			a.Memo, err = f.string()
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !hasPayment {
+		return nil, fmt.Errorf("%w: payment of acknowledgement",
+			ErrMissingField)
+	}
+	return a, nil
+}
@@ -0,0 +1,392 @@
+// Package paymentprotocol implements the payment protocol of BIP 70, with
+// the media types of BIP 71 and the r parameter of bitcoin: URIs of BIP 72.
+// A customer's wallet fetches a PaymentRequest from the URL of the
+// parameter, checks the merchant's signature of it with the X.509
+// certificates it carries, pays the outputs of its PaymentDetails, and
+// posts a Payment of the transactions to the merchant, who acknowledges it
+// with a PaymentACK:
+//
+//	client := &paymentprotocol.Client{Net: &chaincfg.MainNetParams}
+//	invoice, err := client.FetchURI(ctx, uri)
+//	ack, err := client.Pay(ctx, invoice, payment)
+//
+// The messages are protocol buffers, which the package encodes and decodes
+// itself, skipping the fields it doesn't know. A signature covers the
+// request as the merchant serialized it, with an empty signature field in
+// place of the signature: the fields before it in order, then the empty
+// field, then those after it, extensions included. The certificate chain
+// is verified against a pool of trusted roots, the system's by default,
+// and the signature by the key of its first certificate, RSA or ECDSA.
+//
+// Server is the merchant's side of the protocol, serving a request and
+// acknowledging the payments of it, and the vectors check the whole flow
+// against one, over TLS on a local port.
+package paymentprotocol
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// The media types of the messages, of BIP 71.
+const (
+	RequestMediaType = "application/bitcoin-paymentrequest"
+	PaymentMediaType = "application/bitcoin-payment"
+	ACKMediaType     = "application/bitcoin-paymentack"
+)
+
+// The largest messages wallets and merchants accept, in bytes. An
+// acknowledgement is larger as it holds a payment.
+const (
+	MaxRequestSize = 50000
+	MaxPaymentSize = 50000
+	MaxACKSize     = 60000
+)
+
+const (
+	// DetailsVersion is the version of the payment details of BIP 70.
+	DetailsVersion = 1
+
+	// MainNetwork is the network of payment details that don't say.
+	MainNetwork = "main"
+)
+
+// The PKI types of requests: unsigned, and signed by the key of an X.509
+// certificate over the SHA-256 or SHA-1 hash of the request.
+const (
+	PKINone       = "none"
+	PKIX509SHA256 = "x509+sha256"
+	PKIX509SHA1   = "x509+sha1"
+)
+
+var (
+	// ErrMalformedMessage is returned for a message that isn't a valid
+	// protocol buffer, or has a field of the wrong wire type.
+	ErrMalformedMessage = errors.New("paymentprotocol: malformed message")
+
+	// ErrMissingField is returned for a message without a required field.
+	ErrMissingField = errors.New("paymentprotocol: missing required field")
+
+	// ErrTooLarge is returned for a message larger than its limit.
+	ErrTooLarge = errors.New("paymentprotocol: message too large")
+
+	// ErrUnsupportedVersion is returned for a request of a version of the
+	// payment details other than DetailsVersion.
+	ErrUnsupportedVersion = errors.New("paymentprotocol: unsupported " +
+		"payment details version")
+
+	// ErrUnknownPKIType is returned for a request of a PKI type other than
+	// those of BIP 70.
+	ErrUnknownPKIType = errors.New("paymentprotocol: unknown PKI type")
+
+	// ErrNoCertificates is returned for a request of an X.509 PKI type
+	// without certificates.
+	ErrNoCertificates = errors.New("paymentprotocol: no certificates")
+
+	// ErrInvalidCertificate is returned for a certificate that doesn't
+	// parse.
+	ErrInvalidCertificate = errors.New("paymentprotocol: invalid " +
+		"certificate")
+
+	// ErrUntrustedCertificate is returned for a certificate chain that
+	// doesn't verify up to a trusted root.
+	ErrUntrustedCertificate = errors.New("paymentprotocol: untrusted " +
+		"certificate")
+
+	// ErrInvalidSignature is returned for a signature that the key of the
+	// merchant's certificate doesn't verify.
+	ErrInvalidSignature = errors.New("paymentprotocol: invalid signature")
+
+	// ErrWrongNetwork is returned for payment details of another network.
+	ErrWrongNetwork = errors.New("paymentprotocol: wrong network")
+
+	// ErrExpired is returned for payment details that have expired.
+	ErrExpired = errors.New("paymentprotocol: payment request expired")
+
+	// ErrNoOutputs is returned for payment details without outputs.
+	ErrNoOutputs = errors.New("paymentprotocol: no outputs")
+
+	// ErrInvalidAmount is returned for payment details whose amounts add
+	// up to more bitcoins than there will ever be.
+	ErrInvalidAmount = errors.New("paymentprotocol: invalid amount")
+
+	// ErrInvalidTransaction is returned for a transaction of a payment
+	// that doesn't deserialize.
+	ErrInvalidTransaction = errors.New("paymentprotocol: invalid " +
+		"transaction")
+
+	// ErrMerchantDataMismatch is returned for a payment whose merchant
+	// data isn't that of the details.
+	ErrMerchantDataMismatch = errors.New("paymentprotocol: merchant data " +
+		"mismatch")
+
+	// ErrUnderpaid is returned for a payment whose transactions don't pay
+	// the outputs of the details in full.
+	ErrUnderpaid = errors.New("paymentprotocol: payment short of the " +
+		"request")
+)
+
+// networkNames are the names of networks in payment details, by the name
+// of their parameters in btcd, which are those of Bitcoin Core.
+var networkNames = map[string]string{
+	chaincfg.MainNetParams.Name:       MainNetwork,
+	chaincfg.TestNet3Params.Name:      "test",
+	chaincfg.RegressionNetParams.Name: "regtest",
+	chaincfg.SigNetParams.Name:        "signet",
+}
+
+// NetworkName returns the name payment details give the network.
+func NetworkName(net *chaincfg.Params) string {
+	if name, ok := networkNames[net.Name]; ok {
+		return name
+	}
+	return net.Name
+}
+
+// withSignature returns the serialized request with its signature field
+// replaced by one of the signature: the fields before it, in order, then
+// that of the signature, then those after it.
+func withSignature(raw, signature []byte) ([]byte, error) {
+	fields, err := readFields(raw)
+	if err != nil {
+		return nil, err
+	}
+	var before, after []byte
+	for _, f := range fields {
+		switch {
+		case f.num < 5:
+			before = append(before, f.raw...)
+		case f.num > 5:
+			after = append(after, f.raw...)
+		}
+	}
+	b := appendBytesField(before, 5, signature)
+	return append(b, after...), nil
+}
+
+// signatureHash returns the hash of the PKI type.
+func signatureHash(pkiType string) (crypto.Hash, error) {
+	switch pkiType {
+	case PKIX509SHA256:
+		return crypto.SHA256, nil
+	case PKIX509SHA1:
+		return crypto.SHA1, nil
+	default:
+		return 0, fmt.Errorf("%w: %q", ErrUnknownPKIType, pkiType)
+	}
+}
+
+// digest returns the digest of the request with an empty signature field,
+// which its signature signs, with the hash.
+func (r *PaymentRequest) digest(hash crypto.Hash) ([]byte, error) {
+	data, err := withSignature(r.Serialize(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if hash == crypto.SHA1 {
+		sum := sha1.Sum(data)
+		return sum[:], nil
+	}
+	sum := sha256.Sum256(data)
+	return sum[:], nil
+}
+
+// Sign returns a request of the serialized details, signed with the key of
+// the first of the DER certificates over the hash of the X.509 PKI type.
+func Sign(details []byte, pkiType string, certs [][]byte,
+	key crypto.Signer) (*PaymentRequest, error) {
+
+	hash, err := signatureHash(pkiType)
+	if err != nil {
+		return nil, err
+	}
+	pkiData := (&X509Certificates{Certificates: certs}).Serialize()
+	r := &PaymentRequest{
+		PaymentDetailsVersion:    DetailsVersion,
+		PKIType:                  pkiType,
+		PKIData:                  pkiData,
+		SerializedPaymentDetails: details,
+	}
+	digest, err := r.digest(hash)
+	if err != nil {
+		return nil, err
+	}
+	if r.Signature, err = key.Sign(rand.Reader, digest, hash); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Verify checks the version of the request, and, for an X.509 PKI type,
+// verifies its certificate chain up to one of the roots, or the system's if
+// roots is nil, at the time, and its signature by the key of the merchant's
+// certificate. It returns the common name of that certificate, the
+// merchant's identity to show the customer, or an empty string for an
+// unsigned request.
+func (r *PaymentRequest) Verify(roots *x509.CertPool,
+	now time.Time) (string, error) {
+
+	if r.PaymentDetailsVersion != DetailsVersion {
+		return "", fmt.Errorf("%w: %d", ErrUnsupportedVersion,
+			r.PaymentDetailsVersion)
+	}
+	if r.PKIType == PKINone {
+		return "", nil
+	}
+	hash, err := signatureHash(r.PKIType)
+	if err != nil {
+		return "", err
+	}
+
+	pkiData, err := ParseX509Certificates(r.PKIData)
+	if err != nil {
+		return "", err
+	}
+	if len(pkiData.Certificates) == 0 {
+		return "", ErrNoCertificates
+	}
+	certs := make([]*x509.Certificate, len(pkiData.Certificates))
+	for i, der := range pkiData.Certificates {
+		if certs[i], err = x509.ParseCertificate(der); err != nil {
+			return "", fmt.Errorf("%w: %v", ErrInvalidCertificate,
+				err)
+		}
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err = certs[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   now,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrUntrustedCertificate, err)
+	}
+
+	digest, err := r.digest(hash)
+	if err != nil {
+		return "", err
+	}
+	switch key := certs[0].PublicKey.(type) {
+	case *rsa.PublicKey:
+		err = rsa.VerifyPKCS1v15(key, hash, digest, r.Signature)
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(key, digest, r.Signature) {
+			err = errors.New("ECDSA verification error")
+		}
+	default:
+		err = fmt.Errorf("key of type %T", key)
+	}
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	return certs[0].Subject.CommonName, nil
+}
+
+// Check checks that the details are of the network, have outputs, whose
+// amounts add up to at most every bitcoin, and haven't expired at the time.
+func (d *PaymentDetails) Check(net *chaincfg.Params, now time.Time) error {
+	if name := NetworkName(net); d.Network != name {
+		return fmt.Errorf("%w: %q, expected %q", ErrWrongNetwork,
+			d.Network, name)
+	}
+	if len(d.Outputs) == 0 {
+		return ErrNoOutputs
+	}
+	var total uint64
+	for _, o := range d.Outputs {
+		total += o.Amount
+		if o.Amount > btcutil.MaxSatoshi || total > btcutil.MaxSatoshi {
+			return fmt.Errorf("%w: outputs of more than %d "+
+				"satoshis", ErrInvalidAmount,
+				uint64(btcutil.MaxSatoshi))
+		}
+	}
+	if d.Expires != 0 && now.Unix() >= int64(d.Expires) {
+		return fmt.Errorf("%w: at %d", ErrExpired, d.Expires)
+	}
+	return nil
+}
+
+// NewPayment returns the payment of the signed transactions paying the
+// details, with their merchant data, and the refund outputs and memo.
+func NewPayment(d *PaymentDetails, txs []*wire.MsgTx, refundTo []Output,
+	memo string) (*Payment, error) {
+
+	p := &Payment{
+		MerchantData: d.MerchantData,
+		RefundTo:     refundTo,
+		Memo:         memo,
+	}
+	for _, tx := range txs {
+		var buf bytes.Buffer
+		if err := tx.Serialize(&buf); err != nil {
+			return nil, err
+		}
+		p.Transactions = append(p.Transactions, buf.Bytes())
+	}
+	return p, nil
+}
+
+// CheckPayment checks that the payment carries the merchant data of the
+// details, and transactions that pay each output script of the details at
+// least the sum of the amounts the details ask of it. Details of a zero
+// total leave the amount to the customer, but the transactions must still
+// pay one of their outputs.
+func (d *PaymentDetails) CheckPayment(p *Payment) error {
+	if !bytes.Equal(p.MerchantData, d.MerchantData) {
+		return fmt.Errorf("%w: %x, expected %x",
+			ErrMerchantDataMismatch, p.MerchantData, d.MerchantData)
+	}
+
+	paid := make(map[string]uint64)
+	for i, b := range p.Transactions {
+		var tx wire.MsgTx
+		if err := tx.Deserialize(bytes.NewReader(b)); err != nil {
+			return fmt.Errorf("%w: transaction %d: %v",
+				ErrInvalidTransaction, i, err)
+		}
+		for _, txOut := range tx.TxOut {
+			paid[string(txOut.PkScript)] += uint64(txOut.Value)
+		}
+	}
+
+	asked := make(map[string]uint64)
+	var total uint64
+	for _, o := range d.Outputs {
+		asked[string(o.Script)] += o.Amount
+		total += o.Amount
+	}
+	if total == 0 {
+		for script := range asked {
+			if paid[script] > 0 {
+				return nil
+			}
+		}
+		return fmt.Errorf("%w: no output paid", ErrUnderpaid)
+	}
+	for _, o := range d.Outputs {
+		if paid[string(o.Script)] < asked[string(o.Script)] {
+			return fmt.Errorf("%w: %d of %d satoshis to %x",
+				ErrUnderpaid, paid[string(o.Script)],
+				asked[string(o.Script)], o.Script)
+		}
+	}
+	return nil
+}
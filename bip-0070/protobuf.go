@@ -0,0 +1,139 @@
+package paymentprotocol
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// The wire types of the protocol buffer encoding. The start and end group
+// types are obsolete, and not used by the messages of BIP 70.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// maxFieldNum is the largest field number.
+const maxFieldNum = 1<<29 - 1
+
+// field is a field of a message as it was read: its number and wire type,
+// and its value, a varint or data, along with its raw bytes, tag included.
+type field struct {
+	num    int
+	typ    int
+	varint uint64
+	data   []byte
+	raw    []byte
+}
+
+// appendVarint appends the varint of the value.
+func appendVarint(b []byte, v uint64) []byte {
+	return binary.AppendUvarint(b, v)
+}
+
+// appendVarintField appends a varint field of the number and value.
+func appendVarintField(b []byte, num int, v uint64) []byte {
+	b = appendVarint(b, uint64(num)<<3|wireVarint)
+	return appendVarint(b, v)
+}
+
+// appendBytesField appends a length-delimited field of the number and data.
+func appendBytesField(b []byte, num int, data []byte) []byte {
+	b = appendVarint(b, uint64(num)<<3|wireBytes)
+	b = appendVarint(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+// readVarint reads a varint from the start of b, returning it and its
+// length.
+func readVarint(b []byte) (uint64, int, error) {
+	v, n := binary.Uvarint(b)
+	switch {
+	case n == 0:
+		return 0, 0, fmt.Errorf("%w: truncated varint",
+			ErrMalformedMessage)
+	case n < 0:
+		return 0, 0, fmt.Errorf("%w: varint overflows 64 bits",
+			ErrMalformedMessage)
+	}
+	return v, n, nil
+}
+
+// readFields reads the fields of the message, in order.
+func readFields(b []byte) ([]field, error) {
+	var fields []field
+	for len(b) > 0 {
+		tag, n, err := readVarint(b)
+		if err != nil {
+			return nil, err
+		}
+		if tag>>3 == 0 || tag>>3 > maxFieldNum {
+			return nil, fmt.Errorf("%w: field number %d",
+				ErrMalformedMessage, tag>>3)
+		}
+		f := field{num: int(tag >> 3), typ: int(tag & 7)}
+
+		rest := b[n:]
+		switch f.typ {
+		case wireVarint:
+			f.varint, n, err = readVarint(rest)
+			if err != nil {
+				return nil, err
+			}
+		case wireFixed64, wireFixed32:
+			n = 8
+			if f.typ == wireFixed32 {
+				n = 4
+			}
+			if len(rest) < n {
+				return nil, fmt.Errorf("%w: truncated field %d",
+					ErrMalformedMessage, f.num)
+			}
+			f.data = rest[:n]
+		case wireBytes:
+			length, m, err := readVarint(rest)
+			if err != nil {
+				return nil, err
+			}
+			if length > uint64(len(rest)-m) {
+				return nil, fmt.Errorf("%w: truncated field %d",
+					ErrMalformedMessage, f.num)
+			}
+			n = m + int(length)
+			f.data = rest[m:n]
+		default:
+			return nil, fmt.Errorf("%w: wire type %d of field %d",
+				ErrMalformedMessage, f.typ, f.num)
+		}
+		size := len(b) - len(rest) + n
+		f.raw, b = b[:size], b[size:]
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// checkType checks that the field is of the wire type its number has in
+// the message.
+func (f *field) checkType(typ int) error {
+	if f.typ != typ {
+		return fmt.Errorf("%w: wire type %d of field %d",
+			ErrMalformedMessage, f.typ, f.num)
+	}
+	return nil
+}
+
+// uint returns the value of a varint field.
+func (f *field) uint() (uint64, error) {
+	return f.varint, f.checkType(wireVarint)
+}
+
+// bytes returns the data of a length-delimited field.
+func (f *field) bytes() ([]byte, error) {
+	return f.data, f.checkType(wireBytes)
+}
+
+// string returns the data of a length-delimited field as a string.
+func (f *field) string() (string, error) {
+	return string(f.data), f.checkType(wireBytes)
+}
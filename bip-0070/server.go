@@ -0,0 +1,80 @@
+package paymentprotocol
+
+import (
+	"io"
+	"mime"
+	"net/http"
+)
+
+// Server is a merchant's side of the protocol, for a single request: it
+// serves the request to GET requests at any path, and acknowledges payments
+// of it posted to any path, those that carry its merchant data and pay its
+// outputs in full. Serve it over TLS, as BIP 70 asks of payment URLs.
+type Server struct {
+	request []byte
+	details *PaymentDetails
+
+	// OnPayment, if set, is called with each payment of the request, and
+	// returns the memo of its acknowledgement, or an error to reject it.
+	// BIP 70 asks merchants to acknowledge a payment every time it's sent.
+	OnPayment func(p *Payment) (string, error)
+}
+
+// NewServer returns a server of the request.
+func NewServer(request *PaymentRequest) (*Server, error) {
+	details, err := request.Details()
+	if err != nil {
+		return nil, err
+	}
+	return &Server{request: request.Serialize(), details: details}, nil
+}
+
+// ServeHTTP serves the request or acknowledges a payment.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		w.Header().Set("Content-Type", RequestMediaType)
+		w.Header().Set("Content-Transfer-Encoding", "binary")
+		w.Write(s.request)
+	case http.MethodPost:
+		s.servePayment(w, r)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		http.Error(w, "method not allowed",
+			http.StatusMethodNotAllowed)
+	}
+}
+
+// servePayment acknowledges the payment posted, or rejects it.
+func (s *Server) servePayment(w http.ResponseWriter, r *http.Request) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != PaymentMediaType {
+		http.Error(w, "expected "+PaymentMediaType,
+			http.StatusUnsupportedMediaType)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, MaxPaymentSize+1))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	p, err := ParsePayment(body)
+	if err == nil {
+		err = s.details.CheckPayment(p)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ack := &PaymentACK{Payment: *p}
+	if s.OnPayment != nil {
+		if ack.Memo, err = s.OnPayment(p); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", ACKMediaType)
+	w.Header().Set("Content-Transfer-Encoding", "binary")
+	w.Write(ack.Serialize())
+}
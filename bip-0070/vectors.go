@@ -0,0 +1,840 @@
+package paymentprotocol
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/christsim/bips/internal/vectorfile"
+)
+
+// ErrVectorMismatch is returned by the checks of the vectors when a vector
+// doesn't give the expected result.
+var ErrVectorMismatch = errors.New("paymentprotocol: vector mismatch")
+
+// ErrUnknownNetwork is returned by CheckRequestVector for a vector of a
+// network btcd doesn't have.
+var ErrUnknownNetwork = errors.New("paymentprotocol: unknown network")
+
+// networks are the networks of the vectors, by name.
+var networks = map[string]*chaincfg.Params{
+	chaincfg.MainNetParams.Name:       &chaincfg.MainNetParams,
+	chaincfg.TestNet3Params.Name:      &chaincfg.TestNet3Params,
+	chaincfg.SigNetParams.Name:        &chaincfg.SigNetParams,
+	chaincfg.RegressionNetParams.Name: &chaincfg.RegressionNetParams,
+}
+
+// vectorTime is the time most vectors are checked at, the start of 2025.
+const vectorTime = 1735689600
+
+// The URLs of the requests of the vectors, which CheckFlow serves them at,
+// and of their payments.
+const (
+	requestURL = "https://merchant.example/request"
+	paymentURL = "https://merchant.example/pay"
+)
+
+// ackMemo is the memo of the acknowledgements of CheckFlow.
+const ackMemo = "Thank you for your payment"
+
+// RequestVector is a serialized payment request, checked on the network at
+// the time against the root certificate of the vectors, and the merchant
+// it's verified to be signed by, or the error it's rejected with.
+type RequestVector struct {
+	Request []byte
+	Network string
+	Time    int64
+
+	// Merchant is the common name of the merchant's certificate of a
+	// valid signed request, or empty.
+	Merchant string
+
+	// Err is the error an invalid request is rejected with, or nil.
+	Err error
+
+	// Comment describes what the vector exercises.
+	Comment string
+}
+
+// mustDER returns the DER certificate of the PEM block, panicking if there
+// isn't one.
+func mustDER(s string) []byte {
+	block, _ := pem.Decode([]byte(s))
+	if block == nil {
+		panic("paymentprotocol: no PEM block")
+	}
+	return block.Bytes
+}
+
+// vectorRoots returns a pool of the root certificate of the vectors.
+func vectorRoots() *x509.CertPool {
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM([]byte(rootCertPEM)) {
+		panic("paymentprotocol: bad root certificate")
+	}
+	return roots
+}
+
+// merchantKey returns the merchant's key the vectors are signed with.
+func merchantKey() *rsa.PrivateKey {
+	key, err := x509.ParsePKCS1PrivateKey(mustDER(merchantKeyPEM))
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
+
+// vectorScript returns a P2WPKH output script for the outputs of the
+// vectors.
+func vectorScript(tag string) []byte {
+	hash := sha256.Sum256([]byte(tag))
+	return append([]byte{txscript.OP_0, txscript.OP_DATA_20},
+		hash[:20]...)
+}
+
+// checkRequest parses the serialized request, verifies it against the root
+// of the vectors and checks its details on the network at the time,
+// returning its merchant.
+func checkRequest(b []byte, net *chaincfg.Params, t int64) (string, error) {
+	r, err := ParsePaymentRequest(b)
+	if err != nil {
+		return "", err
+	}
+	now := time.Unix(t, 0)
+	merchant, err := r.Verify(vectorRoots(), now)
+	if err != nil {
+		return "", err
+	}
+	details, err := r.Details()
+	if err != nil {
+		return "", err
+	}
+	if err := details.Check(net, now); err != nil {
+		return "", err
+	}
+	return merchant, nil
+}
+
+// newRequestVector returns the vector of checking the serialized request on
+// the network at the time.
+func newRequestVector(b []byte, net *chaincfg.Params, t int64,
+	comment string) RequestVector {
+
+	v := RequestVector{
+		Request: b,
+		Network: net.Name,
+		Time:    t,
+		Comment: comment,
+	}
+	v.Merchant, v.Err = checkRequest(b, net, t)
+	return v
+}
+
+// signRaw returns the serialized request signed over the hash by the
+// merchant's key as it is, fields Sign doesn't write included.
+func signRaw(raw []byte, hash crypto.Hash) []byte {
+	r, err := ParsePaymentRequest(raw)
+	if err != nil {
+		panic(err)
+	}
+	digest, err := r.digest(hash)
+	if err != nil {
+		panic(err)
+	}
+	signature, err := merchantKey().Sign(nil, digest, hash)
+	if err != nil {
+		panic(err)
+	}
+	b, err := withSignature(raw, signature)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// RequestVectors returns vectors of requests unsigned and signed over
+// either hash, of certificate chains good and bad, of signatures broken in
+// every way and covering fields Sign doesn't write, of versions and PKI
+// types unknown, of malformed messages, and of details of every network,
+// expiry and total. They are followed by count random requests, signed or
+// not, of which the signed ones have a bit flipped or not, derived from a
+// math/rand source with the seed.
+func RequestVectors(rngSeed int64, count int) []RequestVector {
+	main := &chaincfg.MainNetParams
+	test := &chaincfg.TestNet3Params
+	signet := &chaincfg.SigNetParams
+	regtest := &chaincfg.RegressionNetParams
+
+	key := merchantKey()
+	root := mustDER(rootCertPEM)
+	intermediate := mustDER(intermediateCertPEM)
+	merchant := mustDER(merchantCertPEM)
+	chain := [][]byte{merchant, intermediate}
+
+	details := func(edit func(d *PaymentDetails)) *PaymentDetails {
+		d := &PaymentDetails{
+			Network: MainNetwork,
+			Outputs: []Output{{
+				Amount: 100000,
+				Script: vectorScript("output"),
+			}},
+			Time:         vectorTime - 60,
+			Expires:      vectorTime + 3600,
+			Memo:         "Order 1234",
+			PaymentURL:   paymentURL,
+			MerchantData: []byte("order=1234"),
+		}
+		if edit != nil {
+			edit(d)
+		}
+		return d
+	}
+	unsigned := func(serialized []byte) *PaymentRequest {
+		return &PaymentRequest{
+			PaymentDetailsVersion:    DetailsVersion,
+			PKIType:                  PKINone,
+			SerializedPaymentDetails: serialized,
+		}
+	}
+	sign := func(serialized []byte, pkiType string,
+		certs ...[]byte) *PaymentRequest {
+
+		r, err := Sign(serialized, pkiType, certs, key)
+		if err != nil {
+			panic(err)
+		}
+		return r
+	}
+	signed := func(edit func(d *PaymentDetails)) []byte {
+		return sign(details(edit).Serialize(), PKIX509SHA256,
+			chain...).Serialize()
+	}
+	// toSign is a request of the details that's yet to be signed.
+	toSign := func() *PaymentRequest {
+		r := unsigned(details(nil).Serialize())
+		r.PKIType = PKIX509SHA256
+		r.PKIData = (&X509Certificates{Certificates: chain}).Serialize()
+		return r
+	}
+
+	base := signed(nil)
+	baseSignature := sign(details(nil).Serialize(), PKIX509SHA256,
+		chain...).Signature
+	flipped := append([]byte{}, baseSignature...)
+	flipped[len(flipped)/2] ^= 1
+
+	changed := sign(details(nil).Serialize(), PKIX509SHA256, chain...)
+	changed.SerializedPaymentDetails = details(func(d *PaymentDetails) {
+		d.Outputs[0].Amount = 1
+	}).Serialize()
+
+	rehashed := sign(details(nil).Serialize(), PKIX509SHA256, chain...)
+	rehashed.PKIType = PKIX509SHA1
+
+	explicitVersion := signRaw(append(appendVarintField(nil, 1,
+		DetailsVersion), toSign().Serialize()...), crypto.SHA256)
+	extension := signRaw(appendBytesField(toSign().Serialize(), 1000,
+		[]byte("extension")), crypto.SHA256)
+	version2 := toSign()
+	version2.PaymentDetailsVersion = 2
+	version0 := toSign()
+	version0.PaymentDetailsVersion = 0
+
+	unknownType := toSign()
+	unknownType.PKIType = "x509+sha512"
+	unknownType.Signature = baseSignature
+	noCerts := toSign()
+	noCerts.PKIData = nil
+	noCerts.Signature = baseSignature
+	garbageCert := toSign()
+	garbageCert.PKIData = (&X509Certificates{
+		Certificates: [][]byte{{1, 2, 3}},
+	}).Serialize()
+	garbageCert.Signature = baseSignature
+	badPKIData := toSign()
+	badPKIData.PKIData = []byte{0xff}
+	badPKIData.Signature = baseSignature
+	junkSignature := unsigned(details(nil).Serialize())
+	junkSignature.Signature = []byte("junk")
+
+	mainWritten := append(appendBytesField(nil, 1, []byte(MainNetwork)),
+		details(nil).Serialize()...)
+	output := appendOutputField(nil, 2, details(nil).Outputs[0])
+	noScript := appendVarintField(nil, 1, 100000)
+	beforeMerchantCert := time.Date(2023, 6, 1, 0, 0, 0, 0,
+		time.UTC).Unix()
+
+	cases := []struct {
+		request []byte
+		net     *chaincfg.Params
+		time    int64
+		comment string
+	}{
+		// Signatures.
+		{unsigned(details(nil).Serialize()).Serialize(), main,
+			vectorTime, "Unsigned request"},
+		{base, main, vectorTime, "Request signed over SHA-256"},
+		{sign(details(nil).Serialize(), PKIX509SHA1,
+			chain...).Serialize(), main, vectorTime,
+			"Request signed over SHA-1"},
+		{sign(details(nil).Serialize(), PKIX509SHA256, merchant,
+			intermediate, root).Serialize(), main, vectorTime,
+			"Chain including the root"},
+		{sign(details(nil).Serialize(), PKIX509SHA256,
+			merchant).Serialize(), main, vectorTime,
+			"Merchant certificate without the intermediate"},
+		{sign(details(nil).Serialize(), PKIX509SHA256,
+			mustDER(selfSignedCertPEM)).Serialize(), main,
+			vectorTime, "Self-signed certificate"},
+		{sign(details(nil).Serialize(), PKIX509SHA256,
+			mustDER(expiredCertPEM), intermediate).Serialize(),
+			main, vectorTime, "Expired certificate"},
+		{base, main, beforeMerchantCert,
+			"Certificate not yet valid"},
+		{sign(details(nil).Serialize(), PKIX509SHA256, intermediate,
+			merchant).Serialize(), main, vectorTime,
+			"Intermediate before the merchant certificate"},
+		{mustWithSignature(base, flipped), main, vectorTime,
+			"Signature of a flipped bit"},
+		{mustWithSignature(base, nil), main, vectorTime,
+			"Empty signature"},
+		{changed.Serialize(), main, vectorTime,
+			"Details changed after signing"},
+		{rehashed.Serialize(), main, vectorTime,
+			"PKI type changed to SHA-1 after signing"},
+		{appendBytesField(base, 1000, []byte("extension")), main,
+			vectorTime, "Extension field added after signing"},
+		{extension, main, vectorTime, "Extension field signed"},
+		{explicitVersion, main, vectorTime,
+			"Default version written and signed"},
+		{explicitVersion[2:], main, vectorTime,
+			"Default version removed after signing"},
+		{junkSignature.Serialize(), main, vectorTime,
+			"Unsigned request with a signature"},
+
+		// Versions, PKI types and certificates.
+		{signRaw(version2.Serialize(), crypto.SHA256), main,
+			vectorTime, "Version 2"},
+		{signRaw(version0.Serialize(), crypto.SHA256), main,
+			vectorTime, "Version 0"},
+		{unknownType.Serialize(), main, vectorTime,
+			"Unknown PKI type"},
+		{noCerts.Serialize(), main, vectorTime,
+			"Signed request without certificates"},
+		{garbageCert.Serialize(), main, vectorTime,
+			"Certificate that doesn't parse"},
+		{badPKIData.Serialize(), main, vectorTime,
+			"PKI data that isn't a protocol buffer"},
+
+		// Messages.
+		{nil, main, vectorTime, "Empty request"},
+		{base[:len(base)-10], main, vectorTime, "Truncated request"},
+		{appendVarintField(nil, 4, 5), main, vectorTime,
+			"Details of the wrong wire type"},
+		{[]byte{0x80}, main, vectorTime, "Truncated tag"},
+		{appendVarintField(nil, 0, 1), main, vectorTime,
+			"Field number 0"},
+		{append([]byte{0x0b}, base...), main, vectorTime,
+			"Field of the start group wire type"},
+		{unsigned(output).Serialize(), main, vectorTime,
+			"Details without a time"},
+		{unsigned(appendBytesField(appendVarintField(nil, 3,
+			vectorTime), 2, noScript)).Serialize(), main,
+			vectorTime, "Output without a script"},
+		{unsigned(details(func(d *PaymentDetails) {
+			d.Memo = strings.Repeat("x", MaxRequestSize)
+		}).Serialize()).Serialize(), main, vectorTime,
+			"Request too large"},
+
+		// Details.
+		{signed(func(d *PaymentDetails) {
+			d.Expires = vectorTime - 1
+		}), main, vectorTime, "Expired a second ago"},
+		{signed(func(d *PaymentDetails) {
+			d.Expires = vectorTime
+		}), main, vectorTime, "Expiring now"},
+		{signed(func(d *PaymentDetails) {
+			d.Expires = vectorTime + 1
+		}), main, vectorTime, "Expiring in a second"},
+		{signed(func(d *PaymentDetails) {
+			d.Expires = 0
+		}), main, vectorTime, "No expiry"},
+		{signed(func(d *PaymentDetails) {
+			d.Network = "test"
+		}), main, vectorTime, "Testnet request on mainnet"},
+		{signed(func(d *PaymentDetails) {
+			d.Network = "test"
+		}), test, vectorTime, "Testnet request"},
+		{signed(func(d *PaymentDetails) {
+			d.Network = "signet"
+		}), signet, vectorTime, "Signet request"},
+		{signed(func(d *PaymentDetails) {
+			d.Network = "regtest"
+		}), regtest, vectorTime, "Regtest request"},
+		{base, test, vectorTime, "Mainnet request on testnet"},
+		{unsigned(mainWritten).Serialize(), main, vectorTime,
+			"Network written as main"},
+		{signed(func(d *PaymentDetails) {
+			d.Outputs = nil
+		}), main, vectorTime, "No outputs"},
+		{signed(func(d *PaymentDetails) {
+			d.Outputs[0].Amount = btcutil.MaxSatoshi
+		}), main, vectorTime, "Output of every bitcoin"},
+		{signed(func(d *PaymentDetails) {
+			d.Outputs[0].Amount = btcutil.MaxSatoshi + 1
+		}), main, vectorTime, "Output of a satoshi past every bitcoin"},
+		{signed(func(d *PaymentDetails) {
+			half := uint64(btcutil.MaxSatoshi/2 + 1)
+			d.Outputs = []Output{
+				{Amount: half, Script: vectorScript("a")},
+				{Amount: half, Script: vectorScript("b")},
+			}
+		}), main, vectorTime, "Outputs of more than every bitcoin"},
+		{signed(func(d *PaymentDetails) {
+			d.Outputs = []Output{
+				{Amount: 1<<64 - 1, Script: vectorScript("a")},
+				{Amount: 2, Script: vectorScript("b")},
+			}
+		}), main, vectorTime, "Outputs whose total overflows"},
+		{signed(func(d *PaymentDetails) {
+			d.Outputs[0].Amount = 0
+		}), main, vectorTime,
+			"Output of an amount left to the customer"},
+		{signed(func(d *PaymentDetails) {
+			d.Outputs = append(d.Outputs, d.Outputs[0])
+		}), main, vectorTime, "Two outputs of the same script"},
+		{signed(func(d *PaymentDetails) {
+			d.PaymentURL = ""
+		}), main, vectorTime, "No payment URL"},
+		{signed(func(d *PaymentDetails) {
+			d.Memo = ""
+			d.MerchantData = nil
+		}), main, vectorTime, "No memo or merchant data"},
+		{unsigned(appendBytesField(details(nil).Serialize(), 100,
+			[]byte("unknown"))).Serialize(), main, vectorTime,
+			"Unknown field in the details"},
+	}
+
+	vectors := make([]RequestVector, 0, len(cases)+count)
+	for _, c := range cases {
+		vectors = append(vectors, newRequestVector(c.request, c.net,
+			c.time, c.comment))
+	}
+
+	rng := rand.New(rand.NewSource(rngSeed))
+	pkiTypes := []string{PKINone, PKIX509SHA256, PKIX509SHA1}
+	for n := 0; n < count; n++ {
+		d := randomDetails(rng)
+		if rng.Intn(2) == 0 {
+			d.Expires = vectorTime - 3600 + uint64(rng.Intn(7200))
+		}
+
+		pkiType := pkiTypes[rng.Intn(len(pkiTypes))]
+		b := unsigned(d.Serialize()).Serialize()
+		if pkiType != PKINone {
+			b = sign(d.Serialize(), pkiType, chain...).Serialize()
+		}
+		comment := "Random, " + pkiType
+		if pkiType != PKINone && rng.Intn(2) == 0 {
+			i := rng.Intn(len(b) * 8)
+			b[i/8] ^= 1 << (i % 8)
+			comment += fmt.Sprintf(", bit %d flipped", i)
+		}
+		vectors = append(vectors, newRequestVector(b, main, vectorTime,
+			comment))
+	}
+	return vectors
+}
+
+// mustWithSignature returns the serialized request with the signature,
+// panicking on an error.
+func mustWithSignature(raw, signature []byte) []byte {
+	b, err := withSignature(raw, signature)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// randomDetails returns mainnet details of one to three outputs of random
+// amounts, to three scripts, and of a random memo and merchant data, or
+// none.
+func randomDetails(rng *rand.Rand) *PaymentDetails {
+	d := &PaymentDetails{
+		Network:    MainNetwork,
+		Time:       vectorTime - uint64(rng.Intn(86400)),
+		PaymentURL: paymentURL,
+	}
+	for i, n := 0, 1+rng.Intn(3); i < n; i++ {
+		d.Outputs = append(d.Outputs, Output{
+			Amount: uint64(rng.Int63n(100000000)),
+			Script: vectorScript(fmt.Sprint(rng.Intn(3))),
+		})
+	}
+	if rng.Intn(2) == 0 {
+		order := rng.Intn(10000)
+		d.Memo = fmt.Sprintf("Order %d", order)
+		d.MerchantData = []byte(fmt.Sprintf("order=%d", order))
+	}
+	return d
+}
+
+// CheckRequestVector parses the request of the vector, verifies it against
+// the root of the vectors and checks its details on its network at its
+// time, which must give the expected merchant or error.
+func CheckRequestVector(v RequestVector) error {
+	net, ok := networks[v.Network]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownNetwork, v.Network)
+	}
+	merchant, err := checkRequest(v.Request, net, v.Time)
+	if !vectorfile.SameError(err, v.Err) {
+		return fmt.Errorf("%w: error %v, expected %v",
+			ErrVectorMismatch, err, v.Err)
+	}
+	if merchant != v.Merchant {
+		return fmt.Errorf("%w: merchant %q, expected %q",
+			ErrVectorMismatch, merchant, v.Merchant)
+	}
+	return nil
+}
+
+// PaymentVector is serialized payment details and a serialized payment of
+// them, and the error the payment is rejected with, if any.
+type PaymentVector struct {
+	Details []byte
+	Payment []byte
+
+	// Err is the error an invalid payment is rejected with, or nil.
+	Err error
+
+	// Comment describes what the vector exercises.
+	Comment string
+}
+
+// checkPayment parses the details and the payment, and checks the payment
+// against the details.
+func checkPayment(details, payment []byte) error {
+	d, err := ParsePaymentDetails(details)
+	if err != nil {
+		return err
+	}
+	p, err := ParsePayment(payment)
+	if err != nil {
+		return err
+	}
+	return d.CheckPayment(p)
+}
+
+// newPaymentVector returns the vector of checking the payment against the
+// details.
+func newPaymentVector(details, payment []byte,
+	comment string) PaymentVector {
+
+	return PaymentVector{
+		Details: details,
+		Payment: payment,
+		Err:     checkPayment(details, payment),
+		Comment: comment,
+	}
+}
+
+// newTx returns a transaction of the outputs, spending an output of a
+// transaction of the vectors.
+func newTx(outputs ...Output) *wire.MsgTx {
+	tx := wire.NewMsgTx(wire.TxVersion)
+	prevOut := wire.NewOutPoint(&chainhash.Hash{1}, 0)
+	tx.AddTxIn(wire.NewTxIn(prevOut, nil, nil))
+	for _, o := range outputs {
+		tx.AddTxOut(wire.NewTxOut(int64(o.Amount), o.Script))
+	}
+	return tx
+}
+
+// PaymentVectors returns vectors of payments of exact amounts, more and
+// less, in one transaction and several, to outputs of the same script and
+// not, of amounts left to the customer, of merchant data good and bad, and
+// of malformed messages and transactions. They are followed by count
+// random payments of random details, paying them in full or not, derived
+// from a math/rand source with the seed.
+func PaymentVectors(rngSeed int64, count int) []PaymentVector {
+	a, b, c := vectorScript("a"), vectorScript("b"), vectorScript("c")
+	merchantData := []byte("order=1234")
+	details := func(outputs ...Output) *PaymentDetails {
+		return &PaymentDetails{
+			Network:      MainNetwork,
+			Outputs:      outputs,
+			Time:         vectorTime,
+			PaymentURL:   paymentURL,
+			MerchantData: merchantData,
+		}
+	}
+	one := details(Output{100000, a})
+	two := details(Output{100000, a}, Output{50000, b})
+	same := details(Output{60000, a}, Output{40000, a})
+	zero := details(Output{0, a}, Output{0, b})
+	noData := details(Output{100000, a})
+	noData.MerchantData = nil
+
+	pay := func(d *PaymentDetails, txs ...*wire.MsgTx) []byte {
+		p, err := NewPayment(d, txs, nil, "")
+		if err != nil {
+			panic(err)
+		}
+		return p.Serialize()
+	}
+	withData := func(data []byte, txs ...*wire.MsgTx) []byte {
+		p, err := NewPayment(&PaymentDetails{MerchantData: data}, txs,
+			nil, "")
+		if err != nil {
+			panic(err)
+		}
+		return p.Serialize()
+	}
+	exact := pay(one, newTx(Output{100000, a}))
+	refund, err := NewPayment(one, []*wire.MsgTx{newTx(Output{100000, a})},
+		[]Output{{Script: c}, {Amount: 5000, Script: b}}, "Refund here")
+	if err != nil {
+		panic(err)
+	}
+	large := &Payment{
+		MerchantData: merchantData,
+		Memo:         strings.Repeat("x", MaxPaymentSize),
+	}
+
+	cases := []struct {
+		details *PaymentDetails
+		payment []byte
+		comment string
+	}{
+		// Amounts.
+		{one, exact, "Exact payment"},
+		{one, pay(one, newTx(Output{100001, a})), "Overpayment"},
+		{one, pay(one, newTx(Output{99999, a})),
+			"Underpayment by a satoshi"},
+		{one, pay(one, newTx(Output{100000, b})),
+			"Payment to another script"},
+		{one, pay(one, newTx(Output{50000, a}),
+			newTx(Output{50000, a})),
+			"Payment split across two transactions"},
+		{one, pay(one, newTx(Output{60000, a}, Output{40000, a})),
+			"Payment split across two outputs"},
+		{one, pay(one, newTx(Output{100000, a}, Output{70000, c})),
+			"Payment with change"},
+		{one, pay(one), "Payment without transactions"},
+		{two, pay(two, newTx(Output{100000, a}, Output{50000, b})),
+			"Two outputs paid by a transaction"},
+		{two, pay(two, newTx(Output{50000, b}),
+			newTx(Output{100000, a})),
+			"Two outputs paid by a transaction each"},
+		{two, pay(two, newTx(Output{100000, a})),
+			"Two outputs, one of them paid"},
+		{two, pay(two, newTx(Output{150000, a})),
+			"Two outputs, the total paid to one"},
+		{same, pay(same, newTx(Output{100000, a})),
+			"Two outputs of a script paid by one output"},
+		{same, pay(same, newTx(Output{60000, a})),
+			"Two outputs of a script, the larger paid"},
+		{zero, pay(zero, newTx(Output{1, b})),
+			"Amounts left to the customer, a satoshi paid"},
+		{zero, pay(zero, newTx(Output{0, a})),
+			"Amounts left to the customer, nothing paid"},
+		{zero, pay(zero, newTx(Output{1000, c})),
+			"Amounts left to the customer, another script paid"},
+		{zero, pay(zero), "Amounts left to the customer, no " +
+			"transactions"},
+
+		// Merchant data, refunds and memos.
+		{one, withData(nil, newTx(Output{100000, a})),
+			"Payment without the merchant data"},
+		{one, withData([]byte("order=1235"), newTx(Output{100000, a})),
+			"Merchant data of another order"},
+		{noData, withData(merchantData, newTx(Output{100000, a})),
+			"Merchant data the details don't have"},
+		{noData, pay(noData, newTx(Output{100000, a})),
+			"No merchant data"},
+		{one, refund.Serialize(), "Refund outputs and a memo"},
+
+		// Messages and transactions.
+		{one, appendBytesField(exact, 2, []byte{1, 2, 3}),
+			"Transaction that doesn't deserialize"},
+		{one, appendBytesField(exact, 2, nil), "Empty transaction"},
+		{one, exact[:len(exact)-1], "Truncated payment"},
+		{one, appendVarintField(exact, 2, 1),
+			"Transaction of the wrong wire type"},
+		{one, appendBytesField(exact, 3, appendVarintField(nil, 1, 1)),
+			"Refund output without a script"},
+		{one, appendBytesField(exact, 100, []byte("unknown")),
+			"Unknown field in the payment"},
+		{one, large.Serialize(), "Payment too large"},
+	}
+
+	vectors := make([]PaymentVector, 0, len(cases)+count+1)
+	for _, c := range cases {
+		vectors = append(vectors, newPaymentVector(
+			c.details.Serialize(), c.payment, c.comment))
+	}
+	vectors = append(vectors, newPaymentVector(appendOutputField(nil, 2,
+		Output{100000, a}), exact, "Details without a time"))
+
+	rng := rand.New(rand.NewSource(rngSeed))
+	for n := 0; n < count; n++ {
+		d := randomDetails(rng)
+		var txs []*wire.MsgTx
+		comment := "Random"
+		short := rng.Intn(4) == 0
+		for i, o := range d.Outputs {
+			if short && i == 0 {
+				if o.Amount == 0 {
+					continue
+				}
+				o.Amount--
+				comment += ", short a satoshi"
+			}
+			if len(txs) == 0 || rng.Intn(2) == 0 {
+				txs = append(txs, newTx())
+			}
+			txs[len(txs)-1].AddTxOut(wire.NewTxOut(int64(o.Amount),
+				o.Script))
+		}
+		vectors = append(vectors, newPaymentVector(d.Serialize(),
+			pay(d, txs...), comment))
+	}
+	return vectors
+}
+
+// CheckPaymentVector parses the details and payment of the vector, and
+// checks the payment against the details, which must give the expected
+// error.
+func CheckPaymentVector(v PaymentVector) error {
+	err := checkPayment(v.Details, v.Payment)
+	if !vectorfile.SameError(err, v.Err) {
+		return fmt.Errorf("%w: error %v, expected %v",
+			ErrVectorMismatch, err, v.Err)
+	}
+	return nil
+}
+
+// CheckFlow runs the whole protocol for the request of a valid vector: it
+// serves the request with a Server over TLS on a local port, which the
+// merchant's URLs are dialed to, and fetches it with a Client of the
+// vector's network and time through a bitcoin: URI of the r parameter. It
+// then posts a payment short of the details, which the server must reject,
+// and one paying them in full, which it must acknowledge. Invalid vectors
+// are left to CheckRequestVector.
+func CheckFlow(v RequestVector) error {
+	if v.Err != nil {
+		return nil
+	}
+	params, ok := networks[v.Network]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownNetwork, v.Network)
+	}
+	r, err := ParsePaymentRequest(v.Request)
+	if err != nil {
+		return err
+	}
+	server, err := NewServer(r)
+	if err != nil {
+		return err
+	}
+	var received []byte
+	server.OnPayment = func(p *Payment) (string, error) {
+		received = p.Serialize()
+		return ackMemo, nil
+	}
+	ts := httptest.NewTLSServer(server)
+	defer ts.Close()
+
+	transport := ts.Client().Transport.(*http.Transport).Clone()
+	transport.TLSClientConfig.ServerName = "example.com"
+	addr := ts.Listener.Addr().String()
+	transport.DialContext = func(ctx context.Context, network,
+		_ string) (net.Conn, error) {
+
+		var d net.Dialer
+		return d.DialContext(ctx, network, addr)
+	}
+	client := &Client{
+		Net:        params,
+		HTTPClient: &http.Client{Transport: transport},
+		Roots:      vectorRoots(),
+		Now:        func() time.Time { return time.Unix(v.Time, 0) },
+	}
+
+	ctx := context.Background()
+	invoice, err := client.FetchURI(ctx, "bitcoin:?r="+requestURL)
+	if err != nil {
+		return fmt.Errorf("%w: fetching request: %v", ErrVectorMismatch,
+			err)
+	}
+	if invoice.Merchant != v.Merchant {
+		return fmt.Errorf("%w: fetched merchant %q, expected %q",
+			ErrVectorMismatch, invoice.Merchant, v.Merchant)
+	}
+	if !bytes.Equal(invoice.Request.Serialize(), v.Request) {
+		return fmt.Errorf("%w: fetched request %x", ErrVectorMismatch,
+			invoice.Request.Serialize())
+	}
+	if invoice.Details.PaymentURL == "" {
+		_, err := client.Pay(ctx, invoice, &Payment{})
+		if !errors.Is(err, ErrNoPaymentURL) {
+			return fmt.Errorf("%w: paying without a payment URL: "+
+				"%v", ErrVectorMismatch, err)
+		}
+		return nil
+	}
+
+	short, err := NewPayment(invoice.Details, nil, nil, "")
+	if err != nil {
+		return err
+	}
+	if _, err := client.Pay(ctx, invoice, short); !errors.Is(err,
+		ErrHTTPStatus) {
+
+		return fmt.Errorf("%w: short payment: error %v, expected %v",
+			ErrVectorMismatch, err, ErrHTTPStatus)
+	}
+
+	tx := newTx()
+	for _, o := range invoice.Details.Outputs {
+		if o.Amount == 0 {
+			o.Amount = 1000
+		}
+		tx.AddTxOut(wire.NewTxOut(int64(o.Amount), o.Script))
+	}
+	payment, err := NewPayment(invoice.Details, []*wire.MsgTx{tx},
+		[]Output{{Script: vectorScript("refund")}}, "Paid")
+	if err != nil {
+		return err
+	}
+	ack, err := client.Pay(ctx, invoice, payment)
+	if err != nil {
+		return fmt.Errorf("%w: paying: %v", ErrVectorMismatch, err)
+	}
+	if !bytes.Equal(ack.Payment.Serialize(), payment.Serialize()) ||
+		!bytes.Equal(received, payment.Serialize()) ||
+		ack.Memo != ackMemo {
+
+		return fmt.Errorf("%w: acknowledgement %+v", ErrVectorMismatch,
+			*ack)
+	}
+	return nil
+}
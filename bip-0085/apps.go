@@ -0,0 +1,130 @@
+package bip85
+
+import (
+	"github.com/christsim/bips/base58"
+	bip32 "github.com/christsim/bips/bip-0032"
+	bip39 "github.com/christsim/bips/bip-0039"
+)
+
+// Language is the code of a BIP 39 wordlist in BIP 85 paths.
+type Language uint32
+
+const (
+	English            Language = 0
+	Japanese           Language = 1
+	Korean             Language = 2
+	Spanish            Language = 3
+	ChineseSimplified  Language = 4
+	ChineseTraditional Language = 5
+	French             Language = 6
+	Italian            Language = 7
+	Czech              Language = 8
+)
+
+// wordlists maps language codes to the wordlists of the bip39 package. Czech
+// has a code but no wordlist in this repository.
+var wordlists = map[Language]*bip39.Wordlist{
+	English:            bip39.English,
+	Japanese:           bip39.Japanese,
+	Korean:             bip39.Korean,
+	Spanish:            bip39.Spanish,
+	ChineseSimplified:  bip39.ChineseSimplified,
+	ChineseTraditional: bip39.ChineseTraditional,
+	French:             bip39.French,
+	Italian:            bip39.Italian,
+}
+
+// Wordlist returns the wordlist of the language, or nil if the bip39 package
+// doesn't have it.
+func (l Language) Wordlist() *bip39.Wordlist {
+	return wordlists[l]
+}
+
+// MnemonicPath returns the path of the BIP 39 application.
+func MnemonicPath(lang Language, words int, index uint32) bip32.Path {
+	return Path(AppBIP39, uint32(lang), uint32(words), index)
+}
+
+// Mnemonic derives a mnemonic of 12, 18 or 24 words in the language, from
+// the first 16, 24 or 32 bytes of the entropy at
+// m/83696968'/39'/language'/words'/index'.
+func Mnemonic(master *bip32.ExtendedKey, lang Language, words int,
+	index uint32) (string, error) {
+
+	if words != 12 && words != 18 && words != 24 {
+		return "", ErrInvalidWordCount
+	}
+	wl := lang.Wordlist()
+	if wl == nil {
+		return "", ErrUnsupportedLanguage
+	}
+	entropy, err := DeriveEntropy(master, MnemonicPath(lang, words, index))
+	if err != nil {
+		return "", err
+	}
+	return bip39.NewMnemonic(entropy[:words*4/3], wl)
+}
+
+// HDSeedPath returns the path of the HD-Seed WIF application.
+func HDSeedPath(index uint32) bip32.Path {
+	return Path(AppHDSeed, index)
+}
+
+// HDSeedWIF derives a private key, from the first 32 bytes of the entropy at
+// m/83696968'/2'/index', for wallets such as Bitcoin Core's that take an HD
+// seed as a WIF key. The key is encoded compressed for mainnet.
+func HDSeedWIF(master *bip32.ExtendedKey, index uint32) (string, error) {
+	entropy, err := DeriveEntropy(master, HDSeedPath(index))
+	if err != nil {
+		return "", err
+	}
+	return base58.EncodeWIF(entropy[:32], base58.MainnetWIF, true)
+}
+
+// XPRVPath returns the path of the XPRV application.
+func XPRVPath(index uint32) bip32.Path {
+	return Path(AppXPRV, index)
+}
+
+// XPRV derives a master key from the entropy at m/83696968'/32'/index',
+// whose first 32 bytes are the chain code and the last 32 the private key.
+// The order is the reverse of that of a key derived from a seed. The key has
+// the versions of the passed master key's network.
+func XPRV(master *bip32.ExtendedKey, index uint32) (*bip32.ExtendedKey,
+	error) {
+
+	entropy, err := DeriveEntropy(master, XPRVPath(index))
+	if err != nil {
+		return nil, err
+	}
+
+	// Version, depth, parent fingerprint and child number, followed by
+	// the chain code and the padded private key.
+	net := master.Network()
+	data := append([]byte(nil), net.Private[:]...)
+	data = append(data, make([]byte, 9)...)
+	data = append(data, entropy[:32]...)
+	data = append(data, 0)
+	data = append(data, entropy[32:]...)
+	return bip32.Deserialize(data)
+}
+
+// HexPath returns the path of the hex application.
+func HexPath(numBytes int, index uint32) bip32.Path {
+	return Path(AppHex, uint32(numBytes), index)
+}
+
+// Hex derives numBytes of entropy, between 16 and 64, from the entropy at
+// m/83696968'/128169'/numBytes'/index'.
+func Hex(master *bip32.ExtendedKey, numBytes int, index uint32) ([]byte,
+	error) {
+
+	if numBytes < 16 || numBytes > EntropyLen {
+		return nil, ErrInvalidHexLen
+	}
+	entropy, err := DeriveEntropy(master, HexPath(numBytes, index))
+	if err != nil {
+		return nil, err
+	}
+	return entropy[:numBytes], nil
+}
@@ -0,0 +1,96 @@
+// Package bip85 implements the deterministic entropy of BIP 85, which derives
+// independent secrets for other wallets from a single BIP 32 master key, so
+// that backing up the master key backs them all up:
+//
+//	mnemonic, err := bip85.Mnemonic(master, bip85.English, 24, 0)
+//
+// Each secret is derived from the private key at a hardened path below
+// m/83696968', whose next level selects the application: BIP 39 mnemonics,
+// WIF private keys for HD seeds, XPRV master keys, or raw hex entropy. The key
+// is stretched with HMAC-SHA512 into 64 bytes of entropy, of which each
+// application takes what it needs. Knowing a derived secret reveals nothing
+// about the master key or the other secrets.
+package bip85
+
+import (
+	"crypto/hmac"
+	"crypto/sha512"
+	"errors"
+
+	bip32 "github.com/christsim/bips/bip-0032"
+)
+
+// Purpose is the first level of every BIP 85 path, hardened.
+const Purpose = 83696968
+
+// Application numbers, the second level of a path.
+const (
+	AppBIP39  = 39
+	AppHDSeed = 2
+	AppXPRV   = 32
+	AppHex    = 128169
+)
+
+// EntropyLen is the length of the entropy DeriveEntropy returns.
+const EntropyLen = 64
+
+// entropyKey is the HMAC-SHA512 key derived private keys are stretched with.
+var entropyKey = []byte("bip-entropy-from-k")
+
+var (
+	// ErrPublicKey is returned when deriving entropy from a public key.
+	ErrPublicKey = errors.New("bip85: master key must be private")
+
+	// ErrNotHardened is returned when deriving entropy along a path with a
+	// level that isn't hardened.
+	ErrNotHardened = errors.New("bip85: every level of the path must be " +
+		"hardened")
+
+	// ErrInvalidWordCount is returned for a mnemonic length other than
+	// 12, 18 or 24 words.
+	ErrInvalidWordCount = errors.New("bip85: mnemonic must have 12, 18 " +
+		"or 24 words")
+
+	// ErrUnsupportedLanguage is returned for a BIP 39 language code whose
+	// wordlist the bip39 package doesn't have.
+	ErrUnsupportedLanguage = errors.New("bip85: unsupported language")
+
+	// ErrInvalidHexLen is returned for a hex entropy length outside 16 to
+	// 64 bytes.
+	ErrInvalidHexLen = errors.New("bip85: hex entropy must be 16 to 64 " +
+		"bytes")
+)
+
+// Path returns the path below the master key of the passed levels after the
+// purpose, all hardened.
+func Path(levels ...uint32) bip32.Path {
+	path := bip32.Path{Purpose + bip32.HardenedKeyStart}
+	for _, level := range levels {
+		path = append(path, level+bip32.HardenedKeyStart)
+	}
+	return path
+}
+
+// DeriveEntropy derives the private key at the path from the master key and
+// returns its 64 bytes of entropy. Every level of the path must be hardened,
+// so that child entropy can't be derived from public keys.
+func DeriveEntropy(master *bip32.ExtendedKey, path bip32.Path) ([]byte,
+	error) {
+
+	if !master.IsPrivate() {
+		return nil, ErrPublicKey
+	}
+	for _, index := range path {
+		if index < bip32.HardenedKeyStart {
+			return nil, ErrNotHardened
+		}
+	}
+
+	key, err := master.Derive(path)
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha512.New, entropyKey)
+	mac.Write(key.PrivateKey())
+	return mac.Sum(nil), nil
+}
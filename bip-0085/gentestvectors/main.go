@@ -0,0 +1,174 @@
+// This program writes test vectors for the bip85 package to bip85.json: the
+// test vectors of BIP 85, followed by vectors for every wordlist and mnemonic
+// length and the first indexes of the other applications, all derived from
+// the master key of the BIP. Each vector lists the master key, the path, the
+// 64 bytes of entropy at the path and the output of its application:
+//
+//	gentestvectors -out bip85.json
+//
+// The file uses the layout of the BIP 158 vectors: a JSON array whose first
+// row names the columns, followed by one row per vector. Pass -check to
+// verify an existing file against the package instead, which is how the
+// output of wallet backup tools can be compared:
+//
+//	gentestvectors -check bip85.json
+//
+// The program lives in a directory of its own since the bip85 package sits at
+// the root of the module.
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	bip32 "github.com/christsim/bips/bip-0032"
+	bip85 "github.com/christsim/bips/bip-0085"
+)
+
+// vectorColumns is the header row of the vector file.
+const vectorColumns = "Master,Path,Entropy,Output,Comment"
+
+type JSONTestWriter struct {
+	writer          io.Writer
+	firstRowWritten bool
+}
+
+func NewJSONTestWriter(writer io.Writer) *JSONTestWriter {
+	return &JSONTestWriter{writer: writer}
+}
+
+func (w *JSONTestWriter) WriteComment(comment string) error {
+	return w.WriteTestCase([]interface{}{comment})
+}
+
+func (w *JSONTestWriter) WriteTestCase(row []interface{}) error {
+	var err error
+	if w.firstRowWritten {
+		_, err = io.WriteString(w.writer, ",\n")
+	} else {
+		_, err = io.WriteString(w.writer, "[\n")
+		w.firstRowWritten = true
+	}
+	if err != nil {
+		return err
+	}
+
+	rowBytes, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.writer.Write(rowBytes)
+	return err
+}
+
+func (w *JSONTestWriter) Close() error {
+	if !w.firstRowWritten {
+		return nil
+	}
+
+	_, err := io.WriteString(w.writer, "\n]\n")
+	return err
+}
+
+func main() {
+	out := flag.String("out", "bip85.json", "file to write the vectors to")
+	check := flag.String("check", "", "vector file to check instead of "+
+		"writing one")
+	flag.Parse()
+
+	var err error
+	if *check != "" {
+		err = checkFile(*check)
+	} else {
+		err = writeFile(*out)
+	}
+	if err != nil {
+		fmt.Println("Error: ", err.Error())
+		os.Exit(1)
+	}
+}
+
+// writeFile writes the vectors of the package to out.
+func writeFile(out string) error {
+	vectors := bip85.Vectors()
+
+	file, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := NewJSONTestWriter(file)
+	if err := writer.WriteComment(vectorColumns); err != nil {
+		return err
+	}
+	for _, v := range vectors {
+		err := writer.WriteTestCase([]interface{}{
+			v.Master,
+			v.Path.String(),
+			hex.EncodeToString(v.Entropy),
+			v.Output,
+			v.Comment,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote %d vectors\n", len(vectors))
+	return nil
+}
+
+// checkFile checks each vector of the file with bip85.CheckVector.
+func checkFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var rows [][]string
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return err
+	}
+
+	count := 0
+	for i, row := range rows {
+		// Skip the header row and any other comments.
+		if len(row) == 1 {
+			continue
+		}
+		if len(row) != 5 {
+			return fmt.Errorf("row %d: expected 5 columns, got %d", i,
+				len(row))
+		}
+
+		keyPath, err := bip32.ParsePath(row[1])
+		if err != nil {
+			return fmt.Errorf("%v: %v", row[4], err)
+		}
+		entropy, err := hex.DecodeString(row[2])
+		if err != nil {
+			return fmt.Errorf("%v: %v", row[4], err)
+		}
+		err = bip85.CheckVector(bip85.Vector{
+			Master:  row[0],
+			Path:    keyPath,
+			Entropy: entropy,
+			Output:  row[3],
+		})
+		if err != nil {
+			return fmt.Errorf("%v: %v", row[4], err)
+		}
+		count++
+	}
+
+	fmt.Printf("%d vectors OK\n", count)
+	return nil
+}
@@ -0,0 +1,22 @@
+module github.com/christsim/bips/bip-0085
+
+go 1.21
+
+require (
+	github.com/christsim/bips/base58 v0.0.0
+	github.com/christsim/bips/bip-0032 v0.0.0
+	github.com/christsim/bips/bip-0039 v0.0.0
+)
+
+require (
+	github.com/btcsuite/btcd/btcec/v2 v2.3.4 // indirect
+	github.com/decred/dcrd/dcrec/secp256k1/v4 v4.0.1 // indirect
+	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9 // indirect
+	golang.org/x/text v0.3.3 // indirect
+)
+
+replace (
+	github.com/christsim/bips/base58 => ../base58
+	github.com/christsim/bips/bip-0032 => ../bip-0032
+	github.com/christsim/bips/bip-0039 => ../bip-0039
+)
@@ -0,0 +1,258 @@
+package bip85
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	bip32 "github.com/christsim/bips/bip-0032"
+)
+
+// ErrVectorMismatch is returned by CheckVector when deriving a vector's
+// entropy or output doesn't give the expected result.
+var ErrVectorMismatch = errors.New("bip85: vector mismatch")
+
+// SpecMaster is the master key of the test vectors of the BIP.
+const SpecMaster = "xprv9s21ZrQH143K2LBWUUQRFXhucrQqBpKdRRxNVq2zBqsx8HVqFk2uYo" +
+	"8kmbaLLHRdqtQpUm98uKfu3vca1LqdGhUtyoFnCNkfmXRyPXLjbKb"
+
+// Vector is the entropy derived along a path from a master key, and the
+// output of the application the path belongs to.
+type Vector struct {
+	Master  string
+	Path    bip32.Path
+	Entropy []byte
+
+	// Output is the mnemonic, WIF key, xprv or hex string the application
+	// derives, or empty for a path that belongs to no application.
+	Output string
+
+	// Comment describes what the vector exercises.
+	Comment string
+}
+
+// specVector is one of the test vectors of the BIP.
+type specVector struct {
+	path    bip32.Path
+	entropy string
+	output  string
+	comment string
+}
+
+var specVectors = []specVector{
+	{
+		path: Path(0, 0),
+		entropy: "efecfbccffea313214232d29e71563d941229afb4338c21f9517c41a" +
+			"aa0d16f00b83d2a09ef747e7a64e8e2bd5a14869e693da66ce94ac2da5" +
+			"70ab7ee48618f7",
+		comment: "Test case 1",
+	},
+	{
+		path: Path(0, 1),
+		entropy: "70c6e3e8ebee8dc4c0dbba66076819bb8c09672527c4277ca8729532" +
+			"ad711872218f826919f6b67218adde99018a6df9095ab2b58d803b5b93" +
+			"ec9802085a690e",
+		comment: "Test case 2",
+	},
+	{
+		path: MnemonicPath(English, 12, 0),
+		entropy: "6250b68daf746d12a24d58b4787a714bf1b58d69e4c2a466276fb16f" +
+			"e93dc52b6fac6b756894072241447cad56f6405ee326dbb473d2f5e943" +
+			"543590082927c0",
+		output: "girl mad pet galaxy egg matter matrix prison refuse " +
+			"sense ordinary nose",
+		comment: "BIP39, 12 English words",
+	},
+	{
+		path: MnemonicPath(English, 18, 0),
+		entropy: "938033ed8b12698449d4bbca3c853c66b293ea1b1ce9d9dc76a62012" +
+			"cbca636ac192271d292df994fa21ac0184560f79d007803282f70e41e6" +
+			"5526a0a8663d5d",
+		output: "near account window bike charge season chef number " +
+			"sketch tomorrow excuse sniff circle vital hockey outdoor " +
+			"supply token",
+		comment: "BIP39, 18 English words",
+	},
+	{
+		path: MnemonicPath(English, 24, 0),
+		entropy: "ae131e2312cdc61331542efe0d1077bac5ea803adf24b313a4f0e48e" +
+			"9c51f37f6f6bba7cc92a2d1f5954b4ba442510e1e2179ec5f2ca003169" +
+			"803cfcbcc8e9e8",
+		output: "puppy ocean match cereal symbol another shed magic wrap " +
+			"hammer bulb intact gadget divorce twin tonight reason " +
+			"outdoor destroy simple truth cigar social volcano",
+		comment: "BIP39, 24 English words",
+	},
+	{
+		path: HDSeedPath(0),
+		entropy: "7040bb53104f27367f317558e78a994ada7296c6fde36a364e5baf20" +
+			"6e502bb1f988080b7dd814e7ae7d6d83edbb6689886a560e165f4a7408" +
+			"77cdf3beecacf8",
+		output:  "Kzyv4uF39d4Jrw2W7UryTHwZr1zQVNk4dAFyqE6BuMrMh1Za7uhp",
+		comment: "HD-Seed WIF",
+	},
+	{
+		path: XPRVPath(0),
+		entropy: "52405cd0dd21c5be78314a7c1a3c65ffd8d896536cc7dee3157db582" +
+			"4f0c92e2ead0b33988a616cf6a497f1c169d9e92562604e38305ccd3fc" +
+			"96f2252c177682",
+		output: "xprv9s21ZrQH143K2srSbCSg4m4kLvPMzcWydgmKEnMmoZUurYuBuYG4" +
+			"6c6P71UGXMzmriLzCCBvKQWBUv3vPB3m1SATMhp3uEjXHJ42jFg7myX",
+		comment: "XPRV",
+	},
+	{
+		path: HexPath(64, 0),
+		entropy: "492db4698cf3b73a5a24998aa3e9d7fa96275d85724a91e71aa2d645" +
+			"442f878555d078fd1f1f67e368976f04137b1f7a0d19232136ca50c446" +
+			"14af72b5582a5c",
+		output: "492db4698cf3b73a5a24998aa3e9d7fa96275d85724a91e71aa2d645" +
+			"442f878555d078fd1f1f67e368976f04137b1f7a0d19232136ca50c446" +
+			"14af72b5582a5c",
+		comment: "HEX, 64 bytes",
+	},
+}
+
+// SpecVectors returns the test vectors of the BIP, all derived from
+// SpecMaster.
+func SpecVectors() []Vector {
+	vectors := make([]Vector, 0, len(specVectors))
+	for _, sv := range specVectors {
+		entropy, err := hex.DecodeString(sv.entropy)
+		if err != nil {
+			panic(err)
+		}
+		vectors = append(vectors, Vector{
+			Master:  SpecMaster,
+			Path:    sv.path,
+			Entropy: entropy,
+			Output:  sv.output,
+			Comment: sv.comment,
+		})
+	}
+	return vectors
+}
+
+// Vectors returns the test vectors of the BIP, followed by vectors derived
+// from SpecMaster for every language with a wordlist and every mnemonic
+// length, for the first indexes of the other applications, and for every
+// hex length at a multiple of 8 bytes.
+func Vectors() []Vector {
+	vectors := SpecVectors()
+	master, err := bip32.ParseKey(SpecMaster)
+	if err != nil {
+		panic(err)
+	}
+
+	add := func(path bip32.Path, comment string) {
+		v, err := NewVector(master, path)
+		if err != nil {
+			panic(err)
+		}
+		v.Comment = comment
+		vectors = append(vectors, *v)
+	}
+	for lang := English; lang <= Czech; lang++ {
+		wl := lang.Wordlist()
+		if wl == nil {
+			continue
+		}
+		for _, words := range []int{12, 18, 24} {
+			add(MnemonicPath(lang, words, 1),
+				fmt.Sprintf("BIP39, %d %v words", words, wl.Name))
+		}
+	}
+	for index := uint32(1); index < 4; index++ {
+		add(HDSeedPath(index), fmt.Sprintf("HD-Seed WIF, index %d",
+			index))
+		add(XPRVPath(index), fmt.Sprintf("XPRV, index %d", index))
+	}
+	for numBytes := 16; numBytes <= EntropyLen; numBytes += 8 {
+		add(HexPath(numBytes, 1), fmt.Sprintf("HEX, %d bytes",
+			numBytes))
+	}
+	return vectors
+}
+
+// NewVector derives the entropy at the path from the master key, and the
+// output of the application the path belongs to, and returns them as a
+// vector without a comment.
+func NewVector(master *bip32.ExtendedKey, path bip32.Path) (*Vector, error) {
+	entropy, err := DeriveEntropy(master, path)
+	if err != nil {
+		return nil, err
+	}
+	output, err := applicationOutput(master, path)
+	if err != nil {
+		return nil, err
+	}
+	return &Vector{
+		Master:  master.String(),
+		Path:    path,
+		Entropy: entropy,
+		Output:  output,
+	}, nil
+}
+
+// applicationOutput derives the output of the application the path belongs
+// to, going through the application's own function rather than the path, or
+// returns an empty string if the path belongs to none.
+func applicationOutput(master *bip32.ExtendedKey,
+	path bip32.Path) (string, error) {
+
+	levels := make([]uint32, 0, len(path))
+	for _, index := range path {
+		levels = append(levels, index-bip32.HardenedKeyStart)
+	}
+	if len(levels) < 2 || levels[0] != Purpose {
+		return "", nil
+	}
+
+	switch app, args := levels[1], levels[2:]; {
+	case app == AppBIP39 && len(args) == 3:
+		return Mnemonic(master, Language(args[0]), int(args[1]),
+			args[2])
+
+	case app == AppHDSeed && len(args) == 1:
+		return HDSeedWIF(master, args[0])
+
+	case app == AppXPRV && len(args) == 1:
+		key, err := XPRV(master, args[0])
+		if err != nil {
+			return "", err
+		}
+		return key.String(), nil
+
+	case app == AppHex && len(args) == 2:
+		entropy, err := Hex(master, int(args[0]), args[1])
+		if err != nil {
+			return "", err
+		}
+		return hex.EncodeToString(entropy), nil
+
+	default:
+		return "", nil
+	}
+}
+
+// CheckVector derives the vector's entropy and output from its master key
+// and checks them against the expected values.
+func CheckVector(v Vector) error {
+	master, err := bip32.ParseKey(v.Master)
+	if err != nil {
+		return err
+	}
+	got, err := NewVector(master, v.Path)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(got.Entropy, v.Entropy) {
+		return fmt.Errorf("%w: entropy %x, expected %x",
+			ErrVectorMismatch, got.Entropy, v.Entropy)
+	}
+	if got.Output != v.Output {
+		return fmt.Errorf("%w: output %q, expected %q",
+			ErrVectorMismatch, got.Output, v.Output)
+	}
+	return nil
+}
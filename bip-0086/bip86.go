@@ -0,0 +1,178 @@
+// Package bip86 derives the single key taproot outputs of BIP 86 end to end:
+// from the account key a wallet exports, down the BIP 32 path of each
+// address, to the internal key, the output key it's tweaked into with no
+// script tree, the output script and the bech32m address paying to it.
+//
+//	account, err := bip86.NewAccount(xpub, derivation.Mainnet)
+//	out, err := account.Output(derivation.External, 0)
+//	fmt.Println(out.Address)
+//
+// An account of a private key also gives the tweaked secret key of each
+// output, which signs its key path spends with the Schnorr signatures of
+// BIP 340.
+//
+// The package puts together the bip32 and derivation packages, the taproot
+// tweak of BIP 341, the signatures of BIP 340 and the bech32m addresses of
+// BIP 350 rather than reimplementing any of them, and its vectors check that
+// they agree with each other and with the BIP.
+package bip86
+
+import (
+	"errors"
+	"fmt"
+
+	bip32 "github.com/christsim/bips/bip-0032"
+	"github.com/christsim/bips/bip-0032/derivation"
+	schnorr "github.com/christsim/bips/bip-0340"
+	taproot "github.com/christsim/bips/bip-0341"
+)
+
+var (
+	// ErrWatchOnly is returned when asking an account of a public key
+	// for a secret key or a signature.
+	ErrWatchOnly = errors.New("bip86: account has no private key")
+
+	// ErrNotAccountKey is returned for a key that isn't at the depth of
+	// account keys, m/86'/coin_type'/account', or whose child number isn't
+	// hardened.
+	ErrNotAccountKey = errors.New("bip86: not an account key")
+)
+
+// accountDepth is the depth of account keys below the master key.
+const accountDepth = 3
+
+// Output is the taproot output at a path of an account.
+type Output struct {
+	Path derivation.Path
+
+	// InternalKey is the x-only public key at the path.
+	InternalKey []byte
+
+	// OutputKey is the x-only key the internal key is tweaked into, and
+	// Parity the parity of its y coordinate.
+	OutputKey []byte
+	Parity    byte
+
+	// Script is the output script, OP_1 <OutputKey>, and Address the
+	// bech32m address paying to it.
+	Script  []byte
+	Address string
+}
+
+// Account is a BIP 86 account, private or watch-only.
+type Account struct {
+	account *derivation.Account
+}
+
+// DeriveAccount derives the account of the passed number from a master key,
+// which must be private.
+func DeriveAccount(master *bip32.ExtendedKey, net derivation.Network,
+	number uint32) (*Account, error) {
+
+	account, err := derivation.DeriveAccount(master, derivation.BIP86, net,
+		number)
+	if err != nil {
+		return nil, err
+	}
+	return &Account{account: account}, nil
+}
+
+// NewAccount returns the account of a serialized account key, an xpub for a
+// watch-only account or an xprv for one that signs.
+func NewAccount(accountKey string, net derivation.Network) (*Account, error) {
+	key, err := bip32.ParseKey(accountKey)
+	if err != nil {
+		return nil, err
+	}
+	if key.Depth() != accountDepth ||
+		key.ChildNumber() < bip32.HardenedKeyStart {
+
+		return nil, fmt.Errorf("%w: depth %d, child number %d",
+			ErrNotAccountKey, key.Depth(), key.ChildNumber())
+	}
+	account, err := derivation.NewAccount(key, derivation.BIP86, net)
+	if err != nil {
+		return nil, err
+	}
+	return &Account{account: account}, nil
+}
+
+// Key returns the account key.
+func (a *Account) Key() *bip32.ExtendedKey {
+	return a.account.Key()
+}
+
+// IsPrivate reports whether the account can sign.
+func (a *Account) IsPrivate() bool {
+	return a.account.Key().IsPrivate()
+}
+
+// Output derives the output at the passed change level and index.
+func (a *Account) Output(change derivation.Change,
+	index uint32) (*Output, error) {
+
+	key, err := a.account.AddressKey(change, index)
+	if err != nil {
+		return nil, err
+	}
+	internalKey := key.PublicKey()[1:]
+	outputKey, parity, err := taproot.TweakPubKey(internalKey, nil)
+	if err != nil {
+		return nil, err
+	}
+	address, err := taproot.Address(outputKey, a.account.Net.HRP)
+	if err != nil {
+		return nil, err
+	}
+	return &Output{
+		Path:        a.account.Path(change, index),
+		InternalKey: internalKey,
+		OutputKey:   outputKey,
+		Parity:      parity,
+		Script:      taproot.OutputScript(outputKey),
+		Address:     address,
+	}, nil
+}
+
+// Outputs derives count outputs at the passed change level, from index
+// start on, as a wallet scanning for its outputs does.
+func (a *Account) Outputs(change derivation.Change, start,
+	count uint32) ([]*Output, error) {
+
+	outs := make([]*Output, 0, count)
+	for index := start; index-start < count; index++ {
+		out, err := a.Output(change, index)
+		if err != nil {
+			return nil, err
+		}
+		outs = append(outs, out)
+	}
+	return outs, nil
+}
+
+// SecKey returns the secret key of the output key at the passed change level
+// and index, the key at the path tweaked as BIP 341 describes.
+func (a *Account) SecKey(change derivation.Change,
+	index uint32) ([]byte, error) {
+
+	if !a.IsPrivate() {
+		return nil, ErrWatchOnly
+	}
+	key, err := a.account.AddressKey(change, index)
+	if err != nil {
+		return nil, err
+	}
+	return taproot.TweakSecKey(key.PrivateKey(), nil)
+}
+
+// Sign signs the signature hash of a key path spend of the output at the
+// passed change level and index, with the auxiliary randomness of BIP 340.
+func (a *Account) Sign(change derivation.Change, index uint32, sigHash,
+	auxRand []byte) ([]byte, error) {
+
+	secKey, err := a.SecKey(change, index)
+	if err != nil {
+		return nil, err
+	}
+	return schnorr.Sign(secKey, sigHash, auxRand)
+}
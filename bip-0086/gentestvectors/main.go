@@ -0,0 +1,198 @@
+// This program writes test vectors for the bip86 package to bip86.json: the
+// test vectors of BIP 86, the same outputs derived from the account xprv of
+// the BIP and signed for, and the outputs of random accounts on both
+// networks, watch-only or not. The random vectors depend only on -seed and
+// -count, so they can be regenerated by anyone:
+//
+//	gentestvectors -count 100 -seed 86
+//
+// The file uses the layout of the BIP 158 vectors: a JSON array whose first
+// row names the columns, followed by one row per vector. Each vector is the
+// network and account key an output is derived from, its path, its internal
+// and output keys, script and address, and for a private account key a
+// signature hash and its signature by the output key. Pass -check to verify
+// an existing file against the package, and through it against the bip32,
+// taproot, schnorr and bech32 packages, instead:
+//
+//	gentestvectors -check bip86.json
+//
+// The program lives in a directory of its own since the bip86 package sits at
+// the root of the module.
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/christsim/bips/bip-0032/derivation"
+	bip86 "github.com/christsim/bips/bip-0086"
+	"github.com/christsim/bips/internal/vectorfile"
+)
+
+// vectorColumns is the header row of the vector file.
+const vectorColumns = "Network,Account Key,Path,Internal Key,Output Key," +
+	"Script,Address,Sig Hash,Signature,Comment"
+
+type JSONTestWriter struct {
+	writer          io.Writer
+	firstRowWritten bool
+}
+
+func NewJSONTestWriter(writer io.Writer) *JSONTestWriter {
+	return &JSONTestWriter{writer: writer}
+}
+
+func (w *JSONTestWriter) WriteComment(comment string) error {
+	return w.WriteTestCase([]interface{}{comment})
+}
+
+func (w *JSONTestWriter) WriteTestCase(row []interface{}) error {
+	var err error
+	if w.firstRowWritten {
+		_, err = io.WriteString(w.writer, ",\n")
+	} else {
+		_, err = io.WriteString(w.writer, "[\n")
+		w.firstRowWritten = true
+	}
+	if err != nil {
+		return err
+	}
+
+	rowBytes, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.writer.Write(rowBytes)
+	return err
+}
+
+func (w *JSONTestWriter) Close() error {
+	if !w.firstRowWritten {
+		return nil
+	}
+
+	_, err := io.WriteString(w.writer, "\n]\n")
+	return err
+}
+
+func main() {
+	out := flag.String("out", "bip86.json", "file to write the vectors to")
+	count := flag.Int("count", 100, "number of random outputs to write "+
+		"vectors of")
+	seed := flag.Int64("seed", 86, "seed of the random vectors")
+	check := flag.String("check", "", "vector file to check instead of "+
+		"writing one")
+	flag.Parse()
+
+	var err error
+	if *check != "" {
+		err = checkFile(*check)
+	} else {
+		err = writeFile(*out, *seed, *count)
+	}
+	if err != nil {
+		fmt.Println("Error: ", err.Error())
+		os.Exit(1)
+	}
+}
+
+// networks maps the names of the networks of the derivation package to them.
+var networks = map[string]derivation.Network{
+	derivation.Mainnet.Name: derivation.Mainnet,
+	derivation.Testnet.Name: derivation.Testnet,
+}
+
+// writeFile writes the vectors, with count random ones, to out.
+func writeFile(out string, seed int64, count int) error {
+	file, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := NewJSONTestWriter(file)
+	if err := writer.WriteComment(vectorColumns); err != nil {
+		return err
+	}
+	vectors := bip86.Vectors(seed, count)
+	for _, v := range vectors {
+		err := writer.WriteTestCase([]interface{}{
+			v.Net.Name,
+			v.AccountKey,
+			v.Path.String(),
+			hex.EncodeToString(v.InternalKey),
+			hex.EncodeToString(v.OutputKey),
+			hex.EncodeToString(v.Script),
+			v.Address,
+			hex.EncodeToString(v.SigHash),
+			hex.EncodeToString(v.Signature),
+			v.Comment,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote %d vectors\n", len(vectors))
+	return nil
+}
+
+// decodeHex decodes the hex columns of a row into the values.
+func decodeHex(columns []string, values ...*[]byte) error {
+	for i, value := range values {
+		b, err := hex.DecodeString(columns[i])
+		if err != nil {
+			return fmt.Errorf("column %q: %v", columns[i], err)
+		}
+		*value = b
+	}
+	return nil
+}
+
+// checkFile checks each vector of the file with bip86.CheckVector.
+func checkFile(path string) error {
+	rows, err := vectorfile.ReadStringRows(path, 10)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		v := bip86.Vector{
+			AccountKey: row[1],
+			Address:    row[6],
+			Comment:    row[9],
+		}
+		net, ok := networks[row[0]]
+		if !ok {
+			return fmt.Errorf("%v: unknown network %q", v.Comment,
+				row[0])
+		}
+		v.Net = net
+		v.Path, err = derivation.ParsePath(row[2])
+		if err != nil {
+			return fmt.Errorf("%v: %v", v.Comment, err)
+		}
+		err := decodeHex(row[3:6], &v.InternalKey, &v.OutputKey,
+			&v.Script)
+		if err != nil {
+			return fmt.Errorf("%v: %v", v.Comment, err)
+		}
+		err = decodeHex(row[7:9], &v.SigHash, &v.Signature)
+		if err != nil {
+			return fmt.Errorf("%v: %v", v.Comment, err)
+		}
+		if err := bip86.CheckVector(v); err != nil {
+			return fmt.Errorf("%v: %v", v.Comment, err)
+		}
+	}
+
+	fmt.Printf("%d vectors OK\n", len(rows))
+	return nil
+}
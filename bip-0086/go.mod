@@ -0,0 +1,29 @@
+module github.com/christsim/bips/bip-0086
+
+go 1.21
+
+require (
+	github.com/christsim/bips/bip-0032 v0.0.0
+	github.com/christsim/bips/bip-0173 v0.0.0
+	github.com/christsim/bips/bip-0340 v0.0.0
+	github.com/christsim/bips/bip-0341 v0.0.0
+	github.com/christsim/bips/internal v0.0.0
+)
+
+require (
+	github.com/btcsuite/btcd/btcec/v2 v2.3.4 // indirect
+	github.com/btcsuite/btcd/chaincfg/chainhash v1.0.1 // indirect
+	github.com/christsim/bips/base58 v0.0.0 // indirect
+	github.com/decred/dcrd/crypto/blake256 v1.0.0 // indirect
+	github.com/decred/dcrd/dcrec/secp256k1/v4 v4.0.1 // indirect
+	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9 // indirect
+)
+
+replace (
+	github.com/christsim/bips/base58 => ../base58
+	github.com/christsim/bips/bip-0032 => ../bip-0032
+	github.com/christsim/bips/bip-0173 => ../bip-0173
+	github.com/christsim/bips/bip-0340 => ../bip-0340
+	github.com/christsim/bips/bip-0341 => ../bip-0341
+	github.com/christsim/bips/internal => ../internal
+)
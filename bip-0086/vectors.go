@@ -0,0 +1,336 @@
+package bip86
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/rand"
+
+	bip32 "github.com/christsim/bips/bip-0032"
+	"github.com/christsim/bips/bip-0032/derivation"
+	bech32 "github.com/christsim/bips/bip-0173"
+	schnorr "github.com/christsim/bips/bip-0340"
+	taproot "github.com/christsim/bips/bip-0341"
+)
+
+// ErrVectorMismatch is returned by CheckVector when deriving the output of a
+// vector, through this package or any of those it builds on, doesn't give
+// the expected result.
+var ErrVectorMismatch = errors.New("bip86: vector mismatch")
+
+// Vector is a taproot output derived from an account key.
+type Vector struct {
+	Net derivation.Network
+
+	// AccountKey is the serialized account key, an xpub or an xprv.
+	AccountKey string
+	Path       derivation.Path
+
+	InternalKey []byte
+	OutputKey   []byte
+	Script      []byte
+	Address     string
+
+	// SigHash is a message signed with the secret key of the output key,
+	// with all zero auxiliary randomness, giving Signature. Both are empty
+	// for a watch-only account key.
+	SigHash   []byte
+	Signature []byte
+
+	// Comment describes what the vector exercises.
+	Comment string
+}
+
+// specVector is an output from the test vectors of BIP 86, all of which are
+// of the first mainnet account of derivation.AbandonSeed.
+type specVector struct {
+	change      derivation.Change
+	index       uint32
+	internalKey string
+	outputKey   string
+	address     string
+	comment     string
+}
+
+const (
+	// specXprv and specXpub are the account keys of the BIP 86 vectors,
+	// at m/86'/0'/0'.
+	specXprv = "xprv9xgqHN7yz9MwCkxsBPN5qetuNdQSUttZNKw1dcYTV4mkaAFiBVGQ" +
+		"ziHs3NRSWMkCzvgjEe3n9xV8oYywvM8at9yRqyaZVz6TYYhX98VjsUk"
+	specXpub = "xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxarj2af" +
+		"YWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ"
+)
+
+var specVectors = []specVector{
+	{
+		change:      derivation.External,
+		index:       0,
+		internalKey: "cc8a4bc64d897bddc5fbc2f670f7a8ba0b386779106cf1223c6fc5d7cd6fc115",
+		outputKey:   "a60869f0dbcf1dc659c9cecbaf8050135ea9e8cdc487053f1dc6880949dc684c",
+		address:     "bc1p5cyxnuxmeuwuvkwfem96lqzszd02n6xdcjrs20cac6yqjjwudpxqkedrcr",
+		comment:     "BIP 86 test vector, first receiving address",
+	},
+	{
+		change:      derivation.External,
+		index:       1,
+		internalKey: "83dfe85a3151d2517290da461fe2815591ef69f2b18a2ce63f01697a8b313145",
+		outputKey:   "a82f29944d65b86ae6b5e5cc75e294ead6c59391a1edc5e016e3498c67fc7bbb",
+		address:     "bc1p4qhjn9zdvkux4e44uhx8tc55attvtyu358kutcqkudyccelu0was9fqzwh",
+		comment:     "BIP 86 test vector, second receiving address",
+	},
+	{
+		change:      derivation.Internal,
+		index:       0,
+		internalKey: "399f1b2f4393f29a18c937859c5dd8a77350103157eb880f02e8c08214277cef",
+		outputKey:   "882d74e5d0572d5a816cef0041a96b6c1de832f6f9676d9605c44d5e9a97d3dc",
+		address:     "bc1p3qkhfews2uk44qtvauqyr2ttdsw7svhkl9nkm9s9c3x4ax5h60wqwruhk7",
+		comment:     "BIP 86 test vector, first change address",
+	},
+}
+
+func mustDecodeHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// SpecVectors returns the test vectors of BIP 86, derived from the account
+// xpub they list.
+func SpecVectors() []Vector {
+	vectors := make([]Vector, 0, len(specVectors))
+	for _, sv := range specVectors {
+		outputKey := mustDecodeHex(sv.outputKey)
+		vectors = append(vectors, Vector{
+			Net:        derivation.Mainnet,
+			AccountKey: specXpub,
+			Path: derivation.Path{
+				Purpose:  derivation.BIP86,
+				CoinType: derivation.Mainnet.CoinType,
+				Account:  0,
+				Change:   sv.change,
+				Index:    sv.index,
+			},
+			InternalKey: mustDecodeHex(sv.internalKey),
+			OutputKey:   outputKey,
+			Script:      taproot.OutputScript(outputKey),
+			Address:     sv.address,
+			Comment:     sv.comment,
+		})
+	}
+	return vectors
+}
+
+// Vectors returns the test vectors of BIP 86, followed by the same outputs
+// derived from the account xprv the BIP lists and signed for, and by count
+// outputs of random accounts of random seeds on either network, derived
+// from a math/rand source with the seed. Half of the random accounts are
+// watch-only.
+func Vectors(rngSeed int64, count int) []Vector {
+	vectors := SpecVectors()
+	for _, sv := range SpecVectors() {
+		v, err := NewVector(derivation.Mainnet, specXprv, sv.Path.Change,
+			sv.Path.Index, make([]byte, 32))
+		if err != nil {
+			panic(err)
+		}
+		v.Comment = sv.Comment + " from the xprv"
+		vectors = append(vectors, *v)
+	}
+
+	rng := rand.New(rand.NewSource(rngSeed))
+	nets := []derivation.Network{derivation.Mainnet, derivation.Testnet}
+	for i := 0; i < count; i++ {
+		net := nets[rng.Intn(len(nets))]
+		seed := make([]byte, 16+rng.Intn(49))
+		rng.Read(seed)
+		master, err := bip32.NewMaster(seed, net.Keys)
+		if err != nil {
+			// A seed whose master key is invalid is too unlikely
+			// to ever be drawn.
+			panic(err)
+		}
+		account, err := DeriveAccount(master, net, uint32(rng.Intn(4)))
+		if err != nil {
+			panic(err)
+		}
+		key := account.Key()
+		var sigHash []byte
+		if rng.Intn(2) == 0 {
+			key = key.Neuter()
+		} else {
+			sigHash = make([]byte, 32)
+			rng.Read(sigHash)
+		}
+		change := derivation.Change(rng.Intn(2))
+		index := uint32(rng.Intn(1000))
+
+		v, err := NewVector(net, key.String(), change, index, sigHash)
+		if err != nil {
+			panic(err)
+		}
+		v.Comment = fmt.Sprintf("random %v account, %v", net.Name,
+			v.Path)
+		if !key.IsPrivate() {
+			v.Comment += ", watch-only"
+		}
+		vectors = append(vectors, *v)
+	}
+	return vectors
+}
+
+// NewVector derives the vector of the output at the passed change level and
+// index of an account key, signing the signature hash with the output's
+// secret key if the key is private.
+func NewVector(net derivation.Network, accountKey string,
+	change derivation.Change, index uint32, sigHash []byte) (*Vector,
+	error) {
+
+	account, err := NewAccount(accountKey, net)
+	if err != nil {
+		return nil, err
+	}
+	out, err := account.Output(change, index)
+	if err != nil {
+		return nil, err
+	}
+	v := &Vector{
+		Net:         net,
+		AccountKey:  accountKey,
+		Path:        out.Path,
+		InternalKey: out.InternalKey,
+		OutputKey:   out.OutputKey,
+		Script:      out.Script,
+		Address:     out.Address,
+		Comment:     out.Path.String(),
+	}
+	if account.IsPrivate() {
+		v.SigHash = sigHash
+		v.Signature, err = account.Sign(change, index, sigHash,
+			make([]byte, schnorr.AuxRandSize))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+// CheckVector derives the output of the vector from its account key and
+// checks each of its keys, its script and its address. It then checks the
+// packages the derivation goes through against each other: the address
+// must be the one the derivation package renders, and must decode as a
+// bech32m address of witness version 1 to the output key. For a private
+// account key, the tweaked secret key must be that of the output key, and
+// must sign the signature hash into the signature, which must verify
+// against the output key.
+func CheckVector(v Vector) error {
+	account, err := NewAccount(v.AccountKey, v.Net)
+	if err != nil {
+		return err
+	}
+	if v.Path.Purpose != derivation.BIP86 ||
+		v.Path.CoinType != v.Net.CoinType {
+
+		return derivation.ErrWrongNetwork
+	}
+	path := account.account.Path(v.Path.Change, v.Path.Index)
+	if path != v.Path {
+		return fmt.Errorf("%w: account key at %v, expected %v",
+			ErrVectorMismatch, path, v.Path)
+	}
+
+	out, err := account.Output(v.Path.Change, v.Path.Index)
+	if err != nil {
+		return err
+	}
+	switch {
+	case !bytes.Equal(out.InternalKey, v.InternalKey):
+		return fmt.Errorf("%w: internal key %x, expected %x",
+			ErrVectorMismatch, out.InternalKey, v.InternalKey)
+	case !bytes.Equal(out.OutputKey, v.OutputKey):
+		return fmt.Errorf("%w: output key %x, expected %x",
+			ErrVectorMismatch, out.OutputKey, v.OutputKey)
+	case !bytes.Equal(out.Script, v.Script):
+		return fmt.Errorf("%w: script %x, expected %x",
+			ErrVectorMismatch, out.Script, v.Script)
+	case out.Address != v.Address:
+		return fmt.Errorf("%w: address %v, expected %v",
+			ErrVectorMismatch, out.Address, v.Address)
+	}
+
+	// The derivation package tweaks the key of its own accord.
+	address, err := account.account.Address(v.Path.Change, v.Path.Index)
+	if err != nil {
+		return err
+	}
+	if address != v.Address {
+		return fmt.Errorf("%w: derivation package renders %v, "+
+			"expected %v", ErrVectorMismatch, address, v.Address)
+	}
+	version, program, err := bech32.DecodeSegwit(v.Net.HRP, v.Address)
+	if err != nil {
+		return fmt.Errorf("%w: address: %v", ErrVectorMismatch, err)
+	}
+	if version != taproot.WitnessVersion ||
+		!bytes.Equal(program, v.OutputKey) {
+
+		return fmt.Errorf("%w: address decodes to version %d, "+
+			"program %x", ErrVectorMismatch, version, program)
+	}
+
+	if !account.IsPrivate() {
+		if len(v.SigHash) != 0 || len(v.Signature) != 0 {
+			return fmt.Errorf("%w: signature of a watch-only "+
+				"account", ErrVectorMismatch)
+		}
+		_, err := account.SecKey(v.Path.Change, v.Path.Index)
+		if !errors.Is(err, ErrWatchOnly) {
+			return fmt.Errorf("%w: watch-only account gives secret "+
+				"key, error %v", ErrVectorMismatch, err)
+		}
+		return nil
+	}
+
+	secKey, err := account.SecKey(v.Path.Change, v.Path.Index)
+	if err != nil {
+		return err
+	}
+	pubKey, err := schnorr.PubKey(secKey)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(pubKey, v.OutputKey) {
+		return fmt.Errorf("%w: secret key of public key %x, expected %x",
+			ErrVectorMismatch, pubKey, v.OutputKey)
+	}
+	sig, err := account.Sign(v.Path.Change, v.Path.Index, v.SigHash,
+		make([]byte, schnorr.AuxRandSize))
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(sig, v.Signature) {
+		return fmt.Errorf("%w: signature %x, expected %x",
+			ErrVectorMismatch, sig, v.Signature)
+	}
+	if err := schnorr.Verify(v.OutputKey, v.SigHash, v.Signature); err != nil {
+		return fmt.Errorf("%w: signature: %v", ErrVectorMismatch, err)
+	}
+
+	// A watch-only wallet of the same account derives the same output.
+	neutered := account.Key().Neuter().String()
+	watchOnly, err := NewAccount(neutered, v.Net)
+	if err != nil {
+		return err
+	}
+	out, err = watchOnly.Output(v.Path.Change, v.Path.Index)
+	if err != nil {
+		return err
+	}
+	if out.Address != v.Address {
+		return fmt.Errorf("%w: watch-only address %v, expected %v",
+			ErrVectorMismatch, out.Address, v.Address)
+	}
+	return nil
+}
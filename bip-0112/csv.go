@@ -0,0 +1,242 @@
+// Package csv implements OP_CHECKSEQUENCEVERIFY, the opcode of BIP 112
+// that fails a script unless the input executing it is locked by BIP 68 for
+// at least the relative lock on top of the stack:
+//
+//	script := csv.Script(sequencelock.Blocks(144))
+//	err := csv.Execute(append(script, txscript.OP_TRUE), tx, 0, true)
+//
+// The operand is a script number of up to 5 bytes, so that all 32 bits of a
+// sequence number fit, and must not be negative. If its disable flag is set
+// the opcode does nothing, leaving room for future soft forks. Otherwise the
+// transaction must be of version 2 or above, the input's sequence number
+// must not have its disable flag set, its lock must be of the same type as
+// the operand, blocks or time, and at least as long. The bits BIP 68 leaves
+// free are ignored on both sides.
+//
+// Like OP_CHECKLOCKTIMEVERIFY, the opcode leaves its operand on the stack,
+// so scripts usually drop it next. Execute runs scripts of pushes,
+// OP_CHECKSEQUENCEVERIFY and OP_DROP, enough for the locking scripts of
+// BIP 112 and its vectors, which are also checked against the script engine
+// of btcd.
+package csv
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	sequencelock "github.com/christsim/bips/bip-0068"
+)
+
+// MaxOperandLen is the size of the largest operand, in bytes.
+const MaxOperandLen = 5
+
+var (
+	// ErrEmptyStack is returned when OP_CHECKSEQUENCEVERIFY or OP_DROP
+	// executes on an empty stack.
+	ErrEmptyStack = errors.New("csv: empty stack")
+
+	// ErrOperandTooLong is returned for an operand longer than
+	// MaxOperandLen.
+	ErrOperandTooLong = errors.New("csv: operand too long")
+
+	// ErrMinimalData is returned, when minimal encodings are required,
+	// for an operand or a push that isn't minimally encoded.
+	ErrMinimalData = errors.New("csv: non-minimal encoding")
+
+	// ErrNegativeLockTime is returned for a negative operand.
+	ErrNegativeLockTime = errors.New("csv: negative lock-time")
+
+	// ErrUnsatisfiedLockTime is returned when the input isn't locked for
+	// the operand.
+	ErrUnsatisfiedLockTime = errors.New("csv: unsatisfied lock-time")
+
+	// ErrUnsupportedOpcode is returned by Execute for an opcode other than
+	// a push, OP_CHECKSEQUENCEVERIFY or OP_DROP, or one that fails to
+	// parse.
+	ErrUnsupportedOpcode = errors.New("csv: unsupported opcode")
+
+	// ErrEvalFalse is returned by Execute for a script that leaves an
+	// empty stack or false on top of it.
+	ErrEvalFalse = errors.New("csv: script evaluated false")
+
+	// ErrInputIndex is returned for an input the transaction doesn't
+	// have.
+	ErrInputIndex = errors.New("csv: input index out of range")
+)
+
+// Script returns the script locking an output for the relative lock, its
+// sequence number followed by OP_CHECKSEQUENCEVERIFY and OP_DROP, to which
+// the rest of the locking script is appended.
+func Script(l sequencelock.RelativeLock) []byte {
+	script, _ := txscript.NewScriptBuilder().
+		AddInt64(int64(l.Sequence())).
+		AddOp(txscript.OP_CHECKSEQUENCEVERIFY).
+		AddOp(txscript.OP_DROP).
+		Script()
+	return script
+}
+
+// ParseOperand returns the value of the operand, a little endian script
+// number whose top bit is its sign, of at most MaxOperandLen bytes. If
+// requireMinimal is set, it must have no extra zero bytes.
+func ParseOperand(b []byte, requireMinimal bool) (int64, error) {
+	if len(b) > MaxOperandLen {
+		return 0, fmt.Errorf("%w: %d bytes", ErrOperandTooLong, len(b))
+	}
+	if len(b) == 0 {
+		return 0, nil
+	}
+
+	// The last byte can only be zero, or the sign bit alone, if the byte
+	// before needs its top bit.
+	last := b[len(b)-1]
+	if requireMinimal && last&0x7f == 0 &&
+		(len(b) == 1 || b[len(b)-2]&0x80 == 0) {
+
+		return 0, fmt.Errorf("%w: operand %x", ErrMinimalData, b)
+	}
+
+	var n int64
+	for i, c := range b {
+		n |= int64(c) << (8 * i)
+	}
+	if last&0x80 != 0 {
+		n &^= 0x80 << (8 * (len(b) - 1))
+		n = -n
+	}
+	return n, nil
+}
+
+// Verify checks the input of the transaction at index i against the
+// operand of OP_CHECKSEQUENCEVERIFY.
+func Verify(tx *wire.MsgTx, i int, operand int64) error {
+	if operand < 0 {
+		return fmt.Errorf("%w: %d", ErrNegativeLockTime, operand)
+	}
+	lock, ok := sequencelock.Decode(uint32(operand))
+	if !ok {
+		return nil
+	}
+
+	if uint32(tx.Version) < sequencelock.MinTxVersion {
+		return fmt.Errorf("%w: transaction version %d",
+			ErrUnsatisfiedLockTime, tx.Version)
+	}
+	if i < 0 || i >= len(tx.TxIn) {
+		return fmt.Errorf("%w: %d of %d", ErrInputIndex, i,
+			len(tx.TxIn))
+	}
+	sequence := tx.TxIn[i].Sequence
+	inputLock, ok := sequencelock.Decode(sequence)
+	if !ok {
+		return fmt.Errorf("%w: input sequence %08x disabled",
+			ErrUnsatisfiedLockTime, sequence)
+	}
+	if inputLock.Seconds != lock.Seconds || inputLock.Value < lock.Value {
+		return fmt.Errorf("%w: lock of %v, input locked for %v",
+			ErrUnsatisfiedLockTime, lock, inputLock)
+	}
+	return nil
+}
+
+// isMinimalPush reports whether the data push opcode is the smallest push
+// of its data.
+func isMinimalPush(op byte, data []byte) bool {
+	switch {
+	case len(data) == 0:
+		return op == txscript.OP_0
+	case len(data) == 1 && data[0] >= 1 && data[0] <= 16:
+		return op == txscript.OP_1+data[0]-1
+	case len(data) == 1 && data[0] == 0x81:
+		return op == txscript.OP_1NEGATE
+	case len(data) <= txscript.OP_DATA_75:
+		return int(op) == len(data)
+	case len(data) <= 0xff:
+		return op == txscript.OP_PUSHDATA1
+	case len(data) <= 0xffff:
+		return op == txscript.OP_PUSHDATA2
+	}
+	return true
+}
+
+// pushedData returns the data a push opcode pushes, with the small integer
+// opcodes pushing their number.
+func pushedData(op byte, data []byte) ([]byte, bool) {
+	switch {
+	case op <= txscript.OP_PUSHDATA4:
+		return data, true
+	case op == txscript.OP_1NEGATE:
+		return []byte{0x81}, true
+	case op >= txscript.OP_1 && op <= txscript.OP_16:
+		return []byte{op - txscript.OP_1 + 1}, true
+	}
+	return nil, false
+}
+
+// isTrue reports whether the stack item is true: not all zero bytes but
+// for a sign bit in the last.
+func isTrue(item []byte) bool {
+	for i, c := range item {
+		if c != 0 && (i < len(item)-1 || c != 0x80) {
+			return true
+		}
+	}
+	return false
+}
+
+// Execute runs the script, spent by the input of the transaction at index
+// i, from an empty stack, and checks that it leaves true on top. The script
+// may only push data, run OP_CHECKSEQUENCEVERIFY and OP_DROP. If
+// requireMinimal is set, pushes and operands must be minimally encoded.
+func Execute(script []byte, tx *wire.MsgTx, i int,
+	requireMinimal bool) error {
+
+	var stack [][]byte
+	tokenizer := txscript.MakeScriptTokenizer(0, script)
+	for tokenizer.Next() {
+		op, data := tokenizer.Opcode(), tokenizer.Data()
+		if item, ok := pushedData(op, data); ok {
+			if requireMinimal && op <= txscript.OP_PUSHDATA4 &&
+				!isMinimalPush(op, data) {
+
+				return fmt.Errorf("%w: push of %x",
+					ErrMinimalData, data)
+			}
+			stack = append(stack, item)
+			continue
+		}
+
+		switch op {
+		case txscript.OP_CHECKSEQUENCEVERIFY:
+			if len(stack) == 0 {
+				return ErrEmptyStack
+			}
+			operand, err := ParseOperand(stack[len(stack)-1],
+				requireMinimal)
+			if err != nil {
+				return err
+			}
+			if err := Verify(tx, i, operand); err != nil {
+				return err
+			}
+		case txscript.OP_DROP:
+			if len(stack) == 0 {
+				return ErrEmptyStack
+			}
+			stack = stack[:len(stack)-1]
+		default:
+			return fmt.Errorf("%w: %02x at offset %d",
+				ErrUnsupportedOpcode, op, tokenizer.ByteIndex())
+		}
+	}
+	if err := tokenizer.Err(); err != nil {
+		return fmt.Errorf("%w: %v", ErrUnsupportedOpcode, err)
+	}
+
+	if len(stack) == 0 || !isTrue(stack[len(stack)-1]) {
+		return ErrEvalFalse
+	}
+	return nil
+}
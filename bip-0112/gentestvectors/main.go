@@ -0,0 +1,166 @@
+// This program writes test vectors for the csv package to scripts.json:
+// scripts checking relative locks with OP_CHECKSEQUENCEVERIFY, each spent
+// by transactions that satisfy the lock and by ones that don't, for being
+// locked too little or for the other type of lock, with the lock of the
+// input disabled or of a version below 2. They are followed by the edge
+// cases of operands, scripts around the opcode, operands encoded in odd
+// ways, under both the standard rules requiring minimal encodings and the
+// consensus rules that don't, and random locks spent by random
+// transactions. The random vectors depend only on -seed and -count, so they
+// can be regenerated by anyone:
+//
+//	gentestvectors -count 50 -seed 112
+//
+// The file uses the layout of the BIP 158 vectors: a JSON array whose first
+// row names the columns, followed by one row per vector. Each vector is a
+// script, in hex, spent by the only input of a transaction of the version
+// and sequence number, and the error it fails with, empty if it passes.
+// Pass -check to verify an existing file against the package, and against
+// the script engine of btcd, instead:
+//
+//	gentestvectors -check scripts.json
+//
+// The program lives in a directory of its own since the csv package sits at
+// the root of the module.
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	csv "github.com/christsim/bips/bip-0112"
+	"github.com/christsim/bips/internal/vectorfile"
+)
+
+// scriptColumns is the header row of the vector file.
+const scriptColumns = "Version,Sequence,Script,Minimal Data,Error,Comment"
+
+type JSONTestWriter struct {
+	writer          io.Writer
+	firstRowWritten bool
+}
+
+func NewJSONTestWriter(writer io.Writer) *JSONTestWriter {
+	return &JSONTestWriter{writer: writer}
+}
+
+func (w *JSONTestWriter) WriteComment(comment string) error {
+	return w.WriteTestCase([]interface{}{comment})
+}
+
+func (w *JSONTestWriter) WriteTestCase(row []interface{}) error {
+	var err error
+	if w.firstRowWritten {
+		_, err = io.WriteString(w.writer, ",\n")
+	} else {
+		_, err = io.WriteString(w.writer, "[\n")
+		w.firstRowWritten = true
+	}
+	if err != nil {
+		return err
+	}
+
+	rowBytes, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.writer.Write(rowBytes)
+	return err
+}
+
+func (w *JSONTestWriter) Close() error {
+	if !w.firstRowWritten {
+		return nil
+	}
+
+	_, err := io.WriteString(w.writer, "\n]\n")
+	return err
+}
+
+func main() {
+	out := flag.String("out", "scripts.json", "file to write the vectors "+
+		"to")
+	count := flag.Int("count", 50, "number of random locks to write "+
+		"vectors of")
+	seed := flag.Int64("seed", 112, "seed of the random vectors")
+	check := flag.String("check", "", "vector file to check instead of "+
+		"writing one")
+	flag.Parse()
+
+	var err error
+	if *check != "" {
+		err = checkFile(*check)
+	} else {
+		err = writeFile(*out, *seed, *count)
+	}
+	if err != nil {
+		fmt.Println("Error: ", err.Error())
+		os.Exit(1)
+	}
+}
+
+// writeFile writes the vectors, with count random ones, to out.
+func writeFile(out string, seed int64, count int) error {
+	file, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := NewJSONTestWriter(file)
+	if err := writer.WriteComment(scriptColumns); err != nil {
+		return err
+	}
+	vectors := csv.ScriptVectors(seed, count)
+	for _, v := range vectors {
+		err := writer.WriteTestCase([]interface{}{
+			v.Version,
+			v.Sequence,
+			hex.EncodeToString(v.Script),
+			v.MinimalData,
+			vectorfile.ErrorString(v.Err),
+			v.Comment,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote %d vectors\n", len(vectors))
+	return nil
+}
+
+// checkFile checks each vector of the file with csv.CheckScriptVector.
+func checkFile(path string) error {
+	rows, err := vectorfile.ReadRows(path, 6)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		var v csv.ScriptVector
+		var script, errMsg string
+		err := vectorfile.DecodeRow(row, &v.Version, &v.Sequence,
+			&script, &v.MinimalData, &errMsg, &v.Comment)
+		if err != nil {
+			return err
+		}
+		v.Script, err = hex.DecodeString(script)
+		if err != nil {
+			return fmt.Errorf("%v: %v", v.Comment, err)
+		}
+		v.Err = vectorfile.ParseError(errMsg)
+		if err := csv.CheckScriptVector(v); err != nil {
+			return fmt.Errorf("%v: %v", v.Comment, err)
+		}
+	}
+	fmt.Printf("%d vectors OK\n", len(rows))
+	return nil
+}
@@ -0,0 +1,254 @@
+package csv
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	sequencelock "github.com/christsim/bips/bip-0068"
+	"github.com/christsim/bips/internal/vectorfile"
+)
+
+// ErrVectorMismatch is returned by CheckScriptVector when executing the
+// script of a vector, with the package or the script engine of btcd,
+// doesn't give the expected result.
+var ErrVectorMismatch = errors.New("csv: vector mismatch")
+
+// Shorthands for the flags of sequence numbers and operands.
+const (
+	disableFlag = sequencelock.DisableFlag
+	typeFlag    = sequencelock.TypeFlag
+)
+
+// ScriptVector is a script spent by the only input of a transaction of the
+// version, whose sequence number is passed, and the error executing it
+// gives, nil if it passes.
+type ScriptVector struct {
+	Version  int32
+	Sequence uint32
+	Script   []byte
+
+	// MinimalData tells whether pushes and operands must be minimally
+	// encoded, as they must for standard transactions.
+	MinimalData bool
+
+	Err error
+
+	// Comment describes what the vector exercises.
+	Comment string
+}
+
+// spendTx returns a transaction of the version whose only input has the
+// sequence number.
+func spendTx(version int32, sequence uint32) *wire.MsgTx {
+	tx := wire.NewMsgTx(version)
+	txIn := wire.NewTxIn(&wire.OutPoint{}, nil, nil)
+	txIn.Sequence = sequence
+	tx.AddTxIn(txIn)
+	tx.AddTxOut(wire.NewTxOut(0, nil))
+	return tx
+}
+
+// newScriptVector returns the vector of the script spent by the transaction.
+func newScriptVector(version int32, sequence uint32, script []byte,
+	minimalData bool, comment string) ScriptVector {
+
+	return ScriptVector{
+		Version:     version,
+		Sequence:    sequence,
+		Script:      script,
+		MinimalData: minimalData,
+		Err: Execute(script, spendTx(version, sequence), 0,
+			minimalData),
+		Comment: comment,
+	}
+}
+
+// lockScript returns the script checking the operand with
+// OP_CHECKSEQUENCEVERIFY, then dropping it and pushing true.
+func lockScript(operand int64) []byte {
+	script, _ := txscript.NewScriptBuilder().
+		AddInt64(operand).
+		AddOp(txscript.OP_CHECKSEQUENCEVERIFY).
+		AddOp(txscript.OP_DROP).
+		AddOp(txscript.OP_TRUE).
+		Script()
+	return script
+}
+
+// rawLockScript returns the lock script of the operand as the raw push
+// opcodes.
+func rawLockScript(push ...byte) []byte {
+	return append(push, txscript.OP_CHECKSEQUENCEVERIFY,
+		txscript.OP_DROP, txscript.OP_TRUE)
+}
+
+// ScriptVectors returns vectors of scripts checking relative locks with
+// OP_CHECKSEQUENCEVERIFY, spent by transactions that satisfy them and that
+// don't: locked too little, for the wrong type of lock, with the lock of
+// the input disabled or of a version too low. They are followed by the
+// edge cases of operands, their encodings and the scripts around them, and
+// count random operands spent by random transactions derived from a
+// math/rand source with the seed. All follow the standard rules requiring
+// minimal encodings, and the encodings also the consensus rules that don't.
+func ScriptVectors(rngSeed int64, count int) []ScriptVector {
+	var vectors []ScriptVector
+	add := func(version int32, sequence uint32, script []byte,
+		comment string) {
+
+		vectors = append(vectors, newScriptVector(version, sequence,
+			script, true, comment))
+	}
+
+	for _, c := range []struct {
+		operand  int64
+		version  int32
+		sequence uint32
+		comment  string
+	}{
+		{10, 2, 10, "10 blocks, input locked 10 blocks"},
+		{10, 2, 11, "10 blocks, input locked 11 blocks"},
+		{10, 2, 9, "10 blocks, input locked 9 blocks"},
+		{typeFlag | 10, 2, typeFlag | 10,
+			"5120 seconds, input locked 5120 seconds"},
+		{typeFlag | 10, 2, typeFlag | 9,
+			"5120 seconds, input locked 4608 seconds"},
+		{0, 2, 0, "0 blocks, input locked 0 blocks"},
+		{0xffff, 2, 0xffff, "Most blocks, input locked as much"},
+		{10, 2, typeFlag | 10, "Blocks, input locked in time"},
+		{typeFlag | 10, 2, 10, "Seconds, input locked in blocks"},
+		{0, 2, typeFlag, "0 blocks, input locked 0 seconds"},
+		{typeFlag, 2, 0, "0 seconds, input locked 0 blocks"},
+		{10, 2, disableFlag | 10, "Input lock disabled"},
+		{10, 2, wire.MaxTxInSequenceNum, "Input final"},
+		{0, 2, wire.MaxTxInSequenceNum, "0 blocks, input final"},
+		{10, 1, 10, "Version 1"},
+		{10, 0, 10, "Version 0"},
+		{10, 3, 10, "Version 3"},
+		{10, -1, 10, "Version -1, unsigned above 2"},
+		{disableFlag, 1, wire.MaxTxInSequenceNum,
+			"Operand disabled, NOP"},
+		{disableFlag | typeFlag | 10, 2, 0,
+			"Operand disabled, seconds"},
+		{1<<39 - 1, 1, disableFlag, "Largest operand, disabled"},
+		{1 << 32, 2, 0, "Bits above 32 ignored, 0 blocks"},
+		{1<<32 | 10, 2, 9, "Bits above 32 ignored, 10 blocks"},
+		{0x003f0000 | 10, 2, 10, "Operand free bits ignored"},
+		{10, 2, 0x003f0000 | 10, "Input free bits ignored"},
+		{0x7f800000 | 11, 2, 0x7f800000 | 10,
+			"Free bits ignored, input locked too little"},
+		{-1, 2, 10, "Negative operand"},
+		{-10, 2, 10, "Negative 10 blocks"},
+		{-disableFlag, 2, 10, "Negative disabled operand"},
+	} {
+		add(c.version, c.sequence, lockScript(c.operand), c.comment)
+	}
+
+	// Scripts around the opcode.
+	csv := byte(txscript.OP_CHECKSEQUENCEVERIFY)
+	for _, c := range []struct {
+		script  []byte
+		comment string
+	}{
+		{[]byte{csv}, "Empty stack"},
+		{[]byte{txscript.OP_10, csv}, "Operand left on stack"},
+		{[]byte{txscript.OP_0, csv}, "Zero operand left on stack"},
+		{[]byte{txscript.OP_10, csv, txscript.OP_DROP},
+			"Operand dropped, empty stack"},
+		{append(Script(sequencelock.Blocks(10)), txscript.OP_1),
+			"Script of 10 blocks"},
+		{append(Script(sequencelock.RelativeLock{
+			Seconds: true, Value: 10}), txscript.OP_1),
+			"Script of 5120 seconds"},
+		{[]byte{txscript.OP_1, txscript.OP_10, csv, txscript.OP_5, csv,
+			txscript.OP_DROP, txscript.OP_DROP},
+			"Two locks, both unlocked"},
+		{[]byte{txscript.OP_1, txscript.OP_10, csv, txscript.OP_DROP,
+			txscript.OP_11, csv}, "Two locks, second locked"},
+	} {
+		add(2, 10, c.script, c.comment)
+	}
+
+	// Operands encoded in odd ways, by the bytes of the push, which only
+	// the consensus rules accept.
+	for _, minimalData := range []bool{true, false} {
+		for _, c := range []struct {
+			push     []byte
+			sequence uint32
+			comment  string
+		}{
+			{[]byte{0x01, 0x0a}, 10, "10 pushed as data"},
+			{[]byte{0x02, 0x0a, 0x00}, 10, "10 padded to 2 bytes"},
+			{[]byte{0x4c, 0x01, 0x0a}, 10,
+				"10 pushed by PUSHDATA1"},
+			{[]byte{0x01, 0x80}, 0, "Negative zero"},
+			{[]byte{0x02, 0x00, 0x80}, 0, "Negative zero, 2 bytes"},
+			{[]byte{0x05, 0x0a, 0x00, 0x00, 0x00, 0x00}, 10,
+				"10 padded to 5 bytes"},
+			{[]byte{0x06, 0x0a, 0x00, 0x00, 0x00, 0x00, 0x00}, 10,
+				"10 padded to 6 bytes"},
+			{[]byte{0x06, 0x00, 0x00, 0x00, 0x80, 0x00, 0x00}, 10,
+				"Disabled, 6 bytes"},
+			{[]byte{0x02, 0xff, 0x00}, 0xff,
+				"255, sign byte needed"},
+		} {
+			comment := c.comment
+			if !minimalData {
+				comment += ", non-minimal allowed"
+			}
+			vectors = append(vectors, newScriptVector(2, c.sequence,
+				rawLockScript(c.push...), minimalData, comment))
+		}
+	}
+
+	rng := rand.New(rand.NewSource(rngSeed))
+	for n := 0; n < count; n++ {
+		operand := int64(rng.Intn(1 << 10))
+		sequence := uint32(rng.Intn(1 << 10))
+		if rng.Intn(2) == 0 {
+			operand |= typeFlag
+		}
+		if rng.Intn(2) == 0 {
+			sequence |= typeFlag
+		}
+		if rng.Intn(8) == 0 {
+			operand |= int64(rng.Uint32())
+		}
+		if rng.Intn(8) == 0 {
+			sequence |= rng.Uint32()
+		}
+		version := int32(1 + rng.Intn(2))
+		add(version, sequence, lockScript(operand),
+			fmt.Sprintf("Random, version %d", version))
+	}
+	return vectors
+}
+
+// CheckScriptVector executes the script of the vector with Execute and
+// with the script engine of btcd, which must agree on whether it passes.
+func CheckScriptVector(v ScriptVector) error {
+	tx := spendTx(v.Version, v.Sequence)
+	err := Execute(v.Script, tx, 0, v.MinimalData)
+	if !vectorfile.SameError(err, v.Err) {
+		return fmt.Errorf("%w: error %v, expected %v",
+			ErrVectorMismatch, err, v.Err)
+	}
+
+	flags := txscript.ScriptVerifyCheckSequenceVerify
+	if v.MinimalData {
+		flags |= txscript.ScriptVerifyMinimalData
+	}
+	fetcher := txscript.NewCannedPrevOutputFetcher(v.Script, 0)
+	vm, err := txscript.NewEngine(v.Script, tx, 0, flags, nil, nil, 0,
+		fetcher)
+	if err == nil {
+		err = vm.Execute()
+	}
+	if (err == nil) != (v.Err == nil) {
+		return fmt.Errorf("%w: btcd gives error %v, expected %v",
+			ErrVectorMismatch, err, v.Err)
+	}
+	return nil
+}
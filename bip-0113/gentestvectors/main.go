@@ -0,0 +1,232 @@
+// This program writes test vectors for the mediantime package: the median
+// times past of chains of fewer than, as many as and more than eleven
+// blocks, of timestamps out of order, equal and off the spacing of the
+// others, followed by random chains, to medians.json, and transactions
+// mined in the last block their lock-times or BIP 68 relative lock-times
+// lock them in and the next, in a chain of blocks of timestamps off by up
+// to two hours, followed by random transactions in random chains, to
+// spends.json. The vectors depend only on -seed and -count, so they can be
+// regenerated by anyone:
+//
+//	gentestvectors -count 50 -seed 113
+//
+// Both files use the layout of the BIP 158 vectors: a JSON array whose
+// first row names the columns, followed by one row per vector. Chains are
+// given by the timestamps of their blocks from the genesis block, and the
+// errors of transactions that can't be mined by their messages, empty for
+// those that can. Pass -check and -check-spends to verify existing files
+// against the package instead:
+//
+//	gentestvectors -check medians.json -check-spends spends.json
+//
+// The program lives in a directory of its own since the mediantime package
+// sits at the root of the module.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	mediantime "github.com/christsim/bips/bip-0113"
+	"github.com/christsim/bips/internal/vectorfile"
+)
+
+// medianColumns is the header row of the median time past vector file.
+const medianColumns = "Timestamps,Median Time Past,Comment"
+
+// spendColumns is the header row of the spend vector file.
+const spendColumns = "Timestamps,Version,Lock Time,Sequences,Input Heights," +
+	"Height,Error,Comment"
+
+type JSONTestWriter struct {
+	writer          io.Writer
+	firstRowWritten bool
+}
+
+func NewJSONTestWriter(writer io.Writer) *JSONTestWriter {
+	return &JSONTestWriter{writer: writer}
+}
+
+func (w *JSONTestWriter) WriteComment(comment string) error {
+	return w.WriteTestCase([]interface{}{comment})
+}
+
+func (w *JSONTestWriter) WriteTestCase(row []interface{}) error {
+	var err error
+	if w.firstRowWritten {
+		_, err = io.WriteString(w.writer, ",\n")
+	} else {
+		_, err = io.WriteString(w.writer, "[\n")
+		w.firstRowWritten = true
+	}
+	if err != nil {
+		return err
+	}
+
+	rowBytes, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.writer.Write(rowBytes)
+	return err
+}
+
+func (w *JSONTestWriter) Close() error {
+	if !w.firstRowWritten {
+		return nil
+	}
+
+	_, err := io.WriteString(w.writer, "\n]\n")
+	return err
+}
+
+func main() {
+	out := flag.String("out", "medians.json", "file to write the median "+
+		"time past vectors to")
+	spendsOut := flag.String("spends-out", "spends.json", "file to "+
+		"write the spend vectors to")
+	count := flag.Int("count", 50, "number of random chains and "+
+		"transactions to write vectors of")
+	seed := flag.Int64("seed", 113, "seed of the random vectors")
+	check := flag.String("check", "", "median time past vector file to "+
+		"check instead of writing the files")
+	checkSpends := flag.String("check-spends", "", "spend vector file to "+
+		"check instead of writing the files")
+	flag.Parse()
+
+	var err error
+	switch {
+	case *check != "" || *checkSpends != "":
+		if *check != "" {
+			err = checkFile(*check)
+		}
+		if err == nil && *checkSpends != "" {
+			err = checkSpendsFile(*checkSpends)
+		}
+	default:
+		err = writeFile(*out, *seed, *count)
+		if err == nil {
+			err = writeSpendsFile(*spendsOut, *seed, *count)
+		}
+	}
+	if err != nil {
+		fmt.Println("Error: ", err.Error())
+		os.Exit(1)
+	}
+}
+
+// writeRows writes the header and rows to a new vector file at path.
+func writeRows(path, columns string, rows [][]interface{}) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := NewJSONTestWriter(file)
+	if err := writer.WriteComment(columns); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if err := writer.WriteTestCase(row); err != nil {
+			return err
+		}
+	}
+	return writer.Close()
+}
+
+// writeFile writes the median time past vectors, with count random ones,
+// to out.
+func writeFile(out string, seed int64, count int) error {
+	var rows [][]interface{}
+	vectors := mediantime.MedianVectors(seed, count)
+	for _, v := range vectors {
+		rows = append(rows, []interface{}{
+			v.Timestamps,
+			v.MedianTimePast,
+			v.Comment,
+		})
+	}
+	if err := writeRows(out, medianColumns, rows); err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote %d median time past vectors\n", len(vectors))
+	return nil
+}
+
+// writeSpendsFile writes the spend vectors, with those of count random
+// transactions, to out.
+func writeSpendsFile(out string, seed int64, count int) error {
+	var rows [][]interface{}
+	vectors := mediantime.SpendVectors(seed, count)
+	for _, v := range vectors {
+		rows = append(rows, []interface{}{
+			v.Timestamps,
+			v.Version,
+			v.LockTime,
+			v.Sequences,
+			v.InputHeights,
+			v.Height,
+			vectorfile.ErrorString(v.Err),
+			v.Comment,
+		})
+	}
+	if err := writeRows(out, spendColumns, rows); err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote %d spend vectors\n", len(vectors))
+	return nil
+}
+
+// checkFile checks each vector of the file with
+// mediantime.CheckMedianVector.
+func checkFile(path string) error {
+	rows, err := vectorfile.ReadRows(path, 3)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		var v mediantime.MedianVector
+		err := vectorfile.DecodeRow(row, &v.Timestamps,
+			&v.MedianTimePast, &v.Comment)
+		if err != nil {
+			return err
+		}
+		if err := mediantime.CheckMedianVector(v); err != nil {
+			return fmt.Errorf("%v: %v", v.Comment, err)
+		}
+	}
+	fmt.Printf("%d median time past vectors OK\n", len(rows))
+	return nil
+}
+
+// checkSpendsFile checks each vector of the file with
+// mediantime.CheckSpendVector.
+func checkSpendsFile(path string) error {
+	rows, err := vectorfile.ReadRows(path, 8)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		var v mediantime.SpendVector
+		var errMsg string
+		err := vectorfile.DecodeRow(row, &v.Timestamps, &v.Version,
+			&v.LockTime, &v.Sequences, &v.InputHeights, &v.Height,
+			&errMsg, &v.Comment)
+		if err != nil {
+			return err
+		}
+		v.Err = vectorfile.ParseError(errMsg)
+		if err := mediantime.CheckSpendVector(v); err != nil {
+			return fmt.Errorf("%v: %v", v.Comment, err)
+		}
+	}
+	fmt.Printf("%d spend vectors OK\n", len(rows))
+	return nil
+}
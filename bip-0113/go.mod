@@ -0,0 +1,20 @@
+module github.com/christsim/bips/bip-0113
+
+go 1.21
+
+require (
+	github.com/btcsuite/btcd v0.24.2
+	github.com/btcsuite/btcd/chaincfg/chainhash v1.1.0
+	github.com/christsim/bips/bip-0068 v0.0.0
+	github.com/christsim/bips/internal v0.0.0
+)
+
+require (
+	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9 // indirect
+	golang.org/x/sys v0.0.0-20200814200057-3d37ad5750ed // indirect
+)
+
+replace (
+	github.com/christsim/bips/bip-0068 => ../bip-0068
+	github.com/christsim/bips/internal => ../internal
+)
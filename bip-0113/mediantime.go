@@ -0,0 +1,226 @@
+// Package mediantime implements the median time past of BIP 113, the median
+// of the timestamps of a block and the ten before it, and the lock-times it
+// measures: the nLockTime of transactions and, with the sequencelock package,
+// the relative lock-times of BIP 68:
+//
+//	chain, err := mediantime.NewChain(0, headers)
+//	mtp, err := chain.MedianTimePast(chain.Tip())
+//	err = chain.CheckTx(tx, inputHeights, chain.Tip()+1)
+//
+// A lock-time below LockTimeThreshold is a height, and a transaction of one
+// can be mined in the blocks above it. One of LockTimeThreshold and above is
+// a time, which BIP 113 compares to the median time past of the block before
+// the one mining the transaction rather than to the timestamp of the block,
+// which miners choose freely within two hours. A lock-time of zero, or any
+// lock-time of a transaction whose inputs all have the final sequence
+// number, doesn't lock it at all.
+//
+// The median time past moves forward as the chain grows, though not always
+// by the spacing of blocks, and lags the timestamps of the blocks by about
+// an hour. Near the genesis block the median is that of the blocks there
+// are, the higher of the two middle ones for an even number.
+package mediantime
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	sequencelock "github.com/christsim/bips/bip-0068"
+)
+
+const (
+	// MedianTimeBlocks is the number of blocks whose median timestamp is
+	// the median time past of the last.
+	MedianTimeBlocks = 11
+
+	// LockTimeThreshold is the lowest lock-time that is a time rather
+	// than a height.
+	LockTimeThreshold = 500000000
+)
+
+var (
+	// ErrNotConnected is returned for a header that doesn't follow the
+	// tip of the chain.
+	ErrNotConnected = errors.New("mediantime: header doesn't connect")
+
+	// ErrUnknownHeight is returned for a height whose block, or one of
+	// the blocks before it its median time past needs, isn't in the
+	// chain.
+	ErrUnknownHeight = errors.New("mediantime: unknown height")
+
+	// ErrNotFinal is returned by CheckFinal and CheckTx for a transaction
+	// its lock-time locks.
+	ErrNotFinal = errors.New("mediantime: transaction not final")
+
+	// ErrSequenceLocked is returned by CheckSequenceLocks and CheckTx for
+	// a transaction the relative lock-times of its inputs lock.
+	ErrSequenceLocked = errors.New("mediantime: sequence locks not " +
+		"satisfied")
+)
+
+// MedianTime returns the median of the timestamps, the higher of the middle
+// two for an even number of them, as the median time past of a block is
+// that of the timestamps of the last MedianTimeBlocks blocks.
+func MedianTime(timestamps []int64) int64 {
+	if len(timestamps) == 0 {
+		return 0
+	}
+	sorted := append([]int64{}, timestamps...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+	return sorted[len(sorted)/2]
+}
+
+// IsFinal reports whether the transaction can be mined in the block at the
+// height, with time lock-times measured against the cutoff, the median
+// time past of the block before it.
+func IsFinal(tx *wire.MsgTx, height int32, cutoff int64) bool {
+	if tx.LockTime == 0 {
+		return true
+	}
+	limit := int64(height)
+	if tx.LockTime >= LockTimeThreshold {
+		limit = cutoff
+	}
+	if int64(tx.LockTime) < limit {
+		return true
+	}
+	for _, txIn := range tx.TxIn {
+		if txIn.Sequence != wire.MaxTxInSequenceNum {
+			return false
+		}
+	}
+	return true
+}
+
+// Chain is a chain of headers, from a start height up to its tip, whose
+// median times past it computes.
+type Chain struct {
+	start      int32
+	timestamps []int64
+	tip        chainhash.Hash
+}
+
+// NewChain returns the chain of the headers, the first of which is at the
+// start height.
+func NewChain(start int32, headers []*wire.BlockHeader) (*Chain, error) {
+	c := &Chain{start: start}
+	for _, header := range headers {
+		if err := c.Add(header); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// Add extends the chain with the header, which must follow its tip.
+func (c *Chain) Add(header *wire.BlockHeader) error {
+	if len(c.timestamps) > 0 && header.PrevBlock != c.tip {
+		return fmt.Errorf("%w: %v follows %v, not %v", ErrNotConnected,
+			header.BlockHash(), header.PrevBlock, c.tip)
+	}
+	c.timestamps = append(c.timestamps, header.Timestamp.Unix())
+	c.tip = header.BlockHash()
+	return nil
+}
+
+// Tip returns the height of the last block of the chain, one below its
+// start if it has none.
+func (c *Chain) Tip() int32 {
+	return c.start + int32(len(c.timestamps)) - 1
+}
+
+// MedianTimePast returns the median time past of the block at the height,
+// which needs the blocks down to ten below it, or to the genesis block.
+func (c *Chain) MedianTimePast(height int32) (int64, error) {
+	first := height - MedianTimeBlocks + 1
+	if first < 0 {
+		first = 0
+	}
+	if first < c.start || height > c.Tip() {
+		return 0, fmt.Errorf("%w: %d, chain has %d to %d",
+			ErrUnknownHeight, height, c.start, c.Tip())
+	}
+	return MedianTime(c.timestamps[first-c.start : height-c.start+1]), nil
+}
+
+// Input returns the input of the sequencelock package spending an output
+// confirmed at the height, whose relative time locks count from the median
+// time past of the block before.
+func (c *Chain) Input(height int32) (sequencelock.Input, error) {
+	prev := height - 1
+	if prev < 0 {
+		prev = 0
+	}
+	mtp, err := c.MedianTimePast(prev)
+	if err != nil {
+		return sequencelock.Input{}, err
+	}
+	return sequencelock.Input{Height: height, PrevMedianTimePast: mtp}, nil
+}
+
+// CheckFinal checks that the lock-time of the transaction lets it be mined
+// in the block at the height, the next one after the tip or below, which
+// needs the median time past of the block before it.
+func (c *Chain) CheckFinal(tx *wire.MsgTx, height int32) error {
+	mtp, err := c.MedianTimePast(height - 1)
+	if err != nil {
+		return err
+	}
+	if !IsFinal(tx, height, mtp) {
+		return fmt.Errorf("%w: lock-time %d at height %d, median "+
+			"time past %d", ErrNotFinal, tx.LockTime, height, mtp)
+	}
+	return nil
+}
+
+// CheckSequenceLocks checks that the relative lock-times of the inputs of
+// the transaction, spending outputs confirmed at the input heights, let it
+// be mined in the block at the height.
+func (c *Chain) CheckSequenceLocks(tx *wire.MsgTx, inputHeights []int32,
+	height int32) error {
+
+	inputs := make([]sequencelock.Input, len(inputHeights))
+	for i, inputHeight := range inputHeights {
+		if inputHeight > height {
+			return fmt.Errorf("%w: input %d confirmed at %d, "+
+				"above %d", ErrUnknownHeight, i, inputHeight,
+				height)
+		}
+		input, err := c.Input(inputHeight)
+		if err != nil {
+			return err
+		}
+		inputs[i] = input
+	}
+	lock, err := sequencelock.CalculateLock(tx, inputs)
+	if err != nil {
+		return err
+	}
+	mtp, err := c.MedianTimePast(height - 1)
+	if err != nil {
+		return err
+	}
+	if !lock.Evaluate(height, mtp) {
+		return fmt.Errorf("%w: locked to height %d, time %d at height "+
+			"%d, median time past %d", ErrSequenceLocked,
+			lock.MinHeight, lock.MinTime, height, mtp)
+	}
+	return nil
+}
+
+// CheckTx checks that both the lock-time of the transaction and the
+// relative lock-times of its inputs let it be mined in the block at the
+// height.
+func (c *Chain) CheckTx(tx *wire.MsgTx, inputHeights []int32,
+	height int32) error {
+
+	if err := c.CheckFinal(tx, height); err != nil {
+		return err
+	}
+	return c.CheckSequenceLocks(tx, inputHeights, height)
+}
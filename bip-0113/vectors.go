@@ -0,0 +1,392 @@
+package mediantime
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/btcsuite/btcd/wire"
+	sequencelock "github.com/christsim/bips/bip-0068"
+	"github.com/christsim/bips/internal/vectorfile"
+)
+
+// ErrVectorMismatch is returned by the checks of vectors when computing the
+// median time past or checking the locks of a transaction doesn't give the
+// expected result.
+var ErrVectorMismatch = errors.New("mediantime: vector mismatch")
+
+// MedianVector is the median time past of the last of blocks of the
+// timestamps, starting at the genesis block.
+type MedianVector struct {
+	Timestamps     []int64
+	MedianTimePast int64
+
+	// Comment describes what the vector exercises.
+	Comment string
+}
+
+// SpendVector is a transaction of the version, lock-time and sequence
+// numbers, spending outputs confirmed at the input heights of a chain of
+// blocks of the timestamps, starting at the genesis block, mined in the
+// block at Height, and the error checking its locks gives, nil if it can be
+// mined.
+type SpendVector struct {
+	Timestamps []int64
+
+	Version      int32
+	LockTime     uint32
+	Sequences    []uint32
+	InputHeights []int32
+
+	Height int32
+	Err    error
+
+	// Comment describes what the vector exercises.
+	Comment string
+}
+
+// chainOf returns the chain of headers of the timestamps, starting at the
+// genesis block.
+func chainOf(timestamps []int64) *Chain {
+	c := &Chain{}
+	var prev wire.BlockHeader
+	for i, timestamp := range timestamps {
+		header := wire.BlockHeader{
+			Version:   1,
+			Timestamp: time.Unix(timestamp, 0),
+		}
+		if i > 0 {
+			header.PrevBlock = prev.BlockHash()
+		}
+		if err := c.Add(&header); err != nil {
+			panic(err)
+		}
+		prev = header
+	}
+	return c
+}
+
+// spacing is the spacing of the timestamps of the chains of the vectors,
+// whose first block has the timestamp base.
+const (
+	spacing = 600
+	base    = 1600000000
+)
+
+// newMedianVector returns the vector of the timestamps.
+func newMedianVector(timestamps []int64, comment string) MedianVector {
+	c := chainOf(timestamps)
+	mtp, err := c.MedianTimePast(c.Tip())
+	if err != nil {
+		panic(err)
+	}
+	return MedianVector{
+		Timestamps:     timestamps,
+		MedianTimePast: mtp,
+		Comment:        comment,
+	}
+}
+
+// spacedTimestamps returns the timestamps of n blocks mined every spacing
+// seconds from base.
+func spacedTimestamps(n int) []int64 {
+	timestamps := make([]int64, n)
+	for i := range timestamps {
+		timestamps[i] = base + int64(i)*spacing
+	}
+	return timestamps
+}
+
+// randomTimestamps returns the timestamps of n blocks mined every spacing
+// seconds from base on average, each off by up to two hours either way, as
+// miners may set them.
+func randomTimestamps(rng *rand.Rand, n int) []int64 {
+	timestamps := spacedTimestamps(n)
+	for i := range timestamps {
+		timestamps[i] += int64(rng.Intn(4*3600+1) - 2*3600)
+	}
+	return timestamps
+}
+
+// MedianVectors returns vectors of the median time past of the first blocks
+// of a chain, fewer than, as many as and more than MedianTimeBlocks, of
+// timestamps out of order, equal or off the spacing of the others, followed
+// by count random chains derived from a math/rand source with the seed.
+func MedianVectors(rngSeed int64, count int) []MedianVector {
+	outlier := func(i int, offset int64) []int64 {
+		timestamps := spacedTimestamps(MedianTimeBlocks)
+		timestamps[i] += offset
+		return timestamps
+	}
+	descending := spacedTimestamps(MedianTimeBlocks)
+	for i, j := 0, len(descending)-1; i < j; i, j = i+1, j-1 {
+		descending[i], descending[j] = descending[j], descending[i]
+	}
+	equal := make([]int64, 15)
+	for i := range equal {
+		equal[i] = base
+	}
+
+	vectors := []MedianVector{
+		newMedianVector(spacedTimestamps(1), "Genesis block only"),
+		newMedianVector(spacedTimestamps(2),
+			"Two blocks, higher of the middle two"),
+		newMedianVector(spacedTimestamps(3), "Three blocks"),
+		newMedianVector(spacedTimestamps(10),
+			"Ten blocks, higher of the middle two"),
+		newMedianVector(spacedTimestamps(11), "Eleven blocks"),
+		newMedianVector(spacedTimestamps(12),
+			"Twelve blocks, genesis block left out"),
+		newMedianVector(spacedTimestamps(30), "Thirty blocks"),
+		newMedianVector(descending, "Descending timestamps"),
+		newMedianVector(equal, "Equal timestamps"),
+		newMedianVector(outlier(10, 2*3600),
+			"Last block two hours ahead"),
+		newMedianVector(outlier(10, -2*3600),
+			"Last block two hours behind"),
+		newMedianVector(outlier(5, 2*3600),
+			"Middle block two hours ahead"),
+		newMedianVector(outlier(0, 2*3600),
+			"First block two hours ahead"),
+		newMedianVector([]int64{base, base + 2*spacing, base + spacing},
+			"Last two blocks swapped"),
+	}
+
+	rng := rand.New(rand.NewSource(rngSeed))
+	for n := 0; n < count; n++ {
+		vectors = append(vectors, newMedianVector(
+			randomTimestamps(rng, 1+rng.Intn(30)), "Random"))
+	}
+	return vectors
+}
+
+// CheckMedianVector checks the median time past of the vector.
+func CheckMedianVector(v MedianVector) error {
+	if len(v.Timestamps) == 0 {
+		return fmt.Errorf("%w: no timestamps", ErrVectorMismatch)
+	}
+	c := chainOf(v.Timestamps)
+	mtp, err := c.MedianTimePast(c.Tip())
+	if err != nil {
+		return err
+	}
+	if mtp != v.MedianTimePast {
+		return fmt.Errorf("%w: median time past %d, expected %d",
+			ErrVectorMismatch, mtp, v.MedianTimePast)
+	}
+	return nil
+}
+
+// spendTx returns the transaction of the version, lock-time and sequence
+// numbers.
+func spendTx(version int32, lockTime uint32, sequences []uint32) *wire.MsgTx {
+	tx := wire.NewMsgTx(version)
+	tx.LockTime = lockTime
+	for i, sequence := range sequences {
+		txIn := wire.NewTxIn(&wire.OutPoint{Index: uint32(i)}, nil, nil)
+		txIn.Sequence = sequence
+		tx.AddTxIn(txIn)
+	}
+	tx.AddTxOut(wire.NewTxOut(0, nil))
+	return tx
+}
+
+// newSpendVector returns the vector of the transaction mined in the block
+// at the height.
+func newSpendVector(timestamps []int64, version int32, lockTime uint32,
+	sequences []uint32, inputHeights []int32, height int32,
+	comment string) SpendVector {
+
+	tx := spendTx(version, lockTime, sequences)
+	err := chainOf(timestamps).CheckTx(tx, inputHeights, height)
+	return SpendVector{
+		Timestamps:   timestamps,
+		Version:      version,
+		LockTime:     lockTime,
+		Sequences:    sequences,
+		InputHeights: inputHeights,
+		Height:       height,
+		Err:          err,
+		Comment:      comment,
+	}
+}
+
+// boundaryVectors returns the vectors of the transaction mined in the last
+// block of the chain of the timestamps, or the one after its tip, that its
+// locks lock it in, and in the next. A transaction that can be mined as
+// soon as its inputs are confirmed has only the vector of that block, and
+// one locked past the tip only that of the block after it.
+func boundaryVectors(timestamps []int64, version int32, lockTime uint32,
+	sequences []uint32, inputHeights []int32,
+	comment string) []SpendVector {
+
+	c := chainOf(timestamps)
+	tx := spendTx(version, lockTime, sequences)
+	first := int32(1)
+	for _, height := range inputHeights {
+		if height > first {
+			first = height
+		}
+	}
+
+	for height := first; height <= c.Tip()+1; height++ {
+		if c.CheckTx(tx, inputHeights, height) != nil {
+			continue
+		}
+		if height == first {
+			return []SpendVector{
+				newSpendVector(timestamps, version, lockTime,
+					sequences, inputHeights, height,
+					comment+", spendable at once"),
+			}
+		}
+		return []SpendVector{
+			newSpendVector(timestamps, version, lockTime, sequences,
+				inputHeights, height-1,
+				comment+", last locked block"),
+			newSpendVector(timestamps, version, lockTime, sequences,
+				inputHeights, height,
+				comment+", first spendable block"),
+		}
+	}
+	return []SpendVector{
+		newSpendVector(timestamps, version, lockTime, sequences,
+			inputHeights, c.Tip()+1,
+			comment+", locked past the tip"),
+	}
+}
+
+// SpendVectors returns vectors of transactions mined at the boundaries of
+// their locks in a chain of 40 blocks, whose timestamps are off by up to
+// two hours as miners may set them: of lock-times of heights and times,
+// measured against the median time past of the block before rather than
+// its timestamp, of inputs locked by BIP 68 relative to the median time
+// past of the block before the one confirming them, and of both. They are
+// followed by count random transactions in random chains derived from a
+// math/rand source with the seed, mined at random heights.
+func SpendVectors(rngSeed int64, count int) []SpendVector {
+	rng := rand.New(rand.NewSource(rngSeed))
+	timestamps := randomTimestamps(rng, 40)
+	c := chainOf(timestamps)
+	mtp := func(height int32) uint32 {
+		mtp, _ := c.MedianTimePast(height)
+		return uint32(mtp)
+	}
+
+	const (
+		final       = wire.MaxTxInSequenceNum
+		nonFinal    = wire.MaxTxInSequenceNum - 1
+		typeFlag    = sequencelock.TypeFlag
+		disableFlag = sequencelock.DisableFlag
+	)
+	var vectors []SpendVector
+	for _, v := range []struct {
+		version      int32
+		lockTime     uint32
+		sequences    []uint32
+		inputHeights []int32
+		comment      string
+	}{
+		{1, 0, []uint32{nonFinal}, []int32{5}, "Lock-time 0"},
+		{1, 20, []uint32{nonFinal}, []int32{5},
+			"Lock-time of height 20"},
+		{1, 20, []uint32{final}, []int32{5},
+			"Lock-time of height 20, inputs final"},
+		{1, 20, []uint32{final, nonFinal}, []int32{5, 5},
+			"Lock-time of height 20, one input final"},
+		{1, mtp(20), []uint32{nonFinal}, []int32{5},
+			"Lock-time of median time past of height 20"},
+		{1, uint32(timestamps[20]), []uint32{nonFinal}, []int32{5},
+			"Lock-time of timestamp of height 20"},
+		{1, LockTimeThreshold - 1, []uint32{nonFinal}, []int32{5},
+			"Largest lock-time of a height"},
+		{1, LockTimeThreshold, []uint32{nonFinal}, []int32{5},
+			"Smallest lock-time of a time"},
+		{1, 0xffffffff, []uint32{nonFinal}, []int32{5},
+			"Largest lock-time"},
+		{2, 0, []uint32{5}, []int32{10}, "Relative lock of 5 blocks"},
+		{2, 0, []uint32{typeFlag | 2}, []int32{10},
+			"Relative lock of 1024 seconds"},
+		{2, 0, []uint32{typeFlag | 10}, []int32{10},
+			"Relative lock of 5120 seconds"},
+		{2, 0, []uint32{typeFlag | 1}, []int32{0},
+			"Relative lock of 512 seconds, genesis output"},
+		{2, 0, []uint32{1}, []int32{39},
+			"Relative lock of 1 block, output in the tip"},
+		{2, 0, []uint32{0}, []int32{40},
+			"Relative lock of 0 blocks, output in the same block"},
+		{1, 0, []uint32{typeFlag | 10}, []int32{10},
+			"Version 1, relative lock ignored"},
+		{2, 0, []uint32{disableFlag | 10}, []int32{10},
+			"Relative lock disabled"},
+		{2, 0, []uint32{5, typeFlag | 4}, []int32{10, 12},
+			"Relative locks of height and time"},
+		{2, mtp(25), []uint32{typeFlag | 2}, []int32{10},
+			"Lock-time and relative lock"},
+		{2, 30, []uint32{typeFlag | 2}, []int32{10},
+			"Lock-time of height and relative lock of time"},
+	} {
+		vectors = append(vectors, boundaryVectors(timestamps,
+			v.version, v.lockTime, v.sequences, v.inputHeights,
+			v.comment)...)
+	}
+
+	for n := 0; n < count; n++ {
+		timestamps := randomTimestamps(rng, 20+rng.Intn(21))
+		c := chainOf(timestamps)
+		tip := c.Tip()
+
+		var lockTime uint32
+		switch rng.Intn(3) {
+		case 1:
+			lockTime = uint32(rng.Intn(int(tip) + 5))
+		case 2:
+			height := int32(rng.Intn(int(tip) + 1))
+			mtp, _ := c.MedianTimePast(height)
+			lockTime = uint32(mtp + int64(rng.Intn(spacing)))
+		}
+
+		var sequences []uint32
+		var inputHeights []int32
+		height := int32(1)
+		for i := 1 + rng.Intn(3); i > 0; i-- {
+			sequence := uint32(rng.Intn(20))
+			switch rng.Intn(4) {
+			case 0:
+				sequence = typeFlag | uint32(rng.Intn(10))
+			case 1:
+				sequence = final - uint32(rng.Intn(2))
+			}
+			sequences = append(sequences, sequence)
+			inputHeight := int32(rng.Intn(int(tip) + 1))
+			inputHeights = append(inputHeights, inputHeight)
+			if inputHeight > height {
+				height = inputHeight
+			}
+		}
+		height += int32(rng.Intn(int(tip + 2 - height)))
+		version := int32(1 + rng.Intn(2))
+		vectors = append(vectors, newSpendVector(timestamps, version,
+			lockTime, sequences, inputHeights, height,
+			fmt.Sprintf("Random, version %d", version)))
+	}
+	return vectors
+}
+
+// CheckSpendVector checks the locks of the transaction of the vector in the
+// block at its height.
+func CheckSpendVector(v SpendVector) error {
+	if len(v.Sequences) != len(v.InputHeights) {
+		return fmt.Errorf("%w: %d sequences, %d input heights",
+			ErrVectorMismatch, len(v.Sequences),
+			len(v.InputHeights))
+	}
+	tx := spendTx(v.Version, v.LockTime, v.Sequences)
+	err := chainOf(v.Timestamps).CheckTx(tx, v.InputHeights, v.Height)
+	if !vectorfile.SameError(err, v.Err) {
+		return fmt.Errorf("%w: error %v, expected %v",
+			ErrVectorMismatch, err, v.Err)
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+// This program writes test vectors for the rbf package to scenarios.json:
+// mempools of transactions and replacements of those they conflict with,
+// from wallets bumping their fees by too little, just enough for their
+// bandwidth and more, to replacements of transactions signalling by any
+// input, by inheritance and not at all, of several transactions, of
+// transactions with descendants up to and past the most that can be
+// evicted, and of replacements adding inputs, followed by random
+// replacements in random mempools. The vectors depend only on -seed and
+// -count, so they can be regenerated by anyone:
+//
+//	gentestvectors -count 50 -seed 125
+//
+// The file uses the layout of the BIP 158 vectors: a JSON array whose first
+// row names the columns, followed by one row per vector. Each vector is a
+// list of transactions in hex, added to a mempool in order, their fees,
+// whether each signals replaceability, a replacement and its fee, and the
+// number of transactions it evicts and the error checking it gives, empty
+// if it replaces them. Pass -check to verify an existing file against the
+// package instead:
+//
+//	gentestvectors -check scenarios.json
+//
+// The program lives in a directory of its own since the rbf package sits
+// at the root of the module.
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/btcsuite/btcd/wire"
+	rbf "github.com/christsim/bips/bip-0125"
+	"github.com/christsim/bips/internal/vectorfile"
+)
+
+// scenarioColumns is the header row of the vector file.
+const scenarioColumns = "Txs,Fees,Signals,Replacement,Fee,Evicted,Error," +
+	"Comment"
+
+type JSONTestWriter struct {
+	writer          io.Writer
+	firstRowWritten bool
+}
+
+func NewJSONTestWriter(writer io.Writer) *JSONTestWriter {
+	return &JSONTestWriter{writer: writer}
+}
+
+func (w *JSONTestWriter) WriteComment(comment string) error {
+	return w.WriteTestCase([]interface{}{comment})
+}
+
+func (w *JSONTestWriter) WriteTestCase(row []interface{}) error {
+	var err error
+	if w.firstRowWritten {
+		_, err = io.WriteString(w.writer, ",\n")
+	} else {
+		_, err = io.WriteString(w.writer, "[\n")
+		w.firstRowWritten = true
+	}
+	if err != nil {
+		return err
+	}
+
+	rowBytes, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.writer.Write(rowBytes)
+	return err
+}
+
+func (w *JSONTestWriter) Close() error {
+	if !w.firstRowWritten {
+		return nil
+	}
+
+	_, err := io.WriteString(w.writer, "\n]\n")
+	return err
+}
+
+func main() {
+	out := flag.String("out", "scenarios.json", "file to write the "+
+		"vectors to")
+	count := flag.Int("count", 50, "number of random replacements to "+
+		"write vectors of")
+	seed := flag.Int64("seed", 125, "seed of the random vectors")
+	check := flag.String("check", "", "vector file to check instead of "+
+		"writing one")
+	flag.Parse()
+
+	var err error
+	if *check != "" {
+		err = checkFile(*check)
+	} else {
+		err = writeFile(*out, *seed, *count)
+	}
+	if err != nil {
+		fmt.Println("Error: ", err.Error())
+		os.Exit(1)
+	}
+}
+
+// writeRows writes the header and rows to a new vector file at path.
+func writeRows(path, columns string, rows [][]interface{}) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := NewJSONTestWriter(file)
+	if err := writer.WriteComment(columns); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if err := writer.WriteTestCase(row); err != nil {
+			return err
+		}
+	}
+	return writer.Close()
+}
+
+// txHex returns the serialization of the transaction in hex.
+func txHex(tx *wire.MsgTx) (string, error) {
+	var buf bytes.Buffer
+	if err := tx.Serialize(&buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf.Bytes()), nil
+}
+
+// parseTx returns the transaction of the serialization in hex.
+func parseTx(s string) (*wire.MsgTx, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	var tx wire.MsgTx
+	if err := tx.Deserialize(bytes.NewReader(b)); err != nil {
+		return nil, err
+	}
+	return &tx, nil
+}
+
+// writeFile writes the vectors, with count random ones, to out.
+func writeFile(out string, seed int64, count int) error {
+	var rows [][]interface{}
+	vectors := rbf.ScenarioVectors(seed, count)
+	for _, v := range vectors {
+		txs := make([]string, len(v.Txs))
+		for i, tx := range v.Txs {
+			var err error
+			if txs[i], err = txHex(tx); err != nil {
+				return err
+			}
+		}
+		replacement, err := txHex(v.Replacement)
+		if err != nil {
+			return err
+		}
+		rows = append(rows, []interface{}{
+			txs,
+			v.Fees,
+			v.Signals,
+			replacement,
+			v.Fee,
+			v.Evicted,
+			vectorfile.ErrorString(v.Err),
+			v.Comment,
+		})
+	}
+	if err := writeRows(out, scenarioColumns, rows); err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote %d vectors\n", len(vectors))
+	return nil
+}
+
+// checkFile checks each vector of the file with rbf.CheckScenarioVector.
+func checkFile(path string) error {
+	rows, err := vectorfile.ReadRows(path, 8)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		var v rbf.ScenarioVector
+		var txs []string
+		var replacement, errMsg string
+		err := vectorfile.DecodeRow(row, &txs, &v.Fees, &v.Signals,
+			&replacement, &v.Fee, &v.Evicted, &errMsg, &v.Comment)
+		if err != nil {
+			return err
+		}
+		for _, s := range txs {
+			tx, err := parseTx(s)
+			if err != nil {
+				return fmt.Errorf("%v: %v", v.Comment, err)
+			}
+			v.Txs = append(v.Txs, tx)
+		}
+		v.Replacement, err = parseTx(replacement)
+		if err != nil {
+			return fmt.Errorf("%v: %v", v.Comment, err)
+		}
+		v.Err = vectorfile.ParseError(errMsg)
+		if err := rbf.CheckScenarioVector(v); err != nil {
+			return fmt.Errorf("%v: %v", v.Comment, err)
+		}
+	}
+	fmt.Printf("%d vectors OK\n", len(rows))
+	return nil
+}
@@ -0,0 +1,359 @@
+// Package rbf implements the opt-in replace-by-fee policy of BIP 125: which
+// transactions of a mempool signal that they can be replaced, and the rules
+// a transaction must follow to replace those it conflicts with:
+//
+//	pool := rbf.NewMempool()
+//	err := pool.Add(tx, fee)
+//	err = pool.CheckReplacement(bump, bumpFee)
+//
+// A transaction signals replaceability explicitly by an input of a
+// sequence number up to MaxSignalSequence, 0xfffffffd, and inherits it from
+// any unconfirmed ancestor that does. The final sequence number, and the one
+// below it, which wallets use to enable the lock-time, don't signal.
+//
+// A replacement conflicts with the transactions of the mempool that spend
+// an output it spends, the originals, and evicts them along with their
+// descendants. It must follow the five rules of BIP 125, checked in order:
+//
+//  1. The originals signal replaceability, explicitly or by inheritance.
+//  2. It spends no unconfirmed output of a transaction the originals don't
+//     spend outputs of.
+//  3. It pays a fee of at least the sum of those of the evicted
+//     transactions.
+//  4. It pays for its own bandwidth on top of that, at the incremental
+//     relay fee rate.
+//  5. It evicts no more than MaxEvicted transactions.
+//
+// Outputs of transactions that aren't in the mempool are taken to be
+// confirmed. Sizes are virtual sizes, a quarter of the weight of BIP 141,
+// which are the sizes of transactions without witnesses.
+package rbf
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+const (
+	// MaxSignalSequence is the highest sequence number of an input that
+	// signals replaceability.
+	MaxSignalSequence = wire.MaxTxInSequenceNum - 2
+
+	// IncrementalRelayFee is the fee rate, in satoshis per 1000 virtual
+	// bytes, a replacement pays for its own bandwidth.
+	IncrementalRelayFee = 1000
+
+	// MaxEvicted is the largest number of transactions a replacement can
+	// evict, the originals and their descendants.
+	MaxEvicted = 100
+)
+
+var (
+	// ErrInMempool is returned by Add for a transaction already in the
+	// mempool.
+	ErrInMempool = errors.New("rbf: transaction already in mempool")
+
+	// ErrConflict is returned by Add for a transaction spending an output
+	// a transaction of the mempool spends.
+	ErrConflict = errors.New("rbf: transaction conflicts with mempool")
+
+	// ErrNoConflicts is returned for a replacement that conflicts with no
+	// transaction of the mempool.
+	ErrNoConflicts = errors.New("rbf: replacement has no conflicts")
+
+	// ErrNotReplaceable is returned for an original that doesn't signal
+	// replaceability, breaking rule 1.
+	ErrNotReplaceable = errors.New("rbf: original not replaceable")
+
+	// ErrNewUnconfirmedInput is returned for a replacement spending an
+	// unconfirmed output of a transaction the originals don't spend
+	// outputs of, breaking rule 2.
+	ErrNewUnconfirmedInput = errors.New("rbf: replacement has a new " +
+		"unconfirmed input")
+
+	// ErrInsufficientFee is returned for a replacement paying less than
+	// the evicted transactions, breaking rule 3.
+	ErrInsufficientFee = errors.New("rbf: replacement fee below that of " +
+		"the evicted transactions")
+
+	// ErrInsufficientBandwidthFee is returned for a replacement that
+	// doesn't pay for its own bandwidth, breaking rule 4.
+	ErrInsufficientBandwidthFee = errors.New("rbf: replacement doesn't " +
+		"pay for its bandwidth")
+
+	// ErrTooManyEvicted is returned for a replacement evicting more than
+	// MaxEvicted transactions, breaking rule 5.
+	ErrTooManyEvicted = errors.New("rbf: replacement evicts too many " +
+		"transactions")
+)
+
+// SignalsDirectly reports whether an input of the transaction has a
+// sequence number that signals replaceability.
+func SignalsDirectly(tx *wire.MsgTx) bool {
+	for _, txIn := range tx.TxIn {
+		if txIn.Sequence <= MaxSignalSequence {
+			return true
+		}
+	}
+	return false
+}
+
+// VirtualSize returns the virtual size of the transaction.
+func VirtualSize(tx *wire.MsgTx) int64 {
+	weight := blockchain.GetTransactionWeight(btcutil.NewTx(tx))
+	return (weight + blockchain.WitnessScaleFactor - 1) /
+		blockchain.WitnessScaleFactor
+}
+
+// BandwidthFee returns the fee a replacement of the virtual size pays for
+// its own bandwidth.
+func BandwidthFee(vsize int64) int64 {
+	return vsize * IncrementalRelayFee / 1000
+}
+
+// Entry is a transaction of the mempool and the fee it pays.
+type Entry struct {
+	Tx  *wire.MsgTx
+	Fee int64
+
+	txid chainhash.Hash
+}
+
+// Txid returns the txid of the transaction of the entry.
+func (e *Entry) Txid() chainhash.Hash {
+	return e.txid
+}
+
+// Mempool is a set of unconfirmed transactions without conflicts, their
+// inputs spending confirmed outputs or those of the transactions before.
+type Mempool struct {
+	entries map[chainhash.Hash]*Entry
+	spends  map[wire.OutPoint]*Entry
+}
+
+// NewMempool returns an empty mempool.
+func NewMempool() *Mempool {
+	return &Mempool{
+		entries: make(map[chainhash.Hash]*Entry),
+		spends:  make(map[wire.OutPoint]*Entry),
+	}
+}
+
+// Len returns the number of transactions of the mempool.
+func (m *Mempool) Len() int {
+	return len(m.entries)
+}
+
+// Entry returns the entry of the transaction of the txid, nil if it isn't
+// in the mempool.
+func (m *Mempool) Entry(txid chainhash.Hash) *Entry {
+	return m.entries[txid]
+}
+
+// Add adds the transaction, paying the fee, to the mempool.
+func (m *Mempool) Add(tx *wire.MsgTx, fee int64) error {
+	txid := tx.TxHash()
+	if _, ok := m.entries[txid]; ok {
+		return fmt.Errorf("%w: %v", ErrInMempool, txid)
+	}
+	for _, txIn := range tx.TxIn {
+		if e, ok := m.spends[txIn.PreviousOutPoint]; ok {
+			return fmt.Errorf("%w: %v spent by %v", ErrConflict,
+				txIn.PreviousOutPoint, e.txid)
+		}
+	}
+
+	e := &Entry{Tx: tx, Fee: fee, txid: txid}
+	m.entries[txid] = e
+	for _, txIn := range tx.TxIn {
+		m.spends[txIn.PreviousOutPoint] = e
+	}
+	return nil
+}
+
+// remove removes the entry from the mempool.
+func (m *Mempool) remove(e *Entry) {
+	delete(m.entries, e.txid)
+	for _, txIn := range e.Tx.TxIn {
+		delete(m.spends, txIn.PreviousOutPoint)
+	}
+}
+
+// parents returns the entries of the mempool whose outputs the transaction
+// spends.
+func (m *Mempool) parents(tx *wire.MsgTx) []*Entry {
+	var parents []*Entry
+	seen := make(map[chainhash.Hash]bool)
+	for _, txIn := range tx.TxIn {
+		hash := txIn.PreviousOutPoint.Hash
+		if e, ok := m.entries[hash]; ok && !seen[hash] {
+			seen[hash] = true
+			parents = append(parents, e)
+		}
+	}
+	return parents
+}
+
+// Signals reports whether the transaction signals replaceability, directly
+// or by inheriting it from an ancestor in the mempool.
+func (m *Mempool) Signals(tx *wire.MsgTx) bool {
+	seen := make(map[chainhash.Hash]bool)
+	queue := []*wire.MsgTx{tx}
+	for len(queue) > 0 {
+		tx, queue = queue[0], queue[1:]
+		if SignalsDirectly(tx) {
+			return true
+		}
+		for _, parent := range m.parents(tx) {
+			if !seen[parent.txid] {
+				seen[parent.txid] = true
+				queue = append(queue, parent.Tx)
+			}
+		}
+	}
+	return false
+}
+
+// Conflicts returns the entries of the mempool spending an output the
+// transaction spends, ordered by txid.
+func (m *Mempool) Conflicts(tx *wire.MsgTx) []*Entry {
+	seen := make(map[chainhash.Hash]bool)
+	var conflicts []*Entry
+	for _, txIn := range tx.TxIn {
+		e, ok := m.spends[txIn.PreviousOutPoint]
+		if ok && !seen[e.txid] {
+			seen[e.txid] = true
+			conflicts = append(conflicts, e)
+		}
+	}
+	sortEntries(conflicts)
+	return conflicts
+}
+
+// Evicted returns the entries a transaction conflicting with the originals
+// evicts, the originals and their descendants, ordered by txid.
+func (m *Mempool) Evicted(originals []*Entry) []*Entry {
+	seen := make(map[chainhash.Hash]bool)
+	var evicted []*Entry
+	queue := append([]*Entry{}, originals...)
+	for len(queue) > 0 {
+		e := queue[0]
+		queue = queue[1:]
+		if seen[e.txid] {
+			continue
+		}
+		seen[e.txid] = true
+		evicted = append(evicted, e)
+
+		for i := range e.Tx.TxOut {
+			op := wire.OutPoint{Hash: e.txid, Index: uint32(i)}
+			if child, ok := m.spends[op]; ok {
+				queue = append(queue, child)
+			}
+		}
+	}
+	sortEntries(evicted)
+	return evicted
+}
+
+// sortEntries sorts the entries by txid, so that results don't depend on
+// the order of maps.
+func sortEntries(entries []*Entry) {
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i].txid, entries[j].txid
+		for k := chainhash.HashSize - 1; k >= 0; k-- {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return false
+	})
+}
+
+// CheckReplacement checks that the transaction, paying the fee, can replace
+// the transactions of the mempool it conflicts with, following the rules in
+// order.
+func (m *Mempool) CheckReplacement(tx *wire.MsgTx, fee int64) error {
+	_, err := m.checkReplacement(tx, fee)
+	return err
+}
+
+// checkReplacement checks the replacement, returning the entries it evicts.
+func (m *Mempool) checkReplacement(tx *wire.MsgTx, fee int64) ([]*Entry,
+	error) {
+
+	originals := m.Conflicts(tx)
+	if len(originals) == 0 {
+		return nil, fmt.Errorf("%w: %v", ErrNoConflicts, tx.TxHash())
+	}
+
+	// Rule 1.
+	for _, e := range originals {
+		if !m.Signals(e.Tx) {
+			return nil, fmt.Errorf("%w: %v", ErrNotReplaceable,
+				e.txid)
+		}
+	}
+
+	// Rule 2.
+	spent := make(map[chainhash.Hash]bool)
+	for _, e := range originals {
+		for _, txIn := range e.Tx.TxIn {
+			spent[txIn.PreviousOutPoint.Hash] = true
+		}
+	}
+	for _, txIn := range tx.TxIn {
+		op := txIn.PreviousOutPoint
+		if _, ok := m.entries[op.Hash]; ok && !spent[op.Hash] {
+			return nil, fmt.Errorf("%w: %v", ErrNewUnconfirmedInput,
+				op)
+		}
+	}
+
+	// Rule 3.
+	evicted := m.Evicted(originals)
+	var evictedFee int64
+	for _, e := range evicted {
+		evictedFee += e.Fee
+	}
+	if fee < evictedFee {
+		return nil, fmt.Errorf("%w: %d, evicted transactions pay %d",
+			ErrInsufficientFee, fee, evictedFee)
+	}
+
+	// Rule 4.
+	vsize := VirtualSize(tx)
+	if fee-evictedFee < BandwidthFee(vsize) {
+		return nil, fmt.Errorf("%w: %d more than the evicted "+
+			"transactions, %d needed for %d vbytes",
+			ErrInsufficientBandwidthFee, fee-evictedFee,
+			BandwidthFee(vsize), vsize)
+	}
+
+	// Rule 5.
+	if len(evicted) > MaxEvicted {
+		return nil, fmt.Errorf("%w: %d", ErrTooManyEvicted,
+			len(evicted))
+	}
+	return evicted, nil
+}
+
+// Replace checks that the transaction, paying the fee, can replace the
+// transactions of the mempool it conflicts with, and replaces them and
+// their descendants with it, returning the entries it evicted.
+func (m *Mempool) Replace(tx *wire.MsgTx, fee int64) ([]*Entry, error) {
+	evicted, err := m.checkReplacement(tx, fee)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range evicted {
+		m.remove(e)
+	}
+	return evicted, m.Add(tx, fee)
+}
@@ -0,0 +1,314 @@
+package rbf
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/christsim/bips/internal/vectorfile"
+)
+
+// ErrVectorMismatch is returned by CheckScenarioVector when replaying a
+// vector doesn't give the expected result.
+var ErrVectorMismatch = errors.New("rbf: vector mismatch")
+
+// ScenarioVector is a mempool of transactions, added in order, paying the
+// fees, whether each signals replaceability, and a replacement paying the
+// fee, with the number of transactions it evicts and the error checking it
+// gives, nil if it replaces them.
+type ScenarioVector struct {
+	Txs     []*wire.MsgTx
+	Fees    []int64
+	Signals []bool
+
+	Replacement *wire.MsgTx
+	Fee         int64
+	Evicted     int
+
+	Err error
+
+	// Comment describes what the vector exercises.
+	Comment string
+}
+
+// replay adds the transactions of the vector to a new mempool and returns
+// whether each signals replaceability, and the entries the replacement
+// evicts and the error replacing them gives.
+func replay(txs []*wire.MsgTx, fees []int64, replacement *wire.MsgTx,
+	fee int64) ([]bool, []*Entry, error) {
+
+	pool := NewMempool()
+	signals := make([]bool, len(txs))
+	for i, tx := range txs {
+		if err := pool.Add(tx, fees[i]); err != nil {
+			return nil, nil, err
+		}
+	}
+	for i, tx := range txs {
+		signals[i] = pool.Signals(tx)
+	}
+	evicted, err := pool.Replace(replacement, fee)
+	return signals, evicted, err
+}
+
+// newScenarioVector returns the vector of the mempool and replacement.
+func newScenarioVector(txs []*wire.MsgTx, fees []int64,
+	replacement *wire.MsgTx, fee int64, comment string) ScenarioVector {
+
+	signals, evicted, err := replay(txs, fees, replacement, fee)
+	if signals == nil {
+		panic(err)
+	}
+	return ScenarioVector{
+		Txs:         txs,
+		Fees:        fees,
+		Signals:     signals,
+		Replacement: replacement,
+		Fee:         fee,
+		Evicted:     len(evicted),
+		Err:         err,
+		Comment:     comment,
+	}
+}
+
+// inputValue is the value of the confirmed outputs the vectors spend.
+const inputValue = 100000
+
+// payScript is the output script the transactions of the vectors pay to.
+var payScript = append([]byte{txscript.OP_0, txscript.OP_DATA_20},
+	make([]byte, 20)...)
+
+// confirmed returns the nth confirmed output the vectors spend.
+func confirmed(n int) wire.OutPoint {
+	hash := chainhash.HashH([]byte(fmt.Sprintf("confirmed %d", n)))
+	return wire.OutPoint{Hash: hash}
+}
+
+// out returns the output of the transaction at the index.
+func out(tx *wire.MsgTx, index uint32) wire.OutPoint {
+	return wire.OutPoint{Hash: tx.TxHash(), Index: index}
+}
+
+// newTx returns a transaction spending the outputs with inputs of the
+// sequence number, to n outputs.
+func newTx(sequence uint32, n int, prevOuts ...wire.OutPoint) *wire.MsgTx {
+	tx := wire.NewMsgTx(2)
+	for i := range prevOuts {
+		txIn := wire.NewTxIn(&prevOuts[i], nil, nil)
+		txIn.Sequence = sequence
+		tx.AddTxIn(txIn)
+	}
+	for i := 0; i < n; i++ {
+		tx.AddTxOut(wire.NewTxOut(inputValue/int64(n+1), payScript))
+	}
+	return tx
+}
+
+// bump returns a replacement spending the outputs, which differs from the
+// transactions of the mempool spending them by its lock-time, as a wallet
+// bumping the fee with a new lock-time would.
+func bump(prevOuts ...wire.OutPoint) *wire.MsgTx {
+	tx := newTx(MaxSignalSequence, 1, prevOuts...)
+	tx.LockTime = 1
+	return tx
+}
+
+// ScenarioVectors returns vectors of wallets bumping the fees of their
+// transactions, by too little, just enough for their bandwidth and more,
+// and replacing transactions of every sequence number, signalling by an
+// input of several, by inheritance from parents and grandparents in the
+// mempool and not at all. They are followed by replacements of several
+// transactions, of transactions with descendants, up to and past the most
+// that can be evicted, and replacements adding inputs, confirmed and not,
+// and by count random replacements in random mempools, derived from a
+// math/rand source with the seed.
+func ScenarioVectors(rngSeed int64, count int) []ScenarioVector {
+	const fee = 1000
+	signal := uint32(MaxSignalSequence)
+	final := uint32(wire.MaxTxInSequenceNum)
+	lockTime := uint32(wire.MaxTxInSequenceNum - 1)
+	c0, c1, c2 := confirmed(0), confirmed(1), confirmed(2)
+	vsize := VirtualSize(bump(c0))
+	vsize2 := VirtualSize(bump(c0, c1))
+
+	a := newTx(signal, 1, c0)
+	b := newTx(signal, 1, c1)
+	fees := func(n int) []int64 {
+		fees := make([]int64, n)
+		for i := range fees {
+			fees[i] = fee
+		}
+		return fees
+	}
+	single := func(tx *wire.MsgTx, bumpFee int64,
+		comment string) ScenarioVector {
+
+		return newScenarioVector([]*wire.MsgTx{tx}, fees(1), bump(c0),
+			bumpFee, comment)
+	}
+
+	vectors := []ScenarioVector{
+		single(a, 2*fee+vsize, "Fee bump"),
+		single(a, fee+vsize, "Fee bump paying just for its bandwidth"),
+		single(a, fee+vsize-1, "Fee bump a satoshi short of its "+
+			"bandwidth"),
+		single(a, fee, "Fee bump of the same fee"),
+		single(a, fee-1, "Fee bump of a lower fee"),
+		single(newTx(0, 1, c0), 2*fee, "Original of sequence 0"),
+		single(newTx(final, 1, c0), 2*fee, "Original of the final "+
+			"sequence"),
+		single(newTx(lockTime, 1, c0), 2*fee, "Original enabling "+
+			"its lock-time"),
+	}
+
+	mixed := newTx(final, 1, c0, c1)
+	mixed.TxIn[1].Sequence = signal
+	vectors = append(vectors, newScenarioVector([]*wire.MsgTx{mixed},
+		fees(1), bump(c0), 2*fee, "Original signalling by its second "+
+			"input"))
+
+	// Signalling inherited from ancestors, or not.
+	parent := newTx(signal, 1, c1)
+	child := newTx(final, 1, out(parent, 0))
+	finalParent := newTx(final, 1, c1)
+	finalChild := newTx(final, 1, out(finalParent, 0))
+	grandchild := newTx(final, 1, out(finalChild, 0))
+	heir := newTx(final, 1, out(child, 0))
+	vectors = append(vectors,
+		newScenarioVector([]*wire.MsgTx{parent, child}, fees(2),
+			bump(out(parent, 0)), 2*fee,
+			"Original inheriting signalling from its parent"),
+		newScenarioVector([]*wire.MsgTx{parent, child, heir},
+			fees(3), bump(out(child, 0)), 2*fee,
+			"Original inheriting signalling from its grandparent"),
+		newScenarioVector([]*wire.MsgTx{finalParent, finalChild},
+			fees(2), bump(out(finalParent, 0)), 2*fee,
+			"Original and parent not signalling"),
+		newScenarioVector([]*wire.MsgTx{child}, fees(1),
+			bump(out(parent, 0)), 2*fee,
+			"Original of a confirmed parent signalling"),
+		newScenarioVector([]*wire.MsgTx{parent, child}, fees(2),
+			bump(c1), 2*fee+vsize, "Original with a child"),
+		newScenarioVector([]*wire.MsgTx{parent, child}, fees(2),
+			bump(c1), 2*fee-1,
+			"Original with a child, fee short of the child's"),
+		newScenarioVector(
+			[]*wire.MsgTx{finalParent, finalChild, grandchild},
+			fees(3), bump(out(finalChild, 0)), 2*fee,
+			"Original, parent and grandparent not signalling"),
+	)
+
+	// Several originals, and inputs they don't have.
+	other := newTx(signal, 1, c2)
+	vectors = append(vectors,
+		newScenarioVector([]*wire.MsgTx{a, b}, fees(2), bump(c0, c1),
+			2*fee+vsize2, "Two originals"),
+		newScenarioVector([]*wire.MsgTx{a, b}, fees(2), bump(c0, c1),
+			2*fee-1, "Two originals, fee short of both"),
+		newScenarioVector([]*wire.MsgTx{a, newTx(final, 1, c1)},
+			fees(2), bump(c0, c1), 2*fee+vsize2,
+			"Two originals, one not signalling"),
+		newScenarioVector([]*wire.MsgTx{a}, fees(1), bump(c0, c2),
+			2*fee+vsize2, "New confirmed input"),
+		newScenarioVector([]*wire.MsgTx{a, other}, fees(2),
+			bump(c0, out(other, 0)), 2*fee+vsize2,
+			"New unconfirmed input"),
+		newScenarioVector([]*wire.MsgTx{a}, fees(1),
+			bump(c0, out(a, 0)), 2*fee+vsize2,
+			"Input spending the original"),
+		newScenarioVector([]*wire.MsgTx{parent, child}, fees(2),
+			bump(out(parent, 0)), fee+vsize,
+			"Unconfirmed input of the original"),
+		newScenarioVector([]*wire.MsgTx{a}, fees(1), bump(c2), 2*fee,
+			"No conflicts"),
+	)
+
+	// Originals with descendants up to and past MaxEvicted.
+	for _, n := range []int{MaxEvicted - 1, MaxEvicted} {
+		fan := newTx(signal, n, c0)
+		txs := []*wire.MsgTx{fan}
+		for i := 0; i < n; i++ {
+			txs = append(txs, newTx(final, 1, out(fan, uint32(i))))
+		}
+		vectors = append(vectors, newScenarioVector(txs, fees(n+1),
+			bump(c0), int64(n+1)*fee+vsize,
+			fmt.Sprintf("Original with %d children", n)))
+	}
+
+	rng := rand.New(rand.NewSource(rngSeed))
+	sequences := []uint32{0, signal, lockTime, final}
+	for n := 0; n < count; n++ {
+		var txs []*wire.MsgTx
+		var txFees []int64
+		var spent, unspent []wire.OutPoint
+		next := 0
+		for i, length := 0, 1+rng.Intn(8); i < length; i++ {
+			var prevOuts []wire.OutPoint
+			for j, inputs := 0, 1+rng.Intn(2); j < inputs; j++ {
+				if len(unspent) > 0 && rng.Intn(2) == 0 {
+					k := rng.Intn(len(unspent))
+					prevOuts = append(prevOuts, unspent[k])
+					unspent = append(unspent[:k],
+						unspent[k+1:]...)
+				} else {
+					prevOuts = append(prevOuts,
+						confirmed(next))
+					next++
+				}
+			}
+			sequence := sequences[rng.Intn(len(sequences))]
+			tx := newTx(sequence, 1+rng.Intn(2), prevOuts...)
+			for j := range tx.TxOut {
+				unspent = append(unspent, out(tx, uint32(j)))
+			}
+			spent = append(spent, prevOuts...)
+			txs = append(txs, tx)
+			txFees = append(txFees, int64(500+rng.Intn(1500)))
+		}
+
+		prevOuts := []wire.OutPoint{spent[rng.Intn(len(spent))]}
+		switch rng.Intn(3) {
+		case 0:
+			prevOuts = append(prevOuts, confirmed(next))
+		case 1:
+			prevOuts = append(prevOuts,
+				unspent[rng.Intn(len(unspent))])
+		}
+		vectors = append(vectors, newScenarioVector(txs, txFees,
+			bump(prevOuts...), int64(rng.Intn(10000)), "Random"))
+	}
+	return vectors
+}
+
+// CheckScenarioVector adds the transactions of the vector to a new mempool,
+// which must signal replaceability as expected, and replaces those the
+// replacement conflicts with, which must evict the expected number of
+// transactions or fail with the expected error.
+func CheckScenarioVector(v ScenarioVector) error {
+	if len(v.Fees) != len(v.Txs) {
+		return fmt.Errorf("%w: %d fees of %d transactions",
+			ErrVectorMismatch, len(v.Fees), len(v.Txs))
+	}
+	signals, evicted, err := replay(v.Txs, v.Fees, v.Replacement, v.Fee)
+	if signals == nil {
+		return err
+	}
+	for i := range signals {
+		if i >= len(v.Signals) || signals[i] != v.Signals[i] {
+			return fmt.Errorf("%w: signalling %v, expected %v",
+				ErrVectorMismatch, signals, v.Signals)
+		}
+	}
+	if !vectorfile.SameError(err, v.Err) {
+		return fmt.Errorf("%w: error %v, expected %v",
+			ErrVectorMismatch, err, v.Err)
+	}
+	if len(evicted) != v.Evicted {
+		return fmt.Errorf("%w: %d evicted, expected %d",
+			ErrVectorMismatch, len(evicted), v.Evicted)
+	}
+	return nil
+}
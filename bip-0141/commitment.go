@@ -0,0 +1,223 @@
+// Package segwit implements the witness commitment of BIP 141: the hash of
+// the witness merkle root of a block and a reserved value, which the
+// coinbase transaction commits to in an OP_RETURN output while the reserved
+// value sits in its witness.
+//
+//	err := segwit.AddCommitment(block, reserved)
+//	err = segwit.CheckBlock(block)
+//
+// The functions of btcd blocks build on ones taking the transactions'
+// wtxids and the coinbase's output scripts and witness, so that blocks of
+// other implementations can be checked without converting them.
+package segwit
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+// HashSize is the size of wtxids, merkle roots and the reserved value.
+const HashSize = sha256.Size
+
+// CommitmentHeader starts the output script of a witness commitment: an
+// OP_RETURN pushing 36 bytes that start with 0xaa21a9ed.
+var CommitmentHeader = []byte{0x6a, 0x24, 0xaa, 0x21, 0xa9, 0xed}
+
+// MinCommitmentSize is the size of the smallest output script that is a
+// witness commitment: the header and the commitment. Anything after the
+// commitment is ignored.
+const MinCommitmentSize = 38
+
+var (
+	// ErrNoCoinbase is returned by CheckBlock for a block without
+	// transactions, or whose first transaction has no inputs.
+	ErrNoCoinbase = errors.New("segwit: block has no coinbase")
+
+	// ErrUnexpectedWitness is returned for a block without a witness
+	// commitment whose transactions have witnesses.
+	ErrUnexpectedWitness = errors.New("segwit: witness data without a " +
+		"commitment")
+
+	// ErrReservedValue is returned when the coinbase witness of a block
+	// with a witness commitment isn't a single 32 byte reserved value.
+	ErrReservedValue = errors.New("segwit: coinbase witness isn't a " +
+		"reserved value")
+
+	// ErrCommitmentMismatch is returned when the witness commitment isn't
+	// the hash of the witness merkle root and the reserved value.
+	ErrCommitmentMismatch = errors.New("segwit: witness commitment " +
+		"mismatch")
+)
+
+// doubleHash returns the SHA256 of the SHA256 of b.
+func doubleHash(b []byte) [HashSize]byte {
+	hash := sha256.Sum256(b)
+	return sha256.Sum256(hash[:])
+}
+
+// WitnessRoot returns the witness merkle root of the wtxids of a block's
+// transactions, in order. The wtxid of the coinbase, which can't commit to
+// itself, is taken as zero whatever the first one is.
+func WitnessRoot(wtxids [][HashSize]byte) [HashSize]byte {
+	if len(wtxids) == 0 {
+		return [HashSize]byte{}
+	}
+	hashes := make([][HashSize]byte, len(wtxids))
+	copy(hashes[1:], wtxids[1:])
+
+	var buf [2 * HashSize]byte
+	for len(hashes) > 1 {
+		if len(hashes)%2 == 1 {
+			hashes = append(hashes, hashes[len(hashes)-1])
+		}
+		for i := 0; i < len(hashes)/2; i++ {
+			copy(buf[:], hashes[2*i][:])
+			copy(buf[HashSize:], hashes[2*i+1][:])
+			hashes[i] = doubleHash(buf[:])
+		}
+		hashes = hashes[:len(hashes)/2]
+	}
+	return hashes[0]
+}
+
+// Commitment returns the witness commitment of the witness merkle root and
+// the reserved value.
+func Commitment(witnessRoot, reserved [HashSize]byte) [HashSize]byte {
+	var buf [2 * HashSize]byte
+	copy(buf[:], witnessRoot[:])
+	copy(buf[HashSize:], reserved[:])
+	return doubleHash(buf[:])
+}
+
+// CommitmentScript returns the output script of the witness commitment.
+func CommitmentScript(commitment [HashSize]byte) []byte {
+	script := append([]byte(nil), CommitmentHeader...)
+	return append(script, commitment[:]...)
+}
+
+// IsCommitment reports whether the output script is a witness commitment.
+func IsCommitment(pkScript []byte) bool {
+	return len(pkScript) >= MinCommitmentSize &&
+		bytes.HasPrefix(pkScript, CommitmentHeader)
+}
+
+// CommitmentIndex returns the index of the coinbase output, given the
+// output scripts, that holds the witness commitment: the last that is one,
+// so that miners can append a commitment to a coinbase that has one. It
+// returns -1 if there is none.
+func CommitmentIndex(pkScripts [][]byte) int {
+	for i := len(pkScripts) - 1; i >= 0; i-- {
+		if IsCommitment(pkScripts[i]) {
+			return i
+		}
+	}
+	return -1
+}
+
+// CheckCommitment checks the witness commitment of a block, given the
+// wtxids of its transactions, the output scripts and witness of its
+// coinbase, and whether any of its transactions has a witness. A block
+// without a commitment must have no witnesses. Otherwise the coinbase
+// witness must be the reserved value, which the commitment hashes with the
+// witness merkle root.
+func CheckCommitment(wtxids [][HashSize]byte, pkScripts [][]byte,
+	coinbaseWitness [][]byte, hasWitness bool) error {
+
+	i := CommitmentIndex(pkScripts)
+	if i < 0 {
+		if hasWitness {
+			return ErrUnexpectedWitness
+		}
+		return nil
+	}
+
+	if len(coinbaseWitness) != 1 || len(coinbaseWitness[0]) != HashSize {
+		return fmt.Errorf("%w: %d items", ErrReservedValue,
+			len(coinbaseWitness))
+	}
+	var reserved [HashSize]byte
+	copy(reserved[:], coinbaseWitness[0])
+	commitment := Commitment(WitnessRoot(wtxids), reserved)
+	committed := pkScripts[i][len(CommitmentHeader):MinCommitmentSize]
+	if !bytes.Equal(committed, commitment[:]) {
+		return fmt.Errorf("%w: output %d commits to %x, expected %x",
+			ErrCommitmentMismatch, i, committed, commitment)
+	}
+	return nil
+}
+
+// blockWtxids returns the wtxids of the block's transactions, and whether
+// any of them has a witness.
+func blockWtxids(block *wire.MsgBlock) ([][HashSize]byte, bool) {
+	wtxids := make([][HashSize]byte, len(block.Transactions))
+	hasWitness := false
+	for i, tx := range block.Transactions {
+		wtxids[i] = tx.WitnessHash()
+		hasWitness = hasWitness || tx.HasWitness()
+	}
+	return wtxids, hasWitness
+}
+
+// coinbase returns the coinbase transaction of the block.
+func coinbase(block *wire.MsgBlock) (*wire.MsgTx, error) {
+	if len(block.Transactions) == 0 ||
+		len(block.Transactions[0].TxIn) == 0 {
+
+		return nil, ErrNoCoinbase
+	}
+	return block.Transactions[0], nil
+}
+
+// outputScripts returns the output scripts of the transaction.
+func outputScripts(tx *wire.MsgTx) [][]byte {
+	pkScripts := make([][]byte, len(tx.TxOut))
+	for i, txOut := range tx.TxOut {
+		pkScripts[i] = txOut.PkScript
+	}
+	return pkScripts
+}
+
+// BlockWitnessRoot returns the witness merkle root of the block.
+func BlockWitnessRoot(block *wire.MsgBlock) [HashSize]byte {
+	wtxids, _ := blockWtxids(block)
+	return WitnessRoot(wtxids)
+}
+
+// AddCommitment commits the block to its witnesses: it sets the coinbase
+// witness to the reserved value, and appends the output of the witness
+// commitment to the coinbase, or replaces the commitment of the last output
+// that is one. The coinbase changes, so the merkle root of the block's
+// header must be updated afterwards. It fails with ErrNoCoinbase for a
+// block without a coinbase.
+func AddCommitment(block *wire.MsgBlock, reserved [HashSize]byte) error {
+	cb, err := coinbase(block)
+	if err != nil {
+		return err
+	}
+	cb.TxIn[0].Witness = wire.TxWitness{reserved[:]}
+	commitment := Commitment(BlockWitnessRoot(block), reserved)
+	script := CommitmentScript(commitment)
+
+	if i := CommitmentIndex(outputScripts(cb)); i >= 0 {
+		cb.TxOut[i].PkScript = script
+		return nil
+	}
+	cb.AddTxOut(wire.NewTxOut(0, script))
+	return nil
+}
+
+// CheckBlock checks the witness commitment of the block with
+// CheckCommitment.
+func CheckBlock(block *wire.MsgBlock) error {
+	cb, err := coinbase(block)
+	if err != nil {
+		return err
+	}
+	wtxids, hasWitness := blockWtxids(block)
+	return CheckCommitment(wtxids, outputScripts(cb), cb.TxIn[0].Witness,
+		hasWitness)
+}
@@ -0,0 +1,155 @@
+// This program writes test vectors for the segwit package to
+// commitments.json: random blocks with and without witnesses, each with its
+// witness commitment and with the commitment absent or malformed in the ways
+// BIP 141 rules out or allows. The random vectors depend only on -seed and
+// -count, so they can be regenerated by anyone:
+//
+//	gentestvectors -count 20 -seed 141
+//
+// The file uses the layout of the BIP 158 vectors: a JSON array whose first
+// row names the columns, followed by one row per vector. Blocks, which have
+// witnesses, and witness merkle roots are in hex, and the Error column gives
+// the error checking the block's commitment fails with, or is empty. Pass
+// -check to verify an existing file against the package instead:
+//
+//	gentestvectors -check commitments.json
+//
+// The program lives in a directory of its own since the segwit package sits
+// at the root of the module.
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	segwit "github.com/christsim/bips/bip-0141"
+	"github.com/christsim/bips/internal/vectorfile"
+)
+
+// vectorColumns is the header row of the vector file.
+const vectorColumns = "Block,WitnessRoot,Error,Comment"
+
+type JSONTestWriter struct {
+	writer          io.Writer
+	firstRowWritten bool
+}
+
+func NewJSONTestWriter(writer io.Writer) *JSONTestWriter {
+	return &JSONTestWriter{writer: writer}
+}
+
+func (w *JSONTestWriter) WriteComment(comment string) error {
+	return w.WriteTestCase([]interface{}{comment})
+}
+
+func (w *JSONTestWriter) WriteTestCase(row []interface{}) error {
+	var err error
+	if w.firstRowWritten {
+		_, err = io.WriteString(w.writer, ",\n")
+	} else {
+		_, err = io.WriteString(w.writer, "[\n")
+		w.firstRowWritten = true
+	}
+	if err != nil {
+		return err
+	}
+
+	rowBytes, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.writer.Write(rowBytes)
+	return err
+}
+
+func (w *JSONTestWriter) Close() error {
+	if !w.firstRowWritten {
+		return nil
+	}
+
+	_, err := io.WriteString(w.writer, "\n]\n")
+	return err
+}
+
+func main() {
+	out := flag.String("out", "commitments.json", "file to write the "+
+		"vectors to")
+	count := flag.Int("count", 20, "number of random blocks to write "+
+		"vectors of")
+	seed := flag.Int64("seed", 141, "seed of the random vectors")
+	check := flag.String("check", "", "vector file to check instead of "+
+		"writing one")
+	flag.Parse()
+
+	var err error
+	if *check != "" {
+		err = checkFile(*check)
+	} else {
+		err = writeFile(*out, *seed, *count)
+	}
+	if err != nil {
+		fmt.Println("Error: ", err.Error())
+		os.Exit(1)
+	}
+}
+
+// writeFile writes the vectors of count random blocks to out.
+func writeFile(out string, seed int64, count int) error {
+	vectors := segwit.RandomVectors(seed, count)
+
+	file, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := NewJSONTestWriter(file)
+	if err := writer.WriteComment(vectorColumns); err != nil {
+		return err
+	}
+	for _, v := range vectors {
+		err := writer.WriteTestCase([]interface{}{
+			hex.EncodeToString(v.Block),
+			hex.EncodeToString(v.WitnessRoot),
+			vectorfile.ErrorString(v.Err),
+			v.Comment,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote %d vectors\n", len(vectors))
+	return nil
+}
+
+// checkFile checks each vector of the file with segwit.CheckVector.
+func checkFile(path string) error {
+	rows, err := vectorfile.ReadRows(path, 4)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		var v segwit.Vector
+		var errText string
+		err := vectorfile.DecodeRow(row, &v.Block, &v.WitnessRoot,
+			&errText, &v.Comment)
+		if err != nil {
+			return err
+		}
+		v.Err = vectorfile.ParseError(errText)
+		if err := segwit.CheckVector(v); err != nil {
+			return fmt.Errorf("%v: %v", v.Comment, err)
+		}
+	}
+	fmt.Printf("%d vectors OK\n", len(rows))
+	return nil
+}
@@ -0,0 +1,260 @@
+package segwit
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/christsim/bips/internal/vectorfile"
+)
+
+// ErrVectorMismatch is returned by CheckVector when the package doesn't
+// give the witness merkle root or the outcome a vector expects.
+var ErrVectorMismatch = errors.New("segwit: vector mismatch")
+
+// Vector is a block whose witness commitment is checked with CheckBlock.
+type Vector struct {
+	// Block is the serialized block, with witnesses.
+	Block []byte
+
+	// WitnessRoot is the witness merkle root of the block's transactions.
+	WitnessRoot []byte
+
+	// Err is the error CheckBlock fails with, or nil.
+	Err error
+
+	// Comment describes what the vector exercises.
+	Comment string
+}
+
+// newVector checks the block for the vector.
+func newVector(block *wire.MsgBlock, comment string) Vector {
+	var b bytes.Buffer
+	if err := block.Serialize(&b); err != nil {
+		panic(err)
+	}
+	root := BlockWitnessRoot(block)
+	return Vector{
+		Block:       b.Bytes(),
+		WitnessRoot: root[:],
+		Err:         CheckBlock(block),
+		Comment:     comment,
+	}
+}
+
+// randomBytes returns n random bytes.
+func randomBytes(rng *rand.Rand, n int) []byte {
+	b := make([]byte, n)
+	rng.Read(b)
+	return b
+}
+
+// randomWitness returns a random witness of up to 4 items.
+func randomWitness(rng *rand.Rand) wire.TxWitness {
+	witness := make(wire.TxWitness, 1+rng.Intn(4))
+	for i := range witness {
+		witness[i] = randomBytes(rng, rng.Intn(80))
+	}
+	return witness
+}
+
+// randomTx returns a random transaction of up to 3 inputs and outputs,
+// whose inputs have witnesses if witness is set.
+func randomTx(rng *rand.Rand, witness bool) *wire.MsgTx {
+	tx := wire.NewMsgTx(2)
+	for i := 1 + rng.Intn(3); i > 0; i-- {
+		var hash chainhash.Hash
+		rng.Read(hash[:])
+		txIn := wire.NewTxIn(wire.NewOutPoint(&hash, rng.Uint32()%4),
+			nil, nil)
+		if witness {
+			txIn.Witness = randomWitness(rng)
+		} else {
+			txIn.SignatureScript = randomBytes(rng, 1+rng.Intn(70))
+		}
+		tx.AddTxIn(txIn)
+	}
+	for i := 1 + rng.Intn(3); i > 0; i-- {
+		pkScript := append([]byte{0x00, 0x14}, randomBytes(rng, 20)...)
+		tx.AddTxOut(wire.NewTxOut(rng.Int63n(1e12), pkScript))
+	}
+	return tx
+}
+
+// randomBlock returns a random block of up to 8 transactions besides its
+// coinbase, some of which have witnesses if witness is set, without a
+// witness commitment.
+func randomBlock(rng *rand.Rand, witness bool) *wire.MsgBlock {
+	coinbase := wire.NewMsgTx(1)
+	coinbase.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{},
+		wire.MaxPrevOutIndex), randomBytes(rng, 2+rng.Intn(90)), nil))
+	coinbase.AddTxOut(wire.NewTxOut(rng.Int63n(5e9), append([]byte{0x00,
+		0x14}, randomBytes(rng, 20)...)))
+
+	block := &wire.MsgBlock{}
+	block.AddTransaction(coinbase)
+	n := rng.Intn(9)
+	for i := 0; i < n; i++ {
+		block.AddTransaction(randomTx(rng, witness && rng.Intn(3) != 0))
+	}
+	if witness && n > 0 && !block.Transactions[n].HasWitness() {
+		block.Transactions[n] = randomTx(rng, true)
+	}
+	if witness && n == 0 {
+		block.AddTransaction(randomTx(rng, true))
+	}
+	updateHeader(rng, block)
+	return block
+}
+
+// updateHeader sets the block's header to commit to its transactions.
+func updateHeader(rng *rand.Rand, block *wire.MsgBlock) {
+	hashes := make([]chainhash.Hash, len(block.Transactions))
+	for i, tx := range block.Transactions {
+		hashes[i] = tx.TxHash()
+	}
+	var buf [2 * HashSize]byte
+	for len(hashes) > 1 {
+		if len(hashes)%2 == 1 {
+			hashes = append(hashes, hashes[len(hashes)-1])
+		}
+		for i := 0; i < len(hashes)/2; i++ {
+			copy(buf[:], hashes[2*i][:])
+			copy(buf[HashSize:], hashes[2*i+1][:])
+			hashes[i] = doubleHash(buf[:])
+		}
+		hashes = hashes[:len(hashes)/2]
+	}
+	block.Header.MerkleRoot = hashes[0]
+	block.Header.Version = 0x20000000
+	block.Header.Bits = 0x207fffff
+	block.Header.Nonce = rng.Uint32()
+}
+
+// copyBlock returns a deep copy of the block.
+func copyBlock(block *wire.MsgBlock) *wire.MsgBlock {
+	var b bytes.Buffer
+	if err := block.Serialize(&b); err != nil {
+		panic(err)
+	}
+	c := &wire.MsgBlock{}
+	if err := c.Deserialize(&b); err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// committed returns a copy of the block committed to its witnesses with a
+// random reserved value.
+func committed(rng *rand.Rand, block *wire.MsgBlock) *wire.MsgBlock {
+	c := copyBlock(block)
+	var reserved [HashSize]byte
+	rng.Read(reserved[:])
+	if err := AddCommitment(c, reserved); err != nil {
+		panic(err)
+	}
+	updateHeader(rng, c)
+	return c
+}
+
+// changed returns a copy of the block with f applied to its coinbase, and
+// its header updated.
+func changed(rng *rand.Rand, block *wire.MsgBlock,
+	f func(coinbase *wire.MsgTx)) *wire.MsgBlock {
+
+	c := copyBlock(block)
+	f(c.Transactions[0])
+	updateHeader(rng, c)
+	return c
+}
+
+// RandomVectors returns vectors of count random blocks derived from a
+// math/rand source with the seed. Each block with witnesses has vectors of
+// its valid commitment and of the ways its commitment can be absent or
+// malformed, and each block without them one with and one without a
+// commitment.
+func RandomVectors(rngSeed int64, count int) []Vector {
+	rng := rand.New(rand.NewSource(rngSeed))
+	var vectors []Vector
+	for n := 0; n < count; n++ {
+		legacy := randomBlock(rng, false)
+		block := randomBlock(rng, true)
+		good := committed(rng, block)
+		i := len(good.Transactions[0].TxOut) - 1
+		commitment := good.Transactions[0].TxOut[i].PkScript
+		reserved := good.Transactions[0].TxIn[0].Witness[0]
+
+		vectors = append(vectors,
+			newVector(legacy, "no witnesses and no commitment"),
+			newVector(committed(rng, legacy),
+				"commitment without witnesses"),
+			newVector(good, "commitment of the witnesses"),
+			newVector(block, "witnesses without a commitment"),
+			newVector(changed(rng, good, func(cb *wire.MsgTx) {
+				script := append([]byte(nil), commitment...)
+				cb.TxOut[i].PkScript = append(script,
+					randomBytes(rng, 1+rng.Intn(8))...)
+			}), "commitment followed by other data"),
+			newVector(changed(rng, good, func(cb *wire.MsgTx) {
+				short := commitment[:MinCommitmentSize-1]
+				cb.TxOut[i].PkScript = short
+			}), "commitment one byte short"),
+			newVector(changed(rng, good, func(cb *wire.MsgTx) {
+				wrong := append([]byte(nil), commitment...)
+				wrong[len(wrong)-1] ^= 0x01
+				cb.AddTxOut(wire.NewTxOut(0, wrong))
+			}), "wrong commitment after the commitment"),
+			newVector(changed(rng, good, func(cb *wire.MsgTx) {
+				wrong := append([]byte(nil), commitment...)
+				wrong[len(wrong)-1] ^= 0x01
+				cb.TxOut = append([]*wire.TxOut{
+					wire.NewTxOut(0, wrong)}, cb.TxOut...)
+			}), "wrong commitment before the commitment"),
+			newVector(changed(rng, good, func(cb *wire.MsgTx) {
+				cb.TxIn[0].Witness = nil
+			}), "commitment without a reserved value"),
+			newVector(changed(rng, good, func(cb *wire.MsgTx) {
+				cb.TxIn[0].Witness = wire.TxWitness{
+					reserved[:HashSize-1]}
+			}), "reserved value one byte short"),
+			newVector(changed(rng, good, func(cb *wire.MsgTx) {
+				cb.TxIn[0].Witness = wire.TxWitness{reserved,
+					reserved}
+			}), "reserved value pushed twice"),
+			newVector(changed(rng, good, func(cb *wire.MsgTx) {
+				cb.TxIn[0].Witness = wire.TxWitness{
+					randomBytes(rng, HashSize)}
+			}), "commitment of another reserved value"),
+		)
+
+		// A witness changed after the block was committed to.
+		tampered := copyBlock(good)
+		tx := tampered.Transactions[len(tampered.Transactions)-1]
+		tx.TxIn[0].Witness = randomWitness(rng)
+		vectors = append(vectors, newVector(tampered,
+			"commitment of other witnesses"))
+	}
+	return vectors
+}
+
+// CheckVector checks the vector's block with CheckBlock, and its witness
+// merkle root.
+func CheckVector(v Vector) error {
+	block := &wire.MsgBlock{}
+	if err := block.Deserialize(bytes.NewReader(v.Block)); err != nil {
+		return err
+	}
+	root := BlockWitnessRoot(block)
+	if !bytes.Equal(root[:], v.WitnessRoot) {
+		return fmt.Errorf("%w: witness root %x, expected %x",
+			ErrVectorMismatch, root, v.WitnessRoot)
+	}
+	if err := CheckBlock(block); !vectorfile.SameError(err, v.Err) {
+		return fmt.Errorf("%w: error %v, expected %v",
+			ErrVectorMismatch, err, v.Err)
+	}
+	return nil
+}
@@ -0,0 +1,252 @@
+// This program writes test vectors for the sighash package to witness.json:
+// the examples of BIP 143, followed by the signature hashes of inputs of
+// random transactions for every standard sighash type and two others, with
+// the script codes of P2WPKH and P2WSH inputs. It also writes vectors of
+// legacy signature hashes to legacy.json: one for each of their historical
+// quirks and for each sighash type with SIGHASH_ANYONECANPAY, followed by
+// those of random transactions and scripts. The random vectors depend only
+// on -seed and -count, so they can be regenerated by anyone:
+//
+//	gentestvectors -count 50 -seed 143
+//
+// Both files use the layout of the BIP 158 vectors: a JSON array whose
+// first row names the columns, followed by one row per vector.
+// Transactions, which have no witnesses, scripts, signatures, preimages
+// and hashes are in hex. The Quirks column of a legacy vector lists the
+// quirks its signature hash goes through, and its preimage is empty for
+// the SIGHASH_SINGLE bug. Pass -check and -check-legacy to verify existing
+// files against the package instead:
+//
+//	gentestvectors -check witness.json -check-legacy legacy.json
+//
+// The program lives in a directory of its own since the sighash package
+// sits at the root of the module.
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	sighash "github.com/christsim/bips/bip-0143"
+	"github.com/christsim/bips/internal/vectorfile"
+)
+
+// witnessColumns is the header row of the witness vector file.
+const witnessColumns = "Tx,Index,ScriptCode,Amount,HashType,Preimage," +
+	"SigHash,Comment"
+
+// legacyColumns is the header row of the legacy vector file.
+const legacyColumns = "Tx,Index,Script,Sig,HashType,Preimage,SigHash," +
+	"Quirks,Comment"
+
+type JSONTestWriter struct {
+	writer          io.Writer
+	firstRowWritten bool
+}
+
+func NewJSONTestWriter(writer io.Writer) *JSONTestWriter {
+	return &JSONTestWriter{writer: writer}
+}
+
+func (w *JSONTestWriter) WriteComment(comment string) error {
+	return w.WriteTestCase([]interface{}{comment})
+}
+
+func (w *JSONTestWriter) WriteTestCase(row []interface{}) error {
+	var err error
+	if w.firstRowWritten {
+		_, err = io.WriteString(w.writer, ",\n")
+	} else {
+		_, err = io.WriteString(w.writer, "[\n")
+		w.firstRowWritten = true
+	}
+	if err != nil {
+		return err
+	}
+
+	rowBytes, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.writer.Write(rowBytes)
+	return err
+}
+
+func (w *JSONTestWriter) Close() error {
+	if !w.firstRowWritten {
+		return nil
+	}
+
+	_, err := io.WriteString(w.writer, "\n]\n")
+	return err
+}
+
+func main() {
+	out := flag.String("out", "witness.json", "file to write the witness "+
+		"vectors to")
+	legacyOut := flag.String("legacy-out", "legacy.json", "file to write "+
+		"the legacy vectors to")
+	count := flag.Int("count", 50, "number of random transactions to "+
+		"write vectors of")
+	seed := flag.Int64("seed", 143, "seed of the random vectors")
+	check := flag.String("check", "", "witness vector file to check "+
+		"instead of writing the files")
+	checkLegacy := flag.String("check-legacy", "", "legacy vector file "+
+		"to check instead of writing the files")
+	flag.Parse()
+
+	var err error
+	switch {
+	case *check != "" || *checkLegacy != "":
+		if *check != "" {
+			err = checkFile(*check)
+		}
+		if err == nil && *checkLegacy != "" {
+			err = checkLegacyFile(*checkLegacy)
+		}
+	default:
+		err = writeFile(*out, *seed, *count)
+		if err == nil {
+			err = writeLegacyFile(*legacyOut, *seed, *count)
+		}
+	}
+	if err != nil {
+		fmt.Println("Error: ", err.Error())
+		os.Exit(1)
+	}
+}
+
+// writeFile writes the examples of the BIP and the vectors of count random
+// transactions to out.
+func writeFile(out string, seed int64, count int) error {
+	vectors := append(sighash.SpecVectors(),
+		sighash.RandomVectors(seed, count)...)
+
+	file, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := NewJSONTestWriter(file)
+	if err := writer.WriteComment(witnessColumns); err != nil {
+		return err
+	}
+	for _, v := range vectors {
+		err := writer.WriteTestCase([]interface{}{
+			hex.EncodeToString(v.Tx),
+			v.Index,
+			hex.EncodeToString(v.ScriptCode),
+			v.Amount,
+			v.HashType,
+			hex.EncodeToString(v.Preimage),
+			hex.EncodeToString(v.SigHash),
+			v.Comment,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote %d witness vectors\n", len(vectors))
+	return nil
+}
+
+// writeLegacyFile writes the legacy vectors, with those of count random
+// transactions, to out.
+func writeLegacyFile(out string, seed int64, count int) error {
+	vectors := sighash.LegacyVectors(seed, count)
+
+	file, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := NewJSONTestWriter(file)
+	if err := writer.WriteComment(legacyColumns); err != nil {
+		return err
+	}
+	for _, v := range vectors {
+		quirks := v.Quirks
+		if quirks == nil {
+			quirks = []string{}
+		}
+		err := writer.WriteTestCase([]interface{}{
+			hex.EncodeToString(v.Tx),
+			v.Index,
+			hex.EncodeToString(v.Script),
+			hex.EncodeToString(v.Sig),
+			v.HashType,
+			hex.EncodeToString(v.Preimage),
+			hex.EncodeToString(v.SigHash),
+			quirks,
+			v.Comment,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote %d legacy vectors\n", len(vectors))
+	return nil
+}
+
+// checkFile checks each vector of the file with sighash.CheckVector.
+func checkFile(path string) error {
+	rows, err := vectorfile.ReadRows(path, 8)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		var v sighash.WitnessVector
+		err := vectorfile.DecodeRow(row, &v.Tx, &v.Index, &v.ScriptCode,
+			&v.Amount, &v.HashType, &v.Preimage, &v.SigHash,
+			&v.Comment)
+		if err != nil {
+			return err
+		}
+		if err := sighash.CheckVector(v); err != nil {
+			return fmt.Errorf("%v: %v", v.Comment, err)
+		}
+	}
+	fmt.Printf("%d witness vectors OK\n", len(rows))
+	return nil
+}
+
+// checkLegacyFile checks each vector of the file with
+// sighash.CheckLegacyVector.
+func checkLegacyFile(path string) error {
+	rows, err := vectorfile.ReadRows(path, 9)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		var v sighash.LegacyVector
+		err := vectorfile.DecodeRow(row, &v.Tx, &v.Index, &v.Script,
+			&v.Sig, &v.HashType, &v.Preimage, &v.SigHash, &v.Quirks,
+			&v.Comment)
+		if err != nil {
+			return err
+		}
+		if len(v.Quirks) == 0 {
+			v.Quirks = nil
+		}
+		if err := sighash.CheckLegacyVector(v); err != nil {
+			return fmt.Errorf("%v: %v", v.Comment, err)
+		}
+	}
+	fmt.Printf("%d legacy vectors OK\n", len(rows))
+	return nil
+}
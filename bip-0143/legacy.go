@@ -0,0 +1,253 @@
+package sighash
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+// ErrNoSingleOutput is returned by LegacyPreimage for SIGHASH_SINGLE
+// signatures of an input without an output of the same index, which sign
+// SingleBugHash rather than the hash of a preimage.
+var ErrNoSingleOutput = errors.New("sighash: no output for SIGHASH_SINGLE")
+
+// SingleBugHash is the hash legacy SIGHASH_SINGLE signatures of an input
+// without an output of the same index sign: the number 1 in little endian.
+// The original client returned it to report the error, but never checked
+// for it, so it became part of the consensus rules. A signature of it is
+// valid for any such input whose key is the same.
+var SingleBugHash = [sha256.Size]byte{0x01}
+
+// Opcodes the legacy script code serialization needs.
+const (
+	opPushData1 = 0x4c
+	opPushData2 = 0x4d
+	opPushData4 = 0x4e
+)
+
+// nextOp returns the offset of the opcode after the one at offset pc of the
+// script, and false if there is none or it ends past the script. As in
+// Bitcoin Core, the offset is past the opcode and size of a push that ends
+// past the script.
+func nextOp(script []byte, pc int) (int, bool) {
+	if pc >= len(script) {
+		return pc, false
+	}
+	op := script[pc]
+	pc++
+	var size int
+	switch {
+	case op < opPushData1:
+		size = int(op)
+	case op == opPushData1:
+		if len(script)-pc < 1 {
+			return pc, false
+		}
+		size = int(script[pc])
+		pc++
+	case op == opPushData2:
+		if len(script)-pc < 2 {
+			return pc, false
+		}
+		size = int(script[pc]) | int(script[pc+1])<<8
+		pc += 2
+	case op == opPushData4:
+		if len(script)-pc < 4 {
+			return pc, false
+		}
+		size = int(script[pc]) | int(script[pc+1])<<8 |
+			int(script[pc+2])<<16 | int(script[pc+3])<<24
+		pc += 4
+	}
+	if size > len(script)-pc {
+		return pc, false
+	}
+	return pc + size, true
+}
+
+// pushData returns the script pushing data, with the smallest push opcode
+// that takes its size. Pushes of one byte aren't turned into OP_1 to
+// OP_16.
+func pushData(data []byte) []byte {
+	n := len(data)
+	var push []byte
+	switch {
+	case n < opPushData1:
+		push = []byte{byte(n)}
+	case n <= 0xff:
+		push = []byte{opPushData1, byte(n)}
+	case n <= 0xffff:
+		push = []byte{opPushData2, byte(n), byte(n >> 8)}
+	default:
+		push = []byte{opPushData4, byte(n), byte(n >> 8), byte(n >> 16),
+			byte(n >> 24)}
+	}
+	return append(push, data...)
+}
+
+// FindAndDelete returns the script with every push of the signature, with
+// its sighash type byte, removed, as legacy signature checks do to the
+// script code before they hash it, and the number of pushes removed. A push
+// is removed where it starts at an opcode and is pushed with the smallest
+// push opcode, which may leave pushes the removal brings together behind.
+// The script is returned as it is if nothing is removed. Witness programs
+// aren't subject to this.
+func FindAndDelete(script, sig []byte) ([]byte, int) {
+	if len(sig) == 0 {
+		return script, 0
+	}
+	push := pushData(sig)
+
+	var result []byte
+	var found int
+	pc, copied := 0, 0
+	for {
+		result = append(result, script[copied:pc]...)
+		for bytes.HasPrefix(script[pc:], push) {
+			pc += len(push)
+			found++
+		}
+		copied = pc
+		var ok bool
+		if pc, ok = nextOp(script, pc); !ok {
+			break
+		}
+	}
+	if found == 0 {
+		return script, 0
+	}
+	return append(result, script[copied:]...), found
+}
+
+// legacyCodeSeps returns the number of OP_CODESEPARATORs of the script, up
+// to the opcode it fails to parse at if it doesn't, and whether it parses.
+func legacyCodeSeps(script []byte) (int, bool) {
+	codeSeps := 0
+	for pc := 0; pc < len(script); {
+		start := pc
+		var ok bool
+		if pc, ok = nextOp(script, pc); !ok {
+			return codeSeps, false
+		}
+		if script[start] == opCodeSeparator {
+			codeSeps++
+		}
+	}
+	return codeSeps, true
+}
+
+// writeLegacyScriptCode writes the script code of a legacy preimage: the
+// script without its OP_CODESEPARATORs, prefixed with its size. Bitcoin
+// Core stops writing a script that doesn't parse after the push opcode and
+// size of the push that runs past its end, yet prefixes it with its full
+// size less its OP_CODESEPARATORs, and so does this.
+func writeLegacyScriptCode(b *bytes.Buffer, script []byte) {
+	codeSeps, _ := legacyCodeSeps(script)
+	b.Write(compactSize(len(script) - codeSeps))
+
+	begin, pc := 0, 0
+	for {
+		start := pc
+		var ok bool
+		if pc, ok = nextOp(script, pc); !ok {
+			break
+		}
+		if script[start] == opCodeSeparator {
+			b.Write(script[begin:start])
+			begin = pc
+		}
+	}
+	if begin < len(script) {
+		b.Write(script[begin:pc])
+	}
+}
+
+// LegacyPreimage returns the message legacy signatures of input i with the
+// sighash type sign: the transaction with the script code as the input's
+// script and the scripts of the other inputs empty, followed by the
+// sighash type in four bytes. The script code is the script from the last
+// OP_CODESEPARATOR executed on, with the signature removed by
+// FindAndDelete, and any other OP_CODESEPARATORs are left out here.
+//
+// SIGHASH_NONE signs no outputs and SIGHASH_SINGLE the output of the
+// input's index, those before it with empty scripts and amounts of -1.
+// Both sign the sequences of the other inputs as 0. With
+// SIGHASH_ANYONECANPAY, only the input is signed. It fails with
+// ErrNoSingleOutput for SIGHASH_SINGLE signatures of an input without an
+// output of the same index.
+func LegacyPreimage(tx *wire.MsgTx, i int, scriptCode []byte,
+	hashType HashType) ([]byte, error) {
+
+	if i < 0 || i >= len(tx.TxIn) {
+		return nil, fmt.Errorf("%w: %d", ErrInputIndex, i)
+	}
+	anyoneCanPay := hashType&AnyoneCanPay != 0
+	outputType := hashType.outputType()
+	if outputType == Single && i >= len(tx.TxOut) {
+		return nil, fmt.Errorf("%w: input %d", ErrNoSingleOutput, i)
+	}
+
+	var msg bytes.Buffer
+	writeUint32(&msg, uint32(tx.Version))
+	if anyoneCanPay {
+		msg.WriteByte(1)
+	} else {
+		msg.Write(compactSize(len(tx.TxIn)))
+	}
+	for j, txIn := range tx.TxIn {
+		switch {
+		case j == i:
+			writeOutPoint(&msg, &txIn.PreviousOutPoint)
+			writeLegacyScriptCode(&msg, scriptCode)
+			writeUint32(&msg, txIn.Sequence)
+		case anyoneCanPay:
+		case outputType == Single || outputType == None:
+			writeOutPoint(&msg, &txIn.PreviousOutPoint)
+			msg.WriteByte(0)
+			writeUint32(&msg, 0)
+		default:
+			writeOutPoint(&msg, &txIn.PreviousOutPoint)
+			msg.WriteByte(0)
+			writeUint32(&msg, txIn.Sequence)
+		}
+	}
+
+	switch outputType {
+	case None:
+		msg.WriteByte(0)
+	case Single:
+		msg.Write(compactSize(i + 1))
+		for j := 0; j < i; j++ {
+			writeTxOut(&msg, &wire.TxOut{Value: -1})
+		}
+		writeTxOut(&msg, tx.TxOut[i])
+	default:
+		msg.Write(compactSize(len(tx.TxOut)))
+		for _, txOut := range tx.TxOut {
+			writeTxOut(&msg, txOut)
+		}
+	}
+	writeUint32(&msg, tx.LockTime)
+	writeUint32(&msg, uint32(hashType))
+	return msg.Bytes(), nil
+}
+
+// LegacySigHash returns the hash legacy signatures of input i with the
+// sighash type sign, the double SHA256 of its preimage, or SingleBugHash
+// for SIGHASH_SINGLE signatures of an input without an output of the same
+// index.
+func LegacySigHash(tx *wire.MsgTx, i int, scriptCode []byte,
+	hashType HashType) ([sha256.Size]byte, error) {
+
+	msg, err := LegacyPreimage(tx, i, scriptCode, hashType)
+	switch {
+	case errors.Is(err, ErrNoSingleOutput):
+		return SingleBugHash, nil
+	case err != nil:
+		return [sha256.Size]byte{}, err
+	}
+	return doubleHash(msg), nil
+}
@@ -0,0 +1,270 @@
+// Package sighash implements the signature hash of version 0 witness
+// programs of BIP 143, which signs the amount an input spends and hashes
+// the parts of the transaction every input's signature shares only once,
+// and the legacy signature hash it replaced.
+//
+//	hashes := sighash.NewWitnessHashes(tx)
+//	scriptCode := sighash.PubKeyHashScriptCode(pubKeyHash)
+//	sigHash, err := hashes.SigHash(0, scriptCode, amount, sighash.All)
+//
+// The script code of a P2WPKH input is that of PubKeyHashScriptCode, and
+// that of a P2WSH input is its witness script from the last
+// OP_CODESEPARATOR executed on, as ScriptCode cuts it. Nested P2SH inputs
+// sign the same as native ones.
+//
+// LegacySigHash keeps the quirks of the original client that became
+// consensus rules: SIGHASH_SINGLE signatures of inputs without an output
+// sign the number 1, the script code loses its OP_CODESEPARATORs and,
+// through FindAndDelete, the signature itself, and every input's
+// signature hashes the whole transaction again.
+package sighash
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// HashType is the sighash type of a signature, which selects the parts of
+// the transaction it signs. Signatures end with its low byte, and the
+// signature hash commits to all four bytes.
+type HashType uint32
+
+// The sighash types. Any other value signs what All signs, with or without
+// AnyoneCanPay.
+const (
+	All          HashType = 0x01
+	None         HashType = 0x02
+	Single       HashType = 0x03
+	AnyoneCanPay HashType = 0x80
+)
+
+// HashTypes lists the standard sighash types.
+var HashTypes = []HashType{
+	All, None, Single, All | AnyoneCanPay, None | AnyoneCanPay,
+	Single | AnyoneCanPay,
+}
+
+// outputType returns the bits of the sighash type that select the outputs
+// signed, which are those of None and Single.
+func (t HashType) outputType() HashType {
+	return t & 0x1f
+}
+
+// String returns the name of the sighash type, such as
+// SIGHASH_ALL|ANYONECANPAY, or its value in hex for one that isn't
+// standard.
+func (t HashType) String() string {
+	base := t &^ AnyoneCanPay
+	if base < All || base > Single {
+		return fmt.Sprintf("0x%08x", uint32(t))
+	}
+	name := [...]string{"SIGHASH_ALL", "SIGHASH_NONE",
+		"SIGHASH_SINGLE"}[base-All]
+	if t&AnyoneCanPay != 0 {
+		name += "|ANYONECANPAY"
+	}
+	return name
+}
+
+// NoCodeSeparator is the code separator position passed to ScriptCode when
+// no OP_CODESEPARATOR has been executed.
+const NoCodeSeparator = 0xffffffff
+
+var (
+	// ErrInputIndex is returned for an input index out of range.
+	ErrInputIndex = errors.New("sighash: input index out of range")
+
+	// ErrCodeSeparator is returned by ScriptCode when the opcode at the
+	// code separator position isn't an OP_CODESEPARATOR.
+	ErrCodeSeparator = errors.New("sighash: no OP_CODESEPARATOR at " +
+		"position")
+
+	// ErrScript is returned by ScriptCode for a script that doesn't parse
+	// up to the code separator.
+	ErrScript = errors.New("sighash: invalid script")
+)
+
+// opCodeSeparator is the opcode of OP_CODESEPARATOR.
+const opCodeSeparator = 0xab
+
+// PubKeyHashScriptCode returns the script code of a P2WPKH input, the
+// P2PKH script of its 20 byte witness program.
+func PubKeyHashScriptCode(pubKeyHash []byte) []byte {
+	script := []byte{0x76, 0xa9, byte(len(pubKeyHash))}
+	script = append(script, pubKeyHash...)
+	return append(script, 0x88, 0xac)
+}
+
+// ScriptCode returns the script code of a P2WSH input whose witness script
+// is run up to a signature check: the part of the script after the
+// OP_CODESEPARATOR last executed, which is codeSepPos opcodes into it,
+// pushes included, or the whole script for NoCodeSeparator.
+func ScriptCode(witnessScript []byte, codeSepPos uint32) ([]byte, error) {
+	if codeSepPos == NoCodeSeparator {
+		return witnessScript, nil
+	}
+	tokenizer := txscript.MakeScriptTokenizer(0, witnessScript)
+	for tokenizer.Next() {
+		if uint32(tokenizer.OpcodePosition()) != codeSepPos {
+			continue
+		}
+		if tokenizer.Opcode() != opCodeSeparator {
+			break
+		}
+		return witnessScript[tokenizer.ByteIndex():], nil
+	}
+	if err := tokenizer.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrScript, err)
+	}
+	return nil, fmt.Errorf("%w %d", ErrCodeSeparator, codeSepPos)
+}
+
+// WitnessHashes holds the hashes of a transaction that every signature of
+// its inputs commits to unless its sighash type leaves them out:
+// hashPrevouts, hashSequence and hashOutputs. Computing them once per
+// transaction keeps signing all its inputs linear in its size.
+type WitnessHashes struct {
+	tx *wire.MsgTx
+
+	prevOutsHash [sha256.Size]byte
+	sequenceHash [sha256.Size]byte
+	outputsHash  [sha256.Size]byte
+}
+
+// NewWitnessHashes computes the hashes of the transaction.
+func NewWitnessHashes(tx *wire.MsgTx) *WitnessHashes {
+	var outPoints, sequences, outputs bytes.Buffer
+	for _, txIn := range tx.TxIn {
+		writeOutPoint(&outPoints, &txIn.PreviousOutPoint)
+		writeUint32(&sequences, txIn.Sequence)
+	}
+	for _, txOut := range tx.TxOut {
+		writeTxOut(&outputs, txOut)
+	}
+
+	return &WitnessHashes{
+		tx:           tx,
+		prevOutsHash: doubleHash(outPoints.Bytes()),
+		sequenceHash: doubleHash(sequences.Bytes()),
+		outputsHash:  doubleHash(outputs.Bytes()),
+	}
+}
+
+// Preimage returns the message the signatures of input i with the sighash
+// type sign, given the script code of the input and the amount of the
+// output it spends. SIGHASH_SINGLE signatures of an input without an output
+// of the same index sign a hashOutputs of zeros.
+func (h *WitnessHashes) Preimage(i int, scriptCode []byte, amount int64,
+	hashType HashType) ([]byte, error) {
+
+	tx := h.tx
+	if i < 0 || i >= len(tx.TxIn) {
+		return nil, fmt.Errorf("%w: %d", ErrInputIndex, i)
+	}
+	anyoneCanPay := hashType&AnyoneCanPay != 0
+	outputType := hashType.outputType()
+
+	var prevOutsHash, sequenceHash, outputsHash [sha256.Size]byte
+	if !anyoneCanPay {
+		prevOutsHash = h.prevOutsHash
+	}
+	if !anyoneCanPay && outputType != Single && outputType != None {
+		sequenceHash = h.sequenceHash
+	}
+	switch {
+	case outputType != Single && outputType != None:
+		outputsHash = h.outputsHash
+	case outputType == Single && i < len(tx.TxOut):
+		var b bytes.Buffer
+		writeTxOut(&b, tx.TxOut[i])
+		outputsHash = doubleHash(b.Bytes())
+	}
+
+	txIn := tx.TxIn[i]
+	var msg bytes.Buffer
+	writeUint32(&msg, uint32(tx.Version))
+	msg.Write(prevOutsHash[:])
+	msg.Write(sequenceHash[:])
+	writeOutPoint(&msg, &txIn.PreviousOutPoint)
+	writeVarBytes(&msg, scriptCode)
+	writeUint64(&msg, uint64(amount))
+	writeUint32(&msg, txIn.Sequence)
+	msg.Write(outputsHash[:])
+	writeUint32(&msg, tx.LockTime)
+	writeUint32(&msg, uint32(hashType))
+	return msg.Bytes(), nil
+}
+
+// SigHash returns the hash signed by the signatures of input i with the
+// sighash type, the double SHA256 of its preimage.
+func (h *WitnessHashes) SigHash(i int, scriptCode []byte, amount int64,
+	hashType HashType) ([sha256.Size]byte, error) {
+
+	msg, err := h.Preimage(i, scriptCode, amount, hashType)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	return doubleHash(msg), nil
+}
+
+// doubleHash returns the SHA256 of the SHA256 of b.
+func doubleHash(b []byte) [sha256.Size]byte {
+	hash := sha256.Sum256(b)
+	return sha256.Sum256(hash[:])
+}
+
+// writeUint32 writes n in little endian.
+func writeUint32(w io.Writer, n uint32) {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], n)
+	w.Write(b[:])
+}
+
+// writeUint64 writes n in little endian.
+func writeUint64(w io.Writer, n uint64) {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], n)
+	w.Write(b[:])
+}
+
+// writeVarBytes writes b prefixed with its size as a CompactSize.
+func writeVarBytes(w io.Writer, b []byte) {
+	w.Write(compactSize(len(b)))
+	w.Write(b)
+}
+
+// writeOutPoint writes an outpoint as transactions serialize it: the txid
+// and the output index.
+func writeOutPoint(w io.Writer, outPoint *wire.OutPoint) {
+	w.Write(outPoint.Hash[:])
+	writeUint32(w, outPoint.Index)
+}
+
+// writeTxOut writes an output as transactions serialize it: its amount and
+// its script.
+func writeTxOut(w io.Writer, txOut *wire.TxOut) {
+	writeUint64(w, uint64(txOut.Value))
+	writeVarBytes(w, txOut.PkScript)
+}
+
+// compactSize returns the CompactSize encoding of n.
+func compactSize(n int) []byte {
+	switch {
+	case n < 0xfd:
+		return []byte{byte(n)}
+	case n <= 0xffff:
+		return []byte{0xfd, byte(n), byte(n >> 8)}
+	case n <= 0xffffffff:
+		return []byte{0xfe, byte(n), byte(n >> 8), byte(n >> 16),
+			byte(n >> 24)}
+	}
+	return []byte{0xff, byte(n), byte(n >> 8), byte(n >> 16), byte(n >> 24),
+		byte(n >> 32), byte(n >> 40), byte(n >> 48), byte(n >> 56)}
+}
@@ -0,0 +1,650 @@
+package sighash
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/rand"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// ErrVectorMismatch is returned by CheckVector when the package doesn't
+// give the preimage or signature hash a vector expects.
+var ErrVectorMismatch = errors.New("sighash: vector mismatch")
+
+// WitnessVector is the signature hash of an input of a transaction spending
+// a version 0 witness program, with the preimage it hashes.
+type WitnessVector struct {
+	// Tx is the serialized transaction, without witnesses.
+	Tx    []byte
+	Index int
+
+	// ScriptCode is the script code of the input, and Amount the amount
+	// of the output it spends.
+	ScriptCode []byte
+	Amount     int64
+
+	HashType HashType
+	Preimage []byte
+	SigHash  []byte
+
+	// Comment describes what the vector exercises.
+	Comment string
+}
+
+// parseTx parses the transaction of a vector.
+func parseTx(b []byte) (*wire.MsgTx, error) {
+	tx := &wire.MsgTx{}
+	if err := tx.DeserializeNoWitness(bytes.NewReader(b)); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+// serializeTx serializes the transaction of a vector.
+func serializeTx(tx *wire.MsgTx) []byte {
+	var b bytes.Buffer
+	if err := tx.SerializeNoWitness(&b); err != nil {
+		panic(err)
+	}
+	return b.Bytes()
+}
+
+// newWitnessVector computes the vector of input i of the transaction.
+func newWitnessVector(tx *wire.MsgTx, i int, scriptCode []byte,
+	amount int64, hashType HashType, comment string) WitnessVector {
+
+	preimage, err := NewWitnessHashes(tx).Preimage(i, scriptCode, amount,
+		hashType)
+	if err != nil {
+		panic(err)
+	}
+	sigHash := doubleHash(preimage)
+	return WitnessVector{
+		Tx:         serializeTx(tx),
+		Index:      i,
+		ScriptCode: scriptCode,
+		Amount:     amount,
+		HashType:   hashType,
+		Preimage:   preimage,
+		SigHash:    sigHash[:],
+		Comment:    comment,
+	}
+}
+
+// mustDecodeHex decodes a hex string of the package's vectors.
+func mustDecodeHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// pubKeyHash returns the script code of a P2WPKH input of the BIP's
+// examples.
+func pubKeyHash(s string) []byte {
+	return PubKeyHashScriptCode(mustDecodeHex(s))
+}
+
+// witnessScript returns the script code of a witness script of the BIP's
+// examples, run from the code separator at the position.
+func witnessScript(s string, codeSepPos uint32) []byte {
+	scriptCode, err := ScriptCode(mustDecodeHex(s), codeSepPos)
+	if err != nil {
+		panic(err)
+	}
+	return scriptCode
+}
+
+// specVector is one of the examples of the BIP: a transaction, without
+// witnesses, and what an input of it signs, with the signature hash the BIP
+// gives.
+type specVector struct {
+	tx         string
+	index      int
+	scriptCode []byte
+	amount     int64
+	hashType   HashType
+	sigHash    string
+	comment    string
+}
+
+// The transactions of the examples of the BIP.
+const (
+	p2wpkhTx         = "0100000002fff7f7881a8099afa6940d42d1e7f6362bec38171ea3edf433541db4e4ad969f0000000000eeffffffef51e1b804cc89d182d279655c3aa89e815b1b309fe287d9b2b55d57b90ec68a0100000000ffffffff02202cb206000000001976a9148280b37df378db99f66f85c95a783a76ac7a6d5988ac9093510d000000001976a9143bde42dbee7e4dbe6a21b2d50ce2f0167faa815988ac11000000"
+	p2shP2wpkhTx     = "0100000001db6b1b20aa0fd7b23880be2ecbd4a98130974cf4748fb66092ac4d3ceb1a54770100000000feffffff02b8b4eb0b000000001976a914a457b684d7f0d539a46a45bbc043f35b59d0d96388ac0008af2f000000001976a914fd270b1ee6abcaea97fea7ad0402e8bd8ad6d77c88ac92040000"
+	p2wshTx          = "0100000002fe3dc9208094f3ffd12645477b3dc56f60ec4fa8e6f5d67c565d1c6b9216b36e0000000000ffffffff0815cf020f013ed6cf91d29f4202e8a58726b1ac6c79da47c23d1bee0a6925f80000000000ffffffff0100f2052a010000001976a914a30741f8145e5acadf23f751864167f32e0963f788ac00000000"
+	codeSepTx        = "0100000002e9b542c5176808107ff1df906f46bb1f2583b16112b95ee5380665ba7fcfc0010000000000ffffffff80e68831516392fcd100d186b3c2c7b95c80b53c77e77c35ba03a66b429a2a1b0000000000ffffffff0280969800000000001976a914de4b231626ef508c9a74a8517e6783c0546d6b2888ac80969800000000001976a9146648a8cd4531e1ec47f35916de8e259237294d1e88ac00000000"
+	p2shP2wshTx      = "010000000136641869ca081e70f394c6948e8af409e18b619df2ed74aa106c1ca29787b96e0100000000ffffffff0200e9a435000000001976a914389ffce9cd9ae88dcc0631e88a821ffdbe9bfe2688acc0832f05000000001976a9147480a33f950689af511e6e84c138dbbd3c3ee41588ac00000000"
+	findAndDeleteTx  = "010000000169c12106097dc2e0526493ef67f21269fe888ef05c7a3a5dacab38e1ac8387f14c1d000000ffffffff0101000000000000000000000000"
+	multiSigVerifyTx = "01000000019275cb8d4a485ce95741c013f7c0d28722160008021bb469a11982d47a6628964c1d000000ffffffff0101000000000000000000000000"
+)
+
+// The witness scripts of the examples of the BIP.
+const (
+	p2wshScript        = "21026dccc749adc2a9d0d89497ac511f760f45c47dc5ed9cf352a58ac706453880aeadab210255a9626aebf5e29c0e6538428ba0d1dcf6ca98ffdf086aa8ced5e0d0215ea465ac"
+	multiSig6of6Script = "56210307b8ae49ac90a048e9b53357a2354b3334e9c8bee813ecb98e99a7e07e8c3ba32103b28f0c28bfab54554ae8c658ac5c3e0ce6e79ad336331f78c428dd43eea8449b21034b8113d703413d57761b8b9781957b8c0ac1dfe69f492580ca4195f50376ba4a21033400f6afecb833092a9a21cfdf1ed1376e58c5d1f47de74683123987e967a8f42103a6d48b1131e94ba04d9737d61acdaa1322008af9602b3b14862c07a1789aac162102d8b661b0b3302ee2f162b09e07a55ad5dfbe673a9f01d9f0c19617681024306b56ae"
+)
+
+var specVectors = []specVector{
+	{
+		tx:         p2wpkhTx,
+		index:      1,
+		scriptCode: pubKeyHash("1d0f172a0ecb48aee1be1f2687d2963ae33f71a1"),
+		amount:     600000000,
+		hashType:   All,
+		sigHash:    "c37af31116d1b27caf68aae9e3ac82f1477929014d5b917657d0eb49478cb670",
+		comment:    "native P2WPKH",
+	},
+	{
+		tx:         p2shP2wpkhTx,
+		index:      0,
+		scriptCode: pubKeyHash("79091972186c449eb1ded22b78e40d009bdf0089"),
+		amount:     1000000000,
+		hashType:   All,
+		sigHash:    "64f3b0f4dd2bb3aa1ce8566d220cc74dda9df97d8490cc81d89d735c92e59fb6",
+		comment:    "P2SH-P2WPKH",
+	},
+	{
+		tx:         p2wshTx,
+		index:      1,
+		scriptCode: witnessScript(p2wshScript, NoCodeSeparator),
+		amount:     4900000000,
+		hashType:   Single,
+		sigHash:    "82dde6e4f1e94d02c2b7ad03d2115d691f48d064e9d52f58194a6637e4194391",
+		comment:    "native P2WSH, signature before OP_CODESEPARATOR",
+	},
+	{
+		tx:         p2wshTx,
+		index:      1,
+		scriptCode: witnessScript(p2wshScript, 2),
+		amount:     4900000000,
+		hashType:   Single,
+		sigHash:    "fef7bd749cce710c5c052bd796df1af0d935e59cea63736268bcbe2d2134fc47",
+		comment:    "native P2WSH, signature after OP_CODESEPARATOR",
+	},
+	{
+		tx:         codeSepTx,
+		index:      0,
+		scriptCode: witnessScript("0063ab68210392972e2eb617b2388771abe27235fd5ac44af8e61693261550447a4c3e39da98ac", NoCodeSeparator),
+		amount:     16777215,
+		hashType:   Single | AnyoneCanPay,
+		sigHash:    "e9071e75e25b8a1e298a72f0d2e9f4f95a0f5cdf86a533cda597eb402ed13b3a",
+		comment:    "unexecuted OP_CODESEPARATOR",
+	},
+	{
+		tx:         codeSepTx,
+		index:      1,
+		scriptCode: witnessScript("5163ab68210392972e2eb617b2388771abe27235fd5ac44af8e61693261550447a4c3e39da98ac", 2),
+		amount:     16777215,
+		hashType:   Single | AnyoneCanPay,
+		sigHash:    "cd72f1f1a433ee9df816857fad88d8ebd97e09a75cd481583eb841c330275e54",
+		comment:    "executed OP_CODESEPARATOR",
+	},
+	{
+		tx:         p2shP2wshTx,
+		index:      0,
+		scriptCode: witnessScript(multiSig6of6Script, NoCodeSeparator),
+		amount:     987654321,
+		hashType:   All,
+		sigHash:    "185c0be5263dce5b4bb50a047973c1b6272bfbd0103a89444597dc40b248ee7c",
+		comment:    "P2SH-P2WSH 6-of-6, SIGHASH_ALL",
+	},
+	{
+		tx:         p2shP2wshTx,
+		index:      0,
+		scriptCode: witnessScript(multiSig6of6Script, NoCodeSeparator),
+		amount:     987654321,
+		hashType:   None,
+		sigHash:    "e9733bc60ea13c95c6527066bb975a2ff29a925e80aa14c213f686cbae5d2f36",
+		comment:    "P2SH-P2WSH 6-of-6, SIGHASH_NONE",
+	},
+	{
+		tx:         p2shP2wshTx,
+		index:      0,
+		scriptCode: witnessScript(multiSig6of6Script, NoCodeSeparator),
+		amount:     987654321,
+		hashType:   Single,
+		sigHash:    "1e1f1c303dc025bd664acb72e583e933fae4cff9148bf78c157d1e8f78530aea",
+		comment:    "P2SH-P2WSH 6-of-6, SIGHASH_SINGLE",
+	},
+	{
+		tx:         p2shP2wshTx,
+		index:      0,
+		scriptCode: witnessScript(multiSig6of6Script, NoCodeSeparator),
+		amount:     987654321,
+		hashType:   All | AnyoneCanPay,
+		sigHash:    "2a67f03e63a6a422125878b40b82da593be8d4efaafe88ee528af6e5a9955c6e",
+		comment:    "P2SH-P2WSH 6-of-6, SIGHASH_ALL|ANYONECANPAY",
+	},
+	{
+		tx:         p2shP2wshTx,
+		index:      0,
+		scriptCode: witnessScript(multiSig6of6Script, NoCodeSeparator),
+		amount:     987654321,
+		hashType:   None | AnyoneCanPay,
+		sigHash:    "781ba15f3779d5542ce8ecb5c18716733a5ee42a6f51488ec96154934e2c890a",
+		comment:    "P2SH-P2WSH 6-of-6, SIGHASH_NONE|ANYONECANPAY",
+	},
+	{
+		tx:         p2shP2wshTx,
+		index:      0,
+		scriptCode: witnessScript(multiSig6of6Script, NoCodeSeparator),
+		amount:     987654321,
+		hashType:   Single | AnyoneCanPay,
+		sigHash:    "511e8e52ed574121fc1b654970395502128263f62662e076dc6baf05c2e6a99b",
+		comment:    "P2SH-P2WSH 6-of-6, SIGHASH_SINGLE|ANYONECANPAY",
+	},
+	{
+		tx:         findAndDeleteTx,
+		index:      0,
+		scriptCode: witnessScript("ad4830450220487fb382c4974de3f7d834c1b617fe15860828c7f96454490edd6d891556dcc9022100baf95feb48f845d5bfc9882eb6aeefa1bc3790e39f59eaa46ff7f15ae626c53e01", NoCodeSeparator),
+		amount:     200000,
+		hashType:   All,
+		sigHash:    "71c9cd9b2869b9c70b01b1f0360c148f42dee72297db312638df136f43311f23",
+		comment:    "no FindAndDelete of the signature",
+	},
+	{
+		tx:         multiSigVerifyTx,
+		index:      0,
+		scriptCode: witnessScript("52af4830450220487fb382c4974de3f7d834c1b617fe15860828c7f96454490edd6d891556dcc9022100baf95feb48f845d5bfc9882eb6aeefa1bc3790e39f59eaa46ff7f15ae626c53e0148304502205286f726690b2e9b0207f0345711e63fa7012045b9eb0f19c2458ce1db90cf43022100e89f17f86abc5b149eba4115d4f128bcf45d77fb3ecdd34f594091340c0395960175", NoCodeSeparator),
+		amount:     200000,
+		hashType:   All,
+		sigHash:    "c1628a1e7c67f14ca0c27c06e4fdeec2e6d1a73c7a91d7c046ff83e835aebb72",
+		comment:    "no FindAndDelete with OP_CHECKMULTISIGVERIFY",
+	},
+}
+
+// SpecVectors returns the examples of the BIP. Their preimages are built by
+// the package, and each is checked to give the signature hash the BIP
+// expects.
+func SpecVectors() []WitnessVector {
+	vectors := make([]WitnessVector, len(specVectors))
+	for i, sv := range specVectors {
+		tx, err := parseTx(mustDecodeHex(sv.tx))
+		if err != nil {
+			panic(err)
+		}
+		v := newWitnessVector(tx, sv.index, sv.scriptCode, sv.amount,
+			sv.hashType, sv.comment)
+		if hex.EncodeToString(v.SigHash) != sv.sigHash {
+			panic(fmt.Sprintf("vector %d has signature hash %x, "+
+				"the BIP %v", i, v.SigHash, sv.sigHash))
+		}
+		vectors[i] = v
+	}
+	return vectors
+}
+
+// randomBytes returns n random bytes.
+func randomBytes(rng *rand.Rand, n int) []byte {
+	b := make([]byte, n)
+	rng.Read(b)
+	return b
+}
+
+// randomTx returns a random transaction of up to 5 inputs and 4 outputs.
+func randomTx(rng *rand.Rand) *wire.MsgTx {
+	return newRandomTx(rng, 1+rng.Intn(5), rng.Intn(5))
+}
+
+// newRandomTx returns a transaction of random inputs and outputs.
+func newRandomTx(rng *rand.Rand, inputs, outputs int) *wire.MsgTx {
+	tx := wire.NewMsgTx(int32(rng.Uint32()))
+	if rng.Intn(2) == 0 {
+		tx.Version = 2
+	}
+	tx.LockTime = rng.Uint32()
+
+	for i := 0; i < inputs; i++ {
+		var hash chainhash.Hash
+		rng.Read(hash[:])
+		txIn := wire.NewTxIn(wire.NewOutPoint(&hash, rng.Uint32()%4),
+			nil, nil)
+		txIn.Sequence = rng.Uint32()
+		tx.AddTxIn(txIn)
+	}
+	for i := 0; i < outputs; i++ {
+		pkScript := append([]byte{0x00, 0x14}, randomBytes(rng, 20)...)
+		if rng.Intn(4) == 0 {
+			pkScript = randomBytes(rng, rng.Intn(60))
+		}
+		tx.AddTxOut(wire.NewTxOut(rng.Int63n(1e15), pkScript))
+	}
+	return tx
+}
+
+// randomScriptCode returns the script code of a random P2WPKH input, or of
+// a random witness script run from one of its code separators, if it has
+// any, and describes it.
+func randomScriptCode(rng *rand.Rand) ([]byte, string) {
+	if rng.Intn(3) == 0 {
+		return PubKeyHashScriptCode(randomBytes(rng, 20)), "P2WPKH"
+	}
+
+	// The script checks signatures under random keys, with some
+	// OP_CODESEPARATORs and OP_IFs between them, and is long enough now
+	// and then for its size to take more than a byte to encode.
+	var script []byte
+	var codeSeps []uint32
+	for op := uint32(0); len(script) < 30+rng.Intn(300); op++ {
+		switch rng.Intn(4) {
+		case 0:
+			codeSeps = append(codeSeps, op)
+			script = append(script, opCodeSeparator)
+		case 1:
+			script = append(script, 0x63, 0x68)
+			op++
+		default:
+			script = append(script, 0x21)
+			script = append(script, randomBytes(rng, 33)...)
+			script = append(script, 0xad)
+			op++
+		}
+	}
+	script = append(script, 0x51)
+
+	codeSepPos := uint32(NoCodeSeparator)
+	if len(codeSeps) != 0 && rng.Intn(4) != 0 {
+		codeSepPos = codeSeps[rng.Intn(len(codeSeps))]
+	}
+	scriptCode, err := ScriptCode(script, codeSepPos)
+	if err != nil {
+		panic(err)
+	}
+	if codeSepPos == NoCodeSeparator {
+		return scriptCode, "P2WSH"
+	}
+	return scriptCode, fmt.Sprintf("P2WSH from OP_CODESEPARATOR %d",
+		codeSepPos)
+}
+
+// RandomVectors returns vectors of count random transactions derived from a
+// math/rand source with the seed. Each transaction has a vector for every
+// standard sighash type of one of its inputs, and for two sighash types
+// that aren't standard. Inputs without an output of the same index give
+// vectors of SIGHASH_SINGLE that sign no output.
+func RandomVectors(rngSeed int64, count int) []WitnessVector {
+	rng := rand.New(rand.NewSource(rngSeed))
+	var vectors []WitnessVector
+	for n := 0; n < count; n++ {
+		tx := randomTx(rng)
+		i := rng.Intn(len(tx.TxIn))
+		scriptCode, kind := randomScriptCode(rng)
+		amount := rng.Int63n(21e14 + 1)
+
+		hashTypes := append([]HashType{0, HashType(rng.Uint32())},
+			HashTypes...)
+		for _, hashType := range hashTypes {
+			comment := fmt.Sprintf("%v, %v, input %d of %d, %d "+
+				"outputs", hashType, kind, i, len(tx.TxIn),
+				len(tx.TxOut))
+			vectors = append(vectors, newWitnessVector(tx, i,
+				scriptCode, amount, hashType, comment))
+		}
+	}
+	return vectors
+}
+
+// CheckVector computes the preimage and signature hash of the vector's
+// input and checks them.
+func CheckVector(v WitnessVector) error {
+	tx, err := parseTx(v.Tx)
+	if err != nil {
+		return err
+	}
+	preimage, err := NewWitnessHashes(tx).Preimage(v.Index, v.ScriptCode,
+		v.Amount, v.HashType)
+	switch {
+	case err != nil:
+		return err
+	case !bytes.Equal(preimage, v.Preimage):
+		return fmt.Errorf("%w: preimage %x, expected %x",
+			ErrVectorMismatch, preimage, v.Preimage)
+	}
+	sigHash := doubleHash(preimage)
+	if !bytes.Equal(sigHash[:], v.SigHash) {
+		return fmt.Errorf("%w: signature hash %x, expected %x",
+			ErrVectorMismatch, sigHash, v.SigHash)
+	}
+	return nil
+}
+
+// The quirks of legacy signature hashes that vectors name.
+const (
+	quirkSingleBug     = "SIGHASH_SINGLE bug"
+	quirkFindAndDelete = "FindAndDelete"
+	quirkCodeSeparator = "OP_CODESEPARATOR"
+	quirkBadScript     = "unparsable script"
+)
+
+// LegacyVector is the legacy signature hash of an input of a transaction,
+// with the preimage it hashes.
+type LegacyVector struct {
+	// Tx is the serialized transaction, without witnesses.
+	Tx    []byte
+	Index int
+
+	// Script is the script of the input from the last OP_CODESEPARATOR
+	// executed on, and Sig the signature checked, whose pushes
+	// FindAndDelete removes from it for the script code, or nil.
+	Script []byte
+	Sig    []byte
+
+	// Preimage is nil for the SIGHASH_SINGLE bug, whose SigHash is
+	// SingleBugHash.
+	HashType HashType
+	Preimage []byte
+	SigHash  []byte
+
+	// Quirks names the historical quirks the signature hash goes
+	// through: "SIGHASH_SINGLE bug", "FindAndDelete", "OP_CODESEPARATOR"
+	// for the removal of code separators from the script code, and
+	// "unparsable script".
+	Quirks []string
+
+	// Comment describes what the vector exercises.
+	Comment string
+}
+
+// legacyQuirks returns the quirks the legacy signature hash of input i of
+// the transaction goes through.
+func legacyQuirks(tx *wire.MsgTx, i int, script, sig []byte,
+	hashType HashType) []string {
+
+	if hashType.outputType() == Single && i >= len(tx.TxOut) {
+		return []string{quirkSingleBug}
+	}
+	var quirks []string
+	scriptCode, found := FindAndDelete(script, sig)
+	if found != 0 {
+		quirks = append(quirks, quirkFindAndDelete)
+	}
+	codeSeps, parses := legacyCodeSeps(scriptCode)
+	if codeSeps != 0 {
+		quirks = append(quirks, quirkCodeSeparator)
+	}
+	if !parses {
+		quirks = append(quirks, quirkBadScript)
+	}
+	return quirks
+}
+
+// newLegacyVector computes the legacy vector of input i of the
+// transaction.
+func newLegacyVector(tx *wire.MsgTx, i int, script, sig []byte,
+	hashType HashType, comment string) LegacyVector {
+
+	scriptCode, _ := FindAndDelete(script, sig)
+	preimage, err := LegacyPreimage(tx, i, scriptCode, hashType)
+	if err != nil && !errors.Is(err, ErrNoSingleOutput) {
+		panic(err)
+	}
+	sigHash, err := LegacySigHash(tx, i, scriptCode, hashType)
+	if err != nil {
+		panic(err)
+	}
+	return LegacyVector{
+		Tx:       serializeTx(tx),
+		Index:    i,
+		Script:   script,
+		Sig:      sig,
+		HashType: hashType,
+		Preimage: preimage,
+		SigHash:  sigHash[:],
+		Quirks:   legacyQuirks(tx, i, script, sig, hashType),
+		Comment:  comment,
+	}
+}
+
+// randomLegacyScript returns a random script of signature checks, pushes,
+// other opcodes and OP_CODESEPARATORs, which pushes the signature now and
+// then if there is one, and ends inside a push now and then.
+func randomLegacyScript(rng *rand.Rand, sig []byte) []byte {
+	var script []byte
+	for n := 1 + rng.Intn(12); n > 0; n-- {
+		switch rng.Intn(6) {
+		case 0:
+			script = append(script, opCodeSeparator)
+		case 1:
+			script = append(script, pushData(randomBytes(rng,
+				rng.Intn(90)))...)
+		case 2:
+			if sig != nil {
+				script = append(script, pushData(sig)...)
+			}
+		case 3:
+			script = append(script, 0xac)
+		default:
+			script = append(script, byte(0x4f+rng.Intn(0xb1)))
+		}
+	}
+	if rng.Intn(8) == 0 {
+		push := pushData(randomBytes(rng, 1+rng.Intn(90)))
+		script = append(script, push[:rng.Intn(len(push)-1)+1]...)
+	}
+	return script
+}
+
+// LegacyVectors returns vectors of the historical quirks of legacy
+// signature hashes and of the sighash types that combine with
+// SIGHASH_ANYONECANPAY, followed by those of count random transactions,
+// derived from a math/rand source with the seed. Each random transaction
+// has a vector for every standard sighash type of one of its inputs, and
+// for three sighash types that aren't standard.
+func LegacyVectors(rngSeed int64, count int) []LegacyVector {
+	rng := rand.New(rand.NewSource(rngSeed))
+	sig := randomBytes(rng, 71)
+	noOutput := newRandomTx(rng, 3, 1)
+	outputs := newRandomTx(rng, 3, 3)
+	p2pkh := PubKeyHashScriptCode(randomBytes(rng, 20))
+
+	// Pushes of the signature are removed only where an opcode starts
+	// and with the smallest push opcode, even from a script that stops
+	// parsing after them.
+	sigPush := pushData(sig)
+	nonMinimal := append([]byte{opPushData1, byte(len(sig))}, sig...)
+	hidden := pushData(append(append([]byte{0x01}, sigPush...), 0xac))
+	truncated := append(append([]byte(nil), sigPush...), 0x10, 0x01)
+
+	vectors := []LegacyVector{
+		newLegacyVector(noOutput, 2, p2pkh, nil, Single,
+			"SIGHASH_SINGLE without an output signs 1"),
+		newLegacyVector(noOutput, 1, p2pkh, nil, Single|AnyoneCanPay,
+			"SINGLE|ANYONECANPAY without an output signs 1"),
+		newLegacyVector(noOutput, 0, p2pkh, nil, Single,
+			"SIGHASH_SINGLE of the only output"),
+		newLegacyVector(outputs, 2, p2pkh, nil, Single,
+			"SIGHASH_SINGLE blanking the outputs before"),
+		newLegacyVector(outputs, 2, p2pkh, nil, Single|AnyoneCanPay,
+			"SIGHASH_SINGLE|ANYONECANPAY of the last output"),
+		newLegacyVector(outputs, 1, p2pkh, nil, None,
+			"SIGHASH_NONE zeroing the other sequences"),
+		newLegacyVector(outputs, 1, p2pkh, nil, None|AnyoneCanPay,
+			"SIGHASH_NONE|ANYONECANPAY signing only the input"),
+		newLegacyVector(outputs, 1, p2pkh, nil, All|AnyoneCanPay,
+			"SIGHASH_ALL|ANYONECANPAY signing only the input"),
+		newLegacyVector(outputs, 0, p2pkh, nil, 0,
+			"sighash type 0 signing as SIGHASH_ALL"),
+		newLegacyVector(outputs, 0, p2pkh, nil, AnyoneCanPay,
+			"sighash type 0x80 signing as ALL|ANYONECANPAY"),
+		newLegacyVector(outputs, 2, p2pkh, nil, 0x23,
+			"sighash type 0x23 signing as SIGHASH_SINGLE"),
+		newLegacyVector(outputs, 0, append([]byte{opCodeSeparator},
+			append(p2pkh, opCodeSeparator)...), nil, All,
+			"OP_CODESEPARATORs left out of the script code"),
+		newLegacyVector(outputs, 0, []byte{0x02, opCodeSeparator, 0xab,
+			0xac}, nil, All,
+			"OP_CODESEPARATORs pushed as data kept"),
+		newLegacyVector(outputs, 0, []byte{opCodeSeparator, 0xac,
+			opPushData1}, nil, All,
+			"push opcode without a size ending the script"),
+		newLegacyVector(outputs, 0, []byte{opCodeSeparator, 0xac, 0x10,
+			0x01, 0x02}, nil, All,
+			"push past the end of the script"),
+		newLegacyVector(outputs, 0, append(append(sigPush, sigPush...),
+			0xac), sig, All, "signature pushes removed"),
+		newLegacyVector(outputs, 0, append(nonMinimal, 0xac), sig, All,
+			"push of the signature with OP_PUSHDATA1 kept"),
+		newLegacyVector(outputs, 0, hidden, sig, All,
+			"push of the signature inside another push kept"),
+		newLegacyVector(outputs, 0, truncated, sig, All,
+			"signature removed before a push past the end"),
+	}
+
+	for n := 0; n < count; n++ {
+		tx := randomTx(rng)
+		i := rng.Intn(len(tx.TxIn))
+		var sig []byte
+		if rng.Intn(2) == 0 {
+			sig = randomBytes(rng, 70+rng.Intn(4))
+		}
+		script := randomLegacyScript(rng, sig)
+
+		hashTypes := append([]HashType{0, AnyoneCanPay,
+			HashType(rng.Uint32())}, HashTypes...)
+		for _, hashType := range hashTypes {
+			comment := fmt.Sprintf("%v, input %d of %d, %d outputs",
+				hashType, i, len(tx.TxIn), len(tx.TxOut))
+			vectors = append(vectors, newLegacyVector(tx, i, script,
+				sig, hashType, comment))
+		}
+	}
+	return vectors
+}
+
+// CheckLegacyVector computes the legacy preimage and signature hash of the
+// vector's input and checks them, and the quirks the vector names.
+func CheckLegacyVector(v LegacyVector) error {
+	tx, err := parseTx(v.Tx)
+	if err != nil {
+		return err
+	}
+	scriptCode, _ := FindAndDelete(v.Script, v.Sig)
+	preimage, err := LegacyPreimage(tx, v.Index, scriptCode, v.HashType)
+	switch {
+	case err != nil && !errors.Is(err, ErrNoSingleOutput):
+		return err
+	case !bytes.Equal(preimage, v.Preimage):
+		return fmt.Errorf("%w: preimage %x, expected %x",
+			ErrVectorMismatch, preimage, v.Preimage)
+	}
+	sigHash, err := LegacySigHash(tx, v.Index, scriptCode, v.HashType)
+	switch {
+	case err != nil:
+		return err
+	case !bytes.Equal(sigHash[:], v.SigHash):
+		return fmt.Errorf("%w: signature hash %x, expected %x",
+			ErrVectorMismatch, sigHash, v.SigHash)
+	}
+	quirks := legacyQuirks(tx, v.Index, v.Script, v.Sig, v.HashType)
+	if fmt.Sprint(quirks) != fmt.Sprint(v.Quirks) {
+		return fmt.Errorf("%w: quirks %q, expected %q",
+			ErrVectorMismatch, quirks, v.Quirks)
+	}
+	return nil
+}
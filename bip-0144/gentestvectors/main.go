@@ -0,0 +1,164 @@
+// This program writes test vectors for the witnesstx package to
+// serialization.json: transactions in the witness and legacy serializations
+// of BIP 144, each parsed with and without witnesses allowed, starting with
+// the cases parsers get wrong, such as transactions without inputs, whose
+// legacy serialization starts like the witness one, followed by random
+// transactions. The random vectors depend only on -seed and -count, so they
+// can be regenerated by anyone:
+//
+//	gentestvectors -count 50 -seed 144
+//
+// The file uses the layout of the BIP 158 vectors: a JSON array whose first
+// row names the columns, followed by one row per vector. The bytes parsed
+// and the legacy serialization of the transaction they read as are in hex,
+// and Witness says whether witnesses are allowed. The Txid and Wtxid are in
+// the byte order of block explorers, and a vector that fails to parse gives
+// the error instead of them. Pass -check to verify an existing file against
+// the package instead:
+//
+//	gentestvectors -check serialization.json
+//
+// The program lives in a directory of its own since the witnesstx package
+// sits at the root of the module.
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	witnesstx "github.com/christsim/bips/bip-0144"
+	"github.com/christsim/bips/internal/vectorfile"
+)
+
+// vectorColumns is the header row of the vector file.
+const vectorColumns = "Raw,Witness,Stripped,Txid,Wtxid,Error,Comment"
+
+type JSONTestWriter struct {
+	writer          io.Writer
+	firstRowWritten bool
+}
+
+func NewJSONTestWriter(writer io.Writer) *JSONTestWriter {
+	return &JSONTestWriter{writer: writer}
+}
+
+func (w *JSONTestWriter) WriteComment(comment string) error {
+	return w.WriteTestCase([]interface{}{comment})
+}
+
+func (w *JSONTestWriter) WriteTestCase(row []interface{}) error {
+	var err error
+	if w.firstRowWritten {
+		_, err = io.WriteString(w.writer, ",\n")
+	} else {
+		_, err = io.WriteString(w.writer, "[\n")
+		w.firstRowWritten = true
+	}
+	if err != nil {
+		return err
+	}
+
+	rowBytes, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.writer.Write(rowBytes)
+	return err
+}
+
+func (w *JSONTestWriter) Close() error {
+	if !w.firstRowWritten {
+		return nil
+	}
+
+	_, err := io.WriteString(w.writer, "\n]\n")
+	return err
+}
+
+func main() {
+	out := flag.String("out", "serialization.json", "file to write the "+
+		"vectors to")
+	count := flag.Int("count", 50, "number of random transactions to "+
+		"write vectors of")
+	seed := flag.Int64("seed", 144, "seed of the random vectors")
+	check := flag.String("check", "", "vector file to check instead of "+
+		"writing one")
+	flag.Parse()
+
+	var err error
+	if *check != "" {
+		err = checkFile(*check)
+	} else {
+		err = writeFile(*out, *seed, *count)
+	}
+	if err != nil {
+		fmt.Println("Error: ", err.Error())
+		os.Exit(1)
+	}
+}
+
+// writeFile writes the edge vectors and the vectors of count random
+// transactions to out.
+func writeFile(out string, seed int64, count int) error {
+	vectors := append(witnesstx.EdgeVectors(),
+		witnesstx.RandomVectors(seed, count)...)
+
+	file, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := NewJSONTestWriter(file)
+	if err := writer.WriteComment(vectorColumns); err != nil {
+		return err
+	}
+	for _, v := range vectors {
+		err := writer.WriteTestCase([]interface{}{
+			hex.EncodeToString(v.Raw),
+			v.Witness,
+			hex.EncodeToString(v.Stripped),
+			v.Txid,
+			v.Wtxid,
+			vectorfile.ErrorString(v.Err),
+			v.Comment,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote %d vectors\n", len(vectors))
+	return nil
+}
+
+// checkFile checks each vector of the file with witnesstx.CheckVector.
+func checkFile(path string) error {
+	rows, err := vectorfile.ReadRows(path, 7)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		var v witnesstx.Vector
+		var errText string
+		err := vectorfile.DecodeRow(row, &v.Raw, &v.Witness,
+			&v.Stripped, &v.Txid, &v.Wtxid, &errText, &v.Comment)
+		if err != nil {
+			return err
+		}
+		v.Err = vectorfile.ParseError(errText)
+		if err := witnesstx.CheckVector(v); err != nil {
+			return fmt.Errorf("%v: %v", v.Comment, err)
+		}
+	}
+	fmt.Printf("%d vectors OK\n", len(rows))
+	return nil
+}
@@ -0,0 +1,263 @@
+package witnesstx
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/christsim/bips/internal/vectorfile"
+)
+
+// ErrVectorMismatch is returned by CheckVector when the package doesn't
+// parse a vector's bytes into the transaction it expects.
+var ErrVectorMismatch = errors.New("witnesstx: vector mismatch")
+
+// Vector is a serialized transaction parsed with or without witnesses
+// allowed, with the transaction it reads as or the error it fails with. The
+// transaction of a vector that parses serializes back to its bytes.
+type Vector struct {
+	Raw     []byte
+	Witness bool
+
+	// Stripped is the legacy serialization of the transaction, and Txid
+	// and Wtxid its hashes in the byte order of block explorers. They
+	// are empty if parsing fails.
+	Stripped []byte
+	Txid     string
+	Wtxid    string
+
+	// Err is the error parsing fails with, or nil.
+	Err error
+
+	// Comment describes what the vector exercises.
+	Comment string
+}
+
+// newVector parses raw for the vector.
+func newVector(raw []byte, witness bool, comment string) Vector {
+	v := Vector{Raw: raw, Witness: witness, Comment: comment}
+	tx, err := Parse(raw, witness)
+	if err != nil {
+		v.Err = err
+		return v
+	}
+	v.Stripped = Serialize(tx, false)
+	v.Txid = tx.TxHash().String()
+	v.Wtxid = tx.WitnessHash().String()
+	return v
+}
+
+// newVectors returns the vectors of raw parsed with and without witnesses
+// allowed.
+func newVectors(raw []byte, comment string) []Vector {
+	return []Vector{
+		newVector(raw, true, comment),
+		newVector(raw, false, comment+", read without witnesses"),
+	}
+}
+
+// join returns the concatenation of the parts.
+func join(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+// edgeTx returns the transaction the edge vectors are built from: one of
+// two inputs, the first with a witness of two items and the second without
+// one, and two outputs.
+func edgeTx() *wire.MsgTx {
+	tx := wire.NewMsgTx(2)
+	tx.LockTime = 500000
+	for i := 0; i < 2; i++ {
+		fill := []byte{byte(0x11 * (i + 1))}
+		hash := chainhash.Hash(bytes.Repeat(fill, chainhash.HashSize))
+		tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&hash, uint32(i)), nil,
+			nil))
+	}
+	tx.TxIn[0].Witness = wire.TxWitness{
+		bytes.Repeat([]byte{0x30}, 71), bytes.Repeat([]byte{0x02}, 33),
+	}
+	tx.TxIn[1].SignatureScript = []byte{0x51}
+	tx.AddTxOut(wire.NewTxOut(100000, append([]byte{0x00, 0x14},
+		bytes.Repeat([]byte{0x33}, 20)...)))
+	tx.AddTxOut(wire.NewTxOut(0, []byte{0x6a}))
+	return tx
+}
+
+// EdgeVectors returns vectors of the cases parsers get wrong: transactions
+// without inputs, whose legacy serialization starts like the witness one,
+// flags other than the witness flag, the witness flag without witnesses,
+// and malformed counts and sizes.
+func EdgeVectors() []Vector {
+	tx := edgeTx()
+	full := Serialize(tx, true)
+	stripped := Serialize(tx, false)
+
+	// The serialization of the transaction splits into its version,
+	// marker and flag, inputs and outputs, witnesses and lock time.
+	version, inputs := full[:4], full[6:]
+	var vin, vout int
+	for _, txIn := range tx.TxIn {
+		vin += 41 + len(txIn.SignatureScript)
+	}
+	for _, txOut := range tx.TxOut {
+		vout += 9 + len(txOut.PkScript)
+	}
+	inputs, outputs := inputs[:1+vin], inputs[1+vin:]
+	outputs, witnesses := outputs[:1+vout], outputs[1+vout:]
+	witnesses, lockTime := witnesses[:len(witnesses)-4],
+		witnesses[len(witnesses)-4:]
+	witnessFlag := []byte{Marker, WitnessFlag}
+	outPoint := inputs[1 : 1+chainhash.HashSize+4]
+
+	noInputs := wire.NewMsgTx(1)
+	noInputs.AddTxOut(tx.TxOut[0])
+	twoOutputs := noInputs.Copy()
+	twoOutputs.AddTxOut(tx.TxOut[1])
+
+	big := tx.Copy()
+	big.TxIn[1].Witness = wire.TxWitness{nil, bytes.Repeat([]byte{0x5a},
+		0x1234)}
+
+	var vectors []Vector
+	for _, c := range []struct {
+		raw     []byte
+		comment string
+	}{
+		{full, "witness serialization"},
+		{stripped, "legacy serialization of a transaction with " +
+			"witnesses"},
+		{Serialize(big, true), "witness item whose size takes 3 bytes"},
+		{join(version, []byte{0x00, 0x00}, lockTime), "no inputs or " +
+			"outputs"},
+		{Serialize(noInputs, true), "no inputs and one output, whose " +
+			"count reads as the witness flag"},
+		{Serialize(twoOutputs, true), "no inputs and two outputs, " +
+			"whose count reads as an unknown flag"},
+		{join(version, witnessFlag, inputs, outputs, []byte{0x00, 0x00},
+			lockTime), "witness flag with only empty witnesses"},
+		{join(version, []byte{Marker, 0x02}, inputs, outputs, lockTime),
+			"unknown flag 0x02"},
+		{join(version, []byte{Marker, 0x03}, inputs, outputs, witnesses,
+			lockTime), "witness flag with unknown flag 0x02"},
+		{join(full, []byte{0x00}), "witness serialization followed " +
+			"by a byte"},
+		{join(stripped, []byte{0x00}), "legacy serialization " +
+			"followed by a byte"},
+		{full[:len(full)-4-20], "witness serialization cut off in a " +
+			"witness"},
+		{join(version, []byte{0xfd, 0x02, 0x00}, inputs[1:], outputs,
+			lockTime), "input count in 3 bytes"},
+		{join(version, witnessFlag, inputs, outputs,
+			[]byte{0xfe, 0x02, 0x00, 0x00, 0x00}, witnesses[1:],
+			lockTime), "witness item count in 5 bytes"},
+		{join(version, []byte{0x01}, outPoint,
+			[]byte{0xfe, 0x01, 0x00, 0x00, 0x02}, lockTime),
+			"script size past the maximum"},
+	} {
+		vectors = append(vectors, newVectors(c.raw, c.comment)...)
+	}
+	return vectors
+}
+
+// randomBytes returns n random bytes.
+func randomBytes(rng *rand.Rand, n int) []byte {
+	b := make([]byte, n)
+	rng.Read(b)
+	return b
+}
+
+// randomTx returns a random transaction of up to 4 inputs, each with a
+// witness or not, and up to 4 outputs.
+func randomTx(rng *rand.Rand) *wire.MsgTx {
+	tx := wire.NewMsgTx(int32(rng.Uint32()))
+	if rng.Intn(2) == 0 {
+		tx.Version = 2
+	}
+	tx.LockTime = rng.Uint32()
+
+	for i := 1 + rng.Intn(4); i > 0; i-- {
+		var hash chainhash.Hash
+		rng.Read(hash[:])
+		txIn := wire.NewTxIn(wire.NewOutPoint(&hash, rng.Uint32()),
+			randomBytes(rng, rng.Intn(3)*rng.Intn(110)), nil)
+		txIn.Sequence = rng.Uint32()
+		if rng.Intn(3) != 0 {
+			txIn.Witness = make(wire.TxWitness, rng.Intn(5))
+			for j := range txIn.Witness {
+				txIn.Witness[j] = randomBytes(rng,
+					rng.Intn(2)*rng.Intn(300))
+			}
+		}
+		tx.AddTxIn(txIn)
+	}
+	for i := rng.Intn(5); i > 0; i-- {
+		tx.AddTxOut(wire.NewTxOut(rng.Int63n(1e15),
+			randomBytes(rng, rng.Intn(60))))
+	}
+	return tx
+}
+
+// RandomVectors returns vectors of count random transactions derived from
+// a math/rand source with the seed: their witness and legacy serializations
+// and the legacy serialization of the transaction without its inputs, each
+// parsed with and without witnesses allowed.
+func RandomVectors(rngSeed int64, count int) []Vector {
+	rng := rand.New(rand.NewSource(rngSeed))
+	var vectors []Vector
+	for n := 0; n < count; n++ {
+		tx := randomTx(rng)
+		noInputs := tx.Copy()
+		noInputs.TxIn = nil
+
+		witness := "without witnesses"
+		if tx.HasWitness() {
+			witness = "with witnesses"
+		}
+		vectors = append(vectors, newVectors(Serialize(tx, true),
+			"random transaction "+witness)...)
+		if tx.HasWitness() {
+			vectors = append(vectors, newVectors(Serialize(tx,
+				false), "legacy serialization of a random "+
+				"transaction")...)
+		}
+		vectors = append(vectors, newVectors(Serialize(noInputs, false),
+			"random transaction without inputs")...)
+	}
+	return vectors
+}
+
+// CheckVector parses the vector's bytes and checks the transaction they
+// read as, or the error parsing fails with, and that the transaction
+// serializes back to them.
+func CheckVector(v Vector) error {
+	tx, err := Parse(v.Raw, v.Witness)
+	if !vectorfile.SameError(err, v.Err) {
+		return fmt.Errorf("%w: error %v, expected %v",
+			ErrVectorMismatch, err, v.Err)
+	}
+	if err != nil {
+		return nil
+	}
+
+	if raw := Serialize(tx, v.Witness); !bytes.Equal(raw, v.Raw) {
+		return fmt.Errorf("%w: serialized back as %x",
+			ErrVectorMismatch, raw)
+	}
+	stripped := Serialize(tx, false)
+	if !bytes.Equal(stripped, v.Stripped) {
+		return fmt.Errorf("%w: legacy serialization %x, expected %x",
+			ErrVectorMismatch, stripped, v.Stripped)
+	}
+	if txid := tx.TxHash().String(); txid != v.Txid {
+		return fmt.Errorf("%w: txid %v, expected %v",
+			ErrVectorMismatch, txid, v.Txid)
+	}
+	if wtxid := tx.WitnessHash().String(); wtxid != v.Wtxid {
+		return fmt.Errorf("%w: wtxid %v, expected %v",
+			ErrVectorMismatch, wtxid, v.Wtxid)
+	}
+	return nil
+}
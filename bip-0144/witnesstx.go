@@ -0,0 +1,299 @@
+// Package witnesstx implements the transaction serialization of BIP 144,
+// which carries the witnesses of a transaction's inputs after its outputs,
+// marked by a zero byte where the input count would be and a flag byte.
+//
+//	b := witnesstx.Serialize(tx, true)
+//	tx, err := witnesstx.Parse(b, true)
+//
+// Parse follows Bitcoin Core rather than the BIP: an input count of zero
+// is taken as the marker whenever witnesses are allowed, so the legacy
+// serialization of a transaction without inputs reads differently with and
+// without them, and a transaction without inputs or outputs reads the same
+// both ways. Transactions with the flag but no witnesses, and flags other
+// than 1, are rejected.
+package witnesstx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// Marker is the byte the witness serialization puts where the input count
+// of the legacy one would be.
+const Marker = 0x00
+
+// WitnessFlag is the flag byte of the witness serialization, whose low bit
+// says the witnesses follow the outputs. The other bits are reserved.
+const WitnessFlag = 0x01
+
+// MaxSize is the largest count or size a compact size may give, as in
+// Bitcoin Core.
+const MaxSize = 0x02000000
+
+var (
+	// ErrTruncated is returned by Parse for a transaction that ends
+	// early.
+	ErrTruncated = errors.New("witnesstx: truncated transaction")
+
+	// ErrNonCanonicalSize is returned by Parse for a count or size that
+	// isn't in its shortest compact size encoding.
+	ErrNonCanonicalSize = errors.New("witnesstx: non-canonical compact " +
+		"size")
+
+	// ErrSizeTooLarge is returned by Parse for a count or size larger
+	// than MaxSize.
+	ErrSizeTooLarge = errors.New("witnesstx: compact size too large")
+
+	// ErrSuperfluousWitness is returned by Parse for a transaction with
+	// the witness flag whose inputs all have empty witnesses.
+	ErrSuperfluousWitness = errors.New("witnesstx: superfluous witness " +
+		"record")
+
+	// ErrUnknownFlags is returned by Parse for a transaction with a flag
+	// byte other than WitnessFlag.
+	ErrUnknownFlags = errors.New("witnesstx: unknown optional data")
+
+	// ErrTrailingData is returned by Parse for bytes after the lock time.
+	ErrTrailingData = errors.New("witnesstx: data after the transaction")
+)
+
+// compactSize returns the compact size encoding of n.
+func compactSize(n int) []byte {
+	switch {
+	case n < 0xfd:
+		return []byte{byte(n)}
+	case n <= 0xffff:
+		return []byte{0xfd, byte(n), byte(n >> 8)}
+	case n <= 0xffffffff:
+		return []byte{0xfe, byte(n), byte(n >> 8), byte(n >> 16),
+			byte(n >> 24)}
+	}
+	return []byte{0xff, byte(n), byte(n >> 8), byte(n >> 16), byte(n >> 24),
+		byte(n >> 32), byte(n >> 40), byte(n >> 48), byte(n >> 56)}
+}
+
+// writeVarBytes writes b prefixed with its size.
+func writeVarBytes(w *bytes.Buffer, b []byte) {
+	w.Write(compactSize(len(b)))
+	w.Write(b)
+}
+
+// Serialize returns the serialization of the transaction: the witness one
+// if witness is set and any of its inputs has a witness, and the legacy one
+// otherwise, which the txid hashes.
+func Serialize(tx *wire.MsgTx, witness bool) []byte {
+	witness = witness && tx.HasWitness()
+
+	var b bytes.Buffer
+	var buf [8]byte
+	binary.LittleEndian.PutUint32(buf[:4], uint32(tx.Version))
+	b.Write(buf[:4])
+	if witness {
+		b.Write([]byte{Marker, WitnessFlag})
+	}
+
+	b.Write(compactSize(len(tx.TxIn)))
+	for _, txIn := range tx.TxIn {
+		b.Write(txIn.PreviousOutPoint.Hash[:])
+		binary.LittleEndian.PutUint32(buf[:4],
+			txIn.PreviousOutPoint.Index)
+		b.Write(buf[:4])
+		writeVarBytes(&b, txIn.SignatureScript)
+		binary.LittleEndian.PutUint32(buf[:4], txIn.Sequence)
+		b.Write(buf[:4])
+	}
+	b.Write(compactSize(len(tx.TxOut)))
+	for _, txOut := range tx.TxOut {
+		binary.LittleEndian.PutUint64(buf[:], uint64(txOut.Value))
+		b.Write(buf[:])
+		writeVarBytes(&b, txOut.PkScript)
+	}
+
+	if witness {
+		for _, txIn := range tx.TxIn {
+			b.Write(compactSize(len(txIn.Witness)))
+			for _, item := range txIn.Witness {
+				writeVarBytes(&b, item)
+			}
+		}
+	}
+	binary.LittleEndian.PutUint32(buf[:4], tx.LockTime)
+	b.Write(buf[:4])
+	return b.Bytes()
+}
+
+// reader reads the fields of a serialized transaction, keeping the first
+// error it runs into.
+type reader struct {
+	b   []byte
+	err error
+}
+
+// bytes returns the next n bytes, or nil after an error.
+func (r *reader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n > len(r.b) {
+		r.err = ErrTruncated
+		r.b = nil
+		return nil
+	}
+	b := r.b[:n:n]
+	r.b = r.b[n:]
+	return b
+}
+
+// uint32 reads a little endian uint32.
+func (r *reader) uint32() uint32 {
+	b := r.bytes(4)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(b)
+}
+
+// uint64 reads a little endian uint64.
+func (r *reader) uint64() uint64 {
+	b := r.bytes(8)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint64(b)
+}
+
+// compactSize reads a compact size, which must be canonical and no larger
+// than MaxSize.
+func (r *reader) compactSize() int {
+	b := r.bytes(1)
+	if b == nil {
+		return 0
+	}
+	var n, min uint64
+	switch b[0] {
+	case 0xfd:
+		if b := r.bytes(2); b != nil {
+			n, min = uint64(binary.LittleEndian.Uint16(b)), 0xfd
+		}
+	case 0xfe:
+		n, min = uint64(r.uint32()), 0x10000
+	case 0xff:
+		n, min = r.uint64(), 0x100000000
+	default:
+		return int(b[0])
+	}
+	switch {
+	case r.err != nil:
+		return 0
+	case n < min:
+		r.err = fmt.Errorf("%w: %d in %d bytes", ErrNonCanonicalSize,
+			n, len(compactSize(int(min))))
+		return 0
+	case n > MaxSize:
+		r.err = fmt.Errorf("%w: %d", ErrSizeTooLarge, n)
+		return 0
+	}
+	return int(n)
+}
+
+// varBytes reads bytes prefixed with their size.
+func (r *reader) varBytes() []byte {
+	b := r.bytes(r.compactSize())
+	if r.err != nil {
+		return nil
+	}
+	return b
+}
+
+// count reads the count of items of which each takes at least minSize
+// bytes, failing with ErrTruncated rather than allocating for more items
+// than the bytes left can hold.
+func (r *reader) count(minSize int) int {
+	n := r.compactSize()
+	if r.err == nil && n*minSize > len(r.b) {
+		r.err = ErrTruncated
+		return 0
+	}
+	return n
+}
+
+// inputs reads the inputs of a transaction.
+func (r *reader) inputs() []*wire.TxIn {
+	txIns := make([]*wire.TxIn, r.count(41))
+	for i := range txIns {
+		txIn := &wire.TxIn{}
+		copy(txIn.PreviousOutPoint.Hash[:], r.bytes(chainhash.HashSize))
+		txIn.PreviousOutPoint.Index = r.uint32()
+		txIn.SignatureScript = r.varBytes()
+		txIn.Sequence = r.uint32()
+		txIns[i] = txIn
+	}
+	return txIns
+}
+
+// outputs reads the outputs of a transaction.
+func (r *reader) outputs() []*wire.TxOut {
+	txOuts := make([]*wire.TxOut, r.count(9))
+	for i := range txOuts {
+		value := int64(r.uint64())
+		txOuts[i] = wire.NewTxOut(value, r.varBytes())
+	}
+	return txOuts
+}
+
+// Parse returns the transaction serialized in b, in the witness or legacy
+// serialization if witness is set and in the legacy one otherwise, as
+// Bitcoin Core reads them. A transaction with the marker is only taken to
+// have no inputs if its flag is zero, in which case it has no outputs
+// either, and a transaction with the witness flag must have a witness.
+// Parse fails if b holds anything after the transaction.
+func Parse(b []byte, witness bool) (*wire.MsgTx, error) {
+	r := &reader{b: b}
+	tx := &wire.MsgTx{Version: int32(r.uint32())}
+
+	var flags byte
+	tx.TxIn = r.inputs()
+	if len(tx.TxIn) == 0 && witness {
+		if b := r.bytes(1); b != nil {
+			flags = b[0]
+		}
+		if flags != 0 {
+			tx.TxIn = r.inputs()
+			tx.TxOut = r.outputs()
+		}
+	} else {
+		tx.TxOut = r.outputs()
+	}
+
+	if flags&WitnessFlag != 0 && witness {
+		flags ^= WitnessFlag
+		for _, txIn := range tx.TxIn {
+			txIn.Witness = make(wire.TxWitness, r.count(1))
+			for i := range txIn.Witness {
+				txIn.Witness[i] = r.varBytes()
+			}
+		}
+		if r.err == nil && !tx.HasWitness() {
+			return nil, ErrSuperfluousWitness
+		}
+	}
+	if r.err == nil && flags != 0 {
+		return nil, fmt.Errorf("%w: flags 0x%02x", ErrUnknownFlags,
+			flags)
+	}
+
+	tx.LockTime = r.uint32()
+	if r.err != nil {
+		return nil, r.err
+	}
+	if len(r.b) != 0 {
+		return nil, fmt.Errorf("%w: %d bytes", ErrTrailingData,
+			len(r.b))
+	}
+	return tx, nil
+}
@@ -0,0 +1,157 @@
+// Package compactblocks implements the compact block relay of BIP 152: the
+// sendcmpct, cmpctblock, getblocktxn and blocktxn messages, the short
+// transaction IDs of compact blocks, and the reconstruction of blocks from
+// them and the transactions of a mempool.
+//
+// The sender of a block announces it with a cmpctblock carrying its header,
+// a random nonce, the prefilled transactions it expects the receiver lacks,
+// the coinbase always among them, and the 6 byte short IDs of the rest,
+// keyed by the header and nonce:
+//
+//	msg, err := compactblocks.NewMsgCmpctBlock(block, nonce,
+//		compactblocks.Version2, nil)
+//
+// The receiver fills in what its mempool has, asks for the rest with
+// getblocktxn, and completes the block with the blocktxn answering it:
+//
+//	partial, err := compactblocks.NewPartialBlock(msg, version, mempool)
+//	request := partial.Request()
+//	...
+//	block, err := partial.Fill(response)
+//
+// Version 1 compact blocks identify transactions by their txid and carry
+// them without witnesses, version 2 by their wtxid and with witnesses. The
+// version picks the message encoding of the transactions, as Encoding
+// returns it.
+//
+// Every message type has Serialize and Deserialize methods for its payload
+// alone, those of the messages carrying transactions in the witness
+// encoding, and also implements wire.Message, so it can be sent with
+// wire.WriteMessage.
+package compactblocks
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+const (
+	// CmdSendCmpct, CmdCmpctBlock, CmdGetBlockTxn and CmdBlockTxn are the
+	// commands of the BIP 152 messages.
+	CmdSendCmpct   = "sendcmpct"
+	CmdCmpctBlock  = "cmpctblock"
+	CmdGetBlockTxn = "getblocktxn"
+	CmdBlockTxn    = "blocktxn"
+
+	// Version1 and Version2 are the versions of compact blocks, which
+	// identify transactions by txid and by wtxid.
+	Version1 = 1
+	Version2 = 2
+
+	// ShortIDSize is the size of the short ID of a transaction.
+	ShortIDSize = 6
+
+	// MaxBlockTxs is the largest number of transactions a compact block
+	// may hold, those of the smallest size filling a block.
+	MaxBlockTxs = 100000
+
+	// maxIndex is the largest transaction index that messages may carry.
+	maxIndex = 1<<16 - 1
+)
+
+var (
+	// ErrTooMany is returned when a message holds more items than the
+	// protocol allows.
+	ErrTooMany = errors.New("compactblocks: too many items in message")
+
+	// ErrInvalidIndex is returned for a transaction index that is out of
+	// range, or out of order.
+	ErrInvalidIndex = errors.New("compactblocks: invalid transaction index")
+
+	// ErrUnknownVersion is returned for a compact block version other
+	// than Version1 and Version2.
+	ErrUnknownVersion = errors.New("compactblocks: unknown version")
+
+	// ErrShortIDCollision is returned by NewPartialBlock for a compact
+	// block holding the same short ID twice, which must be fetched in
+	// full instead.
+	ErrShortIDCollision = errors.New("compactblocks: short ID collision")
+
+	// ErrBlockTxnMismatch is returned by PartialBlock.Fill for a blocktxn
+	// that doesn't answer the request of the block.
+	ErrBlockTxnMismatch = errors.New("compactblocks: blocktxn doesn't " +
+		"match request")
+
+	// ErrMerkleMismatch is returned by PartialBlock.Fill when the
+	// reconstructed block doesn't match the merkle root of its header,
+	// which a transaction of the mempool sharing the short ID of one of
+	// the block causes. The block must be fetched in full instead.
+	ErrMerkleMismatch = errors.New("compactblocks: merkle root mismatch")
+)
+
+// Encoding returns the message encoding of the transactions of compact
+// blocks of the version.
+func Encoding(version uint64) (wire.MessageEncoding, error) {
+	switch version {
+	case Version1:
+		return wire.BaseEncoding, nil
+	case Version2:
+		return wire.WitnessEncoding, nil
+	default:
+		return 0, fmt.Errorf("%w: %d", ErrUnknownVersion, version)
+	}
+}
+
+// Message is a BIP 152 message. Serialize and Deserialize handle the payload
+// alone, without the message header.
+type Message interface {
+	wire.Message
+
+	// Serialize writes the message payload to w.
+	Serialize(w io.Writer) error
+
+	// Deserialize reads the message payload from r.
+	Deserialize(r io.Reader) error
+}
+
+// MakeEmptyMessage returns an empty message of the type carrying the passed
+// command, or nil if the command isn't one of the BIP 152 messages.
+func MakeEmptyMessage(command string) Message {
+	switch command {
+	case CmdSendCmpct:
+		return &MsgSendCmpct{}
+	case CmdCmpctBlock:
+		return &MsgCmpctBlock{}
+	case CmdGetBlockTxn:
+		return &MsgGetBlockTxn{}
+	case CmdBlockTxn:
+		return &MsgBlockTxn{}
+	default:
+		return nil
+	}
+}
+
+// readCount reads a CompactSize count of at most max items.
+func readCount(r io.Reader, max int, items string) (int, error) {
+	count, err := wire.ReadVarInt(r, 0)
+	if err != nil {
+		return 0, err
+	}
+	if count > uint64(max) {
+		return 0, fmt.Errorf("%w: %d %v, max %d", ErrTooMany, count,
+			items, max)
+	}
+	return int(count), nil
+}
+
+// writeCount writes a CompactSize count of at most max items.
+func writeCount(w io.Writer, count, max int, items string) error {
+	if count > max {
+		return fmt.Errorf("%w: %d %v, max %d", ErrTooMany, count,
+			items, max)
+	}
+	return wire.WriteVarInt(w, 0, uint64(count))
+}
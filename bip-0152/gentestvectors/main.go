@@ -0,0 +1,285 @@
+// This program writes test vectors for the compactblocks package to
+// compact-blocks.json: the relay of the test blocks of the BIP 158 vectors
+// as compact blocks of both versions, with the cmpctblock, getblocktxn and
+// blocktxn payloads, to receivers missing none or some of the transactions.
+// The blocks are read from a BIP 158 vector file, so they needn't be
+// fetched from a node again, and the vectors depend only on the blocks and
+// -seed:
+//
+//	gentestvectors -blocks ../bip-0158/testnet-20.json -seed 152
+//
+// The file uses the layout of the BIP 158 vectors: a JSON array whose first
+// row names the columns, followed by one row per vector. Index lists are
+// comma separated. Pass -check to verify an existing file against the
+// package instead:
+//
+//	gentestvectors -check compact-blocks.json
+//
+// The program lives in a directory of its own since the compactblocks
+// package sits at the root of the module.
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcd/wire"
+	compactblocks "github.com/christsim/bips/bip-0152"
+	"github.com/christsim/bips/internal/vectorfile"
+)
+
+// vectorColumns is the header row of the vector file.
+const vectorColumns = "Version,Block,Nonce,Prefilled,Missing,CmpctBlock," +
+	"GetBlockTxn,BlockTxn,Comment"
+
+type JSONTestWriter struct {
+	writer          io.Writer
+	firstRowWritten bool
+}
+
+func NewJSONTestWriter(writer io.Writer) *JSONTestWriter {
+	return &JSONTestWriter{writer: writer}
+}
+
+func (w *JSONTestWriter) WriteComment(comment string) error {
+	return w.WriteTestCase([]interface{}{comment})
+}
+
+func (w *JSONTestWriter) WriteTestCase(row []interface{}) error {
+	var err error
+	if w.firstRowWritten {
+		_, err = io.WriteString(w.writer, ",\n")
+	} else {
+		_, err = io.WriteString(w.writer, "[\n")
+		w.firstRowWritten = true
+	}
+	if err != nil {
+		return err
+	}
+
+	rowBytes, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.writer.Write(rowBytes)
+	return err
+}
+
+func (w *JSONTestWriter) Close() error {
+	if !w.firstRowWritten {
+		return nil
+	}
+
+	_, err := io.WriteString(w.writer, "\n]\n")
+	return err
+}
+
+func main() {
+	blocks := flag.String("blocks",
+		vectorfile.RepoPath("bip-0158", "testnet-20.json"), "BIP 158 "+
+		"vector file to read the test blocks from")
+	out := flag.String("out", "compact-blocks.json", "file to write the "+
+		"vectors to")
+	seed := flag.Int64("seed", 152, "seed of the random vectors")
+	check := flag.String("check", "", "vector file to check instead of "+
+		"writing one")
+	flag.Parse()
+
+	var err error
+	if *check != "" {
+		err = checkFile(*check)
+	} else {
+		err = writeFile(*out, *blocks, *seed)
+	}
+	if err != nil {
+		fmt.Println("Error: ", err.Error())
+		os.Exit(1)
+	}
+}
+
+// readBlocks reads the blocks of a BIP 158 vector file, whose rows start
+// with the height, hash and serialization of a block, and names each by its
+// height.
+func readBlocks(path string) ([]*wire.MsgBlock, []string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	var rows [][]json.RawMessage
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return nil, nil, err
+	}
+
+	var blocks []*wire.MsgBlock
+	var names []string
+	for i, row := range rows {
+		if len(row) == 1 {
+			continue
+		}
+		if len(row) < 3 {
+			return nil, nil, fmt.Errorf("row %d: no block", i)
+		}
+		var height uint32
+		var blockHex string
+		if err := json.Unmarshal(row[0], &height); err != nil {
+			return nil, nil, fmt.Errorf("row %d: %v", i, err)
+		}
+		if err := json.Unmarshal(row[2], &blockHex); err != nil {
+			return nil, nil, fmt.Errorf("row %d: %v", i, err)
+		}
+		b, err := hex.DecodeString(blockHex)
+		if err != nil {
+			return nil, nil, fmt.Errorf("row %d: %v", i, err)
+		}
+		block := &wire.MsgBlock{}
+		if err := block.Deserialize(bytes.NewReader(b)); err != nil {
+			return nil, nil, fmt.Errorf("row %d: %v", i, err)
+		}
+		blocks = append(blocks, block)
+		names = append(names, fmt.Sprintf("Block %d", height))
+	}
+	if len(blocks) == 0 {
+		return nil, nil, errors.New("no blocks in " + path)
+	}
+	return blocks, names, nil
+}
+
+// formatIndexes returns the indexes as a comma separated list.
+func formatIndexes(indexes []uint32) string {
+	var b []byte
+	for i, index := range indexes {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = strconv.AppendUint(b, uint64(index), 10)
+	}
+	return string(b)
+}
+
+// writeFile writes the vectors of the blocks of the BIP 158 vector file at
+// blocksPath to out.
+func writeFile(out, blocksPath string, seed int64) error {
+	blocks, names, err := readBlocks(blocksPath)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := NewJSONTestWriter(file)
+	if err := writer.WriteComment(vectorColumns); err != nil {
+		return err
+	}
+	vectors := compactblocks.RandomVectors(seed, blocks, names)
+	for _, v := range vectors {
+		err := writer.WriteTestCase([]interface{}{
+			strconv.FormatUint(v.Version, 10),
+			hex.EncodeToString(v.Block),
+			strconv.FormatUint(v.Nonce, 10),
+			formatIndexes(v.Prefilled),
+			formatIndexes(v.Missing),
+			hex.EncodeToString(v.CmpctBlock),
+			hex.EncodeToString(v.GetBlockTxn),
+			hex.EncodeToString(v.BlockTxn),
+			v.Comment,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote %d vectors of %d blocks\n", len(vectors),
+		len(blocks))
+	return nil
+}
+
+// decodeHex decodes the hex columns of a row.
+func decodeHex(columns ...string) ([][]byte, error) {
+	decoded := make([][]byte, len(columns))
+	for i, s := range columns {
+		b, err := hex.DecodeString(s)
+		if err != nil {
+			return nil, err
+		}
+		decoded[i] = b
+	}
+	return decoded, nil
+}
+
+// parseIndexes parses a comma separated list of indexes.
+func parseIndexes(s string) ([]uint32, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var indexes []uint32
+	for _, field := range strings.Split(s, ",") {
+		index, err := strconv.ParseUint(field, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		indexes = append(indexes, uint32(index))
+	}
+	return indexes, nil
+}
+
+// checkFile checks each vector of the file with compactblocks.CheckVector.
+func checkFile(path string) error {
+	rows, err := vectorfile.ReadStringRows(path, 9)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		version, err := strconv.ParseUint(row[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("%v: %v", row[8], err)
+		}
+		nonce, err := strconv.ParseUint(row[2], 10, 64)
+		if err != nil {
+			return fmt.Errorf("%v: %v", row[8], err)
+		}
+		prefilled, err := parseIndexes(row[3])
+		if err != nil {
+			return fmt.Errorf("%v: %v", row[8], err)
+		}
+		missing, err := parseIndexes(row[4])
+		if err != nil {
+			return fmt.Errorf("%v: %v", row[8], err)
+		}
+		b, err := decodeHex(row[1], row[5], row[6], row[7])
+		if err != nil {
+			return fmt.Errorf("%v: %v", row[8], err)
+		}
+		err = compactblocks.CheckVector(compactblocks.Vector{
+			Version:     version,
+			Block:       b[0],
+			Nonce:       nonce,
+			Prefilled:   prefilled,
+			Missing:     missing,
+			CmpctBlock:  b[1],
+			GetBlockTxn: b[2],
+			BlockTxn:    b[3],
+		})
+		if err != nil {
+			return fmt.Errorf("%v: %v", row[8], err)
+		}
+	}
+
+	fmt.Printf("%d vectors OK\n", len(rows))
+	return nil
+}
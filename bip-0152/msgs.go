@@ -0,0 +1,360 @@
+package compactblocks
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// MsgSendCmpct announces that a peer relays compact blocks of the version,
+// and whether it asks to be sent them in high bandwidth mode, before
+// validating the blocks, rather than announced with inv or headers.
+type MsgSendCmpct struct {
+	HighBandwidth bool
+	Version       uint64
+}
+
+// Serialize writes the message payload to w.
+func (msg *MsgSendCmpct) Serialize(w io.Writer) error {
+	var b [9]byte
+	if msg.HighBandwidth {
+		b[0] = 1
+	}
+	binary.LittleEndian.PutUint64(b[1:], msg.Version)
+	_, err := w.Write(b[:])
+	return err
+}
+
+// Deserialize reads the message payload from r.
+func (msg *MsgSendCmpct) Deserialize(r io.Reader) error {
+	var b [9]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return err
+	}
+	msg.HighBandwidth = b[0] != 0
+	msg.Version = binary.LittleEndian.Uint64(b[1:])
+	return nil
+}
+
+// BtcEncode implements wire.Message.
+func (msg *MsgSendCmpct) BtcEncode(w io.Writer, _ uint32,
+	_ wire.MessageEncoding) error {
+
+	return msg.Serialize(w)
+}
+
+// BtcDecode implements wire.Message.
+func (msg *MsgSendCmpct) BtcDecode(r io.Reader, _ uint32,
+	_ wire.MessageEncoding) error {
+
+	return msg.Deserialize(r)
+}
+
+// Command returns "sendcmpct".
+func (msg *MsgSendCmpct) Command() string {
+	return CmdSendCmpct
+}
+
+// MaxPayloadLength returns the fixed size of the payload.
+func (msg *MsgSendCmpct) MaxPayloadLength(uint32) uint32 {
+	return 1 + 8
+}
+
+// PrefilledTx is a transaction a compact block carries in full, at its index
+// in the block.
+type PrefilledTx struct {
+	Index uint32
+	Tx    *wire.MsgTx
+}
+
+// MsgCmpctBlock announces a block with its header, the short IDs of its
+// transactions and those of them the sender expects the receiver lacks.
+// Only the low 6 bytes of the short IDs are sent, and the indexes of the
+// prefilled transactions, which must ascend, are encoded as the differences
+// between them.
+type MsgCmpctBlock struct {
+	Header       wire.BlockHeader
+	Nonce        uint64
+	ShortIDs     []uint64
+	PrefilledTxs []PrefilledTx
+}
+
+// Serialize writes the message payload to w, with the transactions in the
+// witness encoding.
+func (msg *MsgCmpctBlock) Serialize(w io.Writer) error {
+	return msg.BtcEncode(w, 0, wire.WitnessEncoding)
+}
+
+// Deserialize reads the message payload from r, with the transactions in the
+// witness encoding.
+func (msg *MsgCmpctBlock) Deserialize(r io.Reader) error {
+	return msg.BtcDecode(r, 0, wire.WitnessEncoding)
+}
+
+// BtcEncode implements wire.Message, writing the transactions in the
+// encoding enc.
+func (msg *MsgCmpctBlock) BtcEncode(w io.Writer, pver uint32,
+	enc wire.MessageEncoding) error {
+
+	if err := msg.Header.Serialize(w); err != nil {
+		return err
+	}
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], msg.Nonce)
+	if _, err := w.Write(b[:]); err != nil {
+		return err
+	}
+
+	err := writeCount(w, len(msg.ShortIDs), MaxBlockTxs, "short IDs")
+	if err != nil {
+		return err
+	}
+	for _, id := range msg.ShortIDs {
+		binary.LittleEndian.PutUint64(b[:], id)
+		if _, err := w.Write(b[:ShortIDSize]); err != nil {
+			return err
+		}
+	}
+
+	err = writeCount(w, len(msg.PrefilledTxs), MaxBlockTxs,
+		"prefilled transactions")
+	if err != nil {
+		return err
+	}
+	next := uint32(0)
+	for _, p := range msg.PrefilledTxs {
+		if p.Index < next || p.Index > maxIndex {
+			return fmt.Errorf("%w: prefilled transaction %d",
+				ErrInvalidIndex, p.Index)
+		}
+		err := wire.WriteVarInt(w, 0, uint64(p.Index-next))
+		if err != nil {
+			return err
+		}
+		if err := p.Tx.BtcEncode(w, pver, enc); err != nil {
+			return err
+		}
+		next = p.Index + 1
+	}
+	return nil
+}
+
+// BtcDecode implements wire.Message, reading the transactions in the
+// encoding enc.
+func (msg *MsgCmpctBlock) BtcDecode(r io.Reader, pver uint32,
+	enc wire.MessageEncoding) error {
+
+	if err := msg.Header.Deserialize(r); err != nil {
+		return err
+	}
+	var b [8]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return err
+	}
+	msg.Nonce = binary.LittleEndian.Uint64(b[:])
+
+	count, err := readCount(r, MaxBlockTxs, "short IDs")
+	if err != nil {
+		return err
+	}
+	msg.ShortIDs = make([]uint64, count)
+	b = [8]byte{}
+	for i := range msg.ShortIDs {
+		if _, err := io.ReadFull(r, b[:ShortIDSize]); err != nil {
+			return err
+		}
+		msg.ShortIDs[i] = binary.LittleEndian.Uint64(b[:])
+	}
+
+	count, err = readCount(r, MaxBlockTxs-count, "prefilled transactions")
+	if err != nil {
+		return err
+	}
+	msg.PrefilledTxs = make([]PrefilledTx, count)
+	next := uint64(0)
+	for i := range msg.PrefilledTxs {
+		diff, err := wire.ReadVarInt(r, 0)
+		if err != nil {
+			return err
+		}
+		if diff > maxIndex || next+diff > maxIndex {
+			return fmt.Errorf("%w: prefilled transaction %d",
+				ErrInvalidIndex, next+diff)
+		}
+		tx := &wire.MsgTx{}
+		if err := tx.BtcDecode(r, pver, enc); err != nil {
+			return err
+		}
+		msg.PrefilledTxs[i] = PrefilledTx{
+			Index: uint32(next + diff),
+			Tx:    tx,
+		}
+		next += diff + 1
+	}
+	return nil
+}
+
+// Command returns "cmpctblock".
+func (msg *MsgCmpctBlock) Command() string {
+	return CmdCmpctBlock
+}
+
+// MaxPayloadLength returns the largest size of a block.
+func (msg *MsgCmpctBlock) MaxPayloadLength(uint32) uint32 {
+	return wire.MaxBlockPayload
+}
+
+// MsgGetBlockTxn requests the transactions of a block at the indexes, which
+// must ascend and are encoded as the differences between them.
+type MsgGetBlockTxn struct {
+	BlockHash chainhash.Hash
+	Indexes   []uint32
+}
+
+// Serialize writes the message payload to w.
+func (msg *MsgGetBlockTxn) Serialize(w io.Writer) error {
+	if _, err := w.Write(msg.BlockHash[:]); err != nil {
+		return err
+	}
+	err := writeCount(w, len(msg.Indexes), MaxBlockTxs, "indexes")
+	if err != nil {
+		return err
+	}
+	next := uint32(0)
+	for _, index := range msg.Indexes {
+		if index < next || index > maxIndex {
+			return fmt.Errorf("%w: %d", ErrInvalidIndex, index)
+		}
+		err := wire.WriteVarInt(w, 0, uint64(index-next))
+		if err != nil {
+			return err
+		}
+		next = index + 1
+	}
+	return nil
+}
+
+// Deserialize reads the message payload from r.
+func (msg *MsgGetBlockTxn) Deserialize(r io.Reader) error {
+	if _, err := io.ReadFull(r, msg.BlockHash[:]); err != nil {
+		return err
+	}
+	count, err := readCount(r, MaxBlockTxs, "indexes")
+	if err != nil {
+		return err
+	}
+	msg.Indexes = make([]uint32, count)
+	next := uint64(0)
+	for i := range msg.Indexes {
+		diff, err := wire.ReadVarInt(r, 0)
+		if err != nil {
+			return err
+		}
+		if diff > maxIndex || next+diff > maxIndex {
+			return fmt.Errorf("%w: %d", ErrInvalidIndex, next+diff)
+		}
+		msg.Indexes[i] = uint32(next + diff)
+		next += diff + 1
+	}
+	return nil
+}
+
+// BtcEncode implements wire.Message.
+func (msg *MsgGetBlockTxn) BtcEncode(w io.Writer, _ uint32,
+	_ wire.MessageEncoding) error {
+
+	return msg.Serialize(w)
+}
+
+// BtcDecode implements wire.Message.
+func (msg *MsgGetBlockTxn) BtcDecode(r io.Reader, _ uint32,
+	_ wire.MessageEncoding) error {
+
+	return msg.Deserialize(r)
+}
+
+// Command returns "getblocktxn".
+func (msg *MsgGetBlockTxn) Command() string {
+	return CmdGetBlockTxn
+}
+
+// MaxPayloadLength returns the size of the payload holding the most indexes.
+func (msg *MsgGetBlockTxn) MaxPayloadLength(uint32) uint32 {
+	return chainhash.HashSize +
+		uint32(wire.VarIntSerializeSize(MaxBlockTxs)) +
+		MaxBlockTxs*uint32(wire.VarIntSerializeSize(maxIndex))
+}
+
+// MsgBlockTxn carries the transactions a getblocktxn requested, in the order
+// of its indexes.
+type MsgBlockTxn struct {
+	BlockHash chainhash.Hash
+	Txs       []*wire.MsgTx
+}
+
+// Serialize writes the message payload to w, with the transactions in the
+// witness encoding.
+func (msg *MsgBlockTxn) Serialize(w io.Writer) error {
+	return msg.BtcEncode(w, 0, wire.WitnessEncoding)
+}
+
+// Deserialize reads the message payload from r, with the transactions in the
+// witness encoding.
+func (msg *MsgBlockTxn) Deserialize(r io.Reader) error {
+	return msg.BtcDecode(r, 0, wire.WitnessEncoding)
+}
+
+// BtcEncode implements wire.Message, writing the transactions in the
+// encoding enc.
+func (msg *MsgBlockTxn) BtcEncode(w io.Writer, pver uint32,
+	enc wire.MessageEncoding) error {
+
+	if _, err := w.Write(msg.BlockHash[:]); err != nil {
+		return err
+	}
+	err := writeCount(w, len(msg.Txs), MaxBlockTxs, "transactions")
+	if err != nil {
+		return err
+	}
+	for _, tx := range msg.Txs {
+		if err := tx.BtcEncode(w, pver, enc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BtcDecode implements wire.Message, reading the transactions in the
+// encoding enc.
+func (msg *MsgBlockTxn) BtcDecode(r io.Reader, pver uint32,
+	enc wire.MessageEncoding) error {
+
+	if _, err := io.ReadFull(r, msg.BlockHash[:]); err != nil {
+		return err
+	}
+	count, err := readCount(r, MaxBlockTxs, "transactions")
+	if err != nil {
+		return err
+	}
+	msg.Txs = make([]*wire.MsgTx, count)
+	for i := range msg.Txs {
+		msg.Txs[i] = &wire.MsgTx{}
+		if err := msg.Txs[i].BtcDecode(r, pver, enc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Command returns "blocktxn".
+func (msg *MsgBlockTxn) Command() string {
+	return CmdBlockTxn
+}
+
+// MaxPayloadLength returns the largest size of a block.
+func (msg *MsgBlockTxn) MaxPayloadLength(uint32) uint32 {
+	return wire.MaxBlockPayload
+}
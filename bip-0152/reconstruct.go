@@ -0,0 +1,212 @@
+package compactblocks
+
+import (
+	"fmt"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// NewMsgCmpctBlock returns the compact block of the version of the block,
+// with the short IDs keyed by the nonce, prefilling the coinbase and the
+// transactions at the indexes of prefill.
+func NewMsgCmpctBlock(block *wire.MsgBlock, nonce, version uint64,
+	prefill []uint32) (*MsgCmpctBlock, error) {
+
+	if _, err := Encoding(version); err != nil {
+		return nil, err
+	}
+	prefilled := make([]bool, len(block.Transactions))
+	if len(prefilled) > 0 {
+		prefilled[0] = true
+	}
+	for _, index := range prefill {
+		if int(index) >= len(prefilled) {
+			return nil, fmt.Errorf("%w: %d of %d transactions",
+				ErrInvalidIndex, index, len(prefilled))
+		}
+		prefilled[index] = true
+	}
+
+	msg := &MsgCmpctBlock{Header: block.Header, Nonce: nonce}
+	key := NewShortIDKey(&block.Header, nonce)
+	for i, tx := range block.Transactions {
+		if prefilled[i] {
+			msg.PrefilledTxs = append(msg.PrefilledTxs, PrefilledTx{
+				Index: uint32(i),
+				Tx:    tx,
+			})
+		} else {
+			msg.ShortIDs = append(msg.ShortIDs,
+				key.TxShortID(tx, version))
+		}
+	}
+	return msg, nil
+}
+
+// NewMsgBlockTxn returns the blocktxn answering the request for transactions
+// of the block.
+func NewMsgBlockTxn(block *wire.MsgBlock,
+	req *MsgGetBlockTxn) (*MsgBlockTxn, error) {
+
+	hash := block.BlockHash()
+	if req.BlockHash != hash {
+		return nil, fmt.Errorf("%w: block %v, requested %v",
+			ErrBlockTxnMismatch, hash, req.BlockHash)
+	}
+	msg := &MsgBlockTxn{BlockHash: hash}
+	for _, index := range req.Indexes {
+		if int(index) >= len(block.Transactions) {
+			return nil, fmt.Errorf("%w: %d of %d transactions",
+				ErrInvalidIndex, index, len(block.Transactions))
+		}
+		msg.Txs = append(msg.Txs, block.Transactions[index])
+	}
+	return msg, nil
+}
+
+// PartialBlock is a block being reconstructed from a compact block, holding
+// the transactions it prefilled and those of the mempool matching its short
+// IDs.
+type PartialBlock struct {
+	Header wire.BlockHeader
+
+	txs []*wire.MsgTx
+}
+
+// NewPartialBlock places the prefilled transactions of the compact block of
+// the version, and the transactions of the mempool whose short IDs it holds.
+// A short ID that several transactions of the mempool match is left
+// missing, to be requested. A compact block holding a short ID twice fails
+// with ErrShortIDCollision, and must be fetched in full instead.
+func NewPartialBlock(msg *MsgCmpctBlock, version uint64,
+	mempool []*wire.MsgTx) (*PartialBlock, error) {
+
+	if _, err := Encoding(version); err != nil {
+		return nil, err
+	}
+	n := len(msg.ShortIDs) + len(msg.PrefilledTxs)
+	if n == 0 || n > MaxBlockTxs {
+		return nil, fmt.Errorf("%w: %d transactions", ErrInvalidIndex,
+			n)
+	}
+
+	p := &PartialBlock{Header: msg.Header, txs: make([]*wire.MsgTx, n)}
+	prefilled := make([]bool, n)
+	next := 0
+	for _, pt := range msg.PrefilledTxs {
+		if int(pt.Index) < next || int(pt.Index) >= n {
+			return nil, fmt.Errorf("%w: prefilled transaction "+
+				"%d of %d", ErrInvalidIndex, pt.Index, n)
+		}
+		p.txs[pt.Index] = pt.Tx
+		prefilled[pt.Index] = true
+		next = int(pt.Index) + 1
+	}
+
+	// Map the short IDs to the indexes they take, in order, between the
+	// prefilled transactions.
+	slots := make(map[uint64]int, len(msg.ShortIDs))
+	index := 0
+	for _, id := range msg.ShortIDs {
+		for prefilled[index] {
+			index++
+		}
+		id &= shortIDMask
+		if _, ok := slots[id]; ok {
+			return nil, fmt.Errorf("%w: %012x", ErrShortIDCollision,
+				id)
+		}
+		slots[id] = index
+		index++
+	}
+
+	key := NewShortIDKey(&msg.Header, msg.Nonce)
+	collided := make(map[int]bool)
+	for _, tx := range mempool {
+		index, ok := slots[key.TxShortID(tx, version)]
+		if !ok || collided[index] {
+			continue
+		}
+		if p.txs[index] != nil {
+			p.txs[index] = nil
+			collided[index] = true
+			continue
+		}
+		p.txs[index] = tx
+	}
+	return p, nil
+}
+
+// Missing returns the indexes of the transactions the block lacks.
+func (p *PartialBlock) Missing() []uint32 {
+	var missing []uint32
+	for i, tx := range p.txs {
+		if tx == nil {
+			missing = append(missing, uint32(i))
+		}
+	}
+	return missing
+}
+
+// Request returns the getblocktxn requesting the missing transactions.
+func (p *PartialBlock) Request() *MsgGetBlockTxn {
+	return &MsgGetBlockTxn{
+		BlockHash: p.Header.BlockHash(),
+		Indexes:   p.Missing(),
+	}
+}
+
+// Fill returns the block completed with the transactions of the blocktxn
+// answering the request of the missing ones. A block that doesn't match the
+// merkle root of its header fails with ErrMerkleMismatch, and must be
+// fetched in full instead.
+func (p *PartialBlock) Fill(msg *MsgBlockTxn) (*wire.MsgBlock, error) {
+	missing := p.Missing()
+	if msg.BlockHash != p.Header.BlockHash() ||
+		len(msg.Txs) != len(missing) {
+
+		return nil, fmt.Errorf("%w: %d transactions of block %v, "+
+			"expected %d", ErrBlockTxnMismatch, len(msg.Txs),
+			msg.BlockHash, len(missing))
+	}
+
+	block := &wire.MsgBlock{
+		Header:       p.Header,
+		Transactions: append([]*wire.MsgTx{}, p.txs...),
+	}
+	for i, index := range missing {
+		block.Transactions[index] = msg.Txs[i]
+	}
+	root := merkleRoot(block.Transactions)
+	if root != block.Header.MerkleRoot {
+		return nil, fmt.Errorf("%w: %v, header has %v",
+			ErrMerkleMismatch, root, block.Header.MerkleRoot)
+	}
+	return block, nil
+}
+
+// merkleRoot returns the merkle root of the txids of the transactions.
+func merkleRoot(txs []*wire.MsgTx) chainhash.Hash {
+	level := make([]chainhash.Hash, len(txs))
+	for i, tx := range txs {
+		level[i] = tx.TxHash()
+	}
+	for len(level) > 1 {
+		if len(level)%2 != 0 {
+			level = append(level, level[len(level)-1])
+		}
+		next := make([]chainhash.Hash, len(level)/2)
+		for i := range next {
+			var b [2 * chainhash.HashSize]byte
+			copy(b[:], level[2*i][:])
+			copy(b[chainhash.HashSize:], level[2*i+1][:])
+			next[i] = chainhash.DoubleHashH(b[:])
+		}
+		level = next
+	}
+	if len(level) == 0 {
+		return chainhash.Hash{}
+	}
+	return level[0]
+}
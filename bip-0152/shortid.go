@@ -0,0 +1,53 @@
+package compactblocks
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+
+	"github.com/aead/siphash"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// shortIDMask keeps the low 6 bytes of a SipHash, the short ID.
+const shortIDMask = 1<<(8*ShortIDSize) - 1
+
+// ShortIDKey is the SipHash key of the short IDs of a compact block.
+type ShortIDKey [siphash.KeySize]byte
+
+// NewShortIDKey returns the key of the short IDs of the compact block of the
+// header and nonce: the first 16 bytes of the SHA-256 of the serialized
+// header followed by the nonce in little endian.
+func NewShortIDKey(header *wire.BlockHeader, nonce uint64) ShortIDKey {
+	var b bytes.Buffer
+	if err := header.Serialize(&b); err != nil {
+		panic(err)
+	}
+	var n [8]byte
+	binary.LittleEndian.PutUint64(n[:], nonce)
+	b.Write(n[:])
+
+	var key ShortIDKey
+	sum := sha256.Sum256(b.Bytes())
+	copy(key[:], sum[:])
+	return key
+}
+
+// ShortID returns the short ID of the transaction of the hash: the low 6
+// bytes of its SipHash-2-4.
+func (k ShortIDKey) ShortID(hash *chainhash.Hash) uint64 {
+	key := [siphash.KeySize]byte(k)
+	return siphash.Sum64(hash[:], &key) & shortIDMask
+}
+
+// TxShortID returns the short ID of the transaction in compact blocks of the
+// version, which is that of its txid in version 1 and of its wtxid in
+// version 2.
+func (k ShortIDKey) TxShortID(tx *wire.MsgTx, version uint64) uint64 {
+	hash := tx.TxHash()
+	if version == Version2 {
+		hash = tx.WitnessHash()
+	}
+	return k.ShortID(&hash)
+}
@@ -0,0 +1,230 @@
+package compactblocks
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+// ErrVectorMismatch is returned by CheckVector when relaying the block of a
+// vector doesn't give the expected messages.
+var ErrVectorMismatch = errors.New("compactblocks: vector mismatch")
+
+// Vector is the relay of a block as a compact block of the version to a
+// receiver whose mempool holds the transactions of the block but those
+// missing: the cmpctblock, the getblocktxn requesting the missing
+// transactions, and the blocktxn answering it.
+type Vector struct {
+	Version uint64
+	Block   []byte
+	Nonce   uint64
+
+	// Prefilled are the indexes of the transactions prefilled besides the
+	// coinbase, and Missing those the receiver's mempool lacks.
+	Prefilled []uint32
+	Missing   []uint32
+
+	// CmpctBlock, GetBlockTxn and BlockTxn are the message payloads, the
+	// transactions in the encoding of the version.
+	CmpctBlock  []byte
+	GetBlockTxn []byte
+	BlockTxn    []byte
+
+	// Comment describes what the vector exercises.
+	Comment string
+}
+
+// encode returns the payload of the message, with its transactions in the
+// encoding enc.
+func encode(msg wire.Message, enc wire.MessageEncoding) ([]byte, error) {
+	var b bytes.Buffer
+	if err := msg.BtcEncode(&b, 0, enc); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// relay relays the block as a compact block of the version to a receiver
+// whose mempool lacks the missing transactions, returning the payloads of
+// the cmpctblock, getblocktxn and blocktxn, and the block the receiver
+// reconstructs.
+func relay(block *wire.MsgBlock, version, nonce uint64, prefill,
+	missing []uint32) ([3][]byte, *wire.MsgBlock, error) {
+
+	var payloads [3][]byte
+	enc, err := Encoding(version)
+	if err != nil {
+		return payloads, nil, err
+	}
+	cmpct, err := NewMsgCmpctBlock(block, nonce, version, prefill)
+	if err != nil {
+		return payloads, nil, err
+	}
+	if payloads[0], err = encode(cmpct, enc); err != nil {
+		return payloads, nil, err
+	}
+
+	// The receiver decodes the compact block and fills it from a mempool
+	// holding the rest of the transactions, and the sender answers its
+	// request.
+	announced := &MsgCmpctBlock{}
+	err = announced.BtcDecode(bytes.NewReader(payloads[0]), 0, enc)
+	if err != nil {
+		return payloads, nil, err
+	}
+	excluded := make(map[uint32]bool)
+	for _, p := range announced.PrefilledTxs {
+		excluded[p.Index] = true
+	}
+	for _, index := range missing {
+		excluded[index] = true
+	}
+	var mempool []*wire.MsgTx
+	for i, tx := range block.Transactions {
+		if !excluded[uint32(i)] {
+			mempool = append(mempool, tx)
+		}
+	}
+	partial, err := NewPartialBlock(announced, version, mempool)
+	if err != nil {
+		return payloads, nil, err
+	}
+	if payloads[1], err = encode(partial.Request(), enc); err != nil {
+		return payloads, nil, err
+	}
+
+	req := &MsgGetBlockTxn{}
+	if err := req.Deserialize(bytes.NewReader(payloads[1])); err != nil {
+		return payloads, nil, err
+	}
+	txn, err := NewMsgBlockTxn(block, req)
+	if err != nil {
+		return payloads, nil, err
+	}
+	if payloads[2], err = encode(txn, enc); err != nil {
+		return payloads, nil, err
+	}
+
+	answer := &MsgBlockTxn{}
+	err = answer.BtcDecode(bytes.NewReader(payloads[2]), 0, enc)
+	if err != nil {
+		return payloads, nil, err
+	}
+	reconstructed, err := partial.Fill(answer)
+	return payloads, reconstructed, err
+}
+
+// newVector returns the vector of the relay of the block.
+func newVector(block *wire.MsgBlock, version, nonce uint64, prefill,
+	missing []uint32, comment string) Vector {
+
+	payloads, _, err := relay(block, version, nonce, prefill, missing)
+	if err != nil {
+		panic(fmt.Sprintf("compactblocks: %v: %v", comment, err))
+	}
+	var b bytes.Buffer
+	if err := block.Serialize(&b); err != nil {
+		panic(err)
+	}
+	return Vector{
+		Version:     version,
+		Block:       b.Bytes(),
+		Nonce:       nonce,
+		Prefilled:   prefill,
+		Missing:     missing,
+		CmpctBlock:  payloads[0],
+		GetBlockTxn: payloads[1],
+		BlockTxn:    payloads[2],
+		Comment:     comment,
+	}
+}
+
+// RandomVectors returns vectors of the relay of each block, named by the
+// entry of names, derived from a math/rand source with the seed: as a
+// compact block of either version to a receiver whose mempool holds every
+// transaction, and, for blocks of more than the coinbase, to one whose
+// mempool lacks a random subset, and with a random transaction prefilled.
+func RandomVectors(rngSeed int64, blocks []*wire.MsgBlock,
+	names []string) []Vector {
+
+	rng := rand.New(rand.NewSource(rngSeed))
+	var vectors []Vector
+	for i, block := range blocks {
+		n := len(block.Transactions)
+		for _, version := range []uint64{Version1, Version2} {
+			comment := fmt.Sprintf("%v, version %d", names[i],
+				version)
+			vectors = append(vectors, newVector(block, version,
+				rng.Uint64(), nil, nil, comment+", nothing "+
+					"missing"))
+			if n < 2 {
+				continue
+			}
+
+			var missing []uint32
+			for len(missing) == 0 {
+				for j := 1; j < n; j++ {
+					if rng.Intn(2) == 0 {
+						missing = append(missing,
+							uint32(j))
+					}
+				}
+			}
+			vectors = append(vectors, newVector(block, version,
+				rng.Uint64(), nil, missing, fmt.Sprintf(
+					"%v, %d of %d transactions missing",
+					comment, len(missing), n)))
+
+			prefill := []uint32{uint32(1 + rng.Intn(n-1))}
+			vectors = append(vectors, newVector(block, version,
+				rng.Uint64(), prefill, missing, fmt.Sprintf(
+					"%v, transaction %d prefilled", comment,
+					prefill[0])))
+		}
+	}
+	return vectors
+}
+
+// CheckVector relays the block of the vector, and checks the payloads of
+// the messages and that the receiver reconstructs the block.
+func CheckVector(v Vector) error {
+	block := &wire.MsgBlock{}
+	if err := block.Deserialize(bytes.NewReader(v.Block)); err != nil {
+		return err
+	}
+	payloads, reconstructed, err := relay(block, v.Version, v.Nonce,
+		v.Prefilled, v.Missing)
+	if err != nil {
+		return err
+	}
+
+	expected := [3][]byte{v.CmpctBlock, v.GetBlockTxn, v.BlockTxn}
+	commands := [3]string{CmdCmpctBlock, CmdGetBlockTxn, CmdBlockTxn}
+	for i, payload := range payloads {
+		if !bytes.Equal(payload, expected[i]) {
+			return fmt.Errorf("%w: %v %x, expected %x",
+				ErrVectorMismatch, commands[i], payload,
+				expected[i])
+		}
+	}
+
+	// Version 1 relays transactions without their witnesses, so only the
+	// reconstruction's encoding of that version must match.
+	enc, _ := Encoding(v.Version)
+	want, err := encode(block, enc)
+	if err != nil {
+		return err
+	}
+	got, err := encode(reconstructed, enc)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(got, want) {
+		return fmt.Errorf("%w: reconstructed block %x",
+			ErrVectorMismatch, got)
+	}
+	return nil
+}
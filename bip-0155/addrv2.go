@@ -0,0 +1,434 @@
+// Package addrv2 implements the addrv2 message of BIP 155, which gossips
+// the addresses of peers of every network Bitcoin nodes reach each other
+// over, not only those that fit an IPv6 address as addr does: IPv4, IPv6,
+// Tor v2 and v3 onion services, I2P and CJDNS.
+//
+// An address is its network ID and the bytes of the address on that
+// network, whose length is fixed for each network BIP 155 defines, along
+// with its port, services and the time it was last seen:
+//
+//	a, err := addrv2.ParseAddress("[fc32:17ea:e415:c3bf::1]:8333")
+//	msg := &addrv2.MsgAddrV2{Addrs: []addrv2.Address{a}}
+//
+// Addresses of a network a message doesn't know may be of any length up to
+// MaxAddrLen. They are decoded and kept, for relay, but Known tells them
+// apart, and BIP 155 asks nodes to ignore them otherwise. Peers that send
+// sendaddrv2 before verack would rather get addrv2 than addr.
+//
+// Hosts are written as the addresses of their networks are: dotted IPv4,
+// IPv6 and CJDNS in the notation of IPv6, and onion and I2P addresses in
+// lower case base32, with the checksum and version of Tor v3 addresses.
+package addrv2
+
+import (
+	"bytes"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/btcsuite/btcd/wire"
+	"golang.org/x/crypto/sha3"
+)
+
+// NetworkID identifies the network of an address.
+type NetworkID uint8
+
+// The networks of BIP 155.
+const (
+	NetIPv4  NetworkID = 1
+	NetIPv6  NetworkID = 2
+	NetTorV2 NetworkID = 3
+	NetTorV3 NetworkID = 4
+	NetI2P   NetworkID = 5
+	NetCJDNS NetworkID = 6
+)
+
+// addrLens are the lengths of the addresses of the known networks.
+var addrLens = map[NetworkID]int{
+	NetIPv4:  4,
+	NetIPv6:  16,
+	NetTorV2: 10,
+	NetTorV3: 32,
+	NetI2P:   32,
+	NetCJDNS: 16,
+}
+
+// networkNames are the names of the known networks.
+var networkNames = map[NetworkID]string{
+	NetIPv4:  "IPv4",
+	NetIPv6:  "IPv6",
+	NetTorV2: "TorV2",
+	NetTorV3: "TorV3",
+	NetI2P:   "I2P",
+	NetCJDNS: "CJDNS",
+}
+
+// String returns the name of the network, or its number if it isn't known.
+func (id NetworkID) String() string {
+	if name, ok := networkNames[id]; ok {
+		return name
+	}
+	return "network " + strconv.Itoa(int(id))
+}
+
+// AddrLen returns the length of the addresses of the network, or 0 if it
+// isn't known.
+func (id NetworkID) AddrLen() int {
+	return addrLens[id]
+}
+
+const (
+	// MaxAddrLen is the longest address of any network, known or not, a
+	// message may hold.
+	MaxAddrLen = 512
+
+	// torV3Version is the version byte of Tor v3 onion addresses.
+	torV3Version = 3
+
+	// onionSuffix and i2pSuffix end the hosts of onion and I2P addresses.
+	onionSuffix = ".onion"
+	i2pSuffix   = ".b32.i2p"
+)
+
+var (
+	// ErrInvalidLength is returned for an address of a known network
+	// whose length isn't that of the addresses of the network.
+	ErrInvalidLength = errors.New("addrv2: address of invalid length")
+
+	// ErrAddrTooLong is returned for an address longer than MaxAddrLen.
+	ErrAddrTooLong = errors.New("addrv2: address too long")
+
+	// ErrInvalidAddress is returned for an address of a known network
+	// that the network rules out, such as an IPv6 address of a range set
+	// aside for IPv4 or Tor.
+	ErrInvalidAddress = errors.New("addrv2: invalid address")
+
+	// ErrUnknownNetwork is returned when formatting the address of a
+	// network that isn't known.
+	ErrUnknownNetwork = errors.New("addrv2: unknown network")
+
+	// ErrInvalidHost is returned for a host that isn't the address of any
+	// known network.
+	ErrInvalidHost = errors.New("addrv2: invalid host")
+
+	// ErrTooMany is returned when a message holds more items than the
+	// protocol allows.
+	ErrTooMany = errors.New("addrv2: too many items in message")
+)
+
+var (
+	// ipv4Prefix starts the IPv6 addresses that map IPv4 addresses.
+	ipv4Prefix = []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff}
+
+	// torV2Prefix starts the IPv6 addresses of OnionCat, which carried
+	// Tor v2 addresses in addr messages.
+	torV2Prefix = []byte{0xfd, 0x87, 0xd8, 0x7e, 0xeb, 0x43}
+
+	// cjdnsPrefix starts every CJDNS address.
+	cjdnsPrefix = byte(0xfc)
+)
+
+// base32Encoding is the encoding of onion and I2P addresses.
+var base32Encoding = base32.NewEncoding(
+	"abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// Address is the address of a peer on a network, with its port, the
+// services it offers and the time it was last seen, in seconds since the
+// Unix epoch.
+type Address struct {
+	Time     uint32
+	Services wire.ServiceFlag
+	Network  NetworkID
+	Addr     []byte
+	Port     uint16
+}
+
+// Known reports whether the address is of a known network.
+func (a *Address) Known() bool {
+	_, ok := addrLens[a.Network]
+	return ok
+}
+
+// Validate checks that the address is no longer than MaxAddrLen and, for a
+// known network, of the length of its addresses and not of a range the
+// network rules out: IPv6 addresses that map IPv4 addresses or are those of
+// OnionCat, and CJDNS addresses outside fc00::/8.
+func (a *Address) Validate() error {
+	if len(a.Addr) > MaxAddrLen {
+		return fmt.Errorf("%w: %d bytes", ErrAddrTooLong, len(a.Addr))
+	}
+	if !a.Known() {
+		return nil
+	}
+	if n := a.Network.AddrLen(); len(a.Addr) != n {
+		return fmt.Errorf("%w: %v address of %d bytes, expected %d",
+			ErrInvalidLength, a.Network, len(a.Addr), n)
+	}
+	switch a.Network {
+	case NetIPv6:
+		if bytes.HasPrefix(a.Addr, ipv4Prefix) {
+			return fmt.Errorf("%w: IPv6 address %v maps an IPv4 "+
+				"address", ErrInvalidAddress, net.IP(a.Addr))
+		}
+		if bytes.HasPrefix(a.Addr, torV2Prefix) {
+			return fmt.Errorf("%w: IPv6 address %v of OnionCat",
+				ErrInvalidAddress, net.IP(a.Addr))
+		}
+	case NetCJDNS:
+		if a.Addr[0] != cjdnsPrefix {
+			return fmt.Errorf("%w: CJDNS address %v outside "+
+				"fc00::/8", ErrInvalidAddress, net.IP(a.Addr))
+		}
+	}
+	return nil
+}
+
+// Serialize writes the address as an entry of an addrv2 message to w.
+func (a *Address) Serialize(w io.Writer) error {
+	if err := a.Validate(); err != nil {
+		return err
+	}
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], a.Time)
+	if _, err := w.Write(b[:]); err != nil {
+		return err
+	}
+	if err := wire.WriteVarInt(w, 0, uint64(a.Services)); err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte{byte(a.Network)}); err != nil {
+		return err
+	}
+	if err := wire.WriteVarBytes(w, 0, a.Addr); err != nil {
+		return err
+	}
+	binary.BigEndian.PutUint16(b[:], a.Port)
+	_, err := w.Write(b[:2])
+	return err
+}
+
+// Deserialize reads the address from an entry of an addrv2 message in r,
+// rejecting addresses Validate rejects.
+func (a *Address) Deserialize(r io.Reader) error {
+	var b [5]byte
+	if _, err := io.ReadFull(r, b[:4]); err != nil {
+		return err
+	}
+	a.Time = binary.LittleEndian.Uint32(b[:])
+	services, err := wire.ReadVarInt(r, 0)
+	if err != nil {
+		return err
+	}
+	a.Services = wire.ServiceFlag(services)
+	if _, err := io.ReadFull(r, b[:1]); err != nil {
+		return err
+	}
+	a.Network = NetworkID(b[0])
+
+	n, err := wire.ReadVarInt(r, 0)
+	if err != nil {
+		return err
+	}
+	if n > MaxAddrLen {
+		return fmt.Errorf("%w: %d bytes", ErrAddrTooLong, n)
+	}
+	a.Addr = make([]byte, n)
+	if _, err := io.ReadFull(r, a.Addr); err != nil {
+		return err
+	}
+	if err := a.Validate(); err != nil {
+		return err
+	}
+
+	if _, err := io.ReadFull(r, b[:2]); err != nil {
+		return err
+	}
+	a.Port = binary.BigEndian.Uint16(b[:])
+	return nil
+}
+
+// Host returns the host of the address, as FormatHost writes it.
+func (a *Address) Host() (string, error) {
+	return FormatHost(a.Network, a.Addr)
+}
+
+// String returns the host and port of the address, or the number of its
+// network and the address in hex if the network isn't known.
+func (a *Address) String() string {
+	host, err := a.Host()
+	if err != nil {
+		host = fmt.Sprintf("%d:%x", a.Network, a.Addr)
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(a.Port)))
+}
+
+// torV3Checksum returns the checksum of the Tor v3 onion address of the
+// public key.
+func torV3Checksum(pubKey []byte) []byte {
+	h := sha3.New256()
+	h.Write([]byte(".onion checksum"))
+	h.Write(pubKey)
+	h.Write([]byte{torV3Version})
+	return h.Sum(nil)[:2]
+}
+
+// FormatHost returns the host of the address of the known network. The
+// address must be valid.
+func FormatHost(network NetworkID, addr []byte) (string, error) {
+	a := Address{Network: network, Addr: addr}
+	if !a.Known() {
+		return "", fmt.Errorf("%w: %d", ErrUnknownNetwork, network)
+	}
+	if err := a.Validate(); err != nil {
+		return "", err
+	}
+
+	switch network {
+	case NetTorV2:
+		return base32Encoding.EncodeToString(addr) + onionSuffix, nil
+	case NetTorV3:
+		b := append(append([]byte{}, addr...), torV3Checksum(addr)...)
+		b = append(b, torV3Version)
+		return base32Encoding.EncodeToString(b) + onionSuffix, nil
+	case NetI2P:
+		return base32Encoding.EncodeToString(addr) + i2pSuffix, nil
+	default:
+		return net.IP(addr).String(), nil
+	}
+}
+
+// ParseHost returns the network and address of the host: an onion address
+// of Tor v2 or v3, a base32 I2P address, or an IP address, which is of
+// CJDNS in fc00::/8 and of IPv4 if it maps one. Onion and I2P addresses
+// may be in either case.
+func ParseHost(host string) (NetworkID, []byte, error) {
+	lower := strings.ToLower(host)
+	var network NetworkID
+	var addr []byte
+	switch {
+	case strings.HasSuffix(lower, onionSuffix):
+		b, err := base32Encoding.DecodeString(strings.TrimSuffix(lower,
+			onionSuffix))
+		if err != nil {
+			return 0, nil, fmt.Errorf("%w: %q: %v", ErrInvalidHost,
+				host, err)
+		}
+		switch len(b) {
+		case addrLens[NetTorV2]:
+			network, addr = NetTorV2, b
+		case addrLens[NetTorV3] + 3:
+			network, addr = NetTorV3, b[:addrLens[NetTorV3]]
+			if b[len(b)-1] != torV3Version {
+				return 0, nil, fmt.Errorf("%w: %q of Tor "+
+					"version %d", ErrInvalidHost, host,
+					b[len(b)-1])
+			}
+			checksum := b[len(addr) : len(addr)+2]
+			if !bytes.Equal(checksum, torV3Checksum(addr)) {
+				return 0, nil, fmt.Errorf("%w: %q of a bad "+
+					"checksum", ErrInvalidHost, host)
+			}
+		default:
+			return 0, nil, fmt.Errorf("%w: onion address %q of "+
+				"%d bytes", ErrInvalidHost, host, len(b))
+		}
+
+	case strings.HasSuffix(lower, i2pSuffix):
+		b, err := base32Encoding.DecodeString(strings.TrimSuffix(lower,
+			i2pSuffix))
+		if err != nil {
+			return 0, nil, fmt.Errorf("%w: %q: %v", ErrInvalidHost,
+				host, err)
+		}
+		if len(b) != addrLens[NetI2P] {
+			return 0, nil, fmt.Errorf("%w: I2P address %q of %d "+
+				"bytes", ErrInvalidHost, host, len(b))
+		}
+		network, addr = NetI2P, b
+
+	default:
+		ip := net.ParseIP(host)
+		switch {
+		case ip == nil:
+			return 0, nil, fmt.Errorf("%w: %q", ErrInvalidHost, host)
+		case ip.To4() != nil:
+			network, addr = NetIPv4, ip.To4()
+		case ip[0] == cjdnsPrefix:
+			network, addr = NetCJDNS, ip
+		default:
+			network, addr = NetIPv6, ip
+		}
+	}
+
+	a := Address{Network: network, Addr: addr}
+	if err := a.Validate(); err != nil {
+		return 0, nil, err
+	}
+	return network, addr, nil
+}
+
+// ParseAddress returns the address of the host and port, of no services
+// and time.
+func ParseAddress(hostPort string) (Address, error) {
+	host, port, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		return Address{}, fmt.Errorf("%w: %v", ErrInvalidHost, err)
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return Address{}, fmt.Errorf("%w: port %q", ErrInvalidHost,
+			port)
+	}
+	network, addr, err := ParseHost(host)
+	if err != nil {
+		return Address{}, err
+	}
+	return Address{Network: network, Addr: addr, Port: uint16(p)}, nil
+}
+
+// FromNetAddress returns the address of an addr message entry, of IPv4 if
+// it maps an IPv4 address, of Tor v2 if it's an OnionCat address, and of
+// IPv6 otherwise.
+func FromNetAddress(na *wire.NetAddress) Address {
+	a := Address{
+		Time:     uint32(na.Timestamp.Unix()),
+		Services: na.Services,
+		Network:  NetIPv6,
+		Addr:     append([]byte{}, na.IP.To16()...),
+		Port:     na.Port,
+	}
+	switch {
+	case na.IP.To4() != nil:
+		a.Network, a.Addr = NetIPv4, append([]byte{}, na.IP.To4()...)
+	case bytes.HasPrefix(a.Addr, torV2Prefix):
+		a.Network, a.Addr = NetTorV2, a.Addr[len(torV2Prefix):]
+	}
+	return a
+}
+
+// NetAddress returns the addr message entry of an IPv4, IPv6 or Tor v2
+// address, the only ones addr can carry, or false for one of another
+// network.
+func (a *Address) NetAddress() (*wire.NetAddress, bool) {
+	if a.Validate() != nil {
+		return nil, false
+	}
+	var ip net.IP
+	switch a.Network {
+	case NetIPv4, NetIPv6:
+		ip = net.IP(append([]byte{}, a.Addr...))
+	case NetTorV2:
+		ip = append(append(net.IP{}, torV2Prefix...), a.Addr...)
+	default:
+		return nil, false
+	}
+	na := wire.NewNetAddressIPPort(ip, a.Port, a.Services)
+	na.Timestamp = time.Unix(int64(a.Time), 0)
+	return na, true
+}
@@ -0,0 +1,278 @@
+// This program writes test vectors for the addrv2 package: to hosts.json,
+// hosts of every network BIP 155 defines, in either case and of every way
+// they can be malformed, and to addrv2.json, addrv2 message payloads of
+// addresses of every network, known or not, and of every way they can be
+// invalid, followed by random messages, truncated at random or not. The
+// vectors depend only on -seed and -count, so they can be regenerated by
+// anyone:
+//
+//	gentestvectors -count 50 -seed 155
+//
+// The files use the layout of the BIP 158 vectors: a JSON array whose first
+// row names the columns, followed by one row per vector. A host vector is a
+// host followed by its network ID, address in hex and the host written of
+// them, and a message vector a payload in hex followed by its addresses,
+// each as time,services,network,address,port with the address in hex. Both
+// end with the error the vector is rejected with, empty for a valid one.
+// Pass -check to verify existing files against the package instead:
+//
+//	gentestvectors -check
+//
+// The program lives in a directory of its own since the addrv2 package sits
+// at the root of the module.
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcd/wire"
+	addrv2 "github.com/christsim/bips/bip-0155"
+	"github.com/christsim/bips/internal/vectorfile"
+)
+
+const (
+	// hostColumns and messageColumns are the header rows of the vector
+	// files.
+	hostColumns    = "Host,Network,Address,Canonical,Error,Comment"
+	messageColumns = "Payload,Addresses,Error,Comment"
+)
+
+type JSONTestWriter struct {
+	writer          io.Writer
+	firstRowWritten bool
+}
+
+func NewJSONTestWriter(writer io.Writer) *JSONTestWriter {
+	return &JSONTestWriter{writer: writer}
+}
+
+func (w *JSONTestWriter) WriteComment(comment string) error {
+	return w.WriteTestCase([]interface{}{comment})
+}
+
+func (w *JSONTestWriter) WriteTestCase(row []interface{}) error {
+	var err error
+	if w.firstRowWritten {
+		_, err = io.WriteString(w.writer, ",\n")
+	} else {
+		_, err = io.WriteString(w.writer, "[\n")
+		w.firstRowWritten = true
+	}
+	if err != nil {
+		return err
+	}
+
+	rowBytes, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.writer.Write(rowBytes)
+	return err
+}
+
+func (w *JSONTestWriter) Close() error {
+	if !w.firstRowWritten {
+		return nil
+	}
+
+	_, err := io.WriteString(w.writer, "\n]\n")
+	return err
+}
+
+func main() {
+	hosts := flag.String("hosts", "hosts.json", "file of the host "+
+		"vectors")
+	messages := flag.String("messages", "addrv2.json", "file of the "+
+		"message vectors")
+	count := flag.Int("count", 50, "number of random messages to write "+
+		"vectors of")
+	seed := flag.Int64("seed", 155, "seed of the random vectors")
+	check := flag.Bool("check", false, "check the vector files instead "+
+		"of writing them")
+	flag.Parse()
+
+	var err error
+	if *check {
+		err = checkFiles(*hosts, *messages)
+	} else {
+		err = writeFiles(*hosts, *messages, *seed, *count)
+	}
+	if err != nil {
+		fmt.Println("Error: ", err.Error())
+		os.Exit(1)
+	}
+}
+
+// writeRows writes the header and rows to a new vector file at path.
+func writeRows(path, columns string, rows [][]interface{}) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := NewJSONTestWriter(file)
+	if err := writer.WriteComment(columns); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if err := writer.WriteTestCase(row); err != nil {
+			return err
+		}
+	}
+	return writer.Close()
+}
+
+// formatAddrs returns the addresses as time,services,network,address,port
+// strings.
+func formatAddrs(addrs []addrv2.Address) []string {
+	formatted := make([]string, len(addrs))
+	for i, a := range addrs {
+		formatted[i] = fmt.Sprintf("%d,%d,%d,%x,%d", a.Time,
+			uint64(a.Services), a.Network, a.Addr, a.Port)
+	}
+	return formatted
+}
+
+// parseAddrs returns the addresses of time,services,network,address,port
+// strings.
+func parseAddrs(formatted []string) ([]addrv2.Address, error) {
+	addrs := make([]addrv2.Address, len(formatted))
+	for i, s := range formatted {
+		fields := strings.Split(s, ",")
+		if len(fields) != 5 {
+			return nil, fmt.Errorf("address %q of %d fields", s,
+				len(fields))
+		}
+		t, err := strconv.ParseUint(fields[0], 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		services, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		network, err := strconv.ParseUint(fields[2], 10, 8)
+		if err != nil {
+			return nil, err
+		}
+		addr, err := hex.DecodeString(fields[3])
+		if err != nil {
+			return nil, err
+		}
+		port, err := strconv.ParseUint(fields[4], 10, 16)
+		if err != nil {
+			return nil, err
+		}
+		addrs[i] = addrv2.Address{
+			Time:     uint32(t),
+			Services: wire.ServiceFlag(services),
+			Network:  addrv2.NetworkID(network),
+			Addr:     addr,
+			Port:     uint16(port),
+		}
+	}
+	return addrs, nil
+}
+
+// writeFiles writes the host vectors, and the message vectors with count
+// random ones.
+func writeFiles(hosts, messages string, seed int64, count int) error {
+	var rows [][]interface{}
+	hostVectors := addrv2.HostVectors()
+	for _, v := range hostVectors {
+		rows = append(rows, []interface{}{
+			v.Host,
+			int(v.Network),
+			hex.EncodeToString(v.Addr),
+			v.Canonical,
+			vectorfile.ErrorString(v.Err),
+			v.Comment,
+		})
+	}
+	if err := writeRows(hosts, hostColumns, rows); err != nil {
+		return err
+	}
+
+	rows = nil
+	messageVectors := addrv2.MessageVectors(seed, count)
+	for _, v := range messageVectors {
+		rows = append(rows, []interface{}{
+			hex.EncodeToString(v.Payload),
+			formatAddrs(v.Addrs),
+			vectorfile.ErrorString(v.Err),
+			v.Comment,
+		})
+	}
+	if err := writeRows(messages, messageColumns, rows); err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote %d host vectors and %d message vectors\n",
+		len(hostVectors), len(messageVectors))
+	return nil
+}
+
+// checkFiles checks each vector of the files with addrv2.CheckHostVector
+// and addrv2.CheckMessageVector.
+func checkFiles(hosts, messages string) error {
+	hostRows, err := vectorfile.ReadRows(hosts, 6)
+	if err != nil {
+		return err
+	}
+	for _, row := range hostRows {
+		var v addrv2.HostVector
+		var network int
+		var addrHex, errMsg string
+		err := vectorfile.DecodeRow(row, &v.Host, &network, &addrHex,
+			&v.Canonical, &errMsg, &v.Comment)
+		if err != nil {
+			return err
+		}
+		v.Network = addrv2.NetworkID(network)
+		if v.Addr, err = hex.DecodeString(addrHex); err != nil {
+			return fmt.Errorf("%v: %v", v.Comment, err)
+		}
+		v.Err = vectorfile.ParseError(errMsg)
+		if err := addrv2.CheckHostVector(v); err != nil {
+			return fmt.Errorf("%v: %v", v.Comment, err)
+		}
+	}
+
+	messageRows, err := vectorfile.ReadRows(messages, 4)
+	if err != nil {
+		return err
+	}
+	for _, row := range messageRows {
+		var v addrv2.MessageVector
+		var payloadHex, errMsg string
+		var addrs []string
+		err := vectorfile.DecodeRow(row, &payloadHex, &addrs, &errMsg,
+			&v.Comment)
+		if err != nil {
+			return err
+		}
+		if v.Payload, err = hex.DecodeString(payloadHex); err != nil {
+			return fmt.Errorf("%v: %v", v.Comment, err)
+		}
+		if v.Addrs, err = parseAddrs(addrs); err != nil {
+			return fmt.Errorf("%v: %v", v.Comment, err)
+		}
+		v.Err = vectorfile.ParseError(errMsg)
+		if err := addrv2.CheckMessageVector(v); err != nil {
+			return fmt.Errorf("%v: %v", v.Comment, err)
+		}
+	}
+
+	fmt.Printf("%d host vectors and %d message vectors OK\n",
+		len(hostRows), len(messageRows))
+	return nil
+}
@@ -0,0 +1,131 @@
+package addrv2
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+const (
+	// CmdAddrV2 and CmdSendAddrV2 are the commands of the BIP 155
+	// messages.
+	CmdAddrV2     = "addrv2"
+	CmdSendAddrV2 = "sendaddrv2"
+
+	// MaxAddrs is the most addresses an addrv2 message may hold.
+	MaxAddrs = 1000
+
+	// maxEntryLen is the longest entry of an addrv2 message: its time,
+	// services, network ID, address and port.
+	maxEntryLen = 4 + wire.MaxVarIntPayload + 1 + wire.MaxVarIntPayload +
+		MaxAddrLen + 2
+)
+
+// MsgSendAddrV2 announces, before verack, that a peer would rather be sent
+// addrv2 messages than addr. It has no payload.
+type MsgSendAddrV2 struct{}
+
+// BtcEncode implements wire.Message.
+func (msg *MsgSendAddrV2) BtcEncode(io.Writer, uint32,
+	wire.MessageEncoding) error {
+
+	return nil
+}
+
+// BtcDecode implements wire.Message.
+func (msg *MsgSendAddrV2) BtcDecode(io.Reader, uint32,
+	wire.MessageEncoding) error {
+
+	return nil
+}
+
+// Command returns "sendaddrv2".
+func (msg *MsgSendAddrV2) Command() string {
+	return CmdSendAddrV2
+}
+
+// MaxPayloadLength returns 0, since the message has no payload.
+func (msg *MsgSendAddrV2) MaxPayloadLength(uint32) uint32 {
+	return 0
+}
+
+// MsgAddrV2 gossips the addresses of peers, of any network.
+type MsgAddrV2 struct {
+	Addrs []Address
+}
+
+// Serialize writes the message payload to w. Every address must be valid,
+// as Validate checks it.
+func (msg *MsgAddrV2) Serialize(w io.Writer) error {
+	if len(msg.Addrs) > MaxAddrs {
+		return fmt.Errorf("%w: %d addresses, max %d", ErrTooMany,
+			len(msg.Addrs), MaxAddrs)
+	}
+	if err := wire.WriteVarInt(w, 0, uint64(len(msg.Addrs))); err != nil {
+		return err
+	}
+	for i := range msg.Addrs {
+		if err := msg.Addrs[i].Serialize(w); err != nil {
+			return fmt.Errorf("address %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// Deserialize reads the message payload from r, rejecting the message if
+// any address is invalid. Addresses of unknown networks are kept.
+func (msg *MsgAddrV2) Deserialize(r io.Reader) error {
+	count, err := wire.ReadVarInt(r, 0)
+	if err != nil {
+		return err
+	}
+	if count > MaxAddrs {
+		return fmt.Errorf("%w: %d addresses, max %d", ErrTooMany,
+			count, MaxAddrs)
+	}
+	msg.Addrs = make([]Address, count)
+	for i := range msg.Addrs {
+		if err := msg.Addrs[i].Deserialize(r); err != nil {
+			return fmt.Errorf("address %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// BtcEncode implements wire.Message.
+func (msg *MsgAddrV2) BtcEncode(w io.Writer, _ uint32,
+	_ wire.MessageEncoding) error {
+
+	return msg.Serialize(w)
+}
+
+// BtcDecode implements wire.Message.
+func (msg *MsgAddrV2) BtcDecode(r io.Reader, _ uint32,
+	_ wire.MessageEncoding) error {
+
+	return msg.Deserialize(r)
+}
+
+// Command returns "addrv2".
+func (msg *MsgAddrV2) Command() string {
+	return CmdAddrV2
+}
+
+// MaxPayloadLength returns the size of the payload of MaxAddrs addresses of
+// MaxAddrLen bytes.
+func (msg *MsgAddrV2) MaxPayloadLength(uint32) uint32 {
+	return wire.MaxVarIntPayload + MaxAddrs*maxEntryLen
+}
+
+// KnownAddrs returns the addresses of the message of known networks, those
+// a node that doesn't relay addresses should consider.
+func (msg *MsgAddrV2) KnownAddrs() []Address {
+	var known []Address
+	for _, a := range msg.Addrs {
+		if a.Known() {
+			known = append(known, a)
+		}
+	}
+	return known
+}
@@ -0,0 +1,387 @@
+package addrv2
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/rand"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/christsim/bips/internal/vectorfile"
+)
+
+// ErrVectorMismatch is returned by CheckHostVector and CheckMessageVector
+// when a vector doesn't give the expected result.
+var ErrVectorMismatch = errors.New("addrv2: vector mismatch")
+
+// HostVector is a host and what ParseHost returns for it: its network, its
+// address and the host FormatHost writes of them, or the error it's
+// rejected with.
+type HostVector struct {
+	Host string
+
+	Network   NetworkID
+	Addr      []byte
+	Canonical string
+
+	// Err is the error an invalid host is rejected with, or nil.
+	Err error
+
+	// Comment describes what the vector exercises.
+	Comment string
+}
+
+// MessageVector is the payload of an addrv2 message and the addresses it
+// holds, or the error it's rejected with.
+type MessageVector struct {
+	Payload []byte
+	Addrs   []Address
+
+	// Err is the error an invalid payload is rejected with, or nil.
+	Err error
+
+	// Comment describes what the vector exercises.
+	Comment string
+}
+
+// newHostVector returns the vector of parsing the host.
+func newHostVector(host, comment string) HostVector {
+	v := HostVector{Host: host, Comment: comment}
+	v.Network, v.Addr, v.Err = ParseHost(host)
+	if v.Err != nil {
+		return v
+	}
+	canonical, err := FormatHost(v.Network, v.Addr)
+	if err != nil {
+		panic(fmt.Sprintf("addrv2: %v: %v", comment, err))
+	}
+	v.Canonical = canonical
+	return v
+}
+
+// newMessageVector returns the vector of the payload.
+func newMessageVector(payload []byte, comment string) MessageVector {
+	v := MessageVector{Payload: payload, Comment: comment}
+	msg := &MsgAddrV2{}
+	if v.Err = msg.Deserialize(bytes.NewReader(payload)); v.Err == nil {
+		v.Addrs = msg.Addrs
+	}
+	return v
+}
+
+// mustSerialize returns the payload of an addrv2 message of the addresses,
+// panicking on an error.
+func mustSerialize(addrs ...Address) []byte {
+	var b bytes.Buffer
+	msg := &MsgAddrV2{Addrs: addrs}
+	if err := msg.Serialize(&b); err != nil {
+		panic(err)
+	}
+	return b.Bytes()
+}
+
+// rawEntry returns an entry of an addrv2 message of the network and address
+// as they are, so entries Serialize rejects can be written.
+func rawEntry(network NetworkID, addr []byte) []byte {
+	var b bytes.Buffer
+	b.Write([]byte{0x00, 0xe1, 0xf5, 0x05})
+	wire.WriteVarInt(&b, 0, uint64(wire.SFNodeNetwork))
+	b.WriteByte(byte(network))
+	wire.WriteVarBytes(&b, 0, addr)
+	b.Write([]byte{0x20, 0x8d})
+	return b.Bytes()
+}
+
+// rawMessage returns the payload of an addrv2 message of the entries, with
+// the count of entries passed.
+func rawMessage(count uint64, entries ...[]byte) []byte {
+	var b bytes.Buffer
+	wire.WriteVarInt(&b, 0, count)
+	for _, e := range entries {
+		b.Write(e)
+	}
+	return b.Bytes()
+}
+
+// vectorBytes returns n bytes derived from the tag.
+func vectorBytes(tag string, n int) []byte {
+	var b []byte
+	for i := 0; len(b) < n; i++ {
+		hash := sha256.Sum256([]byte(fmt.Sprintf("%s %d", tag, i)))
+		b = append(b, hash[:]...)
+	}
+	return b[:n]
+}
+
+// mustParse returns the address of the host and port, with the services
+// and time of the vectors, panicking on an error.
+func mustParse(hostPort string) Address {
+	a, err := ParseAddress(hostPort)
+	if err != nil {
+		panic(err)
+	}
+	a.Time = 100000000
+	a.Services = wire.SFNodeNetwork | wire.SFNodeWitness
+	return a
+}
+
+// HostVectors returns vectors of hosts of every known network, in either
+// case and of every kind of error: onion addresses of a bad checksum or
+// version, I2P addresses of other lengths, and IP addresses of the ranges
+// the networks rule out.
+func HostVectors() []HostVector {
+	torV3 := "pg6mmjiyjmcrsslvykfwnntlaru7p5svn6y2ymmju6nubxndf4pscryd" +
+		onionSuffix
+	torV3Key := vectorBytes("Tor v3", 32)
+	torV3Other, err := FormatHost(NetTorV3, torV3Key)
+	if err != nil {
+		panic(err)
+	}
+	badChecksum := append(append([]byte{}, torV3Key...), 0, 0,
+		torV3Version)
+	badVersion := append(append([]byte{}, torV3Key...),
+		torV3Checksum(torV3Key)...)
+	badVersion = append(badVersion, 2)
+	i2p := "ukeu3k5oycgaauneqgtnvselmt4yemvoilkln7jpvamvfx7dnkdq" +
+		i2pSuffix
+
+	return []HostVector{
+		newHostVector("1.2.3.4", "IPv4"),
+		newHostVector("::ffff:1.2.3.4", "IPv4 mapped to IPv6"),
+		newHostVector("2001:db8::1", "IPv6"),
+		newHostVector("2001:DB8:0:0:0:0:0:1", "IPv6 in upper case, "+
+			"not shortened"),
+		newHostVector("fd87:d87e:eb43::1", "IPv6 of OnionCat"),
+		newHostVector("fc32:17ea:e415:c3bf:9808:149d:b5a2:c9aa", "CJDNS"),
+		newHostVector("fc00::", "CJDNS, lowest address"),
+		newHostVector("fbff:ffff:ffff:ffff:ffff:ffff:ffff:ffff",
+			"IPv6 below fc00::/8"),
+		newHostVector("6hzph5hv6337r6p2.onion", "Tor v2"),
+		newHostVector(torV3, "Tor v3"),
+		newHostVector(torV3Other, "Tor v3 of a derived key"),
+		newHostVector(upper(torV3), "Tor v3 in upper case"),
+		newHostVector(base32Encoding.EncodeToString(badChecksum)+
+			onionSuffix, "Tor v3 of a bad checksum"),
+		newHostVector(base32Encoding.EncodeToString(badVersion)+
+			onionSuffix, "Tor v3 of version 2"),
+		newHostVector(base32Encoding.EncodeToString(torV3Key[:20])+
+			onionSuffix, "onion address of 20 bytes"),
+		newHostVector("pg6mmjiyjmcrsslvykfwnntlaru7p5svn6y2ymmju6nubx"+
+			"ndf4pscry1"+onionSuffix, "onion address not in base32"),
+		newHostVector(i2p, "I2P"),
+		newHostVector(upper(i2p), "I2P in upper case"),
+		newHostVector(base32Encoding.EncodeToString(
+			vectorBytes("I2P", 31))+i2pSuffix, "I2P address of 31 "+
+			"bytes"),
+		newHostVector("example.i2p", "I2P address not in base32"),
+		newHostVector("", "empty host"),
+		newHostVector("example.com", "DNS name"),
+		newHostVector("1.2.3.4.5", "IPv4 of 5 parts"),
+	}
+}
+
+// upper returns s in upper case but for its suffix.
+func upper(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if c == '.' {
+			break
+		}
+		if c >= 'a' && c <= 'z' {
+			b[i] = c - 'a' + 'A'
+		}
+	}
+	return string(b)
+}
+
+// randomAddress returns a random address of a network from 1 to 8, those
+// of 7 and 8 unknown and of random length.
+func randomAddress(rng *rand.Rand) Address {
+	a := Address{
+		Time:     rng.Uint32(),
+		Services: wire.ServiceFlag(rng.Uint64() >> uint(rng.Intn(64))),
+		Network:  NetworkID(1 + rng.Intn(8)),
+		Port:     uint16(rng.Intn(1 << 16)),
+	}
+	n := a.Network.AddrLen()
+	if !a.Known() {
+		n = rng.Intn(MaxAddrLen + 1)
+	}
+	a.Addr = make([]byte, n)
+	rng.Read(a.Addr)
+
+	// Keep IPv6 and CJDNS addresses in their ranges.
+	switch a.Network {
+	case NetIPv6:
+		a.Addr[0] = 0x20
+	case NetCJDNS:
+		a.Addr[0] = cjdnsPrefix
+	}
+	return a
+}
+
+// MessageVectors returns vectors of addrv2 messages of addresses of every
+// network, those of unknown networks, of the longest address and of every
+// kind of error: addresses of the wrong length for their network or of a
+// range it rules out, addresses and messages too long, and truncated
+// payloads. They are followed by count messages of random addresses,
+// derived from a math/rand source with the seed, truncated at random or
+// not.
+func MessageVectors(rngSeed int64, count int) []MessageVector {
+	all := []Address{
+		mustParse("1.2.3.4:8333"),
+		mustParse("[2001:db8::1]:8333"),
+		mustParse("[6hzph5hv6337r6p2.onion]:8333"),
+		mustParse("[pg6mmjiyjmcrsslvykfwnntlaru7p5svn6y2ymmju6nubxndf" +
+			"4pscryd.onion]:8333"),
+		mustParse("[ukeu3k5oycgaauneqgtnvselmt4yemvoilkln7jpvamvfx7dn" +
+			"kdq.b32.i2p]:0"),
+		mustParse("[fc32:17ea:e415:c3bf:9808:149d:b5a2:c9aa]:8333"),
+	}
+	unknown := Address{
+		Time:    1,
+		Network: 42,
+		Addr:    vectorBytes("unknown", 7),
+		Port:    1,
+	}
+	longest := Address{
+		Network: 255,
+		Addr:    vectorBytes("longest", MaxAddrLen),
+	}
+	services := mustParse("1.2.3.4:8333")
+	services.Services = 1<<63 | wire.SFNodeCF
+
+	vectors := []MessageVector{
+		newMessageVector(mustSerialize(), "no addresses"),
+		newMessageVector(mustSerialize(all...), "address of every "+
+			"known network"),
+		newMessageVector(mustSerialize(unknown, all[0]), "address of "+
+			"an unknown network"),
+		newMessageVector(mustSerialize(longest), "address of "+
+			"MaxAddrLen bytes"),
+		newMessageVector(mustSerialize(services), "services of a "+
+			"9 byte CompactSize"),
+		newMessageVector(rawMessage(1, rawEntry(NetIPv4,
+			vectorBytes("IPv4", 5))), "IPv4 address of 5 bytes"),
+		newMessageVector(rawMessage(1, rawEntry(NetTorV3,
+			vectorBytes("Tor v3", 33))), "Tor v3 address of 33 "+
+			"bytes"),
+		newMessageVector(rawMessage(1, rawEntry(NetI2P,
+			vectorBytes("I2P", 31))), "I2P address of 31 bytes"),
+		newMessageVector(rawMessage(1, rawEntry(NetCJDNS,
+			append([]byte{0xfd}, vectorBytes("CJDNS", 15)...))),
+			"CJDNS address outside fc00::/8"),
+		newMessageVector(rawMessage(1, rawEntry(NetIPv6,
+			append(append([]byte{}, ipv4Prefix...), 1, 2, 3, 4))),
+			"IPv6 address mapping an IPv4 address"),
+		newMessageVector(rawMessage(1, rawEntry(NetIPv6,
+			append(append([]byte{}, torV2Prefix...),
+				vectorBytes("OnionCat", 10)...))),
+			"IPv6 address of OnionCat"),
+		newMessageVector(rawMessage(1, rawEntry(255,
+			vectorBytes("too long", MaxAddrLen+1))), "address of "+
+			"MaxAddrLen+1 bytes"),
+		newMessageVector(rawMessage(MaxAddrs+1), "MaxAddrs+1 "+
+			"addresses"),
+		newMessageVector(rawMessage(2, rawEntry(NetIPv4,
+			vectorBytes("IPv4", 4))), "second address missing"),
+	}
+
+	rng := rand.New(rand.NewSource(rngSeed))
+	for i := 0; i < count; i++ {
+		addrs := make([]Address, 1+rng.Intn(8))
+		for j := range addrs {
+			addrs[j] = randomAddress(rng)
+		}
+		payload := mustSerialize(addrs...)
+		comment := fmt.Sprintf("random message %d of %d addresses", i,
+			len(addrs))
+		if rng.Intn(4) == 0 {
+			n := rng.Intn(len(payload))
+			payload = payload[:n]
+			comment += fmt.Sprintf(", truncated to %d bytes", n)
+		}
+		vectors = append(vectors, newMessageVector(payload, comment))
+	}
+	return vectors
+}
+
+// sameAddress reports whether the addresses are the same.
+func sameAddress(a, b *Address) bool {
+	return a.Time == b.Time && a.Services == b.Services &&
+		a.Network == b.Network && bytes.Equal(a.Addr, b.Addr) &&
+		a.Port == b.Port
+}
+
+// CheckHostVector parses the host of the vector, which must give the
+// expected network and address or error, and parses the host FormatHost
+// writes of a valid one, which must give the same address.
+func CheckHostVector(v HostVector) error {
+	network, addr, err := ParseHost(v.Host)
+	if !vectorfile.SameError(err, v.Err) {
+		return fmt.Errorf("%w: error %v, expected %v",
+			ErrVectorMismatch, err, v.Err)
+	}
+	if err != nil {
+		return nil
+	}
+	if network != v.Network || !bytes.Equal(addr, v.Addr) {
+		return fmt.Errorf("%w: %v address %x, expected %v address %x",
+			ErrVectorMismatch, network, addr, v.Network, v.Addr)
+	}
+
+	canonical, err := FormatHost(network, addr)
+	if err != nil {
+		return err
+	}
+	if canonical != v.Canonical {
+		return fmt.Errorf("%w: host %s, expected %s", ErrVectorMismatch,
+			canonical, v.Canonical)
+	}
+	network, addr, err = ParseHost(canonical)
+	if err != nil {
+		return fmt.Errorf("%w: canonical host: %v", ErrVectorMismatch,
+			err)
+	}
+	if network != v.Network || !bytes.Equal(addr, v.Addr) {
+		return fmt.Errorf("%w: canonical host parses to %v address %x",
+			ErrVectorMismatch, network, addr)
+	}
+	return nil
+}
+
+// CheckMessageVector decodes the payload of the vector, which must give the
+// expected addresses or error, and encodes the addresses of a valid one,
+// which must give the payload again.
+func CheckMessageVector(v MessageVector) error {
+	msg := &MsgAddrV2{}
+	err := msg.Deserialize(bytes.NewReader(v.Payload))
+	if !vectorfile.SameError(err, v.Err) {
+		return fmt.Errorf("%w: error %v, expected %v",
+			ErrVectorMismatch, err, v.Err)
+	}
+	if err != nil {
+		return nil
+	}
+	if len(msg.Addrs) != len(v.Addrs) {
+		return fmt.Errorf("%w: %d addresses, expected %d",
+			ErrVectorMismatch, len(msg.Addrs), len(v.Addrs))
+	}
+	for i := range msg.Addrs {
+		if !sameAddress(&msg.Addrs[i], &v.Addrs[i]) {
+			return fmt.Errorf("%w: address %d %+v, expected %+v",
+				ErrVectorMismatch, i, msg.Addrs[i], v.Addrs[i])
+		}
+	}
+
+	var b bytes.Buffer
+	if err := msg.Serialize(&b); err != nil {
+		return err
+	}
+	if !bytes.Equal(b.Bytes(), v.Payload) {
+		return fmt.Errorf("%w: payload %x, expected %x",
+			ErrVectorMismatch, b.Bytes(), v.Payload)
+	}
+	return nil
+}
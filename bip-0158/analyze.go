@@ -0,0 +1,315 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/christsim/bips/bip-0158/backend/chaincfg"
+	"github.com/christsim/bips/bip-0158/backend/wire"
+	"github.com/christsim/bips/bip-0158/gcs"
+	"github.com/christsim/bips/bip-0158/gcs/builder"
+	"github.com/christsim/bips/bip-0158/prevout"
+	"github.com/christsim/bips/bip-0158/script"
+)
+
+// filterDelta holds how the legacy basic filter of a block, or of a range of
+// blocks, differs from the basic filter of the final BIP 158. Elements are
+// counted once per block, as each filter holds them.
+type filterDelta struct {
+	Blocks int `json:"blocks"`
+
+	// LegacyElements and FinalElements are the number of elements of
+	// each filter, SharedElements those in both, and LegacyOnly and
+	// FinalOnly those in only one of them.
+	LegacyElements uint64 `json:"legacy_elements"`
+	FinalElements  uint64 `json:"final_elements"`
+	SharedElements uint64 `json:"shared_elements"`
+	LegacyOnly     uint64 `json:"legacy_only"`
+	FinalOnly      uint64 `json:"final_only"`
+
+	// LegacyBytes and FinalBytes are the sizes of the filters at the
+	// default P, N prefix included.
+	LegacyBytes uint64 `json:"legacy_bytes"`
+	FinalBytes  uint64 `json:"final_bytes"`
+
+	// The output scripts of the blocks, and among them those a wallet on
+	// the legacy scheme can't find in its filter because they fail to
+	// parse or push no data, and the OP_RETURN outputs the final filter
+	// leaves out while the legacy one holds their pushes.
+	OutputScripts      uint64 `json:"output_scripts"`
+	UnparseableScripts uint64 `json:"unparseable_scripts"`
+	PushlessScripts    uint64 `json:"pushless_scripts"`
+	NullDataScripts    uint64 `json:"nulldata_scripts"`
+}
+
+// analyzeHeader is the header row of the CSV report, in the same order as the
+// columns written by csvRow.
+var analyzeHeader = []string{
+	"height", "blocks", "legacy_elements", "final_elements",
+	"shared_elements", "legacy_only", "final_only", "legacy_bytes",
+	"final_bytes", "output_scripts", "unparseable_scripts",
+	"pushless_scripts", "nulldata_scripts",
+}
+
+// csvRow returns the delta formatted as a row of the CSV report, whose first
+// column is the height of the block, or total for the aggregate of a range.
+func (d *filterDelta) csvRow(height string) []string {
+	return []string{
+		height,
+		strconv.Itoa(d.Blocks),
+		strconv.FormatUint(d.LegacyElements, 10),
+		strconv.FormatUint(d.FinalElements, 10),
+		strconv.FormatUint(d.SharedElements, 10),
+		strconv.FormatUint(d.LegacyOnly, 10),
+		strconv.FormatUint(d.FinalOnly, 10),
+		strconv.FormatUint(d.LegacyBytes, 10),
+		strconv.FormatUint(d.FinalBytes, 10),
+		strconv.FormatUint(d.OutputScripts, 10),
+		strconv.FormatUint(d.UnparseableScripts, 10),
+		strconv.FormatUint(d.PushlessScripts, 10),
+		strconv.FormatUint(d.NullDataScripts, 10),
+	}
+}
+
+// add folds the delta of a block into that of a range.
+func (d *filterDelta) add(block *blockDelta) {
+	d.Blocks += block.Blocks
+	d.LegacyElements += block.LegacyElements
+	d.FinalElements += block.FinalElements
+	d.SharedElements += block.SharedElements
+	d.LegacyOnly += block.LegacyOnly
+	d.FinalOnly += block.FinalOnly
+	d.LegacyBytes += block.LegacyBytes
+	d.FinalBytes += block.FinalBytes
+	d.OutputScripts += block.OutputScripts
+	d.UnparseableScripts += block.UnparseableScripts
+	d.PushlessScripts += block.PushlessScripts
+	d.NullDataScripts += block.NullDataScripts
+}
+
+// blockDelta is the delta of a single block.
+type blockDelta struct {
+	Height int64 `json:"height"`
+	filterDelta
+}
+
+// analyzeReport is the JSON report of the analyze subcommand.
+type analyzeReport struct {
+	Start  int64         `json:"start"`
+	End    int64         `json:"end"`
+	Blocks []*blockDelta `json:"blocks,omitempty"`
+	Total  filterDelta   `json:"total"`
+}
+
+// runAnalyze implements the analyze subcommand, which walks a range of blocks
+// and reports how the legacy basic filter of each, holding transaction
+// hashes, spent outpoints and the data pushed by output scripts, differs from
+// the basic filter of the final BIP 158, holding the previous output scripts
+// and output scripts, to quantify what a wallet still on the old scheme has
+// to migrate. The previous output scripts are resolved from Bitcoin Core's
+// undo files or a UTXO index, as for the spec-basic policy.
+func runAnalyze(args []string) error {
+	fs := flag.NewFlagSet("analyze", flag.ContinueOnError)
+	start := fs.Int64("start", 0, "first block height to include")
+	end := fs.Int64("end", 100, "last block height to include")
+	blocksDir := fs.String("blocksdir", "", "Bitcoin Core blocks directory "+
+		"to read previous output scripts from")
+	utxoDB := fs.String("utxodb", "", "UTXO index to resolve previous "+
+		"output scripts from, instead of -blocksdir")
+	perBlock := fs.Bool("perblock", true, "report each block as well as "+
+		"the aggregate")
+	format := fs.String("format", "csv", "output format: csv or json")
+	out := fs.String("out", "", "file to write the report to (default "+
+		"stdout)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *start > *end {
+		return fmt.Errorf("invalid block range %d-%d", *start, *end)
+	}
+	if *format != "csv" && *format != "json" {
+		return fmt.Errorf("unknown format %q", *format)
+	}
+
+	var resolver builder.PrevScriptResolver
+	switch {
+	case *blocksDir != "" && *utxoDB != "":
+		return fmt.Errorf("only one of -blocksdir and -utxodb may be " +
+			"set")
+
+	case *blocksDir != "":
+		undo, err := prevout.NewUndoResolver(*blocksDir,
+			chaincfg.TestNet3Params.Net)
+		if err != nil {
+			return fmt.Errorf("couldn't open undo files: %v", err)
+		}
+		defer undo.Close()
+		resolver = undo
+
+	case *utxoDB != "":
+		index, err := prevout.OpenUTXOIndex(*utxoDB)
+		if err != nil {
+			return fmt.Errorf("couldn't open UTXO index: %v", err)
+		}
+		defer index.Close()
+		resolver = index
+
+	default:
+		return fmt.Errorf("the final filter needs previous output " +
+			"scripts: set -blocksdir or -utxodb")
+	}
+	final := builder.SpecBasicPolicy{Resolver: resolver}
+
+	report := &analyzeReport{Start: *start, End: *end}
+	height := *start
+	add := func(block *wire.MsgBlock) error {
+		delta, err := analyzeBlock(block, final)
+		if err != nil {
+			return err
+		}
+		delta.Height = height
+		height++
+		report.Total.add(delta)
+		if *perBlock {
+			report.Blocks = append(report.Blocks, delta)
+		}
+		return nil
+	}
+	if err := compareChainBlocks(*start, *end, add); err != nil {
+		return err
+	}
+
+	w := io.Writer(os.Stdout)
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+
+	return writeAnalyzeReport(w, *format, report)
+}
+
+// analyzeBlock returns the delta between the legacy basic filter of the block
+// and its final basic filter, built by the passed policy.
+func analyzeBlock(block *wire.MsgBlock,
+	final builder.SpecBasicPolicy) (*blockDelta, error) {
+
+	elements := builder.ExtractElements(block)
+	legacyEntries, err := elementEntries(builder.LegacyBasicPolicy{},
+		elements)
+	if err != nil {
+		return nil, err
+	}
+	finalEntries, err := elementEntries(final, elements)
+	if err != nil {
+		return nil, fmt.Errorf("error generating %v filter: %v",
+			final.Name(), err)
+	}
+
+	delta := &blockDelta{filterDelta: filterDelta{
+		Blocks:         1,
+		LegacyElements: uint64(len(legacyEntries)),
+		FinalElements:  uint64(len(finalEntries)),
+	}}
+	legacy := make(map[string]struct{}, len(legacyEntries))
+	for _, entry := range legacyEntries {
+		legacy[string(entry)] = struct{}{}
+	}
+	for _, entry := range finalEntries {
+		if _, ok := legacy[string(entry)]; ok {
+			delta.SharedElements++
+		}
+	}
+	delta.LegacyOnly = delta.LegacyElements - delta.SharedElements
+	delta.FinalOnly = delta.FinalElements - delta.SharedElements
+
+	key := builder.DeriveKey(&elements.BlockHash)
+	delta.LegacyBytes, err = filterSize(key, legacyEntries)
+	if err != nil {
+		return nil, err
+	}
+	delta.FinalBytes, err = filterSize(key, finalEntries)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, pkScript := range elements.OutputScripts {
+		delta.OutputScripts++
+		data, err := script.PushedData(pkScript)
+		switch {
+		case err != nil:
+			delta.UnparseableScripts++
+		case len(data) == 0:
+			delta.PushlessScripts++
+		}
+		if script.Classify(pkScript) == script.NullData {
+			delta.NullDataScripts++
+		}
+	}
+
+	return delta, nil
+}
+
+// elementEntries returns the distinct entries the policy puts into the filter
+// of the block whose elements are passed.
+func elementEntries(policy builder.ElementPolicy,
+	e *builder.BlockElements) ([][]byte, error) {
+
+	b := builder.GetBuilder(builder.DeriveKey(&e.BlockHash),
+		builder.DefaultP)
+	defer builder.PutBuilder(b)
+
+	policy.AddElements(b, e)
+
+	return b.Entries()
+}
+
+// filterSize returns the size of the filter of the entries at the default P,
+// N prefix included.
+func filterSize(key [gcs.KeySize]byte, entries [][]byte) (uint64, error) {
+	filter, err := gcs.BuildGCSFilter(builder.DefaultP, key, entries)
+	if err != nil {
+		return 0, err
+	}
+	nBytes, err := filter.NBytes()
+	if err != nil {
+		return 0, err
+	}
+	return uint64(len(nBytes)), nil
+}
+
+// writeAnalyzeReport writes the report to w in the requested format.
+func writeAnalyzeReport(w io.Writer, format string,
+	report *analyzeReport) error {
+
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(analyzeHeader); err != nil {
+		return err
+	}
+	for _, d := range report.Blocks {
+		height := strconv.FormatInt(d.Height, 10)
+		if err := cw.Write(d.csvRow(height)); err != nil {
+			return err
+		}
+	}
+	if err := cw.Write(report.Total.csvRow("total")); err != nil {
+		return err
+	}
+	cw.Flush()
+
+	return cw.Error()
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/christsim/bips/bip-0158/backend/chainhash"
+	"github.com/christsim/bips/bip-0158/backend/wire"
+	"github.com/christsim/bips/bip-0158/filterarchive"
+	"github.com/christsim/bips/bip-0158/filterdb"
+)
+
+// runExport implements the export subcommand, which writes the filters of a
+// filter store built by the index subcommand to an archive that the import
+// subcommand can load into another store.
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	dbPath := fs.String("db", "filterdb", "filter store to export from")
+	out := fs.String("out", "filters.tar", "archive to write")
+	typeList := fs.String("types", "basic,extended", "comma separated list "+
+		"of filter types to export")
+	netName := fs.String("net", "testnet3", "network the filters belong "+
+		"to, recorded in the manifest")
+	start := fs.Uint("start", 0, "first block height to export")
+	end := fs.Int64("end", -1, "last block height to export (default the "+
+		"store's tip)")
+	segmentSize := fs.Uint("segment", filterarchive.DefaultSegmentSize,
+		"number of blocks per segment")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	db, err := filterdb.Open(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	last := uint32(*end)
+	if *end < 0 {
+		last, err = db.TipHeight()
+		if err != nil {
+			return err
+		}
+	}
+	if uint32(*start) > last {
+		return fmt.Errorf("start height %d is above end height %d",
+			*start, last)
+	}
+
+	file, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	bw := bufio.NewWriter(file)
+
+	w := filterarchive.NewWriter(bw, *netName, uint32(*segmentSize))
+	for _, name := range strings.Split(*typeList, ",") {
+		filterType, ok := indexedTypes[strings.TrimSpace(name)]
+		if !ok {
+			return fmt.Errorf("can't export filter type %q", name)
+		}
+		err := exportSet(w, db, filterType, uint32(*start), last)
+		if err != nil {
+			return fmt.Errorf("%v filters: %w", name, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		return err
+	}
+
+	r, err := filterarchive.Open(*out)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	fmt.Printf("Wrote filters of blocks %d-%d to %v, archive ID %v\n",
+		*start, last, *out, r.ID())
+	return nil
+}
+
+// exportSet adds the filters of a single type to an archive, checking the
+// header the archive derives for each against the one in the store.
+func exportSet(w *filterarchive.Writer, db *filterdb.DB,
+	filterType wire.FilterType, start, end uint32) error {
+
+	// The header preceding the first filter anchors the archived chain.
+	var prevHeader chainhash.Hash
+	if start > 0 {
+		blockHash, err := db.BlockHash(start - 1)
+		if err != nil {
+			return err
+		}
+		header, err := db.FetchHeader(blockHash, filterType)
+		if err != nil {
+			return err
+		}
+		prevHeader = *header
+	}
+
+	begun := false
+	next := start
+	err := db.ForEach(filterType, start, end, func(e *filterdb.Entry) error {
+		if e.Height != next {
+			return fmt.Errorf("no filter at height %d", next)
+		}
+		if e.Filter == nil {
+			return fmt.Errorf("filter at height %d has been pruned",
+				e.Height)
+		}
+		if !begun {
+			err := w.BeginSet(filterType, e.Filter.P(), start,
+				prevHeader)
+			if err != nil {
+				return err
+			}
+			begun = true
+		}
+
+		header, err := w.Append(e.Height, &e.BlockHash, e.Filter)
+		if err != nil {
+			return err
+		}
+		if header != e.Header {
+			return fmt.Errorf("filter at height %d doesn't match "+
+				"its stored header", e.Height)
+		}
+		next++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if next != end+1 {
+		return fmt.Errorf("no filter at height %d", next)
+	}
+
+	return nil
+}
+
+// runImport implements the import subcommand, which verifies an archive
+// written by the export subcommand and loads its filters into a filter store.
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	in := fs.String("in", "filters.tar", "archive to import")
+	dbPath := fs.String("db", "filterdb", "filter store to import into")
+	id := fs.String("id", "", "archive ID to require, as printed by export")
+	verifyOnly := fs.Bool("verify", false, "only verify the archive")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	r, err := filterarchive.Open(*in)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	if *id != "" && !strings.EqualFold(*id, r.ID()) {
+		return fmt.Errorf("archive ID is %v, expected %v", r.ID(), *id)
+	}
+	if err := r.Verify(); err != nil {
+		return err
+	}
+	for _, set := range r.Manifest().Sets {
+		fmt.Printf("Filter type %d: blocks %d-%d, tip header %v\n",
+			set.FilterType, set.StartHeight, set.EndHeight,
+			set.TipHeader)
+	}
+	fmt.Printf("Archive %v verified\n", r.ID())
+	if *verifyOnly {
+		return nil
+	}
+
+	db, err := filterdb.Open(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	for _, set := range r.Manifest().Sets {
+		if err := importSet(r, db, set); err != nil {
+			return fmt.Errorf("filter type %d: %w", set.FilterType,
+				err)
+		}
+	}
+
+	fmt.Printf("Imported archive into %v\n", *dbPath)
+	return nil
+}
+
+// importSet writes the filters of a single type from an archive to a filter
+// store. If the store already holds the header preceding the set, the set
+// must build on it.
+func importSet(r *filterarchive.Reader, db *filterdb.DB,
+	set *filterarchive.FilterSet) error {
+
+	if set.StartHeight > 0 {
+		blockHash, err := db.BlockHash(set.StartHeight - 1)
+		if err == nil {
+			var header *chainhash.Hash
+			header, err = db.FetchHeader(blockHash, set.FilterType)
+			if err == nil && header.String() != set.PrevHeader {
+				return fmt.Errorf("archive doesn't build on the "+
+					"store's filter header %v", header)
+			}
+		}
+		if err != nil && err != filterdb.ErrNotFound {
+			return err
+		}
+	}
+
+	batch := db.NewBatch()
+	err := r.ForEach(set, func(rec *filterarchive.Record) error {
+		err := batch.PutFilter(&filterdb.Entry{
+			Height:     rec.Height,
+			BlockHash:  rec.BlockHash,
+			FilterType: set.FilterType,
+			Filter:     rec.Filter,
+			Header:     rec.Header,
+		})
+		if err != nil {
+			return err
+		}
+		if batch.Len() < indexBatchSize {
+			return nil
+		}
+
+		if err := db.WriteBatch(batch); err != nil {
+			return err
+		}
+		batch = db.NewBatch()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return db.WriteBatch(batch)
+}
@@ -0,0 +1,224 @@
+// Package attest signs and verifies published vector files, so that their
+// consumers can check both where the files came from and that they arrived
+// intact.
+//
+// The SHA-256 hash of each file is listed in a SHA256SUMS manifest, in the
+// BSD format printed by sha256sum --tag, and the manifest is signed with an
+// Ed25519 key. Keys, and the detached signature in SHA256SUMS.sig, use the
+// formats of OpenBSD's signify, so a release can also be checked without
+// this package:
+//
+//	signify -V -p vectors.pub -m SHA256SUMS -x SHA256SUMS.sig
+//	sha256sum -c SHA256SUMS
+//
+// Secret keys are written unencrypted; they are meant for test vector
+// releases, not for protecting funds.
+package attest
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	// commentPrefix starts the first line of every key and signature file.
+	commentPrefix = "untrusted comment: "
+
+	// keyNumSize is the size of the random number identifying a key pair,
+	// which signatures carry to tell which key made them.
+	keyNumSize = 8
+)
+
+var (
+	// pkAlg identifies Ed25519 keys and signatures.
+	pkAlg = []byte("Ed")
+
+	// kdfAlg identifies the key derivation of a secret key file.
+	kdfAlg = []byte("BK")
+)
+
+var (
+	// ErrBadKey is returned when parsing a malformed key file, or a secret
+	// key file encrypted with a passphrase.
+	ErrBadKey = errors.New("attest: malformed key")
+
+	// ErrBadSignature is returned when a signature is malformed or doesn't
+	// verify.
+	ErrBadSignature = errors.New("attest: bad signature")
+
+	// ErrWrongKey is returned when a signature was made by a different key
+	// than the one it is verified with.
+	ErrWrongKey = errors.New("attest: signed with a different key")
+)
+
+// PublicKey is a key signatures are verified with.
+type PublicKey struct {
+	KeyNum [keyNumSize]byte
+	Key    ed25519.PublicKey
+}
+
+// PrivateKey is a key vector files are signed with.
+type PrivateKey struct {
+	KeyNum [keyNumSize]byte
+	Key    ed25519.PrivateKey
+}
+
+// GenerateKey returns a new key pair, using entropy from rand.
+func GenerateKey(rand io.Reader) (*PrivateKey, error) {
+	_, key, err := ed25519.GenerateKey(rand)
+	if err != nil {
+		return nil, err
+	}
+
+	k := &PrivateKey{Key: key}
+	if _, err := io.ReadFull(rand, k.KeyNum[:]); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Public returns the public key of the key pair.
+func (k *PrivateKey) Public() *PublicKey {
+	return &PublicKey{
+		KeyNum: k.KeyNum,
+		Key:    k.Key.Public().(ed25519.PublicKey),
+	}
+}
+
+// Encode returns the contents of a secret key file holding the key, with the
+// passed comment.
+func (k *PrivateKey) Encode(comment string) []byte {
+	// The key isn't encrypted, which is denoted by zero KDF rounds. The
+	// salt is then unused, and the checksum lets readers detect a
+	// corrupted key.
+	var rounds [4]byte
+	var salt [16]byte
+	checksum := sha512.Sum512(k.Key)
+
+	var data []byte
+	data = append(data, pkAlg...)
+	data = append(data, kdfAlg...)
+	data = append(data, rounds[:]...)
+	data = append(data, salt[:]...)
+	data = append(data, checksum[:8]...)
+	data = append(data, k.KeyNum[:]...)
+	data = append(data, k.Key...)
+
+	return encodeFile(comment, data)
+}
+
+// ParsePrivateKey parses the contents of an unencrypted secret key file.
+func ParsePrivateKey(file []byte) (*PrivateKey, error) {
+	data, err := decodeFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadKey, err)
+	}
+	const size = 2 + 2 + 4 + 16 + 8 + keyNumSize + ed25519.PrivateKeySize
+	if len(data) != size || !bytes.Equal(data[:2], pkAlg) ||
+		!bytes.Equal(data[2:4], kdfAlg) {
+
+		return nil, fmt.Errorf("%w: not an Ed25519 secret key", ErrBadKey)
+	}
+	if !bytes.Equal(data[4:8], []byte{0, 0, 0, 0}) {
+		return nil, fmt.Errorf("%w: encrypted keys aren't supported",
+			ErrBadKey)
+	}
+
+	k := &PrivateKey{Key: make(ed25519.PrivateKey, ed25519.PrivateKeySize)}
+	copy(k.KeyNum[:], data[32:40])
+	copy(k.Key, data[40:])
+	if checksum := sha512.Sum512(k.Key); !bytes.Equal(checksum[:8],
+		data[24:32]) {
+
+		return nil, fmt.Errorf("%w: bad checksum", ErrBadKey)
+	}
+
+	return k, nil
+}
+
+// Encode returns the contents of a public key file holding the key, with the
+// passed comment.
+func (k *PublicKey) Encode(comment string) []byte {
+	var data []byte
+	data = append(data, pkAlg...)
+	data = append(data, k.KeyNum[:]...)
+	data = append(data, k.Key...)
+
+	return encodeFile(comment, data)
+}
+
+// ParsePublicKey parses the contents of a public key file.
+func ParsePublicKey(file []byte) (*PublicKey, error) {
+	data, err := decodeFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadKey, err)
+	}
+	if len(data) != 2+keyNumSize+ed25519.PublicKeySize ||
+		!bytes.Equal(data[:2], pkAlg) {
+
+		return nil, fmt.Errorf("%w: not an Ed25519 public key", ErrBadKey)
+	}
+
+	k := &PublicKey{Key: make(ed25519.PublicKey, ed25519.PublicKeySize)}
+	copy(k.KeyNum[:], data[2:10])
+	copy(k.Key, data[10:])
+	return k, nil
+}
+
+// Sign returns the contents of a detached signature file for msg.
+func (k *PrivateKey) Sign(msg []byte, comment string) []byte {
+	var data []byte
+	data = append(data, pkAlg...)
+	data = append(data, k.KeyNum[:]...)
+	data = append(data, ed25519.Sign(k.Key, msg)...)
+
+	return encodeFile(comment, data)
+}
+
+// Verify checks the contents of a detached signature file for msg.
+func (k *PublicKey) Verify(msg, sigFile []byte) error {
+	data, err := decodeFile(sigFile)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrBadSignature, err)
+	}
+	if len(data) != 2+keyNumSize+ed25519.SignatureSize ||
+		!bytes.Equal(data[:2], pkAlg) {
+
+		return fmt.Errorf("%w: not an Ed25519 signature", ErrBadSignature)
+	}
+	if !bytes.Equal(data[2:10], k.KeyNum[:]) {
+		return ErrWrongKey
+	}
+	if !ed25519.Verify(k.Key, msg, data[10:]) {
+		return ErrBadSignature
+	}
+
+	return nil
+}
+
+// encodeFile returns a key or signature file holding data after a comment
+// line.
+func encodeFile(comment string, data []byte) []byte {
+	comment = strings.ReplaceAll(comment, "\n", " ")
+	return []byte(commentPrefix + comment + "\n" +
+		base64.StdEncoding.EncodeToString(data) + "\n")
+}
+
+// decodeFile returns the data of a key or signature file.
+func decodeFile(file []byte) ([]byte, error) {
+	lines := strings.SplitN(string(file), "\n", 3)
+	if len(lines) < 2 || !strings.HasPrefix(lines[0], commentPrefix) {
+		return nil, errors.New("missing comment line")
+	}
+	if len(lines) == 3 && lines[2] != "" {
+		return nil, errors.New("trailing data")
+	}
+
+	return base64.StdEncoding.DecodeString(lines[1])
+}
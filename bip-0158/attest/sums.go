@@ -0,0 +1,168 @@
+package attest
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// SumsName is the name of the manifest of file hashes.
+	SumsName = "SHA256SUMS"
+
+	// SigName is the name of the detached signature of the manifest.
+	SigName = SumsName + ".sig"
+)
+
+// ErrHashMismatch is returned when a file doesn't have the hash listed in the
+// manifest.
+var ErrHashMismatch = errors.New("attest: file doesn't match its hash")
+
+// Sum is the SHA-256 hash of a file, named relative to the directory of the
+// manifest.
+type Sum struct {
+	Name   string
+	SHA256 [sha256.Size]byte
+}
+
+// HashFile returns the hash of the file at the passed path.
+func HashFile(path string) ([sha256.Size]byte, error) {
+	var sum [sha256.Size]byte
+
+	file, err := os.Open(path)
+	if err != nil {
+		return sum, err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return sum, err
+	}
+	copy(sum[:], h.Sum(nil))
+	return sum, nil
+}
+
+// EncodeSums returns a manifest listing the passed hashes, sorted by name.
+func EncodeSums(sums []Sum) []byte {
+	sorted := append([]Sum(nil), sums...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Name < sorted[j].Name
+	})
+
+	var buf bytes.Buffer
+	for _, sum := range sorted {
+		fmt.Fprintf(&buf, "SHA256 (%s) = %x\n", sum.Name, sum.SHA256)
+	}
+	return buf.Bytes()
+}
+
+// ParseSums parses a manifest.
+func ParseSums(manifest []byte) ([]Sum, error) {
+	var sums []Sum
+	scanner := bufio.NewScanner(bytes.NewReader(manifest))
+	for scanner.Scan() {
+		line := scanner.Text()
+		rest, ok := strings.CutPrefix(line, "SHA256 (")
+		i := strings.LastIndex(rest, ") = ")
+		if !ok || i < 0 {
+			return nil, fmt.Errorf("attest: malformed manifest line "+
+				"%q", line)
+		}
+
+		sum := Sum{Name: rest[:i]}
+		digest, err := hex.DecodeString(rest[i+4:])
+		if err != nil || len(digest) != sha256.Size {
+			return nil, fmt.Errorf("attest: malformed hash for %v",
+				sum.Name)
+		}
+		copy(sum.SHA256[:], digest)
+		sums = append(sums, sum)
+	}
+
+	return sums, scanner.Err()
+}
+
+// SignDir hashes the named files in dir, writes the manifest of their hashes
+// to dir and signs it with the passed key.
+func SignDir(dir string, names []string, key *PrivateKey) ([]Sum, error) {
+	sums := make([]Sum, 0, len(names))
+	for _, name := range names {
+		sum, err := HashFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		sums = append(sums, Sum{
+			Name:   filepath.ToSlash(name),
+			SHA256: sum,
+		})
+	}
+
+	manifest := EncodeSums(sums)
+	sig := key.Sign(manifest, "verify with "+keyComment(key.Public()))
+	err := os.WriteFile(filepath.Join(dir, SumsName), manifest, 0644)
+	if err != nil {
+		return nil, err
+	}
+	err = os.WriteFile(filepath.Join(dir, SigName), sig, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return sums, nil
+}
+
+// VerifyDir checks the signature of the manifest in dir with the passed key,
+// and then that every file it lists has the listed hash. The verified hashes
+// are returned.
+func VerifyDir(dir string, key *PublicKey) ([]Sum, error) {
+	manifest, err := os.ReadFile(filepath.Join(dir, SumsName))
+	if err != nil {
+		return nil, err
+	}
+	sig, err := os.ReadFile(filepath.Join(dir, SigName))
+	if err != nil {
+		return nil, err
+	}
+	if err := key.Verify(manifest, sig); err != nil {
+		return nil, err
+	}
+
+	sums, err := ParseSums(manifest)
+	if err != nil {
+		return nil, err
+	}
+	for _, sum := range sums {
+		// The manifest is trusted once its signature verifies, but
+		// names escaping the directory are refused all the same.
+		name := filepath.FromSlash(sum.Name)
+		if !filepath.IsLocal(name) {
+			return nil, fmt.Errorf("attest: manifest lists %v "+
+				"outside the directory", sum.Name)
+		}
+
+		actual, err := HashFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		if actual != sum.SHA256 {
+			return nil, fmt.Errorf("%w: %v", ErrHashMismatch, sum.Name)
+		}
+	}
+
+	return sums, nil
+}
+
+// keyComment returns a short description of a public key for the comment
+// line of a file.
+func keyComment(key *PublicKey) string {
+	return fmt.Sprintf("key %X", key.KeyNum)
+}
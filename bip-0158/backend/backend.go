@@ -0,0 +1,94 @@
+// Package backend isolates the module from the btcd implementation it is built
+// against. The tool was written against the roasbeef forks of btcd and
+// btcutil, which carried BIP 157 and 158 support before it was merged
+// upstream. It now builds against current btcsuite releases by default, and
+// against the forks with the roasbeef build tag:
+//
+//	go build -tags roasbeef
+//
+// The rest of the module never imports btcd directly. Block, transaction and
+// message types come from the wire, chainhash, chaincfg, txscript, btcutil and
+// btcec subpackages, which re-export the parts of the btcd package of the same
+// name that the module uses, so switching implementations changes no other
+// code. The btcec subpackage follows the API of btcec/v2, wrapping the fork's
+// functions where they differ.
+//
+// The node the generator and its subcommands read blocks from is reached
+// through the ChainClient interface, which DialRPC satisfies with a btcd RPC
+// client. The client also satisfies MempoolClient, for following the node's
+// mempool. Filters are always built by the gcs/builder package, so nothing
+// depends on the filter builder of either btcutil.
+package backend
+
+import (
+	"github.com/christsim/bips/bip-0158/backend/btcutil"
+	"github.com/christsim/bips/bip-0158/backend/chainhash"
+	"github.com/christsim/bips/bip-0158/backend/wire"
+)
+
+// ChainClient is the part of a btcd RPC client used to read the chain and the
+// filters the node builds. Nodes without filter support fail the GetCFilter
+// and GetCFilterHeader calls, and mainline btcd only builds basic filters.
+type ChainClient interface {
+	// GetBlockCount returns the height of the node's best block.
+	GetBlockCount() (int64, error)
+
+	// GetBlockHash returns the hash of the block at the passed height.
+	GetBlockHash(height int64) (*chainhash.Hash, error)
+
+	// GetBlock returns the block with the passed hash.
+	GetBlock(blockHash *chainhash.Hash) (*wire.MsgBlock, error)
+
+	// GetBlockHeader returns the header of the block with the passed
+	// hash.
+	GetBlockHeader(blockHash *chainhash.Hash) (*wire.BlockHeader, error)
+
+	// GetCFilter returns the node's filter of the passed type for the
+	// block.
+	GetCFilter(blockHash *chainhash.Hash,
+		filterType wire.FilterType) (*wire.MsgCFilter, error)
+
+	// GetCFilterHeader returns the node's filter header of the passed
+	// type for the block, in the PrevFilterHeader field.
+	GetCFilterHeader(blockHash *chainhash.Hash,
+		filterType wire.FilterType) (*wire.MsgCFHeaders, error)
+
+	// GetHeaders returns up to wire.MaxBlockHeadersPerMsg headers of the
+	// node's best chain following the first block of the locator it
+	// knows, ending at hashStop unless it is zero.
+	GetHeaders(blockLocators []chainhash.Hash,
+		hashStop *chainhash.Hash) ([]wire.BlockHeader, error)
+
+	// Shutdown disconnects from the node.
+	Shutdown()
+}
+
+// RPCConfig configures the connection DialRPC makes to a btcd node.
+type RPCConfig struct {
+	// Host is the host and port of the node's RPC server.
+	Host string
+
+	// User and Pass are the RPC credentials.
+	User string
+	Pass string
+
+	// Certificates holds the PEM encoded TLS certificate of the RPC
+	// server.
+	Certificates []byte
+
+	// OnTxAccepted, if set, is called with the hash of each transaction
+	// the node accepts to its mempool, which the client asks the node to
+	// notify it of.
+	OnTxAccepted func(txHash *chainhash.Hash)
+}
+
+// MempoolClient is the part of a btcd RPC client used to follow the node's
+// mempool. The clients DialRPC returns satisfy it.
+type MempoolClient interface {
+	// GetRawMempool returns the hashes of the transactions in the
+	// node's mempool.
+	GetRawMempool() ([]*chainhash.Hash, error)
+
+	// GetRawTransaction returns the transaction with the passed hash.
+	GetRawTransaction(txHash *chainhash.Hash) (*btcutil.Tx, error)
+}
@@ -0,0 +1,5 @@
+// Package btcec re-exports the parts of the btcd btcec package used by this
+// module, for secp256k1 public keys and curve arithmetic, with the API of
+// btcec/v2, which dropped the curve argument of the fork's functions. See the
+// backend package for how the implementation is chosen.
+package btcec
@@ -0,0 +1,22 @@
+//go:build !roasbeef
+
+package btcec
+
+import (
+	"crypto/elliptic"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+)
+
+// PublicKey is a secp256k1 public key.
+type PublicKey = btcec.PublicKey
+
+// ParsePubKey parses a serialized secp256k1 public key.
+func ParsePubKey(pubKey []byte) (*PublicKey, error) {
+	return btcec.ParsePubKey(pubKey)
+}
+
+// S256 returns the secp256k1 curve.
+func S256() elliptic.Curve {
+	return btcec.S256()
+}
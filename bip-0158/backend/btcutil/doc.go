@@ -0,0 +1,4 @@
+// Package btcutil re-exports the parts of the btcd btcutil package used by this
+// module, for addresses and the transactions of the RPC client. See the
+// backend package for how the implementation is chosen.
+package btcutil
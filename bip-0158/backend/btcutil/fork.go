@@ -0,0 +1,17 @@
+//go:build roasbeef
+
+package btcutil
+
+import "github.com/roasbeef/btcutil"
+
+// The types used in this module.
+type (
+	Address = btcutil.Address
+	Tx      = btcutil.Tx
+)
+
+// The functions used in this module.
+var (
+	DecodeAddress = btcutil.DecodeAddress
+	Hash160       = btcutil.Hash160
+)
@@ -0,0 +1,4 @@
+// Package chaincfg re-exports the parts of the btcd chaincfg package used by
+// this module, for the parameters of each Bitcoin network. See the backend
+// package for how the implementation is chosen.
+package chaincfg
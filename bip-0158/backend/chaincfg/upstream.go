@@ -0,0 +1,19 @@
+//go:build !roasbeef
+
+package chaincfg
+
+import "github.com/btcsuite/btcd/chaincfg"
+
+// The types used in this module.
+type (
+	Params = chaincfg.Params
+)
+
+// The parameters of each network. These are copies, so changes to them don't
+// affect the btcd packages.
+var (
+	MainNetParams       = chaincfg.MainNetParams
+	TestNet3Params      = chaincfg.TestNet3Params
+	RegressionNetParams = chaincfg.RegressionNetParams
+	SimNetParams        = chaincfg.SimNetParams
+)
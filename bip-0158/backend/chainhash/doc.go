@@ -0,0 +1,4 @@
+// Package chainhash re-exports the parts of the btcd chaincfg/chainhash package
+// used by this module, for the double SHA-256 hashes of blocks and
+// transactions. See the backend package for how the implementation is chosen.
+package chainhash
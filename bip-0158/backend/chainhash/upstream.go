@@ -0,0 +1,27 @@
+//go:build !roasbeef
+
+package chainhash
+
+import "github.com/btcsuite/btcd/chaincfg/chainhash"
+
+// The types used in this module.
+type (
+	Hash = chainhash.Hash
+)
+
+// The constants used in this module.
+const (
+	HashSize          = chainhash.HashSize
+	MaxHashStringSize = chainhash.MaxHashStringSize
+)
+
+// The functions used in this module.
+var (
+	Decode         = chainhash.Decode
+	DoubleHashB    = chainhash.DoubleHashB
+	DoubleHashH    = chainhash.DoubleHashH
+	HashB          = chainhash.HashB
+	HashH          = chainhash.HashH
+	NewHash        = chainhash.NewHash
+	NewHashFromStr = chainhash.NewHashFromStr
+)
@@ -0,0 +1,40 @@
+//go:build !roasbeef
+
+package backend
+
+import (
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/rpcclient"
+
+	"github.com/christsim/bips/bip-0158/backend/chainhash"
+)
+
+// DialRPC connects to a btcd node over its websocket RPC interface.
+func DialRPC(cfg *RPCConfig) (ChainClient, error) {
+	var handlers *rpcclient.NotificationHandlers
+	if cfg.OnTxAccepted != nil {
+		onTxAccepted := cfg.OnTxAccepted
+		handlers = &rpcclient.NotificationHandlers{
+			OnTxAccepted: func(txHash *chainhash.Hash, _ btcutil.Amount) {
+				onTxAccepted(txHash)
+			},
+		}
+	}
+	client, err := rpcclient.New(&rpcclient.ConnConfig{
+		Host:         cfg.Host,
+		Endpoint:     "ws",
+		User:         cfg.User,
+		Pass:         cfg.Pass,
+		Certificates: cfg.Certificates,
+	}, handlers)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.OnTxAccepted != nil {
+		if err := client.NotifyNewTransactions(false); err != nil {
+			client.Shutdown()
+			return nil, err
+		}
+	}
+	return client, nil
+}
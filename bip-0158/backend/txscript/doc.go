@@ -0,0 +1,4 @@
+// Package txscript re-exports the parts of the btcd txscript package used by
+// this module, for scripts: opcodes, script classes and the script builder. See
+// the backend package for how the implementation is chosen.
+package txscript
@@ -0,0 +1,74 @@
+//go:build roasbeef
+
+package txscript
+
+import "github.com/roasbeef/btcd/txscript"
+
+// The types used in this module.
+type (
+	ScriptBuilder = txscript.ScriptBuilder
+	ScriptClass   = txscript.ScriptClass
+)
+
+// The constants used in this module.
+const (
+	OP_0                  = txscript.OP_0
+	OP_FALSE              = txscript.OP_FALSE
+	OP_DATA_1             = txscript.OP_DATA_1
+	OP_DATA_20            = txscript.OP_DATA_20
+	OP_DATA_32            = txscript.OP_DATA_32
+	OP_DATA_33            = txscript.OP_DATA_33
+	OP_DATA_65            = txscript.OP_DATA_65
+	OP_DATA_75            = txscript.OP_DATA_75
+	OP_PUSHDATA1          = txscript.OP_PUSHDATA1
+	OP_PUSHDATA2          = txscript.OP_PUSHDATA2
+	OP_PUSHDATA4          = txscript.OP_PUSHDATA4
+	OP_1NEGATE            = txscript.OP_1NEGATE
+	OP_1                  = txscript.OP_1
+	OP_TRUE               = txscript.OP_TRUE
+	OP_2                  = txscript.OP_2
+	OP_3                  = txscript.OP_3
+	OP_4                  = txscript.OP_4
+	OP_5                  = txscript.OP_5
+	OP_6                  = txscript.OP_6
+	OP_7                  = txscript.OP_7
+	OP_8                  = txscript.OP_8
+	OP_9                  = txscript.OP_9
+	OP_10                 = txscript.OP_10
+	OP_11                 = txscript.OP_11
+	OP_12                 = txscript.OP_12
+	OP_13                 = txscript.OP_13
+	OP_14                 = txscript.OP_14
+	OP_15                 = txscript.OP_15
+	OP_16                 = txscript.OP_16
+	OP_RETURN             = txscript.OP_RETURN
+	OP_DROP               = txscript.OP_DROP
+	OP_2DROP              = txscript.OP_2DROP
+	OP_DUP                = txscript.OP_DUP
+	OP_EQUAL              = txscript.OP_EQUAL
+	OP_EQUALVERIFY        = txscript.OP_EQUALVERIFY
+	OP_HASH160            = txscript.OP_HASH160
+	OP_CHECKSIG           = txscript.OP_CHECKSIG
+	OP_CHECKMULTISIG      = txscript.OP_CHECKMULTISIG
+	NonStandardTy         = txscript.NonStandardTy
+	PubKeyTy              = txscript.PubKeyTy
+	PubKeyHashTy          = txscript.PubKeyHashTy
+	WitnessV0PubKeyHashTy = txscript.WitnessV0PubKeyHashTy
+	ScriptHashTy          = txscript.ScriptHashTy
+	WitnessV0ScriptHashTy = txscript.WitnessV0ScriptHashTy
+	MultiSigTy            = txscript.MultiSigTy
+	NullDataTy            = txscript.NullDataTy
+)
+
+// The functions used in this module.
+var (
+	ExtractPkScriptAddrs     = txscript.ExtractPkScriptAddrs
+	GetScriptClass           = txscript.GetScriptClass
+	IsPayToScriptHash        = txscript.IsPayToScriptHash
+	IsPayToWitnessPubKeyHash = txscript.IsPayToWitnessPubKeyHash
+	IsPayToWitnessScriptHash = txscript.IsPayToWitnessScriptHash
+	IsUnspendable            = txscript.IsUnspendable
+	NewScriptBuilder         = txscript.NewScriptBuilder
+	PayToAddrScript          = txscript.PayToAddrScript
+	PushedData               = txscript.PushedData
+)
@@ -0,0 +1,4 @@
+// Package wire re-exports the parts of the btcd wire package used by this
+// module, for the Bitcoin wire protocol: blocks, transactions and P2P messages.
+// See the backend package for how the implementation is chosen.
+package wire
@@ -0,0 +1,103 @@
+//go:build !roasbeef
+
+package wire
+
+import "github.com/btcsuite/btcd/wire"
+
+// The types used in this module.
+type (
+	BitcoinNet      = wire.BitcoinNet
+	BlockHeader     = wire.BlockHeader
+	FilterType      = wire.FilterType
+	InvType         = wire.InvType
+	InvVect         = wire.InvVect
+	Message         = wire.Message
+	MessageEncoding = wire.MessageEncoding
+	MsgBlock        = wire.MsgBlock
+	MsgCFCheckpt    = wire.MsgCFCheckpt
+	MsgCFHeaders    = wire.MsgCFHeaders
+	MsgCFilter      = wire.MsgCFilter
+	MsgGetData      = wire.MsgGetData
+	MsgGetHeaders   = wire.MsgGetHeaders
+	MsgHeaders      = wire.MsgHeaders
+	MsgInv          = wire.MsgInv
+	MsgPing         = wire.MsgPing
+	MsgPong         = wire.MsgPong
+	MsgTx           = wire.MsgTx
+	MsgVerAck       = wire.MsgVerAck
+	MsgVersion      = wire.MsgVersion
+	NetAddress      = wire.NetAddress
+	OutPoint        = wire.OutPoint
+	ServiceFlag     = wire.ServiceFlag
+	TxIn            = wire.TxIn
+	TxOut           = wire.TxOut
+	TxWitness       = wire.TxWitness
+)
+
+// The constants used in this module.
+const (
+	BaseEncoding          = wire.BaseEncoding
+	WitnessEncoding       = wire.WitnessEncoding
+	MainNet               = wire.MainNet
+	TestNet               = wire.TestNet
+	TestNet3              = wire.TestNet3
+	SimNet                = wire.SimNet
+	ProtocolVersion       = wire.ProtocolVersion
+	CommandSize           = wire.CommandSize
+	MessageHeaderSize     = wire.MessageHeaderSize
+	MaxMessagePayload     = wire.MaxMessagePayload
+	MaxBlockPayload       = wire.MaxBlockPayload
+	MaxBlockHeadersPerMsg = wire.MaxBlockHeadersPerMsg
+	MaxTxInSequenceNum    = wire.MaxTxInSequenceNum
+	MaxPrevOutIndex       = wire.MaxPrevOutIndex
+	MaxCFilterDataSize    = wire.MaxCFilterDataSize
+	CFCheckptInterval     = wire.CFCheckptInterval
+	GCSFilterRegular      = wire.GCSFilterRegular
+	SFNodeNetwork         = wire.SFNodeNetwork
+	SFNodeWitness         = wire.SFNodeWitness
+	SFNodeCF              = wire.SFNodeCF
+	InvTypeWitnessBlock   = wire.InvTypeWitnessBlock
+	InvTypeTx             = wire.InvTypeTx
+	MaxInvPerMsg          = wire.MaxInvPerMsg
+	CmdVersion            = wire.CmdVersion
+	CmdVerAck             = wire.CmdVerAck
+	CmdPing               = wire.CmdPing
+	CmdPong               = wire.CmdPong
+	CmdGetHeaders         = wire.CmdGetHeaders
+	CmdHeaders            = wire.CmdHeaders
+	CmdGetData            = wire.CmdGetData
+	CmdBlock              = wire.CmdBlock
+)
+
+// The functions used in this module.
+var (
+	NewBlockHeader      = wire.NewBlockHeader
+	NewInvVect          = wire.NewInvVect
+	NewMsgBlock         = wire.NewMsgBlock
+	NewMsgGetData       = wire.NewMsgGetData
+	NewMsgGetHeaders    = wire.NewMsgGetHeaders
+	NewMsgHeaders       = wire.NewMsgHeaders
+	NewMsgInv           = wire.NewMsgInv
+	NewMsgPing          = wire.NewMsgPing
+	NewMsgPong          = wire.NewMsgPong
+	NewMsgTx            = wire.NewMsgTx
+	NewMsgVerAck        = wire.NewMsgVerAck
+	NewMsgVersion       = wire.NewMsgVersion
+	NewNetAddress       = wire.NewNetAddress
+	NewNetAddressIPPort = wire.NewNetAddressIPPort
+	NewOutPoint         = wire.NewOutPoint
+	NewTxIn             = wire.NewTxIn
+	NewTxOut            = wire.NewTxOut
+	ReadMessage         = wire.ReadMessage
+	ReadVarBytes        = wire.ReadVarBytes
+	ReadVarInt          = wire.ReadVarInt
+	VarIntSerializeSize = wire.VarIntSerializeSize
+	WriteMessage        = wire.WriteMessage
+	WriteVarBytes       = wire.WriteVarBytes
+	WriteVarInt         = wire.WriteVarInt
+)
+
+// GCSFilterExtended is the filter type of the extended filter, which was
+// dropped from BIP 158 before btcd merged filter support, so upstream wire
+// has no name for it. The fork and the vectors still use it.
+const GCSFilterExtended FilterType = GCSFilterRegular + 1
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/christsim/bips/bip-0158/backend/wire"
+	"github.com/christsim/bips/bip-0158/blockgen"
+	"github.com/christsim/bips/bip-0158/gcs"
+	"github.com/christsim/bips/bip-0158/gcs/builder"
+)
+
+// runBench implements the bench subcommand, which measures filter
+// construction and matching on a fixed workload of random blocks from the
+// blockgen package. Results are printed in the format of go test -bench with
+// -benchmem, so runs before and after a change can be compared with
+// benchstat.
+func runBench(args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	seed := fs.Int64("seed", 1, "seed for the workload")
+	numBlocks := fs.Int("blocks", 20, "number of blocks in the workload")
+	maxTxs := fs.Int("maxtxs", 2000, "maximum number of transactions per "+
+		"block")
+	minP := fs.Uint("minp", 19, "smallest value of P to measure")
+	maxP := fs.Uint("maxp", 20, "largest value of P to measure")
+	queries := fs.Int("queries", 100, "number of scripts per MatchAny "+
+		"query")
+	count := fs.Int("count", 1, "number of times to run each benchmark")
+	policyList := fs.String("policies", defaultPolicies, "comma separated "+
+		"list of filter policies to measure")
+	out := fs.String("out", "", "file to write the results to (default "+
+		"stdout)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *minP > gcs.MaxP || *maxP > gcs.MaxP || *minP > *maxP {
+		return fmt.Errorf("invalid P range %d-%d", *minP, *maxP)
+	}
+	if *numBlocks < 1 || *queries < 1 {
+		return fmt.Errorf("need at least one block and query")
+	}
+	policies, err := parsePolicies(*policyList, builder.AllScriptTypes, nil)
+	if err != nil {
+		return err
+	}
+
+	w := io.Writer(os.Stdout)
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+
+	cfg := blockgen.DefaultConfig
+	cfg.MaxTxs = *maxTxs
+	g := blockgen.New(*seed, cfg)
+	blocks := make([]*wire.MsgBlock, *numBlocks)
+	for i := range blocks {
+		blocks[i] = g.Block()
+	}
+	corpus := randomScriptCorpus(*queries, *seed)
+
+	fmt.Fprintf(w, "goos: %v\ngoarch: %v\n", runtime.GOOS, runtime.GOARCH)
+	for _, policy := range policies {
+		for p := uint8(*minP); p <= uint8(*maxP); p++ {
+			filters, keys, err := buildBenchFilters(policy, blocks, p)
+			if err != nil {
+				return err
+			}
+
+			benchmarks := []struct {
+				name   string
+				suffix string
+				fn     func(b *testing.B)
+			}{
+				{"Build", "", benchBuild(policy, blocks, p)},
+				{"Match", "", benchMatch(filters, keys, corpus)},
+				{"MatchAny", fmt.Sprintf("/queries=%d", *queries),
+					benchMatchAny(filters, keys, corpus)},
+			}
+			for _, bm := range benchmarks {
+				name := fmt.Sprintf("Benchmark%v/policy=%v/P=%d%v-%d",
+					bm.name, policy.Name(), p, bm.suffix,
+					runtime.GOMAXPROCS(0))
+				for i := 0; i < *count; i++ {
+					r := testing.Benchmark(bm.fn)
+					fmt.Fprintf(w, "%v\t%v\t%v\n", name, r.String(),
+						r.MemString())
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// buildBenchFilters builds the policy's filter of each block, along with the
+// key it is keyed with.
+func buildBenchFilters(policy builder.FilterPolicy, blocks []*wire.MsgBlock,
+	p uint8) ([]*gcs.Filter, [][gcs.KeySize]byte, error) {
+
+	filters := make([]*gcs.Filter, len(blocks))
+	keys := make([][gcs.KeySize]byte, len(blocks))
+	for i, block := range blocks {
+		filter, err := builder.BuildFilter(policy, block, p)
+		if err != nil {
+			return nil, nil, err
+		}
+		blockHash := block.BlockHash()
+		filters[i] = filter
+		keys[i] = builder.DeriveKey(&blockHash)
+	}
+
+	return filters, keys, nil
+}
+
+// benchBuild measures building the filter of one block per operation.
+func benchBuild(policy builder.FilterPolicy, blocks []*wire.MsgBlock,
+	p uint8) func(b *testing.B) {
+
+	return func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_, err := builder.BuildFilter(policy,
+				blocks[i%len(blocks)], p)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+// benchMatch measures matching one script against one filter per operation.
+func benchMatch(filters []*gcs.Filter, keys [][gcs.KeySize]byte,
+	corpus [][]byte) func(b *testing.B) {
+
+	return func(b *testing.B) {
+		m := gcs.NewMatcher(0)
+		rng := rand.New(rand.NewSource(1))
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			j := i % len(filters)
+			_, err := m.Match(filters[j], keys[j],
+				corpus[rng.Intn(len(corpus))])
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+// benchMatchAny measures matching the whole corpus against one filter per
+// operation.
+func benchMatchAny(filters []*gcs.Filter, keys [][gcs.KeySize]byte,
+	corpus [][]byte) func(b *testing.B) {
+
+	return func(b *testing.B) {
+		m := gcs.NewMatcher(len(corpus))
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			j := i % len(filters)
+			_, err := m.MatchAny(filters[j], keys[j], corpus)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,293 @@
+// Package blockgen synthesizes random but structurally valid blocks for
+// property-based testing of filter construction. Generated blocks mix every
+// class of output script with OP_RETURN outputs, empty and unparseable
+// scripts, signature scripts pushing the same data more than once, and
+// witness stacks with empty items, which real chain data may rarely or never
+// combine. Check asserts the invariants every filter built from a block must
+// satisfy.
+package blockgen
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/christsim/bips/bip-0158/backend/chainhash"
+	"github.com/christsim/bips/bip-0158/backend/txscript"
+	"github.com/christsim/bips/bip-0158/backend/wire"
+)
+
+// Config bounds the size of generated blocks.
+type Config struct {
+	// MaxTxs is the maximum number of transactions in a block, including
+	// the coinbase.
+	MaxTxs int
+
+	// MaxInputs and MaxOutputs are the maximum number of inputs and
+	// outputs of a transaction.
+	MaxInputs  int
+	MaxOutputs int
+
+	// MaxPushes is the maximum number of data pushes in a signature
+	// script, and of items in a witness stack.
+	MaxPushes int
+}
+
+// DefaultConfig generates blocks small enough to check quickly while still
+// having room for every kind of script.
+var DefaultConfig = Config{
+	MaxTxs:     20,
+	MaxInputs:  5,
+	MaxOutputs: 8,
+	MaxPushes:  5,
+}
+
+// Generator generates a chain of random blocks. Blocks are deterministic for
+// a given seed and configuration.
+type Generator struct {
+	cfg Config
+	rng *rand.Rand
+
+	height    int32
+	prevBlock chainhash.Hash
+	timestamp time.Time
+
+	// unspent holds outpoints created by earlier blocks, which later
+	// transactions may spend.
+	unspent []wire.OutPoint
+}
+
+// New returns a generator seeded with the passed value.
+func New(seed int64, cfg Config) *Generator {
+	return &Generator{
+		cfg:       cfg,
+		rng:       rand.New(rand.NewSource(seed)),
+		timestamp: time.Unix(1231006505, 0),
+	}
+}
+
+// Block returns the next block of the chain.
+func (g *Generator) Block() *wire.MsgBlock {
+	numTxs := 1 + g.rng.Intn(g.cfg.MaxTxs)
+	txs := make([]*wire.MsgTx, 0, numTxs)
+	txs = append(txs, g.coinbase())
+	for len(txs) < numTxs {
+		txs = append(txs, g.tx())
+	}
+
+	for _, tx := range txs {
+		txHash := tx.TxHash()
+		for i := range tx.TxOut {
+			g.unspent = append(g.unspent, wire.OutPoint{
+				Hash:  txHash,
+				Index: uint32(i),
+			})
+		}
+	}
+
+	g.timestamp = g.timestamp.Add(time.Duration(1+g.rng.Intn(1200)) *
+		time.Second)
+	block := &wire.MsgBlock{
+		Header: wire.BlockHeader{
+			Version:    4,
+			PrevBlock:  g.prevBlock,
+			MerkleRoot: merkleRoot(txs),
+			Timestamp:  g.timestamp,
+			Bits:       0x207fffff,
+			Nonce:      g.rng.Uint32(),
+		},
+		Transactions: txs,
+	}
+	g.prevBlock = block.BlockHash()
+	g.height++
+
+	return block
+}
+
+// coinbase returns a coinbase transaction committing to the block height.
+func (g *Generator) coinbase() *wire.MsgTx {
+	sigScript, _ := txscript.NewScriptBuilder().
+		AddInt64(int64(g.height)).
+		AddData(g.bytes(g.rng.Intn(20))).
+		Script()
+
+	tx := wire.NewMsgTx(1)
+	tx.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: wire.OutPoint{Index: wire.MaxPrevOutIndex},
+		SignatureScript:  sigScript,
+		Sequence:         wire.MaxTxInSequenceNum,
+	})
+	g.addOutputs(tx)
+
+	return tx
+}
+
+// tx returns a transaction spending earlier outputs, or made-up ones once
+// those run out.
+func (g *Generator) tx() *wire.MsgTx {
+	tx := wire.NewMsgTx(2)
+	numInputs := 1 + g.rng.Intn(g.cfg.MaxInputs)
+	for i := 0; i < numInputs; i++ {
+		var outpoint wire.OutPoint
+		if n := len(g.unspent); n > 0 && g.rng.Intn(4) != 0 {
+			j := g.rng.Intn(n)
+			outpoint = g.unspent[j]
+			g.unspent[j] = g.unspent[n-1]
+			g.unspent = g.unspent[:n-1]
+		} else {
+			g.rng.Read(outpoint.Hash[:])
+			outpoint.Index = uint32(g.rng.Intn(10))
+		}
+
+		txIn := &wire.TxIn{
+			PreviousOutPoint: outpoint,
+			SignatureScript:  g.sigScript(),
+			Sequence:         g.rng.Uint32(),
+		}
+		if g.rng.Intn(2) == 0 {
+			txIn.Witness = g.witness()
+		}
+		tx.AddTxIn(txIn)
+	}
+	g.addOutputs(tx)
+
+	return tx
+}
+
+// addOutputs adds between one and the maximum number of outputs to the
+// transaction.
+func (g *Generator) addOutputs(tx *wire.MsgTx) {
+	numOutputs := 1 + g.rng.Intn(g.cfg.MaxOutputs)
+	for i := 0; i < numOutputs; i++ {
+		tx.AddTxOut(&wire.TxOut{
+			Value:    g.rng.Int63n(21e14),
+			PkScript: g.outputScript(),
+		})
+	}
+}
+
+// outputScript returns a random output script of a random class.
+func (g *Generator) outputScript() []byte {
+	b := txscript.NewScriptBuilder()
+	switch g.rng.Intn(12) {
+	case 0: // P2PK
+		b.AddData(g.pubKey()).AddOp(txscript.OP_CHECKSIG)
+	case 1: // P2PKH
+		b.AddOp(txscript.OP_DUP).AddOp(txscript.OP_HASH160).
+			AddData(g.bytes(20)).AddOp(txscript.OP_EQUALVERIFY).
+			AddOp(txscript.OP_CHECKSIG)
+	case 2: // P2SH
+		b.AddOp(txscript.OP_HASH160).AddData(g.bytes(20)).
+			AddOp(txscript.OP_EQUAL)
+	case 3: // Bare multisig
+		n := 1 + g.rng.Intn(3)
+		b.AddInt64(int64(1 + g.rng.Intn(n)))
+		for i := 0; i < n; i++ {
+			b.AddData(g.pubKey())
+		}
+		b.AddInt64(int64(n)).AddOp(txscript.OP_CHECKMULTISIG)
+	case 4: // OP_RETURN
+		b.AddOp(txscript.OP_RETURN)
+		if g.rng.Intn(4) != 0 {
+			b.AddData(g.bytes(g.rng.Intn(81)))
+		}
+	case 5: // P2WPKH
+		b.AddOp(txscript.OP_0).AddData(g.bytes(20))
+	case 6: // P2WSH
+		b.AddOp(txscript.OP_0).AddData(g.bytes(32))
+	case 7: // P2TR
+		b.AddOp(txscript.OP_1).AddData(g.bytes(32))
+	case 8: // Witness program of an undefined version
+		b.AddOp(byte(txscript.OP_2 + g.rng.Intn(15))).
+			AddData(g.bytes(2 + g.rng.Intn(39)))
+	case 9: // Empty
+		return []byte{}
+	case 10: // Unparseable: a push running past the end of the script
+		script := []byte{txscript.OP_PUSHDATA1, 0xff}
+		return append(script, g.bytes(g.rng.Intn(10))...)
+	default: // Random opcodes
+		return g.bytes(1 + g.rng.Intn(40))
+	}
+
+	script, _ := b.Script()
+	return script
+}
+
+// sigScript returns a signature script of data pushes, some of which may
+// repeat, or occasionally one that fails to parse.
+func (g *Generator) sigScript() []byte {
+	switch g.rng.Intn(8) {
+	case 0:
+		return nil
+	case 1:
+		return []byte{txscript.OP_DATA_20, 0x01, 0x02}
+	}
+
+	b := txscript.NewScriptBuilder()
+	var pushes [][]byte
+	for i := g.rng.Intn(g.cfg.MaxPushes + 1); i > 0; i-- {
+		var data []byte
+		if len(pushes) > 0 && g.rng.Intn(3) == 0 {
+			data = pushes[g.rng.Intn(len(pushes))]
+		} else {
+			data = g.bytes(1 + g.rng.Intn(75))
+		}
+		pushes = append(pushes, data)
+		b.AddData(data)
+	}
+
+	script, _ := b.Script()
+	return script
+}
+
+// witness returns a witness stack, which may hold empty or repeated items.
+func (g *Generator) witness() wire.TxWitness {
+	witness := make(wire.TxWitness, g.rng.Intn(g.cfg.MaxPushes+1))
+	for i := range witness {
+		switch {
+		case g.rng.Intn(5) == 0:
+			witness[i] = []byte{}
+		case i > 0 && g.rng.Intn(5) == 0:
+			witness[i] = witness[g.rng.Intn(i)]
+		default:
+			witness[i] = g.bytes(1 + g.rng.Intn(100))
+		}
+	}
+	return witness
+}
+
+// pubKey returns random data shaped like a compressed public key.
+func (g *Generator) pubKey() []byte {
+	key := g.bytes(33)
+	key[0] = byte(2 + g.rng.Intn(2))
+	return key
+}
+
+// bytes returns n random bytes.
+func (g *Generator) bytes(n int) []byte {
+	b := make([]byte, n)
+	g.rng.Read(b)
+	return b
+}
+
+// merkleRoot returns the merkle root of the transactions.
+func merkleRoot(txs []*wire.MsgTx) chainhash.Hash {
+	hashes := make([]chainhash.Hash, len(txs))
+	for i, tx := range txs {
+		hashes[i] = tx.TxHash()
+	}
+
+	var buf [2 * chainhash.HashSize]byte
+	for len(hashes) > 1 {
+		if len(hashes)%2 == 1 {
+			hashes = append(hashes, hashes[len(hashes)-1])
+		}
+		for i := 0; i < len(hashes)/2; i++ {
+			copy(buf[:], hashes[2*i][:])
+			copy(buf[chainhash.HashSize:], hashes[2*i+1][:])
+			hashes[i] = chainhash.DoubleHashH(buf[:])
+		}
+		hashes = hashes[:len(hashes)/2]
+	}
+
+	return hashes[0]
+}
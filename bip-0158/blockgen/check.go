@@ -0,0 +1,220 @@
+package blockgen
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/christsim/bips/bip-0158/backend/txscript"
+	"github.com/christsim/bips/bip-0158/backend/wire"
+	"github.com/christsim/bips/bip-0158/gcs"
+	"github.com/christsim/bips/bip-0158/gcs/builder"
+)
+
+// ErrInvariant is returned by Check when a filter violates an invariant.
+var ErrInvariant = errors.New("filter invariant violated")
+
+// Check builds the basic and extended filters of the block at the passed P
+// and asserts that:
+//
+//   - every transaction hash, spent outpoint and output script of the block
+//     matches its basic filter, as do the output scripts of the included
+//     types of a basic filter restricted to some script types;
+//   - every data push of a parseable signature script and every witness item
+//     of the block matches its extended filter;
+//   - MatchAny matches the elements of each filter taken together;
+//   - each filter holds one element per distinct entry, and survives being
+//     serialized and decoded;
+//   - the stream builder builds the same basic and extended filters from the
+//     serialized block.
+func Check(block *wire.MsgBlock, p uint8) error {
+	blockHash := block.BlockHash()
+	key := builder.DeriveKey(&blockHash)
+
+	var txHashes, outpoints, scripts, pushes [][]byte
+	for i, tx := range block.Transactions {
+		txHash := tx.TxHash()
+		txHashes = append(txHashes, txHash[:])
+		for _, txOut := range tx.TxOut {
+			scripts = append(scripts, txOut.PkScript)
+		}
+		if i == 0 {
+			continue
+		}
+
+		for _, txIn := range tx.TxIn {
+			outpoints = append(outpoints,
+				builder.OutPointToFilterEntry(txIn.PreviousOutPoint))
+			data, err := txscript.PushedData(txIn.SignatureScript)
+			if err == nil {
+				pushes = append(pushes, data...)
+			}
+			pushes = append(pushes, txIn.Witness...)
+		}
+	}
+
+	basic := builder.BasicPolicy{ScriptTypes: builder.AllScriptTypes}
+	err := checkPolicy(basic, block, p, key, map[string][][]byte{
+		"transaction hash": txHashes,
+		"spent outpoint":   outpoints,
+		"output script":    scripts,
+	})
+	if err != nil {
+		return err
+	}
+	err = checkPolicy(builder.ExtendedPolicy{}, block, p, key,
+		map[string][][]byte{"pushed data": pushes})
+	if err != nil {
+		return err
+	}
+
+	// Restrict the basic filter to each class of output script in the
+	// block in turn.
+	byType := make(map[builder.ScriptType][][]byte)
+	for _, script := range scripts {
+		scriptType := builder.ClassifyScript(script)
+		byType[scriptType] = append(byType[scriptType], script)
+	}
+	for scriptType, typeScripts := range byType {
+		restricted := builder.BasicPolicy{
+			ScriptTypes: builder.NewScriptTypeSet(scriptType),
+		}
+		err := checkPolicy(restricted, block, p, key, map[string][][]byte{
+			scriptType.String() + " script": typeScripts,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return checkStream(block, p)
+}
+
+// checkStream builds the basic and extended filters of the block's
+// serialization with the stream builder, and checks them against those built
+// from the deserialized block.
+func checkStream(block *wire.MsgBlock, p uint8) error {
+	var buf bytes.Buffer
+	if err := block.Serialize(&buf); err != nil {
+		return err
+	}
+	basic, ext, blockHash, err := builder.BuildFiltersFromReader(&buf, p)
+	if err != nil {
+		return fmt.Errorf("%w: stream builder fails: %v", ErrInvariant,
+			err)
+	}
+	if *blockHash != block.BlockHash() {
+		return fmt.Errorf("%w: stream builder hashed block %v, want %v",
+			ErrInvariant, blockHash, block.BlockHash())
+	}
+
+	streamed := []*gcs.Filter{basic, ext}
+	policies := []builder.FilterPolicy{
+		builder.BasicPolicy{ScriptTypes: builder.AllScriptTypes},
+		builder.ExtendedPolicy{},
+	}
+	for i, policy := range policies {
+		filter, err := builder.BuildFilter(policy, block, p)
+		if err != nil {
+			return err
+		}
+		want, err := filter.NBytes()
+		if err != nil {
+			return err
+		}
+		got, err := streamed[i].NBytes()
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(got, want) {
+			return fmt.Errorf("%w: stream builder built %v filter "+
+				"%x, want %x", ErrInvariant, policy.Name(), got,
+				want)
+		}
+	}
+
+	return nil
+}
+
+// checkPolicy builds the policy's filter of the block and checks it against
+// the elements it must match, grouped by description.
+func checkPolicy(policy builder.FilterPolicy, block *wire.MsgBlock, p uint8,
+	key [gcs.KeySize]byte, elements map[string][][]byte) error {
+
+	blockHash := block.BlockHash()
+	b := builder.WithKeyHashP(&blockHash, p)
+	policy.AddBlock(b, block)
+	filter, err := b.Build()
+	if err != nil {
+		return err
+	}
+	entries, err := b.Entries()
+	if err != nil {
+		return err
+	}
+
+	if int(filter.N()) != len(entries) {
+		return fmt.Errorf("%w: %v filter has N = %d for %d entries",
+			ErrInvariant, policy.Name(), filter.N(), len(entries))
+	}
+
+	nBytes, err := filter.NBytes()
+	if err != nil {
+		return err
+	}
+	decoded, err := gcs.FromNBytes(p, nBytes)
+	if err != nil {
+		return fmt.Errorf("%w: %v filter doesn't decode: %v",
+			ErrInvariant, policy.Name(), err)
+	}
+	if err := decoded.Validate(); err != nil {
+		return fmt.Errorf("%w: %v filter doesn't validate: %v",
+			ErrInvariant, policy.Name(), err)
+	}
+
+	var all [][]byte
+	for desc, group := range elements {
+		for _, element := range group {
+			match, err := decoded.Match(key, element)
+			if err != nil {
+				return err
+			}
+			if !match {
+				return fmt.Errorf("%w: %v %x doesn't match %v "+
+					"filter", ErrInvariant, desc, element,
+					policy.Name())
+			}
+		}
+		all = append(all, group...)
+	}
+
+	if len(all) > 0 {
+		match, err := decoded.MatchAny(key, all)
+		if err != nil {
+			return err
+		}
+		if !match {
+			return fmt.Errorf("%w: MatchAny doesn't match %v filter",
+				ErrInvariant, policy.Name())
+		}
+	}
+
+	return nil
+}
+
+// CheckRandom generates a chain of the passed number of random blocks from
+// the seed and checks each of them at the passed P, returning the first
+// violation along with the offending block.
+func CheckRandom(seed int64, cfg Config, blocks int, p uint8) (*wire.MsgBlock,
+	error) {
+
+	g := New(seed, cfg)
+	for i := 0; i < blocks; i++ {
+		block := g.Block()
+		if err := Check(block, p); err != nil {
+			return block, fmt.Errorf("block %d: %w", i, err)
+		}
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,187 @@
+// Package cfmsg encodes and decodes the BIP 157 network messages light
+// clients use to fetch compact block filters: getcfilters and cfilter,
+// getcfheaders and cfheaders, and getcfcheckpt and cfcheckpt. It also
+// handles the control messages every modern peer sends once connected: the
+// sendheaders of BIP 130 and the feefilter of BIP 133, which Preferences
+// picks for a peer, and the wtxidrelay of BIP 339, which HandshakeMessages
+// picks for a peer before verack. PeerSettings records them of a peer, and
+// TxInvVect announces transactions to it by txid or wtxid as it asked.
+//
+// Every message type has Serialize and Deserialize methods for its payload
+// alone, and also implements wire.Message, so it can be sent with
+// wire.WriteMessage. WriteMessage and ReadMessage in this package frame and
+// unframe messages with the standard 24 byte header, decoding the filter
+// and control messages into the types of this package and passing any other
+// message through as a RawMessage.
+package cfmsg
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/christsim/bips/bip-0158/backend/chainhash"
+	"github.com/christsim/bips/bip-0158/backend/wire"
+)
+
+const (
+	// CmdGetCFilters, CmdCFilter, CmdGetCFHeaders, CmdCFHeaders,
+	// CmdGetCFCheckpt and CmdCFCheckpt are the commands of the BIP 157
+	// messages.
+	CmdGetCFilters  = "getcfilters"
+	CmdCFilter      = "cfilter"
+	CmdGetCFHeaders = "getcfheaders"
+	CmdCFHeaders    = "cfheaders"
+	CmdGetCFCheckpt = "getcfcheckpt"
+	CmdCFCheckpt    = "cfcheckpt"
+
+	// MaxGetCFiltersRange is the largest number of filters a single
+	// getcfilters message may request.
+	MaxGetCFiltersRange = 1000
+
+	// MaxCFHeadersPerMsg is the largest number of filter hashes a single
+	// cfheaders message may hold.
+	MaxCFHeadersPerMsg = 2000
+
+	// CFCheckptInterval is the number of blocks between the filter
+	// headers of a cfcheckpt message.
+	CFCheckptInterval = 1000
+
+	// MaxFilterSize is the largest filter a cfilter message may hold.
+	MaxFilterSize = wire.MaxCFilterDataSize
+
+	// maxCFCheckpts bounds the number of headers a cfcheckpt message is
+	// decoded with, allowing for a chain of 20 million blocks.
+	maxCFCheckpts = 20000
+)
+
+var (
+	// ErrTooMany is returned when a message holds more items than the
+	// protocol allows.
+	ErrTooMany = errors.New("cfmsg: too many items in message")
+
+	// ErrFilterTooBig is returned when a cfilter message holds a filter
+	// larger than MaxFilterSize.
+	ErrFilterTooBig = errors.New("cfmsg: filter too big")
+)
+
+// Message is a message of this package. Serialize and Deserialize handle the payload
+// alone, without the message header.
+type Message interface {
+	wire.Message
+
+	// Serialize writes the message payload to w.
+	Serialize(w io.Writer) error
+
+	// Deserialize reads the message payload from r.
+	Deserialize(r io.Reader) error
+}
+
+// MakeEmptyMessage returns an empty message of the type carrying the passed
+// command, or nil if the command isn't one of the messages of this package.
+func MakeEmptyMessage(command string) Message {
+	switch command {
+	case CmdGetCFilters:
+		return &MsgGetCFilters{}
+	case CmdCFilter:
+		return &MsgCFilter{}
+	case CmdGetCFHeaders:
+		return &MsgGetCFHeaders{}
+	case CmdCFHeaders:
+		return &MsgCFHeaders{}
+	case CmdGetCFCheckpt:
+		return &MsgGetCFCheckpt{}
+	case CmdCFCheckpt:
+		return &MsgCFCheckpt{}
+	case CmdSendHeaders:
+		return &MsgSendHeaders{}
+	case CmdFeeFilter:
+		return &MsgFeeFilter{}
+	case CmdWtxidRelay:
+		return &MsgWtxidRelay{}
+	default:
+		return nil
+	}
+}
+
+// readFilterType reads a one byte filter type.
+func readFilterType(r io.Reader) (wire.FilterType, error) {
+	var b [1]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return 0, err
+	}
+	return wire.FilterType(b[0]), nil
+}
+
+// writeFilterType writes a one byte filter type.
+func writeFilterType(w io.Writer, filterType wire.FilterType) error {
+	_, err := w.Write([]byte{byte(filterType)})
+	return err
+}
+
+// readUint32 reads a little-endian uint32.
+func readUint32(r io.Reader) (uint32, error) {
+	var b [4]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(b[:]), nil
+}
+
+// writeUint32 writes a little-endian uint32.
+func writeUint32(w io.Writer, v uint32) error {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], v)
+	_, err := w.Write(b[:])
+	return err
+}
+
+// readHash reads a hash in internal byte order.
+func readHash(r io.Reader, hash *chainhash.Hash) error {
+	_, err := io.ReadFull(r, hash[:])
+	return err
+}
+
+// writeHash writes a hash in internal byte order.
+func writeHash(w io.Writer, hash *chainhash.Hash) error {
+	_, err := w.Write(hash[:])
+	return err
+}
+
+// readHashes reads a CompactSize count of at most max hashes followed by the
+// hashes.
+func readHashes(r io.Reader, max int) ([]chainhash.Hash, error) {
+	count, err := wire.ReadVarInt(r, 0)
+	if err != nil {
+		return nil, err
+	}
+	if count > uint64(max) {
+		return nil, fmt.Errorf("%w: %d hashes, max %d", ErrTooMany,
+			count, max)
+	}
+
+	hashes := make([]chainhash.Hash, count)
+	for i := range hashes {
+		if err := readHash(r, &hashes[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return hashes, nil
+}
+
+// writeHashes writes a CompactSize count followed by the hashes.
+func writeHashes(w io.Writer, hashes []chainhash.Hash) error {
+	err := wire.WriteVarInt(w, 0, uint64(len(hashes)))
+	if err != nil {
+		return err
+	}
+	for i := range hashes {
+		if err := writeHash(w, &hashes[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
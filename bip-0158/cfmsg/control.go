@@ -0,0 +1,194 @@
+package cfmsg
+
+import (
+	"encoding/binary"
+	"io"
+
+	"github.com/christsim/bips/bip-0158/backend/wire"
+)
+
+const (
+	// CmdSendHeaders and CmdFeeFilter are the commands of the sendheaders
+	// message of BIP 130 and the feefilter message of BIP 133.
+	CmdSendHeaders = "sendheaders"
+	CmdFeeFilter   = "feefilter"
+
+	// SendHeadersVersion and FeeFilterVersion are the protocol versions
+	// from which peers understand sendheaders and feefilter.
+	SendHeadersVersion = 70012
+	FeeFilterVersion   = 70013
+
+	// MaxFeeRate is the largest fee rate a feefilter message may carry,
+	// in satoshis per 1000 bytes: every bitcoin there will ever be.
+	MaxFeeRate = 21000000 * 100000000
+)
+
+// MsgSendHeaders asks a peer to announce new blocks with headers messages
+// rather than inv. It has no payload.
+type MsgSendHeaders struct{}
+
+// Serialize writes the empty payload to w.
+func (msg *MsgSendHeaders) Serialize(io.Writer) error {
+	return nil
+}
+
+// Deserialize reads the empty payload from r.
+func (msg *MsgSendHeaders) Deserialize(io.Reader) error {
+	return nil
+}
+
+// BtcEncode implements wire.Message.
+func (msg *MsgSendHeaders) BtcEncode(w io.Writer, _ uint32,
+	_ wire.MessageEncoding) error {
+
+	return msg.Serialize(w)
+}
+
+// BtcDecode implements wire.Message.
+func (msg *MsgSendHeaders) BtcDecode(r io.Reader, _ uint32,
+	_ wire.MessageEncoding) error {
+
+	return msg.Deserialize(r)
+}
+
+// Command returns "sendheaders".
+func (msg *MsgSendHeaders) Command() string {
+	return CmdSendHeaders
+}
+
+// MaxPayloadLength returns 0, since the message has no payload.
+func (msg *MsgSendHeaders) MaxPayloadLength(uint32) uint32 {
+	return 0
+}
+
+// MsgFeeFilter asks a peer not to announce transactions paying less than
+// the fee rate, in satoshis per 1000 bytes.
+type MsgFeeFilter struct {
+	MinFeeRate int64
+}
+
+// Valid reports whether the fee rate is within 0 and MaxFeeRate. Peers
+// ignore feefilter messages of other fee rates.
+func (msg *MsgFeeFilter) Valid() bool {
+	return msg.MinFeeRate >= 0 && msg.MinFeeRate <= MaxFeeRate
+}
+
+// Serialize writes the message payload to w.
+func (msg *MsgFeeFilter) Serialize(w io.Writer) error {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], uint64(msg.MinFeeRate))
+	_, err := w.Write(b[:])
+	return err
+}
+
+// Deserialize reads the message payload from r.
+func (msg *MsgFeeFilter) Deserialize(r io.Reader) error {
+	var b [8]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return err
+	}
+	msg.MinFeeRate = int64(binary.LittleEndian.Uint64(b[:]))
+	return nil
+}
+
+// BtcEncode implements wire.Message.
+func (msg *MsgFeeFilter) BtcEncode(w io.Writer, _ uint32,
+	_ wire.MessageEncoding) error {
+
+	return msg.Serialize(w)
+}
+
+// BtcDecode implements wire.Message.
+func (msg *MsgFeeFilter) BtcDecode(r io.Reader, _ uint32,
+	_ wire.MessageEncoding) error {
+
+	return msg.Deserialize(r)
+}
+
+// Command returns "feefilter".
+func (msg *MsgFeeFilter) Command() string {
+	return CmdFeeFilter
+}
+
+// MaxPayloadLength returns the fixed size of the payload.
+func (msg *MsgFeeFilter) MaxPayloadLength(uint32) uint32 {
+	return 8
+}
+
+// PeerSettings are what a peer has asked of the announcements it's sent, by
+// the sendheaders, feefilter and wtxidrelay messages it sent.
+type PeerSettings struct {
+	// SendHeaders is whether the peer asked for new blocks to be
+	// announced with headers.
+	SendHeaders bool
+
+	// MinFeeRate is the fee rate of the last valid feefilter message of
+	// the peer, 0 until it sends one.
+	MinFeeRate int64
+
+	// WtxidRelay is whether the peer sent wtxidrelay before verack. A
+	// node that sent it too announces transactions to the peer by wtxid.
+	WtxidRelay bool
+
+	// verAck is whether the peer sent verack.
+	verAck bool
+}
+
+// Update records the request of a sendheaders, feefilter or wtxidrelay
+// message of the peer, and the verack ending its handshake, and reports
+// whether the message was one of them. It ignores a feefilter message of an
+// invalid fee rate as Bitcoin Core does, and a wtxidrelay message after
+// verack as BIP 339 allows.
+func (s *PeerSettings) Update(msg wire.Message) bool {
+	switch m := msg.(type) {
+	case *MsgSendHeaders:
+		s.SendHeaders = true
+	case *MsgFeeFilter:
+		if m.Valid() {
+			s.MinFeeRate = m.MinFeeRate
+		}
+	case *MsgWtxidRelay:
+		if !s.verAck {
+			s.WtxidRelay = true
+		}
+	default:
+		if msg.Command() != wire.CmdVerAck {
+			return false
+		}
+		s.verAck = true
+	}
+	return true
+}
+
+// TxInvVect returns the inventory vector announcing the transaction to the
+// peer, by wtxid if it sent wtxidrelay.
+func (s *PeerSettings) TxInvVect(tx *wire.MsgTx) (*wire.InvVect, error) {
+	return TxInvVect(tx, s.WtxidRelay)
+}
+
+// Announce reports whether a transaction paying the fee rate, in satoshis
+// per 1000 bytes, passes the fee filter of the peer.
+func (s *PeerSettings) Announce(feeRate int64) bool {
+	return feeRate >= s.MinFeeRate
+}
+
+// Preferences returns the messages to send a peer of the protocol version
+// once the version handshake is done: sendheaders if it understands it, and
+// feefilter if it understands that, of the fee rate minFeeRate if the node
+// relays transactions and of MaxFeeRate if it doesn't, so the peer
+// announces none.
+func Preferences(peerVersion int32, relayTxs bool,
+	minFeeRate int64) []Message {
+
+	var msgs []Message
+	if peerVersion >= SendHeadersVersion {
+		msgs = append(msgs, &MsgSendHeaders{})
+	}
+	if peerVersion >= FeeFilterVersion {
+		if !relayTxs {
+			minFeeRate = MaxFeeRate
+		}
+		msgs = append(msgs, &MsgFeeFilter{MinFeeRate: minFeeRate})
+	}
+	return msgs
+}
@@ -0,0 +1,144 @@
+package cfmsg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/christsim/bips/bip-0158/backend/chainhash"
+	"github.com/christsim/bips/bip-0158/backend/wire"
+)
+
+var (
+	// ErrWrongNetwork is returned by ReadMessage for a message carrying
+	// the magic of another network.
+	ErrWrongNetwork = errors.New("cfmsg: message from wrong network")
+
+	// ErrBadChecksum is returned by ReadMessage for a message whose
+	// payload doesn't match the checksum in its header.
+	ErrBadChecksum = errors.New("cfmsg: bad payload checksum")
+
+	// ErrPayloadTooBig is returned by ReadMessage for a message whose
+	// payload is larger than its type allows.
+	ErrPayloadTooBig = errors.New("cfmsg: payload too big")
+
+	// ErrTrailingPayload is returned by ReadMessage when a message doesn't
+	// use its whole payload.
+	ErrTrailingPayload = errors.New("cfmsg: trailing bytes in payload")
+)
+
+// RawMessage is a message of a type this package doesn't decode, kept as its
+// command and undecoded payload.
+type RawMessage struct {
+	Cmd     string
+	Payload []byte
+}
+
+// BtcEncode implements wire.Message by writing the payload as is.
+func (msg *RawMessage) BtcEncode(w io.Writer, _ uint32,
+	_ wire.MessageEncoding) error {
+
+	_, err := w.Write(msg.Payload)
+	return err
+}
+
+// BtcDecode implements wire.Message by reading all of r as the payload.
+func (msg *RawMessage) BtcDecode(r io.Reader, _ uint32,
+	_ wire.MessageEncoding) error {
+
+	payload, err := io.ReadAll(r)
+	msg.Payload = payload
+	return err
+}
+
+// Command returns the message's command.
+func (msg *RawMessage) Command() string {
+	return msg.Cmd
+}
+
+// MaxPayloadLength returns wire.MaxMessagePayload.
+func (msg *RawMessage) MaxPayloadLength(uint32) uint32 {
+	return wire.MaxMessagePayload
+}
+
+// WriteMessage writes msg to w, preceded by the message header for the
+// passed network.
+func WriteMessage(w io.Writer, msg wire.Message, net wire.BitcoinNet) error {
+	var payload bytes.Buffer
+	err := msg.BtcEncode(&payload, wire.ProtocolVersion, wire.BaseEncoding)
+	if err != nil {
+		return err
+	}
+
+	cmd := msg.Command()
+	if len(cmd) > wire.CommandSize {
+		return fmt.Errorf("cfmsg: command %q is too long", cmd)
+	}
+	if payload.Len() > int(msg.MaxPayloadLength(wire.ProtocolVersion)) {
+		return fmt.Errorf("%w: %v payload of %d bytes",
+			ErrPayloadTooBig, cmd, payload.Len())
+	}
+
+	var header [wire.MessageHeaderSize]byte
+	binary.LittleEndian.PutUint32(header[0:4], uint32(net))
+	copy(header[4:4+wire.CommandSize], cmd)
+	binary.LittleEndian.PutUint32(header[16:20], uint32(payload.Len()))
+	checksum := chainhash.DoubleHashB(payload.Bytes())
+	copy(header[20:24], checksum[:4])
+
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	_, err = w.Write(payload.Bytes())
+	return err
+}
+
+// ReadMessage reads a message for the passed network from r. BIP 157
+// messages are decoded into the types of this package; any other message is
+// returned as a *RawMessage.
+func ReadMessage(r io.Reader, net wire.BitcoinNet) (wire.Message, error) {
+	var header [wire.MessageHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+
+	magic := wire.BitcoinNet(binary.LittleEndian.Uint32(header[0:4]))
+	if magic != net {
+		return nil, fmt.Errorf("%w: magic %v, expected %v",
+			ErrWrongNetwork, magic, net)
+	}
+	cmd := string(bytes.TrimRight(header[4:4+wire.CommandSize], "\x00"))
+	length := binary.LittleEndian.Uint32(header[16:20])
+
+	msg := wire.Message(MakeEmptyMessage(cmd))
+	if msg == nil {
+		msg = &RawMessage{Cmd: cmd}
+	}
+	if length > msg.MaxPayloadLength(wire.ProtocolVersion) {
+		return nil, fmt.Errorf("%w: %v payload of %d bytes",
+			ErrPayloadTooBig, cmd, length)
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+	checksum := chainhash.DoubleHashB(payload)
+	if !bytes.Equal(checksum[:4], header[20:24]) {
+		return nil, fmt.Errorf("%w: %v message", ErrBadChecksum, cmd)
+	}
+
+	pr := bytes.NewReader(payload)
+	err := msg.BtcDecode(pr, wire.ProtocolVersion, wire.BaseEncoding)
+	if err != nil {
+		return nil, err
+	}
+	if pr.Len() != 0 {
+		return nil, fmt.Errorf("%w: %d bytes after %v message",
+			ErrTrailingPayload, pr.Len(), cmd)
+	}
+
+	return msg, nil
+}
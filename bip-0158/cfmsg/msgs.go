@@ -0,0 +1,368 @@
+package cfmsg
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/christsim/bips/bip-0158/backend/chainhash"
+	"github.com/christsim/bips/bip-0158/backend/wire"
+)
+
+// MsgGetCFilters requests the filters of a range of blocks, from the block
+// at StartHeight up to and including the block with hash StopHash.
+type MsgGetCFilters struct {
+	FilterType  wire.FilterType
+	StartHeight uint32
+	StopHash    chainhash.Hash
+}
+
+// Serialize writes the message payload to w.
+func (msg *MsgGetCFilters) Serialize(w io.Writer) error {
+	if err := writeFilterType(w, msg.FilterType); err != nil {
+		return err
+	}
+	if err := writeUint32(w, msg.StartHeight); err != nil {
+		return err
+	}
+	return writeHash(w, &msg.StopHash)
+}
+
+// Deserialize reads the message payload from r.
+func (msg *MsgGetCFilters) Deserialize(r io.Reader) error {
+	var err error
+	if msg.FilterType, err = readFilterType(r); err != nil {
+		return err
+	}
+	if msg.StartHeight, err = readUint32(r); err != nil {
+		return err
+	}
+	return readHash(r, &msg.StopHash)
+}
+
+// BtcEncode implements wire.Message.
+func (msg *MsgGetCFilters) BtcEncode(w io.Writer, _ uint32,
+	_ wire.MessageEncoding) error {
+
+	return msg.Serialize(w)
+}
+
+// BtcDecode implements wire.Message.
+func (msg *MsgGetCFilters) BtcDecode(r io.Reader, _ uint32,
+	_ wire.MessageEncoding) error {
+
+	return msg.Deserialize(r)
+}
+
+// Command returns "getcfilters".
+func (msg *MsgGetCFilters) Command() string {
+	return CmdGetCFilters
+}
+
+// MaxPayloadLength returns the fixed size of the payload.
+func (msg *MsgGetCFilters) MaxPayloadLength(uint32) uint32 {
+	return 1 + 4 + chainhash.HashSize
+}
+
+// MsgCFilter carries the filter of one block, serialized with N as by
+// gcs.Filter.NBytes.
+type MsgCFilter struct {
+	FilterType wire.FilterType
+	BlockHash  chainhash.Hash
+	Filter     []byte
+}
+
+// Serialize writes the message payload to w.
+func (msg *MsgCFilter) Serialize(w io.Writer) error {
+	if len(msg.Filter) > MaxFilterSize {
+		return fmt.Errorf("%w: %d bytes, max %d", ErrFilterTooBig,
+			len(msg.Filter), MaxFilterSize)
+	}
+
+	if err := writeFilterType(w, msg.FilterType); err != nil {
+		return err
+	}
+	if err := writeHash(w, &msg.BlockHash); err != nil {
+		return err
+	}
+	return wire.WriteVarBytes(w, 0, msg.Filter)
+}
+
+// Deserialize reads the message payload from r.
+func (msg *MsgCFilter) Deserialize(r io.Reader) error {
+	var err error
+	if msg.FilterType, err = readFilterType(r); err != nil {
+		return err
+	}
+	if err := readHash(r, &msg.BlockHash); err != nil {
+		return err
+	}
+	msg.Filter, err = wire.ReadVarBytes(r, 0, MaxFilterSize, "filter")
+	return err
+}
+
+// BtcEncode implements wire.Message.
+func (msg *MsgCFilter) BtcEncode(w io.Writer, _ uint32,
+	_ wire.MessageEncoding) error {
+
+	return msg.Serialize(w)
+}
+
+// BtcDecode implements wire.Message.
+func (msg *MsgCFilter) BtcDecode(r io.Reader, _ uint32,
+	_ wire.MessageEncoding) error {
+
+	return msg.Deserialize(r)
+}
+
+// Command returns "cfilter".
+func (msg *MsgCFilter) Command() string {
+	return CmdCFilter
+}
+
+// MaxPayloadLength returns the size of the payload holding the largest
+// allowed filter.
+func (msg *MsgCFilter) MaxPayloadLength(uint32) uint32 {
+	return 1 + chainhash.HashSize +
+		uint32(wire.VarIntSerializeSize(MaxFilterSize)) + MaxFilterSize
+}
+
+// MsgGetCFHeaders requests the filter hashes of a range of blocks, from the
+// block at StartHeight up to and including the block with hash StopHash,
+// along with the filter header preceding them.
+type MsgGetCFHeaders struct {
+	FilterType  wire.FilterType
+	StartHeight uint32
+	StopHash    chainhash.Hash
+}
+
+// Serialize writes the message payload to w.
+func (msg *MsgGetCFHeaders) Serialize(w io.Writer) error {
+	if err := writeFilterType(w, msg.FilterType); err != nil {
+		return err
+	}
+	if err := writeUint32(w, msg.StartHeight); err != nil {
+		return err
+	}
+	return writeHash(w, &msg.StopHash)
+}
+
+// Deserialize reads the message payload from r.
+func (msg *MsgGetCFHeaders) Deserialize(r io.Reader) error {
+	var err error
+	if msg.FilterType, err = readFilterType(r); err != nil {
+		return err
+	}
+	if msg.StartHeight, err = readUint32(r); err != nil {
+		return err
+	}
+	return readHash(r, &msg.StopHash)
+}
+
+// BtcEncode implements wire.Message.
+func (msg *MsgGetCFHeaders) BtcEncode(w io.Writer, _ uint32,
+	_ wire.MessageEncoding) error {
+
+	return msg.Serialize(w)
+}
+
+// BtcDecode implements wire.Message.
+func (msg *MsgGetCFHeaders) BtcDecode(r io.Reader, _ uint32,
+	_ wire.MessageEncoding) error {
+
+	return msg.Deserialize(r)
+}
+
+// Command returns "getcfheaders".
+func (msg *MsgGetCFHeaders) Command() string {
+	return CmdGetCFHeaders
+}
+
+// MaxPayloadLength returns the fixed size of the payload.
+func (msg *MsgGetCFHeaders) MaxPayloadLength(uint32) uint32 {
+	return 1 + 4 + chainhash.HashSize
+}
+
+// MsgCFHeaders carries the filter hashes of a range of blocks ending at the
+// block with hash StopHash, along with the filter header of the block
+// preceding the range, from which the headers of the range can be derived.
+type MsgCFHeaders struct {
+	FilterType       wire.FilterType
+	StopHash         chainhash.Hash
+	PrevFilterHeader chainhash.Hash
+	FilterHashes     []chainhash.Hash
+}
+
+// Serialize writes the message payload to w.
+func (msg *MsgCFHeaders) Serialize(w io.Writer) error {
+	if len(msg.FilterHashes) > MaxCFHeadersPerMsg {
+		return fmt.Errorf("%w: %d filter hashes, max %d", ErrTooMany,
+			len(msg.FilterHashes), MaxCFHeadersPerMsg)
+	}
+
+	if err := writeFilterType(w, msg.FilterType); err != nil {
+		return err
+	}
+	if err := writeHash(w, &msg.StopHash); err != nil {
+		return err
+	}
+	if err := writeHash(w, &msg.PrevFilterHeader); err != nil {
+		return err
+	}
+	return writeHashes(w, msg.FilterHashes)
+}
+
+// Deserialize reads the message payload from r.
+func (msg *MsgCFHeaders) Deserialize(r io.Reader) error {
+	var err error
+	if msg.FilterType, err = readFilterType(r); err != nil {
+		return err
+	}
+	if err := readHash(r, &msg.StopHash); err != nil {
+		return err
+	}
+	if err := readHash(r, &msg.PrevFilterHeader); err != nil {
+		return err
+	}
+	msg.FilterHashes, err = readHashes(r, MaxCFHeadersPerMsg)
+	return err
+}
+
+// BtcEncode implements wire.Message.
+func (msg *MsgCFHeaders) BtcEncode(w io.Writer, _ uint32,
+	_ wire.MessageEncoding) error {
+
+	return msg.Serialize(w)
+}
+
+// BtcDecode implements wire.Message.
+func (msg *MsgCFHeaders) BtcDecode(r io.Reader, _ uint32,
+	_ wire.MessageEncoding) error {
+
+	return msg.Deserialize(r)
+}
+
+// Command returns "cfheaders".
+func (msg *MsgCFHeaders) Command() string {
+	return CmdCFHeaders
+}
+
+// MaxPayloadLength returns the size of the payload holding the largest
+// allowed number of filter hashes.
+func (msg *MsgCFHeaders) MaxPayloadLength(uint32) uint32 {
+	return 1 + 2*chainhash.HashSize +
+		uint32(wire.VarIntSerializeSize(MaxCFHeadersPerMsg)) +
+		MaxCFHeadersPerMsg*chainhash.HashSize
+}
+
+// MsgGetCFCheckpt requests the filter headers of every CFCheckptInterval-th
+// block up to the block with hash StopHash.
+type MsgGetCFCheckpt struct {
+	FilterType wire.FilterType
+	StopHash   chainhash.Hash
+}
+
+// Serialize writes the message payload to w.
+func (msg *MsgGetCFCheckpt) Serialize(w io.Writer) error {
+	if err := writeFilterType(w, msg.FilterType); err != nil {
+		return err
+	}
+	return writeHash(w, &msg.StopHash)
+}
+
+// Deserialize reads the message payload from r.
+func (msg *MsgGetCFCheckpt) Deserialize(r io.Reader) error {
+	var err error
+	if msg.FilterType, err = readFilterType(r); err != nil {
+		return err
+	}
+	return readHash(r, &msg.StopHash)
+}
+
+// BtcEncode implements wire.Message.
+func (msg *MsgGetCFCheckpt) BtcEncode(w io.Writer, _ uint32,
+	_ wire.MessageEncoding) error {
+
+	return msg.Serialize(w)
+}
+
+// BtcDecode implements wire.Message.
+func (msg *MsgGetCFCheckpt) BtcDecode(r io.Reader, _ uint32,
+	_ wire.MessageEncoding) error {
+
+	return msg.Deserialize(r)
+}
+
+// Command returns "getcfcheckpt".
+func (msg *MsgGetCFCheckpt) Command() string {
+	return CmdGetCFCheckpt
+}
+
+// MaxPayloadLength returns the fixed size of the payload.
+func (msg *MsgGetCFCheckpt) MaxPayloadLength(uint32) uint32 {
+	return 1 + chainhash.HashSize
+}
+
+// MsgCFCheckpt carries the filter headers of every CFCheckptInterval-th
+// block up to the block with hash StopHash, starting with the header at
+// height CFCheckptInterval.
+type MsgCFCheckpt struct {
+	FilterType    wire.FilterType
+	StopHash      chainhash.Hash
+	FilterHeaders []chainhash.Hash
+}
+
+// Serialize writes the message payload to w.
+func (msg *MsgCFCheckpt) Serialize(w io.Writer) error {
+	if len(msg.FilterHeaders) > maxCFCheckpts {
+		return fmt.Errorf("%w: %d filter headers, max %d", ErrTooMany,
+			len(msg.FilterHeaders), maxCFCheckpts)
+	}
+
+	if err := writeFilterType(w, msg.FilterType); err != nil {
+		return err
+	}
+	if err := writeHash(w, &msg.StopHash); err != nil {
+		return err
+	}
+	return writeHashes(w, msg.FilterHeaders)
+}
+
+// Deserialize reads the message payload from r.
+func (msg *MsgCFCheckpt) Deserialize(r io.Reader) error {
+	var err error
+	if msg.FilterType, err = readFilterType(r); err != nil {
+		return err
+	}
+	if err := readHash(r, &msg.StopHash); err != nil {
+		return err
+	}
+	msg.FilterHeaders, err = readHashes(r, maxCFCheckpts)
+	return err
+}
+
+// BtcEncode implements wire.Message.
+func (msg *MsgCFCheckpt) BtcEncode(w io.Writer, _ uint32,
+	_ wire.MessageEncoding) error {
+
+	return msg.Serialize(w)
+}
+
+// BtcDecode implements wire.Message.
+func (msg *MsgCFCheckpt) BtcDecode(r io.Reader, _ uint32,
+	_ wire.MessageEncoding) error {
+
+	return msg.Deserialize(r)
+}
+
+// Command returns "cfcheckpt".
+func (msg *MsgCFCheckpt) Command() string {
+	return CmdCFCheckpt
+}
+
+// MaxPayloadLength returns the size of the payload holding the largest
+// number of filter headers it is decoded with.
+func (msg *MsgCFCheckpt) MaxPayloadLength(uint32) uint32 {
+	return 1 + chainhash.HashSize +
+		uint32(wire.VarIntSerializeSize(maxCFCheckpts)) +
+		maxCFCheckpts*chainhash.HashSize
+}
@@ -0,0 +1,113 @@
+package cfmsg
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/christsim/bips/bip-0158/backend/chainhash"
+	"github.com/christsim/bips/bip-0158/backend/wire"
+)
+
+const (
+	// CmdWtxidRelay is the command of the wtxidrelay message of BIP 339.
+	CmdWtxidRelay = "wtxidrelay"
+
+	// WtxidRelayVersion is the protocol version from which peers
+	// understand wtxidrelay.
+	WtxidRelayVersion = 70016
+
+	// InvTypeWTx is the inventory type of a transaction announced or
+	// requested by its wtxid, MSG_WTX.
+	InvTypeWTx wire.InvType = 5
+)
+
+// MsgWtxidRelay announces, before verack, that a peer would rather announce
+// and request transactions by their wtxid than their txid. It has no
+// payload.
+type MsgWtxidRelay struct{}
+
+// Serialize writes the empty payload to w.
+func (msg *MsgWtxidRelay) Serialize(io.Writer) error {
+	return nil
+}
+
+// Deserialize reads the empty payload from r.
+func (msg *MsgWtxidRelay) Deserialize(io.Reader) error {
+	return nil
+}
+
+// BtcEncode implements wire.Message.
+func (msg *MsgWtxidRelay) BtcEncode(w io.Writer, _ uint32,
+	_ wire.MessageEncoding) error {
+
+	return msg.Serialize(w)
+}
+
+// BtcDecode implements wire.Message.
+func (msg *MsgWtxidRelay) BtcDecode(r io.Reader, _ uint32,
+	_ wire.MessageEncoding) error {
+
+	return msg.Deserialize(r)
+}
+
+// Command returns "wtxidrelay".
+func (msg *MsgWtxidRelay) Command() string {
+	return CmdWtxidRelay
+}
+
+// MaxPayloadLength returns 0, since the message has no payload.
+func (msg *MsgWtxidRelay) MaxPayloadLength(uint32) uint32 {
+	return 0
+}
+
+// Wtxid returns the wtxid of the transaction, the double SHA-256 of its
+// serialization with witnesses, which is its txid if it has none.
+func Wtxid(tx *wire.MsgTx) (chainhash.Hash, error) {
+	var b bytes.Buffer
+	if err := tx.BtcEncode(&b, 0, wire.WitnessEncoding); err != nil {
+		return chainhash.Hash{}, err
+	}
+	return chainhash.DoubleHashH(b.Bytes()), nil
+}
+
+// TxInvVect returns the inventory vector announcing the transaction to a
+// peer: of type InvTypeWTx and its wtxid if the peer negotiated wtxidrelay,
+// and of type wire.InvTypeTx and its txid otherwise.
+func TxInvVect(tx *wire.MsgTx, wtxidRelay bool) (*wire.InvVect, error) {
+	if !wtxidRelay {
+		txid := tx.TxHash()
+		return wire.NewInvVect(wire.InvTypeTx, &txid), nil
+	}
+	wtxid, err := Wtxid(tx)
+	if err != nil {
+		return nil, err
+	}
+	return wire.NewInvVect(InvTypeWTx, &wtxid), nil
+}
+
+// NewTxInv returns an inv message announcing the transactions to a peer, as
+// TxInvVect does.
+func NewTxInv(txs []*wire.MsgTx, wtxidRelay bool) (*wire.MsgInv, error) {
+	inv := wire.NewMsgInv()
+	for _, tx := range txs {
+		iv, err := TxInvVect(tx, wtxidRelay)
+		if err != nil {
+			return nil, err
+		}
+		if err := inv.AddInvVect(iv); err != nil {
+			return nil, err
+		}
+	}
+	return inv, nil
+}
+
+// HandshakeMessages returns the messages to send a peer of the protocol
+// version after its version message and before verack: wtxidrelay if it
+// understands it.
+func HandshakeMessages(peerVersion int32) []Message {
+	var msgs []Message
+	if peerVersion >= WtxidRelayVersion {
+		msgs = append(msgs, &MsgWtxidRelay{})
+	}
+	return msgs
+}
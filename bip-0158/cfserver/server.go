@@ -0,0 +1,504 @@
+// Package cfserver implements a minimal Bitcoin P2P server that answers BIP
+// 157 requests for compact block filters from a filter store, so that light
+// client implementations can be integration tested against the filters of
+// this repository without a patched full node.
+//
+// After the version handshake, the server answers getcfilters,
+// getcfheaders and getcfcheckpt from its Store and pings with pongs. If it
+// is given a HeaderSource it also answers getheaders, which is enough for a
+// light client to sync. Every other message is ignored. Requests violating
+// the limits of BIP 157 get the peer disconnected, as a full node would.
+package cfserver
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/christsim/bips/bip-0158/backend/chainhash"
+	"github.com/christsim/bips/bip-0158/backend/wire"
+	"github.com/christsim/bips/bip-0158/cfmsg"
+	"github.com/christsim/bips/bip-0158/gcs"
+	"github.com/christsim/bips/bip-0158/services"
+)
+
+var (
+	// ErrHandshake is returned when a peer doesn't start with a version
+	// message.
+	ErrHandshake = errors.New("cfserver: peer didn't send version first")
+
+	// ErrBadRequest is returned when a peer makes a request BIP 157 says
+	// it must be disconnected for.
+	ErrBadRequest = errors.New("cfserver: invalid request")
+
+	// ErrServerClosed is returned by Serve once Close has been called.
+	ErrServerClosed = errors.New("cfserver: server closed")
+)
+
+// Store is the source of the filters and filter headers the server serves.
+// It is implemented by *filterdb.DB.
+type Store interface {
+	// BlockHash returns the hash of the block at the passed height.
+	BlockHash(height uint32) (*chainhash.Hash, error)
+
+	// Height returns the height of the passed block.
+	Height(blockHash *chainhash.Hash) (uint32, error)
+
+	// TipHeight returns the height of the highest block stored.
+	TipHeight() (uint32, error)
+
+	// FetchFilter returns the filter of the passed type for the block.
+	FetchFilter(blockHash *chainhash.Hash,
+		filterType wire.FilterType) (*gcs.Filter, error)
+
+	// FetchHeader returns the filter header of the passed type for the
+	// block.
+	FetchHeader(blockHash *chainhash.Hash,
+		filterType wire.FilterType) (*chainhash.Hash, error)
+}
+
+// HeaderSource provides the block headers the server answers getheaders
+// with. It is implemented by backend.ChainClient.
+type HeaderSource interface {
+	GetBlockHeader(blockHash *chainhash.Hash) (*wire.BlockHeader, error)
+}
+
+// Config configures a Server.
+type Config struct {
+	// Store holds the filters to serve.
+	Store Store
+
+	// Net is the network whose magic messages are framed with.
+	Net wire.BitcoinNet
+
+	// FilterTypes are the filter types the server serves. Requests for
+	// any other type get the peer disconnected.
+	FilterTypes []wire.FilterType
+
+	// Headers, if set, provides block headers for getheaders requests.
+	Headers HeaderSource
+
+	// UserAgent is sent in the version message.
+	UserAgent string
+}
+
+// Server serves filters to any number of peers.
+type Server struct {
+	cfg Config
+
+	mtx       sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+// New returns a server with the passed configuration.
+func New(cfg Config) *Server {
+	if cfg.UserAgent == "" {
+		cfg.UserAgent = "/cfserver:0.1/"
+	}
+	return &Server{
+		cfg:       cfg,
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[net.Conn]struct{}),
+	}
+}
+
+// Serve accepts connections on l and serves each one in its own goroutine,
+// until l fails or Close is called.
+func (s *Server) Serve(l net.Listener) error {
+	s.mtx.Lock()
+	if s.closed {
+		s.mtx.Unlock()
+		return ErrServerClosed
+	}
+	s.listeners[l] = struct{}{}
+	s.mtx.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mtx.Lock()
+			closed := s.closed
+			delete(s.listeners, l)
+			s.mtx.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			return err
+		}
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.ServeConn(conn)
+		}()
+	}
+}
+
+// ServeConn serves a single peer until it disconnects, breaks the protocol
+// or the server is closed, and then closes conn. The returned error is nil
+// if the peer disconnected cleanly.
+func (s *Server) ServeConn(conn net.Conn) error {
+	s.mtx.Lock()
+	if s.closed {
+		s.mtx.Unlock()
+		conn.Close()
+		return ErrServerClosed
+	}
+	s.conns[conn] = struct{}{}
+	s.mtx.Unlock()
+
+	defer func() {
+		s.mtx.Lock()
+		delete(s.conns, conn)
+		s.mtx.Unlock()
+		conn.Close()
+	}()
+
+	p := &peer{server: s, conn: conn}
+	err := p.run()
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+// Close stops every listener passed to Serve, disconnects all peers and
+// waits for their goroutines to exit.
+func (s *Server) Close() error {
+	s.mtx.Lock()
+	s.closed = true
+	for l := range s.listeners {
+		l.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mtx.Unlock()
+
+	s.wg.Wait()
+	return nil
+}
+
+// peer is the state of a single connection.
+type peer struct {
+	server *Server
+	conn   net.Conn
+
+	// settings are what the peer asked of announcements by its
+	// sendheaders, feefilter and wtxidrelay messages.
+	settings cfmsg.PeerSettings
+}
+
+// send writes a message to the peer.
+func (p *peer) send(msg wire.Message) error {
+	return cfmsg.WriteMessage(p.conn, msg, p.server.cfg.Net)
+}
+
+// run performs the handshake and then answers requests until the peer
+// disconnects or an error occurs.
+func (p *peer) run() error {
+	msg, err := cfmsg.ReadMessage(p.conn, p.server.cfg.Net)
+	if err != nil {
+		return err
+	}
+	var version wire.MsgVersion
+	if err := decodeRaw(msg, &version); err != nil {
+		return ErrHandshake
+	}
+	if err := p.send(p.versionMsg()); err != nil {
+		return err
+	}
+	if err := p.send(wire.NewMsgVerAck()); err != nil {
+		return err
+	}
+
+	for {
+		msg, err := cfmsg.ReadMessage(p.conn, p.server.cfg.Net)
+		if err != nil {
+			return err
+		}
+		if err := p.handle(msg); err != nil {
+			return err
+		}
+	}
+}
+
+// versionMsg returns the version message the server introduces itself with.
+func (p *peer) versionMsg() *wire.MsgVersion {
+	flags := services.FilterPeer.ServiceFlag()
+	me := wire.NewNetAddressIPPort(net.IPv4zero, 0, flags)
+	you := wire.NewNetAddressIPPort(net.IPv4zero, 0, 0)
+	if addr, ok := p.conn.RemoteAddr().(*net.TCPAddr); ok {
+		you = wire.NewNetAddress(addr, 0)
+	}
+
+	var height int32
+	if tip, err := p.server.cfg.Store.TipHeight(); err == nil {
+		height = int32(tip)
+	}
+	msg := wire.NewMsgVersion(me, you, rand.Uint64(), height)
+	msg.Services = flags
+	msg.UserAgent = p.server.cfg.UserAgent
+	msg.Timestamp = time.Unix(time.Now().Unix(), 0)
+
+	return msg
+}
+
+// handle answers a single message.
+func (p *peer) handle(msg wire.Message) error {
+	switch m := msg.(type) {
+	case *cfmsg.MsgGetCFilters:
+		return p.handleGetCFilters(m)
+
+	case *cfmsg.MsgGetCFHeaders:
+		return p.handleGetCFHeaders(m)
+
+	case *cfmsg.MsgGetCFCheckpt:
+		return p.handleGetCFCheckpt(m)
+
+	case *cfmsg.MsgSendHeaders, *cfmsg.MsgFeeFilter, *cfmsg.MsgWtxidRelay:
+		p.settings.Update(m)
+		return nil
+
+	case *cfmsg.RawMessage:
+		switch m.Cmd {
+		case wire.CmdVerAck:
+			p.settings.Update(m)
+			return nil
+
+		case wire.CmdPing:
+			var ping wire.MsgPing
+			if err := decodeRaw(m, &ping); err != nil {
+				return err
+			}
+			return p.send(wire.NewMsgPong(ping.Nonce))
+
+		case wire.CmdGetHeaders:
+			if p.server.cfg.Headers == nil {
+				return nil
+			}
+			var getHeaders wire.MsgGetHeaders
+			if err := decodeRaw(m, &getHeaders); err != nil {
+				return err
+			}
+			return p.handleGetHeaders(&getHeaders)
+		}
+	}
+
+	return nil
+}
+
+// checkFilterType returns an error if the server doesn't serve the filter
+// type.
+func (p *peer) checkFilterType(filterType wire.FilterType) error {
+	for _, t := range p.server.cfg.FilterTypes {
+		if t == filterType {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: unsupported filter type %d", ErrBadRequest,
+		filterType)
+}
+
+// requestRange checks a request for the blocks from startHeight up to the
+// block with hash stopHash, of at most max blocks, and returns the height of
+// the stop block.
+func (p *peer) requestRange(filterType wire.FilterType, startHeight uint32,
+	stopHash *chainhash.Hash, max uint32) (uint32, error) {
+
+	if err := p.checkFilterType(filterType); err != nil {
+		return 0, err
+	}
+	stopHeight, err := p.server.cfg.Store.Height(stopHash)
+	if err != nil {
+		return 0, fmt.Errorf("%w: unknown stop hash %v", ErrBadRequest,
+			stopHash)
+	}
+	if startHeight > stopHeight || stopHeight-startHeight >= max {
+		return 0, fmt.Errorf("%w: invalid range %d-%d", ErrBadRequest,
+			startHeight, stopHeight)
+	}
+
+	return stopHeight, nil
+}
+
+// handleGetCFilters sends a cfilter message for each requested block.
+func (p *peer) handleGetCFilters(m *cfmsg.MsgGetCFilters) error {
+	stopHeight, err := p.requestRange(m.FilterType, m.StartHeight,
+		&m.StopHash, cfmsg.MaxGetCFiltersRange)
+	if err != nil {
+		return err
+	}
+
+	for height := m.StartHeight; height <= stopHeight; height++ {
+		blockHash, err := p.server.cfg.Store.BlockHash(height)
+		if err != nil {
+			return err
+		}
+		filter, err := p.server.cfg.Store.FetchFilter(blockHash,
+			m.FilterType)
+		if err != nil {
+			return err
+		}
+		nBytes, err := filter.NBytes()
+		if err != nil {
+			return err
+		}
+
+		err = p.send(&cfmsg.MsgCFilter{
+			FilterType: m.FilterType,
+			BlockHash:  *blockHash,
+			Filter:     nBytes,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// handleGetCFHeaders sends the filter hashes of the requested blocks along
+// with the filter header preceding them.
+func (p *peer) handleGetCFHeaders(m *cfmsg.MsgGetCFHeaders) error {
+	stopHeight, err := p.requestRange(m.FilterType, m.StartHeight,
+		&m.StopHash, cfmsg.MaxCFHeadersPerMsg)
+	if err != nil {
+		return err
+	}
+
+	reply := &cfmsg.MsgCFHeaders{
+		FilterType: m.FilterType,
+		StopHash:   m.StopHash,
+	}
+	if m.StartHeight > 0 {
+		prevHeader, err := p.header(m.StartHeight-1, m.FilterType)
+		if err != nil {
+			return err
+		}
+		reply.PrevFilterHeader = *prevHeader
+	}
+
+	for height := m.StartHeight; height <= stopHeight; height++ {
+		blockHash, err := p.server.cfg.Store.BlockHash(height)
+		if err != nil {
+			return err
+		}
+		filter, err := p.server.cfg.Store.FetchFilter(blockHash,
+			m.FilterType)
+		if err != nil {
+			return err
+		}
+		nBytes, err := filter.NBytes()
+		if err != nil {
+			return err
+		}
+		reply.FilterHashes = append(reply.FilterHashes,
+			chainhash.DoubleHashH(nBytes))
+	}
+
+	return p.send(reply)
+}
+
+// handleGetCFCheckpt sends the filter header of every CFCheckptInterval-th
+// block up to the requested one.
+func (p *peer) handleGetCFCheckpt(m *cfmsg.MsgGetCFCheckpt) error {
+	if err := p.checkFilterType(m.FilterType); err != nil {
+		return err
+	}
+	stopHeight, err := p.server.cfg.Store.Height(&m.StopHash)
+	if err != nil {
+		return fmt.Errorf("%w: unknown stop hash %v", ErrBadRequest,
+			m.StopHash)
+	}
+
+	reply := &cfmsg.MsgCFCheckpt{
+		FilterType:    m.FilterType,
+		StopHash:      m.StopHash,
+		FilterHeaders: []chainhash.Hash{},
+	}
+	const interval = cfmsg.CFCheckptInterval
+	for height := uint32(interval); height <= stopHeight; height += interval {
+		header, err := p.header(height, m.FilterType)
+		if err != nil {
+			return err
+		}
+		reply.FilterHeaders = append(reply.FilterHeaders, *header)
+	}
+
+	return p.send(reply)
+}
+
+// handleGetHeaders sends the block headers following the first block of the
+// locator the store knows, or following the genesis block if it knows none.
+func (p *peer) handleGetHeaders(m *wire.MsgGetHeaders) error {
+	start := uint32(0)
+	for _, hash := range m.BlockLocatorHashes {
+		height, err := p.server.cfg.Store.Height(hash)
+		if err == nil {
+			start = height
+			break
+		}
+	}
+	tip, err := p.server.cfg.Store.TipHeight()
+	if err != nil {
+		return err
+	}
+
+	reply := wire.NewMsgHeaders()
+	for height := start + 1; height <= tip; height++ {
+		if len(reply.Headers) == wire.MaxBlockHeadersPerMsg {
+			break
+		}
+		blockHash, err := p.server.cfg.Store.BlockHash(height)
+		if err != nil {
+			return err
+		}
+		header, err := p.server.cfg.Headers.GetBlockHeader(blockHash)
+		if err != nil {
+			return err
+		}
+		if err := reply.AddBlockHeader(header); err != nil {
+			return err
+		}
+		if *blockHash == m.HashStop {
+			break
+		}
+	}
+
+	return p.send(reply)
+}
+
+// header returns the filter header of the block at the passed height.
+func (p *peer) header(height uint32,
+	filterType wire.FilterType) (*chainhash.Hash, error) {
+
+	blockHash, err := p.server.cfg.Store.BlockHash(height)
+	if err != nil {
+		return nil, err
+	}
+	return p.server.cfg.Store.FetchHeader(blockHash, filterType)
+}
+
+// decodeRaw decodes the payload of a message the cfmsg package doesn't know
+// into the passed wire message, which must have the same command.
+func decodeRaw(msg wire.Message, into wire.Message) error {
+	raw, ok := msg.(*cfmsg.RawMessage)
+	if !ok || raw.Cmd != into.Command() {
+		return fmt.Errorf("cfserver: expected %v message, got %v",
+			into.Command(), msg.Command())
+	}
+
+	// Some messages, such as version, can only be decoded from a
+	// bytes.Buffer.
+	return into.BtcDecode(bytes.NewBuffer(raw.Payload),
+		wire.ProtocolVersion, wire.BaseEncoding)
+}
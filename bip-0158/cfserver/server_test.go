@@ -0,0 +1,418 @@
+package cfserver_test
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/christsim/bips/bip-0158/backend/chainhash"
+	"github.com/christsim/bips/bip-0158/backend/wire"
+	"github.com/christsim/bips/bip-0158/blockgen"
+	"github.com/christsim/bips/bip-0158/cfmsg"
+	"github.com/christsim/bips/bip-0158/cfserver"
+	"github.com/christsim/bips/bip-0158/filterdb"
+	"github.com/christsim/bips/bip-0158/gcs/builder"
+)
+
+// testBlocks is the length of the chain served, which spans two
+// checkpoints.
+const testBlocks = 2*cfmsg.CFCheckptInterval + 100
+
+// testNet is the network the messages of the tests are framed for.
+const testNet = wire.TestNet3
+
+// testChain is a chain of random blocks whose basic filters are stored in a
+// filterdb.DB.
+type testChain struct {
+	db      *filterdb.DB
+	hashes  []chainhash.Hash
+	headers map[chainhash.Hash]*wire.BlockHeader
+	filters *builder.FilterHeaderChain
+	nBytes  [][]byte
+}
+
+// GetBlockHeader returns the header of the block with the passed hash.
+func (c *testChain) GetBlockHeader(blockHash *chainhash.Hash) (
+	*wire.BlockHeader, error) {
+
+	header, ok := c.headers[*blockHash]
+	if !ok {
+		return nil, filterdb.ErrNotFound
+	}
+	return header, nil
+}
+
+// newTestChain generates testBlocks blocks and stores their filters.
+func newTestChain(t *testing.T) *testChain {
+	t.Helper()
+
+	db, err := filterdb.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	c := &testChain{
+		db:      db,
+		headers: make(map[chainhash.Hash]*wire.BlockHeader),
+		filters: builder.NewFilterHeaderChain(0),
+	}
+	cfg := blockgen.DefaultConfig
+	cfg.MaxTxs = 3
+	gen := blockgen.New(1, cfg)
+	batch := db.NewBatch()
+	for height := uint32(0); height < testBlocks; height++ {
+		block := gen.Block()
+		filter, err := builder.BuildFilter(builder.BasicPolicy{
+			ScriptTypes: builder.AllScriptTypes,
+		}, block, builder.DefaultP)
+		if err != nil {
+			t.Fatal(err)
+		}
+		header, err := c.filters.Append(filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		nBytes, err := filter.NBytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		blockHash := block.BlockHash()
+		c.hashes = append(c.hashes, blockHash)
+		c.headers[blockHash] = &block.Header
+		c.nBytes = append(c.nBytes, nBytes)
+		err = batch.PutFilter(&filterdb.Entry{
+			Height:     height,
+			BlockHash:  blockHash,
+			FilterType: wire.GCSFilterRegular,
+			Filter:     filter,
+			Header:     header,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.WriteBatch(batch); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// header returns the filter header of the block at the passed height.
+func (c *testChain) header(t *testing.T, height uint32) chainhash.Hash {
+	t.Helper()
+
+	header, err := c.filters.Header(height)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return header
+}
+
+// dial connects to a peer served by s over the loopback interface. The error
+// ServeConn returns is sent on the returned channel.
+func dial(t *testing.T, s *cfserver.Server) (net.Conn, <-chan error) {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	served := make(chan error, 1)
+	go func() {
+		server, err := l.Accept()
+		if err != nil {
+			served <- err
+			return
+		}
+		served <- s.ServeConn(server)
+	}()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn, served
+}
+
+// connect connects to a peer served by s and performs its handshake.
+func connect(t *testing.T, s *cfserver.Server) (net.Conn, <-chan error) {
+	t.Helper()
+
+	conn, served := dial(t, s)
+	me := wire.NewNetAddressIPPort(net.IPv4zero, 0, 0)
+	err := cfmsg.WriteMessage(conn, wire.NewMsgVersion(me, me, 1, 0),
+		testNet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, cmd := range []string{wire.CmdVersion, wire.CmdVerAck} {
+		msg, err := cfmsg.ReadMessage(conn, testNet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.Command() != cmd {
+			t.Fatalf("got %v message, want %v", msg.Command(), cmd)
+		}
+	}
+	return conn, served
+}
+
+// decode decodes a message the cfmsg package doesn't know into the passed
+// wire message.
+func decode(t *testing.T, msg wire.Message, into wire.Message) {
+	t.Helper()
+
+	raw, ok := msg.(*cfmsg.RawMessage)
+	if !ok || raw.Cmd != into.Command() {
+		t.Fatalf("got %v message, want %v", msg.Command(),
+			into.Command())
+	}
+	err := into.BtcDecode(bytes.NewBuffer(raw.Payload),
+		wire.ProtocolVersion, wire.BaseEncoding)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestServe sends a request per connection and checks the replies, or that
+// the peer is disconnected for requests BIP 157 doesn't allow.
+func TestServe(t *testing.T) {
+	c := newTestChain(t)
+	s := cfserver.New(cfserver.Config{
+		Store:       c.db,
+		Net:         testNet,
+		FilterTypes: []wire.FilterType{wire.GCSFilterRegular},
+		Headers:     c,
+	})
+	defer s.Close()
+
+	getHeaders := func(locator uint32,
+		stop chainhash.Hash) *wire.MsgGetHeaders {
+
+		msg := wire.NewMsgGetHeaders()
+		msg.AddBlockLocatorHash(&c.hashes[locator])
+		msg.HashStop = stop
+		return msg
+	}
+	// checkHeaders checks that a headers message holds the headers of
+	// the blocks from start up to end.
+	checkHeaders := func(start, end uint32) func(*testing.T,
+		[]wire.Message) {
+
+		return func(t *testing.T, replies []wire.Message) {
+			var headers wire.MsgHeaders
+			decode(t, replies[0], &headers)
+			if len(headers.Headers) != int(end-start+1) {
+				t.Fatalf("got %d headers, want %d",
+					len(headers.Headers), end-start+1)
+			}
+			for i, header := range headers.Headers {
+				height := start + uint32(i)
+				if header.BlockHash() != c.hashes[height] {
+					t.Fatalf("header %d isn't that of "+
+						"height %d", i, height)
+				}
+			}
+		}
+	}
+	unknown := chainhash.HashH([]byte("unknown"))
+
+	tests := []struct {
+		name    string
+		request wire.Message
+		replies int
+		check   func(t *testing.T, replies []wire.Message)
+
+		// err is the error ServeConn returns, once the test
+		// disconnects if it is nil.
+		err error
+	}{{
+		name: "getcfcheckpt",
+		request: &cfmsg.MsgGetCFCheckpt{
+			StopHash: c.hashes[testBlocks-1],
+		},
+		replies: 1,
+		check: func(t *testing.T, replies []wire.Message) {
+			checkpt := replies[0].(*cfmsg.MsgCFCheckpt)
+			want := []chainhash.Hash{
+				c.header(t, cfmsg.CFCheckptInterval),
+				c.header(t, 2*cfmsg.CFCheckptInterval),
+			}
+			if !reflect.DeepEqual(checkpt.FilterHeaders, want) {
+				t.Fatalf("checkpoints %v, want %v",
+					checkpt.FilterHeaders, want)
+			}
+		},
+	}, {
+		name: "getcfcheckpt before first checkpoint",
+		request: &cfmsg.MsgGetCFCheckpt{
+			StopHash: c.hashes[cfmsg.CFCheckptInterval-1],
+		},
+		replies: 1,
+		check: func(t *testing.T, replies []wire.Message) {
+			checkpt := replies[0].(*cfmsg.MsgCFCheckpt)
+			if len(checkpt.FilterHeaders) != 0 {
+				t.Fatalf("got %d checkpoints, want none",
+					len(checkpt.FilterHeaders))
+			}
+		},
+	}, {
+		name: "getcfheaders",
+		request: &cfmsg.MsgGetCFHeaders{
+			StartHeight: 1,
+			StopHash:    c.hashes[cfmsg.MaxCFHeadersPerMsg],
+		},
+		replies: 1,
+		check: func(t *testing.T, replies []wire.Message) {
+			cfheaders := replies[0].(*cfmsg.MsgCFHeaders)
+			headers := builder.HeadersFromHashes(
+				cfheaders.PrevFilterHeader,
+				cfheaders.FilterHashes)
+			if len(headers) != cfmsg.MaxCFHeadersPerMsg {
+				t.Fatalf("got %d headers, want %d",
+					len(headers), cfmsg.MaxCFHeadersPerMsg)
+			}
+			for i, header := range headers {
+				want := c.header(t, uint32(i+1))
+				if header != want {
+					t.Fatalf("header %d is %v, want %v",
+						i+1, header, want)
+				}
+			}
+		},
+	}, {
+		name: "getcfilters",
+		request: &cfmsg.MsgGetCFilters{
+			StartHeight: 5,
+			StopHash:    c.hashes[9],
+		},
+		replies: 5,
+		check: func(t *testing.T, replies []wire.Message) {
+			for i, reply := range replies {
+				cfilter := reply.(*cfmsg.MsgCFilter)
+				filter := cfilter.Filter
+				if cfilter.BlockHash != c.hashes[5+i] ||
+					!bytes.Equal(filter, c.nBytes[5+i]) {
+
+					t.Fatalf("filter %d isn't that of "+
+						"height %d", i, 5+i)
+				}
+			}
+		},
+	}, {
+		name:    "getheaders",
+		request: getHeaders(10, chainhash.Hash{}),
+		replies: 1,
+		check:   checkHeaders(11, 10+wire.MaxBlockHeadersPerMsg),
+	}, {
+		name:    "getheaders with stop hash",
+		request: getHeaders(10, c.hashes[20]),
+		replies: 1,
+		check:   checkHeaders(11, 20),
+	}, {
+		name:    "ping",
+		request: wire.NewMsgPing(7),
+		replies: 1,
+		check: func(t *testing.T, replies []wire.Message) {
+			var pong wire.MsgPong
+			decode(t, replies[0], &pong)
+			if pong.Nonce != 7 {
+				t.Fatalf("pong nonce %d, want 7", pong.Nonce)
+			}
+		},
+	}, {
+		name:    "ignored",
+		request: wire.NewMsgInv(),
+	}, {
+		name: "getcfilters range too large",
+		request: &cfmsg.MsgGetCFilters{
+			StopHash: c.hashes[cfmsg.MaxGetCFiltersRange],
+		},
+		err: cfserver.ErrBadRequest,
+	}, {
+		name: "getcfheaders range too large",
+		request: &cfmsg.MsgGetCFHeaders{
+			StopHash: c.hashes[cfmsg.MaxCFHeadersPerMsg],
+		},
+		err: cfserver.ErrBadRequest,
+	}, {
+		name: "reversed range",
+		request: &cfmsg.MsgGetCFilters{
+			StartHeight: 10,
+			StopHash:    c.hashes[9],
+		},
+		err: cfserver.ErrBadRequest,
+	}, {
+		name:    "unknown stop hash",
+		request: &cfmsg.MsgGetCFCheckpt{StopHash: unknown},
+		err:     cfserver.ErrBadRequest,
+	}, {
+		name: "unsupported filter type",
+		request: &cfmsg.MsgGetCFHeaders{
+			FilterType: wire.GCSFilterExtended,
+			StopHash:   c.hashes[0],
+		},
+		err: cfserver.ErrBadRequest,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conn, served := connect(t, s)
+			err := cfmsg.WriteMessage(conn, test.request, testNet)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var replies []wire.Message
+			for len(replies) < test.replies {
+				msg, err := cfmsg.ReadMessage(conn, testNet)
+				if err != nil {
+					t.Fatal(err)
+				}
+				replies = append(replies, msg)
+			}
+			if test.check != nil {
+				test.check(t, replies)
+			}
+
+			if test.err != nil {
+				_, err := cfmsg.ReadMessage(conn, testNet)
+				if err == nil {
+					t.Fatal("peer wasn't disconnected")
+				}
+			}
+			conn.Close()
+			if err := <-served; !errors.Is(err, test.err) {
+				t.Fatalf("got error %v, want %v", err, test.err)
+			}
+		})
+	}
+}
+
+// TestServeHandshake checks that a peer starting with anything but a version
+// message is disconnected, and that a closed server serves no one.
+func TestServeHandshake(t *testing.T) {
+	c := newTestChain(t)
+	s := cfserver.New(cfserver.Config{Store: c.db, Net: testNet})
+
+	conn, served := dial(t, s)
+	err := cfmsg.WriteMessage(conn, wire.NewMsgPing(1), testNet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-served; !errors.Is(err, cfserver.ErrHandshake) {
+		t.Fatalf("got error %v, want %v", err, cfserver.ErrHandshake)
+	}
+
+	s.Close()
+	_, server := net.Pipe()
+	if err := s.ServeConn(server); err != cfserver.ErrServerClosed {
+		t.Fatalf("got error %v, want %v", err, cfserver.ErrServerClosed)
+	}
+}
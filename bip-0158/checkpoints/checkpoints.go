@@ -0,0 +1,217 @@
+// Package checkpoints embeds the hashes of known-good blocks of each public
+// network, and checks that a walk of the chain from the genesis block passes
+// through them:
+//
+//	v := checkpoints.NewVerifier(checkpoints.ForNet(wire.TestNet3))
+//	for height := uint32(0); ; height++ {
+//		...
+//		if err := v.Check(height, &block.Header); err != nil {
+//			return err
+//		}
+//	}
+//
+// Each block must build on the one checked before it, so once a walk reaches
+// a checkpoint, every block before it is pinned: a node can't substitute any
+// of them without changing the checkpoint's hash. The test vector generator
+// checks the blocks it fetches this way, so that a compromised or
+// misconfigured node can't slip other blocks into the published vectors.
+//
+// The checkpoints are those btcd ships for mainnet and testnet3, along with
+// the testnet3 blocks of the published BIP 158 test vectors. Regtest and
+// simnet chains are local, so they have none.
+package checkpoints
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/christsim/bips/bip-0158/backend/chainhash"
+	"github.com/christsim/bips/bip-0158/backend/wire"
+)
+
+var (
+	// ErrMismatch is returned for a block at the height of a checkpoint
+	// whose hash differs from it.
+	ErrMismatch = errors.New("checkpoints: block doesn't match checkpoint")
+
+	// ErrUnlinked is returned for a block that doesn't build on the
+	// block checked before it.
+	ErrUnlinked = errors.New("checkpoints: block doesn't build on the " +
+		"previous block")
+)
+
+// Checkpoint is the hash of the block at a height.
+type Checkpoint struct {
+	Height uint32
+	Hash   chainhash.Hash
+}
+
+// checkpoint returns the checkpoint of the block with the passed hash, in the
+// byte order hashes are displayed in.
+func checkpoint(height uint32, hash string) Checkpoint {
+	blockHash, err := chainhash.NewHashFromStr(hash)
+	if err != nil {
+		panic(err)
+	}
+	return Checkpoint{Height: height, Hash: *blockHash}
+}
+
+// mainNet are the checkpoints of mainnet: the genesis block and those of
+// btcd.
+var mainNet = []Checkpoint{
+	checkpoint(0, "000000000019d6689c085ae165831e934ff763ae46a2a6c172b3f1b60a8ce26f"),
+	checkpoint(11111, "0000000069e244f73d78e8fd29ba2fd2ed618bd6fa2ee92559f542fdb26e7c1d"),
+	checkpoint(33333, "000000002dd5588a74784eaa7ab0507a18ad16a236e7b1ce69f00d7ddfb5d0a6"),
+	checkpoint(74000, "0000000000573993a3c9e41ce34471c079dcf5f52a0e824a81e7f953b8661a20"),
+	checkpoint(105000, "00000000000291ce28027faea320c8d2b054b2e0fe44a773f3eefb151d6bdc97"),
+	checkpoint(134444, "00000000000005b12ffd4cd315cd34ffd4a594f430ac814c91184a0d42d2b0fe"),
+	checkpoint(168000, "000000000000099e61ea72015e79632f216fe6cb33d7899acb35b75c8303b763"),
+	checkpoint(193000, "000000000000059f452a5f7340de6682a977387c17010ff6e6c3bd83ca8b1317"),
+	checkpoint(210000, "000000000000048b95347e83192f69cf0366076336c639f9b7228e9ba171342e"),
+	checkpoint(216116, "00000000000001b4f4b433e81ee46494af945cf96014816a4e2370f11b23df4e"),
+	checkpoint(225430, "00000000000001c108384350f74090433e7fcf79a606b8e797f065b130575932"),
+	checkpoint(250000, "000000000000003887df1f29024b06fc2200b55f8af8f35453d7be294df2d214"),
+	checkpoint(267300, "000000000000000a83fbd660e918f218bf37edd92b748ad940483c7c116179ac"),
+	checkpoint(279000, "0000000000000001ae8c72a0b0c301f67e3afca10e819efa9041e458e9bd7e40"),
+	checkpoint(300255, "0000000000000000162804527c6e9b9f0563a280525f9d08c12041def0a0f3b2"),
+	checkpoint(319400, "000000000000000021c6052e9becade189495d1c539aa37c58917305fd15f13b"),
+	checkpoint(343185, "0000000000000000072b8bf361d01a6ba7d445dd024203fafc78768ed4368554"),
+	checkpoint(352940, "000000000000000010755df42dba556bb72be6a32f3ce0b6941ce4430152c9ff"),
+	checkpoint(382320, "00000000000000000a8dc6ed5b133d0eb2fd6af56203e4159789b092defd8ab2"),
+	checkpoint(400000, "000000000000000004ec466ce4732fe6f1ed1cddc2ed4b328fff5224276e3f6f"),
+	checkpoint(430000, "000000000000000001868b2bb3a285f3cc6b33ea234eb70facf4dcdf22186b87"),
+	checkpoint(460000, "000000000000000000ef751bbce8e744ad303c47ece06c8d863e4d417efc258c"),
+	checkpoint(490000, "000000000000000000de069137b17b8d5a3dfbd5b145b2dcfb203f15d0c4de90"),
+	checkpoint(520000, "0000000000000000000d26984c0229c9f6962dc74db0a6d525f2f1640396f69c"),
+	checkpoint(550000, "000000000000000000223b7a2298fb1c6c75fb0efc28a4c56853ff4112ec6bc9"),
+	checkpoint(560000, "0000000000000000002c7b276daf6efb2b6aa68e2ce3be67ef925b3264ae7122"),
+	checkpoint(563378, "0000000000000000000f1c54590ee18d15ec70e68c8cd4cfbadb1b4f11697eee"),
+	checkpoint(597379, "00000000000000000005f8920febd3925f8272a6a71237563d78c2edfdd09ddf"),
+	checkpoint(623950, "0000000000000000000f2adce67e49b0b6bdeb9de8b7c3d7e93b21e7fc1e819d"),
+	checkpoint(654683, "0000000000000000000b9d2ec5a352ecba0592946514a92f14319dc2b367fc72"),
+	checkpoint(691719, "00000000000000000008a89e854d57e5667df88f1cdef6fde2fbca1de5b639ad"),
+	checkpoint(724466, "000000000000000000052d314a259755ca65944e68df6b12a067ea8f1f5a7091"),
+	checkpoint(751565, "00000000000000000009c97098b5295f7e5f183ac811fb5d1534040adb93cabd"),
+	checkpoint(781565, "00000000000000000002b8c04999434c33b8e033f11a977b288f8411766ee61c"),
+	checkpoint(800000, "00000000000000000002a7c4c1e48d76c5a37902165a270156b7a8d72728a054"),
+	checkpoint(810000, "000000000000000000028028ca82b6aa81ce789e4eb9e0321b74c3cbaf405dd1"),
+}
+
+// testNet3 are the checkpoints of testnet3: the genesis block and those of
+// btcd, with the blocks of the published test vectors among them.
+var testNet3 = []Checkpoint{
+	checkpoint(0, "000000000933ea01ad0ee984209779baaec3ced90fa3f408719526f8d77f4943"),
+	checkpoint(1, "00000000b873e79784647a6c82962c70d228557d24a747ea4d1b8bbe878e1206"),
+	checkpoint(2, "000000006c02c8ea6e4ff69651f7fcde348fb9d557a06e6957b65552002a7820"),
+	checkpoint(3, "000000008b896e272758da5297bcd98fdc6d97c9b765ecec401e286dc1fdbe10"),
+	checkpoint(546, "000000002a936ca763904c3c35fce2f3556c559c0214345d31b1bcebf76acb70"),
+	checkpoint(100000, "00000000009e2958c15ff9290d571bf9459e93b19765c6801ddeccadbb160a1e"),
+	checkpoint(200000, "0000000000287bffd321963ef05feab753ebe274e1d78b2fd4e2bfe9ad3aa6f2"),
+	checkpoint(300001, "0000000000004829474748f3d1bc8fcf893c88be255e6d7f571c548aff57abf4"),
+	checkpoint(400002, "0000000005e2c73b8ecb82ae2dbc2e8274614ebad7172b53528aba7501f5a089"),
+	checkpoint(500011, "00000000000929f63977fbac92ff570a9bd9e7715401ee96f2848f7b07750b02"),
+	checkpoint(600002, "000000000001f471389afd6ee94dcace5ccc44adc18e8bff402443f034b07240"),
+	checkpoint(700000, "000000000000406178b12a4dea3b27e13b3c4fe4510994fd667d7c1e6a3f4dc1"),
+	checkpoint(800010, "000000000017ed35296433190b6829db01e657d80631d43f5983fa403bfdb4c1"),
+	checkpoint(900000, "0000000000356f8d8924556e765b7a94aaebc6b5c8685dcfa2b1ee8b41acd89b"),
+	checkpoint(926485, "000000000000015d6077a411a8f5cc95caf775ccf11c54e27df75ce58d187313"),
+	checkpoint(987876, "0000000000000c00901f2049055e2a437c819d79a3d54fd63e6af796cd7b8a79"),
+	checkpoint(1000007, "00000000001ccb893d8a1f25b70ad173ce955e5f50124261bbbc50379a612ddf"),
+	checkpoint(1100007, "00000000000abc7b2cd18768ab3dee20857326a818d1946ed6796f42d66dd1e8"),
+	checkpoint(1200007, "00000000000004f2dc41845771909db57e04191714ed8c963f7e56713a7b6cea"),
+	checkpoint(1263442, "000000006f27ddfe1dd680044a34548f41bed47eba9e6f0b310da21423bc5f33"),
+	checkpoint(1300007, "0000000072eab69d54df75107c052b26b0395b44f77578184293bf1bb1dbd9fa"),
+	checkpoint(1354312, "0000000000000037a8cd3e06cd5edbfe9dd1dbcc5dacab279376ef7cfc2b4c75"),
+	checkpoint(1580000, "00000000000000b7ab6ce61eb6d571003fbe5fe892da4c9b740c49a07542462d"),
+	checkpoint(1692000, "000000000000056c49030c174179b52a928c870e6e8a822c75973b7970cfbd01"),
+	checkpoint(1864000, "000000000000006433d1efec504c53ca332b64963c425395515b01977bd7b3b0"),
+	checkpoint(2010000, "0000000000004ae2f3896ca8ecd41c460a35bf6184e145d91558cece1c688a76"),
+	checkpoint(2143398, "00000000000163cfb1f97c4e4098a3692c8053ad9cab5ad9c86b338b5c00b8b7"),
+	checkpoint(2344474, "0000000000000004877fa2d36316398528de4f347df2f8a96f76613a298ce060"),
+}
+
+// ForNet returns the checkpoints of the network, sorted by height, or none
+// for networks without them. The slice must not be modified.
+func ForNet(net wire.BitcoinNet) []Checkpoint {
+	switch net {
+	case wire.MainNet:
+		return mainNet
+	case wire.TestNet3:
+		return testNet3
+	}
+	return nil
+}
+
+// Verifier checks the blocks of a walk of the chain, one height after the
+// other from the genesis block, against a set of checkpoints.
+type Verifier struct {
+	checkpoints []Checkpoint
+
+	// next is the index of the first checkpoint not yet reached.
+	next int
+
+	// height and hash are those of the last block checked.
+	checked bool
+	height  uint32
+	hash    chainhash.Hash
+}
+
+// NewVerifier returns a verifier of the passed checkpoints, which must be
+// sorted by height.
+func NewVerifier(checkpoints []Checkpoint) *Verifier {
+	return &Verifier{checkpoints: checkpoints}
+}
+
+// Check checks the header of the block at the passed height, which must be the
+// genesis block or the block after the last one checked: that it builds on
+// that block, and that its hash is that of the checkpoint at its height, if
+// any.
+func (v *Verifier) Check(height uint32, header *wire.BlockHeader) error {
+	blockHash := header.BlockHash()
+	if height > 0 {
+		if !v.checked || height != v.height+1 {
+			return fmt.Errorf("%w: block %v at height %d checked "+
+				"out of order", ErrUnlinked, blockHash, height)
+		}
+		if header.PrevBlock != v.hash {
+			return fmt.Errorf("%w: block %v at height %d builds "+
+				"on %v, expected %v", ErrUnlinked, blockHash,
+				height, header.PrevBlock, v.hash)
+		}
+	}
+
+	for v.next < len(v.checkpoints) &&
+		v.checkpoints[v.next].Height <= height {
+
+		cp := &v.checkpoints[v.next]
+		if cp.Height == height && cp.Hash != blockHash {
+			return fmt.Errorf("%w: block %v at height %d, "+
+				"checkpoint %v", ErrMismatch, blockHash, height,
+				cp.Hash)
+		}
+		v.next++
+	}
+
+	v.checked = true
+	v.height = height
+	v.hash = blockHash
+	return nil
+}
+
+// Pinned returns the height of the last checkpoint reached, up to which every
+// block checked is pinned, and false if none was reached.
+func (v *Verifier) Pinned() (uint32, bool) {
+	if v.next == 0 {
+		return 0, false
+	}
+	return v.checkpoints[v.next-1].Height, true
+}
+
+// Next returns the first checkpoint not yet reached, and false if every
+// checkpoint was.
+func (v *Verifier) Next() (Checkpoint, bool) {
+	if v.next == len(v.checkpoints) {
+		return Checkpoint{}, false
+	}
+	return v.checkpoints[v.next], true
+}
@@ -0,0 +1,241 @@
+package checkpoints_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/christsim/bips/bip-0158/backend/chaincfg"
+	"github.com/christsim/bips/bip-0158/backend/chainhash"
+	"github.com/christsim/bips/bip-0158/backend/wire"
+	"github.com/christsim/bips/bip-0158/blockgen"
+	"github.com/christsim/bips/bip-0158/checkpoints"
+)
+
+// vectorBlock is a block of testnet-20.json.
+type vectorBlock struct {
+	height uint32
+	block  *wire.MsgBlock
+}
+
+// loadBlocks returns the blocks of the published test vectors.
+func loadBlocks(t *testing.T) []vectorBlock {
+	t.Helper()
+
+	data, err := os.ReadFile("../testnet-20.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rows [][]interface{}
+	if err := json.Unmarshal(data, &rows); err != nil {
+		t.Fatal(err)
+	}
+
+	var blocks []vectorBlock
+	for _, row := range rows[1:] {
+		raw, err := hex.DecodeString(row[2].(string))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var block wire.MsgBlock
+		if err := block.Deserialize(bytes.NewReader(raw)); err != nil {
+			t.Fatal(err)
+		}
+		blocks = append(blocks, vectorBlock{
+			height: uint32(row[0].(float64)),
+			block:  &block,
+		})
+	}
+	return blocks
+}
+
+// TestForNet checks that the checkpoints of each network are sorted, start at
+// its genesis block and include the blocks of the test vectors.
+func TestForNet(t *testing.T) {
+	tests := []struct {
+		net     wire.BitcoinNet
+		genesis *chainhash.Hash
+	}{{
+		net:     wire.MainNet,
+		genesis: chaincfg.MainNetParams.GenesisHash,
+	}, {
+		net:     wire.TestNet3,
+		genesis: chaincfg.TestNet3Params.GenesisHash,
+	}, {
+		net: wire.TestNet,
+	}, {
+		net: wire.SimNet,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.net.String(), func(t *testing.T) {
+			cps := checkpoints.ForNet(test.net)
+			if test.genesis == nil {
+				if len(cps) != 0 {
+					t.Fatalf("got %d checkpoints, want none",
+						len(cps))
+				}
+				return
+			}
+			if cps[0].Height != 0 || cps[0].Hash != *test.genesis {
+				t.Fatalf("first checkpoint %v at height %d isn't "+
+					"the genesis block", cps[0].Hash,
+					cps[0].Height)
+			}
+			for i := 1; i < len(cps); i++ {
+				if cps[i].Height <= cps[i-1].Height {
+					t.Fatalf("checkpoint %d at height %d "+
+						"follows height %d", i,
+						cps[i].Height, cps[i-1].Height)
+				}
+			}
+		})
+	}
+
+	heights := make(map[uint32]chainhash.Hash)
+	for _, cp := range checkpoints.ForNet(wire.TestNet3) {
+		heights[cp.Height] = cp.Hash
+	}
+	for _, vb := range loadBlocks(t) {
+		blockHash := vb.block.BlockHash()
+		if cp, ok := heights[vb.height]; !ok || cp != blockHash {
+			t.Fatalf("height %d: block %v has no checkpoint",
+				vb.height, blockHash)
+		}
+	}
+}
+
+// TestVerifier walks chains past sets of checkpoints, including the first
+// blocks of testnet3.
+func TestVerifier(t *testing.T) {
+	var testnet []*wire.BlockHeader
+	for _, vb := range loadBlocks(t) {
+		if vb.height == uint32(len(testnet)) {
+			testnet = append(testnet, &vb.block.Header)
+		}
+	}
+
+	var chain, other []*wire.BlockHeader
+	gen := blockgen.New(1, blockgen.DefaultConfig)
+	otherGen := blockgen.New(2, blockgen.DefaultConfig)
+	for i := 0; i < 10; i++ {
+		chain = append(chain, &gen.Block().Header)
+		other = append(other, &otherGen.Block().Header)
+	}
+	cps := func(heights ...uint32) []checkpoints.Checkpoint {
+		var cps []checkpoints.Checkpoint
+		for _, height := range heights {
+			cps = append(cps, checkpoints.Checkpoint{
+				Height: height,
+				Hash:   chain[height].BlockHash(),
+			})
+		}
+		return cps
+	}
+	mismatch := cps(0, 3, 6)
+	mismatch[1].Hash = other[3].BlockHash()
+
+	// spliced is chain with a block of other in place of one of its own.
+	spliced := append([]*wire.BlockHeader(nil), chain...)
+	spliced[5] = other[5]
+
+	tests := []struct {
+		name        string
+		checkpoints []checkpoints.Checkpoint
+		headers     []*wire.BlockHeader
+
+		// heights are the heights the headers are checked at, or
+		// those from the genesis block on if nil.
+		heights []uint32
+
+		// failAt is the index of the header Check fails for, if err
+		// is set.
+		failAt int
+		err    error
+
+		pinned uint32
+		next   uint32
+	}{{
+		name:        "testnet3",
+		checkpoints: checkpoints.ForNet(wire.TestNet3),
+		headers:     testnet,
+		pinned:      3,
+		next:        546,
+	}, {
+		name:        "past every checkpoint",
+		checkpoints: cps(0, 3, 6),
+		headers:     chain,
+		pinned:      6,
+	}, {
+		name:        "before first checkpoint",
+		checkpoints: cps(3, 6),
+		headers:     chain[:3],
+		next:        3,
+	}, {
+		name:        "mismatch",
+		checkpoints: mismatch,
+		headers:     chain,
+		failAt:      3,
+		err:         checkpoints.ErrMismatch,
+	}, {
+		name:        "spliced",
+		checkpoints: cps(0, 3, 6),
+		headers:     spliced,
+		failAt:      5,
+		err:         checkpoints.ErrUnlinked,
+	}, {
+		name:        "skipped height",
+		checkpoints: cps(0),
+		headers:     chain[:3],
+		heights:     []uint32{0, 1, 3},
+		failAt:      2,
+		err:         checkpoints.ErrUnlinked,
+	}, {
+		name:        "without genesis",
+		checkpoints: cps(0),
+		headers:     chain[1:3],
+		heights:     []uint32{1, 2},
+		failAt:      0,
+		err:         checkpoints.ErrUnlinked,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			v := checkpoints.NewVerifier(test.checkpoints)
+			for i, header := range test.headers {
+				height := uint32(i)
+				if test.heights != nil {
+					height = test.heights[i]
+				}
+				err := v.Check(height, header)
+				if test.err != nil && i == test.failAt {
+					if !errors.Is(err, test.err) {
+						t.Fatalf("height %d: got error "+
+							"%v, want %v", height, err,
+							test.err)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("height %d: %v", height, err)
+				}
+			}
+
+			pinned, ok := v.Pinned()
+			if pinned != test.pinned ||
+				ok != (test.checkpoints[0].Height == 0) {
+
+				t.Fatalf("pinned up to %d, %v, want %d", pinned,
+					ok, test.pinned)
+			}
+			next, ok := v.Next()
+			if ok != (test.next != 0) || next.Height != test.next {
+				t.Fatalf("next checkpoint at %d, %v, want %d",
+					next.Height, ok, test.next)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package coinselect
+
+// branchAndBound searches the pool, sorted by decreasing effective value, for
+// the coins whose effective values add up to at least the target and exceed
+// it by at most costOfChange, exceeding it the least. It walks the tree of
+// decisions to include or omit each coin depth first, trying inclusion
+// first, and backtracks once the selection exceeds the window or the coins
+// left can't reach the target. Omitting a coin as valuable and heavy as one
+// just omitted leads to selections already tried, so those branches are
+// skipped. An exact match ends the search early. It returns nil if no
+// selection is found within maxTries steps.
+func branchAndBound(pool []candidate, target, costOfChange int64,
+	maxTries int) []candidate {
+
+	var available int64
+	for _, cand := range pool {
+		available += cand.value
+	}
+	if available < target {
+		return nil
+	}
+
+	// selection holds the indexes of the included coins, in increasing
+	// order, and value their effective value.
+	var (
+		selection, best []int
+		value           int64
+		bestExcess      int64 = -1
+	)
+	for try, i := 0, 0; try < maxTries; try, i = try+1, i+1 {
+		backtrack := false
+		switch {
+		case value+available < target || value > target+costOfChange:
+			backtrack = true
+
+		case value >= target:
+			excess := value - target
+			if bestExcess < 0 || excess <= bestExcess {
+				best = append(best[:0], selection...)
+				bestExcess = excess
+			}
+			backtrack = true
+		}
+		if bestExcess == 0 {
+			break
+		}
+
+		if backtrack {
+			if len(selection) == 0 {
+				break
+			}
+
+			// The coins after the last one included go back to
+			// those available before it is omitted instead.
+			last := selection[len(selection)-1]
+			for i--; i > last; i-- {
+				available += pool[i].value
+			}
+			value -= pool[last].value
+			selection = selection[:len(selection)-1]
+			continue
+		}
+
+		cand := pool[i]
+		available -= cand.value
+		if len(selection) == 0 || selection[len(selection)-1] == i-1 ||
+			cand.value != pool[i-1].value ||
+			cand.weight != pool[i-1].weight {
+
+			selection = append(selection, i)
+			value += cand.value
+		}
+	}
+	if best == nil {
+		return nil
+	}
+
+	selected := make([]candidate, len(best))
+	for j, i := range best {
+		selected[j] = pool[i]
+	}
+	return selected
+}
@@ -0,0 +1,487 @@
+// Package coinselect chooses which coins of a wallet a transaction spends, so
+// that the coins a rescan finds can pay for outputs at a fee rate.
+//
+// Coins are weighed by their effective value, their value less the fee of
+// the input spending them. Select first searches for a set of coins paying
+// the outputs and the fee without change, with the branch-and-bound search
+// of Bitcoin Core: a set is accepted if what it pays over the target costs
+// less than creating the change output and later spending it, the excess
+// being left to the fee. Without such a set it falls back on Bitcoin Core's
+// knapsack solver, which picks coins at random towards the target and a
+// change of at least MinChange. Change below the dust threshold of the
+// change script is left to the fee.
+//
+// Spends signal replaceability as defined by BIP 125 unless told otherwise,
+// and can replace an unconfirmed transaction themselves: its inputs are then
+// spent again, and the fee paid follows the rules BIP 125 sets for
+// replacements.
+//
+// The coins may be found by a rescan with FromRescan:
+//
+//	coins := coinselect.FromRescan(txs, r.WatchList(), tipHeight)
+//	sel, err := coinselect.Select(coins, &coinselect.Config{
+//		Outputs:      outputs,
+//		FeeRate:      2000,
+//		ChangeScript: changeScript,
+//	})
+//	tx := sel.Tx()
+package coinselect
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/christsim/bips/bip-0158/backend/chainhash"
+	"github.com/christsim/bips/bip-0158/backend/wire"
+	"github.com/christsim/bips/bip-0158/rescan"
+)
+
+var (
+	// ErrNoOutputs is returned by Select when it's passed no outputs to
+	// pay.
+	ErrNoOutputs = errors.New("coinselect: no outputs to pay")
+
+	// ErrNoChangeScript is returned by Select when it isn't passed a
+	// script to pay change to.
+	ErrNoChangeScript = errors.New("coinselect: no change script")
+
+	// ErrInsufficientFunds is returned by Select when the coins don't
+	// cover the outputs and the fee.
+	ErrInsufficientFunds = errors.New("coinselect: insufficient funds")
+
+	// ErrUnknownScript is returned by EstimateInputWeight for scripts
+	// whose inputs it can't estimate the weight of.
+	ErrUnknownScript = errors.New("coinselect: can't estimate the " +
+		"weight of spending script")
+
+	// ErrReplacementFeeRate is returned by Select when the fee rate of a
+	// replacement isn't higher than the one of the transaction it
+	// replaces.
+	ErrReplacementFeeRate = errors.New("coinselect: fee rate doesn't " +
+		"exceed that of the replaced transaction")
+)
+
+const (
+	// RBFSequence is the sequence of the inputs of a spend signalling
+	// that it may be replaced, the highest one that does under BIP 125.
+	RBFSequence = wire.MaxTxInSequenceNum - 2
+
+	// DefaultMinChange is the smallest change the knapsack solver aims
+	// for by default, the lower bound of the change Bitcoin Core aims for.
+	DefaultMinChange = 50000
+
+	// DefaultIncrementalFeeRate is the fee rate, in satoshis per 1000
+	// virtual bytes, that the fee of a replacement must exceed the fee of
+	// the replaced transaction by under Bitcoin Core's default policy.
+	DefaultIncrementalFeeRate = 1000
+
+	// DefaultMaxTries is the number of steps the branch-and-bound search
+	// takes by default before giving up, as in Bitcoin Core.
+	DefaultMaxTries = 100000
+
+	// CoinbaseMaturity is the number of confirmations before the outputs
+	// of a coinbase transaction can be spent.
+	CoinbaseMaturity = 100
+)
+
+// Coin is an output a spend can select.
+type Coin struct {
+	OutPoint wire.OutPoint
+	Value    int64
+	PkScript []byte
+
+	// InputWeight is the weight of an input spending the coin once
+	// signed. Zero means the weight EstimateInputWeight gives the
+	// script.
+	InputWeight int
+
+	// Height is the height of the block the coin was created in, zero if
+	// it is unconfirmed.
+	Height uint32
+}
+
+// FromRescan returns the coins of the relevant transactions of a rescan: the
+// outputs paying to scripts of the watch list that none of the transactions
+// spends, ordered as found. The transactions must be in the order the rescan
+// sent them. Coinbase outputs are left out until they mature at a chain of
+// the height.
+func FromRescan(txs []*rescan.RelevantTx, watch *rescan.WatchList,
+	height uint32) []Coin {
+
+	var outPoints []wire.OutPoint
+	coins := make(map[wire.OutPoint]Coin)
+	for _, rtx := range txs {
+		if rtx.Index != 0 {
+			for _, txIn := range rtx.Tx.TxIn {
+				delete(coins, txIn.PreviousOutPoint)
+			}
+		} else if height < rtx.Height+CoinbaseMaturity-1 {
+			continue
+		}
+		var txHash chainhash.Hash
+		for i, txOut := range rtx.Tx.TxOut {
+			if !watch.HasScript(txOut.PkScript) {
+				continue
+			}
+			if txHash == (chainhash.Hash{}) {
+				txHash = rtx.Tx.TxHash()
+			}
+			outPoint := wire.OutPoint{Hash: txHash, Index: uint32(i)}
+			outPoints = append(outPoints, outPoint)
+			coins[outPoint] = Coin{
+				OutPoint: outPoint,
+				Value:    txOut.Value,
+				PkScript: txOut.PkScript,
+				Height:   rtx.Height,
+			}
+		}
+	}
+
+	var unspent []Coin
+	for _, outPoint := range outPoints {
+		if coin, ok := coins[outPoint]; ok {
+			unspent = append(unspent, coin)
+		}
+	}
+	return unspent
+}
+
+// Replacement describes an unconfirmed transaction a spend replaces.
+type Replacement struct {
+	// Inputs are the coins the transaction spends, all of which the
+	// replacement spends again so that it conflicts with it.
+	Inputs []Coin
+
+	// Fee is the fee the transaction pays, along with any of its
+	// descendants the replacement evicts, and VSize its virtual size.
+	Fee   int64
+	VSize int
+}
+
+// Config configures a coin selection.
+type Config struct {
+	// Outputs are the outputs the spend pays.
+	Outputs []*wire.TxOut
+
+	// FeeRate is the fee rate of the spend, in satoshis per 1000 virtual
+	// bytes.
+	FeeRate int64
+
+	// ChangeScript is the script change is paid to.
+	ChangeScript []byte
+
+	// MinChange is the smallest change the knapsack solver aims for.
+	// Zero means DefaultMinChange.
+	MinChange int64
+
+	// Final makes the spend not signal replaceability.
+	Final bool
+
+	// Replaces is the transaction the spend replaces, if any. The spend
+	// then pays at least its fee plus IncrementalFeeRate over its own
+	// virtual size, as rules 3 and 4 of BIP 125 require, and selects no
+	// unconfirmed coins besides its inputs, as rule 2 does.
+	Replaces *Replacement
+
+	// IncrementalFeeRate is the fee rate, in satoshis per 1000 virtual
+	// bytes, a replacement pays for its own size on top of the fee of
+	// the transaction it replaces. Zero means DefaultIncrementalFeeRate.
+	IncrementalFeeRate int64
+
+	// MaxTries bounds the steps of the branch-and-bound search. Zero
+	// means DefaultMaxTries.
+	MaxTries int
+
+	// Rand is the source of randomness of the knapsack solver. Nil means
+	// one seeded with the time.
+	Rand *rand.Rand
+}
+
+// Algorithm identifies the algorithm that selected the coins of a spend.
+type Algorithm uint8
+
+const (
+	// Preselected means the spend needed no coins besides the inputs of
+	// the transaction it replaces.
+	Preselected Algorithm = iota
+
+	// BranchAndBound means the branch-and-bound search found coins paying
+	// the spend without change.
+	BranchAndBound
+
+	// Knapsack means the knapsack solver selected the coins.
+	Knapsack
+)
+
+// String returns the name of the algorithm.
+func (a Algorithm) String() string {
+	switch a {
+	case Preselected:
+		return "preselected"
+	case BranchAndBound:
+		return "bnb"
+	case Knapsack:
+		return "knapsack"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint8(a))
+	}
+}
+
+// Selection is the result of a coin selection: the inputs and outputs of a
+// spend.
+type Selection struct {
+	// Inputs are the coins the spend selected.
+	Inputs []Coin
+
+	// Outputs are the outputs of the spend, those of the config followed
+	// by the change output if there is one.
+	Outputs []*wire.TxOut
+
+	// Change is the value of the change output, zero if there is none.
+	Change int64
+
+	// Fee is the fee the spend pays, and Weight the weight estimated for
+	// it once signed.
+	Fee    int64
+	Weight int
+
+	// Sequence is the sequence of the inputs of the spend, RBFSequence
+	// unless the config made it final.
+	Sequence uint32
+
+	// Algorithm is the algorithm that selected the coins.
+	Algorithm Algorithm
+}
+
+// Tx returns the unsigned transaction of the spend.
+func (s *Selection) Tx() *wire.MsgTx {
+	tx := wire.NewMsgTx(2)
+	for _, coin := range s.Inputs {
+		outPoint := coin.OutPoint
+		txIn := wire.NewTxIn(&outPoint, nil, nil)
+		txIn.Sequence = s.Sequence
+		tx.AddTxIn(txIn)
+	}
+	for _, txOut := range s.Outputs {
+		tx.AddTxOut(wire.NewTxOut(txOut.Value, txOut.PkScript))
+	}
+	return tx
+}
+
+// candidate is a coin along with its weight and effective value.
+type candidate struct {
+	coin   Coin
+	weight int
+	value  int64
+}
+
+// newCandidate returns the candidate of the coin at the fee rate.
+func newCandidate(coin Coin, feeRate int64) (candidate, error) {
+	weight := coin.InputWeight
+	if weight == 0 {
+		var err error
+		weight, err = EstimateInputWeight(coin.PkScript)
+		if err != nil {
+			return candidate{}, fmt.Errorf("%w, coin %v",
+				err, coin.OutPoint)
+		}
+	}
+	return candidate{
+		coin:   coin,
+		weight: weight,
+		value:  coin.Value - Fee(weight, feeRate),
+	}, nil
+}
+
+// Select selects coins paying the outputs of the config at its fee rate,
+// along with change if what's left is worth paying back. Coins whose input
+// costs more than their value are never selected.
+func Select(coins []Coin, cfg *Config) (*Selection, error) {
+	if len(cfg.Outputs) == 0 {
+		return nil, ErrNoOutputs
+	}
+	if len(cfg.ChangeScript) == 0 {
+		return nil, ErrNoChangeScript
+	}
+	c := *cfg
+	if c.MinChange == 0 {
+		c.MinChange = DefaultMinChange
+	}
+	if c.IncrementalFeeRate == 0 {
+		c.IncrementalFeeRate = DefaultIncrementalFeeRate
+	}
+	if c.MaxTries == 0 {
+		c.MaxTries = DefaultMaxTries
+	}
+	if c.Rand == nil {
+		c.Rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+
+	var required []candidate
+	replaced := make(map[wire.OutPoint]struct{})
+	if r := c.Replaces; r != nil {
+		if r.VSize > 0 && c.FeeRate <= r.Fee*1000/int64(r.VSize) {
+			return nil, fmt.Errorf("%w: %d sat/kvB, replacing %d "+
+				"sat/kvB", ErrReplacementFeeRate, c.FeeRate,
+				r.Fee*1000/int64(r.VSize))
+		}
+		for _, coin := range r.Inputs {
+			cand, err := newCandidate(coin, c.FeeRate)
+			if err != nil {
+				return nil, err
+			}
+			required = append(required, cand)
+			replaced[coin.OutPoint] = struct{}{}
+		}
+	}
+	var pool []candidate
+	for _, coin := range coins {
+		if _, ok := replaced[coin.OutPoint]; ok {
+			continue
+		}
+		if c.Replaces != nil && coin.Height == 0 {
+			continue
+		}
+		cand, err := newCandidate(coin, c.FeeRate)
+		if err != nil {
+			return nil, err
+		}
+		if cand.value > 0 {
+			pool = append(pool, cand)
+		}
+	}
+
+	// Larger coins come first, which the branch-and-bound search relies
+	// on, with ties broken by outpoint so that searches are repeatable.
+	sort.SliceStable(pool, func(i, j int) bool {
+		if pool[i].value != pool[j].value {
+			return pool[i].value > pool[j].value
+		}
+		a, b := pool[i].coin.OutPoint, pool[j].coin.OutPoint
+		if cmp := bytes.Compare(a.Hash[:], b.Hash[:]); cmp != 0 {
+			return cmp < 0
+		}
+		return a.Index < b.Index
+	})
+
+	// The fee a replacement must pay depends on its size, which depends
+	// on the coins selected, so the selection is redone with a higher
+	// target until it pays enough.
+	var extra int64
+	for {
+		sel, err := c.selectCoins(required, pool, extra)
+		if err != nil {
+			return nil, err
+		}
+		minFee := c.minFee(sel.Weight)
+		if sel.Fee >= minFee {
+			return sel, nil
+		}
+		extra += minFee - sel.Fee
+	}
+}
+
+// minFee returns the smallest fee a spend of the weight can pay: the fee at
+// the fee rate, or for a replacement the fee of the transaction it replaces
+// plus the incremental fee of its own size if that is more.
+func (c *Config) minFee(weight int) int64 {
+	fee := Fee(weight, c.FeeRate)
+	if r := c.Replaces; r != nil {
+		replaceFee := r.Fee + Fee(weight, c.IncrementalFeeRate)
+		if replaceFee > fee {
+			fee = replaceFee
+		}
+	}
+	return fee
+}
+
+// selectCoins selects coins of the pool besides the required ones, for a
+// target raised by extra.
+func (c *Config) selectCoins(required, pool []candidate,
+	extra int64) (*Selection, error) {
+
+	var outValue int64
+	for _, txOut := range c.Outputs {
+		outValue += txOut.Value
+	}
+	changeWeight := outputWeight(c.ChangeScript)
+	changeFee := Fee(changeWeight, c.FeeRate)
+	costOfChange := changeFee
+	if weight, err := EstimateInputWeight(c.ChangeScript); err == nil {
+		costOfChange += Fee(weight, c.FeeRate)
+	}
+
+	// The target is what the selected coins must add to the effective
+	// value of the required ones.
+	target := outValue + Fee(txWeight(c.Outputs), c.FeeRate) + extra
+	var available int64
+	for _, cand := range required {
+		target -= cand.value
+	}
+	for _, cand := range pool {
+		available += cand.value
+	}
+
+	var selected []candidate
+	algorithm := Preselected
+	changeless := false
+	switch {
+	case target <= 0:
+		changeless = -target <= costOfChange
+
+	case available < target:
+		return nil, fmt.Errorf("%w: %d to pay after input fees, %d "+
+			"available", ErrInsufficientFunds, target, available)
+
+	default:
+		selected = branchAndBound(pool, target, costOfChange,
+			c.MaxTries)
+		if selected != nil {
+			algorithm = BranchAndBound
+			changeless = true
+			break
+		}
+		// Coins covering the target but not the change output are
+		// all spent without change.
+		selected = knapsack(pool, target+changeFee, c.MinChange,
+			c.Rand)
+		if selected == nil {
+			selected = pool
+		}
+		algorithm = Knapsack
+	}
+
+	sel := &Selection{
+		Outputs:   append([]*wire.TxOut(nil), c.Outputs...),
+		Weight:    txWeight(c.Outputs),
+		Sequence:  RBFSequence,
+		Algorithm: algorithm,
+	}
+	if c.Final {
+		sel.Sequence = wire.MaxTxInSequenceNum
+	}
+	var inValue, excess int64
+	excess = -target
+	for _, cand := range append(required, selected...) {
+		sel.Inputs = append(sel.Inputs, cand.coin)
+		sel.Weight += cand.weight
+		inValue += cand.coin.Value
+	}
+	for _, cand := range selected {
+		excess += cand.value
+	}
+
+	change := excess - changeFee
+	if !changeless && change >= DustThreshold(c.ChangeScript) {
+		sel.Outputs = append(sel.Outputs,
+			wire.NewTxOut(change, c.ChangeScript))
+		sel.Change = change
+		sel.Weight += changeWeight
+	}
+	sel.Fee = inValue - outValue - sel.Change
+	return sel, nil
+}
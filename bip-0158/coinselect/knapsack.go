@@ -0,0 +1,128 @@
+package coinselect
+
+import (
+	"math/rand"
+	"sort"
+)
+
+// knapsackIterations is the number of random subsets approximateBestSubset
+// draws, as in Bitcoin Core.
+const knapsackIterations = 1000
+
+// knapsack selects coins of the pool whose effective values add up to the
+// target, following Bitcoin Core's knapsack solver. A coin worth the target
+// exactly is taken alone. Otherwise the coins worth less than the target
+// plus minChange are combined, aiming for the target exactly or else for a
+// change of at least minChange, and the smallest coin worth more is taken
+// instead when it comes closer. It returns nil if the coins don't reach the
+// target.
+func knapsack(pool []candidate, target, minChange int64,
+	rng *rand.Rand) []candidate {
+
+	shuffled := append([]candidate(nil), pool...)
+	rng.Shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+
+	var (
+		lower        []candidate
+		totalLower   int64
+		lowestLarger *candidate
+	)
+	for i, cand := range shuffled {
+		switch {
+		case cand.value == target:
+			return []candidate{cand}
+
+		case cand.value < target+minChange:
+			lower = append(lower, cand)
+			totalLower += cand.value
+
+		case lowestLarger == nil || cand.value < lowestLarger.value:
+			lowestLarger = &shuffled[i]
+		}
+	}
+
+	if totalLower == target {
+		return lower
+	}
+	if totalLower < target {
+		if lowestLarger == nil {
+			return nil
+		}
+		return []candidate{*lowestLarger}
+	}
+
+	sort.SliceStable(lower, func(i, j int) bool {
+		return lower[i].value > lower[j].value
+	})
+	included, best := approximateBestSubset(lower, totalLower, target,
+		rng)
+	if best != target && totalLower >= target+minChange {
+		included, best = approximateBestSubset(lower, totalLower,
+			target+minChange, rng)
+	}
+
+	// The larger coin is taken if the subsets neither pay the target
+	// exactly nor leave enough change, or if it is worth less than them.
+	if lowestLarger != nil && (best != target && best < target+minChange ||
+		lowestLarger.value <= best) {
+
+		return []candidate{*lowestLarger}
+	}
+	var selected []candidate
+	for i, ok := range included {
+		if ok {
+			selected = append(selected, lower[i])
+		}
+	}
+	return selected
+}
+
+// approximateBestSubset draws random subsets of the coins, whose effective
+// values add up to total, and returns the one adding up to the least at or
+// above the target along with its value. Each draw includes each coin with
+// even odds, then goes through the coins left out in a second pass if it
+// falls short, and leaves out again any coin that takes it past the target.
+func approximateBestSubset(coins []candidate, total, target int64,
+	rng *rand.Rand) ([]bool, int64) {
+
+	best := make([]bool, len(coins))
+	for i := range best {
+		best[i] = true
+	}
+	bestValue := total
+
+	included := make([]bool, len(coins))
+	for rep := 0; rep < knapsackIterations && bestValue != target; rep++ {
+		for i := range included {
+			included[i] = false
+		}
+		var value int64
+		reached := false
+		for pass := 0; pass < 2 && !reached; pass++ {
+			for i, cand := range coins {
+				// The first pass includes coins at random, the
+				// second those the first left out.
+				if pass == 0 && rng.Intn(2) == 0 ||
+					pass == 1 && included[i] {
+
+					continue
+				}
+				value += cand.value
+				included[i] = true
+				if value < target {
+					continue
+				}
+				reached = true
+				if value < bestValue {
+					bestValue = value
+					copy(best, included)
+				}
+				value -= cand.value
+				included[i] = false
+			}
+		}
+	}
+	return best, bestValue
+}
@@ -0,0 +1,111 @@
+package coinselect
+
+import (
+	"fmt"
+
+	"github.com/christsim/bips/bip-0158/backend/wire"
+	"github.com/christsim/bips/bip-0158/script"
+)
+
+const (
+	// witnessScaleFactor is the weight of a byte outside the witness.
+	witnessScaleFactor = 4
+
+	// witnessHeaderSize is the weight of the marker and flag bytes of a
+	// transaction with witnesses, which every spend is assumed to be.
+	witnessHeaderSize = 2
+
+	// inputBaseSize is the size of an input without its signature script:
+	// the outpoint it spends and its sequence.
+	inputBaseSize = 32 + 4 + 4
+
+	// maxSigSize is the size of the largest DER signature along with its
+	// sighash type, which ECDSA inputs are estimated with.
+	maxSigSize = 73
+
+	// schnorrSigSize is the size of a BIP 340 signature with the default
+	// sighash type, which taproot key path spends are estimated with.
+	schnorrSigSize = 64
+
+	// pubKeySize is the size of a compressed public key.
+	pubKeySize = 33
+
+	// dustSpendSize is the size of the signature and public key Bitcoin
+	// Core assumes spend an output when it computes its dust threshold.
+	dustSpendSize = 107
+)
+
+// EstimateInputWeight returns the largest weight of an input spending an
+// output of the script once signed, for the scripts spent with a single
+// signature of a known size: P2PK, P2PKH, P2WPKH and taproot key path
+// spends. Inputs of other scripts depend on what they redeem, which their
+// coins have to give themselves.
+func EstimateInputWeight(pkScript []byte) (int, error) {
+	switch class := script.Classify(pkScript); class {
+	case script.PubKey:
+		return inputWeight(1+maxSigSize, 0), nil
+
+	case script.PubKeyHash:
+		return inputWeight(1+maxSigSize+1+pubKeySize, 0), nil
+
+	case script.WitnessV0KeyHash:
+		return inputWeight(0, 1+1+maxSigSize+1+pubKeySize), nil
+
+	case script.Taproot:
+		return inputWeight(0, 1+1+schnorrSigSize), nil
+
+	default:
+		return 0, fmt.Errorf("%w: %v", ErrUnknownScript, class)
+	}
+}
+
+// inputWeight returns the weight of an input with a signature script and a
+// witness of the sizes. Inputs without a witness still take the byte of an
+// empty one, as the transaction has witnesses.
+func inputWeight(sigScriptSize, witnessSize int) int {
+	if witnessSize == 0 {
+		witnessSize = 1
+	}
+	size := inputBaseSize + wire.VarIntSerializeSize(uint64(sigScriptSize)) +
+		sigScriptSize
+	return size*witnessScaleFactor + witnessSize
+}
+
+// outputWeight returns the weight of an output paying to the script.
+func outputWeight(pkScript []byte) int {
+	size := 8 + wire.VarIntSerializeSize(uint64(len(pkScript))) +
+		len(pkScript)
+	return size * witnessScaleFactor
+}
+
+// txWeight returns the weight of a transaction with the outputs and no
+// inputs, with the witness header and the input count of a single byte.
+func txWeight(outputs []*wire.TxOut) int {
+	size := 4 + 1 + wire.VarIntSerializeSize(uint64(len(outputs))) + 4
+	weight := size*witnessScaleFactor + witnessHeaderSize
+	for _, txOut := range outputs {
+		weight += outputWeight(txOut.PkScript)
+	}
+	return weight
+}
+
+// Fee returns the fee at the fee rate, in satoshis per 1000 virtual bytes, of
+// the weight, its virtual size rounded up as Bitcoin Core does.
+func Fee(weight int, feeRate int64) int64 {
+	vsize := int64(weight+witnessScaleFactor-1) / witnessScaleFactor
+	return (vsize*feeRate + 999) / 1000
+}
+
+// DustThreshold returns the smallest value of an output paying to the script
+// that Bitcoin Core relays, three times the fee at 1 satoshi per virtual byte
+// of the output and of an input spending it.
+func DustThreshold(pkScript []byte) int64 {
+	size := 8 + wire.VarIntSerializeSize(uint64(len(pkScript))) +
+		len(pkScript)
+	if _, _, ok := script.WitnessProgram(pkScript); ok {
+		size += inputBaseSize + 1 + dustSpendSize/witnessScaleFactor
+	} else {
+		size += inputBaseSize + 1 + dustSpendSize
+	}
+	return int64(size) * 3
+}
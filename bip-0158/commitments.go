@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	segwit "github.com/christsim/bips/bip-0141"
+	"github.com/christsim/bips/bip-0158/backend/wire"
+)
+
+// blockVectorFile matches the names of the vector files holding blocks, as
+// opposed to their -invalid and -match companions.
+var blockVectorFile = regexp.MustCompile(`^(testnet|regtest)-\d\d\.json$`)
+
+// runCommitments implements the commitments subcommand, which checks the
+// BIP 141 witness commitment of each block of the vector files with the
+// segwit package, and reports the blocks whose commitment is absent or
+// malformed. Files are passed as arguments, with directories standing for
+// the testnet-XX.json and regtest-XX.json files in them. A block with
+// witnesses but no commitment is malformed, while one without either is
+// only reported, unless -require is passed.
+func runCommitments(args []string) error {
+	fs := flag.NewFlagSet("commitments", flag.ContinueOnError)
+	require := fs.Bool("require", false, "treat blocks without a witness "+
+		"commitment as malformed")
+	verbose := fs.Bool("v", false, "also print the blocks whose "+
+		"commitment is valid")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var paths []string
+	for _, arg := range fs.Args() {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			paths = append(paths, arg)
+			continue
+		}
+		entries, err := os.ReadDir(arg)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if blockVectorFile.MatchString(entry.Name()) {
+				paths = append(paths,
+					filepath.Join(arg, entry.Name()))
+			}
+		}
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("no vector files to check")
+	}
+
+	seen := make(map[string]bool)
+	var valid, absent, malformed int
+	for _, path := range paths {
+		blocks, err := readVectorBlocks(path)
+		if err != nil {
+			return fmt.Errorf("%v: %v", path, err)
+		}
+		for _, b := range blocks {
+			if seen[b.hash] {
+				continue
+			}
+			seen[b.hash] = true
+
+			present, err := checkCommitment(b.block)
+			switch {
+			case err != nil:
+				fmt.Printf("%v: block %d %v: malformed: %v\n",
+					path, b.height, b.hash, err)
+				malformed++
+			case !present && *require:
+				fmt.Printf("%v: block %d %v: malformed: no "+
+					"witness commitment\n", path, b.height,
+					b.hash)
+				malformed++
+			case !present:
+				fmt.Printf("%v: block %d %v: absent\n", path,
+					b.height, b.hash)
+				absent++
+			default:
+				if *verbose {
+					fmt.Printf("%v: block %d %v: valid\n",
+						path, b.height, b.hash)
+				}
+				valid++
+			}
+		}
+	}
+
+	fmt.Printf("%d blocks: %d valid, %d absent, %d malformed\n",
+		len(seen), valid, absent, malformed)
+	if malformed != 0 {
+		return fmt.Errorf("%d blocks have a malformed witness "+
+			"commitment", malformed)
+	}
+	return nil
+}
+
+// vectorBlock is a block of a vector file.
+type vectorBlock struct {
+	height int
+	hash   string
+	block  []byte
+}
+
+// readVectorBlocks reads the height, hash and block of each row of a vector
+// file, locating their columns from the header row.
+func readVectorBlocks(path string) ([]vectorBlock, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rows [][]json.RawMessage
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 || len(rows[0]) != 1 {
+		return nil, fmt.Errorf("no header row")
+	}
+	var header string
+	if err := json.Unmarshal(rows[0][0], &header); err != nil {
+		return nil, fmt.Errorf("no header row")
+	}
+
+	columns := map[string]int{}
+	for i, name := range strings.Split(header, ",") {
+		columns[name] = i
+	}
+	for _, name := range []string{"Block Height", "Block Hash", "Block"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("no %v column", name)
+		}
+	}
+
+	var blocks []vectorBlock
+	for i, row := range rows[1:] {
+		if len(row) == 1 {
+			continue
+		}
+		if len(row) <= columns["Block"] ||
+			len(row) <= columns["Block Hash"] ||
+			len(row) <= columns["Block Height"] {
+
+			return nil, fmt.Errorf("row %d: too few columns", i+1)
+		}
+
+		var b vectorBlock
+		var blockHex string
+		height := row[columns["Block Height"]]
+		hash := row[columns["Block Hash"]]
+		err := json.Unmarshal(height, &b.height)
+		if err == nil {
+			err = json.Unmarshal(hash, &b.hash)
+		}
+		if err == nil {
+			err = json.Unmarshal(row[columns["Block"]], &blockHex)
+		}
+		if err == nil {
+			b.block, err = hex.DecodeString(blockHex)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %v", i+1, err)
+		}
+		blocks = append(blocks, b)
+	}
+	return blocks, nil
+}
+
+// checkCommitment checks the witness commitment of the serialized block
+// with segwit.CheckCommitment, and reports whether it has one.
+func checkCommitment(rawBlock []byte) (bool, error) {
+	var block wire.MsgBlock
+	if err := block.Deserialize(bytes.NewReader(rawBlock)); err != nil {
+		return false, err
+	}
+	if len(block.Transactions) == 0 ||
+		len(block.Transactions[0].TxIn) == 0 {
+
+		return false, segwit.ErrNoCoinbase
+	}
+
+	wtxids := make([][segwit.HashSize]byte, len(block.Transactions))
+	hasWitness := false
+	for i, tx := range block.Transactions {
+		wtxids[i] = tx.WitnessHash()
+		hasWitness = hasWitness || tx.HasWitness()
+	}
+	coinbase := block.Transactions[0]
+	pkScripts := make([][]byte, len(coinbase.TxOut))
+	for i, txOut := range coinbase.TxOut {
+		pkScripts[i] = txOut.PkScript
+	}
+
+	present := segwit.CommitmentIndex(pkScripts) >= 0
+	err := segwit.CheckCommitment(wtxids, pkScripts,
+		coinbase.TxIn[0].Witness, hasWitness)
+	return present, err
+}
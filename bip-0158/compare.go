@@ -0,0 +1,342 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	btcdwire "github.com/btcsuite/btcd/wire"
+	bloom "github.com/christsim/bips/bip-0037"
+	"github.com/christsim/bips/bip-0158/backend/wire"
+	"github.com/christsim/bips/bip-0158/gcs"
+	"github.com/christsim/bips/bip-0158/gcs/builder"
+)
+
+// bloomFlags maps the values of -flags to the update flags of the BIP 37
+// filter.
+var bloomFlags = map[string]btcdwire.BloomUpdateType{
+	"none":     btcdwire.BloomUpdateNone,
+	"all":      btcdwire.BloomUpdateAll,
+	"p2pubkey": btcdwire.BloomUpdateP2PubkeyOnly,
+}
+
+// compareStats accumulates what a wallet following a range of blocks
+// downloads under one scheme: a BIP 37 filter loaded into the serving node,
+// or the BIP 158 filters of a policy. None of the wallet's scripts are in
+// the blocks, so every match is a false positive.
+type compareStats struct {
+	Scheme       string `json:"scheme"`
+	Blocks       int    `json:"blocks"`
+	Transactions uint64 `json:"transactions"`
+
+	// FilterBytes is the size of the filterload message the wallet sends
+	// for BIP 37, and of the filters it fetches for BIP 158.
+	FilterBytes uint64 `json:"filter_bytes"`
+
+	// ProofBytes is the size of the merkleblocks of BIP 37, and
+	// BlockBytes that of the transactions BIP 37 relays and of the
+	// blocks BIP 158 matches.
+	ProofBytes uint64 `json:"proof_bytes"`
+	BlockBytes uint64 `json:"block_bytes"`
+
+	// DownloadBytes is the total the wallet receives.
+	DownloadBytes uint64 `json:"download_bytes"`
+
+	MatchedBlocks int     `json:"matched_blocks"`
+	MatchedTxs    uint64  `json:"matched_txs"`
+	FPBlockRate   float64 `json:"fp_block_rate"`
+	FPTxRate      float64 `json:"fp_tx_rate"`
+}
+
+// compareHeader is the header row of the CSV report, in the same order as
+// the columns written by csvRow.
+var compareHeader = []string{
+	"scheme", "blocks", "transactions", "filter_bytes", "proof_bytes",
+	"block_bytes", "download_bytes", "matched_blocks", "matched_txs",
+	"fp_block_rate", "fp_tx_rate",
+}
+
+// csvRow returns the statistics formatted as a row of the CSV report.
+func (s *compareStats) csvRow() []string {
+	return []string{
+		s.Scheme,
+		strconv.Itoa(s.Blocks),
+		strconv.FormatUint(s.Transactions, 10),
+		strconv.FormatUint(s.FilterBytes, 10),
+		strconv.FormatUint(s.ProofBytes, 10),
+		strconv.FormatUint(s.BlockBytes, 10),
+		strconv.FormatUint(s.DownloadBytes, 10),
+		strconv.Itoa(s.MatchedBlocks),
+		strconv.FormatUint(s.MatchedTxs, 10),
+		strconv.FormatFloat(s.FPBlockRate, 'g', 6, 64),
+		strconv.FormatFloat(s.FPTxRate, 'g', 6, 64),
+	}
+}
+
+// finalize computes the totals and rates once all blocks have been added.
+func (s *compareStats) finalize() {
+	s.DownloadBytes = s.ProofBytes + s.BlockBytes
+	if s.Scheme != "bip37" {
+		s.DownloadBytes += s.FilterBytes
+	}
+	if s.Blocks > 0 {
+		s.FPBlockRate = float64(s.MatchedBlocks) / float64(s.Blocks)
+	}
+	if s.Transactions > 0 {
+		s.FPTxRate = float64(s.MatchedTxs) / float64(s.Transactions)
+	}
+}
+
+// runCompare implements the compare subcommand, which follows a range of
+// blocks as a wallet of random scripts would under BIP 37 and under BIP 158,
+// and reports the size of the filters, what the wallet downloads and the
+// rates of false positives of each scheme. The blocks are read from the
+// vector files passed as arguments, or fetched from the node by height.
+func runCompare(args []string) error {
+	fs := flag.NewFlagSet("compare", flag.ContinueOnError)
+	start := fs.Int64("start", 0, "first block height to include")
+	end := fs.Int64("end", 100, "last block height to include")
+	walletSize := fs.Int("wallet", 100, "number of scripts in the wallet")
+	fpRate := fs.Float64("fprate", 0.0001, "false positive rate of the "+
+		"BIP 37 filter")
+	flagsName := fs.String("flags", "p2pubkey", "update flags of the BIP "+
+		"37 filter: none, all or p2pubkey")
+	seed := fs.Int64("seed", 1, "seed for the wallet's scripts and the "+
+		"filter's tweak")
+	format := fs.String("format", "csv", "output format: csv or json")
+	out := fs.String("out", "", "file to write the report to (default "+
+		"stdout)")
+	policyList := fs.String("policies", "basic", "comma separated list "+
+		"of BIP 158 filter policies to compare")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	flags, ok := bloomFlags[*flagsName]
+	if !ok {
+		return fmt.Errorf("unknown update flags %q", *flagsName)
+	}
+	if *start > *end {
+		return fmt.Errorf("invalid block range %d-%d", *start, *end)
+	}
+	if *format != "csv" && *format != "json" {
+		return fmt.Errorf("unknown format %q", *format)
+	}
+	policies, err := parsePolicies(*policyList, builder.AllScriptTypes, nil)
+	if err != nil {
+		return err
+	}
+
+	// BIP 37 matches the data the scripts push, the 20 byte hashes of
+	// the random P2WPKH-style scripts of the wallet.
+	wallet := randomScriptCorpus(*walletSize, *seed)
+	filter := bloom.NewFilter(len(wallet), *fpRate, uint32(*seed), flags)
+	for _, script := range wallet {
+		filter.Add(script[2:])
+	}
+	var filterLoad bytes.Buffer
+	err = filter.MsgFilterLoad().BtcEncode(&filterLoad,
+		btcdwire.BIP0037Version, btcdwire.BaseEncoding)
+	if err != nil {
+		return err
+	}
+
+	report := []*compareStats{{
+		Scheme:      "bip37",
+		FilterBytes: uint64(filterLoad.Len()),
+	}}
+	for _, policy := range policies {
+		report = append(report, &compareStats{
+			Scheme: "bip158-" + policy.Name(),
+		})
+	}
+	matcher := gcs.NewMatcher(0)
+
+	add := func(block *wire.MsgBlock) error {
+		return addCompareStats(block, filter, policies, report, wallet,
+			matcher)
+	}
+	if fs.NArg() > 0 {
+		err = compareVectorBlocks(fs.Args(), add)
+	} else {
+		err = compareChainBlocks(*start, *end, add)
+	}
+	if err != nil {
+		return err
+	}
+	for _, s := range report {
+		s.finalize()
+	}
+
+	w := io.Writer(os.Stdout)
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+
+	return writeCompareReport(w, *format, report)
+}
+
+// compareVectorBlocks passes each block of the vector files to add.
+func compareVectorBlocks(paths []string,
+	add func(*wire.MsgBlock) error) error {
+
+	for _, path := range paths {
+		blocks, err := readVectorBlocks(path)
+		if err != nil {
+			return fmt.Errorf("%v: %v", path, err)
+		}
+		for _, b := range blocks {
+			block := &wire.MsgBlock{}
+			err := block.Deserialize(bytes.NewReader(b.block))
+			if err != nil {
+				return fmt.Errorf("%v: block %d: %v", path,
+					b.height, err)
+			}
+			if err := add(block); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// compareChainBlocks fetches each block of the range from the node and
+// passes it to add.
+func compareChainBlocks(start, end int64,
+	add func(*wire.MsgBlock) error) error {
+
+	client, err := newRPCClient()
+	if err != nil {
+		return err
+	}
+	defer client.Shutdown()
+
+	for height := start; height <= end; height++ {
+		fmt.Fprintf(os.Stderr, "Height: %d\n", height)
+		blockHash, err := client.GetBlockHash(height)
+		if err != nil {
+			return fmt.Errorf("couldn't get block hash: %v", err)
+		}
+		block, err := client.GetBlock(blockHash)
+		if err != nil {
+			return fmt.Errorf("couldn't get block: %v", err)
+		}
+		if err := add(block); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addCompareStats folds the block into the statistics of each scheme:
+// report[0] holds those of the BIP 37 filter, and report[j+1] those of
+// policies[j].
+func addCompareStats(block *wire.MsgBlock, filter *bloom.Filter,
+	policies []builder.FilterPolicy, report []*compareStats,
+	wallet [][]byte, m *gcs.Matcher) error {
+
+	// The bloom package uses the wire types of upstream btcd whichever
+	// backend is selected, so the block is converted by serializing it.
+	var raw bytes.Buffer
+	if err := block.Serialize(&raw); err != nil {
+		return err
+	}
+	bloomBlock := &btcdwire.MsgBlock{}
+	err := bloomBlock.Deserialize(bytes.NewReader(raw.Bytes()))
+	if err != nil {
+		return err
+	}
+
+	for _, s := range report {
+		s.Blocks++
+		s.Transactions += uint64(len(block.Transactions))
+	}
+
+	// The node relays the matched transactions after the merkleblock,
+	// without their witnesses, which a wallet can't check against the
+	// merkleblock anyway.
+	s := report[0]
+	msg, matched := bloom.NewMerkleBlock(bloomBlock, filter)
+	var proof bytes.Buffer
+	err = msg.BtcEncode(&proof, btcdwire.BIP0037Version,
+		btcdwire.BaseEncoding)
+	if err != nil {
+		return err
+	}
+	s.ProofBytes += uint64(proof.Len())
+	for _, index := range matched {
+		tx := bloomBlock.Transactions[index]
+		s.BlockBytes += uint64(tx.SerializeSizeStripped())
+	}
+	if len(matched) > 0 {
+		s.MatchedBlocks++
+		s.MatchedTxs += uint64(len(matched))
+	}
+
+	blockHash := block.BlockHash()
+	key := builder.DeriveKey(&blockHash)
+	elements := builder.ExtractElements(block)
+	for j, policy := range policies {
+		s := report[j+1]
+		filters, err := builder.BuildElementFilters(policy, elements,
+			[]uint8{builder.DefaultP})
+		if err != nil {
+			return fmt.Errorf("error generating %v filter: %v",
+				policy.Name(), err)
+		}
+		nBytes, err := filters[0].NBytes()
+		if err != nil {
+			return err
+		}
+		s.FilterBytes += uint64(len(nBytes))
+
+		// Empty filters can't be queried, and match nothing.
+		if filters[0].N() == 0 {
+			continue
+		}
+		match, err := m.MatchAny(filters[0], key, wallet)
+		if err != nil {
+			return err
+		}
+		if match {
+			s.MatchedBlocks++
+			s.MatchedTxs += uint64(len(block.Transactions))
+			s.BlockBytes += uint64(raw.Len())
+		}
+	}
+
+	return nil
+}
+
+// writeCompareReport writes the report to w in the requested format.
+func writeCompareReport(w io.Writer, format string,
+	report []*compareStats) error {
+
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(compareHeader); err != nil {
+		return err
+	}
+	for _, s := range report {
+		if err := cw.Write(s.csvRow()); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+
+	return cw.Error()
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/christsim/bips/bip-0158/conformance"
+	"github.com/christsim/bips/bip-0158/gcs/builder"
+)
+
+// commandList collects the values of a flag that may be repeated.
+type commandList []string
+
+func (l *commandList) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *commandList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// runConformance implements the conformance subcommand, which checks external
+// implementations against previously generated vectors and reports a
+// compatibility matrix. It fails if any implementation failed a check.
+func runConformance(args []string) error {
+	fs := flag.NewFlagSet("conformance", flag.ContinueOnError)
+	vectorsDir := fs.String("vectors", "gcstestvectors", "directory of test "+
+		"vectors to check against")
+	btcd := fs.Bool("btcd", false, "check the local btcd over RPC")
+	bitcoindURL := fs.String("bitcoind", "", "URL of a Bitcoin Core RPC "+
+		"server to check, e.g. http://127.0.0.1:18332")
+	bitcoindUser := fs.String("bitcoind-user", "", "Bitcoin Core RPC user")
+	bitcoindPass := fs.String("bitcoind-pass", "", "Bitcoin Core RPC "+
+		"password")
+	var commands commandList
+	fs.Var(&commands, "exec", "command line of an implementation speaking "+
+		"the conformance stdin/stdout protocol; may be repeated")
+	format := fs.String("format", "text", "output format: text or json")
+	out := fs.String("out", "", "file to write the report to (default "+
+		"stdout)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *format != "text" && *format != "json" {
+		return fmt.Errorf("unknown format %q", *format)
+	}
+
+	cases, err := conformance.LoadVectors(*vectorsDir)
+	if err != nil {
+		return err
+	}
+
+	var adapters []conformance.Adapter
+	if *btcd {
+		client, err := newRPCClient()
+		if err != nil {
+			return err
+		}
+		defer client.Shutdown()
+		adapters = append(adapters,
+			conformance.NewBtcdAdapter(client, builder.DefaultP))
+	}
+	if *bitcoindURL != "" {
+		adapters = append(adapters, conformance.NewBitcoindAdapter(
+			*bitcoindURL, *bitcoindUser, *bitcoindPass))
+	}
+	for _, command := range commands {
+		fields := strings.Fields(command)
+		if len(fields) == 0 {
+			continue
+		}
+		process, err := conformance.StartProcess(command, fields[0],
+			fields[1:]...)
+		if err != nil {
+			return fmt.Errorf("couldn't start %q: %v", command, err)
+		}
+		defer process.Close()
+		adapters = append(adapters, process)
+	}
+	if len(adapters) == 0 {
+		return fmt.Errorf("no implementations selected, pass -btcd, " +
+			"-bitcoind or -exec")
+	}
+
+	report := conformance.Run(adapters, cases)
+
+	w := io.Writer(os.Stdout)
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+	if *format == "json" {
+		err = report.WriteJSON(w)
+	} else {
+		err = report.WriteText(w)
+	}
+	if err != nil {
+		return err
+	}
+
+	if !report.Passed() {
+		return fmt.Errorf("%d checks failed", len(report.Failures))
+	}
+	return nil
+}
@@ -0,0 +1,375 @@
+package conformance
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"sync"
+
+	"github.com/christsim/bips/bip-0158/backend/chainhash"
+	"github.com/christsim/bips/bip-0158/backend/wire"
+)
+
+// ErrUnsupported is returned by an adapter for filter types or values of P
+// its implementation doesn't provide. Such checks are reported as skipped
+// rather than failed.
+var ErrUnsupported = errors.New("not supported by implementation")
+
+// Adapter drives an external implementation.
+type Adapter interface {
+	// Name identifies the implementation in reports.
+	Name() string
+
+	// Filter returns the implementation's serialized filter, including N,
+	// for the filter type and block of the case.
+	Filter(c *Case, f *FilterCase) ([]byte, error)
+
+	// Header returns the implementation's filter header for the filter
+	// type and block of the case.
+	Header(c *Case, f *FilterCase) (*chainhash.Hash, error)
+}
+
+// cfilterClient is the part of the btcd RPC client used to fetch filters.
+type cfilterClient interface {
+	GetCFilter(blockHash *chainhash.Hash,
+		filterType wire.FilterType) (*wire.MsgCFilter, error)
+	GetCFilterHeader(blockHash *chainhash.Hash,
+		filterType wire.FilterType) (*wire.MsgCFHeaders, error)
+}
+
+// BtcdAdapter fetches filters from a btcd node with cfilter support over RPC.
+// The node must be synced to the chain the vectors were generated from, and
+// only serves the basic and extended filters at the default P.
+type BtcdAdapter struct {
+	client cfilterClient
+	p      uint8
+}
+
+// NewBtcdAdapter returns an adapter for the btcd node behind the passed RPC
+// client, which builds its filters with the passed P. backend.ChainClient
+// satisfies the interface.
+func NewBtcdAdapter(client cfilterClient, p uint8) *BtcdAdapter {
+	return &BtcdAdapter{client: client, p: p}
+}
+
+// Name returns "btcd".
+func (a *BtcdAdapter) Name() string {
+	return "btcd"
+}
+
+// filterType returns the btcd filter type of the case, or ErrUnsupported.
+func (a *BtcdAdapter) filterType(c *Case, f *FilterCase) (wire.FilterType,
+	error) {
+
+	if c.P != a.p {
+		return 0, ErrUnsupported
+	}
+	switch f.Type {
+	case "basic":
+		return wire.GCSFilterRegular, nil
+	case "extended":
+		return wire.GCSFilterExtended, nil
+	default:
+		return 0, ErrUnsupported
+	}
+}
+
+// Filter fetches the filter with getcfilter.
+func (a *BtcdAdapter) Filter(c *Case, f *FilterCase) ([]byte, error) {
+	filterType, err := a.filterType(c, f)
+	if err != nil {
+		return nil, err
+	}
+	msg, err := a.client.GetCFilter(&c.BlockHash, filterType)
+	if err != nil {
+		return nil, err
+	}
+	return msg.Data, nil
+}
+
+// Header fetches the header with getcfilterheader, which btcd returns in the
+// message's previous header field.
+func (a *BtcdAdapter) Header(c *Case, f *FilterCase) (*chainhash.Hash, error) {
+	filterType, err := a.filterType(c, f)
+	if err != nil {
+		return nil, err
+	}
+	msg, err := a.client.GetCFilterHeader(&c.BlockHash, filterType)
+	if err != nil {
+		return nil, err
+	}
+	header := msg.PrevFilterHeader
+	return &header, nil
+}
+
+// BitcoindAdapter fetches filters from a Bitcoin Core node with
+// -blockfilterindex over JSON-RPC. Core only builds the basic filter as
+// finally specified, which corresponds to the spec-basic policy, at P = 19.
+// Core also uses M = 784931 rather than 2^P, so its filters are expected to
+// differ from vectors built with M = 2^P; the matrix shows where they do.
+type BitcoindAdapter struct {
+	url  string
+	user string
+	pass string
+
+	client *http.Client
+	id     int
+}
+
+// NewBitcoindAdapter returns an adapter for the Bitcoin Core node whose RPC
+// server listens at the passed URL, such as http://127.0.0.1:18332.
+func NewBitcoindAdapter(url, user, pass string) *BitcoindAdapter {
+	return &BitcoindAdapter{
+		url:    url,
+		user:   user,
+		pass:   pass,
+		client: &http.Client{},
+	}
+}
+
+// Name returns "bitcoind".
+func (a *BitcoindAdapter) Name() string {
+	return "bitcoind"
+}
+
+// blockFilter calls getblockfilter for the block of the case.
+func (a *BitcoindAdapter) blockFilter(c *Case, f *FilterCase) ([]byte,
+	*chainhash.Hash, error) {
+
+	if f.Type != "spec-basic" || c.P != 19 {
+		return nil, nil, ErrUnsupported
+	}
+
+	a.id++
+	req, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "1.0",
+		"id":      a.id,
+		"method":  "getblockfilter",
+		"params":  []string{c.BlockHash.String(), "basic"},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	httpReq, err := http.NewRequest("POST", a.url, bytes.NewReader(req))
+	if err != nil {
+		return nil, nil, err
+	}
+	httpReq.SetBasicAuth(a.user, a.pass)
+	httpReq.Header.Set("Content-Type", "application/json")
+	resp, err := a.client.Do(httpReq)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	var reply struct {
+		Result *struct {
+			Filter string `json:"filter"`
+			Header string `json:"header"`
+		} `json:"result"`
+		Error *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		return nil, nil, fmt.Errorf("bad reply (HTTP %v): %v",
+			resp.Status, err)
+	}
+	if reply.Error != nil {
+		return nil, nil, fmt.Errorf("RPC error %d: %v",
+			reply.Error.Code, reply.Error.Message)
+	}
+	if reply.Result == nil {
+		return nil, nil, fmt.Errorf("empty reply")
+	}
+
+	filter, err := hex.DecodeString(reply.Result.Filter)
+	if err != nil {
+		return nil, nil, err
+	}
+	header, err := chainhash.NewHashFromStr(reply.Result.Header)
+	if err != nil {
+		return nil, nil, err
+	}
+	return filter, header, nil
+}
+
+// Filter fetches the filter with getblockfilter.
+func (a *BitcoindAdapter) Filter(c *Case, f *FilterCase) ([]byte, error) {
+	filter, _, err := a.blockFilter(c, f)
+	return filter, err
+}
+
+// Header fetches the header with getblockfilter.
+func (a *BitcoindAdapter) Header(c *Case, f *FilterCase) (*chainhash.Hash,
+	error) {
+
+	_, header, err := a.blockFilter(c, f)
+	return header, err
+}
+
+// ProcessAdapter drives an implementation running as a subprocess, which
+// needn't have access to any chain. Requests are written to its standard
+// input and replies read from its standard output, one JSON object per line:
+//
+//	-> {"id":1,"method":"filter","filter_type":"basic","p":20,"block":"<hex>"}
+//	<- {"id":1,"filter":"<hex>"}
+//	-> {"id":2,"method":"header","filter_type":"basic","p":20,
+//	    "filter":"<hex>","prev_header":"<hash>"}
+//	<- {"id":2,"header":"<hash>"}
+//
+// Hashes are in their usual byte-reversed hex form, and filters include N. A
+// reply of {"id":n,"error":"unsupported"} marks the request as unsupported;
+// any other error fails it.
+type ProcessAdapter struct {
+	name string
+	cmd  *exec.Cmd
+
+	mtx    sync.Mutex
+	stdin  io.WriteCloser
+	stdout *bufio.Scanner
+	id     int
+}
+
+// processRequest is a request to a ProcessAdapter's subprocess.
+type processRequest struct {
+	ID         int    `json:"id"`
+	Method     string `json:"method"`
+	FilterType string `json:"filter_type"`
+	P          uint8  `json:"p"`
+	Block      string `json:"block,omitempty"`
+	Filter     string `json:"filter,omitempty"`
+	PrevHeader string `json:"prev_header,omitempty"`
+}
+
+// processReply is a reply from a ProcessAdapter's subprocess.
+type processReply struct {
+	ID     int    `json:"id"`
+	Filter string `json:"filter"`
+	Header string `json:"header"`
+	Error  string `json:"error"`
+}
+
+// maxReplySize bounds the length of a line of the subprocess's output.
+const maxReplySize = 16 << 20
+
+// StartProcess starts the passed command and returns an adapter speaking to
+// it, named after the command unless name is set.
+func StartProcess(name, command string, args ...string) (*ProcessAdapter,
+	error) {
+
+	if name == "" {
+		name = command
+	}
+	cmd := exec.Command(command, args...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), maxReplySize)
+
+	return &ProcessAdapter{
+		name:   name,
+		cmd:    cmd,
+		stdin:  stdin,
+		stdout: scanner,
+	}, nil
+}
+
+// Name returns the name the adapter was started with.
+func (a *ProcessAdapter) Name() string {
+	return a.name
+}
+
+// Close closes the subprocess's standard input and waits for it to exit.
+func (a *ProcessAdapter) Close() error {
+	a.stdin.Close()
+	return a.cmd.Wait()
+}
+
+// call sends a request to the subprocess and waits for its reply.
+func (a *ProcessAdapter) call(req *processRequest) (*processReply, error) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	a.id++
+	req.ID = a.id
+	line, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := a.stdin.Write(append(line, '\n')); err != nil {
+		return nil, err
+	}
+
+	if !a.stdout.Scan() {
+		if err := a.stdout.Err(); err != nil {
+			return nil, err
+		}
+		return nil, io.ErrUnexpectedEOF
+	}
+	var reply processReply
+	if err := json.Unmarshal(a.stdout.Bytes(), &reply); err != nil {
+		return nil, fmt.Errorf("bad reply: %v", err)
+	}
+	if reply.ID != req.ID {
+		return nil, fmt.Errorf("reply to request %d, expected %d",
+			reply.ID, req.ID)
+	}
+	switch reply.Error {
+	case "":
+		return &reply, nil
+	case "unsupported":
+		return nil, ErrUnsupported
+	default:
+		return nil, errors.New(reply.Error)
+	}
+}
+
+// Filter asks the subprocess to build the filter from the block.
+func (a *ProcessAdapter) Filter(c *Case, f *FilterCase) ([]byte, error) {
+	reply, err := a.call(&processRequest{
+		Method:     "filter",
+		FilterType: f.Type,
+		P:          c.P,
+		Block:      hex.EncodeToString(c.Block),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return hex.DecodeString(reply.Filter)
+}
+
+// Header asks the subprocess to compute the header from the expected filter
+// and previous header, so that it's checked independently of the filter.
+func (a *ProcessAdapter) Header(c *Case, f *FilterCase) (*chainhash.Hash,
+	error) {
+
+	reply, err := a.call(&processRequest{
+		Method:     "header",
+		FilterType: f.Type,
+		P:          c.P,
+		Filter:     hex.EncodeToString(f.Filter),
+		PrevHeader: f.PrevHeader.String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return chainhash.NewHashFromStr(reply.Header)
+}
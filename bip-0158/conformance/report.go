@@ -0,0 +1,170 @@
+package conformance
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+// Tally counts the outcomes of one check for one implementation.
+type Tally struct {
+	Passed  int `json:"passed"`
+	Failed  int `json:"failed"`
+	Skipped int `json:"skipped"`
+}
+
+// Failure describes a failed check.
+type Failure struct {
+	Adapter string `json:"adapter"`
+	Check   string `json:"check"`
+	Height  uint32 `json:"height"`
+	P       uint8  `json:"p"`
+	Reason  string `json:"reason"`
+}
+
+// Report is a compatibility matrix of implementations against checks, such
+// as "basic filter" or "extended header".
+type Report struct {
+	Adapters []string `json:"adapters"`
+	Checks   []string `json:"checks"`
+
+	// Matrix holds the tally of each check, by adapter and then check.
+	Matrix map[string]map[string]*Tally `json:"matrix"`
+
+	Failures []Failure `json:"failures"`
+}
+
+// Run checks every filter and header of the cases against each adapter.
+func Run(adapters []Adapter, cases []*Case) *Report {
+	r := &Report{Matrix: make(map[string]map[string]*Tally)}
+	for _, a := range adapters {
+		r.Adapters = append(r.Adapters, a.Name())
+		r.Matrix[a.Name()] = make(map[string]*Tally)
+	}
+
+	for _, c := range cases {
+		for _, f := range c.Filters {
+			for _, a := range adapters {
+				filter, err := a.Filter(c, f)
+				if err == nil && !bytes.Equal(filter, f.Filter) {
+					err = fmt.Errorf("filter is %x, expected %x",
+						filter, f.Filter)
+				}
+				r.record(a, f.Type+" filter", c, err)
+
+				header, err := a.Header(c, f)
+				if err == nil && *header != f.Header {
+					err = fmt.Errorf("header is %v, expected %v",
+						header, f.Header)
+				}
+				r.record(a, f.Type+" header", c, err)
+			}
+		}
+	}
+
+	return r
+}
+
+// record tallies the outcome of a check.
+func (r *Report) record(a Adapter, check string, c *Case, err error) {
+	tallies := r.Matrix[a.Name()]
+	tally, ok := tallies[check]
+	if !ok {
+		tally = &Tally{}
+		tallies[check] = tally
+	}
+	if !r.hasCheck(check) {
+		r.Checks = append(r.Checks, check)
+	}
+
+	switch {
+	case err == nil:
+		tally.Passed++
+	case errors.Is(err, ErrUnsupported):
+		tally.Skipped++
+	default:
+		tally.Failed++
+		r.Failures = append(r.Failures, Failure{
+			Adapter: a.Name(),
+			Check:   check,
+			Height:  c.Height,
+			P:       c.P,
+			Reason:  err.Error(),
+		})
+	}
+}
+
+// hasCheck returns whether the check has been seen before.
+func (r *Report) hasCheck(check string) bool {
+	for _, seen := range r.Checks {
+		if seen == check {
+			return true
+		}
+	}
+	return false
+}
+
+// Passed returns whether no check failed.
+func (r *Report) Passed() bool {
+	return len(r.Failures) == 0
+}
+
+// WriteText writes the matrix as a table, with one row per implementation
+// and one column per check, followed by the failures. Each cell holds the
+// number of passed checks out of those run, or "n/a" if none were.
+func (r *Report) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprint(tw, "implementation")
+	for _, check := range r.Checks {
+		fmt.Fprintf(tw, "\t%v", check)
+	}
+	fmt.Fprintln(tw)
+
+	for _, name := range r.Adapters {
+		fmt.Fprint(tw, name)
+		for _, check := range r.Checks {
+			tally, ok := r.Matrix[name][check]
+			run := 0
+			if ok {
+				run = tally.Passed + tally.Failed
+			}
+			if run == 0 {
+				fmt.Fprint(tw, "\tn/a")
+				continue
+			}
+			mark := "ok"
+			if tally.Failed > 0 {
+				mark = "FAIL"
+			}
+			fmt.Fprintf(tw, "\t%d/%d %v", tally.Passed, run, mark)
+		}
+		fmt.Fprintln(tw)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	for _, f := range r.Failures {
+		_, err := fmt.Fprintf(w, "\n%v: %v at height %d, P = %d: %v",
+			f.Adapter, f.Check, f.Height, f.P, f.Reason)
+		if err != nil {
+			return err
+		}
+	}
+	if len(r.Failures) > 0 {
+		_, err := fmt.Fprintln(w)
+		return err
+	}
+
+	return nil
+}
+
+// WriteJSON writes the report as JSON.
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
@@ -0,0 +1,195 @@
+// Package conformance checks external BIP 158 implementations against the
+// generated test vectors. Each implementation is driven through an Adapter,
+// and Run tallies the results into a compatibility matrix.
+package conformance
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/christsim/bips/bip-0158/backend/chainhash"
+)
+
+// ErrBadVectors is returned when a vector file doesn't have the layout written
+// by the generator.
+var ErrBadVectors = errors.New("malformed test vector file")
+
+// legacyColumns maps the names used in the column headers for the filter
+// types whose vectors predate other policies to the names of the policies.
+var legacyColumns = map[string]string{
+	"Basic": "basic",
+	"Ext":   "extended",
+}
+
+// vectorFile matches the names of the vector files, leaving out the invalid
+// and match files written alongside them.
+var vectorFile = regexp.MustCompile(`^testnet-(\d\d)\.json$`)
+
+// Case is a single row of a vector file: one block at one value of P.
+type Case struct {
+	Height    uint32
+	BlockHash chainhash.Hash
+	Block     []byte
+	P         uint8
+	Filters   []*FilterCase
+	Notes     string
+}
+
+// FilterCase holds the expected filter and header of one filter type for the
+// block of a Case.
+type FilterCase struct {
+	// Type is the name of the filter policy, such as "basic".
+	Type       string
+	PrevHeader chainhash.Hash
+	Filter     []byte
+	Header     chainhash.Hash
+}
+
+// LoadVectors reads every vector file in the passed directory, as written by
+// the generator, ordered by P and then height.
+func LoadVectors(dir string) ([]*Case, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var cases []*Case
+	for _, entry := range entries {
+		m := vectorFile.FindStringSubmatch(entry.Name())
+		if m == nil {
+			continue
+		}
+		p, _ := strconv.Atoi(m[1])
+
+		fileCases, err := loadFile(filepath.Join(dir, entry.Name()),
+			uint8(p))
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", entry.Name(), err)
+		}
+		cases = append(cases, fileCases...)
+	}
+	if len(cases) == 0 {
+		return nil, fmt.Errorf("no test vectors in %v", dir)
+	}
+
+	sort.SliceStable(cases, func(i, j int) bool {
+		if cases[i].P != cases[j].P {
+			return cases[i].P < cases[j].P
+		}
+		return cases[i].Height < cases[j].Height
+	})
+
+	return cases, nil
+}
+
+// loadFile reads the cases of a single vector file. The columns holding each
+// filter type's fields are located from the header row.
+func loadFile(path string, p uint8) ([]*Case, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rows [][]interface{}
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadVectors, err)
+	}
+	if len(rows) == 0 || len(rows[0]) != 1 {
+		return nil, fmt.Errorf("%w: no header row", ErrBadVectors)
+	}
+	header, _ := rows[0][0].(string)
+	columns := strings.Split(header, ",")
+
+	// Every filter type has a previous header, filter and header column.
+	var types []string
+	index := make(map[string]int, len(columns))
+	for i, column := range columns {
+		index[column] = i
+		if name := strings.TrimSuffix(column, " Filter"); name != column {
+			types = append(types, name)
+		}
+	}
+	for _, column := range []string{"Block Height", "Block Hash", "Block"} {
+		if _, ok := index[column]; !ok {
+			return nil, fmt.Errorf("%w: no %q column", ErrBadVectors,
+				column)
+		}
+	}
+	for _, name := range types {
+		for _, column := range []string{"Previous " + name + " Header",
+			name + " Header"} {
+
+			if _, ok := index[column]; !ok {
+				return nil, fmt.Errorf("%w: no %q column",
+					ErrBadVectors, column)
+			}
+		}
+	}
+
+	cases := make([]*Case, 0, len(rows)-1)
+	for _, row := range rows[1:] {
+		if len(row) != len(columns) {
+			return nil, fmt.Errorf("%w: row has %d columns, expected "+
+				"%d", ErrBadVectors, len(row), len(columns))
+		}
+		field := func(column string) string {
+			s, _ := row[index[column]].(string)
+			return s
+		}
+
+		height, ok := row[index["Block Height"]].(float64)
+		if !ok {
+			return nil, fmt.Errorf("%w: bad block height",
+				ErrBadVectors)
+		}
+		c := &Case{Height: uint32(height), P: p}
+		if i, ok := index["Notes"]; ok {
+			c.Notes, _ = row[i].(string)
+		}
+		if err := parseHash(&c.BlockHash, field("Block Hash")); err != nil {
+			return nil, err
+		}
+		if c.Block, err = hex.DecodeString(field("Block")); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrBadVectors, err)
+		}
+
+		for _, name := range types {
+			f := &FilterCase{Type: name}
+			if policy, ok := legacyColumns[name]; ok {
+				f.Type = policy
+			}
+			err := parseHash(&f.PrevHeader,
+				field("Previous "+name+" Header"))
+			if err != nil {
+				return nil, err
+			}
+			f.Filter, err = hex.DecodeString(field(name + " Filter"))
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrBadVectors, err)
+			}
+			err = parseHash(&f.Header, field(name+" Header"))
+			if err != nil {
+				return nil, err
+			}
+			c.Filters = append(c.Filters, f)
+		}
+		cases = append(cases, c)
+	}
+
+	return cases, nil
+}
+
+// parseHash decodes a hash in its usual byte-reversed hex form.
+func parseHash(hash *chainhash.Hash, s string) error {
+	if err := chainhash.Decode(hash, s); err != nil {
+		return fmt.Errorf("%w: %v", ErrBadVectors, err)
+	}
+	return nil
+}
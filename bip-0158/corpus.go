@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+
+	"github.com/christsim/bips/bip-0158/backend/wire"
+	"github.com/christsim/bips/bip-0158/conformance"
+	"github.com/christsim/bips/bip-0158/gcs"
+	"github.com/christsim/bips/bip-0158/gcs/builder"
+	"github.com/christsim/bips/bip-0158/gcs/gcsfuzz"
+)
+
+// runCorpus implements the corpus subcommand, which exports the filters of
+// previously generated vectors as seed inputs for the fuzz targets of the gcs
+// package.
+func runCorpus(args []string) error {
+	fs := flag.NewFlagSet("corpus", flag.ContinueOnError)
+	vectorsDir := fs.String("vectors", "gcstestvectors", "directory of test "+
+		"vectors to export")
+	out := fs.String("out", "gcs/testdata/fuzz", "directory to write "+
+		"the seed corpus to, with one subdirectory per fuzz target")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cases, err := conformance.LoadVectors(*vectorsDir)
+	if err != nil {
+		return err
+	}
+
+	count := 0
+	for _, c := range cases {
+		var block wire.MsgBlock
+		if err := block.Deserialize(bytes.NewReader(c.Block)); err != nil {
+			return fmt.Errorf("couldn't decode block %v: %v",
+				c.BlockHash, err)
+		}
+		key := builder.DeriveKey(&c.BlockHash)
+
+		for _, f := range c.Filters {
+			err := gcsfuzz.WriteCorpusEntry(*out, "FuzzDecode", c.P,
+				f.Filter)
+			if err != nil {
+				return err
+			}
+			err = gcsfuzz.WriteCorpusEntry(*out, "FuzzHeader",
+				f.Filter, f.PrevHeader[:])
+			if err != nil {
+				return err
+			}
+
+			// Query each filter with the elements it was built from,
+			// when the policy can be rebuilt without outside data.
+			query := []byte{}
+			policy, err := builder.LookupPolicy(f.Type)
+			if err == nil {
+				entries, err := policyEntries(policy, &block, c.P)
+				if err == nil {
+					query = gcsfuzz.JoinElements(entries)
+				}
+			}
+			err = gcsfuzz.WriteCorpusEntry(*out, "FuzzMatchAny", c.P,
+				key[:gcs.KeySize], f.Filter, query)
+			if err != nil {
+				return err
+			}
+			count += 3
+		}
+	}
+
+	fmt.Printf("Wrote %d seed inputs to %v\n", count, *out)
+	return nil
+}
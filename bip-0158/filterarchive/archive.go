@@ -0,0 +1,136 @@
+// Package filterarchive implements an archive format for distributing the
+// filters of a whole chain, so that test environments can be bootstrapped
+// with a full filter set without syncing a node and building the filters.
+//
+// An archive is a tar file. For each filter type it holds, the filters are
+// split into gzip compressed segments of consecutive blocks, alongside a file
+// of the filter headers at every checkpoint height. A JSON manifest, written
+// last, describes each filter set and records the size and SHA-256 hash of
+// every file:
+//
+//	manifest.json
+//	type-0/checkpoints.dat
+//	type-0/segment-0000000000.gz
+//	type-0/segment-0000001000.gz
+//	...
+//
+// A decompressed segment is a sequence of records, each the block hash (32)
+// followed by the filter serialized with N, prefixed by its length as a
+// varint. Filter headers aren't stored with the records: a reader derives
+// them from the previous filter header in the manifest and checks them
+// against the checkpoint file and the tip header in the manifest, so an
+// archive whose manifest matches a trusted one can't contain a wrong filter.
+// The checkpoint file holds the filter header of every block in the set whose
+// height is a non-zero multiple of builder.CheckpointInterval, in height
+// order, so it can also be compared with the cfcheckpt answer of a peer.
+package filterarchive
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/christsim/bips/bip-0158/backend/chainhash"
+	"github.com/christsim/bips/bip-0158/backend/wire"
+	"github.com/christsim/bips/bip-0158/gcs"
+	"github.com/christsim/bips/bip-0158/gcs/builder"
+)
+
+const (
+	// FormatVersion is the version of the archive format written by this
+	// package.
+	FormatVersion = 1
+
+	// ManifestName is the name of the manifest within the archive.
+	ManifestName = "manifest.json"
+
+	// DefaultSegmentSize is the number of blocks per segment if the writer
+	// isn't given one.
+	DefaultSegmentSize = builder.CheckpointInterval
+)
+
+var (
+	// ErrBadArchive is returned when an archive isn't well-formed, for
+	// example if a file listed in the manifest is missing.
+	ErrBadArchive = errors.New("filterarchive: malformed archive")
+
+	// ErrCorrupt is returned when the contents of an archive don't match
+	// its manifest: a file has the wrong hash, or the filters don't hash
+	// to the recorded filter headers.
+	ErrCorrupt = errors.New("filterarchive: archive is corrupt")
+
+	// ErrNotContiguous is returned when filters aren't appended to a set
+	// in height order.
+	ErrNotContiguous = errors.New("filterarchive: filters aren't " +
+		"contiguous")
+)
+
+// Manifest describes the contents of an archive.
+type Manifest struct {
+	Version int `json:"version"`
+
+	// Network is the name of the network the filters belong to, for
+	// information only.
+	Network string `json:"network,omitempty"`
+
+	Sets []*FilterSet `json:"sets"`
+}
+
+// FilterSet describes the filters of a single type held by an archive, for
+// the blocks from StartHeight to EndHeight inclusive.
+type FilterSet struct {
+	FilterType  wire.FilterType `json:"filter_type"`
+	P           uint8           `json:"p"`
+	StartHeight uint32          `json:"start_height"`
+	EndHeight   uint32          `json:"end_height"`
+
+	// PrevHeader is the filter header of the block before StartHeight,
+	// which is all zeros for a set starting at the genesis block.
+	PrevHeader string `json:"prev_header"`
+
+	// TipHeader is the filter header of the block at EndHeight.
+	TipHeader string `json:"tip_header"`
+
+	Checkpoints File      `json:"checkpoints"`
+	Segments    []Segment `json:"segments"`
+}
+
+// File describes a file within an archive.
+type File struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Segment describes a segment file holding the filters of Count blocks from
+// StartHeight.
+type Segment struct {
+	File
+	StartHeight uint32 `json:"start_height"`
+	Count       uint32 `json:"count"`
+}
+
+// Record is a single filter read from an archive, along with the filter
+// header derived for it.
+type Record struct {
+	Height    uint32
+	BlockHash chainhash.Hash
+	Filter    *gcs.Filter
+	Header    chainhash.Hash
+}
+
+// checkpointsName returns the name of the checkpoint file of a filter set.
+func checkpointsName(filterType wire.FilterType) string {
+	return fmt.Sprintf("type-%d/checkpoints.dat", filterType)
+}
+
+// segmentName returns the name of the segment file of a filter set starting
+// at the passed height.
+func segmentName(filterType wire.FilterType, startHeight uint32) string {
+	return fmt.Sprintf("type-%d/segment-%010d.gz", filterType, startHeight)
+}
+
+// isCheckpoint returns whether the filter header at the passed height goes in
+// the checkpoint file.
+func isCheckpoint(height uint32) bool {
+	return height != 0 && height%builder.CheckpointInterval == 0
+}
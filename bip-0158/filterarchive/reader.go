@@ -0,0 +1,334 @@
+package filterarchive
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+
+	"github.com/christsim/bips/bip-0158/backend/chainhash"
+	"github.com/christsim/bips/bip-0158/backend/wire"
+	"github.com/christsim/bips/bip-0158/gcs"
+	"github.com/christsim/bips/bip-0158/gcs/builder"
+)
+
+// entry locates a file within the tar file.
+type entry struct {
+	offset int64
+	size   int64
+}
+
+// Reader reads an archive. Every file is checked against the manifest as it
+// is read.
+type Reader struct {
+	file     *os.File
+	entries  map[string]entry
+	manifest Manifest
+
+	// id is the SHA-256 hash of the manifest.
+	id [sha256.Size]byte
+}
+
+// Open opens the archive at the passed path and reads its manifest.
+func Open(path string) (*Reader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := newReader(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// newReader indexes the files of the tar file and reads the manifest.
+func newReader(file *os.File) (*Reader, error) {
+	r := &Reader{
+		file:    file,
+		entries: make(map[string]entry),
+	}
+
+	// The tar reader seeks past the contents of each file, so the file
+	// position after reading a header is where the contents start.
+	tr := tar.NewReader(file)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrBadArchive, err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		offset, err := file.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, err
+		}
+		r.entries[header.Name] = entry{
+			offset: offset,
+			size:   header.Size,
+		}
+	}
+
+	e, ok := r.entries[ManifestName]
+	if !ok {
+		return nil, fmt.Errorf("%w: no manifest", ErrBadArchive)
+	}
+	manifest := make([]byte, e.size)
+	if _, err := file.ReadAt(manifest, e.offset); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(manifest, &r.manifest); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadArchive, err)
+	}
+	if r.manifest.Version != FormatVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d",
+			ErrBadArchive, r.manifest.Version)
+	}
+	r.id = sha256.Sum256(manifest)
+
+	return r, nil
+}
+
+// Close closes the archive.
+func (r *Reader) Close() error {
+	return r.file.Close()
+}
+
+// Manifest returns the manifest of the archive.
+func (r *Reader) Manifest() *Manifest {
+	return &r.manifest
+}
+
+// ID returns the hex encoded SHA-256 hash of the manifest. Since the manifest
+// commits to every file, an archive whose ID matches a trusted one and which
+// verifies holds the same filters.
+func (r *Reader) ID() string {
+	return hex.EncodeToString(r.id[:])
+}
+
+// Set returns the filter set of the passed type, or nil if the archive has
+// none.
+func (r *Reader) Set(filterType wire.FilterType) *FilterSet {
+	for _, set := range r.manifest.Sets {
+		if set.FilterType == filterType {
+			return set
+		}
+	}
+	return nil
+}
+
+// open returns a reader of the contents of a file listed in the manifest,
+// along with the hash the contents should be checked against once read.
+func (r *Reader) open(f *File) (io.Reader, hash.Hash, error) {
+	e, ok := r.entries[f.Name]
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: %v is missing", ErrBadArchive,
+			f.Name)
+	}
+	if e.size != f.Size {
+		return nil, nil, fmt.Errorf("%w: %v has %d bytes, manifest "+
+			"says %d", ErrCorrupt, f.Name, e.size, f.Size)
+	}
+
+	h := sha256.New()
+	section := io.NewSectionReader(r.file, e.offset, e.size)
+	return io.TeeReader(section, h), h, nil
+}
+
+// checkHash checks the hash of a file read through open.
+func checkHash(f *File, h hash.Hash) error {
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != f.SHA256 {
+		return fmt.Errorf("%w: %v has hash %v, manifest says %v",
+			ErrCorrupt, f.Name, sum, f.SHA256)
+	}
+	return nil
+}
+
+// Checkpoints returns the checkpointed filter headers of a filter set, keyed
+// by height.
+func (r *Reader) Checkpoints(set *FilterSet) (map[uint32]chainhash.Hash,
+	error) {
+
+	fr, h, err := r.open(&set.Checkpoints)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(fr)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkHash(&set.Checkpoints, h); err != nil {
+		return nil, err
+	}
+
+	checkpoints := make(map[uint32]chainhash.Hash)
+	for height := set.StartHeight; height <= set.EndHeight; height++ {
+		if !isCheckpoint(height) {
+			continue
+		}
+		if len(data) < chainhash.HashSize {
+			return nil, fmt.Errorf("%w: missing checkpoint for "+
+				"height %d", ErrBadArchive, height)
+		}
+		var header chainhash.Hash
+		copy(header[:], data)
+		checkpoints[height] = header
+		data = data[chainhash.HashSize:]
+
+		// Guard against wrapping around at the highest height.
+		if height == set.EndHeight {
+			break
+		}
+	}
+	if len(data) != 0 {
+		return nil, fmt.Errorf("%w: extra checkpoints", ErrBadArchive)
+	}
+
+	return checkpoints, nil
+}
+
+// ForEach calls fn with each filter of a set in height order, stopping early
+// if fn returns an error. Each filter is checked against its segment's hash,
+// and its header against the checkpoints and the tip header, but a failing
+// check is only noticed after the filters before it have been passed to fn:
+// call Verify first to avoid acting on part of a corrupt archive.
+func (r *Reader) ForEach(set *FilterSet, fn func(*Record) error) error {
+	prevHeader, err := chainhash.NewHashFromStr(set.PrevHeader)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrBadArchive, err)
+	}
+	tipHeader, err := chainhash.NewHashFromStr(set.TipHeader)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrBadArchive, err)
+	}
+	if set.EndHeight < set.StartHeight {
+		return fmt.Errorf("%w: set ends at %d before it starts at %d",
+			ErrBadArchive, set.EndHeight, set.StartHeight)
+	}
+	checkpoints, err := r.Checkpoints(set)
+	if err != nil {
+		return err
+	}
+
+	chain := builder.NewFilterHeaderChainFrom(set.StartHeight,
+		*prevHeader, 1)
+	for i := range set.Segments {
+		segment := &set.Segments[i]
+		if segment.StartHeight != chain.NextHeight() || segment.Count == 0 {
+			return fmt.Errorf("%w: segment %v doesn't follow the "+
+				"previous one", ErrBadArchive, segment.Name)
+		}
+
+		err := r.readSegment(set, segment, func(rec *Record) error {
+			header, err := chain.Append(rec.Filter)
+			if err != nil {
+				return err
+			}
+			expected, ok := checkpoints[rec.Height]
+			if ok && header != expected {
+				return fmt.Errorf("%w: filter header at height "+
+					"%d is %v, checkpoint is %v", ErrCorrupt,
+					rec.Height, header, expected)
+			}
+			rec.Header = header
+
+			return fn(rec)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if chain.NextHeight()-1 != set.EndHeight {
+		return fmt.Errorf("%w: segments end at height %d, set at %d",
+			ErrBadArchive, chain.NextHeight()-1, set.EndHeight)
+	}
+	if chain.TipHeader() != *tipHeader {
+		return fmt.Errorf("%w: tip filter header is %v, manifest says "+
+			"%v", ErrCorrupt, chain.TipHeader(), tipHeader)
+	}
+
+	return nil
+}
+
+// readSegment calls fn with each filter of a segment, without its header.
+func (r *Reader) readSegment(set *FilterSet, segment *Segment,
+	fn func(*Record) error) error {
+
+	fr, h, err := r.open(&segment.File)
+	if err != nil {
+		return err
+	}
+	gz, err := gzip.NewReader(fr)
+	if err != nil {
+		return fmt.Errorf("%w: %v: %v", ErrCorrupt, segment.Name, err)
+	}
+	br := bufio.NewReader(gz)
+
+	for i := uint32(0); i < segment.Count; i++ {
+		rec := &Record{Height: segment.StartHeight + i}
+		if _, err := io.ReadFull(br, rec.BlockHash[:]); err != nil {
+			return fmt.Errorf("%w: %v: %v", ErrCorrupt, segment.Name,
+				err)
+		}
+		nBytes, err := wire.ReadVarBytes(br, 0, wire.MaxCFilterDataSize,
+			"filter")
+		if err != nil {
+			return fmt.Errorf("%w: %v: %v", ErrCorrupt, segment.Name,
+				err)
+		}
+		rec.Filter, err = gcs.FromNBytes(set.P, nBytes)
+		if err != nil {
+			return fmt.Errorf("%w: %v: filter at height %d: %v",
+				ErrCorrupt, segment.Name, rec.Height, err)
+		}
+
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+
+	// Reading to the end checks the gzip checksum, and then the hash of
+	// the whole file can be checked.
+	n, err := io.Copy(io.Discard, br)
+	if err != nil {
+		return fmt.Errorf("%w: %v: %v", ErrCorrupt, segment.Name, err)
+	}
+	if n != 0 {
+		return fmt.Errorf("%w: %v has trailing data", ErrCorrupt,
+			segment.Name)
+	}
+	if _, err := io.Copy(io.Discard, fr); err != nil {
+		return err
+	}
+	return checkHash(&segment.File, h)
+}
+
+// Verify reads every filter set of the archive and returns the first
+// integrity error found, if any.
+func (r *Reader) Verify() error {
+	if len(r.manifest.Sets) == 0 {
+		return fmt.Errorf("%w: no filter sets", ErrBadArchive)
+	}
+	for _, set := range r.manifest.Sets {
+		err := r.ForEach(set, func(*Record) error { return nil })
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,239 @@
+package filterarchive
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/christsim/bips/bip-0158/backend/chainhash"
+	"github.com/christsim/bips/bip-0158/backend/wire"
+	"github.com/christsim/bips/bip-0158/gcs"
+	"github.com/christsim/bips/bip-0158/gcs/builder"
+)
+
+// Writer writes an archive. Filter sets are written one at a time: BeginSet
+// starts a set, Append adds the filter of each block in turn, and the next
+// call to BeginSet or Close finishes it.
+type Writer struct {
+	tw          *tar.Writer
+	manifest    Manifest
+	segmentSize uint32
+
+	// set is the filter set being written, if any, and chain derives its
+	// filter headers.
+	set         *FilterSet
+	chain       *builder.FilterHeaderChain
+	checkpoints bytes.Buffer
+
+	// segment holds the compressed records of the current segment, which
+	// has to be complete before it can be added to the tar file.
+	segment      bytes.Buffer
+	gz           *gzip.Writer
+	segmentStart uint32
+	segmentCount uint32
+}
+
+// NewWriter returns a writer of an archive to w for the filters of the named
+// network, splitting them into segments of segmentSize blocks, or of
+// DefaultSegmentSize if zero.
+func NewWriter(w io.Writer, network string, segmentSize uint32) *Writer {
+	if segmentSize == 0 {
+		segmentSize = DefaultSegmentSize
+	}
+
+	return &Writer{
+		tw: tar.NewWriter(w),
+		manifest: Manifest{
+			Version: FormatVersion,
+			Network: network,
+		},
+		segmentSize: segmentSize,
+	}
+}
+
+// BeginSet starts a set of filters of the passed type and P, the first of
+// which is for the block at startHeight. prevHeader is the filter header of
+// the block before it.
+func (w *Writer) BeginSet(filterType wire.FilterType, p uint8,
+	startHeight uint32, prevHeader chainhash.Hash) error {
+
+	if err := w.finishSet(); err != nil {
+		return err
+	}
+	for _, set := range w.manifest.Sets {
+		if set.FilterType == filterType {
+			return fmt.Errorf("filterarchive: archive already "+
+				"holds filter type %d", filterType)
+		}
+	}
+
+	w.set = &FilterSet{
+		FilterType:  filterType,
+		P:           p,
+		StartHeight: startHeight,
+		PrevHeader:  prevHeader.String(),
+	}
+	w.chain = builder.NewFilterHeaderChainFrom(startHeight, prevHeader, 1)
+	w.checkpoints.Reset()
+
+	return nil
+}
+
+// Append adds the filter of the next block of the current set and returns
+// its filter header.
+func (w *Writer) Append(height uint32, blockHash *chainhash.Hash,
+	filter *gcs.Filter) (chainhash.Hash, error) {
+
+	if w.set == nil {
+		return chainhash.Hash{}, fmt.Errorf("filterarchive: no set " +
+			"begun")
+	}
+	if height != w.chain.NextHeight() {
+		return chainhash.Hash{}, fmt.Errorf("%w: got height %d, "+
+			"expected %d", ErrNotContiguous, height,
+			w.chain.NextHeight())
+	}
+	if filter.P() != w.set.P {
+		return chainhash.Hash{}, fmt.Errorf("filterarchive: filter "+
+			"has P of %d, set has %d", filter.P(), w.set.P)
+	}
+	nBytes, err := filter.NBytes()
+	if err != nil {
+		return chainhash.Hash{}, err
+	}
+
+	if w.gz == nil {
+		w.segment.Reset()
+		w.gz = gzip.NewWriter(&w.segment)
+		w.segmentStart = height
+		w.segmentCount = 0
+	}
+	if _, err := w.gz.Write(blockHash[:]); err != nil {
+		return chainhash.Hash{}, err
+	}
+	if err := wire.WriteVarBytes(w.gz, 0, nBytes); err != nil {
+		return chainhash.Hash{}, err
+	}
+	w.segmentCount++
+
+	header, err := w.chain.Append(filter)
+	if err != nil {
+		return chainhash.Hash{}, err
+	}
+	if isCheckpoint(height) {
+		w.checkpoints.Write(header[:])
+	}
+
+	if w.segmentCount == w.segmentSize {
+		if err := w.finishSegment(); err != nil {
+			return chainhash.Hash{}, err
+		}
+	}
+
+	return header, nil
+}
+
+// Close finishes the current set and writes the manifest. It doesn't close
+// the underlying writer.
+func (w *Writer) Close() error {
+	if err := w.finishSet(); err != nil {
+		return err
+	}
+
+	manifest, err := json.MarshalIndent(&w.manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if _, err := w.writeFile(ManifestName, manifest); err != nil {
+		return err
+	}
+
+	return w.tw.Close()
+}
+
+// finishSegment adds the current segment to the archive.
+func (w *Writer) finishSegment() error {
+	if w.gz == nil {
+		return nil
+	}
+	if err := w.gz.Close(); err != nil {
+		return err
+	}
+	w.gz = nil
+
+	name := segmentName(w.set.FilterType, w.segmentStart)
+	file, err := w.writeFile(name, w.segment.Bytes())
+	if err != nil {
+		return err
+	}
+	w.set.Segments = append(w.set.Segments, Segment{
+		File:        file,
+		StartHeight: w.segmentStart,
+		Count:       w.segmentCount,
+	})
+
+	return nil
+}
+
+// finishSet adds the last segment and the checkpoint file of the current set
+// to the archive, and the set to the manifest.
+func (w *Writer) finishSet() error {
+	if w.set == nil {
+		return nil
+	}
+	if w.chain.NextHeight() == w.set.StartHeight {
+		return fmt.Errorf("filterarchive: set of filter type %d is "+
+			"empty", w.set.FilterType)
+	}
+	if err := w.finishSegment(); err != nil {
+		return err
+	}
+
+	name := checkpointsName(w.set.FilterType)
+	file, err := w.writeFile(name, w.checkpoints.Bytes())
+	if err != nil {
+		return err
+	}
+	w.set.Checkpoints = file
+	w.set.EndHeight = w.chain.NextHeight() - 1
+	w.set.TipHeader = w.chain.TipHeader().String()
+
+	w.manifest.Sets = append(w.manifest.Sets, w.set)
+	w.set = nil
+
+	return nil
+}
+
+// writeFile adds a file to the tar file and returns its description for the
+// manifest.
+func (w *Writer) writeFile(name string, data []byte) (File, error) {
+	// The modification time is fixed so that archives of the same
+	// filters are identical.
+	err := w.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     int64(len(data)),
+		Mode:     0644,
+		ModTime:  time.Unix(0, 0),
+		Format:   tar.FormatUSTAR,
+	})
+	if err != nil {
+		return File{}, err
+	}
+	if _, err := w.tw.Write(data); err != nil {
+		return File{}, err
+	}
+
+	sum := sha256.Sum256(data)
+	return File{
+		Name:   name,
+		Size:   int64(len(data)),
+		SHA256: hex.EncodeToString(sum[:]),
+	}, nil
+}
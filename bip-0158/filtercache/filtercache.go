@@ -0,0 +1,168 @@
+// Package filtercache provides an LRU cache in front of any source of filters,
+// such as a filter store, a filter file or a backend building filters on the
+// fly. Repeated scans over overlapping ranges of blocks, as when testing
+// wallet birthday logic, are then served from memory.
+package filtercache
+
+import (
+	"container/list"
+	"expvar"
+	"sync"
+
+	"github.com/christsim/bips/bip-0158/backend/chainhash"
+	"github.com/christsim/bips/bip-0158/gcs"
+)
+
+// Source provides filters by block height. It is the same interface the
+// rescan package walks, so a Cache can be used wherever a source can.
+type Source interface {
+	// Filter returns the filter of the block at the passed height along
+	// with the block's hash.
+	Filter(height uint32) (*gcs.Filter, *chainhash.Hash, error)
+}
+
+// Stats reports how effective a cache has been.
+type Stats struct {
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"`
+
+	// Size is the number of filters currently cached.
+	Size int `json:"size"`
+}
+
+// HitRate returns the fraction of lookups that were served from the cache, or
+// zero if there haven't been any.
+func (s Stats) HitRate() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(total)
+}
+
+// entry is a cached filter.
+type entry struct {
+	height    uint32
+	filter    *gcs.Filter
+	blockHash *chainhash.Hash
+}
+
+// Cache is an LRU cache of filters in front of a Source. It is safe for
+// concurrent use.
+type Cache struct {
+	src      Source
+	capacity int
+
+	mtx   sync.Mutex
+	ll    *list.List
+	items map[uint32]*list.Element
+	stats Stats
+}
+
+// New returns a cache holding up to capacity filters from src.
+func New(src Source, capacity int) *Cache {
+	if capacity < 1 {
+		capacity = 1
+	}
+
+	return &Cache{
+		src:      src,
+		capacity: capacity,
+		ll:       list.New(),
+		items:    make(map[uint32]*list.Element, capacity),
+	}
+}
+
+// Filter returns the filter of the block at the passed height, from the cache
+// if possible and otherwise from the underlying source. Errors from the
+// source aren't cached.
+func (c *Cache) Filter(height uint32) (*gcs.Filter, *chainhash.Hash, error) {
+	c.mtx.Lock()
+	if elem, ok := c.items[height]; ok {
+		c.ll.MoveToFront(elem)
+		c.stats.Hits++
+		e := elem.Value.(*entry)
+		c.mtx.Unlock()
+		return e.filter, e.blockHash, nil
+	}
+	c.stats.Misses++
+	c.mtx.Unlock()
+
+	// The source is queried without holding the lock so that slow
+	// lookups don't hold up hits.
+	filter, blockHash, err := c.src.Filter(height)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	// Another caller may have fetched the same filter meanwhile.
+	if elem, ok := c.items[height]; ok {
+		c.ll.MoveToFront(elem)
+		return filter, blockHash, nil
+	}
+
+	c.items[height] = c.ll.PushFront(&entry{
+		height:    height,
+		filter:    filter,
+		blockHash: blockHash,
+	})
+	if c.ll.Len() > c.capacity {
+		oldest := c.ll.Back()
+		c.ll.Remove(oldest)
+		delete(c.items, oldest.Value.(*entry).height)
+		c.stats.Evictions++
+	}
+
+	return filter, blockHash, nil
+}
+
+// Invalidate drops the filters of the blocks at and above the passed height,
+// as needed after a reorganization.
+func (c *Cache) Invalidate(height uint32) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	for h, elem := range c.items {
+		if h >= height {
+			c.ll.Remove(elem)
+			delete(c.items, h)
+		}
+	}
+}
+
+// Purge empties the cache. The statistics are kept.
+func (c *Cache) Purge() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.ll.Init()
+	c.items = make(map[uint32]*list.Element, c.capacity)
+}
+
+// Stats returns a snapshot of the cache's statistics.
+func (c *Cache) Stats() Stats {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	stats := c.stats
+	stats.Size = c.ll.Len()
+	return stats
+}
+
+// Publish exports the cache's statistics, along with its hit rate, as an
+// expvar variable with the passed name, so they show up under /debug/vars
+// of any HTTP server serving expvar. Like expvar.Publish, it panics if the
+// name is already in use.
+func (c *Cache) Publish(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		stats := c.Stats()
+		return struct {
+			Stats
+			HitRate float64 `json:"hit_rate"`
+		}{stats, stats.HitRate()}
+	}))
+}
@@ -0,0 +1,402 @@
+// Package filterdb provides a persistent store for BIP 158 filters and their
+// filter headers, backed by LevelDB. Filters are keyed by block hash and
+// filter type, and a height index allows walking them in chain order.
+package filterdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/goleveldb/leveldb"
+	"github.com/btcsuite/goleveldb/leveldb/util"
+	"github.com/christsim/bips/bip-0158/backend/chainhash"
+	"github.com/christsim/bips/bip-0158/backend/wire"
+	"github.com/christsim/bips/bip-0158/gcs"
+)
+
+var (
+	// ErrNotFound is returned when the requested filter, header or block
+	// isn't in the store.
+	ErrNotFound = errors.New("not found in filter store")
+
+	// ErrPruned is returned when the requested filter has been pruned.
+	// Its header is still available.
+	ErrPruned = errors.New("filter has been pruned")
+)
+
+var (
+	// filterPrefix prefixes the key of every filter, which is followed by
+	// the filter type and the block hash. The value is the filter's P
+	// followed by its serialization with N prepended, or empty once
+	// pruned.
+	filterPrefix = []byte{'f'}
+
+	// headerPrefix prefixes the key of every filter header, which is
+	// followed by the filter type and the block hash.
+	headerPrefix = []byte{'h'}
+
+	// heightPrefix prefixes the key of the height index, which is
+	// followed by the big endian block height and maps to the block hash.
+	heightPrefix = []byte{'i'}
+
+	// blockPrefix prefixes the key of the reverse height index, which is
+	// followed by the block hash and maps to the big endian block height.
+	blockPrefix = []byte{'b'}
+
+	// tipKey holds the big endian height of the highest block stored.
+	tipKey = []byte("tip")
+
+	// pruneKey holds the big endian height below which filters have been
+	// pruned.
+	pruneKey = []byte("prune")
+)
+
+// typedKey returns the key of a filter or header of the passed type for the
+// passed block.
+func typedKey(prefix []byte, filterType wire.FilterType,
+	blockHash *chainhash.Hash) []byte {
+
+	key := make([]byte, 0, len(prefix)+1+chainhash.HashSize)
+	key = append(key, prefix...)
+	key = append(key, byte(filterType))
+	return append(key, blockHash[:]...)
+}
+
+// heightKey returns the height index key of the passed height.
+func heightKey(height uint32) []byte {
+	key := make([]byte, 0, len(heightPrefix)+4)
+	key = append(key, heightPrefix...)
+	return binary.BigEndian.AppendUint32(key, height)
+}
+
+// blockKey returns the reverse height index key of the passed block.
+func blockKey(blockHash *chainhash.Hash) []byte {
+	key := make([]byte, 0, len(blockPrefix)+chainhash.HashSize)
+	key = append(key, blockPrefix...)
+	return append(key, blockHash[:]...)
+}
+
+// Entry is a single filter along with everything stored about it.
+type Entry struct {
+	Height     uint32
+	BlockHash  chainhash.Hash
+	FilterType wire.FilterType
+
+	// Filter is nil if the filter has been pruned.
+	Filter *gcs.Filter
+	Header chainhash.Hash
+}
+
+// DB is a persistent filter store.
+type DB struct {
+	db *leveldb.DB
+}
+
+// Open opens the filter store at the passed path, creating an empty one if it
+// doesn't exist.
+func Open(path string) (*DB, error) {
+	db, err := leveldb.OpenFile(path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DB{db: db}, nil
+}
+
+// Close closes the store.
+func (d *DB) Close() error {
+	return d.db.Close()
+}
+
+// Batch collects filters to be written to the store atomically.
+type Batch struct {
+	b   *leveldb.Batch
+	n   int
+	tip uint32
+	set bool
+}
+
+// NewBatch returns an empty batch.
+func (d *DB) NewBatch() *Batch {
+	return &Batch{b: new(leveldb.Batch)}
+}
+
+// Len returns the number of filters in the batch.
+func (b *Batch) Len() int {
+	return b.n
+}
+
+// PutFilter adds a filter, its header and its block's height to the batch.
+func (b *Batch) PutFilter(e *Entry) error {
+	var value []byte
+	if e.Filter != nil {
+		nBytes, err := e.Filter.NBytes()
+		if err != nil {
+			return err
+		}
+		value = make([]byte, 0, 1+len(nBytes))
+		value = append(value, e.Filter.P())
+		value = append(value, nBytes...)
+	}
+
+	var height [4]byte
+	binary.BigEndian.PutUint32(height[:], e.Height)
+
+	b.b.Put(typedKey(filterPrefix, e.FilterType, &e.BlockHash), value)
+	b.b.Put(typedKey(headerPrefix, e.FilterType, &e.BlockHash),
+		e.Header[:])
+	b.b.Put(heightKey(e.Height), e.BlockHash[:])
+	b.b.Put(blockKey(&e.BlockHash), height[:])
+
+	b.n++
+	if !b.set || e.Height > b.tip {
+		b.tip = e.Height
+		b.set = true
+	}
+
+	return nil
+}
+
+// WriteBatch atomically writes the filters in the batch to the store.
+func (d *DB) WriteBatch(b *Batch) error {
+	if b.set {
+		tip, err := d.TipHeight()
+		switch {
+		case err == ErrNotFound || err == nil && b.tip > tip:
+			var height [4]byte
+			binary.BigEndian.PutUint32(height[:], b.tip)
+			b.b.Put(tipKey, height[:])
+		case err != nil:
+			return err
+		}
+	}
+
+	return d.db.Write(b.b, nil)
+}
+
+// PutFilter writes a single filter to the store.
+func (d *DB) PutFilter(e *Entry) error {
+	b := d.NewBatch()
+	if err := b.PutFilter(e); err != nil {
+		return err
+	}
+	return d.WriteBatch(b)
+}
+
+// get reads a key, translating a missing key to ErrNotFound.
+func (d *DB) get(key []byte) ([]byte, error) {
+	value, err := d.db.Get(key, nil)
+	if err == leveldb.ErrNotFound {
+		return nil, ErrNotFound
+	}
+	return value, err
+}
+
+// FetchFilter returns the filter of the passed type for the passed block.
+func (d *DB) FetchFilter(blockHash *chainhash.Hash,
+	filterType wire.FilterType) (*gcs.Filter, error) {
+
+	value, err := d.get(typedKey(filterPrefix, filterType, blockHash))
+	if err != nil {
+		return nil, err
+	}
+	if len(value) == 0 {
+		return nil, ErrPruned
+	}
+
+	return gcs.FromNBytes(value[0], value[1:])
+}
+
+// FetchHeader returns the filter header of the passed type for the passed
+// block.
+func (d *DB) FetchHeader(blockHash *chainhash.Hash,
+	filterType wire.FilterType) (*chainhash.Hash, error) {
+
+	value, err := d.get(typedKey(headerPrefix, filterType, blockHash))
+	if err != nil {
+		return nil, err
+	}
+
+	return chainhash.NewHash(value)
+}
+
+// BlockHash returns the hash of the block stored at the passed height.
+func (d *DB) BlockHash(height uint32) (*chainhash.Hash, error) {
+	value, err := d.get(heightKey(height))
+	if err != nil {
+		return nil, err
+	}
+
+	return chainhash.NewHash(value)
+}
+
+// Height returns the height of the passed block.
+func (d *DB) Height(blockHash *chainhash.Hash) (uint32, error) {
+	value, err := d.get(blockKey(blockHash))
+	if err != nil {
+		return 0, err
+	}
+	if len(value) != 4 {
+		return 0, fmt.Errorf("corrupt height for block %v", blockHash)
+	}
+
+	return binary.BigEndian.Uint32(value), nil
+}
+
+// TipHeight returns the height of the highest block stored, or ErrNotFound if
+// the store is empty.
+func (d *DB) TipHeight() (uint32, error) {
+	value, err := d.get(tipKey)
+	if err != nil {
+		return 0, err
+	}
+
+	return binary.BigEndian.Uint32(value), nil
+}
+
+// PrunedHeight returns the height below which filters have been pruned, which
+// is zero if nothing has been.
+func (d *DB) PrunedHeight() (uint32, error) {
+	value, err := d.get(pruneKey)
+	if err == ErrNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return binary.BigEndian.Uint32(value), nil
+}
+
+// ForEach calls fn with the filter of the passed type for each block from
+// startHeight to endHeight inclusive, in height order, stopping early if fn
+// returns an error. Blocks without a filter of the type are skipped, and
+// pruned filters are passed with a nil Filter.
+func (d *DB) ForEach(filterType wire.FilterType, startHeight,
+	endHeight uint32, fn func(e *Entry) error) error {
+
+	if startHeight > endHeight {
+		return nil
+	}
+
+	// The range limit is exclusive, and the height after the last one
+	// may not fit in a uint32, so the prefix is used as the limit
+	// instead in that case.
+	limit := heightKey(endHeight + 1)
+	if endHeight == ^uint32(0) {
+		limit = util.BytesPrefix(heightPrefix).Limit
+	}
+	iter := d.db.NewIterator(&util.Range{
+		Start: heightKey(startHeight),
+		Limit: limit,
+	}, nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		e := &Entry{
+			Height:     binary.BigEndian.Uint32(iter.Key()[1:]),
+			FilterType: filterType,
+		}
+		copy(e.BlockHash[:], iter.Value())
+
+		header, err := d.FetchHeader(&e.BlockHash, filterType)
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		e.Header = *header
+
+		e.Filter, err = d.FetchFilter(&e.BlockHash, filterType)
+		if err != nil && err != ErrPruned {
+			return err
+		}
+
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+
+	return iter.Error()
+}
+
+// Prune deletes the filters of every type for blocks below the passed height,
+// keeping their headers so that the header chain can still be extended and
+// verified.
+func (d *DB) Prune(height uint32) error {
+	pruned, err := d.PrunedHeight()
+	if err != nil {
+		return err
+	}
+	if height <= pruned {
+		return nil
+	}
+
+	iter := d.db.NewIterator(&util.Range{
+		Start: heightKey(pruned),
+		Limit: heightKey(height),
+	}, nil)
+	defer iter.Release()
+
+	hashes := make(map[chainhash.Hash]struct{})
+	for iter.Next() {
+		var blockHash chainhash.Hash
+		copy(blockHash[:], iter.Value())
+		hashes[blockHash] = struct{}{}
+	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
+
+	// Filters are stored under each type, so find every filter of a
+	// pruned block regardless of type.
+	b := new(leveldb.Batch)
+	filters := d.db.NewIterator(util.BytesPrefix(filterPrefix), nil)
+	defer filters.Release()
+	for filters.Next() {
+		key := filters.Key()
+		var blockHash chainhash.Hash
+		copy(blockHash[:], key[len(filterPrefix)+1:])
+		if _, ok := hashes[blockHash]; ok && len(filters.Value()) > 0 {
+			b.Put(append([]byte(nil), key...), nil)
+		}
+	}
+	if err := filters.Error(); err != nil {
+		return err
+	}
+
+	var prune [4]byte
+	binary.BigEndian.PutUint32(prune[:], height)
+	b.Put(pruneKey, prune[:])
+
+	return d.db.Write(b, nil)
+}
+
+// Source is a view of the store's filters of a single type, for use by
+// consumers that walk filters by height such as the rescan package.
+type Source struct {
+	db         *DB
+	filterType wire.FilterType
+}
+
+// Source returns a view of the store's filters of the passed type.
+func (d *DB) Source(filterType wire.FilterType) *Source {
+	return &Source{db: d, filterType: filterType}
+}
+
+// Filter returns the filter of the block at the passed height along with the
+// block's hash.
+func (s *Source) Filter(height uint32) (*gcs.Filter, *chainhash.Hash, error) {
+	blockHash, err := s.db.BlockHash(height)
+	if err != nil {
+		return nil, nil, fmt.Errorf("height %d: %w", height, err)
+	}
+	filter, err := s.db.FetchFilter(blockHash, s.filterType)
+	if err != nil {
+		return nil, nil, fmt.Errorf("height %d: %w", height, err)
+	}
+
+	return filter, blockHash, nil
+}
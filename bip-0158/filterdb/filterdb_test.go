@@ -0,0 +1,262 @@
+package filterdb_test
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/christsim/bips/bip-0158/backend/chainhash"
+	"github.com/christsim/bips/bip-0158/backend/wire"
+	"github.com/christsim/bips/bip-0158/filterdb"
+	"github.com/christsim/bips/bip-0158/gcs"
+)
+
+// testBlocks is the number of blocks newTestDB stores.
+const testBlocks = 10
+
+// testEntry returns the entry newTestDB stores for the block at the passed
+// height and the filter type. Each filter holds the height and the type.
+func testEntry(t *testing.T, height uint32,
+	filterType wire.FilterType) *filterdb.Entry {
+
+	t.Helper()
+
+	var key [gcs.KeySize]byte
+	filter, err := gcs.BuildGCSFilter(20, key, [][]byte{
+		{byte(height)}, {0xf0 | byte(filterType)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &filterdb.Entry{
+		Height:     height,
+		BlockHash:  chainhash.HashH([]byte{byte(height)}),
+		FilterType: filterType,
+		Filter:     filter,
+		Header:     chainhash.HashH([]byte{byte(height), 0xff}),
+	}
+}
+
+// newTestDB returns a store holding the basic and extended filters of
+// testBlocks blocks, written in a single batch.
+func newTestDB(t *testing.T) *filterdb.DB {
+	t.Helper()
+
+	db, err := filterdb.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	batch := db.NewBatch()
+	for height := uint32(0); height < testBlocks; height++ {
+		for _, filterType := range []wire.FilterType{
+			wire.GCSFilterRegular, wire.GCSFilterExtended,
+		} {
+			err := batch.PutFilter(testEntry(t, height, filterType))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if batch.Len() != 2*testBlocks {
+		t.Fatalf("batch holds %d filters, want %d", batch.Len(),
+			2*testBlocks)
+	}
+	if err := db.WriteBatch(batch); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// TestFetch fetches filters, headers and heights from a store, before and
+// after pruning it.
+func TestFetch(t *testing.T) {
+	db := newTestDB(t)
+
+	tip, err := db.TipHeight()
+	if err != nil || tip != testBlocks-1 {
+		t.Fatalf("tip %d, %v, want %d", tip, err, testBlocks-1)
+	}
+	if err := db.Prune(5); err != nil {
+		t.Fatal(err)
+	}
+	pruned, err := db.PrunedHeight()
+	if err != nil || pruned != 5 {
+		t.Fatalf("pruned height %d, %v, want 5", pruned, err)
+	}
+
+	unknown := chainhash.HashH([]byte("unknown"))
+	tests := []struct {
+		name       string
+		height     uint32
+		blockHash  *chainhash.Hash
+		filterType wire.FilterType
+		filterErr  error
+		headerErr  error
+	}{{
+		name:       "basic",
+		height:     7,
+		filterType: wire.GCSFilterRegular,
+	}, {
+		name:       "extended",
+		height:     testBlocks - 1,
+		filterType: wire.GCSFilterExtended,
+	}, {
+		name:       "first kept",
+		height:     5,
+		filterType: wire.GCSFilterRegular,
+	}, {
+		name:       "pruned",
+		height:     4,
+		filterType: wire.GCSFilterExtended,
+		filterErr:  filterdb.ErrPruned,
+	}, {
+		name:       "unknown type",
+		height:     7,
+		filterType: wire.GCSFilterExtended + 1,
+		filterErr:  filterdb.ErrNotFound,
+		headerErr:  filterdb.ErrNotFound,
+	}, {
+		name:       "unknown block",
+		blockHash:  &unknown,
+		filterType: wire.GCSFilterRegular,
+		filterErr:  filterdb.ErrNotFound,
+		headerErr:  filterdb.ErrNotFound,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			want := testEntry(t, test.height, test.filterType)
+			blockHash := test.blockHash
+			if blockHash == nil {
+				blockHash = &want.BlockHash
+
+				height, err := db.Height(blockHash)
+				if err != nil || height != test.height {
+					t.Fatalf("height %d, %v, want %d", height,
+						err, test.height)
+				}
+				stored, err := db.BlockHash(test.height)
+				if err != nil || *stored != *blockHash {
+					t.Fatalf("block hash %v, %v, want %v",
+						stored, err, blockHash)
+				}
+			}
+
+			filter, err := db.FetchFilter(blockHash, test.filterType)
+			if !errors.Is(err, test.filterErr) {
+				t.Fatalf("filter: got error %v, want %v", err,
+					test.filterErr)
+			}
+			if err == nil {
+				got, _ := filter.NBytes()
+				expected, _ := want.Filter.NBytes()
+				if !bytes.Equal(got, expected) {
+					t.Fatalf("filter %x, want %x", got,
+						expected)
+				}
+			}
+
+			header, err := db.FetchHeader(blockHash, test.filterType)
+			if !errors.Is(err, test.headerErr) {
+				t.Fatalf("header: got error %v, want %v", err,
+					test.headerErr)
+			}
+			if err == nil && *header != want.Header {
+				t.Fatalf("header %v, want %v", header, want.Header)
+			}
+		})
+	}
+
+	_, _, err = db.Source(wire.GCSFilterRegular).Filter(2)
+	if !errors.Is(err, filterdb.ErrPruned) {
+		t.Fatalf("source: got error %v, want %v", err, filterdb.ErrPruned)
+	}
+	_, _, err = db.Source(wire.GCSFilterRegular).Filter(testBlocks)
+	if !errors.Is(err, filterdb.ErrNotFound) {
+		t.Fatalf("source: got error %v, want %v", err,
+			filterdb.ErrNotFound)
+	}
+}
+
+// TestForEach walks ranges of heights of a pruned store.
+func TestForEach(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.Prune(3); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		start   uint32
+		end     uint32
+		heights []uint32
+		pruned  int
+	}{{
+		name:    "all",
+		start:   0,
+		end:     ^uint32(0),
+		heights: []uint32{0, 1, 2, 3, 4, 5, 6, 7, 8, 9},
+		pruned:  3,
+	}, {
+		name:    "middle",
+		start:   2,
+		end:     4,
+		heights: []uint32{2, 3, 4},
+		pruned:  1,
+	}, {
+		name:  "reversed",
+		start: 4,
+		end:   2,
+	}, {
+		name:  "beyond tip",
+		start: testBlocks,
+		end:   testBlocks + 5,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var heights []uint32
+			pruned := 0
+			err := db.ForEach(wire.GCSFilterExtended, test.start,
+				test.end, func(e *filterdb.Entry) error {
+					heights = append(heights, e.Height)
+					if e.Filter == nil {
+						pruned++
+					}
+					want := testEntry(t, e.Height,
+						wire.GCSFilterExtended)
+					if e.Header != want.Header {
+						t.Fatalf("height %d: wrong "+
+							"header", e.Height)
+					}
+					return nil
+				})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(heights, test.heights) {
+				t.Fatalf("heights %v, want %v", heights,
+					test.heights)
+			}
+			if pruned != test.pruned {
+				t.Fatalf("%d pruned filters, want %d", pruned,
+					test.pruned)
+			}
+		})
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	err := db.ForEach(wire.GCSFilterRegular, 0, testBlocks,
+		func(e *filterdb.Entry) error {
+			calls++
+			return stop
+		})
+	if err != stop || calls != 1 {
+		t.Fatalf("got error %v after %d calls, want %v after 1", err,
+			calls, stop)
+	}
+}
@@ -0,0 +1,248 @@
+// Package filterfile implements a compact, read-only flat-file format holding
+// the filters of a contiguous run of blocks, meant to be shipped as a
+// prebuilt snapshot and queried without a database. Files are memory-mapped
+// where the platform supports it, and filters are matched in place without
+// being copied.
+//
+// A file consists of a fixed header, the filter records, an index of record
+// offsets and a footer locating the index. All integers are little endian.
+//
+//	header:  magic "GCSFLAT1" | filter type (1) | P (1) | reserved (2) |
+//	         start height (4)
+//	record:  block hash (32) | filter header (32) | filter with N (variable)
+//	index:   record offset (8) for each record, in height order
+//	footer:  index offset (8) | record count (4) | magic "GCSF"
+//
+// Records are only ever appended: a Writer opened on an existing file
+// truncates the index, appends the new records and writes a fresh index and
+// footer when closed.
+package filterfile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/christsim/bips/bip-0158/backend/chainhash"
+	"github.com/christsim/bips/bip-0158/backend/wire"
+	"github.com/christsim/bips/bip-0158/gcs"
+)
+
+const (
+	// headerSize is the size of the file header.
+	headerSize = 16
+
+	// footerSize is the size of the file footer.
+	footerSize = 16
+
+	// recordPrefixSize is the size of the fixed part of a record that
+	// precedes the filter.
+	recordPrefixSize = 2 * chainhash.HashSize
+)
+
+var (
+	// headerMagic starts every filter file.
+	headerMagic = []byte("GCSFLAT1")
+
+	// footerMagic ends every complete filter file.
+	footerMagic = []byte("GCSF")
+)
+
+var (
+	// ErrBadFile is returned when opening a file that isn't a complete,
+	// well-formed filter file.
+	ErrBadFile = errors.New("malformed filter file")
+
+	// ErrHeightOutOfRange is returned when requesting the filter of a
+	// block that isn't in the file.
+	ErrHeightOutOfRange = errors.New("height not in filter file")
+
+	// ErrWrongP is returned when appending a filter whose P differs from
+	// the file's.
+	ErrWrongP = errors.New("filter has different P than file")
+)
+
+// File is an open, read-only filter file.
+type File struct {
+	data []byte
+
+	filterType  wire.FilterType
+	p           uint8
+	startHeight uint32
+
+	// index holds the offset of each record. The last record ends where
+	// the index starts.
+	index []byte
+	count uint32
+}
+
+// Open memory-maps the filter file at the passed path.
+func Open(path string) (*File, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() < headerSize+footerSize {
+		return nil, fmt.Errorf("%w: only %d bytes", ErrBadFile,
+			info.Size())
+	}
+
+	data, err := mmapFile(file, int(info.Size()))
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := parse(data)
+	if err != nil {
+		munmap(data)
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// parse validates the header, footer and index of a filter file.
+func parse(data []byte) (*File, error) {
+	if !bytes.Equal(data[:len(headerMagic)], headerMagic) {
+		return nil, fmt.Errorf("%w: bad header magic", ErrBadFile)
+	}
+	footer := data[len(data)-footerSize:]
+	if !bytes.Equal(footer[12:], footerMagic) {
+		return nil, fmt.Errorf("%w: bad footer magic, file may be "+
+			"incomplete", ErrBadFile)
+	}
+
+	f := &File{
+		data:        data,
+		filterType:  wire.FilterType(data[8]),
+		p:           data[9],
+		startHeight: binary.LittleEndian.Uint32(data[12:16]),
+		count:       binary.LittleEndian.Uint32(footer[8:12]),
+	}
+	if f.p > gcs.MaxP {
+		return nil, fmt.Errorf("%w: P of %d", ErrBadFile, f.p)
+	}
+
+	indexOffset := binary.LittleEndian.Uint64(footer[:8])
+	indexEnd := uint64(len(data) - footerSize)
+	if indexOffset < headerSize ||
+		indexEnd-indexOffset != 8*uint64(f.count) {
+
+		return nil, fmt.Errorf("%w: index doesn't fit", ErrBadFile)
+	}
+	f.index = data[indexOffset:indexEnd]
+
+	// Make sure the offsets are ordered and leave room for each record,
+	// so that lookups don't need to check them.
+	prev := uint64(headerSize)
+	for i := uint32(0); i < f.count; i++ {
+		offset := binary.LittleEndian.Uint64(f.index[8*i:])
+		if offset != prev {
+			return nil, fmt.Errorf("%w: record %d at offset %d, "+
+				"expected %d", ErrBadFile, i, offset, prev)
+		}
+		end := indexOffset
+		if i+1 < f.count {
+			end = binary.LittleEndian.Uint64(f.index[8*(i+1):])
+		}
+		if end < offset+recordPrefixSize+1 || end > indexOffset {
+			return nil, fmt.Errorf("%w: record %d is truncated",
+				ErrBadFile, i)
+		}
+		prev = end
+	}
+	if prev != indexOffset {
+		return nil, fmt.Errorf("%w: data between records and index",
+			ErrBadFile)
+	}
+
+	return f, nil
+}
+
+// Close unmaps the file. Filters returned by the file must not be used
+// afterwards.
+func (f *File) Close() error {
+	data := f.data
+	f.data = nil
+	f.index = nil
+	return munmap(data)
+}
+
+// FilterType returns the type of the filters in the file.
+func (f *File) FilterType() wire.FilterType {
+	return f.filterType
+}
+
+// P returns the collision probability parameter shared by the filters in the
+// file.
+func (f *File) P() uint8 {
+	return f.p
+}
+
+// StartHeight returns the height of the first block in the file.
+func (f *File) StartHeight() uint32 {
+	return f.startHeight
+}
+
+// Count returns the number of filters in the file.
+func (f *File) Count() uint32 {
+	return f.count
+}
+
+// record returns the record of the block at the passed height.
+func (f *File) record(height uint32) ([]byte, error) {
+	if height < f.startHeight || height-f.startHeight >= f.count {
+		return nil, fmt.Errorf("%w: %d", ErrHeightOutOfRange, height)
+	}
+
+	i := height - f.startHeight
+	start := binary.LittleEndian.Uint64(f.index[8*i:])
+	var end uint64
+	if i+1 < f.count {
+		end = binary.LittleEndian.Uint64(f.index[8*(i+1):])
+	} else {
+		end = binary.LittleEndian.Uint64(
+			f.data[len(f.data)-footerSize:])
+	}
+
+	return f.data[start:end], nil
+}
+
+// Filter returns the filter of the block at the passed height along with the
+// block's hash. The filter refers to the mapped file and is valid until the
+// file is closed.
+func (f *File) Filter(height uint32) (*gcs.Filter, *chainhash.Hash, error) {
+	record, err := f.record(height)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	blockHash, err := chainhash.NewHash(record[:chainhash.HashSize])
+	if err != nil {
+		return nil, nil, err
+	}
+	filter, err := gcs.FromNBytesNoCopy(f.p, record[recordPrefixSize:])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return filter, blockHash, nil
+}
+
+// Header returns the filter header of the block at the passed height.
+func (f *File) Header(height uint32) (*chainhash.Hash, error) {
+	record, err := f.record(height)
+	if err != nil {
+		return nil, err
+	}
+
+	return chainhash.NewHash(record[chainhash.HashSize:recordPrefixSize])
+}
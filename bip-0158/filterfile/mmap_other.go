@@ -0,0 +1,23 @@
+//go:build !unix
+
+package filterfile
+
+import (
+	"io"
+	"os"
+)
+
+// mmapFile reads the first size bytes of the file into memory, on platforms
+// where memory-mapping isn't supported.
+func mmapFile(file *os.File, size int) ([]byte, error) {
+	data := make([]byte, size)
+	if _, err := io.ReadFull(file, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// munmap releases memory returned by mmapFile.
+func munmap(data []byte) error {
+	return nil
+}
@@ -0,0 +1,22 @@
+//go:build unix
+
+package filterfile
+
+import (
+	"os"
+	"syscall"
+)
+
+// mmapFile maps the first size bytes of the file into memory read-only.
+func mmapFile(file *os.File, size int) ([]byte, error) {
+	return syscall.Mmap(int(file.Fd()), 0, size, syscall.PROT_READ,
+		syscall.MAP_SHARED)
+}
+
+// munmap unmaps memory returned by mmapFile.
+func munmap(data []byte) error {
+	if data == nil {
+		return nil
+	}
+	return syscall.Munmap(data)
+}
@@ -0,0 +1,172 @@
+package filterfile
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/christsim/bips/bip-0158/backend/chainhash"
+	"github.com/christsim/bips/bip-0158/backend/wire"
+	"github.com/christsim/bips/bip-0158/gcs"
+)
+
+// Writer appends filters to a filter file. The file is only valid once the
+// writer is closed, which writes its index.
+type Writer struct {
+	file *os.File
+	w    *bufio.Writer
+
+	p           uint8
+	startHeight uint32
+
+	// offset is the offset the next record will be written at.
+	offset  uint64
+	offsets []uint64
+}
+
+// Create creates a new filter file at the passed path for filters of the
+// passed type and P, starting at the passed block height. An existing file is
+// overwritten.
+func Create(path string, filterType wire.FilterType, p uint8,
+	startHeight uint32) (*Writer, error) {
+
+	if p > gcs.MaxP {
+		return nil, gcs.ErrPTooBig
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var header [headerSize]byte
+	copy(header[:], headerMagic)
+	header[8] = byte(filterType)
+	header[9] = p
+	binary.LittleEndian.PutUint32(header[12:], startHeight)
+	if _, err := file.Write(header[:]); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &Writer{
+		file:        file,
+		w:           bufio.NewWriter(file),
+		p:           p,
+		startHeight: startHeight,
+		offset:      headerSize,
+	}, nil
+}
+
+// OpenWriter opens an existing filter file at the passed path to append
+// filters to it. The existing index is dropped and rewritten when the writer
+// is closed, so the file can't be read in the meantime.
+func OpenWriter(path string) (*Writer, error) {
+	f, err := Open(path)
+	if err != nil {
+		return nil, err
+	}
+	offsets := make([]uint64, f.count)
+	for i := range offsets {
+		offsets[i] = binary.LittleEndian.Uint64(f.index[8*i:])
+	}
+	indexOffset := binary.LittleEndian.Uint64(
+		f.data[len(f.data)-footerSize:])
+	p, startHeight := f.p, f.startHeight
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := file.Truncate(int64(indexOffset)); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if _, err := file.Seek(int64(indexOffset), io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &Writer{
+		file:        file,
+		w:           bufio.NewWriter(file),
+		p:           p,
+		startHeight: startHeight,
+		offset:      indexOffset,
+		offsets:     offsets,
+	}, nil
+}
+
+// NextHeight returns the height of the block whose filter is to be appended
+// next.
+func (w *Writer) NextHeight() uint32 {
+	return w.startHeight + uint32(len(w.offsets))
+}
+
+// Append adds the filter of the block at NextHeight to the file, along with
+// the block's hash and the filter's header.
+func (w *Writer) Append(blockHash *chainhash.Hash, header *chainhash.Hash,
+	filter *gcs.Filter) error {
+
+	if filter.P() != w.p {
+		return fmt.Errorf("%w: %d, file has %d", ErrWrongP, filter.P(),
+			w.p)
+	}
+	nBytes, err := filter.NBytes()
+	if err != nil {
+		return err
+	}
+
+	if _, err := w.w.Write(blockHash[:]); err != nil {
+		return err
+	}
+	if _, err := w.w.Write(header[:]); err != nil {
+		return err
+	}
+	if _, err := w.w.Write(nBytes); err != nil {
+		return err
+	}
+
+	w.offsets = append(w.offsets, w.offset)
+	w.offset += uint64(recordPrefixSize + len(nBytes))
+
+	return nil
+}
+
+// Close writes the index and footer and closes the file.
+func (w *Writer) Close() error {
+	err := w.finish()
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// finish writes the index and footer and flushes the file to disk.
+func (w *Writer) finish() error {
+	var buf [8]byte
+	for _, offset := range w.offsets {
+		binary.LittleEndian.PutUint64(buf[:], offset)
+		if _, err := w.w.Write(buf[:]); err != nil {
+			return err
+		}
+	}
+
+	var footer [footerSize]byte
+	binary.LittleEndian.PutUint64(footer[:8], w.offset)
+	binary.LittleEndian.PutUint32(footer[8:12], uint32(len(w.offsets)))
+	copy(footer[12:], footerMagic)
+	if _, err := w.w.Write(footer[:]); err != nil {
+		return err
+	}
+
+	if err := w.w.Flush(); err != nil {
+		return err
+	}
+	return w.file.Sync()
+}
@@ -0,0 +1,106 @@
+package builder
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/christsim/bips/bip-0158/backend/btcutil"
+	"github.com/christsim/bips/bip-0158/backend/chaincfg"
+	"github.com/christsim/bips/bip-0158/backend/txscript"
+	"github.com/christsim/bips/bip-0158/gcs"
+	bech32 "github.com/christsim/bips/bip-0173"
+)
+
+var (
+	// ErrWrongNetwork is returned when an address is valid but belongs to
+	// a different network than the one it is being used with.
+	ErrWrongNetwork = errors.New("address is for a different network")
+
+	// ErrInvalidSegWitAddress is returned when a bech32 or bech32m
+	// address doesn't decode to a valid witness program.
+	ErrInvalidSegWitAddress = errors.New("invalid segwit address")
+)
+
+// AddressToScript returns the output script that pays to the passed address,
+// which may be a base58 P2PKH or P2SH address, a bech32 segwit v0 address or
+// a bech32m address for a later witness version such as P2TR.
+func AddressToScript(addr string, params *chaincfg.Params) ([]byte, error) {
+	// Bech32 encoded segwit addresses start with a human-readable part
+	// followed by '1'. If the prefix matches this network's, we decode it
+	// with the bip-0173 package so that witness versions beyond 0 are
+	// supported.
+	oneIndex := strings.LastIndexByte(addr, '1')
+	if oneIndex > 1 {
+		hrp := strings.ToLower(addr[:oneIndex])
+		if hrp == params.Bech32HRPSegwit {
+			version, program, err := bech32.DecodeSegwit(hrp, addr)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v",
+					ErrInvalidSegWitAddress, err)
+			}
+			return bech32.WitnessScript(version, program), nil
+		}
+	}
+
+	decoded, err := btcutil.DecodeAddress(addr, params)
+	if err != nil {
+		return nil, err
+	}
+	if !decoded.IsForNet(params) {
+		return nil, ErrWrongNetwork
+	}
+
+	return txscript.PayToAddrScript(decoded)
+}
+
+// AddressesToFilterEntries converts a list of addresses to the filter entries
+// that a basic filter would contain for outputs paying to them, suitable for
+// passing to gcs.Filter.MatchAny.
+func AddressesToFilterEntries(addrs []string,
+	params *chaincfg.Params) ([][]byte, error) {
+
+	entries := make([][]byte, 0, len(addrs))
+	for _, addr := range addrs {
+		script, err := AddressToScript(addr, params)
+		if err != nil {
+			return nil, fmt.Errorf("invalid address %v: %w", addr, err)
+		}
+		entries = append(entries, script)
+	}
+
+	return entries, nil
+}
+
+// MatchAddresses checks whether a basic filter likely (within collision
+// probability) contains an output paying to any of the passed addresses.
+func MatchAddresses(filter *gcs.Filter, key [gcs.KeySize]byte,
+	addrs []string, params *chaincfg.Params) (bool, error) {
+
+	entries, err := AddressesToFilterEntries(addrs, params)
+	if err != nil {
+		return false, err
+	}
+
+	return filter.MatchAny(key, entries)
+}
+
+// AddAddress adds the output script paying to the passed address to the list
+// of entries to be included in the GCS filter when it's built. If the address
+// can't be decoded for the passed network, the builder errors out.
+func (b *GCSBuilder) AddAddress(addr string,
+	params *chaincfg.Params) *GCSBuilder {
+
+	// Do nothing if the builder's already errored out.
+	if b.err != nil {
+		return b
+	}
+
+	script, err := AddressToScript(addr, params)
+	if err != nil {
+		b.err = err
+		return b
+	}
+
+	return b.AddEntry(script)
+}
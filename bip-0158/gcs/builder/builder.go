@@ -0,0 +1,401 @@
+// Package builder provides helpers for building BIP 158 GCS filters out of
+// Bitcoin-specific data such as outpoints, transaction hashes and scripts.
+package builder
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"sort"
+
+	"github.com/christsim/bips/bip-0158/backend/chainhash"
+	"github.com/christsim/bips/bip-0158/backend/wire"
+	"github.com/christsim/bips/bip-0158/gcs"
+	"github.com/christsim/bips/bip-0158/script"
+)
+
+// DefaultP is the default collision probability (2^-20)
+const DefaultP = 20
+
+// GCSBuilder is a utility class that makes building GCS filters convenient.
+type GCSBuilder struct {
+	p   uint8
+	key [gcs.KeySize]byte
+
+	// m is the inverse collision probability, or zero for 2^p.
+	m uint64
+
+	// data is a set of entries represented as strings. This is done to
+	// deduplicate items as they are added.
+	data map[string]struct{}
+	err  error
+
+	// scriptTypes restricts the output scripts added through
+	// AddOutputScript.
+	scriptTypes ScriptTypeSet
+
+	// entries and arena are scratch space for Build, holding the entries
+	// as byte slices backed by a single buffer. They are kept across
+	// calls to Reset so that a reused builder doesn't allocate them
+	// again.
+	entries [][]byte
+	arena   []byte
+}
+
+// RandomKey is a utility function that returns a cryptographically random
+// [gcs.KeySize]byte usable as a key for a GCS filter.
+func RandomKey() ([gcs.KeySize]byte, error) {
+	var key [gcs.KeySize]byte
+
+	// Read the key material directly from the system CSPRNG. This
+	// shouldn't fail unless the user is on a system that doesn't have one.
+	if _, err := rand.Read(key[:]); err != nil {
+		return key, err
+	}
+
+	return key, nil
+}
+
+// DeriveKey is a utility function that derives a key from a chainhash.Hash by
+// truncating the bytes of the hash to the appropriate key size. It is the
+// same as gcs.DeriveKey, which code that only matches filters can use without
+// depending on this package.
+func DeriveKey(keyHash *chainhash.Hash) [gcs.KeySize]byte {
+	return gcs.DeriveKey(keyHash)
+}
+
+// OutPointToFilterEntry is a utility function that derives a filter entry from
+// a wire.OutPoint in a standardized way for use with both building and
+// querying filters.
+func OutPointToFilterEntry(outpoint wire.OutPoint) []byte {
+	// Size of the hash plus size of int32 index
+	data := make([]byte, chainhash.HashSize+4)
+	copy(data[:], outpoint.Hash[:])
+	binary.LittleEndian.PutUint32(data[chainhash.HashSize:], outpoint.Index)
+	return data
+}
+
+// Key retrieves the key with which the builder will build a filter. This is
+// useful if the builder is created with a random initial key.
+func (b *GCSBuilder) Key() ([gcs.KeySize]byte, error) {
+	// Do nothing if the builder's errored out.
+	if b.err != nil {
+		return [gcs.KeySize]byte{}, b.err
+	}
+
+	return b.key, nil
+}
+
+// SetKey sets the key with which the builder will build a filter to the passed
+// [gcs.KeySize]byte.
+func (b *GCSBuilder) SetKey(key [gcs.KeySize]byte) *GCSBuilder {
+	// Do nothing if the builder's already errored out.
+	if b.err != nil {
+		return b
+	}
+
+	b.key = key
+	return b
+}
+
+// SetKeyFromHash sets the key with which the builder will build a filter to a
+// key derived from the passed chainhash.Hash using DeriveKey().
+func (b *GCSBuilder) SetKeyFromHash(keyHash *chainhash.Hash) *GCSBuilder {
+	// Do nothing if the builder's already errored out.
+	if b.err != nil {
+		return b
+	}
+
+	return b.SetKey(DeriveKey(keyHash))
+}
+
+// SetP sets the filter's probability after calling Builder().
+func (b *GCSBuilder) SetP(p uint8) *GCSBuilder {
+	// Do nothing if the builder's already errored out.
+	if b.err != nil {
+		return b
+	}
+
+	// Basic sanity check.
+	if p > gcs.MaxP {
+		b.err = gcs.ErrPTooBig
+		return b
+	}
+
+	b.p = p
+	return b
+}
+
+// SetM sets the inverse collision probability of the filter independently of
+// P, as for gcs.BuildGCSFilterM. Zero restores the default of 2^P.
+func (b *GCSBuilder) SetM(m uint64) *GCSBuilder {
+	// Do nothing if the builder's already errored out.
+	if b.err != nil {
+		return b
+	}
+
+	// Basic sanity check.
+	if m > gcs.MaxM {
+		b.err = gcs.ErrInvalidM
+		return b
+	}
+
+	b.m = m
+	return b
+}
+
+// Preallocate sets the estimated filter size after calling Builder() to reduce
+// the probability of memory reallocations. If the builder has already had data
+// added to it, Preallocate has no effect.
+func (b *GCSBuilder) Preallocate(n uint32) *GCSBuilder {
+	// Do nothing if the builder's already errored out.
+	if b.err != nil {
+		return b
+	}
+
+	if b.data == nil {
+		b.data = make(map[string]struct{}, n)
+	}
+
+	return b
+}
+
+// AddEntry adds a []byte to the list of entries to be included in the GCS
+// filter when it's built.
+func (b *GCSBuilder) AddEntry(data []byte) *GCSBuilder {
+	// Do nothing if the builder's already errored out.
+	if b.err != nil {
+		return b
+	}
+
+	b.data[string(data)] = struct{}{}
+	return b
+}
+
+// AddEntries adds all the []byte entries in a [][]byte to the list of entries
+// to be included in the GCS filter when it's built.
+func (b *GCSBuilder) AddEntries(data [][]byte) *GCSBuilder {
+	// Do nothing if the builder's already errored out.
+	if b.err != nil {
+		return b
+	}
+
+	for _, entry := range data {
+		b.AddEntry(entry)
+	}
+	return b
+}
+
+// AddOutPoint adds a wire.OutPoint to the list of entries to be included in
+// the GCS filter when it's built.
+func (b *GCSBuilder) AddOutPoint(outpoint wire.OutPoint) *GCSBuilder {
+	// Do nothing if the builder's already errored out.
+	if b.err != nil {
+		return b
+	}
+
+	return b.AddEntry(OutPointToFilterEntry(outpoint))
+}
+
+// AddHash adds a chainhash.Hash to the list of entries to be included in the
+// GCS filter when it's built.
+func (b *GCSBuilder) AddHash(hash *chainhash.Hash) *GCSBuilder {
+	// Do nothing if the builder's already errored out.
+	if b.err != nil {
+		return b
+	}
+
+	return b.AddEntry(hash[:])
+}
+
+// AddScript adds all the data pushed in the script serialized as the passed
+// []byte to the list of entries to be included in the GCS filter when it's
+// built.
+func (b *GCSBuilder) AddScript(raw []byte) *GCSBuilder {
+	// Do nothing if the builder's already errored out.
+	if b.err != nil {
+		return b
+	}
+
+	// Ignore errors and add pushed data, if any
+	data, _ := script.PushedData(raw)
+	if len(data) == 0 {
+		return b
+	}
+
+	return b.AddEntries(data)
+}
+
+// AddWitness adds each item of the passed witness stack to the list of
+// entries to be included in the GCS filter when it's built.
+func (b *GCSBuilder) AddWitness(witness wire.TxWitness) *GCSBuilder {
+	// Do nothing if the builder's already errored out.
+	if b.err != nil {
+		return b
+	}
+
+	return b.AddEntries(witness)
+}
+
+// Build returns a function which builds a GCS filter with the given parameters
+// and data.
+func (b *GCSBuilder) Build() (*gcs.Filter, error) {
+	// Do nothing if the builder's already errored out.
+	if b.err != nil {
+		return nil, b.err
+	}
+
+	// The filter doesn't retain the entries it is built from, so they
+	// can live in the builder's scratch space.
+	size := 0
+	for item := range b.data {
+		size += len(item)
+	}
+	if cap(b.arena) < size {
+		b.arena = make([]byte, 0, size)
+	}
+	arena := b.arena[:0]
+	entries := b.entries[:0]
+	for item := range b.data {
+		start := len(arena)
+		arena = append(arena, item...)
+		entries = append(entries, arena[start:len(arena):len(arena)])
+	}
+	b.arena, b.entries = arena, entries
+
+	if b.m != 0 {
+		return gcs.BuildGCSFilterM(b.p, b.m, b.key, entries)
+	}
+	return gcs.BuildGCSFilter(b.p, b.key, entries)
+}
+
+// Entries returns the distinct entries added to the builder so far, sorted
+// bytewise so that the result is deterministic.
+func (b *GCSBuilder) Entries() ([][]byte, error) {
+	// Do nothing if the builder's errored out.
+	if b.err != nil {
+		return nil, b.err
+	}
+
+	entries := make([][]byte, 0, len(b.data))
+	for item := range b.data {
+		entries = append(entries, []byte(item))
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return bytes.Compare(entries[i], entries[j]) < 0
+	})
+
+	return entries, nil
+}
+
+// EstimateSize predicts the length in bytes of the serialized filter that
+// Build would currently produce, based on the number of distinct entries
+// added so far and the builder's probability. It doesn't perform any hashing
+// or encoding, so it is cheap enough to call as entries are added.
+func (b *GCSBuilder) EstimateSize() (int, error) {
+	// Do nothing if the builder's errored out.
+	if b.err != nil {
+		return 0, b.err
+	}
+
+	if b.m != 0 {
+		return gcs.EstimateSizeM(uint32(len(b.data)), b.p, b.m), nil
+	}
+	return gcs.EstimateSize(uint32(len(b.data)), b.p), nil
+}
+
+// WithKeyPN creates a GCSBuilder with specified key and the passed probability
+// and estimated filter size.
+func WithKeyPN(key [gcs.KeySize]byte, p uint8, n uint32) *GCSBuilder {
+	b := GCSBuilder{scriptTypes: AllScriptTypes}
+	return b.SetKey(key).SetP(p).Preallocate(n)
+}
+
+// WithKeyP creates a GCSBuilder with specified key and the passed probability.
+// Estimated filter size is set to zero, which means more reallocations are
+// done when building the filter.
+func WithKeyP(key [gcs.KeySize]byte, p uint8) *GCSBuilder {
+	return WithKeyPN(key, p, 0)
+}
+
+// WithKey creates a GCSBuilder with specified key. Probability is set to
+// 20 (2^-20 collision probability). Estimated filter size is set to zero, which
+// means more reallocations are done when building the filter.
+func WithKey(key [gcs.KeySize]byte) *GCSBuilder {
+	return WithKeyPN(key, DefaultP, 0)
+}
+
+// WithKeyHashPN creates a GCSBuilder with key derived from the specified
+// chainhash.Hash and the passed probability and estimated filter size.
+func WithKeyHashPN(keyHash *chainhash.Hash, p uint8, n uint32) *GCSBuilder {
+	return WithKeyPN(DeriveKey(keyHash), p, n)
+}
+
+// WithKeyHashP creates a GCSBuilder with key derived from the specified
+// chainhash.Hash and the passed probability. Estimated filter size is set to
+// zero, which means more reallocations are done when building the filter.
+func WithKeyHashP(keyHash *chainhash.Hash, p uint8) *GCSBuilder {
+	return WithKeyHashPN(keyHash, p, 0)
+}
+
+// WithKeyHash creates a GCSBuilder with key derived from the specified
+// chainhash.Hash. Probability is set to 20 (2^-20 collision probability).
+// Estimated filter size is set to zero, which means more reallocations are
+// done when building the filter.
+func WithKeyHash(keyHash *chainhash.Hash) *GCSBuilder {
+	return WithKeyHashPN(keyHash, DefaultP, 0)
+}
+
+// WithRandomKeyPN creates a GCSBuilder with a cryptographically random key and
+// the passed probability and estimated filter size.
+func WithRandomKeyPN(p uint8, n uint32) *GCSBuilder {
+	key, err := RandomKey()
+	if err != nil {
+		return &GCSBuilder{err: err}
+	}
+	return WithKeyPN(key, p, n)
+}
+
+// WithRandomKeyP creates a GCSBuilder with a cryptographically random key and
+// the passed probability. Estimated filter size is set to zero, which means
+// more reallocations are done when building the filter.
+func WithRandomKeyP(p uint8) *GCSBuilder {
+	return WithRandomKeyPN(p, 0)
+}
+
+// WithRandomKey creates a GCSBuilder with a cryptographically random key.
+// Probability is set to 20 (2^-20 collision probability). Estimated filter
+// size is set to zero, which means more reallocations are done when
+// building the filter.
+func WithRandomKey() *GCSBuilder {
+	return WithRandomKeyPN(DefaultP, 0)
+}
+
+// GetFilterHash returns the double-SHA256 of the filter.
+func GetFilterHash(filter *gcs.Filter) (chainhash.Hash, error) {
+	filterData, err := filter.NBytes()
+	if err != nil {
+		return chainhash.Hash{}, err
+	}
+
+	return chainhash.DoubleHashH(filterData), nil
+}
+
+// MakeHeaderForFilter makes a filter chain header for a filter, given the
+// filter and the previous filter chain header.
+func MakeHeaderForFilter(filter *gcs.Filter, prevHeader chainhash.Hash) (chainhash.Hash, error) {
+	filterTip := make([]byte, 2*chainhash.HashSize)
+	filterHash, err := GetFilterHash(filter)
+	if err != nil {
+		return chainhash.Hash{}, err
+	}
+
+	// In the buffer we created above we'll compute hash || prevHash as an
+	// intermediate value.
+	copy(filterTip, filterHash[:])
+	copy(filterTip[chainhash.HashSize:], prevHeader[:])
+
+	// The final filter hash is the double-sha256 of the hash computed
+	// above.
+	return chainhash.DoubleHashH(filterTip), nil
+}
@@ -0,0 +1,406 @@
+package builder_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/christsim/bips/bip-0158/backend/chainhash"
+	"github.com/christsim/bips/bip-0158/backend/wire"
+	"github.com/christsim/bips/bip-0158/gcs"
+	"github.com/christsim/bips/bip-0158/gcs/builder"
+)
+
+// vectorP is the Golomb-Rice parameter of the filters of testnet-20.json.
+const vectorP = 20
+
+// vectorBlock is a block of testnet-20.json along with its basic and
+// extended filters and headers.
+type vectorBlock struct {
+	height      float64
+	raw         []byte
+	block       *wire.MsgBlock
+	prevHeaders [2]chainhash.Hash
+	filters     [2][]byte
+	headers     [2]chainhash.Hash
+	notes       string
+}
+
+// loadBlocks reads the blocks of testnet-20.json, skipping its header row.
+func loadBlocks(t *testing.T) []vectorBlock {
+	t.Helper()
+
+	data, err := os.ReadFile("../../testnet-20.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rows [][]interface{}
+	if err := json.Unmarshal(data, &rows); err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) < 2 {
+		t.Fatal("no test cases in testnet-20.json")
+	}
+
+	hexField := func(row []interface{}, i int) []byte {
+		t.Helper()
+		b, err := hex.DecodeString(row[i].(string))
+		if err != nil {
+			t.Fatalf("row %v: field %d: %v", row[0], i, err)
+		}
+		return b
+	}
+	hashField := func(row []interface{}, i int) chainhash.Hash {
+		t.Helper()
+		hash, err := chainhash.NewHashFromStr(row[i].(string))
+		if err != nil {
+			t.Fatalf("row %v: field %d: %v", row[0], i, err)
+		}
+		return *hash
+	}
+
+	var blocks []vectorBlock
+	for _, row := range rows[1:] {
+		if len(row) != 10 {
+			t.Fatalf("row %v has %d fields", row[0], len(row))
+		}
+		raw := hexField(row, 2)
+		block := &wire.MsgBlock{}
+		if err := block.Deserialize(bytes.NewReader(raw)); err != nil {
+			t.Fatalf("row %v: %v", row[0], err)
+		}
+		blocks = append(blocks, vectorBlock{
+			height: row[0].(float64),
+			raw:    raw,
+			block:  block,
+			prevHeaders: [2]chainhash.Hash{
+				hashField(row, 3), hashField(row, 4),
+			},
+			filters: [2][]byte{hexField(row, 5), hexField(row, 6)},
+			headers: [2]chainhash.Hash{
+				hashField(row, 7), hashField(row, 8),
+			},
+			notes: row[9].(string),
+		})
+	}
+	return blocks
+}
+
+// TestBuildFilter checks that BuildFilter, BuildFilters and
+// BuildElementFilter build the same filters of every block of
+// testnet-20.json under each policy that needs nothing but the block, and
+// that the basic and extended filters are those of the vectors.
+func TestBuildFilter(t *testing.T) {
+	ps := []uint8{1, vectorP, gcs.MaxP}
+
+	tests := []struct {
+		policy builder.FilterPolicy
+
+		// vector is the index of the policy's filters in the vectors,
+		// or -1 if the vectors don't have them.
+		vector int
+	}{
+		{builder.BasicPolicy{ScriptTypes: builder.AllScriptTypes}, 0},
+		{builder.ExtendedPolicy{}, 1},
+		{builder.SpentOutpointsPolicy{}, -1},
+		{builder.LegacyBasicPolicy{}, -1},
+	}
+
+	for _, vb := range loadBlocks(t) {
+		elements := builder.ExtractElements(vb.block)
+
+		for _, test := range tests {
+			name := test.policy.Name()
+			filter, err := builder.BuildFilter(test.policy, vb.block,
+				vectorP)
+			if err != nil {
+				t.Fatalf("height %v, %s: %v", vb.height, name, err)
+			}
+			want, err := filter.NBytes()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.vector >= 0 &&
+				!bytes.Equal(want, vb.filters[test.vector]) {
+
+				t.Fatalf("height %v (%s), %s filter: got %x, "+
+					"want %x", vb.height, vb.notes, name,
+					want, vb.filters[test.vector])
+			}
+
+			fromElements, err := builder.BuildElementFilter(
+				test.policy, elements, vectorP)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := fromElements.NBytes()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Fatalf("height %v, %s: element filter %x, "+
+					"want %x", vb.height, name, got, want)
+			}
+
+			filters, err := builder.BuildFilters(test.policy,
+				vb.block, ps)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, p := range ps {
+				single, err := builder.BuildFilter(test.policy,
+					vb.block, p)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := filters[i].NBytes()
+				if err != nil {
+					t.Fatal(err)
+				}
+				want, err := single.NBytes()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, want) {
+					t.Fatalf("height %v, %s, P = %d: "+
+						"BuildFilters %x, BuildFilter "+
+						"%x", vb.height, name, p, got,
+						want)
+				}
+			}
+		}
+	}
+}
+
+// TestGCSBuilderEntries checks the distinct entries builders hold after
+// adding elements of each kind.
+func TestGCSBuilderEntries(t *testing.T) {
+	outpoint := wire.OutPoint{Hash: chainhash.HashH([]byte("tx")), Index: 1}
+	txHash := chainhash.HashH([]byte("tx"))
+
+	tests := []struct {
+		name    string
+		add     func(b *builder.GCSBuilder)
+		entries [][]byte
+	}{{
+		name:    "nothing",
+		add:     func(b *builder.GCSBuilder) {},
+		entries: [][]byte{},
+	}, {
+		name: "duplicate entries",
+		add: func(b *builder.GCSBuilder) {
+			b.AddEntry([]byte{2}).AddEntry([]byte{1})
+			b.AddEntries([][]byte{{2}, {1}, {}})
+		},
+		entries: [][]byte{{}, {1}, {2}},
+	}, {
+		name: "script pushes",
+		add: func(b *builder.GCSBuilder) {
+			b.AddScript([]byte{0x02, 0xaa, 0xbb, 0x51, 0x01, 0xcc})
+		},
+		entries: [][]byte{{0xaa, 0xbb}, {0xcc}},
+	}, {
+		name: "malformed script",
+		add: func(b *builder.GCSBuilder) {
+			b.AddScript([]byte{0x05, 0xaa})
+		},
+		entries: [][]byte{},
+	}, {
+		name: "witness",
+		add: func(b *builder.GCSBuilder) {
+			b.AddWitness(wire.TxWitness{{0xaa}, {}, {0xaa}})
+		},
+		entries: [][]byte{{}, {0xaa}},
+	}, {
+		name: "outpoint and hash",
+		add: func(b *builder.GCSBuilder) {
+			b.AddOutPoint(outpoint).AddHash(&txHash)
+		},
+		entries: [][]byte{
+			builder.OutPointToFilterEntry(outpoint), txHash[:],
+		},
+	}, {
+		name: "restricted output scripts",
+		add: func(b *builder.GCSBuilder) {
+			b.SetScriptTypes(builder.NewScriptTypeSet(
+				builder.ScriptTypeNullData))
+			b.AddOutputScript([]byte{0x6a, 0x01, 0xaa})
+			b.AddOutputScript([]byte{0x51})
+		},
+		entries: [][]byte{{0x6a, 0x01, 0xaa}},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b := builder.WithKeyP([gcs.KeySize]byte{}, vectorP)
+			test.add(b)
+			entries, err := b.Entries()
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := test.entries
+			sort.Slice(want, func(i, j int) bool {
+				return bytes.Compare(want[i], want[j]) < 0
+			})
+			if !reflect.DeepEqual(entries, want) {
+				t.Fatalf("entries %x, want %x", entries, want)
+			}
+
+			filter, err := b.Build()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if int(filter.N()) != len(want) {
+				t.Fatalf("N = %d, want %d", filter.N(), len(want))
+			}
+		})
+	}
+}
+
+// TestGCSBuilderErrors checks that invalid parameters and unresolvable
+// policies make the builder fail, and that the failure sticks.
+func TestGCSBuilderErrors(t *testing.T) {
+	block := loadBlocks(t)[1].block
+
+	tests := []struct {
+		name  string
+		build func() (*gcs.Filter, error)
+		err   error
+	}{{
+		name: "P too big",
+		build: func() (*gcs.Filter, error) {
+			b := builder.WithKeyP([gcs.KeySize]byte{}, gcs.MaxP+1)
+			return b.AddEntry([]byte{1}).Build()
+		},
+		err: gcs.ErrPTooBig,
+	}, {
+		name: "M too big",
+		build: func() (*gcs.Filter, error) {
+			b := builder.WithKey([gcs.KeySize]byte{})
+			return b.SetM(gcs.MaxM + 1).SetP(vectorP).Build()
+		},
+		err: gcs.ErrInvalidM,
+	}, {
+		name: "no previous output scripts",
+		build: func() (*gcs.Filter, error) {
+			return builder.BuildFilter(builder.SpecBasicPolicy{},
+				block, vectorP)
+		},
+		err: builder.ErrNoPrevScripts,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := test.build()
+			if !errors.Is(err, test.err) {
+				t.Fatalf("got error %v, want %v", err, test.err)
+			}
+		})
+	}
+}
+
+// TestPolicies checks the registry of filter policies.
+func TestPolicies(t *testing.T) {
+	want := []string{
+		"basic", "extended", "legacy-basic", "spec-basic",
+		"spent-outpoints",
+	}
+	names := builder.PolicyNames()
+	for _, name := range want {
+		policy, err := builder.LookupPolicy(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if policy.Name() != name {
+			t.Fatalf("policy %q is named %q", name, policy.Name())
+		}
+		found := false
+		for _, registered := range names {
+			found = found || registered == name
+		}
+		if !found {
+			t.Fatalf("%q missing from %v", name, names)
+		}
+	}
+
+	_, err := builder.LookupPolicy("no-such-policy")
+	if !errors.Is(err, builder.ErrUnknownPolicy) {
+		t.Fatalf("got error %v, want %v", err, builder.ErrUnknownPolicy)
+	}
+	err = builder.RegisterPolicy(builder.ExtendedPolicy{})
+	if !errors.Is(err, builder.ErrDuplicatePolicy) {
+		t.Fatalf("got error %v, want %v", err,
+			builder.ErrDuplicatePolicy)
+	}
+}
+
+// TestParseScriptTypeSet parses lists of script types.
+func TestParseScriptTypeSet(t *testing.T) {
+	tests := []struct {
+		list string
+		set  builder.ScriptTypeSet
+		ok   bool
+	}{
+		{"", 0, true},
+		{"p2wpkh", builder.NewScriptTypeSet(builder.ScriptTypeP2WPKH),
+			true},
+		{" P2TR , p2wpkh,", builder.NewScriptTypeSet(
+			builder.ScriptTypeP2WPKH, builder.ScriptTypeP2TR), true},
+		{builder.AllScriptTypes.String(), builder.AllScriptTypes, true},
+		{"p2wpkh,p2foo", 0, false},
+	}
+
+	for _, test := range tests {
+		set, err := builder.ParseScriptTypeSet(test.list)
+		if (err == nil) != test.ok {
+			t.Fatalf("%q: got error %v", test.list, err)
+		}
+		if set != test.set {
+			t.Fatalf("%q: got %v, want %v", test.list, set, test.set)
+		}
+	}
+}
+
+// TestClassifyScript classifies an output script of each type.
+func TestClassifyScript(t *testing.T) {
+	hash20 := bytes.Repeat([]byte{0xaa}, 20)
+	hash32 := bytes.Repeat([]byte{0xbb}, 32)
+	pubKey := append([]byte{0x02}, hash32...)
+
+	join := func(parts ...[]byte) []byte {
+		return bytes.Join(parts, nil)
+	}
+
+	tests := []struct {
+		script []byte
+		want   builder.ScriptType
+	}{
+		{join([]byte{0x21}, pubKey, []byte{0xac}),
+			builder.ScriptTypeP2PK},
+		{join([]byte{0x76, 0xa9, 0x14}, hash20, []byte{0x88, 0xac}),
+			builder.ScriptTypeP2PKH},
+		{join([]byte{0xa9, 0x14}, hash20, []byte{0x87}),
+			builder.ScriptTypeP2SH},
+		{join([]byte{0x51, 0x21}, pubKey, []byte{0x51, 0xae}),
+			builder.ScriptTypeMultiSig},
+		{[]byte{0x6a, 0x01, 0xaa}, builder.ScriptTypeNullData},
+		{join([]byte{0x00, 0x14}, hash20), builder.ScriptTypeP2WPKH},
+		{join([]byte{0x00, 0x20}, hash32), builder.ScriptTypeP2WSH},
+		{join([]byte{0x51, 0x20}, hash32), builder.ScriptTypeP2TR},
+		{join([]byte{0x52, 0x14}, hash20),
+			builder.ScriptTypeWitnessUnknown},
+		{[]byte{0x05, 0xaa}, builder.ScriptTypeNonStandard},
+	}
+
+	for _, test := range tests {
+		if got := builder.ClassifyScript(test.script); got != test.want {
+			t.Fatalf("%x: got %v, want %v", test.script, got,
+				test.want)
+		}
+	}
+}
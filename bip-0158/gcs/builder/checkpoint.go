@@ -0,0 +1,155 @@
+package builder
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/christsim/bips/bip-0158/backend/chainhash"
+	"github.com/christsim/bips/bip-0158/backend/wire"
+)
+
+// CheckpointInterval is the number of blocks between the filter headers
+// served in a cfcheckpt message. The first checkpoint is the filter header of
+// the block at this height, the second at twice this height and so on.
+const CheckpointInterval = wire.CFCheckptInterval
+
+var (
+	// ErrPrevHeaderMismatch is returned when the previous filter header of
+	// a run of filter headers doesn't match the checkpoint (or the all-zero
+	// genesis header) it should link to.
+	ErrPrevHeaderMismatch = errors.New("previous filter header doesn't " +
+		"link to checkpoint")
+
+	// ErrNotAnchored is returned when a run of filter headers neither
+	// starts from nor contains any checkpoint, so that nothing about it
+	// can be verified.
+	ErrNotAnchored = errors.New("filter headers aren't anchored to any " +
+		"checkpoint")
+)
+
+// CheckpointHeight returns the block height of the checkpoint at the passed
+// index of a cfcheckpt message.
+func CheckpointHeight(index int) uint32 {
+	return uint32(index+1) * CheckpointInterval
+}
+
+// checkpointAt returns the checkpointed filter header for the passed height,
+// if there is one.
+func checkpointAt(checkpoints []chainhash.Hash,
+	height uint32) (chainhash.Hash, bool) {
+
+	if height == 0 || height%CheckpointInterval != 0 {
+		return chainhash.Hash{}, false
+	}
+
+	index := int(height/CheckpointInterval) - 1
+	if index >= len(checkpoints) {
+		return chainhash.Hash{}, false
+	}
+
+	return checkpoints[index], true
+}
+
+// HeadersFromHashes derives the filter headers committed to by a run of filter
+// hashes, given the filter header preceding the first of them.
+func HeadersFromHashes(prevHeader chainhash.Hash,
+	filterHashes []chainhash.Hash) []chainhash.Hash {
+
+	headers := make([]chainhash.Hash, len(filterHashes))
+	var filterTip [2 * chainhash.HashSize]byte
+	for i, filterHash := range filterHashes {
+		copy(filterTip[:], filterHash[:])
+		copy(filterTip[chainhash.HashSize:], prevHeader[:])
+		headers[i] = chainhash.DoubleHashH(filterTip[:])
+		prevHeader = headers[i]
+	}
+
+	return headers
+}
+
+// VerifyCFHeaders checks a contiguous run of filter hashes, as served in a
+// cfheaders message, against the filter header checkpoints served in a
+// cfcheckpt message. startHeight is the height of the block the first filter
+// hash belongs to, and prevHeader is the filter header of the block before
+// it.
+//
+// The run must link to the checkpoints: if the block before the run is
+// checkpointed (or is the parent of the genesis block) then prevHeader must
+// match it, and every checkpointed height within the run must match the
+// derived header. A run that isn't constrained by any checkpoint is rejected
+// with ErrNotAnchored, since a client would have no reason to trust it. On
+// success, the derived filter headers are returned.
+func VerifyCFHeaders(checkpoints []chainhash.Hash, startHeight uint32,
+	prevHeader chainhash.Hash,
+	filterHashes []chainhash.Hash) ([]chainhash.Hash, error) {
+
+	anchored := false
+
+	// First, make sure the run starts from the right place. The filter
+	// header preceding the genesis block is defined to be all zeros.
+	if startHeight == 0 {
+		if prevHeader != (chainhash.Hash{}) {
+			return nil, fmt.Errorf("%w: expected zero header before "+
+				"genesis, got %v", ErrPrevHeaderMismatch,
+				prevHeader)
+		}
+		anchored = true
+	} else if expected, ok := checkpointAt(checkpoints, startHeight-1); ok {
+		if prevHeader != expected {
+			return nil, fmt.Errorf("%w: height %d has header %v, "+
+				"expected %v", ErrPrevHeaderMismatch,
+				startHeight-1, prevHeader, expected)
+		}
+		anchored = true
+	}
+
+	// Next, derive the headers for the run and check each one that falls
+	// on a checkpoint.
+	headers := HeadersFromHashes(prevHeader, filterHashes)
+	for i, header := range headers {
+		height := startHeight + uint32(i)
+		expected, ok := checkpointAt(checkpoints, height)
+		if !ok {
+			continue
+		}
+
+		if header != expected {
+			return nil, fmt.Errorf("%w: height %d has header %v, "+
+				"expected %v", ErrCheckpointMismatch, height,
+				header, expected)
+		}
+		anchored = true
+	}
+
+	if !anchored {
+		return nil, ErrNotAnchored
+	}
+
+	return headers, nil
+}
+
+// VerifyCFHeadersMsg is a convenience wrapper around VerifyCFHeaders which
+// takes the checkpoints and filter hashes directly from cfcheckpt and
+// cfheaders messages.
+func VerifyCFHeadersMsg(checkpt *wire.MsgCFCheckpt, startHeight uint32,
+	cfheaders *wire.MsgCFHeaders) ([]chainhash.Hash, error) {
+
+	if checkpt.FilterType != cfheaders.FilterType {
+		return nil, fmt.Errorf("filter type mismatch: cfcheckpt has %v, "+
+			"cfheaders has %v", checkpt.FilterType,
+			cfheaders.FilterType)
+	}
+
+	checkpoints := make([]chainhash.Hash, len(checkpt.FilterHeaders))
+	for i, header := range checkpt.FilterHeaders {
+		checkpoints[i] = *header
+	}
+
+	filterHashes := make([]chainhash.Hash, len(cfheaders.FilterHashes))
+	for i, filterHash := range cfheaders.FilterHashes {
+		filterHashes[i] = *filterHash
+	}
+
+	return VerifyCFHeaders(checkpoints, startHeight,
+		cfheaders.PrevFilterHeader, filterHashes)
+}
@@ -0,0 +1,145 @@
+package builder_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/christsim/bips/bip-0158/backend/chainhash"
+	"github.com/christsim/bips/bip-0158/backend/wire"
+	"github.com/christsim/bips/bip-0158/gcs/builder"
+)
+
+// TestVerifyCFHeaders checks runs of filter hashes starting at various
+// heights against the checkpoints of a chain of two checkpoint intervals.
+func TestVerifyCFHeaders(t *testing.T) {
+	const n = 2*builder.CheckpointInterval + 1
+
+	filterHashes := make([]chainhash.Hash, n)
+	for i := range filterHashes {
+		filterHashes[i] = chainhash.HashH([]byte{byte(i), byte(i >> 8)})
+	}
+	headers := builder.HeadersFromHashes(chainhash.Hash{}, filterHashes)
+	checkpoints := []chainhash.Hash{
+		headers[builder.CheckpointHeight(0)],
+		headers[builder.CheckpointHeight(1)],
+	}
+
+	// tampered has the filter hash of the second checkpoint replaced.
+	tampered := append([]chainhash.Hash(nil), filterHashes...)
+	tampered[builder.CheckpointHeight(1)] = chainhash.Hash{}
+
+	prevHeader := func(height uint32) chainhash.Hash {
+		if height == 0 {
+			return chainhash.Hash{}
+		}
+		return headers[height-1]
+	}
+
+	tests := []struct {
+		name   string
+		start  uint32
+		end    uint32
+		prev   chainhash.Hash
+		hashes []chainhash.Hash
+		err    error
+	}{{
+		name:   "from genesis",
+		start:  0,
+		end:    10,
+		prev:   prevHeader(0),
+		hashes: filterHashes,
+	}, {
+		name:   "whole chain",
+		start:  0,
+		end:    n,
+		prev:   prevHeader(0),
+		hashes: filterHashes,
+	}, {
+		name:   "nonzero header before genesis",
+		start:  0,
+		end:    10,
+		prev:   headers[5],
+		hashes: filterHashes,
+		err:    builder.ErrPrevHeaderMismatch,
+	}, {
+		name:   "after checkpoint",
+		start:  builder.CheckpointHeight(0) + 1,
+		end:    builder.CheckpointHeight(0) + 10,
+		prev:   prevHeader(builder.CheckpointHeight(0) + 1),
+		hashes: filterHashes,
+	}, {
+		name:   "wrong header after checkpoint",
+		start:  builder.CheckpointHeight(0) + 1,
+		end:    builder.CheckpointHeight(0) + 10,
+		prev:   headers[5],
+		hashes: filterHashes,
+		err:    builder.ErrPrevHeaderMismatch,
+	}, {
+		name:   "through checkpoint",
+		start:  builder.CheckpointHeight(0) + 500,
+		end:    n,
+		prev:   prevHeader(builder.CheckpointHeight(0) + 500),
+		hashes: filterHashes,
+	}, {
+		name:   "mismatching checkpoint",
+		start:  builder.CheckpointHeight(0) + 500,
+		end:    n,
+		prev:   prevHeader(builder.CheckpointHeight(0) + 500),
+		hashes: tampered,
+		err:    builder.ErrCheckpointMismatch,
+	}, {
+		name:   "between checkpoints",
+		start:  builder.CheckpointHeight(0) + 500,
+		end:    builder.CheckpointHeight(0) + 600,
+		prev:   prevHeader(builder.CheckpointHeight(0) + 500),
+		hashes: filterHashes,
+		err:    builder.ErrNotAnchored,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := builder.VerifyCFHeaders(checkpoints,
+				test.start, test.prev,
+				test.hashes[test.start:test.end])
+			if !errors.Is(err, test.err) {
+				t.Fatalf("got error %v, want %v", err, test.err)
+			}
+			if err != nil {
+				return
+			}
+			want := headers[test.start:test.end]
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("got %d headers, not those of the chain",
+					len(got))
+			}
+		})
+	}
+}
+
+// TestVerifyCFHeadersMsg checks that the filter types of the messages must
+// agree.
+func TestVerifyCFHeadersMsg(t *testing.T) {
+	filterHash := chainhash.HashH([]byte("filter"))
+	checkpt := &wire.MsgCFCheckpt{FilterType: wire.GCSFilterRegular}
+	cfheaders := &wire.MsgCFHeaders{
+		FilterType:   wire.GCSFilterRegular,
+		FilterHashes: []*chainhash.Hash{&filterHash},
+	}
+
+	headers, err := builder.VerifyCFHeadersMsg(checkpt, 0, cfheaders)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := builder.HeadersFromHashes(chainhash.Hash{},
+		[]chainhash.Hash{filterHash})
+	if !reflect.DeepEqual(headers, want) {
+		t.Fatalf("got headers %v, want %v", headers, want)
+	}
+
+	cfheaders.FilterType = wire.GCSFilterExtended
+	_, err = builder.VerifyCFHeadersMsg(checkpt, 0, cfheaders)
+	if err == nil {
+		t.Fatal("filter type mismatch accepted")
+	}
+}
@@ -0,0 +1,177 @@
+package builder
+
+import (
+	"github.com/christsim/bips/bip-0158/backend/chainhash"
+	"github.com/christsim/bips/bip-0158/backend/wire"
+	"github.com/christsim/bips/bip-0158/gcs"
+	"github.com/christsim/bips/bip-0158/script"
+)
+
+// BlockElements holds the candidate filter elements of a block, sorted into
+// categories by a single walk over its transactions. Building several
+// filters from one BlockElements, rather than having each policy walk the
+// block, hashes each transaction and parses each signature script only once.
+//
+// The slices may hold duplicates, which builders remove, and refer to the
+// block's own scripts and witness items, so the block must not be modified
+// while they are in use.
+type BlockElements struct {
+	// Block is the block the elements were extracted from, for policies
+	// that need more than the elements themselves.
+	Block *wire.MsgBlock
+
+	// BlockHash is the hash of the block, which filters are keyed by.
+	BlockHash chainhash.Hash
+
+	// TxHashes holds the hash of every transaction.
+	TxHashes [][]byte
+
+	// OutPoints holds the outpoints spent by the inputs of every
+	// transaction but the coinbase, serialized with
+	// OutPointToFilterEntry.
+	OutPoints [][]byte
+
+	// OutputScripts holds the output scripts of every transaction,
+	// including empty ones.
+	OutputScripts [][]byte
+
+	// SigScriptPushes holds the data pushes of the signature scripts of
+	// every input but the coinbase's. Scripts that fail to parse
+	// contribute no pushes.
+	SigScriptPushes [][]byte
+
+	// WitnessItems holds the witness stack items of every input but the
+	// coinbase's.
+	WitnessItems [][]byte
+}
+
+// ExtractElements walks the block once and returns its elements.
+func ExtractElements(block *wire.MsgBlock) *BlockElements {
+	e := &BlockElements{
+		Block:     block,
+		BlockHash: block.BlockHash(),
+		TxHashes:  make([][]byte, 0, len(block.Transactions)),
+	}
+
+	for i, tx := range block.Transactions {
+		txHash := tx.TxHash()
+		e.TxHashes = append(e.TxHashes, txHash[:])
+
+		for _, txOut := range tx.TxOut {
+			e.OutputScripts = append(e.OutputScripts, txOut.PkScript)
+		}
+
+		// Skip the inputs for the coinbase transaction
+		if i == 0 {
+			continue
+		}
+
+		for _, txIn := range tx.TxIn {
+			e.OutPoints = append(e.OutPoints,
+				OutPointToFilterEntry(txIn.PreviousOutPoint))
+
+			if txIn.SignatureScript != nil {
+				// Ignore errors and add pushed data, if any
+				data, _ := script.PushedData(txIn.SignatureScript)
+				e.SigScriptPushes = append(e.SigScriptPushes,
+					data...)
+			}
+			e.WitnessItems = append(e.WitnessItems, txIn.Witness...)
+		}
+	}
+
+	return e
+}
+
+// ElementPolicy is implemented by filter policies that can select their
+// elements from a BlockElements instead of walking the block themselves.
+// AddElements must add exactly the elements AddBlock would.
+type ElementPolicy interface {
+	FilterPolicy
+
+	// AddElements adds the elements selected by the policy to the
+	// builder.
+	AddElements(b *GCSBuilder, e *BlockElements)
+}
+
+// addElements adds the policy's elements to the builder, from e if the policy
+// supports it and from the block otherwise.
+func addElements(policy FilterPolicy, b *GCSBuilder, e *BlockElements) {
+	if ep, ok := policy.(ElementPolicy); ok {
+		ep.AddElements(b, e)
+		return
+	}
+	policy.AddBlock(b, e.Block)
+}
+
+// BuildElementFilter is like BuildFilter, but takes the block's elements
+// extracted with ExtractElements, so that filters of several types can be
+// built from a single walk over the block.
+func BuildElementFilter(policy FilterPolicy, e *BlockElements,
+	p uint8) (*gcs.Filter, error) {
+
+	b := GetBuilder(DeriveKey(&e.BlockHash), p)
+	defer PutBuilder(b)
+
+	addElements(policy, b, e)
+
+	return b.Build()
+}
+
+// BuildElementFilters is like BuildFilters, but takes the block's elements
+// extracted with ExtractElements.
+func BuildElementFilters(policy FilterPolicy, e *BlockElements,
+	ps []uint8) ([]*gcs.Filter, error) {
+
+	key := DeriveKey(&e.BlockHash)
+
+	// The probability doesn't affect which entries are extracted, so
+	// any valid value will do here.
+	b := GetBuilder(key, DefaultP)
+	defer PutBuilder(b)
+
+	addElements(policy, b, e)
+	entries, err := b.Entries()
+	if err != nil {
+		return nil, err
+	}
+
+	return buildFiltersP(key, entries, ps)
+}
+
+// AddElements adds the basic filter elements of the block to the builder.
+func (p BasicPolicy) AddElements(b *GCSBuilder, e *BlockElements) {
+	b.SetScriptTypes(p.ScriptTypes)
+	b.AddEntries(e.TxHashes)
+	b.AddEntries(e.OutPoints)
+	for _, script := range e.OutputScripts {
+		b.AddOutputScript(script)
+	}
+}
+
+// AddElements adds the extended filter elements of the block to the builder.
+func (p ExtendedPolicy) AddElements(b *GCSBuilder, e *BlockElements) {
+	b.AddEntries(e.SigScriptPushes)
+	b.AddEntries(e.WitnessItems)
+}
+
+// AddElements adds the outpoints spent by the block to the builder.
+func (p SpentOutpointsPolicy) AddElements(b *GCSBuilder, e *BlockElements) {
+	b.AddEntries(e.OutPoints)
+}
+
+// AddElements adds the legacy basic filter elements of the block to the
+// builder.
+func (p LegacyBasicPolicy) AddElements(b *GCSBuilder, e *BlockElements) {
+	b.AddEntries(e.TxHashes)
+	b.AddEntries(e.OutPoints)
+	for _, script := range e.OutputScripts {
+		b.AddScript(script)
+	}
+}
+
+// AddElements adds the BIP 158 basic filter elements of the block to the
+// builder. The previous output scripts are still resolved from the block.
+func (p SpecBasicPolicy) AddElements(b *GCSBuilder, e *BlockElements) {
+	p.addScripts(b, e.Block, e.OutputScripts)
+}
@@ -0,0 +1,381 @@
+package builder
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/christsim/bips/bip-0158/backend/txscript"
+	"github.com/christsim/bips/bip-0158/backend/wire"
+	"github.com/christsim/bips/bip-0158/gcs"
+)
+
+var (
+	// ErrUnknownPolicy is returned when looking up a filter policy that
+	// hasn't been registered.
+	ErrUnknownPolicy = errors.New("unknown filter policy")
+
+	// ErrDuplicatePolicy is returned when registering a filter policy
+	// under a name that is already taken.
+	ErrDuplicatePolicy = errors.New("duplicate filter policy")
+
+	// ErrNoPrevScripts is returned when building a filter that includes
+	// previous output scripts without a way to resolve them.
+	ErrNoPrevScripts = errors.New("no previous output script resolver")
+)
+
+// FilterPolicy decides which elements of a block are inserted into a filter.
+// Implementing it is all that is needed to prototype a new filter type: the
+// building, keying and header chaining are the same for every policy.
+type FilterPolicy interface {
+	// Name returns the name the policy is registered and selected under.
+	Name() string
+
+	// AddBlock adds the elements of the block selected by the policy to
+	// the builder.
+	AddBlock(b *GCSBuilder, block *wire.MsgBlock)
+}
+
+var (
+	policiesMtx sync.RWMutex
+	policies    = make(map[string]FilterPolicy)
+)
+
+// RegisterPolicy makes a filter policy available by name through
+// LookupPolicy.
+func RegisterPolicy(policy FilterPolicy) error {
+	policiesMtx.Lock()
+	defer policiesMtx.Unlock()
+
+	name := policy.Name()
+	if _, ok := policies[name]; ok {
+		return fmt.Errorf("%w: %v", ErrDuplicatePolicy, name)
+	}
+	policies[name] = policy
+
+	return nil
+}
+
+// LookupPolicy returns the filter policy registered under the passed name.
+func LookupPolicy(name string) (FilterPolicy, error) {
+	policiesMtx.RLock()
+	defer policiesMtx.RUnlock()
+
+	policy, ok := policies[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %v", ErrUnknownPolicy, name)
+	}
+
+	return policy, nil
+}
+
+// PolicyNames returns the names of all registered filter policies in sorted
+// order.
+func PolicyNames() []string {
+	policiesMtx.RLock()
+	defer policiesMtx.RUnlock()
+
+	names := make([]string, 0, len(policies))
+	for name := range policies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// BuildFilter builds the filter for a block under the passed policy, keyed by
+// the block hash. p is specified as an argument in order to create filters
+// with various collision probabilities. Builders are taken from the pool
+// shared with GetBuilder, so indexing a chain doesn't allocate a new one for
+// every filter.
+func BuildFilter(policy FilterPolicy, block *wire.MsgBlock,
+	p uint8) (*gcs.Filter, error) {
+
+	blockHash := block.BlockHash()
+	b := GetBuilder(DeriveKey(&blockHash), p)
+	defer PutBuilder(b)
+
+	// If the filter had an issue with the specified key, then we force it
+	// to bubble up here by calling the Key() function.
+	_, err := b.Key()
+	if err != nil {
+		return nil, err
+	}
+
+	policy.AddBlock(b, block)
+
+	return b.Build()
+}
+
+// BuildFilters builds the filter for a block under the passed policy at each
+// of the passed values of p, in that order. The elements of the block are
+// extracted only once, after which the filters are encoded in parallel, one
+// goroutine per value of p, all hashing the same read-only set of entries.
+func BuildFilters(policy FilterPolicy, block *wire.MsgBlock,
+	ps []uint8) ([]*gcs.Filter, error) {
+
+	blockHash := block.BlockHash()
+	key := DeriveKey(&blockHash)
+
+	// The probability doesn't affect which entries are extracted, so
+	// any valid value will do here.
+	b := GetBuilder(key, DefaultP)
+	defer PutBuilder(b)
+
+	policy.AddBlock(b, block)
+	entries, err := b.Entries()
+	if err != nil {
+		return nil, err
+	}
+
+	return buildFiltersP(key, entries, ps)
+}
+
+// buildFiltersP builds a filter of the entries at each of the passed values
+// of p in parallel. The entries are only read, so they are shared by all the
+// goroutines.
+func buildFiltersP(key [gcs.KeySize]byte, entries [][]byte,
+	ps []uint8) ([]*gcs.Filter, error) {
+
+	var (
+		wg      sync.WaitGroup
+		filters = make([]*gcs.Filter, len(ps))
+		errs    = make([]error, len(ps))
+	)
+	for i, p := range ps {
+		wg.Add(1)
+		go func(i int, p uint8) {
+			defer wg.Done()
+			filters[i], errs[i] = gcs.BuildGCSFilter(p, key, entries)
+		}(i, p)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return filters, nil
+}
+
+// BasicPolicy builds the basic filter, which contains the hash of every
+// transaction in a block, all the previous outpoints spent within it, and the
+// output scripts created within it.
+type BasicPolicy struct {
+	// ScriptTypes restricts the output scripts included in the filter.
+	// The zero value includes none of them; use AllScriptTypes for the
+	// standard filter.
+	ScriptTypes ScriptTypeSet
+}
+
+// Name returns "basic".
+func (p BasicPolicy) Name() string {
+	return "basic"
+}
+
+// AddBlock adds the basic filter elements of the block to the builder.
+func (p BasicPolicy) AddBlock(b *GCSBuilder, block *wire.MsgBlock) {
+	b.SetScriptTypes(p.ScriptTypes)
+
+	// In order to build a basic filter, we'll range over the entire block,
+	// adding the outpoint data as well as the output scripts.
+	for i, tx := range block.Transactions {
+		// First we'll compute the bash of the transaction and add that
+		// directly to the filter.
+		txHash := tx.TxHash()
+		b.AddHash(&txHash)
+
+		// Skip the inputs for the coinbase transaction
+		if i != 0 {
+			// Each each txin, we'll add a serialized version of
+			// the txid:index to the filters data slices.
+			for _, txIn := range tx.TxIn {
+				b.AddOutPoint(txIn.PreviousOutPoint)
+			}
+		}
+
+		// For each output in a transaction, we'll add the output
+		// script if its type is included.
+		for _, txOut := range tx.TxOut {
+			b.AddOutputScript(txOut.PkScript)
+		}
+	}
+}
+
+// ExtendedPolicy builds the legacy extended filter, which supplements the
+// basic filter by including all the _witness_ data found within a block. This
+// includes all the data pushes within any signature scripts as well as each
+// element of an input's witness stack.
+type ExtendedPolicy struct{}
+
+// Name returns "extended".
+func (p ExtendedPolicy) Name() string {
+	return "extended"
+}
+
+// AddBlock adds the extended filter elements of the block to the builder.
+func (p ExtendedPolicy) AddBlock(b *GCSBuilder, block *wire.MsgBlock) {
+	for i, tx := range block.Transactions {
+		// Skip the inputs for the coinbase transaction
+		if i == 0 {
+			continue
+		}
+
+		// For each input, we'll add the sigScript (if it's present),
+		// and also the witness stack (if it's present)
+		for _, txIn := range tx.TxIn {
+			if txIn.SignatureScript != nil {
+				b.AddScript(txIn.SignatureScript)
+			}
+
+			if len(txIn.Witness) != 0 {
+				b.AddWitness(txIn.Witness)
+			}
+		}
+	}
+}
+
+// SpentOutpointsPolicy builds a filter containing only the previous outpoints
+// spent within a block, which is enough for a wallet that knows its own
+// outputs to detect when they are spent.
+type SpentOutpointsPolicy struct{}
+
+// Name returns "spent-outpoints".
+func (p SpentOutpointsPolicy) Name() string {
+	return "spent-outpoints"
+}
+
+// AddBlock adds the outpoints spent by the block to the builder.
+func (p SpentOutpointsPolicy) AddBlock(b *GCSBuilder, block *wire.MsgBlock) {
+	for i, tx := range block.Transactions {
+		// Skip the inputs for the coinbase transaction
+		if i == 0 {
+			continue
+		}
+
+		for _, txIn := range tx.TxIn {
+			b.AddOutPoint(txIn.PreviousOutPoint)
+		}
+	}
+}
+
+// LegacyBasicPolicy builds the basic filter as drafts of BIP 158 before the
+// final one defined it, which is what wallets still on the old scheme query:
+// the hash of every transaction in a block, the previous outpoints spent
+// within it, and the data pushed by each output script created within it,
+// rather than the scripts themselves. Output scripts that fail to parse push
+// nothing into the filter.
+type LegacyBasicPolicy struct{}
+
+// Name returns "legacy-basic".
+func (p LegacyBasicPolicy) Name() string {
+	return "legacy-basic"
+}
+
+// AddBlock adds the legacy basic filter elements of the block to the builder.
+func (p LegacyBasicPolicy) AddBlock(b *GCSBuilder, block *wire.MsgBlock) {
+	for i, tx := range block.Transactions {
+		txHash := tx.TxHash()
+		b.AddHash(&txHash)
+
+		// Skip the inputs for the coinbase transaction
+		if i != 0 {
+			for _, txIn := range tx.TxIn {
+				b.AddOutPoint(txIn.PreviousOutPoint)
+			}
+		}
+
+		for _, txOut := range tx.TxOut {
+			b.AddScript(txOut.PkScript)
+		}
+	}
+}
+
+// PrevScriptResolver looks up the output scripts spent by a block, which the
+// block itself doesn't contain.
+type PrevScriptResolver interface {
+	// PrevScripts returns the output scripts spent by the inputs of the
+	// block's non-coinbase transactions, in order.
+	PrevScripts(block *wire.MsgBlock) ([][]byte, error)
+}
+
+// SpecBasicPolicy builds the basic filter as finally specified by BIP 158,
+// which contains the output scripts created within a block and the previous
+// output scripts spent within it. OP_RETURN outputs and empty scripts are
+// left out.
+type SpecBasicPolicy struct {
+	// Resolver provides the previous output scripts of the block.
+	Resolver PrevScriptResolver
+}
+
+// Name returns "spec-basic".
+func (p SpecBasicPolicy) Name() string {
+	return "spec-basic"
+}
+
+// AddBlock adds the BIP 158 basic filter elements of the block to the
+// builder. If the previous output scripts can't be resolved, the builder
+// errors out.
+func (p SpecBasicPolicy) AddBlock(b *GCSBuilder, block *wire.MsgBlock) {
+	var scripts [][]byte
+	for _, tx := range block.Transactions {
+		for _, txOut := range tx.TxOut {
+			scripts = append(scripts, txOut.PkScript)
+		}
+	}
+
+	p.addScripts(b, block, scripts)
+}
+
+// addScripts adds the passed output scripts of the block, and the previous
+// output scripts it spends, to the builder, leaving out OP_RETURN outputs and
+// empty scripts.
+func (p SpecBasicPolicy) addScripts(b *GCSBuilder, block *wire.MsgBlock,
+	outputScripts [][]byte) {
+
+	// Do nothing if the builder's already errored out.
+	if b.err != nil {
+		return
+	}
+
+	if p.Resolver == nil {
+		b.err = ErrNoPrevScripts
+		return
+	}
+	prevScripts, err := p.Resolver.PrevScripts(block)
+	if err != nil {
+		b.err = err
+		return
+	}
+
+	for _, script := range outputScripts {
+		if len(script) == 0 || script[0] == txscript.OP_RETURN {
+			continue
+		}
+		b.AddEntry(script)
+	}
+	for _, script := range prevScripts {
+		if len(script) == 0 {
+			continue
+		}
+		b.AddEntry(script)
+	}
+}
+
+func init() {
+	for _, policy := range []FilterPolicy{
+		BasicPolicy{ScriptTypes: AllScriptTypes},
+		ExtendedPolicy{},
+		SpentOutpointsPolicy{},
+		LegacyBasicPolicy{},
+		SpecBasicPolicy{},
+	} {
+		if err := RegisterPolicy(policy); err != nil {
+			panic(err)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package builder
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/christsim/bips/bip-0158/backend/chainhash"
+	"github.com/christsim/bips/bip-0158/gcs"
+)
+
+var (
+	// ErrHeightNotInChain is returned when a header is requested for, or
+	// the chain is rolled back to, a height beyond its tip.
+	ErrHeightNotInChain = errors.New("height is beyond the tip of the " +
+		"filter header chain")
+
+	// ErrHeightPruned is returned when a header is requested for, or the
+	// chain is rolled back to, a height that is no longer retained.
+	ErrHeightPruned = errors.New("height has been pruned from the filter " +
+		"header chain")
+
+	// ErrCheckpointMismatch is returned when a header in the chain doesn't
+	// match the checkpoint for its height.
+	ErrCheckpointMismatch = errors.New("filter header doesn't match " +
+		"checkpoint")
+)
+
+// FilterHeaderChain tracks the chain of filter headers for a single filter
+// type, mapping each block height to the header committing to the filter for
+// that block and all filters before it.
+//
+// Only the most recent headers are kept in memory if the chain is created with
+// a retention limit, which allows callers that only need to extend the chain,
+// such as the test vector generator, to process the whole block chain with
+// constant memory.
+type FilterHeaderChain struct {
+	// startHeight is the height of the first header in headers.
+	startHeight uint32
+
+	// startPrev is the header preceding the one at startHeight, which is
+	// all zeros for a chain starting at the genesis block.
+	startPrev chainhash.Hash
+
+	// headers holds the retained headers in height order.
+	headers []chainhash.Hash
+
+	// retain is the maximum number of headers kept in memory, or zero to
+	// keep all of them.
+	retain int
+}
+
+// NewFilterHeaderChain creates an empty filter header chain whose first header
+// will be for the genesis block. If retain is non-zero, only the retain most
+// recent headers are kept in memory.
+func NewFilterHeaderChain(retain int) *FilterHeaderChain {
+	return NewFilterHeaderChainFrom(0, chainhash.Hash{}, retain)
+}
+
+// NewFilterHeaderChainFrom creates an empty filter header chain whose first
+// header will be for the block at height, given the header of the block
+// before it. This allows a chain to be started from a trusted checkpoint
+// rather than from the genesis block.
+func NewFilterHeaderChainFrom(height uint32, prevHeader chainhash.Hash,
+	retain int) *FilterHeaderChain {
+
+	return &FilterHeaderChain{
+		startHeight: height,
+		startPrev:   prevHeader,
+		retain:      retain,
+	}
+}
+
+// NextHeight returns the height of the block whose filter will be appended
+// next.
+func (c *FilterHeaderChain) NextHeight() uint32 {
+	return c.startHeight + uint32(len(c.headers))
+}
+
+// TipHeader returns the most recent header in the chain, which is the
+// previous header for the next filter to be appended. For an empty chain,
+// this is the header the chain was started from.
+func (c *FilterHeaderChain) TipHeader() chainhash.Hash {
+	if len(c.headers) == 0 {
+		return c.startPrev
+	}
+	return c.headers[len(c.headers)-1]
+}
+
+// Header returns the filter header for the block at the passed height.
+func (c *FilterHeaderChain) Header(height uint32) (chainhash.Hash, error) {
+	switch {
+	case height >= c.NextHeight():
+		return chainhash.Hash{}, ErrHeightNotInChain
+	case height < c.startHeight:
+		return chainhash.Hash{}, ErrHeightPruned
+	}
+
+	return c.headers[height-c.startHeight], nil
+}
+
+// Append extends the chain with the header for the passed filter, which must
+// be the filter for the block at NextHeight, and returns the new header.
+func (c *FilterHeaderChain) Append(filter *gcs.Filter) (chainhash.Hash, error) {
+	header, err := MakeHeaderForFilter(filter, c.TipHeader())
+	if err != nil {
+		return chainhash.Hash{}, err
+	}
+
+	c.AppendHeader(header)
+	return header, nil
+}
+
+// AppendHeader extends the chain with a header that has already been
+// computed, for example one received from a peer.
+func (c *FilterHeaderChain) AppendHeader(header chainhash.Hash) {
+	c.headers = append(c.headers, header)
+
+	// Drop the oldest headers once we're over the retention limit. The
+	// header preceding the new start is kept so the chain can still be
+	// rolled back to its first retained height.
+	if c.retain > 0 && len(c.headers) > c.retain {
+		drop := len(c.headers) - c.retain
+		c.startPrev = c.headers[drop-1]
+		c.startHeight += uint32(drop)
+		c.headers = append(c.headers[:0], c.headers[drop:]...)
+	}
+}
+
+// Rollback removes all headers above the passed height, so that the next
+// filter appended will be for the block at height+1. This is used to unwind
+// the chain after a block reorganization.
+func (c *FilterHeaderChain) Rollback(height uint32) error {
+	switch {
+	case height >= c.NextHeight():
+		return ErrHeightNotInChain
+	case height+1 < c.startHeight:
+		return ErrHeightPruned
+	}
+
+	c.headers = c.headers[:height+1-c.startHeight]
+	return nil
+}
+
+// VerifyAgainst checks the chain against a set of trusted headers keyed by
+// block height. Checkpoints beyond the tip of the chain or below its retained
+// headers are ignored. An error wrapping ErrCheckpointMismatch is returned for
+// the first checkpoint that doesn't match.
+func (c *FilterHeaderChain) VerifyAgainst(
+	checkpoints map[uint32]chainhash.Hash) error {
+
+	heights := make([]uint32, 0, len(checkpoints))
+	for height := range checkpoints {
+		heights = append(heights, height)
+	}
+	sort.Slice(heights, func(i, j int) bool {
+		return heights[i] < heights[j]
+	})
+
+	for _, height := range heights {
+		header, err := c.Header(height)
+		if err != nil {
+			continue
+		}
+
+		if expected := checkpoints[height]; header != expected {
+			return fmt.Errorf("%w: height %d has header %v, "+
+				"expected %v", ErrCheckpointMismatch, height,
+				header, expected)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,243 @@
+package builder_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/christsim/bips/bip-0158/backend/chainhash"
+	"github.com/christsim/bips/bip-0158/gcs"
+	"github.com/christsim/bips/bip-0158/gcs/builder"
+)
+
+// testHeaders returns n distinct filter headers.
+func testHeaders(n int) []chainhash.Hash {
+	headers := make([]chainhash.Hash, n)
+	for i := range headers {
+		headers[i] = chainhash.HashH([]byte{byte(i)})
+	}
+	return headers
+}
+
+// TestFilterHeaderChainAppend checks that appending the filters of each block
+// of testnet-20.json to a chain started from the previous headers of the
+// vectors gives their headers. The blocks aren't contiguous, so each starts a
+// chain of its own.
+func TestFilterHeaderChainAppend(t *testing.T) {
+	for _, vb := range loadBlocks(t) {
+		basic, ext, _, err := builder.BuildFiltersFromReader(
+			bytes.NewReader(vb.raw), vectorP)
+		if err != nil {
+			t.Fatal(err)
+		}
+		height := uint32(vb.height)
+		for i, filter := range []*gcs.Filter{basic, ext} {
+			chain := builder.NewFilterHeaderChainFrom(height,
+				vb.prevHeaders[i], 1)
+			if chain.TipHeader() != vb.prevHeaders[i] {
+				t.Fatalf("height %v: tip %v, want %v", vb.height,
+					chain.TipHeader(), vb.prevHeaders[i])
+			}
+			header, err := chain.Append(filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if header != vb.headers[i] {
+				t.Fatalf("height %v (%s): header %v, want %v",
+					vb.height, vb.notes, header, vb.headers[i])
+			}
+			stored, err := chain.Header(height)
+			if err != nil || stored != header {
+				t.Fatalf("height %v: stored header %v, %v",
+					vb.height, stored, err)
+			}
+		}
+	}
+}
+
+// TestFilterHeaderChain checks the headers a chain returns and the rollbacks
+// it allows, for chains started from the genesis block and from a
+// checkpoint, with and without a retention limit.
+func TestFilterHeaderChain(t *testing.T) {
+	headers := testHeaders(10)
+	start := chainhash.HashH([]byte("start"))
+
+	tests := []struct {
+		name     string
+		height   uint32
+		prev     chainhash.Hash
+		retain   int
+		appended int
+
+		// lookups maps heights to the error Header returns for them,
+		// or nil if it returns the appended header.
+		lookups map[uint32]error
+
+		// rollbacks maps heights to the error Rollback returns for
+		// them, each applied to a fresh copy of the chain.
+		rollbacks map[uint32]error
+	}{{
+		name:     "empty",
+		appended: 0,
+		lookups:  map[uint32]error{0: builder.ErrHeightNotInChain},
+		rollbacks: map[uint32]error{
+			0: builder.ErrHeightNotInChain,
+		},
+	}, {
+		name:     "from genesis",
+		appended: 10,
+		lookups: map[uint32]error{
+			0:  nil,
+			9:  nil,
+			10: builder.ErrHeightNotInChain,
+		},
+		rollbacks: map[uint32]error{
+			0:  nil,
+			9:  nil,
+			10: builder.ErrHeightNotInChain,
+		},
+	}, {
+		name:     "from checkpoint",
+		height:   1000,
+		prev:     start,
+		appended: 10,
+		lookups: map[uint32]error{
+			999:  builder.ErrHeightPruned,
+			1000: nil,
+			1009: nil,
+			1010: builder.ErrHeightNotInChain,
+		},
+		rollbacks: map[uint32]error{
+			998:  builder.ErrHeightPruned,
+			999:  nil,
+			1009: nil,
+		},
+	}, {
+		name:     "retained",
+		retain:   4,
+		appended: 10,
+		lookups: map[uint32]error{
+			5: builder.ErrHeightPruned,
+			6: nil,
+			9: nil,
+		},
+		rollbacks: map[uint32]error{
+			4: builder.ErrHeightPruned,
+			5: nil,
+			8: nil,
+		},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			newChain := func() *builder.FilterHeaderChain {
+				chain := builder.NewFilterHeaderChainFrom(
+					test.height, test.prev, test.retain)
+				for _, header := range headers[:test.appended] {
+					chain.AppendHeader(header)
+				}
+				return chain
+			}
+
+			chain := newChain()
+			next := test.height + uint32(test.appended)
+			if chain.NextHeight() != next {
+				t.Fatalf("next height %d, want %d",
+					chain.NextHeight(), next)
+			}
+			tip := test.prev
+			if test.appended > 0 {
+				tip = headers[test.appended-1]
+			}
+			if chain.TipHeader() != tip {
+				t.Fatalf("tip %v, want %v", chain.TipHeader(), tip)
+			}
+
+			for height, want := range test.lookups {
+				header, err := chain.Header(height)
+				if !errors.Is(err, want) {
+					t.Fatalf("height %d: got error %v, "+
+						"want %v", height, err, want)
+				}
+				if err != nil {
+					continue
+				}
+				expected := headers[height-test.height]
+				if header != expected {
+					t.Fatalf("height %d: header %v, want %v",
+						height, header, expected)
+				}
+			}
+
+			for height, want := range test.rollbacks {
+				chain := newChain()
+				err := chain.Rollback(height)
+				if !errors.Is(err, want) {
+					t.Fatalf("rollback to %d: got error %v, "+
+						"want %v", height, err, want)
+				}
+				if err != nil {
+					continue
+				}
+				if chain.NextHeight() != height+1 {
+					t.Fatalf("rollback to %d: next height %d",
+						height, chain.NextHeight())
+				}
+				expected := test.prev
+				if height >= test.height {
+					expected = headers[height-test.height]
+				}
+				if tip := chain.TipHeader(); tip != expected {
+					t.Fatalf("rollback to %d: tip %v, "+
+						"want %v", height, tip, expected)
+				}
+			}
+		})
+	}
+}
+
+// TestFilterHeaderChainVerifyAgainst checks a chain against sets of
+// checkpoints.
+func TestFilterHeaderChainVerifyAgainst(t *testing.T) {
+	headers := testHeaders(10)
+	chain := builder.NewFilterHeaderChain(5)
+	for _, header := range headers {
+		chain.AppendHeader(header)
+	}
+
+	tests := []struct {
+		name        string
+		checkpoints map[uint32]chainhash.Hash
+		err         error
+	}{{
+		name: "none",
+	}, {
+		name: "matching",
+		checkpoints: map[uint32]chainhash.Hash{
+			5: headers[5],
+			9: headers[9],
+		},
+	}, {
+		name: "pruned and beyond tip",
+		checkpoints: map[uint32]chainhash.Hash{
+			2:  headers[3],
+			20: headers[3],
+		},
+	}, {
+		name: "mismatch",
+		checkpoints: map[uint32]chainhash.Hash{
+			6: headers[6],
+			8: headers[7],
+		},
+		err: builder.ErrCheckpointMismatch,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := chain.VerifyAgainst(test.checkpoints)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("got error %v, want %v", err, test.err)
+			}
+		})
+	}
+}
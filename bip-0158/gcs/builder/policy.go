@@ -0,0 +1,180 @@
+package builder
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/christsim/bips/bip-0158/script"
+)
+
+// ScriptType identifies a class of output script.
+type ScriptType uint8
+
+const (
+	// ScriptTypeNonStandard is any script that doesn't fall into one of
+	// the other classes, including scripts that fail to parse.
+	ScriptTypeNonStandard ScriptType = iota
+
+	// ScriptTypeP2PK is a pay-to-pubkey script.
+	ScriptTypeP2PK
+
+	// ScriptTypeP2PKH is a pay-to-pubkey-hash script.
+	ScriptTypeP2PKH
+
+	// ScriptTypeP2SH is a pay-to-script-hash script.
+	ScriptTypeP2SH
+
+	// ScriptTypeMultiSig is a bare multisig script.
+	ScriptTypeMultiSig
+
+	// ScriptTypeNullData is a provably unspendable OP_RETURN script.
+	ScriptTypeNullData
+
+	// ScriptTypeP2WPKH is a version 0 pay-to-witness-pubkey-hash script.
+	ScriptTypeP2WPKH
+
+	// ScriptTypeP2WSH is a version 0 pay-to-witness-script-hash script.
+	ScriptTypeP2WSH
+
+	// ScriptTypeP2TR is a version 1 pay-to-taproot script.
+	ScriptTypeP2TR
+
+	// ScriptTypeWitnessUnknown is a witness program of a version or length
+	// without defined semantics.
+	ScriptTypeWitnessUnknown
+
+	numScriptTypes
+)
+
+// scriptTypeNames maps each script type to the name used for it on the
+// command line.
+var scriptTypeNames = [numScriptTypes]string{
+	ScriptTypeNonStandard:    "nonstandard",
+	ScriptTypeP2PK:           "p2pk",
+	ScriptTypeP2PKH:          "p2pkh",
+	ScriptTypeP2SH:           "p2sh",
+	ScriptTypeMultiSig:       "multisig",
+	ScriptTypeNullData:       "nulldata",
+	ScriptTypeP2WPKH:         "p2wpkh",
+	ScriptTypeP2WSH:          "p2wsh",
+	ScriptTypeP2TR:           "p2tr",
+	ScriptTypeWitnessUnknown: "witness_unknown",
+}
+
+// String returns the name of the script type.
+func (t ScriptType) String() string {
+	if t >= numScriptTypes {
+		return fmt.Sprintf("unknown(%d)", uint8(t))
+	}
+	return scriptTypeNames[t]
+}
+
+// scriptClassTypes maps the classes of the script package to the script types
+// they correspond to.
+var scriptClassTypes = [script.NumClasses]ScriptType{
+	script.NonStandard:         ScriptTypeNonStandard,
+	script.PubKey:              ScriptTypeP2PK,
+	script.PubKeyHash:          ScriptTypeP2PKH,
+	script.ScriptHash:          ScriptTypeP2SH,
+	script.MultiSig:            ScriptTypeMultiSig,
+	script.NullData:            ScriptTypeNullData,
+	script.WitnessV0KeyHash:    ScriptTypeP2WPKH,
+	script.WitnessV0ScriptHash: ScriptTypeP2WSH,
+	script.Taproot:             ScriptTypeP2TR,
+	script.WitnessUnknown:      ScriptTypeWitnessUnknown,
+}
+
+// ClassifyScript returns the class of the passed output script.
+func ClassifyScript(pkScript []byte) ScriptType {
+	return scriptClassTypes[script.Classify(pkScript)]
+}
+
+// ScriptTypeSet is a set of script types, used to restrict which output
+// scripts are inserted into a filter.
+type ScriptTypeSet uint32
+
+// AllScriptTypes is the set containing every script type, which imposes no
+// restriction.
+const AllScriptTypes = ScriptTypeSet(1<<numScriptTypes - 1)
+
+// NewScriptTypeSet returns a set containing the passed script types.
+func NewScriptTypeSet(types ...ScriptType) ScriptTypeSet {
+	var set ScriptTypeSet
+	for _, t := range types {
+		set |= 1 << t
+	}
+	return set
+}
+
+// Contains returns true if the script type is in the set.
+func (s ScriptTypeSet) Contains(t ScriptType) bool {
+	return s&(1<<t) != 0
+}
+
+// String returns the names of the script types in the set, separated by
+// commas.
+func (s ScriptTypeSet) String() string {
+	var names []string
+	for t := ScriptType(0); t < numScriptTypes; t++ {
+		if s.Contains(t) {
+			names = append(names, t.String())
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// ParseScriptTypeSet parses a comma separated list of script type names, as
+// returned by ScriptTypeSet.String, into a set.
+func ParseScriptTypeSet(list string) (ScriptTypeSet, error) {
+	var set ScriptTypeSet
+	for _, name := range strings.Split(list, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		found := false
+		for t := ScriptType(0); t < numScriptTypes; t++ {
+			if scriptTypeNames[t] == name {
+				set |= 1 << t
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("unknown script type %q", name)
+		}
+	}
+
+	return set, nil
+}
+
+// SetScriptTypes restricts the output scripts the builder inserts through
+// AddOutputScript to those of the passed types. Other entries, such as
+// outpoints and transaction hashes, are unaffected. By default all script
+// types are inserted.
+func (b *GCSBuilder) SetScriptTypes(types ScriptTypeSet) *GCSBuilder {
+	// Do nothing if the builder's already errored out.
+	if b.err != nil {
+		return b
+	}
+
+	b.scriptTypes = types
+	return b
+}
+
+// AddOutputScript adds an output script to the list of entries to be included
+// in the GCS filter when it's built, provided its type is allowed by the
+// builder's script type policy.
+func (b *GCSBuilder) AddOutputScript(script []byte) *GCSBuilder {
+	// Do nothing if the builder's already errored out.
+	if b.err != nil {
+		return b
+	}
+
+	if !b.scriptTypes.Contains(ClassifyScript(script)) {
+		return b
+	}
+
+	return b.AddEntry(script)
+}
@@ -0,0 +1,54 @@
+package builder
+
+import (
+	"sync"
+
+	"github.com/christsim/bips/bip-0158/gcs"
+)
+
+// builderPool holds builders released with PutBuilder for reuse by
+// GetBuilder.
+var builderPool = sync.Pool{
+	New: func() interface{} {
+		return &GCSBuilder{}
+	},
+}
+
+// Reset clears the builder's entries and error and sets it up to build a
+// filter with the passed key and probability, as if it had been created with
+// WithKeyP. The memory holding the entries is kept, so a builder that is
+// reset and reused for every filter allocates far less than a new builder
+// per filter once it has grown to the size of the largest filter.
+func (b *GCSBuilder) Reset(key [gcs.KeySize]byte, p uint8) *GCSBuilder {
+	if b.data == nil {
+		b.data = make(map[string]struct{})
+	} else {
+		clear(b.data)
+	}
+	b.err = nil
+	b.m = 0
+	b.scriptTypes = AllScriptTypes
+
+	// Drop the references to the previous filter's entries, so they
+	// don't keep anything alive while the builder sits in a pool.
+	clear(b.entries)
+	b.entries = b.entries[:0]
+
+	return b.SetKey(key).SetP(p)
+}
+
+// GetBuilder returns a builder for a filter with the passed key and
+// probability, reusing one released with PutBuilder if there is any. It is
+// meant for indexing many blocks, where building each filter with a fresh
+// builder puts significant pressure on the garbage collector.
+func GetBuilder(key [gcs.KeySize]byte, p uint8) *GCSBuilder {
+	b := builderPool.Get().(*GCSBuilder)
+	return b.Reset(key, p)
+}
+
+// PutBuilder releases a builder obtained with GetBuilder for reuse. The
+// builder must not be used afterwards, but filters it has built are
+// unaffected.
+func PutBuilder(b *GCSBuilder) {
+	builderPool.Put(b)
+}
@@ -0,0 +1,338 @@
+package builder
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"io"
+
+	"github.com/christsim/bips/bip-0158/backend/chainhash"
+	"github.com/christsim/bips/bip-0158/backend/wire"
+	"github.com/christsim/bips/bip-0158/gcs"
+)
+
+var (
+	// ErrElementTooLarge is returned when a streamed block claims to
+	// contain a script or witness item larger than a block could hold.
+	ErrElementTooLarge = errors.New("block element exceeds maximum block size")
+
+	// ErrTooManyElements is returned when a streamed block claims to
+	// contain more transactions, inputs, outputs or witness items than a
+	// block could hold.
+	ErrTooManyElements = errors.New("block element count exceeds maximum block size")
+
+	// ErrMissingWitness is returned when a transaction is serialized with
+	// the witness flag set, but none of its inputs carry any witness data.
+	ErrMissingWitness = errors.New("witness flag set but no witness data present")
+
+	// ErrInvalidWitnessFlag is returned when a transaction's witness
+	// marker is followed by a flag other than 0x01.
+	ErrInvalidWitnessFlag = errors.New("invalid witness flag")
+)
+
+const (
+	// blockHeaderSize is the size of a serialized block header.
+	blockHeaderSize = 80
+
+	// witnessMarker and witnessFlag are the two bytes that follow the
+	// version of a transaction serialized with witness data.
+	witnessMarker = 0x00
+	witnessFlag   = 0x01
+)
+
+// StreamBuilder builds the basic and extended filters for a block by reading
+// its raw serialization from an io.Reader. Unlike building from a
+// wire.MsgBlock, the block is never fully deserialized: scripts, outpoints
+// and witness items are extracted as they are read and only the filter
+// entries themselves are held in memory, which keeps memory usage bounded for
+// large blocks.
+type StreamBuilder struct {
+	p uint8
+
+	r       io.Reader
+	scratch [9]byte
+
+	// txHasher accumulates the non-witness serialization of the
+	// transaction currently being read in order to compute its txid.
+	txHasher hash.Hash
+	hashing  bool
+
+	blockHash chainhash.Hash
+	basic     *GCSBuilder
+	ext       *GCSBuilder
+}
+
+// NewStreamBuilder creates a StreamBuilder which reads a serialized block from
+// r and builds filters with the passed probability.
+func NewStreamBuilder(r io.Reader, p uint8) *StreamBuilder {
+	return &StreamBuilder{
+		p:        p,
+		r:        r,
+		txHasher: sha256.New(),
+	}
+}
+
+// BuildFiltersFromReader reads a serialized block from r and returns its basic
+// and extended filters built with the passed probability, along with the hash
+// of the block.
+func BuildFiltersFromReader(r io.Reader, p uint8) (*gcs.Filter,
+	*gcs.Filter, *chainhash.Hash, error) {
+
+	return NewStreamBuilder(r, p).Build()
+}
+
+// Build consumes the block from the underlying reader and returns its basic
+// and extended filters, along with the hash of the block.
+func (s *StreamBuilder) Build() (*gcs.Filter, *gcs.Filter, *chainhash.Hash,
+	error) {
+
+	// The block hash is the double-SHA256 of the header, which also
+	// provides the key for both filters.
+	var header [blockHeaderSize]byte
+	if err := s.read(header[:]); err != nil {
+		return nil, nil, nil, err
+	}
+	s.blockHash = chainhash.DoubleHashH(header[:])
+
+	s.basic = WithKeyHashP(&s.blockHash, s.p)
+	s.ext = WithKeyHashP(&s.blockHash, s.p)
+
+	txCount, err := s.readCount(wire.MaxBlockPayload / minTxPayload)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	for i := uint64(0); i < txCount; i++ {
+		if err := s.readTx(i == 0); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	basicFilter, err := s.basic.Build()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	extFilter, err := s.ext.Build()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return basicFilter, extFilter, &s.blockHash, nil
+}
+
+// minTxPayload is the minimum size of a serialized transaction, used to bound
+// the number of transactions a block can claim to contain.
+const minTxPayload = 10
+
+// readTx reads a single transaction from the stream, adding its elements to
+// the basic and extended filters. The outpoints, signature scripts and
+// witnesses of the coinbase transaction are skipped.
+func (s *StreamBuilder) readTx(coinbase bool) error {
+	s.txHasher.Reset()
+	s.hashing = true
+
+	var version [4]byte
+	if err := s.read(version[:]); err != nil {
+		return err
+	}
+
+	// The input count doubles as the witness marker: a transaction with
+	// witness data starts with a zero input count followed by the flag.
+	inCount, err := s.readCount(wire.MaxBlockPayload)
+	if err != nil {
+		return err
+	}
+	hasWitness := false
+	if inCount == witnessMarker {
+		// The marker and flag aren't part of the txid serialization.
+		// Since we've already hashed the marker, we restart the
+		// hash with only the version.
+		s.hashing = false
+		flag, err := s.readByte()
+		if err != nil {
+			return err
+		}
+		if flag != witnessFlag {
+			return ErrInvalidWitnessFlag
+		}
+
+		s.txHasher.Reset()
+		s.txHasher.Write(version[:])
+		s.hashing = true
+
+		hasWitness = true
+		inCount, err = s.readCount(wire.MaxBlockPayload)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i := uint64(0); i < inCount; i++ {
+		var outpoint wire.OutPoint
+		if err := s.read(outpoint.Hash[:]); err != nil {
+			return err
+		}
+		index, err := s.readUint32()
+		if err != nil {
+			return err
+		}
+		outpoint.Index = index
+
+		sigScript, err := s.readVarBytes()
+		if err != nil {
+			return err
+		}
+		if _, err := s.readUint32(); err != nil {
+			return err
+		}
+
+		if !coinbase {
+			s.basic.AddOutPoint(outpoint)
+			s.ext.AddScript(sigScript)
+		}
+	}
+
+	outCount, err := s.readCount(wire.MaxBlockPayload)
+	if err != nil {
+		return err
+	}
+	for i := uint64(0); i < outCount; i++ {
+		var value [8]byte
+		if err := s.read(value[:]); err != nil {
+			return err
+		}
+		pkScript, err := s.readVarBytes()
+		if err != nil {
+			return err
+		}
+
+		s.basic.AddEntry(pkScript)
+	}
+
+	// The witness data isn't part of the txid, so we stop hashing while
+	// reading it.
+	if hasWitness {
+		s.hashing = false
+
+		witnessFound := false
+		for i := uint64(0); i < inCount; i++ {
+			itemCount, err := s.readCount(wire.MaxBlockPayload)
+			if err != nil {
+				return err
+			}
+			for j := uint64(0); j < itemCount; j++ {
+				item, err := s.readVarBytes()
+				if err != nil {
+					return err
+				}
+				if !coinbase {
+					s.ext.AddEntry(item)
+				}
+			}
+			witnessFound = witnessFound || itemCount > 0
+		}
+		if !witnessFound {
+			return ErrMissingWitness
+		}
+
+		s.hashing = true
+	}
+
+	if _, err := s.readUint32(); err != nil {
+		return err
+	}
+
+	// With the whole non-witness serialization hashed, we can now finish
+	// computing the txid and add it to the basic filter.
+	var digest [sha256.Size]byte
+	txid := chainhash.HashH(s.txHasher.Sum(digest[:0]))
+	s.basic.AddHash(&txid)
+
+	s.hashing = false
+	return nil
+}
+
+// read fills p from the underlying reader, feeding the bytes to the txid
+// hasher if a transaction is currently being hashed.
+func (s *StreamBuilder) read(p []byte) error {
+	if _, err := io.ReadFull(s.r, p); err != nil {
+		return err
+	}
+	if s.hashing {
+		s.txHasher.Write(p)
+	}
+	return nil
+}
+
+// readByte reads a single byte from the stream.
+func (s *StreamBuilder) readByte() (byte, error) {
+	if err := s.read(s.scratch[:1]); err != nil {
+		return 0, err
+	}
+	return s.scratch[0], nil
+}
+
+// readUint32 reads a little-endian uint32 from the stream.
+func (s *StreamBuilder) readUint32() (uint32, error) {
+	if err := s.read(s.scratch[:4]); err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(s.scratch[:4]), nil
+}
+
+// readCompactSize reads a CompactSize encoded integer from the stream.
+func (s *StreamBuilder) readCompactSize() (uint64, error) {
+	prefix, err := s.readByte()
+	if err != nil {
+		return 0, err
+	}
+
+	switch prefix {
+	case 0xfd:
+		if err := s.read(s.scratch[:2]); err != nil {
+			return 0, err
+		}
+		return uint64(binary.LittleEndian.Uint16(s.scratch[:2])), nil
+	case 0xfe:
+		v, err := s.readUint32()
+		return uint64(v), err
+	case 0xff:
+		if err := s.read(s.scratch[:8]); err != nil {
+			return 0, err
+		}
+		return binary.LittleEndian.Uint64(s.scratch[:8]), nil
+	default:
+		return uint64(prefix), nil
+	}
+}
+
+// readCount reads a CompactSize element count from the stream, rejecting
+// values larger than max.
+func (s *StreamBuilder) readCount(max uint64) (uint64, error) {
+	count, err := s.readCompactSize()
+	if err != nil {
+		return 0, err
+	}
+	if count > max {
+		return 0, ErrTooManyElements
+	}
+	return count, nil
+}
+
+// readVarBytes reads a CompactSize length-prefixed byte slice from the
+// stream.
+func (s *StreamBuilder) readVarBytes() ([]byte, error) {
+	size, err := s.readCompactSize()
+	if err != nil {
+		return nil, err
+	}
+	if size > wire.MaxBlockPayload {
+		return nil, ErrElementTooLarge
+	}
+
+	b := make([]byte, size)
+	if err := s.read(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
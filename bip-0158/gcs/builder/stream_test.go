@@ -0,0 +1,127 @@
+package builder_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/christsim/bips/bip-0158/backend/wire"
+	"github.com/christsim/bips/bip-0158/gcs"
+	"github.com/christsim/bips/bip-0158/gcs/builder"
+)
+
+// TestStreamBuilder builds the filters of every block of testnet-20.json
+// from its serialization with BuildFiltersFromReader, and checks them against
+// the vectors and against the filters BuildFilter builds from the
+// deserialized block under the basic and extended policies.
+func TestStreamBuilder(t *testing.T) {
+	policies := [2]builder.FilterPolicy{
+		builder.BasicPolicy{ScriptTypes: builder.AllScriptTypes},
+		builder.ExtendedPolicy{},
+	}
+
+	for _, vb := range loadBlocks(t) {
+		block := &wire.MsgBlock{}
+		if err := block.Deserialize(bytes.NewReader(vb.raw)); err != nil {
+			t.Fatalf("height %v: %v", vb.height, err)
+		}
+
+		basic, ext, blockHash, err := builder.BuildFiltersFromReader(
+			bytes.NewReader(vb.raw), vectorP)
+		if err != nil {
+			t.Fatalf("height %v (%s): %v", vb.height, vb.notes, err)
+		}
+		if *blockHash != block.BlockHash() {
+			t.Fatalf("height %v: block hash %v, want %v", vb.height,
+				blockHash, block.BlockHash())
+		}
+
+		for i, streamed := range []*gcs.Filter{basic, ext} {
+			got, err := streamed.NBytes()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, vb.filters[i]) {
+				t.Fatalf("height %v (%s), %s filter: got %x, "+
+					"want %x", vb.height, vb.notes,
+					policies[i].Name(), got, vb.filters[i])
+			}
+
+			filter, err := builder.BuildFilter(policies[i], block,
+				vectorP)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := filter.NBytes()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Fatalf("height %v (%s), %s filter: streamed "+
+					"%x, built %x", vb.height, vb.notes,
+					policies[i].Name(), got, want)
+			}
+		}
+	}
+}
+
+// TestStreamBuilderErrors checks that the stream builder rejects malformed
+// block serializations with the expected error.
+func TestStreamBuilderErrors(t *testing.T) {
+	header := make([]byte, 80)
+	version := []byte{1, 0, 0, 0}
+	outpoint := make([]byte, 36)
+
+	join := func(parts ...[]byte) []byte {
+		return bytes.Join(parts, nil)
+	}
+
+	tests := []struct {
+		name  string
+		block []byte
+		err   error
+	}{{
+		name:  "empty",
+		block: nil,
+		err:   io.EOF,
+	}, {
+		name:  "truncated header",
+		block: header[:40],
+		err:   io.ErrUnexpectedEOF,
+	}, {
+		name:  "missing transactions",
+		block: join(header, []byte{1}),
+		err:   io.EOF,
+	}, {
+		name: "too many transactions",
+		block: join(header, []byte{0xfe, 0xff, 0xff, 0xff,
+			0xff}),
+		err: builder.ErrTooManyElements,
+	}, {
+		name:  "invalid witness flag",
+		block: join(header, []byte{1}, version, []byte{0, 2}),
+		err:   builder.ErrInvalidWitnessFlag,
+	}, {
+		name: "script too large",
+		block: join(header, []byte{1}, version, []byte{1}, outpoint,
+			[]byte{0xfe, 0xff, 0xff, 0xff, 0x7f}),
+		err: builder.ErrElementTooLarge,
+	}, {
+		name: "missing witness",
+		block: join(header, []byte{1}, version, []byte{0, 1, 1},
+			outpoint, []byte{0}, make([]byte, 4), []byte{0},
+			[]byte{0}),
+		err: builder.ErrMissingWitness,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, _, _, err := builder.BuildFiltersFromReader(
+				bytes.NewReader(test.block), vectorP)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("got error %v, want %v", err, test.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,202 @@
+// Command cshared exports the BIP 158 filter code of the gcs and builder
+// packages as a C library, so that wallets in languages with a C foreign
+// function interface, such as Swift and Kotlin, can build and match filters
+// and verify filter headers with this implementation instead of
+// reimplementing the Golomb-Rice coding. Build it with:
+//
+//	go build -buildmode=c-shared -o libbip158.so ./gcs/cshared
+//
+// which also writes the libbip158.h header declaring the functions and the
+// BIP158_* result codes they return. Use -buildmode=c-archive instead for a
+// static library, as iOS requires.
+//
+// Filters are passed serialized with their element count, as in a cfilter
+// message. Block hashes and filter headers are passed as 32 bytes in their
+// internal byte order, as serialized in blocks and P2P messages, not the
+// byte-reversed order they are displayed in. Memory passed in is only read
+// during the call. Filters returned by BuildFilter are allocated with malloc
+// and must be released with FreeFilter.
+package main
+
+/*
+#include <stddef.h>
+#include <stdint.h>
+#include <stdlib.h>
+
+// The result codes returned by every function.
+enum {
+	BIP158_OK = 0,
+	BIP158_ERR_INVALID_ARGUMENT = 1,
+	BIP158_ERR_UNKNOWN_POLICY = 2,
+	BIP158_ERR_BAD_BLOCK = 3,
+	BIP158_ERR_BAD_FILTER = 4,
+	BIP158_ERR_HEADER_MISMATCH = 5,
+};
+*/
+import "C"
+
+import (
+	"bytes"
+	"unsafe"
+
+	"github.com/christsim/bips/bip-0158/backend/chainhash"
+	"github.com/christsim/bips/bip-0158/backend/wire"
+	"github.com/christsim/bips/bip-0158/gcs"
+	"github.com/christsim/bips/bip-0158/gcs/builder"
+)
+
+// goBytes returns a slice aliasing the passed C memory, which must stay valid
+// for as long as the slice is used.
+func goBytes(p *C.uint8_t, n C.size_t) []byte {
+	if p == nil || n == 0 {
+		return nil
+	}
+	return unsafe.Slice((*byte)(unsafe.Pointer(p)), int(n))
+}
+
+// goHash copies the 32 byte hash at p.
+func goHash(p *C.uint8_t) chainhash.Hash {
+	var hash chainhash.Hash
+	copy(hash[:], goBytes(p, chainhash.HashSize))
+	return hash
+}
+
+// BuildFilter builds the filter of the serialized block under the filter
+// policy with the passed name, such as "basic", with the Golomb-Rice
+// parameter p. The serialized filter is stored in *filter, to be freed with
+// FreeFilter, and its length in *filterLen.
+//
+//export BuildFilter
+func BuildFilter(policyName *C.char, block *C.uint8_t, blockLen C.size_t,
+	p C.uint8_t, filter **C.uint8_t, filterLen *C.size_t) C.int {
+
+	if policyName == nil || block == nil || filter == nil ||
+		filterLen == nil {
+
+		return C.BIP158_ERR_INVALID_ARGUMENT
+	}
+	policy, err := builder.LookupPolicy(C.GoString(policyName))
+	if err != nil {
+		return C.BIP158_ERR_UNKNOWN_POLICY
+	}
+
+	var msgBlock wire.MsgBlock
+	err = msgBlock.Deserialize(bytes.NewReader(goBytes(block, blockLen)))
+	if err != nil {
+		return C.BIP158_ERR_BAD_BLOCK
+	}
+	f, err := builder.BuildFilter(policy, &msgBlock, uint8(p))
+	if err != nil {
+		return C.BIP158_ERR_BAD_BLOCK
+	}
+	if f == nil {
+		f = &gcs.Filter{}
+	}
+	nBytes, err := f.NBytes()
+	if err != nil {
+		return C.BIP158_ERR_BAD_FILTER
+	}
+
+	*filter = (*C.uint8_t)(C.CBytes(nBytes))
+	*filterLen = C.size_t(len(nBytes))
+	return C.BIP158_OK
+}
+
+// FreeFilter frees a filter returned by BuildFilter.
+//
+//export FreeFilter
+func FreeFilter(filter *C.uint8_t) {
+	C.free(unsafe.Pointer(filter))
+}
+
+// MatchAny sets *match to 1 if any of the count elements, of the lengths in
+// elementLens, matches the filter of the block with the passed hash, which
+// was built with the Golomb-Rice parameter p, and to 0 otherwise.
+//
+//export MatchAny
+func MatchAny(filter *C.uint8_t, filterLen C.size_t, p C.uint8_t,
+	blockHash *C.uint8_t, elements **C.uint8_t, elementLens *C.size_t,
+	count C.size_t, match *C.int) C.int {
+
+	if filter == nil || blockHash == nil || match == nil ||
+		(count > 0 && (elements == nil || elementLens == nil)) {
+
+		return C.BIP158_ERR_INVALID_ARGUMENT
+	}
+	f, err := gcs.FromNBytes(uint8(p), goBytes(filter, filterLen))
+	if err != nil {
+		return C.BIP158_ERR_BAD_FILTER
+	}
+
+	data := make([][]byte, count)
+	if count > 0 {
+		ptrs := unsafe.Slice(elements, int(count))
+		lens := unsafe.Slice(elementLens, int(count))
+		for i := range data {
+			data[i] = goBytes(ptrs[i], lens[i])
+		}
+	}
+
+	hash := goHash(blockHash)
+	matched, err := f.MatchAny(builder.DeriveKey(&hash), data)
+	if err != nil {
+		return C.BIP158_ERR_BAD_FILTER
+	}
+	*match = 0
+	if matched {
+		*match = 1
+	}
+	return C.BIP158_OK
+}
+
+// VerifyHeaderChain checks that the count filters, of the lengths in
+// filterLens, chain from prevHeader to the count filter headers stored one
+// after the other in headers. If a header doesn't match, it returns
+// BIP158_ERR_HEADER_MISMATCH and stores the index of the first one that
+// doesn't in *failedIndex, which may be NULL.
+//
+//export VerifyHeaderChain
+func VerifyHeaderChain(prevHeader *C.uint8_t, filters **C.uint8_t,
+	filterLens *C.size_t, headers *C.uint8_t, count C.size_t,
+	failedIndex *C.size_t) C.int {
+
+	if prevHeader == nil || (count > 0 && (filters == nil ||
+		filterLens == nil || headers == nil)) {
+
+		return C.BIP158_ERR_INVALID_ARGUMENT
+	}
+	if count == 0 {
+		return C.BIP158_OK
+	}
+
+	ptrs := unsafe.Slice(filters, int(count))
+	lens := unsafe.Slice(filterLens, int(count))
+	want := goBytes(headers, count*chainhash.HashSize)
+	header := goHash(prevHeader)
+	for i := range ptrs {
+		// The header commits to the serialized filter, whatever its
+		// P, so any value will do to parse it.
+		f, err := gcs.FromNBytes(builder.DefaultP,
+			goBytes(ptrs[i], lens[i]))
+		if err != nil {
+			return C.BIP158_ERR_BAD_FILTER
+		}
+		header, err = builder.MakeHeaderForFilter(f, header)
+		if err != nil {
+			return C.BIP158_ERR_BAD_FILTER
+		}
+
+		wantHeader := want[i*chainhash.HashSize : (i+1)*chainhash.HashSize]
+		if !bytes.Equal(header[:], wantHeader) {
+			if failedIndex != nil {
+				*failedIndex = C.size_t(i)
+			}
+			return C.BIP158_ERR_HEADER_MISMATCH
+		}
+	}
+
+	return C.BIP158_OK
+}
+
+// main is required by -buildmode=c-shared but never called.
+func main() {}
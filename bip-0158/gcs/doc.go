@@ -0,0 +1,39 @@
+/*
+Package gcs provides an API for building and using a Golomb-coded set filter
+as specified in BIP 158.
+
+# Golomb-Coded Set
+
+A Golomb-coded set is a probabilistic data structure used similarly to a Bloom
+filter. A filter uses constant-size overhead plus on average roughly P+1.6
+bits per item added to the filter, where 2^-P is the desired false positive
+(collision) probability. EstimateSize can be used to predict the size of a
+filter before building it.
+
+Items are hashed with SipHash-2-4 under a 128-bit key and mapped uniformly
+onto the range [0, N * 2^P) using a multiply-and-shift reduction. The hashed
+values are then sorted and the deltas between successive values are written
+to a bit stream using Golomb-Rice coding with parameter P.
+
+# GCS use in Bitcoin
+
+BIP 158 defines per-block filters which a full node sends to light clients,
+which then check them against their own list of relevant items. The key used
+for a block filter is the first 16 bytes of the block hash, as returned by
+DeriveKey; KeyFromBytes and KeyFromHex accept any other 128-bit key, and
+HashElement exposes the value an element is represented by, for code matching
+filters by other means. The serialized
+form of a filter is N encoded as a CompactSize followed by the Golomb-Rice
+coded data. The builder sub-package contains helpers for deriving keys and
+adding Bitcoin-specific elements such as outpoints and scripts.
+
+# Use from other languages
+
+The package and the builder sub-package use neither cgo nor files or network
+connections, so they compile to WebAssembly. The wasm sub-package is a
+WebAssembly build exposing filter building, matching and header computation to
+JavaScript, so that browser based wallets can verify filters client-side. The
+cshared sub-package exports the same operations as a C library, for wallets in
+Swift, Kotlin and other languages with a C foreign function interface.
+*/
+package gcs
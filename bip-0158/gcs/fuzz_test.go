@@ -0,0 +1,170 @@
+package gcs_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/christsim/bips/bip-0158/backend/chainhash"
+	"github.com/christsim/bips/bip-0158/gcs"
+	"github.com/christsim/bips/bip-0158/gcs/builder"
+	"github.com/christsim/bips/bip-0158/gcs/gcsfuzz"
+)
+
+// seedFilters are serialized filters added to every target's seed inputs.
+var seedFilters = []string{
+	// Empty filter.
+	"00",
+
+	// Basic filter of the testnet genesis block at P = 20.
+	"0285c7cdbe33a0",
+
+	// Basic filter of testnet block 1 at P = 20.
+	"026929d09bee00",
+}
+
+// addSeeds adds each seed filter to the target, passing it to the function
+// returning the target's arguments.
+func addSeeds(f *testing.F, args func(filter []byte) []interface{}) {
+	for _, s := range seedFilters {
+		filter, err := hex.DecodeString(s)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(args(filter)...)
+	}
+}
+
+// FuzzDecode checks that decoding arbitrary data as a filter never panics,
+// and that any filter that decodes and validates serializes back to the same
+// bytes and can be queried without errors.
+func FuzzDecode(f *testing.F) {
+	addSeeds(f, func(filter []byte) []interface{} {
+		return []interface{}{uint8(builder.DefaultP), filter}
+	})
+
+	f.Fuzz(func(t *testing.T, p uint8, data []byte) {
+		p %= gcs.MaxP + 1
+		filter, err := gcs.FromNBytes(p, data)
+		if err != nil {
+			return
+		}
+		if err := filter.Validate(); err != nil {
+			return
+		}
+
+		nBytes, err := filter.NBytes()
+		if err != nil {
+			t.Fatalf("NBytes of valid filter: %v", err)
+		}
+		if !bytes.Equal(nBytes, data) {
+			t.Fatalf("filter serialized as %x, decoded from %x",
+				nBytes, data)
+		}
+
+		var key [gcs.KeySize]byte
+		if _, err := filter.Match(key, data); err != nil {
+			t.Fatalf("Match on valid filter: %v", err)
+		}
+		if _, err := filter.MatchAny(key, [][]byte{data}); err != nil {
+			t.Fatalf("MatchAny on valid filter: %v", err)
+		}
+	})
+}
+
+// FuzzHeader checks that the header of any decodable filter is the double
+// SHA-256 of the filter's hash and the previous header.
+func FuzzHeader(f *testing.F) {
+	addSeeds(f, func(filter []byte) []interface{} {
+		return []interface{}{filter, make([]byte, chainhash.HashSize)}
+	})
+
+	f.Fuzz(func(t *testing.T, data []byte, prev []byte) {
+		if len(prev) != chainhash.HashSize {
+			return
+		}
+		filter, err := gcs.FromNBytes(builder.DefaultP, data)
+		if err != nil {
+			return
+		}
+
+		var prevHeader chainhash.Hash
+		copy(prevHeader[:], prev)
+		header, err := builder.MakeHeaderForFilter(filter, prevHeader)
+		if err != nil {
+			t.Fatalf("MakeHeaderForFilter: %v", err)
+		}
+
+		filterHash := chainhash.DoubleHashB(data)
+		expected := chainhash.DoubleHashH(append(filterHash, prev...))
+		if header != expected {
+			t.Fatalf("header is %v, expected %v", header, expected)
+		}
+	})
+}
+
+// FuzzMatchAny checks that, for any decodable filter, MatchAny agrees with
+// matching each query element in turn, and that a filter built from the
+// query elements matches every one of them.
+func FuzzMatchAny(f *testing.F) {
+	addSeeds(f, func(filter []byte) []interface{} {
+		return []interface{}{uint8(builder.DefaultP),
+			make([]byte, gcs.KeySize), filter,
+			gcsfuzz.JoinElements([][]byte{{0x51}, {}, filter})}
+	})
+
+	f.Fuzz(func(t *testing.T, p uint8, keyBytes, data, query []byte) {
+		p %= gcs.MaxP + 1
+		var key [gcs.KeySize]byte
+		copy(key[:], keyBytes)
+		elements := gcsfuzz.SplitElements(query)
+
+		// A filter built from the elements must match each of them.
+		if len(elements) > 0 {
+			built, err := gcs.BuildGCSFilter(p, key, elements)
+			if err != nil {
+				t.Fatalf("BuildGCSFilter: %v", err)
+			}
+			for _, element := range elements {
+				match, err := built.Match(key, element)
+				if err != nil || !match {
+					t.Fatalf("built filter doesn't match %x: %v",
+						element, err)
+				}
+			}
+			match, err := built.MatchAny(key, elements)
+			if err != nil || !match {
+				t.Fatalf("built filter doesn't match any: %v", err)
+			}
+		}
+
+		filter, err := gcs.FromNBytes(p, data)
+		if err != nil {
+			return
+		}
+		valid := filter.Validate() == nil
+
+		var want bool
+		for _, element := range elements {
+			match, err := filter.Match(key, element)
+			if err != nil {
+				if valid {
+					t.Fatalf("Match on valid filter: %v", err)
+				}
+				return
+			}
+			want = want || match
+		}
+		got, err := filter.MatchAny(key, elements)
+		if err != nil {
+			if valid {
+				t.Fatalf("MatchAny on valid filter: %v", err)
+			}
+			return
+		}
+		if got != want {
+			t.Fatalf("MatchAny returned %v, matching each element "+
+				"returned %v", got, want)
+		}
+	})
+}
@@ -0,0 +1,541 @@
+package gcs
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"math/bits"
+	"slices"
+	"sort"
+
+	"github.com/aead/siphash"
+	"github.com/christsim/bips/bip-0158/golomb"
+)
+
+var (
+	// ErrNTooBig signifies that the filter can't handle N items.
+	ErrNTooBig = errors.New("N is too big to fit in uint32")
+
+	// ErrPTooBig signifies that the filter can't handle `1/2**P`
+	// collision probability.
+	ErrPTooBig = errors.New("P is too big to fit in uint32")
+
+	// ErrInvalidM signifies that M is zero or too big for N * M to fit in
+	// 64 bits.
+	ErrInvalidM = errors.New("M must be between 1 and 2^32")
+
+	// ErrNonCanonicalVarInt is returned when N is not encoded using the
+	// minimal number of bytes.
+	ErrNonCanonicalVarInt = errors.New("non-canonical CompactSize for N")
+
+	// ErrFilterTruncated is returned by Validate when the filter data ends
+	// before all N elements have been decoded.
+	ErrFilterTruncated = errors.New("filter data ends before N elements")
+
+	// ErrTrailingData is returned by Validate when anything other than
+	// zero padding follows the last element of the filter.
+	ErrTrailingData = errors.New("filter has data after its last element")
+)
+
+const (
+	// KeySize is the size of the byte array required for key material for
+	// the SipHash keyed hash function.
+	KeySize = 16
+
+	// MaxP is the largest collision probability parameter a filter can be
+	// built with. Any larger value would allow N * 2^P to overflow 64
+	// bits.
+	MaxP = 32
+
+	// MaxM is the largest inverse false positive rate a filter can be
+	// built with.
+	MaxM = 1 << MaxP
+)
+
+// fastReduction maps v uniformly onto the range [0, modulus) by taking the
+// high 64 bits of the 128-bit product v * modulus. This is equivalent in
+// distribution to v mod modulus but avoids the costly division, as described
+// in:
+// https://lemire.me/blog/2016/06/27/a-fast-alternative-to-the-modulo-reduction/
+func fastReduction(v, modulus uint64) uint64 {
+	hi, _ := bits.Mul64(v, modulus)
+	return hi
+}
+
+// hashToRange hashes data with SipHash-2-4 under key and reduces the result
+// to the range [0, modulus).
+func hashToRange(data []byte, key *[KeySize]byte, modulus uint64) uint64 {
+	return fastReduction(siphash.Sum64(data, key), modulus)
+}
+
+// Filter describes an immutable filter that can be built from a set of data
+// elements, serialized, deserialized, and queried in a thread-safe manner. The
+// serialized form is compressed as a Golomb Coded Set (GCS), but does not
+// include N or P to allow the user to encode the metadata separately if
+// necessary. The hash function used is SipHash, a keyed function; the key used
+// in building the filter is required in order to match filter values and is
+// not included in the serialized form.
+type Filter struct {
+	n          uint32
+	p          uint8
+	m          uint64
+	modulusNP  uint64
+	filterData []byte
+}
+
+// BuildGCSFilter builds a new GCS filter with the collision probability of
+// `1/(2**P)`, key `key`, and including every `[]byte` in `data` as a member of
+// the set. Callers are expected to have removed duplicate entries from data.
+func BuildGCSFilter(P uint8, key [KeySize]byte, data [][]byte) (*Filter, error) {
+	if P > MaxP {
+		return nil, ErrPTooBig
+	}
+
+	return BuildGCSFilterM(P, 1<<P, key, data)
+}
+
+// BuildGCSFilterM is like BuildGCSFilter, but elements are hashed onto the
+// range [0, N * M) rather than [0, N * 2^P), for a collision probability of
+// 1/M. Decoupling M from the Golomb-Rice parameter P allows smaller filters
+// for the same collision probability; BIP 158 as finally specified uses
+// P = 19 and M = 784931.
+func BuildGCSFilterM(P uint8, M uint64, key [KeySize]byte,
+	data [][]byte) (*Filter, error) {
+
+	// Some initial parameter checks: make sure our parameters will fit
+	// the hash function we're using.
+	if uint64(len(data)) >= (1 << 32) {
+		return nil, ErrNTooBig
+	}
+	if P > MaxP {
+		return nil, ErrPTooBig
+	}
+	if M == 0 || M > MaxM {
+		return nil, ErrInvalidM
+	}
+
+	// Create the filter object and insert metadata.
+	f := Filter{
+		n: uint32(len(data)),
+		p: P,
+	}
+	f.setM(M)
+
+	// Shortcut if the filter is empty.
+	if f.n == 0 {
+		return &f, nil
+	}
+
+	// Hash each data element onto the range [0, N * M) and sort the
+	// results so that we can encode the deltas between them.
+	values := make([]uint64, 0, len(data))
+	for _, d := range data {
+		values = append(values, hashToRange(d, &key, f.modulusNP))
+	}
+	sort.Slice(values, func(i, j int) bool {
+		return values[i] < values[j]
+	})
+
+	// Each value takes P+1 bits at minimum, plus on average another bit
+	// of unary quotient, so we size the stream accordingly to avoid
+	// repeated reallocations.
+	w := golomb.NewBuffer(int((uint64(f.n)*uint64(P+2) + 7) / 8))
+
+	// Write the sorted list of values into the filter bitstream,
+	// compressing it using Golomb-Rice coding.
+	var lastValue uint64
+	for _, v := range values {
+		delta := v - lastValue
+		lastValue = v
+
+		// The quotient is written in unary, and the remainder as a
+		// P-bit big-endian integer.
+		w.WriteUint64(P, delta)
+	}
+
+	f.filterData = w.Bytes()
+
+	return &f, nil
+}
+
+// EstimateSize predicts the length in bytes of the serialized form (as
+// returned by NBytes) of a filter containing n items with collision
+// probability `1/(2**P)`, without having to hash or encode any data.
+//
+// Since the hashed values are distributed uniformly over [0, N * 2^P), the
+// deltas between them are approximately exponentially distributed with mean
+// 2^P. The Golomb-Rice quotient of each delta is then geometrically
+// distributed with an expected value of 1/(e-1), and each value takes a
+// further P+1 bits for the remainder and the unary terminator. The
+// approximation is very close for the values of P used in practice, but
+// underestimates slightly for very small P, where the hashed values are
+// too coarse for the deltas to follow the continuous distribution.
+func EstimateSize(n uint32, P uint8) int {
+	if n == 0 {
+		return compactSizeLen(0)
+	}
+
+	bitsPerItem := float64(P) + 1 + 1/(math.E-1)
+	dataBytes := int(math.Ceil(float64(n) * bitsPerItem / 8))
+
+	return compactSizeLen(uint64(n)) + dataBytes
+}
+
+// EstimateSizeM is like EstimateSize for a filter built with
+// BuildGCSFilterM. The deltas between hashed values then have mean M, so the
+// quotient of each has an expected value of 1/(e^(2^P/M)-1).
+func EstimateSizeM(n uint32, P uint8, M uint64) int {
+	if n == 0 {
+		return compactSizeLen(0)
+	}
+
+	ratio := math.Ldexp(1, int(P)) / float64(M)
+	bitsPerItem := float64(P) + 1 + 1/math.Expm1(ratio)
+	dataBytes := int(math.Ceil(float64(n) * bitsPerItem / 8))
+
+	return compactSizeLen(uint64(n)) + dataBytes
+}
+
+// setM sets the filter's M and derives the range elements are hashed onto.
+func (f *Filter) setM(M uint64) {
+	f.m = M
+	f.modulusNP = uint64(f.n) * M
+}
+
+// FromBytes deserializes a GCS filter from a known N, P, and serialized filter
+// as returned by Bytes().
+func FromBytes(N uint32, P uint8, d []byte) (*Filter, error) {
+	// Basic sanity check.
+	if P > MaxP {
+		return nil, ErrPTooBig
+	}
+
+	// Create the filter object and insert metadata.
+	f := &Filter{
+		n: N,
+		p: P,
+	}
+	f.setM(1 << P)
+
+	// Copy the filter.
+	f.filterData = make([]byte, len(d))
+	copy(f.filterData, d)
+
+	return f, nil
+}
+
+// FromNBytesM is like FromNBytes for a filter built with BuildGCSFilterM.
+func FromNBytesM(P uint8, M uint64, d []byte) (*Filter, error) {
+	if M == 0 || M > MaxM {
+		return nil, ErrInvalidM
+	}
+
+	f, err := FromNBytes(P, d)
+	if err != nil {
+		return nil, err
+	}
+	f.setM(M)
+
+	return f, nil
+}
+
+// FromNBytes deserializes a GCS filter from a known P, and serialized N and
+// filter as returned by NBytes().
+func FromNBytes(P uint8, d []byte) (*Filter, error) {
+	N, size, err := readCompactSize(d)
+	if err != nil {
+		return nil, err
+	}
+	if N >= (1 << 32) {
+		return nil, ErrNTooBig
+	}
+
+	return FromBytes(uint32(N), P, d[size:])
+}
+
+// FromNBytesNoCopy is like FromNBytes, but the returned filter refers to d
+// directly instead of copying it, which lets filters be queried straight out
+// of memory-mapped storage. d must not be modified while the filter is in
+// use.
+func FromNBytesNoCopy(P uint8, d []byte) (*Filter, error) {
+	// Basic sanity check.
+	if P > MaxP {
+		return nil, ErrPTooBig
+	}
+
+	N, size, err := readCompactSize(d)
+	if err != nil {
+		return nil, err
+	}
+	if N >= (1 << 32) {
+		return nil, ErrNTooBig
+	}
+
+	f := &Filter{
+		n:          uint32(N),
+		p:          P,
+		filterData: d[size:len(d):len(d)],
+	}
+	f.setM(1 << P)
+
+	return f, nil
+}
+
+// Bytes returns the serialized format of the GCS filter, which does not
+// include N or P (returned by separate methods) or the key used by SipHash.
+func (f *Filter) Bytes() ([]byte, error) {
+	filterData := make([]byte, len(f.filterData))
+	copy(filterData, f.filterData)
+	return filterData, nil
+}
+
+// NBytes returns the serialized format of the GCS filter with N, which does
+// not include P (returned by a separate method) or the key used by SipHash.
+// This is the serialization used by BIP 158.
+func (f *Filter) NBytes() ([]byte, error) {
+	size := compactSizeLen(uint64(f.n))
+	filterData := make([]byte, size+len(f.filterData))
+	putCompactSize(filterData, uint64(f.n))
+	copy(filterData[size:], f.filterData)
+	return filterData, nil
+}
+
+// P returns the filter's collision probability as a negative power of 2 (that
+// is, a collision probability of `1/2**20` is represented as 20).
+func (f *Filter) P() uint8 {
+	return f.p
+}
+
+// M returns the inverse collision probability the filter was built with,
+// which is 2^P unless it was built with BuildGCSFilterM.
+func (f *Filter) M() uint64 {
+	return f.m
+}
+
+// N returns the size of the data set used to build the filter.
+func (f *Filter) N() uint32 {
+	return f.n
+}
+
+// Match checks whether a []byte value is likely (within collision probability)
+// to be a member of the set represented by the filter. Match does not
+// allocate, so it is safe to call in tight loops over many filters.
+func (f *Filter) Match(key [KeySize]byte, data []byte) (bool, error) {
+	var r golomb.SliceReader
+	return f.match(&r, &key, data)
+}
+
+// match hashes data under key and checks whether the result is present in the
+// filter, decoding the filter with the passed reader.
+func (f *Filter) match(r *golomb.SliceReader, key *[KeySize]byte, data []byte) (bool, error) {
+	// An empty filter can't match anything, and would otherwise reduce
+	// every term to zero.
+	if f.n == 0 {
+		return false, nil
+	}
+
+	// Hash our search term with the same parameters as the filter.
+	return f.matchHash(r, hashToRange(data, key, f.modulusNP))
+}
+
+// matchHash checks whether a term that has already been hashed onto the
+// filter's range is present in the filter.
+func (f *Filter) matchHash(r *golomb.SliceReader, term uint64) (bool, error) {
+	r.Reset(f.filterData)
+
+	// Go through the search filter and look for the desired value. Since
+	// the values are sorted, we can stop as soon as we've passed the
+	// term.
+	var lastValue uint64
+	for i := uint32(0); i < f.n; i++ {
+		// Read the difference between previous and new value from
+		// bitstream and add the previous value to it.
+		delta, err := r.ReadUint64(f.p)
+		if err != nil {
+			if err == io.EOF {
+				return false, nil
+			}
+			return false, err
+		}
+		value := lastValue + delta
+
+		switch {
+		case value == term:
+			return true, nil
+		case value > term:
+			return false, nil
+		}
+
+		lastValue = value
+	}
+
+	return false, nil
+}
+
+// MatchAny checks whether any []byte value is likely (within collision
+// probability) to be a member of the set represented by the filter. The query
+// set is hashed and sorted once, after which the filter is decoded in a single
+// pass, which is much faster than calling Match for each value individually.
+func (f *Filter) MatchAny(key [KeySize]byte, data [][]byte) (bool, error) {
+	// Basic sanity check.
+	if len(data) == 0 || f.n == 0 {
+		return false, nil
+	}
+
+	// Create an uncompressed, sorted set of the search values.
+	values := make([]uint64, 0, len(data))
+	for _, d := range data {
+		values = append(values, hashToRange(d, &key, f.modulusNP))
+	}
+	slices.Sort(values)
+
+	var r golomb.SliceReader
+	return f.matchAnySorted(&r, values)
+}
+
+// matchAnySorted checks whether any of the passed terms, which must already be
+// hashed onto the filter's range and sorted in ascending order, is present in
+// the filter. Both sets are walked in lockstep, so the filter is decoded at
+// most once, and the search terminates as soon as either a match is found or
+// one of the sets is exhausted.
+func (f *Filter) matchAnySorted(r *golomb.SliceReader, terms []uint64) (bool, error) {
+	r.Reset(f.filterData)
+
+	// Zip down the filter and the search terms, comparing values until we
+	// either run out of values to compare in one of them or we reach a
+	// matching value.
+	var (
+		value uint64
+		idx   int
+	)
+	for i := uint32(0); i < f.n; i++ {
+		delta, err := r.ReadUint64(f.p)
+		if err != nil {
+			if err == io.EOF {
+				return false, nil
+			}
+			return false, err
+		}
+		value += delta
+
+		// Skip over all the search terms that are smaller than the
+		// current filter value, since they can no longer match.
+		for terms[idx] < value {
+			idx++
+			if idx == len(terms) {
+				return false, nil
+			}
+		}
+
+		if terms[idx] == value {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// Validate decodes every element of the filter to check that the data holds
+// exactly N Golomb-Rice coded values followed by at most seven bits of zero
+// padding. Filters received from untrusted peers can be checked with it
+// before use; Match and MatchAny don't reject malformed filters themselves,
+// they merely stop early.
+func (f *Filter) Validate() error {
+	var r golomb.SliceReader
+	r.Reset(f.filterData)
+	for i := uint32(0); i < f.n; i++ {
+		_, err := r.ReadUint64(f.p)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return ErrFilterTruncated
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// Anything past the byte holding the last bit must not exist, and the
+	// rest of that byte must be zero.
+	pos := r.Pos()
+	used := (pos + 7) / 8
+	if used != uint64(len(f.filterData)) {
+		return ErrTrailingData
+	}
+	if pos%8 != 0 && f.filterData[used-1]&(0xff>>(pos%8)) != 0 {
+		return ErrTrailingData
+	}
+
+	return nil
+}
+
+// compactSizeLen returns the number of bytes needed to encode v as a
+// CompactSize.
+func compactSizeLen(v uint64) int {
+	switch {
+	case v < 0xfd:
+		return 1
+	case v <= 0xffff:
+		return 3
+	case v <= 0xffffffff:
+		return 5
+	default:
+		return 9
+	}
+}
+
+// putCompactSize encodes v as a CompactSize into buf, which must be at least
+// compactSizeLen(v) bytes long.
+func putCompactSize(buf []byte, v uint64) {
+	switch {
+	case v < 0xfd:
+		buf[0] = uint8(v)
+	case v <= 0xffff:
+		buf[0] = 0xfd
+		binary.LittleEndian.PutUint16(buf[1:], uint16(v))
+	case v <= 0xffffffff:
+		buf[0] = 0xfe
+		binary.LittleEndian.PutUint32(buf[1:], uint32(v))
+	default:
+		buf[0] = 0xff
+		binary.LittleEndian.PutUint64(buf[1:], v)
+	}
+}
+
+// readCompactSize decodes a CompactSize from the start of buf, returning the
+// value and the number of bytes it occupied. Non-canonical encodings are
+// rejected.
+func readCompactSize(buf []byte) (uint64, int, error) {
+	if len(buf) == 0 {
+		return 0, 0, io.EOF
+	}
+
+	var v, min uint64
+	size := 1
+	switch buf[0] {
+	case 0xfd:
+		size, min = 3, 0xfd
+	case 0xfe:
+		size, min = 5, 0x10000
+	case 0xff:
+		size, min = 9, 0x100000000
+	default:
+		return uint64(buf[0]), 1, nil
+	}
+
+	if len(buf) < size {
+		return 0, 0, io.ErrUnexpectedEOF
+	}
+	switch size {
+	case 3:
+		v = uint64(binary.LittleEndian.Uint16(buf[1:]))
+	case 5:
+		v = uint64(binary.LittleEndian.Uint32(buf[1:]))
+	case 9:
+		v = binary.LittleEndian.Uint64(buf[1:])
+	}
+	if v < min {
+		return 0, 0, ErrNonCanonicalVarInt
+	}
+
+	return v, size, nil
+}
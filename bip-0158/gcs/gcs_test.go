@@ -0,0 +1,216 @@
+package gcs_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/christsim/bips/bip-0158/backend/chainhash"
+	"github.com/christsim/bips/bip-0158/backend/wire"
+	"github.com/christsim/bips/bip-0158/gcs"
+	"github.com/christsim/bips/bip-0158/gcs/builder"
+)
+
+// vectorP is the Golomb-Rice parameter of the filters of testnet-20.json.
+const vectorP = 20
+
+// vectorRow is a row of testnet-20.json.
+type vectorRow struct {
+	height      float64
+	block       *wire.MsgBlock
+	prevHeaders [2]chainhash.Hash
+	filters     [2][]byte
+	headers     [2]chainhash.Hash
+	notes       string
+}
+
+// loadVectors reads the rows of testnet-20.json, skipping its header row.
+func loadVectors(t *testing.T) []vectorRow {
+	t.Helper()
+
+	data, err := os.ReadFile("../testnet-20.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var raw [][]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		t.Fatal(err)
+	}
+	if len(raw) < 2 {
+		t.Fatal("no test cases in testnet-20.json")
+	}
+
+	hexField := func(row []interface{}, i int) []byte {
+		t.Helper()
+		s, ok := row[i].(string)
+		if !ok {
+			t.Fatalf("row %v: field %d isn't a string", row[0], i)
+		}
+		b, err := hex.DecodeString(s)
+		if err != nil {
+			t.Fatalf("row %v: field %d: %v", row[0], i, err)
+		}
+		return b
+	}
+	hashField := func(row []interface{}, i int) chainhash.Hash {
+		t.Helper()
+		hash, err := chainhash.NewHashFromStr(row[i].(string))
+		if err != nil {
+			t.Fatalf("row %v: field %d: %v", row[0], i, err)
+		}
+		return *hash
+	}
+
+	var rows []vectorRow
+	for _, row := range raw[1:] {
+		if len(row) != 10 {
+			t.Fatalf("row %v has %d fields", row[0], len(row))
+		}
+		block := &wire.MsgBlock{}
+		err := block.Deserialize(bytes.NewReader(hexField(row, 2)))
+		if err != nil {
+			t.Fatalf("row %v: %v", row[0], err)
+		}
+		rows = append(rows, vectorRow{
+			height: row[0].(float64),
+			block:  block,
+			prevHeaders: [2]chainhash.Hash{
+				hashField(row, 3), hashField(row, 4),
+			},
+			filters: [2][]byte{hexField(row, 5), hexField(row, 6)},
+			headers: [2]chainhash.Hash{
+				hashField(row, 7), hashField(row, 8),
+			},
+			notes: row[9].(string),
+		})
+	}
+	return rows
+}
+
+// TestVectors builds the basic and extended filters of every block of
+// testnet-20.json and checks them and their headers against the vectors, and
+// that every element of each filter matches both the built filter and the one
+// decoded from the vectors, one at a time and all at once.
+func TestVectors(t *testing.T) {
+	policies := [2]builder.FilterPolicy{
+		builder.BasicPolicy{ScriptTypes: builder.AllScriptTypes},
+		builder.ExtendedPolicy{},
+	}
+
+	for _, row := range loadVectors(t) {
+		blockHash := row.block.BlockHash()
+		key := builder.DeriveKey(&blockHash)
+
+		for i, policy := range policies {
+			b := builder.WithKeyHashP(&blockHash, vectorP)
+			policy.AddBlock(b, row.block)
+			filter, err := b.Build()
+			if err != nil {
+				t.Fatalf("height %v (%s), %s: %v", row.height,
+					row.notes, policy.Name(), err)
+			}
+
+			nBytes, err := filter.NBytes()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(nBytes, row.filters[i]) {
+				t.Fatalf("height %v (%s), %s filter: got %x, "+
+					"want %x", row.height, row.notes,
+					policy.Name(), nBytes, row.filters[i])
+			}
+
+			header, err := builder.MakeHeaderForFilter(filter,
+				row.prevHeaders[i])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if header != row.headers[i] {
+				t.Fatalf("height %v (%s), %s header: got %v, "+
+					"want %v", row.height, row.notes,
+					policy.Name(), header, row.headers[i])
+			}
+
+			decoded, err := gcs.FromNBytes(vectorP, row.filters[i])
+			if err != nil {
+				t.Fatalf("height %v, %s: %v", row.height,
+					policy.Name(), err)
+			}
+			if decoded.N() != filter.N() {
+				t.Fatalf("height %v, %s: decoded N %d, built %d",
+					row.height, policy.Name(), decoded.N(),
+					filter.N())
+			}
+
+			entries, err := b.Entries()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if uint32(len(entries)) != filter.N() {
+				t.Fatalf("height %v, %s: %d entries, N %d",
+					row.height, policy.Name(), len(entries),
+					filter.N())
+			}
+			matcher := gcs.NewMatcher(len(entries))
+			for _, f := range []*gcs.Filter{filter, decoded} {
+				for _, entry := range entries {
+					match, err := f.Match(key, entry)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if !match {
+						t.Fatalf("height %v, %s: %x "+
+							"doesn't match", row.height,
+							policy.Name(), entry)
+					}
+					match, err = matcher.Match(f, key, entry)
+					if err != nil || !match {
+						t.Fatalf("height %v, %s: matcher "+
+							"doesn't match %x: %v",
+							row.height, policy.Name(),
+							entry, err)
+					}
+				}
+				if len(entries) == 0 {
+					continue
+				}
+
+				match, err := f.MatchAny(key, entries)
+				if err != nil || !match {
+					t.Fatalf("height %v, %s: MatchAny of "+
+						"all entries: %v, %v", row.height,
+						policy.Name(), match, err)
+				}
+				match, err = matcher.MatchAny(f, key, entries)
+				if err != nil || !match {
+					t.Fatalf("height %v, %s: matcher MatchAny "+
+						"of all entries: %v, %v",
+						row.height, policy.Name(), match, err)
+				}
+			}
+		}
+	}
+}
+
+// TestEmptyFilter checks that a filter without elements serializes to a zero
+// count and matches nothing.
+func TestEmptyFilter(t *testing.T) {
+	var key [gcs.KeySize]byte
+	filter, err := gcs.FromNBytes(vectorP, []byte{0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filter.N() != 0 {
+		t.Fatalf("N = %d, want 0", filter.N())
+	}
+	match, err := filter.Match(key, []byte("element"))
+	if err != nil || match {
+		t.Fatalf("Match = %v, %v, want false", match, err)
+	}
+	match, err = filter.MatchAny(key, [][]byte{[]byte("element")})
+	if err != nil || match {
+		t.Fatalf("MatchAny = %v, %v, want false", match, err)
+	}
+}
@@ -0,0 +1,79 @@
+// Package gcsfuzz holds helpers for the native Go fuzz targets of the gcs
+// package, which decodes filters received from untrusted peers. The targets
+// take queries as elements joined with JoinElements, and are fuzzed with
+//
+//	go test -fuzz FuzzDecode ./gcs
+//
+// Seed inputs can be added on top of the built-in ones by writing a corpus
+// from the test vectors with WriteCorpusEntry, which the generator's corpus
+// subcommand does.
+package gcsfuzz
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// SplitElements splits the elements of a fuzzed query, each prefixed by its
+// length in a single byte. A truncated last element is kept as is.
+func SplitElements(data []byte) [][]byte {
+	var elements [][]byte
+	for len(data) > 0 {
+		n := int(data[0])
+		data = data[1:]
+		if n > len(data) {
+			n = len(data)
+		}
+		elements = append(elements, data[:n])
+		data = data[n:]
+	}
+	return elements
+}
+
+// JoinElements is the inverse of SplitElements. Elements longer than 255
+// bytes are truncated.
+func JoinElements(elements [][]byte) []byte {
+	var data []byte
+	for _, element := range elements {
+		if len(element) > 255 {
+			element = element[:255]
+		}
+		data = append(data, byte(len(element)))
+		data = append(data, element...)
+	}
+	return data
+}
+
+// WriteCorpusEntry writes a seed input for the named target to the target's
+// directory under dir, in the format go test reads from testdata/fuzz. The
+// values must be of the types the target takes, which for the targets of the
+// gcs package are uint8 and []byte. The file is named after its contents, so
+// writing the same input twice is harmless.
+func WriteCorpusEntry(dir, target string, values ...interface{}) error {
+	var b strings.Builder
+	b.WriteString("go test fuzz v1\n")
+	for _, value := range values {
+		switch v := value.(type) {
+		case uint8:
+			fmt.Fprintf(&b, "byte(%d)\n", v)
+		case []byte:
+			fmt.Fprintf(&b, "[]byte(%s)\n", strconv.Quote(string(v)))
+		default:
+			return fmt.Errorf("unsupported corpus value type %T",
+				value)
+		}
+	}
+
+	data := []byte(b.String())
+	sum := sha256.Sum256(data)
+	targetDir := filepath.Join(dir, target)
+	if err := os.MkdirAll(targetDir, 0755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%x", sum)[:16]
+	return os.WriteFile(filepath.Join(targetDir, name), data, 0644)
+}
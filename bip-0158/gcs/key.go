@@ -0,0 +1,56 @@
+package gcs
+
+import (
+	"encoding/hex"
+	"errors"
+
+	"github.com/christsim/bips/bip-0158/backend/chainhash"
+)
+
+// ErrInvalidKeySize is returned when key material isn't exactly KeySize
+// bytes long.
+var ErrInvalidKeySize = errors.New("key must be 16 bytes")
+
+// DeriveKey returns the SipHash key of the filter of the block with the
+// passed hash. As specified by BIP 158, this is the first 16 bytes of the
+// block hash in its internal byte order, that is, the reverse of the order in
+// which block hashes are usually displayed.
+func DeriveKey(blockHash *chainhash.Hash) [KeySize]byte {
+	var key [KeySize]byte
+	copy(key[:], blockHash[:KeySize])
+	return key
+}
+
+// KeyFromBytes returns the key holding the passed bytes, which must be
+// exactly KeySize long. It is meant for filters that aren't keyed by a block
+// hash, such as filters over arbitrary sets built with a random or
+// pre-shared key.
+func KeyFromBytes(b []byte) ([KeySize]byte, error) {
+	var key [KeySize]byte
+	if len(b) != KeySize {
+		return key, ErrInvalidKeySize
+	}
+
+	copy(key[:], b)
+	return key, nil
+}
+
+// KeyFromHex is like KeyFromBytes, but takes the key as 32 hex digits.
+func KeyFromHex(s string) ([KeySize]byte, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return [KeySize]byte{}, err
+	}
+
+	return KeyFromBytes(b)
+}
+
+// HashElement returns the value data is represented by in a filter of n
+// elements keyed with key and built with inverse collision probability m,
+// which is 2^P for filters built with BuildGCSFilter. It is the SipHash-2-4
+// of data reduced onto the range [0, n * m), and is exposed for
+// implementations that store or match filters in their own format but must
+// agree with this package on which values a filter holds.
+func HashElement(key [KeySize]byte, data []byte, n uint32, m uint64) uint64 {
+	return hashToRange(data, &key, uint64(n)*m)
+}
@@ -0,0 +1,62 @@
+package gcs
+
+import (
+	"slices"
+
+	"github.com/christsim/bips/bip-0158/golomb"
+)
+
+// Matcher holds the scratch state needed to query filters so that it can be
+// reused across many calls without allocating. This is useful for wallets
+// scanning through a large number of filters, where per-call allocations
+// would otherwise put significant pressure on the garbage collector.
+//
+// A Matcher is not safe for concurrent use; each goroutine should use its
+// own.
+type Matcher struct {
+	r golomb.SliceReader
+
+	// values holds the hashed query terms. It is grown as needed and
+	// reused between calls.
+	values []uint64
+}
+
+// NewMatcher returns a Matcher with room for size query terms before its
+// scratch space needs to grow.
+func NewMatcher(size int) *Matcher {
+	return &Matcher{values: make([]uint64, 0, size)}
+}
+
+// NewMatcherWithScratch returns a Matcher that uses the caller-provided
+// scratch slice to hold hashed query terms. This allows callers that manage
+// their own buffers to avoid allocating entirely.
+func NewMatcherWithScratch(scratch []uint64) *Matcher {
+	return &Matcher{values: scratch[:0]}
+}
+
+// Match checks whether a []byte value is likely (within collision probability)
+// to be a member of the set represented by the filter.
+func (m *Matcher) Match(f *Filter, key [KeySize]byte, data []byte) (bool, error) {
+	return f.match(&m.r, &key, data)
+}
+
+// MatchAny checks whether any []byte value is likely (within collision
+// probability) to be a member of the set represented by the filter. The
+// query terms are hashed and sorted in the Matcher's scratch space, which is
+// grown if it is too small, and the filter is then decoded in a single pass.
+func (m *Matcher) MatchAny(f *Filter, key [KeySize]byte, data [][]byte) (bool, error) {
+	// Basic sanity check.
+	if len(data) == 0 || f.n == 0 {
+		return false, nil
+	}
+
+	// Hash each of the query terms onto the filter's range, reusing the
+	// scratch space from previous calls.
+	m.values = m.values[:0]
+	for _, d := range data {
+		m.values = append(m.values, hashToRange(d, &key, f.modulusNP))
+	}
+	slices.Sort(m.values)
+
+	return f.matchAnySorted(&m.r, m.values)
+}
@@ -0,0 +1,46 @@
+// bip158.js loads the WebAssembly build of the BIP 158 filter code and wraps
+// the functions it registers so that they throw on error. wasm_exec.js from
+// the Go distribution must be loaded first, as it defines the Go class that
+// runs the module. See main.go for how to build bip158.wasm and for what each
+// function does. For example:
+//
+//	const bip158 = await load("bip158.wasm");
+//	const filter = bip158.buildFilter("basic", blockHex);
+//	const script = bip158.addressToScript(address, "mainnet");
+//	if (bip158.match(filter, blockHash, 20, script)) { ... }
+
+// unwrap returns the value of a result from the module, or throws its error.
+function unwrap(result) {
+	if (result.error !== undefined) {
+		throw new Error(result.error);
+	}
+	return result.value;
+}
+
+// load instantiates the module from source, which is either the URL to fetch
+// it from or its bytes, and returns its functions once it is running.
+export async function load(source = "bip158.wasm") {
+	const go = new Go();
+	const { instance } = typeof source === "string"
+		? await WebAssembly.instantiateStreaming(fetch(source),
+			go.importObject)
+		: await WebAssembly.instantiate(source, go.importObject);
+
+	// The module registers its functions as soon as it starts, and keeps
+	// running in the background to serve calls to them.
+	go.run(instance);
+	const raw = globalThis.bip158Go;
+
+	return {
+		buildFilter: (policy, blockHex, p) =>
+			unwrap(raw.buildFilter(policy, blockHex, p)),
+		filterHeader: (filterHex, prevHeader) =>
+			unwrap(raw.filterHeader(filterHex, prevHeader)),
+		match: (filterHex, blockHash, p, elementHex) =>
+			unwrap(raw.match(filterHex, blockHash, p, elementHex)),
+		matchAny: (filterHex, blockHash, p, elementHexes) =>
+			unwrap(raw.matchAny(filterHex, blockHash, p, elementHexes)),
+		addressToScript: (address, network) =>
+			unwrap(raw.addressToScript(address, network)),
+	};
+}
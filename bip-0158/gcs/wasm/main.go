@@ -0,0 +1,269 @@
+//go:build js && wasm
+
+// Command wasm builds the BIP 158 filter code of the gcs and builder packages
+// as a WebAssembly module, so that browser based wallets can build, match and
+// verify filters client-side with this implementation. Build it with:
+//
+//	GOOS=js GOARCH=wasm go build -o bip158.wasm ./gcs/wasm
+//
+// and serve bip158.wasm alongside bip158.js from this directory and the
+// wasm_exec.js support file of the Go distribution, found in lib/wasm under
+// go env GOROOT (misc/wasm before Go 1.24).
+//
+// When run, the module registers its functions on a global bip158Go object
+// and keeps running to serve calls. Each function returns an object holding
+// either its result as value, or a message as error; bip158.js wraps them in
+// functions that throw the error instead. Data is passed as hex strings, and
+// hashes in their usual byte-reversed form:
+//
+//   - buildFilter(policy, blockHex, p) builds the filter of a serialized
+//     block under a registered policy such as "basic", returning it
+//     serialized with its element count as in a cfilter message.
+//   - filterHeader(filterHex, prevHeader) returns the header of a filter
+//     given the previous block's filter header.
+//   - match(filterHex, blockHash, p, elementHex) and matchAny(filterHex,
+//     blockHash, p, elementHexes) check elements against a block's filter.
+//   - addressToScript(address, network) returns the output script paying to
+//     an address on mainnet, testnet3, regtest or simnet, to match against
+//     filters.
+//
+// P defaults to the BIP 158 value of 20 when undefined.
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"syscall/js"
+
+	"github.com/christsim/bips/bip-0158/backend/chaincfg"
+	"github.com/christsim/bips/bip-0158/backend/chainhash"
+	"github.com/christsim/bips/bip-0158/backend/wire"
+	"github.com/christsim/bips/bip-0158/gcs"
+	"github.com/christsim/bips/bip-0158/gcs/builder"
+)
+
+// networks maps the network names accepted by addressToScript to their
+// parameters.
+var networks = map[string]*chaincfg.Params{
+	"mainnet":  &chaincfg.MainNetParams,
+	"testnet3": &chaincfg.TestNet3Params,
+	"regtest":  &chaincfg.RegressionNetParams,
+	"simnet":   &chaincfg.SimNetParams,
+}
+
+// export wraps a function as a JavaScript function returning an object that
+// holds either the function's result as value or its error as error.
+func export(fn func(args []js.Value) (interface{}, error)) js.Func {
+	return js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		value, err := fn(args)
+		if err != nil {
+			return map[string]interface{}{"error": err.Error()}
+		}
+		return map[string]interface{}{"value": value}
+	})
+}
+
+// stringArg returns the ith argument, which must be a string.
+func stringArg(args []js.Value, i int, name string) (string, error) {
+	if i >= len(args) || args[i].Type() != js.TypeString {
+		return "", fmt.Errorf("%v must be a string", name)
+	}
+	return args[i].String(), nil
+}
+
+// hexArg returns the data of the ith argument, which must be a hex string.
+func hexArg(args []js.Value, i int, name string) ([]byte, error) {
+	s, err := stringArg(args, i, name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("%v isn't valid hex: %v", name, err)
+	}
+	return data, nil
+}
+
+// hashArg returns the hash in the ith argument, which must be a hash in its
+// byte-reversed hex form.
+func hashArg(args []js.Value, i int, name string) (*chainhash.Hash, error) {
+	s, err := stringArg(args, i, name)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := chainhash.NewHashFromStr(s)
+	if err != nil {
+		return nil, fmt.Errorf("%v isn't a valid hash: %v", name, err)
+	}
+	return hash, nil
+}
+
+// pArg returns the Golomb-Rice parameter in the ith argument, which defaults
+// to builder.DefaultP if undefined.
+func pArg(args []js.Value, i int) (uint8, error) {
+	if i >= len(args) || args[i].IsUndefined() {
+		return builder.DefaultP, nil
+	}
+	if args[i].Type() != js.TypeNumber {
+		return 0, fmt.Errorf("p must be a number")
+	}
+	p := args[i].Int()
+	if p < 0 || p > 32 {
+		return 0, fmt.Errorf("p of %d is out of range", p)
+	}
+	return uint8(p), nil
+}
+
+// filterArg returns the filter in the ith argument, which must be a hex
+// serialized filter with its element count, built with the passed P.
+func filterArg(args []js.Value, i int, p uint8) (*gcs.Filter, error) {
+	data, err := hexArg(args, i, "filter")
+	if err != nil {
+		return nil, err
+	}
+	return gcs.FromNBytes(p, data)
+}
+
+// buildFilter implements buildFilter(policy, blockHex, p).
+func buildFilter(args []js.Value) (interface{}, error) {
+	name, err := stringArg(args, 0, "policy")
+	if err != nil {
+		return nil, err
+	}
+	policy, err := builder.LookupPolicy(name)
+	if err != nil {
+		return nil, err
+	}
+	blockBytes, err := hexArg(args, 1, "block")
+	if err != nil {
+		return nil, err
+	}
+	p, err := pArg(args, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	var block wire.MsgBlock
+	if err := block.Deserialize(bytes.NewReader(blockBytes)); err != nil {
+		return nil, fmt.Errorf("block isn't a valid block: %v", err)
+	}
+	filter, err := builder.BuildFilter(policy, &block, p)
+	if err != nil {
+		return nil, err
+	}
+	if filter == nil {
+		filter = &gcs.Filter{}
+	}
+	nBytes, err := filter.NBytes()
+	if err != nil {
+		return nil, err
+	}
+	return hex.EncodeToString(nBytes), nil
+}
+
+// filterHeader implements filterHeader(filterHex, prevHeader).
+func filterHeader(args []js.Value) (interface{}, error) {
+	// The header commits to the serialized filter, whatever its P.
+	filter, err := filterArg(args, 0, builder.DefaultP)
+	if err != nil {
+		return nil, err
+	}
+	prevHeader, err := hashArg(args, 1, "prevHeader")
+	if err != nil {
+		return nil, err
+	}
+
+	header, err := builder.MakeHeaderForFilter(filter, *prevHeader)
+	if err != nil {
+		return nil, err
+	}
+	return header.String(), nil
+}
+
+// matchArgs parses the filter, block hash and P arguments shared by match and
+// matchAny, returning the filter and the key to match with.
+func matchArgs(args []js.Value) (*gcs.Filter, [gcs.KeySize]byte, error) {
+	var key [gcs.KeySize]byte
+	p, err := pArg(args, 2)
+	if err != nil {
+		return nil, key, err
+	}
+	filter, err := filterArg(args, 0, p)
+	if err != nil {
+		return nil, key, err
+	}
+	blockHash, err := hashArg(args, 1, "blockHash")
+	if err != nil {
+		return nil, key, err
+	}
+	return filter, builder.DeriveKey(blockHash), nil
+}
+
+// match implements match(filterHex, blockHash, p, elementHex).
+func match(args []js.Value) (interface{}, error) {
+	filter, key, err := matchArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	element, err := hexArg(args, 3, "element")
+	if err != nil {
+		return nil, err
+	}
+	return filter.Match(key, element)
+}
+
+// matchAny implements matchAny(filterHex, blockHash, p, elementHexes).
+func matchAny(args []js.Value) (interface{}, error) {
+	filter, key, err := matchArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) < 4 || args[3].Type() != js.TypeObject {
+		return nil, fmt.Errorf("elements must be an array")
+	}
+	elements := make([][]byte, args[3].Length())
+	for i := range elements {
+		elements[i], err = hexArg([]js.Value{args[3].Index(i)}, 0,
+			fmt.Sprintf("element %d", i))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return filter.MatchAny(key, elements)
+}
+
+// addressToScript implements addressToScript(address, network).
+func addressToScript(args []js.Value) (interface{}, error) {
+	addr, err := stringArg(args, 0, "address")
+	if err != nil {
+		return nil, err
+	}
+	netName, err := stringArg(args, 1, "network")
+	if err != nil {
+		return nil, err
+	}
+	params, ok := networks[netName]
+	if !ok {
+		return nil, fmt.Errorf("unknown network %q", netName)
+	}
+
+	script, err := builder.AddressToScript(addr, params)
+	if err != nil {
+		return nil, err
+	}
+	return hex.EncodeToString(script), nil
+}
+
+func main() {
+	js.Global().Set("bip158Go", js.ValueOf(map[string]interface{}{
+		"buildFilter":     export(buildFilter),
+		"filterHeader":    export(filterHeader),
+		"match":           export(match),
+		"matchAny":        export(matchAny),
+		"addressToScript": export(addressToScript),
+	}))
+
+	// The functions are only callable while the program runs.
+	select {}
+}
@@ -0,0 +1,398 @@
+// Package generator runs the main loop of the test vector generator: it walks
+// the chain from the genesis block, builds the filters of each block for
+// every selected policy and value of P, and extends a filter header chain for
+// each. It doesn't write anything itself. Instead it reports its progress
+// through the hooks of its Config, which the gentestvectors program uses to
+// write the vector files, and which applications embedding the generator can
+// use to index, publish or check the intermediate results:
+//
+//	gen := generator.New(generator.Config{
+//		Source:     client,
+//		Policies:   []builder.FilterPolicy{builder.BasicPolicy{}},
+//		TestBlocks: []generator.TestBlock{{Height: 1000}},
+//		Hooks: generator.Hooks{
+//			OnHeaderComputed: func(e *generator.HeaderEvent) error {
+//				fmt.Println(e.Height, e.P, e.Header)
+//				return nil
+//			},
+//		},
+//	})
+//	err := gen.Run()
+//
+// The blocks the source provides are checked before their filters are built:
+// each must have the hash it was fetched by, transactions matching its merkle
+// root, and build on the block before it. With Config.Checkpoints, the walk
+// must also pass through the known-good blocks of the checkpoints package,
+// and once the last test block is processed, the generator fetches headers on
+// to the next checkpoint, so that a node serving other blocks than the real
+// chain's can't slip them into the vectors. Hooks see blocks as they are
+// processed, before the checkpoints after them are reached, so the results
+// they receive are only pinned once Run returns nil.
+package generator
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/christsim/bips/bip-0158/backend/chainhash"
+	"github.com/christsim/bips/bip-0158/backend/wire"
+	"github.com/christsim/bips/bip-0158/checkpoints"
+	"github.com/christsim/bips/bip-0158/gcs"
+	"github.com/christsim/bips/bip-0158/gcs/builder"
+	"github.com/christsim/bips/bip-0158/headers"
+)
+
+var (
+	// ErrNoPolicies is returned by Run when no filter policies are
+	// configured.
+	ErrNoPolicies = errors.New("generator: no filter policies")
+
+	// ErrNoTestBlocks is returned by Run when no test blocks are
+	// configured, so there's no height to stop at.
+	ErrNoTestBlocks = errors.New("generator: no test blocks")
+
+	// ErrUnsortedTestBlocks is returned by Run when the test blocks aren't
+	// in increasing order of height.
+	ErrUnsortedTestBlocks = errors.New("generator: test blocks aren't " +
+		"sorted by height")
+
+	// ErrUnpinned is returned by Run when test blocks lie past the last
+	// checkpoint and Config.AllowUnpinned isn't set.
+	ErrUnpinned = errors.New("generator: test blocks past the last " +
+		"checkpoint")
+
+	// ErrBlockMismatch is returned when the source provides a block or
+	// header other than the one requested.
+	ErrBlockMismatch = errors.New("generator: source returned the wrong " +
+		"block")
+)
+
+// BlockSource provides the blocks the generator walks. backend.ChainClient
+// satisfies it.
+type BlockSource interface {
+	// GetBlockHash returns the hash of the block at the passed height.
+	GetBlockHash(height int64) (*chainhash.Hash, error)
+
+	// GetBlock returns the block with the passed hash.
+	GetBlock(blockHash *chainhash.Hash) (*wire.MsgBlock, error)
+}
+
+// HeaderSource is a BlockSource that can fetch headers alone, which the
+// generator uses to reach the checkpoint after the last test block without
+// downloading every block on the way. backend.ChainClient satisfies it.
+type HeaderSource interface {
+	BlockSource
+
+	// GetBlockHeader returns the header of the block with the passed
+	// hash.
+	GetBlockHeader(blockHash *chainhash.Hash) (*wire.BlockHeader, error)
+}
+
+// TestBlock is a block to include in the test vectors.
+type TestBlock struct {
+	Height uint32
+
+	// Comment is written to the notes column of the block's vectors.
+	Comment string
+}
+
+// FilterEvent reports a filter built for a block.
+type FilterEvent struct {
+	Height    uint32
+	BlockHash chainhash.Hash
+
+	// Policy is the policy the filter was built with, and P the
+	// Golomb-Rice parameter.
+	Policy builder.FilterPolicy
+	P      uint8
+
+	// Filter is the filter the policy built for the block.
+	Filter *gcs.Filter
+}
+
+// HeaderEvent reports a filter header computed for a block.
+type HeaderEvent struct {
+	FilterEvent
+
+	// PrevHeader is the header of the previous block's filter, or all
+	// zeros for the genesis block, and Header is the header of Filter.
+	PrevHeader chainhash.Hash
+	Header     chainhash.Hash
+}
+
+// BlockEvent reports a block whose filters and filter headers have all been
+// computed.
+type BlockEvent struct {
+	Height    uint32
+	BlockHash chainhash.Hash
+	Block     *wire.MsgBlock
+
+	// TestBlock is the block's entry in Config.TestBlocks, or nil if the
+	// block isn't part of the vectors and was only processed to extend
+	// the filter header chains.
+	TestBlock *TestBlock
+
+	// Headers[i][j] is the header computed for the jth policy at the ith
+	// value of Config.P, along with its filter.
+	Headers [][]*HeaderEvent
+}
+
+// Hooks are called as the generator makes progress. Any of them may be nil.
+// An error returned from a hook stops Run, which returns it. Events, and the
+// filters and blocks they point to, must not be modified, but may be kept.
+type Hooks struct {
+	// OnFilterBuilt is called for each filter as it is built.
+	OnFilterBuilt func(e *FilterEvent) error
+
+	// OnHeaderComputed is called for each filter header as it is
+	// computed, after OnFilterBuilt is called for its filter.
+	OnHeaderComputed func(e *HeaderEvent) error
+
+	// OnBlockProcessed is called for each block once every filter and
+	// header for it has been computed.
+	OnBlockProcessed func(e *BlockEvent) error
+}
+
+// Config configures a Generator.
+type Config struct {
+	// Source provides the blocks.
+	Source BlockSource
+
+	// Policies are the filter policies to build filters with.
+	Policies []builder.FilterPolicy
+
+	// P are the values of the Golomb-Rice parameter to build filters
+	// for. If empty, every value from 1 to 32 is used.
+	P []uint8
+
+	// TestBlocks are the blocks to include in the vectors, sorted by
+	// height. The generator processes every block from the genesis block
+	// up to the last of them, since each filter header depends on all
+	// the filters before it.
+	TestBlocks []TestBlock
+
+	// Checkpoints, if set, are known-good blocks sorted by height, such
+	// as checkpoints.ForNet returns, that the walk must pass through.
+	Checkpoints []checkpoints.Checkpoint
+
+	// AllowUnpinned lets test blocks lie past the last checkpoint, in
+	// which case the blocks after it are only checked to build on each
+	// other.
+	AllowUnpinned bool
+
+	Hooks Hooks
+}
+
+// Generator runs the main loop of the test vector generator.
+type Generator struct {
+	cfg Config
+
+	// chains[i][j] is the filter header chain of the jth policy at the
+	// ith value of P. Only the previous header is needed to extend each
+	// chain, so each retains just its tip to keep memory use constant.
+	chains [][]*builder.FilterHeaderChain
+
+	// verifier checks that each block builds on the one before it and
+	// matches the checkpoints.
+	verifier *checkpoints.Verifier
+}
+
+// New returns a generator with the passed configuration.
+func New(cfg Config) *Generator {
+	if len(cfg.P) == 0 {
+		cfg.P = make([]uint8, 32)
+		for i := range cfg.P {
+			cfg.P[i] = uint8(i + 1)
+		}
+	}
+
+	chains := make([][]*builder.FilterHeaderChain, len(cfg.P))
+	for i := range chains {
+		chains[i] = make([]*builder.FilterHeaderChain,
+			len(cfg.Policies))
+		for j := range chains[i] {
+			chains[i][j] = builder.NewFilterHeaderChain(1)
+		}
+	}
+
+	return &Generator{
+		cfg:      cfg,
+		chains:   chains,
+		verifier: checkpoints.NewVerifier(cfg.Checkpoints),
+	}
+}
+
+// Run processes every block from the genesis block up to the last test block.
+// It can only be called once.
+func (g *Generator) Run() error {
+	if len(g.cfg.Policies) == 0 {
+		return ErrNoPolicies
+	}
+	if len(g.cfg.TestBlocks) == 0 {
+		return ErrNoTestBlocks
+	}
+	for i := 1; i < len(g.cfg.TestBlocks); i++ {
+		if g.cfg.TestBlocks[i].Height <= g.cfg.TestBlocks[i-1].Height {
+			return ErrUnsortedTestBlocks
+		}
+	}
+	last := g.cfg.TestBlocks[len(g.cfg.TestBlocks)-1].Height
+	if n := len(g.cfg.Checkpoints); n > 0 && !g.cfg.AllowUnpinned &&
+		last > g.cfg.Checkpoints[n-1].Height {
+
+		return fmt.Errorf("%w: block %d, last checkpoint %d",
+			ErrUnpinned, last, g.cfg.Checkpoints[n-1].Height)
+	}
+
+	testBlockIndex := 0
+	for height := uint32(0); testBlockIndex < len(g.cfg.TestBlocks); height++ {
+		var testBlock *TestBlock
+		if height == g.cfg.TestBlocks[testBlockIndex].Height {
+			testBlock = &g.cfg.TestBlocks[testBlockIndex]
+			testBlockIndex++
+		}
+
+		if err := g.processBlock(height, testBlock); err != nil {
+			return err
+		}
+	}
+
+	return g.pin(last)
+}
+
+// pin checks the headers of the blocks after the last test block, at the
+// passed height, up to the next checkpoint, which then pins the blocks of
+// the vectors.
+func (g *Generator) pin(height uint32) error {
+	next, ok := g.verifier.Next()
+	if !ok {
+		return nil
+	}
+
+	headerSource, _ := g.cfg.Source.(HeaderSource)
+	for height++; height <= next.Height; height++ {
+		blockHash, err := g.cfg.Source.GetBlockHash(int64(height))
+		if err != nil {
+			return fmt.Errorf("couldn't get hash of block %d: %v",
+				height, err)
+		}
+
+		var header *wire.BlockHeader
+		if headerSource != nil {
+			header, err = headerSource.GetBlockHeader(blockHash)
+		} else {
+			var block *wire.MsgBlock
+			block, err = g.cfg.Source.GetBlock(blockHash)
+			if block != nil {
+				header = &block.Header
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("couldn't get header %v: %v",
+				blockHash, err)
+		}
+		if header.BlockHash() != *blockHash {
+			return fmt.Errorf("%w: header %v for block %v",
+				ErrBlockMismatch, header.BlockHash(), blockHash)
+		}
+		if err := g.verifier.Check(height, header); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkBlock checks that the block fetched by the passed hash has that hash,
+// that its transactions match its header, and that it builds on the block
+// before it and matches the checkpoints.
+func (g *Generator) checkBlock(height uint32, blockHash *chainhash.Hash,
+	block *wire.MsgBlock) error {
+
+	if block.BlockHash() != *blockHash {
+		return fmt.Errorf("%w: block %v for block %v", ErrBlockMismatch,
+			block.BlockHash(), blockHash)
+	}
+	if err := headers.CheckMerkleRoot(block); err != nil {
+		return err
+	}
+	return g.verifier.Check(height, &block.Header)
+}
+
+// processBlock builds the filters and headers of the block at the passed
+// height and calls the hooks.
+func (g *Generator) processBlock(height uint32, testBlock *TestBlock) error {
+	blockHash, err := g.cfg.Source.GetBlockHash(int64(height))
+	if err != nil {
+		return fmt.Errorf("couldn't get hash of block %d: %v", height,
+			err)
+	}
+	block, err := g.cfg.Source.GetBlock(blockHash)
+	if err != nil {
+		return fmt.Errorf("couldn't get block %v: %v", blockHash, err)
+	}
+	if err := g.checkBlock(height, blockHash, block); err != nil {
+		return err
+	}
+
+	// Build the filters for every value of P at once, from the elements
+	// of the block extracted just once for all policies. filters[j][i] is
+	// the jth policy's filter at the ith value of P.
+	elements := builder.ExtractElements(block)
+	filters := make([][]*gcs.Filter, len(g.cfg.Policies))
+	for j, policy := range g.cfg.Policies {
+		filters[j], err = builder.BuildElementFilters(policy, elements,
+			g.cfg.P)
+		if err != nil {
+			return fmt.Errorf("error generating %v filter: %v",
+				policy.Name(), err)
+		}
+	}
+
+	hooks := &g.cfg.Hooks
+	headers := make([][]*HeaderEvent, len(g.cfg.P))
+	for i, p := range g.cfg.P {
+		headers[i] = make([]*HeaderEvent, len(g.cfg.Policies))
+		for j, policy := range g.cfg.Policies {
+			e := &HeaderEvent{
+				FilterEvent: FilterEvent{
+					Height:    height,
+					BlockHash: *blockHash,
+					Policy:    policy,
+					P:         p,
+					Filter:    filters[j][i],
+				},
+				PrevHeader: g.chains[i][j].TipHeader(),
+			}
+			if hooks.OnFilterBuilt != nil {
+				err := hooks.OnFilterBuilt(&e.FilterEvent)
+				if err != nil {
+					return err
+				}
+			}
+
+			e.Header, err = g.chains[i][j].Append(e.Filter)
+			if err != nil {
+				return fmt.Errorf("error generating header for "+
+					"%v filter: %v", policy.Name(), err)
+			}
+			if hooks.OnHeaderComputed != nil {
+				if err := hooks.OnHeaderComputed(e); err != nil {
+					return err
+				}
+			}
+			headers[i][j] = e
+		}
+	}
+
+	if hooks.OnBlockProcessed != nil {
+		return hooks.OnBlockProcessed(&BlockEvent{
+			Height:    height,
+			BlockHash: *blockHash,
+			Block:     block,
+			TestBlock: testBlock,
+			Headers:   headers,
+		})
+	}
+	return nil
+}
@@ -1,9 +1,12 @@
 // This program connects to your local btcd and generates test vectors for
 // 5 blocks and collision space sizes of 1-32 bits. Change the RPC cert path
 // and credentials to run on your system. The program assumes you're running
-// a btcd with cfilter support, which mainline btcd doesn't have; in order to
-// circumvent this assumption, comment out the if block that checks for
-// filter size of DefaultP.
+// a btcd serving both the basic and extended filters, which only the roasbeef
+// fork does, since mainline btcd only serves basic filters. Build with
+// -tags roasbeef to use the fork, as described in the backend package.
+//
+// Its flags and subcommands are described in README.md, and each
+// subcommand lists its own flags with -h.
 
 package main
 
@@ -11,36 +14,36 @@ import (
 	"bytes"
 	"encoding/hex"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"path"
+	"path/filepath"
+	"strings"
 
-	"github.com/roasbeef/btcd/chaincfg/chainhash"
-	"github.com/roasbeef/btcd/rpcclient"
-	"github.com/roasbeef/btcd/wire"
-	"github.com/roasbeef/btcutil/gcs"
-	"github.com/roasbeef/btcutil/gcs/builder"
+	"github.com/christsim/bips/bip-0158/backend"
+	"github.com/christsim/bips/bip-0158/backend/chaincfg"
+	"github.com/christsim/bips/bip-0158/backend/chainhash"
+	"github.com/christsim/bips/bip-0158/backend/wire"
+	"github.com/christsim/bips/bip-0158/checkpoints"
+	"github.com/christsim/bips/bip-0158/gcs"
+	"github.com/christsim/bips/bip-0158/gcs/builder"
+	"github.com/christsim/bips/bip-0158/generator"
+	"github.com/christsim/bips/bip-0158/prevout"
 )
 
-var (
-	// testBlockHeights are the heights of the blocks to include in the test
-	// vectors. Any new entries must be added in sorted order.
-	testBlockHeights = []testBlockCase{
-		{0, "Genesis block"},
-		{1, "Extended filter is empty"},
-		{2, ""},
-		{3, ""},
-		{926485, "Duplicate pushdata 913bcc2be49cb534c20474c4dee1e9c4c317e7eb"},
-		{987876, "Coinbase tx has unparseable output script"},
-		{1263442, "Includes witness data"},
-	}
-)
-
-type testBlockCase struct {
-	height  uint32
-	comment string
+// testBlocks are the blocks to include in the test vectors. Any new entries
+// must be added in sorted order.
+var testBlocks = []generator.TestBlock{
+	{Height: 0, Comment: "Genesis block"},
+	{Height: 1, Comment: "Extended filter is empty"},
+	{Height: 2},
+	{Height: 3},
+	{Height: 926485, Comment: "Duplicate pushdata 913bcc2be49cb534c20474c4dee1e9c4c317e7eb"},
+	{Height: 987876, Comment: "Coinbase tx has unparseable output script"},
+	{Height: 1263442, Comment: "Includes witness data"},
 }
 
 type JSONTestWriter struct {
@@ -86,276 +89,506 @@ func (w *JSONTestWriter) Close() error {
 	return err
 }
 
+// subcommands maps the name of each auxiliary mode of the program to the
+// function implementing it. Each is passed the remaining command line
+// arguments. Running the program without a subcommand generates the test
+// vectors.
+var subcommands = map[string]func(args []string) error{
+	"stats":             runStats,
+	"importutxo":        runImportUTXO,
+	"index":             runIndex,
+	"snapshot":          runSnapshot,
+	"conformance":       runConformance,
+	"corpus":            runCorpus,
+	"proptest":          runPropTest,
+	"regtest":           runRegtest,
+	"bench":             runBench,
+	"commitments":       runCommitments,
+	"paramsearch":       runParamSearch,
+	"golomb":            runGolomb,
+	"messages":          runMessages,
+	"serve":             runServe,
+	"lightclient":       runLightClient,
+	"export":            runExport,
+	"import":            runImport,
+	"keygen":            runKeygen,
+	"sign":              runSign,
+	"validate":          runValidate,
+	"verify-signatures": runVerifySignatures,
+	"compare":           runCompare,
+	"analyze":           runAnalyze,
+	"mempool":           runMempool,
+	"multisig":          runMultisig,
+}
+
 func main() {
-	err := os.Mkdir("gcstestvectors", os.ModeDir|0755)
-	if err != nil { // Don't overwrite existing output if any
-		fmt.Println("Couldn't create directory: ", err)
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		run, ok := subcommands[os.Args[1]]
+		if !ok {
+			fmt.Println("Unknown subcommand: ", os.Args[1])
+			os.Exit(1)
+		}
+		if err := run(os.Args[2:]); err != nil {
+			fmt.Println("Error: ", err.Error())
+			os.Exit(1)
+		}
 		return
 	}
-	files := make([]*JSONTestWriter, 33)
-	prevBasicHeaders := make([]chainhash.Hash, 33)
-	prevExtHeaders := make([]chainhash.Hash, 33)
-	for i := 1; i <= 32; i++ { // Min 1 bit of collision space, max 32
-		fName := fmt.Sprintf("gcstestvectors/testnet-%02d.json", i)
-		file, err := os.Create(fName)
-		if err != nil {
-			fmt.Println("Error creating output file: ", err.Error())
-			return
-		}
-		defer file.Close()
-
-		writer := &JSONTestWriter{writer: file}
-		defer writer.Close()
 
-		err = writer.WriteComment("Block Height,Block Hash,Block,Previous Basic Header,Previous Ext Header,Basic Filter,Ext Filter,Basic Header,Ext Header,Notes")
-		if err != nil {
-			fmt.Println("Error writing to output file: ", err.Error())
-			return
-		}
+	genTestVectors(os.Args[1:])
+}
 
-		files[i] = writer
+// newRPCClient connects to the local btcd whose RPC certificate and
+// credentials are hardcoded below. Change them to run on your system.
+func newRPCClient() (backend.ChainClient, error) {
+	cfg, err := rpcConfig()
+	if err != nil {
+		return nil, err
 	}
+	return dialRPC(cfg)
+}
+
+// rpcConfig returns the configuration of the connection to the local btcd,
+// for callers that need to set more than newRPCClient does.
+func rpcConfig() (*backend.RPCConfig, error) {
 	cert, err := ioutil.ReadFile(
 		path.Join(os.Getenv("HOME"), "/.btcd/rpc.cert"))
 	if err != nil {
-		fmt.Println("Couldn't read RPC cert: ", err.Error())
-		return
+		return nil, fmt.Errorf("couldn't read RPC cert: %v", err)
 	}
-	conf := rpcclient.ConnConfig{
+	return &backend.RPCConfig{
 		Host:         "127.0.0.1:18334",
-		Endpoint:     "ws",
 		User:         "kek",
 		Pass:         "kek",
 		Certificates: cert,
+	}, nil
+}
+
+// dialRPC connects to the node with the passed configuration.
+func dialRPC(cfg *backend.RPCConfig) (backend.ChainClient, error) {
+	client, err := backend.DialRPC(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't create a new client: %v", err)
+	}
+
+	return client, nil
+}
+
+// defaultPolicies is the list of filter policies the test vectors are
+// generated for unless the -policies flag says otherwise.
+const defaultPolicies = "basic,extended"
+
+// policyColumns maps the names of the policies whose vectors predate the
+// -policies flag to the names used for them in the column headers, so that
+// the default output is unchanged.
+var policyColumns = map[string]string{
+	"basic":    "Basic",
+	"extended": "Ext",
+}
+
+// columnName returns the name used for the policy in the column headers.
+func columnName(policy builder.FilterPolicy) string {
+	if name, ok := policyColumns[policy.Name()]; ok {
+		return name
 	}
-	client, err := rpcclient.New(&conf, nil)
+	return policy.Name()
+}
+
+// lastBlockResolver remembers the previous output scripts of the last block it
+// resolved. Filters are built many times per block, once for each value of P,
+// while resolvers such as the UTXO index can only resolve each block once.
+type lastBlockResolver struct {
+	resolver    builder.PrevScriptResolver
+	blockHash   chainhash.Hash
+	prevScripts [][]byte
+}
+
+// PrevScripts returns the previous output scripts of the block, only asking
+// the underlying resolver if the block isn't the last one resolved.
+func (r *lastBlockResolver) PrevScripts(block *wire.MsgBlock) ([][]byte,
+	error) {
+
+	blockHash := block.BlockHash()
+	if r.prevScripts != nil && blockHash == r.blockHash {
+		return r.prevScripts, nil
+	}
+
+	prevScripts, err := r.resolver.PrevScripts(block)
 	if err != nil {
-		fmt.Println("Couldn't create a new client: ", err.Error())
-		return
+		return nil, err
+	}
+	if prevScripts == nil {
+		prevScripts = [][]byte{}
+	}
+	r.blockHash = blockHash
+	r.prevScripts = prevScripts
+
+	return prevScripts, nil
+}
+
+// parsePolicies looks up each of the comma separated policy names. The basic
+// policy is restricted to the passed script types, and the spec basic policy
+// resolves previous output scripts with the passed resolver.
+func parsePolicies(list string, scriptTypes builder.ScriptTypeSet,
+	resolver builder.PrevScriptResolver) ([]builder.FilterPolicy, error) {
+
+	var policies []builder.FilterPolicy
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		policy, err := builder.LookupPolicy(name)
+		if err != nil {
+			return nil, err
+		}
+		switch policy.(type) {
+		case builder.BasicPolicy:
+			policy = builder.BasicPolicy{ScriptTypes: scriptTypes}
+		case builder.SpecBasicPolicy:
+			policy = builder.SpecBasicPolicy{Resolver: resolver}
+		}
+		policies = append(policies, policy)
+	}
+	if len(policies) == 0 {
+		return nil, fmt.Errorf("no filter policies selected")
+	}
+
+	return policies, nil
+}
+
+// vectorColumns returns the header row of the vector files for the passed
+// policies. The columns are grouped by field, with one column per policy
+// within each group.
+func vectorColumns(policies []builder.FilterPolicy) []string {
+	var prevCols, filterCols, headerCols []string
+	for _, policy := range policies {
+		name := columnName(policy)
+		prevCols = append(prevCols, "Previous "+name+" Header")
+		filterCols = append(filterCols, name+" Filter")
+		headerCols = append(headerCols, name+" Header")
+	}
+	columns := append([]string{"Block Height", "Block Hash", "Block"},
+		prevCols...)
+	columns = append(columns, filterCols...)
+	columns = append(columns, headerCols...)
+	return append(columns, "Notes")
+}
+
+// vectorFiles holds the writers of the vector, invalid vector and match vector
+// files for each value of P, indexed by P.
+type vectorFiles struct {
+	files   []*JSONTestWriter
+	invalid []*JSONTestWriter
+	match   []*JSONTestWriter
+
+	osFiles []*os.File
+}
+
+// createVectorFiles creates the files for every value of P in outDir, named
+// after prefix as in testnet-20.json, and writes their header rows, which for
+// the vector files are the passed columns.
+func createVectorFiles(outDir, prefix string,
+	columns []string) (*vectorFiles, error) {
+
+	vf := &vectorFiles{
+		files:   make([]*JSONTestWriter, 33),
+		invalid: make([]*JSONTestWriter, 33),
+		match:   make([]*JSONTestWriter, 33),
+	}
+	create := func(name, header string) (*JSONTestWriter, error) {
+		file, err := os.Create(filepath.Join(outDir, name))
+		if err != nil {
+			return nil, fmt.Errorf("error creating output file: %v",
+				err)
+		}
+		vf.osFiles = append(vf.osFiles, file)
+
+		writer := &JSONTestWriter{writer: file}
+		if err := writer.WriteComment(header); err != nil {
+			return nil, fmt.Errorf("error writing to output file: %v",
+				err)
+		}
+		return writer, nil
+	}
+
+	var err error
+	for i := 1; i <= 32; i++ { // Min 1 bit of collision space, max 32
+		name := fmt.Sprintf("%s-%02d", prefix, i)
+		vf.files[i], err = create(name+".json",
+			strings.Join(columns, ","))
+		if err == nil {
+			vf.invalid[i], err = create(name+"-invalid.json",
+				invalidColumns)
+		}
+		if err == nil {
+			vf.match[i], err = create(name+"-match.json",
+				matchColumns)
+		}
+		if err != nil {
+			vf.Close()
+			return nil, err
+		}
 	}
 
-	var testBlockIndex int = 0
-	for height := 0; testBlockIndex < len(testBlockHeights); height++ {
-		fmt.Printf("Height: %d\n", height)
-		blockHash, err := client.GetBlockHash(int64(height))
+	return vf, nil
+}
+
+// Close terminates the JSON of every file and closes them.
+func (vf *vectorFiles) Close() {
+	for _, writers := range [][]*JSONTestWriter{vf.files, vf.invalid,
+		vf.match} {
+
+		for _, writer := range writers {
+			if writer != nil {
+				writer.Close()
+			}
+		}
+	}
+	for _, file := range vf.osFiles {
+		file.Close()
+	}
+}
+
+// genTestVectors writes the test vector files for every value of P to the
+// gcstestvectors directory. If other filter policies are selected with the
+// -policies flag, or the basic filter is restricted to a subset of output
+// script types with the -include-types flag, the vectors are instead written
+// to a directory named after them, and aren't checked against the server
+// since it only knows about the standard filters.
+func genTestVectors(args []string) {
+	fs := flag.NewFlagSet("gentestvectors", flag.ExitOnError)
+	policyList := fs.String("policies", defaultPolicies, "comma separated "+
+		"list of filter policies to generate vectors for, out of "+
+		strings.Join(builder.PolicyNames(), ", "))
+	includeTypes := fs.String("include-types", "", "comma separated list "+
+		"of output script types to include in the basic filter, e.g. "+
+		"p2pkh,p2wpkh,p2tr (default all)")
+	blocksDir := fs.String("blocksdir", "", "Bitcoin Core blocks directory "+
+		"to read previous output scripts from for the spec-basic policy")
+	utxoDB := fs.String("utxodb", "", "UTXO index to resolve previous "+
+		"output scripts from for the spec-basic policy, instead of "+
+		"-blocksdir (see the importutxo subcommand)")
+	unpinned := fs.Bool("unpinned", false, "allow test blocks past the "+
+		"last built-in checkpoint")
+	fs.Parse(args)
+
+	scriptTypes := builder.AllScriptTypes
+	outDir := "gcstestvectors"
+	if *policyList != defaultPolicies {
+		outDir += "-" + strings.Replace(*policyList, ",", "-", -1)
+	}
+	if *includeTypes != "" {
+		var err error
+		scriptTypes, err = builder.ParseScriptTypeSet(*includeTypes)
 		if err != nil {
-			fmt.Println("Couldn't get block hash: ", err.Error())
+			fmt.Println("Invalid script types: ", err)
 			return
 		}
-		block, err := client.GetBlock(blockHash)
+		outDir += "-" + strings.Replace(scriptTypes.String(), ",", "-", -1)
+	}
+	var resolver builder.PrevScriptResolver
+	if *blocksDir != "" {
+		undo, err := prevout.NewUndoResolver(*blocksDir,
+			chaincfg.TestNet3Params.Net)
 		if err != nil {
-			fmt.Println("Couldn't get block hash: ", err.Error())
+			fmt.Println("Couldn't open undo files: ", err)
+			return
+		}
+		defer undo.Close()
+		resolver = undo
+	}
+	if *utxoDB != "" {
+		if resolver != nil {
+			fmt.Println("Only one of -blocksdir and -utxodb may be set")
 			return
 		}
-		var blockBuf bytes.Buffer
-		err = block.Serialize(&blockBuf)
+		index, err := prevout.OpenUTXOIndex(*utxoDB)
 		if err != nil {
-			fmt.Println("Error serializing block to buffer: ", err.Error())
+			fmt.Println("Couldn't open UTXO index: ", err)
 			return
 		}
-		blockBytes := blockBuf.Bytes()
-		for i := 1; i <= 32; i++ {
-			basicFilter, err := buildBasicFilter(block, uint8(i))
-			if err != nil {
-				fmt.Println("Error generating basic filter: ", err.Error())
-				return
-			}
-			basicHeader, err := builder.MakeHeaderForFilter(basicFilter,
-				prevBasicHeaders[i])
-			if err != nil {
-				fmt.Println("Error generating header for filter: ", err.Error())
-				return
-			}
-			if basicFilter == nil {
-				basicFilter = &gcs.Filter{}
-			}
-			extFilter, err := buildExtFilter(block, uint8(i))
-			if err != nil {
-				fmt.Println("Error generating ext filter: ", err.Error())
-				return
-			}
-			extHeader, err := builder.MakeHeaderForFilter(extFilter,
-				prevExtHeaders[i])
-			if err != nil {
-				fmt.Println("Error generating header for filter: ", err.Error())
-				return
-			}
-			if extFilter == nil {
-				extFilter = &gcs.Filter{}
-			}
-			if i == builder.DefaultP { // This is the default filter size so we can check against the server's info
-				filter, err := client.GetCFilter(blockHash, wire.GCSFilterRegular)
-				if err != nil {
-					fmt.Println("Error getting basic filter: ", err.Error())
-					return
-				}
-				nBytes, err := basicFilter.NBytes()
-				if err != nil {
-					fmt.Println("Couldn't get NBytes(): ", err)
-					return
-				}
-				if !bytes.Equal(filter.Data, nBytes) {
-					// Don't error on empty filters
-					fmt.Println("Basic filter doesn't match!\n", filter.Data, "\n", nBytes)
-					return
-				}
-				filter, err = client.GetCFilter(blockHash, wire.GCSFilterExtended)
-				if err != nil {
-					fmt.Println("Error getting extended filter: ", err.Error())
-					return
-				}
-				nBytes, err = extFilter.NBytes()
-				if err != nil {
-					fmt.Println("Couldn't get NBytes(): ", err)
-					return
-				}
-				if !bytes.Equal(filter.Data, nBytes) {
-					fmt.Println("Extended filter doesn't match!")
-					return
-				}
-				header, err := client.GetCFilterHeader(blockHash, wire.GCSFilterRegular)
-				if err != nil {
-					fmt.Println("Error getting basic header: ", err.Error())
-					return
-				}
-				if !bytes.Equal(header.PrevFilterHeader[:], basicHeader[:]) {
-					fmt.Println("Basic header doesn't match!")
-					return
-				}
-				header, err = client.GetCFilterHeader(blockHash, wire.GCSFilterExtended)
-				if err != nil {
-					fmt.Println("Error getting extended header: ", err.Error())
-					return
-				}
-				if !bytes.Equal(header.PrevFilterHeader[:], extHeader[:]) {
-					fmt.Println("Extended header doesn't match!")
-					return
-				}
-				fmt.Println("Verified against server")
-			}
+		defer index.Close()
+		resolver = index
+	}
+	if resolver != nil {
+		resolver = &lastBlockResolver{resolver: resolver}
+	}
+	policies, err := parsePolicies(*policyList, scriptTypes, resolver)
+	if err != nil {
+		fmt.Println("Invalid filter policies: ", err)
+		return
+	}
+	verifyServer := *policyList == defaultPolicies &&
+		scriptTypes == builder.AllScriptTypes
 
-			if uint32(height) == testBlockHeights[testBlockIndex].height {
-				var bfBytes []byte
-				var efBytes []byte
-				bfBytes, err = basicFilter.NBytes()
-				if err != nil {
-					fmt.Println("Couldn't get NBytes(): ", err)
-					return
-				}
-				efBytes, err = extFilter.NBytes()
-				if err != nil {
-					fmt.Println("Couldn't get NBytes(): ", err)
-					return
-				}
-				row := []interface{}{
-					height,
-					blockHash.String(),
-					hex.EncodeToString(blockBytes),
-					prevBasicHeaders[i].String(),
-					prevExtHeaders[i].String(),
-					hex.EncodeToString(bfBytes),
-					hex.EncodeToString(efBytes),
-					basicHeader.String(),
-					extHeader.String(),
-					testBlockHeights[testBlockIndex].comment,
+	err = os.Mkdir(outDir, os.ModeDir|0755)
+	if err != nil { // Don't overwrite existing output if any
+		fmt.Println("Couldn't create directory: ", err)
+		return
+	}
+	vf, err := createVectorFiles(outDir, "testnet", vectorColumns(policies))
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	defer vf.Close()
+
+	client, err := newRPCClient()
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+
+	gen := generator.New(generator.Config{
+		Source:        client,
+		Policies:      policies,
+		TestBlocks:    testBlocks,
+		Checkpoints:   checkpoints.ForNet(chaincfg.TestNet3Params.Net),
+		AllowUnpinned: *unpinned,
+		Hooks: generator.Hooks{
+			OnBlockProcessed: func(e *generator.BlockEvent) error {
+				fmt.Printf("Height: %d\n", e.Height)
+
+				// The default filter size is the one we can check
+				// against the server's info.
+				if verifyServer {
+					err := verifyAgainstServer(client,
+						&e.BlockHash,
+						e.Headers[builder.DefaultP-1])
+					if err != nil {
+						return err
+					}
+					fmt.Println("Verified against server")
 				}
-				err = files[i].WriteTestCase(row)
-				if err != nil {
-					fmt.Println("Error writing test case to output: ", err.Error())
-					return
+
+				if e.TestBlock == nil {
+					return nil
 				}
-			}
-			prevBasicHeaders[i] = basicHeader
-			prevExtHeaders[i] = extHeader
-		}
+				return writeTestBlock(e, vf.files, vf.invalid,
+					vf.match)
+			},
+		},
+	})
+	if err := gen.Run(); err != nil {
+		fmt.Println(err.Error())
+	}
+}
 
-		if uint32(height) == testBlockHeights[testBlockIndex].height {
-			testBlockIndex++
-		}
+// vectorFilter returns the filter as written to the vectors, where a policy
+// that builds no filter for a block is given an empty one.
+func vectorFilter(filter *gcs.Filter) *gcs.Filter {
+	if filter == nil {
+		return &gcs.Filter{}
 	}
+	return filter
 }
 
-// buildBasicFilter builds a basic GCS filter from a block. A basic GCS filter
-// will contain all the previous outpoints spent within a block, as well as the
-// data pushes within all the outputs created within a block. p is specified as
-// an argument in order to create test vectors with various values for p.
-func buildBasicFilter(block *wire.MsgBlock, p uint8) (*gcs.Filter, error) {
-	blockHash := block.BlockHash()
-	b := builder.WithKeyHashP(&blockHash, p)
+// writeTestBlock writes the rows of a test block to the vector files of each
+// value of P, and its invalid and match cases to the files beside them. The
+// files are indexed by P.
+func writeTestBlock(e *generator.BlockEvent, files, invalidFiles,
+	matchFiles []*JSONTestWriter) error {
 
-	// If the filter had an issue with the specified key, then we force it
-	// to bubble up here by calling the Key() function.
-	_, err := b.Key()
-	if err != nil {
-		return nil, err
+	var blockBuf bytes.Buffer
+	if err := e.Block.Serialize(&blockBuf); err != nil {
+		return fmt.Errorf("error serializing block to buffer: %v", err)
 	}
+	blockBytes := blockBuf.Bytes()
 
-	// In order to build a basic filter, we'll range over the entire block,
-	// adding the outpoint data as well as the data pushes within the
-	// pkScript.
-	for i, tx := range block.Transactions {
-		// First we'll compute the bash of the transaction and add that
-		// directly to the filter.
-		txHash := tx.TxHash()
-		b.AddHash(&txHash)
-
-		// Skip the inputs for the coinbase transaction
-		if i != 0 {
-			// Each each txin, we'll add a serialized version of
-			// the txid:index to the filters data slices.
-			for _, txIn := range tx.TxIn {
-				b.AddOutPoint(txIn.PreviousOutPoint)
+	for _, headers := range e.Headers {
+		p := headers[0].P
+		row := []interface{}{
+			e.Height,
+			e.BlockHash.String(),
+			hex.EncodeToString(blockBytes),
+		}
+		for _, h := range headers {
+			row = append(row, h.PrevHeader.String())
+		}
+		for _, h := range headers {
+			nBytes, err := vectorFilter(h.Filter).NBytes()
+			if err != nil {
+				return fmt.Errorf("couldn't get NBytes(): %v", err)
 			}
+			row = append(row, hex.EncodeToString(nBytes))
+		}
+		for _, h := range headers {
+			row = append(row, h.Header.String())
+		}
+		row = append(row, e.TestBlock.Comment)
+		if err := files[p].WriteTestCase(row); err != nil {
+			return fmt.Errorf("error writing test case to output: %v",
+				err)
 		}
 
-		// For each output in a transaction, we'll add each of the
-		// individual data pushes within the script.
-		for _, txOut := range tx.TxOut {
-			b.AddEntry(txOut.PkScript)
+		for _, h := range headers {
+			filter := vectorFilter(h.Filter)
+			cases, err := invalidCases(h.Policy, e.Height, e.Block,
+				p, h.PrevHeader, filter, h.Header)
+			if err != nil {
+				return fmt.Errorf("error generating invalid %v "+
+					"cases: %v", h.Policy.Name(), err)
+			}
+			for _, row := range cases {
+				err = invalidFiles[p].WriteTestCase(row)
+				if err != nil {
+					return fmt.Errorf("error writing test case "+
+						"to output: %v", err)
+				}
+			}
+
+			row, err := matchCase(h.Policy, e.Height, e.Block, filter,
+				e.TestBlock.Comment)
+			if err != nil {
+				return fmt.Errorf("error generating %v match "+
+					"case: %v", h.Policy.Name(), err)
+			}
+			if err := matchFiles[p].WriteTestCase(row); err != nil {
+				return fmt.Errorf("error writing test case to output: %v",
+					err)
+			}
 		}
 	}
 
-	return b.Build()
+	return nil
 }
 
-// buildExtFilter builds an extended GCS filter from a block. An extended
-// filter supplements a regular basic filter by include all the _witness_ data
-// found within a block. This includes all the data pushes within any signature
-// scripts as well as each element of an input's witness stack. Additionally,
-// the _hashes_ of each transaction are also inserted into the filter. p is
-// specified as an argument in order to create test vectors with various values
-// for p.
-func buildExtFilter(block *wire.MsgBlock, p uint8) (*gcs.Filter, error) {
-	blockHash := block.BlockHash()
-	b := builder.WithKeyHashP(&blockHash, p)
+// verifyAgainstServer checks the basic and extended filters and headers, in
+// that order, against the ones served by btcd.
+func verifyAgainstServer(client backend.ChainClient, blockHash *chainhash.Hash,
+	headers []*generator.HeaderEvent) error {
 
-	// If the filter had an issue with the specified key, then we force it
-	// to bubble up here by calling the Key() function.
-	_, err := b.Key()
-	if err != nil {
-		return nil, err
+	filterTypes := []struct {
+		name       string
+		filterType wire.FilterType
+	}{
+		{"basic", wire.GCSFilterRegular},
+		{"extended", wire.GCSFilterExtended},
 	}
+	for j, t := range filterTypes {
+		filter, err := client.GetCFilter(blockHash, t.filterType)
+		if err != nil {
+			return fmt.Errorf("error getting %v filter: %v", t.name, err)
+		}
+		nBytes, err := vectorFilter(headers[j].Filter).NBytes()
+		if err != nil {
+			return fmt.Errorf("couldn't get NBytes(): %v", err)
+		}
+		if !bytes.Equal(filter.Data, nBytes) {
+			return fmt.Errorf("%v filter doesn't match!\n%v\n%v",
+				t.name, filter.Data, nBytes)
+		}
 
-	// In order to build an extended filter, we add the hash of each
-	// transaction as well as each piece of witness data included in both
-	// the sigScript and the witness stack of an input.
-	for i, tx := range block.Transactions {
-		// Skip the inputs for the coinbase transaction
-		if i != 0 {
-			// Next, for each input, we'll add the sigScript (if
-			// it's present), and also the witness stack (if it's
-			// present)
-			for _, txIn := range tx.TxIn {
-				if txIn.SignatureScript != nil {
-					b.AddScript(txIn.SignatureScript)
-				}
-
-				if len(txIn.Witness) != 0 {
-					b.AddWitness(txIn.Witness)
-				}
-			}
+		header, err := client.GetCFilterHeader(blockHash, t.filterType)
+		if err != nil {
+			return fmt.Errorf("error getting %v header: %v", t.name, err)
+		}
+		if !bytes.Equal(header.PrevFilterHeader[:], headers[j].Header[:]) {
+			return fmt.Errorf("%v header doesn't match!", t.name)
 		}
 	}
 
-	return b.Build()
+	return nil
 }
@@ -0,0 +1,45 @@
+module github.com/christsim/bips/bip-0158
+
+go 1.21
+
+require (
+	github.com/aead/siphash v1.0.1
+	github.com/btcsuite/btcd v0.24.2
+	github.com/btcsuite/btcd/btcec/v2 v2.3.4
+	github.com/btcsuite/btcd/btcutil v1.1.6
+	github.com/btcsuite/btcd/chaincfg/chainhash v1.1.0
+	github.com/btcsuite/goleveldb v1.0.0
+	github.com/christsim/bips/bip-0032 v0.0.0
+	github.com/christsim/bips/bip-0037 v0.0.0
+	github.com/christsim/bips/bip-0141 v0.0.0
+	github.com/christsim/bips/bip-0173 v0.0.0
+	github.com/christsim/bips/bip-0174 v0.0.0
+	github.com/christsim/bips/bip-0380 v0.0.0
+	github.com/roasbeef/btcd v0.0.0-20180418012700-a03db407e40d
+	github.com/roasbeef/btcutil v0.0.0-20180406014609-dfb640c57141
+)
+
+require (
+	github.com/btcsuite/btclog v0.0.0-20170628155309-84c8d2346e9f // indirect
+	github.com/btcsuite/go-socks v0.0.0-20170105172521-4720035b7bfd // indirect
+	github.com/btcsuite/golangcrypto v0.0.0-20150304025918-53f62d9b43e8 // indirect
+	github.com/btcsuite/snappy-go v1.0.0 // indirect
+	github.com/btcsuite/websocket v0.0.0-20150119174127-31079b680792 // indirect
+	github.com/christsim/bips/base58 v0.0.0 // indirect
+	github.com/christsim/bips/internal v0.0.0 // indirect
+	github.com/decred/dcrd/crypto/blake256 v1.0.0 // indirect
+	github.com/decred/dcrd/dcrec/secp256k1/v4 v4.0.1 // indirect
+	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9 // indirect
+	golang.org/x/sys v0.0.0-20200814200057-3d37ad5750ed // indirect
+)
+
+replace (
+	github.com/christsim/bips/base58 => ../base58
+	github.com/christsim/bips/bip-0032 => ../bip-0032
+	github.com/christsim/bips/bip-0037 => ../bip-0037
+	github.com/christsim/bips/bip-0141 => ../bip-0141
+	github.com/christsim/bips/bip-0173 => ../bip-0173
+	github.com/christsim/bips/bip-0174 => ../bip-0174
+	github.com/christsim/bips/bip-0380 => ../bip-0380
+	github.com/christsim/bips/internal => ../internal
+)
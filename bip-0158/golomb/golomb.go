@@ -0,0 +1,96 @@
+// Package golomb implements the Golomb-Rice coding used by the compact block
+// filters of BIP 158, so that it can be shared by other tooling that needs
+// the same primitive, such as experimental filter types.
+//
+// A value v is coded with parameter p as the quotient v >> p in unary, that
+// is as that many one bits followed by a zero bit, and then the p least
+// significant bits of v in big-endian order. Bits are packed into bytes most
+// significant bit first, and the last byte of a stream is padded with zero
+// bits.
+//
+// Writer and Reader code streams over the io interfaces. Buffer and
+// SliceReader do the same over byte slices without allocating, which is what
+// filter matching uses in its inner loop. Both pairs produce and accept
+// exactly the same bytes.
+package golomb
+
+import (
+	"errors"
+)
+
+// MaxP is the largest parameter values can be coded with, as the remainder
+// must fit in 64 bits.
+const MaxP = 64
+
+// ErrPTooBig is returned when coding with a parameter larger than MaxP.
+var ErrPTooBig = errors.New("golomb: parameter too big")
+
+// BitWriter is implemented by Writer, and by anything else that can be
+// written one or more bits at a time.
+type BitWriter interface {
+	// WriteBit writes a single bit.
+	WriteBit(bit bool) error
+
+	// WriteBits writes the nbits least significant bits of v in
+	// big-endian order.
+	WriteBits(v uint64, nbits uint8) error
+}
+
+// BitReader is implemented by Reader, and by anything else that can be read
+// one or more bits at a time.
+type BitReader interface {
+	// ReadBit reads a single bit, returning io.EOF at the end of the
+	// stream.
+	ReadBit() (bool, error)
+
+	// ReadBits reads nbits bits as a big-endian integer.
+	ReadBits(nbits uint8) (uint64, error)
+}
+
+// WriteUint64 writes v Golomb-Rice coded with parameter p to w. The quotient
+// is written one bit at a time, so p should be chosen such that v >> p is
+// small.
+func WriteUint64(w BitWriter, p uint8, v uint64) error {
+	if p > MaxP {
+		return ErrPTooBig
+	}
+
+	for q := v >> p; q > 0; q-- {
+		if err := w.WriteBit(true); err != nil {
+			return err
+		}
+	}
+	if err := w.WriteBit(false); err != nil {
+		return err
+	}
+
+	return w.WriteBits(v, p)
+}
+
+// ReadUint64 reads a value Golomb-Rice coded with parameter p from r. It
+// returns io.EOF if the stream ends before the first bit of the value, and
+// io.ErrUnexpectedEOF if it ends within the remainder.
+func ReadUint64(r BitReader, p uint8) (uint64, error) {
+	if p > MaxP {
+		return 0, ErrPTooBig
+	}
+
+	var q uint64
+	for {
+		bit, err := r.ReadBit()
+		if err != nil {
+			return 0, err
+		}
+		if !bit {
+			break
+		}
+		q++
+	}
+
+	remainder, err := r.ReadBits(p)
+	if err != nil {
+		return 0, err
+	}
+
+	return q<<p + remainder, nil
+}
@@ -0,0 +1,174 @@
+package golomb_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/christsim/bips/bip-0158/golomb"
+)
+
+// TestCoding codes values whose encodings were worked out by hand with the
+// slice and stream coders, and decodes the encodings with both readers.
+func TestCoding(t *testing.T) {
+	tests := []struct {
+		name    string
+		p       uint8
+		values  []uint64
+		encoded string
+	}{{
+		name:    "zero with P = 0",
+		p:       0,
+		values:  []uint64{0},
+		encoded: "00",
+	}, {
+		name:    "unary only",
+		p:       0,
+		values:  []uint64{0, 1, 2, 7, 8, 9},
+		encoded: "5bfbfdff00",
+	}, {
+		name:    "quotient and remainder",
+		p:       2,
+		values:  []uint64{5},
+		encoded: "90",
+	}, {
+		name:    "remainder spanning bytes",
+		p:       8,
+		values:  []uint64{0x1ff},
+		encoded: "bfc0",
+	}, {
+		name:    "values filling a byte",
+		p:       3,
+		values:  []uint64{7, 7},
+		encoded: "77",
+	}, {
+		name:    "remainder only",
+		p:       64,
+		values:  []uint64{1<<64 - 1},
+		encoded: "7fffffffffffffff80",
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			encoded, err := hex.DecodeString(test.encoded)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = golomb.CheckVector(golomb.Vector{
+				P:       test.p,
+				Values:  test.values,
+				Encoded: encoded,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+// TestVectors checks the vectors of the package and that golomb-rice.json
+// holds the same vectors.
+func TestVectors(t *testing.T) {
+	vectors := golomb.Vectors()
+	for _, v := range vectors {
+		if err := golomb.CheckVector(v); err != nil {
+			t.Fatalf("%s: %v", v.Comment, err)
+		}
+	}
+
+	data, err := os.ReadFile("../golomb-rice.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rows [][]interface{}
+	if err := json.Unmarshal(data, &rows); err != nil {
+		t.Fatal(err)
+	}
+	if len(rows)-1 != len(vectors) {
+		t.Fatalf("golomb-rice.json has %d vectors, want %d",
+			len(rows)-1, len(vectors))
+	}
+	for i, row := range rows[1:] {
+		v := vectors[i]
+		values := []uint64{}
+		for _, value := range row[1].([]interface{}) {
+			values = append(values, uint64(value.(float64)))
+		}
+		encoded, err := hex.DecodeString(row[2].(string))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// JSON numbers lose the precision of large values, so those
+		// are only compared through their encoding.
+		if uint8(row[0].(float64)) != v.P || row[3] != v.Comment ||
+			!bytes.Equal(encoded, v.Encoded) {
+
+			t.Fatalf("row %d: got %v, want %v", i+1, row, v)
+		}
+		if v.P < 32 && !reflect.DeepEqual(values, v.Values) {
+			t.Fatalf("%s: values %v, want %v", v.Comment, values,
+				v.Values)
+		}
+	}
+}
+
+// TestReadErrors checks the errors both readers return for streams that end
+// early, and those of coding with a parameter that is too big.
+func TestReadErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		p       uint8
+		encoded []byte
+		err     error
+	}{{
+		name:    "empty stream",
+		p:       19,
+		encoded: nil,
+		err:     io.EOF,
+	}, {
+		name:    "unterminated quotient",
+		p:       19,
+		encoded: []byte{0xff},
+		err:     io.EOF,
+	}, {
+		name:    "truncated remainder",
+		p:       19,
+		encoded: []byte{0x00, 0x00},
+		err:     io.ErrUnexpectedEOF,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := golomb.NewSliceReader(test.encoded).ReadUint64(
+				test.p)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("SliceReader: got error %v, want %v",
+					err, test.err)
+			}
+			_, err = golomb.NewReader(bytes.NewReader(
+				test.encoded)).ReadUint64(test.p)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("Reader: got error %v, want %v", err,
+					test.err)
+			}
+		})
+	}
+
+	var buf bytes.Buffer
+	err := golomb.NewWriter(&buf).WriteUint64(golomb.MaxP+1, 0)
+	if !errors.Is(err, golomb.ErrPTooBig) {
+		t.Fatalf("WriteUint64: got error %v, want %v", err,
+			golomb.ErrPTooBig)
+	}
+	_, err = golomb.NewReader(&buf).ReadUint64(golomb.MaxP + 1)
+	if !errors.Is(err, golomb.ErrPTooBig) {
+		t.Fatalf("ReadUint64: got error %v, want %v", err,
+			golomb.ErrPTooBig)
+	}
+}
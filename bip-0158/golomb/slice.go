@@ -0,0 +1,177 @@
+package golomb
+
+import (
+	"io"
+)
+
+// Buffer accumulates a stream of bits, most significant bit first, into a
+// byte slice. The final byte is padded with zero bits. Writing to a Buffer
+// can't fail, so its methods don't return errors; it is the fastest way to
+// encode a stream that fits in memory.
+type Buffer struct {
+	data []byte
+
+	// used is the number of bits of the last byte in data that have been
+	// written to. A value of 0 means a new byte must be appended before the
+	// next bit can be written.
+	used uint8
+}
+
+// NewBuffer returns a Buffer with room for size bytes before the underlying
+// slice needs to grow.
+func NewBuffer(size int) *Buffer {
+	return &Buffer{data: make([]byte, 0, size)}
+}
+
+// WriteBit appends a single bit to the stream.
+func (w *Buffer) WriteBit(bit bool) {
+	if w.used == 0 {
+		w.data = append(w.data, 0)
+		w.used = 8
+	}
+
+	if bit {
+		w.data[len(w.data)-1] |= 1 << (w.used - 1)
+	}
+	w.used--
+}
+
+// WriteUnary writes q as a run of q one bits followed by a single zero bit.
+func (w *Buffer) WriteUnary(q uint64) {
+	for ; q > 0; q-- {
+		w.WriteBit(true)
+	}
+	w.WriteBit(false)
+}
+
+// WriteBits appends the nbits least significant bits of v to the stream in
+// big-endian order.
+func (w *Buffer) WriteBits(v uint64, nbits uint8) {
+	for nbits > 0 {
+		if w.used == 0 {
+			w.data = append(w.data, 0)
+			w.used = 8
+		}
+
+		// Write as many bits as fit into the current byte in one go.
+		n := w.used
+		if nbits < n {
+			n = nbits
+		}
+		chunk := byte(v>>(nbits-n)) & (1<<n - 1)
+		w.data[len(w.data)-1] |= chunk << (w.used - n)
+
+		w.used -= n
+		nbits -= n
+	}
+}
+
+// WriteUint64 appends v Golomb-Rice coded with parameter p, which must be at
+// most MaxP.
+func (w *Buffer) WriteUint64(p uint8, v uint64) {
+	w.WriteUnary(v >> p)
+	w.WriteBits(v, p)
+}
+
+// Bytes returns the bytes written to the stream so far.
+func (w *Buffer) Bytes() []byte {
+	return w.data
+}
+
+// SliceReader reads a stream of bits, most significant bit first, from a byte
+// slice. Its zero value is ready to use once Reset, and it never allocates,
+// so a single reader can be reused to decode many streams.
+type SliceReader struct {
+	data []byte
+
+	// pos is the index of the next bit to be read.
+	pos uint64
+}
+
+// NewSliceReader returns a reader positioned at the first bit of data.
+func NewSliceReader(data []byte) *SliceReader {
+	return &SliceReader{data: data}
+}
+
+// Reset positions the reader at the first bit of data.
+func (r *SliceReader) Reset(data []byte) {
+	r.data = data
+	r.pos = 0
+}
+
+// Pos returns the number of bits read so far.
+func (r *SliceReader) Pos() uint64 {
+	return r.pos
+}
+
+// ReadBit reads a single bit from the stream, returning io.EOF once all bits
+// have been consumed.
+func (r *SliceReader) ReadBit() (bool, error) {
+	idx := r.pos >> 3
+	if idx >= uint64(len(r.data)) {
+		return false, io.EOF
+	}
+
+	bit := r.data[idx]&(0x80>>(r.pos&7)) != 0
+	r.pos++
+
+	return bit, nil
+}
+
+// ReadUnary counts the one bits preceding the next zero bit.
+func (r *SliceReader) ReadUnary() (uint64, error) {
+	var q uint64
+	for {
+		bit, err := r.ReadBit()
+		if err != nil {
+			return 0, err
+		}
+		if !bit {
+			return q, nil
+		}
+		q++
+	}
+}
+
+// ReadBits reads nbits bits from the stream and returns them as a big-endian
+// integer, or io.ErrUnexpectedEOF if fewer than nbits remain.
+func (r *SliceReader) ReadBits(nbits uint8) (uint64, error) {
+	if r.pos+uint64(nbits) > uint64(len(r.data))*8 {
+		return 0, io.ErrUnexpectedEOF
+	}
+
+	var v uint64
+	for nbits > 0 {
+		idx := r.pos >> 3
+		offset := uint8(r.pos & 7)
+
+		// Read as many bits as remain in the current byte in one go.
+		n := 8 - offset
+		if nbits < n {
+			n = nbits
+		}
+		chunk := uint64(r.data[idx]>>(8-offset-n)) & (1<<n - 1)
+		v = v<<n | chunk
+
+		r.pos += uint64(n)
+		nbits -= n
+	}
+
+	return v, nil
+}
+
+// ReadUint64 reads a value Golomb-Rice coded with parameter p, which must be
+// at most MaxP.
+func (r *SliceReader) ReadUint64(p uint8) (uint64, error) {
+	quotient, err := r.ReadUnary()
+	if err != nil {
+		return 0, err
+	}
+
+	remainder, err := r.ReadBits(p)
+	if err != nil {
+		return 0, err
+	}
+
+	return quotient<<p + remainder, nil
+}
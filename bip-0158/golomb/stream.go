@@ -0,0 +1,157 @@
+package golomb
+
+import (
+	"bufio"
+	"io"
+)
+
+// Writer writes a stream of bits, most significant bit first, to an
+// io.Writer. Whole bytes are written as soon as they are complete; Flush must
+// be called after the last bit to write out the final, zero-padded byte.
+type Writer struct {
+	w   io.Writer
+	buf [1]byte
+
+	// used is the number of bits of buf that have been written to.
+	used uint8
+
+	// err is the first error returned by the underlying writer, after
+	// which all writes fail.
+	err error
+}
+
+// NewWriter returns a Writer writing to w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// WriteBit writes a single bit to the stream.
+func (w *Writer) WriteBit(bit bool) error {
+	if bit {
+		return w.WriteBits(1, 1)
+	}
+	return w.WriteBits(0, 1)
+}
+
+// WriteBits writes the nbits least significant bits of v to the stream in
+// big-endian order.
+func (w *Writer) WriteBits(v uint64, nbits uint8) error {
+	for nbits > 0 && w.err == nil {
+		// Write as many bits as fit into the current byte in one go.
+		n := 8 - w.used
+		if nbits < n {
+			n = nbits
+		}
+		chunk := byte(v>>(nbits-n)) & (1<<n - 1)
+		w.buf[0] |= chunk << (8 - w.used - n)
+
+		w.used += n
+		nbits -= n
+		if w.used == 8 {
+			_, w.err = w.w.Write(w.buf[:])
+			w.buf[0] = 0
+			w.used = 0
+		}
+	}
+
+	return w.err
+}
+
+// WriteUint64 writes v Golomb-Rice coded with parameter p to the stream.
+func (w *Writer) WriteUint64(p uint8, v uint64) error {
+	return WriteUint64(w, p, v)
+}
+
+// Flush writes out the final partial byte of the stream, if any, padded with
+// zero bits. Writing may continue afterwards, starting at a new byte.
+func (w *Writer) Flush() error {
+	if w.used == 0 || w.err != nil {
+		return w.err
+	}
+
+	_, w.err = w.w.Write(w.buf[:])
+	w.buf[0] = 0
+	w.used = 0
+
+	return w.err
+}
+
+// Reader reads a stream of bits, most significant bit first, from an
+// io.Reader. The underlying reader is read a byte at a time, through a
+// bufio.Reader unless it implements io.ByteReader itself.
+type Reader struct {
+	r io.ByteReader
+	b byte
+
+	// left is the number of bits of b not yet read.
+	left uint8
+}
+
+// NewReader returns a Reader reading from r.
+func NewReader(r io.Reader) *Reader {
+	br, ok := r.(io.ByteReader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	return &Reader{r: br}
+}
+
+// ReadBit reads a single bit from the stream, returning io.EOF once the
+// underlying reader is exhausted.
+func (r *Reader) ReadBit() (bool, error) {
+	if r.left == 0 {
+		b, err := r.r.ReadByte()
+		if err != nil {
+			return false, err
+		}
+		r.b = b
+		r.left = 8
+	}
+
+	r.left--
+	return r.b&(1<<r.left) != 0, nil
+}
+
+// ReadBits reads nbits bits from the stream and returns them as a big-endian
+// integer, or io.ErrUnexpectedEOF if the stream ends first.
+func (r *Reader) ReadBits(nbits uint8) (uint64, error) {
+	var v uint64
+	for nbits > 0 {
+		if r.left == 0 {
+			b, err := r.r.ReadByte()
+			if err == io.EOF {
+				return 0, io.ErrUnexpectedEOF
+			}
+			if err != nil {
+				return 0, err
+			}
+			r.b = b
+			r.left = 8
+		}
+
+		// Read as many bits as remain in the current byte in one go.
+		n := r.left
+		if nbits < n {
+			n = nbits
+		}
+		chunk := uint64(r.b>>(r.left-n)) & (1<<n - 1)
+		v = v<<n | chunk
+
+		r.left -= n
+		nbits -= n
+	}
+
+	return v, nil
+}
+
+// ReadUint64 reads a value Golomb-Rice coded with parameter p from the
+// stream.
+func (r *Reader) ReadUint64(p uint8) (uint64, error) {
+	return ReadUint64(r, p)
+}
+
+// Align discards the remaining bits of the current byte, so that the next
+// read starts at a byte boundary. It is the counterpart of Flush.
+func (r *Reader) Align() {
+	r.left = 0
+}
@@ -0,0 +1,132 @@
+package golomb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+)
+
+// ErrVectorMismatch is returned by CheckVector when coding a vector doesn't
+// give the expected result.
+var ErrVectorMismatch = errors.New("golomb: vector mismatch")
+
+// Vector is a sequence of values along with their Golomb-Rice coding.
+type Vector struct {
+	// P is the parameter the values are coded with.
+	P uint8
+
+	// Values are the coded values, in order.
+	Values []uint64
+
+	// Encoded is the concatenated coding of the values, with the last
+	// byte padded with zero bits.
+	Encoded []byte
+
+	// Comment describes what the vector exercises.
+	Comment string
+}
+
+// Vectors returns test vectors covering the edges of the coding: empty
+// streams, zero quotients and remainders, values either side of a multiple
+// of 2^p, remainders spanning byte boundaries, and runs of random values. The
+// vectors are deterministic, so the same set is returned on every call.
+func Vectors() []Vector {
+	rng := rand.New(rand.NewSource(158))
+
+	var vectors []Vector
+	add := func(p uint8, comment string, values ...uint64) {
+		if values == nil {
+			values = []uint64{}
+		}
+		w := NewBuffer(0)
+		for _, v := range values {
+			w.WriteUint64(p, v)
+		}
+		vectors = append(vectors, Vector{
+			P:       p,
+			Values:  values,
+			Encoded: w.Bytes(),
+			Comment: comment,
+		})
+	}
+
+	add(19, "Empty stream")
+	add(0, "Unary only", 0, 1, 2, 7, 8, 9)
+	add(1, "One bit remainder", 0, 1, 2, 3, 4, 17)
+	for _, p := range []uint8{2, 5, 8, 19, 20, 32} {
+		m := uint64(1) << p
+		add(p, fmt.Sprintf("Values around multiples of 2^%d", p),
+			0, 1, m-1, m, m+1, 2*m-1, 2*m, 7*m+m/2)
+
+		values := make([]uint64, 16)
+		for i := range values {
+			// Keep quotients short, as they would be for the
+			// deltas of a filter.
+			values[i] = uint64(rng.Int63n(int64(4 * m)))
+		}
+		add(p, fmt.Sprintf("Random values with P = %d", p), values...)
+	}
+	large := make([]uint64, 16)
+	for i := range large {
+		large[i] = rng.Uint64()
+	}
+	add(63, "Random values with P = 63", large...)
+	add(64, "Remainder only", 0, 1, 1<<63, 1<<64-1)
+
+	return vectors
+}
+
+// CheckVector codes the vector's values with both the slice and the stream
+// coders and decodes its encoding with both readers, returning an error
+// wrapping ErrVectorMismatch on any difference.
+func CheckVector(v Vector) error {
+	w := NewBuffer(0)
+	for _, value := range v.Values {
+		w.WriteUint64(v.P, value)
+	}
+	if !bytes.Equal(w.Bytes(), v.Encoded) {
+		return fmt.Errorf("%w: Buffer encoded %x, want %x",
+			ErrVectorMismatch, w.Bytes(), v.Encoded)
+	}
+
+	var buf bytes.Buffer
+	sw := NewWriter(&buf)
+	for _, value := range v.Values {
+		if err := sw.WriteUint64(v.P, value); err != nil {
+			return err
+		}
+	}
+	if err := sw.Flush(); err != nil {
+		return err
+	}
+	if !bytes.Equal(buf.Bytes(), v.Encoded) {
+		return fmt.Errorf("%w: Writer encoded %x, want %x",
+			ErrVectorMismatch, buf.Bytes(), v.Encoded)
+	}
+
+	r := NewSliceReader(v.Encoded)
+	sr := NewReader(bytes.NewReader(v.Encoded))
+	for i, want := range v.Values {
+		got, err := r.ReadUint64(v.P)
+		if err != nil || got != want {
+			return fmt.Errorf("%w: SliceReader decoded value %d as %d "+
+				"(err %v), want %d", ErrVectorMismatch, i, got, err,
+				want)
+		}
+		got, err = sr.ReadUint64(v.P)
+		if err != nil || got != want {
+			return fmt.Errorf("%w: Reader decoded value %d as %d "+
+				"(err %v), want %d", ErrVectorMismatch, i, got, err,
+				want)
+		}
+	}
+
+	// Only the zero padding of the last byte may follow the last value.
+	if (r.Pos()+7)/8 != uint64(len(v.Encoded)) {
+		return fmt.Errorf("%w: %d bytes follow the last value",
+			ErrVectorMismatch, uint64(len(v.Encoded))-(r.Pos()+7)/8)
+	}
+
+	return nil
+}
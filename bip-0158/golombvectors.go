@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/christsim/bips/bip-0158/golomb"
+)
+
+// golombColumns is the header row of the Golomb-Rice vector file.
+const golombColumns = "P,Values,Encoded,Comment"
+
+// runGolomb implements the golomb subcommand, which writes the test vectors
+// of the golomb package to a file, or with -check verifies an existing file
+// against the package's coders.
+func runGolomb(args []string) error {
+	fs := flag.NewFlagSet("golomb", flag.ContinueOnError)
+	out := fs.String("out", "golomb-rice.json", "file to write the vectors "+
+		"to")
+	check := fs.String("check", "", "vector file to check instead of "+
+		"writing one")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *check != "" {
+		return checkGolombVectors(*check)
+	}
+
+	file, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := NewJSONTestWriter(file)
+	if err := writer.WriteComment(golombColumns); err != nil {
+		return err
+	}
+	for _, v := range golomb.Vectors() {
+		err := writer.WriteTestCase([]interface{}{
+			v.P,
+			v.Values,
+			hex.EncodeToString(v.Encoded),
+			v.Comment,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return writer.Close()
+}
+
+// checkGolombVectors decodes the vector file at path and checks each vector
+// with golomb.CheckVector.
+func checkGolombVectors(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var rows [][]json.RawMessage
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return err
+	}
+
+	count := 0
+	for i, row := range rows {
+		// Skip the header row and any other comments.
+		if len(row) == 1 {
+			continue
+		}
+		if len(row) != 4 {
+			return fmt.Errorf("row %d: expected 4 columns, got %d", i,
+				len(row))
+		}
+
+		var (
+			v       golomb.Vector
+			encoded string
+		)
+		err := firstError(
+			json.Unmarshal(row[0], &v.P),
+			json.Unmarshal(row[1], &v.Values),
+			json.Unmarshal(row[2], &encoded),
+			json.Unmarshal(row[3], &v.Comment),
+		)
+		if err != nil {
+			return fmt.Errorf("row %d: %v", i, err)
+		}
+		if v.Encoded, err = hex.DecodeString(encoded); err != nil {
+			return fmt.Errorf("row %d: %v", i, err)
+		}
+
+		if err := golomb.CheckVector(v); err != nil {
+			return fmt.Errorf("row %d (%v): %v", i, v.Comment, err)
+		}
+		count++
+	}
+
+	fmt.Printf("%d vectors OK\n", count)
+	return nil
+}
+
+// firstError returns the first non-nil error passed to it.
+func firstError(errs ...error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
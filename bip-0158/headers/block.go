@@ -0,0 +1,61 @@
+package headers
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/christsim/bips/bip-0158/backend/chainhash"
+	"github.com/christsim/bips/bip-0158/backend/wire"
+)
+
+// ErrBadMerkleRoot is returned for a block whose transactions don't hash to
+// the merkle root of its header.
+var ErrBadMerkleRoot = errors.New("headers: transactions don't match " +
+	"merkle root")
+
+// CheckMerkleRoot checks that the transactions of the block hash to the
+// merkle root its header commits to, so that a block whose header is in a
+// validated chain can be trusted to hold the transactions it was mined with.
+// Blocks mutated by repeating their last transactions, which hash to the same
+// root, are rejected as Bitcoin Core rejects them. Witnesses aren't covered
+// by the root and aren't checked.
+func CheckMerkleRoot(block *wire.MsgBlock) error {
+	if len(block.Transactions) == 0 {
+		return fmt.Errorf("%w: block %v has no transactions",
+			ErrBadMerkleRoot, block.BlockHash())
+	}
+
+	hashes := make([]chainhash.Hash, len(block.Transactions))
+	for i, tx := range block.Transactions {
+		hashes[i] = tx.TxHash()
+	}
+
+	var buf [2 * chainhash.HashSize]byte
+	for len(hashes) > 1 {
+		// A pair of equal hashes other than the last one duplicated
+		// to pad the level means the transactions were repeated.
+		for i := 0; i+1 < len(hashes); i += 2 {
+			if hashes[i] == hashes[i+1] {
+				return fmt.Errorf("%w: block %v repeats "+
+					"transactions", ErrBadMerkleRoot,
+					block.BlockHash())
+			}
+		}
+		if len(hashes)%2 == 1 {
+			hashes = append(hashes, hashes[len(hashes)-1])
+		}
+		for i := 0; i < len(hashes)/2; i++ {
+			copy(buf[:], hashes[2*i][:])
+			copy(buf[chainhash.HashSize:], hashes[2*i+1][:])
+			hashes[i] = chainhash.DoubleHashH(buf[:])
+		}
+		hashes = hashes[:len(hashes)/2]
+	}
+
+	if hashes[0] != block.Header.MerkleRoot {
+		return fmt.Errorf("%w: block %v has root %v, transactions hash "+
+			"to %v", ErrBadMerkleRoot, block.BlockHash(),
+			block.Header.MerkleRoot, hashes[0])
+	}
+	return nil
+}
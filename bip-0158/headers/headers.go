@@ -0,0 +1,380 @@
+// Package headers syncs and validates a chain of block headers, so that the
+// blocks and filters a client is handed can be checked against a chain it
+// verified itself rather than one a peer or RPC server claims:
+//
+//	chain := headers.New(headers.NetParams(&chaincfg.TestNet3Params))
+//	forkHeight, err := chain.Connect(msgHeaders.Headers)
+//	forkHeight, err = chain.Sync(rpcClient)
+//
+// Every header must connect to the one before it, carry the difficulty the
+// network's rules require of it, and hash below the target that difficulty
+// encodes. Difficulty is retargeted every 2016 blocks from the time the
+// previous 2016 took, as Bitcoin Core does, and on networks that allow it,
+// such as testnet3, a block more than 20 minutes after its parent may be
+// mined at the minimum difficulty, with the blocks after it returning to
+// the difficulty of the last block that wasn't. Regtest never retargets.
+//
+// A batch of headers may fork off below the tip; the chain switches to it if
+// it has more work than the blocks it replaces. Timestamps are only checked
+// as far as retargeting needs them: the median time past and future limits
+// are not enforced, and neither are the version bits. CheckMerkleRoot ties a
+// block to its header once the header is validated.
+package headers
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/christsim/bips/bip-0158/backend/chaincfg"
+	"github.com/christsim/bips/bip-0158/backend/chainhash"
+	"github.com/christsim/bips/bip-0158/backend/wire"
+)
+
+var (
+	// ErrDisconnected is returned for headers that don't build on the
+	// chain, or on the header before them.
+	ErrDisconnected = errors.New("headers: header doesn't connect")
+
+	// ErrBadDifficulty is returned for a header whose bits differ from
+	// those the network's retarget rules require.
+	ErrBadDifficulty = errors.New("headers: unexpected difficulty")
+
+	// ErrBadProofOfWork is returned for a header whose hash exceeds its
+	// target, or whose target is out of range.
+	ErrBadProofOfWork = errors.New("headers: insufficient proof of work")
+
+	// ErrInsufficientWork is returned for headers forking off the chain
+	// that have no more work than the blocks they would replace.
+	ErrInsufficientWork = errors.New("headers: fork has less work than " +
+		"the chain")
+
+	// ErrNotInChain is returned for heights beyond the tip.
+	ErrNotInChain = errors.New("headers: height not in chain")
+)
+
+// Params are the rules headers are validated against.
+type Params struct {
+	// Genesis is the header of the genesis block, which the chain starts
+	// from.
+	Genesis wire.BlockHeader
+
+	// PowLimit is the highest target, and PowLimitBits its compact form.
+	PowLimit     *big.Int
+	PowLimitBits uint32
+
+	// TargetTimespan is the time each retarget period should take, and
+	// TargetTimePerBlock each block. Their ratio is the number of blocks
+	// of a period.
+	TargetTimespan     time.Duration
+	TargetTimePerBlock time.Duration
+
+	// RetargetAdjustmentFactor bounds how far a retarget changes the
+	// difficulty, in either direction.
+	RetargetAdjustmentFactor int64
+
+	// ReduceMinDifficulty allows a block to be mined at the minimum
+	// difficulty if its timestamp is more than MinDiffReductionTime after
+	// its parent's.
+	ReduceMinDifficulty  bool
+	MinDiffReductionTime time.Duration
+
+	// NoRetargeting skips retargets, so the difficulty only changes for
+	// minimum difficulty blocks.
+	NoRetargeting bool
+}
+
+// NetParams returns the header rules of the network. Regtest, which the
+// parameters of the roasbeef backend don't mark, never retargets.
+func NetParams(params *chaincfg.Params) *Params {
+	return &Params{
+		Genesis:                  params.GenesisBlock.Header,
+		PowLimit:                 params.PowLimit,
+		PowLimitBits:             params.PowLimitBits,
+		TargetTimespan:           params.TargetTimespan,
+		TargetTimePerBlock:       params.TargetTimePerBlock,
+		RetargetAdjustmentFactor: params.RetargetAdjustmentFactor,
+		ReduceMinDifficulty:      params.ReduceMinDifficulty,
+		MinDiffReductionTime:     params.MinDiffReductionTime,
+		NoRetargeting:            params.Net == wire.TestNet,
+	}
+}
+
+// entry is what the chain keeps of each header.
+type entry struct {
+	hash      chainhash.Hash
+	timestamp uint32
+	bits      uint32
+
+	// lastBits is the bits of the last block up to this one that isn't
+	// a minimum difficulty block inside a retarget period, which the
+	// block after a minimum difficulty block returns to.
+	lastBits uint32
+}
+
+// Chain is a validated chain of block headers from the genesis block. Its
+// methods must not be called concurrently.
+type Chain struct {
+	params   *Params
+	interval uint32
+
+	entries []entry
+	work    *big.Int
+}
+
+// New returns a chain holding the genesis block of params.
+func New(params *Params) *Chain {
+	genesis := &params.Genesis
+	return &Chain{
+		params: params,
+		interval: uint32(params.TargetTimespan /
+			params.TargetTimePerBlock),
+		entries: []entry{{
+			hash:      genesis.BlockHash(),
+			timestamp: uint32(genesis.Timestamp.Unix()),
+			bits:      genesis.Bits,
+			lastBits:  genesis.Bits,
+		}},
+		work: CalcWork(genesis.Bits),
+	}
+}
+
+// Height returns the height of the tip.
+func (c *Chain) Height() uint32 {
+	return uint32(len(c.entries) - 1)
+}
+
+// TipHash returns the hash of the tip.
+func (c *Chain) TipHash() chainhash.Hash {
+	return c.entries[len(c.entries)-1].hash
+}
+
+// Work returns the total work of the chain.
+func (c *Chain) Work() *big.Int {
+	return new(big.Int).Set(c.work)
+}
+
+// BlockHash returns the hash of the block at the passed height.
+func (c *Chain) BlockHash(height uint32) (*chainhash.Hash, error) {
+	if height > c.Height() {
+		return nil, ErrNotInChain
+	}
+	return &c.entries[height].hash, nil
+}
+
+// Locator returns a block locator for the chain, as sent in a getheaders
+// message: the hashes of the last ten blocks, then of blocks twice as far
+// back each time, ending with the genesis block.
+func (c *Chain) Locator() []chainhash.Hash {
+	var locator []chainhash.Hash
+	step := uint32(1)
+	for height := c.Height(); ; height -= step {
+		locator = append(locator, c.entries[height].hash)
+		if len(locator) >= 10 {
+			step *= 2
+		}
+		if height < step {
+			break
+		}
+	}
+	if locator[len(locator)-1] != c.entries[0].hash {
+		locator = append(locator, c.entries[0].hash)
+	}
+	return locator
+}
+
+// Connect validates the headers, which must follow each other, and adds them
+// to the chain. The first may build on any block of the chain: headers the
+// chain already holds are skipped, and the rest, if they fork off below the
+// tip, replace the blocks after the fork point only if they have more work.
+// Connect returns the height of the last block the chain shared before and
+// after, which is the old tip unless the chain reorganized. On error, the
+// chain is unchanged.
+func (c *Chain) Connect(headers []*wire.BlockHeader) (uint32, error) {
+	if len(headers) == 0 {
+		return c.Height(), nil
+	}
+
+	forkHeight, ok := c.find(&headers[0].PrevBlock)
+	if !ok {
+		return 0, fmt.Errorf("%w: %v builds on unknown block %v",
+			ErrDisconnected, headers[0].BlockHash(),
+			headers[0].PrevBlock)
+	}
+	for len(headers) > 0 && forkHeight < c.Height() &&
+		headers[0].BlockHash() == c.entries[forkHeight+1].hash {
+
+		forkHeight++
+		headers = headers[1:]
+	}
+	if len(headers) == 0 {
+		return c.Height(), nil
+	}
+
+	// The new headers are validated against the chain up to the fork
+	// point followed by those before them.
+	branch := make([]entry, 0, len(headers))
+	at := func(height uint32) *entry {
+		if height <= forkHeight {
+			return &c.entries[height]
+		}
+		return &branch[height-forkHeight-1]
+	}
+	branchWork := new(big.Int)
+	for i, header := range headers {
+		height := forkHeight + 1 + uint32(i)
+		prev := at(height - 1)
+		if header.PrevBlock != prev.hash {
+			return 0, fmt.Errorf("%w: header at height %d builds "+
+				"on %v, expected %v", ErrDisconnected, height,
+				header.PrevBlock, prev.hash)
+		}
+
+		e, err := c.check(header, height, at)
+		if err != nil {
+			return 0, err
+		}
+		branch = append(branch, e)
+		branchWork.Add(branchWork, CalcWork(e.bits))
+	}
+
+	if forkHeight < c.Height() {
+		replacedWork := new(big.Int)
+		for _, e := range c.entries[forkHeight+1:] {
+			replacedWork.Add(replacedWork, CalcWork(e.bits))
+		}
+		if branchWork.Cmp(replacedWork) <= 0 {
+			return 0, fmt.Errorf("%w: %d headers from height %d",
+				ErrInsufficientWork, len(branch), forkHeight+1)
+		}
+		c.entries = c.entries[:forkHeight+1]
+		c.work.Sub(c.work, replacedWork)
+	}
+	c.entries = append(c.entries, branch...)
+	c.work.Add(c.work, branchWork)
+
+	return forkHeight, nil
+}
+
+// HeaderSource serves the headers of its best chain after a block locator,
+// as a peer answers getheaders. backend.ChainClient satisfies it with the
+// getheaders RPC of btcd.
+type HeaderSource interface {
+	// GetHeaders returns up to wire.MaxBlockHeadersPerMsg headers
+	// following the first block of the locator the source knows, ending
+	// at hashStop unless it is zero.
+	GetHeaders(blockLocators []chainhash.Hash,
+		hashStop *chainhash.Hash) ([]wire.BlockHeader, error)
+}
+
+// Sync connects the headers the source serves after the tip until it has no
+// more, and returns the height of the last block the chain shared before and
+// after. Headers connected before an invalid batch are kept.
+func (c *Chain) Sync(source HeaderSource) (uint32, error) {
+	forkHeight := c.Height()
+	for {
+		headers, err := source.GetHeaders(c.Locator(), &chainhash.Hash{})
+		if err != nil {
+			return forkHeight, err
+		}
+		batch := make([]*wire.BlockHeader, len(headers))
+		for i := range headers {
+			batch[i] = &headers[i]
+		}
+		height, err := c.Connect(batch)
+		if err != nil {
+			return forkHeight, err
+		}
+		if height < forkHeight {
+			forkHeight = height
+		}
+
+		if len(headers) < wire.MaxBlockHeadersPerMsg {
+			return forkHeight, nil
+		}
+	}
+}
+
+// find returns the height of the block with the passed hash. Forks happen
+// near the tip, so the chain is searched from there.
+func (c *Chain) find(blockHash *chainhash.Hash) (uint32, bool) {
+	for i := len(c.entries) - 1; i >= 0; i-- {
+		if c.entries[i].hash == *blockHash {
+			return uint32(i), true
+		}
+	}
+	return 0, false
+}
+
+// check validates the header at the passed height against the blocks before
+// it, which at returns, and returns its entry.
+func (c *Chain) check(header *wire.BlockHeader, height uint32,
+	at func(height uint32) *entry) (entry, error) {
+
+	e := entry{
+		hash:      header.BlockHash(),
+		timestamp: uint32(header.Timestamp.Unix()),
+		bits:      header.Bits,
+	}
+
+	bits := c.requiredBits(height, e.timestamp, at)
+	if header.Bits != bits {
+		return e, fmt.Errorf("%w: block %v at height %d has bits %08x, "+
+			"expected %08x", ErrBadDifficulty, e.hash, height,
+			header.Bits, bits)
+	}
+	err := CheckProofOfWork(&e.hash, header.Bits, c.params.PowLimit)
+	if err != nil {
+		return e, err
+	}
+
+	e.lastBits = e.bits
+	if height%c.interval != 0 && e.bits == c.params.PowLimitBits {
+		e.lastBits = at(height - 1).lastBits
+	}
+	return e, nil
+}
+
+// requiredBits returns the bits the block at the passed height must have,
+// given its timestamp and the blocks before it.
+func (c *Chain) requiredBits(height, timestamp uint32,
+	at func(height uint32) *entry) uint32 {
+
+	prev := at(height - 1)
+
+	if height%c.interval != 0 {
+		if !c.params.ReduceMinDifficulty {
+			return prev.bits
+		}
+		reduction := int64(c.params.MinDiffReductionTime / time.Second)
+		if int64(timestamp) > int64(prev.timestamp)+reduction {
+			return c.params.PowLimitBits
+		}
+		return prev.lastBits
+	}
+	if c.params.NoRetargeting {
+		return prev.bits
+	}
+
+	// Like Bitcoin Core, the period is measured from its first block to
+	// its last, one block short of the whole period.
+	first := at(height - c.interval)
+	timespan := int64(prev.timestamp) - int64(first.timestamp)
+	targetTimespan := int64(c.params.TargetTimespan / time.Second)
+	factor := c.params.RetargetAdjustmentFactor
+	switch {
+	case timespan < targetTimespan/factor:
+		timespan = targetTimespan / factor
+	case timespan > targetTimespan*factor:
+		timespan = targetTimespan * factor
+	}
+
+	target := CompactToBig(prev.bits)
+	target.Mul(target, big.NewInt(timespan))
+	target.Div(target, big.NewInt(targetTimespan))
+	if target.Cmp(c.params.PowLimit) > 0 {
+		target.Set(c.params.PowLimit)
+	}
+	return BigToCompact(target)
+}
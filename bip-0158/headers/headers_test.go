@@ -0,0 +1,457 @@
+package headers_test
+
+import (
+	"errors"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/christsim/bips/bip-0158/backend/chaincfg"
+	"github.com/christsim/bips/bip-0158/backend/chainhash"
+	"github.com/christsim/bips/bip-0158/backend/wire"
+	"github.com/christsim/bips/bip-0158/blockgen"
+	"github.com/christsim/bips/bip-0158/headers"
+)
+
+const (
+	// limitBits are the bits of the minimum difficulty of testParams.
+	limitBits = 0x207fffff
+
+	// testBits are the bits of the genesis block of testParams, 128
+	// times the minimum difficulty, so that blocks are cheap to mine
+	// and minimum difficulty blocks stand out.
+	testBits = 0x2000ffff
+)
+
+// testParams are rules retargeting every four blocks of ten minutes, which
+// allow minimum difficulty blocks after twenty minutes.
+func testParams() *headers.Params {
+	genesis := wire.BlockHeader{
+		Version:   1,
+		Timestamp: time.Unix(1600000000, 0),
+		Bits:      testBits,
+	}
+	mine(&genesis, false)
+
+	return &headers.Params{
+		Genesis:                  genesis,
+		PowLimit:                 headers.CompactToBig(limitBits),
+		PowLimitBits:             limitBits,
+		TargetTimespan:           40 * time.Minute,
+		TargetTimePerBlock:       10 * time.Minute,
+		RetargetAdjustmentFactor: 4,
+		ReduceMinDifficulty:      true,
+		MinDiffReductionTime:     20 * time.Minute,
+	}
+}
+
+// mine sets the nonce of the header to the first for which its hash is below
+// its target, or above it if weak is set.
+func mine(header *wire.BlockHeader, weak bool) {
+	target := headers.CompactToBig(header.Bits)
+	for {
+		blockHash := header.BlockHash()
+		if (headers.HashToBig(&blockHash).Cmp(target) > 0) == weak {
+			return
+		}
+		header.Nonce++
+	}
+}
+
+// child returns a mined header building on prev, the passed time after it.
+func child(prev *wire.BlockHeader, after time.Duration,
+	bits uint32) *wire.BlockHeader {
+
+	header := &wire.BlockHeader{
+		Version:   1,
+		PrevBlock: prev.BlockHash(),
+		Timestamp: prev.Timestamp.Add(after),
+		Bits:      bits,
+	}
+	mine(header, false)
+	return header
+}
+
+// TestConnect connects batches of headers to a chain holding the genesis
+// block of testParams and those of base.
+func TestConnect(t *testing.T) {
+	params := testParams()
+	genesis := &params.Genesis
+
+	// a is the main chain. With blocks ten minutes apart, the first
+	// retarget period takes three quarters of its target, so the
+	// target of a[4] is three quarters of the genesis block's.
+	a := []*wire.BlockHeader{genesis}
+	for i := 1; i <= 3; i++ {
+		a = append(a, child(a[i-1], 10*time.Minute, testBits))
+	}
+	a = append(a, child(a[3], 10*time.Minute, 0x2000bfff))
+	unretargeted := child(a[3], 10*time.Minute, testBits)
+
+	// m2 is a minimum difficulty block, after which m3 returns to the
+	// difficulty before it.
+	m2 := child(a[1], 30*time.Minute, limitBits)
+	m3 := child(m2, 10*time.Minute, testBits)
+	easy := child(m2, 10*time.Minute, limitBits)
+	early := child(a[1], 10*time.Minute, limitBits)
+
+	weak := &wire.BlockHeader{
+		Version:   1,
+		PrevBlock: a[1].BlockHash(),
+		Timestamp: a[1].Timestamp.Add(10 * time.Minute),
+		Bits:      testBits,
+	}
+	mine(weak, true)
+
+	// b forks off a after its first block.
+	b2 := child(a[1], 11*time.Minute, testBits)
+	b3 := child(b2, 10*time.Minute, testBits)
+
+	orphan := child(&wire.BlockHeader{Nonce: 1}, 0, testBits)
+
+	tests := []struct {
+		name    string
+		base    []*wire.BlockHeader
+		headers []*wire.BlockHeader
+
+		forkHeight uint32
+		tip        *wire.BlockHeader
+		err        error
+	}{{
+		name:       "empty",
+		base:       a[1:2],
+		forkHeight: 1,
+		tip:        a[1],
+	}, {
+		name:       "extend",
+		base:       a[1:2],
+		headers:    a[2:4],
+		forkHeight: 1,
+		tip:        a[3],
+	}, {
+		name:       "already held",
+		base:       a[1:3],
+		headers:    a[1:3],
+		forkHeight: 2,
+		tip:        a[2],
+	}, {
+		name:       "overlapping",
+		base:       a[1:3],
+		headers:    a[1:4],
+		forkHeight: 2,
+		tip:        a[3],
+	}, {
+		name:       "retarget",
+		base:       a[1:3],
+		headers:    a[3:5],
+		forkHeight: 2,
+		tip:        a[4],
+	}, {
+		name:    "missing retarget",
+		base:    a[1:3],
+		headers: []*wire.BlockHeader{a[3], unretargeted},
+		err:     headers.ErrBadDifficulty,
+	}, {
+		name:       "minimum difficulty",
+		base:       a[1:2],
+		headers:    []*wire.BlockHeader{m2, m3},
+		forkHeight: 1,
+		tip:        m3,
+	}, {
+		name:    "minimum difficulty kept",
+		base:    a[1:2],
+		headers: []*wire.BlockHeader{m2, easy},
+		err:     headers.ErrBadDifficulty,
+	}, {
+		name:    "minimum difficulty too early",
+		base:    a[1:2],
+		headers: []*wire.BlockHeader{early},
+		err:     headers.ErrBadDifficulty,
+	}, {
+		name:    "insufficient proof of work",
+		base:    a[1:2],
+		headers: []*wire.BlockHeader{weak},
+		err:     headers.ErrBadProofOfWork,
+	}, {
+		name:    "unknown parent",
+		base:    a[1:2],
+		headers: []*wire.BlockHeader{orphan},
+		err:     headers.ErrDisconnected,
+	}, {
+		name:    "out of order",
+		base:    a[1:2],
+		headers: []*wire.BlockHeader{a[3], a[2]},
+		err:     headers.ErrDisconnected,
+	}, {
+		name:    "fork with equal work",
+		base:    a[1:3],
+		headers: []*wire.BlockHeader{b2},
+		err:     headers.ErrInsufficientWork,
+	}, {
+		name:       "fork with more work",
+		base:       a[1:3],
+		headers:    []*wire.BlockHeader{b2, b3},
+		forkHeight: 1,
+		tip:        b3,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			chain := headers.New(params)
+			if _, err := chain.Connect(test.base); err != nil {
+				t.Fatal(err)
+			}
+			baseHeight, baseTip := chain.Height(), chain.TipHash()
+
+			forkHeight, err := chain.Connect(test.headers)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("got error %v, want %v", err, test.err)
+			}
+			if err != nil {
+				if chain.Height() != baseHeight ||
+					chain.TipHash() != baseTip {
+
+					t.Fatal("chain changed on error")
+				}
+				return
+			}
+			if forkHeight != test.forkHeight {
+				t.Fatalf("fork height %d, want %d", forkHeight,
+					test.forkHeight)
+			}
+			if chain.TipHash() != test.tip.BlockHash() {
+				t.Fatalf("tip %v, want %v", chain.TipHash(),
+					test.tip.BlockHash())
+			}
+
+			// The chain is walked back from the tip to check the
+			// hashes of each height and the total work.
+			work := new(big.Int)
+			header := test.tip
+			for height := chain.Height(); ; height-- {
+				blockHash, err := chain.BlockHash(height)
+				if err != nil || *blockHash != header.BlockHash() {
+					t.Fatalf("height %d: hash %v, %v", height,
+						blockHash, err)
+				}
+				work.Add(work, headers.CalcWork(header.Bits))
+				if height == 0 {
+					break
+				}
+				header = find(header.PrevBlock, a, m2, m3, b2,
+					b3)
+			}
+			if chain.Work().Cmp(work) != 0 {
+				t.Fatalf("work %v, want %v", chain.Work(), work)
+			}
+			_, err = chain.BlockHash(chain.Height() + 1)
+			if err != headers.ErrNotInChain {
+				t.Fatalf("hash past tip: got error %v", err)
+			}
+		})
+	}
+}
+
+// find returns the header with the passed hash among a and the others.
+func find(blockHash chainhash.Hash, a []*wire.BlockHeader,
+	others ...*wire.BlockHeader) *wire.BlockHeader {
+
+	for _, header := range append(others, a...) {
+		if header.BlockHash() == blockHash {
+			return header
+		}
+	}
+	return nil
+}
+
+// TestLocator checks the locator of a chain of fifteen blocks, which steps
+// back one block at a time for ten blocks and then twice as far each time.
+func TestLocator(t *testing.T) {
+	params := testParams()
+	params.NoRetargeting = true
+	chain := headers.New(params)
+
+	batch := []*wire.BlockHeader{&params.Genesis}
+	for i := 1; i <= 15; i++ {
+		batch = append(batch, child(batch[i-1], 10*time.Minute,
+			testBits))
+	}
+	if _, err := chain.Connect(batch[1:]); err != nil {
+		t.Fatal(err)
+	}
+
+	var want []chainhash.Hash
+	for _, height := range []int{15, 14, 13, 12, 11, 10, 9, 8, 7, 6, 4,
+		0} {
+
+		want = append(want, batch[height].BlockHash())
+	}
+	if locator := chain.Locator(); !reflect.DeepEqual(locator, want) {
+		t.Fatalf("got locator of %d hashes, want %d", len(locator),
+			len(want))
+	}
+}
+
+// TestCompact converts targets to and from the compact form of the bits of a
+// header.
+func TestCompact(t *testing.T) {
+	tests := []struct {
+		bits   uint32
+		target *big.Int
+
+		// canonical is set if BigToCompact returns bits for target.
+		canonical bool
+	}{{
+		bits:      0x1d00ffff,
+		target:    new(big.Int).Lsh(big.NewInt(0xffff), 208),
+		canonical: true,
+	}, {
+		bits:      0x207fffff,
+		target:    new(big.Int).Lsh(big.NewInt(0x7fffff), 232),
+		canonical: true,
+	}, {
+		bits:      0x03123456,
+		target:    big.NewInt(0x123456),
+		canonical: true,
+	}, {
+		bits:      0x02123400,
+		target:    big.NewInt(0x1234),
+		canonical: true,
+	}, {
+		bits:      0x02008000,
+		target:    big.NewInt(0x80),
+		canonical: true,
+	}, {
+		bits:      0x04923456,
+		target:    big.NewInt(-0x12345600),
+		canonical: true,
+	}, {
+		bits:      0,
+		target:    new(big.Int),
+		canonical: true,
+	}, {
+		bits:   0x01003456,
+		target: new(big.Int),
+	}, {
+		bits:   0x04800000,
+		target: new(big.Int),
+	}}
+
+	for _, test := range tests {
+		target := headers.CompactToBig(test.bits)
+		if target.Cmp(test.target) != 0 {
+			t.Fatalf("bits %08x: target %x, want %x", test.bits,
+				target, test.target)
+		}
+		if !test.canonical {
+			continue
+		}
+		if bits := headers.BigToCompact(test.target); bits != test.bits {
+			t.Fatalf("target %x: bits %08x, want %08x", test.target,
+				bits, test.bits)
+		}
+	}
+}
+
+// TestProofOfWork checks the work of bits and hashes against targets.
+func TestProofOfWork(t *testing.T) {
+	powLimit := chaincfg.MainNetParams.PowLimit
+	var high chainhash.Hash
+	for i := range high {
+		high[i] = 0xff
+	}
+
+	tests := []struct {
+		name string
+		hash chainhash.Hash
+		bits uint32
+		work int64
+		err  error
+	}{{
+		name: "minimum difficulty",
+		bits: 0x1d00ffff,
+		work: 0x100010001,
+	}, {
+		name: "hash above target",
+		hash: high,
+		bits: 0x1d00ffff,
+		work: 0x100010001,
+		err:  headers.ErrBadProofOfWork,
+	}, {
+		name: "target above limit",
+		bits: 0x1e00ffff,
+		work: 0x1000100,
+		err:  headers.ErrBadProofOfWork,
+	}, {
+		name: "zero target",
+		bits: 0,
+		err:  headers.ErrBadProofOfWork,
+	}, {
+		name: "negative target",
+		bits: 0x04923456,
+		err:  headers.ErrBadProofOfWork,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			work := headers.CalcWork(test.bits)
+			if work.Cmp(big.NewInt(test.work)) != 0 {
+				t.Fatalf("work %v, want %v", work, test.work)
+			}
+			err := headers.CheckProofOfWork(&test.hash, test.bits,
+				powLimit)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("got error %v, want %v", err, test.err)
+			}
+		})
+	}
+}
+
+// TestCheckMerkleRoot checks the transactions of blocks against the merkle
+// roots of their headers.
+func TestCheckMerkleRoot(t *testing.T) {
+	gen := blockgen.New(1, blockgen.DefaultConfig)
+	var block *wire.MsgBlock
+	for block == nil || len(block.Transactions) != 3 {
+		block = gen.Block()
+	}
+	txs := block.Transactions
+
+	tests := []struct {
+		name string
+		txs  []*wire.MsgTx
+		err  error
+	}{{
+		name: "valid",
+		txs:  txs,
+	}, {
+		name: "repeated transactions",
+		txs:  append(txs[:3:3], txs[2]),
+		err:  headers.ErrBadMerkleRoot,
+	}, {
+		name: "reordered",
+		txs:  []*wire.MsgTx{txs[0], txs[2], txs[1]},
+		err:  headers.ErrBadMerkleRoot,
+	}, {
+		name: "missing transaction",
+		txs:  txs[:2],
+		err:  headers.ErrBadMerkleRoot,
+	}, {
+		name: "no transactions",
+		err:  headers.ErrBadMerkleRoot,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mutated := &wire.MsgBlock{
+				Header:       block.Header,
+				Transactions: test.txs,
+			}
+			err := headers.CheckMerkleRoot(mutated)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("got error %v, want %v", err, test.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package headers
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/christsim/bips/bip-0158/backend/chainhash"
+)
+
+// oneLsh256 is 2^256, the number of possible hash values.
+var oneLsh256 = new(big.Int).Lsh(big.NewInt(1), 256)
+
+// CompactToBig returns the target encoded in the compact form of a header's
+// bits field: a base 256 floating point number whose most significant byte
+// is the exponent and whose lower 23 bits are the mantissa, with bit 23 as
+// the sign.
+func CompactToBig(compact uint32) *big.Int {
+	mantissa := compact & 0x007fffff
+	negative := compact&0x00800000 != 0
+	exponent := uint(compact >> 24)
+
+	var n *big.Int
+	if exponent <= 3 {
+		mantissa >>= 8 * (3 - exponent)
+		n = big.NewInt(int64(mantissa))
+	} else {
+		n = big.NewInt(int64(mantissa))
+		n.Lsh(n, 8*(exponent-3))
+	}
+	if negative {
+		n.Neg(n)
+	}
+	return n
+}
+
+// BigToCompact returns the compact form of the target, rounding it down to
+// the precision of the mantissa as Bitcoin Core does.
+func BigToCompact(n *big.Int) uint32 {
+	if n.Sign() == 0 {
+		return 0
+	}
+
+	var mantissa uint32
+	exponent := uint(len(n.Bytes()))
+	if exponent <= 3 {
+		mantissa = uint32(n.Bits()[0])
+		mantissa <<= 8 * (3 - exponent)
+	} else {
+		tn := new(big.Int).Abs(n)
+		mantissa = uint32(tn.Rsh(tn, 8*(exponent-3)).Bits()[0])
+	}
+
+	// A mantissa with its top bit set would read as negative, so it is
+	// moved down a byte.
+	if mantissa&0x00800000 != 0 {
+		mantissa >>= 8
+		exponent++
+	}
+
+	compact := uint32(exponent<<24) | mantissa
+	if n.Sign() < 0 {
+		compact |= 0x00800000
+	}
+	return compact
+}
+
+// HashToBig returns the hash read as a little endian number, as it is
+// compared with the target.
+func HashToBig(hash *chainhash.Hash) *big.Int {
+	var buf [chainhash.HashSize]byte
+	for i := range hash {
+		buf[chainhash.HashSize-1-i] = hash[i]
+	}
+	return new(big.Int).SetBytes(buf[:])
+}
+
+// CalcWork returns the expected number of hashes needed to find a block with
+// the passed bits, 2^256 / (target + 1). Bits encoding a target that isn't
+// positive are worth no work.
+func CalcWork(bits uint32) *big.Int {
+	target := CompactToBig(bits)
+	if target.Sign() <= 0 {
+		return new(big.Int)
+	}
+	return new(big.Int).Div(oneLsh256, target.Add(target, big.NewInt(1)))
+}
+
+// CheckProofOfWork checks that the bits encode a target between one and the
+// network's limit, and that the block hash doesn't exceed it.
+func CheckProofOfWork(blockHash *chainhash.Hash, bits uint32,
+	powLimit *big.Int) error {
+
+	target := CompactToBig(bits)
+	if target.Sign() <= 0 || target.Cmp(powLimit) > 0 {
+		return fmt.Errorf("%w: target %064x of bits %08x out of range",
+			ErrBadProofOfWork, target, bits)
+	}
+	if HashToBig(blockHash).Cmp(target) > 0 {
+		return fmt.Errorf("%w: block %v above target %064x",
+			ErrBadProofOfWork, blockHash, target)
+	}
+	return nil
+}
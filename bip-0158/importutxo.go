@@ -0,0 +1,68 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/christsim/bips/bip-0158/backend/chainhash"
+	"github.com/christsim/bips/bip-0158/prevout"
+)
+
+// runImportUTXO implements the importutxo subcommand, which loads a UTXO
+// snapshot written by dumptxoutset, or a CSV export of the UTXO set, into a
+// UTXO index for use with the -utxodb flag.
+func runImportUTXO(args []string) error {
+	fs := flag.NewFlagSet("importutxo", flag.ContinueOnError)
+	db := fs.String("db", "", "UTXO index to import into")
+	snapshot := fs.String("snapshot", "", "dumptxoutset snapshot or .csv "+
+		"file to import")
+	base := fs.String("base", "", "hash of the block a CSV file was "+
+		"exported at")
+	netName := fs.String("net", "testnet3", "network of the snapshot: "+
+		"mainnet, testnet3, regtest or simnet")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *db == "" || *snapshot == "" {
+		return fmt.Errorf("both -db and -snapshot must be set")
+	}
+	params, ok := networks[*netName]
+	if !ok {
+		return fmt.Errorf("unknown network %q", *netName)
+	}
+
+	file, err := os.Open(*snapshot)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	index, err := prevout.OpenUTXOIndex(*db)
+	if err != nil {
+		return err
+	}
+	defer index.Close()
+
+	if strings.HasSuffix(strings.ToLower(*snapshot), ".csv") {
+		baseHash, err := chainhash.NewHashFromStr(*base)
+		if err != nil || *base == "" {
+			return fmt.Errorf("-base must be set to the block hash " +
+				"the CSV file was exported at")
+		}
+		if err := index.ImportCSV(file, baseHash); err != nil {
+			return err
+		}
+		fmt.Println("Imported UTXO set at block", baseHash)
+		return nil
+	}
+
+	baseHash, err := index.ImportSnapshot(file, params.Net)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Imported UTXO snapshot at block", baseHash)
+
+	return nil
+}
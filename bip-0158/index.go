@@ -0,0 +1,288 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/christsim/bips/bip-0158/backend/chainhash"
+	"github.com/christsim/bips/bip-0158/backend/wire"
+	"github.com/christsim/bips/bip-0158/filterdb"
+	"github.com/christsim/bips/bip-0158/gcs/builder"
+	"github.com/christsim/bips/bip-0158/headers"
+)
+
+// indexBatchSize is the number of blocks whose filters are written to the
+// filter store at a time.
+const indexBatchSize = 500
+
+// indexedTypes maps the policies the index subcommand can store to the filter
+// type they are stored under.
+var indexedTypes = map[string]wire.FilterType{
+	"basic":    wire.GCSFilterRegular,
+	"extended": wire.GCSFilterExtended,
+}
+
+// runIndex implements the index subcommand, which builds the filters of each
+// block and stores them along with their headers in a filter store. It picks
+// up where the store left off, and with -follow keeps indexing new blocks as
+// they arrive. With -verifyheaders, the node's header chain is synced and
+// validated with the headers package first, and only blocks in it whose
+// transactions match their headers are indexed, so that the node can't have
+// filters built for a chain without proof of work.
+func runIndex(args []string) error {
+	fs := flag.NewFlagSet("index", flag.ContinueOnError)
+	dbPath := fs.String("db", "filterdb", "filter store to write to")
+	typeList := fs.String("types", "basic,extended", "comma separated list "+
+		"of filter types to index")
+	end := fs.Int64("end", -1, "last block height to index (default the "+
+		"node's tip)")
+	follow := fs.Bool("follow", false, "keep indexing new blocks as they "+
+		"arrive")
+	poll := fs.Duration("poll", 10*time.Second, "how often to check for "+
+		"new blocks with -follow")
+	keep := fs.Uint("keep", 0, "prune filters more than this many blocks "+
+		"below the tip, keeping their headers (default keep all)")
+	verifyHeaders := fs.Bool("verifyheaders", false, "validate the "+
+		"proof of work of the node's headers and index only blocks "+
+		"that match them")
+	netName := fs.String("net", "testnet3", "network of the node, whose "+
+		"rules -verifyheaders checks: mainnet, testnet3, regtest or "+
+		"simnet")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	params, ok := networks[*netName]
+	if !ok {
+		return fmt.Errorf("unknown network %q", *netName)
+	}
+
+	var (
+		policies    []builder.FilterPolicy
+		filterTypes []wire.FilterType
+	)
+	for _, name := range strings.Split(*typeList, ",") {
+		name = strings.TrimSpace(name)
+		filterType, ok := indexedTypes[name]
+		if !ok {
+			return fmt.Errorf("can't index filter type %q", name)
+		}
+		policy, err := builder.LookupPolicy(name)
+		if err != nil {
+			return err
+		}
+		policies = append(policies, policy)
+		filterTypes = append(filterTypes, filterType)
+	}
+
+	db, err := filterdb.Open(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	client, err := newRPCClient()
+	if err != nil {
+		return err
+	}
+	defer client.Shutdown()
+
+	var chain *headers.Chain
+	fetcher := blockFetcher(client)
+	if *verifyHeaders {
+		chain = headers.New(headers.NetParams(params))
+		fetcher = &checkedFetcher{client: client, chain: chain}
+	}
+
+	// Resume from the block after the store's tip, extending each header
+	// chain from the header stored for it.
+	height := uint32(0)
+	chains := make([]*builder.FilterHeaderChain, len(policies))
+	tip, err := db.TipHeight()
+	switch {
+	case err == filterdb.ErrNotFound:
+		for j := range chains {
+			chains[j] = builder.NewFilterHeaderChain(1)
+		}
+
+	case err != nil:
+		return err
+
+	default:
+		height = tip + 1
+		tipHash, err := db.BlockHash(tip)
+		if err != nil {
+			return err
+		}
+		for j, filterType := range filterTypes {
+			header, err := db.FetchHeader(tipHash, filterType)
+			if err != nil {
+				return fmt.Errorf("no %v header at tip: %v",
+					policies[j].Name(), err)
+			}
+			chains[j] = builder.NewFilterHeaderChainFrom(height,
+				*header, 1)
+		}
+	}
+
+	for {
+		last := *end
+		if last < 0 {
+			last, err = client.GetBlockCount()
+			if err != nil {
+				return fmt.Errorf("couldn't get block count: %v", err)
+			}
+		}
+		if chain != nil {
+			last, err = syncIndexHeaders(chain, client, db, height,
+				last)
+			if err != nil {
+				return err
+			}
+		}
+
+		batch := db.NewBatch()
+		for ; int64(height) <= last; height++ {
+			fmt.Fprintf(os.Stderr, "Height: %d\n", height)
+			err := indexBlock(fetcher, batch, height, policies,
+				filterTypes, chains)
+			if err != nil {
+				return err
+			}
+
+			if batch.Len() >= indexBatchSize*len(policies) {
+				if err := db.WriteBatch(batch); err != nil {
+					return err
+				}
+				batch = db.NewBatch()
+			}
+		}
+		if err := db.WriteBatch(batch); err != nil {
+			return err
+		}
+
+		if *keep > 0 && height > uint32(*keep) {
+			if err := db.Prune(height - uint32(*keep)); err != nil {
+				return err
+			}
+		}
+
+		if !*follow {
+			return nil
+		}
+		time.Sleep(*poll)
+	}
+}
+
+// indexBlock builds the filters of the block at the passed height and adds
+// them to the batch.
+func indexBlock(client blockFetcher, batch *filterdb.Batch, height uint32,
+	policies []builder.FilterPolicy, filterTypes []wire.FilterType,
+	chains []*builder.FilterHeaderChain) error {
+
+	blockHash, err := client.GetBlockHash(int64(height))
+	if err != nil {
+		return fmt.Errorf("couldn't get block hash: %v", err)
+	}
+	block, err := client.GetBlock(blockHash)
+	if err != nil {
+		return fmt.Errorf("couldn't get block: %v", err)
+	}
+
+	elements := builder.ExtractElements(block)
+	for j, policy := range policies {
+		filter, err := builder.BuildElementFilter(policy, elements,
+			builder.DefaultP)
+		if err != nil {
+			return fmt.Errorf("error generating %v filter: %v",
+				policy.Name(), err)
+		}
+		header, err := chains[j].Append(filter)
+		if err != nil {
+			return err
+		}
+
+		err = batch.PutFilter(&filterdb.Entry{
+			Height:     height,
+			BlockHash:  *blockHash,
+			FilterType: filterTypes[j],
+			Filter:     filter,
+			Header:     header,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// blockFetcher is the part of the RPC client used to fetch blocks by height.
+type blockFetcher interface {
+	GetBlockHash(height int64) (*chainhash.Hash, error)
+	GetBlock(blockHash *chainhash.Hash) (*wire.MsgBlock, error)
+}
+
+// syncIndexHeaders extends the validated header chain with the node's
+// headers and returns the last height to index, the lower of last and the
+// chain's tip. It fails if the chain no longer holds the blocks indexed
+// below height, since the index can't follow a reorganization.
+func syncIndexHeaders(chain *headers.Chain, client headers.HeaderSource,
+	db *filterdb.DB, height uint32, last int64) (int64, error) {
+
+	if _, err := chain.Sync(client); err != nil {
+		return 0, fmt.Errorf("invalid headers from node: %v", err)
+	}
+	if height > 0 {
+		indexed, err := db.BlockHash(height - 1)
+		if err != nil {
+			return 0, err
+		}
+		blockHash, err := chain.BlockHash(height - 1)
+		if err != nil || *blockHash != *indexed {
+			return 0, fmt.Errorf("indexed block %v at height %d "+
+				"isn't in the node's header chain", indexed,
+				height-1)
+		}
+	}
+
+	if last > int64(chain.Height()) {
+		last = int64(chain.Height())
+	}
+	return last, nil
+}
+
+// checkedFetcher fetches blocks by the hashes of a validated header chain,
+// checking that their transactions match their headers, rather than taking
+// the node's word for them.
+type checkedFetcher struct {
+	client blockFetcher
+	chain  *headers.Chain
+}
+
+// GetBlockHash returns the hash of the block at the passed height in the
+// validated chain.
+func (f *checkedFetcher) GetBlockHash(height int64) (*chainhash.Hash, error) {
+	return f.chain.BlockHash(uint32(height))
+}
+
+// GetBlock fetches the block from the node and checks it against its header.
+func (f *checkedFetcher) GetBlock(
+	blockHash *chainhash.Hash) (*wire.MsgBlock, error) {
+
+	block, err := f.client.GetBlock(blockHash)
+	if err != nil {
+		return nil, err
+	}
+	if block.BlockHash() != *blockHash {
+		return nil, fmt.Errorf("node returned block %v, requested %v",
+			block.BlockHash(), blockHash)
+	}
+	if err := headers.CheckMerkleRoot(block); err != nil {
+		return nil, err
+	}
+	return block, nil
+}
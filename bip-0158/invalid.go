@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+
+	"github.com/christsim/bips/bip-0158/backend/chainhash"
+	"github.com/christsim/bips/bip-0158/backend/wire"
+	"github.com/christsim/bips/bip-0158/gcs"
+	"github.com/christsim/bips/bip-0158/gcs/builder"
+)
+
+// invalidColumns is the header row of the invalid vector files.
+const invalidColumns = "Block Height,Block Hash,Filter Type,Previous Header," +
+	"Filter,Header,Element,Expected Error,Notes"
+
+// The error classes invalid vectors are tagged with. Implementations are
+// expected to reject each case, and can check that they do so for the right
+// reason.
+const (
+	// errTruncatedFilter means the filter data ends before N elements
+	// can be decoded.
+	errTruncatedFilter = "truncated_filter"
+
+	// errTrailingData means data other than padding follows the last
+	// element of the filter.
+	errTrailingData = "trailing_data"
+
+	// errNonCanonicalN means N isn't encoded as the shortest CompactSize.
+	errNonCanonicalN = "non_canonical_n"
+
+	// errKeyMismatch means the filter wasn't keyed with the block hash, so
+	// the element, which belongs to the block, doesn't match it.
+	errKeyMismatch = "key_mismatch"
+
+	// errHeaderMismatch means the header isn't the hash of the filter
+	// and the previous header.
+	errHeaderMismatch = "header_mismatch"
+)
+
+// policyEntries returns the entries the policy inserts into the filter of the
+// block, sorted.
+func policyEntries(policy builder.FilterPolicy,
+	block *wire.MsgBlock, p uint8) ([][]byte, error) {
+
+	blockHash := block.BlockHash()
+	b := builder.WithKeyHashP(&blockHash, p)
+	policy.AddBlock(b, block)
+	return b.Entries()
+}
+
+// validateError classifies the error returned when decoding and validating a
+// serialized filter, returning the empty string if it is valid.
+func validateError(p uint8, nBytes []byte) string {
+	filter, err := gcs.FromNBytes(p, nBytes)
+	if err == nil {
+		err = filter.Validate()
+	}
+
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, gcs.ErrNonCanonicalVarInt):
+		return errNonCanonicalN
+	case errors.Is(err, gcs.ErrTrailingData):
+		return errTrailingData
+	default:
+		return errTruncatedFilter
+	}
+}
+
+// withN returns the filter data of a serialized filter with N replaced by the
+// passed value.
+func withN(nBytes []byte, n uint64) []byte {
+	filter, err := gcs.FromNBytes(0, nBytes)
+	if err != nil {
+		return nil
+	}
+	data, _ := filter.Bytes()
+
+	var buf [9]byte
+	size := wire.VarIntSerializeSize(n)
+	switch size {
+	case 1:
+		buf[0] = byte(n)
+	case 3:
+		buf[0] = 0xfd
+		binary.LittleEndian.PutUint16(buf[1:], uint16(n))
+	default:
+		buf[0] = 0xfe
+		binary.LittleEndian.PutUint32(buf[1:], uint32(n))
+	}
+
+	return append(buf[:size:size], data...)
+}
+
+// invalidCases derives deliberately corrupted variants of a valid filter and
+// header for the block, each tagged with the class of error an implementation
+// should reject it with. Corruptions that our own decoder would accept, which
+// can happen for tiny values of P, are left out so that every case is
+// unambiguous.
+func invalidCases(policy builder.FilterPolicy, height uint32,
+	block *wire.MsgBlock, p uint8, prevHeader chainhash.Hash,
+	filter *gcs.Filter, header chainhash.Hash) ([][]interface{}, error) {
+
+	blockHash := block.BlockHash()
+	nBytes, err := filter.NBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	var cases [][]interface{}
+	addCase := func(prev chainhash.Hash, filterBytes []byte,
+		head chainhash.Hash, element []byte, class, notes string) {
+
+		cases = append(cases, []interface{}{
+			height,
+			blockHash.String(),
+			policy.Name(),
+			prev.String(),
+			hex.EncodeToString(filterBytes),
+			head.String(),
+			hex.EncodeToString(element),
+			class,
+			notes,
+		})
+	}
+
+	n := uint64(filter.N())
+	if n > 0 {
+		// Drop the second half of the filter data.
+		prefix := wire.VarIntSerializeSize(n)
+		truncated := nBytes[:prefix+(len(nBytes)-prefix)/2]
+		if validateError(p, truncated) == errTruncatedFilter {
+			addCase(prevHeader, truncated, header, nil,
+				errTruncatedFilter, "Filter data cut in half")
+		}
+
+		// Claim one element fewer than the filter holds.
+		fewer := withN(nBytes, n-1)
+		if class := validateError(p, fewer); class != "" {
+			addCase(prevHeader, fewer, header, nil, class,
+				"N is one less than the number of elements")
+		}
+	}
+
+	// Claim one element more than the filter holds.
+	more := withN(nBytes, n+1)
+	if validateError(p, more) == errTruncatedFilter {
+		addCase(prevHeader, more, header, nil, errTruncatedFilter,
+			"N is one more than the number of elements")
+	}
+
+	// Encode N with a needlessly long CompactSize.
+	if n < 0xfd {
+		long := []byte{0xfd, byte(n), 0}
+		long = append(long, nBytes[1:]...)
+		addCase(prevHeader, long, header, nil, errNonCanonicalN,
+			"N encoded in three bytes")
+	}
+
+	// Key the filter with the previous block's hash instead of this one's
+	// and pick a non-empty element of the block that the result doesn't
+	// match.
+	if n > 0 {
+		entries, err := policyEntries(policy, block, p)
+		if err != nil {
+			return nil, err
+		}
+		b := builder.WithKeyHashP(&block.Header.PrevBlock, p)
+		policy.AddBlock(b, block)
+		misKeyed, err := b.Build()
+		if err != nil {
+			return nil, err
+		}
+		key := builder.DeriveKey(&blockHash)
+		for _, entry := range entries {
+			if len(entry) == 0 {
+				continue
+			}
+			match, err := misKeyed.Match(key, entry)
+			if err != nil {
+				return nil, err
+			}
+			if match {
+				continue
+			}
+
+			misKeyedBytes, err := misKeyed.NBytes()
+			if err != nil {
+				return nil, err
+			}
+			misKeyedHeader, err := builder.MakeHeaderForFilter(
+				misKeyed, prevHeader)
+			if err != nil {
+				return nil, err
+			}
+			addCase(prevHeader, misKeyedBytes, misKeyedHeader,
+				entry, errKeyMismatch, "Filter keyed with the "+
+					"previous block hash")
+			break
+		}
+	}
+
+	// Flip a bit of the previous header so that it no longer links to
+	// the header.
+	brokenPrev := prevHeader
+	brokenPrev[0] ^= 1
+	addCase(brokenPrev, nBytes, header, nil, errHeaderMismatch,
+		"Previous header has a flipped bit")
+
+	return cases, nil
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	btcdwire "github.com/btcsuite/btcd/wire"
+	"github.com/christsim/bips/bip-0158/backend/chaincfg"
+	"github.com/christsim/bips/bip-0158/backend/wire"
+	"github.com/christsim/bips/bip-0158/coinselect"
+	"github.com/christsim/bips/bip-0158/gcs/builder"
+	"github.com/christsim/bips/bip-0158/headers"
+	"github.com/christsim/bips/bip-0158/lightclient"
+	"github.com/christsim/bips/bip-0158/rescan"
+	"github.com/christsim/bips/bip-0158/services"
+	"github.com/christsim/bips/bip-0174"
+	"github.com/christsim/bips/bip-0380"
+)
+
+// runLightClient implements the lightclient subcommand, which syncs the
+// headers and filter headers of a BIP 157 peer with the lightclient package,
+// validating the proof of work and difficulty of the headers, and reports the
+// blocks whose filters match a watch list. With -blocks, the matching blocks
+// are fetched from the peer and the transactions relevant to the watch list
+// are listed as well. Output descriptors may be watched too; with -blocks the
+// scripts of ranged ones are watched with a gap limit, and without it the
+// first -lookahead scripts of each are matched. Once a rescan ends, the first
+// index of each ranged descriptor past those it found used is reported, from
+// which a wallet gives out its next addresses. Passing -blockpeer fetches the
+// matching blocks from other peers instead, with a rescan.Scheduler
+// downloading them in batches while earlier ones are scanned.
+//
+// With -pay, the coins the rescan found are spent: the coinselect package
+// selects those paying the outputs at -feerate, and the unsigned PSBT of the
+// spend is printed for a wallet holding the keys to sign. Change goes to
+// -change, or to the next unused script of the last ranged descriptor.
+func runLightClient(args []string) error {
+	fs := flag.NewFlagSet("lightclient", flag.ContinueOnError)
+	peer := fs.String("peer", "127.0.0.1:18333", "address of the peer to "+
+		"sync from")
+	netName := fs.String("net", "testnet3", "network of the peer: mainnet, "+
+		"testnet3, regtest or simnet")
+	typeName := fs.String("type", "basic", "filter type to sync")
+	p := fs.Uint("p", builder.DefaultP, "Golomb-Rice parameter of the "+
+		"peer's filters")
+	watch := fs.String("watch", "", "comma separated list of addresses or "+
+		"hex encoded output scripts to watch for")
+	var descs commandList
+	fs.Var(&descs, "descriptor", "output descriptor whose scripts to "+
+		"watch for; may be repeated")
+	lookAhead := fs.Uint("lookahead", rescan.DefaultLookAhead, "number of "+
+		"scripts of a ranged descriptor watched past the last one used")
+	start := fs.Uint("start", 0, "first block height to scan")
+	blocks := fs.Bool("blocks", false, "fetch the matching blocks from the "+
+		"peer and list the relevant transactions")
+	var blockPeers commandList
+	fs.Var(&blockPeers, "blockpeer", "address of a peer to fetch the "+
+		"matching blocks from alongside the others, in batches; may be "+
+		"repeated")
+	var pay commandList
+	fs.Var(&pay, "pay", "address=amount, in satoshis, to pay from the "+
+		"coins found with -blocks; may be repeated")
+	feeRate := fs.Int64("feerate", 1000, "fee rate of the spend, in "+
+		"satoshis per 1000 virtual bytes")
+	changeTo := fs.String("change", "", "address or hex encoded output "+
+		"script to pay the change of the spend to")
+	final := fs.Bool("final", false, "don't signal that the spend may be "+
+		"replaced, as BIP 125 defines")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	params, ok := networks[*netName]
+	if !ok {
+		return fmt.Errorf("unknown network %q", *netName)
+	}
+	filterType, ok := indexedTypes[*typeName]
+	if !ok {
+		return fmt.Errorf("unknown filter type %q", *typeName)
+	}
+
+	var scripts [][]byte
+	for _, item := range strings.Split(*watch, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		script, err := parseScript(item, params)
+		if err != nil {
+			return err
+		}
+		scripts = append(scripts, script)
+	}
+	var watchDescs []rescan.Descriptor
+	for _, text := range descs {
+		desc, err := descriptor.Parse(text)
+		if err != nil {
+			return err
+		}
+		watchDescs = append(watchDescs, desc)
+	}
+	if len(scripts) == 0 && len(watchDescs) == 0 {
+		return fmt.Errorf("nothing to watch, pass -watch or -descriptor")
+	}
+	var outputs []*wire.TxOut
+	for _, item := range pay {
+		address, amount, ok := strings.Cut(item, "=")
+		if !ok {
+			return fmt.Errorf("%q isn't address=amount", item)
+		}
+		script, err := parseScript(address, params)
+		if err != nil {
+			return err
+		}
+		value, err := strconv.ParseInt(amount, 10, 64)
+		if err != nil || value <= 0 {
+			return fmt.Errorf("invalid amount %q", amount)
+		}
+		outputs = append(outputs, wire.NewTxOut(value, script))
+	}
+	if len(outputs) > 0 && !*blocks {
+		return fmt.Errorf("-pay spends the coins found with -blocks")
+	}
+
+	client, err := lightclient.Dial(*peer, lightclient.Config{
+		Net:         params.Net,
+		GenesisHash: *params.GenesisHash,
+		Headers:     headers.NetParams(params),
+		FilterType:  filterType,
+		P:           uint8(*p),
+	})
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	height, err := client.SyncHeaders()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Synced %d block headers\n", height)
+	filterHeight, err := client.SyncFilterHeaders()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Synced %d filter headers\n", filterHeight+1)
+
+	if !*blocks {
+		// Without blocks there's no telling which scripts are used,
+		// so ranged descriptors are matched up to the look-ahead.
+		watchList, err := rescan.NewWatchList(watchDescs,
+			uint32(*lookAhead))
+		if err != nil {
+			return err
+		}
+		for _, script := range scripts {
+			watchList.WatchScript(script)
+		}
+		scripts = watchList.Entries()
+		matches, err := client.MatchBlocks(uint32(*start), scripts)
+		if err != nil {
+			return err
+		}
+		for _, match := range matches {
+			fmt.Printf("%d %v\n", match.Height, match.BlockHash)
+		}
+		return nil
+	}
+
+	cfg := client.RescanConfig(uint32(*start), nil)
+	cfg.WatchScripts = scripts
+	cfg.WatchDescriptors = watchDescs
+	cfg.LookAhead = uint32(*lookAhead)
+	if len(blockPeers) > 0 {
+		// Blocks are only fetched from the extra peers, since the
+		// rescan matches filters from the client while blocks are
+		// downloaded, and a client can't do both at once.
+		var sources []rescan.BlockSource
+		for _, addr := range blockPeers {
+			peer, err := lightclient.Dial(addr, lightclient.Config{
+				Net:              params.Net,
+				GenesisHash:      *params.GenesisHash,
+				RequiredServices: services.Witness,
+			})
+			if err != nil {
+				return fmt.Errorf("%v: %v", addr, err)
+			}
+			defer peer.Close()
+			sources = append(sources, peer)
+		}
+		scheduler := rescan.NewScheduler(&rescan.SchedulerConfig{
+			Sources: sources,
+		})
+		scheduler.Start()
+		defer scheduler.Stop()
+		cfg.Scheduler = scheduler
+	}
+	r := rescan.New(cfg)
+	r.Start()
+	var txs []*rescan.RelevantTx
+	for tx := range r.Transactions() {
+		fmt.Printf("%d %v %v\n", tx.Height, tx.BlockHash, tx.Tx.TxHash())
+		txs = append(txs, tx)
+	}
+	if err := r.Err(); err != nil {
+		return err
+	}
+	var changeScript []byte
+	for i, text := range descs {
+		if !watchDescs[i].IsRange() {
+			continue
+		}
+		next := r.WatchList().NextIndex(i)
+		fmt.Fprintf(os.Stderr, "Next index %d of %v\n", next, text)
+		nextScripts, err := watchDescs[i].Scripts(next)
+		if err != nil {
+			return err
+		}
+		changeScript = nextScripts[0]
+	}
+	if len(outputs) == 0 {
+		return nil
+	}
+
+	if *changeTo != "" {
+		changeScript, err = parseScript(*changeTo, params)
+		if err != nil {
+			return err
+		}
+	}
+	if changeScript == nil {
+		return fmt.Errorf("no script to pay change to, pass -change " +
+			"or a ranged -descriptor")
+	}
+	return printSpend(txs, r.WatchList(), height, &coinselect.Config{
+		Outputs:      outputs,
+		FeeRate:      *feeRate,
+		ChangeScript: changeScript,
+		Final:        *final,
+	})
+}
+
+// parseScript returns the output script of an address of the network, or of
+// a hex encoded script.
+func parseScript(item string, params *chaincfg.Params) ([]byte, error) {
+	script, err := builder.AddressToScript(item, params)
+	if err != nil {
+		script, err = hex.DecodeString(item)
+		if err != nil {
+			return nil, fmt.Errorf("%q is neither an address nor "+
+				"a hex script", item)
+		}
+	}
+	return script, nil
+}
+
+// printSpend selects coins of the relevant transactions of a rescan for the
+// spend configured, and prints the unsigned PSBT of the spend, its inputs
+// having the outputs they spend. Coins whose inputs coinselect can't weigh
+// are left out.
+func printSpend(txs []*rescan.RelevantTx, watch *rescan.WatchList,
+	height uint32, cfg *coinselect.Config) error {
+
+	var coins []coinselect.Coin
+	for _, coin := range coinselect.FromRescan(txs, watch, height) {
+		_, err := coinselect.EstimateInputWeight(coin.PkScript)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Skipping %v: %v\n",
+				coin.OutPoint, err)
+			continue
+		}
+		coins = append(coins, coin)
+	}
+	sel, err := coinselect.Select(coins, cfg)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Selected %d of %d coins with %v, paying %d "+
+		"in fees and %d in change\n", len(sel.Inputs), len(coins),
+		sel.Algorithm, sel.Fee, sel.Change)
+
+	// The psbt package uses the wire types of upstream btcd whichever
+	// backend is selected, so transactions are converted by serializing
+	// them.
+	tx, err := toBtcdTx(sel.Tx())
+	if err != nil {
+		return err
+	}
+	update := &psbt.Update{}
+	for _, rtx := range txs {
+		prevTx, err := toBtcdTx(rtx.Tx)
+		if err != nil {
+			return err
+		}
+		update.PrevTxs = append(update.PrevTxs, prevTx)
+	}
+	packet, err := psbt.New(tx)
+	if err != nil {
+		return err
+	}
+	if err := packet.Update(update); err != nil {
+		return err
+	}
+	encoded, err := packet.Base64()
+	if err != nil {
+		return err
+	}
+	fmt.Println(encoded)
+	return nil
+}
+
+// toBtcdTx converts a transaction to the wire type of upstream btcd.
+func toBtcdTx(tx *wire.MsgTx) (*btcdwire.MsgTx, error) {
+	var raw bytes.Buffer
+	if err := tx.Serialize(&raw); err != nil {
+		return nil, err
+	}
+	btcdTx := &btcdwire.MsgTx{}
+	if err := btcdTx.Deserialize(&raw); err != nil {
+		return nil, err
+	}
+	return btcdTx, nil
+}
@@ -0,0 +1,720 @@
+// Package lightclient implements a minimal BIP 157 light client, in the
+// style of neutrino, on top of the filter stack of this repository. It serves
+// as an executable example of how the pieces fit together and as an end to
+// end test of them against a peer such as the one in the cfserver package.
+//
+// A Client talks to a single peer. SyncHeaders downloads the block header
+// chain and SyncFilterHeaders the filter header chain, checking the latter
+// against the peer's checkpoints and, if configured, checkpoints the client
+// trusts. Filters are then fetched on demand and checked against the filter
+// header chain before they are used, so the Client can be handed to the
+// rescan package as both its FilterSource and BlockSource.
+//
+// Unless Config.Headers is set, the client trusts its peer for the block
+// header chain: headers are only checked to connect to each other. With it,
+// they are validated by the headers package, so that a peer has to do the
+// work of the chain it serves, and the blocks and filters the client matches
+// are tied to that work. There is no second peer to catch a filter header
+// chain that is consistent but wrong, so the client is not meant to protect
+// real funds either way.
+package lightclient
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"time"
+
+	"github.com/christsim/bips/bip-0158/backend/chainhash"
+	"github.com/christsim/bips/bip-0158/backend/wire"
+	"github.com/christsim/bips/bip-0158/cfmsg"
+	"github.com/christsim/bips/bip-0158/gcs"
+	"github.com/christsim/bips/bip-0158/gcs/builder"
+	"github.com/christsim/bips/bip-0158/headers"
+	"github.com/christsim/bips/bip-0158/rescan"
+	"github.com/christsim/bips/bip-0158/services"
+)
+
+var (
+	// ErrNoFilterService is returned when the peer doesn't advertise
+	// NODE_COMPACT_FILTERS.
+	ErrNoFilterService = errors.New("lightclient: peer doesn't serve " +
+		"compact filters")
+
+	// ErrMissingServices is returned when the peer doesn't advertise
+	// every service of Config.RequiredServices.
+	ErrMissingServices = errors.New("lightclient: peer lacks required " +
+		"services")
+
+	// ErrBadHeaders is returned when the peer sends block headers that
+	// don't connect to the chain.
+	ErrBadHeaders = errors.New("lightclient: headers don't connect")
+
+	// ErrBadFilterHeaders is returned when the peer's filter headers or
+	// checkpoints are inconsistent with the block chain or with each
+	// other.
+	ErrBadFilterHeaders = errors.New("lightclient: invalid filter headers")
+
+	// ErrBadFilter is returned when the peer sends a filter that doesn't
+	// match the filter header chain.
+	ErrBadFilter = errors.New("lightclient: filter doesn't match its " +
+		"header")
+
+	// ErrNotSynced is returned for heights beyond the synced chains.
+	ErrNotSynced = errors.New("lightclient: height not synced")
+)
+
+// DefaultTimeout is how long the client waits for the peer to answer a
+// request if Config.Timeout isn't set.
+const DefaultTimeout = 30 * time.Second
+
+// Config configures a Client.
+type Config struct {
+	// Net is the network whose magic messages are framed with.
+	Net wire.BitcoinNet
+
+	// GenesisHash is the hash of the genesis block, which the header
+	// chain starts from.
+	GenesisHash chainhash.Hash
+
+	// Headers, if set, are the rules the block headers are validated
+	// against, whose genesis block must be GenesisHash.
+	Headers *headers.Params
+
+	// FilterType is the type of filter to sync and match.
+	FilterType wire.FilterType
+
+	// P is the Golomb-Rice parameter of the filters. It defaults to
+	// builder.DefaultP.
+	P uint8
+
+	// Checkpoints, if set, are trusted filter headers for every
+	// cfmsg.CFCheckptInterval-th block, laid out as in a cfcheckpt
+	// message. The peer's checkpoints must agree with them.
+	Checkpoints []chainhash.Hash
+
+	// UserAgent is sent in the version message.
+	UserAgent string
+
+	// RequiredServices are the services the peer must advertise. It
+	// defaults to services.CompactFilters; add services.Witness and
+	// services.Network or services.NetworkLimited to rely on the peer
+	// for blocks too.
+	RequiredServices services.Flags
+
+	// Timeout is how long to wait for the peer to answer a request.
+	Timeout time.Duration
+}
+
+// Match is a block whose filter matched the watch list.
+type Match struct {
+	Height    uint32
+	BlockHash chainhash.Hash
+}
+
+// Client is a light client connected to a single peer. Its methods must not
+// be called concurrently.
+type Client struct {
+	cfg  Config
+	conn net.Conn
+
+	// peerServices and peerHeight are the services and chain height the
+	// peer advertised in its version message.
+	peerServices services.Flags
+	peerHeight   int32
+
+	// blockHashes holds the hash of every block of the synced header
+	// chain, indexed by height.
+	blockHashes []chainhash.Hash
+
+	// chain validates the headers as they are synced, if Config.Headers
+	// is set.
+	chain *headers.Chain
+
+	// filterHashes holds the hash of every block's filter, indexed by
+	// height, as committed to by filterHeaders.
+	filterHashes  []chainhash.Hash
+	filterHeaders *builder.FilterHeaderChain
+
+	// filters holds the most recently fetched batch of verified filters,
+	// keyed by height.
+	filters map[uint32]*gcs.Filter
+}
+
+// Dial connects to the peer at addr and performs the version handshake.
+func Dial(addr string, cfg Config) (*Client, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := New(conn, cfg)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// New performs the version handshake over an established connection and
+// returns a client using it.
+func New(conn net.Conn, cfg Config) (*Client, error) {
+	if cfg.P == 0 {
+		cfg.P = builder.DefaultP
+	}
+	if cfg.UserAgent == "" {
+		cfg.UserAgent = "/lightclient:0.1/"
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	if cfg.RequiredServices == 0 {
+		cfg.RequiredServices = services.CompactFilters
+	}
+
+	c := &Client{
+		cfg:           cfg,
+		conn:          conn,
+		blockHashes:   []chainhash.Hash{cfg.GenesisHash},
+		filterHeaders: builder.NewFilterHeaderChain(0),
+		filters:       make(map[uint32]*gcs.Filter),
+	}
+	if cfg.Headers != nil {
+		c.chain = headers.New(cfg.Headers)
+		if c.chain.TipHash() != cfg.GenesisHash {
+			return nil, fmt.Errorf("lightclient: header rules are "+
+				"for genesis block %v, not %v",
+				c.chain.TipHash(), cfg.GenesisHash)
+		}
+	}
+	if err := c.handshake(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Close disconnects from the peer.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Height returns the height of the tip of the synced header chain.
+func (c *Client) Height() uint32 {
+	return uint32(len(c.blockHashes) - 1)
+}
+
+// PeerServices returns the services the peer advertised.
+func (c *Client) PeerServices() services.Flags {
+	return c.peerServices
+}
+
+// ServesBlock reports whether the peer, by the services and height it
+// advertised, serves the block at height.
+func (c *Client) ServesBlock(height uint32) bool {
+	return c.peerServices.ServesBlock(c.peerHeight, int32(height))
+}
+
+// FilterHeight returns the height of the tip of the synced filter header
+// chain, or -1 if no filter headers have been synced.
+func (c *Client) FilterHeight() int64 {
+	return int64(len(c.filterHashes)) - 1
+}
+
+// BlockHash returns the hash of the block at the passed height.
+func (c *Client) BlockHash(height uint32) (*chainhash.Hash, error) {
+	if height > c.Height() {
+		return nil, ErrNotSynced
+	}
+	return &c.blockHashes[height], nil
+}
+
+// FilterHeader returns the filter header of the block at the passed height.
+func (c *Client) FilterHeader(height uint32) (chainhash.Hash, error) {
+	header, err := c.filterHeaders.Header(height)
+	if err == builder.ErrHeightNotInChain {
+		return header, ErrNotSynced
+	}
+	return header, err
+}
+
+// send writes a message to the peer.
+func (c *Client) send(msg wire.Message) error {
+	c.conn.SetWriteDeadline(time.Now().Add(c.cfg.Timeout))
+	return cfmsg.WriteMessage(c.conn, msg, c.cfg.Net)
+}
+
+// receive reads messages from the peer until one with the passed command
+// arrives, answering pings and ignoring everything else in the meantime.
+func (c *Client) receive(cmd string) (wire.Message, error) {
+	c.conn.SetReadDeadline(time.Now().Add(c.cfg.Timeout))
+	for {
+		msg, err := cfmsg.ReadMessage(c.conn, c.cfg.Net)
+		if err != nil {
+			return nil, err
+		}
+
+		switch msg.Command() {
+		case cmd:
+			return msg, nil
+
+		case wire.CmdPing:
+			var ping wire.MsgPing
+			if err := decodeRaw(msg, &ping, wire.BaseEncoding); err != nil {
+				return nil, err
+			}
+			if err := c.send(wire.NewMsgPong(ping.Nonce)); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// handshake exchanges version and verack messages with the peer.
+func (c *Client) handshake() error {
+	me := wire.NewNetAddressIPPort(net.IPv4zero, 0, 0)
+	you := wire.NewNetAddressIPPort(net.IPv4zero, 0, 0)
+	if addr, ok := c.conn.RemoteAddr().(*net.TCPAddr); ok {
+		you = wire.NewNetAddress(addr, 0)
+	}
+	version := wire.NewMsgVersion(me, you, rand.Uint64(), 0)
+	version.UserAgent = c.cfg.UserAgent
+	version.Timestamp = time.Unix(time.Now().Unix(), 0)
+	version.DisableRelayTx = true
+	if err := c.send(version); err != nil {
+		return err
+	}
+
+	msg, err := c.receive(wire.CmdVersion)
+	if err != nil {
+		return err
+	}
+	var peerVersion wire.MsgVersion
+	if err := decodeRaw(msg, &peerVersion, wire.BaseEncoding); err != nil {
+		return err
+	}
+	c.peerServices = services.Flags(peerVersion.Services)
+	c.peerHeight = peerVersion.LastBlock
+	if !c.peerServices.Has(services.CompactFilters) {
+		return ErrNoFilterService
+	}
+	if !c.peerServices.Has(c.cfg.RequiredServices) {
+		return fmt.Errorf("%w: %v, required %v", ErrMissingServices,
+			c.peerServices, c.cfg.RequiredServices)
+	}
+
+	for _, msg := range cfmsg.HandshakeMessages(
+		peerVersion.ProtocolVersion) {
+
+		if err := c.send(msg); err != nil {
+			return err
+		}
+	}
+	if err := c.send(wire.NewMsgVerAck()); err != nil {
+		return err
+	}
+	if _, err := c.receive(wire.CmdVerAck); err != nil {
+		return err
+	}
+
+	// The client relays no transactions, so it asks the peer to announce
+	// none, and new blocks by their headers.
+	for _, msg := range cfmsg.Preferences(peerVersion.ProtocolVersion,
+		false, 0) {
+
+		if err := c.send(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SyncHeaders downloads the block headers following the synced chain until
+// the peer has no more, and returns the new tip height.
+func (c *Client) SyncHeaders() (uint32, error) {
+	for {
+		getHeaders := wire.NewMsgGetHeaders()
+		tip := c.blockHashes[len(c.blockHashes)-1]
+		getHeaders.AddBlockLocatorHash(&tip)
+		if err := c.send(getHeaders); err != nil {
+			return 0, err
+		}
+
+		msg, err := c.receive(wire.CmdHeaders)
+		if err != nil {
+			return 0, err
+		}
+		var msgHeaders wire.MsgHeaders
+		err = decodeRaw(msg, &msgHeaders, wire.BaseEncoding)
+		if err != nil {
+			return 0, err
+		}
+
+		// The headers are checked to connect to the tip before the
+		// validated chain sees them, so that it only ever extends it.
+		hashes := make([]chainhash.Hash, len(msgHeaders.Headers))
+		prev := c.blockHashes[len(c.blockHashes)-1]
+		for i, header := range msgHeaders.Headers {
+			if header.PrevBlock != prev {
+				return 0, fmt.Errorf("%w: header at height %d "+
+					"builds on %v, expected %v", ErrBadHeaders,
+					len(c.blockHashes)+i, header.PrevBlock,
+					prev)
+			}
+			hashes[i] = header.BlockHash()
+			prev = hashes[i]
+		}
+		if c.chain != nil {
+			_, err := c.chain.Connect(msgHeaders.Headers)
+			if err != nil {
+				return 0, err
+			}
+		}
+		c.blockHashes = append(c.blockHashes, hashes...)
+
+		if len(msgHeaders.Headers) < wire.MaxBlockHeadersPerMsg {
+			return c.Height(), nil
+		}
+	}
+}
+
+// SyncFilterHeaders downloads the filter headers of every block of the
+// synced header chain that doesn't have one yet, and returns the new tip
+// height of the filter header chain.
+//
+// The peer's checkpoints are fetched first and checked against the trusted
+// ones, if any. Filter headers are then requested in runs of
+// cfmsg.MaxCFHeadersPerMsg, each of which is checked to connect to the
+// previous one and to match the checkpoints within it.
+func (c *Client) SyncFilterHeaders() (int64, error) {
+	stopHash := c.blockHashes[c.Height()]
+	checkpoints, err := c.checkpoints(&stopHash)
+	if err != nil {
+		return 0, err
+	}
+
+	for c.filterHeaders.NextHeight() <= c.Height() {
+		startHeight := c.filterHeaders.NextHeight()
+		stopHeight := startHeight + cfmsg.MaxCFHeadersPerMsg - 1
+		if stopHeight > c.Height() {
+			stopHeight = c.Height()
+		}
+
+		err := c.send(&cfmsg.MsgGetCFHeaders{
+			FilterType:  c.cfg.FilterType,
+			StartHeight: startHeight,
+			StopHash:    c.blockHashes[stopHeight],
+		})
+		if err != nil {
+			return 0, err
+		}
+		msg, err := c.receive(cfmsg.CmdCFHeaders)
+		if err != nil {
+			return 0, err
+		}
+		cfHeaders := msg.(*cfmsg.MsgCFHeaders)
+
+		if cfHeaders.FilterType != c.cfg.FilterType ||
+			cfHeaders.StopHash != c.blockHashes[stopHeight] ||
+			len(cfHeaders.FilterHashes) != int(stopHeight-startHeight+1) {
+
+			return 0, fmt.Errorf("%w: cfheaders doesn't answer the "+
+				"request for heights %d-%d", ErrBadFilterHeaders,
+				startHeight, stopHeight)
+		}
+		prevHeader := c.filterHeaders.TipHeader()
+		if cfHeaders.PrevFilterHeader != prevHeader {
+			return 0, fmt.Errorf("%w: cfheaders for height %d "+
+				"builds on %v, expected %v", ErrBadFilterHeaders,
+				startHeight, cfHeaders.PrevFilterHeader, prevHeader)
+		}
+
+		headers, err := builder.VerifyCFHeaders(checkpoints,
+			startHeight, prevHeader, cfHeaders.FilterHashes)
+
+		// A run after the last checkpoint isn't anchored by one, but
+		// it builds on the header we verified last, which is as much
+		// as a client with a single peer can check.
+		if errors.Is(err, builder.ErrNotAnchored) && startHeight > 0 {
+			headers = builder.HeadersFromHashes(prevHeader,
+				cfHeaders.FilterHashes)
+			err = nil
+		}
+		if err != nil {
+			return 0, fmt.Errorf("%w: %v", ErrBadFilterHeaders, err)
+		}
+		for _, header := range headers {
+			c.filterHeaders.AppendHeader(header)
+		}
+		c.filterHashes = append(c.filterHashes,
+			cfHeaders.FilterHashes...)
+	}
+
+	return c.FilterHeight(), nil
+}
+
+// checkpoints fetches the peer's filter header checkpoints up to the block
+// with the passed hash and checks them against the trusted ones.
+func (c *Client) checkpoints(stopHash *chainhash.Hash) ([]chainhash.Hash,
+	error) {
+
+	err := c.send(&cfmsg.MsgGetCFCheckpt{
+		FilterType: c.cfg.FilterType,
+		StopHash:   *stopHash,
+	})
+	if err != nil {
+		return nil, err
+	}
+	msg, err := c.receive(cfmsg.CmdCFCheckpt)
+	if err != nil {
+		return nil, err
+	}
+	checkpt := msg.(*cfmsg.MsgCFCheckpt)
+
+	expected := int(c.Height() / cfmsg.CFCheckptInterval)
+	if checkpt.FilterType != c.cfg.FilterType ||
+		checkpt.StopHash != *stopHash ||
+		len(checkpt.FilterHeaders) != expected {
+
+		return nil, fmt.Errorf("%w: cfcheckpt has %d headers, "+
+			"expected %d", ErrBadFilterHeaders,
+			len(checkpt.FilterHeaders), expected)
+	}
+
+	for i, trusted := range c.cfg.Checkpoints {
+		if i == len(checkpt.FilterHeaders) {
+			break
+		}
+		if checkpt.FilterHeaders[i] != trusted {
+			return nil, fmt.Errorf("%w: peer's checkpoint at "+
+				"height %d is %v, expected %v",
+				builder.ErrCheckpointMismatch,
+				(i+1)*cfmsg.CFCheckptInterval,
+				checkpt.FilterHeaders[i], trusted)
+		}
+	}
+
+	return checkpt.FilterHeaders, nil
+}
+
+// Filter returns the filter of the block at the passed height along with the
+// block's hash, fetching it and the filters following it from the peer if
+// they aren't at hand. It implements rescan.FilterSource.
+func (c *Client) Filter(height uint32) (*gcs.Filter, *chainhash.Hash, error) {
+	if int64(height) > c.FilterHeight() {
+		return nil, nil, ErrNotSynced
+	}
+
+	filter, ok := c.filters[height]
+	if !ok {
+		if err := c.fetchFilters(height); err != nil {
+			return nil, nil, err
+		}
+		filter = c.filters[height]
+	}
+
+	return filter, &c.blockHashes[height], nil
+}
+
+// fetchFilters replaces the filters at hand with the batch starting at the
+// passed height, checking each against its filter hash.
+func (c *Client) fetchFilters(startHeight uint32) error {
+	stopHeight := startHeight + cfmsg.MaxGetCFiltersRange - 1
+	if int64(stopHeight) > c.FilterHeight() {
+		stopHeight = uint32(c.FilterHeight())
+	}
+
+	err := c.send(&cfmsg.MsgGetCFilters{
+		FilterType:  c.cfg.FilterType,
+		StartHeight: startHeight,
+		StopHash:    c.blockHashes[stopHeight],
+	})
+	if err != nil {
+		return err
+	}
+
+	c.filters = make(map[uint32]*gcs.Filter, stopHeight-startHeight+1)
+	for height := startHeight; height <= stopHeight; height++ {
+		msg, err := c.receive(cfmsg.CmdCFilter)
+		if err != nil {
+			return err
+		}
+		cfilter := msg.(*cfmsg.MsgCFilter)
+
+		if cfilter.FilterType != c.cfg.FilterType ||
+			cfilter.BlockHash != c.blockHashes[height] {
+
+			return fmt.Errorf("%w: got filter for block %v at "+
+				"height %d", ErrBadFilter, cfilter.BlockHash,
+				height)
+		}
+		if chainhash.DoubleHashH(cfilter.Filter) != c.filterHashes[height] {
+			return fmt.Errorf("%w: block %v", ErrBadFilter,
+				cfilter.BlockHash)
+		}
+
+		filter, err := gcs.FromNBytes(c.cfg.P, cfilter.Filter)
+		if err != nil {
+			return fmt.Errorf("%w: block %v: %v", ErrBadFilter,
+				cfilter.BlockHash, err)
+		}
+		c.filters[height] = filter
+	}
+
+	return nil
+}
+
+// GetBlock fetches the block with the passed hash from the peer. It
+// implements rescan.BlockSource.
+func (c *Client) GetBlock(blockHash *chainhash.Hash) (*wire.MsgBlock, error) {
+	getData := wire.NewMsgGetData()
+	err := getData.AddInvVect(wire.NewInvVect(wire.InvTypeWitnessBlock,
+		blockHash))
+	if err != nil {
+		return nil, err
+	}
+	if err := c.send(getData); err != nil {
+		return nil, err
+	}
+
+	msg, err := c.receive(wire.CmdBlock)
+	if err != nil {
+		return nil, err
+	}
+	var block wire.MsgBlock
+	if err := decodeRaw(msg, &block, wire.WitnessEncoding); err != nil {
+		return nil, err
+	}
+	if block.BlockHash() != *blockHash {
+		return nil, fmt.Errorf("lightclient: got block %v, requested %v",
+			block.BlockHash(), blockHash)
+	}
+
+	return &block, nil
+}
+
+// GetBlocks fetches the blocks with the passed hashes from the peer with a
+// single getdata message, which the peer answers with the blocks in order.
+// It implements rescan.BatchBlockSource.
+func (c *Client) GetBlocks(blockHashes []chainhash.Hash) ([]*wire.MsgBlock,
+	error) {
+
+	getData := wire.NewMsgGetData()
+	for i := range blockHashes {
+		err := getData.AddInvVect(wire.NewInvVect(
+			wire.InvTypeWitnessBlock, &blockHashes[i]))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := c.send(getData); err != nil {
+		return nil, err
+	}
+
+	blocks := make([]*wire.MsgBlock, len(blockHashes))
+	for i := range blocks {
+		msg, err := c.receive(wire.CmdBlock)
+		if err != nil {
+			return nil, err
+		}
+		var block wire.MsgBlock
+		err = decodeRaw(msg, &block, wire.WitnessEncoding)
+		if err != nil {
+			return nil, err
+		}
+		if block.BlockHash() != blockHashes[i] {
+			return nil, fmt.Errorf("lightclient: got block %v, "+
+				"requested %v", block.BlockHash(),
+				blockHashes[i])
+		}
+		blocks[i] = &block
+	}
+
+	return blocks, nil
+}
+
+// MatchBlocks walks the filters from startHeight to the tip of the filter
+// header chain and returns the blocks whose filters match any of the passed
+// filter entries, such as output scripts or serialized outpoints. Matches
+// include false positives at the rate set by P.
+func (c *Client) MatchBlocks(startHeight uint32,
+	entries [][]byte) ([]Match, error) {
+
+	var matches []Match
+	matcher := gcs.NewMatcher(len(entries))
+	for height := startHeight; int64(height) <= c.FilterHeight(); height++ {
+		filter, blockHash, err := c.Filter(height)
+		if err != nil {
+			return nil, err
+		}
+
+		match, err := matcher.MatchAny(filter,
+			builder.DeriveKey(blockHash), entries)
+		if err != nil {
+			return nil, err
+		}
+		if match {
+			matches = append(matches, Match{
+				Height:    height,
+				BlockHash: *blockHash,
+			})
+		}
+	}
+
+	return matches, nil
+}
+
+// RescanConfig returns the configuration of a rescan of the synced filters
+// from startHeight onwards, without a watch list, for callers that watch
+// descriptors or set other fields before passing it to rescan.New. Blocks
+// whose filters match are fetched from blocks, or from the peer if it is
+// nil. The client must not be used while the rescan runs.
+func (c *Client) RescanConfig(startHeight uint32,
+	blocks rescan.BlockSource) *rescan.Config {
+
+	if blocks == nil {
+		blocks = c
+	}
+	endHeight := uint32(0)
+	if c.FilterHeight() >= 0 {
+		endHeight = uint32(c.FilterHeight())
+	}
+
+	return &rescan.Config{
+		Filters:     c,
+		Blocks:      blocks,
+		StartHeight: startHeight,
+		EndHeight:   endHeight,
+	}
+}
+
+// Rescan returns a rescan, not yet started, of the synced filters from
+// startHeight onwards for the passed watch list, configured as RescanConfig
+// does.
+func (c *Client) Rescan(startHeight uint32, blocks rescan.BlockSource,
+	watchScripts [][]byte, watchOutPoints []wire.OutPoint) *rescan.Rescan {
+
+	cfg := c.RescanConfig(startHeight, blocks)
+	cfg.WatchScripts = watchScripts
+	cfg.WatchOutPoints = watchOutPoints
+	return rescan.New(cfg)
+}
+
+// decodeRaw decodes the payload of a message the cfmsg package doesn't know
+// into the passed wire message, which must have the same command.
+func decodeRaw(msg wire.Message, into wire.Message,
+	enc wire.MessageEncoding) error {
+
+	raw, ok := msg.(*cfmsg.RawMessage)
+	if !ok || raw.Cmd != into.Command() {
+		return fmt.Errorf("lightclient: expected %v message, got %v",
+			into.Command(), msg.Command())
+	}
+
+	// Some messages, such as version, can only be decoded from a
+	// bytes.Buffer.
+	return into.BtcDecode(bytes.NewBuffer(raw.Payload),
+		wire.ProtocolVersion, enc)
+}
@@ -0,0 +1,291 @@
+package lightclient_test
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/christsim/bips/bip-0158/backend/chainhash"
+	"github.com/christsim/bips/bip-0158/backend/wire"
+	"github.com/christsim/bips/bip-0158/blockgen"
+	"github.com/christsim/bips/bip-0158/cfmsg"
+	"github.com/christsim/bips/bip-0158/cfserver"
+	"github.com/christsim/bips/bip-0158/filterdb"
+	"github.com/christsim/bips/bip-0158/gcs/builder"
+	"github.com/christsim/bips/bip-0158/lightclient"
+	"github.com/christsim/bips/bip-0158/services"
+)
+
+// testBlocks is the length of the chain served, which takes more than one
+// message to sync both the block and the filter headers of, and spans two
+// checkpoints.
+const testBlocks = 2*cfmsg.CFCheckptInterval + 100
+
+// testNet is the network the messages of the tests are framed for.
+const testNet = wire.TestNet3
+
+// testChain is a chain of random blocks whose basic filters are served by a
+// cfserver.Server.
+type testChain struct {
+	blocks  map[chainhash.Hash]*wire.MsgBlock
+	hashes  []chainhash.Hash
+	filters *builder.FilterHeaderChain
+
+	// watchHeight is the height of the block paying to watchScript, a
+	// P2WPKH script that appears nowhere else in the chain.
+	watchHeight uint32
+	watchScript []byte
+}
+
+// GetBlockHeader returns the header of the block with the passed hash.
+func (c *testChain) GetBlockHeader(blockHash *chainhash.Hash) (
+	*wire.BlockHeader, error) {
+
+	block, err := c.GetBlock(blockHash)
+	if err != nil {
+		return nil, err
+	}
+	return &block.Header, nil
+}
+
+// GetBlock returns the block with the passed hash.
+func (c *testChain) GetBlock(blockHash *chainhash.Hash) (*wire.MsgBlock,
+	error) {
+
+	block, ok := c.blocks[*blockHash]
+	if !ok {
+		return nil, fmt.Errorf("no block %v", blockHash)
+	}
+	return block, nil
+}
+
+// p2wpkh returns the first P2WPKH output script of the block, if any.
+func p2wpkh(block *wire.MsgBlock) []byte {
+	for _, tx := range block.Transactions {
+		for _, txOut := range tx.TxOut {
+			script := txOut.PkScript
+			if len(script) == 22 && script[0] == 0x00 &&
+				script[1] == 0x14 {
+
+				return script
+			}
+		}
+	}
+	return nil
+}
+
+// newTestChain generates testBlocks blocks and serves their filters from a
+// server listening on the loopback interface, whose address it returns.
+func newTestChain(t *testing.T) (*testChain, string) {
+	t.Helper()
+
+	db, err := filterdb.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	c := &testChain{
+		blocks:  make(map[chainhash.Hash]*wire.MsgBlock),
+		filters: builder.NewFilterHeaderChain(0),
+	}
+	cfg := blockgen.DefaultConfig
+	cfg.MaxTxs = 3
+	gen := blockgen.New(1, cfg)
+	batch := db.NewBatch()
+	for height := uint32(0); height < testBlocks; height++ {
+		block := gen.Block()
+		filter, err := builder.BuildFilter(builder.BasicPolicy{
+			ScriptTypes: builder.AllScriptTypes,
+		}, block, builder.DefaultP)
+		if err != nil {
+			t.Fatal(err)
+		}
+		header, err := c.filters.Append(filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		blockHash := block.BlockHash()
+		c.hashes = append(c.hashes, blockHash)
+		c.blocks[blockHash] = block
+		if c.watchScript == nil && height >= testBlocks/2 {
+			c.watchHeight = height
+			c.watchScript = p2wpkh(block)
+		}
+		err = batch.PutFilter(&filterdb.Entry{
+			Height:     height,
+			BlockHash:  blockHash,
+			FilterType: wire.GCSFilterRegular,
+			Filter:     filter,
+			Header:     header,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.WriteBatch(batch); err != nil {
+		t.Fatal(err)
+	}
+	if c.watchScript == nil {
+		t.Fatal("no block pays to a P2WPKH script")
+	}
+
+	s := cfserver.New(cfserver.Config{
+		Store:       db,
+		Net:         testNet,
+		FilterTypes: []wire.FilterType{wire.GCSFilterRegular},
+		Headers:     c,
+	})
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(l)
+	t.Cleanup(func() { s.Close() })
+
+	return c, l.Addr().String()
+}
+
+// header returns the filter header of the block at the passed height.
+func (c *testChain) header(t *testing.T, height uint32) chainhash.Hash {
+	t.Helper()
+
+	header, err := c.filters.Header(height)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return header
+}
+
+// TestClient syncs clients configured in various ways against a server, and
+// matches and rescans the synced filters for a script paid to once.
+func TestClient(t *testing.T) {
+	c, addr := newTestChain(t)
+	tip := uint32(testBlocks - 1)
+
+	tests := []struct {
+		name    string
+		cfg     lightclient.Config
+		dialErr error
+		syncErr error
+	}{{
+		name: "default",
+	}, {
+		name: "trusted checkpoints",
+		cfg: lightclient.Config{
+			Checkpoints: []chainhash.Hash{
+				c.header(t, cfmsg.CFCheckptInterval),
+				c.header(t, 2*cfmsg.CFCheckptInterval),
+			},
+		},
+	}, {
+		name: "mismatching checkpoint",
+		cfg: lightclient.Config{
+			Checkpoints: []chainhash.Hash{
+				c.header(t, cfmsg.CFCheckptInterval),
+				c.header(t, cfmsg.CFCheckptInterval),
+			},
+		},
+		syncErr: builder.ErrCheckpointMismatch,
+	}, {
+		name: "missing services",
+		cfg: lightclient.Config{
+			RequiredServices: services.CompactFilters |
+				services.Network,
+		},
+		dialErr: lightclient.ErrMissingServices,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := test.cfg
+			cfg.Net = testNet
+			cfg.GenesisHash = c.hashes[0]
+			client, err := lightclient.Dial(addr, cfg)
+			if !errors.Is(err, test.dialErr) {
+				t.Fatalf("dial: got error %v, want %v", err,
+					test.dialErr)
+			}
+			if err != nil {
+				return
+			}
+			defer client.Close()
+
+			height, err := client.SyncHeaders()
+			if err != nil || height != tip {
+				t.Fatalf("synced headers to %d, %v, want %d",
+					height, err, tip)
+			}
+			filterHeight, err := client.SyncFilterHeaders()
+			if !errors.Is(err, test.syncErr) {
+				t.Fatalf("sync: got error %v, want %v", err,
+					test.syncErr)
+			}
+			if err != nil {
+				return
+			}
+			if filterHeight != int64(tip) {
+				t.Fatalf("synced filter headers to %d, want %d",
+					filterHeight, tip)
+			}
+
+			for _, height := range []uint32{0, 1000, tip} {
+				header, err := client.FilterHeader(height)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if want := c.header(t, height); header != want {
+					t.Fatalf("height %d: filter header %v, "+
+						"want %v", height, header, want)
+				}
+			}
+			if _, err := client.BlockHash(tip + 1); err !=
+				lightclient.ErrNotSynced {
+
+				t.Fatalf("block hash past tip: got error %v", err)
+			}
+			if _, err := client.FilterHeader(tip + 1); err !=
+				lightclient.ErrNotSynced {
+
+				t.Fatalf("filter header past tip: got error %v",
+					err)
+			}
+			if _, _, err := client.Filter(tip + 1); err !=
+				lightclient.ErrNotSynced {
+
+				t.Fatalf("filter past tip: got error %v", err)
+			}
+
+			matches, err := client.MatchBlocks(c.watchHeight-10,
+				[][]byte{c.watchScript})
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := []lightclient.Match{{
+				Height:    c.watchHeight,
+				BlockHash: c.hashes[c.watchHeight],
+			}}
+			if !reflect.DeepEqual(matches, want) {
+				t.Fatalf("matched %v, want %v", matches, want)
+			}
+
+			r := client.Rescan(c.watchHeight-10, c,
+				[][]byte{c.watchScript}, nil)
+			r.Start()
+			var heights []uint32
+			for tx := range r.Transactions() {
+				heights = append(heights, tx.Height)
+			}
+			if err := r.Err(); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(heights, []uint32{c.watchHeight}) {
+				t.Fatalf("rescan found transactions at %v, "+
+					"want %d", heights, c.watchHeight)
+			}
+		})
+	}
+}
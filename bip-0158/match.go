@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"math/rand"
+
+	"github.com/christsim/bips/bip-0158/backend/wire"
+	"github.com/christsim/bips/bip-0158/gcs"
+	"github.com/christsim/bips/bip-0158/gcs/builder"
+)
+
+// matchColumns is the header row of the match vector files.
+const matchColumns = "Block Height,Block Hash,Filter Type,Filter,Matching " +
+	"Elements,Non-Matching Elements,Notes"
+
+const (
+	// matchNegatives is the number of elements that must not match each
+	// filter.
+	matchNegatives = 20
+
+	// maxNegativeAttempts bounds the number of random elements tried when
+	// looking for ones that don't match, which for small values of P
+	// most do.
+	maxNegativeAttempts = 100 * matchNegatives
+)
+
+// matchCase returns a match vector for the filter of the block: every element
+// the policy put in the filter, all of which must match, and random P2WPKH
+// scripts that happen not to, all of which must not. The random scripts are
+// drawn from a generator seeded with the block hash and P, so the vectors are
+// reproducible. Implementations can also check that MatchAny returns false
+// for the non-matching elements and true once any matching one is added.
+func matchCase(policy builder.FilterPolicy, height uint32,
+	block *wire.MsgBlock, filter *gcs.Filter,
+	notes string) ([]interface{}, error) {
+
+	blockHash := block.BlockHash()
+	nBytes, err := filter.NBytes()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := policyEntries(policy, block, filter.P())
+	if err != nil {
+		return nil, err
+	}
+	matching := make([]string, len(entries))
+	for i, entry := range entries {
+		matching[i] = hex.EncodeToString(entry)
+	}
+
+	seed := int64(binary.LittleEndian.Uint64(blockHash[:8])) ^
+		int64(filter.P())
+	rng := rand.New(rand.NewSource(seed))
+	key := builder.DeriveKey(&blockHash)
+	nonMatching := make([]string, 0, matchNegatives)
+	for i := 0; i < maxNegativeAttempts &&
+		len(nonMatching) < matchNegatives; i++ {
+
+		script := make([]byte, 22)
+		script[1] = 20
+		rng.Read(script[2:])
+
+		match, err := filter.Match(key, script)
+		if err != nil {
+			return nil, err
+		}
+		if !match {
+			nonMatching = append(nonMatching,
+				hex.EncodeToString(script))
+		}
+	}
+
+	return []interface{}{
+		height,
+		blockHash.String(),
+		policy.Name(),
+		hex.EncodeToString(nBytes),
+		matching,
+		nonMatching,
+		notes,
+	}, nil
+}
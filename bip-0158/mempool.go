@@ -0,0 +1,93 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/christsim/bips/bip-0158/backend"
+	"github.com/christsim/bips/bip-0158/backend/chainhash"
+	"github.com/christsim/bips/bip-0158/gcs/builder"
+	"github.com/christsim/bips/bip-0158/mempool"
+)
+
+// runMempool implements the experimental mempool subcommand, which follows
+// the local btcd's mempool and serves a filter of its transactions over
+// HTTP. btcd has no ZMQ interface, so new transactions are learned of
+// through its websocket notifications, or only by polling with -notify=false.
+func runMempool(args []string) error {
+	fs := flag.NewFlagSet("mempool", flag.ContinueOnError)
+	listen := fs.String("listen", "127.0.0.1:18158", "address to serve "+
+		"the filter on")
+	p := fs.Uint("p", builder.DefaultP, "Golomb-Rice parameter of the "+
+		"filter")
+	interval := fs.Duration("interval", mempool.DefaultResyncInterval,
+		"how often to resync with the node's mempool")
+	notify := fs.Bool("notify", true, "fetch transactions as the node "+
+		"notifies them, rather than only on resync")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *p == 0 || *p > 32 {
+		return fmt.Errorf("invalid P %d", *p)
+	}
+	if *interval <= 0 {
+		return fmt.Errorf("invalid interval %v", *interval)
+	}
+
+	cfg, err := rpcConfig()
+	if err != nil {
+		return err
+	}
+
+	// The follower needs the client to be created, and the client the
+	// follower's callback, so notifications are only forwarded once both
+	// are. Those that arrive before are dropped, but the follower's
+	// initial sync lists their transactions.
+	var follower *mempool.Follower
+	ready := make(chan struct{})
+	if *notify {
+		cfg.OnTxAccepted = func(txHash *chainhash.Hash) {
+			select {
+			case <-ready:
+				follower.TxAccepted(txHash)
+			default:
+			}
+		}
+	}
+	client, err := dialRPC(cfg)
+	if err != nil {
+		return err
+	}
+	defer client.Shutdown()
+	mempoolClient, ok := client.(backend.MempoolClient)
+	if !ok {
+		return fmt.Errorf("RPC client can't read the mempool")
+	}
+
+	pool := mempool.New(uint8(*p))
+	follower = mempool.NewFollower(pool, mempoolClient, *interval)
+	close(ready)
+	if err := follower.Start(); err != nil {
+		return fmt.Errorf("couldn't read the mempool: %v", err)
+	}
+	defer follower.Stop()
+
+	l, err := net.Listen("tcp", *listen)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Serving the filter of %d mempool "+
+		"transactions on http://%v/filter\n", pool.Len(), l.Addr())
+
+	mux := http.NewServeMux()
+	mux.Handle("/filter", mempool.NewHandler(pool))
+	server := &http.Server{
+		Handler:     mux,
+		ReadTimeout: 10 * time.Second,
+	}
+	return server.Serve(l)
+}
@@ -0,0 +1,163 @@
+package mempool
+
+import (
+	"sync"
+	"time"
+
+	"github.com/christsim/bips/bip-0158/backend"
+	"github.com/christsim/bips/bip-0158/backend/chainhash"
+)
+
+// DefaultResyncInterval is how often a follower resyncs its pool with the
+// node's mempool when NewFollower is passed no interval.
+const DefaultResyncInterval = 30 * time.Second
+
+// notifyQueueSize is the number of notified transactions a follower queues
+// before dropping further ones, which the next resync picks up instead.
+const notifyQueueSize = 1024
+
+// Sync brings the pool in line with the node's mempool: transactions the
+// node no longer has are removed and those the pool lacks are fetched. A
+// transaction that leaves the mempool between being listed and fetched is
+// skipped, so only failing to list the mempool is an error.
+func (m *Pool) Sync(client backend.MempoolClient) error {
+	txHashes, err := client.GetRawMempool()
+	if err != nil {
+		return err
+	}
+
+	current := make(map[chainhash.Hash]struct{}, len(txHashes))
+	for _, txHash := range txHashes {
+		current[*txHash] = struct{}{}
+	}
+
+	m.mtx.Lock()
+	var stale []chainhash.Hash
+	for txHash := range m.txs {
+		if _, ok := current[txHash]; !ok {
+			stale = append(stale, txHash)
+		}
+	}
+	m.mtx.Unlock()
+
+	for i := range stale {
+		m.Remove(&stale[i])
+	}
+	for _, txHash := range txHashes {
+		if m.Has(txHash) {
+			continue
+		}
+		tx, err := client.GetRawTransaction(txHash)
+		if err != nil {
+			continue
+		}
+		m.Add(tx.MsgTx())
+	}
+
+	return nil
+}
+
+// Follower keeps a pool in step with a node's mempool. Transactions the node
+// notifies it of are fetched as they arrive, and the pool is resynced
+// periodically to drop the transactions that were confirmed or evicted,
+// which the node doesn't notify.
+type Follower struct {
+	pool     *Pool
+	client   backend.MempoolClient
+	interval time.Duration
+
+	notified chan chainhash.Hash
+	quit     chan struct{}
+	wg       sync.WaitGroup
+
+	mtx sync.Mutex
+	err error
+}
+
+// NewFollower returns a follower keeping the pool in step with the mempool
+// of the node the client is connected to, resyncing every interval. Zero
+// means DefaultResyncInterval. The follower is started by calling Start.
+func NewFollower(pool *Pool, client backend.MempoolClient,
+	interval time.Duration) *Follower {
+
+	if interval == 0 {
+		interval = DefaultResyncInterval
+	}
+	return &Follower{
+		pool:     pool,
+		client:   client,
+		interval: interval,
+		notified: make(chan chainhash.Hash, notifyQueueSize),
+		quit:     make(chan struct{}),
+	}
+}
+
+// TxAccepted queues the transaction with the passed hash to be added to the
+// pool. It never blocks, so it can be set as the OnTxAccepted callback of
+// backend.RPCConfig; if the queue is full, the transaction is left for the
+// next resync.
+func (f *Follower) TxAccepted(txHash *chainhash.Hash) {
+	select {
+	case f.notified <- *txHash:
+	default:
+	}
+}
+
+// Start syncs the pool with the node's mempool, then launches the goroutine
+// that follows it. The initial sync failing is returned, and the follower
+// isn't started.
+func (f *Follower) Start() error {
+	if err := f.pool.Sync(f.client); err != nil {
+		return err
+	}
+
+	f.wg.Add(1)
+	go f.follow()
+	return nil
+}
+
+// Stop stops following the node and waits for the follower to exit.
+func (f *Follower) Stop() {
+	close(f.quit)
+	f.wg.Wait()
+}
+
+// Err returns the error the last resync failed with, or nil if it succeeded.
+func (f *Follower) Err() error {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	return f.err
+}
+
+// follow adds notified transactions and resyncs the pool until the follower
+// is stopped. It must be run as a goroutine.
+func (f *Follower) follow() {
+	defer f.wg.Done()
+
+	ticker := time.NewTicker(f.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case txHash := <-f.notified:
+			if f.pool.Has(&txHash) {
+				continue
+			}
+			tx, err := f.client.GetRawTransaction(&txHash)
+			if err != nil {
+				continue
+			}
+			f.pool.Add(tx.MsgTx())
+
+		case <-ticker.C:
+			err := f.pool.Sync(f.client)
+			f.mtx.Lock()
+			f.err = err
+			f.mtx.Unlock()
+
+		case <-f.quit:
+			return
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package mempool
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// filterResponse is the JSON body Handler serves.
+type filterResponse struct {
+	// StateHash and Key are hex encoded, the state hash in the byte
+	// order hashes are displayed in.
+	StateHash string `json:"state_hash"`
+	Key       string `json:"key"`
+
+	P uint8  `json:"p"`
+	N uint32 `json:"n"`
+
+	// Filter is the hex encoded filter, N prefix included, as a cfilter
+	// message carries it.
+	Filter string `json:"filter"`
+
+	Txs  int       `json:"txs"`
+	Time time.Time `json:"time"`
+}
+
+// Handler serves the current filter of the pool as JSON to GET requests.
+type Handler struct {
+	pool *Pool
+}
+
+// NewHandler returns a handler serving the filter of the pool.
+func NewHandler(pool *Pool) *Handler {
+	return &Handler{pool: pool}
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s, err := h.pool.Snapshot()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	nBytes, err := s.Filter.NBytes()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp := filterResponse{
+		StateHash: s.StateHash.String(),
+		Key:       hex.EncodeToString(s.Key[:]),
+		P:         s.Filter.P(),
+		N:         s.Filter.N(),
+		Filter:    hex.EncodeToString(nBytes),
+		Txs:       s.Txs,
+		Time:      s.Time.UTC(),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", `"`+resp.StateHash+`"`)
+	json.NewEncoder(w).Encode(&resp)
+}
@@ -0,0 +1,173 @@
+// Package mempool builds a GCS filter over the transactions of a node's
+// mempool, so that a light client can check whether an unconfirmed payment
+// likely concerns it before downloading the mempool. This is an experiment:
+// no BIP defines mempool filters, and peers don't serve them.
+//
+// A Pool holds the transactions and builds the filter of what it holds on
+// demand. Each filter holds the elements the basic filter holds for a block:
+// the hash of each transaction, the outpoints it spends and its output
+// scripts. It is keyed by the hash of the set of transactions it covers,
+// which changes with every transaction in or out, so the key is served along
+// with the filter. A Follower keeps a pool in step with a node, adding the
+// transactions the node notifies it of as they arrive and resyncing with the
+// node's mempool periodically, which also drops those confirmed or evicted.
+// Handler serves the filter over HTTP.
+package mempool
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/christsim/bips/bip-0158/backend/chainhash"
+	"github.com/christsim/bips/bip-0158/backend/wire"
+	"github.com/christsim/bips/bip-0158/gcs"
+	"github.com/christsim/bips/bip-0158/gcs/builder"
+)
+
+// Snapshot is the filter of the transactions of a pool at one moment.
+type Snapshot struct {
+	// Filter is the filter of the transactions.
+	Filter *gcs.Filter
+
+	// StateHash commits to the transactions the filter covers: it is the
+	// double SHA-256 of their hashes, sorted bytewise and concatenated.
+	StateHash chainhash.Hash
+
+	// Key is the key the filter is keyed with, derived from StateHash as
+	// the key of a block's filter is from the block hash.
+	Key [gcs.KeySize]byte
+
+	// Txs is the number of transactions the filter covers.
+	Txs int
+
+	// Time is when the pool last changed before the filter was built.
+	Time time.Time
+}
+
+// Pool is a set of mempool transactions along with their filter. It is safe
+// for concurrent use.
+type Pool struct {
+	p uint8
+
+	mtx      sync.Mutex
+	txs      map[chainhash.Hash]*wire.MsgTx
+	modified time.Time
+
+	// snapshot is the filter of the current transactions, or nil if they
+	// changed since it was last built.
+	snapshot *Snapshot
+}
+
+// New returns an empty pool whose filters are built with the Golomb-Rice
+// parameter p. Zero means builder.DefaultP.
+func New(p uint8) *Pool {
+	if p == 0 {
+		p = builder.DefaultP
+	}
+	return &Pool{
+		p:        p,
+		txs:      make(map[chainhash.Hash]*wire.MsgTx),
+		modified: time.Now(),
+	}
+}
+
+// Add adds a transaction to the pool.
+func (m *Pool) Add(tx *wire.MsgTx) {
+	txHash := tx.TxHash()
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	if _, ok := m.txs[txHash]; ok {
+		return
+	}
+	m.txs[txHash] = tx
+	m.changed()
+}
+
+// Remove removes the transaction with the passed hash from the pool.
+func (m *Pool) Remove(txHash *chainhash.Hash) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	if _, ok := m.txs[*txHash]; !ok {
+		return
+	}
+	delete(m.txs, *txHash)
+	m.changed()
+}
+
+// Has reports whether the transaction with the passed hash is in the pool.
+func (m *Pool) Has(txHash *chainhash.Hash) bool {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	_, ok := m.txs[*txHash]
+	return ok
+}
+
+// Len returns the number of transactions in the pool.
+func (m *Pool) Len() int {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	return len(m.txs)
+}
+
+// changed marks the snapshot stale. The mutex must be held.
+func (m *Pool) changed() {
+	m.snapshot = nil
+	m.modified = time.Now()
+}
+
+// Snapshot returns the filter of the transactions currently in the pool. It
+// is only rebuilt once the pool changes.
+func (m *Pool) Snapshot() (*Snapshot, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	if m.snapshot != nil {
+		return m.snapshot, nil
+	}
+
+	txHashes := make([]chainhash.Hash, 0, len(m.txs))
+	for txHash := range m.txs {
+		txHashes = append(txHashes, txHash)
+	}
+	sort.Slice(txHashes, func(i, j int) bool {
+		return bytes.Compare(txHashes[i][:], txHashes[j][:]) < 0
+	})
+	state := make([]byte, 0, len(txHashes)*chainhash.HashSize)
+	for i := range txHashes {
+		state = append(state, txHashes[i][:]...)
+	}
+
+	s := &Snapshot{
+		StateHash: chainhash.DoubleHashH(state),
+		Txs:       len(txHashes),
+		Time:      m.modified,
+	}
+	s.Key = builder.DeriveKey(&s.StateHash)
+
+	b := builder.WithKeyP(s.Key, m.p)
+	for i := range txHashes {
+		tx := m.txs[txHashes[i]]
+		b.AddHash(&txHashes[i])
+		for _, txIn := range tx.TxIn {
+			b.AddOutPoint(txIn.PreviousOutPoint)
+		}
+		for _, txOut := range tx.TxOut {
+			b.AddOutputScript(txOut.PkScript)
+		}
+	}
+	filter, err := b.Build()
+	if err != nil {
+		return nil, err
+	}
+	s.Filter = filter
+
+	m.snapshot = s
+	return s, nil
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/christsim/bips/bip-0158/backend/chaincfg"
+	"github.com/christsim/bips/bip-0158/backend/chainhash"
+	"github.com/christsim/bips/bip-0158/backend/wire"
+	"github.com/christsim/bips/bip-0158/cfmsg"
+	"github.com/christsim/bips/bip-0158/conformance"
+	"github.com/christsim/bips/bip-0158/gcs/builder"
+)
+
+// messageColumns is the header row of the message vector file.
+const messageColumns = "Command,Description,Payload,Message"
+
+// messageCase is a message along with a description of it.
+type messageCase struct {
+	msg  wire.Message
+	desc string
+}
+
+// runMessages implements the messages subcommand, which turns the filters
+// and headers of previously generated vectors into BIP 157 network messages
+// and writes their payloads, and the complete testnet3 messages, as vectors
+// for implementations of the protocol. Each block's transactions are also
+// announced in inv messages by txid and by wtxid, in the same order, so the
+// two pair up. They are followed by the control messages light clients
+// exchange with their peers.
+func runMessages(args []string) error {
+	fs := flag.NewFlagSet("messages", flag.ContinueOnError)
+	vectorsDir := fs.String("vectors", "gcstestvectors", "directory of test "+
+		"vectors to derive the messages from")
+	p := fs.Uint("p", builder.DefaultP, "value of P whose vectors to use")
+	out := fs.String("out", "messages.json", "file to write the message "+
+		"vectors to")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cases, err := conformance.LoadVectors(*vectorsDir)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := NewJSONTestWriter(file)
+	if err := writer.WriteComment(messageColumns); err != nil {
+		return err
+	}
+	write := func(msg wire.Message, description string) error {
+		var payload, framed bytes.Buffer
+		err := msg.BtcEncode(&payload, wire.ProtocolVersion,
+			wire.BaseEncoding)
+		if err != nil {
+			return err
+		}
+		err = cfmsg.WriteMessage(&framed, msg, chaincfg.TestNet3Params.Net)
+		if err != nil {
+			return err
+		}
+		return writer.WriteTestCase([]interface{}{
+			msg.Command(),
+			description,
+			hex.EncodeToString(payload.Bytes()),
+			hex.EncodeToString(framed.Bytes()),
+		})
+	}
+
+	count := 0
+	for _, c := range cases {
+		if c.P != uint8(*p) {
+			continue
+		}
+
+		invs, err := txInvCases(c)
+		if err != nil {
+			return err
+		}
+		for _, m := range invs {
+			if err := write(m.msg, m.desc); err != nil {
+				return err
+			}
+			count++
+		}
+
+		for _, f := range c.Filters {
+			filterType, ok := indexedTypes[f.Type]
+			if !ok {
+				continue
+			}
+			desc := fmt.Sprintf("%v filter of block %d", f.Type,
+				c.Height)
+
+			msgs := []messageCase{
+				{&cfmsg.MsgGetCFilters{
+					FilterType:  filterType,
+					StartHeight: c.Height,
+					StopHash:    c.BlockHash,
+				}, "Request for the " + desc},
+				{&cfmsg.MsgCFilter{
+					FilterType: filterType,
+					BlockHash:  c.BlockHash,
+					Filter:     f.Filter,
+				}, "The " + desc},
+				{&cfmsg.MsgGetCFHeaders{
+					FilterType:  filterType,
+					StartHeight: c.Height,
+					StopHash:    c.BlockHash,
+				}, "Request for the header of the " + desc},
+				{&cfmsg.MsgCFHeaders{
+					FilterType:       filterType,
+					StopHash:         c.BlockHash,
+					PrevFilterHeader: f.PrevHeader,
+					FilterHashes: []chainhash.Hash{
+						chainhash.DoubleHashH(f.Filter),
+					},
+				}, "The header of the " + desc},
+			}
+			if c.Height < cfmsg.CFCheckptInterval {
+				msgs = append(msgs, messageCase{
+					&cfmsg.MsgGetCFCheckpt{
+						FilterType: filterType,
+						StopHash:   c.BlockHash,
+					},
+					"Request for checkpoints up to the " + desc,
+				}, messageCase{
+					&cfmsg.MsgCFCheckpt{
+						FilterType:    filterType,
+						StopHash:      c.BlockHash,
+						FilterHeaders: []chainhash.Hash{},
+					},
+					"No checkpoints up to the " + desc,
+				})
+			}
+			for _, m := range msgs {
+				if err := write(m.msg, m.desc); err != nil {
+					return err
+				}
+				count++
+			}
+		}
+	}
+	if count == 0 {
+		return fmt.Errorf("no vectors with P = %d in %v", *p, *vectorsDir)
+	}
+	for _, m := range controlCases() {
+		if err := write(m.msg, m.desc); err != nil {
+			return err
+		}
+		count++
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote %d message vectors to %v\n", count, *out)
+	return nil
+}
+
+// controlCases returns the wtxidrelay, sendheaders and feefilter messages a
+// light client sends, and feefilter messages of the fee rates at the edges of the valid
+// range and past them, which peers ignore.
+func controlCases() []messageCase {
+	return []messageCase{
+		{&cfmsg.MsgWtxidRelay{}, "Announcement of wtxid relay"},
+		{&cfmsg.MsgSendHeaders{}, "Request for headers announcements"},
+		{&cfmsg.MsgFeeFilter{MinFeeRate: 1000}, "Fee filter of 1 " +
+			"sat/vB"},
+		{&cfmsg.MsgFeeFilter{MinFeeRate: 0}, "Fee filter of 0"},
+		{&cfmsg.MsgFeeFilter{MinFeeRate: cfmsg.MaxFeeRate}, "Fee " +
+			"filter of MaxFeeRate, as sent by nodes relaying no " +
+			"transactions"},
+		{&cfmsg.MsgFeeFilter{MinFeeRate: cfmsg.MaxFeeRate + 1}, "Fee " +
+			"filter past MaxFeeRate, ignored"},
+		{&cfmsg.MsgFeeFilter{MinFeeRate: -1}, "Negative fee filter, " +
+			"ignored"},
+	}
+}
+
+// txInvCases returns inv messages announcing the transactions of the block of
+// the case by txid and by wtxid, which differ for the transactions with
+// witnesses, or none for a block of more transactions than an inv message
+// may hold.
+func txInvCases(c *conformance.Case) ([]messageCase, error) {
+	block := &wire.MsgBlock{}
+	if err := block.Deserialize(bytes.NewReader(c.Block)); err != nil {
+		return nil, fmt.Errorf("block %d: %v", c.Height, err)
+	}
+	if len(block.Transactions) > wire.MaxInvPerMsg {
+		return nil, nil
+	}
+
+	witnesses := 0
+	for _, tx := range block.Transactions {
+		if tx.HasWitness() {
+			witnesses++
+		}
+	}
+	var cases []messageCase
+	for _, byWtxid := range []bool{false, true} {
+		inv, err := cfmsg.NewTxInv(block.Transactions, byWtxid)
+		if err != nil {
+			return nil, err
+		}
+		desc := fmt.Sprintf("The %d transactions of block %d, %d "+
+			"with witnesses, by txid", len(block.Transactions),
+			c.Height, witnesses)
+		if byWtxid {
+			desc = strings.Replace(desc, "by txid", "by wtxid", 1)
+		}
+		cases = append(cases, messageCase{inv, desc})
+	}
+	return cases, nil
+}
@@ -0,0 +1,595 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	bip32 "github.com/christsim/bips/bip-0032"
+	"github.com/christsim/bips/bip-0158/backend/chaincfg"
+	"github.com/christsim/bips/bip-0158/backend/chainhash"
+	"github.com/christsim/bips/bip-0158/backend/wire"
+	"github.com/christsim/bips/bip-0158/gcs"
+	"github.com/christsim/bips/bip-0158/gcs/builder"
+	"github.com/christsim/bips/bip-0158/multisig"
+	"github.com/christsim/bips/bip-0158/regtestharness"
+	"github.com/christsim/bips/bip-0158/rescan"
+	"github.com/christsim/bips/bip-0174"
+)
+
+// multisigColumns is the header row of the multisig vector file.
+const multisigColumns = "Stage,Index,Value,Comment"
+
+const (
+	// multisigCosigners and multisigThreshold make the wallet of the
+	// multisig vectors 2-of-3.
+	multisigCosigners = 3
+	multisigThreshold = 2
+
+	// multisigPayment is what the spend of the vectors pays out, and
+	// multisigFeeRate its fee rate in satoshis per 1000 virtual bytes.
+	multisigPayment = 120000000
+	multisigFeeRate = 2000
+)
+
+// multisigFunding are the outputs paying to the wallet in the funding blocks:
+// in the first block, two of them to receive indexes 0 and 2 in one
+// transaction, leaving a gap at index 1 that the second block fills.
+var multisigFunding = [][]struct {
+	index uint32
+	value int64
+}{
+	{{0, 100000000}, {2, 30000000}},
+	{{1, 50000000}},
+}
+
+// multisigSigners are the cosigners signing the spend of the vectors, each on
+// a copy of the unsigned packet.
+var multisigSigners = []int{0, 2}
+
+// errSpendMismatch is returned when checking multisig vectors whose spend
+// block doesn't hold the transaction the workflow signed.
+var errSpendMismatch = errors.New("spend block doesn't hold the signed " +
+	"transaction")
+
+// runMultisig implements the multisig subcommand, which runs a 2-of-3
+// multisig wallet through its whole life on a regtest node, as an integration
+// test of descriptors, filters and PSBTs: its wsh(sortedmulti()) descriptors
+// and addresses, the blocks funding it, their basic filters, the wallet's
+// outputs found by a rescan of them, a PSBT spending them, the packets signed
+// by two of the cosigners on their own, and the transaction finalized from
+// them, which the node accepts in a block. The wallet's keys derive from
+// fixed seeds and blocks are mined with fixed timestamps, so the vectors are
+// the same on every run. With -check, the workflow is replayed from the seeds
+// and blocks of a vector file, without a node, and must reproduce it.
+func runMultisig(args []string) error {
+	fs := flag.NewFlagSet("multisig", flag.ContinueOnError)
+	bitcoind := fs.String("bitcoind", "", "path of the bitcoind binary "+
+		"to mine the blocks with")
+	btcd := fs.String("btcd", "", "path of the btcd binary to mine the "+
+		"blocks with, instead of -bitcoind")
+	dataDir := fs.String("datadir", "", "data directory of the node, "+
+		"which must not hold any blocks (default a temporary directory)")
+	out := fs.String("out", "multisig.json", "file to write the vectors "+
+		"to")
+	check := fs.String("check", "", "vector file to check instead of "+
+		"writing one")
+	verbose := fs.Bool("v", false, "show the node's output")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *check != "" {
+		return checkMultisigVectors(*check)
+	}
+
+	cfg := regtestharness.Config{DataDir: *dataDir}
+	switch {
+	case *bitcoind != "" && *btcd != "":
+		return fmt.Errorf("only one of -bitcoind and -btcd may be set")
+	case *bitcoind != "":
+		cfg.Implementation = regtestharness.Bitcoind
+		cfg.Path = *bitcoind
+	case *btcd != "":
+		cfg.Implementation = regtestharness.Btcd
+		cfg.Path = *btcd
+	default:
+		return fmt.Errorf("one of -bitcoind and -btcd must be set")
+	}
+	if *verbose {
+		cfg.Output = os.Stderr
+	}
+
+	seeds := make([][]byte, multisigCosigners)
+	for i := range seeds {
+		seed := sha256.Sum256([]byte(fmt.Sprintf("multisig-cosigner-%d",
+			i)))
+		seeds[i] = seed[:]
+	}
+	wf, err := newMultisigWorkflow(seeds)
+	if err != nil {
+		return err
+	}
+
+	node, err := regtestharness.Start(cfg)
+	if err != nil {
+		return err
+	}
+	defer node.Stop()
+
+	m, err := regtestharness.NewMiner(node)
+	if err != nil {
+		return err
+	}
+	params := &chaincfg.RegressionNetParams
+	for i := uint16(0); i < params.CoinbaseMaturity; i++ {
+		if _, err := m.Mine(); err != nil {
+			return err
+		}
+	}
+
+	for _, funding := range multisigFunding {
+		var outputs []*wire.TxOut
+		for _, f := range funding {
+			scripts, err := wf.wallet.Descriptor(
+				multisig.Receive).Scripts(f.index)
+			if err != nil {
+				return err
+			}
+			outputs = append(outputs, wire.NewTxOut(f.value,
+				scripts[0]))
+		}
+		tx, err := m.Spend(outputs...)
+		if err != nil {
+			return err
+		}
+		block, err := m.Mine(tx)
+		if err != nil {
+			return err
+		}
+		err = wf.addBlock(uint32(m.Height()), block, "Funds the wallet")
+		if err != nil {
+			return err
+		}
+	}
+
+	tx, err := wf.spend()
+	if err != nil {
+		return err
+	}
+	block, err := m.Mine(tx)
+	if err != nil {
+		return fmt.Errorf("spend rejected: %v", err)
+	}
+	err = wf.addBlock(uint32(m.Height()), block, "Spends from the wallet")
+	if err != nil {
+		return err
+	}
+	if err := wf.finish(); err != nil {
+		return err
+	}
+
+	file, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := NewJSONTestWriter(file)
+	if err := writer.WriteComment(multisigColumns); err != nil {
+		return err
+	}
+	for _, row := range wf.rows {
+		if err := writer.WriteTestCase(row); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("Wrote %d rows, spending %v at height %d\n", len(wf.rows),
+		tx.TxHash(), m.Height())
+	return writer.Close()
+}
+
+// memoryChain holds blocks by height and serves them, along with basic
+// filters built from them, to a rescan, so that the multisig workflow runs
+// the same against a node's blocks and those of a vector file.
+type memoryChain struct {
+	blocks  map[uint32]*wire.MsgBlock
+	hashes  map[chainhash.Hash]*wire.MsgBlock
+	filters map[uint32]*gcs.Filter
+}
+
+// newMemoryChain returns an empty chain.
+func newMemoryChain() *memoryChain {
+	return &memoryChain{
+		blocks:  make(map[uint32]*wire.MsgBlock),
+		hashes:  make(map[chainhash.Hash]*wire.MsgBlock),
+		filters: make(map[uint32]*gcs.Filter),
+	}
+}
+
+// add adds the block at the height and builds its basic filter.
+func (c *memoryChain) add(height uint32, block *wire.MsgBlock) error {
+	filter, err := builder.BuildFilter(builder.BasicPolicy{
+		ScriptTypes: builder.AllScriptTypes,
+	}, block, builder.DefaultP)
+	if err != nil {
+		return err
+	}
+	c.blocks[height] = block
+	c.hashes[block.BlockHash()] = block
+	c.filters[height] = filter
+	return nil
+}
+
+// Filter returns the filter of the block at the height, or nil if the chain
+// doesn't have it.
+func (c *memoryChain) Filter(height uint32) (*gcs.Filter, *chainhash.Hash,
+	error) {
+
+	block, ok := c.blocks[height]
+	if !ok {
+		return nil, nil, nil
+	}
+	blockHash := block.BlockHash()
+	return c.filters[height], &blockHash, nil
+}
+
+// GetBlock returns the block with the hash.
+func (c *memoryChain) GetBlock(blockHash *chainhash.Hash) (*wire.MsgBlock,
+	error) {
+
+	block, ok := c.hashes[*blockHash]
+	if !ok {
+		return nil, fmt.Errorf("no block %v", blockHash)
+	}
+	return block, nil
+}
+
+// multisigWorkflow runs the wallet of the multisig vectors over the blocks
+// added to its chain, collecting the vector rows of each step.
+type multisigWorkflow struct {
+	masters []*bip32.ExtendedKey
+	wallet  *multisig.Wallet
+	chain   *memoryChain
+
+	// scanned is the height past the last block rescanned.
+	scanned uint32
+
+	// tx is the spend, once the wallet's cosigners have signed it.
+	tx *wire.MsgTx
+
+	rows [][]interface{}
+}
+
+// newMultisigWorkflow creates the wallet of the cosigners with the seeds, and
+// adds rows for the seeds, the wallet's descriptors and its first receive
+// addresses.
+func newMultisigWorkflow(seeds [][]byte) (*multisigWorkflow, error) {
+	params := &chaincfg.RegressionNetParams
+	wf := &multisigWorkflow{chain: newMemoryChain()}
+
+	var cosigners []*multisig.Cosigner
+	for i, seed := range seeds {
+		master, err := bip32.NewMaster(seed, bip32.Testnet)
+		if err != nil {
+			return nil, err
+		}
+		cosigner, err := multisig.NewCosigner(master,
+			multisig.AccountPath(params, 0))
+		if err != nil {
+			return nil, err
+		}
+		wf.masters = append(wf.masters, master)
+		cosigners = append(cosigners, cosigner)
+		wf.addRow("seed", i, hex.EncodeToString(seed),
+			fmt.Sprintf("Cosigner %d, account key %v", i, cosigner))
+	}
+
+	var err error
+	wf.wallet, err = multisig.New(multisigThreshold, cosigners)
+	if err != nil {
+		return nil, err
+	}
+	for _, chain := range []multisig.Chain{multisig.Receive,
+		multisig.Change} {
+
+		wf.addRow("descriptor", int(chain),
+			wf.wallet.Descriptor(chain).String(),
+			fmt.Sprintf("%d-of-%d %v descriptor", multisigThreshold,
+				len(seeds), chain))
+	}
+	for index := uint32(0); index < 3; index++ {
+		address, err := wf.wallet.Address(multisig.Receive, index,
+			params)
+		if err != nil {
+			return nil, err
+		}
+		wf.addRow("address", int(index), address,
+			fmt.Sprintf("Regtest receive address %d", index))
+	}
+	return wf, nil
+}
+
+// addRow adds a row to the vectors.
+func (wf *multisigWorkflow) addRow(stage string, index int, value,
+	comment string) {
+
+	wf.rows = append(wf.rows, []interface{}{stage, index, value, comment})
+}
+
+// addBlock adds the block at the height to the chain, and rows for it and its
+// filter.
+func (wf *multisigWorkflow) addBlock(height uint32, block *wire.MsgBlock,
+	comment string) error {
+
+	if err := wf.chain.add(height, block); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := block.Serialize(&buf); err != nil {
+		return err
+	}
+	filterBytes, err := wf.chain.filters[height].NBytes()
+	if err != nil {
+		return err
+	}
+	wf.addRow("block", int(height), hex.EncodeToString(buf.Bytes()),
+		comment)
+	wf.addRow("filter", int(height), hex.EncodeToString(filterBytes),
+		"Basic filter")
+	if wf.scanned == 0 {
+		wf.scanned = height
+	}
+	return nil
+}
+
+// rescan walks the filters of the blocks added since the last rescan,
+// watching the wallet's descriptors and unspent outputs, and adds the
+// relevant transactions it finds to the wallet.
+func (wf *multisigWorkflow) rescan(end uint32) error {
+	cfg := &rescan.Config{
+		Filters:          wf.chain,
+		Blocks:           wf.chain,
+		StartHeight:      wf.scanned,
+		EndHeight:        end,
+		WatchDescriptors: wf.wallet.Descriptors(),
+	}
+	for _, utxo := range wf.wallet.UTXOs() {
+		cfg.WatchOutPoints = append(cfg.WatchOutPoints, utxo.OutPoint)
+	}
+	r := rescan.New(cfg)
+	r.Start()
+	for tx := range r.Transactions() {
+		if err := wf.wallet.AddTx(tx); err != nil {
+			r.Stop()
+			return err
+		}
+	}
+	if err := r.Err(); err != nil {
+		return err
+	}
+	wf.scanned = end + 1
+	return nil
+}
+
+// addUTXORows adds a row for each unspent output of the wallet.
+func (wf *multisigWorkflow) addUTXORows() {
+	for i, utxo := range wf.wallet.UTXOs() {
+		wf.addRow("utxo", i, utxo.OutPoint.String(),
+			fmt.Sprintf("%d sat at %v/%d, height %d", utxo.Value,
+				utxo.Chain, utxo.Index, utxo.Height))
+	}
+}
+
+// spend rescans the blocks added so far, and spends every output the wallet
+// found in them, adding rows for the outputs, the unsigned packet, the
+// packet signed by each of multisigSigners and the finalized transaction. A
+// single cosigner's signatures are checked not to be enough.
+func (wf *multisigWorkflow) spend() (*wire.MsgTx, error) {
+	var tip uint32
+	for height := range wf.chain.blocks {
+		if height > tip {
+			tip = height
+		}
+	}
+	if err := wf.rescan(tip); err != nil {
+		return nil, err
+	}
+	wf.addUTXORows()
+
+	packet, err := wf.wallet.CreateSpend(wf.wallet.UTXOs(),
+		[]*wire.TxOut{wire.NewTxOut(multisigPayment,
+			regtestharness.AnyoneCanSpendScript)}, multisigFeeRate)
+	if err != nil {
+		return nil, err
+	}
+	unsigned, err := packet.Base64()
+	if err != nil {
+		return nil, err
+	}
+	wf.addRow("unsigned-psbt", 0, unsigned, "Spend with change, "+
+		"before any signatures")
+
+	var signed []*psbt.Packet
+	for _, i := range multisigSigners {
+		p, err := psbt.ParseBase64(unsigned)
+		if err != nil {
+			return nil, err
+		}
+		if err := multisig.Sign(p, wf.masters[i]); err != nil {
+			return nil, fmt.Errorf("cosigner %d: %v", i, err)
+		}
+		text, err := p.Base64()
+		if err != nil {
+			return nil, err
+		}
+		wf.addRow("signed-psbt", i, text,
+			fmt.Sprintf("Signed by cosigner %d", i))
+		signed = append(signed, p)
+	}
+
+	_, err = multisig.Finalize(signed[0])
+	if !errors.Is(err, psbt.ErrIncompleteSignatures) {
+		return nil, fmt.Errorf("finalizing with one cosigner's "+
+			"signatures gave %v", err)
+	}
+	tx, err := multisig.Finalize(signed...)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := tx.Serialize(&buf); err != nil {
+		return nil, err
+	}
+	wf.tx = tx
+	wf.addRow("tx", 0, hex.EncodeToString(buf.Bytes()),
+		fmt.Sprintf("Finalized from the signatures of cosigners %v",
+			multisigSigners))
+	return tx, nil
+}
+
+// finish rescans the spend block, which must hold the transaction the
+// wallet signed, and adds rows for the wallet's outputs left and the next
+// index of each of its chains.
+func (wf *multisigWorkflow) finish() error {
+	block := wf.chain.blocks[wf.scanned]
+	found := false
+	for _, tx := range block.Transactions {
+		found = found || wf.tx != nil && tx.TxHash() == wf.tx.TxHash()
+	}
+	if !found {
+		return errSpendMismatch
+	}
+
+	if err := wf.rescan(wf.scanned); err != nil {
+		return err
+	}
+	wf.addUTXORows()
+	for _, chain := range []multisig.Chain{multisig.Receive,
+		multisig.Change} {
+
+		wf.addRow("next-index", int(chain),
+			fmt.Sprint(wf.wallet.NextIndex(chain)),
+			fmt.Sprintf("Next unused %v index", chain))
+	}
+	return nil
+}
+
+// checkMultisigVectors replays the multisig workflow from the seeds and
+// blocks of the vector file at path, the last block being the spend's, and
+// checks that it reproduces every row of the file.
+func checkMultisigVectors(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var rows [][]json.RawMessage
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return err
+	}
+
+	type blockRow struct {
+		height  uint32
+		block   *wire.MsgBlock
+		comment string
+	}
+	var (
+		seeds  [][]byte
+		blocks []blockRow
+		want   [][]interface{}
+	)
+	for i, row := range rows {
+		// Skip the header row and any other comments.
+		if len(row) == 1 {
+			continue
+		}
+		if len(row) != 4 {
+			return fmt.Errorf("row %d: expected 4 columns, got %d", i,
+				len(row))
+		}
+
+		var (
+			stage, value, comment string
+			index                 int
+		)
+		err := firstError(
+			json.Unmarshal(row[0], &stage),
+			json.Unmarshal(row[1], &index),
+			json.Unmarshal(row[2], &value),
+			json.Unmarshal(row[3], &comment),
+		)
+		if err != nil {
+			return fmt.Errorf("row %d: %v", i, err)
+		}
+		want = append(want, []interface{}{stage, index, value, comment})
+
+		switch stage {
+		case "seed":
+			seed, err := hex.DecodeString(value)
+			if err != nil {
+				return fmt.Errorf("row %d: %v", i, err)
+			}
+			seeds = append(seeds, seed)
+
+		case "block":
+			raw, err := hex.DecodeString(value)
+			if err != nil {
+				return fmt.Errorf("row %d: %v", i, err)
+			}
+			block := &wire.MsgBlock{}
+			err = block.Deserialize(bytes.NewReader(raw))
+			if err != nil {
+				return fmt.Errorf("row %d: %v", i, err)
+			}
+			blocks = append(blocks, blockRow{uint32(index), block,
+				comment})
+		}
+	}
+	if len(blocks) < 2 {
+		return fmt.Errorf("expected funding and spend blocks, got %d "+
+			"blocks", len(blocks))
+	}
+
+	wf, err := newMultisigWorkflow(seeds)
+	if err != nil {
+		return err
+	}
+	for _, b := range blocks[:len(blocks)-1] {
+		if err := wf.addBlock(b.height, b.block, b.comment); err != nil {
+			return err
+		}
+	}
+	if _, err := wf.spend(); err != nil {
+		return err
+	}
+	spend := blocks[len(blocks)-1]
+	err = wf.addBlock(spend.height, spend.block, spend.comment)
+	if err != nil {
+		return err
+	}
+	if err := wf.finish(); err != nil {
+		return err
+	}
+
+	if len(wf.rows) != len(want) {
+		return fmt.Errorf("replay gave %d rows, file has %d",
+			len(wf.rows), len(want))
+	}
+	for i := range want {
+		for j := range want[i] {
+			if wf.rows[i][j] != want[i][j] {
+				return fmt.Errorf("%v row %v: replay gave %v, "+
+					"file has %v", want[i][0], want[i][1],
+					wf.rows[i][j], want[i][j])
+			}
+		}
+	}
+
+	fmt.Printf("%d rows OK\n", len(want))
+	return nil
+}
@@ -0,0 +1,248 @@
+package multisig
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	btcdchainhash "github.com/btcsuite/btcd/chaincfg/chainhash"
+	btcdwire "github.com/btcsuite/btcd/wire"
+	bip32 "github.com/christsim/bips/bip-0032"
+	"github.com/christsim/bips/bip-0158/backend/wire"
+	"github.com/christsim/bips/bip-0174"
+)
+
+var (
+	// ErrNoInputs is returned by CreateSpend when it's passed no outputs
+	// to spend.
+	ErrNoInputs = errors.New("multisig: no outputs to spend")
+
+	// ErrInsufficientFunds is returned by CreateSpend when the outputs it
+	// spends don't cover the outputs it pays and the fee.
+	ErrInsufficientFunds = errors.New("multisig: insufficient funds")
+
+	// ErrNotCosigner is returned by Sign for a master key none of the
+	// packet's keys derive from.
+	ErrNotCosigner = errors.New("multisig: key isn't a cosigner of the " +
+		"packet")
+
+	// ErrDerivationMismatch is returned by Sign when a key derived along
+	// a derivation of the packet isn't the derivation's public key.
+	ErrDerivationMismatch = errors.New("multisig: derivation doesn't " +
+		"give its public key")
+)
+
+// DustLimit is the smallest value of a P2WSH output that Bitcoin Core relays
+// at its default dust fee rate. Change below it is left to the fee.
+const DustLimit = 330
+
+const (
+	// maxSigSize is the size of the largest DER signature along with its
+	// sighash type, which fees are estimated with.
+	maxSigSize = 73
+
+	// witnessHeaderSize is the weight of the marker and flag bytes of a
+	// transaction with witnesses.
+	witnessHeaderSize = 2
+
+	// witnessScaleFactor is the weight of a byte outside the witness.
+	witnessScaleFactor = 4
+)
+
+// compactSizeLen returns the length of the compact size encoding of n.
+func compactSizeLen(n int) int {
+	switch {
+	case n < 0xfd:
+		return 1
+	case n <= 0xffff:
+		return 3
+	}
+	return 5
+}
+
+// inputWitnessSize returns the largest size of the witness of an input
+// spending a script of the wallet: the empty item CHECKMULTISIG pops, the
+// threshold's signatures and the witness script.
+func (w *Wallet) inputWitnessSize() int {
+	scriptSize := 3 + len(w.cosigners)*34
+	return compactSizeLen(w.threshold+2) + 1 +
+		w.threshold*(1+maxSigSize) +
+		compactSizeLen(scriptSize) + scriptSize
+}
+
+// fee returns the fee of the unsigned transaction at the fee rate, in
+// satoshis per 1000 virtual bytes, once its inputs are signed.
+func (w *Wallet) fee(tx *btcdwire.MsgTx, feeRate int64) int64 {
+	weight := tx.SerializeSizeStripped()*witnessScaleFactor +
+		witnessHeaderSize + len(tx.TxIn)*w.inputWitnessSize()
+	vsize := int64(weight+witnessScaleFactor-1) / witnessScaleFactor
+	return (vsize*feeRate + 999) / 1000
+}
+
+// CreateSpend returns a packet of a transaction spending the wallet's outputs
+// to the passed outputs at the fee rate, in satoshis per 1000 virtual bytes,
+// paying what's left to the next unused script of the change chain. Change
+// below DustLimit is left to the fee instead. The packet holds what
+// cosigners need to sign it: the output and witness script each input
+// spends, the derivations of their keys, and the account keys of the
+// cosigners as global xpubs. The change output has its witness script and
+// derivations too, so that signers can tell it's the wallet's.
+func (w *Wallet) CreateSpend(utxos []UTXO, outputs []*wire.TxOut,
+	feeRate int64) (*psbt.Packet, error) {
+
+	if len(utxos) == 0 {
+		return nil, ErrNoInputs
+	}
+
+	update := &psbt.Update{
+		Utxos: make(map[btcdwire.OutPoint]*btcdwire.TxOut),
+	}
+	addScript := func(chain Chain, index uint32) error {
+		script, keys, err := w.witnessScript(chain, index)
+		if err != nil {
+			return err
+		}
+		update.Scripts = append(update.Scripts, script)
+		for _, key := range keys {
+			update.Keys = append(update.Keys, psbt.Derivation{
+				PubKey: key.pubKey,
+				KeyOrigin: psbt.KeyOrigin{
+					Fingerprint: key.fingerprint,
+					Path:        key.path,
+				},
+			})
+		}
+		return nil
+	}
+
+	tx := btcdwire.NewMsgTx(2)
+	var in int64
+	for _, utxo := range utxos {
+		outPoint := btcdwire.OutPoint{
+			Hash:  btcdchainhash.Hash(utxo.OutPoint.Hash),
+			Index: utxo.OutPoint.Index,
+		}
+		tx.AddTxIn(btcdwire.NewTxIn(&outPoint, nil, nil))
+		update.Utxos[outPoint] = btcdwire.NewTxOut(utxo.Value,
+			utxo.PkScript)
+		if err := addScript(utxo.Chain, utxo.Index); err != nil {
+			return nil, err
+		}
+		in += utxo.Value
+	}
+	var out int64
+	for _, txOut := range outputs {
+		tx.AddTxOut(btcdwire.NewTxOut(txOut.Value, txOut.PkScript))
+		out += txOut.Value
+	}
+
+	changeIndex := w.next[Change]
+	changeScripts, err := w.descs[Change].Scripts(changeIndex)
+	if err != nil {
+		return nil, err
+	}
+	tx.AddTxOut(btcdwire.NewTxOut(0, changeScripts[0]))
+	change := in - out - w.fee(tx, feeRate)
+	if change >= DustLimit {
+		tx.TxOut[len(tx.TxOut)-1].Value = change
+		err := addScript(Change, changeIndex)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		tx.TxOut = tx.TxOut[:len(tx.TxOut)-1]
+		if in-out < w.fee(tx, feeRate) {
+			return nil, fmt.Errorf("%w: %d to spend, %d to pay "+
+				"and %d in fees", ErrInsufficientFunds, in, out,
+				w.fee(tx, feeRate))
+		}
+	}
+
+	packet, err := psbt.New(tx)
+	if err != nil {
+		return nil, err
+	}
+	if err := packet.Update(update); err != nil {
+		return nil, err
+	}
+	for _, c := range w.cosigners {
+		packet.XPubs = append(packet.XPubs, psbt.XPub{
+			ExtendedKey: c.Key.Serialize(),
+			KeyOrigin: psbt.KeyOrigin{
+				Fingerprint: c.Fingerprint,
+				Path:        c.Path,
+			},
+		})
+	}
+	return packet, nil
+}
+
+// Sign signs each input of the packet with the keys of the master key, as a
+// cosigner does. The keys are derived along the derivations of the inputs
+// whose fingerprint is the master key's, and must be the derivations' public
+// keys.
+func Sign(packet *psbt.Packet, master *bip32.ExtendedKey) error {
+	fingerprint := master.Fingerprint()
+	signed := false
+	for i := range packet.Inputs {
+		for _, d := range packet.Inputs[i].Derivations {
+			if d.Fingerprint != fingerprint {
+				continue
+			}
+			key, err := master.Derive(d.Path)
+			if err != nil {
+				return err
+			}
+			if !bytes.Equal(key.PublicKey(), d.PubKey) {
+				return fmt.Errorf("%w: input %d, %v",
+					ErrDerivationMismatch, i, d.KeyOrigin)
+			}
+			privKey, _ := btcec.PrivKeyFromBytes(key.PrivateKey())
+			if err := packet.Sign(i, privKey); err != nil {
+				return err
+			}
+			signed = true
+		}
+	}
+	if !signed {
+		return fmt.Errorf("%w: %x", ErrNotCosigner, fingerprint)
+	}
+	return nil
+}
+
+// Finalize combines packets of the same spend signed by different cosigners,
+// finalizes each input from their signatures, and returns the signed
+// transaction. Every input needs the signatures of the wallet's threshold of
+// cosigners.
+func Finalize(packets ...*psbt.Packet) (*wire.MsgTx, error) {
+	if len(packets) == 0 {
+		return nil, errors.New("multisig: no packets to finalize")
+	}
+	combined, err := psbt.Combine(packets[0], packets[1:]...)
+	if err != nil {
+		return nil, err
+	}
+	if err := combined.FinalizeAll(); err != nil {
+		return nil, err
+	}
+	signed, err := combined.Extract()
+	if err != nil {
+		return nil, err
+	}
+	return FromPSBTTx(signed)
+}
+
+// FromPSBTTx converts a transaction of the PSBT package to the wire type of
+// the selected backend.
+func FromPSBTTx(tx *btcdwire.MsgTx) (*wire.MsgTx, error) {
+	var buf bytes.Buffer
+	if err := tx.Serialize(&buf); err != nil {
+		return nil, err
+	}
+	msgTx := &wire.MsgTx{}
+	if err := msgTx.Deserialize(&buf); err != nil {
+		return nil, err
+	}
+	return msgTx, nil
+}
@@ -0,0 +1,401 @@
+// Package multisig runs a k-of-n multisig wallet on top of output
+// descriptors, BIP 158 filters and PSBTs, as cosigners holding separate keys
+// do:
+//
+//	wallet, err := multisig.New(2, cosigners)
+//	address, err := wallet.Address(multisig.Receive, 0, params)
+//	cfg.WatchDescriptors = wallet.Descriptors()
+//	...
+//	for tx := range r.Transactions() {
+//		err = wallet.AddTx(tx)
+//	}
+//	packet, err := wallet.CreateSpend(wallet.UTXOs(), outputs, feeRate)
+//	err = multisig.Sign(packet, master)
+//	tx, err := multisig.Finalize(signed...)
+//
+// The wallet's scripts are those of a receive and a change descriptor,
+// wsh(sortedmulti(k,...)) over the BIP 48 account keys of the cosigners along
+// with their origins, so that any descriptor wallet can watch them too. A
+// rescan of the filters finds the transactions paying to them, from which the
+// wallet keeps its unspent outputs. Spends are PSBTs carrying the witness
+// UTXO, witness script and key derivations of each input, which is all a
+// cosigner needs to sign without knowing the wallet: Sign finds the keys of
+// its master key among the derivations. Finalize combines the packets the
+// cosigners signed and builds the witnesses once enough of them have.
+//
+// The PSBT package of the bip-0174 module is built on btcd's wire types,
+// which the roasbeef backend doesn't share, so transactions cross between the
+// two serialized.
+package multisig
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	bip32 "github.com/christsim/bips/bip-0032"
+	"github.com/christsim/bips/bip-0032/derivation"
+	"github.com/christsim/bips/bip-0158/backend/chaincfg"
+	"github.com/christsim/bips/bip-0158/backend/txscript"
+	"github.com/christsim/bips/bip-0158/backend/wire"
+	"github.com/christsim/bips/bip-0158/rescan"
+	"github.com/christsim/bips/bip-0380"
+)
+
+var (
+	// ErrThreshold is returned by New for a threshold that isn't a number
+	// from 1 to the number of cosigners.
+	ErrThreshold = errors.New("multisig: invalid threshold")
+
+	// ErrTooManyCosigners is returned by New for more cosigners than a
+	// P2WSH multisig script takes.
+	ErrTooManyCosigners = errors.New("multisig: too many cosigners")
+
+	// ErrPublicMaster is returned by NewCosigner for a master key that
+	// isn't private, from which hardened account keys can't be derived.
+	ErrPublicMaster = errors.New("multisig: master key isn't private")
+
+	// ErrScriptMismatch is returned when the script derived from the
+	// cosigners' keys isn't the one the wallet's descriptor describes.
+	ErrScriptMismatch = errors.New("multisig: witness script doesn't " +
+		"match descriptor")
+)
+
+// MaxCosigners is the number of keys of the largest multisig script that
+// P2WSH allows.
+const MaxCosigners = 20
+
+// Chain is one of the two chains of addresses of an account, the change level
+// of BIP 44 paths.
+type Chain uint32
+
+const (
+	// Receive is the chain of addresses given out to be paid to.
+	Receive Chain = 0
+
+	// Change is the chain of addresses the wallet's spends pay their
+	// change to.
+	Change Chain = 1
+)
+
+// String returns the name of the chain.
+func (c Chain) String() string {
+	if c == Change {
+		return "change"
+	}
+	return "receive"
+}
+
+// AccountPath returns the BIP 48 path of the account keys of P2WSH multisig
+// wallets on a network, m/48'/coin'/account'/2'.
+func AccountPath(params *chaincfg.Params, account uint32) bip32.Path {
+	return bip32.Path{
+		48 + bip32.HardenedKeyStart,
+		params.HDCoinType + bip32.HardenedKeyStart,
+		account + bip32.HardenedKeyStart,
+		2 + bip32.HardenedKeyStart,
+	}
+}
+
+// Cosigner is one of the keys of a multisig wallet: the extended public key
+// of a cosigner's account, along with the fingerprint of the master key it
+// derives from and the path it derives along, which signers look their keys
+// up by.
+type Cosigner struct {
+	Fingerprint [4]byte
+	Path        bip32.Path
+	Key         *bip32.ExtendedKey
+}
+
+// NewCosigner derives the account key of a cosigner along the path from its
+// master key, as the cosigner shares it with the others.
+func NewCosigner(master *bip32.ExtendedKey,
+	path bip32.Path) (*Cosigner, error) {
+
+	if !master.IsPrivate() {
+		return nil, ErrPublicMaster
+	}
+	key, err := master.Derive(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Cosigner{
+		Fingerprint: master.Fingerprint(),
+		Path:        append(bip32.Path(nil), path...),
+		Key:         key.Neuter(),
+	}, nil
+}
+
+// String returns the cosigner's key as a descriptor key expression with its
+// origin, such as [d34db33f/48'/1'/0'/2']tpub....
+func (c *Cosigner) String() string {
+	return fmt.Sprintf("[%x%s]%v", c.Fingerprint, c.Path.String()[1:],
+		c.Key)
+}
+
+// keyPath is the chain and index a script of the wallet derives at.
+type keyPath struct {
+	chain Chain
+	index uint32
+}
+
+// UTXO is an unspent output paying to the wallet.
+type UTXO struct {
+	OutPoint wire.OutPoint
+	Value    int64
+	PkScript []byte
+
+	// Chain and Index are where the output's script derives.
+	Chain Chain
+	Index uint32
+
+	// Height is the height of the block the output was found in.
+	Height uint32
+}
+
+// Wallet is a k-of-n multisig wallet: the scripts of its descriptors, which of
+// them it has found paid to, and its unspent outputs. A wallet only holds
+// public keys; the cosigners sign its spends with Sign.
+type Wallet struct {
+	threshold int
+	cosigners []*Cosigner
+	descs     [2]*descriptor.Descriptor
+	lookAhead uint32
+
+	// scripts maps the output scripts derived so far to where they
+	// derive. derived is the number of indexes derived on each chain, and
+	// next the index past the highest one found paid to.
+	scripts map[string]keyPath
+	derived [2]uint32
+	next    [2]uint32
+
+	utxos map[wire.OutPoint]*UTXO
+}
+
+// New returns a wallet of the cosigners whose spends take signatures from
+// threshold of them. Its descriptors list the cosigners in the order they are
+// passed, but sortedmulti() sorts their keys within each script, so any
+// order gives the same wallet.
+func New(threshold int, cosigners []*Cosigner) (*Wallet, error) {
+	if len(cosigners) > MaxCosigners {
+		return nil, fmt.Errorf("%w: %d", ErrTooManyCosigners,
+			len(cosigners))
+	}
+	if threshold < 1 || threshold > len(cosigners) {
+		return nil, fmt.Errorf("%w: %d of %d", ErrThreshold, threshold,
+			len(cosigners))
+	}
+
+	w := &Wallet{
+		threshold: threshold,
+		cosigners: cosigners,
+		lookAhead: rescan.DefaultLookAhead,
+		scripts:   make(map[string]keyPath),
+		utxos:     make(map[wire.OutPoint]*UTXO),
+	}
+	for _, chain := range []Chain{Receive, Change} {
+		keys := make([]string, len(cosigners))
+		for i, c := range cosigners {
+			keys[i] = fmt.Sprintf("%v/%d/*", c, chain)
+		}
+		text := fmt.Sprintf("wsh(sortedmulti(%d,%s))", threshold,
+			strings.Join(keys, ","))
+		desc, err := descriptor.Parse(text)
+		if err != nil {
+			return nil, err
+		}
+		w.descs[chain] = desc
+		if err := w.derive(chain, w.lookAhead); err != nil {
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+// Threshold returns the number of cosigners that must sign a spend.
+func (w *Wallet) Threshold() int {
+	return w.threshold
+}
+
+// Cosigners returns the cosigners of the wallet.
+func (w *Wallet) Cosigners() []*Cosigner {
+	return w.cosigners
+}
+
+// Descriptor returns the descriptor of the chain's scripts.
+func (w *Wallet) Descriptor(chain Chain) *descriptor.Descriptor {
+	return w.descs[chain]
+}
+
+// Descriptors returns the receive and change descriptors, for a rescan to
+// watch.
+func (w *Wallet) Descriptors() []rescan.Descriptor {
+	return []rescan.Descriptor{w.descs[Receive], w.descs[Change]}
+}
+
+// derive derives the scripts of the chain up to the passed index, exclusive.
+func (w *Wallet) derive(chain Chain, end uint32) error {
+	for ; w.derived[chain] < end; w.derived[chain]++ {
+		index := w.derived[chain]
+		scripts, err := w.descs[chain].Scripts(index)
+		if err != nil {
+			return err
+		}
+		w.scripts[string(scripts[0])] = keyPath{chain, index}
+	}
+	return nil
+}
+
+// NextIndex returns the index of the chain past the highest one found paid
+// to, where the wallet gives out its next address.
+func (w *Wallet) NextIndex(chain Chain) uint32 {
+	return w.next[chain]
+}
+
+// Address returns the address of the chain's script at the index on the
+// network.
+func (w *Wallet) Address(chain Chain, index uint32,
+	params *chaincfg.Params) (string, error) {
+
+	scripts, err := w.descs[chain].Scripts(index)
+	if err != nil {
+		return "", err
+	}
+	return descriptor.ScriptAddress(scripts[0], derivation.Network{
+		Name:             params.Name,
+		PubKeyHashAddrID: params.PubKeyHashAddrID,
+		ScriptHashAddrID: params.ScriptHashAddrID,
+		HRP:              params.Bech32HRPSegwit,
+	})
+}
+
+// derivedKey is a public key of a script of the wallet, along with its origin.
+type derivedKey struct {
+	pubKey      []byte
+	fingerprint [4]byte
+	path        bip32.Path
+}
+
+// WitnessScript returns the witness script of the chain's script at the
+// index, which the P2WSH output script of the descriptor commits to.
+func (w *Wallet) WitnessScript(chain Chain, index uint32) ([]byte, error) {
+	script, _, err := w.witnessScript(chain, index)
+	return script, err
+}
+
+// witnessScript returns the witness script of the chain's script at the index
+// along with its keys, derived from the cosigners' account keys. It's checked
+// against the output script of the descriptor, so that the keys signers are
+// pointed to are those of the scripts the wallet watches.
+func (w *Wallet) witnessScript(chain Chain,
+	index uint32) ([]byte, []derivedKey, error) {
+
+	keys := make([]derivedKey, len(w.cosigners))
+	for i, c := range w.cosigners {
+		key, err := c.Key.Derive(bip32.Path{uint32(chain), index})
+		if err != nil {
+			return nil, nil, err
+		}
+		path := append(append(bip32.Path(nil), c.Path...),
+			uint32(chain), index)
+		keys[i] = derivedKey{
+			pubKey:      key.PublicKey(),
+			fingerprint: c.Fingerprint,
+			path:        path,
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return bytes.Compare(keys[i].pubKey, keys[j].pubKey) < 0
+	})
+
+	script := []byte{byte(txscript.OP_1 - 1 + w.threshold)}
+	for _, key := range keys {
+		script = append(script, txscript.OP_DATA_33)
+		script = append(script, key.pubKey...)
+	}
+	script = append(script, byte(txscript.OP_1-1+len(keys)),
+		txscript.OP_CHECKMULTISIG)
+
+	pkScripts, err := w.descs[chain].Scripts(index)
+	if err != nil {
+		return nil, nil, err
+	}
+	hash := sha256.Sum256(script)
+	pkScript := append([]byte{txscript.OP_0, txscript.OP_DATA_32},
+		hash[:]...)
+	if !bytes.Equal(pkScript, pkScripts[0]) {
+		return nil, nil, fmt.Errorf("%w: %v index %d", ErrScriptMismatch,
+			chain, index)
+	}
+	return script, keys, nil
+}
+
+// AddTx updates the wallet with a transaction a rescan found relevant: the
+// wallet's outputs it spends are spent, and those it creates are added. The
+// scripts of each chain are derived up to the rescan's default look-ahead
+// past the highest index found paid to, as the rescan watches them.
+// Transactions must be added in chain order.
+func (w *Wallet) AddTx(tx *rescan.RelevantTx) error {
+	for _, txIn := range tx.Tx.TxIn {
+		delete(w.utxos, txIn.PreviousOutPoint)
+	}
+
+	txHash := tx.Tx.TxHash()
+	for i, txOut := range tx.Tx.TxOut {
+		path, ok := w.scripts[string(txOut.PkScript)]
+		if !ok {
+			continue
+		}
+		outPoint := wire.OutPoint{Hash: txHash, Index: uint32(i)}
+		w.utxos[outPoint] = &UTXO{
+			OutPoint: outPoint,
+			Value:    txOut.Value,
+			PkScript: txOut.PkScript,
+			Chain:    path.chain,
+			Index:    path.index,
+			Height:   tx.Height,
+		}
+		if path.index >= w.next[path.chain] {
+			w.next[path.chain] = path.index + 1
+			err := w.derive(path.chain, path.index+1+w.lookAhead)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// UTXOs returns the unspent outputs of the wallet, oldest first, and in the
+// order of their outpoints within a block.
+func (w *Wallet) UTXOs() []UTXO {
+	utxos := make([]UTXO, 0, len(w.utxos))
+	for _, utxo := range w.utxos {
+		utxos = append(utxos, *utxo)
+	}
+	sort.Slice(utxos, func(i, j int) bool {
+		a, b := &utxos[i], &utxos[j]
+		if a.Height != b.Height {
+			return a.Height < b.Height
+		}
+		if c := bytes.Compare(a.OutPoint.Hash[:],
+			b.OutPoint.Hash[:]); c != 0 {
+
+			return c < 0
+		}
+		return a.OutPoint.Index < b.OutPoint.Index
+	})
+	return utxos
+}
+
+// Balance returns the total value of the wallet's unspent outputs.
+func (w *Wallet) Balance() int64 {
+	var balance int64
+	for _, utxo := range w.utxos {
+		balance += utxo.Value
+	}
+	return balance
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/christsim/bips/bip-0158/backend/wire"
+	"github.com/christsim/bips/bip-0158/blockgen"
+	"github.com/christsim/bips/bip-0158/gcs"
+	"github.com/christsim/bips/bip-0158/gcs/builder"
+)
+
+// defaultMultipliers are the multiples of 2^P swept for M by default. For a
+// given P, Golomb-Rice coding is most compact when M is about 1.497137 times
+// 2^P, which is how BIP 158 arrived at P = 19 and M = 784931.
+const defaultMultipliers = "1,1.25,1.497137,1.75,2"
+
+// paramCandidate is a combination of P and M along with the statistics of the
+// filters built with it.
+type paramCandidate struct {
+	*filterStats
+
+	// MeetsTarget is whether the expected false positive rate is at most
+	// the target.
+	MeetsTarget bool `json:"meets_target"`
+
+	// Recommended marks the smallest candidate that meets the target.
+	Recommended bool `json:"recommended"`
+}
+
+// runParamSearch implements the paramsearch subcommand, which sweeps
+// combinations of P and M over a range of blocks, reports how filter size
+// trades off against the false positive rate, and recommends the combination
+// giving the smallest filters at or below a target false positive rate. With
+// -vectors it also writes test vectors for the recommended parameters.
+func runParamSearch(args []string) error {
+	fs := flag.NewFlagSet("paramsearch", flag.ContinueOnError)
+	target := fs.Float64("fprate", 1.0/784931, "target false positive rate "+
+		"per query")
+	start := fs.Int64("start", 0, "first block height to analyze")
+	end := fs.Int64("end", 1000, "last block height to analyze")
+	synthetic := fs.Int("synthetic", 0, "analyze this many random blocks "+
+		"instead of fetching blocks from the node")
+	minP := fs.Uint("minp", 15, "smallest value of P to sweep")
+	maxP := fs.Uint("maxp", 23, "largest value of P to sweep")
+	multList := fs.String("multipliers", defaultMultipliers, "comma "+
+		"separated multiples of 2^P to sweep M over")
+	samples := fs.Int("samples", 10000, "number of random scripts to "+
+		"query each filter with")
+	seed := fs.Int64("seed", 1, "seed for the random script corpus and "+
+		"synthetic blocks")
+	policyName := fs.String("policy", "basic", "filter policy to analyze")
+	format := fs.String("format", "text", "output format: text, csv or "+
+		"json")
+	out := fs.String("out", "", "file to write the report to (default "+
+		"stdout)")
+	vectorsPath := fs.String("vectors", "", "file to write test vectors "+
+		"for the recommended parameters to")
+	vectorBlocks := fs.Int("vectorblocks", 5, "number of leading blocks "+
+		"to include in the test vectors")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *minP > gcs.MaxP || *maxP > gcs.MaxP || *minP > *maxP {
+		return fmt.Errorf("invalid P range %d-%d", *minP, *maxP)
+	}
+	if *synthetic == 0 && *start > *end {
+		return fmt.Errorf("invalid block range %d-%d", *start, *end)
+	}
+	if *target <= 0 || *target >= 1 {
+		return fmt.Errorf("invalid target false positive rate %v",
+			*target)
+	}
+	if *format != "text" && *format != "csv" && *format != "json" {
+		return fmt.Errorf("unknown format %q", *format)
+	}
+	policies, err := parsePolicies(*policyName, builder.AllScriptTypes, nil)
+	if err != nil {
+		return err
+	}
+	policy := policies[0]
+
+	var candidates []*paramCandidate
+	for p := *minP; p <= *maxP; p++ {
+		for _, field := range strings.Split(*multList, ",") {
+			mult, err := strconv.ParseFloat(strings.TrimSpace(field),
+				64)
+			if err != nil || mult <= 0 {
+				return fmt.Errorf("invalid multiplier %q", field)
+			}
+			m := uint64(math.Round(mult * math.Ldexp(1, int(p))))
+			if m == 0 || m > gcs.MaxM {
+				continue
+			}
+			candidates = append(candidates, &paramCandidate{
+				filterStats: &filterStats{
+					FilterType: policy.Name(),
+					P:          uint8(p),
+					M:          m,
+				},
+			})
+		}
+	}
+
+	// Blocks come either from the node or from the random generator.
+	var nextBlock func(i int) (*wire.MsgBlock, int64, error)
+	numBlocks := int(*end - *start + 1)
+	if *synthetic > 0 {
+		numBlocks = *synthetic
+		g := blockgen.New(*seed, blockgen.DefaultConfig)
+		nextBlock = func(i int) (*wire.MsgBlock, int64, error) {
+			return g.Block(), int64(i), nil
+		}
+	} else {
+		client, err := newRPCClient()
+		if err != nil {
+			return err
+		}
+		defer client.Shutdown()
+		nextBlock = func(i int) (*wire.MsgBlock, int64, error) {
+			height := *start + int64(i)
+			blockHash, err := client.GetBlockHash(height)
+			if err != nil {
+				return nil, 0, fmt.Errorf("couldn't get block "+
+					"hash: %v", err)
+			}
+			block, err := client.GetBlock(blockHash)
+			if err != nil {
+				return nil, 0, fmt.Errorf("couldn't get block: %v",
+					err)
+			}
+			return block, height, nil
+		}
+	}
+
+	corpus := randomScriptCorpus(*samples, *seed)
+	matcher := gcs.NewMatcher(0)
+	var (
+		vectorBlockList []*wire.MsgBlock
+		vectorHeights   []int64
+	)
+	for i := 0; i < numBlocks; i++ {
+		block, height, err := nextBlock(i)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Height: %d\n", height)
+		if i < *vectorBlocks {
+			vectorBlockList = append(vectorBlockList, block)
+			vectorHeights = append(vectorHeights, height)
+		}
+
+		entries, err := policyEntries(policy, block, 0)
+		if err != nil {
+			return err
+		}
+		blockHash := block.BlockHash()
+		key := builder.DeriveKey(&blockHash)
+		for _, c := range candidates {
+			filter, err := gcs.BuildGCSFilterM(c.P, c.M, key, entries)
+			if err != nil {
+				return err
+			}
+			if err := c.add(filter, key, corpus, matcher); err != nil {
+				return err
+			}
+		}
+	}
+
+	var best *paramCandidate
+	for _, c := range candidates {
+		c.finalize()
+		c.MeetsTarget = c.ExpectedFP <= *target
+		if c.MeetsTarget && (best == nil || c.Bytes < best.Bytes) {
+			best = c
+		}
+	}
+	if best != nil {
+		best.Recommended = true
+	}
+
+	w := io.Writer(os.Stdout)
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+	if err := writeParamReport(w, *format, candidates, best); err != nil {
+		return err
+	}
+
+	if *vectorsPath == "" {
+		return nil
+	}
+	if best == nil {
+		return fmt.Errorf("no candidate meets the target false positive " +
+			"rate, not writing vectors")
+	}
+	return writeParamVectors(*vectorsPath, policy, best.P, best.M,
+		vectorBlockList, vectorHeights)
+}
+
+// writeParamReport writes the candidates to w in the requested format.
+func writeParamReport(w io.Writer, format string,
+	candidates []*paramCandidate, best *paramCandidate) error {
+
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(candidates)
+
+	case "csv":
+		cw := csv.NewWriter(w)
+		header := append([]string{"m"}, statsHeader...)
+		header = append(header, "meets_target", "recommended")
+		if err := cw.Write(header); err != nil {
+			return err
+		}
+		for _, c := range candidates {
+			row := append([]string{strconv.FormatUint(c.M, 10)},
+				c.csvRow()...)
+			row = append(row, strconv.FormatBool(c.MeetsTarget),
+				strconv.FormatBool(c.Recommended))
+			if err := cw.Write(row); err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+
+	fmt.Fprintf(w, "%3s %12s %12s %10s %12s %12s\n", "P", "M", "bytes",
+		"bits/elt", "expected FP", "measured FP")
+	for _, c := range candidates {
+		mark := ""
+		switch {
+		case c.Recommended:
+			mark = " <- recommended"
+		case !c.MeetsTarget:
+			mark = " (above target)"
+		}
+		fmt.Fprintf(w, "%3d %12d %12d %10.4f %12.4g %12.4g%v\n", c.P,
+			c.M, c.Bytes, c.BitsPerElt, c.ExpectedFP, c.FPRate, mark)
+	}
+	if best == nil {
+		_, err := fmt.Fprintln(w, "\nNo candidate meets the target "+
+			"false positive rate; raise -maxp or the multipliers.")
+		return err
+	}
+	_, err := fmt.Fprintf(w, "\nRecommended: P = %d, M = %d (%.4f bits "+
+		"per element)\n", best.P, best.M, best.BitsPerElt)
+	return err
+}
+
+// writeParamVectors writes test vectors for the passed blocks built with the
+// chosen P and M, in the layout of the generator's vector files with added P
+// and M columns. The header chain starts from a zero previous header at the
+// first block.
+func writeParamVectors(path string, policy builder.FilterPolicy, p uint8,
+	m uint64, blocks []*wire.MsgBlock, heights []int64) error {
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := NewJSONTestWriter(file)
+	err = writer.WriteComment("Block Height,Block Hash,Block,P,M," +
+		"Previous Header,Filter,Header")
+	if err != nil {
+		return err
+	}
+
+	chain := builder.NewFilterHeaderChain(1)
+	for i, block := range blocks {
+		blockHash := block.BlockHash()
+		b := builder.WithKeyHashP(&blockHash, p).SetM(m)
+		policy.AddBlock(b, block)
+		filter, err := b.Build()
+		if err != nil {
+			return err
+		}
+		prevHeader := chain.TipHeader()
+		header, err := chain.Append(filter)
+		if err != nil {
+			return err
+		}
+
+		var blockBuf bytes.Buffer
+		if err := block.Serialize(&blockBuf); err != nil {
+			return err
+		}
+		nBytes, err := filter.NBytes()
+		if err != nil {
+			return err
+		}
+
+		err = writer.WriteTestCase([]interface{}{
+			heights[i],
+			blockHash.String(),
+			hex.EncodeToString(blockBuf.Bytes()),
+			p,
+			m,
+			prevHeader.String(),
+			hex.EncodeToString(nBytes),
+			header.String(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return writer.Close()
+}
@@ -0,0 +1,204 @@
+package prevout
+
+import (
+	"errors"
+	"io"
+
+	"github.com/christsim/bips/bip-0158/backend/btcec"
+	"github.com/christsim/bips/bip-0158/backend/txscript"
+	"github.com/christsim/bips/bip-0158/backend/wire"
+)
+
+var (
+	// ErrVarIntOverflow is returned when a Core-style VARINT doesn't fit in
+	// 64 bits.
+	ErrVarIntOverflow = errors.New("varint overflows uint64")
+
+	// ErrScriptTooLarge is returned when a compressed script claims to be
+	// larger than the maximum script size.
+	ErrScriptTooLarge = errors.New("compressed script too large")
+)
+
+// maxScriptSize is the largest script Core will deserialize from its
+// compressed form. Anything larger is replaced by a single OP_RETURN.
+const maxScriptSize = 10000
+
+// numSpecialScripts is the number of script templates with a special
+// compressed encoding.
+const numSpecialScripts = 6
+
+// readVarInt reads a VARINT as used in Core's undo and chainstate
+// serialization. Unlike the CompactSize used on the wire, it is a big endian
+// base-128 encoding where each continuation byte also adds one, so that every
+// value has exactly one encoding.
+func readVarInt(r io.ByteReader) (uint64, error) {
+	var n uint64
+	for {
+		ch, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if n > (1<<64-1)>>7 {
+			return 0, ErrVarIntOverflow
+		}
+		n = n<<7 | uint64(ch&0x7f)
+		if ch&0x80 == 0 {
+			return n, nil
+		}
+		if n == 1<<64-1 {
+			return 0, ErrVarIntOverflow
+		}
+		n++
+	}
+}
+
+// decompressAmount reverses Core's CompressAmount, which strips trailing
+// decimal zeros from satoshi values.
+func decompressAmount(x uint64) uint64 {
+	if x == 0 {
+		return 0
+	}
+	x--
+
+	// x = 10*(9*n + d - 1) + e
+	e := x % 10
+	x /= 10
+	var n uint64
+	if e < 9 {
+		// x = 9*n + d - 1
+		d := x%9 + 1
+		x /= 9
+		n = x*10 + d
+	} else {
+		n = x + 1
+	}
+	for ; e > 0; e-- {
+		n *= 10
+	}
+
+	return n
+}
+
+// readCompressedScript reads a script in the compressed form Core uses in
+// undo data and the UTXO set. The six most common templates are stored as a type followed by
+// just their hash or key, and other scripts as their length plus six
+// followed by the script itself.
+func readCompressedScript(r reader) ([]byte, error) {
+	size, err := readVarInt(r)
+	if err != nil {
+		return nil, err
+	}
+
+	switch size {
+	// Pay-to-pubkey-hash.
+	case 0:
+		script := make([]byte, 25)
+		script[0] = txscript.OP_DUP
+		script[1] = txscript.OP_HASH160
+		script[2] = txscript.OP_DATA_20
+		if _, err := io.ReadFull(r, script[3:23]); err != nil {
+			return nil, err
+		}
+		script[23] = txscript.OP_EQUALVERIFY
+		script[24] = txscript.OP_CHECKSIG
+		return script, nil
+
+	// Pay-to-script-hash.
+	case 1:
+		script := make([]byte, 23)
+		script[0] = txscript.OP_HASH160
+		script[1] = txscript.OP_DATA_20
+		if _, err := io.ReadFull(r, script[2:22]); err != nil {
+			return nil, err
+		}
+		script[22] = txscript.OP_EQUAL
+		return script, nil
+
+	// Pay-to-pubkey with a compressed key, where the type is the key's
+	// prefix byte.
+	case 2, 3:
+		script := make([]byte, 35)
+		script[0] = txscript.OP_DATA_33
+		script[1] = byte(size)
+		if _, err := io.ReadFull(r, script[2:34]); err != nil {
+			return nil, err
+		}
+		script[34] = txscript.OP_CHECKSIG
+		return script, nil
+
+	// Pay-to-pubkey with an uncompressed key, stored compressed with the
+	// type minus two as its prefix byte.
+	case 4, 5:
+		var compressed [33]byte
+		compressed[0] = byte(size - 2)
+		if _, err := io.ReadFull(r, compressed[1:]); err != nil {
+			return nil, err
+		}
+		pubKey, err := btcec.ParsePubKey(compressed[:])
+		if err != nil {
+			return nil, err
+		}
+		script := make([]byte, 0, 67)
+		script = append(script, txscript.OP_DATA_65)
+		script = append(script, pubKey.SerializeUncompressed()...)
+		script = append(script, txscript.OP_CHECKSIG)
+		return script, nil
+	}
+
+	size -= numSpecialScripts
+	if size > maxScriptSize {
+		return nil, ErrScriptTooLarge
+	}
+	script := make([]byte, size)
+	if _, err := io.ReadFull(r, script); err != nil {
+		return nil, err
+	}
+
+	return script, nil
+}
+
+// readTxInUndo reads the spent output of a single input from undo data.
+func readTxInUndo(r reader) (*wire.TxOut, error) {
+	// The code packs the height of the block that created the output
+	// together with whether it was a coinbase.
+	code, err := readVarInt(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Outputs not from the genesis block are followed by a dummy
+	// transaction version kept for compatibility with the old format.
+	if code>>1 > 0 {
+		if _, err := readVarInt(r); err != nil {
+			return nil, err
+		}
+	}
+
+	return readCompressedTxOut(r)
+}
+
+// readCoin reads an unspent output as serialized in Core's chainstate and
+// UTXO snapshots.
+func readCoin(r reader) (*wire.TxOut, error) {
+	// The code packs the height of the block that created the output
+	// together with whether it was a coinbase, neither of which we need.
+	if _, err := readVarInt(r); err != nil {
+		return nil, err
+	}
+
+	return readCompressedTxOut(r)
+}
+
+// readCompressedTxOut reads an output with a compressed amount and script.
+func readCompressedTxOut(r reader) (*wire.TxOut, error) {
+	amount, err := readVarInt(r)
+	if err != nil {
+		return nil, err
+	}
+	script, err := readCompressedScript(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return wire.NewTxOut(int64(decompressAmount(amount)), script), nil
+}
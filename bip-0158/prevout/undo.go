@@ -0,0 +1,331 @@
+// Package prevout resolves the output scripts spent by the inputs of a block,
+// which BIP 158 basic filters include but blocks themselves don't contain.
+//
+// UndoResolver reads them from the undo files (rev*.dat) Bitcoin Core keeps
+// alongside its block files, which avoids an RPC round trip per input and
+// works offline. UTXOIndex instead looks them up in an on-disk copy of the
+// UTXO set imported from a dumptxoutset snapshot, for nodes that have neither
+// a transaction index nor undo data.
+package prevout
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/christsim/bips/bip-0158/backend/chainhash"
+	"github.com/christsim/bips/bip-0158/backend/wire"
+)
+
+var (
+	// ErrUndoNotFound is returned when no undo record in the undo files
+	// belongs to the requested block.
+	ErrUndoNotFound = errors.New("undo data not found for block")
+
+	// ErrUndoMismatch is returned when an undo record doesn't have one
+	// spent output for each input of the block it belongs to.
+	ErrUndoMismatch = errors.New("undo data doesn't match block")
+
+	// ErrBadMagic is returned when an undo record doesn't start with the
+	// network's magic bytes.
+	ErrBadMagic = errors.New("undo record has wrong network magic")
+)
+
+// maxPendingUndo is the most undo records UndoResolver keeps around while
+// looking for the one belonging to a block. Records are written as blocks are
+// connected, so they're normally consumed in order and only blocks from
+// reorganizations are ever skipped.
+const maxPendingUndo = 1024
+
+// reader is satisfied by the readers undo data is decoded from.
+type reader interface {
+	io.Reader
+	io.ByteReader
+}
+
+// undoRecord is a single block's undo data along with its checksum, which
+// commits to the hash of the block's parent.
+type undoRecord struct {
+	data     []byte
+	checksum chainhash.Hash
+}
+
+// belongsTo returns true if the record is the undo data of the child of the
+// block with the passed hash.
+func (u *undoRecord) belongsTo(prevHash *chainhash.Hash) bool {
+	preimage := make([]byte, 0, chainhash.HashSize+len(u.data))
+	preimage = append(preimage, prevHash[:]...)
+	preimage = append(preimage, u.data...)
+	return chainhash.DoubleHashH(preimage) == u.checksum
+}
+
+// UndoResolver resolves the output scripts spent by a block from the undo
+// files in a Bitcoin Core blocks directory. Blocks are expected to be
+// resolved roughly in the order they were connected, as when walking the
+// chain by height.
+type UndoResolver struct {
+	dir    string
+	net    wire.BitcoinNet
+	xorKey []byte
+
+	fileNum int
+	file    *os.File
+	r       *bufio.Reader
+	offset  int64
+
+	pending []*undoRecord
+}
+
+// NewUndoResolver returns a resolver reading the undo files in blocksDir,
+// which must belong to the passed network. If the directory has an xor.dat
+// file, as created by newer versions of Core, the files are deobfuscated
+// with its key.
+func NewUndoResolver(blocksDir string,
+	net wire.BitcoinNet) (*UndoResolver, error) {
+
+	r := &UndoResolver{dir: blocksDir, net: net}
+
+	key, err := os.ReadFile(filepath.Join(blocksDir, "xor.dat"))
+	switch {
+	case err == nil:
+		// An all-zero key means the files aren't obfuscated.
+		if !bytes.Equal(key, make([]byte, len(key))) {
+			r.xorKey = key
+		}
+	case !os.IsNotExist(err):
+		return nil, err
+	}
+
+	if err := r.openFile(0); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Close closes the undo file currently being read.
+func (r *UndoResolver) Close() error {
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
+
+// PrevOutputs returns the outputs spent by each non-coinbase transaction of
+// the block, with one slice per transaction holding one output per input.
+func (r *UndoResolver) PrevOutputs(block *wire.MsgBlock) ([][]*wire.TxOut,
+	error) {
+
+	// The genesis block spends nothing and has no undo data.
+	if block.Header.PrevBlock == (chainhash.Hash{}) {
+		return nil, nil
+	}
+
+	record, err := r.findRecord(&block.Header.PrevBlock)
+	if err != nil {
+		return nil, err
+	}
+	spent, err := DecodeBlockUndo(record.data)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(spent) != len(block.Transactions)-1 {
+		return nil, fmt.Errorf("%w: %d transactions spend outputs, "+
+			"undo data has %d", ErrUndoMismatch,
+			len(block.Transactions)-1, len(spent))
+	}
+	for i, tx := range block.Transactions[1:] {
+		if len(spent[i]) != len(tx.TxIn) {
+			return nil, fmt.Errorf("%w: transaction %v has %d "+
+				"inputs, undo data has %d", ErrUndoMismatch,
+				tx.TxHash(), len(tx.TxIn), len(spent[i]))
+		}
+	}
+
+	return spent, nil
+}
+
+// PrevScripts returns the output scripts spent by the inputs of the block's
+// non-coinbase transactions, in order.
+func (r *UndoResolver) PrevScripts(block *wire.MsgBlock) ([][]byte, error) {
+	spent, err := r.PrevOutputs(block)
+	if err != nil {
+		return nil, err
+	}
+
+	var scripts [][]byte
+	for _, txOuts := range spent {
+		for _, txOut := range txOuts {
+			scripts = append(scripts, txOut.PkScript)
+		}
+	}
+
+	return scripts, nil
+}
+
+// findRecord returns the undo record of the child of the block with the
+// passed hash, reading further into the undo files if it hasn't been seen
+// yet.
+func (r *UndoResolver) findRecord(prevHash *chainhash.Hash) (*undoRecord,
+	error) {
+
+	for i, record := range r.pending {
+		if record.belongsTo(prevHash) {
+			r.pending = append(r.pending[:i], r.pending[i+1:]...)
+			return record, nil
+		}
+	}
+
+	for {
+		record, err := r.nextRecord()
+		if err == io.EOF {
+			return nil, fmt.Errorf("%w: child of %v", ErrUndoNotFound,
+				prevHash)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if record.belongsTo(prevHash) {
+			return record, nil
+		}
+
+		if len(r.pending) == maxPendingUndo {
+			r.pending = r.pending[1:]
+		}
+		r.pending = append(r.pending, record)
+	}
+}
+
+// nextRecord reads the next undo record, moving on to the next undo file at
+// the end of each one. io.EOF is returned once there are no more files.
+func (r *UndoResolver) nextRecord() (*undoRecord, error) {
+	for r.file != nil {
+		var header [8]byte
+		_, err := r.read(header[:])
+		// Files are preallocated with zeros, so a zero magic also
+		// marks the end of the data.
+		if err == io.EOF || err == io.ErrUnexpectedEOF ||
+			err == nil && binary.LittleEndian.Uint32(header[:4]) == 0 {
+
+			if err := r.openFile(r.fileNum + 1); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		magic := wire.BitcoinNet(binary.LittleEndian.Uint32(header[:4]))
+		if magic != r.net {
+			return nil, fmt.Errorf("%w: %v in %v", ErrBadMagic, magic,
+				r.file.Name())
+		}
+
+		size := binary.LittleEndian.Uint32(header[4:])
+		if size > wire.MaxBlockPayload {
+			return nil, fmt.Errorf("undo record of %d bytes in %v is "+
+				"too large", size, r.file.Name())
+		}
+		record := &undoRecord{data: make([]byte, size)}
+		if _, err := r.read(record.data); err != nil {
+			return nil, err
+		}
+		if _, err := r.read(record.checksum[:]); err != nil {
+			return nil, err
+		}
+
+		return record, nil
+	}
+
+	return nil, io.EOF
+}
+
+// openFile closes the current undo file and opens the one with the passed
+// number. If it doesn't exist, the resolver is left without a file.
+func (r *UndoResolver) openFile(num int) error {
+	if err := r.Close(); err != nil {
+		return err
+	}
+
+	name := filepath.Join(r.dir, fmt.Sprintf("rev%05d.dat", num))
+	file, err := os.Open(name)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	r.fileNum = num
+	r.file = file
+	r.r = bufio.NewReader(file)
+	r.offset = 0
+
+	return nil
+}
+
+// read fills buf from the current undo file, deobfuscating it if needed.
+func (r *UndoResolver) read(buf []byte) (int, error) {
+	n, err := io.ReadFull(r.r, buf)
+	if r.xorKey != nil {
+		for i := 0; i < n; i++ {
+			buf[i] ^= r.xorKey[(r.offset+int64(i))%int64(len(r.xorKey))]
+		}
+	}
+	r.offset += int64(n)
+
+	return n, err
+}
+
+// DecodeBlockUndo decodes the serialized undo data of a block, returning the
+// outputs spent by each of its non-coinbase transactions.
+func DecodeBlockUndo(data []byte) ([][]*wire.TxOut, error) {
+	r := bytes.NewReader(data)
+
+	numTxs, err := wire.ReadVarInt(r, 0)
+	if err != nil {
+		return nil, err
+	}
+	// Each transaction takes at least a byte, so a larger count can't be
+	// valid and mustn't be used to size allocations.
+	if numTxs > uint64(r.Len()) {
+		return nil, fmt.Errorf("undo data claims %d transactions in %d "+
+			"bytes", numTxs, r.Len())
+	}
+
+	spent := make([][]*wire.TxOut, numTxs)
+	for i := range spent {
+		numIns, err := wire.ReadVarInt(r, 0)
+		if err != nil {
+			return nil, err
+		}
+		if numIns > uint64(r.Len()) {
+			return nil, fmt.Errorf("undo data claims %d inputs in %d "+
+				"bytes", numIns, r.Len())
+		}
+
+		spent[i] = make([]*wire.TxOut, numIns)
+		for j := range spent[i] {
+			spent[i][j], err = readTxInUndo(r)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if r.Len() != 0 {
+		return nil, fmt.Errorf("%d trailing bytes after undo data",
+			r.Len())
+	}
+
+	return spent, nil
+}
@@ -0,0 +1,391 @@
+package prevout
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/goleveldb/leveldb"
+	"github.com/christsim/bips/bip-0158/backend/chainhash"
+	"github.com/christsim/bips/bip-0158/backend/txscript"
+	"github.com/christsim/bips/bip-0158/backend/wire"
+)
+
+var (
+	// ErrMissingPrevOut is returned when an input spends an output that
+	// isn't in the UTXO index.
+	ErrMissingPrevOut = errors.New("spent output not in UTXO index")
+
+	// ErrNotNextBlock is returned when resolving a block that doesn't
+	// extend the block the UTXO index is at.
+	ErrNotNextBlock = errors.New("block doesn't extend UTXO index tip")
+
+	// ErrBadSnapshot is returned when a UTXO snapshot is malformed or for
+	// a different network.
+	ErrBadSnapshot = errors.New("malformed UTXO snapshot")
+)
+
+// snapshotMagic starts the metadata of UTXO snapshots written by Bitcoin Core
+// 28 and later. Earlier snapshots start directly with the base block hash.
+var snapshotMagic = []byte{'u', 't', 'x', 'o', 0xff}
+
+// utxoBatchSize is the number of outputs written to the index at a time while
+// importing.
+const utxoBatchSize = 100000
+
+var (
+	// utxoPrefix prefixes the key of every output in the index, which is
+	// followed by the txid and the big endian output index.
+	utxoPrefix = []byte{'u'}
+
+	// tipKey holds the hash of the block the index is at.
+	tipKey = []byte("tip")
+)
+
+// utxoKey returns the index key of the passed outpoint.
+func utxoKey(outpoint *wire.OutPoint) []byte {
+	key := make([]byte, 0, len(utxoPrefix)+chainhash.HashSize+4)
+	key = append(key, utxoPrefix...)
+	key = append(key, outpoint.Hash[:]...)
+	return binary.BigEndian.AppendUint32(key, outpoint.Index)
+}
+
+// utxoValue serializes an output for the index as its little endian amount
+// followed by its script.
+func utxoValue(txOut *wire.TxOut) []byte {
+	value := make([]byte, 8, 8+len(txOut.PkScript))
+	binary.LittleEndian.PutUint64(value, uint64(txOut.Value))
+	return append(value, txOut.PkScript...)
+}
+
+// UTXOIndex is an on-disk UTXO set used to resolve the outputs spent by
+// blocks. It is seeded from a UTXO snapshot, or left empty to be built up from
+// the genesis block, and then kept current by resolving each following block
+// in order.
+type UTXOIndex struct {
+	db *leveldb.DB
+}
+
+// OpenUTXOIndex opens the UTXO index at the passed path, creating an empty one
+// if it doesn't exist.
+func OpenUTXOIndex(path string) (*UTXOIndex, error) {
+	db, err := leveldb.OpenFile(path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &UTXOIndex{db: db}, nil
+}
+
+// Close closes the index.
+func (u *UTXOIndex) Close() error {
+	return u.db.Close()
+}
+
+// Tip returns the hash of the block the index is at, which is the zero hash
+// for an empty index that is yet to resolve the genesis block.
+func (u *UTXOIndex) Tip() (chainhash.Hash, error) {
+	var tip chainhash.Hash
+	value, err := u.db.Get(tipKey, nil)
+	if err == leveldb.ErrNotFound {
+		return tip, nil
+	}
+	if err != nil {
+		return tip, err
+	}
+	copy(tip[:], value)
+
+	return tip, nil
+}
+
+// ImportSnapshot loads a UTXO snapshot as written by Bitcoin Core's
+// dumptxoutset RPC into the index, which must belong to the passed network,
+// and returns the hash of the block the snapshot was taken at. Both the
+// format of Core 28 and later, which groups outputs by transaction, and the
+// earlier one are supported.
+func (u *UTXOIndex) ImportSnapshot(r io.Reader,
+	net wire.BitcoinNet) (*chainhash.Hash, error) {
+
+	br := bufio.NewReaderSize(r, 1<<20)
+
+	grouped := false
+	prefix, err := br.Peek(len(snapshotMagic))
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Equal(prefix, snapshotMagic) {
+		var header [11]byte
+		if _, err := io.ReadFull(br, header[:]); err != nil {
+			return nil, err
+		}
+		version := binary.LittleEndian.Uint16(header[5:7])
+		if version != 2 {
+			return nil, fmt.Errorf("%w: unsupported version %d",
+				ErrBadSnapshot, version)
+		}
+		magic := wire.BitcoinNet(binary.LittleEndian.Uint32(header[7:]))
+		if magic != net {
+			return nil, fmt.Errorf("%w: snapshot is for network %v",
+				ErrBadSnapshot, magic)
+		}
+		grouped = true
+	}
+
+	var base chainhash.Hash
+	if _, err := io.ReadFull(br, base[:]); err != nil {
+		return nil, err
+	}
+	var count uint64
+	if err := binary.Read(br, binary.LittleEndian, &count); err != nil {
+		return nil, err
+	}
+
+	batch := new(leveldb.Batch)
+	put := func(outpoint *wire.OutPoint, txOut *wire.TxOut) error {
+		batch.Put(utxoKey(outpoint), utxoValue(txOut))
+		if batch.Len() < utxoBatchSize {
+			return nil
+		}
+		err := u.db.Write(batch, nil)
+		batch.Reset()
+		return err
+	}
+
+	var outpoint wire.OutPoint
+	for read := uint64(0); read < count; {
+		// Newer snapshots write each txid once followed by the number
+		// of its outputs, older ones repeat it for every output.
+		coins := uint64(1)
+		if _, err := io.ReadFull(br, outpoint.Hash[:]); err != nil {
+			return nil, err
+		}
+		if grouped {
+			coins, err = wire.ReadVarInt(br, 0)
+			if err != nil {
+				return nil, err
+			}
+			if coins == 0 || coins > count-read {
+				return nil, fmt.Errorf("%w: transaction %v has %d "+
+					"outputs", ErrBadSnapshot, outpoint.Hash,
+					coins)
+			}
+		}
+
+		for i := uint64(0); i < coins; i++ {
+			if grouped {
+				index, err := wire.ReadVarInt(br, 0)
+				if err != nil {
+					return nil, err
+				}
+				outpoint.Index = uint32(index)
+			} else {
+				err := binary.Read(br, binary.LittleEndian,
+					&outpoint.Index)
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			txOut, err := readCoin(br)
+			if err != nil {
+				return nil, err
+			}
+			if err := put(&outpoint, txOut); err != nil {
+				return nil, err
+			}
+		}
+		read += coins
+	}
+
+	batch.Put(tipKey, base[:])
+	if err := u.db.Write(batch, nil); err != nil {
+		return nil, err
+	}
+
+	return &base, nil
+}
+
+// ImportCSV loads a UTXO set from CSV into the index and marks it as being at
+// the passed block. The first row must name the columns, of which txid, vout,
+// amount (in satoshis) and script (hex encoded, also accepted as
+// scriptpubkey) are used and any others ignored.
+func (u *UTXOIndex) ImportCSV(r io.Reader, base *chainhash.Hash) error {
+	cr := csv.NewReader(bufio.NewReader(r))
+	cr.ReuseRecord = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return err
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["script"]; !ok {
+		if i, ok := columns["scriptpubkey"]; ok {
+			columns["script"] = i
+		}
+	}
+	for _, name := range []string{"txid", "vout", "amount", "script"} {
+		if _, ok := columns[name]; !ok {
+			return fmt.Errorf("CSV has no %v column", name)
+		}
+	}
+
+	batch := new(leveldb.Batch)
+	for line := 2; ; line++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		txid, err := chainhash.NewHashFromStr(record[columns["txid"]])
+		if err != nil {
+			return fmt.Errorf("line %d: %v", line, err)
+		}
+		vout, err := strconv.ParseUint(record[columns["vout"]], 10, 32)
+		if err != nil {
+			return fmt.Errorf("line %d: %v", line, err)
+		}
+		amount, err := strconv.ParseInt(record[columns["amount"]], 10, 64)
+		if err != nil {
+			return fmt.Errorf("line %d: %v", line, err)
+		}
+		script, err := hex.DecodeString(record[columns["script"]])
+		if err != nil {
+			return fmt.Errorf("line %d: %v", line, err)
+		}
+
+		outpoint := wire.OutPoint{Hash: *txid, Index: uint32(vout)}
+		batch.Put(utxoKey(&outpoint), utxoValue(wire.NewTxOut(amount,
+			script)))
+		if batch.Len() >= utxoBatchSize {
+			if err := u.db.Write(batch, nil); err != nil {
+				return err
+			}
+			batch.Reset()
+		}
+	}
+
+	batch.Put(tipKey, base[:])
+	return u.db.Write(batch, nil)
+}
+
+// PrevOutputs returns the outputs spent by each non-coinbase transaction of
+// the block, with one slice per transaction holding one output per input. The
+// block must extend the index's tip, which the index then moves on to by
+// removing the spent outputs and adding the created ones.
+func (u *UTXOIndex) PrevOutputs(block *wire.MsgBlock) ([][]*wire.TxOut,
+	error) {
+
+	tip, err := u.Tip()
+	if err != nil {
+		return nil, err
+	}
+	if block.Header.PrevBlock != tip {
+		return nil, fmt.Errorf("%w: block %v builds on %v, index is "+
+			"at %v", ErrNotNextBlock, block.BlockHash(),
+			block.Header.PrevBlock, tip)
+	}
+
+	// Outputs created earlier in the block may be spent later in it, so
+	// they are tracked until the batch is written.
+	created := make(map[wire.OutPoint]*wire.TxOut)
+	batch := new(leveldb.Batch)
+	spent := make([][]*wire.TxOut, 0, len(block.Transactions)-1)
+	for i, tx := range block.Transactions {
+		// Skip the inputs for the coinbase transaction
+		if i != 0 {
+			txSpent := make([]*wire.TxOut, len(tx.TxIn))
+			for j, txIn := range tx.TxIn {
+				txSpent[j], err = u.spend(&txIn.PreviousOutPoint,
+					created, batch)
+				if err != nil {
+					return nil, err
+				}
+			}
+			spent = append(spent, txSpent)
+		}
+
+		txHash := tx.TxHash()
+		for j, txOut := range tx.TxOut {
+			// Provably unspendable outputs never enter the UTXO
+			// set.
+			if len(txOut.PkScript) > 0 &&
+				txOut.PkScript[0] == txscript.OP_RETURN {
+
+				continue
+			}
+
+			outpoint := wire.OutPoint{Hash: txHash, Index: uint32(j)}
+			created[outpoint] = txOut
+			batch.Put(utxoKey(&outpoint), utxoValue(txOut))
+		}
+	}
+
+	blockHash := block.BlockHash()
+	batch.Put(tipKey, blockHash[:])
+	if err := u.db.Write(batch, nil); err != nil {
+		return nil, err
+	}
+
+	return spent, nil
+}
+
+// spend looks up the output spent by an input, first among those created
+// earlier in the same block, and records its removal from the index.
+func (u *UTXOIndex) spend(outpoint *wire.OutPoint,
+	created map[wire.OutPoint]*wire.TxOut,
+	batch *leveldb.Batch) (*wire.TxOut, error) {
+
+	key := utxoKey(outpoint)
+	if txOut, ok := created[*outpoint]; ok {
+		delete(created, *outpoint)
+		batch.Delete(key)
+		return txOut, nil
+	}
+
+	value, err := u.db.Get(key, nil)
+	if err == leveldb.ErrNotFound {
+		return nil, fmt.Errorf("%w: %v", ErrMissingPrevOut, outpoint)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(value) < 8 {
+		return nil, fmt.Errorf("corrupt UTXO index entry for %v",
+			outpoint)
+	}
+	batch.Delete(key)
+
+	amount := int64(binary.LittleEndian.Uint64(value))
+	return wire.NewTxOut(amount, value[8:]), nil
+}
+
+// PrevScripts returns the output scripts spent by the inputs of the block's
+// non-coinbase transactions, in order, moving the index on to the block.
+func (u *UTXOIndex) PrevScripts(block *wire.MsgBlock) ([][]byte, error) {
+	spent, err := u.PrevOutputs(block)
+	if err != nil {
+		return nil, err
+	}
+
+	var scripts [][]byte
+	for _, txOuts := range spent {
+		for _, txOut := range txOuts {
+			scripts = append(scripts, txOut.PkScript)
+		}
+	}
+
+	return scripts, nil
+}
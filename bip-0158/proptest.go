@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"flag"
+	"fmt"
+
+	"github.com/christsim/bips/bip-0158/blockgen"
+	"github.com/christsim/bips/bip-0158/gcs"
+)
+
+// runPropTest implements the proptest subcommand, which checks the filter
+// invariants of the blockgen package against random blocks for a range of
+// values of P. The first offending block is printed so that it can be turned
+// into a regression vector.
+func runPropTest(args []string) error {
+	fs := flag.NewFlagSet("proptest", flag.ContinueOnError)
+	seed := fs.Int64("seed", 1, "seed for the random blocks")
+	blocks := fs.Int("blocks", 1000, "number of random blocks to check at "+
+		"each value of P")
+	minP := fs.Uint("minp", 1, "smallest value of P to check")
+	maxP := fs.Uint("maxp", 32, "largest value of P to check")
+	maxTxs := fs.Int("maxtxs", blockgen.DefaultConfig.MaxTxs, "maximum "+
+		"number of transactions per block")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *minP > gcs.MaxP || *maxP > gcs.MaxP || *minP > *maxP {
+		return fmt.Errorf("invalid P range %d-%d", *minP, *maxP)
+	}
+
+	cfg := blockgen.DefaultConfig
+	cfg.MaxTxs = *maxTxs
+	for p := *minP; p <= *maxP; p++ {
+		block, err := blockgen.CheckRandom(*seed, cfg, *blocks, uint8(p))
+		if err != nil {
+			var buf bytes.Buffer
+			if block.Serialize(&buf) == nil {
+				fmt.Printf("Offending block: %v\n",
+					hex.EncodeToString(buf.Bytes()))
+			}
+			return fmt.Errorf("P = %d: %v", p, err)
+		}
+		fmt.Printf("P = %d: %d blocks OK\n", p, *blocks)
+	}
+
+	return nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/christsim/bips/bip-0158/gcs/builder"
+	"github.com/christsim/bips/bip-0158/generator"
+	"github.com/christsim/bips/bip-0158/regtestharness"
+)
+
+// runRegtest implements the regtest subcommand, which launches a regtest node,
+// mines the edge case blocks of the regtestharness package on it and writes
+// vectors for them, in the layout of the testnet vectors, to regtest-XX.json
+// files. The blocks don't depend on the node or on when they are mined, so
+// neither do the vectors. Other cases can be described in a scenario file
+// passed with -scenarios.
+func runRegtest(args []string) error {
+	fs := flag.NewFlagSet("regtest", flag.ContinueOnError)
+	bitcoind := fs.String("bitcoind", "", "path of the bitcoind binary "+
+		"to mine the blocks with")
+	btcd := fs.String("btcd", "", "path of the btcd binary to mine the "+
+		"blocks with, instead of -bitcoind")
+	dataDir := fs.String("datadir", "", "data directory of the node, "+
+		"which must not hold any blocks (default a temporary directory)")
+	policyList := fs.String("policies", defaultPolicies, "comma separated "+
+		"list of filter policies to generate vectors for, out of "+
+		strings.Join(builder.PolicyNames(), ", "))
+	includeTypes := fs.String("include-types", "", "comma separated list "+
+		"of output script types to include in the basic filter, e.g. "+
+		"p2tr (default all)")
+	scenarioFile := fs.String("scenarios", "", "JSON file of scenarios "+
+		"to mine instead of the built-in cases, as described in the "+
+		"regtestharness package")
+	outDir := fs.String("out", "regtestvectors", "directory to write the "+
+		"vectors to, which must not exist")
+	verbose := fs.Bool("v", false, "show the node's output")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg := regtestharness.Config{DataDir: *dataDir}
+	switch {
+	case *bitcoind != "" && *btcd != "":
+		return fmt.Errorf("only one of -bitcoind and -btcd may be set")
+	case *bitcoind != "":
+		cfg.Implementation = regtestharness.Bitcoind
+		cfg.Path = *bitcoind
+	case *btcd != "":
+		cfg.Implementation = regtestharness.Btcd
+		cfg.Path = *btcd
+	default:
+		return fmt.Errorf("one of -bitcoind and -btcd must be set")
+	}
+	if *verbose {
+		cfg.Output = os.Stderr
+	}
+
+	cases := regtestharness.DefaultCases
+	if *scenarioFile != "" {
+		file, err := os.Open(*scenarioFile)
+		if err != nil {
+			return err
+		}
+		scenarios, err := regtestharness.ParseScenarios(file)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("invalid scenarios: %v", err)
+		}
+		cases, err = regtestharness.ScenarioCases(scenarios)
+		if err != nil {
+			return err
+		}
+	}
+
+	scriptTypes := builder.AllScriptTypes
+	if *includeTypes != "" {
+		var err error
+		scriptTypes, err = builder.ParseScriptTypeSet(*includeTypes)
+		if err != nil {
+			return fmt.Errorf("invalid script types: %v", err)
+		}
+	}
+	policies, err := parsePolicies(*policyList, scriptTypes, nil)
+	if err != nil {
+		return fmt.Errorf("invalid filter policies: %v", err)
+	}
+	// Don't overwrite existing output if any.
+	if err := os.Mkdir(*outDir, os.ModeDir|0755); err != nil {
+		return err
+	}
+	vf, err := createVectorFiles(*outDir, "regtest", vectorColumns(policies))
+	if err != nil {
+		return err
+	}
+	defer vf.Close()
+
+	node, err := regtestharness.Start(cfg)
+	if err != nil {
+		return err
+	}
+	defer node.Stop()
+
+	testBlocks, err := regtestharness.Run(node, cases)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Mined %d blocks\n", testBlocks[len(testBlocks)-1].Height)
+
+	gen := generator.New(generator.Config{
+		Source:     node,
+		Policies:   policies,
+		TestBlocks: testBlocks,
+		Hooks: generator.Hooks{
+			OnBlockProcessed: func(e *generator.BlockEvent) error {
+				if e.TestBlock == nil {
+					return nil
+				}
+				fmt.Printf("Height: %d (%v)\n", e.Height,
+					e.TestBlock.Comment)
+				return writeTestBlock(e, vf.files, vf.invalid,
+					vf.match)
+			},
+		},
+	})
+	return gen.Run()
+}
@@ -0,0 +1,209 @@
+package regtestharness
+
+import (
+	"bytes"
+
+	"github.com/christsim/bips/bip-0158/backend/txscript"
+	"github.com/christsim/bips/bip-0158/backend/wire"
+)
+
+// Case is a block mined by the harness to exercise an edge case of filter
+// construction.
+type Case struct {
+	// Name identifies the case.
+	Name string
+
+	// Comment is written to the notes column of the block's vectors.
+	Comment string
+
+	// Txs returns the transactions of the block after its coinbase. It
+	// may return none for a block holding only the coinbase.
+	Txs func(m *Miner) ([]*wire.MsgTx, error)
+}
+
+// DefaultCases are the cases mined by Run unless others are passed.
+var DefaultCases = []Case{
+	{
+		Name:    "coinbase-only",
+		Comment: "Coinbase only, paying to P2WSH",
+		Txs: func(m *Miner) ([]*wire.MsgTx, error) {
+			return nil, nil
+		},
+	},
+	{
+		Name:    "unparseable-scripts",
+		Comment: "Unparseable, empty and OP_RETURN output scripts",
+		Txs:     unparseableScripts,
+	},
+	{
+		Name:    "duplicate-scripts",
+		Comment: "Same output script created by several transactions",
+		Txs:     duplicateScripts,
+	},
+	{
+		Name:    "taproot-spend",
+		Comment: "Taproot output spent through its script path",
+		Txs:     taprootSpend,
+	},
+	{
+		Name:    "taproot-key-spend",
+		Comment: "Taproot output spent through its key path",
+		Txs:     taprootKeySpend,
+	},
+	{
+		Name:    "taproot-annex",
+		Comment: "Taproot key and script path spends with an annex",
+		Txs:     taprootAnnex,
+	},
+	{
+		Name:    "huge-witness",
+		Comment: "Witness of over 100 kB",
+		Txs:     hugeWitness,
+	},
+}
+
+// unparseableScripts creates outputs whose scripts end in the middle of a
+// push, which parsers must tolerate since output scripts are never checked
+// until spent, along with an empty script and an OP_RETURN script that the
+// final BIP 158 basic filter leaves out.
+func unparseableScripts(m *Miner) ([]*wire.MsgTx, error) {
+	tx, err := m.Spend(
+		wire.NewTxOut(1000, []byte{txscript.OP_PUSHDATA1, 0x10, 1, 2,
+			3}),
+		wire.NewTxOut(1000, []byte{txscript.OP_DATA_20, 1}),
+		wire.NewTxOut(1000, nil),
+		wire.NewTxOut(0, []byte{txscript.OP_RETURN, txscript.OP_DATA_1,
+			0x2a}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return []*wire.MsgTx{tx}, nil
+}
+
+// duplicateScripts creates the same output script several times within a
+// transaction and across transactions, which must only be put into filters
+// once.
+func duplicateScripts(m *Miner) ([]*wire.MsgTx, error) {
+	script := PayToWitnessScriptHash([]byte{txscript.OP_2, txscript.OP_2,
+		txscript.OP_EQUAL})
+
+	var txs []*wire.MsgTx
+	for i := 0; i < 2; i++ {
+		tx, err := m.Spend(wire.NewTxOut(1000, script),
+			wire.NewTxOut(2000, script))
+		if err != nil {
+			return nil, err
+		}
+		txs = append(txs, tx)
+	}
+	return txs, nil
+}
+
+// spendOutput returns a transaction spending the first output of prevTx with
+// the passed witness to AnyoneCanSpendScript.
+func spendOutput(prevTx *wire.MsgTx, witness wire.TxWitness) *wire.MsgTx {
+	tx := wire.NewMsgTx(2)
+	tx.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: wire.OutPoint{Hash: prevTx.TxHash()},
+		Witness:          witness,
+		Sequence:         wire.MaxTxInSequenceNum,
+	})
+	tx.AddTxOut(wire.NewTxOut(prevTx.TxOut[0].Value, AnyoneCanSpendScript))
+	return tx
+}
+
+// hugeWitness spends a P2WSH output whose witness script drops 200 stack
+// items, each of the maximum 520 bytes consensus allows.
+func hugeWitness(m *Miner) ([]*wire.MsgTx, error) {
+	const items = 200
+	witnessScript := append(bytes.Repeat([]byte{txscript.OP_2DROP},
+		items/2), txscript.OP_TRUE)
+
+	fund, err := m.Spend(wire.NewTxOut(100000,
+		PayToWitnessScriptHash(witnessScript)))
+	if err != nil {
+		return nil, err
+	}
+
+	witness := make(wire.TxWitness, 0, items+1)
+	for i := 0; i < items; i++ {
+		witness = append(witness, bytes.Repeat([]byte{byte(i)}, 520))
+	}
+	witness = append(witness, witnessScript)
+
+	return []*wire.MsgTx{fund, spendOutput(fund, witness)}, nil
+}
+
+// taprootSpend creates a taproot output committing to a single OP_TRUE leaf
+// and spends it through the script path, which puts the leaf script and
+// control block in the witness rather than a signature.
+func taprootSpend(m *Miner) ([]*wire.MsgTx, error) {
+	leafScript := []byte{txscript.OP_TRUE}
+	pkScript, controlBlock := taprootScriptTree(leafScript)
+
+	fund, err := m.Spend(wire.NewTxOut(100000, pkScript))
+	if err != nil {
+		return nil, err
+	}
+	spend := spendOutput(fund, wire.TxWitness{leafScript, controlBlock})
+
+	return []*wire.MsgTx{fund, spend}, nil
+}
+
+// taprootKeySpend creates a taproot output without a script tree and spends it
+// through its key path, with a witness of just a signature.
+func taprootKeySpend(m *Miner) ([]*wire.MsgTx, error) {
+	pkScript, secret := taprootKeyPath([]byte("taproot-key-spend"))
+
+	fund, err := m.Spend(wire.NewTxOut(100000, pkScript))
+	if err != nil {
+		return nil, err
+	}
+	spend := spendOutput(fund, nil)
+	err = signKeyPath(spend, 0, fund.TxOut[:1], secret, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return []*wire.MsgTx{fund, spend}, nil
+}
+
+// taprootAnnex spends a taproot output through its key path and another
+// through its script path in one transaction, each with an annex as the last
+// item of its witness. The annex is reserved for future extensions and, unlike
+// the other witness items, isn't passed to the script, but the key path
+// signature commits to it.
+func taprootAnnex(m *Miner) ([]*wire.MsgTx, error) {
+	keyScript, secret := taprootKeyPath([]byte("taproot-annex"))
+	leafScript := []byte{txscript.OP_TRUE}
+	treeScript, controlBlock := taprootScriptTree(leafScript)
+
+	fund, err := m.Spend(wire.NewTxOut(100000, keyScript),
+		wire.NewTxOut(100000, treeScript))
+	if err != nil {
+		return nil, err
+	}
+
+	fundHash := fund.TxHash()
+	spend := wire.NewMsgTx(2)
+	for i := uint32(0); i < 2; i++ {
+		spend.AddTxIn(&wire.TxIn{
+			PreviousOutPoint: wire.OutPoint{Hash: fundHash, Index: i},
+			Sequence:         wire.MaxTxInSequenceNum,
+		})
+	}
+	spend.AddTxOut(wire.NewTxOut(200000, AnyoneCanSpendScript))
+
+	keyAnnex := []byte{annexTag, 'k', 'e', 'y'}
+	scriptAnnex := append([]byte{annexTag}, bytes.Repeat([]byte{0xa5},
+		100)...)
+	spend.TxIn[1].Witness = wire.TxWitness{leafScript, controlBlock,
+		scriptAnnex}
+	err = signKeyPath(spend, 0, fund.TxOut[:2], secret, keyAnnex)
+	if err != nil {
+		return nil, err
+	}
+
+	return []*wire.MsgTx{fund, spend}, nil
+}
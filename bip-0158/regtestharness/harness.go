@@ -0,0 +1,70 @@
+// Package regtestharness generates test vectors from blocks it mines on a
+// local regtest node, rather than from historical testnet blocks. It launches
+// bitcoind or btcd on an empty regtest chain, mines the blocks needed to
+// mature a coinbase, and then mines one block for each Case, exercising an
+// edge case of filter construction such as a taproot key or script path
+// spend, a witness carrying an annex, an unparseable output script or a huge
+// witness. Blocks are built locally with
+// fixed timestamps, so every run on any node produces the same chain, and
+// thus the same vectors:
+//
+//	node, err := regtestharness.Start(regtestharness.Config{
+//		Implementation: regtestharness.Bitcoind,
+//	})
+//	...
+//	defer node.Stop()
+//	testBlocks, err := regtestharness.Run(node, regtestharness.DefaultCases)
+//	...
+//	gen := generator.New(generator.Config{
+//		Source:     node,
+//		Policies:   policies,
+//		TestBlocks: testBlocks,
+//		Hooks:      hooks,
+//	})
+//
+// Coinbases and change pay to a P2WSH output anyone can spend. The only
+// signatures are those of taproot key path spends, made with keys derived
+// from fixed seeds and deterministic nonces.
+package regtestharness
+
+import (
+	"fmt"
+
+	"github.com/christsim/bips/bip-0158/generator"
+)
+
+// Run mines the blocks of the passed cases on the node's chain, which must
+// only hold the genesis block. The cases are preceded by enough blocks for the
+// first coinbase to mature, so that each case can spend coins. It returns the
+// genesis block and the block of each case as test blocks for the generator,
+// commented with the case's comment.
+func Run(node *Node, cases []Case) ([]generator.TestBlock, error) {
+	m, err := NewMiner(node)
+	if err != nil {
+		return nil, err
+	}
+	for i := uint16(0); i < m.params.CoinbaseMaturity; i++ {
+		if _, err := m.Mine(); err != nil {
+			return nil, err
+		}
+	}
+
+	testBlocks := []generator.TestBlock{
+		{Height: 0, Comment: "Genesis block"},
+	}
+	for _, c := range cases {
+		txs, err := c.Txs(m)
+		if err != nil {
+			return nil, fmt.Errorf("case %v: %v", c.Name, err)
+		}
+		if _, err := m.Mine(txs...); err != nil {
+			return nil, fmt.Errorf("case %v: %v", c.Name, err)
+		}
+		testBlocks = append(testBlocks, generator.TestBlock{
+			Height:  uint32(m.Height()),
+			Comment: c.Comment,
+		})
+	}
+
+	return testBlocks, nil
+}
@@ -0,0 +1,336 @@
+package regtestharness
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/christsim/bips/bip-0158/backend/chaincfg"
+	"github.com/christsim/bips/bip-0158/backend/chainhash"
+	"github.com/christsim/bips/bip-0158/backend/txscript"
+	"github.com/christsim/bips/bip-0158/backend/wire"
+)
+
+var (
+	// ErrChainNotEmpty is returned by NewMiner when the node already has
+	// blocks beyond the genesis block, whose contents would make the
+	// vectors depend on the node's history.
+	ErrChainNotEmpty = errors.New("regtestharness: node's chain isn't " +
+		"empty")
+
+	// ErrNoCoins is returned by Spend when no coin is mature enough to be
+	// spent in the next block.
+	ErrNoCoins = errors.New("regtestharness: no spendable coins")
+)
+
+// firstBlockTime is the timestamp of the first block mined, from which the
+// timestamps of the following blocks count up, so that blocks don't depend on
+// when they are mined. The regtest genesis block predates the BIP 16 switch
+// time, which btcd checks block timestamps against to enforce P2SH, and so
+// witness programs, on every network.
+var firstBlockTime = time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+const (
+	// blockVersion is the version of mined blocks, which signals BIP 9
+	// and is above the versions that activated BIP 34, 65 and 66.
+	blockVersion = 0x20000000
+
+	// blockInterval is the time between the timestamps of mined blocks.
+	blockInterval = 10 * time.Minute
+
+	// witnessMagic prefixes the witness commitment in the coinbase.
+	witnessMagic = "\xaa\x21\xa9\xed"
+)
+
+// AnyoneCanSpendWitnessScript is the witness script of AnyoneCanSpendScript,
+// which leaves true on the stack.
+var AnyoneCanSpendWitnessScript = []byte{txscript.OP_TRUE}
+
+// AnyoneCanSpendScript is the P2WSH output script the miner pays coinbases and
+// change to. Anyone can spend it with a witness of just the witness script, so
+// no keys are involved.
+var AnyoneCanSpendScript = PayToWitnessScriptHash(AnyoneCanSpendWitnessScript)
+
+// PayToWitnessScriptHash returns the P2WSH output script paying to the passed
+// witness script.
+func PayToWitnessScriptHash(witnessScript []byte) []byte {
+	hash := sha256.Sum256(witnessScript)
+	return append([]byte{txscript.OP_0, txscript.OP_DATA_32}, hash[:]...)
+}
+
+// Coin is an output paying to AnyoneCanSpendScript.
+type Coin struct {
+	OutPoint wire.OutPoint
+	Value    int64
+
+	// height is the height of the coinbase the coin was created by, or -1
+	// if it wasn't created by one and can be spent right away.
+	height int32
+}
+
+// Miner builds blocks on top of a node's chain and submits them to it. Blocks
+// are built locally with fixed timestamps and the coinbase paying to
+// AnyoneCanSpendScript, so the same calls produce the same blocks whichever
+// node they are submitted to.
+type Miner struct {
+	node   *Node
+	params *chaincfg.Params
+
+	height  int32
+	tipHash chainhash.Hash
+	tipTime time.Time
+
+	// coins are the unspent coins in the order they were created.
+	// pending are the change coins of transactions that will be spendable
+	// once they are mined.
+	coins   []Coin
+	pending []Coin
+}
+
+// NewMiner returns a miner building on the node's chain, which must only hold
+// the genesis block.
+func NewMiner(node *Node) (*Miner, error) {
+	count, err := node.GetBlockCount()
+	if err != nil {
+		return nil, err
+	}
+	if count != 0 {
+		return nil, ErrChainNotEmpty
+	}
+
+	params := &chaincfg.RegressionNetParams
+	genesisHash := params.GenesisBlock.BlockHash()
+	hash, err := node.GetBlockHash(0)
+	if err != nil {
+		return nil, err
+	}
+	if *hash != genesisHash {
+		return nil, fmt.Errorf("node's genesis block %v isn't the "+
+			"regtest genesis block %v", hash, genesisHash)
+	}
+
+	return &Miner{
+		node:    node,
+		params:  params,
+		tipHash: genesisHash,
+		tipTime: firstBlockTime.Add(-blockInterval),
+	}, nil
+}
+
+// Height returns the height of the last block mined.
+func (m *Miner) Height() int32 {
+	return m.height
+}
+
+// subsidy returns the block subsidy at the passed height.
+func (m *Miner) subsidy(height int32) int64 {
+	halvings := uint(height) / uint(m.params.SubsidyReductionInterval)
+	if halvings >= 64 {
+		return 0
+	}
+	return (50 * 1e8) >> halvings
+}
+
+// Spend returns a transaction spending the oldest coin that can be spent in
+// the next block to the passed outputs, paying what they leave of the coin's
+// value back to AnyoneCanSpendScript as change. The transaction must be
+// included in the next block mined.
+func (m *Miner) Spend(outputs ...*wire.TxOut) (*wire.MsgTx, error) {
+	nextHeight := m.height + 1
+	maturity := int32(m.params.CoinbaseMaturity)
+	index := -1
+	for i, coin := range m.coins {
+		if coin.height < 0 || coin.height+maturity <= nextHeight {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return nil, ErrNoCoins
+	}
+	coin := m.coins[index]
+
+	tx := wire.NewMsgTx(2)
+	tx.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: coin.OutPoint,
+		Witness:          wire.TxWitness{AnyoneCanSpendWitnessScript},
+		Sequence:         wire.MaxTxInSequenceNum,
+	})
+	change := coin.Value
+	for _, out := range outputs {
+		change -= out.Value
+		tx.AddTxOut(out)
+	}
+	if change < 0 {
+		return nil, fmt.Errorf("outputs spend %d more than the "+
+			"coin's %d", -change, coin.Value)
+	}
+	if change > 0 {
+		tx.AddTxOut(wire.NewTxOut(change, AnyoneCanSpendScript))
+		m.pending = append(m.pending, Coin{
+			OutPoint: wire.OutPoint{
+				Hash:  tx.TxHash(),
+				Index: uint32(len(tx.TxOut) - 1),
+			},
+			Value:  change,
+			height: -1,
+		})
+	}
+
+	m.coins = append(m.coins[:index], m.coins[index+1:]...)
+	return tx, nil
+}
+
+// Mine builds a block holding the passed transactions after its coinbase and
+// submits it to the node.
+func (m *Miner) Mine(txs ...*wire.MsgTx) (*wire.MsgBlock, error) {
+	height := m.height + 1
+	coinbase, err := m.coinbase(height, txs)
+	if err != nil {
+		return nil, err
+	}
+
+	block := &wire.MsgBlock{
+		Header: wire.BlockHeader{
+			Version:   blockVersion,
+			PrevBlock: m.tipHash,
+			Timestamp: m.tipTime.Add(blockInterval),
+			Bits:      m.params.PowLimitBits,
+		},
+		Transactions: append([]*wire.MsgTx{coinbase}, txs...),
+	}
+	block.Header.MerkleRoot = merkleRoot(block.Transactions, false)
+	if err := m.solve(&block.Header); err != nil {
+		return nil, err
+	}
+
+	if err := m.node.SubmitBlock(block); err != nil {
+		return nil, fmt.Errorf("height %d: %v", height, err)
+	}
+
+	m.height = height
+	m.tipHash = block.BlockHash()
+	m.tipTime = block.Header.Timestamp
+	m.coins = append(m.coins, m.pending...)
+	m.pending = nil
+	m.coins = append(m.coins, Coin{
+		OutPoint: wire.OutPoint{Hash: coinbase.TxHash()},
+		Value:    coinbase.TxOut[0].Value,
+		height:   height,
+	})
+
+	return block, nil
+}
+
+// coinbase returns the coinbase of the block at the passed height holding the
+// passed transactions. It pushes the height as BIP 34 requires, pays the
+// subsidy to AnyoneCanSpendScript and commits to the block's witnesses.
+func (m *Miner) coinbase(height int32,
+	txs []*wire.MsgTx) (*wire.MsgTx, error) {
+
+	// The extra push keeps the script above the minimum length of 2 bytes
+	// at heights that are pushed with a single opcode.
+	sigScript, err := txscript.NewScriptBuilder().AddInt64(int64(height)).
+		AddData([]byte("regtestharness")).Script()
+	if err != nil {
+		return nil, err
+	}
+
+	// The coinbase's witness is the reserved value, which the commitment
+	// covers along with the witness merkle root, in which the coinbase
+	// counts as all zeros.
+	var reserved [chainhash.HashSize]byte
+	coinbase := wire.NewMsgTx(1)
+	coinbase.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: wire.OutPoint{Index: wire.MaxPrevOutIndex},
+		SignatureScript:  sigScript,
+		Witness:          wire.TxWitness{reserved[:]},
+		Sequence:         wire.MaxTxInSequenceNum,
+	})
+	coinbase.AddTxOut(wire.NewTxOut(m.subsidy(height), AnyoneCanSpendScript))
+
+	witnessRoot := merkleRoot(append([]*wire.MsgTx{coinbase}, txs...), true)
+	commitment := chainhash.DoubleHashB(append(witnessRoot[:],
+		reserved[:]...))
+	commitScript := append([]byte{txscript.OP_RETURN, 0x24},
+		witnessMagic...)
+	coinbase.AddTxOut(wire.NewTxOut(0, append(commitScript,
+		commitment...)))
+
+	return coinbase, nil
+}
+
+// solve grinds the header's nonce until its hash meets its target. At the
+// regtest difficulty this takes two tries on average.
+func (m *Miner) solve(header *wire.BlockHeader) error {
+	target := compactToBig(header.Bits)
+	for nonce := uint32(0); ; nonce++ {
+		header.Nonce = nonce
+		hash := header.BlockHash()
+		if hashToBig(&hash).Cmp(target) <= 0 {
+			return nil
+		}
+		if nonce == ^uint32(0) {
+			return errors.New("no nonce solves the block")
+		}
+	}
+}
+
+// compactToBig returns the target encoded in the compact form of a header's
+// bits.
+func compactToBig(compact uint32) *big.Int {
+	mantissa := int64(compact & 0x007fffff)
+	exponent := uint(compact >> 24)
+
+	target := big.NewInt(mantissa)
+	if exponent <= 3 {
+		target.Rsh(target, 8*(3-exponent))
+	} else {
+		target.Lsh(target, 8*(exponent-3))
+	}
+	if compact&0x00800000 != 0 {
+		target.Neg(target)
+	}
+	return target
+}
+
+// hashToBig returns the hash as the little endian number it's compared to the
+// target as.
+func hashToBig(hash *chainhash.Hash) *big.Int {
+	var buf [chainhash.HashSize]byte
+	for i := range buf {
+		buf[i] = hash[chainhash.HashSize-1-i]
+	}
+	return new(big.Int).SetBytes(buf[:])
+}
+
+// merkleRoot returns the merkle root of the transactions' hashes, or of their
+// witness hashes with the coinbase's taken as all zeros.
+func merkleRoot(txs []*wire.MsgTx, witness bool) chainhash.Hash {
+	hashes := make([]chainhash.Hash, len(txs))
+	for i, tx := range txs {
+		switch {
+		case !witness:
+			hashes[i] = tx.TxHash()
+		case i > 0:
+			hashes[i] = tx.WitnessHash()
+		}
+	}
+
+	var buf [2 * chainhash.HashSize]byte
+	for len(hashes) > 1 {
+		if len(hashes)%2 == 1 {
+			hashes = append(hashes, hashes[len(hashes)-1])
+		}
+		for i := 0; i < len(hashes)/2; i++ {
+			copy(buf[:], hashes[2*i][:])
+			copy(buf[chainhash.HashSize:], hashes[2*i+1][:])
+			hashes[i] = chainhash.DoubleHashH(buf[:])
+		}
+		hashes = hashes[:len(hashes)/2]
+	}
+
+	return hashes[0]
+}
@@ -0,0 +1,364 @@
+package regtestharness
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/christsim/bips/bip-0158/backend/chainhash"
+	"github.com/christsim/bips/bip-0158/backend/wire"
+)
+
+// Implementation is a node implementation the harness can launch.
+type Implementation int
+
+const (
+	// Bitcoind is Bitcoin Core's bitcoind.
+	Bitcoind Implementation = iota
+
+	// Btcd is btcd.
+	Btcd
+)
+
+// String returns the name of the implementation's binary.
+func (i Implementation) String() string {
+	switch i {
+	case Bitcoind:
+		return "bitcoind"
+	case Btcd:
+		return "btcd"
+	default:
+		return "Implementation(" + strconv.Itoa(int(i)) + ")"
+	}
+}
+
+// Config configures a node launched by Start.
+type Config struct {
+	Implementation Implementation
+
+	// Path is the path of the node's binary. If empty, the binary named
+	// after the implementation is looked up in PATH.
+	Path string
+
+	// DataDir is the node's data directory. If empty, a temporary
+	// directory is used and removed by Stop. Vectors are only
+	// reproducible when the node starts from an empty chain.
+	DataDir string
+
+	// Args are passed to the node in addition to those the harness needs.
+	Args []string
+
+	// Output receives the node's standard output and error, which are
+	// discarded if nil.
+	Output io.Writer
+
+	// StartTimeout is how long to wait for the node's RPC server to come
+	// up, 30 seconds if zero.
+	StartTimeout time.Duration
+}
+
+// Node is a regtest node launched as a subprocess, which the harness talks to
+// over JSON-RPC. It satisfies generator.BlockSource.
+type Node struct {
+	cmd     *exec.Cmd
+	exited  chan struct{}
+	dataDir string
+	tempDir bool
+
+	rpcURL  string
+	rpcUser string
+	rpcPass string
+	client  http.Client
+}
+
+// Start launches a node in regtest mode and waits until its RPC server
+// answers. The node only listens on the loopback interface and doesn't
+// connect to any peers.
+func Start(cfg Config) (*Node, error) {
+	binary := cfg.Path
+	if binary == "" {
+		binary = cfg.Implementation.String()
+	}
+	timeout := cfg.StartTimeout
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+
+	n := &Node{
+		exited:  make(chan struct{}),
+		dataDir: cfg.DataDir,
+		rpcUser: "regtestharness",
+		client:  http.Client{Timeout: time.Minute},
+	}
+	if n.dataDir == "" {
+		dir, err := ioutil.TempDir("", "regtestharness")
+		if err != nil {
+			return nil, err
+		}
+		n.dataDir = dir
+		n.tempDir = true
+	}
+	var pass [16]byte
+	if _, err := rand.Read(pass[:]); err != nil {
+		n.removeDataDir()
+		return nil, err
+	}
+	n.rpcPass = hex.EncodeToString(pass[:])
+
+	port, err := freePort()
+	if err != nil {
+		n.removeDataDir()
+		return nil, err
+	}
+	rpcListen := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+	n.rpcURL = "http://" + rpcListen
+
+	var args []string
+	switch cfg.Implementation {
+	case Bitcoind:
+		args = []string{
+			"-regtest",
+			"-datadir=" + n.dataDir,
+			"-server",
+			"-listen=0",
+			"-dnsseed=0",
+			"-fixedseeds=0",
+			"-disablewallet",
+			"-rpcbind=127.0.0.1",
+			"-rpcport=" + strconv.Itoa(port),
+			"-rpcuser=" + n.rpcUser,
+			"-rpcpassword=" + n.rpcPass,
+		}
+	case Btcd:
+		args = []string{
+			"--regtest",
+			"--configfile=" + filepath.Join(n.dataDir, "btcd.conf"),
+			"--datadir=" + n.dataDir,
+			"--logdir=" + filepath.Join(n.dataDir, "logs"),
+			"--nolisten",
+			"--notls",
+			"--rpclisten=" + rpcListen,
+			"--rpcuser=" + n.rpcUser,
+			"--rpcpass=" + n.rpcPass,
+		}
+	default:
+		n.removeDataDir()
+		return nil, fmt.Errorf("unknown implementation %v",
+			cfg.Implementation)
+	}
+
+	n.cmd = exec.Command(binary, append(args, cfg.Args...)...)
+	n.cmd.Stdout = cfg.Output
+	n.cmd.Stderr = cfg.Output
+	if err := n.cmd.Start(); err != nil {
+		n.removeDataDir()
+		return nil, fmt.Errorf("couldn't start %v: %v", binary, err)
+	}
+	go func() {
+		n.cmd.Wait()
+		close(n.exited)
+	}()
+
+	// The RPC server refuses connections until it's listening, and
+	// bitcoind answers with an error while it's still loading.
+	deadline := time.Now().Add(timeout)
+	for {
+		_, err := n.GetBlockCount()
+		if err == nil {
+			return n, nil
+		}
+
+		select {
+		case <-n.exited:
+			n.removeDataDir()
+			return nil, fmt.Errorf("%v exited on startup: %v", binary,
+				n.cmd.ProcessState)
+		case <-time.After(100 * time.Millisecond):
+		}
+		if time.Now().After(deadline) {
+			n.Stop()
+			return nil, fmt.Errorf("%v didn't start within %v: %v",
+				binary, timeout, err)
+		}
+	}
+}
+
+// freePort returns a TCP port on the loopback interface that was free when
+// checked.
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+// removeDataDir removes the data directory if it was created by Start.
+func (n *Node) removeDataDir() {
+	if n.tempDir {
+		os.RemoveAll(n.dataDir)
+	}
+}
+
+// Stop asks the node to shut down, kills it if it hasn't within 30 seconds,
+// and removes its data directory if it's temporary.
+func (n *Node) Stop() error {
+	defer n.removeDataDir()
+
+	var stopErr error
+	if _, err := n.call("stop"); err != nil {
+		stopErr = err
+	}
+	select {
+	case <-n.exited:
+		return nil
+	case <-time.After(30 * time.Second):
+	}
+
+	n.cmd.Process.Kill()
+	<-n.exited
+	if stopErr != nil {
+		return fmt.Errorf("node didn't stop: %v", stopErr)
+	}
+	return errors.New("node didn't stop in time")
+}
+
+// rpcError is the error member of a JSON-RPC response.
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return fmt.Sprintf("%v (code %d)", e.Message, e.Code)
+}
+
+// call makes a JSON-RPC call and returns its result.
+func (n *Node) call(method string, params ...interface{}) (json.RawMessage,
+	error) {
+
+	if params == nil {
+		params = []interface{}{}
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "1.0",
+		"id":      1,
+		"method":  method,
+		"params":  params,
+	})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("POST", n.rpcURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(n.rpcUser, n.rpcPass)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// bitcoind reports errors with a non-200 status along with a JSON
+	// body, so the status only matters if the body isn't one.
+	var reply struct {
+		Result json.RawMessage `json:"result"`
+		Error  *rpcError       `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		return nil, fmt.Errorf("%v: %v", method, resp.Status)
+	}
+	if reply.Error != nil {
+		return nil, fmt.Errorf("%v: %v", method, reply.Error)
+	}
+	return reply.Result, nil
+}
+
+// GetBlockCount returns the height of the node's best block.
+func (n *Node) GetBlockCount() (int64, error) {
+	result, err := n.call("getblockcount")
+	if err != nil {
+		return 0, err
+	}
+	var count int64
+	err = json.Unmarshal(result, &count)
+	return count, err
+}
+
+// GetBlockHash returns the hash of the block at the passed height.
+func (n *Node) GetBlockHash(height int64) (*chainhash.Hash, error) {
+	result, err := n.call("getblockhash", height)
+	if err != nil {
+		return nil, err
+	}
+	var hash string
+	if err := json.Unmarshal(result, &hash); err != nil {
+		return nil, err
+	}
+	return chainhash.NewHashFromStr(hash)
+}
+
+// GetBlock returns the block with the passed hash.
+func (n *Node) GetBlock(blockHash *chainhash.Hash) (*wire.MsgBlock, error) {
+	// Verbosity 0 returns the serialized block in both implementations.
+	result, err := n.call("getblock", blockHash.String(), 0)
+	if err != nil {
+		return nil, err
+	}
+	var blockHex string
+	if err := json.Unmarshal(result, &blockHex); err != nil {
+		return nil, err
+	}
+	blockBytes, err := hex.DecodeString(blockHex)
+	if err != nil {
+		return nil, err
+	}
+
+	var block wire.MsgBlock
+	if err := block.Deserialize(bytes.NewReader(blockBytes)); err != nil {
+		return nil, err
+	}
+	return &block, nil
+}
+
+// SubmitBlock submits a block to the node, returning an error if the node
+// doesn't accept it.
+func (n *Node) SubmitBlock(block *wire.MsgBlock) error {
+	var buf bytes.Buffer
+	if err := block.Serialize(&buf); err != nil {
+		return err
+	}
+	result, err := n.call("submitblock", hex.EncodeToString(buf.Bytes()))
+	if err != nil {
+		return err
+	}
+
+	// Both implementations return null for an accepted block, and the
+	// reason as a string for a rejected one.
+	var reason *string
+	if err := json.Unmarshal(result, &reason); err != nil {
+		return err
+	}
+	if reason != nil {
+		return fmt.Errorf("block %v rejected: %v", block.BlockHash(),
+			*reason)
+	}
+	return nil
+}
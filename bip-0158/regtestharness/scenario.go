@@ -0,0 +1,464 @@
+package regtestharness
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/christsim/bips/bip-0158/backend/btcec"
+	"github.com/christsim/bips/bip-0158/backend/btcutil"
+	"github.com/christsim/bips/bip-0158/backend/txscript"
+	"github.com/christsim/bips/bip-0158/backend/wire"
+)
+
+// Scenario describes the block of a Case as data, so that new edge cases can
+// be added to the vectors without writing code. A JSON array of scenarios,
+// read with ParseScenarios, looks like:
+//
+//	[
+//		{
+//			"name": "p2tr-outputs",
+//			"comment": "2 P2TR outputs, one OP_RETURN, one duplicate pushdata",
+//			"txs": [
+//				{"outputs": [
+//					{"type": "p2tr", "count": 2},
+//					{"type": "op_return"},
+//					{"type": "duplicate-pushdata"}
+//				]},
+//				{"outputs": [
+//					{"type": "p2wsh", "spend": true,
+//					 "witness_items": 100}
+//				]}
+//			]
+//		}
+//	]
+//
+// Each transaction spends a coin of the miner to its outputs, in order, plus
+// change. Outputs marked to be spent are then all spent by one more
+// transaction at the end of the block. See ScenarioOutput for the output
+// types.
+type Scenario struct {
+	Name    string       `json:"name"`
+	Comment string       `json:"comment"`
+	Txs     []ScenarioTx `json:"txs"`
+}
+
+// ScenarioTx describes a transaction of a Scenario.
+type ScenarioTx struct {
+	Outputs []ScenarioOutput `json:"outputs"`
+}
+
+// ScenarioOutput describes outputs of a ScenarioTx. Type is one of:
+//
+//   - p2pkh, p2wpkh: paying to the 20 byte hash in Data.
+//   - p2pk: paying to the 33 byte compressed public key in Data.
+//   - p2sh, p2wsh, p2tr: paying to the script that drops Data and leaves
+//     true, through P2SH, P2WSH or the only leaf of a taproot script tree.
+//     These can be spent.
+//   - p2tr-keypath: a taproot output without a script tree, whose internal
+//     key is derived from Data. This can be spent through its key path.
+//   - duplicate-pushdata: a bare script pushing Data twice, dropping both
+//     pushes and leaving true. This can be spent.
+//   - op_return: an OP_RETURN script pushing Data.
+//   - unparseable: a script whose push of Data is cut short.
+//   - empty: an empty script.
+//   - raw: Data as the script.
+//
+// Data is hex encoded. If it's left out, it's derived from the position of
+// the output in the scenario, so each output gets different data and a
+// different script.
+type ScenarioOutput struct {
+	Type string `json:"type"`
+	Data string `json:"data,omitempty"`
+
+	// Count is the number of outputs, 1 if zero. Outputs with derived
+	// data each get their own.
+	Count int `json:"count,omitempty"`
+
+	// Value is the value of each output in satoshis, 1000 if zero except
+	// for op_return outputs.
+	Value int64 `json:"value,omitempty"`
+
+	// Spend spends the outputs at the end of the block.
+	Spend bool `json:"spend,omitempty"`
+
+	// WitnessItems is the number of stack items of WitnessItemSize bytes,
+	// 520 if zero, that the witness spending p2wsh and p2tr outputs
+	// carries, and their script drops, to grow the witness.
+	WitnessItems    int `json:"witness_items,omitempty"`
+	WitnessItemSize int `json:"witness_item_size,omitempty"`
+
+	// Annex is the hex encoded annex, starting with 0x50, that the
+	// witness spending p2tr and p2tr-keypath outputs ends with, if any.
+	Annex string `json:"annex,omitempty"`
+}
+
+// ParseScenarios reads a JSON array of scenarios and checks each of them.
+func ParseScenarios(r io.Reader) ([]Scenario, error) {
+	var scenarios []Scenario
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&scenarios); err != nil {
+		return nil, err
+	}
+	for i := range scenarios {
+		if _, err := scenarios[i].Case(); err != nil {
+			return nil, err
+		}
+	}
+	return scenarios, nil
+}
+
+// ScenarioCases compiles each of the scenarios into a case.
+func ScenarioCases(scenarios []Scenario) ([]Case, error) {
+	cases := make([]Case, len(scenarios))
+	for i := range scenarios {
+		var err error
+		cases[i], err = scenarios[i].Case()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return cases, nil
+}
+
+// maxStackItemSize is the largest item consensus allows on the script stack.
+const maxStackItemSize = 520
+
+// compiledOutput is an output of a scenario with its script built.
+type compiledOutput struct {
+	txOut *wire.TxOut
+	spend bool
+
+	// The spending input's signature script and witness, or for key
+	// path spends, the secret key signing it and its annex.
+	sigScript []byte
+	witness   wire.TxWitness
+	secret    *big.Int
+	annex     []byte
+}
+
+// Case compiles the scenario into a case, checking it so that errors are
+// reported before anything is mined.
+func (s *Scenario) Case() (Case, error) {
+	txs := make([][]*compiledOutput, len(s.Txs))
+	for i, tx := range s.Txs {
+		for j := range tx.Outputs {
+			outs, err := s.compileOutput(i, j)
+			if err != nil {
+				return Case{}, fmt.Errorf("scenario %v, tx %d, "+
+					"output %d: %v", s.Name, i, j, err)
+			}
+			txs[i] = append(txs[i], outs...)
+		}
+	}
+
+	return Case{
+		Name:    s.Name,
+		Comment: s.Comment,
+		Txs: func(m *Miner) ([]*wire.MsgTx, error) {
+			return buildScenario(m, txs)
+		},
+	}, nil
+}
+
+// buildScenario spends a coin of the miner to each transaction's outputs and
+// then spends the outputs to be spent.
+func buildScenario(m *Miner, txs [][]*compiledOutput) ([]*wire.MsgTx, error) {
+	var (
+		block    []*wire.MsgTx
+		spend    = wire.NewMsgTx(2)
+		prevOuts []*wire.TxOut
+		signers  []*compiledOutput
+		value    int64
+	)
+	for _, outs := range txs {
+		txOuts := make([]*wire.TxOut, len(outs))
+		for i, out := range outs {
+			txOuts[i] = out.txOut
+		}
+		tx, err := m.Spend(txOuts...)
+		if err != nil {
+			return nil, err
+		}
+		block = append(block, tx)
+
+		for i, out := range outs {
+			if !out.spend {
+				continue
+			}
+			spend.AddTxIn(&wire.TxIn{
+				PreviousOutPoint: wire.OutPoint{
+					Hash:  tx.TxHash(),
+					Index: uint32(i),
+				},
+				SignatureScript: out.sigScript,
+				Witness:         out.witness,
+				Sequence:        wire.MaxTxInSequenceNum,
+			})
+			prevOuts = append(prevOuts, out.txOut)
+			signers = append(signers, out)
+			value += out.txOut.Value
+		}
+	}
+	if len(spend.TxIn) == 0 {
+		return block, nil
+	}
+
+	// Key path signatures commit to the whole transaction, so they are
+	// made once it's complete.
+	spend.AddTxOut(wire.NewTxOut(value, AnyoneCanSpendScript))
+	for i, out := range signers {
+		if out.secret == nil {
+			continue
+		}
+		err := signKeyPath(spend, i, prevOuts, out.secret, out.annex)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return append(block, spend), nil
+}
+
+// compileOutput builds the outputs described by the jth output of the ith
+// transaction.
+func (s *Scenario) compileOutput(i, j int) ([]*compiledOutput, error) {
+	desc := &s.Txs[i].Outputs[j]
+
+	count := desc.Count
+	if count == 0 {
+		count = 1
+	}
+	if count < 0 {
+		return nil, fmt.Errorf("negative count %d", count)
+	}
+	value := desc.Value
+	if value == 0 && desc.Type != "op_return" {
+		value = 1000
+	}
+	if value < 0 {
+		return nil, fmt.Errorf("negative value %d", value)
+	}
+	if desc.WitnessItems < 0 || desc.WitnessItemSize < 0 {
+		return nil, errors.New("negative witness item count or size")
+	}
+	if desc.WitnessItems > 0 && desc.Type != "p2wsh" &&
+		desc.Type != "p2tr" {
+
+		return nil, errors.New("witness items only apply to p2wsh and " +
+			"p2tr outputs")
+	}
+	var annex []byte
+	if desc.Annex != "" {
+		if desc.Type != "p2tr" && desc.Type != "p2tr-keypath" {
+			return nil, errors.New("annexes only apply to p2tr and " +
+				"p2tr-keypath outputs")
+		}
+		var err error
+		annex, err = hex.DecodeString(desc.Annex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid annex: %v", err)
+		}
+		if annex[0] != annexTag {
+			return nil, fmt.Errorf("annex must start with %#x",
+				annexTag)
+		}
+	}
+
+	var data []byte
+	if desc.Data != "" {
+		var err error
+		data, err = hex.DecodeString(desc.Data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid data: %v", err)
+		}
+	}
+	// Data pushed by a script that is run must fit in a stack item, as
+	// must the redeem script of p2sh outputs, which takes up to 5 bytes of
+	// opcodes besides the data.
+	if desc.Spend && len(data) > maxStackItemSize-5 {
+		return nil, fmt.Errorf("data of spent outputs can't be over "+
+			"%d bytes", maxStackItemSize-5)
+	}
+
+	outs := make([]*compiledOutput, count)
+	for k := range outs {
+		outData := data
+		if outData == nil {
+			outData = s.derivedData(desc.Type, i, j, k)
+		}
+		out, err := compileScript(desc, outData)
+		if err != nil {
+			return nil, err
+		}
+		if desc.Spend && out.sigScript == nil && out.witness == nil &&
+			out.secret == nil {
+
+			return nil, fmt.Errorf("%v outputs can't be spent",
+				desc.Type)
+		}
+		out.txOut = wire.NewTxOut(value, out.txOut.PkScript)
+		out.spend = desc.Spend
+		if annex != nil && out.witness != nil {
+			out.witness = append(out.witness, annex)
+		}
+		out.annex = annex
+		outs[k] = out
+	}
+	return outs, nil
+}
+
+// derivedData returns the data of the kth copy of the jth output of the ith
+// transaction when the scenario doesn't set it, sized for the output type.
+func (s *Scenario) derivedData(outputType string, i, j, k int) []byte {
+	seed := sha256.Sum256([]byte(fmt.Sprintf("%s/%d/%d/%d", s.Name, i, j,
+		k)))
+	switch outputType {
+	case "p2pkh", "p2wpkh":
+		return seed[:20]
+	case "p2pk":
+		// Any point will do as long as it's one.
+		x, y := btcec.S256().ScalarBaseMult(seed[:])
+		return append([]byte{0x02 | byte(y.Bit(0))}, pad32(x)...)
+	default:
+		return seed[:8]
+	}
+}
+
+// pushScript returns a script pushing the data with a push opcode, even if
+// it's small enough for a small integer opcode. Unlike the script builder,
+// it doesn't limit the size of the data, which output scripts can push as long
+// as they aren't run.
+func pushScript(data []byte) []byte {
+	n := len(data)
+	var script []byte
+	switch {
+	case n <= txscript.OP_DATA_75:
+		script = []byte{byte(n)}
+	case n <= 0xff:
+		script = []byte{txscript.OP_PUSHDATA1, byte(n)}
+	case n <= 0xffff:
+		script = []byte{txscript.OP_PUSHDATA2, byte(n), byte(n >> 8)}
+	default:
+		script = []byte{txscript.OP_PUSHDATA4, byte(n), byte(n >> 8),
+			byte(n >> 16), byte(n >> 24)}
+	}
+	return append(script, data...)
+}
+
+// dropScript returns the script dropping the pushed data and then the passed
+// number of stack items, leaving true.
+func dropScript(data []byte, items int) []byte {
+	script := append(pushScript(data), txscript.OP_DROP)
+	if items%2 == 1 {
+		script = append(script, txscript.OP_DROP)
+	}
+	script = append(script, bytes.Repeat([]byte{txscript.OP_2DROP},
+		items/2)...)
+	return append(script, txscript.OP_TRUE)
+}
+
+// compileScript builds the output script of the described output type with
+// the passed data, and how to spend it if it can be. The output's value is
+// set by the caller.
+func compileScript(desc *ScenarioOutput, data []byte) (*compiledOutput,
+	error) {
+
+	checkLen := func(n int) error {
+		if len(data) != n {
+			return fmt.Errorf("%v data must be %d bytes, not %d",
+				desc.Type, n, len(data))
+		}
+		return nil
+	}
+
+	var witness wire.TxWitness
+	itemSize := desc.WitnessItemSize
+	if itemSize == 0 {
+		itemSize = maxStackItemSize
+	}
+	for k := 0; k < desc.WitnessItems; k++ {
+		witness = append(witness, bytes.Repeat([]byte{byte(k)},
+			itemSize))
+	}
+
+	out := &compiledOutput{}
+	var pkScript []byte
+	switch desc.Type {
+	case "p2pkh":
+		if err := checkLen(20); err != nil {
+			return nil, err
+		}
+		pkScript = append([]byte{txscript.OP_DUP, txscript.OP_HASH160},
+			pushScript(data)...)
+		pkScript = append(pkScript, txscript.OP_EQUALVERIFY,
+			txscript.OP_CHECKSIG)
+
+	case "p2wpkh":
+		if err := checkLen(20); err != nil {
+			return nil, err
+		}
+		pkScript = append([]byte{txscript.OP_0}, pushScript(data)...)
+
+	case "p2pk":
+		if err := checkLen(33); err != nil {
+			return nil, err
+		}
+		pkScript = append(pushScript(data), txscript.OP_CHECKSIG)
+
+	case "p2sh":
+		redeemScript := dropScript(data, 0)
+		pkScript = append([]byte{txscript.OP_HASH160},
+			pushScript(btcutil.Hash160(redeemScript))...)
+		pkScript = append(pkScript, txscript.OP_EQUAL)
+		out.sigScript = pushScript(redeemScript)
+
+	case "p2wsh":
+		witnessScript := dropScript(data, desc.WitnessItems)
+		pkScript = PayToWitnessScriptHash(witnessScript)
+		out.witness = append(witness, witnessScript)
+
+	case "p2tr":
+		leafScript := dropScript(data, desc.WitnessItems)
+		var controlBlock []byte
+		pkScript, controlBlock = taprootScriptTree(leafScript)
+		out.witness = append(witness, leafScript, controlBlock)
+
+	case "p2tr-keypath":
+		pkScript, out.secret = taprootKeyPath(data)
+
+	case "duplicate-pushdata":
+		push := pushScript(data)
+		pkScript = append(append(push, push...), txscript.OP_2DROP,
+			txscript.OP_TRUE)
+		out.sigScript = []byte{}
+
+	case "op_return":
+		pkScript = append([]byte{txscript.OP_RETURN}, pushScript(data)...)
+
+	case "unparseable":
+		if len(data) > 0xff-0x10 {
+			return nil, fmt.Errorf("unparseable data is over %d "+
+				"bytes", 0xff-0x10)
+		}
+		pkScript = append([]byte{txscript.OP_PUSHDATA1,
+			byte(len(data) + 0x10)}, data...)
+
+	case "empty":
+		pkScript = []byte{}
+
+	case "raw":
+		pkScript = data
+
+	default:
+		return nil, fmt.Errorf("unknown output type %q", desc.Type)
+	}
+
+	out.txOut = &wire.TxOut{PkScript: pkScript}
+	return out, nil
+}
@@ -0,0 +1,225 @@
+package regtestharness
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math/big"
+
+	"github.com/christsim/bips/bip-0158/backend/btcec"
+	"github.com/christsim/bips/bip-0158/backend/txscript"
+	"github.com/christsim/bips/bip-0158/backend/wire"
+)
+
+// annexTag is the first byte of a taproot annex, which a witness with at
+// least two items carries as its last item.
+const annexTag = 0x50
+
+// tapLeafVersion is the leaf version of tapscript.
+const tapLeafVersion = 0xc0
+
+// numsKeyX is the x coordinate of the BIP 341 point with no known discrete
+// logarithm, used as the internal key of outputs only spendable through their
+// script path.
+var numsKeyX = []byte{
+	0x50, 0x92, 0x9b, 0x74, 0xc1, 0xa0, 0x49, 0x54, 0xb7, 0x8b, 0x4b,
+	0x60, 0x35, 0xe9, 0x7a, 0x5e, 0x07, 0x8a, 0x5a, 0x0f, 0x28, 0xec,
+	0x96, 0xd5, 0x47, 0xbf, 0xee, 0x9a, 0xce, 0x80, 0x3a, 0xc0,
+}
+
+// taggedHash returns the BIP 340 tagged hash of the messages.
+func taggedHash(tag string, msgs ...[]byte) []byte {
+	tagHash := sha256.Sum256([]byte(tag))
+	h := sha256.New()
+	h.Write(tagHash[:])
+	h.Write(tagHash[:])
+	for _, msg := range msgs {
+		h.Write(msg)
+	}
+	return h.Sum(nil)
+}
+
+// liftX returns the point with the passed x coordinate and an even y
+// coordinate. The curve's prime is 3 mod 4, so a square root is a power.
+func liftX(x *big.Int) *big.Int {
+	prime := btcec.S256().Params().P
+	ySquared := new(big.Int).Exp(x, big.NewInt(3), prime)
+	ySquared.Add(ySquared, big.NewInt(7))
+	exp := new(big.Int).Add(prime, big.NewInt(1))
+	exp.Rsh(exp, 2)
+	y := new(big.Int).Exp(ySquared, exp, prime)
+	if y.Bit(0) == 1 {
+		y.Sub(prime, y)
+	}
+	return y
+}
+
+// pad32 returns the number as 32 big endian bytes.
+func pad32(n *big.Int) []byte {
+	var buf [32]byte
+	return n.FillBytes(buf[:])
+}
+
+// taprootScriptTree returns the output script of a taproot output whose only
+// leaf is the passed tapscript, under the NUMS internal key, along with the
+// control block revealing the leaf.
+func taprootScriptTree(leafScript []byte) ([]byte, []byte) {
+	var leaf bytes.Buffer
+	leaf.WriteByte(tapLeafVersion)
+	wire.WriteVarBytes(&leaf, 0, leafScript)
+	merkleRoot := taggedHash("TapLeaf", leaf.Bytes())
+	tweak := taggedHash("TapTweak", numsKeyX, merkleRoot)
+
+	curve := btcec.S256()
+	internalX := new(big.Int).SetBytes(numsKeyX)
+	tweakX, tweakY := curve.ScalarBaseMult(tweak)
+	outX, outY := curve.Add(internalX, liftX(internalX), tweakX, tweakY)
+
+	pkScript := append([]byte{txscript.OP_1, txscript.OP_DATA_32},
+		pad32(outX)...)
+	controlBlock := append([]byte{tapLeafVersion | byte(outY.Bit(0))},
+		numsKeyX...)
+	return pkScript, controlBlock
+}
+
+// taprootKeyPath returns the output script of a taproot output without a
+// script tree, as BIP 86 wallets create, whose internal secret key is derived
+// from the seed, along with the secret key of its output key that signs
+// spends through its key path.
+func taprootKeyPath(seed []byte) ([]byte, *big.Int) {
+	curve := btcec.S256()
+	order := curve.Params().N
+
+	hash := sha256.Sum256(seed)
+	secret := new(big.Int).SetBytes(hash[:])
+	secret.Mod(secret, order)
+	internalX, internalY := curve.ScalarBaseMult(pad32(secret))
+	if internalY.Bit(0) == 1 {
+		secret.Sub(order, secret)
+	}
+
+	tweak := new(big.Int).SetBytes(taggedHash("TapTweak",
+		pad32(internalX)))
+	tweakX, tweakY := curve.ScalarBaseMult(pad32(tweak))
+	outX, outY := curve.Add(internalX, liftX(internalX), tweakX, tweakY)
+
+	// The output key's secret is the tweaked internal one, negated if the
+	// output key has an odd y coordinate, since only its x coordinate is
+	// committed to.
+	secret.Add(secret, tweak)
+	secret.Mod(secret, order)
+	if outY.Bit(0) == 1 {
+		secret.Sub(order, secret)
+	}
+
+	pkScript := append([]byte{txscript.OP_1, txscript.OP_DATA_32},
+		pad32(outX)...)
+	return pkScript, secret
+}
+
+// schnorrSign returns the BIP 340 signature of the 32 byte message by the
+// secret key, whose public key must have an even y coordinate. The auxiliary
+// randomness is all zeros, so signatures are deterministic.
+func schnorrSign(secret *big.Int, msg []byte) ([]byte, error) {
+	curve := btcec.S256()
+	order := curve.Params().N
+	secretBytes := pad32(secret)
+	pubX, _ := curve.ScalarBaseMult(secretBytes)
+
+	var aux [32]byte
+	t := taggedHash("BIP0340/aux", aux[:])
+	for i := range t {
+		t[i] ^= secretBytes[i]
+	}
+	k := new(big.Int).SetBytes(taggedHash("BIP0340/nonce", t,
+		pad32(pubX), msg))
+	k.Mod(k, order)
+	if k.Sign() == 0 {
+		return nil, errors.New("nonce is zero")
+	}
+	rX, rY := curve.ScalarBaseMult(pad32(k))
+	if rY.Bit(0) == 1 {
+		k.Sub(order, k)
+	}
+
+	e := new(big.Int).SetBytes(taggedHash("BIP0340/challenge", pad32(rX),
+		pad32(pubX), msg))
+	e.Mod(e, order)
+	s := e.Mul(e, secret)
+	s.Add(s, k)
+	s.Mod(s, order)
+
+	return append(pad32(rX), pad32(s)...), nil
+}
+
+// taprootSigHash returns the BIP 341 signature hash of the indexed input of
+// the transaction, spending the previous outputs, for a key path spend with
+// the default hash type, which commits to all inputs and outputs. The annex
+// is nil if the witness doesn't carry one.
+func taprootSigHash(tx *wire.MsgTx, prevOuts []*wire.TxOut, index int,
+	annex []byte) []byte {
+
+	var prevouts, amounts, scripts, sequences, outputs bytes.Buffer
+	for i, txIn := range tx.TxIn {
+		prevouts.Write(txIn.PreviousOutPoint.Hash[:])
+		binary.Write(&prevouts, binary.LittleEndian,
+			txIn.PreviousOutPoint.Index)
+		binary.Write(&amounts, binary.LittleEndian, prevOuts[i].Value)
+		wire.WriteVarBytes(&scripts, 0, prevOuts[i].PkScript)
+		binary.Write(&sequences, binary.LittleEndian, txIn.Sequence)
+	}
+	for _, txOut := range tx.TxOut {
+		binary.Write(&outputs, binary.LittleEndian, txOut.Value)
+		wire.WriteVarBytes(&outputs, 0, txOut.PkScript)
+	}
+
+	// The message starts with the sighash epoch and the hash type, both
+	// zero.
+	var msg bytes.Buffer
+	msg.Write([]byte{0, 0})
+	binary.Write(&msg, binary.LittleEndian, tx.Version)
+	binary.Write(&msg, binary.LittleEndian, tx.LockTime)
+	for _, buf := range []*bytes.Buffer{&prevouts, &amounts, &scripts,
+		&sequences, &outputs} {
+
+		hash := sha256.Sum256(buf.Bytes())
+		msg.Write(hash[:])
+	}
+
+	var spendType byte
+	if annex != nil {
+		spendType = 1
+	}
+	msg.WriteByte(spendType)
+	binary.Write(&msg, binary.LittleEndian, uint32(index))
+	if annex != nil {
+		var buf bytes.Buffer
+		wire.WriteVarBytes(&buf, 0, annex)
+		hash := sha256.Sum256(buf.Bytes())
+		msg.Write(hash[:])
+	}
+
+	return taggedHash("TapSighash", msg.Bytes())
+}
+
+// signKeyPath signs the indexed input of the transaction, which spends the
+// taproot output of the secret key's output key through its key path, and
+// sets its witness to the signature followed by the annex if not nil. The
+// previous outputs of all inputs are needed, since the signature commits to
+// them.
+func signKeyPath(tx *wire.MsgTx, index int, prevOuts []*wire.TxOut,
+	secret *big.Int, annex []byte) error {
+
+	sig, err := schnorrSign(secret, taprootSigHash(tx, prevOuts, index,
+		annex))
+	if err != nil {
+		return err
+	}
+
+	tx.TxIn[index].Witness = wire.TxWitness{sig}
+	if annex != nil {
+		tx.TxIn[index].Witness = append(tx.TxIn[index].Witness, annex)
+	}
+	return nil
+}
@@ -0,0 +1,439 @@
+// Package rescan finds the transactions relevant to a wallet by walking a
+// chain of BIP 158 filters. Only the blocks whose filters match the wallet's
+// scripts or outpoints are fetched, so a light client downloads a small
+// fraction of the chain. The wallet's scripts may also be given as output
+// descriptors, whose ranged scripts are watched with a gap limit that moves
+// as the rescan finds them paid to. A Scheduler can fetch the matching blocks
+// from several sources at once, ahead of the block being scanned, so that a
+// rescan of a busy wallet doesn't wait on each download in turn.
+package rescan
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/christsim/bips/bip-0158/backend/chainhash"
+	"github.com/christsim/bips/bip-0158/backend/wire"
+	"github.com/christsim/bips/bip-0158/gcs"
+	"github.com/christsim/bips/bip-0158/gcs/builder"
+)
+
+var (
+	// ErrStopped is returned by Err when the rescan was stopped before it
+	// reached its end height.
+	ErrStopped = errors.New("rescan stopped")
+
+	// ErrInvalidRange is returned by Err when the start height is above
+	// the end height.
+	ErrInvalidRange = errors.New("invalid rescan range")
+)
+
+// FilterSource provides the filters the rescan walks, such as a filter store
+// or a peer serving BIP 157 requests. *filterdb.Source satisfies it.
+type FilterSource interface {
+	// Filter returns the filter of the block at the passed height along
+	// with the block's hash, which the filter is keyed with. A nil filter
+	// is treated as empty.
+	Filter(height uint32) (*gcs.Filter, *chainhash.Hash, error)
+}
+
+// BlockSource provides the blocks whose filters match. backend.ChainClient
+// satisfies it.
+type BlockSource interface {
+	// GetBlock returns the block with the passed hash.
+	GetBlock(blockHash *chainhash.Hash) (*wire.MsgBlock, error)
+}
+
+// Descriptor is an output descriptor whose scripts the rescan watches, such
+// as one of a wallet's receive or change chains. *descriptor.Descriptor of
+// the bip-0380 module satisfies it.
+type Descriptor interface {
+	// IsRange reports whether the descriptor has a script at each child
+	// index rather than a single one.
+	IsRange() bool
+
+	// Scripts returns the output scripts of the descriptor at the passed
+	// child index.
+	Scripts(index uint32) ([][]byte, error)
+}
+
+// DefaultLookAhead is the number of scripts of a ranged descriptor watched
+// past the last one found to be used, when Config doesn't set LookAhead. It
+// is the gap limit of BIP 44.
+const DefaultLookAhead = 20
+
+// maxDescriptorIndex is one past the highest child index a ranged descriptor
+// derives scripts at.
+const maxDescriptorIndex = 1 << 31
+
+// Config holds the parameters of a rescan.
+type Config struct {
+	// Filters provides the filter of each block in the range.
+	Filters FilterSource
+
+	// Blocks provides the blocks whose filters match.
+	Blocks BlockSource
+
+	// Scheduler, if set, fetches the blocks whose filters match instead
+	// of Blocks, so that up to MaxPendingBlocks of them are downloaded,
+	// possibly from several sources at once, while earlier ones are
+	// scanned. The rescan cancels the requests it no longer needs when it
+	// ends, but doesn't start or stop the scheduler. Its sources must be
+	// safe to use alongside Filters.
+	Scheduler *Scheduler
+
+	// MaxPendingBlocks is the number of matched blocks requested from
+	// Scheduler ahead of the one being scanned. Zero means
+	// DefaultMaxPendingBlocks.
+	MaxPendingBlocks int
+
+	// StartHeight and EndHeight are the first and last block heights to
+	// scan, inclusive.
+	StartHeight uint32
+	EndHeight   uint32
+
+	// WatchScripts are the output scripts the wallet is interested in.
+	// Transactions paying to them are relevant, and the outputs they
+	// create are watched from then on so that spending them is noticed
+	// too.
+	WatchScripts [][]byte
+
+	// WatchOutPoints are the outputs the wallet already owns. Transactions
+	// spending them are relevant.
+	WatchOutPoints []wire.OutPoint
+
+	// WatchDescriptors are output descriptors whose scripts are watched
+	// like WatchScripts. Ranged descriptors are watched from index 0 up
+	// to LookAhead scripts past the highest index found to be paid to,
+	// so the watch list grows as the rescan finds the wallet's
+	// transactions.
+	WatchDescriptors []Descriptor
+
+	// LookAhead is the number of scripts of each ranged descriptor that
+	// are watched past the last one paid to. Zero means
+	// DefaultLookAhead.
+	LookAhead uint32
+}
+
+// RelevantTx is a transaction found by a rescan, along with where it was
+// found.
+type RelevantTx struct {
+	Tx        *wire.MsgTx
+	BlockHash chainhash.Hash
+	Height    uint32
+
+	// Index is the position of the transaction within its block.
+	Index int
+}
+
+// Rescan walks a range of filters, fetching the blocks that match the watched
+// scripts and outpoints and sending the relevant transactions they contain
+// over a channel.
+type Rescan struct {
+	cfg   Config
+	watch *WatchList
+
+	txs  chan *RelevantTx
+	quit chan struct{}
+	wg   sync.WaitGroup
+	stop sync.Once
+
+	err error
+}
+
+// New returns a rescan with the passed configuration, which is started by
+// calling Start.
+func New(cfg *Config) *Rescan {
+	r := &Rescan{
+		cfg:  *cfg,
+		txs:  make(chan *RelevantTx),
+		quit: make(chan struct{}),
+	}
+	if r.cfg.LookAhead == 0 {
+		r.cfg.LookAhead = DefaultLookAhead
+	}
+	if r.cfg.MaxPendingBlocks == 0 {
+		r.cfg.MaxPendingBlocks = DefaultMaxPendingBlocks
+	}
+
+	// A descriptor that fails to derive ends the rescan as soon as it
+	// starts, which is where errors are reported.
+	r.watch, r.err = NewWatchList(cfg.WatchDescriptors, r.cfg.LookAhead)
+	if r.err != nil {
+		r.watch, _ = NewWatchList(nil, r.cfg.LookAhead)
+	}
+	for _, script := range cfg.WatchScripts {
+		r.watch.WatchScript(script)
+	}
+	for _, outPoint := range cfg.WatchOutPoints {
+		r.watch.WatchOutPoint(outPoint)
+	}
+
+	return r
+}
+
+// Start begins the rescan in the background.
+func (r *Rescan) Start() {
+	r.wg.Add(1)
+	go r.rescanHandler()
+}
+
+// Stop ends the rescan early and waits for it to exit.
+func (r *Rescan) Stop() {
+	r.stop.Do(func() {
+		close(r.quit)
+	})
+	r.wg.Wait()
+}
+
+// Transactions returns the channel relevant transactions are sent over, in
+// chain order. It is closed once the rescan ends, after which Err reports why.
+func (r *Rescan) Transactions() <-chan *RelevantTx {
+	return r.txs
+}
+
+// Err returns the error that ended the rescan, or nil if it reached its end
+// height. It must only be called once the Transactions channel is closed.
+func (r *Rescan) Err() error {
+	return r.err
+}
+
+// WatchList returns what the rescan watches, which grows as it finds
+// outputs paid to the watched scripts and uses the scripts of ranged
+// descriptors. Its NextIndex tells where a wallet resumes giving out
+// addresses. It must only be called once the Transactions channel is
+// closed.
+func (r *Rescan) WatchList() *WatchList {
+	return r.watch
+}
+
+// pendingBlock is a block whose filter matched, waiting to be scanned.
+type pendingBlock struct {
+	height    uint32
+	blockHash chainhash.Hash
+
+	// req fetches the block when the rescan has a scheduler. Without one,
+	// the block is fetched from Blocks when it is scanned.
+	req *BlockRequest
+}
+
+// rescanHandler walks the filters from the start height to the end height. It
+// must be run as a goroutine.
+//
+// Filters are matched ahead of the block being scanned, as far as
+// MaxPendingBlocks matched blocks with a scheduler and one without, so that
+// the scheduler fetches those blocks meanwhile. Scanning a block may grow the
+// watch list, in which case the filters after it are matched again, so that
+// every block is matched against everything watched by the time it is
+// reached, as if the filters had been walked one at a time.
+func (r *Rescan) rescanHandler() {
+	defer r.wg.Done()
+	defer close(r.txs)
+
+	if r.err != nil {
+		return
+	}
+	if r.cfg.StartHeight > r.cfg.EndHeight {
+		r.err = ErrInvalidRange
+		return
+	}
+
+	maxPending := 1
+	if r.cfg.Scheduler != nil {
+		maxPending = r.cfg.MaxPendingBlocks
+	}
+
+	// pending holds the matched blocks in height order. The next height
+	// to match is kept as a uint64 so that it can move past the highest
+	// possible height.
+	var pending []*pendingBlock
+	defer func() {
+		for _, p := range pending {
+			if p.req != nil {
+				p.req.Cancel()
+			}
+		}
+	}()
+	next := uint64(r.cfg.StartHeight)
+	matcher := gcs.NewMatcher(len(r.watch.Entries()))
+	for {
+		// Matching goes on past a full pipeline while there are
+		// heights before the next block to scan left to match, after
+		// the watch list grew.
+		for next <= uint64(r.cfg.EndHeight) &&
+			(len(pending) < maxPending ||
+				next <= uint64(pending[0].height)) {
+
+			select {
+			case <-r.quit:
+				r.err = ErrStopped
+				return
+			default:
+			}
+
+			height := uint32(next)
+			next++
+			p, err := r.matchBlock(matcher, height, pending)
+			if err != nil {
+				r.err = err
+				return
+			}
+			if p != nil {
+				pending = insertPending(pending, p)
+			}
+		}
+		if len(pending) == 0 {
+			return
+		}
+
+		p := pending[0]
+		pending = pending[1:]
+		block, err := r.fetchBlock(p)
+		if err != nil {
+			r.err = err
+			return
+		}
+		entries := len(r.watch.Entries())
+		if err := r.scanBlock(block, &p.blockHash, p.height); err != nil {
+			r.err = err
+			return
+		}
+		if len(r.watch.Entries()) != entries &&
+			next > uint64(p.height)+1 {
+
+			next = uint64(p.height) + 1
+		}
+	}
+}
+
+// matchBlock matches the filter at height against the watch list, and
+// returns the block to scan if it matches and isn't pending already. The
+// block is requested from the scheduler, if there is one.
+func (r *Rescan) matchBlock(matcher *gcs.Matcher, height uint32,
+	pending []*pendingBlock) (*pendingBlock, error) {
+
+	for _, p := range pending {
+		if p.height == height {
+			return nil, nil
+		}
+	}
+
+	filter, blockHash, err := r.cfg.Filters.Filter(height)
+	if err != nil || filter == nil {
+		return nil, err
+	}
+	match, err := matcher.MatchAny(filter, builder.DeriveKey(blockHash),
+		r.watch.Entries())
+	if err != nil || !match {
+		return nil, err
+	}
+
+	p := &pendingBlock{height: height, blockHash: *blockHash}
+	if r.cfg.Scheduler != nil {
+		p.req = r.cfg.Scheduler.Fetch(blockHash)
+	}
+	return p, nil
+}
+
+// insertPending inserts the block into pending, keeping it in height order.
+func insertPending(pending []*pendingBlock,
+	p *pendingBlock) []*pendingBlock {
+
+	i := len(pending)
+	for i > 0 && pending[i-1].height > p.height {
+		i--
+	}
+	pending = append(pending, nil)
+	copy(pending[i+1:], pending[i:])
+	pending[i] = p
+	return pending
+}
+
+// fetchBlock returns the block of a pending match, waiting for the scheduler
+// to fetch it if it was requested from one.
+func (r *Rescan) fetchBlock(p *pendingBlock) (*wire.MsgBlock, error) {
+	if p.req == nil {
+		return r.cfg.Blocks.GetBlock(&p.blockHash)
+	}
+
+	select {
+	case <-p.req.Done():
+		return p.req.Result()
+	case <-r.quit:
+		p.req.Cancel()
+		return nil, ErrStopped
+	}
+}
+
+// scanBlock sends each transaction of a block whose filter matched that pays
+// to a watched script or spends a watched outpoint. False positives of the
+// filter simply yield no transactions.
+func (r *Rescan) scanBlock(block *wire.MsgBlock, blockHash *chainhash.Hash,
+	height uint32) error {
+
+	// Paying to a script of a ranged descriptor moves its look-ahead
+	// window past the script's index. The windows are moved for the whole
+	// block before its transactions are looked at, since a transaction
+	// may pay to a script that only a later one brings into its window.
+	for grew := true; grew; {
+		grew = false
+		for _, tx := range block.Transactions {
+			for _, txOut := range tx.TxOut {
+				derived, err := r.watch.MarkUsed(txOut.PkScript)
+				if err != nil {
+					return err
+				}
+				grew = grew || derived
+			}
+		}
+	}
+
+	for i, tx := range block.Transactions {
+		relevant := false
+
+		// Skip the inputs for the coinbase transaction
+		if i != 0 {
+			for _, txIn := range tx.TxIn {
+				if r.watch.HasOutPoint(txIn.PreviousOutPoint) {
+					relevant = true
+					break
+				}
+			}
+		}
+
+		// Outputs paying to a watched script are watched from now on,
+		// so that a later transaction spending them is found even
+		// with filters that don't include previous output scripts.
+		var txHash *chainhash.Hash
+		for j, txOut := range tx.TxOut {
+			if !r.watch.HasScript(txOut.PkScript) {
+				continue
+			}
+			if txHash == nil {
+				hash := tx.TxHash()
+				txHash = &hash
+			}
+			relevant = true
+			r.watch.WatchOutPoint(wire.OutPoint{
+				Hash: *txHash, Index: uint32(j),
+			})
+		}
+
+		if !relevant {
+			continue
+		}
+
+		select {
+		case r.txs <- &RelevantTx{
+			Tx:        tx,
+			BlockHash: *blockHash,
+			Height:    height,
+			Index:     i,
+		}:
+		case <-r.quit:
+			return ErrStopped
+		}
+	}
+
+	return nil
+}
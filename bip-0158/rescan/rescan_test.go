@@ -0,0 +1,280 @@
+package rescan_test
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/christsim/bips/bip-0158/backend/chainhash"
+	"github.com/christsim/bips/bip-0158/backend/wire"
+	"github.com/christsim/bips/bip-0158/gcs"
+	"github.com/christsim/bips/bip-0158/gcs/builder"
+	"github.com/christsim/bips/bip-0158/rescan"
+)
+
+// testP is the Golomb-Rice parameter of the filters of testChain.
+const testP = 20
+
+// testChain is a chain of blocks held in memory, which serves as both the
+// filter and the block source of a rescan.
+type testChain struct {
+	blocks []*wire.MsgBlock
+}
+
+// Filter returns the basic filter of the block at the passed height.
+func (c *testChain) Filter(height uint32) (*gcs.Filter, *chainhash.Hash,
+	error) {
+
+	if int(height) >= len(c.blocks) {
+		return nil, nil, fmt.Errorf("no block at height %d", height)
+	}
+	block := c.blocks[height]
+	filter, err := builder.BuildFilter(builder.BasicPolicy{
+		ScriptTypes: builder.AllScriptTypes,
+	}, block, testP)
+	if err != nil {
+		return nil, nil, err
+	}
+	blockHash := block.BlockHash()
+	return filter, &blockHash, nil
+}
+
+// GetBlock returns the block with the passed hash.
+func (c *testChain) GetBlock(blockHash *chainhash.Hash) (*wire.MsgBlock,
+	error) {
+
+	for _, block := range c.blocks {
+		if block.BlockHash() == *blockHash {
+			return block, nil
+		}
+	}
+	return nil, fmt.Errorf("no block %v", blockHash)
+}
+
+// addBlock appends a block holding a coinbase and the passed transactions.
+func (c *testChain) addBlock(txs ...*wire.MsgTx) {
+	height := byte(len(c.blocks))
+	coinbase := &wire.MsgTx{
+		Version: 1,
+		TxIn: []*wire.TxIn{{
+			PreviousOutPoint: wire.OutPoint{Index: ^uint32(0)},
+			SignatureScript:  []byte{0x01, height},
+		}},
+		TxOut: []*wire.TxOut{{Value: 50, PkScript: []byte{0x51}}},
+	}
+	block := &wire.MsgBlock{
+		Header:       wire.BlockHeader{Nonce: uint32(height)},
+		Transactions: append([]*wire.MsgTx{coinbase}, txs...),
+	}
+	if height > 0 {
+		block.Header.PrevBlock = c.blocks[height-1].BlockHash()
+	}
+	c.blocks = append(c.blocks, block)
+}
+
+// payTx returns a transaction spending the outpoint to the passed scripts.
+func payTx(outPoint wire.OutPoint, scripts ...[]byte) *wire.MsgTx {
+	tx := &wire.MsgTx{
+		Version: 1,
+		TxIn:    []*wire.TxIn{{PreviousOutPoint: outPoint}},
+	}
+	for _, script := range scripts {
+		tx.TxOut = append(tx.TxOut, &wire.TxOut{
+			Value: 1, PkScript: script,
+		})
+	}
+	return tx
+}
+
+// testDescriptor is a ranged descriptor whose script at index i is a P2WPKH
+// script holding i, failing at index failAt if it is non-zero.
+type testDescriptor struct {
+	failAt uint32
+}
+
+// IsRange returns true.
+func (d testDescriptor) IsRange() bool {
+	return true
+}
+
+// Scripts returns the script at the passed index.
+func (d testDescriptor) Scripts(index uint32) ([][]byte, error) {
+	if d.failAt != 0 && index >= d.failAt {
+		return nil, errDerive
+	}
+	script := make([]byte, 22)
+	script[1] = 0x14
+	script[21] = byte(index)
+	return [][]byte{script}, nil
+}
+
+// errDerive is the error testDescriptor fails with.
+var errDerive = errors.New("can't derive")
+
+// TestRescan rescans a chain in which a watched script is paid to and its
+// output spent later, and in which the scripts of a ranged descriptor are
+// paid to in and out of its look-ahead window, with and without a
+// scheduler.
+func TestRescan(t *testing.T) {
+	watched := []byte{0x00, 0x14, 0xaa, 0xaa, 0xaa, 0xaa, 0xaa, 0xaa, 0xaa,
+		0xaa, 0xaa, 0xaa, 0xaa, 0xaa, 0xaa, 0xaa, 0xaa, 0xaa, 0xaa,
+		0xaa, 0xaa, 0xaa}
+	other := []byte{0x6a, 0x01, 0xbb}
+	desc := testDescriptor{}
+	descScript := func(index uint32) []byte {
+		scripts, _ := desc.Scripts(index)
+		return scripts[0]
+	}
+
+	chain := &testChain{}
+	chain.addBlock()
+	pay := payTx(wire.OutPoint{Index: 7}, other, watched)
+	chain.addBlock(pay)
+	chain.addBlock(payTx(wire.OutPoint{Index: 8}, other))
+	paid := wire.OutPoint{Hash: pay.TxHash(), Index: 1}
+	chain.addBlock(payTx(paid, other))
+	chain.addBlock(payTx(wire.OutPoint{Index: 9}, descScript(1)))
+	chain.addBlock(payTx(wire.OutPoint{Index: 10}, descScript(3)))
+	chain.addBlock(payTx(wire.OutPoint{Index: 11}, descScript(9)))
+	tip := uint32(len(chain.blocks) - 1)
+
+	tests := []struct {
+		name    string
+		cfg     rescan.Config
+		heights []uint32
+
+		// nextIndex is the index the descriptor's addresses resume
+		// at, if it is watched.
+		nextIndex uint32
+		err       error
+	}{{
+		name: "script",
+		cfg: rescan.Config{
+			EndHeight:    tip,
+			WatchScripts: [][]byte{watched},
+		},
+		heights: []uint32{1, 3},
+	}, {
+		name: "outpoint",
+		cfg: rescan.Config{
+			EndHeight:      tip,
+			WatchOutPoints: []wire.OutPoint{paid},
+		},
+		heights: []uint32{3},
+	}, {
+		name: "after payment",
+		cfg: rescan.Config{
+			StartHeight:  2,
+			EndHeight:    tip,
+			WatchScripts: [][]byte{watched},
+		},
+	}, {
+		name: "single block",
+		cfg: rescan.Config{
+			StartHeight:  1,
+			EndHeight:    1,
+			WatchScripts: [][]byte{watched},
+		},
+		heights: []uint32{1},
+	}, {
+		name: "descriptor",
+		cfg: rescan.Config{
+			EndHeight:        tip,
+			WatchDescriptors: []rescan.Descriptor{desc},
+			LookAhead:        2,
+		},
+		heights:   []uint32{4, 5},
+		nextIndex: 4,
+	}, {
+		name: "descriptor with default look-ahead",
+		cfg: rescan.Config{
+			EndHeight:        tip,
+			WatchDescriptors: []rescan.Descriptor{desc},
+		},
+		heights:   []uint32{4, 5, 6},
+		nextIndex: 10,
+	}, {
+		name: "failing descriptor",
+		cfg: rescan.Config{
+			EndHeight: tip,
+			WatchDescriptors: []rescan.Descriptor{
+				testDescriptor{failAt: 3},
+			},
+			LookAhead: 2,
+		},
+		err: errDerive,
+	}, {
+		name: "invalid range",
+		cfg: rescan.Config{
+			StartHeight:  3,
+			EndHeight:    1,
+			WatchScripts: [][]byte{watched},
+		},
+		err: rescan.ErrInvalidRange,
+	}}
+
+	for _, scheduled := range []bool{false, true} {
+		for _, test := range tests {
+			name := fmt.Sprintf("%s, scheduled %v", test.name,
+				scheduled)
+			t.Run(name, func(t *testing.T) {
+				r, heights := runRescan(t, chain, test.cfg,
+					scheduled)
+				if !errors.Is(r.Err(), test.err) {
+					t.Fatalf("got error %v, want %v", r.Err(),
+						test.err)
+				}
+				if !reflect.DeepEqual(heights, test.heights) {
+					t.Fatalf("found transactions at %v, "+
+						"want %v", heights, test.heights)
+				}
+				if test.err != nil ||
+					len(test.cfg.WatchDescriptors) == 0 {
+
+					return
+				}
+				next := r.WatchList().NextIndex(0)
+				if next != test.nextIndex {
+					t.Fatalf("next index %d, want %d", next,
+						test.nextIndex)
+				}
+			})
+		}
+	}
+}
+
+// runRescan rescans the chain with the passed configuration, fetching blocks
+// through a scheduler if scheduled is set, and returns the stopped rescan
+// along with the heights of the transactions it found.
+func runRescan(t *testing.T, chain *testChain, cfg rescan.Config,
+	scheduled bool) (*rescan.Rescan, []uint32) {
+
+	t.Helper()
+
+	cfg.Filters = chain
+	cfg.Blocks = chain
+	if scheduled {
+		s := rescan.NewScheduler(&rescan.SchedulerConfig{
+			Sources: []rescan.BlockSource{chain},
+		})
+		s.Start()
+		defer s.Stop()
+		cfg.Scheduler = s
+	}
+
+	r := rescan.New(&cfg)
+	r.Start()
+	var heights []uint32
+	for tx := range r.Transactions() {
+		heights = append(heights, tx.Height)
+		block := chain.blocks[tx.Height]
+		if block.Transactions[tx.Index] != tx.Tx {
+			t.Fatalf("height %d: transaction %d isn't the block's",
+				tx.Height, tx.Index)
+		}
+	}
+	r.Stop()
+
+	return r, heights
+}
@@ -0,0 +1,235 @@
+package rescan
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/christsim/bips/bip-0158/backend/chainhash"
+	"github.com/christsim/bips/bip-0158/backend/wire"
+)
+
+// ErrCanceled is the error of a block request canceled, or cut short by the
+// scheduler stopping, before its block was fetched.
+var ErrCanceled = errors.New("block request canceled")
+
+// DefaultBatchSize is the most blocks a scheduler fetches with one request
+// to a BatchBlockSource, when SchedulerConfig doesn't set BatchSize. It is
+// the number of blocks Bitcoin Core has in flight from a peer at once.
+const DefaultBatchSize = 16
+
+// DefaultMaxPendingBlocks is the number of matched blocks a rescan requests
+// from its scheduler ahead of the one it is scanning, when Config doesn't set
+// MaxPendingBlocks.
+const DefaultMaxPendingBlocks = 32
+
+// BatchBlockSource is a BlockSource that can fetch several blocks with a
+// single request, as a peer is sent one getdata message for all of them.
+// *lightclient.Client satisfies it.
+type BatchBlockSource interface {
+	BlockSource
+
+	// GetBlocks returns the blocks with the passed hashes, in the same
+	// order.
+	GetBlocks(blockHashes []chainhash.Hash) ([]*wire.MsgBlock, error)
+}
+
+// SchedulerConfig holds the parameters of a Scheduler.
+type SchedulerConfig struct {
+	// Sources are the sources blocks are fetched from, such as
+	// connections to different peers. Each request is fetched from
+	// whichever source is free first.
+	Sources []BlockSource
+
+	// MaxInFlight is the number of requests each source is sent at
+	// once. Zero means one, which sources that can't be used
+	// concurrently, such as a *lightclient.Client, need.
+	MaxInFlight int
+
+	// BatchSize is the most blocks fetched with one request from a
+	// source that is a BatchBlockSource. Zero means DefaultBatchSize.
+	BatchSize int
+}
+
+// BlockRequest is a block queued to be fetched by a Scheduler.
+type BlockRequest struct {
+	// BlockHash is the hash of the requested block.
+	BlockHash chainhash.Hash
+
+	s    *Scheduler
+	done chan struct{}
+	once sync.Once
+
+	block *wire.MsgBlock
+	err   error
+}
+
+// Done returns a channel that is closed once the request completes, after
+// which Result returns its outcome.
+func (r *BlockRequest) Done() <-chan struct{} {
+	return r.done
+}
+
+// Result returns the fetched block, or the error fetching it failed with. It
+// must only be called once Done is closed.
+func (r *BlockRequest) Result() (*wire.MsgBlock, error) {
+	return r.block, r.err
+}
+
+// Cancel drops the request if it hasn't been sent to a source yet, completing
+// it with ErrCanceled. A request already sent completes with its block once
+// the source answers.
+func (r *BlockRequest) Cancel() {
+	r.s.mtx.Lock()
+	defer r.s.mtx.Unlock()
+
+	for i, queued := range r.s.queue {
+		if queued == r {
+			r.s.queue = append(r.s.queue[:i], r.s.queue[i+1:]...)
+			r.complete(nil, ErrCanceled)
+			return
+		}
+	}
+}
+
+// complete records the outcome of the request, unless it already has one.
+func (r *BlockRequest) complete(block *wire.MsgBlock, err error) {
+	r.once.Do(func() {
+		r.block, r.err = block, err
+		close(r.done)
+	})
+}
+
+// Scheduler fetches blocks from a set of sources in the background, keeping
+// up to MaxInFlight requests outstanding to each, so that the blocks a rescan
+// of a busy wallet matches are downloaded while it scans earlier ones rather
+// than one after another. Requests are served in the order they are made,
+// several at a time from sources that support batches.
+type Scheduler struct {
+	cfg SchedulerConfig
+
+	mtx     sync.Mutex
+	cond    *sync.Cond
+	queue   []*BlockRequest
+	stopped bool
+
+	wg sync.WaitGroup
+}
+
+// NewScheduler returns a scheduler with the passed configuration, which is
+// started by calling Start.
+func NewScheduler(cfg *SchedulerConfig) *Scheduler {
+	s := &Scheduler{cfg: *cfg}
+	if s.cfg.MaxInFlight == 0 {
+		s.cfg.MaxInFlight = 1
+	}
+	if s.cfg.BatchSize == 0 {
+		s.cfg.BatchSize = DefaultBatchSize
+	}
+	s.cond = sync.NewCond(&s.mtx)
+	return s
+}
+
+// Start launches MaxInFlight fetchers for each source.
+func (s *Scheduler) Start() {
+	for _, source := range s.cfg.Sources {
+		for i := 0; i < s.cfg.MaxInFlight; i++ {
+			s.wg.Add(1)
+			go s.fetcher(source)
+		}
+	}
+}
+
+// Stop completes every queued request with ErrCanceled and waits for the
+// requests already sent to be answered.
+func (s *Scheduler) Stop() {
+	s.mtx.Lock()
+	s.stopped = true
+	for _, r := range s.queue {
+		r.complete(nil, ErrCanceled)
+	}
+	s.queue = nil
+	s.cond.Broadcast()
+	s.mtx.Unlock()
+
+	s.wg.Wait()
+}
+
+// Fetch queues the block with the passed hash to be fetched. Requests made
+// once the scheduler is stopped complete with ErrCanceled at once.
+func (s *Scheduler) Fetch(blockHash *chainhash.Hash) *BlockRequest {
+	r := &BlockRequest{
+		BlockHash: *blockHash,
+		s:         s,
+		done:      make(chan struct{}),
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.stopped {
+		r.complete(nil, ErrCanceled)
+		return r
+	}
+	s.queue = append(s.queue, r)
+	s.cond.Signal()
+	return r
+}
+
+// next waits for queued requests and takes up to max of them off the queue.
+// It returns nil once the scheduler is stopped.
+func (s *Scheduler) next(max int) []*BlockRequest {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	for len(s.queue) == 0 && !s.stopped {
+		s.cond.Wait()
+	}
+	if s.stopped {
+		return nil
+	}
+
+	n := len(s.queue)
+	if n > max {
+		n = max
+	}
+	reqs := append([]*BlockRequest(nil), s.queue[:n]...)
+	s.queue = s.queue[n:]
+	return reqs
+}
+
+// fetcher sends queued requests to the source until the scheduler is
+// stopped. It must be run as a goroutine.
+func (s *Scheduler) fetcher(source BlockSource) {
+	defer s.wg.Done()
+
+	batchSource, batches := source.(BatchBlockSource)
+	max := 1
+	if batches {
+		max = s.cfg.BatchSize
+	}
+	for {
+		reqs := s.next(max)
+		if reqs == nil {
+			return
+		}
+
+		if len(reqs) == 1 {
+			block, err := source.GetBlock(&reqs[0].BlockHash)
+			reqs[0].complete(block, err)
+			continue
+		}
+
+		blockHashes := make([]chainhash.Hash, len(reqs))
+		for i, r := range reqs {
+			blockHashes[i] = r.BlockHash
+		}
+		blocks, err := batchSource.GetBlocks(blockHashes)
+		for i, r := range reqs {
+			if err != nil {
+				r.complete(nil, err)
+				continue
+			}
+			r.complete(blocks[i], nil)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package rescan
+
+import (
+	"github.com/christsim/bips/bip-0158/backend/wire"
+	"github.com/christsim/bips/bip-0158/gcs/builder"
+)
+
+// descriptorIndex locates a script derived from one of the watched
+// descriptors.
+type descriptorIndex struct {
+	desc  int
+	index uint32
+}
+
+// WatchList is the set of scripts and outpoints a wallet watches filters
+// for, kept as the entries a BIP 158 filter holds for them so it can be
+// passed to MatchAny as it is. Scripts may be derived from output
+// descriptors: each ranged one is watched from index 0 up to a look-ahead
+// window past the highest index used, which MarkUsed moves as payments to
+// the descriptor are found, so that the set grows with the wallet.
+type WatchList struct {
+	descs     []Descriptor
+	lookAhead uint32
+
+	scripts   map[string]struct{}
+	outPoints map[wire.OutPoint]struct{}
+
+	// derived maps the scripts derived from the descriptors to where
+	// they were derived, next holds the first index of each descriptor
+	// that hasn't been derived yet, and used one past the highest index
+	// of each found to be paid to.
+	derived map[string]descriptorIndex
+	next    []uint32
+	used    []uint32
+
+	// entries holds the filter entries of everything being watched, in
+	// the form they appear in a filter.
+	entries [][]byte
+}
+
+// NewWatchList returns a watch list of the scripts of the descriptors: the
+// only one of each descriptor that isn't ranged, and the first lookAhead of
+// each ranged one. Zero means DefaultLookAhead.
+func NewWatchList(descs []Descriptor, lookAhead uint32) (*WatchList, error) {
+	if lookAhead == 0 {
+		lookAhead = DefaultLookAhead
+	}
+	w := &WatchList{
+		descs:     descs,
+		lookAhead: lookAhead,
+		scripts:   make(map[string]struct{}),
+		outPoints: make(map[wire.OutPoint]struct{}),
+		derived:   make(map[string]descriptorIndex),
+		next:      make([]uint32, len(descs)),
+		used:      make([]uint32, len(descs)),
+	}
+	for i := range descs {
+		if err := w.derive(i, lookAhead); err != nil {
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+// WatchScript adds an output script to the watch list.
+func (w *WatchList) WatchScript(script []byte) {
+	if _, ok := w.scripts[string(script)]; ok {
+		return
+	}
+	w.scripts[string(script)] = struct{}{}
+	w.entries = append(w.entries, script)
+}
+
+// WatchOutPoint adds an outpoint to the watch list.
+func (w *WatchList) WatchOutPoint(outPoint wire.OutPoint) {
+	if _, ok := w.outPoints[outPoint]; ok {
+		return
+	}
+	w.outPoints[outPoint] = struct{}{}
+	w.entries = append(w.entries, builder.OutPointToFilterEntry(outPoint))
+}
+
+// HasScript reports whether the output script is watched.
+func (w *WatchList) HasScript(script []byte) bool {
+	_, ok := w.scripts[string(script)]
+	return ok
+}
+
+// HasOutPoint reports whether the outpoint is watched.
+func (w *WatchList) HasOutPoint(outPoint wire.OutPoint) bool {
+	_, ok := w.outPoints[outPoint]
+	return ok
+}
+
+// Entries returns the filter entries of everything watched. The slice must
+// not be modified, and is only valid until the watch list next grows.
+func (w *WatchList) Entries() [][]byte {
+	return w.entries
+}
+
+// MarkUsed records that the output script was paid to. If it was derived
+// from a ranged descriptor, the descriptor's look-ahead window is moved past
+// its index, and MarkUsed reports whether that derived new scripts.
+func (w *WatchList) MarkUsed(script []byte) (bool, error) {
+	d, ok := w.derived[string(script)]
+	if !ok {
+		return false, nil
+	}
+	if d.index+1 > w.used[d.desc] {
+		w.used[d.desc] = d.index + 1
+	}
+	next := w.next[d.desc]
+	end := uint64(d.index) + 1 + uint64(w.lookAhead)
+	if end > maxDescriptorIndex {
+		end = maxDescriptorIndex
+	}
+	if err := w.derive(d.desc, uint32(end)); err != nil {
+		return false, err
+	}
+	return w.next[d.desc] != next, nil
+}
+
+// NextIndex returns the first index of descriptor i, in the order the
+// descriptors were passed in, past every index found to be paid to: where a
+// wallet resumes giving out addresses after a rescan.
+func (w *WatchList) NextIndex(i int) uint32 {
+	return w.used[i]
+}
+
+// derive watches the scripts of descriptor i at each index from the first
+// one not derived yet up to end, exclusive. Descriptors that aren't ranged
+// have a single index, and ranged ones stop at the highest child index.
+func (w *WatchList) derive(i int, end uint32) error {
+	desc := w.descs[i]
+	if !desc.IsRange() {
+		end = 1
+	} else if end > maxDescriptorIndex {
+		end = maxDescriptorIndex
+	}
+
+	for ; w.next[i] < end; w.next[i]++ {
+		scripts, err := desc.Scripts(w.next[i])
+		if err != nil {
+			return err
+		}
+		for _, script := range scripts {
+			if _, ok := w.derived[string(script)]; !ok {
+				w.derived[string(script)] = descriptorIndex{
+					desc: i, index: w.next[i],
+				}
+			}
+			w.WatchScript(script)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package script
+
+import "fmt"
+
+// Class identifies a standard type of output script.
+type Class uint8
+
+const (
+	// NonStandard is any script that doesn't fall into one of the other
+	// classes, including scripts that fail to parse.
+	NonStandard Class = iota
+
+	// PubKey is a pay-to-pubkey script.
+	PubKey
+
+	// PubKeyHash is a pay-to-pubkey-hash script.
+	PubKeyHash
+
+	// ScriptHash is a pay-to-script-hash script.
+	ScriptHash
+
+	// MultiSig is a bare multisig script.
+	MultiSig
+
+	// NullData is a provably unspendable OP_RETURN script.
+	NullData
+
+	// WitnessV0KeyHash is a version 0 pay-to-witness-pubkey-hash script.
+	WitnessV0KeyHash
+
+	// WitnessV0ScriptHash is a version 0 pay-to-witness-script-hash
+	// script.
+	WitnessV0ScriptHash
+
+	// Taproot is a version 1 pay-to-taproot script.
+	Taproot
+
+	// WitnessUnknown is a witness program of a version or length without
+	// defined semantics.
+	WitnessUnknown
+
+	// NumClasses is the number of classes.
+	NumClasses
+)
+
+// classNames maps each class to its name, the one the builder's script types
+// use on the command line.
+var classNames = [NumClasses]string{
+	NonStandard:         "nonstandard",
+	PubKey:              "p2pk",
+	PubKeyHash:          "p2pkh",
+	ScriptHash:          "p2sh",
+	MultiSig:            "multisig",
+	NullData:            "nulldata",
+	WitnessV0KeyHash:    "p2wpkh",
+	WitnessV0ScriptHash: "p2wsh",
+	Taproot:             "p2tr",
+	WitnessUnknown:      "witness_unknown",
+}
+
+// String returns the name of the class.
+func (c Class) String() string {
+	if c >= NumClasses {
+		return fmt.Sprintf("unknown(%d)", uint8(c))
+	}
+	return classNames[c]
+}
+
+// Classify returns the class of the output script. The templates are matched
+// on the bytes of the script, so that a script matching one is classified
+// the same however the rest of it would parse; only bare multisig scripts
+// are tokenized.
+func Classify(script []byte) Class {
+	switch {
+	case len(script) == 25 && script[0] == OpDup &&
+		script[1] == OpHash160 && script[2] == OpData20 &&
+		script[23] == OpEqualVerify && script[24] == OpCheckSig:
+
+		return PubKeyHash
+
+	case len(script) == 23 && script[0] == OpHash160 &&
+		script[1] == OpData20 && script[22] == OpEqual:
+
+		return ScriptHash
+
+	case len(script) == 22 && script[0] == Op0 && script[1] == OpData20:
+		return WitnessV0KeyHash
+
+	case len(script) == 34 && script[0] == Op0 && script[1] == OpData32:
+		return WitnessV0ScriptHash
+
+	case len(script) == 34 && script[0] == Op1 && script[1] == OpData32:
+		return Taproot
+
+	case (len(script) == 35 && script[0] == OpData33 ||
+		len(script) == 67 && script[0] == OpData65) &&
+		script[len(script)-1] == OpCheckSig:
+
+		return PubKey
+
+	case len(script) > 0 && script[0] == OpReturn:
+		return NullData
+	}
+
+	if _, _, ok := WitnessProgram(script); ok {
+		return WitnessUnknown
+	}
+	if IsMultiSig(script) {
+		return MultiSig
+	}
+	return NonStandard
+}
+
+// WitnessProgram returns the version and program of a witness program, a
+// small integer followed by a single push of 2 to 40 bytes as defined by
+// BIP 141, or false for other scripts.
+func WitnessProgram(script []byte) (int, []byte, bool) {
+	if len(script) < 4 || len(script) > 42 {
+		return 0, nil, false
+	}
+	if !IsSmallInt(script[0]) || int(script[1]) != len(script)-2 {
+		return 0, nil, false
+	}
+	return SmallInt(script[0]), script[2:], true
+}
+
+// IsMultiSig reports whether the script is a bare multisig script,
+//
+//	<m> <key>... <n> OP_CHECKMULTISIG
+//
+// with m and n small integers and n opcodes between them, as btcd's txscript
+// package recognizes them. Like btcd, it doesn't require the keys to be
+// validly encoded, or m to be at most n.
+func IsMultiSig(script []byte) bool {
+	if len(script) < 3 || script[len(script)-1] != OpCheckMultiSig {
+		return false
+	}
+	tokens, err := Tokenize(script)
+	if err != nil || len(tokens) < 3 || !IsSmallInt(tokens[0].Op) {
+		return false
+	}
+
+	// The keys run up to the first small integer after m, which must
+	// count them and be followed by OP_CHECKMULTISIG alone.
+	for i, t := range tokens[1:] {
+		if !IsSmallInt(t.Op) {
+			continue
+		}
+		return SmallInt(t.Op) == i && len(tokens) == i+3 &&
+			tokens[i+2].Op == OpCheckMultiSig
+	}
+	return false
+}
@@ -0,0 +1,170 @@
+// Package script tokenizes output and signature scripts, classifies output
+// scripts into the standard types, and extracts the data they push, without
+// going through the txscript package of whichever btcd backend is selected:
+//
+//	tokens, err := script.Tokenize(pkScript)
+//	class := script.Classify(pkScript)
+//	pushes, err := script.PushedData(pkScript)
+//
+// PushedData extracts pushes the way the legacy basic filter's "data pushes"
+// mode did, which inserted the pushes of every output script rather than the
+// scripts themselves. Scripts don't have to parse to be valid in an output:
+// the coinbase of testnet block 987876 has an output script whose last push
+// runs past its end. Tokenize returns the tokens before such a push along
+// with ErrMalformedPush, while PushedData returns none of them, so that a
+// filter of pushes holds nothing of an unparseable script, as the legacy
+// filter did.
+package script
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// ErrMalformedPush is returned for a script with a push that runs past its
+// end.
+var ErrMalformedPush = errors.New("script: malformed push")
+
+// Opcodes the tokenizer and classifier tell apart.
+const (
+	Op0             = 0x00
+	OpData20        = 0x14
+	OpData32        = 0x20
+	OpData33        = 0x21
+	OpData65        = 0x41
+	OpPushData1     = 0x4c
+	OpPushData2     = 0x4d
+	OpPushData4     = 0x4e
+	Op1             = 0x51
+	Op16            = 0x60
+	OpReturn        = 0x6a
+	OpDup           = 0x76
+	OpEqual         = 0x87
+	OpEqualVerify   = 0x88
+	OpHash160       = 0xa9
+	OpCheckSig      = 0xac
+	OpCheckMultiSig = 0xae
+)
+
+// Token is an opcode of a script along with the data it pushes.
+type Token struct {
+	// Op is the opcode.
+	Op byte
+
+	// Data is the data pushed by the opcode, empty but not nil for
+	// OP_0 and nil for opcodes other than pushes of data.
+	Data []byte
+
+	// Offset is the position of the opcode in the script.
+	Offset int
+}
+
+// IsPush reports whether the token pushes data, OP_0 included. Small
+// integers other than OP_0 don't count, as they push numbers.
+func (t Token) IsPush() bool {
+	return t.Op <= OpPushData4
+}
+
+// next returns the token at offset i of the script, and the offset of the one
+// after it.
+func next(script []byte, i int) (Token, int, error) {
+	t := Token{Op: script[i], Offset: i}
+	i++
+
+	var n, size int
+	switch {
+	case t.Op < OpPushData1:
+		n = int(t.Op)
+	case t.Op == OpPushData1:
+		size = 1
+	case t.Op == OpPushData2:
+		size = 2
+	case t.Op == OpPushData4:
+		size = 4
+	default:
+		return t, i, nil
+	}
+
+	if len(script)-i < size {
+		return t, i, fmt.Errorf("%w: opcode 0x%02x at %d needs %d "+
+			"size bytes, %d left", ErrMalformedPush, t.Op, t.Offset,
+			size, len(script)-i)
+	}
+	switch size {
+	case 1:
+		n = int(script[i])
+	case 2:
+		n = int(binary.LittleEndian.Uint16(script[i:]))
+	case 4:
+		// Compared as a uint64 so that sizes above the largest int
+		// of 32 bit platforms are reported rather than wrapping.
+		size := uint64(binary.LittleEndian.Uint32(script[i:]))
+		if size > uint64(len(script)) {
+			return t, i, fmt.Errorf("%w: opcode 0x%02x at %d "+
+				"pushes %d bytes, %d left", ErrMalformedPush,
+				t.Op, t.Offset, size, len(script)-i-4)
+		}
+		n = int(size)
+	}
+	i += size
+
+	if len(script)-i < n {
+		return t, i, fmt.Errorf("%w: opcode 0x%02x at %d pushes %d "+
+			"bytes, %d left", ErrMalformedPush, t.Op, t.Offset, n,
+			len(script)-i)
+	}
+	t.Data = script[i : i+n : i+n]
+	return t, i + n, nil
+}
+
+// Tokenize splits the script into its opcodes. If a push runs past the end of
+// the script, Tokenize returns the tokens before it along with an error
+// wrapping ErrMalformedPush. The data of the tokens refers to the script.
+func Tokenize(script []byte) ([]Token, error) {
+	var tokens []Token
+	for i := 0; i < len(script); {
+		t, n, err := next(script, i)
+		if err != nil {
+			return tokens, err
+		}
+		tokens = append(tokens, t)
+		i = n
+	}
+	return tokens, nil
+}
+
+// PushedData returns the data of every push of the script, in order, with
+// OP_0 pushing an empty item and the other small integers nothing, as btcd's
+// txscript.PushedData does. It returns no data for a script that fails to
+// parse, only an error wrapping ErrMalformedPush, since the legacy basic
+// filter took nothing from such scripts. The data refers to the script.
+func PushedData(script []byte) ([][]byte, error) {
+	var data [][]byte
+	for i := 0; i < len(script); {
+		t, n, err := next(script, i)
+		if err != nil {
+			return nil, err
+		}
+		if t.IsPush() {
+			data = append(data, t.Data)
+		}
+		i = n
+	}
+	return data, nil
+}
+
+// IsSmallInt reports whether the opcode pushes a small integer, OP_0 through
+// OP_16.
+func IsSmallInt(op byte) bool {
+	return op == Op0 || op >= Op1 && op <= Op16
+}
+
+// SmallInt returns the small integer pushed by the opcode, which must be one
+// IsSmallInt accepts.
+func SmallInt(op byte) int {
+	if op == Op0 {
+		return 0
+	}
+	return int(op-Op1) + 1
+}
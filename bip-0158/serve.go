@@ -0,0 +1,82 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/christsim/bips/bip-0158/backend/chaincfg"
+	"github.com/christsim/bips/bip-0158/backend/wire"
+	"github.com/christsim/bips/bip-0158/cfserver"
+	"github.com/christsim/bips/bip-0158/filterdb"
+)
+
+// networks maps the names accepted by -net to their parameters.
+var networks = map[string]*chaincfg.Params{
+	"mainnet":  &chaincfg.MainNetParams,
+	"testnet3": &chaincfg.TestNet3Params,
+	"regtest":  &chaincfg.RegressionNetParams,
+	"simnet":   &chaincfg.SimNetParams,
+}
+
+// runServe implements the serve subcommand, which serves the filters of a
+// filter store written by the index subcommand to light clients over the
+// P2P protocol.
+func runServe(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	dbPath := fs.String("db", "filterdb", "filter store to serve")
+	listen := fs.String("listen", "127.0.0.1:18333", "address to listen on")
+	netName := fs.String("net", "testnet3", "network to serve: mainnet, "+
+		"testnet3, regtest or simnet")
+	typeList := fs.String("types", "basic,extended", "comma separated list "+
+		"of filter types to serve")
+	headers := fs.Bool("headers", false, "answer getheaders with block "+
+		"headers fetched from the node over RPC")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	params, ok := networks[*netName]
+	if !ok {
+		return fmt.Errorf("unknown network %q", *netName)
+	}
+	var filterTypes []wire.FilterType
+	for _, name := range strings.Split(*typeList, ",") {
+		filterType, ok := indexedTypes[strings.TrimSpace(name)]
+		if !ok {
+			return fmt.Errorf("can't serve filter type %q", name)
+		}
+		filterTypes = append(filterTypes, filterType)
+	}
+
+	db, err := filterdb.Open(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	cfg := cfserver.Config{
+		Store:       db,
+		Net:         params.Net,
+		FilterTypes: filterTypes,
+	}
+	if *headers {
+		client, err := newRPCClient()
+		if err != nil {
+			return err
+		}
+		defer client.Shutdown()
+		cfg.Headers = client
+	}
+
+	l, err := net.Listen("tcp", *listen)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Serving %v filters on %v\n", *netName,
+		l.Addr())
+
+	return cfserver.New(cfg).Serve(l)
+}
@@ -0,0 +1,188 @@
+// Package services names the service bits nodes advertise in their version
+// messages and addr entries, and picks the peers whose services suit what a
+// node needs of them: the full chain or only its tip, compact filters,
+// witnesses.
+//
+// Most bits promise to answer some messages. NODE_NETWORK promises every
+// block of the chain, NODE_NETWORK_LIMITED of BIP 159 only the last
+// NetworkLimitedBlocks of them, so a peer of the latter suits a node only
+// while the node is near the tip of the peer's chain:
+//
+//	if services.Flags(version.Services).ServesBlock(peerHeight, height) {
+//		...
+//	}
+//
+// Select orders candidate peers by how well they serve a node at a height,
+// dropping those that lack the services it requires.
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/christsim/bips/bip-0158/backend/wire"
+)
+
+// Flags are the service bits of a node.
+type Flags uint64
+
+// The service bits of the BIPs.
+const (
+	// Network serves every block of the chain.
+	Network Flags = 1 << 0
+
+	// GetUTXO answers the getutxo messages of BIP 64.
+	GetUTXO Flags = 1 << 1
+
+	// Bloom answers the filterload messages of BIP 37, as BIP 111
+	// requires nodes to announce.
+	Bloom Flags = 1 << 2
+
+	// Witness serves blocks and transactions with their witnesses, as of
+	// BIP 144.
+	Witness Flags = 1 << 3
+
+	// XThin answers the Xtreme Thinblocks messages of Bitcoin Unlimited.
+	XThin Flags = 1 << 4
+
+	// CompactFilters answers the BIP 157 messages, serving the basic
+	// filters of BIP 158.
+	CompactFilters Flags = 1 << 6
+
+	// NetworkLimited serves the last NetworkLimitedBlocks blocks, as of
+	// BIP 159.
+	NetworkLimited Flags = 1 << 10
+
+	// P2PV2 accepts the encrypted transport of BIP 324.
+	P2PV2 Flags = 1 << 11
+)
+
+const (
+	// NetworkLimitedBlocks is the number of blocks at the tip of its
+	// chain a NetworkLimited node serves.
+	NetworkLimitedBlocks = 288
+
+	// ReorgBuffer is the margin BIP 159 asks nodes to allow, on top of
+	// the blocks they need of a NetworkLimited peer, for the peer's tip
+	// to move on or be reorganized while they fetch them.
+	ReorgBuffer = 144
+)
+
+// The services peers are commonly required to have.
+const (
+	// FilterPeer are those a BIP 157 light client needs to sync filters
+	// and fetch the blocks they match with their witnesses, of peers near
+	// the tip; add Network for older blocks.
+	FilterPeer = CompactFilters | Witness
+
+	// FullPeer are those a node syncing the whole chain needs.
+	FullPeer = Network | Witness
+)
+
+// names are the names of the service bits, as Bitcoin Core logs them.
+var names = []struct {
+	flag Flags
+	name string
+}{
+	{Network, "NETWORK"},
+	{GetUTXO, "GETUTXO"},
+	{Bloom, "BLOOM"},
+	{Witness, "WITNESS"},
+	{XThin, "XTHIN"},
+	{CompactFilters, "COMPACT_FILTERS"},
+	{NetworkLimited, "NETWORK_LIMITED"},
+	{P2PV2, "P2P_V2"},
+}
+
+// String returns the names of the service bits, separated by |, those not
+// named as UNKNOWN[2^bit], or NONE if no bit is set.
+func (f Flags) String() string {
+	if f == 0 {
+		return "NONE"
+	}
+	var parts []string
+	for _, n := range names {
+		if f&n.flag != 0 {
+			parts = append(parts, n.name)
+			f &^= n.flag
+		}
+	}
+	for bit := 0; f != 0; bit++ {
+		if f&1 != 0 {
+			parts = append(parts, fmt.Sprintf("UNKNOWN[2^%d]", bit))
+		}
+		f >>= 1
+	}
+	return strings.Join(parts, "|")
+}
+
+// Has reports whether every bit of required is set.
+func (f Flags) Has(required Flags) bool {
+	return f&required == required
+}
+
+// ServiceFlag returns the service bits as those of the wire package.
+func (f Flags) ServiceFlag() wire.ServiceFlag {
+	return wire.ServiceFlag(f)
+}
+
+// ServesBlock reports whether a node of the service bits, whose chain is
+// peerHeight blocks high, serves the block at height: any of its chain if
+// it's a Network node, and one of the last NetworkLimitedBlocks if it's a
+// NetworkLimited one.
+func (f Flags) ServesBlock(peerHeight, height int32) bool {
+	switch {
+	case height < 0 || height > peerHeight:
+		return false
+	case f.Has(Network):
+		return true
+	case f.Has(NetworkLimited):
+		return peerHeight-height < NetworkLimitedBlocks
+	}
+	return false
+}
+
+// ServesSync reports whether a node of the service bits, whose chain is
+// peerHeight blocks high, serves every block a node at height needs to
+// catch up with it: any Network node, and a NetworkLimited one if the node
+// is within NetworkLimitedBlocks less ReorgBuffer blocks of its tip.
+func (f Flags) ServesSync(peerHeight, height int32) bool {
+	switch {
+	case f.Has(Network):
+		return true
+	case f.Has(NetworkLimited):
+		return peerHeight-height < NetworkLimitedBlocks-ReorgBuffer
+	}
+	return false
+}
+
+// Peer is a candidate peer, with the service bits and height it advertised.
+type Peer struct {
+	Addr     string
+	Services Flags
+	Height   int32
+}
+
+// Select returns the peers of every service of required that serve a node
+// at height the blocks it needs, as ServesSync reports: Network peers
+// first, then NetworkLimited ones, each ordered by descending height. Peers
+// of the same rank keep their order.
+func Select(peers []Peer, required Flags, height int32) []Peer {
+	var selected []Peer
+	for _, p := range peers {
+		if p.Services.Has(required) &&
+			p.Services.ServesSync(p.Height, height) {
+
+			selected = append(selected, p)
+		}
+	}
+	sort.SliceStable(selected, func(i, j int) bool {
+		a, b := selected[i], selected[j]
+		if a.Services.Has(Network) != b.Services.Has(Network) {
+			return a.Services.Has(Network)
+		}
+		return a.Height > b.Height
+	})
+	return selected
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"crypto/rand"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/christsim/bips/bip-0158/attest"
+)
+
+// runKeygen implements the keygen subcommand, which writes a new key pair for
+// signing vector files.
+func runKeygen(args []string) error {
+	fs := flag.NewFlagSet("keygen", flag.ContinueOnError)
+	out := fs.String("out", "vectors", "path of the key files to write, "+
+		"with .key appended for the secret key and .pub for the public key")
+	comment := fs.String("comment", "bip-0158 test vectors", "comment to "+
+		"put in the key files")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	key, err := attest.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	// Refuse to overwrite an existing secret key, which would make
+	// everything signed with it unverifiable.
+	secFile, err := os.OpenFile(*out+".key",
+		os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = secFile.Write(key.Encode(*comment + " secret key"))
+	if closeErr := secFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(*out+".pub",
+		key.Public().Encode(*comment+" public key"), 0644)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote %v.key and %v.pub\n", *out, *out)
+	return nil
+}
+
+// runSign implements the sign subcommand, which writes a manifest of the
+// SHA-256 hashes of the vector files in a directory and signs it. Files are
+// named relative to the directory as extra arguments, or else every JSON file
+// in it is signed.
+func runSign(args []string) error {
+	fs := flag.NewFlagSet("sign", flag.ContinueOnError)
+	keyPath := fs.String("key", "vectors.key", "secret key to sign with")
+	dir := fs.String("dir", "gcstestvectors", "directory of the vector "+
+		"files to sign")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	keyFile, err := os.ReadFile(*keyPath)
+	if err != nil {
+		return err
+	}
+	key, err := attest.ParsePrivateKey(keyFile)
+	if err != nil {
+		return err
+	}
+
+	names := fs.Args()
+	if len(names) == 0 {
+		paths, err := filepath.Glob(filepath.Join(*dir, "*.json"))
+		if err != nil {
+			return err
+		}
+		for _, path := range paths {
+			names = append(names, filepath.Base(path))
+		}
+		sort.Strings(names)
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("no vector files in %v", *dir)
+	}
+
+	sums, err := attest.SignDir(*dir, names, key)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Signed %d files in %v with key %X\n", len(sums), *dir,
+		key.KeyNum)
+	return nil
+}
+
+// runVerifySignatures implements the verify-signatures subcommand, which
+// checks the signed manifest in a directory of vector files and the hash of
+// every file it lists. Vector files in the directory that the manifest
+// doesn't list are reported, since nothing vouches for them.
+func runVerifySignatures(args []string) error {
+	fs := flag.NewFlagSet("verify-signatures", flag.ContinueOnError)
+	pubPath := fs.String("pubkey", "vectors.pub", "public key to verify "+
+		"with")
+	dir := fs.String("dir", "gcstestvectors", "directory of the signed "+
+		"vector files")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	pubFile, err := os.ReadFile(*pubPath)
+	if err != nil {
+		return err
+	}
+	key, err := attest.ParsePublicKey(pubFile)
+	if err != nil {
+		return err
+	}
+
+	sums, err := attest.VerifyDir(*dir, key)
+	if err != nil {
+		return err
+	}
+	signed := make(map[string]bool, len(sums))
+	for _, sum := range sums {
+		signed[sum.Name] = true
+	}
+
+	paths, err := filepath.Glob(filepath.Join(*dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	var unsigned []string
+	for _, path := range paths {
+		if name := filepath.Base(path); !signed[name] {
+			unsigned = append(unsigned, name)
+		}
+	}
+
+	fmt.Printf("Verified %d files in %v signed with key %X\n", len(sums),
+		*dir, key.KeyNum)
+	if len(unsigned) != 0 {
+		return fmt.Errorf("files not covered by the signature: %v",
+			strings.Join(unsigned, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/christsim/bips/bip-0158/filterdb"
+	"github.com/christsim/bips/bip-0158/filterfile"
+	"github.com/christsim/bips/bip-0158/gcs/builder"
+)
+
+// runSnapshot implements the snapshot subcommand, which exports a run of
+// filters from a filter store built by the index subcommand to a flat filter
+// file that light clients can ship and query without a database.
+func runSnapshot(args []string) error {
+	fs := flag.NewFlagSet("snapshot", flag.ContinueOnError)
+	dbPath := fs.String("db", "filterdb", "filter store to export from")
+	out := fs.String("out", "filters.dat", "filter file to write")
+	typeName := fs.String("type", "basic", "filter type to export")
+	start := fs.Uint("start", 0, "first block height to export")
+	end := fs.Int64("end", -1, "last block height to export (default the "+
+		"store's tip)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	filterType, ok := indexedTypes[*typeName]
+	if !ok {
+		return fmt.Errorf("unknown filter type %q", *typeName)
+	}
+
+	db, err := filterdb.Open(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	last := uint32(*end)
+	if *end < 0 {
+		last, err = db.TipHeight()
+		if err != nil {
+			return err
+		}
+	}
+
+	w, err := filterfile.Create(*out, filterType, builder.DefaultP,
+		uint32(*start))
+	if err != nil {
+		return err
+	}
+
+	// The file must hold a contiguous run of blocks, so every height in
+	// the range has to have a filter.
+	err = db.ForEach(filterType, uint32(*start), last,
+		func(e *filterdb.Entry) error {
+			if e.Height != w.NextHeight() {
+				return fmt.Errorf("no filter at height %d",
+					w.NextHeight())
+			}
+			if e.Filter == nil {
+				return fmt.Errorf("filter at height %d has "+
+					"been pruned", e.Height)
+			}
+			return w.Append(&e.BlockHash, &e.Header, e.Filter)
+		})
+	if err != nil {
+		w.Close()
+		return err
+	}
+	if w.NextHeight() != last+1 {
+		w.Close()
+		return fmt.Errorf("no filter at height %d", w.NextHeight())
+	}
+
+	return w.Close()
+}
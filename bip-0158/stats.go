@@ -0,0 +1,278 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"strconv"
+
+	"github.com/christsim/bips/bip-0158/backend/wire"
+	"github.com/christsim/bips/bip-0158/gcs"
+	"github.com/christsim/bips/bip-0158/gcs/builder"
+)
+
+// filterStats accumulates the statistics for one filter type and value of P
+// over a range of blocks. M is only set when it differs from 2^P.
+type filterStats struct {
+	FilterType string  `json:"filter_type"`
+	P          uint8   `json:"p"`
+	M          uint64  `json:"m,omitempty"`
+	Blocks     int     `json:"blocks"`
+	Elements   uint64  `json:"elements"`
+	Bytes      uint64  `json:"bytes"`
+	Estimated  uint64  `json:"estimated_bytes"`
+	BitsPerElt float64 `json:"bits_per_element"`
+	Queries    uint64  `json:"fp_queries"`
+	Matches    uint64  `json:"fp_matches"`
+	FPRate     float64 `json:"fp_rate"`
+	ExpectedFP float64 `json:"expected_fp_rate"`
+
+	// dataBytes is the total size of the filters excluding their N
+	// prefix.
+	dataBytes uint64
+}
+
+// statsHeader is the header row of the CSV report, in the same order as the
+// columns written by csvRow.
+var statsHeader = []string{
+	"filter_type", "p", "blocks", "elements", "bytes", "estimated_bytes",
+	"bits_per_element", "fp_queries", "fp_matches", "fp_rate",
+	"expected_fp_rate",
+}
+
+// csvRow returns the statistics formatted as a row of the CSV report.
+func (s *filterStats) csvRow() []string {
+	return []string{
+		s.FilterType,
+		strconv.Itoa(int(s.P)),
+		strconv.Itoa(s.Blocks),
+		strconv.FormatUint(s.Elements, 10),
+		strconv.FormatUint(s.Bytes, 10),
+		strconv.FormatUint(s.Estimated, 10),
+		strconv.FormatFloat(s.BitsPerElt, 'f', 4, 64),
+		strconv.FormatUint(s.Queries, 10),
+		strconv.FormatUint(s.Matches, 10),
+		strconv.FormatFloat(s.FPRate, 'g', 6, 64),
+		strconv.FormatFloat(s.ExpectedFP, 'g', 6, 64),
+	}
+}
+
+// add folds a single filter into the statistics, querying it with each of
+// the scripts in corpus to measure its false positive rate.
+func (s *filterStats) add(f *gcs.Filter, key [gcs.KeySize]byte,
+	corpus [][]byte, m *gcs.Matcher) error {
+
+	nBytes, err := f.NBytes()
+	if err != nil {
+		return err
+	}
+	data, err := f.Bytes()
+	if err != nil {
+		return err
+	}
+
+	s.Blocks++
+	s.Elements += uint64(f.N())
+	s.Bytes += uint64(len(nBytes))
+	s.dataBytes += uint64(len(data))
+	s.Estimated += uint64(gcs.EstimateSizeM(f.N(), f.P(), f.M()))
+
+	// The corpus consists of random scripts which are overwhelmingly
+	// unlikely to actually be in the block, so every match is counted as
+	// a false positive. Empty filters can't match anything, so they
+	// don't tell us anything about the rate.
+	if f.N() == 0 {
+		return nil
+	}
+	for _, script := range corpus {
+		match, err := m.Match(f, key, script)
+		if err != nil {
+			return err
+		}
+		s.Queries++
+		if match {
+			s.Matches++
+		}
+	}
+
+	return nil
+}
+
+// finalize computes the derived ratios once all blocks have been added.
+func (s *filterStats) finalize() {
+	if s.Elements > 0 {
+		// The N prefix is excluded so that the figure reflects the
+		// cost of the Golomb-Rice coding itself.
+		s.BitsPerElt = float64(8*s.dataBytes) / float64(s.Elements)
+	}
+	if s.Queries > 0 {
+		s.FPRate = float64(s.Matches) / float64(s.Queries)
+	}
+	s.ExpectedFP = math.Pow(2, -float64(s.P))
+	if s.M != 0 {
+		s.ExpectedFP = 1 / float64(s.M)
+	}
+}
+
+// randomScriptCorpus returns n random P2WPKH-style output scripts generated
+// from the passed seed, so that reports are reproducible.
+func randomScriptCorpus(n int, seed int64) [][]byte {
+	rng := rand.New(rand.NewSource(seed))
+	corpus := make([][]byte, n)
+	for i := range corpus {
+		script := make([]byte, 22)
+		script[0] = 0x00
+		script[1] = 0x14
+		rng.Read(script[2:])
+		corpus[i] = script
+	}
+	return corpus
+}
+
+// runStats implements the stats subcommand, which builds the filters of the
+// selected policies for a range of blocks at every value of P in a range and
+// reports their sizes and empirically measured false positive rates.
+func runStats(args []string) error {
+	fs := flag.NewFlagSet("stats", flag.ContinueOnError)
+	start := fs.Int64("start", 0, "first block height to include")
+	end := fs.Int64("end", 100, "last block height to include")
+	minP := fs.Uint("minp", 1, "smallest value of P to report on")
+	maxP := fs.Uint("maxp", 32, "largest value of P to report on")
+	samples := fs.Int("samples", 10000, "number of random scripts to "+
+		"query each filter with")
+	seed := fs.Int64("seed", 1, "seed for the random script corpus")
+	format := fs.String("format", "csv", "output format: csv or json")
+	out := fs.String("out", "", "file to write the report to (default "+
+		"stdout)")
+	policyList := fs.String("policies", defaultPolicies, "comma separated "+
+		"list of filter policies to report on")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *minP > gcs.MaxP || *maxP > gcs.MaxP || *minP > *maxP {
+		return fmt.Errorf("invalid P range %d-%d", *minP, *maxP)
+	}
+	if *start > *end {
+		return fmt.Errorf("invalid block range %d-%d", *start, *end)
+	}
+	if *format != "csv" && *format != "json" {
+		return fmt.Errorf("unknown format %q", *format)
+	}
+	policies, err := parsePolicies(*policyList, builder.AllScriptTypes, nil)
+	if err != nil {
+		return err
+	}
+
+	client, err := newRPCClient()
+	if err != nil {
+		return err
+	}
+	defer client.Shutdown()
+
+	corpus := randomScriptCorpus(*samples, *seed)
+	matcher := gcs.NewMatcher(0)
+
+	stats := make([][]*filterStats, len(policies))
+	for j, policy := range policies {
+		for p := *minP; p <= *maxP; p++ {
+			stats[j] = append(stats[j], &filterStats{
+				FilterType: policy.Name(), P: uint8(p),
+			})
+		}
+	}
+
+	for height := *start; height <= *end; height++ {
+		fmt.Fprintf(os.Stderr, "Height: %d\n", height)
+		blockHash, err := client.GetBlockHash(height)
+		if err != nil {
+			return fmt.Errorf("couldn't get block hash: %v", err)
+		}
+		block, err := client.GetBlock(blockHash)
+		if err != nil {
+			return fmt.Errorf("couldn't get block: %v", err)
+		}
+
+		err = addBlockStats(block, policies, stats, corpus, matcher)
+		if err != nil {
+			return err
+		}
+	}
+
+	var report []*filterStats
+	for _, policyStats := range stats {
+		report = append(report, policyStats...)
+	}
+	for _, s := range report {
+		s.finalize()
+	}
+
+	w := io.Writer(os.Stdout)
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+
+	return writeStatsReport(w, *format, report)
+}
+
+// addBlockStats builds the filters for block under each policy at each value
+// of P covered by the passed statistics and folds them in. stats[j] holds the
+// statistics for policies[j].
+func addBlockStats(block *wire.MsgBlock, policies []builder.FilterPolicy,
+	stats [][]*filterStats, corpus [][]byte, m *gcs.Matcher) error {
+
+	blockHash := block.BlockHash()
+	key := builder.DeriveKey(&blockHash)
+
+	elements := builder.ExtractElements(block)
+	for j, policy := range policies {
+		ps := make([]uint8, len(stats[j]))
+		for i, s := range stats[j] {
+			ps[i] = s.P
+		}
+		filters, err := builder.BuildElementFilters(policy, elements,
+			ps)
+		if err != nil {
+			return fmt.Errorf("error generating %v filter: %v",
+				policy.Name(), err)
+		}
+		for i, s := range stats[j] {
+			if err := s.add(filters[i], key, corpus, m); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// writeStatsReport writes the report to w in the requested format.
+func writeStatsReport(w io.Writer, format string, report []*filterStats) error {
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(statsHeader); err != nil {
+		return err
+	}
+	for _, s := range report {
+		if err := cw.Write(s.csvRow()); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+
+	return cw.Error()
+}
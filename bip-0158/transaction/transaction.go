@@ -0,0 +1,174 @@
+// Package transaction holds bitcoin transactions in types of this module
+// rather than those of btcd, so that packages built on it and the vector
+// generator don't expose the wire types of whichever btcd backend is
+// selected. Transactions are serialized with and without their witnesses as
+// BIP 144 lays out, and measured as BIP 141 does:
+//
+//	tx, err := transaction.Parse(raw)
+//	weight := tx.Weight()
+//	vsize := tx.VSize()
+//	cost, err := tx.SigOpCost(prevOuts)
+//	feeRate := tx.FeeRate(fee)
+//
+// FromWire and Wire convert transactions from and to the wire types at the
+// edges, where blocks and messages are read.
+package transaction
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/christsim/bips/bip-0158/backend/chainhash"
+	"github.com/christsim/bips/bip-0158/backend/wire"
+)
+
+var (
+	// ErrTruncated is returned by Parse for a transaction that ends
+	// early.
+	ErrTruncated = errors.New("transaction: truncated transaction")
+
+	// ErrNonCanonicalSize is returned by Parse for a count or size that
+	// isn't in its shortest compact size encoding.
+	ErrNonCanonicalSize = errors.New("transaction: non-canonical " +
+		"compact size")
+
+	// ErrSizeTooLarge is returned by Parse for a count or size larger
+	// than MaxSize.
+	ErrSizeTooLarge = errors.New("transaction: compact size too large")
+
+	// ErrSuperfluousWitness is returned by Parse for a transaction with
+	// the witness flag whose inputs all have empty witnesses.
+	ErrSuperfluousWitness = errors.New("transaction: superfluous " +
+		"witness record")
+
+	// ErrUnknownFlags is returned by Parse for a transaction with a flag
+	// byte other than WitnessFlag.
+	ErrUnknownFlags = errors.New("transaction: unknown optional data")
+
+	// ErrTrailingData is returned by Parse for bytes after the lock time.
+	ErrTrailingData = errors.New("transaction: data after the " +
+		"transaction")
+
+	// ErrPrevOutCount is returned for a list of previous outputs that
+	// doesn't have one for each input.
+	ErrPrevOutCount = errors.New("transaction: previous output count " +
+		"doesn't match input count")
+)
+
+// OutPoint is the output of a transaction an input spends.
+type OutPoint struct {
+	Hash  chainhash.Hash
+	Index uint32
+}
+
+// TxIn is an input of a transaction.
+type TxIn struct {
+	PreviousOutPoint OutPoint
+	SignatureScript  []byte
+	Witness          [][]byte
+	Sequence         uint32
+}
+
+// TxOut is an output of a transaction.
+type TxOut struct {
+	Value    int64
+	PkScript []byte
+}
+
+// Tx is a transaction.
+type Tx struct {
+	Version  int32
+	TxIn     []*TxIn
+	TxOut    []*TxOut
+	LockTime uint32
+}
+
+// HasWitness reports whether any input of the transaction has a witness,
+// which makes its serialization that of BIP 144.
+func (tx *Tx) HasWitness() bool {
+	for _, in := range tx.TxIn {
+		if len(in.Witness) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// IsCoinBase reports whether the transaction is a coinbase: its only input
+// spends the null outpoint.
+func (tx *Tx) IsCoinBase() bool {
+	if len(tx.TxIn) != 1 {
+		return false
+	}
+	prevOut := tx.TxIn[0].PreviousOutPoint
+	return prevOut.Index == wire.MaxPrevOutIndex &&
+		prevOut.Hash == chainhash.Hash{}
+}
+
+// TxHash returns the txid of the transaction, the double SHA-256 of its
+// serialization without witnesses.
+func (tx *Tx) TxHash() chainhash.Hash {
+	var b bytes.Buffer
+	tx.serialize(&b, false)
+	return chainhash.DoubleHashH(b.Bytes())
+}
+
+// WitnessHash returns the wtxid of the transaction, the double SHA-256 of its
+// serialization with witnesses, which is its txid if it has none.
+func (tx *Tx) WitnessHash() chainhash.Hash {
+	var b bytes.Buffer
+	tx.serialize(&b, true)
+	return chainhash.DoubleHashH(b.Bytes())
+}
+
+// FromWire returns the transaction of a wire transaction, sharing its
+// scripts and witnesses.
+func FromWire(msg *wire.MsgTx) *Tx {
+	tx := &Tx{
+		Version:  msg.Version,
+		TxIn:     make([]*TxIn, len(msg.TxIn)),
+		TxOut:    make([]*TxOut, len(msg.TxOut)),
+		LockTime: msg.LockTime,
+	}
+	for i, in := range msg.TxIn {
+		tx.TxIn[i] = &TxIn{
+			PreviousOutPoint: OutPoint{
+				Hash:  in.PreviousOutPoint.Hash,
+				Index: in.PreviousOutPoint.Index,
+			},
+			SignatureScript: in.SignatureScript,
+			Witness:         in.Witness,
+			Sequence:        in.Sequence,
+		}
+	}
+	for i, out := range msg.TxOut {
+		tx.TxOut[i] = &TxOut{Value: out.Value, PkScript: out.PkScript}
+	}
+	return tx
+}
+
+// Wire returns the wire transaction of the transaction, sharing its scripts
+// and witnesses.
+func (tx *Tx) Wire() *wire.MsgTx {
+	msg := &wire.MsgTx{
+		Version:  tx.Version,
+		TxIn:     make([]*wire.TxIn, len(tx.TxIn)),
+		TxOut:    make([]*wire.TxOut, len(tx.TxOut)),
+		LockTime: tx.LockTime,
+	}
+	for i, in := range tx.TxIn {
+		msg.TxIn[i] = &wire.TxIn{
+			PreviousOutPoint: wire.OutPoint{
+				Hash:  in.PreviousOutPoint.Hash,
+				Index: in.PreviousOutPoint.Index,
+			},
+			SignatureScript: in.SignatureScript,
+			Witness:         in.Witness,
+			Sequence:        in.Sequence,
+		}
+	}
+	for i, out := range tx.TxOut {
+		msg.TxOut[i] = &wire.TxOut{Value: out.Value, PkScript: out.PkScript}
+	}
+	return msg
+}
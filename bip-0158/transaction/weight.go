@@ -0,0 +1,260 @@
+package transaction
+
+import "fmt"
+
+const (
+	// WitnessScaleFactor is the factor BIP 141 discounts witness bytes
+	// by: the weight of a byte outside the witness.
+	WitnessScaleFactor = 4
+
+	// MaxBlockWeight is the weight limit of blocks.
+	MaxBlockWeight = 4000000
+
+	// MaxBlockSigOpsCost is the sigop cost limit of blocks.
+	MaxBlockSigOpsCost = 80000
+
+	// DefaultBytesPerSigOp is the number of virtual bytes Bitcoin Core
+	// charges each sigop of a transaction for its policy size, so that
+	// transactions heavy on sigops pay for them.
+	DefaultBytesPerSigOp = 20
+)
+
+// BaseSize returns the size of the transaction without its witnesses.
+func (tx *Tx) BaseSize() int {
+	return len(tx.BytesNoWitness())
+}
+
+// TotalSize returns the size of the transaction with its witnesses.
+func (tx *Tx) TotalSize() int {
+	return len(tx.Bytes())
+}
+
+// Weight returns the weight of the transaction, three times its base size
+// plus its total size.
+func (tx *Tx) Weight() int {
+	return tx.BaseSize()*(WitnessScaleFactor-1) + tx.TotalSize()
+}
+
+// VSize returns the virtual size of the transaction, its weight divided by
+// WitnessScaleFactor and rounded up.
+func (tx *Tx) VSize() int {
+	return (tx.Weight() + WitnessScaleFactor - 1) / WitnessScaleFactor
+}
+
+// PolicyVSize returns the virtual size Bitcoin Core's policy gives a
+// transaction of the sigop cost: its virtual size, or that of its sigop cost
+// at DefaultBytesPerSigOp bytes each if that is larger.
+func (tx *Tx) PolicyVSize(sigOpCost int) int {
+	weight := tx.Weight()
+	if sigOpCost*DefaultBytesPerSigOp > weight {
+		weight = sigOpCost * DefaultBytesPerSigOp
+	}
+	return (weight + WitnessScaleFactor - 1) / WitnessScaleFactor
+}
+
+// Fee returns the fee of the transaction: the value of the outputs its
+// inputs spend, in their order, less the value of its outputs.
+func (tx *Tx) Fee(prevOuts []*TxOut) (int64, error) {
+	if len(prevOuts) != len(tx.TxIn) {
+		return 0, fmt.Errorf("%w: %d outputs for %d inputs",
+			ErrPrevOutCount, len(prevOuts), len(tx.TxIn))
+	}
+	var fee int64
+	for _, prevOut := range prevOuts {
+		fee += prevOut.Value
+	}
+	for _, txOut := range tx.TxOut {
+		fee -= txOut.Value
+	}
+	return fee, nil
+}
+
+// FeeRate returns the fee rate of the transaction paying the fee, in
+// satoshis per 1000 virtual bytes, rounded down as Bitcoin Core does.
+func (tx *Tx) FeeRate(fee int64) int64 {
+	return fee * 1000 / int64(tx.VSize())
+}
+
+// Opcodes that count as sigops, and the bounds of small integers.
+const (
+	opPushData1           = 0x4c
+	opPushData2           = 0x4d
+	opPushData4           = 0x4e
+	op1                   = 0x51
+	op16                  = 0x60
+	opCheckSig            = 0xac
+	opCheckSigVerify      = 0xad
+	opCheckMultiSig       = 0xae
+	opCheckMultiSigVerify = 0xaf
+	opHash160             = 0xa9
+	opEqual               = 0x87
+)
+
+// maxPubKeysPerMultiSig is the number of sigops a CHECKMULTISIG counts as
+// when its key count isn't known.
+const maxPubKeysPerMultiSig = 20
+
+// nextOp returns the opcode at the start of script along with the data it
+// pushes and the rest of the script, or false if the push runs past its
+// end.
+func nextOp(script []byte) (byte, []byte, []byte, bool) {
+	op := script[0]
+	script = script[1:]
+	n := 0
+	switch {
+	case op < opPushData1:
+		n = int(op)
+	case op == opPushData1:
+		if len(script) < 1 {
+			return 0, nil, nil, false
+		}
+		n, script = int(script[0]), script[1:]
+	case op == opPushData2:
+		if len(script) < 2 {
+			return 0, nil, nil, false
+		}
+		n, script = int(script[0])|int(script[1])<<8, script[2:]
+	case op == opPushData4:
+		if len(script) < 4 {
+			return 0, nil, nil, false
+		}
+		size := uint64(script[0]) | uint64(script[1])<<8 |
+			uint64(script[2])<<16 | uint64(script[3])<<24
+		if size > uint64(len(script)-4) {
+			return 0, nil, nil, false
+		}
+		n, script = int(size), script[4:]
+	}
+	if n > len(script) {
+		return 0, nil, nil, false
+	}
+	return op, script[:n], script[n:], true
+}
+
+// sigOpCount counts the sigops of the script as Bitcoin Core does, up to
+// where it fails to parse. A CHECKMULTISIG counts as the number of keys of
+// the small integer before it if accurate is set, and as
+// maxPubKeysPerMultiSig otherwise.
+func sigOpCount(script []byte, accurate bool) int {
+	n := 0
+	var last byte = 0xff
+	for len(script) > 0 {
+		op, _, rest, ok := nextOp(script)
+		if !ok {
+			break
+		}
+		switch op {
+		case opCheckSig, opCheckSigVerify:
+			n++
+		case opCheckMultiSig, opCheckMultiSigVerify:
+			if accurate && last >= op1 && last <= op16 {
+				n += int(last-op1) + 1
+			} else {
+				n += maxPubKeysPerMultiSig
+			}
+		}
+		last, script = op, rest
+	}
+	return n
+}
+
+// lastPush returns the data of the last push of a script that only pushes
+// data, or false if the script does anything else or fails to parse.
+func lastPush(script []byte) ([]byte, bool) {
+	var data []byte
+	for len(script) > 0 {
+		op, pushed, rest, ok := nextOp(script)
+		if !ok || op > op16 {
+			return nil, false
+		}
+		data, script = pushed, rest
+	}
+	return data, true
+}
+
+// isScriptHash reports whether the script is P2SH,
+// OP_HASH160 <20 bytes> OP_EQUAL.
+func isScriptHash(script []byte) bool {
+	return len(script) == 23 && script[0] == opHash160 &&
+		script[1] == 0x14 && script[22] == opEqual
+}
+
+// witnessProgram returns the version and program of a witness program
+// script, a small integer followed by a push of 2 to 40 bytes, or false for
+// other scripts.
+func witnessProgram(script []byte) (int, []byte, bool) {
+	if len(script) < 4 || len(script) > 42 {
+		return 0, nil, false
+	}
+	if script[0] != 0 && (script[0] < op1 || script[0] > op16) {
+		return 0, nil, false
+	}
+	if int(script[1])+2 != len(script) {
+		return 0, nil, false
+	}
+	version := 0
+	if script[0] != 0 {
+		version = int(script[0]-op1) + 1
+	}
+	return version, script[2:], true
+}
+
+// witnessSigOps counts the sigops of spending a witness program with the
+// witness: one for P2WPKH and those of the witness script for P2WSH. Other
+// versions have none, their signatures being budgeted otherwise.
+func witnessSigOps(version int, program []byte, witness [][]byte) int {
+	if version != 0 {
+		return 0
+	}
+	switch {
+	case len(program) == 20:
+		return 1
+	case len(program) == 32 && len(witness) > 0:
+		return sigOpCount(witness[len(witness)-1], true)
+	}
+	return 0
+}
+
+// SigOpCost returns the sigop cost of the transaction as BIP 141 counts it,
+// given the outputs its inputs spend, in their order: the legacy sigops of
+// its scripts and of the redeem scripts of the P2SH outputs it spends, each
+// weighing WitnessScaleFactor, plus those of the witness programs it spends,
+// each weighing one. Coinbases only count their legacy sigops, and may be
+// passed no previous outputs.
+func (tx *Tx) SigOpCost(prevOuts []*TxOut) (int, error) {
+	legacy := 0
+	for _, txIn := range tx.TxIn {
+		legacy += sigOpCount(txIn.SignatureScript, false)
+	}
+	for _, txOut := range tx.TxOut {
+		legacy += sigOpCount(txOut.PkScript, false)
+	}
+	cost := legacy * WitnessScaleFactor
+	if tx.IsCoinBase() {
+		return cost, nil
+	}
+	if len(prevOuts) != len(tx.TxIn) {
+		return 0, fmt.Errorf("%w: %d outputs for %d inputs",
+			ErrPrevOutCount, len(prevOuts), len(tx.TxIn))
+	}
+
+	for i, txIn := range tx.TxIn {
+		prevScript := prevOuts[i].PkScript
+		if version, program, ok := witnessProgram(prevScript); ok {
+			cost += witnessSigOps(version, program, txIn.Witness)
+			continue
+		}
+		if !isScriptHash(prevScript) {
+			continue
+		}
+		redeemScript, ok := lastPush(txIn.SignatureScript)
+		if !ok {
+			continue
+		}
+		cost += sigOpCount(redeemScript, true) * WitnessScaleFactor
+		if version, program, ok := witnessProgram(redeemScript); ok {
+			cost += witnessSigOps(version, program, txIn.Witness)
+		}
+	}
+	return cost, nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/christsim/bips/bip-0158/vectorschema"
+)
+
+// runValidate implements the validate subcommand, which checks the structure
+// of vector files, such as a third party's regeneration, against the layouts
+// of the vectorschema package before their contents are verified. Files are
+// passed as arguments, with directories standing for every JSON file in them.
+// With -schema, the layouts are also written out as a JSON Schema.
+func runValidate(args []string) error {
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	schemaOut := fs.String("schema", "", "file to write the JSON Schema of "+
+		"the vector files to")
+	maxProblems := fs.Int("max", 10, "maximum number of problems to print "+
+		"per file")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *schemaOut != "" {
+		schema, err := vectorschema.Schema()
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(*schemaOut, schema, 0644); err != nil {
+			return err
+		}
+		fmt.Printf("Wrote schema to %v\n", *schemaOut)
+	}
+
+	var paths []string
+	for _, arg := range fs.Args() {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			paths = append(paths, arg)
+			continue
+		}
+		matches, err := filepath.Glob(filepath.Join(arg, "*.json"))
+		if err != nil {
+			return err
+		}
+		paths = append(paths, matches...)
+	}
+	if len(paths) == 0 && *schemaOut == "" {
+		return fmt.Errorf("no vector files to validate")
+	}
+
+	invalid := 0
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		layout, problems, err := vectorschema.Validate(data)
+		if err != nil {
+			fmt.Printf("%v: %v\n", path, err)
+			invalid++
+			continue
+		}
+		if len(problems) == 0 {
+			fmt.Printf("%v: valid %v file\n", path, layout.Name)
+			continue
+		}
+
+		fmt.Printf("%v: %d problems in %v file\n", path, len(problems),
+			layout.Name)
+		for i, problem := range problems {
+			if i == *maxProblems {
+				fmt.Printf("\t...\n")
+				break
+			}
+			fmt.Printf("\t%v\n", problem)
+		}
+		invalid++
+	}
+
+	if invalid != 0 {
+		return fmt.Errorf("%d of %d files are invalid", invalid,
+			len(paths))
+	}
+	return nil
+}
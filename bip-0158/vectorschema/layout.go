@@ -0,0 +1,227 @@
+// Package vectorschema describes the layout of every kind of vector file the
+// generator writes, and checks files against it. It only checks structure:
+// that each row has the columns named by the header row, that hex fields
+// decode and that hashes have the right length. It doesn't check that the
+// filters or headers are correct, which is left to the conformance package
+// and the other checkers, but running it first turns a malformed
+// regeneration into a precise error rather than a confusing mismatch.
+//
+// Every vector file is a JSON array whose first element is the header row,
+// an array holding the comma separated column names as its only string, and
+// whose remaining elements are the rows. Schema renders the same layouts as
+// a JSON Schema, for consumers in other languages.
+package vectorschema
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Kind is the type of the values in a column.
+type Kind int
+
+const (
+	// KindHeight is a block height: an integer that fits in 32 bits.
+	KindHeight Kind = iota
+
+	// KindHash is a hash in its usual byte-reversed form: 64 hex
+	// characters.
+	KindHash
+
+	// KindHex is hex encoded data, possibly empty.
+	KindHex
+
+	// KindBlock is a hex encoded serialized block, which can't be empty.
+	KindBlock
+
+	// KindText is free-form text.
+	KindText
+
+	// KindName is the name of a filter policy, such as "basic".
+	KindName
+
+	// KindErrorClass is one of the error classes of the invalid vectors.
+	KindErrorClass
+
+	// KindHexList is an array of hex encoded data.
+	KindHexList
+
+	// KindP is a Golomb-Rice parameter, from 0 to 64.
+	KindP
+
+	// KindUintList is an array of integers that fit in 64 bits.
+	KindUintList
+
+	// KindCommand is a P2P message command, of at most 12 characters.
+	KindCommand
+)
+
+// Column is a named column of a vector file.
+type Column struct {
+	Name string
+	Kind Kind
+}
+
+// Layout is the layout of a kind of vector file.
+type Layout struct {
+	// Name identifies the layout, and Description says which files have
+	// it.
+	Name        string
+	Description string
+
+	Columns []Column
+}
+
+// Header returns the header row of files with the layout.
+func (l *Layout) Header() string {
+	names := make([]string, len(l.Columns))
+	for i, column := range l.Columns {
+		names[i] = column.Name
+	}
+	return strings.Join(names, ",")
+}
+
+// ErrUnknownLayout is returned for a header row that doesn't match any known
+// layout.
+var ErrUnknownLayout = errors.New("vectorschema: unknown vector file layout")
+
+// ErrorClasses are the error classes invalid vectors are tagged with.
+var ErrorClasses = []string{
+	"truncated_filter",
+	"trailing_data",
+	"non_canonical_n",
+	"key_mismatch",
+	"header_mismatch",
+}
+
+// The layouts with a fixed set of columns. Their column names must be kept in
+// step with the header rows the generator writes.
+var (
+	// InvalidLayout is the layout of the testnet-XX-invalid.json files.
+	InvalidLayout = &Layout{
+		Name: "invalid",
+		Description: "Corrupted filters and headers, each tagged with " +
+			"the class of error it must be rejected with " +
+			"(testnet-XX-invalid.json)",
+		Columns: []Column{
+			{"Block Height", KindHeight},
+			{"Block Hash", KindHash},
+			{"Filter Type", KindName},
+			{"Previous Header", KindHash},
+			{"Filter", KindHex},
+			{"Header", KindHash},
+			{"Element", KindHex},
+			{"Expected Error", KindErrorClass},
+			{"Notes", KindText},
+		},
+	}
+
+	// MatchLayout is the layout of the testnet-XX-match.json files.
+	MatchLayout = &Layout{
+		Name: "match",
+		Description: "Elements that must and must not match each " +
+			"filter (testnet-XX-match.json)",
+		Columns: []Column{
+			{"Block Height", KindHeight},
+			{"Block Hash", KindHash},
+			{"Filter Type", KindName},
+			{"Filter", KindHex},
+			{"Matching Elements", KindHexList},
+			{"Non-Matching Elements", KindHexList},
+			{"Notes", KindText},
+		},
+	}
+
+	// GolombLayout is the layout of the Golomb-Rice coding vectors.
+	GolombLayout = &Layout{
+		Name:        "golomb",
+		Description: "Golomb-Rice coding vectors (golomb-rice.json)",
+		Columns: []Column{
+			{"P", KindP},
+			{"Values", KindUintList},
+			{"Encoded", KindHex},
+			{"Comment", KindText},
+		},
+	}
+
+	// MessagesLayout is the layout of the BIP 157 message vectors.
+	MessagesLayout = &Layout{
+		Name:        "messages",
+		Description: "BIP 157 network message vectors (messages.json)",
+		Columns: []Column{
+			{"Command", KindCommand},
+			{"Description", KindText},
+			{"Payload", KindHex},
+			{"Message", KindHex},
+		},
+	}
+
+	// fixedLayouts lists the layouts with a fixed set of columns.
+	fixedLayouts = []*Layout{
+		InvalidLayout, MatchLayout, GolombLayout, MessagesLayout,
+	}
+)
+
+// FilterLayout returns the layout of the testnet-XX.json files holding the
+// filters of the passed columns, as named in their headers: "Basic" and
+// "Ext" for the default basic and extended filters, or the policy name for
+// any other.
+func FilterLayout(filterColumns ...string) *Layout {
+	l := &Layout{
+		Name: "filters",
+		Description: "Filters and filter headers of each block " +
+			"(testnet-XX.json)",
+		Columns: []Column{
+			{"Block Height", KindHeight},
+			{"Block Hash", KindHash},
+			{"Block", KindBlock},
+		},
+	}
+	for _, name := range filterColumns {
+		l.Columns = append(l.Columns,
+			Column{"Previous " + name + " Header", KindHash})
+	}
+	for _, name := range filterColumns {
+		l.Columns = append(l.Columns, Column{name + " Filter", KindHex})
+	}
+	for _, name := range filterColumns {
+		l.Columns = append(l.Columns, Column{name + " Header", KindHash})
+	}
+	l.Columns = append(l.Columns, Column{"Notes", KindText})
+
+	return l
+}
+
+// DefaultFilterLayout is the layout of the vector files of the default basic
+// and extended filters.
+var DefaultFilterLayout = FilterLayout("Basic", "Ext")
+
+// LayoutFor returns the layout with the passed header row.
+func LayoutFor(header string) (*Layout, error) {
+	for _, l := range fixedLayouts {
+		if header == l.Header() {
+			return l, nil
+		}
+	}
+
+	// Filter files have a previous header, filter and header column for
+	// each filter type, grouped by field.
+	columns := strings.Split(header, ",")
+	n := len(columns) - 4
+	if n > 0 && n%3 == 0 && strings.HasPrefix(header, "Block Height,") {
+		var names []string
+		for _, column := range columns[3+n/3 : 3+2*n/3] {
+			name, ok := strings.CutSuffix(column, " Filter")
+			if !ok {
+				break
+			}
+			names = append(names, name)
+		}
+		if l := FilterLayout(names...); l.Header() == header {
+			return l, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: header row %q", ErrUnknownLayout, header)
+}
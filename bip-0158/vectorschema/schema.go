@@ -0,0 +1,172 @@
+package vectorschema
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+// object is a JSON Schema object.
+type object map[string]interface{}
+
+// kindDefs maps each kind to the name of its definition in the schema and the
+// definition itself.
+var kindDefs = map[Kind]struct {
+	name string
+	def  object
+}{
+	KindHeight: {"height", object{
+		"description": "Block height",
+		"type":        "integer",
+		"minimum":     0,
+		"maximum":     uint32(1<<32 - 1),
+	}},
+	KindHash: {"hash", object{
+		"description": "Hash in byte-reversed hex",
+		"type":        "string",
+		"pattern":     "^[0-9a-fA-F]{64}$",
+	}},
+	KindHex: {"hex", object{
+		"description": "Hex encoded data",
+		"type":        "string",
+		"pattern":     "^([0-9a-fA-F]{2})*$",
+	}},
+	KindBlock: {"block", object{
+		"description": "Hex encoded serialized block",
+		"type":        "string",
+		"pattern":     "^([0-9a-fA-F]{2})+$",
+	}},
+	KindText: {"text", object{
+		"type": "string",
+	}},
+	KindName: {"name", object{
+		"description": "Filter policy name",
+		"type":        "string",
+		"minLength":   1,
+	}},
+	KindErrorClass: {"errorClass", object{
+		"description": "Class of error the case must be rejected with",
+		"enum":        ErrorClasses,
+	}},
+	KindHexList: {"hexList", object{
+		"type":  "array",
+		"items": ref("hex"),
+	}},
+	KindP: {"p", object{
+		"description": "Golomb-Rice parameter",
+		"type":        "integer",
+		"minimum":     0,
+		"maximum":     64,
+	}},
+	KindUintList: {"uintList", object{
+		"type": "array",
+		"items": object{
+			"type":    "integer",
+			"minimum": 0,
+			"maximum": uint64(1<<64 - 1),
+		},
+	}},
+	KindCommand: {"command", object{
+		"description": "P2P message command",
+		"type":        "string",
+		"minLength":   1,
+		"maxLength":   maxCommandSize,
+	}},
+}
+
+// ref returns a reference to the named definition.
+func ref(name string) object {
+	return object{"$ref": "#/$defs/" + name}
+}
+
+// fileSchema returns the schema of a file whose header row matches the
+// passed schema and whose rows match rowSchema.
+func fileSchema(l *Layout, header, rowSchema object) object {
+	return object{
+		"title":       l.Name,
+		"description": l.Description,
+		"type":        "array",
+		"minItems":    1,
+		"prefixItems": []interface{}{object{
+			"type":        "array",
+			"prefixItems": []interface{}{header},
+			"minItems":    1,
+			"items":       false,
+		}},
+		"items": rowSchema,
+	}
+}
+
+// layoutSchema returns the schema of files with a fixed layout.
+func layoutSchema(l *Layout) object {
+	columns := make([]interface{}, len(l.Columns))
+	for i, column := range l.Columns {
+		columns[i] = object{
+			"title": column.Name,
+			"$ref":  "#/$defs/" + kindDefs[column.Kind].name,
+		}
+	}
+
+	return fileSchema(l, object{"const": l.Header()}, object{
+		"type":        "array",
+		"prefixItems": columns,
+		"minItems":    len(columns),
+		"items":       false,
+	})
+}
+
+// anyFilterSchema returns the schema of filter files for any set of filter
+// types. JSON Schema can't tie the number of columns to the header row, so
+// the columns after the block are only constrained to be strings.
+func anyFilterSchema() object {
+	name := `[^,]+`
+	header := "^" + regexp.QuoteMeta("Block Height,Block Hash,Block") +
+		"(,Previous " + name + " Header)+(," + name + " Filter)+(," +
+		name + " Header)+,Notes$"
+	l := FilterLayout("X")
+
+	return fileSchema(l, object{"type": "string", "pattern": header},
+		object{
+			"type": "array",
+			"prefixItems": []interface{}{
+				ref("height"), ref("hash"), ref("block"),
+			},
+			"minItems": 7,
+			"items":    ref("text"),
+		})
+}
+
+// Schema returns a JSON Schema (draft 2020-12) describing every layout of
+// vector file. Files with the default filter layout and the fixed layouts are
+// described exactly, while filter files for other policies are only described
+// loosely; Validate checks all of them exactly.
+func Schema() ([]byte, error) {
+	defs := make(object, len(kindDefs))
+	for _, d := range kindDefs {
+		defs[d.name] = d.def
+	}
+
+	layouts := []interface{}{layoutSchema(DefaultFilterLayout)}
+	for _, l := range fixedLayouts {
+		layouts = append(layouts, layoutSchema(l))
+	}
+	layouts = append(layouts, anyFilterSchema())
+
+	schema := object{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"title":   "BIP 158 test vector file",
+		"description": strings.Join([]string{
+			"A JSON array whose first element is the header row,",
+			"an array holding the comma separated column names,",
+			"followed by one array per row.",
+		}, " "),
+		"anyOf": layouts,
+		"$defs": defs,
+	}
+
+	data, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
@@ -0,0 +1,210 @@
+package vectorschema
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// maxCommandSize is the maximum length of a P2P message command.
+const maxCommandSize = 12
+
+// ErrNotVectorFile is returned for data that isn't a JSON array starting with
+// a header row.
+var ErrNotVectorFile = errors.New("vectorschema: not a vector file")
+
+// Problem is a structural error in a row of a vector file.
+type Problem struct {
+	// Row is the index of the row in the file, counting the header row
+	// as row 0.
+	Row int
+
+	// Column is the name of the column at fault, or empty for a problem
+	// with the whole row.
+	Column string
+
+	Err error
+}
+
+// Error implements the error interface.
+func (p *Problem) Error() string {
+	if p.Column == "" {
+		return fmt.Sprintf("row %d: %v", p.Row, p.Err)
+	}
+	return fmt.Sprintf("row %d, %v: %v", p.Row, p.Column, p.Err)
+}
+
+// Validate checks a vector file against the layout named by its header row,
+// returning the layout along with every problem found. An error is returned
+// if the file isn't a vector file at all or its layout is unknown.
+func Validate(data []byte) (*Layout, []*Problem, error) {
+	// Numbers are decoded as strings so that heights and values beyond
+	// the precision of a float64 are checked exactly.
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var rows [][]interface{}
+	if err := dec.Decode(&rows); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrNotVectorFile, err)
+	}
+	if dec.More() {
+		return nil, nil, fmt.Errorf("%w: data after the array",
+			ErrNotVectorFile)
+	}
+	if len(rows) == 0 || len(rows[0]) != 1 {
+		return nil, nil, fmt.Errorf("%w: no header row",
+			ErrNotVectorFile)
+	}
+	header, ok := rows[0][0].(string)
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: header row isn't a string",
+			ErrNotVectorFile)
+	}
+
+	layout, err := LayoutFor(header)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var problems []*Problem
+	for i, row := range rows[1:] {
+		if len(row) != len(layout.Columns) {
+			problems = append(problems, &Problem{
+				Row: i + 1,
+				Err: fmt.Errorf("has %d columns, expected %d",
+					len(row), len(layout.Columns)),
+			})
+			continue
+		}
+
+		for j, column := range layout.Columns {
+			if err := checkValue(column.Kind, row[j]); err != nil {
+				problems = append(problems, &Problem{
+					Row:    i + 1,
+					Column: column.Name,
+					Err:    err,
+				})
+			}
+		}
+	}
+
+	return layout, problems, nil
+}
+
+// checkValue checks a single value against the kind of its column.
+func checkValue(kind Kind, value interface{}) error {
+	switch kind {
+	case KindHeight:
+		return checkUint(value, 32)
+
+	case KindP:
+		if err := checkUint(value, 8); err != nil {
+			return err
+		}
+		if p, _ := strconv.ParseUint(value.(json.Number).String(), 10,
+			8); p > 64 {
+
+			return fmt.Errorf("P of %d is above 64", p)
+		}
+		return nil
+
+	case KindUintList:
+		values, ok := value.([]interface{})
+		if !ok {
+			return errors.New("isn't an array")
+		}
+		for i, v := range values {
+			if err := checkUint(v, 64); err != nil {
+				return fmt.Errorf("element %d %v", i, err)
+			}
+		}
+		return nil
+
+	case KindHexList:
+		values, ok := value.([]interface{})
+		if !ok {
+			return errors.New("isn't an array")
+		}
+		for i, v := range values {
+			if _, err := checkHex(v); err != nil {
+				return fmt.Errorf("element %d %v", i, err)
+			}
+		}
+		return nil
+	}
+
+	s, ok := value.(string)
+	if !ok {
+		return errors.New("isn't a string")
+	}
+
+	switch kind {
+	case KindHash:
+		if len(s) != 2*32 {
+			return fmt.Errorf("hash has %d characters, expected 64",
+				len(s))
+		}
+		_, err := checkHex(s)
+		return err
+
+	case KindHex:
+		_, err := checkHex(s)
+		return err
+
+	case KindBlock:
+		data, err := checkHex(s)
+		if err == nil && len(data) == 0 {
+			err = errors.New("is empty")
+		}
+		return err
+
+	case KindName:
+		if s == "" {
+			return errors.New("is empty")
+		}
+
+	case KindErrorClass:
+		for _, class := range ErrorClasses {
+			if s == class {
+				return nil
+			}
+		}
+		return fmt.Errorf("unknown error class %q", s)
+
+	case KindCommand:
+		if s == "" || len(s) > maxCommandSize {
+			return fmt.Errorf("command %q isn't 1 to %d characters",
+				s, maxCommandSize)
+		}
+	}
+
+	return nil
+}
+
+// checkUint checks that a value is an integer that fits in the passed number
+// of bits.
+func checkUint(value interface{}, bits int) error {
+	n, ok := value.(json.Number)
+	if !ok {
+		return errors.New("isn't a number")
+	}
+	if _, err := strconv.ParseUint(n.String(), 10, bits); err != nil {
+		return fmt.Errorf("%v isn't a %d bit unsigned integer", n, bits)
+	}
+	return nil
+}
+
+// checkHex checks that a value is a hex encoded string and returns the data.
+func checkHex(value interface{}) ([]byte, error) {
+	s, ok := value.(string)
+	if !ok {
+		return nil, errors.New("isn't a string")
+	}
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("isn't valid hex: %v", err)
+	}
+	return data, nil
+}
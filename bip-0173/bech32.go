@@ -0,0 +1,382 @@
+// Package bech32 implements the bech32 encoding of BIP 173 and the bech32m
+// variant of BIP 350, and the segwit addresses built on them:
+//
+//	addr, err := bech32.EncodeSegwit("bc", 1, outputKey)
+//	version, program, err := bech32.DecodeSegwit("bc", addr)
+//
+// A bech32 string is a human-readable part, the separator 1, and a data part
+// of 5 bit values ending in a 6 character BCH checksum. The two variants only
+// differ in the constant the checksum is built with: version 0 witness
+// programs use bech32, and later versions bech32m, which fixes the length
+// extension weakness of the original checksum.
+//
+// Decoding errors that can be pinned to a character are returned as an
+// *Error with its position, so that wallets can point users at the typo. A
+// string with a single mistyped character in its data part has it located,
+// since the checksum guarantees that no other single substitution fits.
+package bech32
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// MaxLength is the maximum length of a bech32 string. Encodings built on
+// bech32 with longer strings, such as the silent payment addresses of BIP
+// 352, pass a limit of their own to EncodeLimit and DecodeLimit.
+const MaxLength = 90
+
+// ChecksumLen is the number of characters of the checksum.
+const ChecksumLen = 6
+
+// charset is the alphabet of the data part, indexed by value.
+const charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+// charsetRev maps the characters of charset to their values, and every other
+// byte to -1.
+var charsetRev [256]int8
+
+func init() {
+	for i := range charsetRev {
+		charsetRev[i] = -1
+	}
+	for i := 0; i < len(charset); i++ {
+		charsetRev[charset[i]] = int8(i)
+	}
+}
+
+// Encoding is the checksum variant of a string.
+type Encoding int
+
+const (
+	// Bech32 is the original checksum of BIP 173.
+	Bech32 Encoding = iota + 1
+
+	// Bech32m is the checksum of BIP 350.
+	Bech32m
+)
+
+// String returns the name of the encoding.
+func (e Encoding) String() string {
+	switch e {
+	case Bech32:
+		return "bech32"
+	case Bech32m:
+		return "bech32m"
+	default:
+		return fmt.Sprintf("Encoding(%d)", int(e))
+	}
+}
+
+// constant returns the value the checksum of the encoding is XORed with.
+func (e Encoding) constant() uint32 {
+	if e == Bech32m {
+		return 0x2bc830a3
+	}
+	return 1
+}
+
+var (
+	// ErrInvalidLength is returned for a string longer than MaxLength, or
+	// than the limit passed.
+	ErrInvalidLength = errors.New("bech32: string too long")
+
+	// ErrMissingSeparator is returned for a string without a 1.
+	ErrMissingSeparator = errors.New("bech32: missing separator")
+
+	// ErrEmptyHRP is returned for a string starting with its separator.
+	ErrEmptyHRP = errors.New("bech32: empty human-readable part")
+
+	// ErrShortChecksum is returned for a data part shorter than the
+	// checksum.
+	ErrShortChecksum = errors.New("bech32: data part shorter than the " +
+		"checksum")
+
+	// ErrInvalidHRPChar is returned for a human-readable part character
+	// outside the printable US-ASCII range.
+	ErrInvalidHRPChar = errors.New("bech32: invalid human-readable part " +
+		"character")
+
+	// ErrInvalidDataChar is returned for a data part character outside the
+	// bech32 alphabet.
+	ErrInvalidDataChar = errors.New("bech32: invalid data character")
+
+	// ErrMixedCase is returned for a string with both upper and lower case
+	// letters.
+	ErrMixedCase = errors.New("bech32: mixed case")
+
+	// ErrInvalidChecksum is returned for a string whose checksum is
+	// neither a bech32 nor a bech32m one.
+	ErrInvalidChecksum = errors.New("bech32: invalid checksum")
+
+	// ErrInvalidDataValue is returned when encoding a value that doesn't
+	// fit the passed number of bits.
+	ErrInvalidDataValue = errors.New("bech32: data value out of range")
+
+	// ErrInvalidPadding is returned when regrouping bits leaves a non-zero
+	// remainder, or a remainder of a whole group.
+	ErrInvalidPadding = errors.New("bech32: invalid padding")
+
+	// ErrUnknownEncoding is returned when encoding with neither Bech32 nor
+	// Bech32m.
+	ErrUnknownEncoding = errors.New("bech32: unknown encoding")
+)
+
+// Error is a decoding error caught at a character of the string.
+type Error struct {
+	// Pos is the index of the character in the string.
+	Pos int
+
+	// Err is the error caught there.
+	Err error
+}
+
+// Error returns the message of the error, followed by its position.
+func (e *Error) Error() string {
+	return fmt.Sprintf("%v at position %d", e.Err, e.Pos)
+}
+
+// Unwrap returns the error caught at the position.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// polymod computes the BCH checksum of BIP 173 over the values.
+func polymod(values []byte) uint32 {
+	gen := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd,
+		0x2a1462b3}
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (top>>uint(i))&1 == 1 {
+				chk ^= gen[i]
+			}
+		}
+	}
+	return chk
+}
+
+// hrpExpand returns the values the human-readable part contributes to the
+// checksum: the high bits of its characters, a zero, and their low bits.
+func hrpExpand(hrp string) []byte {
+	values := make([]byte, 0, 2*len(hrp)+1)
+	for i := 0; i < len(hrp); i++ {
+		values = append(values, hrp[i]>>5)
+	}
+	values = append(values, 0)
+	for i := 0; i < len(hrp); i++ {
+		values = append(values, hrp[i]&31)
+	}
+	return values
+}
+
+// checksumOf returns the polymod of the human-readable part and the data
+// part, checksum included.
+func checksumOf(hrp string, data []byte) uint32 {
+	return polymod(append(hrpExpand(hrp), data...))
+}
+
+// Encode encodes the human-readable part and the 5 bit data values, with the
+// checksum of the encoding appended. The human-readable part is lowered, and
+// must not have mixed case.
+func Encode(hrp string, data []byte, enc Encoding) (string, error) {
+	return EncodeLimit(hrp, data, enc, MaxLength)
+}
+
+// EncodeLimit encodes as Encode does, into a string of up to limit
+// characters. The checksum only guarantees to detect up to 4 errors in
+// strings of MaxLength; past it, and up to 1023 characters, it still
+// detects any single one.
+func EncodeLimit(hrp string, data []byte, enc Encoding, limit int) (string,
+	error) {
+
+	if enc != Bech32 && enc != Bech32m {
+		return "", ErrUnknownEncoding
+	}
+	if len(hrp)+1+len(data)+ChecksumLen > limit {
+		return "", ErrInvalidLength
+	}
+	if len(hrp) == 0 {
+		return "", ErrEmptyHRP
+	}
+	if err := checkChars(hrp, len(hrp)); err != nil {
+		return "", err
+	}
+	hrp = strings.ToLower(hrp)
+	for _, v := range data {
+		if v > 31 {
+			return "", ErrInvalidDataValue
+		}
+	}
+
+	values := append(hrpExpand(hrp), data...)
+	values = append(values, make([]byte, ChecksumLen)...)
+	mod := polymod(values) ^ enc.constant()
+
+	var b strings.Builder
+	b.Grow(len(hrp) + 1 + len(data) + ChecksumLen)
+	b.WriteString(hrp)
+	b.WriteByte('1')
+	for _, v := range data {
+		b.WriteByte(charset[v])
+	}
+	for i := 0; i < ChecksumLen; i++ {
+		b.WriteByte(charset[mod>>uint(5*(5-i))&31])
+	}
+	return b.String(), nil
+}
+
+// checkChars checks that every character of s is printable US-ASCII, and
+// that its letters are all upper or all lower case. Characters from sep on
+// belong to the data part.
+func checkChars(s string, sep int) error {
+	var lower, upper bool
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 33 || c > 126 {
+			if i < sep {
+				return &Error{Pos: i, Err: ErrInvalidHRPChar}
+			}
+			return &Error{Pos: i, Err: ErrInvalidDataChar}
+		}
+		switch {
+		case c >= 'a' && c <= 'z':
+			lower = true
+		case c >= 'A' && c <= 'Z':
+			upper = true
+		default:
+			continue
+		}
+		if lower && upper {
+			return &Error{Pos: i, Err: ErrMixedCase}
+		}
+	}
+	return nil
+}
+
+// Decode decodes a bech32 or bech32m string, and returns its lowered
+// human-readable part, its data values without the checksum, and the
+// encoding of the checksum.
+func Decode(s string) (string, []byte, Encoding, error) {
+	return DecodeLimit(s, MaxLength)
+}
+
+// DecodeLimit decodes as Decode does a string of up to limit characters.
+// Checksum errors are only located in strings of up to MaxLength.
+func DecodeLimit(s string, limit int) (string, []byte, Encoding, error) {
+	if len(s) > limit {
+		return "", nil, 0, ErrInvalidLength
+	}
+	sep := strings.LastIndexByte(s, '1')
+	if err := checkChars(s, sep); err != nil {
+		return "", nil, 0, err
+	}
+	switch {
+	case sep < 0:
+		return "", nil, 0, ErrMissingSeparator
+	case sep == 0:
+		return "", nil, 0, ErrEmptyHRP
+	case len(s)-sep-1 < ChecksumLen:
+		return "", nil, 0, ErrShortChecksum
+	}
+
+	s = strings.ToLower(s)
+	hrp := s[:sep]
+	data := make([]byte, 0, len(s)-sep-1)
+	for i := sep + 1; i < len(s); i++ {
+		v := charsetRev[s[i]]
+		if v < 0 {
+			return "", nil, 0, &Error{Pos: i, Err: ErrInvalidDataChar}
+		}
+		data = append(data, byte(v))
+	}
+
+	enc, ok := encodingOf(checksumOf(hrp, data))
+	if !ok {
+		if len(s) > MaxLength {
+			return "", nil, 0, ErrInvalidChecksum
+		}
+		if pos, ok := locateError(hrp, data); ok {
+			return "", nil, 0, &Error{
+				Pos: sep + 1 + pos,
+				Err: ErrInvalidChecksum,
+			}
+		}
+		return "", nil, 0, ErrInvalidChecksum
+	}
+	return hrp, data[:len(data)-ChecksumLen], enc, nil
+}
+
+// encodingOf returns the encoding whose constant the checksum polymod equals.
+func encodingOf(mod uint32) (Encoding, bool) {
+	switch mod {
+	case Bech32.constant():
+		return Bech32, true
+	case Bech32m.constant():
+		return Bech32m, true
+	default:
+		return 0, false
+	}
+}
+
+// locateError returns the index in the data part of the only character whose
+// substitution makes the checksum valid, in either encoding. Both checksums
+// detect any 4 substitutions in strings up to MaxLength, so a single
+// mistyped character always has exactly one fix; more typos usually have
+// none, and the error isn't located.
+func locateError(hrp string, data []byte) (int, bool) {
+	pos := -1
+	fixed := append([]byte(nil), data...)
+	for i := range data {
+		for v := byte(0); v < 32; v++ {
+			if v == data[i] {
+				continue
+			}
+			fixed[i] = v
+			if _, ok := encodingOf(checksumOf(hrp, fixed)); ok {
+				if pos >= 0 && pos != i {
+					return 0, false
+				}
+				pos = i
+			}
+		}
+		fixed[i] = data[i]
+	}
+	return pos, pos >= 0
+}
+
+// ConvertBits regroups values of fromBits bits into values of toBits bits,
+// both at most 8. With pad, the last group is completed with zero bits;
+// without, the leftover bits must be fewer than fromBits and zero, as they
+// are after padding.
+func ConvertBits(data []byte, fromBits, toBits uint, pad bool) ([]byte,
+	error) {
+
+	var acc, bits uint32
+	maxv := uint32(1)<<toBits - 1
+	out := make([]byte, 0, (len(data)*int(fromBits)+int(toBits)-1)/
+		int(toBits))
+	for _, v := range data {
+		if uint32(v)>>fromBits != 0 {
+			return nil, ErrInvalidDataValue
+		}
+		acc = acc<<fromBits | uint32(v)
+		bits += uint32(fromBits)
+		for bits >= uint32(toBits) {
+			bits -= uint32(toBits)
+			out = append(out, byte(acc>>bits&maxv))
+		}
+	}
+	switch {
+	case pad:
+		if bits > 0 {
+			out = append(out, byte(acc<<(uint32(toBits)-bits)&maxv))
+		}
+	case bits >= uint32(fromBits) || acc<<(uint32(toBits)-bits)&maxv != 0:
+		return nil, ErrInvalidPadding
+	}
+	return out, nil
+}
@@ -0,0 +1,239 @@
+// This program writes test vectors for the bech32 package: the strings of
+// BIPs 173 and 350, followed by random strings and strings broken by random
+// mutations, to bech32.json, and the segwit addresses of the BIPs followed by
+// random valid and invalid addresses to segwit.json. The random vectors
+// depend only on -seed and -count, so they can be regenerated by anyone:
+//
+//	gentestvectors -count 1000 -seed 173
+//
+// Invalid vectors list the error they're rejected with, including the
+// position of the offending character where there is one. Both files use the
+// layout of the BIP 158 vectors: a JSON array whose first row names the
+// columns, followed by one row per vector. Pass -check to verify existing
+// files against the package instead:
+//
+//	gentestvectors -check bech32.json -check-segwit segwit.json
+//
+// The program lives in a directory of its own since the bech32 package sits
+// at the root of the module.
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	bech32 "github.com/christsim/bips/bip-0173"
+	"github.com/christsim/bips/internal/vectorfile"
+)
+
+const (
+	// vectorColumns and segwitColumns are the header rows of the vector
+	// files.
+	vectorColumns = "String,Encoding,Error,Comment"
+	segwitColumns = "HRP,Address,ScriptPubKey,Error,Comment"
+)
+
+type JSONTestWriter struct {
+	writer          io.Writer
+	firstRowWritten bool
+}
+
+func NewJSONTestWriter(writer io.Writer) *JSONTestWriter {
+	return &JSONTestWriter{writer: writer}
+}
+
+func (w *JSONTestWriter) WriteComment(comment string) error {
+	return w.WriteTestCase([]interface{}{comment})
+}
+
+func (w *JSONTestWriter) WriteTestCase(row []interface{}) error {
+	var err error
+	if w.firstRowWritten {
+		_, err = io.WriteString(w.writer, ",\n")
+	} else {
+		_, err = io.WriteString(w.writer, "[\n")
+		w.firstRowWritten = true
+	}
+	if err != nil {
+		return err
+	}
+
+	rowBytes, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.writer.Write(rowBytes)
+	return err
+}
+
+func (w *JSONTestWriter) Close() error {
+	if !w.firstRowWritten {
+		return nil
+	}
+
+	_, err := io.WriteString(w.writer, "\n]\n")
+	return err
+}
+
+func main() {
+	out := flag.String("out", "bech32.json", "file to write the vectors to")
+	segwitOut := flag.String("segwit-out", "segwit.json", "file to write "+
+		"the addresses to")
+	count := flag.Int("count", 200, "number of random vectors to write "+
+		"after those of the BIPs, in each file")
+	seed := flag.Int64("seed", 173, "seed of the random vectors")
+	check := flag.String("check", "", "vector file to check instead of "+
+		"writing one")
+	checkSegwit := flag.String("check-segwit", "", "address file to check "+
+		"instead of writing one")
+	flag.Parse()
+
+	var err error
+	if *check != "" || *checkSegwit != "" {
+		err = checkFiles(*check, *checkSegwit)
+	} else {
+		err = writeFiles(*out, *segwitOut, *seed, *count)
+	}
+	if err != nil {
+		fmt.Println("Error: ", err.Error())
+		os.Exit(1)
+	}
+}
+
+// encodingName returns the name of a valid vector's encoding, or an empty
+// string for an invalid one.
+func encodingName(enc bech32.Encoding) string {
+	if enc == 0 {
+		return ""
+	}
+	return enc.String()
+}
+
+// writeFiles writes the vectors of the BIPs and count random vectors to out,
+// and the addresses of the BIPs and count random addresses to segwitOut.
+func writeFiles(out, segwitOut string, seed int64, count int) error {
+	vectors := append(bech32.SpecVectors(),
+		bech32.RandomVectors(seed, count)...)
+
+	file, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := NewJSONTestWriter(file)
+	if err := writer.WriteComment(vectorColumns); err != nil {
+		return err
+	}
+	for _, v := range vectors {
+		err := writer.WriteTestCase([]interface{}{
+			v.String,
+			encodingName(v.Encoding),
+			vectorfile.ErrorString(v.Err),
+			v.Comment,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	addrs := append(bech32.SpecAddressVectors(),
+		bech32.RandomAddressVectors(seed, count)...)
+
+	segwitFile, err := os.Create(segwitOut)
+	if err != nil {
+		return err
+	}
+	defer segwitFile.Close()
+
+	writer = NewJSONTestWriter(segwitFile)
+	if err := writer.WriteComment(segwitColumns); err != nil {
+		return err
+	}
+	for _, v := range addrs {
+		err := writer.WriteTestCase([]interface{}{
+			v.HRP,
+			v.Address,
+			hex.EncodeToString(v.ScriptPubKey),
+			vectorfile.ErrorString(v.Err),
+			v.Comment,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote %d vectors and %d addresses\n", len(vectors),
+		len(addrs))
+	return nil
+}
+
+// encodings maps the names of the encodings to them.
+var encodings = map[string]bech32.Encoding{
+	"":                      0,
+	bech32.Bech32.String():  bech32.Bech32,
+	bech32.Bech32m.String(): bech32.Bech32m,
+}
+
+// checkFiles checks each vector of the vector file with bech32.CheckVector,
+// and each address of the address file with bech32.CheckAddressVector.
+// Either path may be empty to skip that file.
+func checkFiles(path, segwitPath string) error {
+	if path != "" {
+		rows, err := vectorfile.ReadStringRows(path, 4)
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			enc, ok := encodings[row[1]]
+			if !ok {
+				return fmt.Errorf("%v: unknown encoding %v", row[3],
+					row[1])
+			}
+			err := bech32.CheckVector(bech32.Vector{
+				String:   row[0],
+				Encoding: enc,
+				Err:      vectorfile.ParseError(row[2]),
+			})
+			if err != nil {
+				return fmt.Errorf("%v: %v", row[3], err)
+			}
+		}
+		fmt.Printf("%d vectors OK\n", len(rows))
+	}
+
+	if segwitPath != "" {
+		rows, err := vectorfile.ReadStringRows(segwitPath, 5)
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			script, err := hex.DecodeString(row[2])
+			if err != nil {
+				return fmt.Errorf("%v: %v", row[4], err)
+			}
+			err = bech32.CheckAddressVector(bech32.AddressVector{
+				HRP:          row[0],
+				Address:      row[1],
+				ScriptPubKey: script,
+				Err:          vectorfile.ParseError(row[3]),
+			})
+			if err != nil {
+				return fmt.Errorf("%v: %v", row[4], err)
+			}
+		}
+		fmt.Printf("%d addresses OK\n", len(rows))
+	}
+	return nil
+}
@@ -0,0 +1,7 @@
+module github.com/christsim/bips/bip-0173
+
+go 1.21
+
+require github.com/christsim/bips/internal v0.0.0
+
+replace github.com/christsim/bips/internal => ../internal
@@ -0,0 +1,140 @@
+package bech32
+
+import (
+	"errors"
+	"strings"
+)
+
+// MaxWitnessVersion is the highest witness version an address can have.
+const MaxWitnessVersion = 16
+
+// Witness program lengths allowed by BIP 141.
+const (
+	MinProgramLen = 2
+	MaxProgramLen = 40
+)
+
+var (
+	// ErrWrongHRP is returned when decoding an address of another network
+	// than the one expected.
+	ErrWrongHRP = errors.New("bech32: wrong human-readable part")
+
+	// ErrEmptyData is returned for an address without a witness version.
+	ErrEmptyData = errors.New("bech32: empty data part")
+
+	// ErrInvalidWitnessVersion is returned for a witness version above
+	// MaxWitnessVersion.
+	ErrInvalidWitnessVersion = errors.New("bech32: invalid witness version")
+
+	// ErrInvalidProgramLength is returned for a witness program shorter
+	// than 2 or longer than 40 bytes, or of other than 20 or 32 bytes for
+	// witness version 0.
+	ErrInvalidProgramLength = errors.New("bech32: invalid witness program " +
+		"length")
+
+	// ErrWrongEncoding is returned for a version 0 address with a bech32m
+	// checksum, or a later version address with a bech32 one.
+	ErrWrongEncoding = errors.New("bech32: wrong checksum encoding for the " +
+		"witness version")
+)
+
+// encodingFor returns the encoding addresses of the witness version use.
+func encodingFor(version byte) Encoding {
+	if version == 0 {
+		return Bech32
+	}
+	return Bech32m
+}
+
+// checkProgram checks the length of a witness program of the version.
+func checkProgram(version byte, program []byte) error {
+	if len(program) < MinProgramLen || len(program) > MaxProgramLen {
+		return ErrInvalidProgramLength
+	}
+	if version == 0 && len(program) != 20 && len(program) != 32 {
+		return ErrInvalidProgramLength
+	}
+	return nil
+}
+
+// EncodeSegwit encodes the address of a witness program, with the bech32
+// checksum for version 0 and bech32m for later versions.
+func EncodeSegwit(hrp string, version byte, program []byte) (string, error) {
+	if version > MaxWitnessVersion {
+		return "", ErrInvalidWitnessVersion
+	}
+	if err := checkProgram(version, program); err != nil {
+		return "", err
+	}
+	data, err := ConvertBits(program, 8, 5, true)
+	if err != nil {
+		return "", err
+	}
+	return Encode(hrp, append([]byte{version}, data...),
+		encodingFor(version))
+}
+
+// DecodeSegwit decodes an address of the network with the human-readable
+// part, and returns its witness version and program.
+func DecodeSegwit(hrp, addr string) (byte, []byte, error) {
+	got, data, enc, err := Decode(addr)
+	if err != nil {
+		return 0, nil, err
+	}
+	if got != strings.ToLower(hrp) {
+		return 0, nil, ErrWrongHRP
+	}
+	if len(data) == 0 {
+		return 0, nil, ErrEmptyData
+	}
+	version := data[0]
+	if version > MaxWitnessVersion {
+		return 0, nil, &Error{
+			Pos: len(got) + 1,
+			Err: ErrInvalidWitnessVersion,
+		}
+	}
+	if enc != encodingFor(version) {
+		return 0, nil, ErrWrongEncoding
+	}
+	program, err := ConvertBits(data[1:], 5, 8, false)
+	if err != nil {
+		return 0, nil, err
+	}
+	if err := checkProgram(version, program); err != nil {
+		return 0, nil, err
+	}
+	return version, program, nil
+}
+
+// WitnessScript returns the output script paying to a witness program: the
+// push of the witness version, OP_0 or OP_1 to OP_16, followed by the push of
+// the program.
+func WitnessScript(version byte, program []byte) []byte {
+	op := version
+	if version > 0 {
+		op += 0x50
+	}
+	return append([]byte{op, byte(len(program))}, program...)
+}
+
+// ParseWitnessScript returns the witness version and program of an output
+// script paying to one, and false for any other script.
+func ParseWitnessScript(script []byte) (byte, []byte, bool) {
+	if len(script) < 4 || int(script[1]) != len(script)-2 {
+		return 0, nil, false
+	}
+	var version byte
+	switch op := script[0]; {
+	case op == 0:
+	case op >= 0x51 && op <= 0x60:
+		version = op - 0x50
+	default:
+		return 0, nil, false
+	}
+	program := script[2:]
+	if checkProgram(version, program) != nil {
+		return 0, nil, false
+	}
+	return version, program, true
+}
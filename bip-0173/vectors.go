@@ -0,0 +1,752 @@
+package bech32
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+)
+
+// ErrVectorMismatch is returned by CheckVector and CheckAddressVector when
+// decoding a vector doesn't give the expected result.
+var ErrVectorMismatch = errors.New("bech32: vector mismatch")
+
+// Vector is a string and the outcome of decoding it: the encoding of its
+// checksum, or the error it's rejected with.
+type Vector struct {
+	String string
+
+	// Encoding is the encoding of a valid string, or zero.
+	Encoding Encoding
+
+	// Err is the error an invalid string is rejected with, or nil.
+	Err error
+
+	// Comment describes where the vector comes from.
+	Comment string
+}
+
+// AddressVector is a segwit address and the outcome of decoding it for the
+// network with the human-readable part: its output script, or the error
+// it's rejected with.
+type AddressVector struct {
+	HRP     string
+	Address string
+
+	// ScriptPubKey is the output script of a valid address, or nil.
+	ScriptPubKey []byte
+
+	// Err is the error an invalid address is rejected with, or nil.
+	Err error
+
+	// Comment describes where the vector comes from.
+	Comment string
+}
+
+// specVector is a string from the test vectors of BIP 173 or 350, with its
+// encoding if valid, or the error of the reason the BIP gives for it being
+// invalid.
+type specVector struct {
+	s       string
+	enc     Encoding
+	err     error
+	comment string
+}
+
+// bip173Vectors are the bech32 strings of BIP 173. Those with bytes outside
+// US-ASCII hold the Unicode code points of the reference implementation
+// instead, which are valid UTF-8 and so survive JSON.
+var bip173Vectors = []specVector{
+	{s: "A12UEL5L", enc: Bech32},
+	{s: "a12uel5l", enc: Bech32},
+	{
+		s: "an83characterlonghumanreadablepartthatcontainsthenumber1" +
+			"andtheexcludedcharactersbio1tt5tgs",
+		enc: Bech32,
+	},
+	{s: "abcdef1qpzry9x8gf2tvdw0s3jn54khce6mua7lmqqqxw", enc: Bech32},
+	{
+		s: "11qqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqq" +
+			"qqqqqqqqqqqqqqqqqqqqqqqqqqc8247j",
+		enc: Bech32,
+	},
+	{
+		s:   "split1checkupstagehandshakeupstreamerranterredcaperred2y9e3w",
+		enc: Bech32,
+	},
+	{s: "?1ezyfcl", enc: Bech32},
+	{
+		s:       "\x201nwldj5",
+		err:     ErrInvalidHRPChar,
+		comment: "HRP character out of range",
+	},
+	{
+		s:       "\x7f1axkwrx",
+		err:     ErrInvalidHRPChar,
+		comment: "HRP character out of range",
+	},
+	{
+		s:       "\u00801eym55h",
+		err:     ErrInvalidHRPChar,
+		comment: "HRP character out of range",
+	},
+	{
+		s: "an84characterslonghumanreadablepartthatcontainsthenumber1" +
+			"andtheexcludedcharactersbio1569pvx",
+		err:     ErrInvalidLength,
+		comment: "overall max length exceeded",
+	},
+	{
+		s:       "pzry9x0s0muk",
+		err:     ErrMissingSeparator,
+		comment: "No separator character",
+	},
+	{s: "1pzry9x0s0muk", err: ErrEmptyHRP, comment: "Empty HRP"},
+	{
+		s:       "x1b4n0q5v",
+		err:     ErrInvalidDataChar,
+		comment: "Invalid data character",
+	},
+	{s: "li1dgmt3", err: ErrShortChecksum, comment: "Too short checksum"},
+	{
+		s:       "de1lg7wt\u00ff",
+		err:     ErrInvalidDataChar,
+		comment: "Invalid character in checksum",
+	},
+	{
+		s:       "A1G7SGD8",
+		err:     ErrInvalidChecksum,
+		comment: "checksum calculated with uppercase form of HRP",
+	},
+	{s: "10a06t8", err: ErrEmptyHRP, comment: "empty HRP"},
+	{s: "1qzzfhee", err: ErrEmptyHRP, comment: "empty HRP"},
+}
+
+// bip350Vectors are the bech32m strings of BIP 350.
+var bip350Vectors = []specVector{
+	{s: "A1LQFN3A", enc: Bech32m},
+	{s: "a1lqfn3a", enc: Bech32m},
+	{
+		s: "an83characterlonghumanreadablepartthatcontainsthetheexcluded" +
+			"charactersbioandnumber11sg7hg6",
+		enc: Bech32m,
+	},
+	{s: "abcdef1l7aum6echk45nj3s0wdvt2fg8x9yrzpqzd3ryx", enc: Bech32m},
+	{
+		s: "11llllllllllllllllllllllllllllllllllllllllllllllllllllllll" +
+			"llllllllllllllllllllllllllludsr8",
+		enc: Bech32m,
+	},
+	{
+		s:   "split1checkupstagehandshakeupstreamerranterredcaperredlc445v",
+		enc: Bech32m,
+	},
+	{s: "?1v759aa", enc: Bech32m},
+	{
+		s:       "\x201xj0phk",
+		err:     ErrInvalidHRPChar,
+		comment: "HRP character out of range",
+	},
+	{
+		s:       "\x7f1g6xzxy",
+		err:     ErrInvalidHRPChar,
+		comment: "HRP character out of range",
+	},
+	{
+		s:       "\u00801vctc34",
+		err:     ErrInvalidHRPChar,
+		comment: "HRP character out of range",
+	},
+	{
+		s: "an84characterslonghumanreadablepartthatcontainsthetheexcluded" +
+			"charactersbioandnumber11d6pts4",
+		err:     ErrInvalidLength,
+		comment: "overall max length exceeded",
+	},
+	{
+		s:       "qyrz8wqd2c9m",
+		err:     ErrMissingSeparator,
+		comment: "No separator character",
+	},
+	{s: "1qyrz8wqd2c9m", err: ErrEmptyHRP, comment: "Empty HRP"},
+	{
+		s:       "y1b0jsk6g",
+		err:     ErrInvalidDataChar,
+		comment: "Invalid data character",
+	},
+	{
+		s:       "lt1igcx5c0",
+		err:     ErrInvalidDataChar,
+		comment: "Invalid data character",
+	},
+	{s: "in1muywd", err: ErrShortChecksum, comment: "Too short checksum"},
+	{
+		s:       "mm1crxm3i",
+		err:     ErrInvalidDataChar,
+		comment: "Invalid character in checksum",
+	},
+	{
+		s:       "au1s5cgom",
+		err:     ErrInvalidDataChar,
+		comment: "Invalid character in checksum",
+	},
+	{
+		s:       "M1VUXWEZ",
+		err:     ErrInvalidChecksum,
+		comment: "checksum calculated with uppercase form of HRP",
+	},
+	{s: "16plkw9", err: ErrEmptyHRP, comment: "empty HRP"},
+	{s: "1p2gdwpf", err: ErrEmptyHRP, comment: "empty HRP"},
+}
+
+// specAddressVector is an address from the test vectors of BIP 173 or 350,
+// with its output script if valid, or the error of the reason the BIP gives
+// for it being invalid.
+type specAddressVector struct {
+	hrp     string
+	addr    string
+	script  string
+	err     error
+	comment string
+}
+
+// specAddressVectors are the addresses of BIP 350, which replaced those of BIP
+// 173 with witness versions above 0 since they had bech32 checksums, along
+// with the invalid version 0 addresses of BIP 173.
+var specAddressVectors = []specAddressVector{
+	{
+		hrp:    "bc",
+		addr:   "BC1QW508D6QEJXTDG4Y5R3ZARVARY0C5XW7KV8F3T4",
+		script: "0014751e76e8199196d454941c45d1b3a323f1433bd6",
+	},
+	{
+		hrp: "tb",
+		addr: "tb1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3q0" +
+			"sl5k7",
+		script: "00201863143c14c5166804bd19203356da136c985678cd4d27a1b8c6" +
+			"329604903262",
+	},
+	{
+		hrp: "bc",
+		addr: "bc1pw508d6qejxtdg4y5r3zarvary0c5xw7kw508d6qejxtdg4y5r3zarv" +
+			"ary0c5xw7kt5nd6y",
+		script: "5128751e76e8199196d454941c45d1b3a323f1433bd6751e76e81991" +
+			"96d454941c45d1b3a323f1433bd6",
+	},
+	{hrp: "bc", addr: "BC1SW50QGDZ25J", script: "6002751e"},
+	{
+		hrp:    "bc",
+		addr:   "bc1zw508d6qejxtdg4y5r3zarvaryvaxxpcs",
+		script: "5210751e76e8199196d454941c45d1b3a323",
+	},
+	{
+		hrp: "tb",
+		addr: "tb1qqqqqp399et2xygdj5xreqhjjvcmzhxw4aywxecjdzew6hylgvsesr" +
+			"xh6hy",
+		script: "0020000000c4a5cad46221b2a187905e5266362b99d5e91c6ce24d16" +
+			"5dab93e86433",
+	},
+	{
+		hrp: "tb",
+		addr: "tb1pqqqqp399et2xygdj5xreqhjjvcmzhxw4aywxecjdzew6hylgvsesf" +
+			"3hn0c",
+		script: "5120000000c4a5cad46221b2a187905e5266362b99d5e91c6ce24d16" +
+			"5dab93e86433",
+	},
+	{
+		hrp: "bc",
+		addr: "bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqz" +
+			"k5jj0",
+		script: "512079be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2" +
+			"815b16f81798",
+	},
+	{
+		hrp:     "bc",
+		addr:    "tc1qw508d6qejxtdg4y5r3zarvary0c5xw7kg3g4ty",
+		err:     ErrWrongHRP,
+		comment: "Invalid human-readable part",
+	},
+	{
+		hrp:     "bc",
+		addr:    "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t5",
+		err:     ErrInvalidChecksum,
+		comment: "Invalid checksum",
+	},
+	{
+		hrp:     "bc",
+		addr:    "BC1QR508D6QEJXTDG4Y5R3ZARVARYV98GJ9P",
+		err:     ErrInvalidProgramLength,
+		comment: "Invalid program length for witness version 0 (per BIP141)",
+	},
+	{
+		hrp: "tb",
+		addr: "tb1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3q0" +
+			"sL5k7",
+		err:     ErrMixedCase,
+		comment: "Mixed case",
+	},
+	{
+		hrp: "tb",
+		addr: "tb1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3pj" +
+			"xtptv",
+		err:     ErrInvalidPadding,
+		comment: "Non-zero padding in 8-to-5 conversion",
+	},
+	{
+		hrp:     "bc",
+		addr:    "bc1gmk9yu",
+		err:     ErrEmptyData,
+		comment: "Empty data section",
+	},
+	{
+		hrp: "bc",
+		addr: "tc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vq5" +
+			"zuyut",
+		err:     ErrWrongHRP,
+		comment: "Invalid human-readable part",
+	},
+	{
+		hrp: "bc",
+		addr: "bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqh" +
+			"2y7hd",
+		err:     ErrWrongEncoding,
+		comment: "Invalid checksum (Bech32 instead of Bech32m)",
+	},
+	{
+		hrp: "tb",
+		addr: "tb1z0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqg" +
+			"lt7rf",
+		err:     ErrWrongEncoding,
+		comment: "Invalid checksum (Bech32 instead of Bech32m)",
+	},
+	{
+		hrp: "bc",
+		addr: "BC1S0XLXVLHEMJA6C4DQV22UAPCTQUPFHLXM9H8Z3K2E72Q4K9HCZ7VQ5" +
+			"4WELL",
+		err:     ErrWrongEncoding,
+		comment: "Invalid checksum (Bech32 instead of Bech32m)",
+	},
+	{
+		hrp:     "bc",
+		addr:    "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kemeawh",
+		err:     ErrWrongEncoding,
+		comment: "Invalid checksum (Bech32m instead of Bech32)",
+	},
+	{
+		hrp: "tb",
+		addr: "tb1q0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vq2" +
+			"4jc47",
+		err:     ErrWrongEncoding,
+		comment: "Invalid checksum (Bech32m instead of Bech32)",
+	},
+	{
+		hrp: "bc",
+		addr: "bc1p38j9r5y49hruaue7wxjce0updqjuyyx0kh56v8s25huc6995vvpql" +
+			"3jow4",
+		err:     ErrInvalidDataChar,
+		comment: "Invalid character in checksum",
+	},
+	{
+		hrp: "bc",
+		addr: "BC130XLXVLHEMJA6C4DQV22UAPCTQUPFHLXM9H8Z3K2E72Q4K9HCZ7VQ7" +
+			"ZWS8R",
+		err:     ErrInvalidWitnessVersion,
+		comment: "Invalid witness version",
+	},
+	{
+		hrp:     "bc",
+		addr:    "bc1pw5dgrnzv",
+		err:     ErrInvalidProgramLength,
+		comment: "Invalid program length (1 byte)",
+	},
+	{
+		hrp: "bc",
+		addr: "bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7v8n" +
+			"0nx0muaewav253zgeav",
+		err:     ErrInvalidProgramLength,
+		comment: "Invalid program length (41 bytes)",
+	},
+	{
+		hrp: "tb",
+		addr: "tb1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vq4" +
+			"7Zagq",
+		err:     ErrMixedCase,
+		comment: "Mixed case",
+	},
+	{
+		hrp: "bc",
+		addr: "bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7v07" +
+			"qwwzcrf",
+		err:     ErrInvalidPadding,
+		comment: "zero padding of more than 4 bits",
+	},
+	{
+		hrp: "tb",
+		addr: "tb1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vpg" +
+			"gkg4j",
+		err:     ErrInvalidPadding,
+		comment: "Non-zero padding in 8-to-5 conversion",
+	},
+}
+
+// SpecVectors returns the strings of BIPs 173 and 350, with the errors the
+// invalid ones are rejected with, positions included.
+func SpecVectors() []Vector {
+	var vectors []Vector
+	for _, spec := range []struct {
+		bip     int
+		vectors []specVector
+	}{
+		{173, bip173Vectors},
+		{350, bip350Vectors},
+	} {
+		for _, sv := range spec.vectors {
+			comment := sv.comment
+			if comment == "" {
+				comment = "valid " + sv.enc.String()
+			}
+			vectors = append(vectors, Vector{
+				String:   sv.s,
+				Encoding: sv.enc,
+				Err:      decodeError(sv.s, sv.err),
+				Comment:  fmt.Sprintf("BIP %d: %v", spec.bip, comment),
+			})
+		}
+	}
+	return vectors
+}
+
+// decodeError returns the error decoding s fails with, which must be the
+// expected one, possibly with a position. It panics on any other outcome.
+func decodeError(s string, expected error) error {
+	_, _, _, err := Decode(s)
+	if !errors.Is(err, expected) || (err == nil) != (expected == nil) {
+		panic(fmt.Sprintf("bech32: decoding %q gives %v, expected %v", s,
+			err, expected))
+	}
+	return err
+}
+
+// SpecAddressVectors returns the addresses of BIPs 173 and 350, with the
+// errors the invalid ones are rejected with.
+func SpecAddressVectors() []AddressVector {
+	vectors := make([]AddressVector, 0, len(specAddressVectors))
+	for _, sv := range specAddressVectors {
+		script, err := hex.DecodeString(sv.script)
+		if err != nil {
+			panic(err)
+		}
+		if sv.script == "" {
+			script = nil
+		}
+		_, _, err = DecodeSegwit(sv.hrp, sv.addr)
+		if !errors.Is(err, sv.err) || (err == nil) != (sv.err == nil) {
+			panic(fmt.Sprintf("bech32: decoding %q gives %v, expected %v",
+				sv.addr, err, sv.err))
+		}
+		comment := sv.comment
+		if comment == "" {
+			comment = "valid address"
+		}
+		vectors = append(vectors, AddressVector{
+			HRP:          sv.hrp,
+			Address:      sv.addr,
+			ScriptPubKey: script,
+			Err:          err,
+			Comment:      comment,
+		})
+	}
+	return vectors
+}
+
+// randomHRPs are the human-readable parts random vectors are built with.
+var randomHRPs = []string{"bc", "tb", "bcrt", "lnbc", "a", "x1y"}
+
+// randomString returns a valid string of a random human-readable part and
+// length, with a random encoding, upper case one time in four.
+func randomString(rng *rand.Rand) (string, Encoding) {
+	hrp := randomHRPs[rng.Intn(len(randomHRPs))]
+	data := make([]byte, rng.Intn(MaxLength-len(hrp)-ChecksumLen))
+	for i := range data {
+		data[i] = byte(rng.Intn(32))
+	}
+	enc := Encoding(1 + rng.Intn(2))
+	s, err := Encode(hrp, data, enc)
+	if err != nil {
+		panic(err)
+	}
+	if rng.Intn(4) == 0 {
+		s = strings.ToUpper(s)
+	}
+	return s, enc
+}
+
+// mutation breaks a valid string in a way decoding must catch with the
+// error.
+type mutation struct {
+	name   string
+	err    error
+	mutate func(rng *rand.Rand, s string, sep int) string
+}
+
+// mutations are the ways random invalid vectors are derived from valid ones.
+var mutations = []mutation{
+	{
+		name: "substituted character",
+		err:  ErrInvalidChecksum,
+		mutate: func(rng *rand.Rand, s string, sep int) string {
+			i := sep + 1 + rng.Intn(len(s)-sep-1)
+			v := (charsetRev[lower(s[i])] + 1 +
+				int8(rng.Intn(31))) % 32
+			return s[:i] + sameCase(s, charset[v]) + s[i+1:]
+		},
+	},
+	{
+		name: "swapped case",
+		err:  ErrMixedCase,
+		mutate: func(rng *rand.Rand, s string, sep int) string {
+			for {
+				i := rng.Intn(len(s))
+				if c := s[i]; c >= 'a' && c <= 'z' {
+					return s[:i] + string(c-'a'+'A') + s[i+1:]
+				} else if c >= 'A' && c <= 'Z' {
+					return s[:i] + string(c-'A'+'a') + s[i+1:]
+				}
+			}
+		},
+	},
+	{
+		name: "excluded data character",
+		err:  ErrInvalidDataChar,
+		mutate: func(rng *rand.Rand, s string, sep int) string {
+			i := sep + 1 + rng.Intn(len(s)-sep-1)
+			return s[:i] + sameCase(s, "bio"[rng.Intn(3)]) + s[i+1:]
+		},
+	},
+	{
+		name: "HRP character out of range",
+		err:  ErrInvalidHRPChar,
+		mutate: func(rng *rand.Rand, s string, sep int) string {
+			i := rng.Intn(sep)
+			return s[:i] + string(" \x7f"[rng.Intn(2)]) + s[i+1:]
+		},
+	},
+	{
+		name: "truncated checksum",
+		err:  ErrShortChecksum,
+		mutate: func(rng *rand.Rand, s string, sep int) string {
+			return s[:sep+1+rng.Intn(ChecksumLen)]
+		},
+	},
+	{
+		name: "overlong",
+		err:  ErrInvalidLength,
+		mutate: func(rng *rand.Rand, s string, sep int) string {
+			pad := strings.Repeat(sameCase(s, 'q'), MaxLength+1-len(s))
+			return s[:sep+1] + pad + s[sep+1:]
+		},
+	},
+}
+
+// lower returns the lower case of an ASCII letter, and other bytes as is.
+func lower(c byte) byte {
+	if c >= 'A' && c <= 'Z' {
+		return c - 'A' + 'a'
+	}
+	return c
+}
+
+// sameCase returns the lower case letter c in the case of s.
+func sameCase(s string, c byte) string {
+	if strings.ToLower(s) != s {
+		return strings.ToUpper(string(c))
+	}
+	return string(c)
+}
+
+// RandomVectors returns count vectors derived from a math/rand source with
+// the seed, alternating valid strings and strings broken by a random
+// mutation: a substituted character, which is located, a swapped case, an
+// excluded character, an out of range HRP character, a truncated checksum
+// or too many characters. The vectors depend only on the seed and count.
+func RandomVectors(rngSeed int64, count int) []Vector {
+	rng := rand.New(rand.NewSource(rngSeed))
+	vectors := make([]Vector, 0, count)
+	for i := 0; i < count; i++ {
+		s, enc := randomString(rng)
+		if i%2 == 0 {
+			vectors = append(vectors, Vector{
+				String:   s,
+				Encoding: enc,
+				Comment:  "random valid " + enc.String(),
+			})
+			continue
+		}
+
+		m := mutations[i/2%len(mutations)]
+		sep := strings.LastIndexByte(s, '1')
+		mutated := m.mutate(rng, s, sep)
+		err := decodeError(mutated, m.err)
+
+		// A single substitution must be located where it was made.
+		var posErr *Error
+		if m.err == ErrInvalidChecksum && (!errors.As(err, &posErr) ||
+			mutated[posErr.Pos] == s[posErr.Pos]) {
+
+			panic(fmt.Sprintf("bech32: substitution in %q not located: "+
+				"%v", mutated, err))
+		}
+		vectors = append(vectors, Vector{
+			String:  mutated,
+			Err:     err,
+			Comment: fmt.Sprintf("random %v, %v", enc, m.name),
+		})
+	}
+	return vectors
+}
+
+// RandomAddressVectors returns count address vectors derived from a math/rand
+// source with the seed: valid addresses of every witness version, and
+// addresses with the checksum of the wrong encoding, a witness version above
+// 16, a program of the wrong length, or the human-readable part of another
+// network. The vectors depend only on the seed and count.
+func RandomAddressVectors(rngSeed int64, count int) []AddressVector {
+	rng := rand.New(rand.NewSource(rngSeed))
+	vectors := make([]AddressVector, 0, count)
+	for i := 0; i < count; i++ {
+		hrp := randomHRPs[rng.Intn(3)]
+		version := byte(rng.Intn(MaxWitnessVersion + 1))
+		length := MinProgramLen + rng.Intn(MaxProgramLen-MinProgramLen+1)
+		if version == 0 {
+			length = []int{20, 32}[rng.Intn(2)]
+		}
+		enc := encodingFor(version)
+
+		v := AddressVector{HRP: hrp}
+		switch i % 5 {
+		case 0:
+			v.Comment = fmt.Sprintf("random valid version %d address",
+				version)
+		case 1:
+			enc = Bech32 + Bech32m - enc
+			v.Err = ErrWrongEncoding
+			v.Comment = fmt.Sprintf("random version %d address with a "+
+				"%v checksum", version, enc)
+		case 2:
+			version = byte(MaxWitnessVersion + 1 + rng.Intn(15))
+			v.Err = ErrInvalidWitnessVersion
+			v.Comment = fmt.Sprintf("random version %d address", version)
+		case 3:
+			length = []int{0, 1, MaxProgramLen + 1}[rng.Intn(3)]
+			if version == 0 {
+				length = 20 + 1 + rng.Intn(11)
+			}
+			v.Err = ErrInvalidProgramLength
+			v.Comment = fmt.Sprintf("random version %d address with a "+
+				"%d byte program", version, length)
+		case 4:
+			v.HRP = randomHRPs[(rng.Intn(2)+1+indexOf(hrp))%3]
+			v.Err = ErrWrongHRP
+			v.Comment = fmt.Sprintf("random %v address decoded as %v",
+				hrp, v.HRP)
+		}
+
+		program := make([]byte, length)
+		rng.Read(program)
+		data, err := ConvertBits(program, 8, 5, true)
+		if err != nil {
+			panic(err)
+		}
+		v.Address, err = Encode(hrp, append([]byte{version}, data...), enc)
+		if err != nil {
+			panic(err)
+		}
+		_, _, err = DecodeSegwit(v.HRP, v.Address)
+		if !errors.Is(err, v.Err) || (err == nil) != (v.Err == nil) {
+			panic(fmt.Sprintf("bech32: decoding %q gives %v, expected %v",
+				v.Address, err, v.Err))
+		}
+		v.Err = err
+		if err == nil {
+			v.ScriptPubKey = WitnessScript(version, program)
+		}
+		vectors = append(vectors, v)
+	}
+	return vectors
+}
+
+// indexOf returns the index of the human-readable part in randomHRPs.
+func indexOf(hrp string) int {
+	for i, h := range randomHRPs {
+		if h == hrp {
+			return i
+		}
+	}
+	return -1
+}
+
+// CheckVector decodes the vector's string and checks the outcome, and that
+// encoding a valid string's data again gives it back.
+func CheckVector(v Vector) error {
+	hrp, data, enc, err := Decode(v.String)
+	if v.Err != nil {
+		if err == nil || err.Error() != v.Err.Error() {
+			return fmt.Errorf("%w: got error %v, expected %v",
+				ErrVectorMismatch, err, v.Err)
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if enc != v.Encoding {
+		return fmt.Errorf("%w: encoding %v, expected %v",
+			ErrVectorMismatch, enc, v.Encoding)
+	}
+	s, err := Encode(hrp, data, enc)
+	if err != nil {
+		return err
+	}
+	if s != strings.ToLower(v.String) {
+		return fmt.Errorf("%w: encoded again as %v", ErrVectorMismatch, s)
+	}
+	return nil
+}
+
+// CheckAddressVector decodes the vector's address and checks the outcome,
+// and that a valid address's output script gives it back.
+func CheckAddressVector(v AddressVector) error {
+	version, program, err := DecodeSegwit(v.HRP, v.Address)
+	if v.Err != nil {
+		if err == nil || err.Error() != v.Err.Error() {
+			return fmt.Errorf("%w: got error %v, expected %v",
+				ErrVectorMismatch, err, v.Err)
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	script := WitnessScript(version, program)
+	if !bytes.Equal(script, v.ScriptPubKey) {
+		return fmt.Errorf("%w: script %x, expected %x", ErrVectorMismatch,
+			script, v.ScriptPubKey)
+	}
+
+	version, program, ok := ParseWitnessScript(script)
+	if !ok {
+		return fmt.Errorf("%w: script %x not parsed", ErrVectorMismatch,
+			script)
+	}
+	addr, err := EncodeSegwit(v.HRP, version, program)
+	if err != nil {
+		return err
+	}
+	if addr != strings.ToLower(v.Address) {
+		return fmt.Errorf("%w: encoded again as %v", ErrVectorMismatch,
+			addr)
+	}
+	return nil
+}
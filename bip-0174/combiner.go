@@ -0,0 +1,116 @@
+package psbt
+
+import (
+	"fmt"
+)
+
+// Combine merges packets of the same transaction and version into a new
+// packet, as the Combiner does: each of its maps has the key-value pairs of
+// the maps of all the packets. When packets have different values for a
+// key, the value of the first packet with the key is kept, except that the
+// inputs and outputs of version 2 packets stay modifiable only if all the
+// packets allow it.
+func Combine(p *Packet, others ...*Packet) (*Packet, error) {
+	packets := append([]*Packet{p}, others...)
+	for _, packet := range packets {
+		if err := packet.check(); err != nil {
+			return nil, err
+		}
+	}
+	id, err := p.ID()
+	if err != nil {
+		return nil, err
+	}
+	for _, other := range others {
+		otherID, err := other.ID()
+		if err != nil {
+			return nil, err
+		}
+		if other.Version != p.Version || otherID != id {
+			return nil, ErrCombineMismatch
+		}
+	}
+
+	var global [][]pair
+	for _, packet := range packets {
+		global = append(global, packet.globalPairs())
+	}
+	combined, _, _, err := decodeGlobal(mergePairs(global))
+	if err != nil {
+		return nil, err
+	}
+	if combined.Version == 2 {
+		combined.TxModifiable = combineModifiable(packets)
+	}
+
+	combined.Inputs = make([]Input, len(p.Inputs))
+	for i := range combined.Inputs {
+		var maps [][]pair
+		for _, packet := range packets {
+			maps = append(maps, packet.Inputs[i].pairs(p.Version))
+		}
+		scope := fmt.Sprintf("input %d", i)
+		combined.Inputs[i], err = decodeInput(mergePairs(maps),
+			p.Version, scope)
+		if err != nil {
+			return nil, err
+		}
+		if err := combined.checkNonWitnessUtxo(i); err != nil {
+			return nil, err
+		}
+	}
+
+	combined.Outputs = make([]Output, len(p.Outputs))
+	for i := range combined.Outputs {
+		var maps [][]pair
+		for _, packet := range packets {
+			maps = append(maps, packet.Outputs[i].pairs(p.Version))
+		}
+		scope := fmt.Sprintf("output %d", i)
+		combined.Outputs[i], err = decodeOutput(mergePairs(maps),
+			p.Version, scope)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return combined, nil
+}
+
+// mergePairs returns the union of the pairs of maps, keeping the first
+// value of each key.
+func mergePairs(maps [][]pair) []pair {
+	var merged []pair
+	seen := make(map[string]bool)
+	for _, pairs := range maps {
+		for _, kv := range pairs {
+			if !seen[string(kv.key)] {
+				seen[string(kv.key)] = true
+				merged = append(merged, kv)
+			}
+		}
+	}
+	return merged
+}
+
+// combineModifiable returns the TxModifiable flags of combined version 2
+// packets: inputs and outputs are modifiable if they are in every packet,
+// and HasSighashSingle is set if it is in any packet.
+func combineModifiable(packets []*Packet) *uint8 {
+	found := false
+	modifiable := uint8(ModifiableInputs | ModifiableOutputs)
+	var single uint8
+	for _, p := range packets {
+		var flags uint8
+		if p.TxModifiable != nil {
+			flags = *p.TxModifiable
+			found = true
+		}
+		modifiable &= flags
+		single |= flags & HasSighashSingle
+	}
+	if !found {
+		return nil
+	}
+	flags := modifiable | single
+	return &flags
+}
@@ -0,0 +1,1492 @@
+package psbt
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"golang.org/x/crypto/ripemd160"
+)
+
+// magic are the bytes every packet starts with: psbt followed by 0xff.
+var magic = []byte{0x70, 0x73, 0x62, 0x74, 0xff}
+
+// Names of the known key types of each map, for error messages.
+var (
+	globalFields = map[uint64]string{
+		GlobalUnsignedTx:       "unsigned transaction",
+		GlobalXPub:             "xpub",
+		GlobalTxVersion:        "transaction version",
+		GlobalFallbackLockTime: "fallback lock time",
+		GlobalInputCount:       "input count",
+		GlobalOutputCount:      "output count",
+		GlobalTxModifiable:     "modifiable flags",
+		GlobalVersion:          "version",
+		GlobalProprietary:      "proprietary key",
+	}
+	inputFields = map[uint64]string{
+		InputNonWitnessUtxo:         "non-witness UTXO",
+		InputWitnessUtxo:            "witness UTXO",
+		InputPartialSig:             "partial signature",
+		InputSighashType:            "sighash type",
+		InputRedeemScript:           "redeem script",
+		InputWitnessScript:          "witness script",
+		InputBIP32Derivation:        "BIP 32 derivation",
+		InputFinalScriptSig:         "final scriptSig",
+		InputFinalScriptWitness:     "final scriptWitness",
+		InputRIPEMD160:              "RIPEMD160 preimage",
+		InputSHA256:                 "SHA256 preimage",
+		InputHash160:                "HASH160 preimage",
+		InputHash256:                "HASH256 preimage",
+		InputPreviousTxid:           "previous txid",
+		InputOutputIndex:            "output index",
+		InputSequence:               "sequence",
+		InputRequiredTimeLockTime:   "required time lock time",
+		InputRequiredHeightLockTime: "required height lock time",
+		InputTapKeySig:              "taproot key signature",
+		InputTapScriptSig:           "taproot script signature",
+		InputTapLeafScript:          "taproot leaf script",
+		InputTapBIP32Derivation:     "taproot BIP 32 derivation",
+		InputTapInternalKey:         "taproot internal key",
+		InputTapMerkleRoot:          "taproot merkle root",
+		InputProprietary:            "proprietary key",
+	}
+	outputFields = map[uint64]string{
+		OutputRedeemScript:       "redeem script",
+		OutputWitnessScript:      "witness script",
+		OutputBIP32Derivation:    "BIP 32 derivation",
+		OutputAmount:             "amount",
+		OutputScript:             "script",
+		OutputTapInternalKey:     "taproot internal key",
+		OutputTapTree:            "taproot tree",
+		OutputTapBIP32Derivation: "taproot BIP 32 derivation",
+		OutputProprietary:        "proprietary key",
+	}
+)
+
+// versionField tells which version of packets a key type is in, if only
+// one.
+type versionField struct {
+	version  uint32
+	required bool
+}
+
+// Key types of each map that are only in one version of packets, and
+// whether that version requires them.
+var (
+	globalVersionFields = map[uint64]versionField{
+		GlobalUnsignedTx:       {version: 0},
+		GlobalTxVersion:        {version: 2, required: true},
+		GlobalFallbackLockTime: {version: 2},
+		GlobalInputCount:       {version: 2, required: true},
+		GlobalOutputCount:      {version: 2, required: true},
+		GlobalTxModifiable:     {version: 2},
+	}
+	inputVersionFields = map[uint64]versionField{
+		InputPreviousTxid:           {version: 2, required: true},
+		InputOutputIndex:            {version: 2, required: true},
+		InputSequence:               {version: 2},
+		InputRequiredTimeLockTime:   {version: 2},
+		InputRequiredHeightLockTime: {version: 2},
+	}
+	outputVersionFields = map[uint64]versionField{
+		OutputAmount: {version: 2, required: true},
+		OutputScript: {version: 2, required: true},
+	}
+)
+
+// checkVersionFields checks that a map has the key types its version
+// requires and none that other versions have, given the types of its keys
+// in order.
+func checkVersionFields(version uint32, types []uint64,
+	versionFields map[uint64]versionField, fields map[uint64]string,
+	scope string) error {
+
+	seen := make(map[uint64]bool)
+	for _, typ := range types {
+		field, ok := versionFields[typ]
+		if ok && field.version != version {
+			return fieldErr(ErrExcludedField, fieldName(fields, typ),
+				scope)
+		}
+		seen[typ] = true
+	}
+
+	var missing []uint64
+	for typ, field := range versionFields {
+		if field.version == version && field.required && !seen[typ] {
+			missing = append(missing, typ)
+		}
+	}
+	if len(missing) != 0 {
+		sort.Slice(missing, func(i, j int) bool {
+			return missing[i] < missing[j]
+		})
+		return fieldErr(ErrMissingField, fieldName(fields, missing[0]),
+			scope)
+	}
+	return nil
+}
+
+// fieldName returns the name of the key type in a map with the field names.
+func fieldName(fields map[uint64]string, typ uint64) string {
+	if name, ok := fields[typ]; ok {
+		return name
+	}
+	return fmt.Sprintf("key type 0x%02x", typ)
+}
+
+// fieldErr wraps err with the field it was found in and the map of the
+// field.
+func fieldErr(err error, field, scope string) error {
+	return fmt.Errorf("%w: %s in %s", err, field, scope)
+}
+
+// pair is a key-value pair as it's serialized. The key starts with its type.
+type pair struct {
+	key, value []byte
+}
+
+// readCompactSize reads a compact size, which must be canonical.
+func readCompactSize(r *bytes.Reader) (uint64, error) {
+	n, err := wire.ReadVarInt(r, 0)
+	switch {
+	case err == io.EOF || err == io.ErrUnexpectedEOF:
+		return 0, ErrTruncated
+	case err != nil:
+		return 0, ErrInvalidCompactSize
+	}
+	return n, nil
+}
+
+// readBytes reads a compact size followed by as many bytes.
+func readBytes(r *bytes.Reader) ([]byte, error) {
+	n, err := readCompactSize(r)
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(r.Len()) {
+		return nil, ErrTruncated
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, ErrTruncated
+	}
+	return b, nil
+}
+
+// readMap reads the pairs of a map up to its separator, and checks that
+// every key is unique. Scope names the map and fields its key types, for
+// error messages.
+func readMap(r *bytes.Reader, scope string,
+	fields map[uint64]string) ([]pair, error) {
+
+	var pairs []pair
+	seen := make(map[string]bool)
+	for {
+		key, err := readBytes(r)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", err, scope)
+		}
+		if len(key) == 0 {
+			return pairs, nil
+		}
+		value, err := readBytes(r)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", err, scope)
+		}
+
+		if seen[string(key)] {
+			name := "key"
+			if typ, _, err := splitKey(key); err == nil {
+				name = fieldName(fields, typ)
+			}
+			return nil, fieldErr(ErrDuplicateKey, name, scope)
+		}
+		seen[string(key)] = true
+		pairs = append(pairs, pair{key: key, value: value})
+	}
+}
+
+// splitKey splits a key into its type and key data.
+func splitKey(key []byte) (uint64, []byte, error) {
+	r := bytes.NewReader(key)
+	typ, err := readCompactSize(r)
+	if err != nil {
+		return 0, nil, ErrInvalidCompactSize
+	}
+	return typ, key[len(key)-r.Len():], nil
+}
+
+// makeKey returns a key of the type with the key data.
+func makeKey(typ uint64, data ...[]byte) []byte {
+	var buf bytes.Buffer
+	wire.WriteVarInt(&buf, 0, typ)
+	for _, d := range data {
+		buf.Write(d)
+	}
+	return buf.Bytes()
+}
+
+// noKeyData checks that a key is only its type.
+func noKeyData(keyData []byte) error {
+	if len(keyData) != 0 {
+		return ErrInvalidKeyData
+	}
+	return nil
+}
+
+// parseTx parses a whole transaction, in the witness serialization if
+// witness is set.
+func parseTx(value []byte, witness bool) (*wire.MsgTx, error) {
+	tx := new(wire.MsgTx)
+	r := bytes.NewReader(value)
+	var err error
+	if witness {
+		err = tx.Deserialize(r)
+	} else {
+		err = tx.DeserializeNoWitness(r)
+	}
+	if err != nil || r.Len() != 0 {
+		return nil, ErrInvalidValue
+	}
+	return tx, nil
+}
+
+// serializeTx serializes a transaction, in the witness serialization if
+// witness is set and the transaction has witnesses.
+func serializeTx(tx *wire.MsgTx, witness bool) []byte {
+	var buf bytes.Buffer
+
+	// Writes to a bytes.Buffer never fail.
+	if witness {
+		tx.Serialize(&buf)
+	} else {
+		tx.SerializeNoWitness(&buf)
+	}
+	return buf.Bytes()
+}
+
+// parseTxOut parses a whole transaction output.
+func parseTxOut(value []byte) (*wire.TxOut, error) {
+	var out wire.TxOut
+	r := bytes.NewReader(value)
+	if err := wire.ReadTxOut(r, 0, 0, &out); err != nil || r.Len() != 0 {
+		return nil, ErrInvalidValue
+	}
+	return &out, nil
+}
+
+// serializeTxOut serializes a transaction output.
+func serializeTxOut(out *wire.TxOut) []byte {
+	var buf bytes.Buffer
+	wire.WriteTxOut(&buf, 0, 0, out)
+	return buf.Bytes()
+}
+
+// parseWitness parses a whole witness stack.
+func parseWitness(value []byte) (wire.TxWitness, error) {
+	r := bytes.NewReader(value)
+	n, err := readCompactSize(r)
+	if err != nil || n > uint64(r.Len()) {
+		return nil, ErrInvalidValue
+	}
+	witness := make(wire.TxWitness, 0, n)
+	for i := uint64(0); i < n; i++ {
+		item, err := readBytes(r)
+		if err != nil {
+			return nil, ErrInvalidValue
+		}
+		witness = append(witness, item)
+	}
+	if r.Len() != 0 {
+		return nil, ErrInvalidValue
+	}
+	return witness, nil
+}
+
+// serializeWitness serializes a witness stack.
+func serializeWitness(witness wire.TxWitness) []byte {
+	var buf bytes.Buffer
+	wire.WriteVarInt(&buf, 0, uint64(len(witness)))
+	for _, item := range witness {
+		wire.WriteVarBytes(&buf, 0, item)
+	}
+	return buf.Bytes()
+}
+
+// parsePubKey checks that key data is a valid public key, compressed or not.
+func parsePubKey(keyData []byte) ([]byte, error) {
+	if len(keyData) != 33 && len(keyData) != 65 {
+		return nil, ErrInvalidKeyData
+	}
+	if _, err := btcec.ParsePubKey(keyData); err != nil {
+		return nil, ErrInvalidKeyData
+	}
+	return keyData, nil
+}
+
+// parseOrigin parses a fingerprint followed by a path of 32 bit indexes.
+func parseOrigin(value []byte) (KeyOrigin, error) {
+	var origin KeyOrigin
+	if len(value) < 4 || len(value)%4 != 0 {
+		return origin, ErrInvalidValue
+	}
+	copy(origin.Fingerprint[:], value)
+	origin.Path = make([]uint32, 0, len(value)/4-1)
+	for i := 4; i < len(value); i += 4 {
+		origin.Path = append(origin.Path,
+			binary.LittleEndian.Uint32(value[i:]))
+	}
+	return origin, nil
+}
+
+// serializeOrigin serializes an origin as parseOrigin parses it.
+func serializeOrigin(origin KeyOrigin) []byte {
+	b := append([]byte(nil), origin.Fingerprint[:]...)
+	for _, index := range origin.Path {
+		b = binary.LittleEndian.AppendUint32(b, index)
+	}
+	return b
+}
+
+// parseUint32 parses a 32 bit little endian value.
+func parseUint32(value []byte) (uint32, error) {
+	if len(value) != 4 {
+		return 0, ErrInvalidValue
+	}
+	return binary.LittleEndian.Uint32(value), nil
+}
+
+// parseCompactSizeValue parses a value that is a compact size.
+func parseCompactSizeValue(value []byte) (uint64, error) {
+	r := bytes.NewReader(value)
+	n, err := readCompactSize(r)
+	if err != nil || r.Len() != 0 {
+		return 0, ErrInvalidValue
+	}
+	return n, nil
+}
+
+// compactSize serializes a compact size.
+func compactSize(n uint64) []byte {
+	var buf bytes.Buffer
+	wire.WriteVarInt(&buf, 0, n)
+	return buf.Bytes()
+}
+
+// parseLockTime parses a lock time, which must be a timestamp if time is set
+// and a block height otherwise.
+func parseLockTime(value []byte, time bool) (*uint32, error) {
+	lockTime, err := parseUint32(value)
+	if err != nil {
+		return nil, err
+	}
+	if (lockTime >= lockTimeThreshold) != time {
+		return nil, ErrInvalidValue
+	}
+	return &lockTime, nil
+}
+
+// hashPreimage returns the hash of a preimage of the type.
+func hashPreimage(typ uint64, preimage []byte) []byte {
+	switch typ {
+	case InputRIPEMD160:
+		h := ripemd160.New()
+		h.Write(preimage)
+		return h.Sum(nil)
+	case InputSHA256:
+		sum := sha256.Sum256(preimage)
+		return sum[:]
+	case InputHash160:
+		return btcutil.Hash160(preimage)
+	default:
+		sum := sha256.Sum256(preimage)
+		sum = sha256.Sum256(sum[:])
+		return sum[:]
+	}
+}
+
+// parsePreimage parses a preimage, whose key data is its hash.
+func parsePreimage(typ uint64, keyData, value []byte) (Preimage, error) {
+	hash := hashPreimage(typ, value)
+	if len(keyData) != len(hash) {
+		return Preimage{}, ErrInvalidKeyData
+	}
+	if !bytes.Equal(hash, keyData) {
+		return Preimage{}, ErrInvalidValue
+	}
+	return Preimage{Type: typ, Hash: keyData, Preimage: value}, nil
+}
+
+// parseProprietary parses the key data of a proprietary key: the identifier
+// with its length, the subtype, and the rest of the key data.
+func parseProprietary(keyData, value []byte) (Proprietary, error) {
+	r := bytes.NewReader(keyData)
+	identifier, err := readBytes(r)
+	if err != nil {
+		return Proprietary{}, ErrInvalidKeyData
+	}
+	subtype, err := readCompactSize(r)
+	if err != nil {
+		return Proprietary{}, ErrInvalidKeyData
+	}
+	return Proprietary{
+		Identifier: identifier,
+		Subtype:    subtype,
+		KeyData:    keyData[len(keyData)-r.Len():],
+		Value:      value,
+	}, nil
+}
+
+// key returns the serialized key of the proprietary pair.
+func (p *Proprietary) key(typ uint64) []byte {
+	var buf bytes.Buffer
+	wire.WriteVarBytes(&buf, 0, p.Identifier)
+	wire.WriteVarInt(&buf, 0, p.Subtype)
+	buf.Write(p.KeyData)
+	return makeKey(typ, buf.Bytes())
+}
+
+// Parse parses a serialized packet of version 0 or 2, and checks that its
+// keys are unique in each map, that the keys and values of the types BIP 174
+// and BIP 370 define are valid, and that each map has the fields its version
+// requires and none that only the other version has. The keys of each map
+// may be in any order.
+func Parse(data []byte) (*Packet, error) {
+	if !bytes.HasPrefix(data, magic) {
+		return nil, ErrInvalidMagic
+	}
+	r := bytes.NewReader(data[len(magic):])
+
+	pairs, err := readMap(r, "global map", globalFields)
+	if err != nil {
+		return nil, err
+	}
+	p, inputs, outputs, err := decodeGlobal(pairs)
+	if err != nil {
+		return nil, err
+	}
+
+	// Every map takes at least a byte, which bounds the counts of
+	// version 2 packets before anything is allocated for them.
+	if inputs+outputs > uint64(r.Len()) {
+		return nil, ErrTruncated
+	}
+
+	p.Inputs = make([]Input, inputs)
+	for i := range p.Inputs {
+		scope := fmt.Sprintf("input %d", i)
+		pairs, err := readMap(r, scope, inputFields)
+		if err != nil {
+			return nil, err
+		}
+		p.Inputs[i], err = decodeInput(pairs, p.Version, scope)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.checkNonWitnessUtxo(i); err != nil {
+			return nil, err
+		}
+	}
+
+	p.Outputs = make([]Output, outputs)
+	for i := range p.Outputs {
+		scope := fmt.Sprintf("output %d", i)
+		pairs, err := readMap(r, scope, outputFields)
+		if err != nil {
+			return nil, err
+		}
+		p.Outputs[i], err = decodeOutput(pairs, p.Version, scope)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if r.Len() != 0 {
+		return nil, ErrTrailingData
+	}
+	return p, nil
+}
+
+// ParseStrict parses a serialized packet like Parse, and also checks that it
+// is serialized exactly as Serialize would serialize it, with the keys of
+// each map in canonical order.
+func ParseStrict(data []byte) (*Packet, error) {
+	p, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	serialized, err := p.Serialize()
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(serialized, data) {
+		return nil, ErrNonCanonical
+	}
+	return p, nil
+}
+
+// ParseBase64 parses a packet encoded in base64, as packets are exchanged as
+// text.
+func ParseBase64(s string) (*Packet, error) {
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidBase64
+	}
+	return Parse(data)
+}
+
+// decodeGlobal decodes the pairs of the global map, and returns the numbers
+// of inputs and outputs of the packet.
+func decodeGlobal(pairs []pair) (*Packet, uint64, uint64, error) {
+	p := new(Packet)
+	var inputs, outputs uint64
+	var types []uint64
+	for _, kv := range pairs {
+		typ, keyData, err := splitKey(kv.key)
+		if err != nil {
+			return nil, 0, 0, fieldErr(err, "key", "global map")
+		}
+		types = append(types, typ)
+		switch typ {
+		case GlobalUnsignedTx:
+			if err = noKeyData(keyData); err != nil {
+				break
+			}
+			if p.UnsignedTx, err = parseTx(kv.value, false); err != nil {
+				break
+			}
+			err = checkUnsigned(p.UnsignedTx)
+
+		case GlobalXPub:
+			if len(keyData) != 78 {
+				err = ErrInvalidKeyData
+				break
+			}
+			var origin KeyOrigin
+			if origin, err = parseOrigin(kv.value); err == nil {
+				p.XPubs = append(p.XPubs, XPub{
+					ExtendedKey: keyData,
+					KeyOrigin:   origin,
+				})
+			}
+
+		case GlobalTxVersion:
+			var version uint32
+			if err = noKeyData(keyData); err != nil {
+				break
+			}
+			if version, err = parseUint32(kv.value); err != nil {
+				break
+			}
+			if p.TxVersion = int32(version); p.TxVersion < 2 {
+				err = ErrInvalidValue
+			}
+
+		case GlobalFallbackLockTime:
+			var lockTime uint32
+			if err = noKeyData(keyData); err != nil {
+				break
+			}
+			if lockTime, err = parseUint32(kv.value); err == nil {
+				p.FallbackLockTime = &lockTime
+			}
+
+		case GlobalInputCount:
+			if err = noKeyData(keyData); err == nil {
+				inputs, err = parseCompactSizeValue(kv.value)
+			}
+
+		case GlobalOutputCount:
+			if err = noKeyData(keyData); err == nil {
+				outputs, err = parseCompactSizeValue(kv.value)
+			}
+
+		case GlobalTxModifiable:
+			if err = noKeyData(keyData); err != nil {
+				break
+			}
+			if len(kv.value) != 1 {
+				err = ErrInvalidValue
+				break
+			}
+			flags := kv.value[0]
+			p.TxModifiable = &flags
+
+		case GlobalVersion:
+			if err = noKeyData(keyData); err == nil {
+				p.Version, err = parseUint32(kv.value)
+			}
+
+		case GlobalProprietary:
+			var prop Proprietary
+			if prop, err = parseProprietary(keyData, kv.value); err == nil {
+				p.Proprietary = append(p.Proprietary, prop)
+			}
+
+		default:
+			p.Unknowns = append(p.Unknowns, Unknown{
+				Key:   kv.key,
+				Value: kv.value,
+			})
+		}
+		if err != nil {
+			return nil, 0, 0, fieldErr(err, fieldName(globalFields, typ),
+				"global map")
+		}
+	}
+
+	if p.Version != 0 && p.Version != 2 {
+		return nil, 0, 0, fmt.Errorf("%w %d", ErrUnsupportedVersion,
+			p.Version)
+	}
+	err := checkVersionFields(p.Version, types, globalVersionFields,
+		globalFields, "global map")
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	if p.Version == 0 && p.UnsignedTx == nil {
+		return nil, 0, 0, ErrMissingUnsignedTx
+	}
+	if p.Version == 0 {
+		inputs = uint64(len(p.UnsignedTx.TxIn))
+		outputs = uint64(len(p.UnsignedTx.TxOut))
+	}
+	return p, inputs, outputs, nil
+}
+
+// decodeInput decodes the pairs of an input map of a packet of the version.
+func decodeInput(pairs []pair, version uint32, scope string) (Input, error) {
+	var in Input
+	var types []uint64
+	for _, kv := range pairs {
+		typ, keyData, err := splitKey(kv.key)
+		if err != nil {
+			return in, fieldErr(err, "key", scope)
+		}
+		types = append(types, typ)
+		switch typ {
+		case InputNonWitnessUtxo:
+			if err = noKeyData(keyData); err == nil {
+				in.NonWitnessUtxo, err = parseTx(kv.value, true)
+			}
+
+		case InputWitnessUtxo:
+			if err = noKeyData(keyData); err == nil {
+				in.WitnessUtxo, err = parseTxOut(kv.value)
+			}
+
+		case InputPartialSig:
+			var pubKey []byte
+			if pubKey, err = parsePubKey(keyData); err == nil {
+				in.PartialSigs = append(in.PartialSigs, PartialSig{
+					PubKey:    pubKey,
+					Signature: kv.value,
+				})
+			}
+
+		case InputSighashType:
+			var sighash uint32
+			if err = noKeyData(keyData); err != nil {
+				break
+			}
+			if sighash, err = parseUint32(kv.value); err == nil {
+				sighashType := txscript.SigHashType(sighash)
+				in.SighashType = &sighashType
+			}
+
+		case InputRedeemScript:
+			if err = noKeyData(keyData); err == nil {
+				in.RedeemScript = kv.value
+			}
+
+		case InputWitnessScript:
+			if err = noKeyData(keyData); err == nil {
+				in.WitnessScript = kv.value
+			}
+
+		case InputBIP32Derivation:
+			in.Derivations, err = appendDerivation(in.Derivations,
+				keyData, kv.value)
+
+		case InputFinalScriptSig:
+			if err = noKeyData(keyData); err == nil {
+				in.FinalScriptSig = kv.value
+			}
+
+		case InputFinalScriptWitness:
+			if err = noKeyData(keyData); err == nil {
+				in.FinalScriptWitness, err = parseWitness(kv.value)
+			}
+
+		case InputRIPEMD160, InputSHA256, InputHash160, InputHash256:
+			var preimage Preimage
+			preimage, err = parsePreimage(typ, keyData, kv.value)
+			if err == nil {
+				in.Preimages = append(in.Preimages, preimage)
+			}
+
+		case InputPreviousTxid:
+			if err = noKeyData(keyData); err != nil {
+				break
+			}
+			if len(kv.value) != chainhash.HashSize {
+				err = ErrInvalidValue
+				break
+			}
+			copy(in.PreviousTxid[:], kv.value)
+
+		case InputOutputIndex:
+			if err = noKeyData(keyData); err == nil {
+				in.OutputIndex, err = parseUint32(kv.value)
+			}
+
+		case InputSequence:
+			var sequence uint32
+			if err = noKeyData(keyData); err != nil {
+				break
+			}
+			if sequence, err = parseUint32(kv.value); err == nil {
+				in.Sequence = &sequence
+			}
+
+		case InputRequiredTimeLockTime:
+			if err = noKeyData(keyData); err == nil {
+				in.RequiredTimeLockTime, err = parseLockTime(kv.value,
+					true)
+			}
+
+		case InputRequiredHeightLockTime:
+			if err = noKeyData(keyData); err == nil {
+				in.RequiredHeightLockTime, err = parseLockTime(kv.value,
+					false)
+			}
+
+		case InputTapKeySig:
+			if err = noKeyData(keyData); err == nil {
+				in.TapKeySig, err = parseSchnorrSig(kv.value)
+			}
+
+		case InputTapScriptSig:
+			var sig TapScriptSig
+			if sig, err = parseTapScriptSig(keyData, kv.value); err == nil {
+				in.TapScriptSigs = append(in.TapScriptSigs, sig)
+			}
+
+		case InputTapLeafScript:
+			var leaf TapLeafScript
+			if leaf, err = parseTapLeafScript(keyData, kv.value); err == nil {
+				in.TapLeafScripts = append(in.TapLeafScripts, leaf)
+			}
+
+		case InputTapBIP32Derivation:
+			in.TapDerivations, err = appendTapDerivation(
+				in.TapDerivations, keyData, kv.value)
+
+		case InputTapInternalKey:
+			if err = noKeyData(keyData); err == nil {
+				in.TapInternalKey, err = parseXOnlyPubKey(kv.value)
+			}
+
+		case InputTapMerkleRoot:
+			if err = noKeyData(keyData); err != nil {
+				break
+			}
+			if len(kv.value) != chainhash.HashSize {
+				err = ErrInvalidValue
+				break
+			}
+			in.TapMerkleRoot = kv.value
+
+		case InputProprietary:
+			var prop Proprietary
+			if prop, err = parseProprietary(keyData, kv.value); err == nil {
+				in.Proprietary = append(in.Proprietary, prop)
+			}
+
+		default:
+			in.Unknowns = append(in.Unknowns, Unknown{
+				Key:   kv.key,
+				Value: kv.value,
+			})
+		}
+		if err != nil {
+			return in, fieldErr(err, fieldName(inputFields, typ), scope)
+		}
+	}
+	err := checkVersionFields(version, types, inputVersionFields,
+		inputFields, scope)
+	return in, err
+}
+
+// decodeOutput decodes the pairs of an output map of a packet of the
+// version.
+func decodeOutput(pairs []pair, version uint32, scope string) (Output, error) {
+	var out Output
+	var types []uint64
+	for _, kv := range pairs {
+		typ, keyData, err := splitKey(kv.key)
+		if err != nil {
+			return out, fieldErr(err, "key", scope)
+		}
+		types = append(types, typ)
+		switch typ {
+		case OutputRedeemScript:
+			if err = noKeyData(keyData); err == nil {
+				out.RedeemScript = kv.value
+			}
+
+		case OutputWitnessScript:
+			if err = noKeyData(keyData); err == nil {
+				out.WitnessScript = kv.value
+			}
+
+		case OutputBIP32Derivation:
+			out.Derivations, err = appendDerivation(out.Derivations,
+				keyData, kv.value)
+
+		case OutputAmount:
+			if err = noKeyData(keyData); err != nil {
+				break
+			}
+			if len(kv.value) != 8 {
+				err = ErrInvalidValue
+				break
+			}
+			out.Amount = int64(binary.LittleEndian.Uint64(kv.value))
+
+		case OutputScript:
+			if err = noKeyData(keyData); err == nil {
+				out.Script = kv.value
+			}
+
+		case OutputTapInternalKey:
+			if err = noKeyData(keyData); err == nil {
+				out.TapInternalKey, err = parseXOnlyPubKey(kv.value)
+			}
+
+		case OutputTapTree:
+			if err = noKeyData(keyData); err == nil {
+				out.TapTree, err = parseTapTree(kv.value)
+			}
+
+		case OutputTapBIP32Derivation:
+			out.TapDerivations, err = appendTapDerivation(
+				out.TapDerivations, keyData, kv.value)
+
+		case OutputProprietary:
+			var prop Proprietary
+			if prop, err = parseProprietary(keyData, kv.value); err == nil {
+				out.Proprietary = append(out.Proprietary, prop)
+			}
+
+		default:
+			out.Unknowns = append(out.Unknowns, Unknown{
+				Key:   kv.key,
+				Value: kv.value,
+			})
+		}
+		if err != nil {
+			return out, fieldErr(err, fieldName(outputFields, typ),
+				scope)
+		}
+	}
+	err := checkVersionFields(version, types, outputVersionFields,
+		outputFields, scope)
+	return out, err
+}
+
+// appendDerivation parses a BIP 32 derivation and appends it.
+func appendDerivation(derivations []Derivation, keyData,
+	value []byte) ([]Derivation, error) {
+
+	pubKey, err := parsePubKey(keyData)
+	if err != nil {
+		return nil, err
+	}
+	origin, err := parseOrigin(value)
+	if err != nil {
+		return nil, err
+	}
+	return append(derivations, Derivation{
+		PubKey:    pubKey,
+		KeyOrigin: origin,
+	}), nil
+}
+
+// parseXOnlyPubKey checks that a value is a valid x-only public key.
+func parseXOnlyPubKey(value []byte) ([]byte, error) {
+	if len(value) != schnorr.PubKeyBytesLen {
+		return nil, ErrInvalidValue
+	}
+	if _, err := schnorr.ParsePubKey(value); err != nil {
+		return nil, ErrInvalidValue
+	}
+	return value, nil
+}
+
+// parseSchnorrSig checks that a value is a Schnorr signature, with or
+// without a sighash type.
+func parseSchnorrSig(value []byte) ([]byte, error) {
+	if len(value) != schnorr.SignatureSize &&
+		len(value) != schnorr.SignatureSize+1 {
+
+		return nil, ErrInvalidValue
+	}
+	return value, nil
+}
+
+// parseTapScriptSig parses a signature of a leaf script, whose key data is
+// the x-only public key followed by the hash of the leaf.
+func parseTapScriptSig(keyData, value []byte) (TapScriptSig, error) {
+	var sig TapScriptSig
+	if len(keyData) != schnorr.PubKeyBytesLen+chainhash.HashSize {
+		return sig, ErrInvalidKeyData
+	}
+	pubKey, err := parseXOnlyPubKey(keyData[:schnorr.PubKeyBytesLen])
+	if err != nil {
+		return sig, ErrInvalidKeyData
+	}
+	if sig.Signature, err = parseSchnorrSig(value); err != nil {
+		return sig, err
+	}
+	sig.XOnlyPubKey = pubKey
+	copy(sig.LeafHash[:], keyData[schnorr.PubKeyBytesLen:])
+	return sig, nil
+}
+
+// parseTapLeafScript parses a leaf script, whose key data is its control
+// block and whose value is the script followed by its leaf version.
+func parseTapLeafScript(keyData, value []byte) (TapLeafScript, error) {
+	if len(keyData) < txscript.ControlBlockBaseSize ||
+		len(keyData) > txscript.ControlBlockMaxSize ||
+		(len(keyData)-txscript.ControlBlockBaseSize)%
+			txscript.ControlBlockNodeSize != 0 {
+
+		return TapLeafScript{}, ErrInvalidKeyData
+	}
+	if len(value) == 0 {
+		return TapLeafScript{}, ErrInvalidValue
+	}
+	return TapLeafScript{
+		ControlBlock: keyData,
+		Script:       value[:len(value)-1],
+		LeafVersion:  txscript.TapscriptLeafVersion(value[len(value)-1]),
+	}, nil
+}
+
+// appendTapDerivation parses a taproot BIP 32 derivation, whose value is the
+// hashes of the leaves with their count followed by the origin, and appends
+// it.
+func appendTapDerivation(derivations []TapDerivation, keyData,
+	value []byte) ([]TapDerivation, error) {
+
+	pubKey, err := parseXOnlyPubKey(keyData)
+	if err != nil {
+		return nil, ErrInvalidKeyData
+	}
+	r := bytes.NewReader(value)
+	n, err := readCompactSize(r)
+	if err != nil || n > uint64(r.Len()/chainhash.HashSize) {
+		return nil, ErrInvalidValue
+	}
+	hashes := make([]chainhash.Hash, n)
+	for i := range hashes {
+		r.Read(hashes[i][:])
+	}
+	origin, err := parseOrigin(value[len(value)-r.Len():])
+	if err != nil {
+		return nil, err
+	}
+	return append(derivations, TapDerivation{
+		XOnlyPubKey: pubKey,
+		LeafHashes:  hashes,
+		KeyOrigin:   origin,
+	}), nil
+}
+
+// parseTapTree parses the leaves of a taproot tree, each its depth, leaf
+// version and script, and checks that they make up a whole tree.
+func parseTapTree(value []byte) ([]TapTreeLeaf, error) {
+	var leaves []TapTreeLeaf
+	r := bytes.NewReader(value)
+	for r.Len() != 0 {
+		depth, _ := r.ReadByte()
+		leafVersion, err := r.ReadByte()
+		if err != nil {
+			return nil, ErrInvalidValue
+		}
+		script, err := readBytes(r)
+		if err != nil {
+			return nil, ErrInvalidValue
+		}
+		leaves = append(leaves, TapTreeLeaf{
+			Depth:       depth,
+			LeafVersion: txscript.TapscriptLeafVersion(leafVersion),
+			Script:      script,
+		})
+	}
+	if _, err := TapTreeRoot(leaves); err != nil {
+		return nil, ErrInvalidValue
+	}
+	return leaves, nil
+}
+
+// Serialize serializes the packet, with the keys of each map in the order
+// Bitcoin Core writes them: by type, then proprietary keys and keys of
+// unknown types.
+func (p *Packet) Serialize() ([]byte, error) {
+	if err := p.check(); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.Write(magic)
+	writeMap(&buf, p.globalPairs())
+	for i := range p.Inputs {
+		writeMap(&buf, p.Inputs[i].pairs(p.Version))
+	}
+	for i := range p.Outputs {
+		writeMap(&buf, p.Outputs[i].pairs(p.Version))
+	}
+	return buf.Bytes(), nil
+}
+
+// check checks that the packet has the fields its version requires and none
+// that only the other version has, so that it can be serialized.
+func (p *Packet) check() error {
+	switch p.Version {
+	case 0:
+		if p.UnsignedTx == nil {
+			return ErrMissingUnsignedTx
+		}
+		if err := checkUnsigned(p.UnsignedTx); err != nil {
+			return err
+		}
+		if len(p.Inputs) != len(p.UnsignedTx.TxIn) ||
+			len(p.Outputs) != len(p.UnsignedTx.TxOut) {
+
+			return ErrMapCount
+		}
+		if p.TxVersion != 0 || p.FallbackLockTime != nil ||
+			p.TxModifiable != nil {
+
+			return fieldErr(ErrExcludedField, "version 2 fields",
+				"global map")
+		}
+		for i := range p.Inputs {
+			in := &p.Inputs[i]
+			if in.PreviousTxid != (chainhash.Hash{}) ||
+				in.OutputIndex != 0 || in.Sequence != nil ||
+				in.RequiredTimeLockTime != nil ||
+				in.RequiredHeightLockTime != nil {
+
+				return fieldErr(ErrExcludedField, "version 2 fields",
+					fmt.Sprintf("input %d", i))
+			}
+		}
+		for i := range p.Outputs {
+			if p.Outputs[i].Amount != 0 || p.Outputs[i].Script != nil {
+				return fieldErr(ErrExcludedField, "version 2 fields",
+					fmt.Sprintf("output %d", i))
+			}
+		}
+
+	case 2:
+		if p.UnsignedTx != nil {
+			return fieldErr(ErrExcludedField, "unsigned transaction",
+				"global map")
+		}
+		if p.TxVersion < 2 {
+			return fieldErr(ErrInvalidValue, "transaction version",
+				"global map")
+		}
+
+	default:
+		return fmt.Errorf("%w %d", ErrUnsupportedVersion, p.Version)
+	}
+	return nil
+}
+
+// Base64 returns the serialized packet in base64.
+func (p *Packet) Base64() (string, error) {
+	data, err := p.Serialize()
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+// writeMap writes the pairs of a map followed by its separator.
+func writeMap(buf *bytes.Buffer, pairs []pair) {
+	for _, kv := range pairs {
+		wire.WriteVarBytes(buf, 0, kv.key)
+		wire.WriteVarBytes(buf, 0, kv.value)
+	}
+	buf.WriteByte(0x00)
+}
+
+// sortedPairs sorts pairs by key, as Bitcoin Core keeps the pairs of several
+// key types in sorted maps.
+func sortedPairs(pairs []pair) []pair {
+	sort.SliceStable(pairs, func(i, j int) bool {
+		return bytes.Compare(pairs[i].key, pairs[j].key) < 0
+	})
+	return pairs
+}
+
+// extraPairs returns the pairs of the proprietary keys followed by those of
+// unknown types, each sorted by key.
+func extraPairs(typ uint64, props []Proprietary, unknowns []Unknown) []pair {
+	var propPairs, unknownPairs []pair
+	for i := range props {
+		propPairs = append(propPairs, pair{
+			key:   props[i].key(typ),
+			value: props[i].Value,
+		})
+	}
+	for _, u := range unknowns {
+		unknownPairs = append(unknownPairs, pair{
+			key:   u.Key,
+			value: u.Value,
+		})
+	}
+	return append(sortedPairs(propPairs), sortedPairs(unknownPairs)...)
+}
+
+// derivationPairs returns the pairs of BIP 32 derivations, sorted by public
+// key.
+func derivationPairs(typ uint64, derivations []Derivation) []pair {
+	var pairs []pair
+	for _, d := range derivations {
+		pairs = append(pairs, pair{
+			key:   makeKey(typ, d.PubKey),
+			value: serializeOrigin(d.KeyOrigin),
+		})
+	}
+	return sortedPairs(pairs)
+}
+
+// compareOrigins orders key origins by fingerprint, then path.
+func compareOrigins(a, b KeyOrigin) int {
+	if c := bytes.Compare(a.Fingerprint[:], b.Fingerprint[:]); c != 0 {
+		return c
+	}
+	for i := 0; i < len(a.Path) && i < len(b.Path); i++ {
+		switch {
+		case a.Path[i] < b.Path[i]:
+			return -1
+		case a.Path[i] > b.Path[i]:
+			return 1
+		}
+	}
+	return len(a.Path) - len(b.Path)
+}
+
+// globalPairs returns the pairs of the global map.
+func (p *Packet) globalPairs() []pair {
+	var pairs []pair
+	if p.Version == 0 {
+		pairs = append(pairs, pair{
+			key:   makeKey(GlobalUnsignedTx),
+			value: serializeTx(p.UnsignedTx, false),
+		})
+	}
+
+	// Bitcoin Core groups xpubs by origin.
+	xpubs := append([]XPub(nil), p.XPubs...)
+	sort.SliceStable(xpubs, func(i, j int) bool {
+		if c := compareOrigins(xpubs[i].KeyOrigin,
+			xpubs[j].KeyOrigin); c != 0 {
+
+			return c < 0
+		}
+		return bytes.Compare(xpubs[i].ExtendedKey,
+			xpubs[j].ExtendedKey) < 0
+	})
+	for _, xpub := range xpubs {
+		pairs = append(pairs, pair{
+			key:   makeKey(GlobalXPub, xpub.ExtendedKey),
+			value: serializeOrigin(xpub.KeyOrigin),
+		})
+	}
+
+	if p.Version == 2 {
+		pairs = append(pairs, pair{
+			key: makeKey(GlobalTxVersion),
+			value: binary.LittleEndian.AppendUint32(nil,
+				uint32(p.TxVersion)),
+		})
+		if p.FallbackLockTime != nil {
+			pairs = append(pairs, pair{
+				key: makeKey(GlobalFallbackLockTime),
+				value: binary.LittleEndian.AppendUint32(nil,
+					*p.FallbackLockTime),
+			})
+		}
+		pairs = append(pairs, pair{
+			key:   makeKey(GlobalInputCount),
+			value: compactSize(uint64(len(p.Inputs))),
+		}, pair{
+			key:   makeKey(GlobalOutputCount),
+			value: compactSize(uint64(len(p.Outputs))),
+		})
+		if p.TxModifiable != nil {
+			pairs = append(pairs, pair{
+				key:   makeKey(GlobalTxModifiable),
+				value: []byte{*p.TxModifiable},
+			})
+		}
+	}
+
+	if p.Version != 0 {
+		pairs = append(pairs, pair{
+			key:   makeKey(GlobalVersion),
+			value: binary.LittleEndian.AppendUint32(nil, p.Version),
+		})
+	}
+	return append(pairs, extraPairs(GlobalProprietary, p.Proprietary,
+		p.Unknowns)...)
+}
+
+// pairs returns the pairs of the input's map in a packet of the version.
+func (in *Input) pairs(version uint32) []pair {
+	var pairs []pair
+	if in.NonWitnessUtxo != nil {
+		pairs = append(pairs, pair{
+			key:   makeKey(InputNonWitnessUtxo),
+			value: serializeTx(in.NonWitnessUtxo, true),
+		})
+	}
+	if in.WitnessUtxo != nil {
+		pairs = append(pairs, pair{
+			key:   makeKey(InputWitnessUtxo),
+			value: serializeTxOut(in.WitnessUtxo),
+		})
+	}
+
+	// Bitcoin Core keeps partial signatures by the hash of their public
+	// keys.
+	sigs := append([]PartialSig(nil), in.PartialSigs...)
+	sort.SliceStable(sigs, func(i, j int) bool {
+		return bytes.Compare(btcutil.Hash160(sigs[i].PubKey),
+			btcutil.Hash160(sigs[j].PubKey)) < 0
+	})
+	for _, sig := range sigs {
+		pairs = append(pairs, pair{
+			key:   makeKey(InputPartialSig, sig.PubKey),
+			value: sig.Signature,
+		})
+	}
+
+	if in.SighashType != nil {
+		pairs = append(pairs, pair{
+			key: makeKey(InputSighashType),
+			value: binary.LittleEndian.AppendUint32(nil,
+				uint32(*in.SighashType)),
+		})
+	}
+	if len(in.RedeemScript) != 0 {
+		pairs = append(pairs, pair{
+			key:   makeKey(InputRedeemScript),
+			value: in.RedeemScript,
+		})
+	}
+	if len(in.WitnessScript) != 0 {
+		pairs = append(pairs, pair{
+			key:   makeKey(InputWitnessScript),
+			value: in.WitnessScript,
+		})
+	}
+	pairs = append(pairs, derivationPairs(InputBIP32Derivation,
+		in.Derivations)...)
+	if len(in.FinalScriptSig) != 0 {
+		pairs = append(pairs, pair{
+			key:   makeKey(InputFinalScriptSig),
+			value: in.FinalScriptSig,
+		})
+	}
+	if len(in.FinalScriptWitness) != 0 {
+		pairs = append(pairs, pair{
+			key:   makeKey(InputFinalScriptWitness),
+			value: serializeWitness(in.FinalScriptWitness),
+		})
+	}
+
+	var preimages []pair
+	for _, pre := range in.Preimages {
+		preimages = append(preimages, pair{
+			key:   makeKey(pre.Type, pre.Hash),
+			value: pre.Preimage,
+		})
+	}
+	pairs = append(pairs, sortedPairs(preimages)...)
+
+	if version == 2 {
+		pairs = append(pairs, pair{
+			key:   makeKey(InputPreviousTxid),
+			value: in.PreviousTxid[:],
+		}, pair{
+			key:   makeKey(InputOutputIndex),
+			value: binary.LittleEndian.AppendUint32(nil, in.OutputIndex),
+		})
+		for _, field := range []struct {
+			typ   uint64
+			value *uint32
+		}{
+			{InputSequence, in.Sequence},
+			{InputRequiredTimeLockTime, in.RequiredTimeLockTime},
+			{InputRequiredHeightLockTime, in.RequiredHeightLockTime},
+		} {
+			if field.value != nil {
+				pairs = append(pairs, pair{
+					key: makeKey(field.typ),
+					value: binary.LittleEndian.AppendUint32(nil,
+						*field.value),
+				})
+			}
+		}
+	}
+
+	pairs = append(pairs, in.taprootPairs()...)
+	return append(pairs, extraPairs(InputProprietary, in.Proprietary,
+		in.Unknowns)...)
+}
+
+// pairs returns the pairs of the output's map in a packet of the version.
+func (out *Output) pairs(version uint32) []pair {
+	var pairs []pair
+	if len(out.RedeemScript) != 0 {
+		pairs = append(pairs, pair{
+			key:   makeKey(OutputRedeemScript),
+			value: out.RedeemScript,
+		})
+	}
+	if len(out.WitnessScript) != 0 {
+		pairs = append(pairs, pair{
+			key:   makeKey(OutputWitnessScript),
+			value: out.WitnessScript,
+		})
+	}
+	pairs = append(pairs, derivationPairs(OutputBIP32Derivation,
+		out.Derivations)...)
+	if version == 2 {
+		pairs = append(pairs, pair{
+			key: makeKey(OutputAmount),
+			value: binary.LittleEndian.AppendUint64(nil,
+				uint64(out.Amount)),
+		}, pair{
+			key:   makeKey(OutputScript),
+			value: out.Script,
+		})
+	}
+
+	if len(out.TapInternalKey) != 0 {
+		pairs = append(pairs, pair{
+			key:   makeKey(OutputTapInternalKey),
+			value: out.TapInternalKey,
+		})
+	}
+	if len(out.TapTree) != 0 {
+		var value []byte
+		for _, leaf := range out.TapTree {
+			value = append(value, leaf.Depth, byte(leaf.LeafVersion))
+			value = append(value, compactSize(uint64(len(leaf.Script)))...)
+			value = append(value, leaf.Script...)
+		}
+		pairs = append(pairs, pair{
+			key:   makeKey(OutputTapTree),
+			value: value,
+		})
+	}
+	pairs = append(pairs, tapDerivationPairs(OutputTapBIP32Derivation,
+		out.TapDerivations)...)
+	return append(pairs, extraPairs(OutputProprietary, out.Proprietary,
+		out.Unknowns)...)
+}
+
+// taprootPairs returns the pairs of the input's taproot fields. Leaf scripts
+// are sorted by script and leaf version, then control block, as Bitcoin Core
+// keeps the control blocks of each script.
+func (in *Input) taprootPairs() []pair {
+	var pairs []pair
+	if len(in.TapKeySig) != 0 {
+		pairs = append(pairs, pair{
+			key:   makeKey(InputTapKeySig),
+			value: in.TapKeySig,
+		})
+	}
+
+	var sigs []pair
+	for _, sig := range in.TapScriptSigs {
+		sigs = append(sigs, pair{
+			key: makeKey(InputTapScriptSig, sig.XOnlyPubKey,
+				sig.LeafHash[:]),
+			value: sig.Signature,
+		})
+	}
+	pairs = append(pairs, sortedPairs(sigs)...)
+
+	leaves := append([]TapLeafScript(nil), in.TapLeafScripts...)
+	sort.SliceStable(leaves, func(i, j int) bool {
+		a, b := leaves[i], leaves[j]
+		if c := bytes.Compare(a.Script, b.Script); c != 0 {
+			return c < 0
+		}
+		if a.LeafVersion != b.LeafVersion {
+			return a.LeafVersion < b.LeafVersion
+		}
+		return bytes.Compare(a.ControlBlock, b.ControlBlock) < 0
+	})
+	for _, leaf := range leaves {
+		pairs = append(pairs, pair{
+			key: makeKey(InputTapLeafScript, leaf.ControlBlock),
+			value: append(append([]byte(nil), leaf.Script...),
+				byte(leaf.LeafVersion)),
+		})
+	}
+
+	pairs = append(pairs, tapDerivationPairs(InputTapBIP32Derivation,
+		in.TapDerivations)...)
+	if len(in.TapInternalKey) != 0 {
+		pairs = append(pairs, pair{
+			key:   makeKey(InputTapInternalKey),
+			value: in.TapInternalKey,
+		})
+	}
+	if len(in.TapMerkleRoot) != 0 {
+		pairs = append(pairs, pair{
+			key:   makeKey(InputTapMerkleRoot),
+			value: in.TapMerkleRoot,
+		})
+	}
+	return pairs
+}
+
+// tapDerivationPairs returns the pairs of taproot BIP 32 derivations, sorted
+// by x-only public key.
+func tapDerivationPairs(typ uint64, derivations []TapDerivation) []pair {
+	var pairs []pair
+	for _, d := range derivations {
+		value := compactSize(uint64(len(d.LeafHashes)))
+		for _, hash := range d.LeafHashes {
+			value = append(value, hash[:]...)
+		}
+		pairs = append(pairs, pair{
+			key:   makeKey(typ, d.XOnlyPubKey),
+			value: append(value, serializeOrigin(d.KeyOrigin)...),
+		})
+	}
+	return sortedPairs(pairs)
+}
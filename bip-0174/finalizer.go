@@ -0,0 +1,182 @@
+package psbt
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// Finalize builds the final scriptSig and scriptWitness of input i from its
+// partial signatures, as the Finalizer does, and clears every field of the
+// input other than its UTXOs, the fields of version 2 inputs, proprietary
+// keys and keys of unknown types.
+// Inputs spending P2PK, P2PKH, P2WPKH and multisig outputs, bare or wrapped
+// in P2SH, P2WSH or both, can be finalized, and so can taproot inputs with a
+// key path signature or with the signatures of a leaf script checking one
+// key, or k of n keys with OP_CHECKSIGADD. An input that has been finalized
+// already is left alone.
+func (p *Packet) Finalize(i int) error {
+	if i < 0 || i >= len(p.Inputs) {
+		return fmt.Errorf("psbt: no input %d", i)
+	}
+	in := &p.Inputs[i]
+	if in.IsFinal() {
+		return nil
+	}
+	if utxo := p.taprootUtxo(i); utxo != nil {
+		finalWitness, err := p.finalizeTaproot(i, utxo)
+		if err != nil {
+			return fmt.Errorf("%w: input %d", err, i)
+		}
+		in.finalize(nil, finalWitness)
+		return nil
+	}
+	script, witness, err := p.inputScript(i)
+	if err != nil {
+		return fmt.Errorf("%w: input %d", err, i)
+	}
+
+	var stack [][]byte
+	if txscript.IsPayToWitnessPubKeyHash(script) {
+		stack, err = in.satisfyPubKeyHash(script[2:])
+	} else {
+		stack, err = in.satisfy(script)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: input %d", err, i)
+	}
+
+	var scriptSig []byte
+	var finalWitness wire.TxWitness
+	switch {
+	case witness && len(in.WitnessScript) != 0:
+		finalWitness = append(stack, in.WitnessScript)
+	case witness:
+		finalWitness = stack
+	case len(in.RedeemScript) != 0:
+		stack = append(stack, in.RedeemScript)
+		fallthrough
+	default:
+		if scriptSig, err = pushAll(stack); err != nil {
+			return fmt.Errorf("%w: input %d", err, i)
+		}
+	}
+	if witness && len(in.RedeemScript) != 0 {
+		scriptSig, err = pushAll([][]byte{in.RedeemScript})
+		if err != nil {
+			return fmt.Errorf("%w: input %d", err, i)
+		}
+	}
+
+	in.finalize(scriptSig, finalWitness)
+	return nil
+}
+
+// finalize sets the final scriptSig and scriptWitness of the input and
+// clears the fields Finalize clears.
+func (in *Input) finalize(scriptSig []byte, witness wire.TxWitness) {
+	*in = Input{
+		NonWitnessUtxo:         in.NonWitnessUtxo,
+		WitnessUtxo:            in.WitnessUtxo,
+		FinalScriptSig:         scriptSig,
+		FinalScriptWitness:     witness,
+		PreviousTxid:           in.PreviousTxid,
+		OutputIndex:            in.OutputIndex,
+		Sequence:               in.Sequence,
+		RequiredTimeLockTime:   in.RequiredTimeLockTime,
+		RequiredHeightLockTime: in.RequiredHeightLockTime,
+		Proprietary:            in.Proprietary,
+		Unknowns:               in.Unknowns,
+	}
+}
+
+// FinalizeAll finalizes every input of the packet.
+func (p *Packet) FinalizeAll() error {
+	for i := range p.Inputs {
+		if err := p.Finalize(i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pushAll returns a script pushing each item of a stack.
+func pushAll(stack [][]byte) ([]byte, error) {
+	builder := txscript.NewScriptBuilder()
+	for _, item := range stack {
+		builder.AddData(item)
+	}
+	return builder.Script()
+}
+
+// satisfy returns the stack of signatures and keys that satisfies a script.
+func (in *Input) satisfy(script []byte) ([][]byte, error) {
+	switch txscript.GetScriptClass(script) {
+	case txscript.PubKeyTy:
+		tokens := txscript.MakeScriptTokenizer(0, script)
+		tokens.Next()
+		sig := in.findPartialSig(tokens.Data())
+		if sig == nil {
+			return nil, ErrIncompleteSignatures
+		}
+		return [][]byte{sig.Signature}, nil
+
+	case txscript.PubKeyHashTy:
+		return in.satisfyPubKeyHash(script[3:23])
+
+	case txscript.MultiSigTy:
+		_, required, err := txscript.CalcMultiSigStats(script)
+		if err != nil {
+			return nil, ErrUnsupportedScript
+		}
+
+		// The extra item is the one CHECKMULTISIG pops by mistake.
+		stack := [][]byte{nil}
+		tokens := txscript.MakeScriptTokenizer(0, script)
+		for tokens.Next() && len(stack) <= required {
+			if sig := in.findPartialSig(tokens.Data()); sig != nil {
+				stack = append(stack, sig.Signature)
+			}
+		}
+		if len(stack) <= required {
+			return nil, ErrIncompleteSignatures
+		}
+		return stack, nil
+	}
+	return nil, ErrUnsupportedScript
+}
+
+// satisfyPubKeyHash returns the signature and key that satisfy a P2PKH or
+// P2WPKH script with the key hash.
+func (in *Input) satisfyPubKeyHash(hash []byte) ([][]byte, error) {
+	for _, sig := range in.PartialSigs {
+		if bytes.Equal(btcutil.Hash160(sig.PubKey), hash) {
+			return [][]byte{sig.Signature, sig.PubKey}, nil
+		}
+	}
+	return nil, ErrIncompleteSignatures
+}
+
+// Extract returns the signed transaction of a packet whose inputs have all
+// been finalized, as the Extractor does.
+func (p *Packet) Extract() (*wire.MsgTx, error) {
+	if err := p.check(); err != nil {
+		return nil, err
+	}
+	tx, err := p.Tx()
+	if err != nil {
+		return nil, err
+	}
+	for i := range p.Inputs {
+		in := &p.Inputs[i]
+		if !in.IsFinal() {
+			return nil, fmt.Errorf("%w: input %d", ErrNotFinal, i)
+		}
+		tx.TxIn[i].SignatureScript = in.FinalScriptSig
+		tx.TxIn[i].Witness = in.FinalScriptWitness
+	}
+	return tx, nil
+}
@@ -0,0 +1,304 @@
+// This program writes test vectors for the psbt package to psbt.json: the
+// valid and invalid packets of the BIP, packets exercising edge cases the
+// BIP's vectors leave out, such as large witness items and proprietary keys,
+// version 2 packets of BIP 370, and valid packets of random transactions. It
+// also writes vectors converting packets between versions 0 and 2 to
+// conversion.json, and vectors signing and finalizing taproot inputs of BIP
+// 371 to taproot.json. The random vectors depend only on -seed and -count, so
+// they can be regenerated by anyone:
+//
+//	gentestvectors -count 20 -seed 174
+//
+// Each vector gives the error Parse rejects the packet with, and the error
+// ParseStrict rejects it with, which differs for valid packets whose keys
+// aren't in canonical order. The file uses the layout of the BIP 158
+// vectors: a JSON array whose first row names the columns, followed by one
+// row per vector. The conversion vectors give the packet to convert, the
+// packet it converts to and the error converting fails with. Pass -check
+// and -check-conversion to verify existing files against the package
+// instead:
+//
+//	gentestvectors -check psbt.json -check-conversion conversion.json
+//
+// The program lives in a directory of its own since the psbt package sits at
+// the root of the module.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	psbt "github.com/christsim/bips/bip-0174"
+	"github.com/christsim/bips/internal/vectorfile"
+)
+
+// vectorColumns is the header row of the vector file.
+const vectorColumns = "PSBT,Error,StrictError,Comment"
+
+// conversionColumns is the header row of the conversion vector file.
+const conversionColumns = "From,To,Error,Comment"
+
+// taprootColumns is the header row of the taproot vector file.
+const taprootColumns = "PSBT,Keys,Signed,Tx,Comment"
+
+type JSONTestWriter struct {
+	writer          io.Writer
+	firstRowWritten bool
+}
+
+func NewJSONTestWriter(writer io.Writer) *JSONTestWriter {
+	return &JSONTestWriter{writer: writer}
+}
+
+func (w *JSONTestWriter) WriteComment(comment string) error {
+	return w.WriteTestCase([]interface{}{comment})
+}
+
+func (w *JSONTestWriter) WriteTestCase(row []interface{}) error {
+	var err error
+	if w.firstRowWritten {
+		_, err = io.WriteString(w.writer, ",\n")
+	} else {
+		_, err = io.WriteString(w.writer, "[\n")
+		w.firstRowWritten = true
+	}
+	if err != nil {
+		return err
+	}
+
+	rowBytes, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.writer.Write(rowBytes)
+	return err
+}
+
+func (w *JSONTestWriter) Close() error {
+	if !w.firstRowWritten {
+		return nil
+	}
+
+	_, err := io.WriteString(w.writer, "\n]\n")
+	return err
+}
+
+func main() {
+	out := flag.String("out", "psbt.json", "file to write the vectors to")
+	conversionOut := flag.String("conversion-out", "conversion.json",
+		"file to write the conversion vectors to")
+	count := flag.Int("count", 20, "number of random vectors to write "+
+		"after the others")
+	seed := flag.Int64("seed", 174, "seed of the random vectors")
+	check := flag.String("check", "", "vector file to check instead of "+
+		"writing the files")
+	checkConversion := flag.String("check-conversion", "", "conversion "+
+		"vector file to check instead of writing the files")
+	taprootOut := flag.String("taproot-out", "taproot.json",
+		"file to write the taproot vectors to")
+	checkTaproot := flag.String("check-taproot", "", "taproot vector "+
+		"file to check instead of writing the files")
+	flag.Parse()
+
+	var err error
+	switch {
+	case *check != "" || *checkConversion != "" || *checkTaproot != "":
+		if *check != "" {
+			err = checkFile(*check)
+		}
+		if err == nil && *checkConversion != "" {
+			err = checkConversionFile(*checkConversion)
+		}
+		if err == nil && *checkTaproot != "" {
+			err = checkTaprootFile(*checkTaproot)
+		}
+	default:
+		err = writeFile(*out, *seed, *count)
+		if err == nil {
+			err = writeConversionFile(*conversionOut, *seed, *count)
+		}
+		if err == nil {
+			err = writeTaprootFile(*taprootOut, *seed, *count)
+		}
+	}
+	if err != nil {
+		fmt.Println("Error: ", err.Error())
+		os.Exit(1)
+	}
+}
+
+// writeFile writes the vectors of the BIP, the edge cases, the version 2
+// packets and count random vectors to out.
+func writeFile(out string, seed int64, count int) error {
+	vectors := append(psbt.SpecVectors(), psbt.EdgeVectors()...)
+	vectors = append(vectors, psbt.V2Vectors()...)
+	vectors = append(vectors, psbt.RandomVectors(seed, count)...)
+
+	file, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := NewJSONTestWriter(file)
+	if err := writer.WriteComment(vectorColumns); err != nil {
+		return err
+	}
+	for _, v := range vectors {
+		err := writer.WriteTestCase([]interface{}{
+			v.PSBT,
+			vectorfile.ErrorString(v.Err),
+			vectorfile.ErrorString(v.StrictErr),
+			v.Comment,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote %d vectors\n", len(vectors))
+	return nil
+}
+
+// writeConversionFile writes the conversion vectors, with count random
+// packets of each version, to out.
+func writeConversionFile(out string, seed int64, count int) error {
+	vectors := psbt.ConversionVectors(seed, count)
+
+	file, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := NewJSONTestWriter(file)
+	if err := writer.WriteComment(conversionColumns); err != nil {
+		return err
+	}
+	for _, v := range vectors {
+		err := writer.WriteTestCase([]interface{}{
+			v.From,
+			v.To,
+			vectorfile.ErrorString(v.Err),
+			v.Comment,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote %d conversion vectors\n", len(vectors))
+	return nil
+}
+
+// writeTaprootFile writes the taproot signing vectors, with count random
+// packets, to out.
+func writeTaprootFile(out string, seed int64, count int) error {
+	vectors, err := psbt.TaprootVectors(seed, count)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := NewJSONTestWriter(file)
+	if err := writer.WriteComment(taprootColumns); err != nil {
+		return err
+	}
+	for _, v := range vectors {
+		err := writer.WriteTestCase([]interface{}{
+			v.PSBT,
+			strings.Join(v.Keys, " "),
+			v.Signed,
+			v.Tx,
+			v.Comment,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote %d taproot vectors\n", len(vectors))
+	return nil
+}
+
+// checkFile checks each vector of the file with psbt.CheckVector.
+func checkFile(path string) error {
+	rows, err := vectorfile.ReadStringRows(path, 4)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		err := psbt.CheckVector(psbt.Vector{
+			PSBT:      row[0],
+			Err:       vectorfile.ParseError(row[1]),
+			StrictErr: vectorfile.ParseError(row[2]),
+		})
+		if err != nil {
+			return fmt.Errorf("%v: %v", row[3], err)
+		}
+	}
+	fmt.Printf("%d vectors OK\n", len(rows))
+	return nil
+}
+
+// checkConversionFile checks each vector of the file with
+// psbt.CheckConversionVector.
+func checkConversionFile(path string) error {
+	rows, err := vectorfile.ReadStringRows(path, 4)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		err := psbt.CheckConversionVector(psbt.ConversionVector{
+			From: row[0],
+			To:   row[1],
+			Err:  vectorfile.ParseError(row[2]),
+		})
+		if err != nil {
+			return fmt.Errorf("%v: %v", row[3], err)
+		}
+	}
+	fmt.Printf("%d conversion vectors OK\n", len(rows))
+	return nil
+}
+
+// checkTaprootFile checks each vector of the file with
+// psbt.CheckSigningVector.
+func checkTaprootFile(path string) error {
+	rows, err := vectorfile.ReadStringRows(path, 5)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		err := psbt.CheckSigningVector(psbt.SigningVector{
+			PSBT:   row[0],
+			Keys:   strings.Fields(row[1]),
+			Signed: row[2],
+			Tx:     row[3],
+		})
+		if err != nil {
+			return fmt.Errorf("%v: %v", row[4], err)
+		}
+	}
+	fmt.Printf("%d taproot vectors OK\n", len(rows))
+	return nil
+}
@@ -0,0 +1,586 @@
+// Package psbt implements the Partially Signed Bitcoin Transactions of BIP 174,
+// which carry an unsigned transaction along with everything needed to sign
+// it between the parties that create, update, sign, combine and finalize it:
+//
+//	packet, err := psbt.New(unsignedTx)
+//	err = packet.Update(&psbt.Update{PrevTxs: prevTxs, Keys: keys})
+//	err = packet.Sign(0, key)
+//	combined, err := psbt.Combine(packet, other)
+//	err = combined.FinalizeAll()
+//	tx, err := combined.Extract()
+//
+// A packet is a global key-value map followed by one map for each input and
+// each output of the transaction. Parse decodes and validates a serialized
+// packet: every key is unique in its map, and the key data and value of
+// every known key type are checked. Keys of unknown types, including
+// proprietary keys, are kept and serialized back. Serialize writes the maps
+// in the order of Bitcoin Core, which ParseStrict requires of the packets it
+// accepts.
+//
+// Version 2 packets, of BIP 370, have no unsigned transaction: its version
+// and lock time are global fields, and the outpoint and sequence of each
+// input and the amount and script of each output are fields of their maps.
+// Inputs and outputs can then be added to a packet after it's created, as
+// the Constructor does, for as long as its TxModifiable flags allow it. Parse
+// reads both versions, and ConvertV0 and ConvertV2 convert between them:
+//
+//	packet := psbt.NewV2(2, 0, psbt.ModifiableInputs|psbt.ModifiableOutputs)
+//	err := packet.AddInput(psbt.Input{PreviousTxid: txid, OutputIndex: 1})
+//	err = packet.AddOutput(psbt.Output{Amount: 1000, Script: script})
+//	v0, err := packet.ConvertV0()
+//
+// Taproot inputs and outputs have the fields of BIP 371: internal keys,
+// merkle roots, leaf scripts with their control blocks, and x-only key
+// derivations. Sign signs taproot inputs along their key path and their leaf
+// scripts, and Finalize builds their witness from a key path signature or
+// from the signatures of a leaf script.
+//
+// The BIP in this repository is an early draft, with redeem scripts in the
+// global map and no output maps. The package implements the BIP as finalized,
+// which is the format wallets exchange, and its vectors are those of the
+// final BIP.
+package psbt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	bip32 "github.com/christsim/bips/bip-0032"
+)
+
+// Global key types. GlobalUnsignedTx is only in version 0 packets, and the
+// types from GlobalTxVersion to GlobalTxModifiable are only in version 2
+// packets.
+const (
+	GlobalUnsignedTx       = 0x00
+	GlobalXPub             = 0x01
+	GlobalTxVersion        = 0x02
+	GlobalFallbackLockTime = 0x03
+	GlobalInputCount       = 0x04
+	GlobalOutputCount      = 0x05
+	GlobalTxModifiable     = 0x06
+	GlobalVersion          = 0xfb
+	GlobalProprietary      = 0xfc
+)
+
+// Input key types. The types from InputPreviousTxid to
+// InputRequiredHeightLockTime are only in version 2 packets, and those from
+// InputTapKeySig to InputTapMerkleRoot are the taproot fields of BIP 371.
+const (
+	InputNonWitnessUtxo         = 0x00
+	InputWitnessUtxo            = 0x01
+	InputPartialSig             = 0x02
+	InputSighashType            = 0x03
+	InputRedeemScript           = 0x04
+	InputWitnessScript          = 0x05
+	InputBIP32Derivation        = 0x06
+	InputFinalScriptSig         = 0x07
+	InputFinalScriptWitness     = 0x08
+	InputRIPEMD160              = 0x0a
+	InputSHA256                 = 0x0b
+	InputHash160                = 0x0c
+	InputHash256                = 0x0d
+	InputPreviousTxid           = 0x0e
+	InputOutputIndex            = 0x0f
+	InputSequence               = 0x10
+	InputRequiredTimeLockTime   = 0x11
+	InputRequiredHeightLockTime = 0x12
+	InputTapKeySig              = 0x13
+	InputTapScriptSig           = 0x14
+	InputTapLeafScript          = 0x15
+	InputTapBIP32Derivation     = 0x16
+	InputTapInternalKey         = 0x17
+	InputTapMerkleRoot          = 0x18
+	InputProprietary            = 0xfc
+)
+
+// Output key types. OutputAmount and OutputScript are only in version 2
+// packets, and the types from OutputTapInternalKey to
+// OutputTapBIP32Derivation are the taproot fields of BIP 371.
+const (
+	OutputRedeemScript       = 0x00
+	OutputWitnessScript      = 0x01
+	OutputBIP32Derivation    = 0x02
+	OutputAmount             = 0x03
+	OutputScript             = 0x04
+	OutputTapInternalKey     = 0x05
+	OutputTapTree            = 0x06
+	OutputTapBIP32Derivation = 0x07
+	OutputProprietary        = 0xfc
+)
+
+// Flags of the TxModifiable field of version 2 packets.
+const (
+	// ModifiableInputs is set while inputs may be added or removed.
+	ModifiableInputs = 1 << 0
+
+	// ModifiableOutputs is set while outputs may be added or removed.
+	ModifiableOutputs = 1 << 1
+
+	// HasSighashSingle is set once an input has a SIGHASH_SINGLE
+	// signature, which ties the input to the output of the same index.
+	HasSighashSingle = 1 << 2
+)
+
+// lockTimeThreshold is the lock time from which lock times are timestamps
+// rather than block heights.
+const lockTimeThreshold = 500000000
+
+var (
+	// ErrInvalidMagic is returned when parsing data that doesn't start
+	// with the magic bytes of a PSBT.
+	ErrInvalidMagic = errors.New("psbt: invalid magic bytes")
+
+	// ErrTruncated is returned when parsing data that ends before the
+	// last map does.
+	ErrTruncated = errors.New("psbt: unexpected end of data")
+
+	// ErrTrailingData is returned when parsing data that goes on after
+	// the map of the last output.
+	ErrTrailingData = errors.New("psbt: data after the last map")
+
+	// ErrInvalidCompactSize is returned when parsing a compact size that
+	// isn't encoded in as few bytes as possible.
+	ErrInvalidCompactSize = errors.New("psbt: non-canonical compact size")
+
+	// ErrDuplicateKey is returned when parsing a map with a key that
+	// appears more than once.
+	ErrDuplicateKey = errors.New("psbt: duplicate key")
+
+	// ErrInvalidKeyData is returned when parsing a key whose data doesn't
+	// fit its type.
+	ErrInvalidKeyData = errors.New("psbt: invalid key data")
+
+	// ErrInvalidValue is returned when parsing a value that doesn't fit
+	// the type of its key.
+	ErrInvalidValue = errors.New("psbt: invalid value")
+
+	// ErrMissingUnsignedTx is returned for a packet without an unsigned
+	// transaction.
+	ErrMissingUnsignedTx = errors.New("psbt: missing unsigned " +
+		"transaction")
+
+	// ErrTxNotUnsigned is returned for an unsigned transaction with
+	// scriptSigs or witnesses.
+	ErrTxNotUnsigned = errors.New("psbt: unsigned transaction has " +
+		"scriptSigs or witnesses")
+
+	// ErrUnsupportedVersion is returned for a packet of a version other
+	// than 0 and 2.
+	ErrUnsupportedVersion = errors.New("psbt: unsupported version")
+
+	// ErrExcludedField is returned when parsing or serializing a packet
+	// with a field its version doesn't allow.
+	ErrExcludedField = errors.New("psbt: field not allowed in the " +
+		"packet's version")
+
+	// ErrMissingField is returned when parsing or serializing a version 2
+	// packet without a field the version requires.
+	ErrMissingField = errors.New("psbt: missing required field")
+
+	// ErrLockTime is returned for a version 2 packet whose inputs require
+	// lock times that no transaction can satisfy together, some a block
+	// height and others a timestamp.
+	ErrLockTime = errors.New("psbt: inputs require conflicting lock " +
+		"times")
+
+	// ErrNotModifiable is returned when adding an input or output to a
+	// packet whose TxModifiable flags don't allow it.
+	ErrNotModifiable = errors.New("psbt: packet isn't modifiable")
+
+	// ErrLossyConversion is returned when converting a version 2 packet
+	// with fields that version 0 can't carry.
+	ErrLossyConversion = errors.New("psbt: conversion would lose fields")
+
+	// ErrMapCount is returned when serializing a packet whose number of
+	// input or output maps doesn't match its transaction.
+	ErrMapCount = errors.New("psbt: number of maps doesn't match the " +
+		"transaction")
+
+	// ErrUtxoMismatch is returned when the transaction of an input's
+	// non-witness UTXO isn't the one the input spends from.
+	ErrUtxoMismatch = errors.New("psbt: UTXO doesn't match the input's " +
+		"outpoint")
+
+	// ErrNonCanonical is returned by ParseStrict for a packet that isn't
+	// serialized as Serialize would, such as one with keys out of order.
+	ErrNonCanonical = errors.New("psbt: keys aren't in canonical order")
+
+	// ErrInvalidBase64 is returned by ParseBase64 for a string that isn't
+	// valid base64.
+	ErrInvalidBase64 = errors.New("psbt: invalid base64")
+
+	// ErrMissingUtxo is returned when signing or finalizing an input
+	// without the UTXO it needs.
+	ErrMissingUtxo = errors.New("psbt: missing UTXO")
+
+	// ErrMissingScript is returned when signing or finalizing an input
+	// that spends a P2SH or P2WSH output without its redeem or witness
+	// script.
+	ErrMissingScript = errors.New("psbt: missing redeem or witness " +
+		"script")
+
+	// ErrScriptMismatch is returned when an input's redeem or witness
+	// script isn't the one the output it spends commits to.
+	ErrScriptMismatch = errors.New("psbt: script doesn't match the " +
+		"output")
+
+	// ErrKeyNotInScript is returned when signing an input with a key its
+	// script doesn't check signatures of.
+	ErrKeyNotInScript = errors.New("psbt: key isn't in the input's " +
+		"script")
+
+	// ErrUnsupportedScript is returned when signing or finalizing an
+	// input whose script is of a type the package doesn't handle.
+	ErrUnsupportedScript = errors.New("psbt: unsupported script")
+
+	// ErrIncompleteSignatures is returned when finalizing an input that
+	// doesn't have the partial signatures its script needs.
+	ErrIncompleteSignatures = errors.New("psbt: missing signatures")
+
+	// ErrNotFinal is returned when extracting the transaction of a packet
+	// with an input that hasn't been finalized.
+	ErrNotFinal = errors.New("psbt: input isn't finalized")
+
+	// ErrCombineMismatch is returned when combining packets of different
+	// transactions.
+	ErrCombineMismatch = errors.New("psbt: packets are of different " +
+		"transactions")
+)
+
+// Packet is a partially signed transaction: an unsigned transaction, along
+// with global fields and the fields of each of its inputs and outputs.
+type Packet struct {
+	// UnsignedTx is the transaction being signed, with empty scriptSigs
+	// and witnesses, in version 0 packets. Version 2 packets have it in
+	// fields of their own, and Tx builds it.
+	UnsignedTx *wire.MsgTx
+
+	// XPubs are extended public keys that the keys of the inputs and
+	// outputs derive from, along with their origins.
+	XPubs []XPub
+
+	// TxVersion, FallbackLockTime and TxModifiable are the global fields
+	// of version 2 packets. FallbackLockTime is the lock time of the
+	// transaction when no input requires one, or 0 if nil, and
+	// TxModifiable holds the Modifiable and HasSighashSingle flags.
+	TxVersion        int32
+	FallbackLockTime *uint32
+	TxModifiable     *uint8
+
+	// Version is the version of the packet, 0 for BIP 174 or 2 for
+	// BIP 370.
+	Version uint32
+
+	Proprietary []Proprietary
+	Unknowns    []Unknown
+
+	// Inputs and Outputs hold the fields of each input and output of the
+	// transaction, in order.
+	Inputs  []Input
+	Outputs []Output
+}
+
+// Input holds the fields of an input.
+type Input struct {
+	// NonWitnessUtxo is the transaction the input spends from, which
+	// inputs spending legacy outputs must have.
+	NonWitnessUtxo *wire.MsgTx
+
+	// WitnessUtxo is the output a segwit input spends, which is enough
+	// to sign it.
+	WitnessUtxo *wire.TxOut
+
+	PartialSigs []PartialSig
+
+	// SighashType is the sighash type signers should use, or nil for
+	// SIGHASH_ALL.
+	SighashType *txscript.SigHashType
+
+	RedeemScript  []byte
+	WitnessScript []byte
+	Derivations   []Derivation
+
+	// FinalScriptSig and FinalScriptWitness are set by the Finalizer
+	// once the input is fully signed.
+	FinalScriptSig     []byte
+	FinalScriptWitness wire.TxWitness
+
+	// Preimages are the preimages of hashes the scripts of the input
+	// check.
+	Preimages []Preimage
+
+	// TapKeySig is the signature of a taproot input's key path, and
+	// TapScriptSigs are signatures of its leaf scripts. Both are 64
+	// bytes, or 65 with a sighash type other than SIGHASH_DEFAULT.
+	TapKeySig     []byte
+	TapScriptSigs []TapScriptSig
+
+	// TapLeafScripts are the leaf scripts the input may be spent with,
+	// each with the control block that proves it's in the output's tree.
+	TapLeafScripts []TapLeafScript
+	TapDerivations []TapDerivation
+
+	// TapInternalKey is the x-only internal key of the taproot output the
+	// input spends, and TapMerkleRoot the root of its script tree, or nil
+	// if it has none.
+	TapInternalKey []byte
+	TapMerkleRoot  []byte
+
+	// PreviousTxid, OutputIndex and Sequence are the outpoint and
+	// sequence of the input in version 2 packets. Sequence is final if
+	// nil.
+	PreviousTxid chainhash.Hash
+	OutputIndex  uint32
+	Sequence     *uint32
+
+	// RequiredTimeLockTime and RequiredHeightLockTime are the smallest
+	// lock times, as a timestamp or a block height, that the input needs
+	// in version 2 packets, if it needs one.
+	RequiredTimeLockTime   *uint32
+	RequiredHeightLockTime *uint32
+
+	Proprietary []Proprietary
+	Unknowns    []Unknown
+}
+
+// Output holds the fields of an output, which let signers check that the
+// output pays where it claims to.
+type Output struct {
+	RedeemScript  []byte
+	WitnessScript []byte
+	Derivations   []Derivation
+
+	// Amount and Script are the output itself in version 2 packets.
+	Amount int64
+	Script []byte
+
+	// TapInternalKey is the x-only internal key of a taproot output, and
+	// TapTree the leaves of its script tree.
+	TapInternalKey []byte
+	TapTree        []TapTreeLeaf
+	TapDerivations []TapDerivation
+
+	Proprietary []Proprietary
+	Unknowns    []Unknown
+}
+
+// KeyOrigin is the fingerprint of the master key a key derives from, and the
+// path it derives along.
+type KeyOrigin struct {
+	Fingerprint [4]byte
+	Path        bip32.Path
+}
+
+// String returns the origin as the fingerprint in hex followed by the path,
+// such as d90c6a4f/0'/0'/1, as output descriptors write it.
+func (o KeyOrigin) String() string {
+	return fmt.Sprintf("%x%s", o.Fingerprint, o.Path.String()[1:])
+}
+
+// ParseKeyOrigin parses an origin written as String writes it.
+func ParseKeyOrigin(s string) (KeyOrigin, error) {
+	var origin KeyOrigin
+	if len(s) < 8 {
+		return origin, fmt.Errorf("psbt: invalid key origin %q", s)
+	}
+	if _, err := fmt.Sscanf(s[:8], "%x", &origin.Fingerprint); err != nil {
+		return origin, fmt.Errorf("psbt: invalid key origin %q", s)
+	}
+	path, err := bip32.ParsePath("m" + s[8:])
+	if err != nil {
+		return origin, fmt.Errorf("psbt: invalid key origin %q", s)
+	}
+	origin.Path = path
+	return origin, nil
+}
+
+// XPub is an extended public key in its 78 byte serialization, and its
+// origin.
+type XPub struct {
+	ExtendedKey []byte
+	KeyOrigin
+}
+
+// Derivation is a public key, compressed or not, and its origin.
+type Derivation struct {
+	PubKey []byte
+	KeyOrigin
+}
+
+// PartialSig is a signature of an input, with the public key it verifies
+// under. The signature ends with its sighash type, as scripts push it.
+type PartialSig struct {
+	PubKey    []byte
+	Signature []byte
+}
+
+// TapScriptSig is a signature of a taproot leaf script, with the x-only
+// public key it verifies under and the hash of the leaf.
+type TapScriptSig struct {
+	XOnlyPubKey []byte
+	LeafHash    chainhash.Hash
+	Signature   []byte
+}
+
+// TapLeafScript is a leaf script of a taproot output, with its leaf version
+// and the control block that proves it's in the output's tree.
+type TapLeafScript struct {
+	ControlBlock []byte
+	Script       []byte
+	LeafVersion  txscript.TapscriptLeafVersion
+}
+
+// TapDerivation is an x-only public key, the hashes of the leaves whose
+// scripts have it, and its origin.
+type TapDerivation struct {
+	XOnlyPubKey []byte
+	LeafHashes  []chainhash.Hash
+	KeyOrigin
+}
+
+// TapTreeLeaf is a leaf of a taproot script tree at its depth in the tree.
+// Outputs list the leaves of their trees in depth-first order.
+type TapTreeLeaf struct {
+	Depth       uint8
+	LeafVersion txscript.TapscriptLeafVersion
+	Script      []byte
+}
+
+// Preimage is the preimage of a hash, of one of the types InputRIPEMD160,
+// InputSHA256, InputHash160 and InputHash256.
+type Preimage struct {
+	Type     uint64
+	Hash     []byte
+	Preimage []byte
+}
+
+// Proprietary is a key-value pair of type 0xfc, which applications use for
+// their own fields: the key carries an identifier of the application, a
+// subtype and key data.
+type Proprietary struct {
+	Identifier []byte
+	Subtype    uint64
+	KeyData    []byte
+	Value      []byte
+}
+
+// Unknown is a key-value pair of a type the package doesn't know, kept so
+// that it's serialized back. Key includes the type.
+type Unknown struct {
+	Key   []byte
+	Value []byte
+}
+
+// New creates a packet for an unsigned transaction, with empty maps for its
+// inputs and outputs, as the Creator does. The transaction is copied.
+func New(tx *wire.MsgTx) (*Packet, error) {
+	if err := checkUnsigned(tx); err != nil {
+		return nil, err
+	}
+	return &Packet{
+		UnsignedTx: tx.Copy(),
+		Inputs:     make([]Input, len(tx.TxIn)),
+		Outputs:    make([]Output, len(tx.TxOut)),
+	}, nil
+}
+
+// checkUnsigned checks that the transaction has no scriptSigs or witnesses.
+func checkUnsigned(tx *wire.MsgTx) error {
+	for _, in := range tx.TxIn {
+		if len(in.SignatureScript) != 0 || len(in.Witness) != 0 {
+			return ErrTxNotUnsigned
+		}
+	}
+	return nil
+}
+
+// IsFinal reports whether the input has been finalized.
+func (in *Input) IsFinal() bool {
+	return len(in.FinalScriptSig) != 0 || len(in.FinalScriptWitness) != 0
+}
+
+// IsComplete reports whether every input of the packet has been finalized,
+// so that the transaction can be extracted.
+func (p *Packet) IsComplete() bool {
+	for i := range p.Inputs {
+		if !p.Inputs[i].IsFinal() {
+			return false
+		}
+	}
+	return true
+}
+
+// outPoint returns the outpoint input i spends.
+func (p *Packet) outPoint(i int) wire.OutPoint {
+	if p.Version == 0 {
+		return p.UnsignedTx.TxIn[i].PreviousOutPoint
+	}
+	return wire.OutPoint{
+		Hash:  p.Inputs[i].PreviousTxid,
+		Index: p.Inputs[i].OutputIndex,
+	}
+}
+
+// txOut returns output i of the transaction.
+func (p *Packet) txOut(i int) *wire.TxOut {
+	if p.Version == 0 {
+		return p.UnsignedTx.TxOut[i]
+	}
+	return wire.NewTxOut(p.Outputs[i].Amount, p.Outputs[i].Script)
+}
+
+// checkNonWitnessUtxo checks that the input's non-witness UTXO is the
+// transaction the input spends from.
+func (p *Packet) checkNonWitnessUtxo(i int) error {
+	utxo := p.Inputs[i].NonWitnessUtxo
+	if utxo == nil {
+		return nil
+	}
+	prevOut := p.outPoint(i)
+	if utxo.TxHash() != prevOut.Hash ||
+		prevOut.Index >= uint32(len(utxo.TxOut)) {
+
+		return fmt.Errorf("%w: non-witness UTXO of input %d",
+			ErrUtxoMismatch, i)
+	}
+	return nil
+}
+
+// prevOut returns the output input i spends, from its non-witness UTXO if it
+// has one and from its witness UTXO otherwise, or nil if it has neither.
+func (p *Packet) prevOut(i int) (*wire.TxOut, error) {
+	in := &p.Inputs[i]
+	if in.NonWitnessUtxo != nil {
+		if err := p.checkNonWitnessUtxo(i); err != nil {
+			return nil, err
+		}
+		index := p.outPoint(i).Index
+		return in.NonWitnessUtxo.TxOut[index], nil
+	}
+	return in.WitnessUtxo, nil
+}
+
+// findDerivation returns the derivation of the public key, or nil.
+func findDerivation(derivations []Derivation, pubKey []byte) *Derivation {
+	for i := range derivations {
+		if bytes.Equal(derivations[i].PubKey, pubKey) {
+			return &derivations[i]
+		}
+	}
+	return nil
+}
+
+// findPartialSig returns the partial signature under the public key, or nil.
+func (in *Input) findPartialSig(pubKey []byte) *PartialSig {
+	for i := range in.PartialSigs {
+		if bytes.Equal(in.PartialSigs[i].PubKey, pubKey) {
+			return &in.PartialSigs[i]
+		}
+	}
+	return nil
+}
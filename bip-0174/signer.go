@@ -0,0 +1,153 @@
+package psbt
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// inputScript returns the script whose signatures input i checks, and
+// whether it's checked as a segwit v0 script. It checks that the input has
+// the UTXO and the redeem and witness scripts that the script takes.
+func (p *Packet) inputScript(i int) ([]byte, bool, error) {
+	in := &p.Inputs[i]
+	utxo, err := p.prevOut(i)
+	if err != nil {
+		return nil, false, err
+	}
+	if utxo == nil {
+		return nil, false, ErrMissingUtxo
+	}
+
+	script := utxo.PkScript
+	if txscript.IsPayToScriptHash(script) {
+		if err := matchScript(script, in.RedeemScript); err != nil {
+			return nil, false, err
+		}
+		script = in.RedeemScript
+	}
+
+	switch {
+	case txscript.IsPayToWitnessScriptHash(script):
+		if err := matchScript(script, in.WitnessScript); err != nil {
+			return nil, false, err
+		}
+		return in.WitnessScript, true, nil
+
+	case txscript.IsPayToWitnessPubKeyHash(script):
+		return script, true, nil
+
+	case txscript.IsWitnessProgram(script):
+		return nil, false, ErrUnsupportedScript
+	}
+
+	return script, false, nil
+}
+
+// prevOutFetcher returns the outputs the inputs spend, as far as the packet
+// has them. Outputs it doesn't have are empty.
+func (p *Packet) prevOutFetcher() *txscript.MultiPrevOutFetcher {
+	fetcher := txscript.NewMultiPrevOutFetcher(nil)
+	for i := range p.Inputs {
+		utxo, err := p.prevOut(i)
+		if err != nil || utxo == nil {
+			utxo = &wire.TxOut{}
+		}
+		fetcher.AddPrevOut(p.outPoint(i), utxo)
+	}
+	return fetcher
+}
+
+// Sign signs input i with the key and adds the signature to its partial
+// signatures, as the Signer does. The input's sighash type is used, or
+// SIGHASH_ALL if it has none. The public key is serialized compressed or not
+// as the input's script has it, and an input that already has a signature
+// under the key or has been finalized is left alone. Signing a version 2
+// packet clears the TxModifiable flags that the signature commits to.
+//
+// Taproot inputs are signed with Schnorr signatures, and SIGHASH_DEFAULT if
+// they have no sighash type: along the key path if the key is their internal
+// key, giving TapKeySig, and for each leaf script that has the key, giving
+// TapScriptSigs. Their sighashes commit to the outputs every input spends,
+// so every input must have its UTXO.
+func (p *Packet) Sign(i int, key *btcec.PrivateKey) error {
+	if i < 0 || i >= len(p.Inputs) {
+		return fmt.Errorf("psbt: no input %d", i)
+	}
+	in := &p.Inputs[i]
+	if in.IsFinal() {
+		return nil
+	}
+	if utxo := p.taprootUtxo(i); utxo != nil {
+		return p.signTaproot(i, key, utxo)
+	}
+	script, witness, err := p.inputScript(i)
+	if err != nil {
+		return fmt.Errorf("%w: input %d", err, i)
+	}
+
+	// Legacy sighashes don't commit to the amount, so signers need the
+	// whole transaction to know what they sign.
+	if !witness && in.NonWitnessUtxo == nil {
+		return fmt.Errorf("%w: input %d", ErrMissingUtxo, i)
+	}
+
+	pubKey := key.PubKey().SerializeCompressed()
+	if !hasKey(pubKey, script) {
+		pubKey = key.PubKey().SerializeUncompressed()
+		if !hasKey(pubKey, script) {
+			return fmt.Errorf("%w: input %d", ErrKeyNotInScript, i)
+		}
+	}
+	if in.findPartialSig(pubKey) != nil {
+		return nil
+	}
+
+	sighashType := txscript.SigHashAll
+	if in.SighashType != nil {
+		sighashType = *in.SighashType
+	}
+
+	tx, err := p.Tx()
+	if err != nil {
+		return err
+	}
+	var sig []byte
+	if witness {
+		fetcher := p.prevOutFetcher()
+		hashes := txscript.NewTxSigHashes(tx, fetcher)
+		utxo := fetcher.FetchPrevOutput(p.outPoint(i))
+		sig, err = txscript.RawTxInWitnessSignature(tx, hashes, i,
+			utxo.Value, script, sighashType, key)
+	} else {
+		sig, err = txscript.RawTxInSignature(tx, i, script, sighashType,
+			key)
+	}
+	if err != nil {
+		return err
+	}
+
+	in.PartialSigs = append(in.PartialSigs, PartialSig{
+		PubKey:    pubKey,
+		Signature: sig,
+	})
+	p.signed(sighashType)
+	return nil
+}
+
+// SignAll signs every input it can with each of the keys. Inputs whose
+// scripts don't have a key are skipped for that key.
+func (p *Packet) SignAll(keys ...*btcec.PrivateKey) error {
+	for i := range p.Inputs {
+		for _, key := range keys {
+			err := p.Sign(i, key)
+			if err != nil && !errors.Is(err, ErrKeyNotInScript) {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,369 @@
+package psbt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// ErrInvalidTapTree is returned by TapTreeRoot for leaves that don't make up
+// a whole tree.
+var ErrInvalidTapTree = errors.New("psbt: invalid taproot tree")
+
+// maxTapTreeDepth is the largest depth of a leaf of a taproot tree, as a
+// control block has at most 128 hashes.
+const maxTapTreeDepth = 128
+
+// TapTreeRoot returns the merkle root of the taproot tree whose leaves are
+// listed in depth-first order, as outputs list them. The leaves must make up
+// a whole tree: every branch has two children, and no leaf is deeper than
+// 128 or has a leaf version with its lowest bit set.
+func TapTreeRoot(leaves []TapTreeLeaf) (chainhash.Hash, error) {
+	type node struct {
+		depth int
+		hash  chainhash.Hash
+	}
+
+	// Each leaf is merged with the nodes at its depth that precede it,
+	// which are its siblings, until the stack holds the root alone.
+	var stack []node
+	for _, leaf := range leaves {
+		if leaf.Depth > maxTapTreeDepth ||
+			leaf.LeafVersion&^txscript.TaprootLeafMask != 0 {
+
+			return chainhash.Hash{}, ErrInvalidTapTree
+		}
+		n := node{
+			depth: int(leaf.Depth),
+			hash: txscript.NewTapLeaf(leaf.LeafVersion,
+				leaf.Script).TapHash(),
+		}
+		for len(stack) != 0 && stack[len(stack)-1].depth == n.depth {
+			if n.depth == 0 {
+				return chainhash.Hash{}, ErrInvalidTapTree
+			}
+			n.hash = tapBranch(stack[len(stack)-1].hash, n.hash)
+			n.depth--
+			stack = stack[:len(stack)-1]
+		}
+		stack = append(stack, n)
+	}
+	if len(stack) != 1 || stack[0].depth != 0 {
+		return chainhash.Hash{}, ErrInvalidTapTree
+	}
+	return stack[0].hash, nil
+}
+
+// tapBranch returns the hash of a branch of a taproot tree, whose children
+// are hashed in sorted order.
+func tapBranch(a, b chainhash.Hash) chainhash.Hash {
+	if bytes.Compare(a[:], b[:]) > 0 {
+		a, b = b, a
+	}
+	return *chainhash.TaggedHash(chainhash.TagTapBranch, a[:], b[:])
+}
+
+// xOnly returns the x-only serialization of a public key, or nil for keys
+// that aren't compressed, which taproot scripts don't have.
+func xOnly(pubKey []byte) []byte {
+	if len(pubKey) != btcec.PubKeyBytesLenCompressed {
+		return nil
+	}
+	return pubKey[1:]
+}
+
+// taprootUtxo returns the output input i spends if it's a taproot output,
+// or nil.
+func (p *Packet) taprootUtxo(i int) *wire.TxOut {
+	utxo, err := p.prevOut(i)
+	if err != nil || utxo == nil {
+		return nil
+	}
+	if !txscript.IsPayToTaproot(utxo.PkScript) {
+		return nil
+	}
+	return utxo
+}
+
+// checkLeaf checks that the control block of a leaf script proves that it's
+// in the tree of the taproot output.
+func checkLeaf(leaf *TapLeafScript, pkScript []byte) error {
+	controlBlock, err := txscript.ParseControlBlock(leaf.ControlBlock)
+	if err != nil || controlBlock.LeafVersion != leaf.LeafVersion {
+		return ErrScriptMismatch
+	}
+	err = txscript.VerifyTaprootLeafCommitment(controlBlock, pkScript[2:],
+		leaf.Script)
+	if err != nil {
+		return ErrScriptMismatch
+	}
+	return nil
+}
+
+// findTapScriptSig returns the signature of the leaf under the x-only public
+// key, or nil.
+func (in *Input) findTapScriptSig(pubKey []byte,
+	leafHash chainhash.Hash) *TapScriptSig {
+
+	for i := range in.TapScriptSigs {
+		sig := &in.TapScriptSigs[i]
+		if sig.LeafHash == leafHash &&
+			bytes.Equal(sig.XOnlyPubKey, pubKey) {
+
+			return sig
+		}
+	}
+	return nil
+}
+
+// signTaproot signs taproot input i with the key, as Sign does: along the
+// key path if the key is the input's internal key, and for each of its leaf
+// scripts of the base leaf version that has the key.
+func (p *Packet) signTaproot(i int, key *btcec.PrivateKey,
+	utxo *wire.TxOut) error {
+
+	in := &p.Inputs[i]
+	sighashType := txscript.SigHashDefault
+	if in.SighashType != nil {
+		sighashType = *in.SighashType
+	}
+
+	// Taproot sighashes commit to the outputs every input spends, unless
+	// they only sign their own input.
+	if sighashType&txscript.SigHashAnyOneCanPay == 0 {
+		for j := range p.Inputs {
+			if utxo, err := p.prevOut(j); err != nil || utxo == nil {
+				return fmt.Errorf("%w: input %d", ErrMissingUtxo, j)
+			}
+		}
+	}
+
+	tx, err := p.Tx()
+	if err != nil {
+		return err
+	}
+	hashes := txscript.NewTxSigHashes(tx, p.prevOutFetcher())
+	pubKey := schnorr.SerializePubKey(key.PubKey())
+
+	signed := false
+	if bytes.Equal(pubKey, in.TapInternalKey) {
+		outputKey := txscript.ComputeTaprootOutputKey(key.PubKey(),
+			in.TapMerkleRoot)
+		if !bytes.Equal(schnorr.SerializePubKey(outputKey),
+			utxo.PkScript[2:]) {
+
+			return fmt.Errorf("%w: input %d", ErrScriptMismatch, i)
+		}
+		if in.TapKeySig == nil {
+			in.TapKeySig, err = txscript.RawTxInTaprootSignature(tx,
+				hashes, i, utxo.Value, utxo.PkScript, in.TapMerkleRoot,
+				sighashType, key)
+			if err != nil {
+				return err
+			}
+		}
+		signed = true
+	}
+
+	for j := range in.TapLeafScripts {
+		leaf := &in.TapLeafScripts[j]
+		if leaf.LeafVersion != txscript.BaseLeafVersion ||
+			!hasKey(pubKey, leaf.Script) {
+
+			continue
+		}
+		if err := checkLeaf(leaf, utxo.PkScript); err != nil {
+			return fmt.Errorf("%w: input %d", err, i)
+		}
+		signed = true
+
+		tapLeaf := txscript.NewBaseTapLeaf(leaf.Script)
+		leafHash := tapLeaf.TapHash()
+		if in.findTapScriptSig(pubKey, leafHash) != nil {
+			continue
+		}
+		sig, err := txscript.RawTxInTapscriptSignature(tx, hashes, i,
+			utxo.Value, utxo.PkScript, tapLeaf, sighashType, key)
+		if err != nil {
+			return err
+		}
+		in.TapScriptSigs = append(in.TapScriptSigs, TapScriptSig{
+			XOnlyPubKey: pubKey,
+			LeafHash:    leafHash,
+			Signature:   sig,
+		})
+	}
+
+	if !signed {
+		return fmt.Errorf("%w: input %d", ErrKeyNotInScript, i)
+	}
+	p.signed(sighashType)
+	return nil
+}
+
+// finalizeTaproot returns the final scriptWitness of taproot input i: its
+// key path signature if it has one, or else the smallest witness of the leaf
+// scripts it has the signatures of.
+func (p *Packet) finalizeTaproot(i int, utxo *wire.TxOut) (wire.TxWitness,
+	error) {
+
+	in := &p.Inputs[i]
+	if len(in.TapKeySig) != 0 {
+		return wire.TxWitness{in.TapKeySig}, nil
+	}
+
+	var witness wire.TxWitness
+	supported := false
+	for j := range in.TapLeafScripts {
+		leaf := &in.TapLeafScripts[j]
+		if leaf.LeafVersion != txscript.BaseLeafVersion {
+			continue
+		}
+		if err := checkLeaf(leaf, utxo.PkScript); err != nil {
+			return nil, err
+		}
+		stack, err := in.satisfyTapscript(leaf.Script)
+		if !errors.Is(err, ErrUnsupportedScript) {
+			supported = true
+		}
+		if err != nil {
+			continue
+		}
+		stack = append(stack, leaf.Script, leaf.ControlBlock)
+		if witness == nil ||
+			stack.SerializeSize() < witness.SerializeSize() {
+
+			witness = stack
+		}
+	}
+
+	switch {
+	case witness != nil:
+		return witness, nil
+	case !supported && len(in.TapLeafScripts) != 0:
+		return nil, ErrUnsupportedScript
+	}
+	return nil, ErrIncompleteSignatures
+}
+
+// satisfyTapscript returns the stack of signatures that satisfies a leaf
+// script checking one key with OP_CHECKSIG, or k of n keys with
+// OP_CHECKSIGADD.
+func (in *Input) satisfyTapscript(script []byte) (wire.TxWitness, error) {
+	keys, required, ok := tapscriptKeys(script)
+	if !ok {
+		return nil, ErrUnsupportedScript
+	}
+	leafHash := txscript.NewBaseTapLeaf(script).TapHash()
+
+	// The signature of the first key is checked first, so it goes on top
+	// of the stack, and keys that don't sign take an empty signature.
+	stack := make(wire.TxWitness, len(keys))
+	found := 0
+	for j, key := range keys {
+		item := []byte{}
+		if found < required {
+			if sig := in.findTapScriptSig(key, leafHash); sig != nil {
+				item = sig.Signature
+				found++
+			}
+		}
+		stack[len(keys)-1-j] = item
+	}
+	if found < required {
+		return nil, ErrIncompleteSignatures
+	}
+	return stack, nil
+}
+
+// tapscriptKeys returns the keys of a leaf script of the form
+// <key> OP_CHECKSIG, or <key> OP_CHECKSIG <key> OP_CHECKSIGADD ...
+// <k> OP_NUMEQUAL, and the number of them that must sign.
+func tapscriptKeys(script []byte) ([][]byte, int, bool) {
+	tokens := txscript.MakeScriptTokenizer(0, script)
+	var keys [][]byte
+	for tokens.Next() && tokens.Opcode() == txscript.OP_DATA_32 {
+		keys = append(keys, tokens.Data())
+		op := byte(txscript.OP_CHECKSIGADD)
+		if len(keys) == 1 {
+			op = txscript.OP_CHECKSIG
+		}
+		if !tokens.Next() || tokens.Opcode() != op {
+			return nil, 0, false
+		}
+	}
+	if tokens.Err() != nil || len(keys) == 0 {
+		return nil, 0, false
+	}
+	if tokens.Done() {
+		return keys, 1, len(keys) == 1
+	}
+
+	var required int
+	switch op := tokens.Opcode(); {
+	case op >= txscript.OP_1 && op <= txscript.OP_16:
+		required = txscript.AsSmallInt(op)
+	case op == txscript.OP_DATA_1 || op == txscript.OP_DATA_2:
+		data := tokens.Data()
+		if data[len(data)-1]&0x80 != 0 {
+			return nil, 0, false
+		}
+		for j := len(data) - 1; j >= 0; j-- {
+			required = required<<8 | int(data[j])
+		}
+	default:
+		return nil, 0, false
+	}
+	if !tokens.Next() || tokens.Opcode() != txscript.OP_NUMEQUAL ||
+		tokens.Next() || tokens.Err() != nil {
+
+		return nil, 0, false
+	}
+	if required < 1 || required > len(keys) {
+		return nil, 0, false
+	}
+	return keys, required, true
+}
+
+// addTapDerivations appends the taproot derivations of the compressed keys
+// that are the internal key or in one of the leaf scripts, and aren't among
+// the derivations yet.
+func addTapDerivations(derivations []TapDerivation, keys []Derivation,
+	internalKey []byte, leaves []txscript.TapLeaf) []TapDerivation {
+
+	for _, key := range keys {
+		pubKey := xOnly(key.PubKey)
+		if pubKey == nil {
+			continue
+		}
+		found := false
+		for _, d := range derivations {
+			found = found || bytes.Equal(d.XOnlyPubKey, pubKey)
+		}
+		if found {
+			continue
+		}
+
+		var hashes []chainhash.Hash
+		for _, leaf := range leaves {
+			if hasKey(pubKey, leaf.Script) {
+				hashes = append(hashes, leaf.TapHash())
+			}
+		}
+		if hashes == nil && !bytes.Equal(pubKey, internalKey) {
+			continue
+		}
+		derivations = append(derivations, TapDerivation{
+			XOnlyPubKey: pubKey,
+			LeafHashes:  hashes,
+			KeyOrigin:   key.KeyOrigin,
+		})
+	}
+	return derivations
+}
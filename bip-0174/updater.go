@@ -0,0 +1,217 @@
+package psbt
+
+import (
+	"bytes"
+	"crypto/sha256"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// Update is what an Updater knows about the transaction of a packet. Each
+// field is added to the inputs and outputs it applies to.
+type Update struct {
+	// PrevTxs are transactions the inputs may spend from. An input that
+	// spends a segwit output gets the output as its witness UTXO, and
+	// any other input the whole transaction as its non-witness UTXO.
+	PrevTxs []*wire.MsgTx
+
+	// Utxos are outputs the inputs may spend, by outpoint, which become
+	// witness UTXOs. They are for segwit outputs whose transactions
+	// aren't at hand.
+	Utxos map[wire.OutPoint]*wire.TxOut
+
+	// Scripts are redeem and witness scripts, matched against the P2SH
+	// and P2WSH outputs the inputs spend and the outputs pay to.
+	Scripts [][]byte
+
+	// Keys are the BIP 32 derivations of public keys, added to the
+	// inputs and outputs whose scripts have the keys or their hashes.
+	// Compressed keys are added to taproot inputs and outputs as x-only
+	// keys if they are the internal key or in one of the leaf scripts,
+	// which inputs have in TapLeafScripts and outputs in TapTree.
+	Keys []Derivation
+
+	// SighashType, if set, is the sighash type of every input.
+	SighashType *txscript.SigHashType
+}
+
+// Update adds what the update knows to the inputs and outputs of the packet,
+// as the Updater does. Fields the packet already has are left alone, as are
+// finalized inputs.
+func (p *Packet) Update(u *Update) error {
+	for i := range p.Inputs {
+		in := &p.Inputs[i]
+		if in.IsFinal() {
+			continue
+		}
+		prevOut := p.outPoint(i)
+
+		var prevTx *wire.MsgTx
+		for _, tx := range u.PrevTxs {
+			if tx.TxHash() == prevOut.Hash &&
+				prevOut.Index < uint32(len(tx.TxOut)) {
+
+				prevTx = tx
+				break
+			}
+		}
+
+		utxo, err := p.prevOut(i)
+		if err != nil {
+			return err
+		}
+		if utxo == nil && u.Utxos[prevOut] != nil {
+			utxo = u.Utxos[prevOut]
+		}
+		if utxo == nil && prevTx != nil {
+			utxo = prevTx.TxOut[prevOut.Index]
+		}
+		if utxo == nil {
+			continue
+		}
+
+		script := utxo.PkScript
+		if txscript.IsPayToScriptHash(script) {
+			if in.RedeemScript == nil {
+				in.RedeemScript = findScript(u.Scripts, script)
+			}
+			script = in.RedeemScript
+		}
+		if txscript.IsPayToWitnessScriptHash(script) &&
+			in.WitnessScript == nil {
+
+			in.WitnessScript = findScript(u.Scripts, script)
+		}
+
+		if in.NonWitnessUtxo == nil && in.WitnessUtxo == nil {
+			switch {
+			case u.Utxos[prevOut] != nil:
+				in.WitnessUtxo = u.Utxos[prevOut]
+			case prevTx != nil && txscript.IsWitnessProgram(script):
+				in.WitnessUtxo = prevTx.TxOut[prevOut.Index]
+			case prevTx != nil:
+				in.NonWitnessUtxo = prevTx
+			}
+		}
+
+		if u.SighashType != nil && in.SighashType == nil {
+			sighashType := *u.SighashType
+			in.SighashType = &sighashType
+		}
+
+		if txscript.IsPayToTaproot(utxo.PkScript) {
+			var leaves []txscript.TapLeaf
+			for _, leaf := range in.TapLeafScripts {
+				leaves = append(leaves, txscript.NewTapLeaf(
+					leaf.LeafVersion, leaf.Script))
+			}
+			in.TapDerivations = addTapDerivations(in.TapDerivations,
+				u.Keys, in.TapInternalKey, leaves)
+			continue
+		}
+		in.Derivations = addDerivations(in.Derivations, u.Keys,
+			utxo.PkScript, in.RedeemScript, in.WitnessScript)
+	}
+
+	for i := range p.Outputs {
+		out := &p.Outputs[i]
+		pkScript := p.txOut(i).PkScript
+		if txscript.IsPayToTaproot(pkScript) {
+			var leaves []txscript.TapLeaf
+			for _, leaf := range out.TapTree {
+				leaves = append(leaves, txscript.NewTapLeaf(
+					leaf.LeafVersion, leaf.Script))
+			}
+			out.TapDerivations = addTapDerivations(out.TapDerivations,
+				u.Keys, out.TapInternalKey, leaves)
+			continue
+		}
+		script := pkScript
+		if txscript.IsPayToScriptHash(script) {
+			if out.RedeemScript == nil {
+				out.RedeemScript = findScript(u.Scripts, script)
+			}
+			script = out.RedeemScript
+		}
+		if txscript.IsPayToWitnessScriptHash(script) &&
+			out.WitnessScript == nil {
+
+			out.WitnessScript = findScript(u.Scripts, script)
+		}
+
+		out.Derivations = addDerivations(out.Derivations, u.Keys,
+			pkScript, out.RedeemScript, out.WitnessScript)
+	}
+	return nil
+}
+
+// findScript returns the script a P2SH or P2WSH output script commits to, or
+// nil if it isn't one of the scripts.
+func findScript(scripts [][]byte, pkScript []byte) []byte {
+	for _, script := range scripts {
+		var hash []byte
+		if txscript.IsPayToScriptHash(pkScript) {
+			hash = btcutil.Hash160(script)
+		} else {
+			sum := sha256.Sum256(script)
+			hash = sum[:]
+		}
+		if bytes.Equal(scriptHash(pkScript), hash) {
+			return script
+		}
+	}
+	return nil
+}
+
+// scriptHash returns the hash a P2SH or P2WSH output script commits to.
+func scriptHash(pkScript []byte) []byte {
+	if txscript.IsPayToScriptHash(pkScript) {
+		return pkScript[2:22]
+	}
+	return pkScript[2:]
+}
+
+// matchScript checks that a redeem or witness script is the one a P2SH or
+// P2WSH output script commits to.
+func matchScript(pkScript, script []byte) error {
+	if script == nil {
+		return ErrMissingScript
+	}
+	if findScript([][]byte{script}, pkScript) == nil {
+		return ErrScriptMismatch
+	}
+	return nil
+}
+
+// hasKey reports whether one of the scripts pushes the public key or its
+// hash.
+func hasKey(pubKey []byte, scripts ...[]byte) bool {
+	hash := btcutil.Hash160(pubKey)
+	for _, script := range scripts {
+		tokens := txscript.MakeScriptTokenizer(0, script)
+		for tokens.Next() {
+			data := tokens.Data()
+			if bytes.Equal(data, pubKey) || bytes.Equal(data, hash) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// addDerivations appends the derivations of the keys in the scripts that
+// aren't among the derivations yet.
+func addDerivations(derivations, keys []Derivation,
+	scripts ...[]byte) []Derivation {
+
+	for _, key := range keys {
+		if findDerivation(derivations, key.PubKey) == nil &&
+			hasKey(key.PubKey, scripts...) {
+
+			derivations = append(derivations, key)
+		}
+	}
+	return derivations
+}
@@ -0,0 +1,310 @@
+package psbt
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// ErrTxVersion is returned by ConvertV2 for a transaction of a version below
+// 2, which version 2 packets can't carry.
+var ErrTxVersion = errors.New("psbt: version 2 packets need transactions " +
+	"of version 2 or more")
+
+// NewV2 creates a version 2 packet without inputs or outputs, as the Creator
+// does, for the Constructor to add them with AddInput and AddOutput. The
+// modifiable flags are those of TxModifiable.
+func NewV2(txVersion int32, fallbackLockTime uint32, modifiable uint8) *Packet {
+	return &Packet{
+		TxVersion:        txVersion,
+		FallbackLockTime: &fallbackLockTime,
+		TxModifiable:     &modifiable,
+		Version:          2,
+	}
+}
+
+// modifiable returns the TxModifiable flags of the packet, which are all
+// clear in version 0 packets.
+func (p *Packet) modifiable() uint8 {
+	if p.Version != 2 || p.TxModifiable == nil {
+		return 0
+	}
+	return *p.TxModifiable
+}
+
+// LockTime returns the lock time of the packet's transaction. In version 2
+// packets, it's the largest block height the inputs require if every input
+// that requires a lock time can take a height, or else the largest timestamp
+// they require if every one can take a timestamp. Without requirements, it's
+// the fallback lock time.
+func (p *Packet) LockTime() (uint32, error) {
+	if p.Version == 0 {
+		return p.UnsignedTx.LockTime, nil
+	}
+
+	required, byHeight, byTime := false, true, true
+	var height, time uint32
+	for i := range p.Inputs {
+		in := &p.Inputs[i]
+		if in.RequiredHeightLockTime == nil &&
+			in.RequiredTimeLockTime == nil {
+
+			continue
+		}
+		required = true
+		if in.RequiredHeightLockTime == nil {
+			byHeight = false
+		} else if *in.RequiredHeightLockTime > height {
+			height = *in.RequiredHeightLockTime
+		}
+		if in.RequiredTimeLockTime == nil {
+			byTime = false
+		} else if *in.RequiredTimeLockTime > time {
+			time = *in.RequiredTimeLockTime
+		}
+	}
+
+	switch {
+	case !required && p.FallbackLockTime != nil:
+		return *p.FallbackLockTime, nil
+	case !required:
+		return 0, nil
+	case byHeight:
+		return height, nil
+	case byTime:
+		return time, nil
+	}
+	return 0, ErrLockTime
+}
+
+// Tx returns the unsigned transaction of the packet. For version 2 packets,
+// it's built from their fields, which fails if the inputs require
+// conflicting lock times.
+func (p *Packet) Tx() (*wire.MsgTx, error) {
+	if p.Version == 0 {
+		return p.UnsignedTx.Copy(), nil
+	}
+	lockTime, err := p.LockTime()
+	if err != nil {
+		return nil, err
+	}
+
+	tx := wire.NewMsgTx(p.TxVersion)
+	tx.LockTime = lockTime
+	for i := range p.Inputs {
+		prevOut := p.outPoint(i)
+		txIn := wire.NewTxIn(&prevOut, nil, nil)
+		if p.Inputs[i].Sequence != nil {
+			txIn.Sequence = *p.Inputs[i].Sequence
+		}
+		tx.AddTxIn(txIn)
+	}
+	for i := range p.Outputs {
+		tx.AddTxOut(p.txOut(i))
+	}
+	return tx, nil
+}
+
+// ID returns the identifier of the packet, the txid of its transaction. For
+// version 2 packets the sequences are taken as 0, since Updaters may change
+// them.
+func (p *Packet) ID() (chainhash.Hash, error) {
+	tx, err := p.Tx()
+	if err != nil {
+		return chainhash.Hash{}, err
+	}
+	if p.Version == 2 {
+		for _, txIn := range tx.TxIn {
+			txIn.Sequence = 0
+		}
+	}
+	return tx.TxHash(), nil
+}
+
+// checkModifiable checks that the Constructor may add to the packet given
+// the flag of what is added.
+func (p *Packet) checkModifiable(flag uint8) error {
+	flags := p.modifiable()
+	if flags&flag == 0 {
+		return ErrNotModifiable
+	}
+
+	// Once an input signs with SIGHASH_SINGLE, inputs and outputs have
+	// to be added in pairs to keep it tied to its output, which AddInput
+	// and AddOutput don't do.
+	if flags&HasSighashSingle != 0 {
+		return ErrNotModifiable
+	}
+	return nil
+}
+
+// AddInput adds an input to a version 2 packet, as the Constructor does. The
+// packet must allow inputs to be modified, and the input must not spend the
+// outpoint of another input nor change the lock time of a transaction that
+// has signatures already.
+func (p *Packet) AddInput(in Input) error {
+	if err := p.checkModifiable(ModifiableInputs); err != nil {
+		return err
+	}
+	prevOut := wire.OutPoint{Hash: in.PreviousTxid, Index: in.OutputIndex}
+	for i := range p.Inputs {
+		if p.outPoint(i) == prevOut {
+			return fmt.Errorf("psbt: outpoint %v is spent by input %d",
+				prevOut, i)
+		}
+	}
+
+	lockTime, err := p.LockTime()
+	if err != nil {
+		return err
+	}
+	p.Inputs = append(p.Inputs, in)
+	newLockTime, err := p.LockTime()
+	if err == nil && newLockTime != lockTime && p.hasSignatures() {
+		err = ErrNotModifiable
+	}
+	if err != nil {
+		p.Inputs = p.Inputs[:len(p.Inputs)-1]
+		return err
+	}
+	return nil
+}
+
+// AddOutput adds an output to a version 2 packet, as the Constructor does.
+// The packet must allow outputs to be modified.
+func (p *Packet) AddOutput(out Output) error {
+	if err := p.checkModifiable(ModifiableOutputs); err != nil {
+		return err
+	}
+	p.Outputs = append(p.Outputs, out)
+	return nil
+}
+
+// hasSignatures reports whether any input has a partial or taproot
+// signature or has been finalized.
+func (p *Packet) hasSignatures() bool {
+	for i := range p.Inputs {
+		in := &p.Inputs[i]
+		if len(in.PartialSigs) != 0 || len(in.TapKeySig) != 0 ||
+			len(in.TapScriptSigs) != 0 || in.IsFinal() {
+
+			return true
+		}
+	}
+	return false
+}
+
+// signed clears the TxModifiable flags a signature of the sighash type
+// commits to, as the Signer does for version 2 packets: a signature without
+// SIGHASH_ANYONECANPAY commits to the inputs, and one without SIGHASH_NONE
+// or SIGHASH_SINGLE to the outputs.
+func (p *Packet) signed(sighashType txscript.SigHashType) {
+	if p.Version != 2 || p.TxModifiable == nil {
+		return
+	}
+	flags := *p.TxModifiable
+	if sighashType&txscript.SigHashAnyOneCanPay == 0 {
+		flags &^= ModifiableInputs
+	}
+	switch sighashType & sigHashMask {
+	case txscript.SigHashNone:
+	case txscript.SigHashSingle:
+		flags |= HasSighashSingle
+	default:
+		flags &^= ModifiableOutputs
+	}
+	p.TxModifiable = &flags
+}
+
+// sigHashMask masks the sighash type of its SIGHASH_ANYONECANPAY flag.
+const sigHashMask = 0x1f
+
+// clone returns a deep copy of the packet.
+func (p *Packet) clone() (*Packet, error) {
+	data, err := p.Serialize()
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// ConvertV2 returns the packet as a version 2 packet, with the version,
+// lock time, outpoints and sequences of its transaction and the amounts and
+// scripts of its outputs in fields of their own. The lock time becomes the
+// fallback lock time, and every sequence is kept, so that ConvertV0 gives
+// the packet back. A version 2 packet is copied as it is.
+func (p *Packet) ConvertV2() (*Packet, error) {
+	q, err := p.clone()
+	if err != nil || q.Version == 2 {
+		return q, err
+	}
+	tx := q.UnsignedTx
+	if tx.Version < 2 {
+		return nil, ErrTxVersion
+	}
+
+	q.UnsignedTx = nil
+	q.Version = 2
+	q.TxVersion = tx.Version
+	lockTime := tx.LockTime
+	q.FallbackLockTime = &lockTime
+	for i, txIn := range tx.TxIn {
+		in := &q.Inputs[i]
+		in.PreviousTxid = txIn.PreviousOutPoint.Hash
+		in.OutputIndex = txIn.PreviousOutPoint.Index
+		sequence := txIn.Sequence
+		in.Sequence = &sequence
+	}
+	for i, txOut := range tx.TxOut {
+		q.Outputs[i].Amount = txOut.Value
+		q.Outputs[i].Script = txOut.PkScript
+	}
+	return q, nil
+}
+
+// ConvertV0 returns the packet as a version 0 packet, whose unsigned
+// transaction is built by Tx. Version 0 packets can't be modified and have
+// no lock time requirements of their inputs, so a packet with modifiable
+// flags or requirements isn't converted. A version 0 packet is copied as it
+// is.
+func (p *Packet) ConvertV0() (*Packet, error) {
+	q, err := p.clone()
+	if err != nil || q.Version == 0 {
+		return q, err
+	}
+	if q.modifiable() != 0 {
+		return nil, fmt.Errorf("%w: modifiable flags", ErrLossyConversion)
+	}
+	for i := range q.Inputs {
+		if q.Inputs[i].RequiredTimeLockTime != nil ||
+			q.Inputs[i].RequiredHeightLockTime != nil {
+
+			return nil, fmt.Errorf("%w: lock time required by input %d",
+				ErrLossyConversion, i)
+		}
+	}
+	tx, err := q.Tx()
+	if err != nil {
+		return nil, err
+	}
+
+	q.UnsignedTx = tx
+	q.Version = 0
+	q.TxVersion = 0
+	q.FallbackLockTime = nil
+	q.TxModifiable = nil
+	for i := range q.Inputs {
+		in := &q.Inputs[i]
+		in.PreviousTxid = chainhash.Hash{}
+		in.OutputIndex = 0
+		in.Sequence = nil
+	}
+	for i := range q.Outputs {
+		q.Outputs[i].Amount = 0
+		q.Outputs[i].Script = nil
+	}
+	return q, nil
+}
@@ -0,0 +1,2068 @@
+package psbt
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/rand"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	bip32 "github.com/christsim/bips/bip-0032"
+	"github.com/christsim/bips/internal/vectorfile"
+)
+
+// ErrVectorMismatch is returned by CheckVector and CheckConversionVector when
+// parsing or converting a vector's packet doesn't give the expected result.
+var ErrVectorMismatch = errors.New("psbt: vector mismatch")
+
+// Vector is a serialized packet and the outcome of parsing it.
+type Vector struct {
+	// PSBT is the packet in base64.
+	PSBT string
+
+	// Err is the error Parse rejects the packet with, or nil if the
+	// packet is valid.
+	Err error
+
+	// StrictErr is the error ParseStrict rejects the packet with, which is
+	// Err for a packet Parse rejects, or nil if the packet is valid and
+	// canonical.
+	StrictErr error
+
+	// Comment describes what the vector exercises.
+	Comment string
+}
+
+// specVector is a test vector of the BIP.
+type specVector struct {
+	psbt    string
+	err     error
+	comment string
+}
+
+// specValid are the valid packets of the BIP, ending with the taproot ones
+// BIP 371 added. The keys of unknown types in its inputs are of type 0xf0,
+// as the BIP has had them since BIP 370 took type 0x0f for output indexes.
+var specValid = []specVector{
+	{
+		psbt: "cHNidP8BAHUCAAAAASaBcTce3/KF6Tet7qSze3gADAVmy7OtZGQX" +
+			"E8pCFxv2AAAAAAD+////AtPf9QUAAAAAGXapFNDFmQPFusKGh2Dp" +
+			"D9UhpGZap2UgiKwA4fUFAAAAABepFDVF5uM7gyxHBQ8k0+65PJwD" +
+			"lIvHh7MuEwAAAQD9pQEBAAAAAAECiaPHHqtNIOA3G7ukzGmPopXJ" +
+			"Rjr6Ljl/hTPMti+VZ+UBAAAAFxYAFL4Y0VKpsBIDna89p95PUzSe" +
+			"7LmF/////4b4qkOnHf8USIk6UwpyN+9rRgi7st0tAXHmOuxqSJC0" +
+			"AQAAABcWABT+Pp7xp0XpdNkCxDVZQ6vLNL1TU/////8CAMLrCwAA" +
+			"AAAZdqkUhc/xCX/Z4Ai7NK9wnGIZeziXikiIrHL++E4sAAAAF6kU" +
+			"M5cluiHv1irHU6m80GfWx6ajnQWHAkcwRAIgJxK+IuAnDzlPVoMR" +
+			"3HyppolwuAJf3TskAinwf4pfOiQCIAGLONfc0xTnNMkna9b7QPZz" +
+			"MlvEuqFEyADS8vAtsnZcASED0uFWdJQbrUqZY3LLh+GFbTZSYG2Y" +
+			"Vi/jnF6efkE/IQUCSDBFAiEA0SuFLYXc2WHS9fSrZgZU327tzHlM" +
+			"DDPOXMMJ/7X85Y0CIGczio4OFyXBl/saiK9Z9R5E5CVbIBZ8hoQD" +
+			"HAXR8lkqASECI7cr7vCWXRC+B3jv7NYfysb3mk6haTkzgHNEZPhP" +
+			"KrMAAAAAAAAA",
+		comment: "One P2PKH input with its non-witness UTXO, and empty output maps",
+	},
+	{
+		psbt: "cHNidP8BAKACAAAAAqsJSaCMWvfEm4IS9Bfi8Vqz9cM9zxU4IagT" +
+			"n4d6W3vkAAAAAAD+////qwlJoIxa98SbghL0F+LxWrP1wz3PFTgh" +
+			"qBOfh3pbe+QBAAAAAP7///8CYDvqCwAAAAAZdqkUdopAu9dAy+gd" +
+			"mI5x3ipNXHE5ax2IrI4kAAAAAAAAGXapFG9GILVT+glechue4O/p" +
+			"+gOcykWXiKwAAAAAAAEHakcwRAIgR1lmF5fAGwNrJZKJSGhiGDR9" +
+			"iYZLcZ4ff89X0eURZYcCIFMJ6r9Wqk2Ikf/REf3xM286KdqGbX+E" +
+			"htdVRs7tr5MZASEDXNxh/HupccC1AaZGoqg7ECy0OIEhfKaC3Ibi" +
+			"1z+ogpIAAQEgAOH1BQAAAAAXqRQ1RebjO4MsRwUPJNPuuTycA5SL" +
+			"x4cBBBYAFIXRNTfy4mVAWjTbr6nj3aAfuCMIAAAA",
+		comment: "A finalized P2PKH input and a P2SH-P2WPKH input with its redeem script",
+	},
+	{
+		psbt: "cHNidP8BAHUCAAAAASaBcTce3/KF6Tet7qSze3gADAVmy7OtZGQX" +
+			"E8pCFxv2AAAAAAD+////AtPf9QUAAAAAGXapFNDFmQPFusKGh2Dp" +
+			"D9UhpGZap2UgiKwA4fUFAAAAABepFDVF5uM7gyxHBQ8k0+65PJwD" +
+			"lIvHh7MuEwAAAQD9pQEBAAAAAAECiaPHHqtNIOA3G7ukzGmPopXJ" +
+			"Rjr6Ljl/hTPMti+VZ+UBAAAAFxYAFL4Y0VKpsBIDna89p95PUzSe" +
+			"7LmF/////4b4qkOnHf8USIk6UwpyN+9rRgi7st0tAXHmOuxqSJC0" +
+			"AQAAABcWABT+Pp7xp0XpdNkCxDVZQ6vLNL1TU/////8CAMLrCwAA" +
+			"AAAZdqkUhc/xCX/Z4Ai7NK9wnGIZeziXikiIrHL++E4sAAAAF6kU" +
+			"M5cluiHv1irHU6m80GfWx6ajnQWHAkcwRAIgJxK+IuAnDzlPVoMR" +
+			"3HyppolwuAJf3TskAinwf4pfOiQCIAGLONfc0xTnNMkna9b7QPZz" +
+			"MlvEuqFEyADS8vAtsnZcASED0uFWdJQbrUqZY3LLh+GFbTZSYG2Y" +
+			"Vi/jnF6efkE/IQUCSDBFAiEA0SuFLYXc2WHS9fSrZgZU327tzHlM" +
+			"DDPOXMMJ/7X85Y0CIGczio4OFyXBl/saiK9Z9R5E5CVbIBZ8hoQD" +
+			"HAXR8lkqASECI7cr7vCWXRC+B3jv7NYfysb3mk6haTkzgHNEZPhP" +
+			"KrMAAAAAAQMEAQAAAAAAAA==",
+		comment: "A P2PKH input with a non-witness UTXO and a sighash type",
+	},
+	{
+		psbt: "cHNidP8BAKACAAAAAqsJSaCMWvfEm4IS9Bfi8Vqz9cM9zxU4IagT" +
+			"n4d6W3vkAAAAAAD+////qwlJoIxa98SbghL0F+LxWrP1wz3PFTgh" +
+			"qBOfh3pbe+QBAAAAAP7///8CYDvqCwAAAAAZdqkUdopAu9dAy+gd" +
+			"mI5x3ipNXHE5ax2IrI4kAAAAAAAAGXapFG9GILVT+glechue4O/p" +
+			"+gOcykWXiKwAAAAAAAEA3wIAAAABJoFxNx7f8oXpN63upLN7eAAM" +
+			"BWbLs61kZBcTykIXG/YAAAAAakcwRAIgcLIkUSPmv0dNYMW1DAQ9" +
+			"TGkaXSQ18Jo0p2YqncJReQoCIAEynKnazygL3zB0DsA5BCJCLIHL" +
+			"RYOUV663b8Eu3ZWzASECZX0RjTNXuOD0ws1G23s59tnDjZpwq8ub" +
+			"LeXcjb/kzjH+////AtPf9QUAAAAAGXapFNDFmQPFusKGh2DpD9Uh" +
+			"pGZap2UgiKwA4fUFAAAAABepFDVF5uM7gyxHBQ8k0+65PJwDlIvH" +
+			"h7MuEwAAAQEgAOH1BQAAAAAXqRQ1RebjO4MsRwUPJNPuuTycA5SL" +
+			"x4cBBBYAFIXRNTfy4mVAWjTbr6nj3aAfuCMIACICAurVlmh8qAYE" +
+			"Ptw94RbN8p1eklfBls0FXPaYyNAr8k6ZELSmumcAAACAAAAAgAIA" +
+			"AIAAIgIDlPYr6d8ZlSxVh3aK63aYBhrSxKJciU9H2MFitNchPQUQ" +
+			"tKa6ZwAAAIABAACAAgAAgAA=",
+		comment: "A P2PKH input and a P2SH-P2WPKH input, and outputs with derivations",
+	},
+	{
+		psbt: "cHNidP8BAFUCAAAAASeaIyOl37UfxF8iD6WLD8E+HjNCeSqF1+Ns" +
+			"1jM7XLw5AAAAAAD/////AaBa6gsAAAAAGXapFP/pwAYQl8w7Y28s" +
+			"sEYPpPxCfStFiKwAAAAAAAEBIJVe6gsAAAAAF6kUY0UgD2jRieGt" +
+			"wN8cTRbqjxTA2+uHIgIDsTQcy6doO2r08SOM1ul+cWfVafrEfx5I" +
+			"1HVBhENVvUZGMEMCIAQktY7/qqaU4VWepck7v9SokGQiQFXN8HC2" +
+			"dxRpRC0HAh9cjrD+plFtYLisszrWTt5g6Hhb+zqpS5m9+GFR25qa" +
+			"AQEEIgAgdx/RitRZZm3Unz1WTj28QvTIR3TjYK2haBao7UiNVoEB" +
+			"BUdSIQOxNBzLp2g7avTxI4zW6X5xZ9Vp+sR/HkjUdUGEQ1W9RiED" +
+			"3lXR4drIBeP4pYwfv5uUwC89uq/hJ/78pJlfJvggg71SriIGA7E0" +
+			"HMunaDtq9PEjjNbpfnFn1Wn6xH8eSNR1QYRDVb1GELSmumcAAACA" +
+			"AAAAgAQAAIAiBgPeVdHh2sgF4/iljB+/m5TALz26r+En/vykmV8m" +
+			"+CCDvRC0prpnAAAAgAAAAIAFAACAAAA=",
+		comment: "A P2SH-P2WSH 2-of-2 multisig input with its scripts, derivations and one signature",
+	},
+	{
+		psbt: "cHNidP8BAD8CAAAAAf//////////////////////////////////" +
+			"////////AAAAAAD/////AQAAAAAAAAAAA2oBAAAAAAAACvABAgME" +
+			"BQYHCAkPAQIDBAUGBwgJCgsMDQ4PAAA=",
+		comment: "An input with a key of an unknown type",
+	},
+	{
+		psbt: "cHNidP8BAD8CAAAAAf//////////////////////////////////" +
+			"////////AAAAAAD/////AQAAAAAAAAAAA2oBAAAAAAAAIgYDDQl0" +
+			"Zrf1kWKsTZC/ZfKjGoutgvzSLpgTjc8nlAGTm9EE/////wrwAQID" +
+			"BAUGBwgJDwECAwQFBgcICQoLDA0ODwAA",
+		comment: "An input with a derivation and a key of an unknown type",
+	},
+	{
+		psbt: "cHNidP8BACABAAAAAAEAAAAAAAAAAA1qC2hlbGxvIHdvcmxkAAAA" +
+			"AAAA",
+		comment: "A transaction without inputs",
+	},
+	{
+		psbt: "cHNidP8BAFICAAAAASd0Srq/MCf+DWzyOpbu4u+xiO9SMBlUWFiD" +
+			"5ptmJLJCAAAAAAD/////AUjmBSoBAAAAFgAUdo4e60z0IIZgM/gK" +
+			"zv8PlyB0SWkAAAAAAAEBKwDyBSoBAAAAIlEgWiws9bUs8x+DrS6N" +
+			"pj/wMYPs2PYJx1EK6KSOA5EKB1chFv40kGTJjW4qhT+jybEr2LME" +
+			"oZwZXGDvp+4jkwRtP6IyGQB3Ky2nVgAAgAEAAIAAAACAAQAAAAAA" +
+			"AAABFyD+NJBkyY1uKoU/o8mxK9izBKGcGVxg76fuI5MEbT+iMgAi" +
+			"AgNrdyptt02HU8mKgnlY3mx4qzMSEJ830+AwRIQkLs5z2Bh3Ky2n" +
+			"VAAAgAEAAIAAAACAAAAAAAAAAAAA",
+		comment: "A P2TR key path input with its internal key and derivation",
+	},
+	{
+		psbt: "cHNidP8BAFICAAAAASd0Srq/MCf+DWzyOpbu4u+xiO9SMBlUWFiD" +
+			"5ptmJLJCAAAAAAD/////AUjmBSoBAAAAFgAUdo4e60z0IIZgM/gK" +
+			"zv8PlyB0SWkAAAAAAAEBKwDyBSoBAAAAIlEgWiws9bUs8x+DrS6N" +
+			"pj/wMYPs2PYJx1EK6KSOA5EKB1cBE0C7U+yRe62dkGrxuocYHEi4" +
+			"as5aritTYFpyXKdGJWMUdvxvW67a9PLuD0d/NvWPOXDVuCc7fkl7" +
+			"l68uPxJcl680IRb+NJBkyY1uKoU/o8mxK9izBKGcGVxg76fuI5ME" +
+			"bT+iMhkAdystp1YAAIABAACAAAAAgAEAAAAAAAAAARcg/jSQZMmN" +
+			"biqFP6PJsSvYswShnBlcYO+n7iOTBG0/ojIAIgIDa3cqbbdNh1PJ" +
+			"ioJ5WN5seKszEhCfN9PgMESEJC7Oc9gYdystp1QAAIABAACAAAAA" +
+			"gAAAAAAAAAAAAA==",
+		comment: "A P2TR key path input with its internal key, derivation and signature",
+	},
+	{
+		psbt: "cHNidP8BAF4CAAAAASd0Srq/MCf+DWzyOpbu4u+xiO9SMBlUWFiD" +
+			"5ptmJLJCAAAAAAD/////AUjmBSoBAAAAIlEgg2mORYxmZOFZXXXa" +
+			"JZfeHiLul9eY5wbEwKS1qYI810MAAAAAAAEBKwDyBSoBAAAAIlEg" +
+			"Wiws9bUs8x+DrS6Npj/wMYPs2PYJx1EK6KSOA5EKB1chFv40kGTJ" +
+			"jW4qhT+jybEr2LMEoZwZXGDvp+4jkwRtP6IyGQB3Ky2nVgAAgAEA" +
+			"AIAAAACAAQAAAAAAAAABFyD+NJBkyY1uKoU/o8mxK9izBKGcGVxg" +
+			"76fuI5MEbT+iMgABBSARJNp67JLM0GyVRWJkf0N7E4uVchqEvivy" +
+			"J2u92rPmcSEHESTaeuySzNBslUViZH9DexOLlXIahL4r8idrvdqz" +
+			"5nEZAHcrLadWAACAAQAAgAAAAIAAAAAABQAAAAA=",
+		comment: "A P2TR key path input, and a P2TR output with its internal key and derivation",
+	},
+	{
+		psbt: "cHNidP8BAF4CAAAAAZvUh2UjC/mnLmYgAflyVW5U8Mb5f+tWvLVg" +
+			"DYF/aZUmAQAAAAD/////AUjmBSoBAAAAIlEgg2mORYxmZOFZXXXa" +
+			"JZfeHiLul9eY5wbEwKS1qYI810MAAAAAAAEBKwDyBSoBAAAAIlEg" +
+			"wiR++/2SrEf29AuNQtFpF1oZ+p+hDkol1/NetN2FtpJiFcFQkpt0" +
+			"waBJVLeLS2A16XpeB4paDyjsltVHv+6azoA6wG99YgWelJehpKJn" +
+			"Vp2YdtpgEBr/OONSm5uTnOf5GulwEV8uSQr3zEXE94UR82BXzlxa" +
+			"XFYyWin7RN/CA/NW4fgjICyxOsaCSN6AaqajZZzzwD62gh0JyBFK" +
+			"ToaP696GW7bSrMBCFcFQkpt0waBJVLeLS2A16XpeB4paDyjsltVH" +
+			"v+6azoA6wJfG5v6l/3FP9XJEmZkIEOQG6YqhD1v35fZ4S8HQqabO" +
+			"IyBDILC/FvARtT6nvmFZJKp/J+XSmtIOoRVdhIZ2w7rRsqzAYhXB" +
+			"UJKbdMGgSVS3i0tgNel6XgeKWg8o7JbVR7/ums6AOsDNlw4V9T/A" +
+			"yC+VD9Vg/6kZt2FyvgFzaKiZE68HT0ALCRFfLkkK98xFxPeFEfNg" +
+			"V85cWlxWMlop+0TfwgPzVuH4IyD6D3o87zsdDAps59JuF62gsuXJ" +
+			"LRnvrUi0GFnLikUcqazAIRYssTrGgkjegGqmo2Wc88A+toIdCcgR" +
+			"Sk6Gj+vehlu20jkBzZcOFfU/wMgvlQ/VYP+pGbdhcr4Bc2iomROv" +
+			"B09ACwl3Ky2nVgAAgAEAAIACAACAAAAAAAAAAAAhFkMgsL8W8BG1" +
+			"Pqe+YVkkqn8n5dKa0g6hFV2EhnbDutGyOQERXy5JCvfMRcT3hRHz" +
+			"YFfOXFpcVjJaKftE38ID81bh+HcrLadWAACAAQAAgAEAAIAAAAAA" +
+			"AAAAACEWUJKbdMGgSVS3i0tgNel6XgeKWg8o7JbVR7/ums6AOsAF" +
+			"AHxGHl0hFvoPejzvOx0MCmzn0m4XraCy5cktGe+tSLQYWcuKRRyp" +
+			"OQFvfWIFnpSXoaSiZ1admHbaYBAa/zjjUpubk5zn+RrpcHcrLadW" +
+			"AACAAQAAgAMAAIAAAAAAAAAAAAEXIFCSm3TBoElUt4tLYDXpel4H" +
+			"iloPKOyW1Ue/7prOgDrAARgg8DYuL3Wm9CClvePrIh2WrmcgzyX4" +
+			"GJDJWx13WstRXmUAAQUgESTaeuySzNBslUViZH9DexOLlXIahL4r" +
+			"8idrvdqz5nEhBxEk2nrskszQbJVFYmR/Q3sTi5VyGoS+K/Ina73a" +
+			"s+ZxGQB3Ky2nVgAAgAEAAIAAAACAAAAAAAUAAAAA",
+		comment: "A P2TR script path input with its leaf scripts, merkle root and derivations",
+	},
+	{
+		psbt: "cHNidP8BAF4CAAAAASd0Srq/MCf+DWzyOpbu4u+xiO9SMBlUWFiD" +
+			"5ptmJLJCAAAAAAD/////AUjmBSoBAAAAIlEgCoy9yG3hzhwPnK6y" +
+			"LW33ztNoP+Qj4F0eQCqHk0HW9vUAAAAAAAEBKwDyBSoBAAAAIlEg" +
+			"Wiws9bUs8x+DrS6Npj/wMYPs2PYJx1EK6KSOA5EKB1chFv40kGTJ" +
+			"jW4qhT+jybEr2LMEoZwZXGDvp+4jkwRtP6IyGQB3Ky2nVgAAgAEA" +
+			"AIAAAACAAQAAAAAAAAABFyD+NJBkyY1uKoU/o8mxK9izBKGcGVxg" +
+			"76fuI5MEbT+iMgABBSBQkpt0waBJVLeLS2A16XpeB4paDyjsltVH" +
+			"v+6azoA6wAEGbwLAIiBzblcpAP4SUliaIUPI88efcaBBLSNTr3Ve" +
+			"lwHHgmlKAqwCwCIgYxxfO1gyuPvev7GXBM7rMjwh9A96JPQ9aO8M" +
+			"wmsSWWmsAcAiIET6pJoDON5IjI3//s37bzKfOAvVZu8gyN9tgT6r" +
+			"HEJzrCEHRPqkmgM43kiMjf/+zftvMp84C9Vm7yDI322BPqscQnM5" +
+			"AfBreYuSoQ7ZqdC7/Trxc6U7FhfaOkFZygCCFs2Fay4Odystp1YA" +
+			"AIABAACAAQAAgAAAAAADAAAAIQdQkpt0waBJVLeLS2A16XpeB4pa" +
+			"DyjsltVHv+6azoA6wAUAfEYeXSEHYxxfO1gyuPvev7GXBM7rMjwh" +
+			"9A96JPQ9aO8MwmsSWWk5ARis5AmIl4Xg6nDO67jhyokqenjq7eDy" +
+			"4pbPQ1lhqPTKdystp1YAAIABAACAAgAAgAAAAAADAAAAIQdzblcp" +
+			"AP4SUliaIUPI88efcaBBLSNTr3VelwHHgmlKAjkBKaW0kVCQFi11" +
+			"mv0/4Pk/ozJgVtC0CIy5M8rngmy42Cx3Ky2nVgAAgAEAAIADAACA" +
+			"AAAAAAMAAAAA",
+		comment: "A P2TR output with its taproot tree and the derivations of its leaves' keys",
+	},
+	{
+		psbt: "cHNidP8BAF4CAAAAAZvUh2UjC/mnLmYgAflyVW5U8Mb5f+tWvLVg" +
+			"DYF/aZUmAQAAAAD/////AUjmBSoBAAAAIlEgg2mORYxmZOFZXXXa" +
+			"JZfeHiLul9eY5wbEwKS1qYI810MAAAAAAAEBKwDyBSoBAAAAIlEg" +
+			"wiR++/2SrEf29AuNQtFpF1oZ+p+hDkol1/NetN2FtpJBFCyxOsaC" +
+			"SN6AaqajZZzzwD62gh0JyBFKToaP696GW7bSzZcOFfU/wMgvlQ/V" +
+			"YP+pGbdhcr4Bc2iomROvB09ACwlAv4GNl1fW/+tTi6BX+0wfxOD1" +
+			"7xhudlvrVkeR4Cr1/T1eJVHU404z2G8na4LJnHmu0/A5Wgge/NLM" +
+			"LGXdfmk9eUEUQyCwvxbwEbU+p75hWSSqfyfl0prSDqEVXYSGdsO6" +
+			"0bIRXy5JCvfMRcT3hRHzYFfOXFpcVjJaKftE38ID81bh+EDh8atv" +
+			"q/omsjbyGDNxncHUKKt2jYD5H5mI2KvvR7+4Y7sfKlKfdowV8Azj" +
+			"TsKDzcB+iPhCi+KPbvZAQ8MpEYEaQRT6D3o87zsdDAps59JuF62g" +
+			"suXJLRnvrUi0GFnLikUcqW99YgWelJehpKJnVp2YdtpgEBr/OONS" +
+			"m5uTnOf5GulwQOwfA3kgZGHIM0IoVCMyZwirAx8NpKJT7kWq+luM" +
+			"kgNNi2BUkPjNE+APmJmJuX4hX6o28S3uNpPS2szzeBwXV/ZiFcFQ" +
+			"kpt0waBJVLeLS2A16XpeB4paDyjsltVHv+6azoA6wG99YgWelJeh" +
+			"pKJnVp2YdtpgEBr/OONSm5uTnOf5GulwEV8uSQr3zEXE94UR82BX" +
+			"zlxaXFYyWin7RN/CA/NW4fgjICyxOsaCSN6AaqajZZzzwD62gh0J" +
+			"yBFKToaP696GW7bSrMBCFcFQkpt0waBJVLeLS2A16XpeB4paDyjs" +
+			"ltVHv+6azoA6wJfG5v6l/3FP9XJEmZkIEOQG6YqhD1v35fZ4S8HQ" +
+			"qabOIyBDILC/FvARtT6nvmFZJKp/J+XSmtIOoRVdhIZ2w7rRsqzA" +
+			"YhXBUJKbdMGgSVS3i0tgNel6XgeKWg8o7JbVR7/ums6AOsDNlw4V" +
+			"9T/AyC+VD9Vg/6kZt2FyvgFzaKiZE68HT0ALCRFfLkkK98xFxPeF" +
+			"EfNgV85cWlxWMlop+0TfwgPzVuH4IyD6D3o87zsdDAps59JuF62g" +
+			"suXJLRnvrUi0GFnLikUcqazAIRYssTrGgkjegGqmo2Wc88A+toId" +
+			"CcgRSk6Gj+vehlu20jkBzZcOFfU/wMgvlQ/VYP+pGbdhcr4Bc2io" +
+			"mROvB09ACwl3Ky2nVgAAgAEAAIACAACAAAAAAAAAAAAhFkMgsL8W" +
+			"8BG1Pqe+YVkkqn8n5dKa0g6hFV2EhnbDutGyOQERXy5JCvfMRcT3" +
+			"hRHzYFfOXFpcVjJaKftE38ID81bh+HcrLadWAACAAQAAgAEAAIAA" +
+			"AAAAAAAAACEWUJKbdMGgSVS3i0tgNel6XgeKWg8o7JbVR7/ums6A" +
+			"OsAFAHxGHl0hFvoPejzvOx0MCmzn0m4XraCy5cktGe+tSLQYWcuK" +
+			"RRypOQFvfWIFnpSXoaSiZ1admHbaYBAa/zjjUpubk5zn+RrpcHcr" +
+			"LadWAACAAQAAgAMAAIAAAAAAAAAAAAEXIFCSm3TBoElUt4tLYDXp" +
+			"el4HiloPKOyW1Ue/7prOgDrAARgg8DYuL3Wm9CClvePrIh2Wrmcg" +
+			"zyX4GJDJWx13WstRXmUAAQUgESTaeuySzNBslUViZH9DexOLlXIa" +
+			"hL4r8idrvdqz5nEhBxEk2nrskszQbJVFYmR/Q3sTi5VyGoS+K/In" +
+			"a73as+ZxGQB3Ky2nVgAAgAEAAIAAAACAAAAAAAUAAAAA",
+		comment: "A P2TR script path input with signatures of its leaf scripts",
+	},
+}
+
+// specInvalid are the invalid packets of the BIP, ending with the taproot
+// ones BIP 371 added, with the errors Parse rejects them with.
+var specInvalid = []specVector{
+	{
+		psbt: "AgAAAAEmgXE3Ht/yhek3re6ks3t4AAwFZsuzrWRkFxPKQhcb9gAA" +
+			"AABqRzBEAiBwsiRRI+a/R01gxbUMBD1MaRpdJDXwmjSnZiqdwlF5" +
+			"CgIgATKcqdrPKAvfMHQOwDkEIkIsgctFg5RXrrdvwS7dlbMBIQJl" +
+			"fRGNM1e44PTCzUbbezn22cONmnCry5st5dyNv+TOMf7///8C09/1" +
+			"BQAAAAAZdqkU0MWZA8W6woaHYOkP1SGkZlqnZSCIrADh9QUAAAAA" +
+			"F6kUNUXm4zuDLEcFDyTT7rk8nAOUi8eHsy4TAA==",
+		err:     ErrInvalidMagic,
+		comment: "Wire format, not PSBT format",
+	},
+	{
+		psbt: "cHNidP8BAHUCAAAAASaBcTce3/KF6Tet7qSze3gADAVmy7OtZGQX" +
+			"E8pCFxv2AAAAAAD+////AtPf9QUAAAAAGXapFNDFmQPFusKGh2Dp" +
+			"D9UhpGZap2UgiKwA4fUFAAAAABepFDVF5uM7gyxHBQ8k0+65PJwD" +
+			"lIvHh7MuEwAAAQD9pQEBAAAAAAECiaPHHqtNIOA3G7ukzGmPopXJ" +
+			"Rjr6Ljl/hTPMti+VZ+UBAAAAFxYAFL4Y0VKpsBIDna89p95PUzSe" +
+			"7LmF/////4b4qkOnHf8USIk6UwpyN+9rRgi7st0tAXHmOuxqSJC0" +
+			"AQAAABcWABT+Pp7xp0XpdNkCxDVZQ6vLNL1TU/////8CAMLrCwAA" +
+			"AAAZdqkUhc/xCX/Z4Ai7NK9wnGIZeziXikiIrHL++E4sAAAAF6kU" +
+			"M5cluiHv1irHU6m80GfWx6ajnQWHAkcwRAIgJxK+IuAnDzlPVoMR" +
+			"3HyppolwuAJf3TskAinwf4pfOiQCIAGLONfc0xTnNMkna9b7QPZz" +
+			"MlvEuqFEyADS8vAtsnZcASED0uFWdJQbrUqZY3LLh+GFbTZSYG2Y" +
+			"Vi/jnF6efkE/IQUCSDBFAiEA0SuFLYXc2WHS9fSrZgZU327tzHlM" +
+			"DDPOXMMJ/7X85Y0CIGczio4OFyXBl/saiK9Z9R5E5CVbIBZ8hoQD" +
+			"HAXR8lkqASECI7cr7vCWXRC+B3jv7NYfysb3mk6haTkzgHNEZPhP" +
+			"KrMAAAAAAA==",
+		err:     fmt.Errorf("%w: output 0", ErrTruncated),
+		comment: "Missing outputs",
+	},
+	{
+		psbt: "cHNidP8BAP0KAQIAAAACqwlJoIxa98SbghL0F+LxWrP1wz3PFTgh" +
+			"qBOfh3pbe+QAAAAAakcwRAIgR1lmF5fAGwNrJZKJSGhiGDR9iYZL" +
+			"cZ4ff89X0eURZYcCIFMJ6r9Wqk2Ikf/REf3xM286KdqGbX+EhtdV" +
+			"Rs7tr5MZASEDXNxh/HupccC1AaZGoqg7ECy0OIEhfKaC3Ibi1z+o" +
+			"gpL+////qwlJoIxa98SbghL0F+LxWrP1wz3PFTghqBOfh3pbe+QB" +
+			"AAAAAP7///8CYDvqCwAAAAAZdqkUdopAu9dAy+gdmI5x3ipNXHE5" +
+			"ax2IrI4kAAAAAAAAGXapFG9GILVT+glechue4O/p+gOcykWXiKwA" +
+			"AAAAAAABASAA4fUFAAAAABepFDVF5uM7gyxHBQ8k0+65PJwDlIvH" +
+			"hwEEFgAUhdE1N/LiZUBaNNuvqePdoB+4IwgAAAA=",
+		err:     fieldErr(ErrTxNotUnsigned, "unsigned transaction", "global map"),
+		comment: "Filled in scriptSig in unsigned tx",
+	},
+	{
+		psbt: "cHNidP8AAQD9pQEBAAAAAAECiaPHHqtNIOA3G7ukzGmPopXJRjr6" +
+			"Ljl/hTPMti+VZ+UBAAAAFxYAFL4Y0VKpsBIDna89p95PUzSe7LmF" +
+			"/////4b4qkOnHf8USIk6UwpyN+9rRgi7st0tAXHmOuxqSJC0AQAA" +
+			"ABcWABT+Pp7xp0XpdNkCxDVZQ6vLNL1TU/////8CAMLrCwAAAAAZ" +
+			"dqkUhc/xCX/Z4Ai7NK9wnGIZeziXikiIrHL++E4sAAAAF6kUM5cl" +
+			"uiHv1irHU6m80GfWx6ajnQWHAkcwRAIgJxK+IuAnDzlPVoMR3Hyp" +
+			"polwuAJf3TskAinwf4pfOiQCIAGLONfc0xTnNMkna9b7QPZzMlvE" +
+			"uqFEyADS8vAtsnZcASED0uFWdJQbrUqZY3LLh+GFbTZSYG2YVi/j" +
+			"nF6efkE/IQUCSDBFAiEA0SuFLYXc2WHS9fSrZgZU327tzHlMDDPO" +
+			"XMMJ/7X85Y0CIGczio4OFyXBl/saiK9Z9R5E5CVbIBZ8hoQDHAXR" +
+			"8lkqASECI7cr7vCWXRC+B3jv7NYfysb3mk6haTkzgHNEZPhPKrMA" +
+			"AAAAAA==",
+		err:     ErrMissingUnsignedTx,
+		comment: "No unsigned tx",
+	},
+	{
+		psbt: "cHNidP8BAHUCAAAAASaBcTce3/KF6Tet7qSze3gADAVmy7OtZGQX" +
+			"E8pCFxv2AAAAAAD+////AtPf9QUAAAAAGXapFNDFmQPFusKGh2Dp" +
+			"D9UhpGZap2UgiKwA4fUFAAAAABepFDVF5uM7gyxHBQ8k0+65PJwD" +
+			"lIvHh7MuEwAAAQD9pQEBAAAAAAECiaPHHqtNIOA3G7ukzGmPopXJ" +
+			"Rjr6Ljl/hTPMti+VZ+UBAAAAFxYAFL4Y0VKpsBIDna89p95PUzSe" +
+			"7LmF/////4b4qkOnHf8USIk6UwpyN+9rRgi7st0tAXHmOuxqSJC0" +
+			"AQAAABcWABT+Pp7xp0XpdNkCxDVZQ6vLNL1TU/////8CAMLrCwAA" +
+			"AAAZdqkUhc/xCX/Z4Ai7NK9wnGIZeziXikiIrHL++E4sAAAAF6kU" +
+			"M5cluiHv1irHU6m80GfWx6ajnQWHAkcwRAIgJxK+IuAnDzlPVoMR" +
+			"3HyppolwuAJf3TskAinwf4pfOiQCIAGLONfc0xTnNMkna9b7QPZz" +
+			"MlvEuqFEyADS8vAtsnZcASED0uFWdJQbrUqZY3LLh+GFbTZSYG2Y" +
+			"Vi/jnF6efkE/IQUCSDBFAiEA0SuFLYXc2WHS9fSrZgZU327tzHlM" +
+			"DDPOXMMJ/7X85Y0CIGczio4OFyXBl/saiK9Z9R5E5CVbIBZ8hoQD" +
+			"HAXR8lkqASECI7cr7vCWXRC+B3jv7NYfysb3mk6haTkzgHNEZPhP" +
+			"KrMAAAAAAQA/AgAAAAH/////////////////////////////////" +
+			"/////////wAAAAAA/////wEAAAAAAAAAAANqAQAAAAAAAAAA",
+		err:     fieldErr(ErrDuplicateKey, "non-witness UTXO", "input 0"),
+		comment: "Duplicate keys in an input",
+	},
+	{
+		psbt: "cHNidP8CAAFVAgAAAAEnmiMjpd+1H8RfIg+liw/BPh4zQnkqhdfj" +
+			"bNYzO1y8OQAAAAAA/////wGgWuoLAAAAABl2qRT/6cAGEJfMO2Nv" +
+			"LLBGD6T8Qn0rRYisAAAAAAABASCVXuoLAAAAABepFGNFIA9o0Ynh" +
+			"rcDfHE0W6o8UwNvrhyICA7E0HMunaDtq9PEjjNbpfnFn1Wn6xH8e" +
+			"SNR1QYRDVb1GRjBDAiAEJLWO/6qmlOFVnqXJO7/UqJBkIkBVzfBw" +
+			"tncUaUQtBwIfXI6w/qZRbWC4rLM61k7eYOh4W/s6qUuZvfhhUdua" +
+			"mgEBBCIAIHcf0YrUWWZt1J89Vk49vEL0yEd042CtoWgWqO1IjVaB" +
+			"AQVHUiEDsTQcy6doO2r08SOM1ul+cWfVafrEfx5I1HVBhENVvUYh" +
+			"A95V0eHayAXj+KWMH7+blMAvPbqv4Sf+/KSZXyb4IIO9Uq4iBgOx" +
+			"NBzLp2g7avTxI4zW6X5xZ9Vp+sR/HkjUdUGEQ1W9RhC0prpnAAAA" +
+			"gAAAAIAEAACAIgYD3lXR4drIBeP4pYwfv5uUwC89uq/hJ/78pJlf" +
+			"Jvggg70QtKa6ZwAAAIAAAACABQAAgAAA",
+		err:     fieldErr(ErrInvalidKeyData, "unsigned transaction", "global map"),
+		comment: "Invalid global transaction typed key",
+	},
+	{
+		psbt: "cHNidP8BAFUCAAAAASeaIyOl37UfxF8iD6WLD8E+HjNCeSqF1+Ns" +
+			"1jM7XLw5AAAAAAD/////AaBa6gsAAAAAGXapFP/pwAYQl8w7Y28s" +
+			"sEYPpPxCfStFiKwAAAAAAAIBACCVXuoLAAAAABepFGNFIA9o0Ynh" +
+			"rcDfHE0W6o8UwNvrhyICA7E0HMunaDtq9PEjjNbpfnFn1Wn6xH8e" +
+			"SNR1QYRDVb1GRjBDAiAEJLWO/6qmlOFVnqXJO7/UqJBkIkBVzfBw" +
+			"tncUaUQtBwIfXI6w/qZRbWC4rLM61k7eYOh4W/s6qUuZvfhhUdua" +
+			"mgEBBCIAIHcf0YrUWWZt1J89Vk49vEL0yEd042CtoWgWqO1IjVaB" +
+			"AQVHUiEDsTQcy6doO2r08SOM1ul+cWfVafrEfx5I1HVBhENVvUYh" +
+			"A95V0eHayAXj+KWMH7+blMAvPbqv4Sf+/KSZXyb4IIO9Uq4iBgOx" +
+			"NBzLp2g7avTxI4zW6X5xZ9Vp+sR/HkjUdUGEQ1W9RhC0prpnAAAA" +
+			"gAAAAIAEAACAIgYD3lXR4drIBeP4pYwfv5uUwC89uq/hJ/78pJlf" +
+			"Jvggg70QtKa6ZwAAAIAAAACABQAAgAAA",
+		err:     fieldErr(ErrInvalidKeyData, "witness UTXO", "input 0"),
+		comment: "Invalid input witness utxo typed key",
+	},
+	{
+		psbt: "cHNidP8BAFUCAAAAASeaIyOl37UfxF8iD6WLD8E+HjNCeSqF1+Ns" +
+			"1jM7XLw5AAAAAAD/////AaBa6gsAAAAAGXapFP/pwAYQl8w7Y28s" +
+			"sEYPpPxCfStFiKwAAAAAAAEBIJVe6gsAAAAAF6kUY0UgD2jRieGt" +
+			"wN8cTRbqjxTA2+uHIQIDsTQcy6doO2r08SOM1ul+cWfVafrEfx5I" +
+			"1HVBhENVvUYwQwIgBCS1jv+qppThVZ6lyTu/1KiQZCJAVc3wcLZ3" +
+			"FGlELQcCH1yOsP6mUW1guKyzOtZO3mDoeFv7OqlLmb34YVHbmpoB" +
+			"AQQiACB3H9GK1FlmbdSfPVZOPbxC9MhHdONgraFoFqjtSI1WgQEF" +
+			"R1IhA7E0HMunaDtq9PEjjNbpfnFn1Wn6xH8eSNR1QYRDVb1GIQPe" +
+			"VdHh2sgF4/iljB+/m5TALz26r+En/vykmV8m+CCDvVKuIgYDsTQc" +
+			"y6doO2r08SOM1ul+cWfVafrEfx5I1HVBhENVvUYQtKa6ZwAAAIAA" +
+			"AACABAAAgCIGA95V0eHayAXj+KWMH7+blMAvPbqv4Sf+/KSZXyb4" +
+			"IIO9ELSmumcAAACAAAAAgAUAAIAAAA==",
+		err:     fieldErr(ErrInvalidKeyData, "partial signature", "input 0"),
+		comment: "Invalid pubkey length for input partial signature typed key",
+	},
+	{
+		psbt: "cHNidP8BAFUCAAAAASeaIyOl37UfxF8iD6WLD8E+HjNCeSqF1+Ns" +
+			"1jM7XLw5AAAAAAD/////AaBa6gsAAAAAGXapFP/pwAYQl8w7Y28s" +
+			"sEYPpPxCfStFiKwAAAAAAAEBIJVe6gsAAAAAF6kUY0UgD2jRieGt" +
+			"wN8cTRbqjxTA2+uHIgIDsTQcy6doO2r08SOM1ul+cWfVafrEfx5I" +
+			"1HVBhENVvUZGMEMCIAQktY7/qqaU4VWepck7v9SokGQiQFXN8HC2" +
+			"dxRpRC0HAh9cjrD+plFtYLisszrWTt5g6Hhb+zqpS5m9+GFR25qa" +
+			"AQIEACIAIHcf0YrUWWZt1J89Vk49vEL0yEd042CtoWgWqO1IjVaB" +
+			"AQVHUiEDsTQcy6doO2r08SOM1ul+cWfVafrEfx5I1HVBhENVvUYh" +
+			"A95V0eHayAXj+KWMH7+blMAvPbqv4Sf+/KSZXyb4IIO9Uq4iBgOx" +
+			"NBzLp2g7avTxI4zW6X5xZ9Vp+sR/HkjUdUGEQ1W9RhC0prpnAAAA" +
+			"gAAAAIAEAACAIgYD3lXR4drIBeP4pYwfv5uUwC89uq/hJ/78pJlf" +
+			"Jvggg70QtKa6ZwAAAIAAAACABQAAgAAA",
+		err:     fieldErr(ErrInvalidKeyData, "redeem script", "input 0"),
+		comment: "Invalid redeemscript typed key",
+	},
+	{
+		psbt: "cHNidP8BAFUCAAAAASeaIyOl37UfxF8iD6WLD8E+HjNCeSqF1+Ns" +
+			"1jM7XLw5AAAAAAD/////AaBa6gsAAAAAGXapFP/pwAYQl8w7Y28s" +
+			"sEYPpPxCfStFiKwAAAAAAAEBIJVe6gsAAAAAF6kUY0UgD2jRieGt" +
+			"wN8cTRbqjxTA2+uHIgIDsTQcy6doO2r08SOM1ul+cWfVafrEfx5I" +
+			"1HVBhENVvUZGMEMCIAQktY7/qqaU4VWepck7v9SokGQiQFXN8HC2" +
+			"dxRpRC0HAh9cjrD+plFtYLisszrWTt5g6Hhb+zqpS5m9+GFR25qa" +
+			"AQEEIgAgdx/RitRZZm3Unz1WTj28QvTIR3TjYK2haBao7UiNVoEC" +
+			"BQBHUiEDsTQcy6doO2r08SOM1ul+cWfVafrEfx5I1HVBhENVvUYh" +
+			"A95V0eHayAXj+KWMH7+blMAvPbqv4Sf+/KSZXyb4IIO9Uq4iBgOx" +
+			"NBzLp2g7avTxI4zW6X5xZ9Vp+sR/HkjUdUGEQ1W9RhC0prpnAAAA" +
+			"gAAAAIAEAACAIgYD3lXR4drIBeP4pYwfv5uUwC89uq/hJ/78pJlf" +
+			"Jvggg70QtKa6ZwAAAIAAAACABQAAgAAA",
+		err:     fieldErr(ErrInvalidKeyData, "witness script", "input 0"),
+		comment: "Invalid witness script typed key",
+	},
+	{
+		psbt: "cHNidP8BAFUCAAAAASeaIyOl37UfxF8iD6WLD8E+HjNCeSqF1+Ns" +
+			"1jM7XLw5AAAAAAD/////AaBa6gsAAAAAGXapFP/pwAYQl8w7Y28s" +
+			"sEYPpPxCfStFiKwAAAAAAAEBIJVe6gsAAAAAF6kUY0UgD2jRieGt" +
+			"wN8cTRbqjxTA2+uHIgIDsTQcy6doO2r08SOM1ul+cWfVafrEfx5I" +
+			"1HVBhENVvUZGMEMCIAQktY7/qqaU4VWepck7v9SokGQiQFXN8HC2" +
+			"dxRpRC0HAh9cjrD+plFtYLisszrWTt5g6Hhb+zqpS5m9+GFR25qa" +
+			"AQEEIgAgdx/RitRZZm3Unz1WTj28QvTIR3TjYK2haBao7UiNVoEB" +
+			"BUdSIQOxNBzLp2g7avTxI4zW6X5xZ9Vp+sR/HkjUdUGEQ1W9RiED" +
+			"3lXR4drIBeP4pYwfv5uUwC89uq/hJ/78pJlfJvggg71SriEGA7E0" +
+			"HMunaDtq9PEjjNbpfnFn1Wn6xH8eSNR1QYRDVb0QtKa6ZwAAAIAA" +
+			"AACABAAAgCIGA95V0eHayAXj+KWMH7+blMAvPbqv4Sf+/KSZXyb4" +
+			"IIO9ELSmumcAAACAAAAAgAUAAIAAAA==",
+		err:     fieldErr(ErrInvalidKeyData, "BIP 32 derivation", "input 0"),
+		comment: "Invalid bip32 typed key",
+	},
+	{
+		psbt: "cHNidP8BAJoCAAAAAljoeiG1ba8MI76OcHBFbDNvfLqlyHV5JPVF" +
+			"iHuyq911AAAAAAD/////g40EJ9DsZQpoqka7CwmK6kQiwHGyyng1" +
+			"Kgd5WdB86h0BAAAAAP////8CcKrwCAAAAAAWABTYXCtx0AYLCcmI" +
+			"auuBXlCZHdoSTQDh9QUAAAAAFgAUAK6pouXw+HaliN9VRuh0LR2H" +
+			"AI8AAAAAAAIAALsCAAAAAarXOTEBi9JfhK5AC2iEi+CdtwbqwqwY" +
+			"KYur7nGrZW+LAAAAAEhHMEQCIFj2/HxqM+GzFUjUgcgmwBW9MBNa" +
+			"rULNZ3kNq2bSrSQ7AiBKHO0mBMZzW2OT5bQWkd14sA8MWUL7n3UY" +
+			"VvqpOBV9ugH+////AoDw+gIAAAAAF6kUD7lGNCFpa4LIM68kHHjB" +
+			"fdveSTSH0PIKJwEAAAAXqRQpynT4oI+BmZQoGFyXtdhS5AY/YYdl" +
+			"AAAAAQfaAEcwRAIgdAGK1BgAl7hzMjwAFXILNoTMgSOJEEjn282b" +
+			"Va1nnJkCIHPTabdA4+tT3O+jOCPIBwUUylWn3ZVE8VfBZ5EyYRGM" +
+			"AUgwRQIhAPYQOLMI3B2oZaNIUnRvAVdyk0IIxtJEVDk82ZvfIhd3" +
+			"AiAFbmdaZ1ptCgK4WxTl4pB02KJam1dgvqKBb2YZEKAG6gFHUiEC" +
+			"lYO/Oa4KYJdHrRma3dY0+mEIVZ1sXNObTCGD8auW4H8hAtq2H/Sa" +
+			"FNtqfQKwzR+7ePxLGDErW05U2uTbovv+9TbXUq4AAQEgAMLrCwAA" +
+			"AAAXqRS39fr0Dj1ApaRZsds1NfK3L6kh6IcBByMiACCMI1MXN0O1" +
+			"ld+0oHtyuo5C43l9p06H/n2ddJfjsgKJAwEI2gQARzBEAiBi63pV" +
+			"YQenxz9FrEq1od3fb3B1+xJ1lpp/OD7/94S8sgIgDAXbt0cNvy8I" +
+			"VX3TVscyXB7TCRPpls04QJRdsSIo2l8BRzBEAiBl9FulmYtZon/+" +
+			"GnvtAWrx8fkNVLOqj3RQql9WolEDvQIgf3JHA60e25ZoCyhLVtT/" +
+			"y4j3+3Weq74IqjDym4UTg9IBR1IhAwidwQx6xttU+RMpr2FzM9s4" +
+			"jOrQwjH3IzedG5kDCwLcIQI63ZBPPW3PWd25BrDe4jUpt/+57VDl" +
+			"6GFRkmhgIh8Oc1KuACICA6mkw39ZltOqJdusa1cK8GUDlEkpQkYL" +
+			"NUdT7Z7spYdxENkMak8AAACAAAAAgAQAAIAAIgICf2OZdX0u/1Wh" +
+			"Nq0CxoSxg4tlVuXxtrNCgqlLa1AFEJYQ2QxqTwAAAIAAAACABQAA" +
+			"gAA=",
+		err:     fieldErr(ErrInvalidKeyData, "non-witness UTXO", "input 0"),
+		comment: "Invalid non-witness utxo typed key",
+	},
+	{
+		psbt: "cHNidP8BAJoCAAAAAljoeiG1ba8MI76OcHBFbDNvfLqlyHV5JPVF" +
+			"iHuyq911AAAAAAD/////g40EJ9DsZQpoqka7CwmK6kQiwHGyyng1" +
+			"Kgd5WdB86h0BAAAAAP////8CcKrwCAAAAAAWABTYXCtx0AYLCcmI" +
+			"auuBXlCZHdoSTQDh9QUAAAAAFgAUAK6pouXw+HaliN9VRuh0LR2H" +
+			"AI8AAAAAAAEAuwIAAAABqtc5MQGL0l+ErkALaISL4J23BurCrBgp" +
+			"i6vucatlb4sAAAAASEcwRAIgWPb8fGoz4bMVSNSByCbAFb0wE1qt" +
+			"Qs1neQ2rZtKtJDsCIEoc7SYExnNbY5PltBaR3XiwDwxZQvufdRhW" +
+			"+qk4FX26Af7///8CgPD6AgAAAAAXqRQPuUY0IWlrgsgzryQceMF9" +
+			"295JNIfQ8gonAQAAABepFCnKdPigj4GZlCgYXJe12FLkBj9hh2UA" +
+			"AAACBwDaAEcwRAIgdAGK1BgAl7hzMjwAFXILNoTMgSOJEEjn282b" +
+			"Va1nnJkCIHPTabdA4+tT3O+jOCPIBwUUylWn3ZVE8VfBZ5EyYRGM" +
+			"AUgwRQIhAPYQOLMI3B2oZaNIUnRvAVdyk0IIxtJEVDk82ZvfIhd3" +
+			"AiAFbmdaZ1ptCgK4WxTl4pB02KJam1dgvqKBb2YZEKAG6gFHUiEC" +
+			"lYO/Oa4KYJdHrRma3dY0+mEIVZ1sXNObTCGD8auW4H8hAtq2H/Sa" +
+			"FNtqfQKwzR+7ePxLGDErW05U2uTbovv+9TbXUq4AAQEgAMLrCwAA" +
+			"AAAXqRS39fr0Dj1ApaRZsds1NfK3L6kh6IcBByMiACCMI1MXN0O1" +
+			"ld+0oHtyuo5C43l9p06H/n2ddJfjsgKJAwEI2gQARzBEAiBi63pV" +
+			"YQenxz9FrEq1od3fb3B1+xJ1lpp/OD7/94S8sgIgDAXbt0cNvy8I" +
+			"VX3TVscyXB7TCRPpls04QJRdsSIo2l8BRzBEAiBl9FulmYtZon/+" +
+			"GnvtAWrx8fkNVLOqj3RQql9WolEDvQIgf3JHA60e25ZoCyhLVtT/" +
+			"y4j3+3Weq74IqjDym4UTg9IBR1IhAwidwQx6xttU+RMpr2FzM9s4" +
+			"jOrQwjH3IzedG5kDCwLcIQI63ZBPPW3PWd25BrDe4jUpt/+57VDl" +
+			"6GFRkmhgIh8Oc1KuACICA6mkw39ZltOqJdusa1cK8GUDlEkpQkYL" +
+			"NUdT7Z7spYdxENkMak8AAACAAAAAgAQAAIAAIgICf2OZdX0u/1Wh" +
+			"Nq0CxoSxg4tlVuXxtrNCgqlLa1AFEJYQ2QxqTwAAAIAAAACABQAA" +
+			"gAA=",
+		err:     fieldErr(ErrInvalidKeyData, "final scriptSig", "input 0"),
+		comment: "Invalid final scriptsig typed key",
+	},
+	{
+		psbt: "cHNidP8BAJoCAAAAAljoeiG1ba8MI76OcHBFbDNvfLqlyHV5JPVF" +
+			"iHuyq911AAAAAAD/////g40EJ9DsZQpoqka7CwmK6kQiwHGyyng1" +
+			"Kgd5WdB86h0BAAAAAP////8CcKrwCAAAAAAWABTYXCtx0AYLCcmI" +
+			"auuBXlCZHdoSTQDh9QUAAAAAFgAUAK6pouXw+HaliN9VRuh0LR2H" +
+			"AI8AAAAAAAEAuwIAAAABqtc5MQGL0l+ErkALaISL4J23BurCrBgp" +
+			"i6vucatlb4sAAAAASEcwRAIgWPb8fGoz4bMVSNSByCbAFb0wE1qt" +
+			"Qs1neQ2rZtKtJDsCIEoc7SYExnNbY5PltBaR3XiwDwxZQvufdRhW" +
+			"+qk4FX26Af7///8CgPD6AgAAAAAXqRQPuUY0IWlrgsgzryQceMF9" +
+			"295JNIfQ8gonAQAAABepFCnKdPigj4GZlCgYXJe12FLkBj9hh2UA" +
+			"AAABB9oARzBEAiB0AYrUGACXuHMyPAAVcgs2hMyBI4kQSOfbzZtV" +
+			"rWecmQIgc9Npt0Dj61Pc76M4I8gHBRTKVafdlUTxV8FnkTJhEYwB" +
+			"SDBFAiEA9hA4swjcHahlo0hSdG8BV3KTQgjG0kRUOTzZm98iF3cC" +
+			"IAVuZ1pnWm0KArhbFOXikHTYolqbV2C+ooFvZhkQoAbqAUdSIQKV" +
+			"g785rgpgl0etGZrd1jT6YQhVnWxc05tMIYPxq5bgfyEC2rYf9JoU" +
+			"22p9ArDNH7t4/EsYMStbTlTa5Nui+/71NtdSrgABASAAwusLAAAA" +
+			"ABepFLf1+vQOPUClpFmx2zU18rcvqSHohwEHIyIAIIwjUxc3Q7WV" +
+			"37Sge3K6jkLjeX2nTof+fZ10l+OyAokDAggA2gQARzBEAiBi63pV" +
+			"YQenxz9FrEq1od3fb3B1+xJ1lpp/OD7/94S8sgIgDAXbt0cNvy8I" +
+			"VX3TVscyXB7TCRPpls04QJRdsSIo2l8BRzBEAiBl9FulmYtZon/+" +
+			"GnvtAWrx8fkNVLOqj3RQql9WolEDvQIgf3JHA60e25ZoCyhLVtT/" +
+			"y4j3+3Weq74IqjDym4UTg9IBR1IhAwidwQx6xttU+RMpr2FzM9s4" +
+			"jOrQwjH3IzedG5kDCwLcIQI63ZBPPW3PWd25BrDe4jUpt/+57VDl" +
+			"6GFRkmhgIh8Oc1KuACICA6mkw39ZltOqJdusa1cK8GUDlEkpQkYL" +
+			"NUdT7Z7spYdxENkMak8AAACAAAAAgAQAAIAAIgICf2OZdX0u/1Wh" +
+			"Nq0CxoSxg4tlVuXxtrNCgqlLa1AFEJYQ2QxqTwAAAIAAAACABQAA" +
+			"gAA=",
+		err:     fieldErr(ErrInvalidKeyData, "final scriptWitness", "input 1"),
+		comment: "Invalid final script witness typed key",
+	},
+	{
+		psbt: "cHNidP8BAJoCAAAAAljoeiG1ba8MI76OcHBFbDNvfLqlyHV5JPVF" +
+			"iHuyq911AAAAAAD/////g40EJ9DsZQpoqka7CwmK6kQiwHGyyng1" +
+			"Kgd5WdB86h0BAAAAAP////8CcKrwCAAAAAAWABTYXCtx0AYLCcmI" +
+			"auuBXlCZHdoSTQDh9QUAAAAAFgAUAK6pouXw+HaliN9VRuh0LR2H" +
+			"AI8AAAAAAAEAuwIAAAABqtc5MQGL0l+ErkALaISL4J23BurCrBgp" +
+			"i6vucatlb4sAAAAASEcwRAIgWPb8fGoz4bMVSNSByCbAFb0wE1qt" +
+			"Qs1neQ2rZtKtJDsCIEoc7SYExnNbY5PltBaR3XiwDwxZQvufdRhW" +
+			"+qk4FX26Af7///8CgPD6AgAAAAAXqRQPuUY0IWlrgsgzryQceMF9" +
+			"295JNIfQ8gonAQAAABepFCnKdPigj4GZlCgYXJe12FLkBj9hh2UA" +
+			"AAABB9oARzBEAiB0AYrUGACXuHMyPAAVcgs2hMyBI4kQSOfbzZtV" +
+			"rWecmQIgc9Npt0Dj61Pc76M4I8gHBRTKVafdlUTxV8FnkTJhEYwB" +
+			"SDBFAiEA9hA4swjcHahlo0hSdG8BV3KTQgjG0kRUOTzZm98iF3cC" +
+			"IAVuZ1pnWm0KArhbFOXikHTYolqbV2C+ooFvZhkQoAbqAUdSIQKV" +
+			"g785rgpgl0etGZrd1jT6YQhVnWxc05tMIYPxq5bgfyEC2rYf9JoU" +
+			"22p9ArDNH7t4/EsYMStbTlTa5Nui+/71NtdSrgABASAAwusLAAAA" +
+			"ABepFLf1+vQOPUClpFmx2zU18rcvqSHohwEHIyIAIIwjUxc3Q7WV" +
+			"37Sge3K6jkLjeX2nTof+fZ10l+OyAokDAQjaBABHMEQCIGLrelVh" +
+			"B6fHP0WsSrWh3d9vcHX7EnWWmn84Pv/3hLyyAiAMBdu3Rw2/LwhV" +
+			"fdNWxzJcHtMJE+mWzThAlF2xIijaXwFHMEQCIGX0W6WZi1mif/4a" +
+			"e+0BavHx+Q1Us6qPdFCqX1aiUQO9AiB/ckcDrR7blmgLKEtW1P/L" +
+			"iPf7dZ6rvgiqMPKbhROD0gFHUiEDCJ3BDHrG21T5EymvYXMz2ziM" +
+			"6tDCMfcjN50bmQMLAtwhAjrdkE89bc9Z3bkGsN7iNSm3/7ntUOXo" +
+			"YVGSaGAiHw5zUq4AIQIDqaTDf1mW06ol26xrVwrwZQOUSSlCRgs1" +
+			"R1PtnuylhxDZDGpPAAAAgAAAAIAEAACAACICAn9jmXV9Lv9VoTat" +
+			"AsaEsYOLZVbl8bazQoKpS2tQBRCWENkMak8AAACAAAAAgAUAAIAA",
+		err:     fieldErr(ErrInvalidKeyData, "BIP 32 derivation", "output 0"),
+		comment: "Invalid pubkey in output BIP32 derivation paths typed key",
+	},
+	{
+		psbt: "cHNidP8BAHMCAAAAATAa6YblFqHsisW0vGVz0y+DtGXiOtdhZ9aL" +
+			"OOcwtNvbAAAAAAD/////AnR7AQAAAAAAF6kUA6oXrogrXQ1Usl1j" +
+			"EE5P/s57nqKHYEOZOwAAAAAXqRS5IbG6b3IuS/qDtlV6MTmYakLs" +
+			"g4cAAAAAAAEBHwDKmjsAAAAAFgAU0tlLZK4IWH7vyO6xh8YB6Tn5" +
+			"A3wCAwABAAAAAAEAFgAUYunpgv/zTdgjlhAxawkM0qO3R8sAAQAi" +
+			"ACCHa62DLx0WgBXtQSMqnqZaGBXZ7xPA74dZ9ktbKyeKZQEBJVEh" +
+			"A7fOI6AcW0vwCmQlN836uzFbZoMyhnR471EwnSvVf4qHUa4A",
+		err:     fieldErr(ErrInvalidKeyData, "sighash type", "input 0"),
+		comment: "Invalid input sighash type typed key",
+	},
+	{
+		psbt: "cHNidP8BAHMCAAAAATAa6YblFqHsisW0vGVz0y+DtGXiOtdhZ9aL" +
+			"OOcwtNvbAAAAAAD/////AnR7AQAAAAAAF6kUA6oXrogrXQ1Usl1j" +
+			"EE5P/s57nqKHYEOZOwAAAAAXqRS5IbG6b3IuS/qDtlV6MTmYakLs" +
+			"g4cAAAAAAAEBHwDKmjsAAAAAFgAU0tlLZK4IWH7vyO6xh8YB6Tn5" +
+			"A3wAAgAAFgAUYunpgv/zTdgjlhAxawkM0qO3R8sAAQAiACCHa62D" +
+			"Lx0WgBXtQSMqnqZaGBXZ7xPA74dZ9ktbKyeKZQEBJVEhA7fOI6Ac" +
+			"W0vwCmQlN836uzFbZoMyhnR471EwnSvVf4qHUa4A",
+		err:     fieldErr(ErrInvalidKeyData, "redeem script", "output 0"),
+		comment: "Invalid output redeemscript typed key",
+	},
+	{
+		psbt: "cHNidP8BAHMCAAAAATAa6YblFqHsisW0vGVz0y+DtGXiOtdhZ9aL" +
+			"OOcwtNvbAAAAAAD/////AnR7AQAAAAAAF6kUA6oXrogrXQ1Usl1j" +
+			"EE5P/s57nqKHYEOZOwAAAAAXqRS5IbG6b3IuS/qDtlV6MTmYakLs" +
+			"g4cAAAAAAAEBHwDKmjsAAAAAFgAU0tlLZK4IWH7vyO6xh8YB6Tn5" +
+			"A3wAAQAWABRi6emC//NN2COWEDFrCQzSo7dHywABACIAIIdrrYMv" +
+			"HRaAFe1BIyqeploYFdnvE8Dvh1n2S1srJ4plIQEAJVEhA7fOI6Ac" +
+			"W0vwCmQlN836uzFbZoMyhnR471EwnSvVf4qHUa4A",
+		err:     fmt.Errorf("%w: output 1", ErrTruncated),
+		comment: "Invalid output witnessScript typed key",
+	},
+	{
+		psbt: "cHNidP8BAFUCAAAAASeaIyOl37UfxF8iD6WLD8E+HjNCeSqF1+Ns" +
+			"1jM7XLw5AAAAAAD/////AaBa6gsAAAAAGXapFP/pwAYQl8w7Y28s" +
+			"sEYPpPxCfStFiKwAAAAAAAEBIJVe6gsAAAAAF6kUY0UgD2jRieGt" +
+			"wN8cTRbqjxTA2+uHIgIDsTQcy6doO2r08SOM1ul+cWfVafrEfx5I" +
+			"1HVBhENVvUZGMEMCIAQktY7/qqaU4VWepck7v9SokGQiQFXN8HC2" +
+			"dxRpRC0HAh9cjrD+plFtYLisszrWTt5g6Hhb+zqpS5m9+GFR25qa" +
+			"ASICA7E0HMunaDtq9PEjjNbpfnFn1Wn6xH8eSNR1QYRDVb1GRjBD" +
+			"AiAEJLWO/6qmlOFVnqXJO7/UqJBkIkBVzfBwtncUaUQtBwIfXI6w" +
+			"/qZRbWC4rLM61k7eYOh4W/s6qUuZvfhhUduamgEBBCIAIHcf0YrU" +
+			"WWZt1J89Vk49vEL0yEd042CtoWgWqO1IjVaBAQVHUiEDsTQcy6do" +
+			"O2r08SOM1ul+cWfVafrEfx5I1HVBhENVvUYhA95V0eHayAXj+KWM" +
+			"H7+blMAvPbqv4Sf+/KSZXyb4IIO9Uq4iBgOxNBzLp2g7avTxI4zW" +
+			"6X5xZ9Vp+sR/HkjUdUGEQ1W9RhC0prpnAAAAgAAAAIAEAACAIgYD" +
+			"3lXR4drIBeP4pYwfv5uUwC89uq/hJ/78pJlfJvggg70QtKa6ZwAA" +
+			"AIAAAACABQAAgAAA",
+		err:     fieldErr(ErrDuplicateKey, "partial signature", "input 0"),
+		comment: "Invalid duplicate PartialSig",
+	},
+	{
+		psbt: "cHNidP8BAFUCAAAAASeaIyOl37UfxF8iD6WLD8E+HjNCeSqF1+Ns" +
+			"1jM7XLw5AAAAAAD/////AaBa6gsAAAAAGXapFP/pwAYQl8w7Y28s" +
+			"sEYPpPxCfStFiKwAAAAAAAEBIJVe6gsAAAAAF6kUY0UgD2jRieGt" +
+			"wN8cTRbqjxTA2+uHIgIDsTQcy6doO2r08SOM1ul+cWfVafrEfx5I" +
+			"1HVBhENVvUZGMEMCIAQktY7/qqaU4VWepck7v9SokGQiQFXN8HC2" +
+			"dxRpRC0HAh9cjrD+plFtYLisszrWTt5g6Hhb+zqpS5m9+GFR25qa" +
+			"AQEEIgAgdx/RitRZZm3Unz1WTj28QvTIR3TjYK2haBao7UiNVoEB" +
+			"BUdSIQOxNBzLp2g7avTxI4zW6X5xZ9Vp+sR/HkjUdUGEQ1W9RiED" +
+			"3lXR4drIBeP4pYwfv5uUwC89uq/hJ/78pJlfJvggg71SriIGA7E0" +
+			"HMunaDtq9PEjjNbpfnFn1Wn6xH8eSNR1QYRDVb1GELSmumcAAACA" +
+			"AAAAgAQAAIAiBgOxNBzLp2g7avTxI4zW6X5xZ9Vp+sR/HkjUdUGE" +
+			"Q1W9RhC0prpnAAAAgAAAAIAFAACAAAA=",
+		err:     fieldErr(ErrDuplicateKey, "BIP 32 derivation", "input 0"),
+		comment: "Invalid duplicate BIP32 derivation (different derivs, same key)",
+	},
+	{
+		psbt: "cHNidP8BAHECAAAAASd0Srq/MCf+DWzyOpbu4u+xiO9SMBlUWFiD" +
+			"5ptmJLJCAAAAAAD/////Anh8AQAAAAAAFgAUg6fjS9mf8DpJYu+K" +
+			"GhAbspVGHs5gawQqAQAAABYAFHrDad8bIOAz1hFmI5V7CsSfPFLo" +
+			"AAAAAAABASsA8gUqAQAAACJRIFosLPW1LPMfg60ujaY/8DGD7Nj2" +
+			"CcdRCuikjgORCgdXARchAv40kGTJjW4qhT+jybEr2LMEoZwZXGDv" +
+			"p+4jkwRtP6IyAAAA",
+		err:     fieldErr(ErrInvalidValue, "taproot internal key", "input 0"),
+		comment: "Taproot internal key of 33 bytes in an input",
+	},
+	{
+		psbt: "cHNidP8BAHECAAAAASd0Srq/MCf+DWzyOpbu4u+xiO9SMBlUWFiD" +
+			"5ptmJLJCAAAAAAD/////Anh8AQAAAAAAFgAUg6fjS9mf8DpJYu+K" +
+			"GhAbspVGHs5gawQqAQAAABYAFHrDad8bIOAz1hFmI5V7CsSfPFLo" +
+			"AAAAAAABASsA8gUqAQAAACJRIFosLPW1LPMfg60ujaY/8DGD7Nj2" +
+			"CcdRCuikjgORCgdXARM/Fzuz02wHSvtxb+xjB6BpouRQuZXzyCeF" +
+			"lFq43w4kJg3NcDsMvzTeOZGEqUgawrNYbbZgHwJqd/fkk4SBvDR1" +
+			"AAAA",
+		err:     fieldErr(ErrInvalidValue, "taproot key signature", "input 0"),
+		comment: "Taproot key path signature of 63 bytes",
+	},
+	{
+		psbt: "cHNidP8BAHECAAAAASd0Srq/MCf+DWzyOpbu4u+xiO9SMBlUWFiD" +
+			"5ptmJLJCAAAAAAD/////Anh8AQAAAAAAFgAUg6fjS9mf8DpJYu+K" +
+			"GhAbspVGHs5gawQqAQAAABYAFHrDad8bIOAz1hFmI5V7CsSfPFLo" +
+			"AAAAAAABASsA8gUqAQAAACJRIFosLPW1LPMfg60ujaY/8DGD7Nj2" +
+			"CcdRCuikjgORCgdXARNCFzuz02wHSvtxb+xjB6BpouRQuZXzyCeF" +
+			"lFq43w4kJg3NcDsMvzTeOZGEqUgawrNYbbZgHwJqd/fkk4SBvDR1" +
+			"FwGqAAAA",
+		err:     fieldErr(ErrInvalidValue, "taproot key signature", "input 0"),
+		comment: "Taproot key path signature of 66 bytes",
+	},
+	{
+		psbt: "cHNidP8BAHECAAAAASd0Srq/MCf+DWzyOpbu4u+xiO9SMBlUWFiD" +
+			"5ptmJLJCAAAAAAD/////Anh8AQAAAAAAFgAUg6fjS9mf8DpJYu+K" +
+			"GhAbspVGHs5gawQqAQAAABYAFHrDad8bIOAz1hFmI5V7CsSfPFLo" +
+			"AAAAAAABASsA8gUqAQAAACJRIFosLPW1LPMfg60ujaY/8DGD7Nj2" +
+			"CcdRCuikjgORCgdXIhYC/jSQZMmNbiqFP6PJsSvYswShnBlcYO+n" +
+			"7iOTBG0/ojIZAHcrLadWAACAAQAAgAAAAIABAAAAAAAAAAAAAA==",
+		err: fieldErr(ErrInvalidKeyData, "taproot BIP 32 derivation",
+			"input 0"),
+		comment: "Taproot derivation of a 33 byte key in an input",
+	},
+	{
+		psbt: "cHNidP8BAH0CAAAAASd0Srq/MCf+DWzyOpbu4u+xiO9SMBlUWFiD" +
+			"5ptmJLJCAAAAAAD/////Aoh7AQAAAAAAFgAUI4KHHH6EIaAAk/dU" +
+			"2RKB5nWHS59gawQqAQAAACJRIFosLPW1LPMfg60ujaY/8DGD7Nj2" +
+			"CcdRCuikjgORCgdXAAAAAAABASsA8gUqAQAAACJRIFosLPW1LPMf" +
+			"g60ujaY/8DGD7Nj2CcdRCuikjgORCgdXAAABBSEC/jSQZMmNbiqF" +
+			"P6PJsSvYswShnBlcYO+n7iOTBG0/ojIA",
+		err:     fieldErr(ErrInvalidValue, "taproot internal key", "output 1"),
+		comment: "Taproot internal key of 33 bytes in an output",
+	},
+	{
+		psbt: "cHNidP8BAH0CAAAAASd0Srq/MCf+DWzyOpbu4u+xiO9SMBlUWFiD" +
+			"5ptmJLJCAAAAAAD/////Aoh7AQAAAAAAFgAUI4KHHH6EIaAAk/dU" +
+			"2RKB5nWHS59gawQqAQAAACJRIFosLPW1LPMfg60ujaY/8DGD7Nj2" +
+			"CcdRCuikjgORCgdXAAAAAAABASsA8gUqAQAAACJRIFosLPW1LPMf" +
+			"g60ujaY/8DGD7Nj2CcdRCuikjgORCgdXAAAiBwL+NJBkyY1uKoU/" +
+			"o8mxK9izBKGcGVxg76fuI5MEbT+iMhkAdystp1YAAIABAACAAAAA" +
+			"gAEAAAAAAAAAAA==",
+		err: fieldErr(ErrInvalidKeyData, "taproot BIP 32 derivation",
+			"output 1"),
+		comment: "Taproot derivation of a 33 byte key in an output",
+	},
+	{
+		psbt: "cHNidP8BAF4CAAAAAZvUh2UjC/mnLmYgAflyVW5U8Mb5f+tWvLVg" +
+			"DYF/aZUmAQAAAAD/////AUjmBSoBAAAAIlEgAw2k/OT32yjCyylR" +
+			"Yx4ANxOFZZf+ljiCy1AOaBEsymMAAAAAAAEBKwDyBSoBAAAAIlEg" +
+			"wiR++/2SrEf29AuNQtFpF1oZ+p+hDkol1/NetN2FtpJCFAIssTrG" +
+			"gkjegGqmo2Wc88A+toIdCcgRSk6Gj+vehlu20s2XDhX1P8DIL5UP" +
+			"1WD/qRm3YXK+AXNoqJkTrwdPQAsJQIl1aqNznMxonsD886NgvjLM" +
+			"C1mxbpOh6LtGBXJrLKej/3BsQXZkljKyzGjh+RK4pXjjcZzncQiF" +
+			"x6lm9JvNQ8sAAA==",
+		err: fieldErr(ErrInvalidKeyData, "taproot script signature",
+			"input 0"),
+		comment: "Taproot script signature whose key is 65 bytes",
+	},
+	{
+		psbt: "cHNidP8BAF4CAAAAAZvUh2UjC/mnLmYgAflyVW5U8Mb5f+tWvLVg" +
+			"DYF/aZUmAQAAAAD/////AUjmBSoBAAAAIlEgAw2k/OT32yjCyylR" +
+			"Yx4ANxOFZZf+ljiCy1AOaBEsymMAAAAAAAEBKwDyBSoBAAAAIlEg" +
+			"wiR++/2SrEf29AuNQtFpF1oZ+p+hDkol1/NetN2FtpJBFCyxOsaC" +
+			"SN6AaqajZZzzwD62gh0JyBFKToaP696GW7bSzZcOFfU/wMgvlQ/V" +
+			"YP+pGbdhcr4Bc2iomROvB09ACwlCiXVqo3OczGiewPzzo2C+MswL" +
+			"WbFuk6Hou0YFcmssp6P/cGxBdmSWMrLMaOH5ErileONxnOdxCIXH" +
+			"qWb0m81DywEBAAA=",
+		err:     fieldErr(ErrInvalidValue, "taproot script signature", "input 0"),
+		comment: "Taproot script signature of 66 bytes",
+	},
+	{
+		psbt: "cHNidP8BAF4CAAAAAZvUh2UjC/mnLmYgAflyVW5U8Mb5f+tWvLVg" +
+			"DYF/aZUmAQAAAAD/////AUjmBSoBAAAAIlEgAw2k/OT32yjCyylR" +
+			"Yx4ANxOFZZf+ljiCy1AOaBEsymMAAAAAAAEBKwDyBSoBAAAAIlEg" +
+			"wiR++/2SrEf29AuNQtFpF1oZ+p+hDkol1/NetN2FtpJBFCyxOsaC" +
+			"SN6AaqajZZzzwD62gh0JyBFKToaP696GW7bSzZcOFfU/wMgvlQ/V" +
+			"YP+pGbdhcr4Bc2iomROvB09ACwk5iXVqo3OczGiewPzzo2C+MswL" +
+			"WbFuk6Hou0YFcmssp6P/cGxBdmSWMrLMaOH5ErileONxnOdxCIXH" +
+			"qWb0m81DywAA",
+		err:     fmt.Errorf("%w: input 0", ErrTruncated),
+		comment: "Taproot script signature of 57 bytes, in a map that runs past the end",
+	},
+	{
+		psbt: "cHNidP8BAF4CAAAAAZvUh2UjC/mnLmYgAflyVW5U8Mb5f+tWvLVg" +
+			"DYF/aZUmAQAAAAD/////AUjmBSoBAAAAIlEgAw2k/OT32yjCyylR" +
+			"Yx4ANxOFZZf+ljiCy1AOaBEsymMAAAAAAAEBKwDyBSoBAAAAIlEg" +
+			"wiR++/2SrEf29AuNQtFpF1oZ+p+hDkol1/NetN2FtpJjFcFQkpt0" +
+			"waBJVLeLS2A16XpeB4paDyjsltVHv+6azoA6wG99YgWelJehpKJn" +
+			"Vp2YdtpgEBr/OONSm5uTnOf5GulwEV8uSQr3zEXE94UR82BXzlxa" +
+			"XFYyWin7RN/CA/NW4fgAIyAssTrGgkjegGqmo2Wc88A+toIdCcgR" +
+			"Sk6Gj+vehlu20qzAAAA=",
+		err:     fieldErr(ErrInvalidKeyData, "taproot leaf script", "input 0"),
+		comment: "Taproot leaf script whose control block is 98 bytes",
+	},
+	{
+		psbt: "cHNidP8BAF4CAAAAAZvUh2UjC/mnLmYgAflyVW5U8Mb5f+tWvLVg" +
+			"DYF/aZUmAQAAAAD/////AUjmBSoBAAAAIlEgAw2k/OT32yjCyylR" +
+			"Yx4ANxOFZZf+ljiCy1AOaBEsymMAAAAAAAEBKwDyBSoBAAAAIlEg" +
+			"wiR++/2SrEf29AuNQtFpF1oZ+p+hDkol1/NetN2FtpJhFcFQkpt0" +
+			"waBJVLeLS2A16XpeB4paDyjsltVHv+6azoA6wG99YgWelJehpKJn" +
+			"Vp2YdtpgEBr/OONSm5uTnOf5GulwEV8uSQr3zEXE94UR82BXzlxa" +
+			"XFYyWin7RN/CA/NW4SMgLLE6xoJI3oBqpqNlnPPAPraCHQnIEUpO" +
+			"ho/r3oZbttKswAAA",
+		err:     fieldErr(ErrInvalidKeyData, "taproot leaf script", "input 0"),
+		comment: "Taproot leaf script whose control block is 96 bytes",
+	},
+}
+
+// SpecVectors returns the valid and invalid packets of the BIP.
+func SpecVectors() []Vector {
+	var vectors []Vector
+	for _, v := range append(specValid, specInvalid...) {
+		vectors = append(vectors, Vector{
+			PSBT:      v.psbt,
+			Err:       v.err,
+			StrictErr: v.err,
+			Comment:   v.comment,
+		})
+	}
+	return vectors
+}
+
+// edgeTxHex is the transaction of the BIP's Creator example, with two inputs
+// and two P2WPKH outputs, which the edge case vectors are built on.
+const edgeTxHex = "020000000258e87a21b56daf0c23be8e7070456c336f7cbaa5" +
+	"c8757924f545887bb2abdd750000000000ffffffff838d0427d0ec650a68aa46bb" +
+	"0b098aea4422c071b2ca78352a077959d07cea1d0100000000ffffffff0270aaf0" +
+	"0800000000160014d85c2b71d0060b09c9886aeb815e50991dda124d00e1f50500" +
+	"00000016001400aea9a2e5f0f876a588df5546e8742d1d87008f00000000"
+
+// edgeMaster is the master key of the BIP's Updater example.
+const edgeMaster = "tprv8ZgxMBicQKsPd9TeAdPADNnSyH9SSUUbTVeFszDE23Ki6TBB5nC" +
+	"efAdHkK8Fm3qMQR6sHwA56zqRmKmxnHk37JkiFzvncDqoKmPWubu7hDF"
+
+// rawPacket serializes maps of pairs as they are, so that vectors can have
+// keys out of order or of invalid types.
+func rawPacket(maps ...[]pair) []byte {
+	var buf bytes.Buffer
+	buf.Write(magic)
+	for _, pairs := range maps {
+		writeMap(&buf, pairs)
+	}
+	return buf.Bytes()
+}
+
+// mustSerialize serializes a packet in base64, panicking on error since the
+// vectors are built from constants.
+func mustSerialize(p *Packet) string {
+	s, err := p.Base64()
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// EdgeVectors returns packets that exercise what the vectors of the BIP
+// don't: witness items whose sizes take three and five bytes, proprietary
+// keys and keys of unknown types in every map, keys out of canonical order
+// that only ParseStrict rejects, preimages and xpubs, and malformed
+// proprietary keys, versions, UTXOs, values and compact sizes. They are built
+// on the transaction of the BIP's Creator example, so the same set is
+// returned on every call.
+func EdgeVectors() []Vector {
+	txBytes, err := hex.DecodeString(edgeTxHex)
+	if err != nil {
+		panic(err)
+	}
+	tx, err := parseTx(txBytes, false)
+	if err != nil {
+		panic(err)
+	}
+	master, err := bip32.ParseKey(edgeMaster)
+	if err != nil {
+		panic(err)
+	}
+	newPacket := func() *Packet {
+		p, err := New(tx)
+		if err != nil {
+			panic(err)
+		}
+		return p
+	}
+
+	var vectors []Vector
+	valid := func(p *Packet, comment string) {
+		vectors = append(vectors, Vector{
+			PSBT:    mustSerialize(p),
+			Comment: comment,
+		})
+	}
+	nonCanonical := func(data []byte, comment string) {
+		vectors = append(vectors, Vector{
+			PSBT:      base64.StdEncoding.EncodeToString(data),
+			StrictErr: ErrNonCanonical,
+			Comment:   comment,
+		})
+	}
+	invalid := func(data []byte, err error, comment string) {
+		vectors = append(vectors, Vector{
+			PSBT:      base64.StdEncoding.EncodeToString(data),
+			Err:       err,
+			StrictErr: err,
+			Comment:   comment,
+		})
+	}
+
+	// Raw packets have the unsigned transaction as their global map
+	// unless they say otherwise, and empty maps for the rest.
+	txPair := pair{key: makeKey(GlobalUnsignedTx), value: txBytes}
+	raw := func(global, input, output []pair) []byte {
+		return rawPacket(append([]pair{txPair}, global...), input, nil,
+			output, nil)
+	}
+	sig := bytes.Repeat([]byte{0x30}, 71)
+
+	p := newPacket()
+	p.Inputs[0].FinalScriptWitness = wire.TxWitness{
+		sig, bytes.Repeat([]byte{0x51}, 253),
+	}
+	valid(p, "Final scriptWitness with an item of 253 bytes, whose size "+
+		"takes three bytes")
+
+	p = newPacket()
+	p.Inputs[1].FinalScriptWitness = wire.TxWitness{
+		sig, bytes.Repeat([]byte{0x51}, 0x10000),
+	}
+	valid(p, "Final scriptWitness with an item of 65536 bytes, whose size "+
+		"takes five bytes")
+
+	p = newPacket()
+	p.Inputs[0].FinalScriptWitness = wire.TxWitness{nil, sig, {}}
+	valid(p, "Final scriptWitness with empty items")
+
+	p = newPacket()
+	p.Unknowns = []Unknown{
+		{Key: []byte{0x50}, Value: []byte{0x01}},
+		{Key: []byte{0x50, 0x00}, Value: nil},
+	}
+	p.Inputs[1].Unknowns = []Unknown{
+		{Key: []byte{0x09, 0x01}, Value: []byte{0x02}},
+		{Key: []byte{0xfd, 0x00, 0x01, 0xaa}, Value: []byte{0x03}},
+	}
+	p.Outputs[0].Unknowns = []Unknown{
+		{Key: []byte{0x7f}, Value: bytes.Repeat([]byte{0x04}, 300)},
+	}
+	valid(p, "Keys of unknown types in every map, one with a type taking "+
+		"three bytes")
+
+	p = newPacket()
+	p.Proprietary = []Proprietary{
+		{Identifier: []byte("bips"), Subtype: 0, Value: []byte{0x01}},
+		{Identifier: []byte("bips"), Subtype: 1, KeyData: []byte{0xaa},
+			Value: []byte{0x02}},
+	}
+	p.Inputs[0].Proprietary = []Proprietary{
+		{Identifier: nil, Subtype: 0xfd, Value: []byte{0x03}},
+	}
+	p.Outputs[1].Proprietary = []Proprietary{
+		{Identifier: []byte("bips"), Subtype: 0x10000,
+			KeyData: []byte{0xbb, 0xcc}, Value: nil},
+	}
+	valid(p, "Proprietary keys in every map, with an empty identifier and "+
+		"subtypes taking three and five bytes")
+
+	p = newPacket()
+	for i := uint32(0); i < 2; i++ {
+		path := bip32.Path{bip32.HardenedKeyStart + 84,
+			bip32.HardenedKeyStart + 1, bip32.HardenedKeyStart + i}
+		xpub, err := master.Derive(path)
+		if err != nil {
+			panic(err)
+		}
+		p.XPubs = append(p.XPubs, XPub{
+			ExtendedKey: xpub.Neuter().Serialize(),
+			KeyOrigin: KeyOrigin{
+				Fingerprint: master.Fingerprint(),
+				Path:        path,
+			},
+		})
+	}
+	valid(p, "Global xpubs with their origins")
+
+	p = newPacket()
+	for _, typ := range []uint64{InputRIPEMD160, InputSHA256,
+		InputHash160, InputHash256} {
+
+		preimage := []byte{byte(typ)}
+		p.Inputs[0].Preimages = append(p.Inputs[0].Preimages, Preimage{
+			Type:     typ,
+			Hash:     hashPreimage(typ, preimage),
+			Preimage: preimage,
+		})
+	}
+	valid(p, "Preimages of every hash type")
+
+	p = newPacket()
+	key, err := master.Child(0)
+	if err != nil {
+		panic(err)
+	}
+	pubKey, err := btcec.ParsePubKey(key.PublicKey())
+	if err != nil {
+		panic(err)
+	}
+	p.Inputs[0].PartialSigs = []PartialSig{{
+		PubKey:    pubKey.SerializeUncompressed(),
+		Signature: sig,
+	}}
+	p.Inputs[0].Derivations = []Derivation{{
+		PubKey: pubKey.SerializeUncompressed(),
+		KeyOrigin: KeyOrigin{
+			Fingerprint: master.Fingerprint(),
+			Path:        bip32.Path{0},
+		},
+	}}
+	valid(p, "Partial signature and derivation of an uncompressed key")
+
+	p = newPacket()
+	p.Inputs[1].Derivations = []Derivation{{
+		PubKey:    key.PublicKey(),
+		KeyOrigin: KeyOrigin{Fingerprint: master.Fingerprint()},
+	}}
+	valid(p, "Derivation of a master key, with an empty path")
+
+	sighash := []byte{0x01, 0x00, 0x00, 0x00}
+	witnessUtxo := serializeTxOut(wire.NewTxOut(1000,
+		tx.TxOut[0].PkScript))
+	nonCanonical(raw(nil, []pair{
+		{key: makeKey(InputSighashType), value: sighash},
+		{key: makeKey(InputWitnessUtxo), value: witnessUtxo},
+	}, nil), "Input keys out of order")
+
+	nonCanonical(rawPacket([]pair{
+		{key: []byte{0x50}, value: []byte{0x01}},
+		txPair,
+	}, nil, nil, nil, nil), "Unknown global key before the unsigned "+
+		"transaction")
+
+	nonCanonical(raw(nil, nil, []pair{
+		{key: makeKey(OutputProprietary, []byte{0x01, 0x62, 0x01}),
+			value: nil},
+		{key: makeKey(OutputProprietary, []byte{0x01, 0x62, 0x00}),
+			value: nil},
+	}), "Output proprietary keys out of order")
+
+	nonCanonical(raw(nil, []pair{
+		{key: makeKey(InputRedeemScript), value: nil},
+	}, nil), "Empty redeem script, which Serialize leaves out")
+
+	invalid(raw(nil, []pair{
+		{key: makeKey(InputProprietary, []byte{0x05, 0x62}),
+			value: nil},
+	}, nil), fieldErr(ErrInvalidKeyData, "proprietary key", "input 0"),
+		"Proprietary key with a truncated identifier")
+
+	invalid(raw(nil, []pair{
+		{key: makeKey(InputProprietary, []byte{0x01, 0x62}),
+			value: nil},
+	}, nil), fieldErr(ErrInvalidKeyData, "proprietary key", "input 0"),
+		"Proprietary key without a subtype")
+
+	invalid(raw(nil, nil, []pair{
+		{key: makeKey(OutputProprietary, []byte{0x01, 0x62, 0x00}),
+			value: []byte{0x01}},
+		{key: makeKey(OutputProprietary, []byte{0x01, 0x62, 0x00}),
+			value: []byte{0x02}},
+	}), fieldErr(ErrDuplicateKey, "proprietary key", "output 0"),
+		"Duplicate proprietary keys with different values")
+
+	invalid(append(raw(nil, nil, nil), 0x00), ErrTrailingData,
+		"Data after the last output map")
+
+	invalid(raw([]pair{
+		{key: makeKey(GlobalVersion), value: []byte{1, 0, 0, 0}},
+	}, nil, nil), fmt.Errorf("%w %d", ErrUnsupportedVersion, 1),
+		"Version 1")
+
+	invalid(raw([]pair{
+		{key: makeKey(GlobalVersion), value: []byte{0, 0, 0}},
+	}, nil, nil), fieldErr(ErrInvalidValue, "version", "global map"),
+		"Version of three bytes")
+
+	other := wire.NewMsgTx(2)
+	other.AddTxIn(wire.NewTxIn(&wire.OutPoint{}, nil, nil))
+	other.AddTxOut(wire.NewTxOut(1000, tx.TxOut[0].PkScript))
+	invalid(raw(nil, []pair{
+		{key: makeKey(InputNonWitnessUtxo),
+			value: serializeTx(other, true)},
+	}, nil), fmt.Errorf("%w: non-witness UTXO of input 0",
+		ErrUtxoMismatch), "Non-witness UTXO of another transaction")
+
+	invalid(raw(nil, []pair{
+		{key: makeKey(InputWitnessUtxo),
+			value: append(witnessUtxo, 0x00)},
+	}, nil), fieldErr(ErrInvalidValue, "witness UTXO", "input 0"),
+		"Witness UTXO with trailing data")
+
+	invalid(raw(nil, []pair{
+		{key: makeKey(InputSighashType), value: sighash[:3]},
+	}, nil), fieldErr(ErrInvalidValue, "sighash type", "input 0"),
+		"Sighash type of three bytes")
+
+	invalid(raw(nil, []pair{
+		{key: makeKey(InputFinalScriptWitness),
+			value: []byte{0x02, 0x01, 0x51}},
+	}, nil), fieldErr(ErrInvalidValue, "final scriptWitness", "input 0"),
+		"Final scriptWitness with fewer items than its count")
+
+	invalid(raw(nil, []pair{
+		{key: makeKey(InputSHA256, make([]byte, 32)),
+			value: []byte{0x01}},
+	}, nil), fieldErr(ErrInvalidValue, "SHA256 preimage", "input 0"),
+		"SHA256 preimage that doesn't hash to its key")
+
+	invalid(raw(nil, []pair{
+		{key: makeKey(InputHash160, make([]byte, 32)),
+			value: []byte{0x01}},
+	}, nil), fieldErr(ErrInvalidKeyData, "HASH160 preimage", "input 0"),
+		"HASH160 preimage with a hash of 32 bytes")
+
+	invalid(raw([]pair{{
+		key:   makeKey(GlobalXPub, make([]byte, 78)),
+		value: []byte{0, 0, 0, 0, 1, 0},
+	}}, nil, nil), fieldErr(ErrInvalidValue, "xpub", "global map"),
+		"Xpub with a path that isn't a multiple of four bytes")
+
+	invalid(raw([]pair{{
+		key:   makeKey(GlobalXPub, make([]byte, 33)),
+		value: []byte{0, 0, 0, 0},
+	}}, nil, nil), fieldErr(ErrInvalidKeyData, "xpub", "global map"),
+		"Xpub of 33 bytes")
+
+	// The key length of the first input map takes three bytes, which
+	// can't be written with writeMap.
+	data := rawPacket([]pair{txPair})
+	data = append(data, 0xfd, 0x01, 0x00, InputWitnessScript, 0x01, 0x51,
+		0x00, 0x00, 0x00, 0x00)
+	invalid(data, fmt.Errorf("%w: input 0", ErrInvalidCompactSize),
+		"Key length in three bytes where one would do")
+
+	data = rawPacket([]pair{txPair}, nil, nil, nil, []pair{{
+		key:   makeKey(OutputRedeemScript),
+		value: []byte{0x51},
+	}})
+	invalid(data[:len(data)-1], fmt.Errorf("%w: output 1", ErrTruncated),
+		"Last map without its separator")
+
+	return vectors
+}
+
+// randomBytes returns n random bytes from the generator.
+func randomBytes(rng *rand.Rand, n int) []byte {
+	b := make([]byte, n)
+	rng.Read(b)
+	return b
+}
+
+// randomPubKey returns the compressed public key of a random private key.
+func randomPubKey(rng *rand.Rand) []byte {
+	key, _ := btcec.PrivKeyFromBytes(randomBytes(rng, 32))
+	return key.PubKey().SerializeCompressed()
+}
+
+// randomOrigin returns an origin with a random fingerprint and a random
+// path of up to five indexes.
+func randomOrigin(rng *rand.Rand) KeyOrigin {
+	var origin KeyOrigin
+	rng.Read(origin.Fingerprint[:])
+	for i := rng.Intn(6); i > 0; i-- {
+		origin.Path = append(origin.Path, rng.Uint32())
+	}
+	return origin
+}
+
+// randomExtras returns random proprietary keys and keys of unknown types,
+// whose types are never those of known keys.
+func randomExtras(rng *rand.Rand) ([]Proprietary, []Unknown) {
+	var props []Proprietary
+	for i := rng.Intn(3); i > 0; i-- {
+		props = append(props, Proprietary{
+			Identifier: randomBytes(rng, rng.Intn(8)),
+			Subtype:    uint64(rng.Intn(0x20000)),
+			KeyData:    randomBytes(rng, 4+rng.Intn(8)),
+			Value:      randomBytes(rng, rng.Intn(40)),
+		})
+	}
+	var unknowns []Unknown
+	for i := rng.Intn(3); i > 0; i-- {
+		unknowns = append(unknowns, Unknown{
+			Key: append([]byte{byte(0x20 + rng.Intn(0x60))},
+				randomBytes(rng, 4+rng.Intn(8))...),
+			Value: randomBytes(rng, rng.Intn(40)),
+		})
+	}
+	return props, unknowns
+}
+
+// randomPacket returns a packet of a random transaction whose inputs and
+// outputs have random fields.
+func randomPacket(rng *rand.Rand) *Packet {
+	tx := wire.NewMsgTx(int32(1 + rng.Intn(2)))
+	tx.LockTime = uint32(rng.Intn(2)) * rng.Uint32()
+	for i := 1 + rng.Intn(3); i > 0; i-- {
+		var prevOut wire.OutPoint
+		rng.Read(prevOut.Hash[:])
+		prevOut.Index = uint32(rng.Intn(4))
+		tx.AddTxIn(wire.NewTxIn(&prevOut, nil, nil))
+	}
+	for i := 1 + rng.Intn(3); i > 0; i-- {
+		script, err := txscript.NewScriptBuilder().AddOp(txscript.OP_0).
+			AddData(btcutil.Hash160(randomPubKey(rng))).Script()
+		if err != nil {
+			panic(err)
+		}
+		tx.AddTxOut(wire.NewTxOut(rng.Int63n(1e10), script))
+	}
+	p, err := New(tx)
+	if err != nil {
+		panic(err)
+	}
+	p.Proprietary, p.Unknowns = randomExtras(rng)
+
+	for i := range p.Inputs {
+		in := &p.Inputs[i]
+		in.WitnessUtxo = wire.NewTxOut(rng.Int63n(1e10),
+			randomBytes(rng, 22+rng.Intn(12)))
+		if rng.Intn(2) == 0 {
+			sum := sha256.Sum256(randomBytes(rng, 8))
+			in.FinalScriptWitness = wire.TxWitness{
+				randomBytes(rng, rng.Intn(80)),
+				randomBytes(rng, []int{33, 252, 253, 520}[rng.Intn(4)]),
+				sum[:],
+			}
+		} else {
+			for j := rng.Intn(3); j > 0; j-- {
+				pubKey := randomPubKey(rng)
+				in.PartialSigs = append(in.PartialSigs, PartialSig{
+					PubKey:    pubKey,
+					Signature: randomBytes(rng, 70+rng.Intn(3)),
+				})
+				in.Derivations = append(in.Derivations, Derivation{
+					PubKey:    pubKey,
+					KeyOrigin: randomOrigin(rng),
+				})
+			}
+			if rng.Intn(2) == 0 {
+				sighashType := txscript.SigHashType(rng.Intn(0x84))
+				in.SighashType = &sighashType
+			}
+			in.WitnessScript = randomBytes(rng, rng.Intn(100))
+		}
+		if rng.Intn(3) == 0 {
+			typ := uint64(InputRIPEMD160 + rng.Intn(4))
+			preimage := randomBytes(rng, 32)
+			in.Preimages = []Preimage{{
+				Type:     typ,
+				Hash:     hashPreimage(typ, preimage),
+				Preimage: preimage,
+			}}
+		}
+		in.Proprietary, in.Unknowns = randomExtras(rng)
+	}
+
+	for i := range p.Outputs {
+		out := &p.Outputs[i]
+		if rng.Intn(2) == 0 {
+			out.Derivations = []Derivation{{
+				PubKey:    randomPubKey(rng),
+				KeyOrigin: randomOrigin(rng),
+			}}
+		}
+		out.Proprietary, out.Unknowns = randomExtras(rng)
+	}
+	return p
+}
+
+// RandomVectors returns count valid packets of random transactions, whose
+// inputs and outputs have random fields, proprietary keys and keys of
+// unknown types. The vectors depend only on rngSeed and count.
+func RandomVectors(rngSeed int64, count int) []Vector {
+	rng := rand.New(rand.NewSource(rngSeed))
+	vectors := make([]Vector, 0, count)
+	for i := 0; i < count; i++ {
+		vectors = append(vectors, Vector{
+			PSBT:    mustSerialize(randomPacket(rng)),
+			Comment: fmt.Sprintf("Random packet %d", i),
+		})
+	}
+	return vectors
+}
+
+// CheckVector parses the vector's packet with Parse and ParseStrict and checks
+// their outcomes, and that a packet Parse accepts serializes to a packet
+// that ParseStrict accepts and that serializes the same.
+func CheckVector(v Vector) error {
+	data, err := base64.StdEncoding.DecodeString(v.PSBT)
+	if err != nil {
+		return err
+	}
+	p, err := Parse(data)
+	if !vectorfile.SameError(err, v.Err) {
+		return fmt.Errorf("%w: Parse gave %v, expected %v",
+			ErrVectorMismatch, err, v.Err)
+	}
+	_, err = ParseStrict(data)
+	if !vectorfile.SameError(err, v.StrictErr) {
+		return fmt.Errorf("%w: ParseStrict gave %v, expected %v",
+			ErrVectorMismatch, err, v.StrictErr)
+	}
+	if p == nil {
+		return nil
+	}
+
+	serialized, err := p.Serialize()
+	if err != nil {
+		return err
+	}
+	if _, err := ParseStrict(serialized); err != nil {
+		return fmt.Errorf("%w: serialized again, ParseStrict gave %v",
+			ErrVectorMismatch, err)
+	}
+	return nil
+}
+
+// withPair returns the pairs with the value of the key of the type replaced,
+// or added at the end if no pair has the key. A nil value drops the pair.
+func withPair(pairs []pair, typ uint64, value []byte) []pair {
+	key := makeKey(typ)
+	var out []pair
+	found := false
+	for _, kv := range pairs {
+		if !bytes.Equal(kv.key, key) {
+			out = append(out, kv)
+			continue
+		}
+		found = true
+		if value != nil {
+			out = append(out, pair{key: key, value: value})
+		}
+	}
+	if !found && value != nil {
+		out = append(out, pair{key: key, value: value})
+	}
+	return out
+}
+
+// V2Vectors returns version 2 packets of the BIP 370 kind: valid ones with
+// and without the optional fields, and ones missing fields their version
+// requires, having fields only the other version has, or having invalid
+// counts, transaction versions and lock times. They are built on the
+// transaction of the BIP 174 Creator example, so the same set is returned on
+// every call.
+func V2Vectors() []Vector {
+	txBytes, err := hex.DecodeString(edgeTxHex)
+	if err != nil {
+		panic(err)
+	}
+	tx, err := parseTx(txBytes, false)
+	if err != nil {
+		panic(err)
+	}
+	p0, err := New(tx)
+	if err != nil {
+		panic(err)
+	}
+	p, err := p0.ConvertV2()
+	if err != nil {
+		panic(err)
+	}
+
+	var vectors []Vector
+	valid := func(p *Packet, comment string) {
+		vectors = append(vectors, Vector{
+			PSBT:    mustSerialize(p),
+			Comment: comment,
+		})
+	}
+	invalid := func(data []byte, err error, comment string) {
+		vectors = append(vectors, Vector{
+			PSBT:      base64.StdEncoding.EncodeToString(data),
+			Err:       err,
+			StrictErr: err,
+			Comment:   comment,
+		})
+	}
+
+	valid(p, "Version 2 packet of the Creator example's transaction")
+
+	minimal := *p
+	minimal.FallbackLockTime = nil
+	minimal.Inputs = []Input{
+		{PreviousTxid: p.Inputs[0].PreviousTxid},
+		{PreviousTxid: p.Inputs[1].PreviousTxid, OutputIndex: 1},
+	}
+	valid(&minimal, "Version 2 packet without a fallback lock time or "+
+		"sequences")
+
+	valid(NewV2(2, 0, ModifiableInputs|ModifiableOutputs),
+		"Version 2 packet without inputs or outputs")
+
+	locked, err := p.clone()
+	if err != nil {
+		panic(err)
+	}
+	height, time := uint32(840000), uint32(1700000000)
+	locked.Inputs[0].RequiredHeightLockTime = &height
+	locked.Inputs[1].RequiredHeightLockTime = &height
+	locked.Inputs[1].RequiredTimeLockTime = &time
+	flags := uint8(ModifiableInputs | HasSighashSingle)
+	locked.TxModifiable = &flags
+	valid(locked, "Version 2 packet with required lock times and "+
+		"modifiable flags")
+
+	global := p.globalPairs()
+	in0, in1 := p.Inputs[0].pairs(2), p.Inputs[1].pairs(2)
+	out0, out1 := p.Outputs[0].pairs(2), p.Outputs[1].pairs(2)
+	raw := func(global, in0, out1 []pair) []byte {
+		return rawPacket(global, in0, in1, out0, out1)
+	}
+	uint32Value := func(v uint32) []byte {
+		return binary.LittleEndian.AppendUint32(nil, v)
+	}
+
+	invalid(raw(withPair(global, GlobalTxVersion, nil), in0, out1),
+		fieldErr(ErrMissingField, "transaction version", "global map"),
+		"Version 2 packet without a transaction version")
+	invalid(raw(withPair(global, GlobalInputCount, nil), in0, out1),
+		fieldErr(ErrMissingField, "input count", "global map"),
+		"Version 2 packet without an input count")
+	invalid(raw(withPair(global, GlobalOutputCount, nil), in0, out1),
+		fieldErr(ErrMissingField, "output count", "global map"),
+		"Version 2 packet without an output count")
+	invalid(raw(global, withPair(in0, InputPreviousTxid, nil), out1),
+		fieldErr(ErrMissingField, "previous txid", "input 0"),
+		"Version 2 input without a previous txid")
+	invalid(raw(global, withPair(in0, InputOutputIndex, nil), out1),
+		fieldErr(ErrMissingField, "output index", "input 0"),
+		"Version 2 input without an output index")
+	invalid(raw(global, in0, withPair(out1, OutputAmount, nil)),
+		fieldErr(ErrMissingField, "amount", "output 1"),
+		"Version 2 output without an amount")
+	invalid(raw(global, in0, withPair(out1, OutputScript, nil)),
+		fieldErr(ErrMissingField, "script", "output 1"),
+		"Version 2 output without a script")
+
+	invalid(raw(withPair(global, GlobalUnsignedTx, txBytes), in0, out1),
+		fieldErr(ErrExcludedField, "unsigned transaction", "global map"),
+		"Version 2 packet with an unsigned transaction")
+	v0Global := p0.globalPairs()
+	invalid(rawPacket(withPair(v0Global, GlobalTxVersion, uint32Value(2)),
+		nil, nil, nil, nil),
+		fieldErr(ErrExcludedField, "transaction version", "global map"),
+		"Version 0 packet with a transaction version")
+	invalid(rawPacket(withPair(v0Global, GlobalFallbackLockTime,
+		uint32Value(0)), nil, nil, nil, nil),
+		fieldErr(ErrExcludedField, "fallback lock time", "global map"),
+		"Version 0 packet with a fallback lock time")
+	invalid(rawPacket(v0Global, withPair(nil, InputSequence,
+		uint32Value(0)), nil, nil, nil),
+		fieldErr(ErrExcludedField, "sequence", "input 0"),
+		"Version 0 input with a sequence")
+	invalid(rawPacket(v0Global, nil, withPair(nil,
+		InputRequiredHeightLockTime, uint32Value(1)), nil, nil),
+		fieldErr(ErrExcludedField, "required height lock time", "input 1"),
+		"Version 0 input with a required height lock time")
+	invalid(rawPacket(v0Global, nil, nil, withPair(nil, OutputAmount,
+		make([]byte, 8)), nil),
+		fieldErr(ErrExcludedField, "amount", "output 0"),
+		"Version 0 output with an amount")
+	invalid(rawPacket(v0Global, nil, nil, nil, withPair(nil, OutputScript,
+		[]byte{0x51})),
+		fieldErr(ErrExcludedField, "script", "output 1"),
+		"Version 0 output with a script")
+
+	invalid(raw(withPair(global, GlobalTxVersion, uint32Value(1)), in0,
+		out1),
+		fieldErr(ErrInvalidValue, "transaction version", "global map"),
+		"Version 2 packet of a version 1 transaction")
+	invalid(raw(withPair(global, GlobalInputCount,
+		[]byte{0xfe, 0xff, 0xff, 0xff, 0xff}), in0, out1),
+		ErrTruncated, "Input count beyond the end of the packet")
+	invalid(raw(withPair(global, GlobalTxModifiable, []byte{0x03, 0x00}),
+		in0, out1),
+		fieldErr(ErrInvalidValue, "modifiable flags", "global map"),
+		"Modifiable flags of two bytes")
+	invalid(raw(global, withPair(in0, InputPreviousTxid,
+		make([]byte, 31)), out1),
+		fieldErr(ErrInvalidValue, "previous txid", "input 0"),
+		"Previous txid of 31 bytes")
+	invalid(raw(global, withPair(in0, InputRequiredTimeLockTime,
+		uint32Value(lockTimeThreshold-1)), out1),
+		fieldErr(ErrInvalidValue, "required time lock time", "input 0"),
+		"Required time lock time below the threshold")
+	invalid(raw(global, withPair(in0, InputRequiredHeightLockTime,
+		uint32Value(lockTimeThreshold)), out1),
+		fieldErr(ErrInvalidValue, "required height lock time", "input 0"),
+		"Required height lock time at the threshold")
+	invalid(raw(global, in0, withPair(out1, OutputAmount, make([]byte, 4))),
+		fieldErr(ErrInvalidValue, "amount", "output 1"),
+		"Amount of four bytes")
+
+	return vectors
+}
+
+// ConversionVector is a packet and what converting it to the other version
+// gives: ConvertV2 for version 0 packets and ConvertV0 for version 2 ones.
+type ConversionVector struct {
+	// From is the packet to convert in base64.
+	From string
+
+	// To is the converted packet in base64, or empty if converting fails.
+	To string
+
+	// Err is the error converting fails with, if it does.
+	Err error
+
+	// Comment describes the vector.
+	Comment string
+}
+
+// ConversionVectors returns vectors converting packets both ways. The
+// valid version 0 packets of the BIP and the edge cases are converted to
+// version 2 and back, which gives them as they were when their transactions
+// can be carried by version 2 packets. Version 2 packets that version 0 ones
+// can't carry, with required lock times or modifiable flags, fail to
+// convert, and so do count random packets of each version, some of them for
+// the same reasons. The vectors depend only on rngSeed and count.
+func ConversionVectors(rngSeed int64, count int) []ConversionVector {
+	var vectors []ConversionVector
+	add := func(from *Packet, comment string) *Packet {
+		var to *Packet
+		var err error
+		if from.Version == 0 {
+			to, err = from.ConvertV2()
+		} else {
+			to, err = from.ConvertV0()
+		}
+		v := ConversionVector{
+			From:    mustSerialize(from),
+			Err:     err,
+			Comment: comment,
+		}
+		if to != nil {
+			v.To = mustSerialize(to)
+		}
+		vectors = append(vectors, v)
+		return to
+	}
+	both := func(p *Packet, comment string) {
+		if q := add(p, comment); q != nil {
+			add(q, comment+", converted back")
+		}
+	}
+
+	var sources []Vector
+	sources = append(sources, SpecVectors()...)
+	sources = append(sources, EdgeVectors()...)
+	sources = append(sources, V2Vectors()...)
+	for _, v := range sources {
+		if v.StrictErr != nil {
+			continue
+		}
+		p, err := ParseBase64(v.PSBT)
+		if err != nil {
+			panic(err)
+		}
+		both(p, v.Comment)
+	}
+
+	rng := rand.New(rand.NewSource(rngSeed))
+	for i := 0; i < count; i++ {
+		p := randomPacket(rng)
+		both(p, fmt.Sprintf("Random version 0 packet %d", i))
+
+		p.UnsignedTx.Version = 2
+		q, err := p.ConvertV2()
+		if err != nil {
+			panic(err)
+		}
+		for j := range q.Inputs {
+			if rng.Intn(4) != 0 {
+				continue
+			}
+			lockTime := uint32(rng.Intn(lockTimeThreshold))
+			if rng.Intn(2) == 0 {
+				q.Inputs[j].RequiredHeightLockTime = &lockTime
+			} else {
+				lockTime += lockTimeThreshold
+				q.Inputs[j].RequiredTimeLockTime = &lockTime
+			}
+		}
+		if rng.Intn(2) == 0 {
+			flags := uint8(rng.Intn(8))
+			q.TxModifiable = &flags
+		}
+		if rng.Intn(2) == 0 {
+			q.FallbackLockTime = nil
+		}
+		both(q, fmt.Sprintf("Random version 2 packet %d", i))
+	}
+	return vectors
+}
+
+// CheckConversionVector parses the vector's packet, converts it to the
+// other version and checks the outcome.
+func CheckConversionVector(v ConversionVector) error {
+	p, err := ParseBase64(v.From)
+	if err != nil {
+		return err
+	}
+	var q *Packet
+	if p.Version == 0 {
+		q, err = p.ConvertV2()
+	} else {
+		q, err = p.ConvertV0()
+	}
+	if !vectorfile.SameError(err, v.Err) {
+		return fmt.Errorf("%w: converting gave %v, expected %v",
+			ErrVectorMismatch, err, v.Err)
+	}
+	if q == nil {
+		if v.To != "" {
+			return fmt.Errorf("%w: converting gave no packet",
+				ErrVectorMismatch)
+		}
+		return nil
+	}
+	to, err := q.Base64()
+	if err != nil {
+		return err
+	}
+	if to != v.To {
+		return fmt.Errorf("%w: converting gave %s", ErrVectorMismatch, to)
+	}
+	return nil
+}
+
+// SigningVector is a packet, the keys that sign it, and what signing and
+// finalizing it give.
+type SigningVector struct {
+	// PSBT is the packet before signing, in base64.
+	PSBT string
+
+	// Keys are the private keys that sign every input they can, in hex.
+	Keys []string
+
+	// Signed is the packet once the keys have signed, in base64.
+	Signed string
+
+	// Tx is the transaction extracted once every input is finalized, in
+	// hex.
+	Tx string
+
+	// Comment describes the vector.
+	Comment string
+}
+
+// numsKey is the x-only key of BIP 341 whose private key no one knows, the
+// internal key of taproot outputs that can only be spent along their script
+// paths.
+var numsKey = []byte{
+	0x50, 0x92, 0x9b, 0x74, 0xc1, 0xa0, 0x49, 0x54, 0xb7, 0x8b, 0x4b,
+	0x60, 0x35, 0xe9, 0x7a, 0x5e, 0x07, 0x8a, 0x5a, 0x0f, 0x28, 0xec,
+	0x96, 0xd5, 0x47, 0xbf, 0xee, 0x9a, 0xce, 0x80, 0x3a, 0xc0,
+}
+
+// tapscriptMulti returns a leaf script that checks that required of the
+// x-only keys sign, with OP_CHECKSIG alone for a single key.
+func tapscriptMulti(required int, keys ...[]byte) []byte {
+	builder := txscript.NewScriptBuilder()
+	for i, key := range keys {
+		builder.AddData(key)
+		if i == 0 {
+			builder.AddOp(txscript.OP_CHECKSIG)
+		} else {
+			builder.AddOp(txscript.OP_CHECKSIGADD)
+		}
+	}
+	if len(keys) > 1 {
+		builder.AddInt64(int64(required)).AddOp(txscript.OP_NUMEQUAL)
+	}
+	script, err := builder.Script()
+	if err != nil {
+		panic(err)
+	}
+	return script
+}
+
+// taprootTree is a taproot output built for the signing vectors: its
+// script, and the fields of the inputs spending it and of the output itself.
+type taprootTree struct {
+	pkScript    []byte
+	internalKey []byte
+	merkleRoot  []byte
+	leaves      []TapLeafScript
+	tree        []TapTreeLeaf
+}
+
+// newTaprootTree builds the taproot output of the internal key whose tree
+// has the leaf scripts, or no tree if there are none.
+func newTaprootTree(internalKey []byte, scripts ...[]byte) *taprootTree {
+	pubKey, err := schnorr.ParsePubKey(internalKey)
+	if err != nil {
+		panic(err)
+	}
+	t := &taprootTree{internalKey: internalKey}
+	outputKey := txscript.ComputeTaprootKeyNoScript(pubKey)
+	if len(scripts) != 0 {
+		var leaves []txscript.TapLeaf
+		for _, script := range scripts {
+			leaves = append(leaves, txscript.NewBaseTapLeaf(script))
+		}
+		tree := txscript.AssembleTaprootScriptTree(leaves...)
+		root := tree.RootNode.TapHash()
+		t.merkleRoot = root[:]
+		outputKey = txscript.ComputeTaprootOutputKey(pubKey, t.merkleRoot)
+
+		for _, proof := range tree.LeafMerkleProofs {
+			controlBlock := proof.ToControlBlock(pubKey)
+			cb, err := controlBlock.ToBytes()
+			if err != nil {
+				panic(err)
+			}
+			t.leaves = append(t.leaves, TapLeafScript{
+				ControlBlock: cb,
+				Script:       proof.Script,
+				LeafVersion:  proof.LeafVersion,
+			})
+			t.tree = append(t.tree, TapTreeLeaf{
+				Depth: uint8(len(proof.InclusionProof) /
+					txscript.ControlBlockNodeSize),
+				LeafVersion: proof.LeafVersion,
+				Script:      proof.Script,
+			})
+		}
+	}
+	if t.pkScript, err = txscript.PayToTaprootScript(outputKey); err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// signingInput is an input of a signing vector, spending a taproot output
+// or, if tree is nil, a P2WPKH output of the key.
+type signingInput struct {
+	tree        *taprootTree
+	key         *btcec.PrivateKey
+	sighashType *txscript.SigHashType
+}
+
+// signingPacket returns a packet spending the inputs from a transaction that
+// pays to them, and paying to a taproot output with a tree and P2WPKH
+// outputs, so that there are as many outputs as inputs for SIGHASH_SINGLE.
+// The Updater adds the UTXOs and the derivations of the keys.
+func signingPacket(inputs []signingInput, change *taprootTree,
+	keys []Derivation) *Packet {
+
+	prevTx := wire.NewMsgTx(2)
+	prevTx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: 0}, nil, nil))
+	for i, in := range inputs {
+		pkScript := p2wpkhScript(in.key)
+		if in.tree != nil {
+			pkScript = in.tree.pkScript
+		}
+		prevTx.AddTxOut(wire.NewTxOut(int64(i+1)*100000, pkScript))
+	}
+
+	tx := wire.NewMsgTx(2)
+	var total int64
+	for i, txOut := range prevTx.TxOut {
+		prevOut := wire.OutPoint{Hash: prevTx.TxHash(), Index: uint32(i)}
+		tx.AddTxIn(wire.NewTxIn(&prevOut, nil, nil))
+		total += txOut.Value
+	}
+	tx.AddTxOut(wire.NewTxOut(total/2, change.pkScript))
+	for i := 1; i < len(inputs) || i < 2; i++ {
+		tx.AddTxOut(wire.NewTxOut(total/int64(4*i),
+			p2wpkhScript(inputs[0].key)))
+	}
+
+	p, err := New(tx)
+	if err != nil {
+		panic(err)
+	}
+	for i, in := range inputs {
+		p.Inputs[i].SighashType = in.sighashType
+		if in.tree != nil {
+			p.Inputs[i].TapInternalKey = in.tree.internalKey
+			p.Inputs[i].TapMerkleRoot = in.tree.merkleRoot
+			p.Inputs[i].TapLeafScripts = in.tree.leaves
+		}
+	}
+	p.Outputs[0].TapInternalKey = change.internalKey
+	p.Outputs[0].TapTree = change.tree
+
+	err = p.Update(&Update{PrevTxs: []*wire.MsgTx{prevTx}, Keys: keys})
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// p2wpkhScript returns the P2WPKH output script of the key, or nil for a
+// nil key.
+func p2wpkhScript(key *btcec.PrivateKey) []byte {
+	if key == nil {
+		return nil
+	}
+	script, err := txscript.NewScriptBuilder().AddOp(txscript.OP_0).
+		AddData(btcutil.Hash160(key.PubKey().SerializeCompressed())).
+		Script()
+	if err != nil {
+		panic(err)
+	}
+	return script
+}
+
+// signingVector signs a packet with the keys, finalizes it and extracts its
+// transaction.
+func signingVector(p *Packet, keys []*btcec.PrivateKey,
+	comment string) (SigningVector, error) {
+
+	v := SigningVector{PSBT: mustSerialize(p), Comment: comment}
+	signed, err := p.clone()
+	if err != nil {
+		return v, err
+	}
+	for _, key := range keys {
+		v.Keys = append(v.Keys, hex.EncodeToString(key.Serialize()))
+	}
+	if err := signed.SignAll(keys...); err != nil {
+		return v, fmt.Errorf("%v: %w", comment, err)
+	}
+	v.Signed = mustSerialize(signed)
+
+	if err := signed.FinalizeAll(); err != nil {
+		return v, fmt.Errorf("%v: %w", comment, err)
+	}
+	tx, err := signed.Extract()
+	if err != nil {
+		return v, fmt.Errorf("%v: %w", comment, err)
+	}
+	var buf bytes.Buffer
+	if err := tx.Serialize(&buf); err != nil {
+		return v, err
+	}
+	v.Tx = hex.EncodeToString(buf.Bytes())
+	return v, nil
+}
+
+// TaprootVectors returns vectors signing taproot inputs with keys derived
+// from the master key of the BIP 174 Updater example along m/86'/1'/0'/0/i:
+// key path spends with and without script trees, script path spends of
+// leaves checking one key or k of n keys with OP_CHECKSIGADD out of trees
+// of several leaves, inputs of every sighash type, a P2WPKH input alongside
+// taproot ones, and a version 2 packet, followed by count vectors of random
+// trees and signers. The vectors depend only on rngSeed and count. Trees
+// never hold the same leaf script twice, as a tree indexing its leaves by
+// their hashes can't prove the inclusion of both copies.
+func TaprootVectors(rngSeed int64, count int) ([]SigningVector, error) {
+	master, err := bip32.ParseKey(edgeMaster)
+	if err != nil {
+		panic(err)
+	}
+	var keys []*btcec.PrivateKey
+	var derivations []Derivation
+	for i := uint32(0); i < 8; i++ {
+		path := bip32.Path{bip32.HardenedKeyStart + 86,
+			bip32.HardenedKeyStart + 1, bip32.HardenedKeyStart, 0, i}
+		child, err := master.Derive(path)
+		if err != nil {
+			panic(err)
+		}
+		key, _ := btcec.PrivKeyFromBytes(child.PrivateKey())
+		keys = append(keys, key)
+		derivations = append(derivations, Derivation{
+			PubKey: child.PublicKey(),
+			KeyOrigin: KeyOrigin{
+				Fingerprint: master.Fingerprint(),
+				Path:        path,
+			},
+		})
+	}
+	x := func(i int) []byte {
+		return schnorr.SerializePubKey(keys[i].PubKey())
+	}
+	sighash := func(t txscript.SigHashType) *txscript.SigHashType {
+		return &t
+	}
+	change := newTaprootTree(x(6), tapscriptMulti(1, x(7)),
+		tapscriptMulti(2, x(6), x(7)))
+	scripts := [][]byte{
+		tapscriptMulti(1, x(1)),
+		tapscriptMulti(2, x(2), x(3), x(4)),
+		tapscriptMulti(1, x(5)),
+	}
+	scriptTree := newTaprootTree(numsKey, scripts...)
+
+	var vectors []SigningVector
+	add := func(inputs []signingInput, signers []int, comment string) {
+		if err != nil {
+			return
+		}
+		p := signingPacket(inputs, change, derivations)
+		var signerKeys []*btcec.PrivateKey
+		for _, i := range signers {
+			signerKeys = append(signerKeys, keys[i])
+		}
+		var v SigningVector
+		v, err = signingVector(p, signerKeys, comment)
+		vectors = append(vectors, v)
+	}
+
+	add([]signingInput{{tree: newTaprootTree(x(0))}}, []int{0},
+		"Key path spend of an output without a script tree")
+	add([]signingInput{{
+		tree:        newTaprootTree(x(0), scripts...),
+		sighashType: sighash(txscript.SigHashAll),
+	}}, []int{0, 1}, "Key path spend of an output with a script tree, "+
+		"with SIGHASH_ALL, which is chosen over the leaf also signed")
+	add([]signingInput{{tree: scriptTree}}, []int{5},
+		"Script path spend of a leaf checking one key, out of three "+
+			"leaves")
+	add([]signingInput{{tree: scriptTree}}, []int{2, 4},
+		"Script path spend of a 2-of-3 OP_CHECKSIGADD leaf, with the "+
+			"second key not signing")
+	add([]signingInput{{tree: scriptTree}}, []int{1, 2, 3},
+		"Script path spend of the smallest of two satisfied leaves")
+	add([]signingInput{{tree: scriptTree}}, []int{2, 3, 4},
+		"Script path spend of a 2-of-3 OP_CHECKSIGADD leaf signed by "+
+			"every key, of which the first two signatures are used")
+	add([]signingInput{
+		{tree: newTaprootTree(x(0)), sighashType: sighash(
+			txscript.SigHashSingle | txscript.SigHashAnyOneCanPay)},
+		{key: keys[1]},
+		{tree: scriptTree, sighashType: sighash(txscript.SigHashNone)},
+	}, []int{0, 1, 5}, "Taproot key and script path inputs with "+
+		"SIGHASH_SINGLE|ANYONECANPAY and SIGHASH_NONE, and a P2WPKH input")
+
+	if err != nil {
+		return nil, err
+	}
+
+	p := signingPacket([]signingInput{{tree: scriptTree}}, change,
+		derivations)
+	p, err = p.ConvertV2()
+	if err != nil {
+		return nil, err
+	}
+	flags := uint8(ModifiableInputs | ModifiableOutputs)
+	p.TxModifiable = &flags
+	v, err := signingVector(p, keys[3:5], "Version 2 packet with a "+
+		"script path input, whose signatures clear its modifiable flags")
+	if err != nil {
+		return nil, err
+	}
+	vectors = append(vectors, v)
+
+	rng := rand.New(rand.NewSource(rngSeed))
+	sighashTypes := []txscript.SigHashType{
+		txscript.SigHashDefault, txscript.SigHashAll,
+		txscript.SigHashNone, txscript.SigHashSingle,
+	}
+	for i := 0; i < count; i++ {
+		var inputs []signingInput
+		signers := make(map[int]bool)
+		for j := 1 + rng.Intn(3); j > 0; j-- {
+			var in signingInput
+			if t := sighashTypes[rng.Intn(len(sighashTypes))]; t != 0 ||
+				rng.Intn(2) == 0 {
+
+				if t != txscript.SigHashDefault && rng.Intn(2) == 0 {
+					t |= txscript.SigHashAnyOneCanPay
+				}
+				in.sighashType = &t
+			}
+
+			var leafKeys [][]int
+			var scripts [][]byte
+			for k := rng.Intn(5); k > 0; k-- {
+				n := 1 + rng.Intn(3)
+				perm := rng.Perm(8)[:n]
+				var xs [][]byte
+				for _, key := range perm {
+					xs = append(xs, x(key))
+				}
+				script := tapscriptMulti(1+rng.Intn(n), xs...)
+				if containsScript(scripts, script) {
+					continue
+				}
+				leafKeys = append(leafKeys, perm)
+				scripts = append(scripts, script)
+			}
+
+			internal := rng.Intn(8)
+			if scripts != nil && rng.Intn(2) == 0 {
+				in.tree = newTaprootTree(numsKey, scripts...)
+			} else {
+				in.tree = newTaprootTree(x(internal), scripts...)
+			}
+
+			// Either the internal key signs, or as many keys of one
+			// leaf as it needs, or more.
+			if !bytes.Equal(in.tree.internalKey, numsKey) &&
+				(scripts == nil || rng.Intn(2) == 0) {
+
+				signers[internal] = true
+			} else {
+				leaf := rng.Intn(len(scripts))
+				_, required, _ := tapscriptKeys(scripts[leaf])
+				for _, key := range leafKeys[leaf][:required+
+					rng.Intn(len(leafKeys[leaf])-required+1)] {
+
+					signers[key] = true
+				}
+			}
+			inputs = append(inputs, in)
+		}
+
+		var signerList []int
+		for key := 0; key < 8; key++ {
+			if signers[key] {
+				signerList = append(signerList, key)
+			}
+		}
+		add(inputs, signerList, fmt.Sprintf("Random taproot inputs %d", i))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return vectors, nil
+}
+
+// containsScript reports whether the script is one of the scripts.
+func containsScript(scripts [][]byte, script []byte) bool {
+	for _, s := range scripts {
+		if bytes.Equal(s, script) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckSigningVector signs the vector's packet with its keys, finalizes it
+// and extracts its transaction, checks each against the vector, and
+// verifies the transaction's inputs with the script engine.
+func CheckSigningVector(v SigningVector) error {
+	p, err := ParseBase64(v.PSBT)
+	if err != nil {
+		return err
+	}
+	var keys []*btcec.PrivateKey
+	for _, s := range v.Keys {
+		b, err := hex.DecodeString(s)
+		if err != nil {
+			return err
+		}
+		key, _ := btcec.PrivKeyFromBytes(b)
+		keys = append(keys, key)
+	}
+
+	if err := p.SignAll(keys...); err != nil {
+		return err
+	}
+	signed, err := p.Base64()
+	if err != nil {
+		return err
+	}
+	if signed != v.Signed {
+		return fmt.Errorf("%w: signing gave %s", ErrVectorMismatch, signed)
+	}
+
+	fetcher := p.prevOutFetcher()
+	if err := p.FinalizeAll(); err != nil {
+		return err
+	}
+	tx, err := p.Extract()
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := tx.Serialize(&buf); err != nil {
+		return err
+	}
+	if s := hex.EncodeToString(buf.Bytes()); s != v.Tx {
+		return fmt.Errorf("%w: extracting gave %s", ErrVectorMismatch, s)
+	}
+
+	hashes := txscript.NewTxSigHashes(tx, fetcher)
+	for i, txIn := range tx.TxIn {
+		utxo := fetcher.FetchPrevOutput(txIn.PreviousOutPoint)
+		engine, err := txscript.NewEngine(utxo.PkScript, tx, i,
+			txscript.StandardVerifyFlags, nil, hashes, utxo.Value, fetcher)
+		if err != nil {
+			return err
+		}
+		if err := engine.Execute(); err != nil {
+			return fmt.Errorf("%w: input %d: %v", ErrVectorMismatch, i,
+				err)
+		}
+	}
+	return nil
+}
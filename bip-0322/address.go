@@ -0,0 +1,117 @@
+package signmessage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/christsim/bips/base58"
+	bech32 "github.com/christsim/bips/bip-0173"
+)
+
+// ErrAddress is returned by AddressScript for an address of none of the
+// known kinds and networks, and by Address for a script without one.
+var ErrAddress = errors.New("signmessage: unknown address")
+
+// Network is the address encoding of a network.
+type Network struct {
+	// PubKeyHash and ScriptHash are the version bytes of Base58 P2PKH and
+	// P2SH addresses.
+	PubKeyHash byte
+	ScriptHash byte
+
+	// HRP is the human-readable part of segwit addresses.
+	HRP string
+}
+
+// The networks addresses are known for.
+var (
+	MainNet = Network{PubKeyHash: 0x00, ScriptHash: 0x05, HRP: "bc"}
+	TestNet = Network{PubKeyHash: 0x6f, ScriptHash: 0xc4, HRP: "tb"}
+	RegTest = Network{PubKeyHash: 0x6f, ScriptHash: 0xc4, HRP: "bcrt"}
+)
+
+// networks lists the networks AddressScript decodes addresses of.
+var networks = []Network{MainNet, TestNet, RegTest}
+
+// pubKeyHashScript returns the P2PKH script of the public key hash.
+func pubKeyHashScript(hash []byte) []byte {
+	script := []byte{txscript.OP_DUP, txscript.OP_HASH160,
+		txscript.OP_DATA_20}
+	script = append(script, hash...)
+	return append(script, txscript.OP_EQUALVERIFY, txscript.OP_CHECKSIG)
+}
+
+// scriptHashScript returns the P2SH script of the script hash.
+func scriptHashScript(hash []byte) []byte {
+	script := append([]byte{txscript.OP_HASH160, txscript.OP_DATA_20},
+		hash...)
+	return append(script, txscript.OP_EQUAL)
+}
+
+// AddressScript returns the message challenge of an address: its output
+// script. It decodes Base58 P2PKH and P2SH addresses and segwit addresses
+// of the known networks.
+func AddressScript(addr string) ([]byte, error) {
+	for _, net := range networks {
+		if !strings.HasPrefix(strings.ToLower(addr), net.HRP+"1") {
+			continue
+		}
+		version, program, err := bech32.DecodeSegwit(net.HRP, addr)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrAddress, err)
+		}
+		return bech32.WitnessScript(version, program), nil
+	}
+
+	payload, err := base58.CheckDecode(addr)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrAddress, err)
+	}
+	if len(payload) != 21 {
+		return nil, fmt.Errorf("%w: %d byte payload", ErrAddress,
+			len(payload))
+	}
+	for _, net := range networks {
+		switch payload[0] {
+		case net.PubKeyHash:
+			return pubKeyHashScript(payload[1:]), nil
+		case net.ScriptHash:
+			return scriptHashScript(payload[1:]), nil
+		}
+	}
+	return nil, fmt.Errorf("%w: version 0x%02x", ErrAddress, payload[0])
+}
+
+// isPubKeyHashScript reports whether the script is a P2PKH script.
+func isPubKeyHashScript(script []byte) bool {
+	return len(script) == 25 &&
+		bytes.Equal(script, pubKeyHashScript(script[3:23]))
+}
+
+// isScriptHashScript reports whether the script is a P2SH script.
+func isScriptHashScript(script []byte) bool {
+	return len(script) == 23 &&
+		bytes.Equal(script, scriptHashScript(script[2:22]))
+}
+
+// Address returns the address of the message challenge on the network, for
+// the kinds of scripts AddressScript decodes.
+func Address(challenge []byte, net Network) (string, error) {
+	switch {
+	case isPubKeyHashScript(challenge):
+		return base58.CheckEncode(append([]byte{net.PubKeyHash},
+			challenge[3:23]...)), nil
+	case isScriptHashScript(challenge):
+		return base58.CheckEncode(append([]byte{net.ScriptHash},
+			challenge[2:22]...)), nil
+	}
+	version, program, ok := bech32.ParseWitnessScript(challenge)
+	if !ok {
+		return "", fmt.Errorf("%w: no address for script %x",
+			ErrAddress, challenge)
+	}
+	return bech32.EncodeSegwit(net.HRP, version, program)
+}
@@ -0,0 +1,270 @@
+// This program writes test vectors for the signmessage package to
+// signatures.json: BIP 322 signatures of messages for addresses, starting
+// with the examples of the BIP, followed by signatures of random messages
+// with random keys for each of their P2PKH, P2WPKH, P2SH-P2WPKH and P2TR
+// addresses, in each format they can be signed in, and signatures that fail
+// to verify or are inconclusive. It also writes vectors of BIP 137 legacy
+// signatures to legacy.json: the example of Bitcoin Core's tests, followed
+// by signatures of random messages for each P2PKH, P2SH-P2WPKH and P2WPKH
+// address of random keys, and signatures that fail to verify. The random
+// vectors depend only on -seed and -count, so they can be regenerated by
+// anyone:
+//
+//	gentestvectors -count 20 -seed 322
+//
+// Both files use the layout of the BIP 158 vectors: a JSON array whose
+// first row names the columns, followed by one row per vector. Secret keys,
+// auxiliary randomness and message hashes are in hex, signatures are in
+// base64 as the BIPs give them, and the txids of to_spend and the unsigned
+// to_sign are in the byte order of block explorers. A vector with a secret
+// key is signed again when checked, and one whose signature fails to verify
+// gives the error. Pass -check and -check-legacy to verify existing files
+// against the package instead:
+//
+//	gentestvectors -check signatures.json -check-legacy legacy.json
+//
+// The program lives in a directory of its own since the signmessage package
+// sits at the root of the module.
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	signmessage "github.com/christsim/bips/bip-0322"
+	"github.com/christsim/bips/internal/vectorfile"
+)
+
+// vectorColumns is the header row of the BIP 322 vector file.
+const vectorColumns = "Address,Message,SecKey,AuxRand,Format,Signature," +
+	"MessageHash,ToSpend,ToSign,Error,Comment"
+
+// legacyColumns is the header row of the legacy vector file.
+const legacyColumns = "Address,Message,SecKey,Signature,MessageHash,Error," +
+	"Comment"
+
+type JSONTestWriter struct {
+	writer          io.Writer
+	firstRowWritten bool
+}
+
+func NewJSONTestWriter(writer io.Writer) *JSONTestWriter {
+	return &JSONTestWriter{writer: writer}
+}
+
+func (w *JSONTestWriter) WriteComment(comment string) error {
+	return w.WriteTestCase([]interface{}{comment})
+}
+
+func (w *JSONTestWriter) WriteTestCase(row []interface{}) error {
+	var err error
+	if w.firstRowWritten {
+		_, err = io.WriteString(w.writer, ",\n")
+	} else {
+		_, err = io.WriteString(w.writer, "[\n")
+		w.firstRowWritten = true
+	}
+	if err != nil {
+		return err
+	}
+
+	rowBytes, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.writer.Write(rowBytes)
+	return err
+}
+
+func (w *JSONTestWriter) Close() error {
+	if !w.firstRowWritten {
+		return nil
+	}
+
+	_, err := io.WriteString(w.writer, "\n]\n")
+	return err
+}
+
+func main() {
+	out := flag.String("out", "signatures.json", "file to write the "+
+		"BIP 322 vectors to")
+	legacyOut := flag.String("legacy-out", "legacy.json", "file to write "+
+		"the legacy vectors to")
+	count := flag.Int("count", 20, "number of random keys to write "+
+		"vectors of")
+	seed := flag.Int64("seed", 322, "seed of the random vectors")
+	check := flag.String("check", "", "BIP 322 vector file to check "+
+		"instead of writing the files")
+	checkLegacy := flag.String("check-legacy", "", "legacy vector file "+
+		"to check instead of writing the files")
+	flag.Parse()
+
+	var err error
+	switch {
+	case *check != "" || *checkLegacy != "":
+		if *check != "" {
+			err = checkFile(*check)
+		}
+		if err == nil && *checkLegacy != "" {
+			err = checkLegacyFile(*checkLegacy)
+		}
+	default:
+		err = writeFile(*out, *seed, *count)
+		if err == nil {
+			err = writeLegacyFile(*legacyOut, *seed, *count)
+		}
+	}
+	if err != nil {
+		fmt.Println("Error: ", err.Error())
+		os.Exit(1)
+	}
+}
+
+// parseFormat returns the signature format of a vector's format column.
+func parseFormat(s string) (signmessage.Format, error) {
+	for _, format := range []signmessage.Format{signmessage.Simple,
+		signmessage.Full} {
+
+		if format.String() == s {
+			return format, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown format %q", s)
+}
+
+// writeFile writes the examples of the BIP and the vectors of count random
+// keys to out.
+func writeFile(out string, seed int64, count int) error {
+	vectors := append(signmessage.SpecVectors(),
+		signmessage.RandomVectors(seed, count)...)
+
+	file, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := NewJSONTestWriter(file)
+	if err := writer.WriteComment(vectorColumns); err != nil {
+		return err
+	}
+	for _, v := range vectors {
+		err := writer.WriteTestCase([]interface{}{
+			v.Address,
+			v.Message,
+			hex.EncodeToString(v.SecKey),
+			hex.EncodeToString(v.AuxRand),
+			v.Format.String(),
+			v.Signature,
+			hex.EncodeToString(v.MessageHash),
+			v.ToSpend,
+			v.ToSign,
+			vectorfile.ErrorString(v.Err),
+			v.Comment,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote %d vectors\n", len(vectors))
+	return nil
+}
+
+// writeLegacyFile writes the legacy vectors, with those of count random
+// keys, to out.
+func writeLegacyFile(out string, seed int64, count int) error {
+	vectors := signmessage.LegacyVectors(seed, count)
+
+	file, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := NewJSONTestWriter(file)
+	if err := writer.WriteComment(legacyColumns); err != nil {
+		return err
+	}
+	for _, v := range vectors {
+		err := writer.WriteTestCase([]interface{}{
+			v.Address,
+			v.Message,
+			hex.EncodeToString(v.SecKey),
+			v.Signature,
+			hex.EncodeToString(v.MessageHash),
+			vectorfile.ErrorString(v.Err),
+			v.Comment,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote %d legacy vectors\n", len(vectors))
+	return nil
+}
+
+// checkFile checks each vector of the file with signmessage.CheckVector.
+func checkFile(path string) error {
+	rows, err := vectorfile.ReadRows(path, 11)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		var v signmessage.Vector
+		var format, errText string
+		err := vectorfile.DecodeRow(row, &v.Address, &v.Message,
+			&v.SecKey, &v.AuxRand, &format, &v.Signature,
+			&v.MessageHash, &v.ToSpend, &v.ToSign, &errText,
+			&v.Comment)
+		if err != nil {
+			return err
+		}
+		if v.Format, err = parseFormat(format); err != nil {
+			return fmt.Errorf("%v: %v", v.Comment, err)
+		}
+		v.Err = vectorfile.ParseError(errText)
+		if err := signmessage.CheckVector(v); err != nil {
+			return fmt.Errorf("%v: %v", v.Comment, err)
+		}
+	}
+	fmt.Printf("%d vectors OK\n", len(rows))
+	return nil
+}
+
+// checkLegacyFile checks each vector of the file with
+// signmessage.CheckLegacyVector.
+func checkLegacyFile(path string) error {
+	rows, err := vectorfile.ReadRows(path, 7)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		var v signmessage.LegacyVector
+		var errText string
+		err := vectorfile.DecodeRow(row, &v.Address, &v.Message,
+			&v.SecKey, &v.Signature, &v.MessageHash, &errText,
+			&v.Comment)
+		if err != nil {
+			return err
+		}
+		v.Err = vectorfile.ParseError(errText)
+		if err := signmessage.CheckLegacyVector(v); err != nil {
+			return fmt.Errorf("%v: %v", v.Comment, err)
+		}
+	}
+	fmt.Printf("%d legacy vectors OK\n", len(rows))
+	return nil
+}
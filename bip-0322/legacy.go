@@ -0,0 +1,192 @@
+package signmessage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/btcsuite/btcd/wire"
+	bech32 "github.com/christsim/bips/bip-0173"
+)
+
+// legacyMagic is the prefix of the messages legacy signatures sign.
+const legacyMagic = "Bitcoin Signed Message:\n"
+
+// LegacySize is the size of legacy signatures: a header byte followed by
+// the 32 byte r and s of the ECDSA signature.
+const LegacySize = 65
+
+// LegacyHeader is the base of the header byte of a legacy signature, which
+// the recovery ID of the public key is added to. BIP 137 gives one to each
+// kind of address.
+type LegacyHeader byte
+
+// The header bases of BIP 137.
+const (
+	// HeaderUncompressed is the base of P2PKH addresses of uncompressed
+	// public keys.
+	HeaderUncompressed LegacyHeader = 27
+
+	// HeaderCompressed is the base of P2PKH addresses of compressed
+	// public keys.
+	HeaderCompressed LegacyHeader = 31
+
+	// HeaderNestedSegwit is the base of P2SH-P2WPKH addresses.
+	HeaderNestedSegwit LegacyHeader = 35
+
+	// HeaderSegwit is the base of P2WPKH addresses.
+	HeaderSegwit LegacyHeader = 39
+)
+
+// String returns the kind of address of the header base.
+func (h LegacyHeader) String() string {
+	switch h {
+	case HeaderUncompressed:
+		return "uncompressed P2PKH"
+	case HeaderCompressed:
+		return "compressed P2PKH"
+	case HeaderNestedSegwit:
+		return "P2SH-P2WPKH"
+	case HeaderSegwit:
+		return "P2WPKH"
+	}
+	return fmt.Sprintf("LegacyHeader(%d)", byte(h))
+}
+
+// ErrLegacyEncoding is returned by VerifyLegacy for a signature that isn't
+// base64, isn't LegacySize bytes, or whose header is past those of BIP 137.
+var ErrLegacyEncoding = errors.New("signmessage: invalid legacy signature " +
+	"encoding")
+
+// LegacyMessageHash returns the hash legacy signatures of the message sign:
+// the double SHA256 of the message prefixed with the magic string, each
+// with its size as a compact size.
+func LegacyMessageHash(message []byte) [HashSize]byte {
+	var b bytes.Buffer
+	if err := wire.WriteVarString(&b, 0, legacyMagic); err != nil {
+		panic(err)
+	}
+	if err := wire.WriteVarBytes(&b, 0, message); err != nil {
+		panic(err)
+	}
+	first := sha256.Sum256(b.Bytes())
+	return sha256.Sum256(first[:])
+}
+
+// legacyHeader returns the header base of legacy signatures for the
+// message challenge, and the public key hash it pays to with the key
+// serialized as the base says. It fails for challenges of other kinds.
+func legacyHeader(challenge []byte) (LegacyHeader, []byte, error) {
+	version, program, isWitness := bech32.ParseWitnessScript(challenge)
+	switch {
+	case isPubKeyHashScript(challenge):
+		return HeaderCompressed, challenge[3:23], nil
+	case isScriptHashScript(challenge):
+		return HeaderNestedSegwit, challenge[2:22], nil
+	case isWitness && version == 0 && len(program) == 20:
+		return HeaderSegwit, program, nil
+	}
+	return 0, nil, fmt.Errorf("%w: %x", ErrUnsupportedScript, challenge)
+}
+
+// legacyKeyHash returns the hash that the message challenge of the header
+// base commits to for the public key.
+func legacyKeyHash(header LegacyHeader, pubKey *btcec.PublicKey) []byte {
+	if header == HeaderUncompressed {
+		return hash160(pubKey.SerializeUncompressed())
+	}
+	keyHash := hash160(pubKey.SerializeCompressed())
+	if header == HeaderNestedSegwit {
+		return hash160(bech32.WitnessScript(0, keyHash))
+	}
+	return keyHash
+}
+
+// SignLegacy signs the message for the message challenge with the secret
+// key in the legacy format of BIP 137. The challenge must pay to the key's
+// public key with P2PKH, where the key may be compressed or not, or to its
+// compressed public key with P2WPKH or P2SH-P2WPKH. The signature is
+// deterministic, with the nonce of RFC 6979.
+func SignLegacy(secKey, challenge, message []byte) (string, error) {
+	priv, err := parseSecKey(secKey)
+	if err != nil {
+		return "", err
+	}
+	header, keyHash, err := legacyHeader(challenge)
+	if err != nil {
+		return "", err
+	}
+	if header == HeaderCompressed && !bytes.Equal(keyHash,
+		legacyKeyHash(header, priv.PubKey())) {
+
+		header = HeaderUncompressed
+	}
+	if !bytes.Equal(keyHash, legacyKeyHash(header, priv.PubKey())) {
+		return "", ErrKeyMismatch
+	}
+
+	hash := LegacyMessageHash(message)
+	sig := ecdsa.SignCompact(priv, hash[:], header != HeaderUncompressed)
+	if header != HeaderUncompressed {
+		sig[0] += byte(header - HeaderCompressed)
+	}
+	return base64.StdEncoding.EncodeToString(sig), nil
+}
+
+// VerifyLegacy checks the legacy signature of the message for the message
+// challenge, the script of the P2PKH, P2SH-P2WPKH or P2WPKH address it's
+// signed for. The public key is recovered from the signature, and the
+// challenge must pay to it as its header says. Wallets older than BIP 137,
+// such as Electrum, sign for segwit addresses with the compressed P2PKH
+// header, so that header is taken for segwit addresses too. It fails with
+// ErrInvalidSignature, wrapped with the reason, if the signature doesn't
+// verify.
+func VerifyLegacy(challenge, message []byte, sig string) error {
+	b, err := base64.StdEncoding.DecodeString(sig)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrLegacyEncoding, err)
+	}
+	if len(b) != LegacySize || b[0] < byte(HeaderUncompressed) ||
+		b[0] >= byte(HeaderSegwit)+4 {
+
+		return ErrLegacyEncoding
+	}
+	recoveryID := (b[0] - byte(HeaderUncompressed)) % 4
+	header := LegacyHeader(b[0] - recoveryID)
+	want, keyHash, err := legacyHeader(challenge)
+	if err != nil {
+		return err
+	}
+	switch {
+	case header == want:
+	case header == HeaderUncompressed && want == HeaderCompressed:
+	case header == HeaderCompressed:
+		header = want
+	case want == HeaderCompressed:
+		return fmt.Errorf("%w: %v header for a P2PKH address",
+			ErrInvalidSignature, header)
+	default:
+		return fmt.Errorf("%w: %v header for a %v address",
+			ErrInvalidSignature, header, want)
+	}
+
+	// RecoverCompact reads the header of BIP 137's P2PKH addresses only.
+	compact := append([]byte{}, b...)
+	if header != HeaderUncompressed {
+		compact[0] = byte(HeaderCompressed) + recoveryID
+	}
+	hash := LegacyMessageHash(message)
+	pubKey, _, err := ecdsa.RecoverCompact(compact, hash[:])
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	if !bytes.Equal(keyHash, legacyKeyHash(header, pubKey)) {
+		return fmt.Errorf("%w: recovered key doesn't match the address",
+			ErrInvalidSignature)
+	}
+	return nil
+}
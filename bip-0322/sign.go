@@ -0,0 +1,228 @@
+package signmessage
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/btcsuite/btcd/wire"
+	sighash "github.com/christsim/bips/bip-0143"
+	bech32 "github.com/christsim/bips/bip-0173"
+	schnorr "github.com/christsim/bips/bip-0340"
+	taproot "github.com/christsim/bips/bip-0341"
+	tapscript "github.com/christsim/bips/bip-0342"
+	"golang.org/x/crypto/ripemd160"
+)
+
+var (
+	// ErrSecKey is returned by Sign for a secret key that isn't 32 bytes
+	// below the order of the curve, or is zero.
+	ErrSecKey = errors.New("signmessage: invalid secret key")
+
+	// ErrUnsupportedScript is returned by Sign for a message challenge it
+	// can't sign for: any but P2PKH, P2WPKH, P2SH-P2WPKH and P2TR. The
+	// legacy functions return it for P2TR too.
+	ErrUnsupportedScript = errors.New("signmessage: unsupported message " +
+		"challenge")
+
+	// ErrKeyMismatch is returned by Sign and SignLegacy when the message
+	// challenge doesn't pay to the secret key.
+	ErrKeyMismatch = errors.New("signmessage: message challenge doesn't " +
+		"pay to the key")
+
+	// ErrNeedsFull is returned by Sign for a simple signature of a message
+	// challenge that needs a scriptSig.
+	ErrNeedsFull = errors.New("signmessage: message challenge needs the " +
+		"full format")
+)
+
+// hash160 returns the RIPEMD160 of the SHA256 of data.
+func hash160(data []byte) []byte {
+	sha := sha256.Sum256(data)
+	h := ripemd160.New()
+	h.Write(sha[:])
+	return h.Sum(nil)
+}
+
+// pushData returns the script pushing data of up to 75 bytes.
+func pushData(data []byte) []byte {
+	return append([]byte{byte(len(data))}, data...)
+}
+
+// Challenges returns the message challenges of the secret key Sign signs
+// for: its P2PKH, P2WPKH, P2SH-P2WPKH and BIP 86 P2TR scripts, in that
+// order.
+func Challenges(secKey []byte) ([][]byte, error) {
+	priv, err := parseSecKey(secKey)
+	if err != nil {
+		return nil, err
+	}
+	pubKeyHash := hash160(priv.PubKey().SerializeCompressed())
+	witnessScript := bech32.WitnessScript(0, pubKeyHash)
+	outputKey, err := taprootKey(secKey)
+	if err != nil {
+		return nil, err
+	}
+	return [][]byte{
+		pubKeyHashScript(pubKeyHash),
+		witnessScript,
+		scriptHashScript(hash160(witnessScript)),
+		taproot.OutputScript(outputKey),
+	}, nil
+}
+
+// parseSecKey parses a secret key.
+func parseSecKey(secKey []byte) (*btcec.PrivateKey, error) {
+	var d btcec.ModNScalar
+	if len(secKey) != 32 || d.SetByteSlice(secKey) || d.IsZero() {
+		return nil, ErrSecKey
+	}
+	return btcec.PrivKeyFromScalar(&d), nil
+}
+
+// taprootKey returns the output key of the BIP 86 output of the secret key,
+// which commits to no script tree.
+func taprootKey(secKey []byte) ([]byte, error) {
+	priv, err := parseSecKey(secKey)
+	if err != nil {
+		return nil, err
+	}
+	internalKey := priv.PubKey().SerializeCompressed()[1:]
+	outputKey, _, err := taproot.TweakPubKey(internalKey, nil)
+	return outputKey, err
+}
+
+// isTaprootScript reports whether the script is a P2TR script.
+func isTaprootScript(script []byte) bool {
+	version, program, ok := bech32.ParseWitnessScript(script)
+	return ok && version == taproot.WitnessVersion && len(program) == 32
+}
+
+// ecdsaSignature returns the ECDSA signature of the hash with the secret
+// key, with SIGHASH_ALL appended.
+func ecdsaSignature(priv *btcec.PrivateKey, hash [32]byte) []byte {
+	sig := ecdsa.Sign(priv, hash[:]).Serialize()
+	return append(sig, byte(sighash.All))
+}
+
+// pubKeyHashWitness returns the witness of a P2WPKH input of to_sign, on
+// its own or nested in P2SH, signed with the secret key.
+func pubKeyHashWitness(toSign *wire.MsgTx,
+	priv *btcec.PrivateKey) (wire.TxWitness, error) {
+
+	pubKey := priv.PubKey().SerializeCompressed()
+	scriptCode := sighash.PubKeyHashScriptCode(hash160(pubKey))
+	hash, err := sighash.NewWitnessHashes(toSign).SigHash(0, scriptCode, 0,
+		sighash.All)
+	if err != nil {
+		return nil, err
+	}
+	return wire.TxWitness{ecdsaSignature(priv, hash), pubKey}, nil
+}
+
+// Sign signs the message for the message challenge with the secret key, in
+// the format. The challenge must pay to the key's compressed public key
+// with P2PKH, P2WPKH or P2SH-P2WPKH, or to its BIP 86 output key with P2TR;
+// the first and third need a scriptSig, which only the full format holds.
+// Taproot signatures use fresh auxiliary randomness.
+func Sign(secKey, challenge, message []byte, format Format) (string,
+	error) {
+
+	auxRand := make([]byte, schnorr.AuxRandSize)
+	if _, err := rand.Read(auxRand); err != nil {
+		return "", err
+	}
+	return sign(secKey, challenge, message, format, auxRand)
+}
+
+// sign signs as Sign does, with the auxiliary randomness for taproot
+// signatures.
+func sign(secKey, challenge, message []byte, format Format,
+	auxRand []byte) (string, error) {
+
+	priv, err := parseSecKey(secKey)
+	if err != nil {
+		return "", err
+	}
+	pubKey := priv.PubKey().SerializeCompressed()
+	pubKeyHash := hash160(pubKey)
+	witnessScript := bech32.WitnessScript(0, pubKeyHash)
+
+	toSign := ToSign(ToSpend(challenge, message))
+	txIn := toSign.TxIn[0]
+	version, program, isWitness := bech32.ParseWitnessScript(challenge)
+	switch {
+	case isPubKeyHashScript(challenge):
+		if !bytes.Equal(challenge[3:23], pubKeyHash) {
+			return "", ErrKeyMismatch
+		}
+		hash, err := sighash.LegacySigHash(toSign, 0, challenge,
+			sighash.All)
+		if err != nil {
+			return "", err
+		}
+		txIn.SignatureScript = append(pushData(ecdsaSignature(priv,
+			hash)), pushData(pubKey)...)
+
+	case isScriptHashScript(challenge):
+		if !bytes.Equal(challenge[2:22], hash160(witnessScript)) {
+			return "", ErrKeyMismatch
+		}
+		txIn.SignatureScript = pushData(witnessScript)
+		witness, err := pubKeyHashWitness(toSign, priv)
+		if err != nil {
+			return "", err
+		}
+		txIn.Witness = witness
+
+	case isWitness && version == 0 && len(program) == 20:
+		if !bytes.Equal(program, pubKeyHash) {
+			return "", ErrKeyMismatch
+		}
+		witness, err := pubKeyHashWitness(toSign, priv)
+		if err != nil {
+			return "", err
+		}
+		txIn.Witness = witness
+
+	case isTaprootScript(challenge):
+		outputKey, err := taprootKey(secKey)
+		if err != nil {
+			return "", err
+		}
+		if !bytes.Equal(program, outputKey) {
+			return "", ErrKeyMismatch
+		}
+		tweaked, err := taproot.TweakSecKey(secKey, nil)
+		if err != nil {
+			return "", err
+		}
+		hashes, err := tapscript.NewSigHashes(toSign,
+			[]*wire.TxOut{wire.NewTxOut(0, challenge)})
+		if err != nil {
+			return "", err
+		}
+		hash, err := hashes.SigHash(0, tapscript.SigHashDefault, nil,
+			nil)
+		if err != nil {
+			return "", err
+		}
+		sig, err := schnorr.Sign(tweaked, hash[:], auxRand)
+		if err != nil {
+			return "", err
+		}
+		txIn.Witness = wire.TxWitness{sig}
+
+	default:
+		return "", fmt.Errorf("%w: %x", ErrUnsupportedScript, challenge)
+	}
+
+	if format == Simple && len(txIn.SignatureScript) != 0 {
+		return "", ErrNeedsFull
+	}
+	return encode(toSign, format), nil
+}
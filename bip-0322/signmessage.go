@@ -0,0 +1,272 @@
+// Package signmessage implements the generic signed messages of BIP 322,
+// which prove control of an address by spending a virtual output that
+// commits to the message: to_spend, whose output has the address's script as
+// the message challenge, and to_sign, which spends it.
+//
+//	sig, err := signmessage.Sign(key, challenge, msg, signmessage.Full)
+//	err = signmessage.Verify(challenge, msg, sig)
+//
+// A signature in the simple format is the witness of to_sign's input, and
+// one in the full format is the whole of to_sign, which P2PKH and nested
+// P2SH-P2WPKH addresses need for their scriptSig. Both are in base64.
+// Verification runs the script interpreter of btcd, and tells signatures
+// that only fail the rules kept for upgrades apart with ErrInconclusive.
+// Proofs of funds, whose to_sign spends further inputs, aren't supported.
+//
+// SignLegacy and VerifyLegacy make and check the signatures of BIP 137,
+// which came before BIP 322 and which wallets still use: a recoverable
+// ECDSA signature of the message, whose header byte says the kind of
+// address the recovered key pays to.
+package signmessage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// HashSize is the size of message hashes.
+const HashSize = sha256.Size
+
+// tagMessage is the tag of the message hash.
+const tagMessage = "BIP0322-signed-message"
+
+// Format is the format of a signature.
+type Format int
+
+// The signature formats.
+const (
+	// Simple signatures are the witness of to_sign's input.
+	Simple Format = iota
+
+	// Full signatures are the whole of to_sign.
+	Full
+)
+
+// String returns the name of the format.
+func (f Format) String() string {
+	switch f {
+	case Simple:
+		return "simple"
+	case Full:
+		return "full"
+	}
+	return fmt.Sprintf("Format(%d)", int(f))
+}
+
+var (
+	// ErrSignatureEncoding is returned by Verify for a signature that
+	// isn't base64, or whose bytes are neither a witness nor a
+	// transaction.
+	ErrSignatureEncoding = errors.New("signmessage: signature isn't a " +
+		"witness or transaction")
+
+	// ErrInvalidToSign is returned by Verify for a full signature whose
+	// transaction isn't a to_sign of the message: one spending to_spend
+	// alone, with a single empty OP_RETURN output.
+	ErrInvalidToSign = errors.New("signmessage: transaction isn't a " +
+		"to_sign of the message")
+
+	// ErrInvalidSignature is returned by Verify when the message
+	// challenge fails to run, and by VerifyLegacy when the recovered key
+	// doesn't match the address, wrapped with the reason.
+	ErrInvalidSignature = errors.New("signmessage: invalid signature")
+
+	// ErrInconclusive is returned by Verify when the message challenge
+	// runs under the consensus rules but fails those kept for upgrades,
+	// such as for unknown witness versions, so that the signature may be
+	// valid under rules that come later.
+	ErrInconclusive = errors.New("signmessage: inconclusive signature")
+)
+
+// taggedHash returns the BIP 340 tagged hash of the data with the tag.
+func taggedHash(tag string, data ...[]byte) [HashSize]byte {
+	tagHash := sha256.Sum256([]byte(tag))
+	h := sha256.New()
+	h.Write(tagHash[:])
+	h.Write(tagHash[:])
+	for _, d := range data {
+		h.Write(d)
+	}
+	var hash [HashSize]byte
+	h.Sum(hash[:0])
+	return hash
+}
+
+// MessageHash returns the hash of the message that to_spend commits to.
+func MessageHash(message []byte) [HashSize]byte {
+	return taggedHash(tagMessage, message)
+}
+
+// ToSpend returns the virtual transaction whose output has the message
+// challenge as its script, and whose input commits to the message.
+func ToSpend(challenge, message []byte) *wire.MsgTx {
+	hash := MessageHash(message)
+	tx := wire.NewMsgTx(0)
+	txIn := wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{},
+		wire.MaxPrevOutIndex), append([]byte{txscript.OP_0,
+		txscript.OP_DATA_32}, hash[:]...), nil)
+	txIn.Sequence = 0
+	tx.AddTxIn(txIn)
+	tx.AddTxOut(wire.NewTxOut(0, challenge))
+	return tx
+}
+
+// ToSign returns the virtual transaction spending the output of to_spend,
+// unsigned, with a single empty OP_RETURN output.
+func ToSign(toSpend *wire.MsgTx) *wire.MsgTx {
+	hash := toSpend.TxHash()
+	tx := wire.NewMsgTx(0)
+	txIn := wire.NewTxIn(wire.NewOutPoint(&hash, 0), nil, nil)
+	txIn.Sequence = 0
+	tx.AddTxIn(txIn)
+	tx.AddTxOut(wire.NewTxOut(0, []byte{txscript.OP_RETURN}))
+	return tx
+}
+
+// encodeWitness returns the serialization of a witness: its number of
+// items, followed by each prefixed with its size.
+func encodeWitness(witness wire.TxWitness) []byte {
+	var b bytes.Buffer
+	if err := wire.WriteVarInt(&b, 0, uint64(len(witness))); err != nil {
+		panic(err)
+	}
+	for _, item := range witness {
+		if err := wire.WriteVarBytes(&b, 0, item); err != nil {
+			panic(err)
+		}
+	}
+	return b.Bytes()
+}
+
+// decodeWitness parses a witness that takes up all of b.
+func decodeWitness(b []byte) (wire.TxWitness, error) {
+	r := bytes.NewReader(b)
+	n, err := wire.ReadVarInt(r, 0)
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(len(b)) {
+		return nil, fmt.Errorf("%d items in %d bytes", n, len(b))
+	}
+	witness := make(wire.TxWitness, n)
+	for i := range witness {
+		witness[i], err = wire.ReadVarBytes(r, 0, uint32(len(b)),
+			"witness item")
+		if err != nil {
+			return nil, err
+		}
+	}
+	if r.Len() != 0 {
+		return nil, fmt.Errorf("%d bytes after the witness", r.Len())
+	}
+	return witness, nil
+}
+
+// encode returns the signature of the signed to_sign in the format.
+func encode(toSign *wire.MsgTx, format Format) string {
+	if format == Simple {
+		return base64.StdEncoding.EncodeToString(
+			encodeWitness(toSign.TxIn[0].Witness))
+	}
+	var b bytes.Buffer
+	if err := toSign.Serialize(&b); err != nil {
+		panic(err)
+	}
+	return base64.StdEncoding.EncodeToString(b.Bytes())
+}
+
+// decode returns the to_sign of the signature of to_spend, which is first
+// read as a simple signature and then as a full one, and the format it's
+// in.
+func decode(toSpend *wire.MsgTx, sig string) (*wire.MsgTx, Format, error) {
+	b, err := base64.StdEncoding.DecodeString(sig)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: %v", ErrSignatureEncoding, err)
+	}
+
+	toSign := ToSign(toSpend)
+	if witness, err := decodeWitness(b); err == nil {
+		toSign.TxIn[0].Witness = witness
+		return toSign, Simple, nil
+	}
+
+	tx := &wire.MsgTx{}
+	r := bytes.NewReader(b)
+	if err := tx.Deserialize(r); err != nil || r.Len() != 0 {
+		return nil, 0, ErrSignatureEncoding
+	}
+	switch {
+	case len(tx.TxIn) != 1:
+		return nil, 0, fmt.Errorf("%w: %d inputs", ErrInvalidToSign,
+			len(tx.TxIn))
+	case tx.TxIn[0].PreviousOutPoint != toSign.TxIn[0].PreviousOutPoint:
+		return nil, 0, fmt.Errorf("%w: spends %v",
+			ErrInvalidToSign, tx.TxIn[0].PreviousOutPoint)
+	case len(tx.TxOut) != 1 || tx.TxOut[0].Value != 0 ||
+		!bytes.Equal(tx.TxOut[0].PkScript, toSign.TxOut[0].PkScript):
+
+		return nil, 0, fmt.Errorf("%w: outputs aren't a single "+
+			"empty OP_RETURN", ErrInvalidToSign)
+	}
+	return tx, Full, nil
+}
+
+// consensusFlags are the script verification flags of the consensus rules.
+const consensusFlags = txscript.ScriptBip16 |
+	txscript.ScriptVerifyDERSignatures |
+	txscript.ScriptVerifyCheckLockTimeVerify |
+	txscript.ScriptVerifyCheckSequenceVerify |
+	txscript.ScriptVerifyWitness |
+	txscript.ScriptStrictMultiSig |
+	txscript.ScriptVerifyTaproot
+
+// execute runs the message challenge against the input of to_sign with the
+// script verification flags.
+func execute(challenge []byte, toSign *wire.MsgTx,
+	flags txscript.ScriptFlags) error {
+
+	fetcher := txscript.NewCannedPrevOutputFetcher(challenge, 0)
+	vm, err := txscript.NewEngine(challenge, toSign, 0, flags, nil,
+		txscript.NewTxSigHashes(toSign, fetcher), 0, fetcher)
+	if err != nil {
+		return err
+	}
+	return vm.Execute()
+}
+
+// Verify checks the signature of the message for the message challenge,
+// the script of the address it's signed for, in either format. It fails
+// with ErrInconclusive if the challenge only fails the rules kept for
+// upgrades, and with ErrInvalidSignature, wrapped with the reason, if it
+// fails to run otherwise.
+func Verify(challenge, message []byte, sig string) error {
+	toSign, _, err := decode(ToSpend(challenge, message), sig)
+	if err != nil {
+		return err
+	}
+	err = execute(challenge, toSign, txscript.StandardVerifyFlags)
+	if err == nil {
+		return nil
+	}
+	if execute(challenge, toSign, consensusFlags) == nil {
+		return fmt.Errorf("%w: %v", ErrInconclusive, reason(err))
+	}
+	return fmt.Errorf("%w: %v", ErrInvalidSignature, reason(err))
+}
+
+// reason returns the description of a script error, or the name of its
+// code if it has none.
+func reason(err error) string {
+	var scriptErr txscript.Error
+	if errors.As(err, &scriptErr) && scriptErr.Description == "" {
+		return scriptErr.ErrorCode.String()
+	}
+	return err.Error()
+}
@@ -0,0 +1,653 @@
+package signmessage
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/rand"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/christsim/bips/base58"
+	schnorr "github.com/christsim/bips/bip-0340"
+	"github.com/christsim/bips/internal/vectorfile"
+)
+
+// ErrVectorMismatch is returned by CheckVector when the package doesn't
+// give the hashes, signature or outcome a vector expects.
+var ErrVectorMismatch = errors.New("signmessage: vector mismatch")
+
+// Vector is a signature of a message for an address, and the outcome of
+// verifying it.
+type Vector struct {
+	Address string
+	Message string
+
+	// SecKey is the secret key the signature is made with, and AuxRand
+	// the auxiliary randomness of a taproot one. Both are empty for
+	// signatures that aren't made by Sign, which are only verified.
+	SecKey  []byte
+	AuxRand []byte
+
+	Format    Format
+	Signature string
+
+	// MessageHash is the hash of the message, and ToSpend and ToSign the
+	// txids of the virtual transactions, with to_sign unsigned, in the
+	// byte order of block explorers.
+	MessageHash []byte
+	ToSpend     string
+	ToSign      string
+
+	// Err is the error verifying the signature fails with, or nil.
+	Err error
+
+	// Comment describes what the vector exercises.
+	Comment string
+}
+
+// newVector verifies the signature of the message for the vector.
+func newVector(addr, message string, format Format, sig string,
+	comment string) Vector {
+
+	challenge, err := AddressScript(addr)
+	if err != nil {
+		panic(err)
+	}
+	hash := MessageHash([]byte(message))
+	toSpend := ToSpend(challenge, []byte(message))
+	return Vector{
+		Address:     addr,
+		Message:     message,
+		Format:      format,
+		Signature:   sig,
+		MessageHash: hash[:],
+		ToSpend:     toSpend.TxHash().String(),
+		ToSign:      ToSign(toSpend).TxHash().String(),
+		Err:         Verify(challenge, []byte(message), sig),
+		Comment:     comment,
+	}
+}
+
+// newSignedVector signs the message for the vector.
+func newSignedVector(secKey []byte, addr, message string, format Format,
+	auxRand []byte, comment string) Vector {
+
+	challenge, err := AddressScript(addr)
+	if err != nil {
+		panic(err)
+	}
+	sig, err := sign(secKey, challenge, []byte(message), format, auxRand)
+	if err != nil {
+		panic(err)
+	}
+	v := newVector(addr, message, format, sig, comment)
+	v.SecKey = secKey
+	if isTaprootScript(challenge) {
+		v.AuxRand = auxRand
+	}
+	return v
+}
+
+// specKey is the key of the examples of the BIP.
+const specKey = "L3VFeEujGtevx9w18HD1fhRbCH67Az2dpCymeRE1SoPK6XQtaN2k"
+
+// specVectors are the examples of the BIP, signed with specKey, with the
+// txids of their virtual transactions where the BIP gives them.
+var specVectors = []struct {
+	address, message, signature  string
+	messageHash, toSpend, toSign string
+	signed                       bool
+	comment                      string
+}{
+	{
+		address: "bc1q9vza2e8x573nczrlzms0wvx3gsqjx7vavgkx0l",
+		signature: "AkcwRAIgM2gBAQqvZX15ZiysmKmQpDrG83avLIT492QBzLnQ" +
+			"IxYCIBaTpOaD20qRlEylyxFSeEA2ba9YOixpX8z46TSDtS40" +
+			"ASECx/EgAxlkQpQ9hYjgGu6EBCPMVPwVIVJqO4XCsMvViHI=",
+		messageHash: "c90c269c4f8fcbe6880f72a721ddfbf1" +
+			"914268a794cbb21cfafee13770ae19f1",
+		toSpend: "c5680aa69bb8d860bf82d4e9cd3504b5" +
+			"5dde018de765a91bb566283c545a99a7",
+		toSign: "1e9654e951a5ba44c8604c4de6c67fd7" +
+			"8a27e81dcadcfe1edf638ba3aaebaed6",
+		comment: "BIP 322 P2WPKH signature of the empty message",
+	},
+	{
+		address: "bc1q9vza2e8x573nczrlzms0wvx3gsqjx7vavgkx0l",
+		message: "Hello World",
+		signature: "AkcwRAIgZRfIY3p7/DoVTty6YZbWS71bc5Vct9p9Fia83eRm" +
+			"w2QCICK/ENGfwLtptFluMGs2KsqoNSk89pO7F29zJLUx9a/s" +
+			"ASECx/EgAxlkQpQ9hYjgGu6EBCPMVPwVIVJqO4XCsMvViHI=",
+		messageHash: "f0eb03b1a75ac6d9847f55c624a99169" +
+			"b5dccba2a31f5b23bea77ba270de0a7a",
+		toSpend: "b79d196740ad5217771c1098fc4a4b51" +
+			"e0535c32236c71f1ea4d61a2d603352b",
+		toSign: "88737ae86f2077145f93cc4b153ae9a1" +
+			"cb8d56afa511988c149c5c8c9d93bddf",
+		comment: "BIP 322 P2WPKH signature of Hello World",
+	},
+	{
+		address: "bc1q9vza2e8x573nczrlzms0wvx3gsqjx7vavgkx0l",
+		message: "Hello World",
+		signature: "AkgwRQIhAOzyynlqt93lOKJr+wmmxIens//zPzl9tqIOua93" +
+			"wO6MAiBi5n5EyAcPScOjf1lAqIUIQtr3zKNeavYabHyR8eGh" +
+			"owEhAsfxIAMZZEKUPYWI4BruhAQjzFT8FSFSajuFwrDL1Yhy",
+		messageHash: "f0eb03b1a75ac6d9847f55c624a99169" +
+			"b5dccba2a31f5b23bea77ba270de0a7a",
+		toSpend: "b79d196740ad5217771c1098fc4a4b51" +
+			"e0535c32236c71f1ea4d61a2d603352b",
+		toSign: "88737ae86f2077145f93cc4b153ae9a1" +
+			"cb8d56afa511988c149c5c8c9d93bddf",
+		signed: true,
+		comment: "BIP 322 P2WPKH signature of Hello World, " +
+			"without a low R",
+	},
+	{
+		address: "bc1ppv609nr0vr25u07u95waq5lucwfm6tde4nydujnu" +
+			"8npg4q75mr5sxq8lt3",
+		message: "Hello World",
+		signature: "AUHd69PrJQEv+oKTfZ8l+WROBHuy9HKrbFCJu7U1iK2iiEy1" +
+			"vMU5EfMtjc+VSHM7aU0SDbak5IUZRVno2P5mjSafAQ==",
+		comment: "BIP 322 P2TR signature of Hello World, with " +
+			"SIGHASH_ALL",
+	},
+}
+
+// mustDecodeHex decodes hex the package embeds, which is known to be valid.
+func mustDecodeHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// SpecVectors returns the examples of the BIP, which verify. It panics if
+// the package gives them other hashes, or doesn't verify them.
+func SpecVectors() []Vector {
+	wif, err := base58.DecodeWIF(specKey)
+	if err != nil {
+		panic(err)
+	}
+
+	vectors := make([]Vector, len(specVectors))
+	for i, sv := range specVectors {
+		format := Simple
+		v := newVector(sv.address, sv.message, format, sv.signature,
+			sv.comment)
+		if sv.signed {
+			v = newSignedVector(wif.Key, sv.address, sv.message,
+				format, nil, sv.comment)
+		}
+		switch {
+		case v.Signature != sv.signature || v.Err != nil:
+			panic(fmt.Sprintf("signmessage: %v: signature %v, %v",
+				sv.comment, v.Signature, v.Err))
+		case sv.messageHash != "" && !bytes.Equal(v.MessageHash,
+			mustDecodeHex(sv.messageHash)):
+
+			panic(fmt.Sprintf("signmessage: %v: message hash %x",
+				sv.comment, v.MessageHash))
+		case sv.toSpend != "" && (v.ToSpend != sv.toSpend ||
+			v.ToSign != sv.toSign):
+
+			panic(fmt.Sprintf("signmessage: %v: txids %v, %v",
+				sv.comment, v.ToSpend, v.ToSign))
+		}
+		vectors[i] = v
+	}
+	return vectors
+}
+
+// randomMessage returns a random message of printable characters, or now
+// and then the empty one or one that isn't ASCII.
+func randomMessage(rng *rand.Rand) string {
+	const chars = "abcdefghijklmnopqrstuvwxyz" +
+		"ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789 .,:;!?'-"
+	switch rng.Intn(8) {
+	case 0:
+		return ""
+	case 1:
+		return "Proof of reserves éè ₿ \U0001f511"
+	}
+	b := make([]byte, 1+rng.Intn(120))
+	for i := range b {
+		b[i] = chars[rng.Intn(len(chars))]
+	}
+	return string(b)
+}
+
+// randomSecKey returns a random valid secret key.
+func randomSecKey(rng *rand.Rand) []byte {
+	for {
+		secKey := make([]byte, 32)
+		rng.Read(secKey)
+		if _, err := parseSecKey(secKey); err == nil {
+			return secKey
+		}
+	}
+}
+
+// challengeNames describe the message challenges of Challenges.
+var challengeNames = []string{"P2PKH", "P2WPKH", "P2SH-P2WPKH", "P2TR"}
+
+// needsFull reports whether signatures for the message challenge need a
+// scriptSig, which only the full format holds.
+func needsFull(challenge []byte) bool {
+	return isPubKeyHashScript(challenge) || isScriptHashScript(challenge)
+}
+
+// appendByte returns the signature with a zero byte appended.
+func appendByte(sig string) string {
+	b, err := base64.StdEncoding.DecodeString(sig)
+	if err != nil {
+		panic(err)
+	}
+	return base64.StdEncoding.EncodeToString(append(b, 0x00))
+}
+
+// tamper returns the full signature with f applied to its to_sign.
+func tamper(sig string, f func(toSign *wire.MsgTx)) string {
+	b, err := base64.StdEncoding.DecodeString(sig)
+	if err != nil {
+		panic(err)
+	}
+	tx := &wire.MsgTx{}
+	if err := tx.Deserialize(bytes.NewReader(b)); err != nil {
+		panic(err)
+	}
+	f(tx)
+	return encode(tx, Full)
+}
+
+// RandomVectors returns vectors of count random keys and messages derived
+// from a math/rand source with the seed: signatures for each of the key's
+// addresses in each format it can be signed in, on a random network, and
+// signatures that don't verify or are inconclusive.
+func RandomVectors(rngSeed int64, count int) []Vector {
+	rng := rand.New(rand.NewSource(rngSeed))
+	var vectors []Vector
+	for n := 0; n < count; n++ {
+		secKey := randomSecKey(rng)
+		message := randomMessage(rng)
+		net := networks[rng.Intn(len(networks))]
+		challenges, err := Challenges(secKey)
+		if err != nil {
+			panic(err)
+		}
+
+		addrs := make([]string, len(challenges))
+		full := make([]string, len(challenges))
+		first := make([]Vector, len(challenges))
+		for i, challenge := range challenges {
+			if addrs[i], err = Address(challenge, net); err != nil {
+				panic(err)
+			}
+			for _, format := range []Format{Simple, Full} {
+				if format == Simple && needsFull(challenge) {
+					continue
+				}
+				auxRand := make([]byte, schnorr.AuxRandSize)
+				rng.Read(auxRand)
+				v := newSignedVector(secKey, addrs[i], message,
+					format, auxRand, fmt.Sprintf("%v %v "+
+						"signature", challengeNames[i],
+						format))
+				vectors = append(vectors, v)
+				if first[i].Signature == "" {
+					first[i] = v
+				}
+				if format == Full {
+					full[i] = v.Signature
+				}
+			}
+		}
+
+		other := message + "."
+		wrongKey := randomSecKey(rng)
+		wrongAddrs := make([]string, len(challenges))
+		wrongChallenges, err := Challenges(wrongKey)
+		if err != nil {
+			panic(err)
+		}
+		for i, challenge := range wrongChallenges {
+			addr, err := Address(challenge, net)
+			if err != nil {
+				panic(err)
+			}
+			wrongAddrs[i] = addr
+		}
+		i := rng.Intn(len(challenges))
+		unknown, err := Address(append([]byte{0x52, 0x20},
+			challenges[3][2:]...), net)
+		if err != nil {
+			panic(err)
+		}
+		empty := base64.StdEncoding.EncodeToString(
+			encodeWitness(wire.TxWitness{}))
+
+		name := challengeNames[i]
+		vectors = append(vectors,
+			newVector(addrs[i], other, first[i].Format,
+				first[i].Signature, name+" signature of "+
+					"another message"),
+			newVector(wrongAddrs[i], message, first[i].Format,
+				first[i].Signature, name+" signature for "+
+					"another key"),
+			newVector(addrs[i], message, Full, tamper(full[i],
+				func(tx *wire.MsgTx) {
+					tx.TxOut[0].Value = 1
+				}), name+" signature of a to_sign with a "+
+				"nonzero output"),
+			newVector(addrs[i], message, Full, tamper(full[i],
+				func(tx *wire.MsgTx) {
+					tx.AddTxIn(wire.NewTxIn(
+						&tx.TxIn[0].PreviousOutPoint,
+						nil, nil))
+				}), name+" signature of a to_sign with a "+
+				"second input"),
+			newVector(addrs[i], message, Full, tamper(full[i],
+				func(tx *wire.MsgTx) {
+					tx.TxIn[0].PreviousOutPoint.Index = 1
+				}), name+" signature of a to_sign spending "+
+				"another output"),
+			newVector(addrs[i], message, Full, appendByte(full[i]),
+				name+" signature followed by other data"),
+			newVector(addrs[0], message, Simple, empty,
+				"P2PKH signature without a scriptSig"),
+			newVector(unknown, message, Simple, empty,
+				"witness version 2 signature"),
+		)
+	}
+	return vectors
+}
+
+// CheckVector verifies the vector's signature, and checks its hashes and
+// the format it's in. A vector with a secret key is signed again.
+func CheckVector(v Vector) error {
+	challenge, err := AddressScript(v.Address)
+	if err != nil {
+		return err
+	}
+	message := []byte(v.Message)
+	hash := MessageHash(message)
+	if !bytes.Equal(hash[:], v.MessageHash) {
+		return fmt.Errorf("%w: message hash %x, expected %x",
+			ErrVectorMismatch, hash, v.MessageHash)
+	}
+	toSpend := ToSpend(challenge, message)
+	toSign := ToSign(toSpend)
+	if toSpend.TxHash().String() != v.ToSpend ||
+		toSign.TxHash().String() != v.ToSign {
+
+		return fmt.Errorf("%w: txids %v and %v, expected %v and %v",
+			ErrVectorMismatch, toSpend.TxHash(), toSign.TxHash(),
+			v.ToSpend, v.ToSign)
+	}
+
+	err = Verify(challenge, message, v.Signature)
+	if !vectorfile.SameError(err, v.Err) {
+		return fmt.Errorf("%w: error %v, expected %v",
+			ErrVectorMismatch, err, v.Err)
+	}
+	if _, format, err := decode(toSpend, v.Signature); err == nil &&
+		format != v.Format {
+
+		return fmt.Errorf("%w: %v signature, expected %v",
+			ErrVectorMismatch, format, v.Format)
+	}
+
+	if v.SecKey == nil {
+		return nil
+	}
+	sig, err := sign(v.SecKey, challenge, message, v.Format, v.AuxRand)
+	if err != nil {
+		return err
+	}
+	if sig != v.Signature {
+		return fmt.Errorf("%w: signature %v, expected %v",
+			ErrVectorMismatch, sig, v.Signature)
+	}
+	return nil
+}
+
+// LegacyVector is a BIP 137 legacy signature of a message for an address,
+// and the outcome of verifying it.
+type LegacyVector struct {
+	Address string
+	Message string
+
+	// SecKey is the secret key the signature is made with. It's empty for
+	// signatures that aren't made by SignLegacy, which are only verified.
+	SecKey    []byte
+	Signature string
+
+	// MessageHash is the hash the signature signs.
+	MessageHash []byte
+
+	// Err is the error verifying the signature fails with, or nil.
+	Err error
+
+	// Comment describes what the vector exercises.
+	Comment string
+}
+
+// newLegacyVector verifies the legacy signature of the message for the
+// vector.
+func newLegacyVector(addr, message, sig, comment string) LegacyVector {
+	challenge, err := AddressScript(addr)
+	if err != nil {
+		panic(err)
+	}
+	hash := LegacyMessageHash([]byte(message))
+	return LegacyVector{
+		Address:     addr,
+		Message:     message,
+		Signature:   sig,
+		MessageHash: hash[:],
+		Err:         VerifyLegacy(challenge, []byte(message), sig),
+		Comment:     comment,
+	}
+}
+
+// newSignedLegacyVector signs the message for the vector.
+func newSignedLegacyVector(secKey []byte, addr, message,
+	comment string) LegacyVector {
+
+	challenge, err := AddressScript(addr)
+	if err != nil {
+		panic(err)
+	}
+	sig, err := SignLegacy(secKey, challenge, []byte(message))
+	if err != nil {
+		panic(err)
+	}
+	v := newLegacyVector(addr, message, sig, comment)
+	v.SecKey = secKey
+	return v
+}
+
+// The signmessage example of Bitcoin Core's functional tests, signed with a
+// compressed testnet key.
+const (
+	coreKey       = "cUeKHd5orzT3mz8P9pxyREHfsWtVfgsfDjiZZBcjUBAaGk1BTj7N"
+	coreAddress   = "mpLQjfK79b7CCV4VMJWEWAj5Mpx8Up5zxB"
+	coreMessage   = "This is just a test message"
+	coreSignature = "INbVnW4e6PeRmsv2Qgu8NuopvrVjkcxob+sX8OcZG0SA" +
+		"LhWybUjzMLPdAsXI46YZGb0KQTRii+wWIQzRpG/U+S0="
+)
+
+// legacyChallenges returns the message challenges of the secret key
+// SignLegacy signs for: its uncompressed and compressed P2PKH scripts and
+// its P2SH-P2WPKH and P2WPKH ones, in that order.
+func legacyChallenges(secKey []byte) [][]byte {
+	priv, err := parseSecKey(secKey)
+	if err != nil {
+		panic(err)
+	}
+	challenges, err := Challenges(secKey)
+	if err != nil {
+		panic(err)
+	}
+	uncompressed := hash160(priv.PubKey().SerializeUncompressed())
+	return [][]byte{pubKeyHashScript(uncompressed), challenges[0],
+		challenges[2], challenges[1]}
+}
+
+// legacyHeaders are the header bases of legacyChallenges.
+var legacyHeaders = []LegacyHeader{HeaderUncompressed, HeaderCompressed,
+	HeaderNestedSegwit, HeaderSegwit}
+
+// reheader returns the legacy signature with its header base replaced, and
+// its recovery ID added to it.
+func reheader(sig string, base LegacyHeader, recoveryID byte) string {
+	b, err := base64.StdEncoding.DecodeString(sig)
+	if err != nil {
+		panic(err)
+	}
+	b[0] = byte(base) + recoveryID
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+// recoveryID returns the recovery ID of a legacy signature.
+func recoveryID(sig string) byte {
+	b, err := base64.StdEncoding.DecodeString(sig)
+	if err != nil {
+		panic(err)
+	}
+	return (b[0] - byte(HeaderUncompressed)) % 4
+}
+
+// LegacyVectors returns vectors of BIP 137 legacy signatures: the example
+// of Bitcoin Core's tests, followed by those of count random keys and
+// messages derived from a math/rand source with the seed. Each key signs
+// for its addresses on a random network, for its segwit ones with the
+// compressed P2PKH header too, and signatures that don't verify follow. It
+// panics if the package doesn't reproduce the example.
+func LegacyVectors(rngSeed int64, count int) []LegacyVector {
+	wif, err := base58.DecodeWIF(coreKey)
+	if err != nil {
+		panic(err)
+	}
+	core := newSignedLegacyVector(wif.Key, coreAddress, coreMessage,
+		"Bitcoin Core compressed P2PKH signature")
+	if core.Signature != coreSignature || core.Err != nil {
+		panic(fmt.Sprintf("signmessage: Bitcoin Core signature %v, %v",
+			core.Signature, core.Err))
+	}
+	vectors := []LegacyVector{core}
+
+	rng := rand.New(rand.NewSource(rngSeed))
+	for n := 0; n < count; n++ {
+		secKey := randomSecKey(rng)
+		message := randomMessage(rng)
+		net := networks[rng.Intn(len(networks))]
+
+		addrs := make([]string, len(legacyHeaders))
+		sigs := make([]string, len(legacyHeaders))
+		for i, challenge := range legacyChallenges(secKey) {
+			addr, err := Address(challenge, net)
+			if err != nil {
+				panic(err)
+			}
+			v := newSignedLegacyVector(secKey, addr, message,
+				legacyHeaders[i].String()+" signature")
+			addrs[i], sigs[i] = addr, v.Signature
+			vectors = append(vectors, v)
+		}
+		for i := 2; i < len(addrs); i++ {
+			vectors = append(vectors, newLegacyVector(addrs[i],
+				message, reheader(sigs[i], HeaderCompressed,
+					recoveryID(sigs[i])),
+				legacyHeaders[i].String()+" signature with "+
+					"the compressed P2PKH header"))
+		}
+
+		wrongKey := randomSecKey(rng)
+		i := rng.Intn(len(legacyHeaders))
+		wrongAddr, err := Address(legacyChallenges(wrongKey)[i], net)
+		if err != nil {
+			panic(err)
+		}
+		challenges, err := Challenges(secKey)
+		if err != nil {
+			panic(err)
+		}
+		taprootAddr, err := Address(challenges[3], net)
+		if err != nil {
+			panic(err)
+		}
+		id := recoveryID(sigs[i])
+		b, err := base64.StdEncoding.DecodeString(sigs[i])
+		if err != nil {
+			panic(err)
+		}
+
+		name := legacyHeaders[i].String()
+		vectors = append(vectors,
+			newLegacyVector(addrs[i], message+".", sigs[i],
+				name+" signature of another message"),
+			newLegacyVector(wrongAddr, message, sigs[i],
+				name+" signature for another key"),
+			newLegacyVector(addrs[i], message,
+				reheader(sigs[i], legacyHeaders[i], id^1),
+				name+" signature with another recovery ID"),
+			newLegacyVector(addrs[0], message, reheader(sigs[0],
+				HeaderSegwit, recoveryID(sigs[0])),
+				"P2PKH signature with the P2WPKH header"),
+			newLegacyVector(addrs[3], message, reheader(sigs[3],
+				HeaderUncompressed, recoveryID(sigs[3])),
+				"P2WPKH signature with the uncompressed "+
+					"header"),
+			newLegacyVector(addrs[i], message,
+				reheader(sigs[i], HeaderUncompressed-4, id),
+				name+" signature with a header below 27"),
+			newLegacyVector(addrs[i], message,
+				reheader(sigs[i], HeaderSegwit+4, id),
+				name+" signature with a header above 42"),
+			newLegacyVector(addrs[i], message, base64.StdEncoding.
+				EncodeToString(b[:LegacySize-1]), name+
+				" signature cut short"),
+			newLegacyVector(addrs[i], message, sigs[i][1:],
+				name+" signature that isn't base64"),
+			newLegacyVector(taprootAddr, message, sigs[2],
+				"signature for a P2TR address"),
+		)
+	}
+	return vectors
+}
+
+// CheckLegacyVector verifies the vector's legacy signature and checks the
+// hash it signs. A vector with a secret key is signed again.
+func CheckLegacyVector(v LegacyVector) error {
+	challenge, err := AddressScript(v.Address)
+	if err != nil {
+		return err
+	}
+	message := []byte(v.Message)
+	hash := LegacyMessageHash(message)
+	if !bytes.Equal(hash[:], v.MessageHash) {
+		return fmt.Errorf("%w: message hash %x, expected %x",
+			ErrVectorMismatch, hash, v.MessageHash)
+	}
+	err = VerifyLegacy(challenge, message, v.Signature)
+	if !vectorfile.SameError(err, v.Err) {
+		return fmt.Errorf("%w: error %v, expected %v",
+			ErrVectorMismatch, err, v.Err)
+	}
+
+	if v.SecKey == nil {
+		return nil
+	}
+	sig, err := SignLegacy(v.SecKey, challenge, message)
+	if err != nil {
+		return err
+	}
+	if sig != v.Signature {
+		return fmt.Errorf("%w: signature %v, expected %v",
+			ErrVectorMismatch, sig, v.Signature)
+	}
+	return nil
+}
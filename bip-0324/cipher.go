@@ -0,0 +1,271 @@
+package v2transport
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/chacha20"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	// RekeyInterval is the number of messages each cipher encrypts with a
+	// key before replacing it with one derived from it.
+	RekeyInterval = 224
+
+	// LengthFieldLen is the size of the encrypted length of packets.
+	LengthFieldLen = 3
+
+	// HeaderLen is the size of the header byte of packets, whose top
+	// bit marks decoys.
+	HeaderLen = 1
+
+	// TagLen is the size of the Poly1305 tag of packets.
+	TagLen = 16
+
+	// Expansion is the number of bytes packets add to their contents.
+	Expansion = LengthFieldLen + HeaderLen + TagLen
+
+	// MaxContentsLen is the largest contents a packet can carry.
+	MaxContentsLen = 1<<(8*LengthFieldLen) - 1
+
+	// GarbageTerminatorLen is the size of the garbage terminators.
+	GarbageTerminatorLen = 16
+
+	// ignoreBit is the bit of the header byte of decoy packets.
+	ignoreBit = 0x80
+)
+
+// FSChaCha20 is the forward secure ChaCha20 stream cipher the lengths of
+// packets are encrypted with. Each length is a chunk of one keystream,
+// until RekeyInterval chunks have been encrypted, when the next 32 bytes of
+// the keystream become the key.
+type FSChaCha20 struct {
+	key    []byte
+	chunks uint64
+	stream *chacha20.Cipher
+}
+
+// NewFSChaCha20 returns a cipher with the initial key.
+func NewFSChaCha20(key []byte) *FSChaCha20 {
+	c := &FSChaCha20{key: append([]byte{}, key...)}
+	c.reset()
+	return c
+}
+
+// reset starts the keystream of the current key, whose nonce is the number
+// of keys before it.
+func (c *FSChaCha20) reset() {
+	var nonce [chacha20.NonceSize]byte
+	binary.LittleEndian.PutUint64(nonce[4:], c.chunks/RekeyInterval)
+	stream, err := chacha20.NewUnauthenticatedCipher(c.key, nonce[:])
+	if err != nil {
+		panic(err)
+	}
+	c.stream = stream
+}
+
+// Crypt encrypts or decrypts a chunk.
+func (c *FSChaCha20) Crypt(chunk []byte) []byte {
+	out := make([]byte, len(chunk))
+	c.stream.XORKeyStream(out, chunk)
+	c.chunks++
+	if c.chunks%RekeyInterval == 0 {
+		c.stream.XORKeyStream(c.key, make([]byte, len(c.key)))
+		c.reset()
+	}
+	return out
+}
+
+// FSChaCha20Poly1305 is the forward secure ChaCha20-Poly1305 AEAD the
+// contents of packets are encrypted with. The nonce of each packet is its
+// number since the last rekeying and the number of rekeyings, and every
+// RekeyInterval packets the key becomes the first 32 bytes of the
+// encryption of zeros with the nonce of the last packet and 0xffffffff.
+type FSChaCha20Poly1305 struct {
+	key     []byte
+	packets uint64
+}
+
+// NewFSChaCha20Poly1305 returns an AEAD with the initial key.
+func NewFSChaCha20Poly1305(key []byte) *FSChaCha20Poly1305 {
+	return &FSChaCha20Poly1305{key: append([]byte{}, key...)}
+}
+
+// nonce returns the nonce of the packet of the number since the last
+// rekeying, of the current key.
+func (c *FSChaCha20Poly1305) nonce(n uint32) []byte {
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	binary.LittleEndian.PutUint32(nonce, n)
+	binary.LittleEndian.PutUint64(nonce[4:], c.packets/RekeyInterval)
+	return nonce
+}
+
+// crypt encrypts or decrypts the next packet with its associated data.
+func (c *FSChaCha20Poly1305) crypt(aad, text []byte, decrypt bool) ([]byte,
+	error) {
+
+	aead, err := chacha20poly1305.New(c.key)
+	if err != nil {
+		panic(err)
+	}
+	nonce := c.nonce(uint32(c.packets % RekeyInterval))
+	var out []byte
+	if decrypt {
+		out, err = aead.Open(nil, nonce, text, aad)
+	} else {
+		out = aead.Seal(nil, nonce, text, aad)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDecryption, err)
+	}
+
+	if (c.packets+1)%RekeyInterval == 0 {
+		c.key = aead.Seal(nil, c.nonce(0xffffffff), make([]byte, 32),
+			nil)[:32]
+	}
+	c.packets++
+	return out, nil
+}
+
+// Encrypt encrypts the next packet with its associated data, and appends
+// the tag.
+func (c *FSChaCha20Poly1305) Encrypt(aad, plaintext []byte) []byte {
+	out, _ := c.crypt(aad, plaintext, false)
+	return out
+}
+
+// Decrypt decrypts the next packet with its associated data, failing with
+// ErrDecryption if its tag doesn't match.
+func (c *FSChaCha20Poly1305) Decrypt(aad, ciphertext []byte) ([]byte,
+	error) {
+
+	return c.crypt(aad, ciphertext, true)
+}
+
+// Keys are the keys and other secrets derived from the shared secret of a
+// connection.
+type Keys struct {
+	// SessionID identifies the connection, so that its peers can compare
+	// it out of band to rule out a man in the middle.
+	SessionID []byte
+
+	// InitiatorL and InitiatorP are the keys of the lengths and of the
+	// contents of the packets the initiator sends, and ResponderL and
+	// ResponderP of those the responder sends.
+	InitiatorL []byte
+	InitiatorP []byte
+	ResponderL []byte
+	ResponderP []byte
+
+	// GarbageTerminators are the terminator of the initiator's garbage,
+	// followed by that of the responder's.
+	GarbageTerminators []byte
+}
+
+// DeriveKeys derives the keys of a connection from its shared secret with
+// HKDF-SHA256, salted with the magic of the network, as the btcd wire
+// package numbers it.
+func DeriveKeys(secret []byte, magic uint32) *Keys {
+	salt := []byte("bitcoin_v2_shared_secret")
+	salt = binary.LittleEndian.AppendUint32(salt, magic)
+	prk := hkdf.Extract(sha256.New, secret, salt)
+	expand := func(info string) []byte {
+		out := make([]byte, 32)
+		_, err := io.ReadFull(hkdf.Expand(sha256.New, prk,
+			[]byte(info)), out)
+		if err != nil {
+			panic(err)
+		}
+		return out
+	}
+	return &Keys{
+		SessionID:          expand("session_id"),
+		InitiatorL:         expand("initiator_L"),
+		InitiatorP:         expand("initiator_P"),
+		ResponderL:         expand("responder_L"),
+		ResponderP:         expand("responder_P"),
+		GarbageTerminators: expand("garbage_terminators"),
+	}
+}
+
+// Cipher encrypts the packets one side of a connection sends and decrypts
+// those it receives.
+type Cipher struct {
+	sendL *FSChaCha20
+	sendP *FSChaCha20Poly1305
+	recvL *FSChaCha20
+	recvP *FSChaCha20Poly1305
+
+	// SessionID is the session ID of the keys.
+	SessionID []byte
+
+	// SendGarbageTerminator ends the garbage the side sends, and
+	// RecvGarbageTerminator the garbage it receives.
+	SendGarbageTerminator []byte
+	RecvGarbageTerminator []byte
+}
+
+// NewCipher returns the cipher of the initiator or of the responder of a
+// connection with the keys.
+func NewCipher(keys *Keys, initiating bool) *Cipher {
+	c := &Cipher{
+		sendL:                 NewFSChaCha20(keys.InitiatorL),
+		sendP:                 NewFSChaCha20Poly1305(keys.InitiatorP),
+		recvL:                 NewFSChaCha20(keys.ResponderL),
+		recvP:                 NewFSChaCha20Poly1305(keys.ResponderP),
+		SessionID:             keys.SessionID,
+		SendGarbageTerminator: keys.GarbageTerminators[:16],
+		RecvGarbageTerminator: keys.GarbageTerminators[16:],
+	}
+	if !initiating {
+		c.sendL, c.recvL = c.recvL, c.sendL
+		c.sendP, c.recvP = c.recvP, c.sendP
+		c.SendGarbageTerminator, c.RecvGarbageTerminator =
+			c.RecvGarbageTerminator, c.SendGarbageTerminator
+	}
+	return c
+}
+
+// Encrypt returns the packet of the contents: their encrypted length,
+// followed by the encryption of the header byte and the contents with the
+// associated data. A decoy packet has the ignore bit set in its header, so
+// the receiver drops it.
+func (c *Cipher) Encrypt(contents, aad []byte, ignore bool) ([]byte,
+	error) {
+
+	if len(contents) > MaxContentsLen {
+		return nil, fmt.Errorf("%w: %d bytes", ErrPacketTooLarge,
+			len(contents))
+	}
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(len(contents)))
+	header := byte(0)
+	if ignore {
+		header = ignoreBit
+	}
+	plaintext := append([]byte{header}, contents...)
+	packet := c.sendL.Crypt(length[:LengthFieldLen])
+	return append(packet, c.sendP.Encrypt(aad, plaintext)...), nil
+}
+
+// DecryptLength decrypts the length field of the next packet, and returns
+// the size of the contents it announces.
+func (c *Cipher) DecryptLength(field []byte) uint32 {
+	var length [4]byte
+	copy(length[:], c.recvL.Crypt(field[:LengthFieldLen]))
+	return binary.LittleEndian.Uint32(length[:])
+}
+
+// Decrypt decrypts the rest of a packet, whose length DecryptLength has
+// decrypted, and returns its contents and whether it's a decoy.
+func (c *Cipher) Decrypt(ciphertext, aad []byte) ([]byte, bool, error) {
+	plaintext, err := c.recvP.Decrypt(aad, ciphertext)
+	if err != nil {
+		return nil, false, err
+	}
+	return plaintext[HeaderLen:], plaintext[0]&ignoreBit != 0, nil
+}
@@ -0,0 +1,260 @@
+package v2transport
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+const (
+	// MaxGarbageLen is the most garbage a side may send after its key.
+	MaxGarbageLen = 4095
+
+	// v1HeaderSize is the size of the headers of version 1 messages:
+	// magic, command, payload length and checksum.
+	v1HeaderSize = 4 + CommandSize + 4 + 4
+)
+
+// Conn is a connection that speaks the version 2 transport protocol on the
+// wire, and version 1 messages to its user. Read and Write may be called
+// concurrently with each other, but not with themselves.
+type Conn struct {
+	net.Conn
+
+	cipher *Cipher
+	magic  uint32
+
+	// rbuf holds the rest of the last message read, and wbuf the start of
+	// a message being written.
+	rbuf []byte
+	wbuf []byte
+}
+
+// Handshake performs the handshake of the version 2 protocol over the
+// connection on the network of the magic, as the initiator if initiating is
+// set and as the responder otherwise, and returns a Conn over it. Its
+// writes run concurrently with its reads, so the handshake doesn't stall on
+// unbuffered connections such as those of net.Pipe.
+func Handshake(conn net.Conn, magic uint32, initiating bool) (*Conn,
+	error) {
+
+	secKey, err := btcec.NewPrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	ours, err := EllSwiftEncode(secKey.PubKey(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	garbage, err := randomGarbage()
+	if err != nil {
+		return nil, err
+	}
+
+	// The initiator sends its key and garbage right away, and the
+	// responder once it has the initiator's key, which it checks for a
+	// version 1 version message.
+	var sent <-chan error
+	if initiating {
+		sent = goWrite(conn, ours, garbage)
+	}
+	theirs := make([]byte, EllSwiftSize)
+	if _, err := io.ReadFull(conn, theirs); err != nil {
+		return nil, err
+	}
+	if !initiating && isV1Version(theirs, magic) {
+		return nil, ErrV1Peer
+	}
+	secret, err := SharedSecret(secKey.Serialize(), ours, theirs,
+		initiating)
+	if err != nil {
+		return nil, err
+	}
+	c := &Conn{
+		Conn:   conn,
+		cipher: NewCipher(DeriveKeys(secret, magic), initiating),
+		magic:  magic,
+	}
+
+	// Both then end their garbage, and send the version packet, which
+	// authenticates it.
+	version, err := c.cipher.Encrypt(nil, garbage, false)
+	if err != nil {
+		return nil, err
+	}
+	if initiating {
+		if err := <-sent; err != nil {
+			return nil, err
+		}
+		sent = goWrite(conn, c.cipher.SendGarbageTerminator, version)
+	} else {
+		sent = goWrite(conn, ours, garbage,
+			c.cipher.SendGarbageTerminator, version)
+	}
+
+	theirGarbage, err := c.readGarbage()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := c.readPacket(theirGarbage); err != nil {
+		return nil, err
+	}
+	if err := <-sent; err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// randomGarbage returns up to MaxGarbageLen random bytes.
+func randomGarbage() ([]byte, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(MaxGarbageLen+1))
+	if err != nil {
+		return nil, err
+	}
+	garbage := make([]byte, n.Int64())
+	_, err = rand.Read(garbage)
+	return garbage, err
+}
+
+// goWrite writes the chunks to the connection in a goroutine, and sends the
+// outcome on the channel it returns.
+func goWrite(conn net.Conn, chunks ...[]byte) <-chan error {
+	done := make(chan error, 1)
+	data := bytes.Join(chunks, nil)
+	go func() {
+		_, err := conn.Write(data)
+		done <- err
+	}()
+	return done
+}
+
+// isV1Version reports whether the start of the data is the header of a
+// version 1 version message on the network of the magic.
+func isV1Version(data []byte, magic uint32) bool {
+	prefix := binary.LittleEndian.AppendUint32(nil, magic)
+	prefix = append(prefix, "version"...)
+	prefix = append(prefix, make([]byte, 5)...)
+	return bytes.HasPrefix(data, prefix)
+}
+
+// readGarbage reads the peer's garbage and its terminator, and returns the
+// garbage.
+func (c *Conn) readGarbage() ([]byte, error) {
+	terminator := c.cipher.RecvGarbageTerminator
+	buf := make([]byte, GarbageTerminatorLen,
+		MaxGarbageLen+GarbageTerminatorLen)
+	if _, err := io.ReadFull(c.Conn, buf); err != nil {
+		return nil, err
+	}
+	var b [1]byte
+	for !bytes.HasSuffix(buf, terminator) {
+		if len(buf) == cap(buf) {
+			return nil, ErrNoGarbageTerminator
+		}
+		if _, err := io.ReadFull(c.Conn, b[:]); err != nil {
+			return nil, err
+		}
+		buf = append(buf, b[0])
+	}
+	return buf[:len(buf)-GarbageTerminatorLen], nil
+}
+
+// readPacket reads packets until one that isn't a decoy arrives, and
+// returns its contents. The first packet is read with the associated data.
+func (c *Conn) readPacket(aad []byte) ([]byte, error) {
+	for {
+		field := make([]byte, LengthFieldLen)
+		if _, err := io.ReadFull(c.Conn, field); err != nil {
+			return nil, err
+		}
+		length := c.cipher.DecryptLength(field)
+		ciphertext := make([]byte, HeaderLen+int(length)+TagLen)
+		if _, err := io.ReadFull(c.Conn, ciphertext); err != nil {
+			return nil, err
+		}
+		contents, ignore, err := c.cipher.Decrypt(ciphertext, aad)
+		if err != nil {
+			return nil, err
+		}
+		aad = nil
+		if !ignore {
+			return contents, nil
+		}
+	}
+}
+
+// SessionID returns the session ID of the connection.
+func (c *Conn) SessionID() []byte {
+	return c.cipher.SessionID
+}
+
+// Read reads the version 1 framing of the messages the peer sends. Messages
+// of unknown short IDs are dropped.
+func (c *Conn) Read(p []byte) (int, error) {
+	for len(c.rbuf) == 0 {
+		contents, err := c.readPacket(nil)
+		if err != nil {
+			return 0, err
+		}
+		command, payload, err := DecodeContents(contents)
+		if err != nil {
+			return 0, err
+		}
+		if command == "" {
+			continue
+		}
+		c.rbuf = c.frame(command, payload)
+	}
+	n := copy(p, c.rbuf)
+	c.rbuf = c.rbuf[n:]
+	return n, nil
+}
+
+// frame returns the version 1 message of the command and payload.
+func (c *Conn) frame(command string, payload []byte) []byte {
+	msg := make([]byte, v1HeaderSize, v1HeaderSize+len(payload))
+	binary.LittleEndian.PutUint32(msg, c.magic)
+	copy(msg[4:4+CommandSize], command)
+	binary.LittleEndian.PutUint32(msg[4+CommandSize:],
+		uint32(len(payload)))
+	copy(msg[8+CommandSize:], chainhash.DoubleHashB(payload)[:4])
+	return append(msg, payload...)
+}
+
+// Write takes version 1 messages, which may be split across calls, and
+// sends each as a packet once it's complete.
+func (c *Conn) Write(p []byte) (int, error) {
+	c.wbuf = append(c.wbuf, p...)
+	for len(c.wbuf) >= v1HeaderSize {
+		if binary.LittleEndian.Uint32(c.wbuf) != c.magic {
+			return 0, fmt.Errorf("%w: magic %x", ErrInvalidMessage,
+				c.wbuf[:4])
+		}
+		length := binary.LittleEndian.Uint32(c.wbuf[4+CommandSize:])
+		if uint64(len(c.wbuf)) < v1HeaderSize+uint64(length) {
+			break
+		}
+		command := bytes.TrimRight(c.wbuf[4:4+CommandSize], "\x00")
+		payload := c.wbuf[v1HeaderSize : v1HeaderSize+length]
+		contents, err := EncodeContents(string(command), payload)
+		if err != nil {
+			return 0, err
+		}
+		packet, err := c.cipher.Encrypt(contents, nil, false)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := c.Conn.Write(packet); err != nil {
+			return 0, err
+		}
+		c.wbuf = c.wbuf[v1HeaderSize+length:]
+	}
+	return len(p), nil
+}
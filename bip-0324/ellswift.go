@@ -0,0 +1,261 @@
+package v2transport
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// EllSwiftSize is the size of the ElligatorSwift encoding of a public key:
+// two field elements u and t.
+const EllSwiftSize = 64
+
+// ecdhTag is the tag of the hash that turns the x coordinate of the ECDH
+// point into the shared secret.
+var ecdhTag = []byte("bip324_ellswift_xonly_ecdh")
+
+// fieldVal returns the field element of the small integer.
+func fieldVal(n uint16) btcec.FieldVal {
+	var r btcec.FieldVal
+	r.SetInt(n)
+	return r
+}
+
+// fieldAdd returns a + b.
+func fieldAdd(a, b btcec.FieldVal) btcec.FieldVal {
+	var r btcec.FieldVal
+	r.Add2(&a, &b).Normalize()
+	return r
+}
+
+// fieldSub returns a - b.
+func fieldSub(a, b btcec.FieldVal) btcec.FieldVal {
+	var r btcec.FieldVal
+	r.NegateVal(&b, 1).Add(&a).Normalize()
+	return r
+}
+
+// fieldNeg returns -a.
+func fieldNeg(a btcec.FieldVal) btcec.FieldVal {
+	var r btcec.FieldVal
+	r.NegateVal(&a, 1).Normalize()
+	return r
+}
+
+// fieldMul returns a · b.
+func fieldMul(a, b btcec.FieldVal) btcec.FieldVal {
+	var r btcec.FieldVal
+	r.Mul2(&a, &b).Normalize()
+	return r
+}
+
+// fieldDiv returns a / b, which is 0 for b = 0.
+func fieldDiv(a, b btcec.FieldVal) btcec.FieldVal {
+	b.Inverse().Normalize()
+	return fieldMul(a, b)
+}
+
+// fieldSqrt returns a square root of a, and whether it has one.
+func fieldSqrt(a btcec.FieldVal) (btcec.FieldVal, bool) {
+	var r btcec.FieldVal
+	ok := r.SquareRootVal(&a)
+	r.Normalize()
+	return r, ok
+}
+
+// curveRHS returns x³ + 7, which is a square exactly for the x coordinates
+// of points of the curve.
+func curveRHS(x btcec.FieldVal) btcec.FieldVal {
+	return fieldAdd(fieldMul(fieldMul(x, x), x), fieldVal(7))
+}
+
+// isValidX reports whether x is the x coordinate of a point of the curve.
+func isValidX(x btcec.FieldVal) bool {
+	_, ok := fieldSqrt(curveRHS(x))
+	return ok
+}
+
+// sqrtMinus3 is a square root of -3, which exists in the field of
+// secp256k1. Which of the two it is doesn't matter to the encoding.
+var sqrtMinus3 = func() btcec.FieldVal {
+	r, ok := fieldSqrt(fieldNeg(fieldVal(3)))
+	if !ok {
+		panic("v2transport: -3 has no square root")
+	}
+	return r
+}()
+
+// half is the inverse of 2.
+var half = fieldDiv(fieldVal(1), fieldVal(2))
+
+// xSwiftEC returns the x coordinate the field elements u and t decode to,
+// the function of the BIP that maps every pair to a point of the curve.
+func xSwiftEC(u, t btcec.FieldVal) btcec.FieldVal {
+	if u.IsZero() {
+		u = fieldVal(1)
+	}
+	if t.IsZero() {
+		t = fieldVal(1)
+	}
+	g := curveRHS(u)
+	if sum := fieldAdd(g, fieldMul(t, t)); sum.IsZero() {
+		t = fieldAdd(t, t)
+	}
+	x := fieldDiv(fieldSub(g, fieldMul(t, t)), fieldAdd(t, t))
+	y := fieldDiv(fieldAdd(x, t), fieldMul(sqrtMinus3, u))
+
+	// One of the three candidates is always on the curve, and if the
+	// first isn't, exactly one of the other two is.
+	x1 := fieldAdd(u, fieldMul(fieldVal(4), fieldMul(y, y)))
+	if isValidX(x1) {
+		return x1
+	}
+	xy := fieldDiv(x, y)
+	x2 := fieldMul(fieldSub(fieldNeg(xy), u), half)
+	if isValidX(x2) {
+		return x2
+	}
+	return fieldMul(fieldSub(xy, u), half)
+}
+
+// xSwiftECInv returns a t for which xSwiftEC(u, t) is x, if the case, a
+// number from 0 to 7 that picks one of the up to eight preimages, has one.
+func xSwiftECInv(x, u btcec.FieldVal, c int) (btcec.FieldVal, bool) {
+	var v, s btcec.FieldVal
+	g := curveRHS(u)
+	if c&2 == 0 {
+		// x must be the first candidate, which it isn't if the other
+		// two are on the curve.
+		if isValidX(fieldSub(fieldNeg(x), u)) {
+			return v, false
+		}
+		v = x
+		s = fieldDiv(fieldNeg(g), fieldAdd(fieldMul(u, u),
+			fieldMul(v, fieldAdd(u, v))))
+	} else {
+		s = fieldSub(x, u)
+		if s.IsZero() {
+			return v, false
+		}
+		q := fieldAdd(fieldMul(fieldVal(4), g),
+			fieldMul(fieldMul(fieldVal(3), s), fieldMul(u, u)))
+		r, ok := fieldSqrt(fieldMul(fieldNeg(s), q))
+		if !ok || (c&1 != 0 && r.IsZero()) {
+			return v, false
+		}
+		v = fieldMul(fieldSub(fieldDiv(r, s), u), half)
+	}
+	if s.IsZero() {
+		return v, false
+	}
+	w, ok := fieldSqrt(s)
+	if !ok {
+		return v, false
+	}
+
+	// The low bit picks the root of -3 and the bit of 4 the sign of w.
+	root := fieldSub(fieldVal(1), sqrtMinus3)
+	if c&1 != 0 {
+		root = fieldAdd(fieldVal(1), sqrtMinus3)
+	}
+	t := fieldMul(w, fieldAdd(fieldMul(u, fieldMul(root, half)), v))
+	if c&5 == 0 || c&5 == 5 {
+		t = fieldNeg(t)
+	}
+	return t, true
+}
+
+// EllSwiftEncode returns a random ElligatorSwift encoding of the public key,
+// reading the randomness from rand. The encodings of a key are uniformly
+// distributed over all 64 byte strings, so an observer can't tell them from
+// random bytes.
+func EllSwiftEncode(pubKey *btcec.PublicKey, rand io.Reader) ([]byte,
+	error) {
+
+	var x btcec.FieldVal
+	x.SetByteSlice(pubKey.X().Bytes())
+	var b [33]byte
+	for {
+		if _, err := io.ReadFull(rand, b[:]); err != nil {
+			return nil, err
+		}
+		var u btcec.FieldVal
+		u.SetByteSlice(b[:32])
+		u.Normalize()
+		if u.IsZero() {
+			continue
+		}
+		t, ok := xSwiftECInv(x, u, int(b[32]&7))
+		if !ok {
+			continue
+		}
+		enc := make([]byte, 0, EllSwiftSize)
+		enc = append(enc, u.Bytes()[:]...)
+		return append(enc, t.Bytes()[:]...), nil
+	}
+}
+
+// EllSwiftDecode returns the x coordinate of the public key of an
+// ElligatorSwift encoding. Every 64 byte string decodes to a key.
+func EllSwiftDecode(enc []byte) ([]byte, error) {
+	if len(enc) != EllSwiftSize {
+		return nil, fmt.Errorf("%w: %d bytes", ErrInvalidEllSwift,
+			len(enc))
+	}
+	var u, t btcec.FieldVal
+	u.SetByteSlice(enc[:32])
+	t.SetByteSlice(enc[32:])
+	u.Normalize()
+	t.Normalize()
+	x := xSwiftEC(u, t)
+	return x.Bytes()[:], nil
+}
+
+// ecdhX returns the x coordinate of the secret key times the key of the
+// ElligatorSwift encoding. The encoding only fixes the key up to its
+// negation, which doesn't change the x coordinate of the product.
+func ecdhX(secKey, enc []byte) ([]byte, error) {
+	var d btcec.ModNScalar
+	if len(secKey) != 32 || d.SetByteSlice(secKey) || d.IsZero() {
+		return nil, ErrInvalidSecKey
+	}
+	xBytes, err := EllSwiftDecode(enc)
+	if err != nil {
+		return nil, err
+	}
+	var x, y btcec.FieldVal
+	x.SetByteSlice(xBytes)
+	if !btcec.DecompressY(&x, false, &y) {
+		panic("v2transport: decoded x isn't on the curve")
+	}
+	var p, r btcec.JacobianPoint
+	p.X, p.Y = x, y
+	p.Z.SetInt(1)
+	btcec.ScalarMultNonConst(&d, &p, &r)
+	r.ToAffine()
+	return r.X.Bytes()[:], nil
+}
+
+// SharedSecret returns the secret of the ECDH of the secret key, whose
+// public key ours encodes, with the key theirs encodes: the tagged hash of
+// the initiator's encoding, the responder's and the x coordinate of the
+// ECDH point.
+func SharedSecret(secKey, ours, theirs []byte, initiating bool) ([]byte,
+	error) {
+
+	if len(ours) != EllSwiftSize {
+		return nil, fmt.Errorf("%w: %d bytes", ErrInvalidEllSwift,
+			len(ours))
+	}
+	x, err := ecdhX(secKey, theirs)
+	if err != nil {
+		return nil, err
+	}
+	initiator, responder := ours, theirs
+	if !initiating {
+		initiator, responder = theirs, ours
+	}
+	return chainhash.TaggedHash(ecdhTag, initiator, responder, x)[:], nil
+}
@@ -0,0 +1,211 @@
+// This program writes test vectors for the v2transport package to
+// packet_encoding_test_vectors.csv, in the layout of the BIP's file of the
+// same name: random packets, each with the keys, secrets and ciphers of the
+// side that encodes it. The vectors depend only on -seed and -count, so they
+// can be regenerated by anyone:
+//
+//	gentestvectors -count 30 -seed 324
+//
+// Pass -check to verify an existing file against the package instead, the
+// BIP's own included:
+//
+//	gentestvectors -check packet_encoding_test_vectors.csv
+//
+// The program lives in a directory of its own since the v2transport package
+// sits at the root of the module.
+package main
+
+import (
+	"encoding/csv"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	v2transport "github.com/christsim/bips/bip-0324"
+)
+
+// vectorColumns is the header row of the vector file, as the BIP has it.
+var vectorColumns = []string{"in_idx", "in_priv_ours", "in_ellswift_ours",
+	"in_ellswift_theirs", "in_initiating", "in_contents", "in_multiply",
+	"in_aad", "in_ignore", "mid_x_ours", "mid_x_theirs", "mid_x_shared",
+	"mid_shared_secret", "mid_initiator_l", "mid_initiator_p",
+	"mid_responder_l", "mid_responder_p", "mid_send_garbage_terminator",
+	"mid_recv_garbage_terminator", "out_session_id", "out_ciphertext",
+	"out_ciphertext_endswith"}
+
+func main() {
+	out := flag.String("out", "packet_encoding_test_vectors.csv", "file "+
+		"to write the vectors to")
+	count := flag.Int("count", 30, "number of random vectors to write")
+	seed := flag.Int64("seed", 324, "seed of the random vectors")
+	check := flag.String("check", "", "vector file to check instead of "+
+		"writing one")
+	flag.Parse()
+
+	var err error
+	if *check != "" {
+		err = checkFile(*check)
+	} else {
+		err = writeFile(*out, *seed, *count)
+	}
+	if err != nil {
+		fmt.Println("Error: ", err.Error())
+		os.Exit(1)
+	}
+}
+
+// formatBool formats a flag as the BIP's file does, as 0 or 1.
+func formatBool(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+
+// writeFile writes count random vectors to out.
+func writeFile(out string, seed int64, count int) error {
+	vectors := v2transport.RandomVectors(seed, count)
+
+	file, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	if err := writer.Write(vectorColumns); err != nil {
+		return err
+	}
+	for _, v := range vectors {
+		err := writer.Write([]string{
+			strconv.FormatUint(uint64(v.Index), 10),
+			hex.EncodeToString(v.SecKey),
+			hex.EncodeToString(v.EllSwiftOurs),
+			hex.EncodeToString(v.EllSwiftTheirs),
+			formatBool(v.Initiating),
+			hex.EncodeToString(v.Contents),
+			strconv.Itoa(v.Multiply),
+			hex.EncodeToString(v.AAD),
+			formatBool(v.Ignore),
+			hex.EncodeToString(v.XOurs),
+			hex.EncodeToString(v.XTheirs),
+			hex.EncodeToString(v.XShared),
+			hex.EncodeToString(v.SharedSecret),
+			hex.EncodeToString(v.InitiatorL),
+			hex.EncodeToString(v.InitiatorP),
+			hex.EncodeToString(v.ResponderL),
+			hex.EncodeToString(v.ResponderP),
+			hex.EncodeToString(v.SendGarbageTerminator),
+			hex.EncodeToString(v.RecvGarbageTerminator),
+			hex.EncodeToString(v.SessionID),
+			hex.EncodeToString(v.Ciphertext),
+			hex.EncodeToString(v.CiphertextEnd),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote %d vectors\n", len(vectors))
+	return nil
+}
+
+// checkFile checks each vector of the file with v2transport.CheckVector.
+func checkFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = len(vectorColumns)
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return fmt.Errorf("%v has no header row", path)
+	}
+
+	for i, row := range rows[1:] {
+		v, err := parseVector(row)
+		if err != nil {
+			return fmt.Errorf("vector %d: %v", i, err)
+		}
+		if err := v2transport.CheckVector(v); err != nil {
+			return fmt.Errorf("vector %d: %v", i, err)
+		}
+	}
+	fmt.Printf("%d vectors OK\n", len(rows)-1)
+	return nil
+}
+
+// parseVector parses a row of the vector file. Empty hex columns are nil.
+func parseVector(row []string) (v2transport.Vector, error) {
+	var v v2transport.Vector
+	index, err := strconv.ParseUint(row[0], 10, 32)
+	if err != nil {
+		return v, err
+	}
+	multiply, err := strconv.Atoi(row[6])
+	if err != nil {
+		return v, err
+	}
+	initiating, err := strconv.ParseBool(row[4])
+	if err != nil {
+		return v, err
+	}
+	ignore, err := strconv.ParseBool(row[8])
+	if err != nil {
+		return v, err
+	}
+
+	// The hex columns are those of the inputs that aren't numbers or
+	// flags, and all that follow the inputs.
+	hexColumns := []int{1, 2, 3, 5, 7}
+	for i := 9; i < len(vectorColumns); i++ {
+		hexColumns = append(hexColumns, i)
+	}
+	fields := make([][]byte, len(hexColumns))
+	for i, column := range hexColumns {
+		if row[column] == "" {
+			continue
+		}
+		fields[i], err = hex.DecodeString(row[column])
+		if err != nil {
+			return v, fmt.Errorf("%v: %v", vectorColumns[column],
+				err)
+		}
+	}
+	return v2transport.Vector{
+		Index:                 uint32(index),
+		SecKey:                fields[0],
+		EllSwiftOurs:          fields[1],
+		EllSwiftTheirs:        fields[2],
+		Initiating:            initiating,
+		Contents:              fields[3],
+		Multiply:              multiply,
+		AAD:                   fields[4],
+		Ignore:                ignore,
+		XOurs:                 fields[5],
+		XTheirs:               fields[6],
+		XShared:               fields[7],
+		SharedSecret:          fields[8],
+		InitiatorL:            fields[9],
+		InitiatorP:            fields[10],
+		ResponderL:            fields[11],
+		ResponderP:            fields[12],
+		SendGarbageTerminator: fields[13],
+		RecvGarbageTerminator: fields[14],
+		SessionID:             fields[15],
+		Ciphertext:            fields[16],
+		CiphertextEnd:         fields[17],
+	}, nil
+}
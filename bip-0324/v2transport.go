@@ -0,0 +1,124 @@
+// Package v2transport implements the version 2 encrypted transport protocol
+// of BIP 324 for Bitcoin P2P connections:
+//
+//	conn, err := net.Dial("tcp", addr)
+//	v2, err := v2transport.Handshake(conn, uint32(wire.MainNet), true)
+//	client, err := lightclient.New(v2, cfg)
+//
+// Each side sends an ephemeral public key in the ElligatorSwift encoding,
+// which looks like 64 random bytes, followed by up to 4095 bytes of garbage.
+// The ECDH secret of the keys derives a session ID and the keys of two
+// ciphers per direction: an FSChaCha20 stream cipher for the 3 byte lengths
+// of packets, and an FSChaCha20Poly1305 AEAD for their contents, both of
+// which rekey every 224 messages for forward secrecy. Each side then ends
+// its garbage with a terminator derived from the secret, and sends packets,
+// the first of which authenticates the garbage. The first packet that isn't
+// a decoy is the version packet, whose contents are reserved for extensions,
+// and the rest carry P2P messages: a one byte short ID of the message type,
+// or 0 and the 12 byte command of version 1, followed by the payload.
+//
+// Conn, which Handshake returns, wraps a net.Conn so that the code reading
+// and writing version 1 messages, such as the btcd wire package, speaks the
+// version 2 protocol without changes: the messages written to it are taken
+// apart and sent as packets, and the packets received are framed as version
+// 1 messages, with the magic and the checksum recomputed.
+package v2transport
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrInvalidEllSwift is returned for an ElligatorSwift encoding that
+	// isn't EllSwiftSize bytes.
+	ErrInvalidEllSwift = errors.New("v2transport: invalid ElligatorSwift " +
+		"encoding")
+
+	// ErrInvalidSecKey is returned for a secret key that isn't 32 bytes or
+	// isn't below the curve order, or is zero.
+	ErrInvalidSecKey = errors.New("v2transport: invalid secret key")
+
+	// ErrDecryption is returned for a packet whose tag doesn't match its
+	// ciphertext and associated data.
+	ErrDecryption = errors.New("v2transport: decryption failed")
+
+	// ErrPacketTooLarge is returned for contents that don't fit the
+	// length field of packets.
+	ErrPacketTooLarge = errors.New("v2transport: packet too large")
+
+	// ErrNoGarbageTerminator is returned when the peer's garbage
+	// terminator doesn't follow its key within MaxGarbageLen bytes.
+	ErrNoGarbageTerminator = errors.New("v2transport: no garbage " +
+		"terminator")
+
+	// ErrV1Peer is returned by the responder of a handshake whose peer
+	// sent a version 1 version message instead of a key. The bytes read
+	// are lost, so the connection can't fall back to version 1.
+	ErrV1Peer = errors.New("v2transport: version 1 peer")
+
+	// ErrInvalidMessage is returned for a message written to a Conn that
+	// isn't framed as a version 1 message of its network, and for the
+	// contents of a packet too short for their message type.
+	ErrInvalidMessage = errors.New("v2transport: invalid message")
+)
+
+// CommandSize is the size of the commands of version 1 message headers,
+// which messages without a short ID carry.
+const CommandSize = 12
+
+// messageTypes are the commands of the message types with short IDs, by
+// their ID less one.
+var messageTypes = []string{
+	"addr", "block", "blocktxn", "cmpctblock", "feefilter", "filteradd",
+	"filterclear", "filterload", "getblocks", "getblocktxn", "getdata",
+	"getheaders", "headers", "inv", "mempool", "merkleblock", "notfound",
+	"ping", "pong", "sendcmpct", "tx", "getcfilters", "cfilter",
+	"getcfheaders", "cfheaders", "getcfcheckpt", "cfcheckpt", "addrv2",
+}
+
+// shortIDs maps the commands of messageTypes to their short IDs.
+var shortIDs = func() map[string]byte {
+	ids := make(map[string]byte, len(messageTypes))
+	for i, command := range messageTypes {
+		ids[command] = byte(i + 1)
+	}
+	return ids
+}()
+
+// EncodeContents returns the contents of the packet of a message: the short
+// ID of its command, or 0 and the command padded with zeros to CommandSize
+// bytes, followed by the payload.
+func EncodeContents(command string, payload []byte) ([]byte, error) {
+	if id, ok := shortIDs[command]; ok {
+		return append([]byte{id}, payload...), nil
+	}
+	if len(command) > CommandSize {
+		return nil, fmt.Errorf("%w: command %q", ErrInvalidMessage,
+			command)
+	}
+	contents := make([]byte, 1+CommandSize, 1+CommandSize+len(payload))
+	copy(contents[1:], command)
+	return append(contents, payload...), nil
+}
+
+// DecodeContents returns the command and payload of the contents of a
+// packet. The command of an unknown short ID is empty.
+func DecodeContents(contents []byte) (string, []byte, error) {
+	switch {
+	case len(contents) == 0:
+		return "", nil, fmt.Errorf("%w: no message type",
+			ErrInvalidMessage)
+	case contents[0] != 0:
+		if int(contents[0]) > len(messageTypes) {
+			return "", contents[1:], nil
+		}
+		return messageTypes[contents[0]-1], contents[1:], nil
+	case len(contents) < 1+CommandSize:
+		return "", nil, fmt.Errorf("%w: %d bytes", ErrInvalidMessage,
+			len(contents))
+	}
+	command := bytes.TrimRight(contents[1:1+CommandSize], "\x00")
+	return string(command), contents[1+CommandSize:], nil
+}
@@ -0,0 +1,290 @@
+package v2transport
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/rand"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+)
+
+// ErrVectorMismatch is returned by CheckVector when a step of encoding the
+// packet of the vector doesn't give the expected result.
+var ErrVectorMismatch = errors.New("v2transport: vector mismatch")
+
+// VectorMagic is the network magic of the vectors, that of mainnet.
+const VectorMagic = 0xd9b4bef9
+
+// CiphertextEndLen is the number of bytes of the ciphertexts of vectors
+// longer than it that the vectors hold, as they hold only the end.
+const CiphertextEndLen = 64
+
+// Vector is a packet encoded by one side of a connection, with the values
+// the BIP's packet encoding vectors list for each step.
+type Vector struct {
+	// Index is the number of packets of empty contents the side sends
+	// before the packet, and SecKey the secret key of the side.
+	Index  uint32
+	SecKey []byte
+
+	// EllSwiftOurs and EllSwiftTheirs are the encodings of the keys of
+	// the side and of its peer.
+	EllSwiftOurs   []byte
+	EllSwiftTheirs []byte
+	Initiating     bool
+
+	// Contents are repeated Multiply times to make the contents of the
+	// packet, which is encrypted with the AAD and marked as a decoy if
+	// Ignore is set.
+	Contents []byte
+	Multiply int
+	AAD      []byte
+	Ignore   bool
+
+	// XOurs, XTheirs and XShared are the x coordinates of the keys and of
+	// their ECDH point, and SharedSecret the hash of the three.
+	XOurs        []byte
+	XTheirs      []byte
+	XShared      []byte
+	SharedSecret []byte
+
+	// InitiatorL to RecvGarbageTerminator are the keys and terminators
+	// derived from the secret.
+	InitiatorL            []byte
+	InitiatorP            []byte
+	ResponderL            []byte
+	ResponderP            []byte
+	SendGarbageTerminator []byte
+	RecvGarbageTerminator []byte
+	SessionID             []byte
+
+	// Ciphertext is the packet, if it's at most CiphertextEndLen bytes,
+	// and CiphertextEnd its last CiphertextEndLen bytes otherwise.
+	Ciphertext    []byte
+	CiphertextEnd []byte
+
+	// packet is the whole packet, which NewVector keeps for CheckVector.
+	packet []byte
+}
+
+// contents returns the contents of the vector's packet.
+func (v *Vector) contents() []byte {
+	return bytes.Repeat(v.Contents, v.Multiply)
+}
+
+// NewVector returns the vector of the packet of the inputs, whose other
+// fields it computes.
+func NewVector(index uint32, secKey, ours, theirs []byte, initiating bool,
+	contents []byte, multiply int, aad []byte, ignore bool) (Vector,
+	error) {
+
+	v := Vector{
+		Index:          index,
+		SecKey:         secKey,
+		EllSwiftOurs:   ours,
+		EllSwiftTheirs: theirs,
+		Initiating:     initiating,
+		Contents:       contents,
+		Multiply:       multiply,
+		AAD:            aad,
+		Ignore:         ignore,
+	}
+	var err error
+	if v.XOurs, err = EllSwiftDecode(ours); err != nil {
+		return v, err
+	}
+	if v.XTheirs, err = EllSwiftDecode(theirs); err != nil {
+		return v, err
+	}
+	if v.XShared, err = ecdhX(secKey, theirs); err != nil {
+		return v, err
+	}
+	v.SharedSecret, err = SharedSecret(secKey, ours, theirs, initiating)
+	if err != nil {
+		return v, err
+	}
+
+	keys := DeriveKeys(v.SharedSecret, VectorMagic)
+	c := NewCipher(keys, initiating)
+	v.InitiatorL, v.InitiatorP = keys.InitiatorL, keys.InitiatorP
+	v.ResponderL, v.ResponderP = keys.ResponderL, keys.ResponderP
+	v.SendGarbageTerminator = c.SendGarbageTerminator
+	v.RecvGarbageTerminator = c.RecvGarbageTerminator
+	v.SessionID = c.SessionID
+	for i := uint32(0); i < index; i++ {
+		if _, err := c.Encrypt(nil, nil, false); err != nil {
+			return v, err
+		}
+	}
+	packet, err := c.Encrypt(v.contents(), aad, ignore)
+	if err != nil {
+		return v, err
+	}
+	v.packet = packet
+	if len(packet) <= CiphertextEndLen {
+		v.Ciphertext = packet
+	} else {
+		v.CiphertextEnd = packet[len(packet)-CiphertextEndLen:]
+	}
+	return v, nil
+}
+
+// zeroDecoding is the x coordinate 64 zero bytes decode to, as the first of
+// the BIP's ElligatorSwift decoding vectors has it.
+const zeroDecoding = "edd1fd3e327ce90cc7a3542614289aee9682003e9cf7dcc9cf2ca9743be5aa0c"
+
+// randomSecKey returns a random valid secret key.
+func randomSecKey(rng *rand.Rand) []byte {
+	for {
+		secKey := make([]byte, 32)
+		rng.Read(secKey)
+		var d btcec.ModNScalar
+		if !d.SetByteSlice(secKey) && !d.IsZero() {
+			return secKey
+		}
+	}
+}
+
+// randomBytes returns n random bytes.
+func randomBytes(rng *rand.Rand, n int) []byte {
+	b := make([]byte, n)
+	rng.Read(b)
+	return b
+}
+
+// RandomVectors returns count vectors of random inputs derived from a
+// math/rand source with the seed. Their indices cluster around the
+// rekeyings, every fourth repeats its contents into a packet of up to a
+// mebibyte, and the peer's encodings are random bytes, which every string
+// of 64 bytes is the encoding of. It panics if the package doesn't decode
+// 64 zero bytes as the BIP does.
+func RandomVectors(rngSeed int64, count int) []Vector {
+	x, err := EllSwiftDecode(make([]byte, EllSwiftSize))
+	if err != nil || hex.EncodeToString(x) != zeroDecoding {
+		panic(fmt.Sprintf("v2transport: 64 zero bytes decode to %x", x))
+	}
+
+	rng := rand.New(rand.NewSource(rngSeed))
+	var vectors []Vector
+	for n := 0; n < count; n++ {
+		var index uint32
+		switch n % 3 {
+		case 1:
+			index = uint32(rng.Intn(8))
+		case 2:
+			index = uint32(rng.Intn(4)+1)*RekeyInterval - 2 +
+				uint32(rng.Intn(4))
+		}
+		secKey := randomSecKey(rng)
+		_, pubKey := btcec.PrivKeyFromBytes(secKey)
+		ours, err := EllSwiftEncode(pubKey, rng)
+		if err != nil {
+			panic(err)
+		}
+		contents := randomBytes(rng, rng.Intn(64))
+		multiply := 1
+		if n%4 == 3 {
+			contents = randomBytes(rng, 1+rng.Intn(4))
+			multiply = 1 + rng.Intn(1<<20/len(contents))
+		}
+		var aad []byte
+		if rng.Intn(2) == 0 {
+			aad = randomBytes(rng, 1+rng.Intn(64))
+		}
+		v, err := NewVector(index, secKey, ours, randomBytes(rng,
+			EllSwiftSize), rng.Intn(2) == 0, contents, multiply,
+			aad, rng.Intn(4) == 0)
+		if err != nil {
+			panic(err)
+		}
+		vectors = append(vectors, v)
+	}
+	return vectors
+}
+
+// CheckVector recomputes the vector from its inputs, checks every step
+// against it, and checks that the peer decrypts the packet to its contents.
+func CheckVector(v Vector) error {
+	got, err := NewVector(v.Index, v.SecKey, v.EllSwiftOurs,
+		v.EllSwiftTheirs, v.Initiating, v.Contents, v.Multiply, v.AAD,
+		v.Ignore)
+	if err != nil {
+		return err
+	}
+	_, pubKey := btcec.PrivKeyFromBytes(v.SecKey)
+	steps := []struct {
+		name      string
+		got, want []byte
+	}{
+		{"x_ours", got.XOurs, v.XOurs},
+		{"x_ours of the key", pubKey.X().FillBytes(make([]byte, 32)),
+			v.XOurs},
+		{"x_theirs", got.XTheirs, v.XTheirs},
+		{"x_shared", got.XShared, v.XShared},
+		{"shared secret", got.SharedSecret, v.SharedSecret},
+		{"initiator_L", got.InitiatorL, v.InitiatorL},
+		{"initiator_P", got.InitiatorP, v.InitiatorP},
+		{"responder_L", got.ResponderL, v.ResponderL},
+		{"responder_P", got.ResponderP, v.ResponderP},
+		{"send garbage terminator", got.SendGarbageTerminator,
+			v.SendGarbageTerminator},
+		{"receive garbage terminator", got.RecvGarbageTerminator,
+			v.RecvGarbageTerminator},
+		{"session ID", got.SessionID, v.SessionID},
+	}
+	for _, step := range steps {
+		if !bytes.Equal(step.got, step.want) {
+			return fmt.Errorf("%w: %v %x, expected %x",
+				ErrVectorMismatch, step.name, step.got,
+				step.want)
+		}
+	}
+
+	// A file may hold the whole of a long packet, or less of its end than
+	// the vector does.
+	if (v.Ciphertext != nil && !bytes.Equal(got.packet, v.Ciphertext)) ||
+		!bytes.HasSuffix(got.packet, v.CiphertextEnd) {
+
+		return fmt.Errorf("%w: ciphertext %x, expected %x or one "+
+			"ending in %x", ErrVectorMismatch, got.packet,
+			v.Ciphertext, v.CiphertextEnd)
+	}
+	return checkDecryption(v)
+}
+
+// checkDecryption checks that the peer of the vector's side decrypts its
+// packet, which it encrypts again, to the vector's contents.
+func checkDecryption(v Vector) error {
+	keys := DeriveKeys(v.SharedSecret, VectorMagic)
+	c := NewCipher(keys, v.Initiating)
+	peer := NewCipher(keys, !v.Initiating)
+	for i := uint32(0); i <= v.Index; i++ {
+		var contents, aad []byte
+		var ignore bool
+		if i == v.Index {
+			contents, aad, ignore = v.contents(), v.AAD, v.Ignore
+		}
+		packet, err := c.Encrypt(contents, aad, ignore)
+		if err != nil {
+			return err
+		}
+		length := peer.DecryptLength(packet)
+		if int(length) != len(contents) {
+			return fmt.Errorf("%w: packet %d of length %d, "+
+				"expected %d", ErrVectorMismatch, i, length,
+				len(contents))
+		}
+		plaintext, decoy, err := peer.Decrypt(packet[LengthFieldLen:],
+			aad)
+		if err != nil {
+			return fmt.Errorf("packet %d: %w", i, err)
+		}
+		if !bytes.Equal(plaintext, contents) || decoy != ignore {
+			return fmt.Errorf("%w: packet %d decrypted wrongly",
+				ErrVectorMismatch, i)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+// Package erlay implements the transaction reconciliation of BIP 330,
+// Erlay, by which two peers find the transactions one has and the other
+// lacks from compact sketches of their sets instead of announcing each:
+//
+//	a, b := erlay.NewSketch(capacity), erlay.NewSketch(capacity)
+//	for _, wtxid := range local {
+//		a.Add(salt.ShortID(wtxid))
+//	}
+//	...
+//	a.Merge(b)
+//	difference, err := a.Decode()
+//
+// Peers that both send sendtxrcncl agree on a salt, the tagged hash of
+// their two, which keys the SipHash of the 32 bit short IDs of
+// transactions. The reconciliation initiator requests a sketch with
+// reqrecon, telling the size of its set and the q coefficient it estimates
+// the difference with, and the responder sends a sketch of its set of that
+// capacity. The initiator merges it with the sketch of its own set and
+// decodes the symmetric difference, or asks for an extension with
+// reqsketchext if that fails, and tells the outcome and the short IDs it
+// lacks with reconcildiff.
+//
+// Sketches are those of PinSketch, as minisketch computes them: the sums of
+// the odd powers of the elements in GF(2^32), serialized in little endian,
+// so sketches of this package and minisketch merge and decode alike.
+package erlay
+
+import "errors"
+
+var (
+	// ErrInvalidSketch is returned for a serialized sketch whose size
+	// isn't a multiple of ElementSize.
+	ErrInvalidSketch = errors.New("erlay: invalid sketch")
+
+	// ErrDecode is returned by Sketch.Decode for a sketch of a set larger
+	// than its capacity.
+	ErrDecode = errors.New("erlay: sketch doesn't decode")
+
+	// ErrTooMany is returned when a message holds more items than the
+	// protocol allows.
+	ErrTooMany = errors.New("erlay: too many items in message")
+)
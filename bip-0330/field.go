@@ -0,0 +1,171 @@
+package erlay
+
+// fieldModulus holds the low terms of the modulus of GF(2^32) that the
+// sketches of PinSketch and minisketch compute in, x^32 + x^7 + x^3 + x^2 +
+// 1.
+const fieldModulus = 1<<7 | 1<<3 | 1<<2 | 1
+
+// fieldMul returns a · b in GF(2^32).
+func fieldMul(a, b uint32) uint32 {
+	var r uint32
+	for b != 0 {
+		if b&1 != 0 {
+			r ^= a
+		}
+		b >>= 1
+		carry := a >> 31
+		a <<= 1
+		if carry != 0 {
+			a ^= fieldModulus
+		}
+	}
+	return r
+}
+
+// fieldInv returns the inverse of a, a^(2^32 - 2), which is 0 for a = 0.
+func fieldInv(a uint32) uint32 {
+	r := uint32(1)
+	for i := 0; i < 31; i++ {
+		a = fieldMul(a, a)
+		r = fieldMul(r, a)
+	}
+	return r
+}
+
+// poly is a polynomial over GF(2^32), with its coefficients from the
+// constant term up and no leading zeros.
+type poly []uint32
+
+// trim drops the leading zero coefficients of p.
+func (p poly) trim() poly {
+	for len(p) > 0 && p[len(p)-1] == 0 {
+		p = p[:len(p)-1]
+	}
+	return p
+}
+
+// degree returns the degree of p, or -1 for the zero polynomial.
+func (p poly) degree() int {
+	return len(p) - 1
+}
+
+// monic returns p divided by its leading coefficient.
+func (p poly) monic() poly {
+	inv := fieldInv(p[len(p)-1])
+	r := make(poly, len(p))
+	for i, c := range p {
+		r[i] = fieldMul(c, inv)
+	}
+	return r
+}
+
+// divMod returns the quotient and the remainder of a divided by the nonzero
+// polynomial b.
+func divMod(a, b poly) (poly, poly) {
+	r := append(poly{}, a...)
+	if len(a) < len(b) {
+		return nil, r
+	}
+	q := make(poly, len(a)-len(b)+1)
+	inv := fieldInv(b[len(b)-1])
+	for i := len(q) - 1; i >= 0; i-- {
+		c := fieldMul(r[i+len(b)-1], inv)
+		q[i] = c
+		for j, bc := range b {
+			r[i+j] ^= fieldMul(c, bc)
+		}
+	}
+	return q.trim(), r.trim()
+}
+
+// mulMod returns a · b mod m.
+func mulMod(a, b, m poly) poly {
+	if len(a) == 0 || len(b) == 0 {
+		return nil
+	}
+	r := make(poly, len(a)+len(b)-1)
+	for i, ac := range a {
+		for j, bc := range b {
+			r[i+j] ^= fieldMul(ac, bc)
+		}
+	}
+	_, r = divMod(r.trim(), m)
+	return r
+}
+
+// gcd returns the monic greatest common divisor of a and b.
+func gcd(a, b poly) poly {
+	for len(b) > 0 {
+		_, r := divMod(a, b)
+		a, b = b, r
+	}
+	if len(a) == 0 {
+		return a
+	}
+	return a.monic()
+}
+
+// frobenius returns p^(2^n) mod m, squaring p n times.
+func frobenius(p poly, n int, m poly) poly {
+	for i := 0; i < n; i++ {
+		p = mulMod(p, p, m)
+	}
+	return p
+}
+
+// findRoots returns the roots of the monic polynomial p, or false if it
+// doesn't split into distinct linear factors.
+func findRoots(p poly) ([]uint32, bool) {
+	// p has distinct roots, all in the field, exactly if it divides
+	// x^(2^32) - x.
+	x := poly{0, 1}
+	if p.degree() >= 2 {
+		_, xm := divMod(x, p)
+		r := frobenius(xm, 32, p)
+		if d := addPoly(r, xm); len(d) != 0 {
+			return nil, false
+		}
+	}
+	return splitRoots(p, 0), true
+}
+
+// addPoly returns a + b.
+func addPoly(a, b poly) poly {
+	if len(a) < len(b) {
+		a, b = b, a
+	}
+	r := append(poly{}, a...)
+	for i, c := range b {
+		r[i] ^= c
+	}
+	return r.trim()
+}
+
+// splitRoots returns the roots of the monic polynomial p, which splits into
+// distinct linear factors, with Berlekamp's trace algorithm: the trace of
+// β·x, which is 0 on half the field and 1 on the other, splits the roots
+// of p by the gcd with it for some β of the basis from the one tried.
+func splitRoots(p poly, basis int) []uint32 {
+	switch p.degree() {
+	case 0:
+		return nil
+	case 1:
+		return []uint32{p[0]}
+	}
+	for ; basis < 32; basis++ {
+		trace := poly{0, 1 << basis}
+		_, term := divMod(trace, p)
+		trace = term
+		for i := 1; i < 32; i++ {
+			term = mulMod(term, term, p)
+			trace = addPoly(trace, term)
+		}
+		h := gcd(p, trace)
+		if h.degree() > 0 && h.degree() < p.degree() {
+			q, _ := divMod(p, h)
+			return append(splitRoots(h, basis+1),
+				splitRoots(q.monic(), basis+1)...)
+		}
+	}
+	panic("erlay: roots don't split")
+}
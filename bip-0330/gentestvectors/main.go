@@ -0,0 +1,334 @@
+// This program writes test vectors for the erlay package: short IDs of
+// random wtxids under random salts to shortids.json, sketches of fixed and
+// random sets, some larger than their capacity, to sketches.json, and the
+// payloads of random BIP 330 messages, followed by payloads that must be
+// rejected, to messages.json. The vectors depend only on -seed and -count,
+// so they can be regenerated by anyone:
+//
+//	gentestvectors -count 50 -seed 330
+//
+// The files use the layout of the BIP 158 vectors: a JSON array whose first
+// row names the columns, followed by one row per vector. Messages are given
+// by their command and their fields as a JSON object. Pass -check to verify
+// existing files against the package instead:
+//
+//	gentestvectors -check shortids.json -check-sketches sketches.json \
+//		-check-messages messages.json
+//
+// The program lives in a directory of its own since the erlay package sits
+// at the root of the module.
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	erlay "github.com/christsim/bips/bip-0330"
+	"github.com/christsim/bips/internal/vectorfile"
+)
+
+const (
+	// vectorColumns, sketchColumns and messageColumns are the header rows
+	// of the vector files.
+	vectorColumns  = "Salt1,Salt2,Wtxid,ShortID,Comment"
+	sketchColumns  = "Capacity,Elements,Sketch,Decoded,Error,Comment"
+	messageColumns = "Command,Fields,Payload,Error,Comment"
+)
+
+type JSONTestWriter struct {
+	writer          io.Writer
+	firstRowWritten bool
+}
+
+func NewJSONTestWriter(writer io.Writer) *JSONTestWriter {
+	return &JSONTestWriter{writer: writer}
+}
+
+func (w *JSONTestWriter) WriteComment(comment string) error {
+	return w.WriteTestCase([]interface{}{comment})
+}
+
+func (w *JSONTestWriter) WriteTestCase(row []interface{}) error {
+	var err error
+	if w.firstRowWritten {
+		_, err = io.WriteString(w.writer, ",\n")
+	} else {
+		_, err = io.WriteString(w.writer, "[\n")
+		w.firstRowWritten = true
+	}
+	if err != nil {
+		return err
+	}
+
+	rowBytes, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.writer.Write(rowBytes)
+	return err
+}
+
+func (w *JSONTestWriter) Close() error {
+	if !w.firstRowWritten {
+		return nil
+	}
+
+	_, err := io.WriteString(w.writer, "\n]\n")
+	return err
+}
+
+func main() {
+	out := flag.String("out", "shortids.json", "file to write the short "+
+		"ID vectors to")
+	sketchesOut := flag.String("sketches-out", "sketches.json", "file to "+
+		"write the sketch vectors to")
+	messagesOut := flag.String("messages-out", "messages.json", "file to "+
+		"write the message vectors to")
+	count := flag.Int("count", 50, "number of random vectors to write, "+
+		"of short IDs, sketch capacities and messages of each command")
+	seed := flag.Int64("seed", 330, "seed of the random vectors")
+	check := flag.String("check", "", "short ID vector file to check "+
+		"instead of writing one")
+	checkSketches := flag.String("check-sketches", "", "sketch vector "+
+		"file to check instead of writing one")
+	checkMessages := flag.String("check-messages", "", "message vector "+
+		"file to check instead of writing one")
+	flag.Parse()
+
+	var err error
+	if *check != "" || *checkSketches != "" || *checkMessages != "" {
+		err = checkFiles(*check, *checkSketches, *checkMessages)
+	} else {
+		err = writeFiles(*out, *sketchesOut, *messagesOut, *seed,
+			*count)
+	}
+	if err != nil {
+		fmt.Println("Error: ", err.Error())
+		os.Exit(1)
+	}
+}
+
+// writeRows writes the header and rows to a new vector file at path.
+func writeRows(path, columns string, rows [][]interface{}) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := NewJSONTestWriter(file)
+	if err := writer.WriteComment(columns); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if err := writer.WriteTestCase(row); err != nil {
+			return err
+		}
+	}
+	return writer.Close()
+}
+
+// formatElements returns the elements as a comma separated list of decimal
+// numbers.
+func formatElements(elements []uint32) string {
+	var b []byte
+	for i, element := range elements {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = strconv.AppendUint(b, uint64(element), 10)
+	}
+	return string(b)
+}
+
+// writeFiles writes the short ID vectors to out, the sketch vectors to
+// sketchesOut and the message vectors to messagesOut.
+func writeFiles(out, sketchesOut, messagesOut string, seed int64,
+	count int) error {
+
+	var rows [][]interface{}
+	vectors := erlay.RandomVectors(seed, count)
+	for _, v := range vectors {
+		rows = append(rows, []interface{}{
+			strconv.FormatUint(v.Salt1, 10),
+			strconv.FormatUint(v.Salt2, 10),
+			hex.EncodeToString(v.Wtxid),
+			strconv.FormatUint(uint64(v.ShortID), 10),
+			v.Comment,
+		})
+	}
+	if err := writeRows(out, vectorColumns, rows); err != nil {
+		return err
+	}
+
+	rows = nil
+	sketches := erlay.SketchVectors(seed, count)
+	for _, v := range sketches {
+		rows = append(rows, []interface{}{
+			strconv.Itoa(v.Capacity),
+			formatElements(v.Elements),
+			hex.EncodeToString(v.Sketch),
+			formatElements(v.Decoded),
+			vectorfile.ErrorString(v.Err),
+			v.Comment,
+		})
+	}
+	if err := writeRows(sketchesOut, sketchColumns, rows); err != nil {
+		return err
+	}
+
+	rows = nil
+	messages := erlay.MessageVectors(seed, count)
+	for _, v := range messages {
+		fields, err := json.Marshal(v.Msg)
+		if err != nil {
+			return err
+		}
+		rows = append(rows, []interface{}{
+			v.Msg.Command(),
+			string(fields),
+			hex.EncodeToString(v.Payload),
+			vectorfile.ErrorString(v.Err),
+			v.Comment,
+		})
+	}
+	if err := writeRows(messagesOut, messageColumns, rows); err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote %d short IDs, %d sketches and %d messages\n",
+		len(vectors), len(sketches), len(messages))
+	return nil
+}
+
+// parseElements parses a comma separated list of decimal elements.
+func parseElements(s string) ([]uint32, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var elements []uint32
+	for _, field := range strings.Split(s, ",") {
+		element, err := strconv.ParseUint(field, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, uint32(element))
+	}
+	return elements, nil
+}
+
+// checkFiles checks each vector of the short ID vector file with
+// erlay.CheckShortIDVector, each vector of the sketch vector file with
+// erlay.CheckSketchVector, and each vector of the message vector file with
+// erlay.CheckMessageVector. Any path may be empty to skip that file.
+func checkFiles(path, sketchesPath, messagesPath string) error {
+	if path != "" {
+		rows, err := vectorfile.ReadStringRows(path, 5)
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			salt1, err := strconv.ParseUint(row[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("%v: %v", row[4], err)
+			}
+			salt2, err := strconv.ParseUint(row[1], 10, 64)
+			if err != nil {
+				return fmt.Errorf("%v: %v", row[4], err)
+			}
+			wtxid, err := hex.DecodeString(row[2])
+			if err != nil {
+				return fmt.Errorf("%v: %v", row[4], err)
+			}
+			id, err := strconv.ParseUint(row[3], 10, 32)
+			if err != nil {
+				return fmt.Errorf("%v: %v", row[4], err)
+			}
+			err = erlay.CheckShortIDVector(erlay.ShortIDVector{
+				Salt1:   salt1,
+				Salt2:   salt2,
+				Wtxid:   wtxid,
+				ShortID: uint32(id),
+			})
+			if err != nil {
+				return fmt.Errorf("%v: %v", row[4], err)
+			}
+		}
+		fmt.Printf("%d vectors OK\n", len(rows))
+	}
+
+	if sketchesPath != "" {
+		rows, err := vectorfile.ReadStringRows(sketchesPath, 6)
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			capacity, err := strconv.Atoi(row[0])
+			if err != nil {
+				return fmt.Errorf("%v: %v", row[5], err)
+			}
+			elements, err := parseElements(row[1])
+			if err != nil {
+				return fmt.Errorf("%v: %v", row[5], err)
+			}
+			sketch, err := hex.DecodeString(row[2])
+			if err != nil {
+				return fmt.Errorf("%v: %v", row[5], err)
+			}
+			decoded, err := parseElements(row[3])
+			if err != nil {
+				return fmt.Errorf("%v: %v", row[5], err)
+			}
+			err = erlay.CheckSketchVector(erlay.SketchVector{
+				Capacity: capacity,
+				Elements: elements,
+				Sketch:   sketch,
+				Decoded:  decoded,
+				Err:      vectorfile.ParseError(row[4]),
+			})
+			if err != nil {
+				return fmt.Errorf("%v: %v", row[5], err)
+			}
+		}
+		fmt.Printf("%d sketches OK\n", len(rows))
+	}
+
+	if messagesPath != "" {
+		rows, err := vectorfile.ReadStringRows(messagesPath, 5)
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			msg := erlay.MakeEmptyMessage(row[0])
+			if msg == nil {
+				return fmt.Errorf("%v: unknown command %v",
+					row[4], row[0])
+			}
+			err := json.Unmarshal([]byte(row[1]), msg)
+			if err != nil {
+				return fmt.Errorf("%v: %v", row[4], err)
+			}
+			payload, err := hex.DecodeString(row[2])
+			if err != nil {
+				return fmt.Errorf("%v: %v", row[4], err)
+			}
+			err = erlay.CheckMessageVector(erlay.MessageVector{
+				Msg:     msg,
+				Payload: payload,
+				Err:     vectorfile.ParseError(row[3]),
+			})
+			if err != nil {
+				return fmt.Errorf("%v: %v", row[4], err)
+			}
+		}
+		fmt.Printf("%d messages OK\n", len(rows))
+	}
+	return nil
+}
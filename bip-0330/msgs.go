@@ -0,0 +1,350 @@
+package erlay
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+const (
+	// CmdSendTxRcncl, CmdReqRecon, CmdSketch, CmdReqSketchExt and
+	// CmdReconcilDiff are the commands of the BIP 330 messages.
+	CmdSendTxRcncl  = "sendtxrcncl"
+	CmdReqRecon     = "reqrecon"
+	CmdSketch       = "sketch"
+	CmdReqSketchExt = "reqsketchext"
+	CmdReconcilDiff = "reconcildiff"
+
+	// TxRcnclVersion is the version of reconciliation peers announce.
+	TxRcnclVersion = 1
+
+	// MaxSetSize is the largest set size reqrecon can tell, which bounds
+	// the capacity of sketches and the short IDs of reconcildiff.
+	MaxSetSize = math.MaxUint16
+
+	// qScale is the fixed point scale of the q coefficient of reqrecon.
+	qScale = 32767
+)
+
+// Message is a BIP 330 message. Serialize and Deserialize handle the payload
+// alone, without the message header.
+type Message interface {
+	wire.Message
+
+	// Serialize writes the message payload to w.
+	Serialize(w io.Writer) error
+
+	// Deserialize reads the message payload from r.
+	Deserialize(r io.Reader) error
+}
+
+// MakeEmptyMessage returns an empty message of the type carrying the passed
+// command, or nil if the command isn't one of the BIP 330 messages.
+func MakeEmptyMessage(command string) Message {
+	switch command {
+	case CmdSendTxRcncl:
+		return &MsgSendTxRcncl{}
+	case CmdReqRecon:
+		return &MsgReqRecon{}
+	case CmdSketch:
+		return &MsgSketch{}
+	case CmdReqSketchExt:
+		return &MsgReqSketchExt{}
+	case CmdReconcilDiff:
+		return &MsgReconcilDiff{}
+	default:
+		return nil
+	}
+}
+
+// MsgSendTxRcncl announces support for reconciliation before verack, with
+// the peer's half of the salt of short IDs.
+type MsgSendTxRcncl struct {
+	Version uint32
+	Salt    uint64
+}
+
+// Serialize writes the message payload to w.
+func (msg *MsgSendTxRcncl) Serialize(w io.Writer) error {
+	var b [12]byte
+	binary.LittleEndian.PutUint32(b[:], msg.Version)
+	binary.LittleEndian.PutUint64(b[4:], msg.Salt)
+	_, err := w.Write(b[:])
+	return err
+}
+
+// Deserialize reads the message payload from r.
+func (msg *MsgSendTxRcncl) Deserialize(r io.Reader) error {
+	var b [12]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return err
+	}
+	msg.Version = binary.LittleEndian.Uint32(b[:])
+	msg.Salt = binary.LittleEndian.Uint64(b[4:])
+	return nil
+}
+
+// BtcEncode implements wire.Message.
+func (msg *MsgSendTxRcncl) BtcEncode(w io.Writer, _ uint32,
+	_ wire.MessageEncoding) error {
+
+	return msg.Serialize(w)
+}
+
+// BtcDecode implements wire.Message.
+func (msg *MsgSendTxRcncl) BtcDecode(r io.Reader, _ uint32,
+	_ wire.MessageEncoding) error {
+
+	return msg.Deserialize(r)
+}
+
+// Command returns "sendtxrcncl".
+func (msg *MsgSendTxRcncl) Command() string {
+	return CmdSendTxRcncl
+}
+
+// MaxPayloadLength returns the fixed size of the payload.
+func (msg *MsgSendTxRcncl) MaxPayloadLength(uint32) uint32 {
+	return 4 + 8
+}
+
+// MsgReqRecon starts a reconciliation, telling the size of the initiator's
+// set and the q coefficient the responder estimates the capacity of its
+// sketch with, in fixed point with a scale of 32767.
+type MsgReqRecon struct {
+	SetSize uint16
+	Q       uint16
+}
+
+// NewMsgReqRecon returns a reqrecon of the set size and q coefficient, which
+// is clamped to the range from 0 to 2.
+func NewMsgReqRecon(setSize uint16, q float64) *MsgReqRecon {
+	q = math.Max(0, math.Min(q, float64(math.MaxUint16)/qScale))
+	return &MsgReqRecon{SetSize: setSize, Q: uint16(q * qScale)}
+}
+
+// Coefficient returns the q coefficient of the message.
+func (msg *MsgReqRecon) Coefficient() float64 {
+	return float64(msg.Q) / qScale
+}
+
+// Serialize writes the message payload to w.
+func (msg *MsgReqRecon) Serialize(w io.Writer) error {
+	var b [4]byte
+	binary.LittleEndian.PutUint16(b[:], msg.SetSize)
+	binary.LittleEndian.PutUint16(b[2:], msg.Q)
+	_, err := w.Write(b[:])
+	return err
+}
+
+// Deserialize reads the message payload from r.
+func (msg *MsgReqRecon) Deserialize(r io.Reader) error {
+	var b [4]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return err
+	}
+	msg.SetSize = binary.LittleEndian.Uint16(b[:])
+	msg.Q = binary.LittleEndian.Uint16(b[2:])
+	return nil
+}
+
+// BtcEncode implements wire.Message.
+func (msg *MsgReqRecon) BtcEncode(w io.Writer, _ uint32,
+	_ wire.MessageEncoding) error {
+
+	return msg.Serialize(w)
+}
+
+// BtcDecode implements wire.Message.
+func (msg *MsgReqRecon) BtcDecode(r io.Reader, _ uint32,
+	_ wire.MessageEncoding) error {
+
+	return msg.Deserialize(r)
+}
+
+// Command returns "reqrecon".
+func (msg *MsgReqRecon) Command() string {
+	return CmdReqRecon
+}
+
+// MaxPayloadLength returns the fixed size of the payload.
+func (msg *MsgReqRecon) MaxPayloadLength(uint32) uint32 {
+	return 2 + 2
+}
+
+// MsgSketch carries the serialized sketch of the responder's set, or its
+// extension.
+type MsgSketch struct {
+	Sketch []byte
+}
+
+// maxSketchSize is the size of the sketch of the largest capacity.
+const maxSketchSize = MaxSetSize * ElementSize
+
+// Serialize writes the message payload to w.
+func (msg *MsgSketch) Serialize(w io.Writer) error {
+	if len(msg.Sketch) > maxSketchSize {
+		return fmt.Errorf("%w: sketch of %d bytes", ErrTooMany,
+			len(msg.Sketch))
+	}
+	return wire.WriteVarBytes(w, 0, msg.Sketch)
+}
+
+// Deserialize reads the message payload from r.
+func (msg *MsgSketch) Deserialize(r io.Reader) error {
+	var err error
+	msg.Sketch, err = wire.ReadVarBytes(r, 0, maxSketchSize, "sketch")
+	return err
+}
+
+// BtcEncode implements wire.Message.
+func (msg *MsgSketch) BtcEncode(w io.Writer, _ uint32,
+	_ wire.MessageEncoding) error {
+
+	return msg.Serialize(w)
+}
+
+// BtcDecode implements wire.Message.
+func (msg *MsgSketch) BtcDecode(r io.Reader, _ uint32,
+	_ wire.MessageEncoding) error {
+
+	return msg.Deserialize(r)
+}
+
+// Command returns "sketch".
+func (msg *MsgSketch) Command() string {
+	return CmdSketch
+}
+
+// MaxPayloadLength returns the size of the payload holding the largest
+// sketch.
+func (msg *MsgSketch) MaxPayloadLength(uint32) uint32 {
+	return uint32(wire.VarIntSerializeSize(maxSketchSize)) + maxSketchSize
+}
+
+// MsgReqSketchExt asks the responder to extend its sketch to twice the
+// capacity, after the first failed to decode.
+type MsgReqSketchExt struct{}
+
+// Serialize writes the empty payload.
+func (msg *MsgReqSketchExt) Serialize(io.Writer) error {
+	return nil
+}
+
+// Deserialize reads the empty payload.
+func (msg *MsgReqSketchExt) Deserialize(io.Reader) error {
+	return nil
+}
+
+// BtcEncode implements wire.Message.
+func (msg *MsgReqSketchExt) BtcEncode(w io.Writer, _ uint32,
+	_ wire.MessageEncoding) error {
+
+	return msg.Serialize(w)
+}
+
+// BtcDecode implements wire.Message.
+func (msg *MsgReqSketchExt) BtcDecode(r io.Reader, _ uint32,
+	_ wire.MessageEncoding) error {
+
+	return msg.Deserialize(r)
+}
+
+// Command returns "reqsketchext".
+func (msg *MsgReqSketchExt) Command() string {
+	return CmdReqSketchExt
+}
+
+// MaxPayloadLength returns 0.
+func (msg *MsgReqSketchExt) MaxPayloadLength(uint32) uint32 {
+	return 0
+}
+
+// MsgReconcilDiff ends a reconciliation, telling whether the difference
+// decoded and the short IDs of the transactions the initiator lacks, which
+// the responder then announces.
+type MsgReconcilDiff struct {
+	Success     bool
+	AskShortIDs []uint32
+}
+
+// Serialize writes the message payload to w.
+func (msg *MsgReconcilDiff) Serialize(w io.Writer) error {
+	if len(msg.AskShortIDs) > MaxSetSize {
+		return fmt.Errorf("%w: %d short IDs, max %d", ErrTooMany,
+			len(msg.AskShortIDs), MaxSetSize)
+	}
+	var success byte
+	if msg.Success {
+		success = 1
+	}
+	if _, err := w.Write([]byte{success}); err != nil {
+		return err
+	}
+	err := wire.WriteVarInt(w, 0, uint64(len(msg.AskShortIDs)))
+	if err != nil {
+		return err
+	}
+	b := make([]byte, 0, len(msg.AskShortIDs)*ElementSize)
+	for _, id := range msg.AskShortIDs {
+		b = binary.LittleEndian.AppendUint32(b, id)
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// Deserialize reads the message payload from r.
+func (msg *MsgReconcilDiff) Deserialize(r io.Reader) error {
+	var success [1]byte
+	if _, err := io.ReadFull(r, success[:]); err != nil {
+		return err
+	}
+	msg.Success = success[0] != 0
+	count, err := wire.ReadVarInt(r, 0)
+	if err != nil {
+		return err
+	}
+	if count > MaxSetSize {
+		return fmt.Errorf("%w: %d short IDs, max %d", ErrTooMany,
+			count, MaxSetSize)
+	}
+	b := make([]byte, count*ElementSize)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return err
+	}
+	msg.AskShortIDs = nil
+	for i := 0; i < len(b); i += ElementSize {
+		msg.AskShortIDs = append(msg.AskShortIDs,
+			binary.LittleEndian.Uint32(b[i:]))
+	}
+	return nil
+}
+
+// BtcEncode implements wire.Message.
+func (msg *MsgReconcilDiff) BtcEncode(w io.Writer, _ uint32,
+	_ wire.MessageEncoding) error {
+
+	return msg.Serialize(w)
+}
+
+// BtcDecode implements wire.Message.
+func (msg *MsgReconcilDiff) BtcDecode(r io.Reader, _ uint32,
+	_ wire.MessageEncoding) error {
+
+	return msg.Deserialize(r)
+}
+
+// Command returns "reconcildiff".
+func (msg *MsgReconcilDiff) Command() string {
+	return CmdReconcilDiff
+}
+
+// MaxPayloadLength returns the size of the payload holding the most short
+// IDs.
+func (msg *MsgReconcilDiff) MaxPayloadLength(uint32) uint32 {
+	return 1 + uint32(wire.VarIntSerializeSize(MaxSetSize)) +
+		MaxSetSize*ElementSize
+}
@@ -0,0 +1,50 @@
+package erlay
+
+import (
+	"encoding/binary"
+	"math"
+
+	"github.com/aead/siphash"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// saltTag is the tag of the hash that combines the salts of two peers.
+var saltTag = []byte("Tx Relay Salting")
+
+// Salt is the SipHash key two peers compute the short IDs of their
+// transactions with.
+type Salt [siphash.KeySize]byte
+
+// NewSalt combines the salts two peers sent in their sendtxrcncl messages:
+// the first 16 bytes of the tagged hash of the lower, followed by the
+// higher, each in little endian. Either peer gets the same salt.
+func NewSalt(salt1, salt2 uint64) Salt {
+	if salt2 < salt1 {
+		salt1, salt2 = salt2, salt1
+	}
+	var b [16]byte
+	binary.LittleEndian.PutUint64(b[:], salt1)
+	binary.LittleEndian.PutUint64(b[8:], salt2)
+	var salt Salt
+	copy(salt[:], chainhash.TaggedHash(saltTag, b[:])[:])
+	return salt
+}
+
+// ShortID returns the short ID of the transaction of the wtxid, in the
+// byte order of the hash: 1 plus its SipHash-2-4 modulo 2^32 - 1, so that
+// no short ID is 0.
+func (s Salt) ShortID(wtxid []byte) uint32 {
+	key := [siphash.KeySize]byte(s)
+	return 1 + uint32(siphash.Sum64(wtxid, &key)%math.MaxUint32)
+}
+
+// EstimateCapacity returns the capacity of the sketch the responder sends
+// for sets of the sizes: their difference in size, plus q times the
+// smaller, rounded down, plus 1.
+func EstimateCapacity(localSize, remoteSize int, q float64) int {
+	diff, min := localSize-remoteSize, localSize
+	if diff < 0 {
+		diff, min = -diff, remoteSize
+	}
+	return diff + int(q*float64(min)) + 1
+}
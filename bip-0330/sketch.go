@@ -0,0 +1,165 @@
+package erlay
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// ElementSize is the size of the elements of sketches, and of short IDs.
+const ElementSize = 4
+
+// Sketch is a PinSketch of a set of short IDs: the sums of their odd powers
+// up to the capacity's. The sketch of the symmetric difference of two sets
+// is the sum of their sketches, and decodes to the difference as long as it
+// has no more elements than the capacity.
+type Sketch struct {
+	sums []uint32
+}
+
+// NewSketch returns the sketch of the empty set with the capacity.
+func NewSketch(capacity int) *Sketch {
+	return &Sketch{sums: make([]uint32, capacity)}
+}
+
+// ParseSketch parses the serialization of a sketch, whose capacity is its
+// size over ElementSize.
+func ParseSketch(data []byte) (*Sketch, error) {
+	if len(data)%ElementSize != 0 {
+		return nil, fmt.Errorf("%w: %d bytes", ErrInvalidSketch,
+			len(data))
+	}
+	s := NewSketch(len(data) / ElementSize)
+	for i := range s.sums {
+		s.sums[i] = binary.LittleEndian.Uint32(data[i*ElementSize:])
+	}
+	return s, nil
+}
+
+// Capacity returns the number of elements of the largest difference the
+// sketch decodes.
+func (s *Sketch) Capacity() int {
+	return len(s.sums)
+}
+
+// Serialize returns the sums of the sketch, each in little endian.
+func (s *Sketch) Serialize() []byte {
+	data := make([]byte, 0, len(s.sums)*ElementSize)
+	for _, sum := range s.sums {
+		data = binary.LittleEndian.AppendUint32(data, sum)
+	}
+	return data
+}
+
+// Add adds an element to the set of the sketch, or removes it if it's
+// there. Zero, which no short ID is, changes nothing.
+func (s *Sketch) Add(element uint32) {
+	squared := fieldMul(element, element)
+	for i := range s.sums {
+		s.sums[i] ^= element
+		element = fieldMul(element, squared)
+	}
+}
+
+// Merge adds the sketch of another set, making the sketch that of the
+// symmetric difference of the two. Sketches of different capacities merge
+// to a sketch of the lower.
+func (s *Sketch) Merge(other *Sketch) {
+	if len(other.sums) < len(s.sums) {
+		s.sums = s.sums[:len(other.sums)]
+	}
+	for i := range s.sums {
+		s.sums[i] ^= other.sums[i]
+	}
+}
+
+// Decode returns the elements of the set of the sketch in ascending order,
+// or ErrDecode if it has more than the capacity. Decoding finds the
+// polynomial whose roots are the elements from the power sums with the
+// Berlekamp-Massey algorithm, then its roots with Berlekamp's trace
+// algorithm. A set larger than the capacity is detected unless it shares
+// the sketch of a set no larger, as that of a random set does with a chance
+// of about 1/c! for capacity c: a sketch of capacity 1 always decodes.
+func (s *Sketch) Decode() ([]uint32, error) {
+	// The even power sums are the squares of the sums of half the power.
+	n := 2 * len(s.sums)
+	sums := make([]uint32, n)
+	for i := 0; i < n; i++ {
+		if i%2 == 0 {
+			sums[i] = s.sums[i/2]
+		} else {
+			sums[i] = fieldMul(sums[i/2], sums[i/2])
+		}
+	}
+
+	locator := berlekampMassey(sums)
+	if locator.degree() > len(s.sums) {
+		return nil, fmt.Errorf("%w: %d elements at least", ErrDecode,
+			locator.degree())
+	}
+
+	// The roots of the locator are the inverses of the elements, so
+	// those of its reverse are the elements.
+	reversed := make(poly, len(locator))
+	for i, c := range locator {
+		reversed[len(locator)-1-i] = c
+	}
+	if len(reversed) > 0 && reversed[0] == 0 {
+		return nil, fmt.Errorf("%w: zero element", ErrDecode)
+	}
+	elements, ok := findRoots(reversed.monic())
+	if !ok {
+		return nil, fmt.Errorf("%w: locator doesn't split", ErrDecode)
+	}
+	sort.Slice(elements, func(i, j int) bool {
+		return elements[i] < elements[j]
+	})
+
+	check := NewSketch(len(s.sums))
+	for _, element := range elements {
+		check.Add(element)
+	}
+	for i, sum := range check.sums {
+		if sum != s.sums[i] {
+			return nil, fmt.Errorf("%w: power sums don't match",
+				ErrDecode)
+		}
+	}
+	return elements, nil
+}
+
+// berlekampMassey returns the shortest connection polynomial, with constant
+// term 1, that generates the sequence.
+func berlekampMassey(seq []uint32) poly {
+	c, b := poly{1}, poly{1}
+	length, shift, lastDiscrepancy := 0, 1, uint32(1)
+	for n := range seq {
+		d := seq[n]
+		for i := 1; i <= length && i < len(c); i++ {
+			d ^= fieldMul(c[i], seq[n-i])
+		}
+		if d == 0 {
+			shift++
+			continue
+		}
+		coef := fieldMul(d, fieldInv(lastDiscrepancy))
+		t := append(poly{}, c...)
+		for len(c) < len(b)+shift {
+			c = append(c, 0)
+		}
+		for i, bc := range b {
+			c[i+shift] ^= fieldMul(coef, bc)
+		}
+		if 2*length <= n {
+			length = n + 1 - length
+			b, lastDiscrepancy, shift = t, d, 1
+		} else {
+			shift++
+		}
+	}
+	c = c.trim()
+	for len(c) < length+1 {
+		c = append(c, 0)
+	}
+	return c[:length+1]
+}
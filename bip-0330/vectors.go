@@ -0,0 +1,334 @@
+package erlay
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+
+	"github.com/christsim/bips/internal/vectorfile"
+)
+
+// ErrVectorMismatch is returned by the checks of vectors when computing
+// their short IDs, sketches or messages doesn't give the expected result.
+var ErrVectorMismatch = errors.New("erlay: vector mismatch")
+
+// ShortIDVector is the short ID of a wtxid under the salt two peers agree on
+// from theirs.
+type ShortIDVector struct {
+	Salt1   uint64
+	Salt2   uint64
+	Wtxid   []byte
+	ShortID uint32
+
+	// Comment describes what the vector exercises.
+	Comment string
+}
+
+// SketchVector is the sketch of a set of elements with a capacity, and the
+// outcome of decoding it.
+type SketchVector struct {
+	Capacity int
+	Elements []uint32
+	Sketch   []byte
+
+	// Decoded is the set decoding the sketch gives in ascending order,
+	// the elements unless there are more than the capacity, or Err the
+	// error decoding fails with.
+	Decoded []uint32
+	Err     error
+
+	// Comment describes what the vector exercises.
+	Comment string
+}
+
+// MessageVector is the payload of a message, or one that deserializing a
+// message of its command must reject.
+type MessageVector struct {
+	// Msg is the message of the payload, or an empty message of the
+	// command that rejects it.
+	Msg     Message
+	Payload []byte
+
+	// Err is the error deserializing the payload fails with, or nil if it
+	// gives Msg.
+	Err error
+
+	// Comment describes what the vector exercises.
+	Comment string
+}
+
+// RandomVectors returns the short IDs of count random wtxids derived from a
+// math/rand source with the seed, under random salts but for the zero salts
+// of the first. The second is repeated under its salts swapped.
+func RandomVectors(rngSeed int64, count int) []ShortIDVector {
+	rng := rand.New(rand.NewSource(rngSeed))
+	var vectors []ShortIDVector
+	for n := 0; n < count; n++ {
+		salt1, salt2 := rng.Uint64(), rng.Uint64()
+		comment := "Random salts"
+		if n == 0 {
+			salt1, salt2 = 0, 0
+			comment = "Zero salts"
+		}
+		var wtxid [32]byte
+		rng.Read(wtxid[:])
+		vectors = append(vectors, ShortIDVector{
+			Salt1:   salt1,
+			Salt2:   salt2,
+			Wtxid:   wtxid[:],
+			ShortID: NewSalt(salt1, salt2).ShortID(wtxid[:]),
+			Comment: comment,
+		})
+		if n == 1 {
+			swapped := NewSalt(salt2, salt1)
+			vectors = append(vectors, ShortIDVector{
+				Salt1:   salt2,
+				Salt2:   salt1,
+				Wtxid:   wtxid[:],
+				ShortID: swapped.ShortID(wtxid[:]),
+				Comment: "Random salts swapped",
+			})
+		}
+	}
+	return vectors
+}
+
+// CheckShortIDVector checks the short ID of the vector under the salts in
+// either order.
+func CheckShortIDVector(v ShortIDVector) error {
+	for _, salt := range []Salt{
+		NewSalt(v.Salt1, v.Salt2), NewSalt(v.Salt2, v.Salt1),
+	} {
+		if id := salt.ShortID(v.Wtxid); id != v.ShortID {
+			return fmt.Errorf("%w: short ID %d, expected %d",
+				ErrVectorMismatch, id, v.ShortID)
+		}
+	}
+	return nil
+}
+
+// newSketchVector returns the vector of the sketch of the elements with the
+// capacity.
+func newSketchVector(capacity int, elements []uint32,
+	comment string) SketchVector {
+
+	s := NewSketch(capacity)
+	for _, element := range elements {
+		s.Add(element)
+	}
+	decoded, err := s.Decode()
+	return SketchVector{
+		Capacity: capacity,
+		Elements: elements,
+		Sketch:   s.Serialize(),
+		Decoded:  decoded,
+		Err:      err,
+		Comment:  comment,
+	}
+}
+
+// randomElements returns n distinct random nonzero elements.
+func randomElements(rng *rand.Rand, n int) []uint32 {
+	seen := make(map[uint32]bool)
+	elements := make([]uint32, 0, n)
+	for len(elements) < n {
+		element := rng.Uint32()
+		if element == 0 || seen[element] {
+			continue
+		}
+		seen[element] = true
+		elements = append(elements, element)
+	}
+	return elements
+}
+
+// SketchVectors returns the sketches of a few fixed sets, followed by those
+// of count random capacities derived from a math/rand source with the seed:
+// of a set of that many random elements, of a smaller set, and of a larger
+// set, whose sketch mostly fails to decode but may decode to another set at
+// small capacities.
+func SketchVectors(rngSeed int64, count int) []SketchVector {
+	vectors := []SketchVector{
+		newSketchVector(1, nil, "Empty set"),
+		newSketchVector(1, []uint32{1}, "Element 1"),
+		newSketchVector(2, []uint32{0xffffffff, 1}, "Largest and "+
+			"smallest element"),
+		newSketchVector(4, []uint32{2, 3, 4, 5, 6}, "Five elements, "+
+			"capacity 4"),
+	}
+
+	rng := rand.New(rand.NewSource(rngSeed))
+	for n := 0; n < count; n++ {
+		capacity := 1 + rng.Intn(64)
+		smaller := rng.Intn(capacity)
+		larger := capacity + 1 + rng.Intn(capacity)
+		vectors = append(vectors,
+			newSketchVector(capacity, randomElements(rng, capacity),
+				"Set of the capacity"),
+			newSketchVector(capacity, randomElements(rng, smaller),
+				"Set smaller than the capacity"),
+			newSketchVector(capacity, randomElements(rng, larger),
+				"Set larger than the capacity"),
+		)
+	}
+	return vectors
+}
+
+// CheckSketchVector checks the sketch of the elements of the vector, made
+// whole and merged from two halves, and that decoding the sketch gives the
+// decoded set, which are the elements if they don't exceed the capacity, or
+// fails with the error.
+func CheckSketchVector(v SketchVector) error {
+	whole, half := NewSketch(v.Capacity), NewSketch(v.Capacity)
+	other := NewSketch(v.Capacity)
+	for i, element := range v.Elements {
+		whole.Add(element)
+		if i%2 == 0 {
+			half.Add(element)
+		} else {
+			other.Add(element)
+		}
+	}
+	half.Merge(other)
+	for _, s := range []*Sketch{whole, half} {
+		if data := s.Serialize(); !bytes.Equal(data, v.Sketch) {
+			return fmt.Errorf("%w: sketch %x, expected %x",
+				ErrVectorMismatch, data, v.Sketch)
+		}
+	}
+
+	s, err := ParseSketch(v.Sketch)
+	if err != nil {
+		return err
+	}
+	decoded, err := s.Decode()
+	if !vectorfile.SameError(err, v.Err) {
+		return fmt.Errorf("%w: decoding fails with %v, expected %v",
+			ErrVectorMismatch, err, v.Err)
+	}
+	if fmt.Sprint(decoded) != fmt.Sprint(v.Decoded) {
+		return fmt.Errorf("%w: decoded %v, expected %v",
+			ErrVectorMismatch, decoded, v.Decoded)
+	}
+	if err != nil || len(v.Elements) > v.Capacity {
+		return nil
+	}
+	elements := append([]uint32{}, v.Elements...)
+	sort.Slice(elements, func(i, j int) bool {
+		return elements[i] < elements[j]
+	})
+	if fmt.Sprint(decoded) != fmt.Sprint(elements) {
+		return fmt.Errorf("%w: decoded %v, expected the elements %v",
+			ErrVectorMismatch, decoded, elements)
+	}
+	return nil
+}
+
+// newMessageVector returns the vector of the payload of the message.
+func newMessageVector(msg Message, comment string) MessageVector {
+	var b bytes.Buffer
+	if err := msg.Serialize(&b); err != nil {
+		panic(err)
+	}
+	return MessageVector{Msg: msg, Payload: b.Bytes(), Comment: comment}
+}
+
+// invalidMessageVector returns the vector of a payload that deserializing
+// a message of the command must reject.
+func invalidMessageVector(command string, payload []byte,
+	comment string) MessageVector {
+
+	msg := MakeEmptyMessage(command)
+	err := msg.Deserialize(bytes.NewReader(payload))
+	if err == nil {
+		panic("erlay: " + comment + ": payload deserializes")
+	}
+	return MessageVector{
+		Msg:     MakeEmptyMessage(command),
+		Payload: payload,
+		Err:     err,
+		Comment: comment,
+	}
+}
+
+// MessageVectors returns count random messages of each command derived
+// from a math/rand source with the seed, followed by payloads that must be
+// rejected.
+func MessageVectors(rngSeed int64, count int) []MessageVector {
+	rng := rand.New(rand.NewSource(rngSeed))
+	var vectors []MessageVector
+	for n := 0; n < count; n++ {
+		capacity := rng.Intn(64)
+		sketch := NewSketch(capacity)
+		for _, element := range randomElements(rng, rng.Intn(64)) {
+			sketch.Add(element)
+		}
+		var ask []uint32
+		if k := rng.Intn(64); k > 0 {
+			ask = randomElements(rng, k)
+		}
+		vectors = append(vectors,
+			newMessageVector(&MsgSendTxRcncl{
+				Version: TxRcnclVersion,
+				Salt:    rng.Uint64(),
+			}, "sendtxrcncl"),
+			newMessageVector(NewMsgReqRecon(uint16(rng.Intn(
+				MaxSetSize+1)), 2*rng.Float64()), "reqrecon"),
+			newMessageVector(&MsgSketch{
+				Sketch: sketch.Serialize(),
+			}, fmt.Sprintf("sketch of capacity %d", capacity)),
+			newMessageVector(&MsgReqSketchExt{}, "reqsketchext"),
+			newMessageVector(&MsgReconcilDiff{
+				Success:     rng.Intn(2) == 0,
+				AskShortIDs: ask,
+			}, fmt.Sprintf("reconcildiff asking for %d short IDs",
+				len(ask))),
+		)
+	}
+
+	tooMany := []byte{1, 0xfe, 0, 0, 1, 0}
+	vectors = append(vectors,
+		invalidMessageVector(CmdSendTxRcncl, make([]byte, 11),
+			"Truncated sendtxrcncl"),
+		invalidMessageVector(CmdReqRecon, []byte{1, 0, 0},
+			"Truncated reqrecon"),
+		invalidMessageVector(CmdSketch, []byte{8, 1, 2, 3, 4},
+			"Truncated sketch"),
+		invalidMessageVector(CmdSketch, []byte{0xfe, 0, 0, 4, 0},
+			"Sketch larger than the largest capacity"),
+		invalidMessageVector(CmdReconcilDiff, []byte{1, 2, 1, 0, 0, 0},
+			"Truncated short IDs"),
+		invalidMessageVector(CmdReconcilDiff, tooMany,
+			"More short IDs than the largest set"),
+	)
+	return vectors
+}
+
+// CheckMessageVector checks that serializing the message of the vector
+// gives the payload and that deserializing the payload gives the message
+// back, or that deserializing fails with the error.
+func CheckMessageVector(v MessageVector) error {
+	msg := MakeEmptyMessage(v.Msg.Command())
+	err := msg.Deserialize(bytes.NewReader(v.Payload))
+	if !vectorfile.SameError(err, v.Err) {
+		return fmt.Errorf("%w: deserializing fails with %v, "+
+			"expected %v", ErrVectorMismatch, err, v.Err)
+	}
+	if err != nil {
+		return nil
+	}
+
+	for _, m := range []Message{v.Msg, msg} {
+		var b bytes.Buffer
+		if err := m.Serialize(&b); err != nil {
+			return err
+		}
+		if !bytes.Equal(b.Bytes(), v.Payload) {
+			return fmt.Errorf("%w: payload %x, expected %x",
+				ErrVectorMismatch, b.Bytes(), v.Payload)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package schnorr
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+)
+
+// ErrBatchLength is returned by BatchVerify when it isn't given as many
+// messages and signatures as public keys.
+var ErrBatchLength = errors.New("schnorr: batch needs a message and a " +
+	"signature per public key")
+
+// batchSeed returns the seed of the coefficients of a batch, a hash of
+// every public key, message and signature in it, so that they can't be
+// known before the signatures are fixed.
+func batchSeed(pubKeys, msgs, sigs [][]byte) []byte {
+	h := sha256.New()
+	for i := range pubKeys {
+		msgHash := sha256.Sum256(msgs[i])
+		h.Write(pubKeys[i])
+		h.Write(msgHash[:])
+		h.Write(sigs[i])
+	}
+	return h.Sum(nil)
+}
+
+// batchCoefficient returns the coefficient a of signature i of a batch. The
+// first one is 1, as the BIP allows, and the others are derived from the
+// seed.
+func batchCoefficient(seed []byte, i int) *btcec.ModNScalar {
+	var a btcec.ModNScalar
+	if i == 0 {
+		a.SetInt(1)
+		return &a
+	}
+
+	// A zero coefficient would drop the signature from the check, so the
+	// hash is redone with a counter in the unlikely case it's zero.
+	data := make([]byte, len(seed)+8)
+	copy(data, seed)
+	binary.BigEndian.PutUint32(data[len(seed):], uint32(i))
+	for counter := uint32(0); a.IsZero(); counter++ {
+		binary.BigEndian.PutUint32(data[len(seed)+4:], counter)
+		hash := sha256.Sum256(data)
+		a.SetBytes(&hash)
+	}
+	return &a
+}
+
+// BatchVerify checks that each signature is one of its message under its
+// public key, as Verify does, by checking that
+//
+//	(s₁ + a₂s₂ + ... + aᵤsᵤ)·G = R₁ + a₂·R₂ + ... + aᵤ·Rᵤ
+//	        + e₁·P₁ + a₂e₂·P₂ + ... + aᵤeᵤ·Pᵤ
+//
+// with coefficients a derived from a hash of the whole batch. It succeeds
+// exactly when every signature verifies, short of a negligible probability,
+// but doesn't tell which signature failed unless one fails to parse. An
+// empty batch verifies.
+func BatchVerify(pubKeys, msgs, sigs [][]byte) error {
+	if len(msgs) != len(pubKeys) || len(sigs) != len(pubKeys) {
+		return ErrBatchLength
+	}
+	seed := batchSeed(pubKeys, msgs, sigs)
+
+	// The equation is checked as s·G - Σ aᵢ·Rᵢ - Σ aᵢeᵢ·Pᵢ = O, with
+	// s = Σ aᵢsᵢ, in a single multi-scalar multiplication.
+	var s btcec.ModNScalar
+	scalars := make([]*btcec.ModNScalar, 0, 2*len(pubKeys)+1)
+	points := make([]*btcec.JacobianPoint, 0, 2*len(pubKeys)+1)
+	for i := range pubKeys {
+		p, err := liftX(pubKeys[i])
+		if err != nil {
+			return fmt.Errorf("%w: signature %d", err, i)
+		}
+		_, si, err := parseSignature(sigs[i])
+		if err != nil {
+			return fmt.Errorf("%w: signature %d", err, i)
+		}
+		r, err := liftX(sigs[i][:32])
+		if err != nil {
+			return fmt.Errorf("%w: signature %d: r isn't the x "+
+				"coordinate of a point", ErrInvalidSignature, i)
+		}
+
+		a := batchCoefficient(seed, i)
+		e := challenge(sigs[i][:32], pubKeys[i], msgs[i])
+		e.Mul(a).Negate()
+		s.Add(si.Mul(a))
+		scalars = append(scalars, a.Negate(), e)
+		points = append(points, r, p)
+	}
+	var g btcec.JacobianPoint
+	btcec.ScalarBaseMultNonConst(new(btcec.ModNScalar).SetInt(1), &g)
+	scalars = append(scalars, &s)
+	points = append(points, &g)
+
+	result := multiScalarMult(scalars, points)
+	if !isInfinity(&result) {
+		return fmt.Errorf("%w: batch doesn't verify",
+			ErrInvalidSignature)
+	}
+	return nil
+}
+
+// multiScalarMult returns Σ kᵢ·Pᵢ in variable time, with Straus's method:
+// the points share their doublings, and each adds a multiple of itself from
+// a table of 16 every 4 bits.
+func multiScalarMult(scalars []*btcec.ModNScalar,
+	points []*btcec.JacobianPoint) btcec.JacobianPoint {
+
+	const window = 4
+	tables := make([][1 << window]btcec.JacobianPoint, len(points))
+	for i, p := range points {
+		// tables[i][j] = j·Pᵢ, with the zero value as infinity.
+		tables[i][1] = *p
+		for j := 2; j < 1<<window; j++ {
+			btcec.AddNonConst(&tables[i][j-1], p, &tables[i][j])
+		}
+	}
+	digits := make([][32]byte, len(scalars))
+	for i, k := range scalars {
+		digits[i] = k.Bytes()
+	}
+
+	var result, t btcec.JacobianPoint
+	for bit := 256 - window; bit >= 0; bit -= window {
+		for j := 0; j < window; j++ {
+			btcec.DoubleNonConst(&result, &t)
+			result = t
+		}
+		for i := range points {
+			b := digits[i][31-bit/8]
+			digit := b >> (bit % 8) & (1<<window - 1)
+			if digit == 0 {
+				continue
+			}
+			btcec.AddNonConst(&result, &tables[i][digit], &t)
+			result = t
+		}
+	}
+	return result
+}
+
+// isInfinity reports whether a Jacobian point is the point at infinity.
+func isInfinity(p *btcec.JacobianPoint) bool {
+	return (p.X.IsZero() && p.Y.IsZero()) || p.Z.IsZero()
+}
@@ -0,0 +1,166 @@
+// This program writes test vectors for the schnorr package to
+// test-vectors.csv, in the layout of the CSV file of BIP 340: the vectors of
+// the BIP, in its order and with its indices, followed by random vectors.
+// With -count 0 the file reproduces the BIP's. The random vectors depend only
+// on -seed and -count, so they can be regenerated by anyone:
+//
+//	gentestvectors -count 60 -seed 340
+//
+// They cycle through valid signatures and negative cases the BIP's vectors
+// don't cover: nonce points and public keys with odd y coordinates, and r,
+// s and public keys that overflow the field or the curve order. Pass -check
+// to verify an existing file against the package instead, vector by vector
+// and with the valid vectors verified as one batch:
+//
+//	gentestvectors -check test-vectors.csv
+//
+// The program lives in a directory of its own since the schnorr package sits
+// at the root of the module.
+package main
+
+import (
+	"encoding/csv"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	schnorr "github.com/christsim/bips/bip-0340"
+)
+
+// vectorColumns is the header row of the vector file, as the BIP has it.
+var vectorColumns = []string{"index", "secret key", "public key", "aux_rand",
+	"message", "signature", "verification result", "comment"}
+
+func main() {
+	out := flag.String("out", "test-vectors.csv", "file to write the "+
+		"vectors to")
+	count := flag.Int("count", 60, "number of random vectors to write "+
+		"after those of the BIP")
+	seed := flag.Int64("seed", 340, "seed of the random vectors")
+	check := flag.String("check", "", "vector file to check instead of "+
+		"writing one")
+	flag.Parse()
+
+	var err error
+	if *check != "" {
+		err = checkFile(*check)
+	} else {
+		err = writeFile(*out, *seed, *count)
+	}
+	if err != nil {
+		fmt.Println("Error: ", err.Error())
+		os.Exit(1)
+	}
+}
+
+// encodeHex encodes bytes as the BIP's file does, in upper case.
+func encodeHex(b []byte) string {
+	return strings.ToUpper(hex.EncodeToString(b))
+}
+
+// formatResult formats a verification result as the BIP's file does.
+func formatResult(result bool) string {
+	return strings.ToUpper(strconv.FormatBool(result))
+}
+
+// writeFile writes the vectors of the BIP and count random vectors to out.
+func writeFile(out string, seed int64, count int) error {
+	vectors := append(schnorr.SpecVectors(),
+		schnorr.RandomVectors(seed, count)...)
+
+	file, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// The BIP's file ends its lines with CRLF.
+	writer := csv.NewWriter(file)
+	writer.UseCRLF = true
+	if err := writer.Write(vectorColumns); err != nil {
+		return err
+	}
+	for i, v := range vectors {
+		err := writer.Write([]string{
+			strconv.Itoa(i),
+			encodeHex(v.SecKey),
+			encodeHex(v.PubKey),
+			encodeHex(v.AuxRand),
+			encodeHex(v.Message),
+			encodeHex(v.Signature),
+			formatResult(v.Result),
+			v.Comment,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote %d vectors\n", len(vectors))
+	return nil
+}
+
+// checkFile checks each vector of the file with schnorr.CheckVector, and
+// the vectors together with schnorr.CheckBatch.
+func checkFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = len(vectorColumns)
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return fmt.Errorf("%v has no header row", path)
+	}
+
+	var vectors []schnorr.Vector
+	for _, row := range rows[1:] {
+		var fields [5][]byte
+		for i := range fields {
+			fields[i], err = hex.DecodeString(row[i+1])
+			if err != nil {
+				return fmt.Errorf("vector %v: %v", row[0], err)
+			}
+		}
+		var result bool
+		switch row[6] {
+		case "TRUE":
+			result = true
+		case "FALSE":
+		default:
+			return fmt.Errorf("vector %v: invalid result %q",
+				row[0], row[6])
+		}
+		v := schnorr.Vector{
+			SecKey:    fields[0],
+			PubKey:    fields[1],
+			AuxRand:   fields[2],
+			Message:   fields[3],
+			Signature: fields[4],
+			Result:    result,
+			Comment:   row[7],
+		}
+		if err := schnorr.CheckVector(v); err != nil {
+			return fmt.Errorf("vector %v: %v", row[0], err)
+		}
+		vectors = append(vectors, v)
+	}
+	if err := schnorr.CheckBatch(vectors); err != nil {
+		return err
+	}
+	fmt.Printf("%d vectors OK\n", len(vectors))
+	return nil
+}
@@ -0,0 +1,150 @@
+package schnorr
+
+import (
+	"github.com/btcsuite/btcd/btcec/v2"
+)
+
+// projective is a point of the curve in homogeneous projective coordinates,
+// (X/Z, Y/Z), with the point at infinity as (0:1:0). Its arithmetic keeps
+// every field element normalized, so each operation takes the same time.
+type projective struct {
+	x, y, z btcec.FieldVal
+}
+
+// generator is the base point G of secp256k1.
+var generator = func() projective {
+	var p projective
+	g := btcec.Generator()
+	p.x.SetByteSlice(g.X().Bytes())
+	p.y.SetByteSlice(g.Y().Bytes())
+	p.z.SetInt(1)
+	return p
+}()
+
+// b3 is three times the b coefficient of y² = x³ + 7.
+const b3 = 21
+
+// fieldAdd returns a + b.
+func fieldAdd(a, b *btcec.FieldVal) btcec.FieldVal {
+	var r btcec.FieldVal
+	r.Add2(a, b).Normalize()
+	return r
+}
+
+// fieldSub returns a - b.
+func fieldSub(a, b *btcec.FieldVal) btcec.FieldVal {
+	var r btcec.FieldVal
+	r.NegateVal(b, 1).Add(a).Normalize()
+	return r
+}
+
+// fieldMul returns a · b.
+func fieldMul(a, b *btcec.FieldVal) btcec.FieldVal {
+	var r btcec.FieldVal
+	r.Mul2(a, b).Normalize()
+	return r
+}
+
+// fieldMulB3 returns 3b · a.
+func fieldMulB3(a *btcec.FieldVal) btcec.FieldVal {
+	var r btcec.FieldVal
+	r.Set(a).MulInt(b3).Normalize()
+	return r
+}
+
+// add sets r to p + q with the complete addition formulas for curves with
+// a = 0 of Renes, Costello and Batina (algorithm 7 of "Complete addition
+// formulas for prime order elliptic curves"), which hold for any two points,
+// the point at infinity and doubling included, without branching.
+func (r *projective) add(p, q *projective) {
+	t0 := fieldMul(&p.x, &q.x)
+	t1 := fieldMul(&p.y, &q.y)
+	t2 := fieldMul(&p.z, &q.z)
+	t3 := fieldAdd(&p.x, &p.y)
+	t4 := fieldAdd(&q.x, &q.y)
+	t3 = fieldMul(&t3, &t4)
+	t4 = fieldAdd(&t0, &t1)
+	t3 = fieldSub(&t3, &t4)
+	t4 = fieldAdd(&p.y, &p.z)
+	x3 := fieldAdd(&q.y, &q.z)
+	t4 = fieldMul(&t4, &x3)
+	x3 = fieldAdd(&t1, &t2)
+	t4 = fieldSub(&t4, &x3)
+	x3 = fieldAdd(&p.x, &p.z)
+	y3 := fieldAdd(&q.x, &q.z)
+	x3 = fieldMul(&x3, &y3)
+	y3 = fieldAdd(&t0, &t2)
+	y3 = fieldSub(&x3, &y3)
+	x3 = fieldAdd(&t0, &t0)
+	t0 = fieldAdd(&x3, &t0)
+	t2 = fieldMulB3(&t2)
+	z3 := fieldAdd(&t1, &t2)
+	t1 = fieldSub(&t1, &t2)
+	y3 = fieldMulB3(&y3)
+	x3 = fieldMul(&t4, &y3)
+	t2 = fieldMul(&t3, &t1)
+	x3 = fieldSub(&t2, &x3)
+	y3 = fieldMul(&y3, &t0)
+	t1 = fieldMul(&t1, &z3)
+	y3 = fieldAdd(&t1, &y3)
+	t0 = fieldMul(&t0, &t3)
+	z3 = fieldMul(&z3, &t4)
+	z3 = fieldAdd(&z3, &t0)
+
+	r.x, r.y, r.z = x3, y3, z3
+}
+
+// swap exchanges p and q if the bit is 1 and leaves them if it's 0, touching
+// the same memory either way.
+func swap(p, q *projective, bit uint32) {
+	mask := byte(-bit)
+	for _, pair := range [3][2]*btcec.FieldVal{
+		{&p.x, &q.x}, {&p.y, &q.y}, {&p.z, &q.z},
+	} {
+		a, b := pair[0].Bytes(), pair[1].Bytes()
+		for i := range a {
+			t := (a[i] ^ b[i]) & mask
+			a[i] ^= t
+			b[i] ^= t
+		}
+		pair[0].SetBytes(a)
+		pair[1].SetBytes(b)
+	}
+}
+
+// scalarBaseMult returns the x coordinate of k·G and whether its y
+// coordinate is odd, in constant time. k must not be zero.
+func scalarBaseMult(k *btcec.ModNScalar) ([32]byte, uint32) {
+	// A Montgomery ladder keeps r1 = r0 + G and does one addition and one
+	// doubling per bit, whatever its value.
+	var r0, r1 projective
+	r0.y.SetInt(1)
+	r1 = generator
+	kBytes := k.Bytes()
+	for i := 255; i >= 0; i-- {
+		bit := uint32(kBytes[31-i/8]>>(i%8)) & 1
+		swap(&r0, &r1, bit)
+		r1.add(&r0, &r1)
+		r0.add(&r0, &r0)
+		swap(&r0, &r1, bit)
+	}
+
+	var zInv, x, y btcec.FieldVal
+	zInv.Set(&r0.z).Inverse()
+	x.Mul2(&r0.x, &zInv).Normalize()
+	y.Mul2(&r0.y, &zInv).Normalize()
+	return *x.Bytes(), y.IsOddBit()
+}
+
+// negateIf negates s if the bit is 1 and leaves it if it's 0, in constant
+// time.
+func negateIf(s *btcec.ModNScalar, bit uint32) {
+	var neg btcec.ModNScalar
+	neg.NegateVal(s)
+	a, b := s.Bytes(), neg.Bytes()
+	mask := byte(-bit)
+	for i := range a {
+		a[i] ^= (a[i] ^ b[i]) & mask
+	}
+	s.SetBytes(&a)
+}
@@ -0,0 +1,239 @@
+// Package schnorr implements the Schnorr signatures of BIP 340 over
+// secp256k1, which taproot outputs are spent with. Public keys are the 32
+// byte x coordinates of points with an even y coordinate, and signatures are
+// 64 bytes: the x coordinate of the nonce point R followed by the scalar s.
+//
+//	pubKey, err := schnorr.PubKey(secKey)
+//	sig, err := schnorr.Sign(secKey, msg, auxRand)
+//	err = schnorr.Verify(pubKey, msg, sig)
+//
+// Signing takes 32 bytes of auxiliary randomness, which is mixed into the
+// nonce as the BIP describes so that signatures stay safe when the
+// randomness is poor, and are deterministic when it is fixed. Computations
+// on the secret key and the nonce run in constant time: points are
+// multiplied with a Montgomery ladder over complete addition formulas, and
+// the choices that depend on secrets are made with masks rather than
+// branches. Verification only handles public data and uses the faster
+// variable time arithmetic of btcec.
+//
+// Messages may have any length. BatchVerify checks many signatures with the
+// single randomized equation of the BIP.
+package schnorr
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+)
+
+// Sizes of the encodings.
+const (
+	PubKeySize    = 32
+	SecKeySize    = 32
+	AuxRandSize   = 32
+	SignatureSize = 64
+)
+
+var (
+	// ErrInvalidSecKey is returned for a secret key that isn't 32 bytes
+	// or whose value is zero or not below the curve order.
+	ErrInvalidSecKey = errors.New("schnorr: invalid secret key")
+
+	// ErrInvalidAuxRand is returned by Sign for auxiliary randomness that
+	// isn't 32 bytes.
+	ErrInvalidAuxRand = errors.New("schnorr: auxiliary randomness must " +
+		"be 32 bytes")
+
+	// ErrInvalidPubKey is returned for a public key that isn't the x
+	// coordinate of a point of the curve.
+	ErrInvalidPubKey = errors.New("schnorr: invalid public key")
+
+	// ErrInvalidSignature is returned for a signature that doesn't verify.
+	// Verify wraps it with the reason.
+	ErrInvalidSignature = errors.New("schnorr: invalid signature")
+)
+
+// Tags of the tagged hashes of the BIP.
+const (
+	tagAux       = "BIP0340/aux"
+	tagNonce     = "BIP0340/nonce"
+	tagChallenge = "BIP0340/challenge"
+)
+
+// taggedHash returns SHA256(SHA256(tag) || SHA256(tag) || data...).
+func taggedHash(tag string, data ...[]byte) [32]byte {
+	tagHash := sha256.Sum256([]byte(tag))
+	h := sha256.New()
+	h.Write(tagHash[:])
+	h.Write(tagHash[:])
+	for _, d := range data {
+		h.Write(d)
+	}
+	var sum [32]byte
+	h.Sum(sum[:0])
+	return sum
+}
+
+// parseSecKey returns the scalar of a secret key.
+func parseSecKey(secKey []byte) (*btcec.ModNScalar, error) {
+	if len(secKey) != SecKeySize {
+		return nil, ErrInvalidSecKey
+	}
+	var d btcec.ModNScalar
+	if overflow := d.SetByteSlice(secKey); overflow || d.IsZero() {
+		return nil, ErrInvalidSecKey
+	}
+	return &d, nil
+}
+
+// liftX returns the point with the x coordinate and an even y coordinate.
+func liftX(x []byte) (*btcec.JacobianPoint, error) {
+	var fx btcec.FieldVal
+	if len(x) != PubKeySize || fx.SetByteSlice(x) {
+		return nil, fmt.Errorf("%w: x coordinate exceeds the field "+
+			"size", ErrInvalidPubKey)
+	}
+
+	// y² = x³ + 7
+	var ySquared, y btcec.FieldVal
+	ySquared.SquareVal(&fx).Mul(&fx).AddInt(7)
+	if !y.SquareRootVal(&ySquared) {
+		return nil, fmt.Errorf("%w: not on the curve", ErrInvalidPubKey)
+	}
+	if y.Normalize().IsOdd() {
+		y.Negate(1).Normalize()
+	}
+
+	var p btcec.JacobianPoint
+	p.X.Set(&fx)
+	p.Y.Set(&y)
+	p.Z.SetInt(1)
+	return &p, nil
+}
+
+// PubKey returns the public key of a secret key: the x coordinate of d·G.
+func PubKey(secKey []byte) ([]byte, error) {
+	d, err := parseSecKey(secKey)
+	if err != nil {
+		return nil, err
+	}
+	x, _ := scalarBaseMult(d)
+	return x[:], nil
+}
+
+// challenge returns the challenge e of a signature with the nonce point's x
+// coordinate, under the public key.
+func challenge(r, pubKey, msg []byte) *btcec.ModNScalar {
+	hash := taggedHash(tagChallenge, r, pubKey, msg)
+	var e btcec.ModNScalar
+	e.SetBytes(&hash)
+	return &e
+}
+
+// Sign signs the message with the secret key and 32 bytes of auxiliary
+// randomness, which should be fresh from crypto/rand but may be fixed, such
+// as all zero, for deterministic signatures. The signature is verified
+// before it's returned, which guards against faults leaking the key.
+func Sign(secKey, msg, auxRand []byte) ([]byte, error) {
+	d, err := parseSecKey(secKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(auxRand) != AuxRandSize {
+		return nil, ErrInvalidAuxRand
+	}
+
+	// The key is negated if its point has an odd y coordinate, so that
+	// it matches the x-only public key.
+	px, pOdd := scalarBaseMult(d)
+	negateIf(d, pOdd)
+	dBytes := d.Bytes()
+
+	// t = bytes(d) xor hash_aux(a), which keeps the nonce secret even
+	// when the randomness is known, and the randomness from being
+	// learned through side channels on the key.
+	t := taggedHash(tagAux, auxRand)
+	for i := range t {
+		t[i] ^= dBytes[i]
+	}
+	nonce := taggedHash(tagNonce, t[:], px[:], msg)
+	var k btcec.ModNScalar
+	k.SetBytes(&nonce)
+	if k.IsZero() {
+		return nil, fmt.Errorf("schnorr: nonce is zero")
+	}
+	rx, rOdd := scalarBaseMult(&k)
+	negateIf(&k, rOdd)
+
+	e := challenge(rx[:], px[:], msg)
+	var s btcec.ModNScalar
+	s.Mul2(e, d).Add(&k)
+
+	sig := make([]byte, SignatureSize)
+	copy(sig, rx[:])
+	s.PutBytesUnchecked(sig[32:])
+	if err := Verify(px[:], msg, sig); err != nil {
+		return nil, fmt.Errorf("schnorr: signature failed to "+
+			"verify: %w", err)
+	}
+	return sig, nil
+}
+
+// parseSignature returns the x coordinate of R and the scalar s of a
+// signature.
+func parseSignature(sig []byte) (*btcec.FieldVal, *btcec.ModNScalar, error) {
+	if len(sig) != SignatureSize {
+		return nil, nil, fmt.Errorf("%w: signature must be %d bytes",
+			ErrInvalidSignature, SignatureSize)
+	}
+	var r btcec.FieldVal
+	if r.SetByteSlice(sig[:32]) {
+		return nil, nil, fmt.Errorf("%w: r exceeds the field size",
+			ErrInvalidSignature)
+	}
+	var s btcec.ModNScalar
+	if s.SetByteSlice(sig[32:]) {
+		return nil, nil, fmt.Errorf("%w: s exceeds the curve order",
+			ErrInvalidSignature)
+	}
+	return &r, &s, nil
+}
+
+// Verify checks a signature of the message under the public key. It returns
+// ErrInvalidPubKey if the key isn't a point of the curve, and otherwise
+// ErrInvalidSignature, wrapped with the reason, if the signature doesn't
+// verify.
+func Verify(pubKey, msg, sig []byte) error {
+	p, err := liftX(pubKey)
+	if err != nil {
+		return err
+	}
+	r, s, err := parseSignature(sig)
+	if err != nil {
+		return err
+	}
+	e := challenge(sig[:32], pubKey, msg)
+
+	// R = s·G - e·P
+	var sG, eP, rPoint btcec.JacobianPoint
+	btcec.ScalarBaseMultNonConst(s, &sG)
+	e.Negate()
+	btcec.ScalarMultNonConst(e, p, &eP)
+	btcec.AddNonConst(&sG, &eP, &rPoint)
+
+	if isInfinity(&rPoint) {
+		return fmt.Errorf("%w: R is the point at infinity",
+			ErrInvalidSignature)
+	}
+	rPoint.ToAffine()
+	switch {
+	case rPoint.Y.IsOdd():
+		return fmt.Errorf("%w: R has an odd y coordinate",
+			ErrInvalidSignature)
+	case !rPoint.X.Equals(r):
+		return fmt.Errorf("%w: R doesn't match r", ErrInvalidSignature)
+	}
+	return nil
+}
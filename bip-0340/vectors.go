@@ -0,0 +1,446 @@
+package schnorr
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"math/rand"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+)
+
+// ErrVectorMismatch is returned by CheckVector when signing or verifying a
+// vector doesn't give the expected result.
+var ErrVectorMismatch = errors.New("schnorr: vector mismatch")
+
+// Vector is a signature of a message under a public key, laid out as the
+// rows of the CSV file of the BIP. Vectors without a secret key only test
+// verification.
+type Vector struct {
+	SecKey    []byte
+	PubKey    []byte
+	AuxRand   []byte
+	Message   []byte
+	Signature []byte
+
+	// Result is whether the signature verifies.
+	Result bool
+
+	// Comment describes what the vector exercises.
+	Comment string
+}
+
+// specVector is one of the test vectors of the BIP, in hex.
+type specVector struct {
+	secKey    string
+	pubKey    string
+	auxRand   string
+	message   string
+	signature string
+	result    bool
+	comment   string
+}
+
+// The public key, message and variable-length message key shared by many of
+// the BIP's vectors.
+const (
+	specPubKey  = "DFF1D77F2A671C5F36183726DB2341BE58FEAE1DA2DECED843240F7B502BA659"
+	specMessage = "243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89"
+	specZero    = "0000000000000000000000000000000000000000000000000000000000000000"
+	specVarKey  = "0340034003400340034003400340034003400340034003400340034003400340"
+	specVarPub  = "778CAA53B4393AC467774D09497A87224BF9FAB6F6E68B23086497324D6FD117"
+)
+
+var specVectors = []specVector{
+	{
+		secKey:    "0000000000000000000000000000000000000000000000000000000000000003",
+		pubKey:    "F9308A019258C31049344F85F89D5229B531C845836F99B08601F113BCE036F9",
+		auxRand:   specZero,
+		message:   specZero,
+		signature: "E907831F80848D1069A5371B402410364BDF1C5F8307B0084C55F1CE2DCA821525F66A4A85EA8B71E482A74F382D2CE5EBEEE8FDB2172F477DF4900D310536C0",
+		result:    true,
+	},
+	{
+		secKey:    "B7E151628AED2A6ABF7158809CF4F3C762E7160F38B4DA56A784D9045190CFEF",
+		pubKey:    specPubKey,
+		auxRand:   "0000000000000000000000000000000000000000000000000000000000000001",
+		message:   specMessage,
+		signature: "6896BD60EEAE296DB48A229FF71DFE071BDE413E6D43F917DC8DCF8C78DE33418906D11AC976ABCCB20B091292BFF4EA897EFCB639EA871CFA95F6DE339E4B0A",
+		result:    true,
+	},
+	{
+		secKey:    "C90FDAA22168C234C4C6628B80DC1CD129024E088A67CC74020BBEA63B14E5C9",
+		pubKey:    "DD308AFEC5777E13121FA72B9CC1B7CC0139715309B086C960E18FD969774EB8",
+		auxRand:   "C87AA53824B4D7AE2EB035A2B5BBBCCC080E76CDC6D1692C4B0B62D798E6D906",
+		message:   "7E2D58D8B3BCDF1ABADEC7829054F90DDA9805AAB56C77333024B9D0A508B75C",
+		signature: "5831AAEED7B44BB74E5EAB94BA9D4294C49BCF2A60728D8B4C200F50DD313C1BAB745879A5AD954A72C45A91C3A51D3C7ADEA98D82F8481E0E1E03674A6F3FB7",
+		result:    true,
+	},
+	{
+		secKey:    "0B432B2677937381AEF05BB02A66ECD012773062CF3FA2549E44F58ED2401710",
+		pubKey:    "25D1DFF95105F5253C4022F628A996AD3A0D95FBF21D468A1B33F8C160D8F517",
+		auxRand:   "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF",
+		message:   "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF",
+		signature: "7EB0509757E246F19449885651611CB965ECC1A187DD51B64FDA1EDC9637D5EC97582B9CB13DB3933705B32BA982AF5AF25FD78881EBB32771FC5922EFC66EA3",
+		result:    true,
+		comment:   "test fails if msg is reduced modulo p or n",
+	},
+	{
+		pubKey:    "D69C3509BB99E412E68B0FE8544E72837DFA30746D8BE2AA65975F29D22DC7B9",
+		message:   "4DF3C3F68FCC83B27E9D42C90431A72499F17875C81A599B566C9889B9696703",
+		signature: "00000000000000000000003B78CE563F89A0ED9414F5AA28AD0D96D6795F9C6376AFB1548AF603B3EB45C9F8207DEE1060CB71C04E80F593060B07D28308D7F4",
+		result:    true,
+	},
+	{
+		pubKey:    "EEFDEA4CDB677750A420FEE807EACF21EB9898AE79B9768766E4FAA04A2D4A34",
+		message:   specMessage,
+		signature: "6CFF5C3BA86C69EA4B7376F31A9BCB4F74C1976089B2D9963DA2E5543E17776969E89B4C5564D00349106B8497785DD7D1D713A8AE82B32FA79D5F7FC407D39B",
+		comment:   "public key not on the curve",
+	},
+	{
+		pubKey:    specPubKey,
+		message:   specMessage,
+		signature: "FFF97BD5755EEEA420453A14355235D382F6472F8568A18B2F057A14602975563CC27944640AC607CD107AE10923D9EF7A73C643E166BE5EBEAFA34B1AC553E2",
+		comment:   "has_even_y(R) is false",
+	},
+	{
+		pubKey:    specPubKey,
+		message:   specMessage,
+		signature: "1FA62E331EDBC21C394792D2AB1100A7B432B013DF3F6FF4F99FCB33E0E1515F28890B3EDB6E7189B630448B515CE4F8622A954CFE545735AAEA5134FCCDB2BD",
+		comment:   "negated message",
+	},
+	{
+		pubKey:    specPubKey,
+		message:   specMessage,
+		signature: "6CFF5C3BA86C69EA4B7376F31A9BCB4F74C1976089B2D9963DA2E5543E177769961764B3AA9B2FFCB6EF947B6887A226E8D7C93E00C5ED0C1834FF0D0C2E6DA6",
+		comment:   "negated s value",
+	},
+	{
+		pubKey:    specPubKey,
+		message:   specMessage,
+		signature: "0000000000000000000000000000000000000000000000000000000000000000123DDA8328AF9C23A94C1FEECFD123BA4FB73476F0D594DCB65C6425BD186051",
+		comment: "sG - eP is infinite. Test fails in single " +
+			"verification if has_even_y(inf) is defined as true " +
+			"and x(inf) as 0",
+	},
+	{
+		pubKey:    specPubKey,
+		message:   specMessage,
+		signature: "00000000000000000000000000000000000000000000000000000000000000017615FBAF5AE28864013C099742DEADB4DBA87F11AC6754F93780D5A1837CF197",
+		comment: "sG - eP is infinite. Test fails in single " +
+			"verification if has_even_y(inf) is defined as true " +
+			"and x(inf) as 1",
+	},
+	{
+		pubKey:    specPubKey,
+		message:   specMessage,
+		signature: "4A298DACAE57395A15D0795DDBFD1DCB564DA82B0F269BC70A74F8220429BA1D69E89B4C5564D00349106B8497785DD7D1D713A8AE82B32FA79D5F7FC407D39B",
+		comment:   "sig[0:32] is not an X coordinate on the curve",
+	},
+	{
+		pubKey:    specPubKey,
+		message:   specMessage,
+		signature: "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFEFFFFFC2F69E89B4C5564D00349106B8497785DD7D1D713A8AE82B32FA79D5F7FC407D39B",
+		comment:   "sig[0:32] is equal to field size",
+	},
+	{
+		pubKey:    specPubKey,
+		message:   specMessage,
+		signature: "6CFF5C3BA86C69EA4B7376F31A9BCB4F74C1976089B2D9963DA2E5543E177769FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFEBAAEDCE6AF48A03BBFD25E8CD0364141",
+		comment:   "sig[32:64] is equal to curve order",
+	},
+	{
+		pubKey:    "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFEFFFFFC30",
+		message:   specMessage,
+		signature: "6CFF5C3BA86C69EA4B7376F31A9BCB4F74C1976089B2D9963DA2E5543E17776969E89B4C5564D00349106B8497785DD7D1D713A8AE82B32FA79D5F7FC407D39B",
+		comment: "public key is not a valid X coordinate because it " +
+			"exceeds the field size",
+	},
+	{
+		secKey:    specVarKey,
+		pubKey:    specVarPub,
+		auxRand:   specZero,
+		signature: "71535DB165ECD9FBBC046E5FFAEA61186BB6AD436732FCCC25291A55895464CF6069CE26BF03466228F19A3A62DB8A649F2D560FAC652827D1AF0574E427AB63",
+		result:    true,
+		comment:   "message of size 0 (added 2022-12)",
+	},
+	{
+		secKey:    specVarKey,
+		pubKey:    specVarPub,
+		auxRand:   specZero,
+		message:   "11",
+		signature: "08A20A0AFEF64124649232E0693C583AB1B9934AE63B4C3511F3AE1134C6A303EA3173BFEA6683BD101FA5AA5DBC1996FE7CACFC5A577D33EC14564CEC2BACBF",
+		result:    true,
+		comment:   "message of size 1 (added 2022-12)",
+	},
+	{
+		secKey:    specVarKey,
+		pubKey:    specVarPub,
+		auxRand:   specZero,
+		message:   "0102030405060708090A0B0C0D0E0F1011",
+		signature: "5130F39A4059B43BC7CAC09A19ECE52B5D8699D1A71E3C52DA9AFDB6B50AC370C4A482B77BF960F8681540E25B6771ECE1E5A37FD80E5A51897C5566A97EA5A5",
+		result:    true,
+		comment:   "message of size 17 (added 2022-12)",
+	},
+	{
+		secKey:    specVarKey,
+		pubKey:    specVarPub,
+		auxRand:   specZero,
+		message:   "99999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999999",
+		signature: "403B12B0D8555A344175EA7EC746566303321E5DBFA8BE6F091635163ECA79A8585ED3E3170807E7C03B720FC54C7B23897FCBA0E9D0B4A06894CFD249F22367",
+		result:    true,
+		comment:   "message of size 100 (added 2022-12)",
+	},
+}
+
+// mustDecodeHex decodes hex the package embeds, which is known to be valid.
+func mustDecodeHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// SpecVectors returns the test vectors of the BIP, in the order of its CSV
+// file.
+func SpecVectors() []Vector {
+	vectors := make([]Vector, len(specVectors))
+	for i, sv := range specVectors {
+		vectors[i] = Vector{
+			SecKey:    mustDecodeHex(sv.secKey),
+			PubKey:    mustDecodeHex(sv.pubKey),
+			AuxRand:   mustDecodeHex(sv.auxRand),
+			Message:   mustDecodeHex(sv.message),
+			Signature: mustDecodeHex(sv.signature),
+			Result:    sv.result,
+			Comment:   sv.comment,
+		}
+	}
+	return vectors
+}
+
+// Kinds of random vectors, which RandomVectors cycles through.
+const (
+	kindValid = iota
+	kindOddR
+	kindOddP
+	kindROverflow
+	kindSOverflow
+	kindPubKeyOverflow
+	numKinds
+)
+
+var (
+	// fieldSize is the prime p of the field of secp256k1.
+	fieldSize = btcec.S256().P
+
+	// curveOrder is the order n of the group of secp256k1.
+	curveOrder = btcec.S256().N
+)
+
+// overflowing returns a random 32 byte value that is at least the limit.
+func overflowing(rng *rand.Rand, limit *big.Int) []byte {
+	span := new(big.Int).Lsh(big.NewInt(1), 256)
+	span.Sub(span, limit)
+	v := new(big.Int).Rand(rng, span)
+	v.Add(v, limit)
+	return v.FillBytes(make([]byte, 32))
+}
+
+// forge returns a signature of the message made without one of the
+// negations of Sign: of the nonce, so that R may have an odd y coordinate,
+// or of the secret key, so that it may not match the x-only public key. The
+// secret key and nonce are taken as they are.
+func forge(d, k *btcec.ModNScalar, msg []byte) (sig, pubKey []byte,
+	rOdd, pOdd bool) {
+
+	var p, r btcec.JacobianPoint
+	btcec.ScalarBaseMultNonConst(d, &p)
+	btcec.ScalarBaseMultNonConst(k, &r)
+	p.ToAffine()
+	r.ToAffine()
+	pubKey = p.X.Bytes()[:]
+	rx := r.X.Bytes()[:]
+
+	e := challenge(rx, pubKey, msg)
+	var s btcec.ModNScalar
+	s.Mul2(e, d).Add(k)
+	sig = make([]byte, SignatureSize)
+	copy(sig, rx)
+	s.PutBytesUnchecked(sig[32:])
+	return sig, pubKey, r.Y.IsOdd(), p.Y.IsOdd()
+}
+
+// randomScalar returns a random nonzero scalar.
+func randomScalar(rng *rand.Rand) *btcec.ModNScalar {
+	var k btcec.ModNScalar
+	for k.IsZero() {
+		var b [32]byte
+		rng.Read(b[:])
+		k.SetBytes(&b)
+	}
+	return &k
+}
+
+// RandomVectors returns count random vectors derived from a math/rand source
+// with the seed. They cycle through valid signatures of messages of random
+// lengths and negative cases: a nonce point with an odd y coordinate, a
+// secret key not negated for a public key with an odd y coordinate, and r,
+// s and public keys that overflow the field or the curve order.
+func RandomVectors(rngSeed int64, count int) []Vector {
+	rng := rand.New(rand.NewSource(rngSeed))
+	vectors := make([]Vector, 0, count)
+	for len(vectors) < count {
+		msgLen := 32
+		if rng.Intn(2) == 0 {
+			msgLen = rng.Intn(101)
+		}
+		msg := make([]byte, msgLen)
+		rng.Read(msg)
+		d := randomScalar(rng)
+		secKey := d.Bytes()
+
+		var v Vector
+		switch kind := len(vectors) % numKinds; kind {
+		case kindValid:
+			auxRand := make([]byte, AuxRandSize)
+			rng.Read(auxRand)
+			v = newVector(secKey[:], auxRand, msg)
+
+		case kindOddR, kindOddP:
+			// Keys and nonces are drawn until the point that
+			// isn't negated has an odd y coordinate, and the
+			// other one an even one.
+			sig, pubKey, rOdd, pOdd := forge(d, randomScalar(rng),
+				msg)
+			if rOdd != (kind == kindOddR) ||
+				pOdd != (kind == kindOddP) {
+
+				continue
+			}
+			v = Vector{PubKey: pubKey, Message: msg, Signature: sig}
+			if kind == kindOddR {
+				v.Comment = "R has an odd y coordinate"
+			} else {
+				v.Comment = "secret key not negated for a " +
+					"public key with an odd y coordinate"
+			}
+
+		default:
+			auxRand := make([]byte, AuxRandSize)
+			rng.Read(auxRand)
+			v = newVector(secKey[:], auxRand, msg)
+			v.SecKey, v.AuxRand, v.Result = nil, nil, false
+			switch kind {
+			case kindROverflow:
+				copy(v.Signature, overflowing(rng, fieldSize))
+				v.Comment = "r exceeds the field size"
+			case kindSOverflow:
+				s := overflowing(rng, curveOrder)
+				copy(v.Signature[32:], s)
+				v.Comment = "s exceeds the curve order"
+			case kindPubKeyOverflow:
+				v.PubKey = overflowing(rng, fieldSize)
+				v.Comment = "public key exceeds the field size"
+			}
+		}
+		vectors = append(vectors, v)
+	}
+	return vectors
+}
+
+// newVector signs the message with the secret key and auxiliary randomness.
+func newVector(secKey, auxRand, msg []byte) Vector {
+	pubKey, err := PubKey(secKey)
+	if err != nil {
+		panic(err)
+	}
+	sig, err := Sign(secKey, msg, auxRand)
+	if err != nil {
+		panic(err)
+	}
+	return Vector{
+		SecKey:    secKey,
+		PubKey:    pubKey,
+		AuxRand:   auxRand,
+		Message:   msg,
+		Signature: sig,
+		Result:    true,
+	}
+}
+
+// CheckVector checks a vector: a vector with a secret key must give its
+// public key and, signed with its auxiliary randomness, its signature, and
+// the signature must verify, alone and in a batch of its own, exactly when
+// the vector's result is true.
+func CheckVector(v Vector) error {
+	if len(v.SecKey) != 0 {
+		pubKey, err := PubKey(v.SecKey)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(pubKey, v.PubKey) {
+			return fmt.Errorf("%w: public key %X, expected %X",
+				ErrVectorMismatch, pubKey, v.PubKey)
+		}
+		sig, err := Sign(v.SecKey, v.Message, v.AuxRand)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(sig, v.Signature) {
+			return fmt.Errorf("%w: signature %X, expected %X",
+				ErrVectorMismatch, sig, v.Signature)
+		}
+	}
+
+	err := Verify(v.PubKey, v.Message, v.Signature)
+	if (err == nil) != v.Result {
+		return fmt.Errorf("%w: verification gave %v, expected %v",
+			ErrVectorMismatch, err, v.Result)
+	}
+	err = BatchVerify([][]byte{v.PubKey}, [][]byte{v.Message},
+		[][]byte{v.Signature})
+	if (err == nil) != v.Result {
+		return fmt.Errorf("%w: batch verification gave %v, expected %v",
+			ErrVectorMismatch, err, v.Result)
+	}
+	return nil
+}
+
+// CheckBatch checks batch verification across vectors: the signatures of
+// every vector whose result is true must verify as one batch, and adding the
+// signature of any other vector must make the batch fail.
+func CheckBatch(vectors []Vector) error {
+	var pubKeys, msgs, sigs [][]byte
+	for _, v := range vectors {
+		if v.Result {
+			pubKeys = append(pubKeys, v.PubKey)
+			msgs = append(msgs, v.Message)
+			sigs = append(sigs, v.Signature)
+		}
+	}
+	if err := BatchVerify(pubKeys, msgs, sigs); err != nil {
+		return fmt.Errorf("%w: batch of valid vectors: %v",
+			ErrVectorMismatch, err)
+	}
+
+	for _, v := range vectors {
+		if v.Result {
+			continue
+		}
+		// The slices are capped so that each vector is appended to
+		// the valid ones alone.
+		n := len(pubKeys)
+		err := BatchVerify(append(pubKeys[:n:n], v.PubKey),
+			append(msgs[:n:n], v.Message),
+			append(sigs[:n:n], v.Signature))
+		if err == nil {
+			return fmt.Errorf("%w: batch verifies with %q",
+				ErrVectorMismatch, v.Comment)
+		}
+	}
+	return nil
+}
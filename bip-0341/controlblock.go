@@ -0,0 +1,193 @@
+package taproot
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// Sizes of control blocks.
+const (
+	// ControlBlockBaseSize is the size of a control block of a tree of a
+	// single leaf: the leaf version and parity byte and the internal key.
+	ControlBlockBaseSize = 1 + KeySize
+
+	// ControlBlockMaxSize is the size of a control block of a leaf at
+	// MaxDepth.
+	ControlBlockMaxSize = ControlBlockBaseSize + MaxDepth*HashSize
+)
+
+// AnnexTag is the first byte of an annex, the optional last item of the
+// witness of a taproot spend.
+const AnnexTag = 0x50
+
+var (
+	// ErrInvalidControlBlock is returned for a control block whose size
+	// isn't 33 plus a multiple of 32 up to 4129 bytes.
+	ErrInvalidControlBlock = errors.New("taproot: invalid control block " +
+		"size")
+
+	// ErrCommitment is returned when a control block doesn't prove that
+	// a script is committed to by an output key.
+	ErrCommitment = errors.New("taproot: script isn't committed to by " +
+		"the output key")
+
+	// ErrInvalidSignature is returned by VerifyWitness for a key path
+	// signature that isn't 64 bytes, or 65 with a sighash type other
+	// than SIGHASH_DEFAULT.
+	ErrInvalidSignature = errors.New("taproot: invalid signature encoding")
+
+	// ErrEmptyWitness is returned by ParseWitness for a witness without
+	// items other than an annex.
+	ErrEmptyWitness = errors.New("taproot: empty witness")
+)
+
+// ControlBlock is the last witness item of a script path spend, which proves
+// that the script being run is in the tree of the output key.
+type ControlBlock struct {
+	LeafVersion     byte
+	OutputKeyParity byte
+	InternalKey     []byte
+
+	// Path holds the hashes of the siblings of the nodes on the way from
+	// the leaf to the root.
+	Path [][HashSize]byte
+}
+
+// ParseControlBlock parses a serialized control block.
+func ParseControlBlock(b []byte) (*ControlBlock, error) {
+	if len(b) < ControlBlockBaseSize || len(b) > ControlBlockMaxSize ||
+		(len(b)-ControlBlockBaseSize)%HashSize != 0 {
+
+		return nil, fmt.Errorf("%w: %d bytes", ErrInvalidControlBlock,
+			len(b))
+	}
+	internalKey := make([]byte, KeySize)
+	copy(internalKey, b[1:])
+	c := &ControlBlock{
+		LeafVersion:     b[0] & LeafVersionMask,
+		OutputKeyParity: b[0] &^ LeafVersionMask,
+		InternalKey:     internalKey,
+	}
+	for i := ControlBlockBaseSize; i < len(b); i += HashSize {
+		var hash [HashSize]byte
+		copy(hash[:], b[i:])
+		c.Path = append(c.Path, hash)
+	}
+	return c, nil
+}
+
+// Bytes returns the serialization of the control block.
+func (c *ControlBlock) Bytes() []byte {
+	b := make([]byte, 0, ControlBlockBaseSize+len(c.Path)*HashSize)
+	b = append(b, c.LeafVersion|c.OutputKeyParity)
+	b = append(b, c.InternalKey...)
+	for _, hash := range c.Path {
+		b = append(b, hash[:]...)
+	}
+	return b
+}
+
+// RootHash returns the merkle root the control block proves the script to be
+// under.
+func (c *ControlBlock) RootHash(script []byte) [HashSize]byte {
+	hash := LeafHash(c.LeafVersion, script)
+	for _, sibling := range c.Path {
+		hash = BranchHash(hash, sibling)
+	}
+	return hash
+}
+
+// Verify checks that the control block proves that the script is in the tree
+// the output key commits to, as a script path spend must: that tweaking the
+// internal key with the merkle root it gives yields the output key, with the
+// parity the control block has.
+func (c *ControlBlock) Verify(outputKey, script []byte) error {
+	root := c.RootHash(script)
+	key, parity, err := TweakPubKey(c.InternalKey, root[:])
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(key, outputKey) || parity != c.OutputKeyParity {
+		return ErrCommitment
+	}
+	return nil
+}
+
+// Spend is the witness of a taproot input, split into its parts.
+type Spend struct {
+	// Annex is the annex of the witness, including its tag, or nil.
+	Annex []byte
+
+	// Signature is the signature of a key path spend, and nil for a
+	// script path spend.
+	Signature []byte
+
+	// Script and ControlBlock are those of a script path spend, and Stack
+	// the witness items the script starts with.
+	Script       []byte
+	ControlBlock *ControlBlock
+	Stack        [][]byte
+}
+
+// IsKeyPath reports whether the spend is along the key path.
+func (s *Spend) IsKeyPath() bool {
+	return s.ControlBlock == nil
+}
+
+// ParseWitness splits the witness of a taproot input into its annex and
+// either the signature of a key path spend or the script, control block and
+// initial stack of a script path spend. An annex is the last of two or more
+// items if it starts with AnnexTag; a key path spend has one item left
+// after it.
+func ParseWitness(witness [][]byte) (*Spend, error) {
+	s := &Spend{}
+	if len(witness) >= 2 && len(witness[len(witness)-1]) != 0 &&
+		witness[len(witness)-1][0] == AnnexTag {
+
+		s.Annex = witness[len(witness)-1]
+		witness = witness[:len(witness)-1]
+	}
+
+	switch len(witness) {
+	case 0:
+		return nil, ErrEmptyWitness
+	case 1:
+		s.Signature = witness[0]
+		return s, nil
+	}
+	controlBlock, err := ParseControlBlock(witness[len(witness)-1])
+	if err != nil {
+		return nil, err
+	}
+	s.ControlBlock = controlBlock
+	s.Script = witness[len(witness)-2]
+	s.Stack = witness[:len(witness)-2]
+	return s, nil
+}
+
+// VerifyWitness parses the witness of an input spending the output with the
+// output key, and checks the commitment of a script path spend. What is
+// left to check is the signature of a key path spend, or the run of the
+// script with its stack, which both need the spending transaction.
+func VerifyWitness(outputKey []byte, witness [][]byte) (*Spend, error) {
+	s, err := ParseWitness(witness)
+	if err != nil {
+		return nil, err
+	}
+	if s.IsKeyPath() {
+		// A 65 byte signature ends with its sighash type, which must
+		// not be SIGHASH_DEFAULT, as that is what 64 bytes mean.
+		if (len(s.Signature) != 64 && len(s.Signature) != 65) ||
+			(len(s.Signature) == 65 && s.Signature[64] == 0) {
+
+			return nil, fmt.Errorf("%w: key path signature %x",
+				ErrInvalidSignature, s.Signature)
+		}
+		return s, nil
+	}
+	if err := s.ControlBlock.Verify(outputKey, s.Script); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
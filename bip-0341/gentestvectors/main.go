@@ -0,0 +1,286 @@
+// This program writes test vectors for the taproot package to
+// wallet-test-vectors.json, in the JSON layout of the wallet test vectors of
+// BIP 341: the scriptPubKey vectors of the BIP, followed by random outputs
+// with and without trees of scripts. The random vectors depend only on -seed
+// and -count, so they can be regenerated by anyone:
+//
+//	gentestvectors -count 50 -seed 341
+//
+// Each vector gives an internal key and a tree, whose leaves are numbered in
+// depth-first order, and lists the intermediary hashes and the expected
+// scriptPubKey, address and control blocks. The keyPathSpending vectors of
+// the BIP need transaction signature hashes and are left out. Pass -check to
+// verify an existing file against the package instead, which reads the
+// BIP's own file too:
+//
+//	gentestvectors -check wallet-test-vectors.json
+//
+// The program lives in a directory of its own since the taproot package sits
+// at the root of the module.
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	taproot "github.com/christsim/bips/bip-0341"
+)
+
+// vectorFile is the layout of the BIP's file.
+type vectorFile struct {
+	Version      int                  `json:"version"`
+	ScriptPubKey []scriptPubKeyVector `json:"scriptPubKey"`
+}
+
+// scriptPubKeyVector is a vector of the scriptPubKey section.
+type scriptPubKeyVector struct {
+	Given struct {
+		InternalPubkey string          `json:"internalPubkey"`
+		ScriptTree     json.RawMessage `json:"scriptTree"`
+	} `json:"given"`
+	Intermediary struct {
+		LeafHashes    []string `json:"leafHashes,omitempty"`
+		MerkleRoot    *string  `json:"merkleRoot"`
+		Tweak         string   `json:"tweak"`
+		TweakedPubkey string   `json:"tweakedPubkey"`
+	} `json:"intermediary"`
+	Expected struct {
+		ScriptPubKey            string   `json:"scriptPubKey"`
+		Bip350Address           string   `json:"bip350Address"`
+		ScriptPathControlBlocks []string `json:"scriptPathControlBlocks,omitempty"`
+	} `json:"expected"`
+}
+
+// leafJSON is a leaf of a script tree. Branches are arrays of two trees.
+type leafJSON struct {
+	ID          int    `json:"id"`
+	Script      string `json:"script"`
+	LeafVersion int    `json:"leafVersion"`
+}
+
+func main() {
+	out := flag.String("out", "wallet-test-vectors.json", "file to write "+
+		"the vectors to")
+	count := flag.Int("count", 50, "number of random vectors to write "+
+		"after those of the BIP")
+	seed := flag.Int64("seed", 341, "seed of the random vectors")
+	check := flag.String("check", "", "vector file to check instead of "+
+		"writing one")
+	flag.Parse()
+
+	var err error
+	if *check != "" {
+		err = checkFile(*check)
+	} else {
+		err = writeFile(*out, *seed, *count)
+	}
+	if err != nil {
+		fmt.Println("Error: ", err.Error())
+		os.Exit(1)
+	}
+}
+
+// encodeTree returns the JSON of a tree whose first leaf has the ID, and the
+// ID of the leaf after it.
+func encodeTree(tree *taproot.Tree, id int) (interface{}, int) {
+	if tree == nil {
+		return nil, id
+	}
+	if tree.IsLeaf() {
+		return leafJSON{
+			ID:          id,
+			Script:      hex.EncodeToString(tree.Script),
+			LeafVersion: int(tree.LeafVersion),
+		}, id + 1
+	}
+	left, id := encodeTree(tree.Left, id)
+	right, id := encodeTree(tree.Right, id)
+	return []interface{}{left, right}, id
+}
+
+// encodeHashes encodes a list of hashes in hex.
+func encodeHashes(hashes [][]byte) []string {
+	var s []string
+	for _, hash := range hashes {
+		s = append(s, hex.EncodeToString(hash))
+	}
+	return s
+}
+
+// writeFile writes the vectors of the BIP and count random vectors to out.
+func writeFile(out string, seed int64, count int) error {
+	vectors := append(taproot.SpecVectors(),
+		taproot.RandomVectors(seed, count)...)
+
+	file := vectorFile{Version: 1}
+	for _, v := range vectors {
+		var sv scriptPubKeyVector
+		sv.Given.InternalPubkey = hex.EncodeToString(v.InternalKey)
+		tree, _ := encodeTree(v.Tree, 0)
+		scriptTree, err := json.Marshal(tree)
+		if err != nil {
+			return err
+		}
+		sv.Given.ScriptTree = scriptTree
+
+		sv.Intermediary.LeafHashes = encodeHashes(v.LeafHashes)
+		if v.MerkleRoot != nil {
+			merkleRoot := hex.EncodeToString(v.MerkleRoot)
+			sv.Intermediary.MerkleRoot = &merkleRoot
+		}
+		sv.Intermediary.Tweak = hex.EncodeToString(v.Tweak)
+		sv.Intermediary.TweakedPubkey = hex.EncodeToString(v.TweakedKey)
+
+		sv.Expected.ScriptPubKey = hex.EncodeToString(v.ScriptPubKey)
+		sv.Expected.Bip350Address = v.Address
+		sv.Expected.ScriptPathControlBlocks = encodeHashes(
+			v.ControlBlocks)
+		file.ScriptPubKey = append(file.ScriptPubKey, sv)
+	}
+
+	data, err := json.MarshalIndent(file, "", "    ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(out, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote %d vectors\n", len(vectors))
+	return nil
+}
+
+// decodeTree decodes the JSON of a tree, checking that its leaves are
+// numbered in depth-first order from the ID, and returns the ID of the leaf
+// after it.
+func decodeTree(data json.RawMessage, id int) (*taproot.Tree, int, error) {
+	data = bytes.TrimSpace(data)
+	switch {
+	case len(data) == 0 || bytes.Equal(data, []byte("null")):
+		return nil, id, nil
+
+	case data[0] == '[':
+		var branch []json.RawMessage
+		if err := json.Unmarshal(data, &branch); err != nil {
+			return nil, 0, err
+		}
+		if len(branch) != 2 {
+			return nil, 0, fmt.Errorf("branch of %d subtrees",
+				len(branch))
+		}
+		left, id, err := decodeTree(branch[0], id)
+		if err != nil {
+			return nil, 0, err
+		}
+		right, id, err := decodeTree(branch[1], id)
+		if err != nil {
+			return nil, 0, err
+		}
+		if left == nil || right == nil {
+			return nil, 0, fmt.Errorf("branch with an empty " +
+				"subtree")
+		}
+		return taproot.NewBranch(left, right), id, nil
+	}
+
+	var leaf leafJSON
+	if err := json.Unmarshal(data, &leaf); err != nil {
+		return nil, 0, err
+	}
+	if leaf.ID != id {
+		return nil, 0, fmt.Errorf("leaf %d where %d was expected",
+			leaf.ID, id)
+	}
+	if leaf.LeafVersion < 0 || leaf.LeafVersion > 0xff {
+		return nil, 0, fmt.Errorf("leaf version %d", leaf.LeafVersion)
+	}
+	script, err := hex.DecodeString(leaf.Script)
+	if err != nil {
+		return nil, 0, err
+	}
+	return taproot.NewLeaf(byte(leaf.LeafVersion), script), id + 1, nil
+}
+
+// decodeHashes decodes a list of hashes in hex.
+func decodeHashes(s []string) ([][]byte, error) {
+	var hashes [][]byte
+	for _, h := range s {
+		hash, err := hex.DecodeString(h)
+		if err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, hash)
+	}
+	return hashes, nil
+}
+
+// decodeVector decodes a vector of the scriptPubKey section.
+func decodeVector(sv *scriptPubKeyVector) (taproot.Vector, error) {
+	var v taproot.Vector
+	var err error
+	if v.InternalKey, err = hex.DecodeString(
+		sv.Given.InternalPubkey); err != nil {
+
+		return v, err
+	}
+	if v.Tree, _, err = decodeTree(sv.Given.ScriptTree, 0); err != nil {
+		return v, err
+	}
+	if v.LeafHashes, err = decodeHashes(
+		sv.Intermediary.LeafHashes); err != nil {
+
+		return v, err
+	}
+	if sv.Intermediary.MerkleRoot != nil {
+		if v.MerkleRoot, err = hex.DecodeString(
+			*sv.Intermediary.MerkleRoot); err != nil {
+
+			return v, err
+		}
+	}
+	if v.Tweak, err = hex.DecodeString(sv.Intermediary.Tweak); err != nil {
+		return v, err
+	}
+	if v.TweakedKey, err = hex.DecodeString(
+		sv.Intermediary.TweakedPubkey); err != nil {
+
+		return v, err
+	}
+	if v.ScriptPubKey, err = hex.DecodeString(
+		sv.Expected.ScriptPubKey); err != nil {
+
+		return v, err
+	}
+	v.Address = sv.Expected.Bip350Address
+	v.ControlBlocks, err = decodeHashes(
+		sv.Expected.ScriptPathControlBlocks)
+	return v, err
+}
+
+// checkFile checks each scriptPubKey vector of the file with
+// taproot.CheckVector.
+func checkFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var file vectorFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return err
+	}
+	for i := range file.ScriptPubKey {
+		v, err := decodeVector(&file.ScriptPubKey[i])
+		if err != nil {
+			return fmt.Errorf("vector %d: %v", i, err)
+		}
+		if err := taproot.CheckVector(v); err != nil {
+			return fmt.Errorf("vector %d: %v", i, err)
+		}
+	}
+	fmt.Printf("%d vectors OK\n", len(file.ScriptPubKey))
+	return nil
+}
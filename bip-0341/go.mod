@@ -0,0 +1,16 @@
+module github.com/christsim/bips/bip-0341
+
+go 1.21
+
+require (
+	github.com/btcsuite/btcd/btcec/v2 v2.3.4
+	github.com/christsim/bips/bip-0173 v0.0.0
+)
+
+require (
+	github.com/btcsuite/btcd/chaincfg/chainhash v1.0.1 // indirect
+	github.com/decred/dcrd/crypto/blake256 v1.0.0 // indirect
+	github.com/decred/dcrd/dcrec/secp256k1/v4 v4.0.1 // indirect
+)
+
+replace github.com/christsim/bips/bip-0173 => ../bip-0173
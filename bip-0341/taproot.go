@@ -0,0 +1,214 @@
+// Package taproot implements the taproot outputs of BIP 341: tweaking an
+// internal key with the merkle root of a tree of scripts into the output
+// key, building those trees and the control blocks that prove a script is
+// in one, and checking the witnesses that spend an output along a script
+// path.
+//
+//	tree := taproot.NewBranch(
+//		taproot.NewLeaf(taproot.LeafVersionTapscript, script1),
+//		taproot.NewLeaf(taproot.LeafVersionTapscript, script2))
+//	out, err := taproot.NewOutput(internalKey, tree)
+//	address, err := out.Address("bc")
+//	controlBlock, err := out.ControlBlock(0)
+//
+// Keys are x-only, the 32 byte x coordinates of BIP 340. Signatures aren't
+// checked here: key path spends and the scripts of script path spends need
+// the signature hash of the spending transaction, which is left to the
+// caller.
+package taproot
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	bech32 "github.com/christsim/bips/bip-0173"
+)
+
+// Leaf versions and the sizes of keys and hashes.
+const (
+	// LeafVersionTapscript is the leaf version of the scripts of BIP 342.
+	LeafVersionTapscript = 0xc0
+
+	// LeafVersionMask masks the leaf version out of the first byte of a
+	// control block, whose lowest bit is the parity of the output key.
+	LeafVersionMask = 0xfe
+
+	// KeySize is the size of x-only internal and output keys.
+	KeySize = 32
+
+	// HashSize is the size of leaf, branch and tweak hashes.
+	HashSize = 32
+
+	// WitnessVersion is the witness version of taproot outputs.
+	WitnessVersion = 1
+)
+
+var (
+	// ErrInvalidKey is returned for an internal key that isn't the x
+	// coordinate of a point of the curve, or that can't be tweaked.
+	ErrInvalidKey = errors.New("taproot: invalid internal key")
+
+	// ErrInvalidSecKey is returned by TweakSecKey for a secret key that
+	// isn't 32 bytes or whose value is zero or not below the curve order.
+	ErrInvalidSecKey = errors.New("taproot: invalid secret key")
+
+	// ErrInvalidLeafVersion is returned for a leaf version that is odd,
+	// which would collide with the parity bit of control blocks, or is
+	// 0x50, which would make a control block look like an annex.
+	ErrInvalidLeafVersion = errors.New("taproot: invalid leaf version")
+)
+
+// Tags of the tagged hashes of the BIP.
+const (
+	tagLeaf   = "TapLeaf"
+	tagBranch = "TapBranch"
+	tagTweak  = "TapTweak"
+)
+
+// taggedHash returns the BIP 340 tagged hash of the data.
+func taggedHash(tag string, data ...[]byte) [HashSize]byte {
+	tagHash := sha256.Sum256([]byte(tag))
+	h := sha256.New()
+	h.Write(tagHash[:])
+	h.Write(tagHash[:])
+	for _, d := range data {
+		h.Write(d)
+	}
+	var sum [HashSize]byte
+	h.Sum(sum[:0])
+	return sum
+}
+
+// compactSize returns the CompactSize encoding of n, which prefixes scripts
+// in leaf hashes.
+func compactSize(n int) []byte {
+	switch {
+	case n < 0xfd:
+		return []byte{byte(n)}
+	case n <= 0xffff:
+		return []byte{0xfd, byte(n), byte(n >> 8)}
+	case n <= 0xffffffff:
+		return []byte{0xfe, byte(n), byte(n >> 8), byte(n >> 16),
+			byte(n >> 24)}
+	}
+	return []byte{0xff, byte(n), byte(n >> 8), byte(n >> 16), byte(n >> 24),
+		byte(n >> 32), byte(n >> 40), byte(n >> 48), byte(n >> 56)}
+}
+
+// checkLeafVersion checks that a leaf version can be committed to.
+func checkLeafVersion(version byte) error {
+	if version&^LeafVersionMask != 0 || version == 0x50 {
+		return fmt.Errorf("%w: %#02x", ErrInvalidLeafVersion, version)
+	}
+	return nil
+}
+
+// LeafHash returns the hash a tree commits to for a script of the leaf
+// version:
+//
+//	hashTapLeaf(v || compact_size(size of s) || s)
+func LeafHash(version byte, script []byte) [HashSize]byte {
+	return taggedHash(tagLeaf, []byte{version}, compactSize(len(script)),
+		script)
+}
+
+// BranchHash returns the hash of a branch of a tree whose children have the
+// hashes, which are hashed in lexicographic order so that proofs don't need
+// to say which side they're on.
+func BranchHash(a, b [HashSize]byte) [HashSize]byte {
+	for i := range a {
+		if a[i] != b[i] {
+			if a[i] > b[i] {
+				a, b = b, a
+			}
+			break
+		}
+	}
+	return taggedHash(tagBranch, a[:], b[:])
+}
+
+// TweakHash returns the tweak of an internal key committing to the merkle
+// root of a tree, or to no tree if the root is nil:
+//
+//	hashTapTweak(P || root)
+func TweakHash(internalKey, merkleRoot []byte) [HashSize]byte {
+	return taggedHash(tagTweak, internalKey, merkleRoot)
+}
+
+// TweakPubKey returns the output key committing to the internal key and the
+// merkle root of a tree, or to no tree if the root is nil, along with the
+// parity of its y coordinate, which control blocks carry:
+//
+//	Q = P + int(hashTapTweak(P || root))·G
+func TweakPubKey(internalKey, merkleRoot []byte) ([]byte, byte, error) {
+	p, err := schnorr.ParsePubKey(internalKey)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: %x", ErrInvalidKey, internalKey)
+	}
+	tweakHash := TweakHash(internalKey, merkleRoot)
+	var tweak btcec.ModNScalar
+	if tweak.SetBytes(&tweakHash) != 0 {
+		return nil, 0, fmt.Errorf("%w: tweak of %x overflows",
+			ErrInvalidKey, internalKey)
+	}
+
+	var tweakPoint, point, q btcec.JacobianPoint
+	btcec.ScalarBaseMultNonConst(&tweak, &tweakPoint)
+	p.AsJacobian(&point)
+	btcec.AddNonConst(&point, &tweakPoint, &q)
+	if (q.X.IsZero() && q.Y.IsZero()) || q.Z.IsZero() {
+		return nil, 0, fmt.Errorf("%w: tweak of %x gives infinity",
+			ErrInvalidKey, internalKey)
+	}
+	q.ToAffine()
+	x := q.X.Bytes()
+	var parity byte
+	if q.Y.IsOdd() {
+		parity = 1
+	}
+	return x[:], parity, nil
+}
+
+// TweakSecKey returns the secret key of the output key that TweakPubKey
+// gives for the public key of the secret key, which signs key path spends.
+// The secret key is negated first if its public key has an odd y
+// coordinate, as BIP 340 keys are.
+func TweakSecKey(secKey, merkleRoot []byte) ([]byte, error) {
+	var d btcec.ModNScalar
+	if len(secKey) != 32 || d.SetByteSlice(secKey) || d.IsZero() {
+		return nil, ErrInvalidSecKey
+	}
+	priv := btcec.PrivKeyFromScalar(&d)
+	pubKey := priv.PubKey().SerializeCompressed()
+	if pubKey[0] == 0x03 {
+		d.Negate()
+	}
+
+	tweakHash := TweakHash(pubKey[1:], merkleRoot)
+	var tweak btcec.ModNScalar
+	if tweak.SetBytes(&tweakHash) != 0 {
+		return nil, fmt.Errorf("%w: tweak of %x overflows",
+			ErrInvalidKey, pubKey[1:])
+	}
+	if d.Add(&tweak).IsZero() {
+		return nil, fmt.Errorf("%w: tweak of %x gives zero",
+			ErrInvalidKey, pubKey[1:])
+	}
+	b := d.Bytes()
+	return b[:], nil
+}
+
+// OutputScript returns the scriptPubKey of the output with the output key,
+// OP_1 <Q>.
+func OutputScript(outputKey []byte) []byte {
+	return bech32.WitnessScript(WitnessVersion, outputKey)
+}
+
+// Address returns the bech32m address of the output with the output key on
+// the network of the human-readable part.
+func Address(outputKey []byte, hrp string) (string, error) {
+	return bech32.EncodeSegwit(hrp, WitnessVersion, outputKey)
+}
@@ -0,0 +1,180 @@
+package taproot
+
+import (
+	"errors"
+	"fmt"
+)
+
+// MaxDepth is the largest depth of a leaf of a tree, as a control block has
+// at most 128 hashes.
+const MaxDepth = 128
+
+var (
+	// ErrTreeDepth is returned for a tree with a leaf deeper than
+	// MaxDepth.
+	ErrTreeDepth = errors.New("taproot: tree is deeper than 128")
+
+	// ErrNoLeaf is returned by Output.ControlBlock for an index past the
+	// leaves of the tree.
+	ErrNoLeaf = errors.New("taproot: no such leaf")
+)
+
+// Tree is a tree of scripts an output commits to. Each node is either a leaf
+// with a script, or a branch with two subtrees.
+type Tree struct {
+	// LeafVersion and Script are those of a leaf.
+	LeafVersion byte
+	Script      []byte
+
+	// Left and Right are the subtrees of a branch, and nil for a leaf.
+	Left, Right *Tree
+}
+
+// NewLeaf returns a tree of a single script of the leaf version.
+func NewLeaf(version byte, script []byte) *Tree {
+	return &Tree{LeafVersion: version, Script: script}
+}
+
+// NewBranch returns a tree of the two subtrees.
+func NewBranch(left, right *Tree) *Tree {
+	return &Tree{Left: left, Right: right}
+}
+
+// IsLeaf reports whether the tree is a single leaf.
+func (t *Tree) IsLeaf() bool {
+	return t.Left == nil && t.Right == nil
+}
+
+// Leaves returns the leaves of the tree, depth first and left to right,
+// which is the order leaves are indexed in.
+func (t *Tree) Leaves() []*Tree {
+	if t.IsLeaf() {
+		return []*Tree{t}
+	}
+	return append(t.Left.Leaves(), t.Right.Leaves()...)
+}
+
+// check checks the leaf versions of the tree and that it's no deeper than
+// MaxDepth, the depth of its root being the passed one.
+func (t *Tree) check(depth int) error {
+	if depth > MaxDepth {
+		return ErrTreeDepth
+	}
+	if t.IsLeaf() {
+		return checkLeafVersion(t.LeafVersion)
+	}
+	if t.Left == nil || t.Right == nil {
+		return errors.New("taproot: branch without two subtrees")
+	}
+	if err := t.Left.check(depth + 1); err != nil {
+		return err
+	}
+	return t.Right.check(depth + 1)
+}
+
+// Hash returns the hash of the tree, the merkle root an output commits to
+// for a whole tree.
+func (t *Tree) Hash() [HashSize]byte {
+	if t.IsLeaf() {
+		return LeafHash(t.LeafVersion, t.Script)
+	}
+	return BranchHash(t.Left.Hash(), t.Right.Hash())
+}
+
+// proof returns the hash of the tree and appends to path the hashes proving
+// that leaf i, counted from the tree's first leaf, is in it, from the leaf
+// up. found is false if the tree has fewer than i+1 leaves, and n is their
+// number.
+func (t *Tree) proof(i int, path *[][HashSize]byte) (hash [HashSize]byte,
+	n int, found bool) {
+
+	if t.IsLeaf() {
+		return t.Hash(), 1, i == 0
+	}
+	left, nLeft, inLeft := t.Left.proof(i, path)
+	right, nRight, inRight := t.Right.proof(i-nLeft, path)
+	switch {
+	case inLeft:
+		*path = append(*path, right)
+	case inRight:
+		*path = append(*path, left)
+	}
+	return BranchHash(left, right), nLeft + nRight, inLeft || inRight
+}
+
+// Output is a taproot output: an internal key tweaked with the merkle root
+// of a tree of scripts, or with nothing if the output has no scripts.
+type Output struct {
+	InternalKey []byte
+	Tree        *Tree
+
+	// MerkleRoot is the hash of the tree, or nil without one.
+	MerkleRoot []byte
+
+	// Tweak is the hash the internal key is tweaked with.
+	Tweak []byte
+
+	// OutputKey is the x-only key of the output, and OutputKeyParity the
+	// parity of its y coordinate.
+	OutputKey       []byte
+	OutputKeyParity byte
+}
+
+// NewOutput returns the output of the internal key and the tree, which may
+// be nil for an output spendable along the key path alone. BIP 341
+// recommends that such outputs still be tweaked, with the hash of the
+// internal key alone, so that no script path can be hidden in them; that is
+// what a nil tree gives.
+func NewOutput(internalKey []byte, tree *Tree) (*Output, error) {
+	var merkleRoot []byte
+	if tree != nil {
+		if err := tree.check(0); err != nil {
+			return nil, err
+		}
+		root := tree.Hash()
+		merkleRoot = root[:]
+	}
+	outputKey, parity, err := TweakPubKey(internalKey, merkleRoot)
+	if err != nil {
+		return nil, err
+	}
+	tweak := TweakHash(internalKey, merkleRoot)
+	return &Output{
+		InternalKey:     internalKey,
+		Tree:            tree,
+		MerkleRoot:      merkleRoot,
+		Tweak:           tweak[:],
+		OutputKey:       outputKey,
+		OutputKeyParity: parity,
+	}, nil
+}
+
+// Script returns the scriptPubKey of the output.
+func (o *Output) Script() []byte {
+	return OutputScript(o.OutputKey)
+}
+
+// Address returns the bech32m address of the output on the network of the
+// human-readable part.
+func (o *Output) Address(hrp string) (string, error) {
+	return Address(o.OutputKey, hrp)
+}
+
+// ControlBlock returns the control block that spends the output with leaf i
+// of its tree, counted as Tree.Leaves orders them.
+func (o *Output) ControlBlock(i int) (*ControlBlock, error) {
+	if o.Tree == nil || i < 0 {
+		return nil, fmt.Errorf("%w: %d", ErrNoLeaf, i)
+	}
+	var path [][HashSize]byte
+	if _, _, found := o.Tree.proof(i, &path); !found {
+		return nil, fmt.Errorf("%w: %d", ErrNoLeaf, i)
+	}
+	leaf := o.Tree.Leaves()[i]
+	return &ControlBlock{
+		LeafVersion:     leaf.LeafVersion,
+		OutputKeyParity: o.OutputKeyParity,
+		InternalKey:     o.InternalKey,
+		Path:            path,
+	}, nil
+}
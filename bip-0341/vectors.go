@@ -0,0 +1,287 @@
+package taproot
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/rand"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+)
+
+// ErrVectorMismatch is returned by CheckVector when building the output of
+// a vector doesn't give the expected values.
+var ErrVectorMismatch = errors.New("taproot: vector mismatch")
+
+// VectorHRP is the human-readable part of the addresses of the vectors,
+// those of mainnet, as the BIP has them.
+const VectorHRP = "bc"
+
+// Vector is an output built from an internal key and a tree, with the values
+// the scriptPubKey vectors of the BIP list: the intermediary hashes and
+// keys, and the expected script, address and control blocks.
+type Vector struct {
+	InternalKey []byte
+	Tree        *Tree
+
+	// LeafHashes are the hashes of the leaves in the order of
+	// Tree.Leaves, and MerkleRoot the hash of the tree, or nil without
+	// one.
+	LeafHashes [][]byte
+	MerkleRoot []byte
+
+	Tweak      []byte
+	TweakedKey []byte
+
+	ScriptPubKey []byte
+	Address      string
+
+	// ControlBlocks are the control blocks of the leaves in the order of
+	// Tree.Leaves.
+	ControlBlocks [][]byte
+}
+
+// NewVector builds the vector of the output of the internal key and the
+// tree, which may be nil.
+func NewVector(internalKey []byte, tree *Tree) (Vector, error) {
+	out, err := NewOutput(internalKey, tree)
+	if err != nil {
+		return Vector{}, err
+	}
+	address, err := out.Address(VectorHRP)
+	if err != nil {
+		return Vector{}, err
+	}
+	v := Vector{
+		InternalKey:  internalKey,
+		Tree:         tree,
+		MerkleRoot:   out.MerkleRoot,
+		Tweak:        out.Tweak,
+		TweakedKey:   out.OutputKey,
+		ScriptPubKey: out.Script(),
+		Address:      address,
+	}
+	if tree == nil {
+		return v, nil
+	}
+	for i, leaf := range tree.Leaves() {
+		hash := LeafHash(leaf.LeafVersion, leaf.Script)
+		v.LeafHashes = append(v.LeafHashes, hash[:])
+		controlBlock, err := out.ControlBlock(i)
+		if err != nil {
+			return Vector{}, err
+		}
+		v.ControlBlocks = append(v.ControlBlocks, controlBlock.Bytes())
+	}
+	return v, nil
+}
+
+// specVector is one of the scriptPubKey vectors of the BIP: its internal key
+// and tree, and the address it expects.
+type specVector struct {
+	internalKey string
+	tree        *Tree
+	address     string
+}
+
+// mustDecodeHex decodes hex the package embeds, which is known to be valid.
+func mustDecodeHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// tapscript returns a leaf of the tapscript leaf version with the script
+// in hex.
+func tapscript(script string) *Tree {
+	return NewLeaf(LeafVersionTapscript, mustDecodeHex(script))
+}
+
+var specVectors = []specVector{
+	{
+		internalKey: "d6889cb081036e0faefa3a35157ad71086b123b2b144b649798b494c300a961d",
+		address:     "bc1p2wsldez5mud2yam29q22wgfh9439spgduvct83k3pm50fcxa5dps59h4z5",
+	},
+	{
+		internalKey: "187791b6f712a8ea41c8ecdd0ee77fab3e85263b37e1ec18a3651926b3a6cf27",
+		tree:        tapscript("20d85a959b0290bf19bb89ed43c916be835475d013da4b362117393e25a48229b8ac"),
+		address:     "bc1pz37fc4cn9ah8anwm4xqqhvxygjf9rjf2resrw8h8w4tmvcs0863sa2e586",
+	},
+	{
+		internalKey: "93478e9488f956df2396be2ce6c5cced75f900dfa18e7dabd2428aae78451820",
+		tree:        tapscript("20b617298552a72ade070667e86ca63b8f5789a9fe8731ef91202a91c9f3459007ac"),
+		address:     "bc1punvppl2stp38f7kwv2u2spltjuvuaayuqsthe34hd2dyy5w4g58qqfuag5",
+	},
+	{
+		internalKey: "ee4fe085983462a184015d1f782d6a5f8b9c2b60130aff050ce221ecf3786592",
+		tree: NewBranch(
+			tapscript("20387671353e273264c495656e27e39ba899ea8fee3bb69fb2a680e22093447d48ac"),
+			NewLeaf(0xfa, mustDecodeHex("06424950333431"))),
+		address: "bc1pwyjywgrd0ffr3tx8laflh6228dj98xkjj8rum0zfpd6h0e930h6saqxrrm",
+	},
+	{
+		internalKey: "f9f400803e683727b14f463836e1e78e1c64417638aa066919291a225f0e8dd8",
+		tree: NewBranch(
+			tapscript("2044b178d64c32c4a05cc4f4d1407268f764c940d20ce97abfd44db5c3592b72fdac"),
+			tapscript("07546170726f6f74")),
+		address: "bc1pwl3s54fzmk0cjnpl3w9af39je7pv5ldg504x5guk2hpecpg2kgsqaqstjq",
+	},
+	{
+		internalKey: "e0dfe2300b0dd746a3f8674dfd4525623639042569d829c7f0eed9602d263e6f",
+		tree: NewBranch(
+			tapscript("2072ea6adcf1d371dea8fba1035a09f3d24ed5a059799bae114084130ee5898e69ac"),
+			NewBranch(
+				tapscript("202352d137f2f3ab38d1eaa976758873377fa5ebb817372c71e2c542313d4abda8ac"),
+				tapscript("207337c0dd4253cb86f2c43a2351aadd82cccb12a172cd120452b9bb8324f2186aac"))),
+		address: "bc1pjxmy65eywgafs5tsunw95ruycpqcqnev6ynxp7jaasylcgtcxczs6n332e",
+	},
+	{
+		internalKey: "55adf4e8967fbd2e29f20ac896e60c3b0f1d5b0efa9d34941b5958c7b0a0312d",
+		tree: NewBranch(
+			tapscript("2071981521ad9fc9036687364118fb6ccd2035b96a423c59c5430e98310a11abe2ac"),
+			NewBranch(
+				tapscript("20d5094d2dbe9b76e2c245a2b89b6006888952e2faa6a149ae318d69e520617748ac"),
+				tapscript("20c440b462ad48c7a77f94cd4532d8f2119dcebbd7c9764557e62726419b08ad4cac"))),
+		address: "bc1pw5tf7sqp4f50zka7629jrr036znzew70zxyvvej3zrpf8jg8hqcssyuewe",
+	},
+}
+
+// SpecVectors returns the scriptPubKey vectors of the BIP. Their intermediary
+// values and control blocks are built by the package from the given internal
+// keys and trees, and each is checked to give the address the BIP expects.
+func SpecVectors() []Vector {
+	vectors := make([]Vector, len(specVectors))
+	for i, sv := range specVectors {
+		v, err := NewVector(mustDecodeHex(sv.internalKey), sv.tree)
+		if err != nil {
+			panic(err)
+		}
+		if v.Address != sv.address {
+			panic(fmt.Sprintf("vector %d has address %v, the "+
+				"BIP %v", i, v.Address, sv.address))
+		}
+		vectors[i] = v
+	}
+	return vectors
+}
+
+// randomKey returns a random x-only internal key.
+func randomKey(rng *rand.Rand) []byte {
+	for {
+		var b [32]byte
+		rng.Read(b[:])
+		var d btcec.ModNScalar
+		if d.SetBytes(&b) != 0 || d.IsZero() {
+			continue
+		}
+		pubKey := btcec.PrivKeyFromScalar(&d).PubKey()
+		return pubKey.SerializeCompressed()[1:]
+	}
+}
+
+// randomLeaf returns a leaf, mostly a tapscript checking a random key, and
+// otherwise a random script of up to 300 bytes, whose size takes more than
+// a byte to encode past 252, under a random valid leaf version.
+func randomLeaf(rng *rand.Rand) *Tree {
+	if rng.Intn(4) != 0 {
+		script := append([]byte{0x20}, randomKey(rng)...)
+		return NewLeaf(LeafVersionTapscript, append(script, 0xac))
+	}
+	script := make([]byte, rng.Intn(301))
+	rng.Read(script)
+	for {
+		version := byte(rng.Intn(256)) & LeafVersionMask
+		if checkLeafVersion(version) == nil {
+			return NewLeaf(version, script)
+		}
+	}
+}
+
+// randomTree returns a tree of the number of leaves, split at random.
+func randomTree(rng *rand.Rand, leaves int) *Tree {
+	if leaves == 1 {
+		return randomLeaf(rng)
+	}
+	left := 1 + rng.Intn(leaves-1)
+	return NewBranch(randomTree(rng, left), randomTree(rng, leaves-left))
+}
+
+// RandomVectors returns count random vectors derived from a math/rand source
+// with the seed: outputs with random internal keys and either no tree or a
+// tree of up to 12 leaves of random shape.
+func RandomVectors(rngSeed int64, count int) []Vector {
+	rng := rand.New(rand.NewSource(rngSeed))
+	vectors := make([]Vector, 0, count)
+	for len(vectors) < count {
+		var tree *Tree
+		if rng.Intn(8) != 0 {
+			tree = randomTree(rng, 1+rng.Intn(12))
+		}
+		v, err := NewVector(randomKey(rng), tree)
+		if err != nil {
+			panic(err)
+		}
+		vectors = append(vectors, v)
+	}
+	return vectors
+}
+
+// equalHashes reports whether two lists of hashes are the same.
+func equalHashes(a, b [][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckVector checks a vector: the output of its internal key and tree must
+// give its intermediary values, script, address and control blocks, and
+// each control block must prove its leaf against the output key.
+func CheckVector(v Vector) error {
+	got, err := NewVector(v.InternalKey, v.Tree)
+	if err != nil {
+		return err
+	}
+	switch {
+	case !equalHashes(got.LeafHashes, v.LeafHashes):
+		return fmt.Errorf("%w: leaf hashes %x, expected %x",
+			ErrVectorMismatch, got.LeafHashes, v.LeafHashes)
+	case !bytes.Equal(got.MerkleRoot, v.MerkleRoot):
+		return fmt.Errorf("%w: merkle root %x, expected %x",
+			ErrVectorMismatch, got.MerkleRoot, v.MerkleRoot)
+	case !bytes.Equal(got.Tweak, v.Tweak):
+		return fmt.Errorf("%w: tweak %x, expected %x",
+			ErrVectorMismatch, got.Tweak, v.Tweak)
+	case !bytes.Equal(got.TweakedKey, v.TweakedKey):
+		return fmt.Errorf("%w: tweaked key %x, expected %x",
+			ErrVectorMismatch, got.TweakedKey, v.TweakedKey)
+	case !bytes.Equal(got.ScriptPubKey, v.ScriptPubKey):
+		return fmt.Errorf("%w: scriptPubKey %x, expected %x",
+			ErrVectorMismatch, got.ScriptPubKey, v.ScriptPubKey)
+	case got.Address != v.Address:
+		return fmt.Errorf("%w: address %v, expected %v",
+			ErrVectorMismatch, got.Address, v.Address)
+	case !equalHashes(got.ControlBlocks, v.ControlBlocks):
+		return fmt.Errorf("%w: control blocks %x, expected %x",
+			ErrVectorMismatch, got.ControlBlocks, v.ControlBlocks)
+	}
+
+	if v.Tree == nil {
+		return nil
+	}
+	for i, leaf := range v.Tree.Leaves() {
+		witness := [][]byte{leaf.Script, v.ControlBlocks[i]}
+		if _, err := VerifyWitness(v.TweakedKey, witness); err != nil {
+			return fmt.Errorf("leaf %d: %w", i, err)
+		}
+	}
+	return nil
+}
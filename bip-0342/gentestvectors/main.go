@@ -0,0 +1,251 @@
+// This program writes test vectors for the tapscript package to
+// sighash.json: the signature messages and hashes of inputs of random
+// transactions for every sighash type, along the key path and a script path,
+// with and without an annex. It also writes vectors of witnesses at and past
+// the resource limits of tapscript to limits.json. The random vectors depend
+// only on -seed and -count, so they can be regenerated by anyone:
+//
+//	gentestvectors -count 20 -seed 342
+//
+// Both files use the layout of the BIP 158 vectors: a JSON array whose first
+// row names the columns, followed by one row per vector. Transactions,
+// outputs, witness items and hashes are in hex, and PrevOuts and Witness are
+// arrays of them. A key path vector has an empty LeafHash, and a vector
+// whose sighash fails gives the error instead of SigMsg and SigHash. Pass
+// -check and -check-limits to verify existing files against the package
+// instead:
+//
+//	gentestvectors -check sighash.json -check-limits limits.json
+//
+// The program lives in a directory of its own since the tapscript package
+// sits at the root of the module.
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	tapscript "github.com/christsim/bips/bip-0342"
+	"github.com/christsim/bips/internal/vectorfile"
+)
+
+// sigHashColumns is the header row of the sighash vector file.
+const sigHashColumns = "Tx,PrevOuts,Index,HashType,Annex,LeafHash," +
+	"CodeSepPos,SigMsg,SigHash,Error,Comment"
+
+// limitColumns is the header row of the limit vector file.
+const limitColumns = "Witness,SigOps,Budget,Error,Comment"
+
+type JSONTestWriter struct {
+	writer          io.Writer
+	firstRowWritten bool
+}
+
+func NewJSONTestWriter(writer io.Writer) *JSONTestWriter {
+	return &JSONTestWriter{writer: writer}
+}
+
+func (w *JSONTestWriter) WriteComment(comment string) error {
+	return w.WriteTestCase([]interface{}{comment})
+}
+
+func (w *JSONTestWriter) WriteTestCase(row []interface{}) error {
+	var err error
+	if w.firstRowWritten {
+		_, err = io.WriteString(w.writer, ",\n")
+	} else {
+		_, err = io.WriteString(w.writer, "[\n")
+		w.firstRowWritten = true
+	}
+	if err != nil {
+		return err
+	}
+
+	rowBytes, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.writer.Write(rowBytes)
+	return err
+}
+
+func (w *JSONTestWriter) Close() error {
+	if !w.firstRowWritten {
+		return nil
+	}
+
+	_, err := io.WriteString(w.writer, "\n]\n")
+	return err
+}
+
+func main() {
+	out := flag.String("out", "sighash.json", "file to write the sighash "+
+		"vectors to")
+	limitsOut := flag.String("limits-out", "limits.json", "file to write "+
+		"the limit vectors to")
+	count := flag.Int("count", 20, "number of random transactions and "+
+		"witnesses to write vectors of")
+	seed := flag.Int64("seed", 342, "seed of the random vectors")
+	check := flag.String("check", "", "sighash vector file to check "+
+		"instead of writing the files")
+	checkLimits := flag.String("check-limits", "", "limit vector file "+
+		"to check instead of writing the files")
+	flag.Parse()
+
+	var err error
+	switch {
+	case *check != "" || *checkLimits != "":
+		if *check != "" {
+			err = checkFile(*check)
+		}
+		if err == nil && *checkLimits != "" {
+			err = checkLimitFile(*checkLimits)
+		}
+	default:
+		err = writeFile(*out, *seed, *count)
+		if err == nil {
+			err = writeLimitFile(*limitsOut, *seed, *count)
+		}
+	}
+	if err != nil {
+		fmt.Println("Error: ", err.Error())
+		os.Exit(1)
+	}
+}
+
+// hexList returns the items in hex.
+func hexList(items [][]byte) []string {
+	list := make([]string, len(items))
+	for i, item := range items {
+		list[i] = hex.EncodeToString(item)
+	}
+	return list
+}
+
+// writeFile writes the sighash vectors of count random transactions to out.
+func writeFile(out string, seed int64, count int) error {
+	vectors := tapscript.RandomVectors(seed, count)
+
+	file, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := NewJSONTestWriter(file)
+	if err := writer.WriteComment(sigHashColumns); err != nil {
+		return err
+	}
+	for _, v := range vectors {
+		err := writer.WriteTestCase([]interface{}{
+			hex.EncodeToString(v.Tx),
+			hexList(v.PrevOuts),
+			v.Index,
+			v.HashType,
+			hex.EncodeToString(v.Annex),
+			hex.EncodeToString(v.LeafHash),
+			v.CodeSepPos,
+			hex.EncodeToString(v.SigMsg),
+			hex.EncodeToString(v.SigHash),
+			vectorfile.ErrorString(v.Err),
+			v.Comment,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote %d sighash vectors\n", len(vectors))
+	return nil
+}
+
+// writeLimitFile writes the limit vectors, with count random witnesses, to
+// out.
+func writeLimitFile(out string, seed int64, count int) error {
+	vectors := tapscript.LimitVectors(seed, count)
+
+	file, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := NewJSONTestWriter(file)
+	if err := writer.WriteComment(limitColumns); err != nil {
+		return err
+	}
+	for _, v := range vectors {
+		err := writer.WriteTestCase([]interface{}{
+			hexList(v.Witness),
+			v.SigOps,
+			v.Budget,
+			vectorfile.ErrorString(v.Err),
+			v.Comment,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote %d limit vectors\n", len(vectors))
+	return nil
+}
+
+// checkFile checks each vector of the file with tapscript.CheckVector.
+func checkFile(path string) error {
+	rows, err := vectorfile.ReadRows(path, 11)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		var v tapscript.SigHashVector
+		var errText string
+		err := vectorfile.DecodeRow(row, &v.Tx, &v.PrevOuts, &v.Index,
+			&v.HashType, &v.Annex, &v.LeafHash, &v.CodeSepPos,
+			&v.SigMsg, &v.SigHash, &errText, &v.Comment)
+		if err != nil {
+			return err
+		}
+		v.Err = vectorfile.ParseError(errText)
+		if err := tapscript.CheckVector(v); err != nil {
+			return fmt.Errorf("%v: %v", v.Comment, err)
+		}
+	}
+	fmt.Printf("%d sighash vectors OK\n", len(rows))
+	return nil
+}
+
+// checkLimitFile checks each vector of the file with
+// tapscript.CheckLimitVector.
+func checkLimitFile(path string) error {
+	rows, err := vectorfile.ReadRows(path, 5)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		var v tapscript.LimitVector
+		var errText string
+		err := vectorfile.DecodeRow(row, &v.Witness, &v.SigOps,
+			&v.Budget, &errText, &v.Comment)
+		if err != nil {
+			return err
+		}
+		v.Err = vectorfile.ParseError(errText)
+		if err := tapscript.CheckLimitVector(v); err != nil {
+			return fmt.Errorf("%v: %v", v.Comment, err)
+		}
+	}
+	fmt.Printf("%d limit vectors OK\n", len(rows))
+	return nil
+}
@@ -0,0 +1,199 @@
+package tapscript
+
+import (
+	"errors"
+	"fmt"
+
+	taproot "github.com/christsim/bips/bip-0341"
+)
+
+// Resource limits of tapscript.
+const (
+	// MaxStackSize is the largest number of items the stack and the
+	// alternate stack may hold together, before and while the script
+	// runs.
+	MaxStackSize = 1000
+
+	// MaxElementSize is the largest size of an item of the initial stack
+	// or of a push.
+	MaxElementSize = 520
+
+	// SigOpWeight is the validation weight each signature check with a
+	// signature that isn't empty takes out of the budget.
+	SigOpWeight = 50
+
+	// WeightOffset is the validation weight budget a witness has on top
+	// of its serialized size.
+	WeightOffset = 50
+)
+
+var (
+	// ErrStackSize is returned for more than MaxStackSize stack items.
+	ErrStackSize = errors.New("tapscript: stack size limit exceeded")
+
+	// ErrElementSize is returned for a stack item larger than
+	// MaxElementSize.
+	ErrElementSize = errors.New("tapscript: push size limit exceeded")
+
+	// ErrValidationWeight is returned when the signature checks of a
+	// script use up more than its validation weight budget.
+	ErrValidationWeight = errors.New("tapscript: validation weight " +
+		"budget exceeded")
+
+	// ErrBadOpcode is returned for a script that ends inside a push
+	// before any OP_SUCCESSx.
+	ErrBadOpcode = errors.New("tapscript: script ends inside a push")
+)
+
+// Opcodes the script scan needs.
+const (
+	opPushData1 = 0x4c
+	opPushData2 = 0x4d
+	opPushData4 = 0x4e
+)
+
+// IsSuccess reports whether the opcode is one of the OP_SUCCESSx opcodes,
+// which make a script that has them succeed without running it, so that
+// soft forks can give them meanings.
+func IsSuccess(op byte) bool {
+	return op == 80 || op == 98 || (op >= 126 && op <= 129) ||
+		(op >= 131 && op <= 134) || (op >= 137 && op <= 138) ||
+		(op >= 141 && op <= 142) || (op >= 149 && op <= 153) ||
+		(op >= 187 && op <= 254)
+}
+
+// HasSuccess reports whether the script has an OP_SUCCESSx opcode. The
+// script is decoded up to the first one, so bytes after it that don't
+// decode are allowed, but it fails with ErrBadOpcode if a push runs past
+// its end before one.
+func HasSuccess(script []byte) (bool, error) {
+	for i := 0; i < len(script); {
+		start, op := i, script[i]
+		i++
+		var size int
+		switch {
+		case IsSuccess(op):
+			return true, nil
+		case op < opPushData1:
+			size = int(op)
+		case op == opPushData1 && i+1 <= len(script):
+			size = int(script[i])
+			i++
+		case op == opPushData2 && i+2 <= len(script):
+			size = int(script[i]) | int(script[i+1])<<8
+			i += 2
+		case op == opPushData4 && i+4 <= len(script):
+			size = int(script[i]) | int(script[i+1])<<8 |
+				int(script[i+2])<<16 | int(script[i+3])<<24
+			i += 4
+		case op >= opPushData1 && op <= opPushData4:
+			return false, fmt.Errorf("%w at %d", ErrBadOpcode,
+				start)
+		}
+		if size > len(script)-i {
+			return false, fmt.Errorf("%w at %d", ErrBadOpcode,
+				start)
+		}
+		i += size
+	}
+	return false, nil
+}
+
+// CheckStackSize checks that the stack and alternate stack, holding n items
+// together, are within MaxStackSize.
+func CheckStackSize(n int) error {
+	if n > MaxStackSize {
+		return fmt.Errorf("%w: %d items", ErrStackSize, n)
+	}
+	return nil
+}
+
+// CheckStack checks the initial stack of a script path spend against the
+// limits of tapscript: no more than MaxStackSize items, none larger than
+// MaxElementSize.
+func CheckStack(stack [][]byte) error {
+	if err := CheckStackSize(len(stack)); err != nil {
+		return err
+	}
+	for i, item := range stack {
+		if len(item) > MaxElementSize {
+			return fmt.Errorf("%w: item %d of %d bytes",
+				ErrElementSize, i, len(item))
+		}
+	}
+	return nil
+}
+
+// ValidationWeight returns the validation weight budget of a witness: its
+// size as serialized in a transaction, with the annex and the control block,
+// plus WeightOffset.
+func ValidationWeight(witness [][]byte) int64 {
+	size := len(compactSize(len(witness)))
+	for _, item := range witness {
+		size += len(compactSize(len(item))) + len(item)
+	}
+	return int64(size) + WeightOffset
+}
+
+// Budget is the validation weight a script has left while it runs.
+type Budget struct {
+	left int64
+}
+
+// NewBudget returns the budget of a script run from the witness.
+func NewBudget(witness [][]byte) *Budget {
+	return &Budget{left: ValidationWeight(witness)}
+}
+
+// Left returns the validation weight left, which is negative once the
+// budget has been exceeded.
+func (b *Budget) Left() int64 {
+	return b.left
+}
+
+// SigOp takes the weight of a signature check out of the budget, and fails
+// with ErrValidationWeight once the budget goes below zero. Checks of empty
+// signatures, which fail without being verified, take nothing.
+func (b *Budget) SigOp(sig []byte) error {
+	if len(sig) == 0 {
+		return nil
+	}
+	b.left -= SigOpWeight
+	if b.left < 0 {
+		return ErrValidationWeight
+	}
+	return nil
+}
+
+// CheckLimits checks the witness of a taproot input against the resource
+// limits of tapscript, given the number of signature checks with signatures
+// that aren't empty that running its script does. Key path spends and
+// scripts of other leaf versions have no such limits, and a tapscript with
+// an OP_SUCCESSx succeeds before any are checked. Otherwise the initial
+// stack must pass CheckStack, and the signature checks must fit in the
+// validation weight budget of the witness.
+func CheckLimits(witness [][]byte, sigOps int) error {
+	spend, err := taproot.ParseWitness(witness)
+	if err != nil {
+		return err
+	}
+	if spend.IsKeyPath() ||
+		spend.ControlBlock.LeafVersion != taproot.LeafVersionTapscript {
+
+		return nil
+	}
+
+	success, err := HasSuccess(spend.Script)
+	if err != nil || success {
+		return err
+	}
+	if err := CheckStack(spend.Stack); err != nil {
+		return err
+	}
+	budget := ValidationWeight(witness)
+	if weight := int64(sigOps) * SigOpWeight; weight > budget {
+		return fmt.Errorf("%w: %d signature checks weigh %d of %d",
+			ErrValidationWeight, sigOps, weight, budget)
+	}
+	return nil
+}
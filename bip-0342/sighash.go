@@ -0,0 +1,334 @@
+// Package tapscript implements the signature hash that taproot key path
+// spends of BIP 341 and tapscript signatures of BIP 342 sign, and the
+// resource limits BIP 342 puts on the scripts of script path spends.
+//
+//	hashes, err := tapscript.NewSigHashes(tx, prevOuts)
+//	path := tapscript.NewScriptPath(script, tapscript.NoCodeSeparator)
+//	sigHash, err := hashes.SigHash(0, tapscript.SigHashDefault, annex, path)
+//
+// A nil script path gives the signature hash of a key path spend. Scripts
+// aren't run here: CheckLimits checks a witness against the limits that
+// apply before a script runs, and the validation weight budget left after
+// the signatures the run checks, which the caller counts.
+package tapscript
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/btcsuite/btcd/wire"
+	taproot "github.com/christsim/bips/bip-0341"
+)
+
+// HashType is the sighash type of a signature, which selects the parts of
+// the transaction it signs.
+type HashType byte
+
+// The sighash types of BIP 341. SigHashDefault signs what SigHashAll signs,
+// but is implied by 64 byte signatures rather than appended to them.
+const (
+	SigHashDefault      HashType = 0x00
+	SigHashAll          HashType = 0x01
+	SigHashNone         HashType = 0x02
+	SigHashSingle       HashType = 0x03
+	SigHashAnyoneCanPay HashType = 0x80
+)
+
+// HashTypes lists the valid sighash types.
+var HashTypes = []HashType{
+	SigHashDefault, SigHashAll, SigHashNone, SigHashSingle,
+	SigHashAll | SigHashAnyoneCanPay, SigHashNone | SigHashAnyoneCanPay,
+	SigHashSingle | SigHashAnyoneCanPay,
+}
+
+// IsValid reports whether the sighash type is one of HashTypes.
+func (t HashType) IsValid() bool {
+	return t&^SigHashAnyoneCanPay <= SigHashSingle &&
+		t != SigHashAnyoneCanPay
+}
+
+// String returns the name of the sighash type, such as
+// SIGHASH_ALL|ANYONECANPAY, or its value in hex for an invalid one.
+func (t HashType) String() string {
+	if !t.IsValid() {
+		return fmt.Sprintf("0x%02x", byte(t))
+	}
+	name := [...]string{"SIGHASH_DEFAULT", "SIGHASH_ALL", "SIGHASH_NONE",
+		"SIGHASH_SINGLE"}[t&^SigHashAnyoneCanPay]
+	if t&SigHashAnyoneCanPay != 0 {
+		name += "|ANYONECANPAY"
+	}
+	return name
+}
+
+// Constants of the extension of the signature message by BIP 342.
+const (
+	// KeyVersion is the version of the public keys of tapscript, which
+	// signatures commit to.
+	KeyVersion = 0x00
+
+	// NoCodeSeparator is the code separator position signed when no
+	// OP_CODESEPARATOR has been executed.
+	NoCodeSeparator = 0xffffffff
+)
+
+var (
+	// ErrInvalidHashType is returned for a sighash type that isn't one of
+	// HashTypes.
+	ErrInvalidHashType = errors.New("tapscript: invalid sighash type")
+
+	// ErrPrevOuts is returned by NewSigHashes when the number of outputs
+	// spent isn't the number of inputs of the transaction.
+	ErrPrevOuts = errors.New("tapscript: outputs spent don't match the " +
+		"inputs")
+
+	// ErrInputIndex is returned for an input index out of range.
+	ErrInputIndex = errors.New("tapscript: input index out of range")
+
+	// ErrNoSingleOutput is returned for SIGHASH_SINGLE signatures of an
+	// input without an output of the same index.
+	ErrNoSingleOutput = errors.New("tapscript: no output for " +
+		"SIGHASH_SINGLE")
+
+	// ErrInvalidAnnex is returned for an annex that doesn't start with
+	// the annex tag.
+	ErrInvalidAnnex = errors.New("tapscript: invalid annex")
+)
+
+// tagSigHash is the tag of the hash of signature messages.
+const tagSigHash = "TapSighash"
+
+// sigHashEpoch is the byte the hashed signature message is prefixed with,
+// which leaves room for new signature hashes to differ from this one.
+const sigHashEpoch = 0x00
+
+// ScriptPath is what signatures of a tapscript commit to beyond those of a
+// key path spend: the hash of the leaf and the position of the last
+// OP_CODESEPARATOR executed before the signature is checked.
+type ScriptPath struct {
+	LeafHash [taproot.HashSize]byte
+
+	// CodeSepPos counts the opcodes of the script before the code
+	// separator, pushes included, or is NoCodeSeparator.
+	CodeSepPos uint32
+}
+
+// NewScriptPath returns the script path of a script of the tapscript leaf
+// version.
+func NewScriptPath(script []byte, codeSepPos uint32) *ScriptPath {
+	leafHash := taproot.LeafHash(taproot.LeafVersionTapscript, script)
+	return &ScriptPath{LeafHash: leafHash, CodeSepPos: codeSepPos}
+}
+
+// SigHashes holds the hashes of a transaction that every signature of its
+// inputs commits to unless its sighash type leaves them out, so that they
+// are computed once per transaction.
+type SigHashes struct {
+	tx       *wire.MsgTx
+	prevOuts []*wire.TxOut
+
+	prevOutsHash      [sha256.Size]byte
+	amountsHash       [sha256.Size]byte
+	scriptPubKeysHash [sha256.Size]byte
+	sequencesHash     [sha256.Size]byte
+	outputsHash       [sha256.Size]byte
+}
+
+// NewSigHashes computes the hashes of the transaction, whose inputs spend
+// the outputs in prevOuts, in order.
+func NewSigHashes(tx *wire.MsgTx, prevOuts []*wire.TxOut) (*SigHashes,
+	error) {
+
+	if len(prevOuts) != len(tx.TxIn) {
+		return nil, fmt.Errorf("%w: %d outputs for %d inputs",
+			ErrPrevOuts, len(prevOuts), len(tx.TxIn))
+	}
+
+	var outPoints, amounts, scripts, sequences, outputs bytes.Buffer
+	for i, txIn := range tx.TxIn {
+		outPoints.Write(txIn.PreviousOutPoint.Hash[:])
+		writeUint32(&outPoints, txIn.PreviousOutPoint.Index)
+		writeUint64(&amounts, uint64(prevOuts[i].Value))
+		writeVarBytes(&scripts, prevOuts[i].PkScript)
+		writeUint32(&sequences, txIn.Sequence)
+	}
+	for _, txOut := range tx.TxOut {
+		writeTxOut(&outputs, txOut)
+	}
+
+	return &SigHashes{
+		tx:                tx,
+		prevOuts:          prevOuts,
+		prevOutsHash:      sha256.Sum256(outPoints.Bytes()),
+		amountsHash:       sha256.Sum256(amounts.Bytes()),
+		scriptPubKeysHash: sha256.Sum256(scripts.Bytes()),
+		sequencesHash:     sha256.Sum256(sequences.Bytes()),
+		outputsHash:       sha256.Sum256(outputs.Bytes()),
+	}, nil
+}
+
+// SigMsg returns the signature message of input i with the sighash type: its
+// ext_flag is 1 for a script path spend and 0 for a key path spend, whose
+// path is nil. The annex is the one the input's witness has, or nil.
+func (h *SigHashes) SigMsg(i int, hashType HashType, annex []byte,
+	path *ScriptPath) ([]byte, error) {
+
+	tx := h.tx
+	if i < 0 || i >= len(tx.TxIn) {
+		return nil, fmt.Errorf("%w: %d", ErrInputIndex, i)
+	}
+	if !hashType.IsValid() {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidHashType, hashType)
+	}
+	if annex != nil && (len(annex) == 0 || annex[0] != taproot.AnnexTag) {
+		return nil, fmt.Errorf("%w: %x", ErrInvalidAnnex, annex)
+	}
+	anyoneCanPay := hashType&SigHashAnyoneCanPay != 0
+	outputType := hashType &^ SigHashAnyoneCanPay
+	if outputType == SigHashSingle && i >= len(tx.TxOut) {
+		return nil, fmt.Errorf("%w: input %d", ErrNoSingleOutput, i)
+	}
+
+	var msg bytes.Buffer
+	msg.WriteByte(byte(hashType))
+	writeUint32(&msg, uint32(tx.Version))
+	writeUint32(&msg, tx.LockTime)
+	if !anyoneCanPay {
+		msg.Write(h.prevOutsHash[:])
+		msg.Write(h.amountsHash[:])
+		msg.Write(h.scriptPubKeysHash[:])
+		msg.Write(h.sequencesHash[:])
+	}
+	if outputType != SigHashNone && outputType != SigHashSingle {
+		msg.Write(h.outputsHash[:])
+	}
+
+	var spendType byte
+	if path != nil {
+		spendType = 2
+	}
+	if annex != nil {
+		spendType |= 1
+	}
+	msg.WriteByte(spendType)
+
+	if anyoneCanPay {
+		txIn := tx.TxIn[i]
+		msg.Write(txIn.PreviousOutPoint.Hash[:])
+		writeUint32(&msg, txIn.PreviousOutPoint.Index)
+		writeTxOut(&msg, h.prevOuts[i])
+		writeUint32(&msg, txIn.Sequence)
+	} else {
+		writeUint32(&msg, uint32(i))
+	}
+	if annex != nil {
+		var b bytes.Buffer
+		writeVarBytes(&b, annex)
+		annexHash := sha256.Sum256(b.Bytes())
+		msg.Write(annexHash[:])
+	}
+	if outputType == SigHashSingle {
+		var b bytes.Buffer
+		writeTxOut(&b, tx.TxOut[i])
+		outputHash := sha256.Sum256(b.Bytes())
+		msg.Write(outputHash[:])
+	}
+
+	if path != nil {
+		msg.Write(path.LeafHash[:])
+		msg.WriteByte(KeyVersion)
+		writeUint32(&msg, path.CodeSepPos)
+	}
+	return msg.Bytes(), nil
+}
+
+// SigHash returns the hash signed by the signatures of input i with the
+// sighash type, the tagged hash of its signature message.
+func (h *SigHashes) SigHash(i int, hashType HashType, annex []byte,
+	path *ScriptPath) ([sha256.Size]byte, error) {
+
+	msg, err := h.SigMsg(i, hashType, annex, path)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	return hashSigMsg(msg), nil
+}
+
+// hashSigMsg returns the tagged hash of the epoch and a signature message.
+func hashSigMsg(msg []byte) [sha256.Size]byte {
+	tagHash := sha256.Sum256([]byte(tagSigHash))
+	h := sha256.New()
+	h.Write(tagHash[:])
+	h.Write(tagHash[:])
+	h.Write([]byte{sigHashEpoch})
+	h.Write(msg)
+	var hash [sha256.Size]byte
+	h.Sum(hash[:0])
+	return hash
+}
+
+// SplitSignature splits a signature of a key path spend or tapscript into
+// its 64 byte Schnorr signature and its sighash type: a 64 byte signature
+// is of SIGHASH_DEFAULT, and a 65 byte one ends with its sighash type,
+// which must be valid and not SIGHASH_DEFAULT.
+func SplitSignature(sig []byte) ([]byte, HashType, error) {
+	switch {
+	case len(sig) == 64:
+		return sig, SigHashDefault, nil
+	case len(sig) != 65:
+		return nil, 0, fmt.Errorf("tapscript: invalid signature "+
+			"size %d", len(sig))
+	}
+	hashType := HashType(sig[64])
+	if hashType == SigHashDefault || !hashType.IsValid() {
+		return nil, 0, fmt.Errorf("%w: %v", ErrInvalidHashType,
+			hashType)
+	}
+	return sig[:64], hashType, nil
+}
+
+// writeUint32 writes n in little endian.
+func writeUint32(w io.Writer, n uint32) {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], n)
+	w.Write(b[:])
+}
+
+// writeUint64 writes n in little endian.
+func writeUint64(w io.Writer, n uint64) {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], n)
+	w.Write(b[:])
+}
+
+// writeVarBytes writes b prefixed with its size as a CompactSize.
+func writeVarBytes(w io.Writer, b []byte) {
+	w.Write(compactSize(len(b)))
+	w.Write(b)
+}
+
+// writeTxOut writes an output as transactions serialize it: its amount and
+// its script.
+func writeTxOut(w io.Writer, txOut *wire.TxOut) {
+	writeUint64(w, uint64(txOut.Value))
+	writeVarBytes(w, txOut.PkScript)
+}
+
+// compactSize returns the CompactSize encoding of n.
+func compactSize(n int) []byte {
+	switch {
+	case n < 0xfd:
+		return []byte{byte(n)}
+	case n <= 0xffff:
+		return []byte{0xfd, byte(n), byte(n >> 8)}
+	case n <= 0xffffffff:
+		return []byte{0xfe, byte(n), byte(n >> 8), byte(n >> 16),
+			byte(n >> 24)}
+	}
+	return []byte{0xff, byte(n), byte(n >> 8), byte(n >> 16), byte(n >> 24),
+		byte(n >> 32), byte(n >> 40), byte(n >> 48), byte(n >> 56)}
+}
@@ -0,0 +1,467 @@
+package tapscript
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	taproot "github.com/christsim/bips/bip-0341"
+	"github.com/christsim/bips/internal/vectorfile"
+)
+
+// ErrVectorMismatch is returned by CheckVector and CheckLimitVector when
+// the package doesn't give the outcome a vector expects.
+var ErrVectorMismatch = errors.New("tapscript: vector mismatch")
+
+// SigHashVector is the signature hash of an input of a transaction, with
+// the signature message it hashes.
+type SigHashVector struct {
+	// Tx is the serialized transaction, without witnesses, and PrevOuts
+	// the outputs its inputs spend, each serialized as transactions
+	// serialize outputs.
+	Tx       []byte
+	PrevOuts [][]byte
+
+	Index    int
+	HashType HashType
+
+	// Annex is the annex of the input's witness, or nil.
+	Annex []byte
+
+	// LeafHash is the hash of the leaf of a script path spend, or nil
+	// for a key path spend, and CodeSepPos the code separator position
+	// signed along the script path.
+	LeafHash   []byte
+	CodeSepPos uint32
+
+	// SigMsg and SigHash are the signature message and its hash, which
+	// are nil if Err is set.
+	SigMsg  []byte
+	SigHash []byte
+	Err     error
+
+	// Comment describes what the vector exercises.
+	Comment string
+}
+
+// LimitVector is a witness checked with CheckLimits.
+type LimitVector struct {
+	Witness [][]byte
+
+	// SigOps is the number of signature checks running the script does,
+	// and Budget the validation weight budget of the witness.
+	SigOps int
+	Budget int64
+
+	// Err is the error CheckLimits fails with, or nil.
+	Err error
+
+	// Comment describes what the vector exercises.
+	Comment string
+}
+
+// parseTx parses the transaction and outputs of a vector.
+func (v *SigHashVector) parseTx() (*wire.MsgTx, []*wire.TxOut, error) {
+	tx := &wire.MsgTx{}
+	if err := tx.DeserializeNoWitness(bytes.NewReader(v.Tx)); err != nil {
+		return nil, nil, err
+	}
+	prevOuts := make([]*wire.TxOut, len(v.PrevOuts))
+	for i, b := range v.PrevOuts {
+		prevOut, err := parseTxOut(b)
+		if err != nil {
+			return nil, nil, fmt.Errorf("output spent by input "+
+				"%d: %v", i, err)
+		}
+		prevOuts[i] = prevOut
+	}
+	return tx, prevOuts, nil
+}
+
+// parseTxOut parses a serialized output.
+func parseTxOut(b []byte) (*wire.TxOut, error) {
+	if len(b) < 8 {
+		return nil, fmt.Errorf("invalid output %x", b)
+	}
+	r := bytes.NewReader(b[8:])
+	script, err := wire.ReadVarBytes(r, 0, uint32(len(b)), "pkScript")
+	if err != nil || r.Len() != 0 {
+		return nil, fmt.Errorf("invalid output %x", b)
+	}
+	value := int64(binary.LittleEndian.Uint64(b))
+	return wire.NewTxOut(value, script), nil
+}
+
+// serializeTxOut serializes an output.
+func serializeTxOut(txOut *wire.TxOut) []byte {
+	var b bytes.Buffer
+	writeTxOut(&b, txOut)
+	return b.Bytes()
+}
+
+// scriptPath returns the script path of the vector, or nil.
+func (v *SigHashVector) scriptPath() *ScriptPath {
+	if v.LeafHash == nil {
+		return nil
+	}
+	path := &ScriptPath{CodeSepPos: v.CodeSepPos}
+	copy(path.LeafHash[:], v.LeafHash)
+	return path
+}
+
+// newSigHashVector computes the vector of input i of the transaction.
+func newSigHashVector(tx *wire.MsgTx, prevOuts []*wire.TxOut, i int,
+	hashType HashType, annex []byte, path *ScriptPath) SigHashVector {
+
+	var b bytes.Buffer
+	if err := tx.SerializeNoWitness(&b); err != nil {
+		panic(err)
+	}
+	v := SigHashVector{
+		Tx:       b.Bytes(),
+		Index:    i,
+		HashType: hashType,
+		Annex:    annex,
+	}
+	for _, prevOut := range prevOuts {
+		v.PrevOuts = append(v.PrevOuts, serializeTxOut(prevOut))
+	}
+
+	spend := "key path"
+	if path != nil {
+		v.LeafHash = append([]byte(nil), path.LeafHash[:]...)
+		v.CodeSepPos = path.CodeSepPos
+		spend = "script path"
+	}
+	v.Comment = fmt.Sprintf("%v, %v, input %d of %d", hashType, spend, i,
+		len(tx.TxIn))
+	if annex != nil {
+		v.Comment += fmt.Sprintf(", %d byte annex", len(annex))
+	}
+
+	hashes, err := NewSigHashes(tx, prevOuts)
+	if err != nil {
+		panic(err)
+	}
+	v.SigMsg, v.Err = hashes.SigMsg(i, hashType, annex, path)
+	if v.Err == nil {
+		sigHash := hashSigMsg(v.SigMsg)
+		v.SigHash = sigHash[:]
+	}
+	return v
+}
+
+// randomKey returns a random x-only public key.
+func randomKey(rng *rand.Rand) []byte {
+	for {
+		var b [32]byte
+		rng.Read(b[:])
+		var d btcec.ModNScalar
+		if d.SetBytes(&b) != 0 || d.IsZero() {
+			continue
+		}
+		pubKey := btcec.PrivKeyFromScalar(&d).PubKey()
+		return pubKey.SerializeCompressed()[1:]
+	}
+}
+
+// randomBytes returns n random bytes.
+func randomBytes(rng *rand.Rand, n int) []byte {
+	b := make([]byte, n)
+	rng.Read(b)
+	return b
+}
+
+// randomPkScript returns a random output script: mostly a taproot output,
+// and otherwise a P2WPKH output or random bytes.
+func randomPkScript(rng *rand.Rand) []byte {
+	switch rng.Intn(4) {
+	case 0:
+		return append([]byte{0x00, 0x14}, randomBytes(rng, 20)...)
+	case 1:
+		return randomBytes(rng, rng.Intn(60))
+	}
+	return taproot.OutputScript(randomKey(rng))
+}
+
+// randomTx returns a random transaction of up to 5 inputs and 4 outputs,
+// and the outputs its inputs spend.
+func randomTx(rng *rand.Rand) (*wire.MsgTx, []*wire.TxOut) {
+	tx := wire.NewMsgTx(int32(rng.Uint32()))
+	if rng.Intn(2) == 0 {
+		tx.Version = 2
+	}
+	tx.LockTime = rng.Uint32()
+
+	var prevOuts []*wire.TxOut
+	for i := 1 + rng.Intn(5); i > 0; i-- {
+		var hash chainhash.Hash
+		rng.Read(hash[:])
+		txIn := wire.NewTxIn(wire.NewOutPoint(&hash, rng.Uint32()%4),
+			nil, nil)
+		txIn.Sequence = rng.Uint32()
+		tx.AddTxIn(txIn)
+		prevOuts = append(prevOuts, wire.NewTxOut(rng.Int63n(1e15),
+			randomPkScript(rng)))
+	}
+	for i := 1 + rng.Intn(4); i > 0; i-- {
+		tx.AddTxOut(wire.NewTxOut(rng.Int63n(1e15),
+			randomPkScript(rng)))
+	}
+	return tx, prevOuts
+}
+
+// randomAnnex returns a random annex, whose size takes more than a byte to
+// encode now and then.
+func randomAnnex(rng *rand.Rand) []byte {
+	size := rng.Intn(40)
+	if rng.Intn(4) == 0 {
+		size = 253 + rng.Intn(100)
+	}
+	return append([]byte{taproot.AnnexTag}, randomBytes(rng, size)...)
+}
+
+// randomScriptPath returns the script path of a random script, with or
+// without a code separator.
+func randomScriptPath(rng *rand.Rand) *ScriptPath {
+	script := append([]byte{0x20}, randomKey(rng)...)
+	codeSepPos := uint32(NoCodeSeparator)
+	if rng.Intn(2) == 0 {
+		script = append([]byte{0xab}, script...)
+		codeSepPos = 0
+	}
+	return NewScriptPath(append(script, 0xac), codeSepPos)
+}
+
+// RandomVectors returns vectors of count random transactions derived from a
+// math/rand source with the seed. Each transaction has a vector for every
+// valid sighash type of one of its inputs along the key path and along a
+// script path, each with and without an annex, and one for an invalid
+// sighash type. Inputs without an output of the same index give vectors
+// of SIGHASH_SINGLE that fail.
+func RandomVectors(rngSeed int64, count int) []SigHashVector {
+	rng := rand.New(rand.NewSource(rngSeed))
+	var vectors []SigHashVector
+	for n := 0; n < count; n++ {
+		tx, prevOuts := randomTx(rng)
+		i := rng.Intn(len(tx.TxIn))
+		annex := randomAnnex(rng)
+		path := randomScriptPath(rng)
+		for _, hashType := range HashTypes {
+			for _, p := range []*ScriptPath{nil, path} {
+				for _, a := range [][]byte{nil, annex} {
+					v := newSigHashVector(tx, prevOuts, i,
+						hashType, a, p)
+					vectors = append(vectors, v)
+				}
+			}
+		}
+
+		var invalid HashType
+		for invalid.IsValid() {
+			invalid = HashType(rng.Intn(256))
+		}
+		vectors = append(vectors, newSigHashVector(tx, prevOuts, i,
+			invalid, nil, nil))
+	}
+	return vectors
+}
+
+// CheckVector computes the signature message and hash of the vector's input
+// and checks them, or the error computing them fails with.
+func CheckVector(v SigHashVector) error {
+	tx, prevOuts, err := v.parseTx()
+	if err != nil {
+		return err
+	}
+	hashes, err := NewSigHashes(tx, prevOuts)
+	if err != nil {
+		return err
+	}
+	msg, err := hashes.SigMsg(v.Index, v.HashType, v.Annex, v.scriptPath())
+	switch {
+	case !vectorfile.SameError(err, v.Err):
+		return fmt.Errorf("%w: error %v, expected %v",
+			ErrVectorMismatch, err, v.Err)
+	case err != nil:
+		return nil
+	case !bytes.Equal(msg, v.SigMsg):
+		return fmt.Errorf("%w: signature message %x, expected %x",
+			ErrVectorMismatch, msg, v.SigMsg)
+	}
+	sigHash := hashSigMsg(msg)
+	if !bytes.Equal(sigHash[:], v.SigHash) {
+		return fmt.Errorf("%w: signature hash %x, expected %x",
+			ErrVectorMismatch, sigHash, v.SigHash)
+	}
+	return nil
+}
+
+// newLimitVector checks the witness with CheckLimits for the vector.
+func newLimitVector(witness [][]byte, sigOps int,
+	comment string) LimitVector {
+
+	return LimitVector{
+		Witness: witness,
+		SigOps:  sigOps,
+		Budget:  ValidationWeight(witness),
+		Err:     CheckLimits(witness, sigOps),
+		Comment: comment,
+	}
+}
+
+// scriptSpend returns the witness of a spend of the script, as the only
+// leaf of an output of a random internal key, with the stack and annex.
+func scriptSpend(rng *rand.Rand, version byte, script []byte,
+	stack [][]byte, annex []byte) [][]byte {
+
+	out, err := taproot.NewOutput(randomKey(rng),
+		taproot.NewLeaf(version, script))
+	if err != nil {
+		panic(err)
+	}
+	controlBlock, err := out.ControlBlock(0)
+	if err != nil {
+		panic(err)
+	}
+	witness := append(stack, script, controlBlock.Bytes())
+	if annex != nil {
+		witness = append(witness, annex)
+	}
+	return witness
+}
+
+// items returns n stack items of the size.
+func items(n, size int) [][]byte {
+	stack := make([][]byte, n)
+	for i := range stack {
+		stack[i] = make([]byte, size)
+	}
+	return stack
+}
+
+// oversized returns a stack past both the stack size and item size limits.
+func oversized() [][]byte {
+	stack := items(MaxStackSize+1, 0)
+	stack[0] = make([]byte, MaxElementSize+1)
+	return stack
+}
+
+// checkSigs returns a script checking a signature under each of n keys with
+// OP_CHECKSIGADD, the first with OP_CHECKSIG.
+func checkSigs(rng *rand.Rand, n int) []byte {
+	var script []byte
+	for i := 0; i < n; i++ {
+		script = append(script, 0x20)
+		script = append(script, randomKey(rng)...)
+		if i == 0 {
+			script = append(script, 0xac)
+		} else {
+			script = append(script, 0xba)
+		}
+	}
+	return script
+}
+
+// LimitVectors returns vectors of witnesses at and past the limits of
+// tapscript, followed by count random witnesses, derived from a math/rand
+// source with the seed, that check signatures near the budget.
+func LimitVectors(rngSeed int64, count int) []LimitVector {
+	rng := rand.New(rand.NewSource(rngSeed))
+	sig := make([]byte, 64)
+	success := []byte{0x50}
+
+	// Each signature adds 65 bytes to the witness and its key 34 to the
+	// script, so a script checking the signatures it's given stays well
+	// within its budget.
+	script := checkSigs(rng, 3)
+	witness := scriptSpend(rng, taproot.LeafVersionTapscript, script,
+		[][]byte{sig, sig, sig}, nil)
+	budget := ValidationWeight(witness)
+	fits := int(budget / SigOpWeight)
+
+	vectors := []LimitVector{
+		newLimitVector([][]byte{sig}, 1000, "key path spends have "+
+			"no limits"),
+		newLimitVector(witness, 3, "signature checks within the "+
+			"budget"),
+		newLimitVector(witness, fits, "signature checks using up "+
+			"the budget"),
+		newLimitVector(witness, fits+1, "one signature check past "+
+			"the budget"),
+		newLimitVector(scriptSpend(rng, taproot.LeafVersionTapscript,
+			script, [][]byte{sig, sig, sig},
+			append([]byte{taproot.AnnexTag},
+				make([]byte, SigOpWeight)...)),
+			fits+1, "an annex adding to the budget"),
+		newLimitVector(scriptSpend(rng, taproot.LeafVersionTapscript,
+			[]byte{0x51}, items(MaxStackSize, 0), nil), 0,
+			"initial stack at the size limit"),
+		newLimitVector(scriptSpend(rng, taproot.LeafVersionTapscript,
+			[]byte{0x51}, items(MaxStackSize+1, 0), nil), 0,
+			"initial stack past the size limit"),
+		newLimitVector(scriptSpend(rng, taproot.LeafVersionTapscript,
+			[]byte{0x51}, items(1, MaxElementSize), nil), 0,
+			"stack item at the size limit"),
+		newLimitVector(scriptSpend(rng, taproot.LeafVersionTapscript,
+			[]byte{0x51}, items(1, MaxElementSize+1), nil), 0,
+			"stack item past the size limit"),
+		newLimitVector(scriptSpend(rng, taproot.LeafVersionTapscript,
+			success, oversized(), nil),
+			1000, "OP_SUCCESS80 overriding the limits"),
+		newLimitVector(scriptSpend(rng, taproot.LeafVersionTapscript,
+			[]byte{0x4c, 0x05, 0x51, 0xfe}, nil, nil), 0,
+			"push past the end of the script"),
+		newLimitVector(scriptSpend(rng, taproot.LeafVersionTapscript,
+			[]byte{0x51, 0xbb, 0x4d, 0xff}, nil, nil), 0,
+			"OP_SUCCESS187 before a push past the end"),
+		newLimitVector(scriptSpend(rng, taproot.LeafVersionTapscript,
+			[]byte{0x03, 0x50, 0x62, 0x7e, 0x51}, nil, nil), 0,
+			"OP_SUCCESS opcodes pushed as data"),
+		newLimitVector(scriptSpend(rng, 0xc2, []byte{0x51}, oversized(),
+			nil), 1000,
+			"unknown leaf version without limits"),
+	}
+
+	for n := 0; n < count; n++ {
+		keys := 1 + rng.Intn(20)
+		stack := make([][]byte, keys)
+		for i := range stack {
+			if rng.Intn(3) != 0 {
+				stack[i] = sig
+			}
+		}
+		var annex []byte
+		if rng.Intn(4) == 0 {
+			annex = randomAnnex(rng)
+		}
+		witness := scriptSpend(rng, taproot.LeafVersionTapscript,
+			checkSigs(rng, keys), stack, annex)
+		sigOps := int(ValidationWeight(witness)/SigOpWeight) - 2 +
+			rng.Intn(5)
+		vectors = append(vectors, newLimitVector(witness, sigOps,
+			fmt.Sprintf("%d signature checks of %d keys", sigOps,
+				keys)))
+	}
+	return vectors
+}
+
+// CheckLimitVector checks the vector's witness with CheckLimits, and its
+// budget.
+func CheckLimitVector(v LimitVector) error {
+	if budget := ValidationWeight(v.Witness); budget != v.Budget {
+		return fmt.Errorf("%w: budget %d, expected %d",
+			ErrVectorMismatch, budget, v.Budget)
+	}
+	err := CheckLimits(v.Witness, v.SigOps)
+	if !vectorfile.SameError(err, v.Err) {
+		return fmt.Errorf("%w: error %v, expected %v",
+			ErrVectorMismatch, err, v.Err)
+	}
+	return nil
+}
@@ -0,0 +1,477 @@
+// This program writes test vectors for the silentpayments package to
+// send_and_receive_test_vectors.json, in the JSON layout of the BIP 352
+// vectors: the cases of the BIP, the first with its own keys and outpoints
+// and the others with keys derived from -seed, followed by random
+// transactions. The vectors depend only on -seed and -count, so they can be
+// regenerated by anyone:
+//
+//	gentestvectors -count 30 -seed 352
+//
+// Each vector gives the inputs a sender spends, with their secret keys, and
+// the recipients it pays, and lists the x-only keys of the outputs it
+// derives. It then gives the transaction's outputs and the keys and labels
+// of each receiver scanning it, and lists the receiver's addresses, the
+// tweak and shared secret of the transaction, and the outputs it finds,
+// each with the tweak of its secret key and a signature made with the key.
+// The case of the BIP paying more than K_max outputs to one receiver, which
+// takes thousands of outputs, is left out. Pass -check to verify an
+// existing file against the package instead, which reads the BIP's own file
+// too:
+//
+//	gentestvectors -check send_and_receive_test_vectors.json
+//
+// The program lives in a directory of its own since the silentpayments
+// package sits at the root of the module.
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	silentpayments "github.com/christsim/bips/bip-0352"
+)
+
+// vectorJSON is a vector of the BIP's file, which is a list of them.
+type vectorJSON struct {
+	Comment   string          `json:"comment"`
+	Sending   []sendingJSON   `json:"sending"`
+	Receiving []receivingJSON `json:"receiving"`
+}
+
+// vinJSON is an input of a transaction, with the private key of the output
+// it spends for senders.
+type vinJSON struct {
+	TxID        string `json:"txid"`
+	Vout        uint32 `json:"vout"`
+	ScriptSig   string `json:"scriptSig"`
+	TxInWitness string `json:"txinwitness"`
+	Prevout     struct {
+		ScriptPubKey struct {
+			Hex string `json:"hex"`
+		} `json:"scriptPubKey"`
+	} `json:"prevout"`
+	PrivateKey string `json:"private_key,omitempty"`
+}
+
+// sendingJSON is a transaction a sender builds.
+type sendingJSON struct {
+	Given struct {
+		Vin []vinJSON `json:"vin"`
+
+		// Recipients are addresses. Older versions of the file give
+		// them as an address and an amount, which are read too.
+		Recipients []json.RawMessage `json:"recipients"`
+	} `json:"given"`
+	Expected struct {
+		Outputs [][]string `json:"outputs"`
+	} `json:"expected"`
+}
+
+// receivingJSON is a transaction a receiver scans.
+type receivingJSON struct {
+	Given struct {
+		Vin         []vinJSON `json:"vin"`
+		Outputs     []string  `json:"outputs"`
+		KeyMaterial struct {
+			SpendPrivKey string `json:"spend_priv_key"`
+			ScanPrivKey  string `json:"scan_priv_key"`
+		} `json:"key_material"`
+		Labels []uint32 `json:"labels"`
+	} `json:"given"`
+	Expected struct {
+		Addresses    []string    `json:"addresses"`
+		Outputs      []foundJSON `json:"outputs"`
+		Tweak        string      `json:"tweak,omitempty"`
+		SharedSecret string      `json:"shared_secret,omitempty"`
+		NOutputs     int         `json:"n_outputs,omitempty"`
+	} `json:"expected"`
+}
+
+// foundJSON is an output a receiver finds.
+type foundJSON struct {
+	PubKey       string `json:"pub_key"`
+	PrivKeyTweak string `json:"priv_key_tweak"`
+	Signature    string `json:"signature"`
+}
+
+func main() {
+	out := flag.String("out", "send_and_receive_test_vectors.json",
+		"file to write the vectors to")
+	count := flag.Int("count", 30, "number of random transactions to "+
+		"write after the cases of the BIP")
+	seed := flag.Int64("seed", 352, "seed of the vectors")
+	check := flag.String("check", "", "vector file to check instead of "+
+		"writing one")
+	flag.Parse()
+
+	var err error
+	if *check != "" {
+		err = checkFile(*check)
+	} else {
+		err = writeFile(*out, *seed, *count)
+	}
+	if err != nil {
+		fmt.Println("Error: ", err.Error())
+		os.Exit(1)
+	}
+}
+
+// encodeInputs encodes the inputs, with the secret keys if there are any.
+func encodeInputs(inputs []silentpayments.Input, secKeys [][]byte) (
+	[]vinJSON, error) {
+
+	vin := make([]vinJSON, len(inputs))
+	for i, in := range inputs {
+		vin[i].TxID = in.OutPoint.Hash.String()
+		vin[i].Vout = in.OutPoint.Index
+		vin[i].ScriptSig = hex.EncodeToString(in.ScriptSig)
+		if len(in.Witness) > 0 {
+			var b bytes.Buffer
+			if err := wire.WriteVarInt(&b, 0,
+				uint64(len(in.Witness))); err != nil {
+
+				return nil, err
+			}
+			for _, item := range in.Witness {
+				if err := wire.WriteVarBytes(&b, 0,
+					item); err != nil {
+
+					return nil, err
+				}
+			}
+			vin[i].TxInWitness = hex.EncodeToString(b.Bytes())
+		}
+		vin[i].Prevout.ScriptPubKey.Hex = hex.EncodeToString(
+			in.PrevScript)
+		if secKeys != nil {
+			vin[i].PrivateKey = hex.EncodeToString(secKeys[i])
+		}
+	}
+	return vin, nil
+}
+
+// encodeKeys encodes a list of keys in hex.
+func encodeKeys(keys [][]byte) []string {
+	s := []string{}
+	for _, key := range keys {
+		s = append(s, hex.EncodeToString(key))
+	}
+	return s
+}
+
+// encodeVector encodes a vector in the layout of the BIP's file.
+func encodeVector(v silentpayments.Vector) (vectorJSON, error) {
+	vj := vectorJSON{Comment: v.Comment}
+	for _, s := range v.Sending {
+		var sj sendingJSON
+		var err error
+		if sj.Given.Vin, err = encodeInputs(s.Inputs,
+			s.SecKeys); err != nil {
+
+			return vj, err
+		}
+		for _, r := range s.Recipients {
+			recipient, err := json.Marshal(r)
+			if err != nil {
+				return vj, err
+			}
+			sj.Given.Recipients = append(sj.Given.Recipients,
+				recipient)
+		}
+		for _, outputs := range s.Outputs {
+			sj.Expected.Outputs = append(sj.Expected.Outputs,
+				encodeKeys(outputs))
+		}
+		vj.Sending = append(vj.Sending, sj)
+	}
+
+	for _, r := range v.Receiving {
+		var rj receivingJSON
+		var err error
+		if rj.Given.Vin, err = encodeInputs(r.Inputs, nil); err != nil {
+			return vj, err
+		}
+		rj.Given.Outputs = encodeKeys(r.Outputs)
+		rj.Given.KeyMaterial.SpendPrivKey = hex.EncodeToString(
+			r.SpendSecKey)
+		rj.Given.KeyMaterial.ScanPrivKey = hex.EncodeToString(
+			r.ScanSecKey)
+		rj.Given.Labels = append([]uint32{}, r.Labels...)
+
+		rj.Expected.Addresses = r.Addresses
+		rj.Expected.Outputs = []foundJSON{}
+		for _, f := range r.Found {
+			rj.Expected.Outputs = append(rj.Expected.Outputs,
+				foundJSON{
+					PubKey: hex.EncodeToString(f.PubKey),
+					PrivKeyTweak: hex.EncodeToString(
+						f.Tweak),
+					Signature: hex.EncodeToString(
+						f.Signature),
+				})
+		}
+		rj.Expected.Tweak = hex.EncodeToString(r.Tweak)
+		rj.Expected.SharedSecret = hex.EncodeToString(r.SharedSecret)
+		rj.Expected.NOutputs = r.NOutputs
+		vj.Receiving = append(vj.Receiving, rj)
+	}
+	return vj, nil
+}
+
+// writeFile writes the vectors of the BIP's cases and count random
+// transactions to out.
+func writeFile(out string, seed int64, count int) error {
+	vectors := silentpayments.Vectors(seed, count)
+	file := make([]vectorJSON, len(vectors))
+	for i, v := range vectors {
+		var err error
+		if file[i], err = encodeVector(v); err != nil {
+			return err
+		}
+	}
+
+	data, err := json.MarshalIndent(file, "", "    ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(out, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote %d vectors\n", len(vectors))
+	return nil
+}
+
+// decodeInputs decodes the inputs, and the secret keys of those that have
+// one.
+func decodeInputs(vin []vinJSON) ([]silentpayments.Input, [][]byte,
+	error) {
+
+	inputs := make([]silentpayments.Input, len(vin))
+	secKeys := make([][]byte, len(vin))
+	for i, vj := range vin {
+		in := &inputs[i]
+		hash, err := chainhash.NewHashFromStr(vj.TxID)
+		if err != nil {
+			return nil, nil, err
+		}
+		in.OutPoint = wire.OutPoint{Hash: *hash, Index: vj.Vout}
+		if in.ScriptSig, err = hex.DecodeString(
+			vj.ScriptSig); err != nil {
+
+			return nil, nil, err
+		}
+		witness, err := hex.DecodeString(vj.TxInWitness)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(witness) > 0 {
+			if in.Witness, err = decodeWitness(
+				witness); err != nil {
+
+				return nil, nil, err
+			}
+		}
+		if in.PrevScript, err = hex.DecodeString(
+			vj.Prevout.ScriptPubKey.Hex); err != nil {
+
+			return nil, nil, err
+		}
+		if vj.PrivateKey != "" {
+			if secKeys[i], err = hex.DecodeString(
+				vj.PrivateKey); err != nil {
+
+				return nil, nil, err
+			}
+		}
+	}
+	return inputs, secKeys, nil
+}
+
+// decodeWitness decodes a serialized witness: its number of items followed
+// by each with its size.
+func decodeWitness(b []byte) (wire.TxWitness, error) {
+	r := bytes.NewReader(b)
+	n, err := wire.ReadVarInt(r, 0)
+	if err != nil {
+		return nil, err
+	}
+	var witness wire.TxWitness
+	for ; n > 0; n-- {
+		item, err := wire.ReadVarBytes(r, 0, wire.MaxMessagePayload,
+			"witness item")
+		if err != nil {
+			return nil, err
+		}
+		witness = append(witness, item)
+	}
+	if r.Len() > 0 {
+		return nil, fmt.Errorf("%d bytes after the witness", r.Len())
+	}
+	return witness, nil
+}
+
+// decodeKeys decodes a list of keys in hex.
+func decodeKeys(s []string) ([][]byte, error) {
+	keys := [][]byte{}
+	for _, k := range s {
+		key, err := hex.DecodeString(k)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// decodeRecipient decodes a recipient, an address or an address and an
+// amount.
+func decodeRecipient(data json.RawMessage) (string, error) {
+	var addr string
+	if err := json.Unmarshal(data, &addr); err == nil {
+		return addr, nil
+	}
+	var pair []json.RawMessage
+	if err := json.Unmarshal(data, &pair); err != nil {
+		return "", err
+	}
+	if len(pair) == 0 {
+		return "", fmt.Errorf("empty recipient")
+	}
+	err := json.Unmarshal(pair[0], &addr)
+	return addr, err
+}
+
+// decodeSending decodes a transaction a sender builds.
+func decodeSending(sj *sendingJSON) (silentpayments.SendVector, error) {
+	var s silentpayments.SendVector
+	var err error
+	if s.Inputs, s.SecKeys, err = decodeInputs(sj.Given.Vin); err != nil {
+		return s, err
+	}
+	for _, data := range sj.Given.Recipients {
+		addr, err := decodeRecipient(data)
+		if err != nil {
+			return s, err
+		}
+		s.Recipients = append(s.Recipients, addr)
+	}
+	for _, outputs := range sj.Expected.Outputs {
+		keys, err := decodeKeys(outputs)
+		if err != nil {
+			return s, err
+		}
+		s.Outputs = append(s.Outputs, keys)
+	}
+	return s, nil
+}
+
+// decodeReceiving decodes a transaction a receiver scans.
+func decodeReceiving(rj *receivingJSON) (silentpayments.ReceiveVector,
+	error) {
+
+	var r silentpayments.ReceiveVector
+	var err error
+	if r.Inputs, _, err = decodeInputs(rj.Given.Vin); err != nil {
+		return r, err
+	}
+	if r.Outputs, err = decodeKeys(rj.Given.Outputs); err != nil {
+		return r, err
+	}
+	if r.ScanSecKey, err = hex.DecodeString(
+		rj.Given.KeyMaterial.ScanPrivKey); err != nil {
+
+		return r, err
+	}
+	if r.SpendSecKey, err = hex.DecodeString(
+		rj.Given.KeyMaterial.SpendPrivKey); err != nil {
+
+		return r, err
+	}
+	r.Labels = rj.Given.Labels
+	r.Addresses = rj.Expected.Addresses
+
+	for _, fj := range rj.Expected.Outputs {
+		var f silentpayments.FoundVector
+		if f.PubKey, err = hex.DecodeString(fj.PubKey); err != nil {
+			return r, err
+		}
+		if f.Tweak, err = hex.DecodeString(
+			fj.PrivKeyTweak); err != nil {
+
+			return r, err
+		}
+		if f.Signature, err = hex.DecodeString(
+			fj.Signature); err != nil {
+
+			return r, err
+		}
+		r.Found = append(r.Found, f)
+	}
+	if r.Tweak, err = hex.DecodeString(rj.Expected.Tweak); err != nil {
+		return r, err
+	}
+	if r.SharedSecret, err = hex.DecodeString(
+		rj.Expected.SharedSecret); err != nil {
+
+		return r, err
+	}
+	if len(r.Tweak) == 0 {
+		r.Tweak, r.SharedSecret = nil, nil
+	}
+	if rj.Expected.NOutputs != len(r.Found) {
+		r.NOutputs = rj.Expected.NOutputs
+	}
+	return r, nil
+}
+
+// decodeVector decodes a vector of the BIP's file.
+func decodeVector(vj *vectorJSON) (silentpayments.Vector, error) {
+	v := silentpayments.Vector{Comment: vj.Comment}
+	for i := range vj.Sending {
+		s, err := decodeSending(&vj.Sending[i])
+		if err != nil {
+			return v, fmt.Errorf("sending %d: %v", i, err)
+		}
+		v.Sending = append(v.Sending, s)
+	}
+	for i := range vj.Receiving {
+		r, err := decodeReceiving(&vj.Receiving[i])
+		if err != nil {
+			return v, fmt.Errorf("receiving %d: %v", i, err)
+		}
+		v.Receiving = append(v.Receiving, r)
+	}
+	return v, nil
+}
+
+// checkFile checks each vector of the file with
+// silentpayments.CheckVector.
+func checkFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var file []vectorJSON
+	if err := json.Unmarshal(data, &file); err != nil {
+		return err
+	}
+	for i := range file {
+		v, err := decodeVector(&file[i])
+		if err != nil {
+			return fmt.Errorf("vector %d: %v", i, err)
+		}
+		if err := silentpayments.CheckVector(v); err != nil {
+			return fmt.Errorf("vector %d (%v): %v", i, v.Comment,
+				err)
+		}
+	}
+	fmt.Printf("%d vectors OK\n", len(file))
+	return nil
+}
@@ -0,0 +1,244 @@
+package silentpayments
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/wire"
+	bech32 "github.com/christsim/bips/bip-0173"
+	"golang.org/x/crypto/ripemd160"
+)
+
+var (
+	// ErrNoEligibleInputs is returned for a transaction none of whose
+	// inputs has a public key the shared secret can be derived from.
+	ErrNoEligibleInputs = errors.New("silentpayments: no eligible inputs")
+
+	// ErrFutureSegwit is returned for a transaction spending an output of
+	// a segwit version past 1, which later versions of the BIP may derive
+	// the shared secret from in other ways.
+	ErrFutureSegwit = errors.New("silentpayments: input of a segwit " +
+		"version past 1")
+
+	// ErrZeroSum is returned when the keys of the eligible inputs sum to
+	// zero, which leaves no shared secret.
+	ErrZeroSum = errors.New("silentpayments: input keys sum to zero")
+)
+
+// numsKey is the x-only key H of BIP 341, whose discrete logarithm nobody
+// knows. Script path spends with it as their internal key have no key the
+// sender could use, and are skipped.
+var numsKey, _ = hex.DecodeString("50929b74c1a04954b78b4b6035e97a5e" +
+	"078a5a0f28ec96d547bfee9ace803ac0")
+
+// annexTag is the first byte of the annex of a taproot witness.
+const annexTag = 0x50
+
+// Input is an input of a transaction, with the script of the output it
+// spends.
+type Input struct {
+	OutPoint   wire.OutPoint
+	ScriptSig  []byte
+	Witness    wire.TxWitness
+	PrevScript []byte
+}
+
+// hash160 returns the RIPEMD160 of the SHA256 of data.
+func hash160(data []byte) []byte {
+	sha := sha256.Sum256(data)
+	h := ripemd160.New()
+	h.Write(sha[:])
+	return h.Sum(nil)
+}
+
+// isCompressedKey reports whether the key is a compressed point of the
+// curve.
+func isCompressedKey(key []byte) bool {
+	if len(key) != PubKeySize || key[0] != 0x02 && key[0] != 0x03 {
+		return false
+	}
+	_, err := btcec.ParsePubKey(key)
+	return err == nil
+}
+
+// isPubKeyHashScript reports whether the script is a P2PKH script.
+func isPubKeyHashScript(script []byte) bool {
+	return len(script) == 25 && script[0] == 0x76 && script[1] == 0xa9 &&
+		script[2] == 0x14 && script[23] == 0x88 && script[24] == 0xac
+}
+
+// isScriptHashScript reports whether the script is a P2SH script.
+func isScriptHashScript(script []byte) bool {
+	return len(script) == 23 && script[0] == 0xa9 && script[1] == 0x14 &&
+		script[22] == 0x87
+}
+
+// witnessKey returns the last item of the witness of a P2WPKH spend, if
+// it's a compressed key.
+func witnessKey(witness wire.TxWitness) ([]byte, bool) {
+	if len(witness) == 0 || !isCompressedKey(witness[len(witness)-1]) {
+		return nil, false
+	}
+	return witness[len(witness)-1], true
+}
+
+// pubKeyHashKey returns the compressed key of the scriptSig of a P2PKH
+// spend whose hash is the one of the script. As the scriptSig may be
+// malleated, every 33 bytes preceded by another are tried, from the end.
+func pubKeyHashKey(scriptSig, hash []byte) ([]byte, bool) {
+	for i := len(scriptSig); i > PubKeySize; i-- {
+		key := scriptSig[i-PubKeySize : i]
+		if bytes.Equal(hash160(key), hash) && isCompressedKey(key) {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+// taprootKey returns the output key of a P2TR spend, with an even y, unless
+// it spends a script whose internal key is H.
+func taprootKey(witness wire.TxWitness, outputKey []byte) ([]byte, bool) {
+	if n := len(witness); n > 1 && len(witness[n-1]) > 0 &&
+		witness[n-1][0] == annexTag {
+
+		witness = witness[:n-1]
+	}
+	if n := len(witness); n > 1 {
+		controlBlock := witness[n-1]
+		if len(controlBlock) >= 1+OutputKeySize &&
+			bytes.Equal(controlBlock[1:1+OutputKeySize], numsKey) {
+
+			return nil, false
+		}
+	}
+	if _, err := liftX(outputKey); err != nil {
+		return nil, false
+	}
+	return append([]byte{0x02}, outputKey...), true
+}
+
+// InputPubKey returns the compressed public key of an input the shared
+// secret is derived from, and false for an input that isn't eligible. The
+// eligible inputs spend P2TR outputs, other than script path spends with H
+// as their internal key, whose key is the output key with an even y, and
+// P2WPKH, P2SH-P2WPKH and P2PKH outputs of compressed keys.
+func InputPubKey(in Input) ([]byte, bool) {
+	version, program, isWitness := bech32.ParseWitnessScript(in.PrevScript)
+	switch {
+	case isWitness && version == 1 && len(program) == OutputKeySize:
+		return taprootKey(in.Witness, program)
+	case isWitness && version == 0 && len(program) == 20:
+		return witnessKey(in.Witness)
+	case isScriptHashScript(in.PrevScript):
+		if len(in.ScriptSig) != 23 || in.ScriptSig[1] != 0x00 ||
+			in.ScriptSig[2] != 0x14 {
+
+			return nil, false
+		}
+		return witnessKey(in.Witness)
+	case isPubKeyHashScript(in.PrevScript):
+		return pubKeyHashKey(in.ScriptSig, in.PrevScript[3:23])
+	}
+	return nil, false
+}
+
+// isFutureSegwit reports whether the input spends an output of a segwit
+// version past 1.
+func isFutureSegwit(in Input) bool {
+	version, _, isWitness := bech32.ParseWitnessScript(in.PrevScript)
+	return isWitness && version > 1
+}
+
+// serializeOutPoint returns the serialization of an outpoint: its txid in
+// the byte order of transactions, and its index in little endian.
+func serializeOutPoint(op wire.OutPoint) []byte {
+	b := append(make([]byte, 0, len(op.Hash)+4), op.Hash[:]...)
+	return binary.LittleEndian.AppendUint32(b, op.Index)
+}
+
+// smallestOutPoint returns the serialization of the lexicographically
+// smallest outpoint of the inputs, eligible or not.
+func smallestOutPoint(inputs []Input) []byte {
+	var smallest []byte
+	for _, in := range inputs {
+		op := serializeOutPoint(in.OutPoint)
+		if smallest == nil || bytes.Compare(op, smallest) < 0 {
+			smallest = op
+		}
+	}
+	return smallest
+}
+
+// inputHash returns the input hash of the inputs whose keys sum to A:
+//
+//	hashBIP0352/Inputs(outpoint_L || serP(A))
+func inputHash(inputs []Input, sum btcec.JacobianPoint) (btcec.ModNScalar,
+	error) {
+
+	return hashScalar(taggedHash(tagInputs, smallestOutPoint(inputs),
+		serializePoint(sum)))
+}
+
+// checkInputs checks that the transaction of the inputs is eligible for
+// silent payments, and returns which of its inputs are.
+func checkInputs(inputs []Input) ([][]byte, error) {
+	keys := make([][]byte, len(inputs))
+	var eligible bool
+	for i, in := range inputs {
+		if isFutureSegwit(in) {
+			return nil, ErrFutureSegwit
+		}
+		keys[i], _ = InputPubKey(in)
+		eligible = eligible || keys[i] != nil
+	}
+	if !eligible {
+		return nil, ErrNoEligibleInputs
+	}
+	return keys, nil
+}
+
+// sumInputKeys returns A, the sum of the public keys of the eligible inputs.
+func sumInputKeys(inputs []Input) (btcec.JacobianPoint, error) {
+	var sum btcec.JacobianPoint
+	keys, err := checkInputs(inputs)
+	if err != nil {
+		return sum, err
+	}
+	for _, key := range keys {
+		if key == nil {
+			continue
+		}
+		p, err := parsePubKey(key)
+		if err != nil {
+			return sum, err
+		}
+		prev := sum
+		btcec.AddNonConst(&prev, &p, &sum)
+	}
+	if isInfinity(&sum) {
+		return sum, ErrZeroSum
+	}
+	return sum, nil
+}
+
+// TweakData returns the tweak of the transaction of the inputs, the input
+// hash times A, which the receiver multiplies with its scan key for the
+// shared secret. Index servers publish it for the transactions of each
+// block, so that light clients scan without the inputs.
+func TweakData(inputs []Input) ([]byte, error) {
+	sum, err := sumInputKeys(inputs)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := inputHash(inputs, sum)
+	if err != nil {
+		return nil, err
+	}
+	var tweak btcec.JacobianPoint
+	btcec.ScalarMultNonConst(&hash, &sum, &tweak)
+	return serializePoint(tweak), nil
+}
@@ -0,0 +1,281 @@
+package silentpayments
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/christsim/bips/bip-0158/gcs"
+	bech32 "github.com/christsim/bips/bip-0173"
+)
+
+var (
+	// ErrMissingPrevOut is returned by TxInputs when the output an input
+	// spends can't be fetched.
+	ErrMissingPrevOut = errors.New("silentpayments: missing previous " +
+		"output")
+
+	// ErrInvalidRange is returned by Rescan when the start height is
+	// above the end height.
+	ErrInvalidRange = errors.New("silentpayments: invalid rescan range")
+)
+
+// FilterSource provides the BIP 158 basic filters a rescan matches, as the
+// FilterSource of the rescan package of the bip-0158 module does, which
+// *filterdb.Source and *lightclient.Client satisfy.
+type FilterSource interface {
+	// Filter returns the filter of the block at the passed height along
+	// with the block's hash. A nil filter is treated as empty.
+	Filter(height uint32) (*gcs.Filter, *chainhash.Hash, error)
+}
+
+// BlockSource provides the blocks whose filters match, as the BlockSource
+// of the rescan package of the bip-0158 module does.
+type BlockSource interface {
+	// GetBlock returns the block with the passed hash.
+	GetBlock(blockHash *chainhash.Hash) (*wire.MsgBlock, error)
+}
+
+// TweakSource provides the tweaks of the transactions of each block that may
+// pay silent payments, such as an index server publishing them for light
+// clients, or BlockTweakSource computing them.
+type TweakSource interface {
+	// Tweaks returns the tweaks of the block with the hash at the height,
+	// in any order.
+	Tweaks(height uint32, blockHash *chainhash.Hash) ([][]byte, error)
+}
+
+// hasTaprootOutput reports whether the transaction has a P2TR output, which
+// a transaction must have to pay a silent payment.
+func hasTaprootOutput(tx *wire.MsgTx) bool {
+	for _, txOut := range tx.TxOut {
+		version, program, ok := bech32.ParseWitnessScript(txOut.PkScript)
+		if ok && version == 1 && len(program) == OutputKeySize {
+			return true
+		}
+	}
+	return false
+}
+
+// TxInputs returns the inputs of a transaction along with the scripts of the
+// outputs they spend, fetched from prevOuts.
+func TxInputs(tx *wire.MsgTx,
+	prevOuts txscript.PrevOutputFetcher) ([]Input, error) {
+
+	inputs := make([]Input, 0, len(tx.TxIn))
+	for _, txIn := range tx.TxIn {
+		prevOut := prevOuts.FetchPrevOutput(txIn.PreviousOutPoint)
+		if prevOut == nil {
+			return nil, fmt.Errorf("%w: %v", ErrMissingPrevOut,
+				txIn.PreviousOutPoint)
+		}
+		inputs = append(inputs, Input{
+			OutPoint:   txIn.PreviousOutPoint,
+			ScriptSig:  txIn.SignatureScript,
+			Witness:    txIn.Witness,
+			PrevScript: prevOut.PkScript,
+		})
+	}
+	return inputs, nil
+}
+
+// BlockTweaks returns the tweaks of the transactions of a block that may pay
+// silent payments, in block order: those other than the coinbase with a P2TR
+// output and inputs the shared secret can be derived from. This is what an
+// index server publishes for the block.
+func BlockTweaks(block *wire.MsgBlock,
+	prevOuts txscript.PrevOutputFetcher) ([][]byte, error) {
+
+	var tweaks [][]byte
+	for i, tx := range block.Transactions {
+		if i == 0 || !hasTaprootOutput(tx) {
+			continue
+		}
+		inputs, err := TxInputs(tx, prevOuts)
+		if err != nil {
+			return nil, err
+		}
+		tweak, err := TweakData(inputs)
+		switch {
+		case errors.Is(err, ErrNoEligibleInputs),
+			errors.Is(err, ErrFutureSegwit), errors.Is(err, ErrZeroSum):
+			continue
+		case err != nil:
+			return nil, err
+		}
+		tweaks = append(tweaks, tweak)
+	}
+	return tweaks, nil
+}
+
+// BlockTweakSource computes the tweaks of each block with BlockTweaks, for a
+// node that has the blocks and the outputs they spend, such as one serving
+// them to light clients.
+type BlockTweakSource struct {
+	Blocks   BlockSource
+	PrevOuts txscript.PrevOutputFetcher
+}
+
+// Tweaks returns the tweaks of the block with the hash.
+func (s *BlockTweakSource) Tweaks(_ uint32,
+	blockHash *chainhash.Hash) ([][]byte, error) {
+
+	block, err := s.Blocks.GetBlock(blockHash)
+	if err != nil {
+		return nil, err
+	}
+	return BlockTweaks(block, s.PrevOuts)
+}
+
+// RescanConfig holds the parameters of a silent payments rescan.
+type RescanConfig struct {
+	// ScanSecKey and SpendKey are the scan secret key and the spend
+	// public key of the receiver, and Labels the numbers of the labels
+	// it scans for.
+	ScanSecKey []byte
+	SpendKey   []byte
+	Labels     []uint32
+
+	// Filters provides the BIP 158 basic filter of each block, Tweaks the
+	// tweaks of its transactions, and Blocks the blocks whose filters
+	// match.
+	Filters FilterSource
+	Tweaks  TweakSource
+	Blocks  BlockSource
+
+	// StartHeight and EndHeight are the first and last block heights to
+	// scan, inclusive.
+	StartHeight uint32
+	EndHeight   uint32
+}
+
+// Payment is an output paying the receiver found by a rescan.
+type Payment struct {
+	FoundOutput
+
+	OutPoint  wire.OutPoint
+	Value     int64
+	BlockHash chainhash.Hash
+	Height    uint32
+}
+
+// taprootOutput is a P2TR output of a block.
+type taprootOutput struct {
+	outPoint wire.OutPoint
+	value    int64
+}
+
+// Rescan finds the outputs paying the receiver in a range of blocks, as
+// light clients of the BIP do. For each block, it derives the scripts of
+// FilterScripts from the tweaks of the block, and fetches the block only if
+// its filter matches them. Every output of a payment is found, since each
+// has the output of t_0 alongside. Blocks without tweaks aren't matched.
+func Rescan(cfg *RescanConfig) ([]Payment, error) {
+	if cfg.StartHeight > cfg.EndHeight {
+		return nil, ErrInvalidRange
+	}
+
+	var payments []Payment
+	for height := cfg.StartHeight; ; height++ {
+		found, err := rescanBlock(cfg, height)
+		if err != nil {
+			return nil, err
+		}
+		payments = append(payments, found...)
+
+		// Guard against wrapping around when scanning up to the
+		// highest possible height.
+		if height == cfg.EndHeight {
+			break
+		}
+	}
+	return payments, nil
+}
+
+// rescanBlock returns the payments to the receiver in the block at height.
+func rescanBlock(cfg *RescanConfig, height uint32) ([]Payment, error) {
+	filter, blockHash, err := cfg.Filters.Filter(height)
+	if err != nil || filter == nil {
+		return nil, err
+	}
+	tweaks, err := cfg.Tweaks.Tweaks(height, blockHash)
+	if err != nil || len(tweaks) == 0 {
+		return nil, err
+	}
+
+	// The scripts of each tweak are kept apart, so that only the tweaks
+	// whose scripts the block pays to are scanned for in full.
+	var scripts [][]byte
+	tweakScripts := make([][][]byte, len(tweaks))
+	for i, tweak := range tweaks {
+		tweakScripts[i], err = FilterScripts(cfg.ScanSecKey, cfg.SpendKey,
+			cfg.Labels, [][]byte{tweak})
+		if err != nil {
+			return nil, err
+		}
+		scripts = append(scripts, tweakScripts[i]...)
+	}
+	match, err := MatchFilter(filter, blockHash, scripts)
+	if err != nil || !match {
+		return nil, err
+	}
+
+	block, err := cfg.Blocks.GetBlock(blockHash)
+	if err != nil {
+		return nil, err
+	}
+	outputs := make(map[string]taprootOutput)
+	var outputKeys [][]byte
+	for _, tx := range block.Transactions {
+		txHash := tx.TxHash()
+		for i, txOut := range tx.TxOut {
+			version, program, ok := bech32.ParseWitnessScript(
+				txOut.PkScript)
+			if !ok || version != 1 || len(program) != OutputKeySize {
+				continue
+			}
+			outputs[string(txOut.PkScript)] = taprootOutput{
+				outPoint: wire.OutPoint{
+					Hash: txHash, Index: uint32(i),
+				},
+				value: txOut.Value,
+			}
+			outputKeys = append(outputKeys, program)
+		}
+	}
+
+	// Filter matches may be false positives, in which case no tweak's
+	// scripts are in the block and nothing is found.
+	var payments []Payment
+	for i, tweak := range tweaks {
+		paid := false
+		for _, script := range tweakScripts[i] {
+			if _, ok := outputs[string(script)]; ok {
+				paid = true
+				break
+			}
+		}
+		if !paid {
+			continue
+		}
+
+		found, err := Scan(cfg.ScanSecKey, cfg.SpendKey, cfg.Labels,
+			tweak, outputKeys)
+		if err != nil {
+			return nil, err
+		}
+		for _, out := range found {
+			output := outputs[string(taprootScript(out.OutputKey))]
+			payments = append(payments, Payment{
+				FoundOutput: out,
+				OutPoint:    output.outPoint,
+				Value:       output.value,
+				BlockHash:   *blockHash,
+				Height:      height,
+			})
+		}
+	}
+	return payments, nil
+}
@@ -0,0 +1,254 @@
+package silentpayments
+
+import (
+	"bytes"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/christsim/bips/bip-0158/gcs"
+)
+
+// FoundOutput is an output of a transaction that pays to the receiver.
+type FoundOutput struct {
+	// OutputKey is the x-only key of the output.
+	OutputKey []byte
+
+	// Tweak is what the receiver adds to its spend secret key for the
+	// secret key of the output: t_k, plus the tweak of the label the
+	// output pays to if it does.
+	Tweak []byte
+
+	// Label is the number of the label the output pays to, if Labelled.
+	Labelled bool
+	Label    uint32
+}
+
+// labelKey is a label that Scan looks for.
+type labelKey struct {
+	m     uint32
+	tweak btcec.ModNScalar
+}
+
+// labelKeys returns the labels of the numbers, by the compressed encoding of
+// their tweak times the generator.
+func labelKeys(scanSecKey []byte, labels []uint32) (map[string]labelKey,
+	error) {
+
+	keys := make(map[string]labelKey, len(labels))
+	for _, m := range labels {
+		t, err := labelScalar(scanSecKey, m)
+		if err != nil {
+			return nil, err
+		}
+		var p btcec.JacobianPoint
+		btcec.ScalarBaseMultNonConst(&t, &p)
+		keys[string(serializePoint(p))] = labelKey{m: m, tweak: t}
+	}
+	return keys, nil
+}
+
+// SharedSecret returns the shared secret of the scan key and the tweak of a
+// transaction: the scan key times the tweak.
+func SharedSecret(scanSecKey, tweak []byte) ([]byte, error) {
+	b, err := parseSecKey(scanSecKey)
+	if err != nil {
+		return nil, err
+	}
+	p, err := parsePubKey(tweak)
+	if err != nil {
+		return nil, err
+	}
+	var shared btcec.JacobianPoint
+	btcec.ScalarMultNonConst(&b, &p, &shared)
+	return serializePoint(shared), nil
+}
+
+// negate returns the negation of a point.
+func negate(p btcec.JacobianPoint) btcec.JacobianPoint {
+	p.ToAffine()
+	p.Y.Negate(1).Normalize()
+	return p
+}
+
+// matchLabel returns the label that the output pays to with P_k, whose
+// negation is passed: the label whose key is the output, or its negation,
+// minus P_k.
+func matchLabel(outputKey []byte, negK btcec.JacobianPoint,
+	labels map[string]labelKey) (labelKey, bool) {
+
+	p, err := liftX(outputKey)
+	if err != nil {
+		return labelKey{}, false
+	}
+	for _, q := range []btcec.JacobianPoint{p, negate(p)} {
+		var diff btcec.JacobianPoint
+		btcec.AddNonConst(&q, &negK, &diff)
+		if isInfinity(&diff) {
+			continue
+		}
+		if label, ok := labels[string(serializePoint(diff))]; ok {
+			return label, true
+		}
+	}
+	return labelKey{}, false
+}
+
+// Scan returns the outputs, given by their x-only keys, that pay the spend
+// key, or the spend key of one of the labels, of a transaction with the
+// tweak, in the order of k. It tries every output for t_0, then for t_1 if
+// one matches, and so on, up to MaxOutputs outputs.
+func Scan(scanSecKey, spendKey []byte, labels []uint32, tweak []byte,
+	outputKeys [][]byte) ([]FoundOutput, error) {
+
+	secret, err := SharedSecret(scanSecKey, tweak)
+	if err != nil {
+		return nil, err
+	}
+	spend, err := parsePubKey(spendKey)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := labelKeys(scanSecKey, labels)
+	if err != nil {
+		return nil, err
+	}
+
+	remaining := append([][]byte{}, outputKeys...)
+	var found []FoundOutput
+	for k := uint32(0); k < MaxOutputs && len(remaining) > 0; k++ {
+		t, err := sharedSecretTweak(secret, k)
+		if err != nil {
+			return nil, err
+		}
+		pk, err := addTweak(spend, &t)
+		if err != nil {
+			return nil, err
+		}
+		x, negK := xOnly(pk), negate(pk)
+
+		match := -1
+		var out FoundOutput
+		for i, outputKey := range remaining {
+			if bytes.Equal(outputKey, x) {
+				match = i
+				out = FoundOutput{OutputKey: outputKey}
+				break
+			}
+			if len(keys) == 0 {
+				continue
+			}
+			if label, ok := matchLabel(outputKey, negK, keys); ok {
+				t.Add(&label.tweak)
+				match = i
+				out = FoundOutput{
+					OutputKey: outputKey,
+					Labelled:  true,
+					Label:     label.m,
+				}
+				break
+			}
+		}
+		if match < 0 {
+			break
+		}
+		tk := t.Bytes()
+		out.Tweak = tk[:]
+		found = append(found, out)
+		remaining = append(remaining[:match], remaining[match+1:]...)
+	}
+	return found, nil
+}
+
+// ScanTx returns the outputs of a transaction spending the inputs that pay
+// to the receiver, as Scan does, with the tweak of the inputs.
+func ScanTx(scanSecKey, spendKey []byte, labels []uint32, inputs []Input,
+	outputKeys [][]byte) ([]FoundOutput, error) {
+
+	tweak, err := TweakData(inputs)
+	if err != nil {
+		return nil, err
+	}
+	return Scan(scanSecKey, spendKey, labels, tweak, outputKeys)
+}
+
+// SpendSecKey returns the secret key of a found output: the spend secret
+// key plus the output's tweak.
+func SpendSecKey(spendSecKey, tweak []byte) ([]byte, error) {
+	d, err := parseSecKey(spendSecKey)
+	if err != nil {
+		return nil, err
+	}
+	var t btcec.ModNScalar
+	if len(tweak) != SecKeySize || t.SetByteSlice(tweak) {
+		return nil, ErrInvalidTweak
+	}
+	if d.Add(&t).IsZero() {
+		return nil, ErrInvalidTweak
+	}
+	secKey := d.Bytes()
+	return secKey[:], nil
+}
+
+// taprootScript returns the P2TR output script of the x-only key.
+func taprootScript(outputKey []byte) []byte {
+	return append([]byte{0x51, OutputKeySize}, outputKey...)
+}
+
+// FilterScripts returns the scripts a light client looks for in the BIP 158
+// filter of a block to learn whether it pays the receiver, from the tweaks
+// of its transactions: for each, the P2TR script of the output of t_0, and
+// of it plus the key of each label. Payments of more than one output to the
+// receiver always have that of t_0, so the block of any is matched, and
+// the client then scans it in full.
+func FilterScripts(scanSecKey, spendKey []byte, labels []uint32,
+	tweaks [][]byte) ([][]byte, error) {
+
+	spend, err := parsePubKey(spendKey)
+	if err != nil {
+		return nil, err
+	}
+	var labelTweaks []btcec.ModNScalar
+	for _, m := range labels {
+		t, err := labelScalar(scanSecKey, m)
+		if err != nil {
+			return nil, err
+		}
+		labelTweaks = append(labelTweaks, t)
+	}
+
+	var scripts [][]byte
+	for _, tweak := range tweaks {
+		secret, err := SharedSecret(scanSecKey, tweak)
+		if err != nil {
+			return nil, err
+		}
+		t, err := sharedSecretTweak(secret, 0)
+		if err != nil {
+			return nil, err
+		}
+		p0, err := addTweak(spend, &t)
+		if err != nil {
+			return nil, err
+		}
+		scripts = append(scripts, taprootScript(xOnly(p0)))
+		for i := range labelTweaks {
+			p, err := addTweak(p0, &labelTweaks[i])
+			if err != nil {
+				return nil, err
+			}
+			scripts = append(scripts, taprootScript(xOnly(p)))
+		}
+	}
+	return scripts, nil
+}
+
+// MatchFilter reports whether the BIP 158 basic filter of the block with the
+// hash matches any of the scripts of FilterScripts.
+func MatchFilter(filter *gcs.Filter, blockHash *chainhash.Hash,
+	scripts [][]byte) (bool, error) {
+
+	if len(scripts) == 0 {
+		return false, nil
+	}
+	return filter.MatchAny(gcs.DeriveKey(blockHash), scripts)
+}
@@ -0,0 +1,122 @@
+package silentpayments
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	bech32 "github.com/christsim/bips/bip-0173"
+)
+
+var (
+	// ErrSecKeyCount is returned by SendOutputs when the number of secret
+	// keys isn't the number of inputs.
+	ErrSecKeyCount = errors.New("silentpayments: a secret key is needed " +
+		"for each input")
+
+	// ErrTooManyOutputs is returned by SendOutputs for more than
+	// MaxOutputs recipients of one scan key.
+	ErrTooManyOutputs = errors.New("silentpayments: too many outputs for " +
+		"a scan key")
+)
+
+// sharedSecretTweak returns t_k, the tweak of the k-th output paying to the
+// scan key of the shared secret:
+//
+//	hashBIP0352/SharedSecret(serP(ecdh_shared_secret) || ser32(k))
+func sharedSecretTweak(secret []byte, k uint32) (btcec.ModNScalar, error) {
+	return hashScalar(taggedHash(tagSharedSecret, secret, ser32(k)))
+}
+
+// isTaprootInput reports whether the input spends a P2TR output, whose
+// secret key is negated if its public key has an odd y.
+func isTaprootInput(in Input) bool {
+	version, program, ok := bech32.ParseWitnessScript(in.PrevScript)
+	return ok && version == 1 && len(program) == OutputKeySize
+}
+
+// SendOutputs returns the x-only keys of the taproot outputs paying the
+// recipients, in their order, from a transaction spending the inputs with
+// the secret keys, which are only read for eligible inputs and may be nil
+// for the others. The k-th recipient of a scan key gets the output of t_k;
+// a transaction whose outputs are ordered otherwise, such as by BIP 69,
+// still pays them, since receivers try each output for each k.
+func SendOutputs(inputs []Input, secKeys [][]byte,
+	recipients []Address) ([][]byte, error) {
+
+	if len(secKeys) != len(inputs) {
+		return nil, fmt.Errorf("%w: %d keys for %d inputs",
+			ErrSecKeyCount, len(secKeys), len(inputs))
+	}
+	keys, err := checkInputs(inputs)
+	if err != nil {
+		return nil, err
+	}
+
+	var a btcec.ModNScalar
+	for i, key := range keys {
+		if key == nil {
+			continue
+		}
+		d, err := parseSecKey(secKeys[i])
+		if err != nil {
+			return nil, fmt.Errorf("%w: input %d", err, i)
+		}
+		var p btcec.JacobianPoint
+		btcec.ScalarBaseMultNonConst(&d, &p)
+		p.ToAffine()
+		if isTaprootInput(inputs[i]) && p.Y.IsOdd() {
+			d.Negate()
+		}
+		a.Add(&d)
+	}
+	if a.IsZero() {
+		return nil, ErrZeroSum
+	}
+	var sum btcec.JacobianPoint
+	btcec.ScalarBaseMultNonConst(&a, &sum)
+	hash, err := inputHash(inputs, sum)
+	if err != nil {
+		return nil, err
+	}
+	a.Mul(&hash)
+
+	secrets := make(map[string][]byte)
+	counts := make(map[string]uint32)
+	outputs := make([][]byte, len(recipients))
+	for i, r := range recipients {
+		scanKey := string(r.ScanKey)
+		secret, ok := secrets[scanKey]
+		if !ok {
+			p, err := parsePubKey(r.ScanKey)
+			if err != nil {
+				return nil, err
+			}
+			var shared btcec.JacobianPoint
+			btcec.ScalarMultNonConst(&a, &p, &shared)
+			secret = serializePoint(shared)
+			secrets[scanKey] = secret
+		}
+		k := counts[scanKey]
+		if k == MaxOutputs {
+			return nil, fmt.Errorf("%w: more than %d",
+				ErrTooManyOutputs, MaxOutputs)
+		}
+		counts[scanKey] = k + 1
+
+		t, err := sharedSecretTweak(secret, k)
+		if err != nil {
+			return nil, err
+		}
+		spendKey, err := parsePubKey(r.SpendKey)
+		if err != nil {
+			return nil, err
+		}
+		output, err := addTweak(spendKey, &t)
+		if err != nil {
+			return nil, err
+		}
+		outputs[i] = xOnly(output)
+	}
+	return outputs, nil
+}
@@ -0,0 +1,330 @@
+// Package silentpayments implements the silent payments of BIP 352, which
+// let a receiver publish a single static address that senders derive a
+// fresh taproot output from for each payment, without any interaction and
+// without the outputs being linkable to the address or to each other:
+//
+//	outputs, err := silentpayments.SendOutputs(inputs, secKeys, recipients)
+//	found, err := silentpayments.ScanTx(scanSecKey, spendKey, labels,
+//		inputs, outputKeys)
+//
+// The sender tweaks the receiver's spend key with an ECDH shared secret of
+// the sum of the keys of the inputs it spends and the receiver's scan key,
+// hashed with the smallest outpoint so that no two transactions share it.
+// The receiver finds the secret again from the public keys of the inputs,
+// and an index server can publish their sum, multiplied by that hash, as
+// the tweak of each transaction, so that light clients scan with their scan
+// key alone. FilterScripts gives the scripts such a client looks for in the
+// BIP 158 filters of blocks, and MatchFilter matches them. Rescan walks a
+// range of blocks that way, with the tweaks of an index server or those
+// BlockTweaks computes from the blocks and the outputs they spend, and
+// fetches only the blocks whose filters match.
+//
+// Labels let a receiver tell payments to one address apart, by adding the
+// hash of the scan key and a label number to the spend key, with label 0
+// kept for change.
+package silentpayments
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	bech32 "github.com/christsim/bips/bip-0173"
+)
+
+// Sizes of keys and hashes.
+const (
+	// SecKeySize is the size of secret keys and tweaks.
+	SecKeySize = 32
+
+	// PubKeySize is the size of the compressed public keys of addresses,
+	// tweaks and shared secrets.
+	PubKeySize = 33
+
+	// OutputKeySize is the size of the x-only keys of taproot outputs.
+	OutputKeySize = 32
+
+	// HashSize is the size of the tagged hashes of the BIP.
+	HashSize = sha256.Size
+)
+
+// Address versions and limits.
+const (
+	// Version is the version of the addresses the package encodes.
+	Version = 0
+
+	// MaxVersion is the last version an address can have. Version 31 is
+	// kept for changes that break decoding.
+	MaxVersion = 30
+
+	// MaxAddressLength is the length limit of the bech32m encoding of
+	// addresses, up to which its checksum detects any single error.
+	MaxAddressLength = 1023
+
+	// MaxOutputs is K_max, the most outputs a transaction can pay to the
+	// addresses of one scan key, which bounds the work of scanning it.
+	MaxOutputs = 2323
+)
+
+// The human-readable parts of addresses.
+const (
+	MainNetHRP = "sp"
+	TestNetHRP = "tsp"
+	RegTestHRP = "sprt"
+)
+
+// ChangeLabel is the label number kept for change, which wallets always
+// scan for.
+const ChangeLabel = 0
+
+// Tags of the tagged hashes of the BIP.
+const (
+	tagInputs       = "BIP0352/Inputs"
+	tagSharedSecret = "BIP0352/SharedSecret"
+	tagLabel        = "BIP0352/Label"
+)
+
+var (
+	// ErrInvalidAddress is returned by DecodeAddress for a string that
+	// isn't a silent payment address of the network, wrapped with the
+	// reason.
+	ErrInvalidAddress = errors.New("silentpayments: invalid address")
+
+	// ErrInvalidSecKey is returned for a secret key that isn't 32 bytes,
+	// or whose value is zero or not below the curve order.
+	ErrInvalidSecKey = errors.New("silentpayments: invalid secret key")
+
+	// ErrInvalidPubKey is returned for a public key that isn't a
+	// compressed point of the curve.
+	ErrInvalidPubKey = errors.New("silentpayments: invalid public key")
+
+	// ErrInvalidTweak is returned in the unlikely case that a hash isn't
+	// below the curve order, or that adding it gives the point at
+	// infinity, so that it can't tweak a key.
+	ErrInvalidTweak = errors.New("silentpayments: invalid tweak")
+)
+
+// taggedHash returns the BIP 340 tagged hash of the data with the tag.
+func taggedHash(tag string, data ...[]byte) [HashSize]byte {
+	tagHash := sha256.Sum256([]byte(tag))
+	h := sha256.New()
+	h.Write(tagHash[:])
+	h.Write(tagHash[:])
+	for _, d := range data {
+		h.Write(d)
+	}
+	var hash [HashSize]byte
+	h.Sum(hash[:0])
+	return hash
+}
+
+// ser32 returns the 4 byte big endian encoding of n.
+func ser32(n uint32) []byte {
+	return binary.BigEndian.AppendUint32(nil, n)
+}
+
+// parseSecKey parses a secret key.
+func parseSecKey(secKey []byte) (btcec.ModNScalar, error) {
+	var d btcec.ModNScalar
+	if len(secKey) != SecKeySize || d.SetByteSlice(secKey) || d.IsZero() {
+		return d, ErrInvalidSecKey
+	}
+	return d, nil
+}
+
+// hashScalar returns the hash as a scalar, and fails if it isn't below the
+// curve order.
+func hashScalar(hash [HashSize]byte) (btcec.ModNScalar, error) {
+	var t btcec.ModNScalar
+	if t.SetBytes(&hash) != 0 {
+		return t, ErrInvalidTweak
+	}
+	return t, nil
+}
+
+// parsePubKey parses a compressed public key.
+func parsePubKey(pubKey []byte) (btcec.JacobianPoint, error) {
+	var p btcec.JacobianPoint
+	if len(pubKey) != PubKeySize {
+		return p, fmt.Errorf("%w: %d bytes", ErrInvalidPubKey,
+			len(pubKey))
+	}
+	key, err := btcec.ParsePubKey(pubKey)
+	if err != nil {
+		return p, fmt.Errorf("%w: %v", ErrInvalidPubKey, err)
+	}
+	key.AsJacobian(&p)
+	return p, nil
+}
+
+// liftX returns the point of the x-only key with an even y.
+func liftX(outputKey []byte) (btcec.JacobianPoint, error) {
+	var p btcec.JacobianPoint
+	key, err := schnorr.ParsePubKey(outputKey)
+	if err != nil {
+		return p, fmt.Errorf("%w: %v", ErrInvalidPubKey, err)
+	}
+	key.AsJacobian(&p)
+	return p, nil
+}
+
+// isInfinity reports whether the point is the point at infinity.
+func isInfinity(p *btcec.JacobianPoint) bool {
+	return (p.X.IsZero() && p.Y.IsZero()) || p.Z.IsZero()
+}
+
+// serializePoint returns the compressed encoding of a point other than the
+// point at infinity.
+func serializePoint(p btcec.JacobianPoint) []byte {
+	p.ToAffine()
+	return btcec.NewPublicKey(&p.X, &p.Y).SerializeCompressed()
+}
+
+// xOnly returns the x-only encoding of a point other than the point at
+// infinity.
+func xOnly(p btcec.JacobianPoint) []byte {
+	return serializePoint(p)[1:]
+}
+
+// addTweak returns the point plus the tweak times the generator.
+func addTweak(p btcec.JacobianPoint, t *btcec.ModNScalar) (
+	btcec.JacobianPoint, error) {
+
+	var tG, sum btcec.JacobianPoint
+	btcec.ScalarBaseMultNonConst(t, &tG)
+	btcec.AddNonConst(&p, &tG, &sum)
+	if isInfinity(&sum) {
+		return sum, ErrInvalidTweak
+	}
+	return sum, nil
+}
+
+// PubKey returns the compressed public key of a secret key.
+func PubKey(secKey []byte) ([]byte, error) {
+	d, err := parseSecKey(secKey)
+	if err != nil {
+		return nil, err
+	}
+	var p btcec.JacobianPoint
+	btcec.ScalarBaseMultNonConst(&d, &p)
+	return serializePoint(p), nil
+}
+
+// Address is a decoded silent payment address.
+type Address struct {
+	// Version is the version of the address. Those of versions past 0
+	// are read as version 0 ones, of which they must start with the
+	// payload.
+	Version byte
+
+	// ScanKey and SpendKey are the compressed public keys B_scan and
+	// B_spend, the latter with the address's label added if it has one.
+	ScanKey  []byte
+	SpendKey []byte
+}
+
+// EncodeAddress returns the version 0 address of the scan and spend keys on
+// the network with the human-readable part.
+func EncodeAddress(hrp string, scanKey, spendKey []byte) (string, error) {
+	for _, key := range [][]byte{scanKey, spendKey} {
+		if _, err := parsePubKey(key); err != nil {
+			return "", err
+		}
+	}
+	data, err := bech32.ConvertBits(append(append([]byte{}, scanKey...),
+		spendKey...), 8, 5, true)
+	if err != nil {
+		return "", err
+	}
+	return bech32.EncodeLimit(hrp, append([]byte{Version}, data...),
+		bech32.Bech32m, MaxAddressLength)
+}
+
+// DecodeAddress decodes an address of the network with the human-readable
+// part. Addresses of versions 1 to 30 must start with the payload of
+// version 0 ones, which is all that's read of them, so that senders can pay
+// addresses of later versions.
+func DecodeAddress(hrp, addr string) (Address, error) {
+	got, data, enc, err := bech32.DecodeLimit(addr, MaxAddressLength)
+	switch {
+	case err != nil:
+		return Address{}, fmt.Errorf("%w: %v", ErrInvalidAddress, err)
+	case got != strings.ToLower(hrp):
+		return Address{}, fmt.Errorf("%w: human-readable part %q",
+			ErrInvalidAddress, got)
+	case enc != bech32.Bech32m:
+		return Address{}, fmt.Errorf("%w: %v checksum",
+			ErrInvalidAddress, enc)
+	case len(data) == 0:
+		return Address{}, fmt.Errorf("%w: no version",
+			ErrInvalidAddress)
+	case data[0] > MaxVersion:
+		return Address{}, fmt.Errorf("%w: version %d",
+			ErrInvalidAddress, data[0])
+	}
+
+	payload, err := bech32.ConvertBits(data[1:], 5, 8, false)
+	if err != nil {
+		return Address{}, fmt.Errorf("%w: %v", ErrInvalidAddress, err)
+	}
+	size := 2 * PubKeySize
+	if len(payload) < size || data[0] == Version && len(payload) != size {
+		return Address{}, fmt.Errorf("%w: %d byte payload",
+			ErrInvalidAddress, len(payload))
+	}
+	a := Address{
+		Version:  data[0],
+		ScanKey:  payload[:PubKeySize],
+		SpendKey: payload[PubKeySize:size],
+	}
+	for _, key := range [][]byte{a.ScanKey, a.SpendKey} {
+		if _, err := parsePubKey(key); err != nil {
+			return Address{}, fmt.Errorf("%w: %v",
+				ErrInvalidAddress, err)
+		}
+	}
+	return a, nil
+}
+
+// labelScalar returns the tweak of the label number m of the scan key.
+func labelScalar(scanSecKey []byte, m uint32) (btcec.ModNScalar, error) {
+	if _, err := parseSecKey(scanSecKey); err != nil {
+		return btcec.ModNScalar{}, err
+	}
+	return hashScalar(taggedHash(tagLabel, scanSecKey, ser32(m)))
+}
+
+// LabelTweak returns the tweak of the label number m of the scan key:
+//
+//	hashBIP0352/Label(ser256(b_scan) || ser32(m))
+func LabelTweak(scanSecKey []byte, m uint32) ([]byte, error) {
+	t, err := labelScalar(scanSecKey, m)
+	if err != nil {
+		return nil, err
+	}
+	tweak := t.Bytes()
+	return tweak[:], nil
+}
+
+// LabelSpendKey returns the spend key of the label number m: the spend key
+// plus the tweak of the label times the generator, which the address of the
+// label has in place of the spend key.
+func LabelSpendKey(scanSecKey, spendKey []byte, m uint32) ([]byte, error) {
+	p, err := parsePubKey(spendKey)
+	if err != nil {
+		return nil, err
+	}
+	t, err := labelScalar(scanSecKey, m)
+	if err != nil {
+		return nil, err
+	}
+	labelled, err := addTweak(p, &t)
+	if err != nil {
+		return nil, err
+	}
+	return serializePoint(labelled), nil
+}
@@ -0,0 +1,767 @@
+package silentpayments
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/rand"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	bech32 "github.com/christsim/bips/bip-0173"
+	schnorr "github.com/christsim/bips/bip-0340"
+)
+
+// ErrVectorMismatch is returned by CheckVector when sending or scanning the
+// transaction of a vector doesn't give the expected values.
+var ErrVectorMismatch = errors.New("silentpayments: vector mismatch")
+
+// VectorHRP is the human-readable part of the addresses of the vectors,
+// those of mainnet, as the BIP has them.
+const VectorHRP = MainNetHRP
+
+// The message and auxiliary randomness that the BIP signs with the secret
+// keys of found outputs, to show that the receiver can spend them.
+var (
+	signMessage = sha256.Sum256([]byte("message"))
+	signAuxRand = sha256.Sum256([]byte("random auxiliary data"))
+)
+
+// Vector is a test case in the layout of the BIP's
+// send_and_receive_test_vectors.json: a transaction that a sender builds,
+// and that receivers scan.
+type Vector struct {
+	Comment   string
+	Sending   []SendVector
+	Receiving []ReceiveVector
+}
+
+// SendVector is a transaction a sender builds to pay the recipients.
+type SendVector struct {
+	// Inputs are the inputs of the transaction, and SecKeys their secret
+	// keys.
+	Inputs  []Input
+	SecKeys [][]byte
+
+	Recipients []string
+
+	// Outputs are the sets of x-only keys the sender may pay, in any
+	// order, since which recipient of a scan key gets which k is up to
+	// it. A single empty set is expected of a transaction that can't pay
+	// silent payments.
+	Outputs [][][]byte
+}
+
+// ReceiveVector is a transaction a receiver scans.
+type ReceiveVector struct {
+	// Inputs are the inputs of the transaction, and Outputs the x-only
+	// keys of its taproot outputs.
+	Inputs  []Input
+	Outputs [][]byte
+
+	ScanSecKey  []byte
+	SpendSecKey []byte
+	Labels      []uint32
+
+	// Addresses are the address of the receiver followed by those of its
+	// labels.
+	Addresses []string
+
+	// Tweak and SharedSecret are those of the transaction, or nil for one
+	// that can't pay silent payments.
+	Tweak        []byte
+	SharedSecret []byte
+
+	// Found are the outputs that pay the receiver. NOutputs is their
+	// number when Found lists only some of them, and zero otherwise.
+	Found    []FoundVector
+	NOutputs int
+}
+
+// FoundVector is an output a receiver finds, with the tweak of its secret
+// key and a BIP 340 signature made with the key.
+type FoundVector struct {
+	PubKey    []byte
+	Tweak     []byte
+	Signature []byte
+}
+
+// skipsTx reports whether the error is one of those for transactions that
+// can't pay silent payments, which senders and receivers skip.
+func skipsTx(err error) bool {
+	return errors.Is(err, ErrNoEligibleInputs) ||
+		errors.Is(err, ErrZeroSum) || errors.Is(err, ErrFutureSegwit)
+}
+
+// receiverAddresses returns the address of the receiver with the keys,
+// followed by those of its labels.
+func receiverAddresses(scanSecKey, spendSecKey []byte, labels []uint32) (
+	[]string, error) {
+
+	scanKey, err := PubKey(scanSecKey)
+	if err != nil {
+		return nil, err
+	}
+	spendKey, err := PubKey(spendSecKey)
+	if err != nil {
+		return nil, err
+	}
+	addr, err := EncodeAddress(VectorHRP, scanKey, spendKey)
+	if err != nil {
+		return nil, err
+	}
+	addrs := []string{addr}
+	for _, m := range labels {
+		labelled, err := LabelSpendKey(scanSecKey, spendKey, m)
+		if err != nil {
+			return nil, err
+		}
+		addr, err := EncodeAddress(VectorHRP, scanKey, labelled)
+		if err != nil {
+			return nil, err
+		}
+		addrs = append(addrs, addr)
+	}
+	return addrs, nil
+}
+
+// receiver is a receiver of the vectors.
+type receiver struct {
+	scanSecKey  []byte
+	spendSecKey []byte
+	labels      []uint32
+}
+
+// addresses returns the address of the receiver followed by those of its
+// labels.
+func (r receiver) addresses() []string {
+	addrs, err := receiverAddresses(r.scanSecKey, r.spendSecKey, r.labels)
+	if err != nil {
+		panic(err)
+	}
+	return addrs
+}
+
+// address returns the address of the receiver, or of its i-th label if i
+// isn't negative.
+func (r receiver) address(i int) string {
+	return r.addresses()[i+1]
+}
+
+// receive returns the vector of the receiver scanning the transaction.
+func (r receiver) receive(inputs []Input, outputs [][]byte) ReceiveVector {
+	v := ReceiveVector{
+		Inputs:      inputs,
+		Outputs:     outputs,
+		ScanSecKey:  r.scanSecKey,
+		SpendSecKey: r.spendSecKey,
+		Labels:      r.labels,
+		Addresses:   r.addresses(),
+	}
+	tweak, err := TweakData(inputs)
+	if skipsTx(err) {
+		return v
+	} else if err != nil {
+		panic(err)
+	}
+	if v.SharedSecret, err = SharedSecret(r.scanSecKey, tweak); err != nil {
+		panic(err)
+	}
+	v.Tweak = tweak
+
+	spendKey, err := PubKey(r.spendSecKey)
+	if err != nil {
+		panic(err)
+	}
+	found, err := Scan(r.scanSecKey, spendKey, r.labels, tweak, outputs)
+	if err != nil {
+		panic(err)
+	}
+	for _, out := range found {
+		secKey, err := SpendSecKey(r.spendSecKey, out.Tweak)
+		if err != nil {
+			panic(err)
+		}
+		sig, err := schnorr.Sign(secKey, signMessage[:], signAuxRand[:])
+		if err != nil {
+			panic(err)
+		}
+		v.Found = append(v.Found, FoundVector{
+			PubKey:    out.OutputKey,
+			Tweak:     out.Tweak,
+			Signature: sig,
+		})
+	}
+	return v
+}
+
+// newVector builds the vector of a transaction spending the inputs with the
+// secret keys to pay the recipients, with the extra outputs after theirs,
+// and of each of the receivers scanning it.
+func newVector(comment string, inputs []Input, secKeys [][]byte,
+	recipients []string, extra [][]byte, receivers ...receiver) Vector {
+
+	addrs := make([]Address, len(recipients))
+	for i, r := range recipients {
+		var err error
+		if addrs[i], err = DecodeAddress(VectorHRP, r); err != nil {
+			panic(err)
+		}
+	}
+	outputs, err := SendOutputs(inputs, secKeys, addrs)
+	if err != nil && !skipsTx(err) {
+		panic(err)
+	}
+	if outputs == nil {
+		outputs = [][]byte{}
+	}
+
+	v := Vector{
+		Comment: comment,
+		Sending: []SendVector{{
+			Inputs:     inputs,
+			SecKeys:    secKeys,
+			Recipients: recipients,
+			Outputs:    [][][]byte{outputs},
+		}},
+	}
+	txOutputs := append(append([][]byte{}, outputs...), extra...)
+	for _, r := range receivers {
+		v.Receiving = append(v.Receiving, r.receive(inputs, txOutputs))
+	}
+	return v
+}
+
+// Kinds of inputs of the vectors.
+const (
+	pubKeyHashInput = iota
+	witnessInput
+	nestedWitnessInput
+	taprootInput
+
+	// The inputs of the kinds past these aren't eligible.
+	uncompressedInput
+	numsInput
+	multisigInput
+
+	numInputKinds
+)
+
+// push returns the script pushing the data, of at most 75 bytes.
+func push(data []byte) []byte {
+	return append([]byte{byte(len(data))}, data...)
+}
+
+// placeholderSig returns random bytes in the shape of a DER signature with
+// SIGHASH_ALL, which silent payments don't read.
+func placeholderSig(rng *rand.Rand) []byte {
+	sig := make([]byte, 71)
+	rng.Read(sig)
+	copy(sig, []byte{0x30, 0x44, 0x02, 0x20})
+	sig[36], sig[37], sig[70] = 0x02, 0x20, 0x01
+	return sig
+}
+
+// randomSecKey returns a random valid secret key.
+func randomSecKey(rng *rand.Rand) []byte {
+	for {
+		secKey := make([]byte, SecKeySize)
+		rng.Read(secKey)
+		if _, err := parseSecKey(secKey); err == nil {
+			return secKey
+		}
+	}
+}
+
+// randomTaprootKey returns a random secret key whose public key has an odd
+// y if odd is set, and an even one otherwise.
+func randomTaprootKey(rng *rand.Rand, odd bool) []byte {
+	for {
+		secKey := randomSecKey(rng)
+		_, pubKey := btcec.PrivKeyFromBytes(secKey)
+		if pubKey.SerializeCompressed()[0] == 0x03 == odd {
+			return secKey
+		}
+	}
+}
+
+// randomOutputKey returns the x-only key of a random secret key.
+func randomOutputKey(rng *rand.Rand) []byte {
+	_, pubKey := btcec.PrivKeyFromBytes(randomSecKey(rng))
+	return pubKey.SerializeCompressed()[1:]
+}
+
+// randomOutPoint returns a random outpoint.
+func randomOutPoint(rng *rand.Rand) wire.OutPoint {
+	var hash chainhash.Hash
+	rng.Read(hash[:])
+	return wire.OutPoint{Hash: hash, Index: uint32(rng.Intn(4))}
+}
+
+// newInput returns an input of the kind spending an output of the secret
+// key, with a random outpoint and placeholder signatures.
+func newInput(rng *rand.Rand, kind int, secKey []byte) Input {
+	_, pubKey := btcec.PrivKeyFromBytes(secKey)
+	key := pubKey.SerializeCompressed()
+	keyHash := hash160(key)
+	in := Input{OutPoint: randomOutPoint(rng)}
+	switch kind {
+	case pubKeyHashInput, uncompressedInput:
+		if kind == uncompressedInput {
+			key = pubKey.SerializeUncompressed()
+			keyHash = hash160(key)
+		}
+		in.ScriptSig = append(push(placeholderSig(rng)), push(key)...)
+		in.PrevScript = append(append([]byte{0x76, 0xa9, 0x14},
+			keyHash...), 0x88, 0xac)
+
+	case witnessInput, nestedWitnessInput:
+		in.Witness = wire.TxWitness{placeholderSig(rng), key}
+		in.PrevScript = bech32.WitnessScript(0, keyHash)
+		if kind == nestedWitnessInput {
+			in.ScriptSig = push(in.PrevScript)
+			in.PrevScript = append(append([]byte{0xa9, 0x14},
+				hash160(in.PrevScript)...), 0x87)
+		}
+
+	case taprootInput, numsInput:
+		sig := make([]byte, 64)
+		rng.Read(sig)
+		in.Witness = wire.TxWitness{sig}
+		in.PrevScript = bech32.WitnessScript(1, key[1:])
+		if kind == numsInput {
+			script := append(push(key[1:]), 0xac)
+			controlBlock := append([]byte{0xc0}, numsKey...)
+			in.Witness = append(in.Witness, script, controlBlock)
+			in.PrevScript = bech32.WitnessScript(1,
+				randomOutputKey(rng))
+		}
+
+	case multisigInput:
+		redeem := append(append([]byte{0x51}, push(key)...), 0x51, 0xae)
+		in.ScriptSig = append(append([]byte{0x00},
+			push(placeholderSig(rng))...), push(redeem)...)
+		in.PrevScript = append(append([]byte{0xa9, 0x14},
+			hash160(redeem)...), 0x87)
+	}
+	return in
+}
+
+// newReceiver returns a receiver with random keys and the labels.
+func newReceiver(rng *rand.Rand, labels ...uint32) receiver {
+	return receiver{
+		scanSecKey:  randomSecKey(rng),
+		spendSecKey: randomSecKey(rng),
+		labels:      labels,
+	}
+}
+
+// The first case of the BIP, a payment from two inputs, whose outpoints and
+// keys are those of the BIP. Its P2PKH inputs are built again with
+// placeholder signatures, which don't change the output.
+const (
+	specTxID1       = "f4184fc596403b9d638783cf57adfe4c75c605f6356fbc91338530e9831e9e16"
+	specTxID2       = "a1075db55d416d3ca199f55b6084e2115b9345e16c5cf302fc80e9d5fbf5d48d"
+	specSecKey1     = "eadc78165ff1f8ea94ad7cfdc54990738a4c53f6e0507b42154201b8e5dff3b1"
+	specSecKey2     = "93f5ed907ad5b2bdbbdcb5d9116ebc0a4e1f92f910d5260237fa45a9408aad16"
+	specScanSecKey  = "0f694e068028a717f8af6b9411f9a133dd3565258714cc226594b34db90c1f2c"
+	specSpendSecKey = "9d6ad855ce3417ef84e836892e5a56392bfba05fa5d97ccea30e266f540e08b3"
+	specAddress     = "sp1qqgste7k9hx0qftg6qmwlkqtwuy6cycyavzmzj85c6qdfhjdpdjtdgqjuexzk6murw56suy3e0rd2cgqvycxttddwsvgxe2usfpxumr70xc9pkqwv"
+	specOutput      = "3e9fce73d4e77a4809908e3c3a2e54ee147b9312dc5044a193d1fc85de46e3c1"
+)
+
+// mustDecodeHex decodes hex the package embeds, which is known to be valid.
+func mustDecodeHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// specVectors returns the first case of the BIP, and the same with its
+// inputs in the other order. It panics if the package doesn't give the
+// BIP's address and output.
+func specVectors(rng *rand.Rand) []Vector {
+	r := receiver{
+		scanSecKey:  mustDecodeHex(specScanSecKey),
+		spendSecKey: mustDecodeHex(specSpendSecKey),
+	}
+	if addr := r.address(-1); addr != specAddress {
+		panic(fmt.Sprintf("silentpayments: spec address %v", addr))
+	}
+	secKeys := [][]byte{
+		mustDecodeHex(specSecKey1),
+		mustDecodeHex(specSecKey2),
+	}
+	var inputs []Input
+	for i, txid := range []string{specTxID1, specTxID2} {
+		in := newInput(rng, pubKeyHashInput, secKeys[i])
+		hash, err := chainhash.NewHashFromStr(txid)
+		if err != nil {
+			panic(err)
+		}
+		in.OutPoint = wire.OutPoint{Hash: *hash}
+		inputs = append(inputs, in)
+	}
+
+	recipients := []string{specAddress}
+	vectors := []Vector{
+		newVector("Simple send: two inputs", inputs, secKeys,
+			recipients, nil, r),
+		newVector("Simple send: two inputs, order reversed",
+			[]Input{inputs[1], inputs[0]},
+			[][]byte{secKeys[1], secKeys[0]}, recipients, nil, r),
+	}
+	for _, v := range vectors {
+		outputs := v.Sending[0].Outputs[0]
+		if len(outputs) != 1 || !bytes.Equal(outputs[0],
+			mustDecodeHex(specOutput)) {
+
+			panic(fmt.Sprintf("silentpayments: %v: outputs %x",
+				v.Comment, outputs))
+		}
+	}
+	return vectors
+}
+
+// caseVectors returns the other cases of the BIP, built with random keys
+// and outpoints.
+func caseVectors(rng *rand.Rand) []Vector {
+	var vectors []Vector
+	add := func(comment string, kinds []int, secKeys [][]byte,
+		recipients []string, extra [][]byte, receivers ...receiver) {
+
+		inputs := make([]Input, len(kinds))
+		for i, kind := range kinds {
+			inputs[i] = newInput(rng, kind, secKeys[i])
+		}
+		vectors = append(vectors, newVector(comment, inputs, secKeys,
+			recipients, extra, receivers...))
+	}
+	keys := func(n int) [][]byte {
+		secKeys := make([][]byte, n)
+		for i := range secKeys {
+			secKeys[i] = randomSecKey(rng)
+		}
+		return secKeys
+	}
+	two := []int{pubKeyHashInput, witnessInput}
+
+	// Outpoints of one transaction, including indexes whose little
+	// endian encodings sort unlike the integers.
+	for _, indexes := range [][2]uint32{{0, 1}, {3, 1}, {1, 256}} {
+		r := newReceiver(rng)
+		secKeys := keys(2)
+		inputs := []Input{
+			newInput(rng, witnessInput, secKeys[0]),
+			newInput(rng, witnessInput, secKeys[1]),
+		}
+		inputs[1].OutPoint.Hash = inputs[0].OutPoint.Hash
+		inputs[0].OutPoint.Index = indexes[0]
+		inputs[1].OutPoint.Index = indexes[1]
+		vectors = append(vectors, newVector(fmt.Sprintf("Outpoint "+
+			"ordering: two inputs of one transaction, vouts %d "+
+			"and %d", indexes[0], indexes[1]), inputs, secKeys,
+			[]string{r.address(-1)}, nil, r))
+	}
+
+	r := newReceiver(rng)
+	secKey := randomSecKey(rng)
+	add("Single recipient: the same public key on two inputs", two,
+		[][]byte{secKey, secKey}, []string{r.address(-1)}, nil, r)
+
+	for _, c := range []struct {
+		comment string
+		odd     []bool
+	}{
+		{"taproot only inputs with even y", []bool{false, false}},
+		{"taproot only inputs with odd y", []bool{true, true}},
+		{"taproot inputs with even and odd y", []bool{false, true}},
+	} {
+		r := newReceiver(rng)
+		secKeys := [][]byte{
+			randomTaprootKey(rng, c.odd[0]),
+			randomTaprootKey(rng, c.odd[1]),
+		}
+		add("Single recipient: "+c.comment,
+			[]int{taprootInput, taprootInput}, secKeys,
+			[]string{r.address(-1)}, nil, r)
+	}
+	r = newReceiver(rng)
+	add("Single recipient: taproot and P2PKH inputs",
+		[]int{taprootInput, pubKeyHashInput}, [][]byte{
+			randomTaprootKey(rng, true), randomSecKey(rng)},
+		[]string{r.address(-1)}, nil, r)
+
+	r = newReceiver(rng)
+	add("Multiple outputs: two outputs to one recipient", two, keys(2),
+		[]string{r.address(-1), r.address(-1)}, nil, r)
+	r, r2 := newReceiver(rng), newReceiver(rng)
+	add("Multiple outputs: recipients of different scan keys", two,
+		keys(2), []string{r.address(-1), r2.address(-1),
+			r.address(-1)}, nil, r, r2)
+
+	for i, m := range []uint32{2, 3, 1001337, 0xffffffff} {
+		r := newReceiver(rng, 2, 3, 1001337, 0xffffffff)
+		add(fmt.Sprintf("Receiving with labels: label %d", m), two,
+			keys(2), []string{r.address(i)}, nil, r)
+	}
+	r = newReceiver(rng, ChangeLabel, 7)
+	add("Multiple outputs with labels: the address, change and a "+
+		"label", two, keys(2), []string{r.address(-1), r.address(0),
+		r.address(1), r.address(1)}, nil, r)
+	r = newReceiver(rng)
+	add("Multiple outputs with labels: a label the receiver doesn't "+
+		"scan for", two, keys(2), []string{r.address(-1),
+		newReceiver(rng, 5).address(0)}, nil, r)
+
+	r = newReceiver(rng)
+	add("Single recipient: a taproot input spending a script with the "+
+		"NUMS internal key is skipped",
+		[]int{numsInput, witnessInput}, keys(2),
+		[]string{r.address(-1)}, nil, r)
+	r = newReceiver(rng)
+	add("Single recipient: P2SH-P2WPKH inputs",
+		[]int{nestedWitnessInput, nestedWitnessInput}, keys(2),
+		[]string{r.address(-1)}, nil, r)
+
+	r = newReceiver(rng)
+	secKeys := keys(2)
+	malleated := newInput(rng, pubKeyHashInput, secKeys[0])
+	malleated.ScriptSig = append(malleated.ScriptSig, 0x61)
+	vectors = append(vectors, newVector("Pubkey extraction from a "+
+		"malleated P2PKH scriptSig", []Input{malleated,
+		newInput(rng, witnessInput, secKeys[1])}, secKeys,
+		[]string{r.address(-1)}, nil, r))
+
+	r = newReceiver(rng)
+	add("Uncompressed keys are skipped",
+		[]int{uncompressedInput, witnessInput}, keys(2),
+		[]string{r.address(-1)}, nil, r)
+	r = newReceiver(rng)
+	add("Skip P2SH inputs other than P2SH-P2WPKH",
+		[]int{multisigInput, pubKeyHashInput}, keys(2),
+		[]string{r.address(-1)}, nil, r)
+	r, r2 = newReceiver(rng), newReceiver(rng)
+	add("Recipient ignores unrelated outputs", two, keys(2),
+		[]string{r.address(-1)}, [][]byte{randomOutputKey(rng),
+			randomOutputKey(rng)}, r, r2)
+
+	r = newReceiver(rng)
+	add("No valid inputs, sender generates no outputs",
+		[]int{uncompressedInput, numsInput, multisigInput}, keys(3),
+		[]string{r.address(-1)}, [][]byte{randomOutputKey(rng)}, r)
+
+	r = newReceiver(rng)
+	secKey = randomSecKey(rng)
+	d, _ := parseSecKey(secKey)
+	negated := d.Negate().Bytes()
+	add("Input keys sum up to zero, sender generates no outputs", two,
+		[][]byte{secKey, negated[:]}, []string{r.address(-1)},
+		[][]byte{randomOutputKey(rng)}, r)
+
+	r = newReceiver(rng)
+	secKeys = keys(2)
+	future := newInput(rng, witnessInput, secKeys[1])
+	future.PrevScript = bech32.WitnessScript(2, randomOutputKey(rng))
+	vectors = append(vectors, newVector("Skip transactions with an "+
+		"input of segwit version 2", []Input{newInput(rng,
+		witnessInput, secKeys[0]), future}, secKeys,
+		[]string{r.address(-1)}, [][]byte{randomOutputKey(rng)}, r))
+	return vectors
+}
+
+// Vectors returns the vectors of the cases of the BIP, the first with its
+// own keys and the others with keys derived from a math/rand source with
+// the seed, followed by count random transactions of one to four inputs of
+// any kind paying one to three recipients, among them labels, and random
+// other outputs.
+func Vectors(rngSeed int64, count int) []Vector {
+	rng := rand.New(rand.NewSource(rngSeed))
+	vectors := append(specVectors(rng), caseVectors(rng)...)
+	for n := 0; n < count; n++ {
+		inputs := make([]Input, 1+rng.Intn(4))
+		secKeys := make([][]byte, len(inputs))
+		for i := range inputs {
+			kind := rng.Intn(numInputKinds)
+			secKeys[i] = randomSecKey(rng)
+			inputs[i] = newInput(rng, kind, secKeys[i])
+		}
+
+		var receivers []receiver
+		var recipients []string
+		for i := 1 + rng.Intn(3); i > 0; i-- {
+			var r receiver
+			if len(receivers) > 0 && rng.Intn(3) == 0 {
+				r = receivers[rng.Intn(len(receivers))]
+			} else {
+				r = newReceiver(rng)
+				if rng.Intn(2) == 0 {
+					r.labels = []uint32{ChangeLabel,
+						rng.Uint32()}
+				}
+				receivers = append(receivers, r)
+			}
+			recipients = append(recipients,
+				r.address(rng.Intn(len(r.labels)+1)-1))
+		}
+		extra := make([][]byte, rng.Intn(3))
+		for i := range extra {
+			extra[i] = randomOutputKey(rng)
+		}
+		vectors = append(vectors, newVector(fmt.Sprintf("Random "+
+			"transaction %d", n), inputs, secKeys, recipients,
+			extra, receivers...))
+	}
+	return vectors
+}
+
+// sameKeys reports whether the two lists hold the same keys, in any order.
+func sameKeys(a, b [][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	count := make(map[string]int)
+	for _, key := range a {
+		count[string(key)]++
+	}
+	for _, key := range b {
+		if count[string(key)]--; count[string(key)] < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// checkSend checks that the sender pays one of the sets of outputs.
+func checkSend(v SendVector) error {
+	addrs := make([]Address, len(v.Recipients))
+	for i, r := range v.Recipients {
+		var err error
+		if addrs[i], err = DecodeAddress(VectorHRP, r); err != nil {
+			return err
+		}
+	}
+	outputs, err := SendOutputs(v.Inputs, v.SecKeys, addrs)
+	if err != nil && !skipsTx(err) {
+		return err
+	}
+	for _, want := range v.Outputs {
+		if sameKeys(outputs, want) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: outputs %x, expected one of %x",
+		ErrVectorMismatch, outputs, v.Outputs)
+}
+
+// checkFound checks that the receiver can spend a found output with the
+// tweak, and that the signature made with its key verifies.
+func checkFound(spendSecKey []byte, f FoundVector) error {
+	secKey, err := SpendSecKey(spendSecKey, f.Tweak)
+	if err != nil {
+		return err
+	}
+	pubKey, err := schnorr.PubKey(secKey)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(pubKey, f.PubKey) {
+		return fmt.Errorf("%w: output %x spent with the key of %x",
+			ErrVectorMismatch, f.PubKey, pubKey)
+	}
+	return schnorr.Verify(f.PubKey, signMessage[:], f.Signature)
+}
+
+// checkReceive checks the receiver's addresses, and that scanning the
+// transaction finds the expected outputs.
+func checkReceive(v ReceiveVector) error {
+	addrs, err := receiverAddresses(v.ScanSecKey, v.SpendSecKey, v.Labels)
+	if err != nil {
+		return err
+	}
+	if fmt.Sprint(addrs) != fmt.Sprint(v.Addresses) {
+		return fmt.Errorf("%w: addresses %v, expected %v",
+			ErrVectorMismatch, addrs, v.Addresses)
+	}
+
+	tweak, err := TweakData(v.Inputs)
+	if skipsTx(err) {
+		tweak = nil
+	} else if err != nil {
+		return err
+	}
+	if !bytes.Equal(tweak, v.Tweak) {
+		return fmt.Errorf("%w: tweak %x, expected %x",
+			ErrVectorMismatch, tweak, v.Tweak)
+	}
+	if tweak == nil {
+		if len(v.Found) > 0 || v.NOutputs > 0 {
+			return fmt.Errorf("%w: no outputs found",
+				ErrVectorMismatch)
+		}
+		return nil
+	}
+	secret, err := SharedSecret(v.ScanSecKey, tweak)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(secret, v.SharedSecret) {
+		return fmt.Errorf("%w: shared secret %x, expected %x",
+			ErrVectorMismatch, secret, v.SharedSecret)
+	}
+
+	spendKey, err := PubKey(v.SpendSecKey)
+	if err != nil {
+		return err
+	}
+	found, err := Scan(v.ScanSecKey, spendKey, v.Labels, tweak, v.Outputs)
+	if err != nil {
+		return err
+	}
+	n := v.NOutputs
+	if n == 0 {
+		n = len(v.Found)
+	}
+	if len(found) != n {
+		return fmt.Errorf("%w: %d outputs found, expected %d",
+			ErrVectorMismatch, len(found), n)
+	}
+	tweaks := make(map[string][]byte, len(found))
+	for _, out := range found {
+		tweaks[string(out.OutputKey)] = out.Tweak
+	}
+	for _, f := range v.Found {
+		if t, ok := tweaks[string(f.PubKey)]; !ok ||
+			!bytes.Equal(t, f.Tweak) {
+
+			return fmt.Errorf("%w: output %x with tweak %x not "+
+				"found", ErrVectorMismatch, f.PubKey, f.Tweak)
+		}
+		if err := checkFound(v.SpendSecKey, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckVector sends and scans the transactions of the vector, and checks
+// that the sender pays one of the expected sets of outputs, and that each
+// receiver finds the expected ones and can spend them.
+func CheckVector(v Vector) error {
+	for i, s := range v.Sending {
+		if err := checkSend(s); err != nil {
+			return fmt.Errorf("sending %d: %w", i, err)
+		}
+	}
+	for i, r := range v.Receiving {
+		if err := checkReceive(r); err != nil {
+			return fmt.Errorf("receiving %d: %w", i, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package descriptor
+
+import "strings"
+
+// inputCharset is the set of characters descriptors are written with, in
+// the order the checksum groups them: the characters of each group of 32
+// share their upper bits, which the checksum packs three at a time.
+const inputCharset = "0123456789()[],'/*abcdefgh@:$%{}" +
+	"IJKLMNOPQRSTUVWXYZ&+-.;<=>?!^_|~" +
+	"ijklmnopqrstuvwxyzABCDEFGH`#\"\\ "
+
+// checksumCharset is the alphabet of the checksum, that of bech32.
+const checksumCharset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+// ChecksumLen is the number of characters of a descriptor checksum.
+const ChecksumLen = 8
+
+// generator holds the generators of the BCH code of the checksum.
+var generator = [5]uint64{
+	0xf5dee51989, 0xa9fdca3312, 0x1bab10e32d, 0x3706b1677a, 0x644d626ffd,
+}
+
+// polymod feeds a 5 bit value into the checksum state.
+func polymod(chk uint64, value uint64) uint64 {
+	top := chk >> 35
+	chk = (chk&0x7ffffffff)<<5 ^ value
+	for i := 0; i < 5; i++ {
+		if (top>>i)&1 != 0 {
+			chk ^= generator[i]
+		}
+	}
+	return chk
+}
+
+// Checksum returns the checksum of a descriptor written without one, or
+// ErrInvalidCharacter if it has a character descriptors can't have.
+func Checksum(desc string) (string, error) {
+	chk := uint64(1)
+	groups, count := 0, 0
+	for i := 0; i < len(desc); i++ {
+		pos := strings.IndexByte(inputCharset, desc[i])
+		if pos < 0 {
+			return "", ErrInvalidCharacter
+		}
+
+		// The low 5 bits of each character are fed in as they come,
+		// and the upper bits of every three characters as one value.
+		chk = polymod(chk, uint64(pos&31))
+		groups = groups*3 + pos>>5
+		count++
+		if count == 3 {
+			chk = polymod(chk, uint64(groups))
+			groups, count = 0, 0
+		}
+	}
+	if count > 0 {
+		chk = polymod(chk, uint64(groups))
+	}
+	for i := 0; i < ChecksumLen; i++ {
+		chk = polymod(chk, 0)
+	}
+	chk ^= 1
+
+	var checksum [ChecksumLen]byte
+	for i := range checksum {
+		checksum[i] = checksumCharset[(chk>>(5*(7-i)))&31]
+	}
+	return string(checksum[:]), nil
+}
@@ -0,0 +1,435 @@
+// Package descriptor implements the output script descriptors of BIPs 380 to
+// 386: a language describing the output scripts of a wallet, such as
+//
+//	wsh(sortedmulti(2,[d34db33f/48'/0'/0'/2']xpub.../0/*,xpub.../0/*))
+//
+// Descriptors are made of script expressions, pk, pkh, wpkh, combo, multi,
+// sortedmulti, sh, wsh, tr, raw and addr, whose arguments are key expressions
+// and other script expressions. Keys are public keys in hex, private keys in
+// WIF, or extended keys with a path below them, and may be preceded by their
+// origin, the fingerprint of their master key and the path they were derived
+// along. An extended key whose path ends in a wildcard, /* or a hardened /*',
+// makes the descriptor ranged: it describes one script for each index, as a
+// wallet uses one address per index.
+//
+// Parse checks the checksum of a descriptor if it has one, and which
+// expressions may appear where, so that a parsed descriptor always derives
+// scripts. Scripts derives the output scripts at an index, which are what
+// BIP 158 basic filters hold for outputs paying to the descriptor and for
+// inputs spending them, so they are matched against filters as they are, and
+// Addresses renders them as addresses:
+//
+//	desc, err := descriptor.Parse("wpkh(" + xpub + "/0/*)")
+//	scripts, err := desc.Scripts(0)
+//	addresses, err := desc.Addresses(0, derivation.Mainnet)
+package descriptor
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrInvalidCharacter is returned for a descriptor with a character
+	// outside the character set of descriptors.
+	ErrInvalidCharacter = errors.New("descriptor: invalid character")
+
+	// ErrChecksum is returned for a descriptor whose checksum doesn't
+	// match.
+	ErrChecksum = errors.New("descriptor: bad checksum")
+
+	// ErrSyntax is returned for a descriptor that isn't made of well
+	// formed expressions.
+	ErrSyntax = errors.New("descriptor: syntax error")
+
+	// ErrUnknownFunction is returned for a script expression of a
+	// function the package doesn't know.
+	ErrUnknownFunction = errors.New("descriptor: unknown function")
+
+	// ErrContext is returned for a script expression where it isn't
+	// allowed, such as sh() inside wsh().
+	ErrContext = errors.New("descriptor: expression not allowed here")
+
+	// ErrInvalidKey is returned for a key expression that isn't a valid
+	// key, origin or path.
+	ErrInvalidKey = errors.New("descriptor: invalid key")
+
+	// ErrUncompressedKey is returned for an uncompressed key in wpkh(),
+	// wsh() or tr(), which only take compressed keys.
+	ErrUncompressedKey = errors.New("descriptor: uncompressed key in " +
+		"segwit script")
+
+	// ErrThreshold is returned for a multisig threshold that isn't a
+	// number from 1 to the number of keys.
+	ErrThreshold = errors.New("descriptor: invalid multisig threshold")
+
+	// ErrTooManyKeys is returned for a multisig with more keys than its
+	// context allows: 3 bare and 20 in wsh().
+	ErrTooManyKeys = errors.New("descriptor: too many multisig keys")
+
+	// ErrScriptSize is returned for a P2SH redeem script larger than 520
+	// bytes.
+	ErrScriptSize = errors.New("descriptor: redeem script larger than " +
+		"520 bytes")
+
+	// ErrTreeDepth is returned for a taproot tree deeper than 128.
+	ErrTreeDepth = errors.New("descriptor: taproot tree deeper than 128")
+
+	// ErrInvalidAddress is returned for an addr() expression whose
+	// address isn't a valid address of mainnet, testnet or regtest.
+	ErrInvalidAddress = errors.New("descriptor: invalid address")
+
+	// ErrInvalidIndex is returned when deriving the scripts of a ranged
+	// descriptor at an index of 2^31 or more.
+	ErrInvalidIndex = errors.New("descriptor: index must be below 2^31")
+
+	// ErrNoAddress is returned by Addresses for a descriptor none of
+	// whose scripts has an address.
+	ErrNoAddress = errors.New("descriptor: no address for script")
+)
+
+// context is where a script expression appears.
+type context int
+
+const (
+	topLevel context = iota
+	inSH
+	inWSH
+	inTap
+)
+
+// String returns the name of the context for error messages.
+func (c context) String() string {
+	switch c {
+	case inSH:
+		return "sh()"
+	case inWSH:
+		return "wsh()"
+	case inTap:
+		return "tr()"
+	}
+	return "top level"
+}
+
+const (
+	// maxBareMultiKeys is the number of keys a bare multisig may have.
+	maxBareMultiKeys = 3
+
+	// maxMultiKeys is the number of keys a multisig in wsh() may have.
+	maxMultiKeys = 20
+
+	// maxRedeemScriptSize is the size of the largest P2SH redeem script,
+	// which is pushed as a single stack element.
+	maxRedeemScriptSize = 520
+
+	// maxTapTreeDepth is the depth of the deepest leaf of a taproot tree,
+	// as a control block has at most 128 hashes.
+	maxTapTreeDepth = 128
+)
+
+// Descriptor is a parsed descriptor, or one of the script expressions it's
+// made of.
+type Descriptor struct {
+	fn string
+
+	// keys are the key arguments, and threshold the number of them that
+	// must sign a multisig.
+	keys      []*Key
+	threshold int
+
+	// sub is the script expression of sh() and wsh().
+	sub *Descriptor
+
+	// script is the script of raw() and addr().
+	script []byte
+
+	// tree is the script tree of tr(), or nil if it has none.
+	tree *tapTree
+
+	text string
+}
+
+// tapTree is a taproot script tree: a leaf script expression, or a branch of
+// two trees.
+type tapTree struct {
+	leaf        *Descriptor
+	left, right *tapTree
+}
+
+// Parse parses a descriptor. A checksum, following the descriptor after a #,
+// is optional, but is checked if present.
+func Parse(s string) (*Descriptor, error) {
+	desc, checksum, found := strings.Cut(s, "#")
+	sum, err := Checksum(desc)
+	if err != nil {
+		return nil, err
+	}
+	if found && checksum != sum {
+		return nil, fmt.Errorf("%w: %q, expected %s", ErrChecksum,
+			checksum, sum)
+	}
+	return parseScript(desc, topLevel)
+}
+
+// String returns the descriptor as it was parsed, followed by its checksum.
+func (d *Descriptor) String() string {
+	sum, _ := Checksum(d.text)
+	return d.text + "#" + sum
+}
+
+// IsRange reports whether the descriptor has a key ending in a wildcard, and
+// so describes different scripts at each index.
+func (d *Descriptor) IsRange() bool {
+	for _, key := range d.keys {
+		if key.IsRange() {
+			return true
+		}
+	}
+	if d.sub != nil && d.sub.IsRange() {
+		return true
+	}
+	return d.tree != nil && d.tree.isRange()
+}
+
+// isRange reports whether a leaf of the tree is ranged.
+func (t *tapTree) isRange() bool {
+	if t.leaf != nil {
+		return t.leaf.IsRange()
+	}
+	return t.left.isRange() || t.right.isRange()
+}
+
+// Keys returns the key expressions of the descriptor, in the order they are
+// written.
+func (d *Descriptor) Keys() []*Key {
+	keys := append([]*Key(nil), d.keys...)
+	if d.sub != nil {
+		keys = append(keys, d.sub.Keys()...)
+	}
+	if d.tree != nil {
+		keys = append(keys, d.tree.keys()...)
+	}
+	return keys
+}
+
+// keys returns the key expressions of the leaves of the tree.
+func (t *tapTree) keys() []*Key {
+	if t.leaf != nil {
+		return t.leaf.Keys()
+	}
+	return append(t.left.keys(), t.right.keys()...)
+}
+
+// splitCall splits a script expression into its function name and its
+// arguments.
+func splitCall(s string) (string, []string, error) {
+	open := strings.IndexByte(s, '(')
+	if open < 0 || !strings.HasSuffix(s, ")") {
+		return "", nil, fmt.Errorf("%w: %q isn't a script expression",
+			ErrSyntax, s)
+	}
+	args, err := splitArgs(s[open+1 : len(s)-1])
+	if err != nil {
+		return "", nil, err
+	}
+	return s[:open], args, nil
+}
+
+// opening maps each closing parenthesis, bracket and brace to its opening
+// one.
+var opening = map[byte]byte{')': '(', ']': '[', '}': '{'}
+
+// splitArgs splits a list of arguments at the commas that aren't nested in
+// parentheses, brackets or braces.
+func splitArgs(s string) ([]string, error) {
+	var args []string
+	var nesting []byte
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '(', '[', '{':
+			nesting = append(nesting, c)
+		case ')', ']', '}':
+			if len(nesting) == 0 ||
+				nesting[len(nesting)-1] != opening[c] {
+
+				return nil, fmt.Errorf("%w: unbalanced %q",
+					ErrSyntax, c)
+			}
+			nesting = nesting[:len(nesting)-1]
+		case ',':
+			if len(nesting) == 0 {
+				args = append(args, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	if len(nesting) != 0 {
+		return nil, fmt.Errorf("%w: unbalanced %q", ErrSyntax,
+			nesting[len(nesting)-1])
+	}
+	return append(args, s[start:]), nil
+}
+
+// allowedContexts holds the contexts each function is allowed in.
+var allowedContexts = map[string][]context{
+	"pk":          {topLevel, inSH, inWSH, inTap},
+	"pkh":         {topLevel, inSH, inWSH},
+	"wpkh":        {topLevel, inSH},
+	"combo":       {topLevel},
+	"multi":       {topLevel, inSH, inWSH},
+	"sortedmulti": {topLevel, inSH, inWSH},
+	"sh":          {topLevel},
+	"wsh":         {topLevel, inSH},
+	"tr":          {topLevel},
+	"raw":         {topLevel},
+	"addr":        {topLevel},
+}
+
+// parseScript parses a script expression allowed in the context.
+func parseScript(s string, ctx context) (*Descriptor, error) {
+	fn, args, err := splitCall(s)
+	if err != nil {
+		return nil, err
+	}
+	d := &Descriptor{fn: fn, text: s}
+
+	contexts, ok := allowedContexts[fn]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownFunction, fn)
+	}
+	found := false
+	for _, c := range contexts {
+		found = found || c == ctx
+	}
+	if !found {
+		return nil, fmt.Errorf("%w: %s() in %v", ErrContext, fn, ctx)
+	}
+
+	keyCtx := anyKey
+	switch {
+	case ctx == inTap || fn == "tr":
+		keyCtx = xOnlyKey
+	case ctx == inWSH || fn == "wpkh":
+		keyCtx = compressedKey
+	}
+
+	switch fn {
+	case "multi", "sortedmulti":
+		if err := d.parseMulti(args, ctx, keyCtx); err != nil {
+			return nil, err
+		}
+		return d, nil
+	case "tr":
+		if len(args) > 2 {
+			return nil, fmt.Errorf("%w: tr() takes a key and a "+
+				"tree", ErrSyntax)
+		}
+		if len(args) == 2 {
+			if d.tree, err = parseTree(args[1], 0); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(args) != 1 && fn != "tr" {
+		return nil, fmt.Errorf("%w: %s() takes one argument", ErrSyntax,
+			fn)
+	}
+
+	switch fn {
+	case "sh":
+		d.sub, err = parseScript(args[0], inSH)
+	case "wsh":
+		d.sub, err = parseScript(args[0], inWSH)
+	case "raw":
+		if !isHex(args[0]) || len(args[0])%2 != 0 {
+			return nil, fmt.Errorf("%w: raw(%s) isn't hex",
+				ErrSyntax, args[0])
+		}
+		d.script, _ = hex.DecodeString(args[0])
+	case "addr":
+		d.script, err = decodeAddress(args[0])
+	default:
+		var key *Key
+		if key, err = parseKey(args[0], keyCtx); err == nil {
+			d.keys = []*Key{key}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// parseMulti parses the threshold and keys of multi() and sortedmulti(),
+// and checks that the context allows as many keys.
+func (d *Descriptor) parseMulti(args []string, ctx context,
+	keyCtx keyContext) error {
+
+	threshold, err := strconv.ParseUint(args[0], 10, 32)
+	if err != nil || threshold < 1 || threshold > uint64(len(args)-1) {
+		return fmt.Errorf("%w: %s of %d keys", ErrThreshold, args[0],
+			len(args)-1)
+	}
+	d.threshold = int(threshold)
+
+	size := 3
+	for _, arg := range args[1:] {
+		key, err := parseKey(arg, keyCtx)
+		if err != nil {
+			return err
+		}
+		d.keys = append(d.keys, key)
+		size += 1 + key.size()
+	}
+
+	switch {
+	case ctx == topLevel && len(d.keys) > maxBareMultiKeys,
+		ctx == inWSH && len(d.keys) > maxMultiKeys:
+
+		return fmt.Errorf("%w: %d in %v", ErrTooManyKeys, len(d.keys),
+			ctx)
+
+	case ctx == inSH && size > maxRedeemScriptSize:
+		return fmt.Errorf("%w: %d bytes", ErrScriptSize, size)
+	}
+	return nil
+}
+
+// parseTree parses a taproot tree whose root is at the passed depth.
+func parseTree(s string, depth int) (*tapTree, error) {
+	if !strings.HasPrefix(s, "{") {
+		leaf, err := parseScript(s, inTap)
+		if err != nil {
+			return nil, err
+		}
+		return &tapTree{leaf: leaf}, nil
+	}
+
+	if depth == maxTapTreeDepth {
+		return nil, ErrTreeDepth
+	}
+	if !strings.HasSuffix(s, "}") {
+		return nil, fmt.Errorf("%w: unbalanced '{'", ErrSyntax)
+	}
+	branches, err := splitArgs(s[1 : len(s)-1])
+	if err != nil {
+		return nil, err
+	}
+	if len(branches) != 2 {
+		return nil, fmt.Errorf("%w: taproot branch of %d trees",
+			ErrSyntax, len(branches))
+	}
+	left, err := parseTree(branches[0], depth+1)
+	if err != nil {
+		return nil, err
+	}
+	right, err := parseTree(branches[1], depth+1)
+	if err != nil {
+		return nil, err
+	}
+	return &tapTree{left: left, right: right}, nil
+}
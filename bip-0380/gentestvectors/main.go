@@ -0,0 +1,184 @@
+// This program writes test vectors for the descriptor package to
+// descriptors.json: descriptors of every expression and kind of key, the
+// addresses of the BIP 44, 49, 84 and 86 test vectors derived from
+// descriptors of their accounts, descriptors that must be rejected, and
+// random descriptors. The random vectors depend only on -seed and -count, so
+// they can be regenerated by anyone:
+//
+//	gentestvectors -count 100 -seed 380
+//
+// The file uses the layout of the BIP 158 vectors: a JSON array whose first
+// row names the columns, followed by one row per vector. Each vector gives a
+// descriptor, the index and network it's derived at, and the scripts in hex
+// and addresses it describes there, separated by spaces, or the error
+// parsing it fails with. Pass -check to verify an existing file against the
+// package instead:
+//
+//	gentestvectors -check descriptors.json
+//
+// The program lives in a directory of its own since the descriptor package
+// sits at the root of the module.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/christsim/bips/bip-0032/derivation"
+	descriptor "github.com/christsim/bips/bip-0380"
+	"github.com/christsim/bips/internal/vectorfile"
+)
+
+// vectorColumns is the header row of the vector file.
+const vectorColumns = "Descriptor,Index,Network,Scripts,Addresses,Error," +
+	"Comment"
+
+type JSONTestWriter struct {
+	writer          io.Writer
+	firstRowWritten bool
+}
+
+func NewJSONTestWriter(writer io.Writer) *JSONTestWriter {
+	return &JSONTestWriter{writer: writer}
+}
+
+func (w *JSONTestWriter) WriteComment(comment string) error {
+	return w.WriteTestCase([]interface{}{comment})
+}
+
+func (w *JSONTestWriter) WriteTestCase(row []interface{}) error {
+	var err error
+	if w.firstRowWritten {
+		_, err = io.WriteString(w.writer, ",\n")
+	} else {
+		_, err = io.WriteString(w.writer, "[\n")
+		w.firstRowWritten = true
+	}
+	if err != nil {
+		return err
+	}
+
+	rowBytes, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.writer.Write(rowBytes)
+	return err
+}
+
+func (w *JSONTestWriter) Close() error {
+	if !w.firstRowWritten {
+		return nil
+	}
+
+	_, err := io.WriteString(w.writer, "\n]\n")
+	return err
+}
+
+func main() {
+	out := flag.String("out", "descriptors.json", "file to write the "+
+		"vectors to")
+	count := flag.Int("count", 100, "number of random vectors to write "+
+		"after the others")
+	seed := flag.Int64("seed", 380, "seed of the random vectors")
+	check := flag.String("check", "", "vector file to check instead of "+
+		"writing one")
+	flag.Parse()
+
+	var err error
+	if *check != "" {
+		err = checkFile(*check)
+	} else {
+		err = writeFile(*out, *seed, *count)
+	}
+	if err != nil {
+		fmt.Println("Error: ", err.Error())
+		os.Exit(1)
+	}
+}
+
+// writeFile writes the vectors of the package and count random vectors to
+// out.
+func writeFile(out string, seed int64, count int) error {
+	vectors := append(descriptor.Vectors(),
+		descriptor.RandomVectors(seed, count)...)
+
+	file, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := NewJSONTestWriter(file)
+	if err := writer.WriteComment(vectorColumns); err != nil {
+		return err
+	}
+	for _, v := range vectors {
+		err := writer.WriteTestCase([]interface{}{
+			v.Descriptor,
+			strconv.FormatUint(uint64(v.Index), 10),
+			v.Net.Name,
+			strings.Join(v.Scripts, " "),
+			strings.Join(v.Addresses, " "),
+			vectorfile.ErrorString(v.Err),
+			v.Comment,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote %d vectors\n", len(vectors))
+	return nil
+}
+
+// networks maps the names of the networks of the derivation package to them.
+var networks = map[string]derivation.Network{
+	derivation.Mainnet.Name: derivation.Mainnet,
+	derivation.Testnet.Name: derivation.Testnet,
+}
+
+// checkFile checks each vector of the file with descriptor.CheckVector.
+func checkFile(path string) error {
+	rows, err := vectorfile.ReadStringRows(path, 7)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		index, err := strconv.ParseUint(row[1], 10, 32)
+		if err != nil {
+			return fmt.Errorf("%v: %v", row[6], err)
+		}
+		net, ok := networks[row[2]]
+		if !ok {
+			return fmt.Errorf("%v: unknown network %v", row[6], row[2])
+		}
+		var vectorErr error
+		if row[5] != "" {
+			vectorErr = errors.New(row[5])
+		}
+		err = descriptor.CheckVector(descriptor.Vector{
+			Descriptor: row[0],
+			Index:      uint32(index),
+			Net:        net,
+			Scripts:    strings.Fields(row[3]),
+			Addresses:  strings.Fields(row[4]),
+			Err:        vectorErr,
+		})
+		if err != nil {
+			return fmt.Errorf("%v: %v", row[6], err)
+		}
+	}
+	fmt.Printf("%d vectors OK\n", len(rows))
+	return nil
+}
@@ -0,0 +1,291 @@
+package descriptor
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/christsim/bips/base58"
+	bip32 "github.com/christsim/bips/bip-0032"
+)
+
+// KeyOrigin is the origin of a key: the fingerprint of the master key it
+// was derived from and the path it was derived along.
+type KeyOrigin struct {
+	Fingerprint [4]byte
+	Path        bip32.Path
+}
+
+// Wildcard is the kind of final step of a ranged key's path.
+type Wildcard int
+
+const (
+	// NoWildcard is the wildcard of keys that aren't ranged.
+	NoWildcard Wildcard = iota
+
+	// Unhardened is the wildcard /*, deriving the child at the index.
+	Unhardened
+
+	// Hardened is the wildcard /*' or /*h, deriving the hardened child
+	// at the index, which takes a private key.
+	Hardened
+)
+
+// pubKeyBytesLenUncompressed is the length of an uncompressed public key.
+const pubKeyBytesLenUncompressed = 65
+
+// keyContext is what a key expression may be, given where it appears.
+type keyContext int
+
+const (
+	// anyKey allows compressed and uncompressed keys.
+	anyKey keyContext = iota
+
+	// compressedKey allows compressed keys only, as segwit scripts do.
+	compressedKey
+
+	// xOnlyKey allows compressed and x-only keys, whose x coordinate is
+	// used alone, as taproot does.
+	xOnlyKey
+)
+
+// Key is a key expression of a descriptor: a public key in hex, a private key
+// in WIF, or an extended key with a path below it that may end in a
+// wildcard, each of which may be preceded by its origin.
+type Key struct {
+	// Origin is the origin of the key, or nil if the descriptor doesn't
+	// give it.
+	Origin *KeyOrigin
+
+	// Wildcard tells whether the key is ranged, and how.
+	Wildcard Wildcard
+
+	// pubKey is the serialized public key of keys written in hex or WIF.
+	pubKey []byte
+
+	// extKey is the extended key of the expression, derived along its
+	// path up to the wildcard.
+	extKey *bip32.ExtendedKey
+
+	// xOnly tells whether the key is used as an x-only key.
+	xOnly bool
+
+	text string
+}
+
+// String returns the key expression as it was written.
+func (k *Key) String() string {
+	return k.text
+}
+
+// IsRange reports whether the key ends in a wildcard.
+func (k *Key) IsRange() bool {
+	return k.Wildcard != NoWildcard
+}
+
+// PubKey returns the public key of the expression at the passed index, which
+// keys without a wildcard ignore. It is serialized as the descriptor uses it:
+// compressed, uncompressed, or as its x coordinate for taproot.
+func (k *Key) PubKey(index uint32) ([]byte, error) {
+	pubKey := k.pubKey
+	if k.extKey != nil {
+		key := k.extKey
+		if k.Wildcard != NoWildcard {
+			if index >= bip32.HardenedKeyStart {
+				return nil, ErrInvalidIndex
+			}
+			if k.Wildcard == Hardened {
+				index += bip32.HardenedKeyStart
+			}
+			var err error
+			if key, err = key.Child(index); err != nil {
+				return nil, err
+			}
+		}
+		pubKey = key.PublicKey()
+	}
+	if k.xOnly && len(pubKey) == btcec.PubKeyBytesLenCompressed {
+		return pubKey[1:], nil
+	}
+	return pubKey, nil
+}
+
+// size returns the length of the serialized public key.
+func (k *Key) size() int {
+	switch {
+	case k.xOnly:
+		return schnorr.PubKeyBytesLen
+	case k.extKey != nil:
+		return btcec.PubKeyBytesLenCompressed
+	}
+	return len(k.pubKey)
+}
+
+// parseKey parses a key expression allowed in the context.
+func parseKey(s string, ctx keyContext) (*Key, error) {
+	k := &Key{text: s, xOnly: ctx == xOnlyKey}
+
+	if strings.HasPrefix(s, "[") {
+		end := strings.IndexByte(s, ']')
+		if end < 0 {
+			return nil, fmt.Errorf("%w: key origin of %q has no "+
+				"closing bracket", ErrInvalidKey, s)
+		}
+		origin, err := parseOrigin(s[1:end])
+		if err != nil {
+			return nil, err
+		}
+		k.Origin = origin
+		s = s[end+1:]
+	}
+
+	steps := strings.Split(s, "/")
+	switch {
+	case len(steps) == 1 && isHex(s):
+		return k, k.parseHex(s, ctx)
+
+	case len(steps) == 1:
+		if wif, err := base58.DecodeWIF(s); err == nil {
+			privKey, _ := btcec.PrivKeyFromBytes(wif.Key)
+			if !wif.Compressed {
+				if ctx != anyKey {
+					return nil, fmt.Errorf("%w: %s",
+						ErrUncompressedKey, s)
+				}
+				pubKey := privKey.PubKey()
+				k.pubKey = pubKey.SerializeUncompressed()
+				return k, nil
+			}
+			k.pubKey = privKey.PubKey().SerializeCompressed()
+			return k, nil
+		}
+	}
+
+	extKey, err := bip32.ParseKey(steps[0])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidKey, steps[0],
+			err)
+	}
+	net := extKey.Network()
+	if net != bip32.Mainnet && net != bip32.Testnet {
+		return nil, fmt.Errorf("%w: %s: versions of %s aren't allowed",
+			ErrInvalidKey, steps[0], net.Name)
+	}
+	steps = steps[1:]
+	if n := len(steps); n != 0 {
+		switch steps[n-1] {
+		case "*":
+			k.Wildcard = Unhardened
+		case "*'", "*h":
+			k.Wildcard = Hardened
+		}
+		if k.Wildcard != NoWildcard {
+			steps = steps[:n-1]
+		}
+	}
+	path, err := parsePath(steps)
+	if err != nil {
+		return nil, err
+	}
+	if k.extKey, err = extKey.Derive(path); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidKey, s, err)
+	}
+	if k.Wildcard == Hardened && !k.extKey.IsPrivate() {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidKey, s,
+			bip32.ErrDeriveHardFromPublic)
+	}
+	return k, nil
+}
+
+// parseHex parses a public key written in hex.
+func (k *Key) parseHex(s string, ctx keyContext) error {
+	pubKey, _ := hex.DecodeString(s)
+	switch len(pubKey) {
+	case schnorr.PubKeyBytesLen:
+		if ctx != xOnlyKey {
+			return fmt.Errorf("%w: x-only key %s outside tr()",
+				ErrInvalidKey, s)
+		}
+		if _, err := schnorr.ParsePubKey(pubKey); err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidKey, s)
+		}
+
+	case pubKeyBytesLenUncompressed:
+		if ctx != anyKey {
+			return fmt.Errorf("%w: %s", ErrUncompressedKey, s)
+		}
+		fallthrough
+
+	case btcec.PubKeyBytesLenCompressed:
+		if _, err := btcec.ParsePubKey(pubKey); err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidKey, s)
+		}
+
+	default:
+		return fmt.Errorf("%w: %s", ErrInvalidKey, s)
+	}
+	k.pubKey = pubKey
+	return nil
+}
+
+// parseOrigin parses the fingerprint and path of a key origin, written
+// between its brackets.
+func parseOrigin(s string) (*KeyOrigin, error) {
+	steps := strings.Split(s, "/")
+	fingerprint, err := hex.DecodeString(steps[0])
+	if err != nil || len(fingerprint) != 4 {
+		return nil, fmt.Errorf("%w: fingerprint %q isn't 4 bytes in "+
+			"hex", ErrInvalidKey, steps[0])
+	}
+	path, err := parsePath(steps[1:])
+	if err != nil {
+		return nil, err
+	}
+	origin := &KeyOrigin{Path: path}
+	copy(origin.Fingerprint[:], fingerprint)
+	return origin, nil
+}
+
+// parsePath parses the steps of a path, which are hardened if they end in '
+// or h.
+func parsePath(steps []string) (bip32.Path, error) {
+	path := bip32.Path{}
+	for _, step := range steps {
+		hardened := strings.HasSuffix(step, "'") ||
+			strings.HasSuffix(step, "h")
+		number := step
+		if hardened {
+			number = step[:len(step)-1]
+		}
+		index, err := strconv.ParseUint(number, 10, 32)
+		if err != nil || index >= bip32.HardenedKeyStart {
+			return nil, fmt.Errorf("%w: path step %q",
+				ErrInvalidKey, step)
+		}
+		if hardened {
+			index += bip32.HardenedKeyStart
+		}
+		path = append(path, uint32(index))
+	}
+	return path, nil
+}
+
+// isHex reports whether the string is made of lowercase or uppercase hex
+// digits only.
+func isHex(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f' ||
+			c >= 'A' && c <= 'F') {
+
+			return false
+		}
+	}
+	return true
+}
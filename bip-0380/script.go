@@ -0,0 +1,326 @@
+package descriptor
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/christsim/bips/base58"
+	"github.com/christsim/bips/bip-0032/derivation"
+	bech32 "github.com/christsim/bips/bip-0173"
+	"golang.org/x/crypto/ripemd160"
+)
+
+// Opcodes of the scripts descriptors describe.
+const (
+	op0             = 0x00
+	op1             = 0x51
+	opDup           = 0x76
+	opEqual         = 0x87
+	opEqualVerify   = 0x88
+	opHash160       = 0xa9
+	opCheckSig      = 0xac
+	opCheckMultiSig = 0xae
+)
+
+// tapLeafVersion is the leaf version of tapscript, that of every leaf of the
+// trees of tr().
+const tapLeafVersion = 0xc0
+
+// hash160 returns RIPEMD160(SHA256(data)).
+func hash160(data []byte) []byte {
+	sha := sha256.Sum256(data)
+	h := ripemd160.New()
+	h.Write(sha[:])
+	return h.Sum(nil)
+}
+
+// taggedHash returns the BIP 340 tagged hash of the data.
+func taggedHash(tag string, data ...[]byte) []byte {
+	tagHash := sha256.Sum256([]byte(tag))
+	h := sha256.New()
+	h.Write(tagHash[:])
+	h.Write(tagHash[:])
+	for _, d := range data {
+		h.Write(d)
+	}
+	return h.Sum(nil)
+}
+
+// push returns the script pushing the data, which is at most 75 bytes.
+func push(data []byte) []byte {
+	return append([]byte{byte(len(data))}, data...)
+}
+
+// pushInt returns the script pushing a number from 1 to 20, with an opcode
+// of its own up to 16.
+func pushInt(n int) []byte {
+	if n <= 16 {
+		return []byte{byte(op1 - 1 + n)}
+	}
+	return []byte{1, byte(n)}
+}
+
+// pubKeyHashScript returns the P2PKH script of a public key hash.
+func pubKeyHashScript(hash []byte) []byte {
+	script := append([]byte{opDup, opHash160}, push(hash)...)
+	return append(script, opEqualVerify, opCheckSig)
+}
+
+// scriptHashScript returns the P2SH script of a redeem script hash.
+func scriptHashScript(hash []byte) []byte {
+	script := append([]byte{opHash160}, push(hash)...)
+	return append(script, opEqual)
+}
+
+// Scripts returns the output scripts the descriptor describes at the passed
+// index, which descriptors that aren't ranged ignore. Every descriptor has
+// one script, but combo(), which has the P2PK and P2PKH scripts of its key,
+// and also the P2WPKH script and the P2WPKH script nested in P2SH if the
+// key is compressed.
+func (d *Descriptor) Scripts(index uint32) ([][]byte, error) {
+	if d.fn != "combo" {
+		script, err := d.outputScript(index)
+		if err != nil {
+			return nil, err
+		}
+		return [][]byte{script}, nil
+	}
+
+	pubKey, err := d.keys[0].PubKey(index)
+	if err != nil {
+		return nil, err
+	}
+	scripts := [][]byte{
+		append(push(pubKey), opCheckSig),
+		pubKeyHashScript(hash160(pubKey)),
+	}
+	if len(pubKey) == btcec.PubKeyBytesLenCompressed {
+		witnessScript := bech32.WitnessScript(0, hash160(pubKey))
+		scripts = append(scripts, witnessScript,
+			scriptHashScript(hash160(witnessScript)))
+	}
+	return scripts, nil
+}
+
+// outputScript returns the script of an expression other than combo() at the
+// passed index.
+func (d *Descriptor) outputScript(index uint32) ([]byte, error) {
+	var pubKeys [][]byte
+	for _, key := range d.keys {
+		pubKey, err := key.PubKey(index)
+		if err != nil {
+			return nil, err
+		}
+		pubKeys = append(pubKeys, pubKey)
+	}
+
+	switch d.fn {
+	case "pk":
+		return append(push(pubKeys[0]), opCheckSig), nil
+
+	case "pkh":
+		return pubKeyHashScript(hash160(pubKeys[0])), nil
+
+	case "wpkh":
+		return bech32.WitnessScript(0, hash160(pubKeys[0])), nil
+
+	case "sortedmulti":
+		sort.Slice(pubKeys, func(i, j int) bool {
+			return bytes.Compare(pubKeys[i], pubKeys[j]) < 0
+		})
+		fallthrough
+
+	case "multi":
+		script := pushInt(d.threshold)
+		for _, pubKey := range pubKeys {
+			script = append(script, push(pubKey)...)
+		}
+		script = append(script, pushInt(len(pubKeys))...)
+		return append(script, opCheckMultiSig), nil
+
+	case "sh":
+		redeemScript, err := d.sub.outputScript(index)
+		if err != nil {
+			return nil, err
+		}
+		return scriptHashScript(hash160(redeemScript)), nil
+
+	case "wsh":
+		witnessScript, err := d.sub.outputScript(index)
+		if err != nil {
+			return nil, err
+		}
+		hash := sha256.Sum256(witnessScript)
+		return bech32.WitnessScript(0, hash[:]), nil
+
+	case "tr":
+		var merkleRoot []byte
+		if d.tree != nil {
+			var err error
+			if merkleRoot, err = d.tree.hash(index); err != nil {
+				return nil, err
+			}
+		}
+		outputKey, err := taprootOutputKey(pubKeys[0], merkleRoot)
+		if err != nil {
+			return nil, err
+		}
+		return bech32.WitnessScript(1, outputKey), nil
+	}
+
+	// raw() and addr() have their script as it is.
+	return d.script, nil
+}
+
+// hash returns the hash of the tree at the passed index: the tagged hash of
+// a leaf's script, or of the sorted hashes of a branch's children.
+func (t *tapTree) hash(index uint32) ([]byte, error) {
+	if t.leaf != nil {
+		script, err := t.leaf.outputScript(index)
+		if err != nil {
+			return nil, err
+		}
+		// Leaf scripts are short, so their length is a one byte
+		// compact size.
+		return taggedHash("TapLeaf", []byte{tapLeafVersion},
+			[]byte{byte(len(script))}, script), nil
+	}
+
+	left, err := t.left.hash(index)
+	if err != nil {
+		return nil, err
+	}
+	right, err := t.right.hash(index)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Compare(left, right) > 0 {
+		left, right = right, left
+	}
+	return taggedHash("TapBranch", left, right), nil
+}
+
+// taprootOutputKey returns the x-only output key committing to the x-only
+// internal key and the merkle root of a script tree, or to no tree if the
+// root is nil:
+//
+//	Q = P + int(hashTapTweak(bytes(P) || root))G
+func taprootOutputKey(internalKey, merkleRoot []byte) ([]byte, error) {
+	p, err := schnorr.ParsePubKey(internalKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %x", ErrInvalidKey, internalKey)
+	}
+
+	var tweak btcec.ModNScalar
+	if tweak.SetByteSlice(taggedHash("TapTweak", internalKey, merkleRoot)) {
+		return nil, fmt.Errorf("%w: tweak of %x overflows",
+			ErrInvalidKey, internalKey)
+	}
+
+	var tweakPoint, point, q btcec.JacobianPoint
+	btcec.ScalarBaseMultNonConst(&tweak, &tweakPoint)
+	p.AsJacobian(&point)
+	btcec.AddNonConst(&point, &tweakPoint, &q)
+	if q.Z.IsZero() {
+		return nil, fmt.Errorf("%w: tweak of %x gives infinity",
+			ErrInvalidKey, internalKey)
+	}
+	q.ToAffine()
+	x := q.X.Bytes()
+	return x[:], nil
+}
+
+// Addresses returns the addresses of the scripts the descriptor describes
+// at the passed index on the network, leaving out scripts without one, such
+// as P2PK, bare multisig and most raw() scripts. A descriptor none of whose
+// scripts has an address gives ErrNoAddress.
+func (d *Descriptor) Addresses(index uint32,
+	net derivation.Network) ([]string, error) {
+
+	scripts, err := d.Scripts(index)
+	if err != nil {
+		return nil, err
+	}
+	var addresses []string
+	for _, script := range scripts {
+		address, err := ScriptAddress(script, net)
+		if err == nil {
+			addresses = append(addresses, address)
+		}
+	}
+	if addresses == nil {
+		return nil, ErrNoAddress
+	}
+	return addresses, nil
+}
+
+// ScriptAddress renders the address of a P2PKH, P2SH or witness program
+// output script on the network, or gives ErrNoAddress for any other script.
+func ScriptAddress(script []byte, net derivation.Network) (string, error) {
+	switch {
+	case len(script) == 25 && script[0] == opDup &&
+		script[1] == opHash160 && script[2] == 20 &&
+		script[23] == opEqualVerify && script[24] == opCheckSig:
+
+		return base58.CheckEncode(append([]byte{net.PubKeyHashAddrID},
+			script[3:23]...)), nil
+
+	case len(script) == 23 && script[0] == opHash160 &&
+		script[1] == 20 && script[22] == opEqual:
+
+		return base58.CheckEncode(append([]byte{net.ScriptHashAddrID},
+			script[2:22]...)), nil
+	}
+
+	version, program, ok := bech32.ParseWitnessScript(script)
+	if !ok {
+		return "", ErrNoAddress
+	}
+	address, err := bech32.EncodeSegwit(net.HRP, version, program)
+	if err != nil {
+		return "", ErrNoAddress
+	}
+	return address, nil
+}
+
+// addressHRPs are the human-readable parts of the segwit addresses addr()
+// takes: those of mainnet, testnet and regtest.
+var addressHRPs = []string{derivation.Mainnet.HRP, derivation.Testnet.HRP,
+	"bcrt"}
+
+// decodeAddress returns the output script paying to an address of addr().
+func decodeAddress(address string) ([]byte, error) {
+	for _, hrp := range addressHRPs {
+		if !strings.HasPrefix(strings.ToLower(address), hrp+"1") {
+			continue
+		}
+		version, program, err := bech32.DecodeSegwit(hrp, address)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidAddress,
+				address, err)
+		}
+		return bech32.WitnessScript(version, program), nil
+	}
+
+	data, err := base58.CheckDecode(address)
+	if err != nil || len(data) != 21 {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidAddress, address)
+	}
+	for _, net := range []derivation.Network{derivation.Mainnet,
+		derivation.Testnet} {
+
+		switch data[0] {
+		case net.PubKeyHashAddrID:
+			return pubKeyHashScript(data[1:]), nil
+		case net.ScriptHashAddrID:
+			return scriptHashScript(data[1:]), nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s: unknown version %d", ErrInvalidAddress,
+		address, data[0])
+}
@@ -0,0 +1,578 @@
+package descriptor
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+
+	"github.com/christsim/bips/base58"
+	bip32 "github.com/christsim/bips/bip-0032"
+	"github.com/christsim/bips/bip-0032/derivation"
+	bech32 "github.com/christsim/bips/bip-0173"
+	"github.com/christsim/bips/internal/vectorfile"
+)
+
+// ErrVectorMismatch is returned by CheckVector when a vector doesn't parse
+// or derive as expected.
+var ErrVectorMismatch = errors.New("descriptor: vector mismatch")
+
+// Vector is a descriptor and the scripts and addresses it describes at an
+// index, or the error parsing it fails with.
+type Vector struct {
+	// Descriptor is the descriptor, which valid vectors give with its
+	// checksum.
+	Descriptor string
+
+	// Index is the index the scripts are derived at.
+	Index uint32
+
+	// Net is the network the addresses are rendered on.
+	Net derivation.Network
+
+	// Scripts are the scripts at the index, in hex, and Addresses their
+	// addresses, which scripts without one don't have.
+	Scripts   []string
+	Addresses []string
+
+	// Err is the error Parse fails with, or nil for a valid descriptor.
+	Err error
+
+	// Comment describes the vector.
+	Comment string
+}
+
+// Keys the vectors are written with: the generator G and its multiples 2G
+// and 3G, G uncompressed, the private key 1 in WIF, and the master key of
+// the first test vector of BIP 32.
+const (
+	keyG  = "0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"
+	key2G = "02c6047f9441ed7d6d3045406e95c07cd85c778e4b8cef3ca7abac09b95c709ee5"
+	key3G = "02f9308a019258c31049344f85f89d5229b531c845836f99b08601f113bce036f9"
+	keyGU = "0479be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798" +
+		"483ada7726a3c4655da4fbfc0e1108a8fd17b448a68554199c47d08ffb10d4b8"
+
+	wifG  = "KwDiBf89QgGbjEhKnhXJuH7LrciVrZi3qYjgd9M7rFU73sVHnoWn"
+	wifGU = "5HpHagT65TZzG1PH3CSu63k8DbpvD8s5ip4nEB3kEsreAnchuDf"
+
+	xprv = "xprv9s21ZrQH143K3QTDL4LXw2F7HEK3wJUD2nW2nRk4stbPy6cq3jPPqjiChk" +
+		"VvvNKmPGJxWUtg6LnF5kejMRNNU3TGtRBeJgk33yuGBxrMPHi"
+	xpub = "xpub661MyMwAqRbcFtXgS5sYJABqqG9YLmC4Q1Rdap9gSE8NqtwybGhePY2gZ2" +
+		"9ESFjqJoCu1Rupje8YtGqsefD265TMg7usUDFdp6W1EGMcet8"
+)
+
+// validVector is a valid descriptor of the vectors, written without its
+// checksum.
+type validVector struct {
+	desc    string
+	index   uint32
+	testnet bool
+	comment string
+}
+
+var validVectors = []validVector{
+	{desc: "raw(deadbeef)", comment: "Raw script, the checksum example " +
+		"of BIP 380"},
+	{desc: "pk(" + keyG + ")", comment: "P2PK of a compressed key"},
+	{desc: "pk(" + keyGU + ")", comment: "P2PK of an uncompressed key"},
+	{desc: "pkh(" + keyG + ")", comment: "P2PKH of a compressed key"},
+	{desc: "pkh(" + wifGU + ")", comment: "P2PKH of an uncompressed " +
+		"private key in WIF"},
+	{desc: "pkh([d34db33f/44'/0'/0']" + xpub + "/1/*)", index: 7,
+		comment: "P2PKH of a ranged xpub with its origin"},
+	{desc: "pkh([d34db33f/44h/0h/0h]" + xpub + "/1/*)", index: 7,
+		comment: "The previous descriptor with hardened steps marked " +
+			"by h, which gives another checksum"},
+	{desc: "sh(pk(" + keyGU + "))", comment: "P2PK of an uncompressed " +
+		"key in P2SH"},
+	{desc: "sh(pkh(" + key2G + "))", comment: "P2PKH in P2SH"},
+	{desc: "wpkh(" + keyG + ")", comment: "P2WPKH"},
+	{desc: "wpkh(" + wifG + ")", comment: "P2WPKH of a compressed " +
+		"private key in WIF"},
+	{desc: "wpkh(" + xprv + "/0'/1/*)", index: 3, comment: "P2WPKH of " +
+		"a ranged xprv with a hardened step"},
+	{desc: "sh(wpkh(" + key2G + "))", comment: "P2WPKH in P2SH"},
+	{desc: "wsh(pk(" + keyG + "))", comment: "P2PK in P2WSH"},
+	{desc: "wsh(pkh(" + key3G + "))", comment: "P2PKH in P2WSH"},
+	{desc: "sh(wsh(pkh(" + keyG + ")))", comment: "P2PKH in P2WSH in " +
+		"P2SH"},
+	{desc: "multi(1," + keyG + "," + keyGU + ")", comment: "Bare 1-of-2 " +
+		"multisig with an uncompressed key"},
+	{desc: "multi(2," + key3G + "," + key2G + "," + keyG + ")",
+		comment: "Bare 2-of-3 multisig, the most keys bare multisig " +
+			"takes"},
+	{desc: "sortedmulti(2," + key3G + "," + key2G + "," + keyG + ")",
+		comment: "Bare 2-of-3 multisig with sorted keys"},
+	{desc: "sh(multi(2,[00000000/111'/222]" + xprv + "," + xpub +
+		"/0))", comment: "2-of-2 multisig in P2SH of extended keys"},
+	{desc: "sh(sortedmulti(1," + xpub + "/1/*," + xprv + "/2/*'))",
+		index: 5, comment: "Sorted multisig in P2SH of ranged keys, " +
+			"one with a hardened wildcard"},
+	{desc: "wsh(multi(1," + xpub + "/1/0/*," + xpub + "/2/0/*))",
+		index: 10, comment: "Ranged multisig in P2WSH"},
+	{desc: "sh(wsh(sortedmulti(1," + key3G + "," + key2G + ")))",
+		comment: "Sorted multisig in P2WSH in P2SH"},
+	{desc: "combo(" + keyG + ")", comment: "combo() of a compressed key, " +
+		"with four scripts"},
+	{desc: "combo(" + keyGU + ")", comment: "combo() of an uncompressed " +
+		"key, with P2PK and P2PKH alone"},
+	{desc: "combo(" + xpub + "/0/*)", index: 2, comment: "Ranged combo()"},
+	{desc: "addr(1BgGZ9tcN4rm9KBzDn7KprQz87SZ26SAMH)", comment: "Mainnet " +
+		"P2PKH address"},
+	{desc: "addr(2N8hwP1WmJrFF5QWABn38y63uYLhnJYJYTF)", testnet: true,
+		comment: "Testnet P2SH address"},
+	{desc: "addr(bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4)",
+		comment: "P2WPKH address"},
+	{desc: "addr(bcrt1qw508d6qejxtdg4y5r3zarvary0c5xw7kygt080)",
+		testnet: true, comment: "Regtest address, rendered as a " +
+			"testnet one"},
+	{desc: "tr(" + keyG + ")", comment: "P2TR of a compressed key " +
+		"without a script tree"},
+	{desc: "tr(" + keyG[2:] + ")", comment: "P2TR of an x-only key"},
+	{desc: "tr(" + keyG + ",pk(" + key2G + "))", comment: "P2TR with a " +
+		"single leaf"},
+	{desc: "tr(" + keyG + ",{pk(" + key2G + "),{pk(" + key3G[2:] +
+		"),pk(" + xpub + "/0/*)}})", index: 4, comment: "P2TR with a " +
+		"tree of three leaves, one of them ranged"},
+	{desc: "tr([ffffffff/86h/0h/0h]" + xprv + "/86h/0h/0h/0/*)",
+		index: 1, comment: "P2TR of a ranged xprv"},
+}
+
+// invalidVector is a descriptor Parse rejects, and the error it fails with.
+type invalidVector struct {
+	desc    string
+	err     error
+	comment string
+}
+
+// invalidVectors returns the descriptors that Parse rejects.
+func invalidVectors() []invalidVector {
+	var keys []string
+	for i := 0; i < 21; i++ {
+		keys = append(keys, key2G)
+	}
+	deepTree := "pk(" + keyG + ")"
+	for i := 0; i <= maxTapTreeDepth; i++ {
+		deepTree = "{pk(" + key2G + ")," + deepTree + "}"
+	}
+	wrap := func(err error, format string, a ...interface{}) error {
+		return fmt.Errorf("%w: "+format, append([]interface{}{err},
+			a...)...)
+	}
+	hardFromPublic := bip32.ErrDeriveHardFromPublic
+
+	return []invalidVector{
+		{"raw(deadbeef)#89f8spxn",
+			wrap(ErrChecksum, `"89f8spxn", expected 89f8spxm`),
+			"Bad checksum"},
+		{"raw(deadbeef)#",
+			wrap(ErrChecksum, `"", expected 89f8spxm`),
+			"Empty checksum"},
+		{"raw(deadbeef)#89f8spxm#89f8spxm",
+			wrap(ErrChecksum, `"89f8spxm#89f8spxm", expected `+
+				"89f8spxm"),
+			"Two checksums"},
+		{"raw(deadbeef)\u00e9", ErrInvalidCharacter,
+			"Character outside the character set"},
+		{"foo(" + keyG + ")", wrap(ErrUnknownFunction, `"foo"`),
+			"Unknown function"},
+		{"pk(" + keyG + ")x",
+			wrap(ErrSyntax, "%q isn't a script expression",
+				"pk("+keyG+")x"),
+			"Trailing characters"},
+		{"pk(" + keyG + "," + key2G + ")",
+			wrap(ErrSyntax, "pk() takes one argument"),
+			"Too many arguments"},
+		{"wsh(pk(" + keyG + ")", wrap(ErrSyntax, "unbalanced '('"),
+			"Unbalanced parentheses"},
+		{"pk()", wrap(ErrInvalidKey, ": %v", bip32.ErrBadChecksum),
+			"Missing key"},
+		{"pk(" + keyG[2:] + ")",
+			wrap(ErrInvalidKey, "x-only key %s outside tr()",
+				keyG[2:]),
+			"x-only key outside tr()"},
+		{"pk(" + keyG + "00)", wrap(ErrInvalidKey, "%s00", keyG),
+			"Public key of the wrong length"},
+		{"pk(04" + keyG[2:] + ")",
+			wrap(ErrInvalidKey, "04%s", keyG[2:]),
+			"Compressed key with an uncompressed prefix"},
+		{"sh(sh(pk(" + keyG + ")))", wrap(ErrContext, "sh() in sh()"),
+			"sh() inside sh()"},
+		{"wsh(sh(pk(" + keyG + ")))", wrap(ErrContext, "sh() in wsh()"),
+			"sh() inside wsh()"},
+		{"wsh(wsh(pk(" + keyG + ")))",
+			wrap(ErrContext, "wsh() in wsh()"),
+			"wsh() inside wsh()"},
+		{"wsh(wpkh(" + keyG + "))", wrap(ErrContext, "wpkh() in wsh()"),
+			"wpkh() inside wsh()"},
+		{"sh(combo(" + keyG + "))", wrap(ErrContext, "combo() in sh()"),
+			"combo() inside sh()"},
+		{"sh(raw(deadbeef))", wrap(ErrContext, "raw() in sh()"),
+			"raw() inside sh()"},
+		{"wsh(addr(1BgGZ9tcN4rm9KBzDn7KprQz87SZ26SAMH))",
+			wrap(ErrContext, "addr() in wsh()"),
+			"addr() inside wsh()"},
+		{"sh(tr(" + keyG + "))", wrap(ErrContext, "tr() in sh()"),
+			"tr() inside sh()"},
+		{"tr(" + keyG + ",pkh(" + key2G + "))",
+			wrap(ErrContext, "pkh() in tr()"),
+			"pkh() as a taproot leaf"},
+		{"wpkh(" + keyGU + ")", wrap(ErrUncompressedKey, keyGU),
+			"Uncompressed key in wpkh()"},
+		{"wsh(pk(" + wifGU + "))", wrap(ErrUncompressedKey, wifGU),
+			"Uncompressed private key in wsh()"},
+		{"sh(wpkh(" + keyGU + "))", wrap(ErrUncompressedKey, keyGU),
+			"Uncompressed key in wpkh() in sh()"},
+		{"tr(" + keyGU + ")", wrap(ErrUncompressedKey, keyGU),
+			"Uncompressed key in tr()"},
+		{"pkh([deadbef]" + keyG + ")",
+			wrap(ErrInvalidKey, `fingerprint "deadbef" isn't 4 `+
+				"bytes in hex"),
+			"Fingerprint of 7 hex digits"},
+		{"pkh([deadbeef/1x]" + keyG + ")",
+			wrap(ErrInvalidKey, `path step "1x"`),
+			"Origin path step that isn't a number"},
+		{"pkh([deadbeef" + keyG + ")",
+			wrap(ErrSyntax, "unbalanced '['"),
+			"Origin without a closing bracket"},
+		{"pkh(" + xpub + "/2147483648)",
+			wrap(ErrInvalidKey, `path step "2147483648"`),
+			"Path step of 2^31, which must be written hardened"},
+		{"pkh(" + xpub + "/1'/*)",
+			wrap(ErrInvalidKey, "%s/1'/*: %v", xpub,
+				hardFromPublic),
+			"Hardened step below an xpub"},
+		{"pkh(" + xpub + "/1/*')",
+			wrap(ErrInvalidKey, "%s/1/*': %v", xpub,
+				hardFromPublic),
+			"Hardened wildcard below an xpub"},
+		{"pkh(" + xpub + "/*/1)", wrap(ErrInvalidKey, `path step "*"`),
+			"Wildcard that isn't the last step"},
+		{"wpkh(" + wifG + "/0)",
+			wrap(ErrInvalidKey, "%s: %v", wifG,
+				bip32.ErrInvalidKeyLen),
+			"Path below a WIF key"},
+		{"multi(0," + keyG + ")", wrap(ErrThreshold, "0 of 1 keys"),
+			"Multisig threshold of 0"},
+		{"multi(3," + keyG + "," + key2G + ")",
+			wrap(ErrThreshold, "3 of 2 keys"),
+			"Multisig threshold above the number of keys"},
+		{"multi(-1," + keyG + ")", wrap(ErrThreshold, "-1 of 1 keys"),
+			"Negative multisig threshold"},
+		{"multi(1," + strings.Join(keys[:4], ",") + ")",
+			wrap(ErrTooManyKeys, "4 in top level"),
+			"Bare multisig of 4 keys"},
+		{"sh(multi(1," + strings.Join(keys[:16], ",") + "))",
+			wrap(ErrScriptSize, "547 bytes"),
+			"Multisig of 16 compressed keys in P2SH, whose " +
+				"redeem script is too large"},
+		{"wsh(multi(1," + strings.Join(keys, ",") + "))",
+			wrap(ErrTooManyKeys, "21 in wsh()"),
+			"Multisig of 21 keys in P2WSH"},
+		{"raw(deadbee)", wrap(ErrSyntax, "raw(deadbee) isn't hex"),
+			"raw() of an odd number of hex digits"},
+		{"addr(1BgGZ9tcN4rm9KBzDn7KprQz87SZ26SAMh)",
+			wrap(ErrInvalidAddress,
+				"1BgGZ9tcN4rm9KBzDn7KprQz87SZ26SAMh"),
+			"Address with a bad checksum"},
+		{"addr(bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t5)",
+			wrap(ErrInvalidAddress, "%s: %v",
+				"bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t5",
+				&bech32.Error{
+					Pos: 41,
+					Err: bech32.ErrInvalidChecksum,
+				}),
+			"Segwit address with a bad checksum"},
+		{"tr(" + keyG + ",{pk(" + key2G + ")})",
+			wrap(ErrSyntax, "taproot branch of 1 trees"),
+			"Taproot branch with a single child"},
+		{"tr(" + keyG + ",pk(" + key2G + "),pk(" + key3G + "))",
+			wrap(ErrSyntax, "tr() takes a key and a tree"),
+			"Taproot leaves outside a branch"},
+		{"tr(" + keyG + "," + deepTree + ")", ErrTreeDepth,
+			"Taproot tree with a leaf at depth 129"},
+	}
+}
+
+// Vectors returns vectors of every expression and kind of key, followed by
+// the addresses of the BIP 44, 49, 84 and 86 test vectors derived from
+// descriptors of their account keys, and the descriptors Parse rejects.
+func Vectors() []Vector {
+	var vectors []Vector
+	for _, vv := range validVectors {
+		net := derivation.Mainnet
+		if vv.testnet {
+			net = derivation.Testnet
+		}
+		v, err := NewVector(vv.desc, vv.index, net, vv.comment)
+		if err != nil {
+			panic(err)
+		}
+		vectors = append(vectors, *v)
+	}
+
+	seed, err := hex.DecodeString(derivation.AbandonSeed)
+	if err != nil {
+		panic(err)
+	}
+	for _, dv := range derivation.SpecVectors() {
+		v, err := walletVector(seed, dv)
+		if err != nil {
+			panic(err)
+		}
+		vectors = append(vectors, *v)
+	}
+
+	for _, iv := range invalidVectors() {
+		vectors = append(vectors, Vector{
+			Descriptor: iv.desc,
+			Net:        derivation.Mainnet,
+			Err:        iv.err,
+			Comment:    iv.comment,
+		})
+	}
+	return vectors
+}
+
+// walletVector returns the vector of the descriptor of a derivation vector's
+// account, with its origin, at the vector's change level and index. Its
+// address must be the derivation vector's.
+func walletVector(seed []byte, dv derivation.Vector) (*Vector, error) {
+	master, err := bip32.NewMaster(seed, dv.Net.Keys)
+	if err != nil {
+		return nil, err
+	}
+	account, err := bip32.ParseKey(dv.AccountKey)
+	if err != nil {
+		return nil, err
+	}
+
+	fingerprint := master.Fingerprint()
+	path := bip32.Path{
+		uint32(dv.Path.Purpose) + bip32.HardenedKeyStart,
+		dv.Path.CoinType + bip32.HardenedKeyStart,
+		dv.Path.Account + bip32.HardenedKeyStart,
+	}
+	key := fmt.Sprintf("[%x%s]%s/%d/*", fingerprint,
+		strings.TrimPrefix(path.String(), "m"),
+		account.WithNetwork(dv.Net.Keys), dv.Path.Change)
+
+	var desc string
+	switch dv.Path.Purpose {
+	case derivation.BIP44:
+		desc = "pkh(" + key + ")"
+	case derivation.BIP49:
+		desc = "sh(wpkh(" + key + "))"
+	case derivation.BIP84:
+		desc = "wpkh(" + key + ")"
+	case derivation.BIP86:
+		desc = "tr(" + key + ")"
+	}
+
+	v, err := NewVector(desc, dv.Path.Index, dv.Net, dv.Comment)
+	if err != nil {
+		return nil, err
+	}
+	if len(v.Addresses) != 1 || v.Addresses[0] != dv.Address {
+		return nil, fmt.Errorf("%w: %s gives %v, expected %s",
+			ErrVectorMismatch, desc, v.Addresses, dv.Address)
+	}
+	return v, nil
+}
+
+// NewVector returns the vector of a valid descriptor, written with or
+// without its checksum, at the index on the network.
+func NewVector(desc string, index uint32, net derivation.Network,
+	comment string) (*Vector, error) {
+
+	d, err := Parse(desc)
+	if err != nil {
+		return nil, err
+	}
+	scripts, err := d.Scripts(index)
+	if err != nil {
+		return nil, err
+	}
+	addresses, err := d.Addresses(index, net)
+	if err != nil && !errors.Is(err, ErrNoAddress) {
+		return nil, err
+	}
+
+	v := &Vector{
+		Descriptor: d.String(),
+		Index:      index,
+		Net:        net,
+		Addresses:  addresses,
+		Comment:    comment,
+	}
+	for _, script := range scripts {
+		v.Scripts = append(v.Scripts, hex.EncodeToString(script))
+	}
+	return v, nil
+}
+
+// randomKey returns a random key expression: a public key in hex, a private
+// key in WIF, or an extended key with a random path, origin and wildcard.
+// Keys for taproot may be x-only.
+func randomKey(rng *rand.Rand, taproot bool) string {
+	var seed [32]byte
+	rng.Read(seed[:])
+	master, err := bip32.NewMaster(seed[:], bip32.Mainnet)
+	if err != nil {
+		panic(err)
+	}
+	if rng.Intn(2) == 0 {
+		master = master.WithNetwork(bip32.Testnet)
+	}
+
+	switch rng.Intn(4) {
+	case 0:
+		pubKey := master.PublicKey()
+		if taproot && rng.Intn(2) == 0 {
+			pubKey = pubKey[1:]
+		}
+		return hex.EncodeToString(pubKey)
+
+	case 1:
+		wif, err := base58.EncodeWIF(master.PrivateKey(), 0x80, true)
+		if err != nil {
+			panic(err)
+		}
+		return wif
+	}
+
+	var key string
+	if rng.Intn(2) == 0 {
+		fingerprint := rng.Uint32()
+		key = fmt.Sprintf("[%08x/%d'/%d'/%dh]", fingerprint,
+			rng.Intn(100), rng.Intn(2), rng.Intn(10))
+	}
+
+	private := rng.Intn(2) == 0
+	if private {
+		key += master.String()
+	} else {
+		key += master.Neuter().String()
+	}
+	for i := rng.Intn(3); i > 0; i-- {
+		if private && rng.Intn(2) == 0 {
+			key += fmt.Sprintf("/%d'", rng.Intn(1000))
+		} else {
+			key += fmt.Sprintf("/%d", rng.Intn(1000))
+		}
+	}
+	switch {
+	case rng.Intn(3) == 0:
+	case private && rng.Intn(2) == 0:
+		key += "/*h"
+	default:
+		key += "/*"
+	}
+	return key
+}
+
+// randomTree returns a random taproot tree of pk() leaves with at most the
+// passed depth.
+func randomTree(rng *rand.Rand, depth int) string {
+	if depth == 0 || rng.Intn(3) == 0 {
+		return "pk(" + randomKey(rng, true) + ")"
+	}
+	return "{" + randomTree(rng, depth-1) + "," +
+		randomTree(rng, depth-1) + "}"
+}
+
+// randomMulti returns a random multisig expression of at most max keys.
+func randomMulti(rng *rand.Rand, max int) string {
+	n := 1 + rng.Intn(max)
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = randomKey(rng, false)
+	}
+	fn := "multi"
+	if rng.Intn(2) == 0 {
+		fn = "sortedmulti"
+	}
+	return fmt.Sprintf("%s(%d,%s)", fn, 1+rng.Intn(n),
+		strings.Join(keys, ","))
+}
+
+// RandomVectors returns count vectors of random descriptors of every kind
+// but raw() and addr(), at random indices on either network. The vectors
+// depend only on rngSeed and count.
+func RandomVectors(rngSeed int64, count int) []Vector {
+	rng := rand.New(rand.NewSource(rngSeed))
+	vectors := make([]Vector, 0, count)
+	for i := 0; i < count; i++ {
+		var desc string
+		switch rng.Intn(8) {
+		case 0:
+			desc = "pkh(" + randomKey(rng, false) + ")"
+		case 1:
+			desc = "wpkh(" + randomKey(rng, false) + ")"
+		case 2:
+			desc = "sh(wpkh(" + randomKey(rng, false) + "))"
+		case 3:
+			desc = "wsh(" + randomMulti(rng, 5) + ")"
+		case 4:
+			desc = "sh(wsh(" + randomMulti(rng, 5) + "))"
+		case 5:
+			desc = "combo(" + randomKey(rng, false) + ")"
+		case 6:
+			desc = "tr(" + randomKey(rng, true) + ")"
+		default:
+			desc = "tr(" + randomKey(rng, true) + "," +
+				randomTree(rng, 4) + ")"
+		}
+
+		net := derivation.Mainnet
+		if rng.Intn(2) == 0 {
+			net = derivation.Testnet
+		}
+		index := uint32(rng.Int31())
+		if rng.Intn(2) == 0 {
+			index %= 100
+		}
+		v, err := NewVector(desc, index, net,
+			fmt.Sprintf("Random descriptor %d", i))
+		if err != nil {
+			panic(err)
+		}
+		vectors = append(vectors, *v)
+	}
+	return vectors
+}
+
+// CheckVector parses the vector's descriptor and checks that it fails as
+// expected, or that it's written with its checksum and derives the vector's
+// scripts and addresses.
+func CheckVector(v Vector) error {
+	d, err := Parse(v.Descriptor)
+	if !vectorfile.SameError(err, v.Err) {
+		return fmt.Errorf("%w: Parse gave %v, expected %v",
+			ErrVectorMismatch, err, v.Err)
+	}
+	if d == nil {
+		return nil
+	}
+	if d.String() != v.Descriptor {
+		return fmt.Errorf("%w: descriptor written as %s",
+			ErrVectorMismatch, d)
+	}
+
+	got, err := NewVector(v.Descriptor, v.Index, v.Net, v.Comment)
+	if err != nil {
+		return err
+	}
+	if strings.Join(got.Scripts, " ") != strings.Join(v.Scripts, " ") {
+		return fmt.Errorf("%w: scripts %v, expected %v",
+			ErrVectorMismatch, got.Scripts, v.Scripts)
+	}
+	if strings.Join(got.Addresses, " ") !=
+		strings.Join(v.Addresses, " ") {
+
+		return fmt.Errorf("%w: addresses %v, expected %v",
+			ErrVectorMismatch, got.Addresses, v.Addresses)
+	}
+	return nil
+}
@@ -0,0 +1,3 @@
+module github.com/christsim/bips/internal
+
+go 1.21
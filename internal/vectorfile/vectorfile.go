@@ -0,0 +1,146 @@
+// Package vectorfile holds the helpers the BIP modules of this repository
+// share to read their vector files and compare the errors they record.
+//
+// Vector files use the layout of the BIP 158 vectors: a JSON array whose first
+// row names the columns, followed by one row per vector. Rows of a single
+// column are comments. Errors are recorded by their message, and an empty
+// message stands for no error.
+package vectorfile
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// RepoPath returns the path of a file of the repository, from the path of its
+// elements relative to the repository's root, so that generators reading the
+// files of other modules find them whatever directory they are run from.
+func RepoPath(elem ...string) string {
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		return filepath.Join(elem...)
+	}
+	root := filepath.Join(filepath.Dir(file), "..", "..")
+	return filepath.Join(append([]string{root}, elem...)...)
+}
+
+// ReadRows reads the rows of a vector file with the passed number of columns,
+// skipping the header row and any other comments.
+func ReadRows(path string, columns int) ([][]json.RawMessage, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rows [][]json.RawMessage
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return nil, err
+	}
+
+	var vectors [][]json.RawMessage
+	for i, row := range rows {
+		if len(row) == 1 {
+			continue
+		}
+		if len(row) != columns {
+			return nil, fmt.Errorf("row %d: expected %d columns, "+
+				"got %d", i, columns, len(row))
+		}
+		vectors = append(vectors, row)
+	}
+	return vectors, nil
+}
+
+// ReadStringRows is like ReadRows for vector files whose columns are all
+// strings.
+func ReadStringRows(path string, columns int) ([][]string, error) {
+	rows, err := ReadRows(path, columns)
+	if err != nil {
+		return nil, err
+	}
+
+	vectors := make([][]string, len(rows))
+	for i, row := range rows {
+		vectors[i] = make([]string, columns)
+		for j, column := range row {
+			if err := json.Unmarshal(column, &vectors[i][j]); err != nil {
+				return nil, fmt.Errorf("column %d: %v", j, err)
+			}
+		}
+	}
+	return vectors, nil
+}
+
+// DecodeRow decodes the columns of a row into the values. A byte slice is
+// decoded from a hex string, an empty one giving nil, and a slice of them
+// from a list of hex strings. Other values are decoded as JSON.
+func DecodeRow(row []json.RawMessage, values ...interface{}) error {
+	for i, value := range values {
+		var err error
+		switch value := value.(type) {
+		case *[]byte:
+			var s string
+			if err = json.Unmarshal(row[i], &s); err == nil {
+				*value, err = decodeHex(s)
+			}
+
+		case *[][]byte:
+			var list []string
+			if err = json.Unmarshal(row[i], &list); err != nil {
+				break
+			}
+			items := make([][]byte, len(list))
+			for j, s := range list {
+				items[j], err = hex.DecodeString(s)
+				if err != nil {
+					break
+				}
+			}
+			*value = items
+
+		default:
+			err = json.Unmarshal(row[i], value)
+		}
+		if err != nil {
+			return fmt.Errorf("column %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// decodeHex decodes a hex string, returning nil for an empty one.
+func decodeHex(s string) ([]byte, error) {
+	if s == "" {
+		return nil, nil
+	}
+	return hex.DecodeString(s)
+}
+
+// ErrorString returns the message of the error, or an empty string for nil.
+func ErrorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// ParseError returns an error of the message, or nil for an empty string.
+func ParseError(s string) error {
+	if s == "" {
+		return nil
+	}
+	return errors.New(s)
+}
+
+// SameError reports whether the errors have the same message, or are both
+// nil.
+func SameError(a, b error) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Error() == b.Error()
+}